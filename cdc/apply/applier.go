@@ -0,0 +1,379 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	"go.uber.org/zap"
+)
+
+const applyInterval = 100 * time.Millisecond
+
+// resolvedOffset is a resolved event of a partition, with the offset of the
+// message next to it
+type resolvedOffset struct {
+	ts     uint64
+	offset int64
+}
+
+type partitionState struct {
+	resolvedTs uint64
+	// rows are the rows received and not applied, in the order of the messages
+	rows []*model.RowChangedEvent
+	// resolved are the resolved events not covered by the checkpoint yet
+	resolved []resolvedOffset
+	// offset is the offset of the partition in the last saved checkpoint
+	offset int64
+}
+
+// Applier applies the open protocol messages consumed from the partitions of
+// a topic to a sink. The rows are buffered until all the partitions are
+// resolved, then the rows of all the partitions are emitted in the order of
+// the commit ts, so the rows of each table are emitted in order even if the
+// table is dispatched to several partitions. The DDLs are executed after all
+// the rows before them are flushed, and the checkpoints are saved after every
+// flush, so that the consuming is resumed from the saved offsets and the rows
+// already applied are dropped by the resolved ts.
+type Applier struct {
+	sink  sink.Sink
+	cfg   *config.ReplicaConfig
+	store CheckpointStore
+
+	mu           sync.Mutex
+	checkpointTs uint64
+	partitions   []*partitionState
+	ddls         []*model.DDLEvent
+	maxDDLTs     uint64
+	bootstraps   []*model.DDLEvent
+	bootstrapTs  map[model.TableName]uint64
+	tableIDs     *fakeTableIDGenerator
+}
+
+// NewApplier creates an Applier resuming from the checkpoint
+func NewApplier(s sink.Sink, cfg *config.ReplicaConfig, store CheckpointStore, checkpoint *Checkpoint) *Applier {
+	a := &Applier{
+		sink:         s,
+		cfg:          cfg,
+		store:        store,
+		checkpointTs: checkpoint.ResolvedTs,
+		maxDDLTs:     checkpoint.ResolvedTs,
+		bootstrapTs:  make(map[model.TableName]uint64),
+		tableIDs:     &fakeTableIDGenerator{tableIDs: make(map[string]int64)},
+	}
+	for _, offset := range checkpoint.Offsets {
+		a.partitions = append(a.partitions, &partitionState{
+			resolvedTs: checkpoint.ResolvedTs,
+			offset:     offset,
+		})
+	}
+	return a
+}
+
+// AddMessage decodes a message consumed from the partition and buffers the
+// events in it
+func (a *Applier) AddMessage(partition int32, offset int64, key, value []byte) error {
+	decoder, err := codec.NewJSONEventBatchDecoder(key, value)
+	if err != nil {
+		return errors.Annotatef(cerror.WrapError(cerror.ErrApplyDecodeMessage, err),
+			"partition %d offset %d", partition, offset)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if partition < 0 || int(partition) >= len(a.partitions) {
+		return cerror.ErrKafkaInvalidPartitionNum.GenWithStackByArgs(partition)
+	}
+	p := a.partitions[partition]
+	for {
+		tp, hasNext, err := decoder.HasNext()
+		if err != nil {
+			return errors.Annotatef(cerror.WrapError(cerror.ErrApplyDecodeMessage, err),
+				"partition %d offset %d", partition, offset)
+		}
+		if !hasNext {
+			return nil
+		}
+		switch tp {
+		case model.MqMessageTypeDDL:
+			ddl, err := decoder.NextDDLEvent()
+			if err != nil {
+				return errors.Annotatef(cerror.WrapError(cerror.ErrApplyDecodeMessage, err),
+					"partition %d offset %d", partition, offset)
+			}
+			a.addDDL(ddl)
+		case model.MqMessageTypeRow:
+			row, err := decoder.NextRowChangedEvent()
+			if err != nil {
+				return errors.Annotatef(cerror.WrapError(cerror.ErrApplyDecodeMessage, err),
+					"partition %d offset %d", partition, offset)
+			}
+			if row.CommitTs <= a.checkpointTs || row.CommitTs <= p.resolvedTs {
+				log.Debug("drop the row already applied",
+					zap.Int32("partition", partition), zap.Int64("offset", offset),
+					zap.Uint64("commitTs", row.CommitTs), zap.Uint64("resolvedTs", p.resolvedTs))
+				continue
+			}
+			// the start ts is not contained in the open protocol
+			row.StartTs = row.CommitTs
+			var partitionID int64
+			if row.Table.IsPartition {
+				partitionID = row.Table.TableID
+			}
+			row.Table.TableID = a.tableIDs.generateFakeTableID(row.Table.Schema, row.Table.Table, partitionID)
+			p.rows = append(p.rows, row)
+		case model.MqMessageTypeResolved:
+			ts, err := decoder.NextResolvedEvent()
+			if err != nil {
+				return errors.Annotatef(cerror.WrapError(cerror.ErrApplyDecodeMessage, err),
+					"partition %d offset %d", partition, offset)
+			}
+			if ts > p.resolvedTs {
+				p.resolvedTs = ts
+				p.resolved = append(p.resolved, resolvedOffset{ts: ts, offset: offset + 1})
+			}
+		}
+	}
+}
+
+// addDDL buffers the DDL, the DDLs are sent to all the partitions, so they're
+// deduplicated by the commit ts
+func (a *Applier) addDDL(ddl *model.DDLEvent) {
+	if ddl.IsBootstrap {
+		table := model.TableName{Schema: ddl.TableInfo.Schema, Table: ddl.TableInfo.Table}
+		if ddl.CommitTs > a.bootstrapTs[table] {
+			a.bootstrapTs[table] = ddl.CommitTs
+			a.bootstraps = append(a.bootstraps, ddl)
+		}
+		return
+	}
+	if ddl.CommitTs <= a.maxDDLTs {
+		return
+	}
+	a.ddls = append(a.ddls, ddl)
+	a.maxDDLTs = ddl.CommitTs
+}
+
+// Run applies the buffered events until the context is canceled or an error
+// occurs
+func (a *Applier) Run(ctx context.Context) error {
+	ticker := time.NewTicker(applyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-ticker.C:
+		}
+		if err := a.apply(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// apply flushes the rows up to the global resolved ts, and executes the DDLs
+// reached by the global resolved ts
+func (a *Applier) apply(ctx context.Context) error {
+	if err := a.applyBootstraps(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	for {
+		resolvedTs, ddl := a.globalResolvedTs()
+		if ddl != nil && resolvedTs >= ddl.CommitTs {
+			if err := a.flush(ctx, ddl.CommitTs-1); err != nil {
+				return errors.Trace(err)
+			}
+			if err := a.execDDL(ctx, ddl); err != nil {
+				return errors.Trace(err)
+			}
+			if err := a.saveCheckpoint(ctx, ddl.CommitTs); err != nil {
+				return errors.Trace(err)
+			}
+			a.mu.Lock()
+			a.ddls = a.ddls[1:]
+			a.mu.Unlock()
+			continue
+		}
+		if ddl != nil && ddl.CommitTs-1 < resolvedTs {
+			resolvedTs = ddl.CommitTs - 1
+		}
+		a.mu.Lock()
+		checkpointTs := a.checkpointTs
+		a.mu.Unlock()
+		if resolvedTs <= checkpointTs {
+			return nil
+		}
+		return a.flush(ctx, resolvedTs)
+	}
+}
+
+// globalResolvedTs returns the minimum resolved ts of the partitions, and the
+// first DDL not executed
+func (a *Applier) globalResolvedTs() (uint64, *model.DDLEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	resolvedTs := uint64(math.MaxUint64)
+	for _, p := range a.partitions {
+		if p.resolvedTs < resolvedTs {
+			resolvedTs = p.resolvedTs
+		}
+	}
+	var ddl *model.DDLEvent
+	if len(a.ddls) > 0 {
+		ddl = a.ddls[0]
+	}
+	return resolvedTs, ddl
+}
+
+// applyBootstraps executes the schema bootstrap events at once, it's safe
+// because the events only contain `CREATE TABLE IF NOT EXISTS` statements.
+func (a *Applier) applyBootstraps(ctx context.Context) error {
+	a.mu.Lock()
+	bootstraps := a.bootstraps
+	a.bootstraps = nil
+	a.mu.Unlock()
+	for _, ddl := range bootstraps {
+		err := a.sink.EmitDDLEvent(ctx, ddl)
+		if err != nil && cerror.ErrDDLEventIgnored.NotEqual(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// flush emits the rows with commit ts not greater than ts, waits for the sink
+// to flush them and saves the checkpoint
+func (a *Applier) flush(ctx context.Context, ts uint64) error {
+	a.mu.Lock()
+	var rows []*model.RowChangedEvent
+	for _, p := range a.partitions {
+		rest := p.rows[:0]
+		for _, row := range p.rows {
+			if row.CommitTs <= ts {
+				rows = append(rows, row)
+			} else {
+				rest = append(rest, row)
+			}
+		}
+		for i := len(rest); i < len(p.rows); i++ {
+			p.rows[i] = nil
+		}
+		p.rows = rest
+	}
+	a.mu.Unlock()
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].CommitTs < rows[j].CommitTs
+	})
+	if err := a.sink.EmitRowChangedEvents(ctx, rows...); err != nil {
+		return errors.Trace(err)
+	}
+	for {
+		checkpointTs, err := sink.FlushCheckpointTs(ctx, a.sink, ts)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if checkpointTs >= ts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return a.saveCheckpoint(ctx, ts)
+}
+
+// execDDL executes the DDL by the changefeed policies, the ignored DDLs and
+// the DDLs not supported by the downstream are skipped as configured.
+func (a *Applier) execDDL(ctx context.Context, ddl *model.DDLEvent) error {
+	err := a.sink.EmitDDLEvent(ctx, ddl)
+	switch {
+	case err == nil:
+		log.Info("apply ddl", zap.String("query", ddl.Query), zap.Uint64("commitTs", ddl.CommitTs))
+		return nil
+	case cerror.ErrDDLEventIgnored.Equal(err):
+		log.Info("ddl is ignored", zap.String("query", ddl.Query), zap.Uint64("commitTs", ddl.CommitTs))
+		return nil
+	case cerror.ErrDDLUnsupportedByDownstream.Equal(err):
+		switch a.cfg.GetDDLUnsupportedAction() {
+		case config.DDLUnsupportedSkip:
+			log.Warn("skip the ddl not supported by the downstream",
+				zap.String("query", ddl.Query), zap.Uint64("commitTs", ddl.CommitTs), zap.Error(err))
+			return nil
+		case config.DDLUnsupportedPause:
+			return cerror.ErrPausedOnUnsupportedDDL.GenWithStackByArgs(ddl.Query)
+		}
+	}
+	return errors.Trace(err)
+}
+
+// saveCheckpoint saves the checkpoint at ts, the offset of each partition is
+// the one next to its last resolved event not greater than ts.
+func (a *Applier) saveCheckpoint(ctx context.Context, ts uint64) error {
+	a.mu.Lock()
+	checkpoint := &Checkpoint{ResolvedTs: ts, Offsets: make([]int64, len(a.partitions))}
+	for i, p := range a.partitions {
+		n := 0
+		for n < len(p.resolved) && p.resolved[n].ts <= ts {
+			p.offset = p.resolved[n].offset
+			n++
+		}
+		p.resolved = p.resolved[n:]
+		checkpoint.Offsets[i] = p.offset
+	}
+	a.checkpointTs = ts
+	a.mu.Unlock()
+	return errors.Trace(a.store.Save(ctx, checkpoint))
+}
+
+// CheckpointTs returns the resolved ts of the last saved checkpoint
+func (a *Applier) CheckpointTs() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.checkpointTs
+}
+
+// fakeTableIDGenerator generates the table IDs required by the sinks, since
+// the table IDs of the upstream are not contained in the open protocol.
+type fakeTableIDGenerator struct {
+	tableIDs       map[string]int64
+	currentTableID int64
+}
+
+func (g *fakeTableIDGenerator) generateFakeTableID(schema, table string, partition int64) int64 {
+	key := quotes.QuoteSchema(schema, table)
+	if partition != 0 {
+		key = fmt.Sprintf("%s.`%d`", key, partition)
+	}
+	if tableID, ok := g.tableIDs[key]; ok {
+		return tableID
+	}
+	g.currentTableID++
+	g.tableIDs[key] = g.currentTableID
+	return g.currentTableID
+}
@@ -0,0 +1,312 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type applierSuite struct{}
+
+var _ = check.Suite(&applierSuite{})
+
+type memCheckpointStore struct {
+	saved []Checkpoint
+}
+
+func (s *memCheckpointStore) Load(ctx context.Context) (*Checkpoint, error) {
+	if len(s.saved) == 0 {
+		return &Checkpoint{}, nil
+	}
+	checkpoint := s.saved[len(s.saved)-1]
+	return &checkpoint, nil
+}
+
+func (s *memCheckpointStore) Save(ctx context.Context, checkpoint *Checkpoint) error {
+	s.saved = append(s.saved, Checkpoint{
+		ResolvedTs: checkpoint.ResolvedTs,
+		Offsets:    append([]int64(nil), checkpoint.Offsets...),
+	})
+	return nil
+}
+
+type mockSink struct {
+	rows     []*model.RowChangedEvent
+	ddls     []string
+	ddlErrs  map[string]error
+	resolved uint64
+}
+
+func (s *mockSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
+	return nil
+}
+
+func (s *mockSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *mockSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	if err, ok := s.ddlErrs[ddl.Query]; ok {
+		return err
+	}
+	s.ddls = append(s.ddls, ddl.Query)
+	return nil
+}
+
+func (s *mockSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	s.resolved = resolvedTs
+	return model.FlushResult{CheckpointTs: resolvedTs}, nil
+}
+
+func (s *mockSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
+	return nil
+}
+
+func (s *mockSink) Close() error {
+	return nil
+}
+
+func (s *mockSink) commitTs() []uint64 {
+	ts := make([]uint64, 0, len(s.rows))
+	for _, row := range s.rows {
+		ts = append(ts, row.CommitTs)
+	}
+	return ts
+}
+
+func rowMessage(c *check.C, table string, commitTs uint64) *codec.MQMessage {
+	encoder := codec.NewJSONEventBatchEncoder()
+	_, err := encoder.AppendRowChangedEvent(&model.RowChangedEvent{
+		CommitTs: commitTs,
+		Table:    &model.TableName{Schema: "test", Table: table},
+		Columns: []*model.Column{
+			{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	return msgs[0]
+}
+
+func resolvedMessage(c *check.C, ts uint64) *codec.MQMessage {
+	msg, err := codec.NewJSONEventBatchEncoder().EncodeCheckpointEvent(ts)
+	c.Assert(err, check.IsNil)
+	return msg
+}
+
+func ddlMessage(c *check.C, query string, commitTs uint64, bootstrap bool) *codec.MQMessage {
+	msg, err := codec.NewJSONEventBatchEncoder().EncodeDDLEvent(&model.DDLEvent{
+		CommitTs:    commitTs,
+		TableInfo:   &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+		Type:        timodel.ActionAddColumn,
+		Query:       query,
+		IsBootstrap: bootstrap,
+	})
+	c.Assert(err, check.IsNil)
+	return msg
+}
+
+// addMessages adds the messages to the partition from the offset
+func addMessages(c *check.C, a *Applier, partition int32, offset int64, msgs ...*codec.MQMessage) {
+	for i, msg := range msgs {
+		err := a.AddMessage(partition, offset+int64(i), msg.Key, msg.Value)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *applierSuite) TestApply(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	store := &memCheckpointStore{}
+	mock := &mockSink{}
+	checkpoint := &Checkpoint{Offsets: []int64{sarama.OffsetOldest, sarama.OffsetOldest}}
+	a := NewApplier(mock, config.GetDefaultReplicaConfig(), store, checkpoint)
+
+	// the table t1 is dispatched to both partitions
+	addMessages(c, a, 0, 0, rowMessage(c, "t1", 5), rowMessage(c, "t2", 7), resolvedMessage(c, 10))
+	addMessages(c, a, 1, 0, rowMessage(c, "t1", 6))
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.rows, check.HasLen, 0)
+	c.Assert(store.saved, check.HasLen, 0)
+
+	// the rows are applied in the order of the commit ts after all the
+	// partitions are resolved
+	addMessages(c, a, 1, 1, resolvedMessage(c, 8))
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.commitTs(), check.DeepEquals, []uint64{5, 6, 7})
+	c.Assert(mock.rows[0].Table.TableID, check.Equals, mock.rows[1].Table.TableID)
+	c.Assert(mock.rows[0].StartTs, check.Equals, uint64(5))
+	c.Assert(mock.resolved, check.Equals, uint64(8))
+	c.Assert(store.saved, check.DeepEquals, []Checkpoint{{ResolvedTs: 8, Offsets: []int64{sarama.OffsetOldest, 2}}})
+
+	// the DDL is sent to all the partitions, and it's executed after the rows
+	// before it are applied
+	addMessages(c, a, 0, 3, ddlMessage(c, "ALTER TABLE t1 ADD COLUMN b int", 12, false), resolvedMessage(c, 12))
+	addMessages(c, a, 1, 2, rowMessage(c, "t1", 11), ddlMessage(c, "ALTER TABLE t1 ADD COLUMN b int", 12, false))
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.commitTs(), check.DeepEquals, []uint64{5, 6, 7})
+	c.Assert(mock.ddls, check.HasLen, 0)
+	addMessages(c, a, 1, 4, resolvedMessage(c, 13), rowMessage(c, "t1", 14))
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.commitTs(), check.DeepEquals, []uint64{5, 6, 7, 11})
+	c.Assert(mock.ddls, check.DeepEquals, []string{"ALTER TABLE t1 ADD COLUMN b int"})
+	c.Assert(store.saved[1:], check.DeepEquals, []Checkpoint{
+		{ResolvedTs: 11, Offsets: []int64{3, 2}},
+		{ResolvedTs: 12, Offsets: []int64{5, 2}},
+	})
+	c.Assert(a.CheckpointTs(), check.Equals, uint64(12))
+
+	// the applier is resumed from the checkpoint, and the events already
+	// applied are dropped
+	checkpoint, err := store.Load(ctx)
+	c.Assert(err, check.IsNil)
+	mock = &mockSink{}
+	a = NewApplier(mock, config.GetDefaultReplicaConfig(), store, checkpoint)
+	addMessages(c, a, 0, 5, resolvedMessage(c, 15))
+	addMessages(c, a, 1, 2, rowMessage(c, "t1", 11), ddlMessage(c, "ALTER TABLE t1 ADD COLUMN b int", 12, false),
+		resolvedMessage(c, 13), rowMessage(c, "t1", 14), resolvedMessage(c, 15))
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.commitTs(), check.DeepEquals, []uint64{14})
+	c.Assert(mock.ddls, check.HasLen, 0)
+	c.Assert(store.saved[len(store.saved)-1], check.DeepEquals, Checkpoint{ResolvedTs: 15, Offsets: []int64{6, 7}})
+
+	msg := rowMessage(c, "t1", 16)
+	msg.Value[len(msg.Value)-1] = '!'
+	err = a.AddMessage(1, 7, msg.Key, msg.Value)
+	c.Assert(err, check.ErrorMatches, "partition 1 offset 7: .*CDC:ErrApplyDecodeMessage.*")
+}
+
+func (s *applierSuite) TestApplyBootstrap(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	mock := &mockSink{}
+	a := NewApplier(mock, config.GetDefaultReplicaConfig(), &memCheckpointStore{}, &Checkpoint{Offsets: []int64{0, 0}})
+
+	// the schema bootstrap events are executed at once and deduplicated
+	bootstrap := ddlMessage(c, "CREATE TABLE IF NOT EXISTS t1(a int primary key)", 3, true)
+	addMessages(c, a, 0, 0, bootstrap, rowMessage(c, "t1", 5))
+	addMessages(c, a, 1, 0, bootstrap)
+	c.Assert(a.apply(ctx), check.IsNil)
+	c.Assert(mock.ddls, check.DeepEquals, []string{"CREATE TABLE IF NOT EXISTS t1(a int primary key)"})
+	c.Assert(mock.rows, check.HasLen, 0)
+}
+
+func (s *applierSuite) TestApplyUnsupportedDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	unsupported := "ALTER TABLE t1 ADD FULLTEXT INDEX idx(b)"
+	for _, tc := range []struct {
+		action string
+		err    *errors.Error
+	}{
+		{config.DDLUnsupportedError, cerror.ErrDDLUnsupportedByDownstream},
+		{config.DDLUnsupportedSkip, nil},
+		{config.DDLUnsupportedPause, cerror.ErrPausedOnUnsupportedDDL},
+	} {
+		cfg := config.GetDefaultReplicaConfig()
+		cfg.DDLUnsupportedAction = tc.action
+		store := &memCheckpointStore{}
+		mock := &mockSink{ddlErrs: map[string]error{
+			unsupported:                    cerror.ErrDDLUnsupportedByDownstream.GenWithStackByArgs(unsupported, "Error 1064"),
+			"ALTER TABLE t1 DROP COLUMN c": cerror.ErrDDLEventIgnored.GenWithStackByArgs(),
+		}}
+		a := NewApplier(mock, cfg, store, &Checkpoint{Offsets: []int64{0}})
+		addMessages(c, a, 0, 0, ddlMessage(c, "ALTER TABLE t1 DROP COLUMN c", 4, false),
+			ddlMessage(c, unsupported, 6, false), resolvedMessage(c, 8))
+		err := a.apply(ctx)
+		if tc.err == nil {
+			c.Assert(err, check.IsNil)
+			c.Assert(a.CheckpointTs(), check.Equals, uint64(8))
+			continue
+		}
+		c.Assert(tc.err.Equal(err), check.IsTrue, check.Commentf("%s: %v", tc.action, err))
+		// the applier is resumed before the DDL
+		c.Assert(a.CheckpointTs(), check.Equals, uint64(5))
+	}
+}
+
+func (s *applierSuite) TestParseKafkaURI(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg, err := parseKafkaURI("kafka://127.0.0.1:9092,127.0.0.1:9093/topic?partition-num=3")
+	c.Assert(err, check.IsNil)
+	c.Assert(cfg, check.DeepEquals, &kafkaConfig{
+		addrs:        []string{"127.0.0.1:9092", "127.0.0.1:9093"},
+		topic:        "topic",
+		version:      "2.4.0",
+		partitionNum: 3,
+		groupID:      defaultConsumerGroupID,
+	})
+	saramaCfg, err := newSaramaConfig(cfg, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(saramaCfg.Consumer.Offsets.AutoCommit.Enable, check.IsFalse)
+
+	for _, uri := range []string{
+		"mysql://127.0.0.1:3306/",
+		"kafka://127.0.0.1:9092/",
+		"kafka://127.0.0.1:9092/topic?partition-num=0",
+	} {
+		_, err := parseKafkaURI(uri)
+		c.Assert(cerror.ErrApplyInvalidUpstream.Equal(err), check.IsTrue, check.Commentf("%s", uri))
+	}
+}
+
+func (s *applierSuite) TestKafkaCheckpointStoreCommitError(c *check.C) {
+	defer testleak.AfterTest(c)()
+	broker := sarama.NewMockBroker(c, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("topic", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(c).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(c).
+			SetOffset("group", "topic", 0, -1, "", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(c).
+			SetError("group", "topic", 0, sarama.ErrOffsetMetadataTooLarge),
+	})
+	cfg, err := parseKafkaURI("kafka://" + broker.Addr() + "/topic?partition-num=1&consumer-group-id=group")
+	c.Assert(err, check.IsNil)
+	saramaCfg, err := newSaramaConfig(cfg, nil)
+	c.Assert(err, check.IsNil)
+	saramaCfg.Metadata.Retry.Max = 1
+	client, err := sarama.NewClient([]string{broker.Addr()}, saramaCfg)
+	c.Assert(err, check.IsNil)
+	defer client.Close() //nolint:errcheck
+	store, err := newKafkaCheckpointStore(client, "group", "topic", 1)
+	c.Assert(err, check.IsNil)
+	defer store.close()
+
+	// the error of the commit is returned instead of blocking the offset
+	// manager
+	err = store.Save(context.Background(), &Checkpoint{ResolvedTs: 10, Offsets: []int64{5}})
+	c.Assert(err, check.ErrorMatches, ".*commit the apply checkpoint.*metadata.*")
+	c.Assert(store.drainErrors(), check.IsNil)
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// Checkpoint is the progress of the applier. All the rows with commit ts not
+// greater than ResolvedTs are applied to the downstream, and the consuming of
+// each partition is resumed from its offset in Offsets.
+type Checkpoint struct {
+	ResolvedTs uint64
+	Offsets    []int64
+}
+
+// CheckpointStore persists the checkpoints of the applier
+type CheckpointStore interface {
+	// Load returns the last saved checkpoint
+	Load(ctx context.Context) (*Checkpoint, error)
+	// Save persists the checkpoint
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+}
+
+// kafkaCheckpointStore commits the offsets of the partitions to the consumer
+// group, with the resolved ts of the checkpoint as the metadata of the offsets.
+type kafkaCheckpointStore struct {
+	manager    sarama.OffsetManager
+	partitions []sarama.PartitionOffsetManager
+}
+
+func newKafkaCheckpointStore(client sarama.Client, groupID, topic string, partitionNum int32) (*kafkaCheckpointStore, error) {
+	manager, err := sarama.NewOffsetManagerFromClient(groupID, client)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	store := &kafkaCheckpointStore{manager: manager}
+	for i := int32(0); i < partitionNum; i++ {
+		pom, err := manager.ManagePartition(topic, i)
+		if err != nil {
+			store.close()
+			return nil, errors.Trace(err)
+		}
+		store.partitions = append(store.partitions, pom)
+	}
+	return store, nil
+}
+
+// Load implements CheckpointStore. The partitions without committed offsets
+// are consumed from the oldest offset, and the rows already applied in them
+// are dropped by the resolved ts.
+func (s *kafkaCheckpointStore) Load(ctx context.Context) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Offsets: make([]int64, len(s.partitions))}
+	committed := false
+	for i, pom := range s.partitions {
+		offset, metadata := pom.NextOffset()
+		if offset < 0 || metadata == "" {
+			checkpoint.Offsets[i] = sarama.OffsetOldest
+			continue
+		}
+		ts, err := strconv.ParseUint(metadata, 10, 64)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse the resolved ts of partition %d", i)
+		}
+		if !committed || ts < checkpoint.ResolvedTs {
+			checkpoint.ResolvedTs = ts
+		}
+		committed = true
+		checkpoint.Offsets[i] = offset
+	}
+	return checkpoint, nil
+}
+
+// Save implements CheckpointStore
+func (s *kafkaCheckpointStore) Save(ctx context.Context, checkpoint *Checkpoint) error {
+	metadata := strconv.FormatUint(checkpoint.ResolvedTs, 10)
+	for i, pom := range s.partitions {
+		offset := checkpoint.Offsets[i]
+		if offset < 0 {
+			continue
+		}
+		// the offset is not changed if the partition is idle, but the resolved
+		// ts in the metadata is still updated
+		if current, _ := pom.NextOffset(); offset > current {
+			pom.MarkOffset(offset, metadata)
+		} else {
+			pom.ResetOffset(offset, metadata)
+		}
+	}
+	s.manager.Commit()
+	// the errors of the commit are sent to the partitions, they must be
+	// drained, otherwise the offset manager is blocked once the channels are
+	// full.
+	if err := s.drainErrors(); err != nil {
+		return errors.Annotate(err, "commit the apply checkpoint")
+	}
+	log.Debug("apply checkpoint saved",
+		zap.Uint64("resolvedTs", checkpoint.ResolvedTs), zap.Int64s("offsets", checkpoint.Offsets))
+	return nil
+}
+
+// drainErrors drains the errors of the partitions without blocking, all the
+// errors are logged and the first one is returned.
+func (s *kafkaCheckpointStore) drainErrors() error {
+	var firstErr error
+	for _, pom := range s.partitions {
+	drain:
+		for {
+			select {
+			case cErr, ok := <-pom.Errors():
+				if !ok {
+					break drain
+				}
+				log.Warn("commit the offset of the partition failed",
+					zap.String("topic", cErr.Topic), zap.Int32("partition", cErr.Partition),
+					zap.Error(cErr.Err))
+				if firstErr == nil {
+					firstErr = cErr
+				}
+			default:
+				break drain
+			}
+		}
+	}
+	return errors.Trace(firstErr)
+}
+
+func (s *kafkaCheckpointStore) close() {
+	// the partitions are released by the offset manager when it's closed,
+	// closing a partition with an uncommitted offset first blocks forever
+	// since the offsets are never committed automatically.
+	for _, pom := range s.partitions {
+		pom.AsyncClose()
+	}
+	if err := s.manager.Close(); err != nil {
+		log.Warn("close the offset manager failed", zap.Error(err))
+	}
+	for _, pom := range s.partitions {
+		for cErr := range pom.Errors() {
+			log.Warn("close the partition offset manager failed",
+				zap.String("topic", cErr.Topic), zap.Int32("partition", cErr.Partition),
+				zap.Error(cErr.Err))
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/security"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultConsumerGroupID = "ticdc-apply"
+
+// kafkaConfig is the config of the upstream Kafka, which is parsed from the
+// upstream URI in the form of
+// kafka://127.0.0.1:9092/topic?version=2.4.0&partition-num=3&consumer-group-id=ticdc-apply
+type kafkaConfig struct {
+	addrs        []string
+	topic        string
+	version      string
+	partitionNum int32
+	groupID      string
+}
+
+func parseKafkaURI(upstreamURI string) (*kafkaConfig, error) {
+	uri, err := url.Parse(upstreamURI)
+	if err != nil {
+		return nil, cerror.ErrApplyInvalidUpstream.GenWithStackByArgs(err.Error())
+	}
+	if strings.ToLower(uri.Scheme) != "kafka" {
+		return nil, cerror.ErrApplyInvalidUpstream.GenWithStackByArgs(
+			fmt.Sprintf("unsupported scheme %s, only kafka is supported", uri.Scheme))
+	}
+	cfg := &kafkaConfig{
+		addrs:   strings.Split(uri.Host, ","),
+		topic:   strings.TrimFunc(uri.Path, func(r rune) bool { return r == '/' }),
+		version: uri.Query().Get("version"),
+		groupID: uri.Query().Get("consumer-group-id"),
+	}
+	if cfg.topic == "" {
+		return nil, cerror.ErrApplyInvalidUpstream.GenWithStackByArgs("the topic is empty")
+	}
+	if cfg.version == "" {
+		cfg.version = "2.4.0"
+	}
+	if cfg.groupID == "" {
+		cfg.groupID = defaultConsumerGroupID
+	}
+	if s := uri.Query().Get("partition-num"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n <= 0 {
+			return nil, cerror.ErrApplyInvalidUpstream.GenWithStackByArgs(
+				fmt.Sprintf("invalid partition-num %s", s))
+		}
+		cfg.partitionNum = int32(n)
+	}
+	return cfg, nil
+}
+
+func newSaramaConfig(cfg *kafkaConfig, credential *security.Credential) (*sarama.Config, error) {
+	saramaCfg := sarama.NewConfig()
+	version, err := sarama.ParseKafkaVersion(cfg.version)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrKafkaInvalidVersion, err)
+	}
+	saramaCfg.Version = version
+	saramaCfg.ClientID = "ticdc_apply_" + cfg.groupID
+	saramaCfg.Metadata.Retry.Max = 120
+	saramaCfg.Metadata.Retry.Backoff = 500 * time.Millisecond
+	// the offsets are committed with the checkpoints only
+	saramaCfg.Consumer.Offsets.AutoCommit.Enable = false
+	saramaCfg.Consumer.Return.Errors = true
+	if credential != nil && len(credential.CAPath) != 0 {
+		saramaCfg.Net.TLS.Enable = true
+		saramaCfg.Net.TLS.Config, err = credential.ToTLSConfig()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return saramaCfg, nil
+}
+
+// Run consumes the open protocol messages of the topic in the upstream URI
+// from the last checkpoint, and applies them to the sink until the context is
+// canceled or an error occurs.
+func Run(ctx context.Context, id string, upstreamURI, sinkURI string, cfg *config.ReplicaConfig, credential *security.Credential) error {
+	kafkaCfg, err := parseKafkaURI(upstreamURI)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	saramaCfg, err := newSaramaConfig(kafkaCfg, credential)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	client, err := sarama.NewClient(kafkaCfg.addrs, saramaCfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer client.Close()
+	partitions, err := client.Partitions(kafkaCfg.topic)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	partitionNum := int32(len(partitions))
+	if kafkaCfg.partitionNum != 0 {
+		if kafkaCfg.partitionNum > partitionNum {
+			return cerror.ErrKafkaInvalidPartitionNum.GenWithStackByArgs(kafkaCfg.partitionNum)
+		}
+		partitionNum = kafkaCfg.partitionNum
+	}
+
+	store, err := newKafkaCheckpointStore(client, kafkaCfg.groupID, kafkaCfg.topic, partitionNum)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer store.close()
+	checkpoint, err := store.Load(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("apply is started",
+		zap.String("topic", kafkaCfg.topic), zap.String("consumerGroupID", kafkaCfg.groupID),
+		zap.Uint64("checkpointTs", checkpoint.ResolvedTs), zap.Int64s("offsets", checkpoint.Offsets))
+
+	f, err := filter.NewFilter(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	errCh := make(chan error, 1)
+	s, err := sink.NewSink(ctx, id, sinkURI, f, cfg, map[string]string{}, errCh)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer s.Close() //nolint:errcheck
+	applier := NewApplier(s, cfg, store, checkpoint)
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer consumer.Close()
+	errg, ctx := errgroup.WithContext(ctx)
+	for i := int32(0); i < partitionNum; i++ {
+		partition := i
+		errg.Go(func() error {
+			pc, err := consumer.ConsumePartition(kafkaCfg.topic, partition, checkpoint.Offsets[partition])
+			if err != nil {
+				return errors.Trace(err)
+			}
+			defer pc.AsyncClose()
+			for {
+				select {
+				case <-ctx.Done():
+					return errors.Trace(ctx.Err())
+				case err := <-pc.Errors():
+					return errors.Trace(err)
+				case msg := <-pc.Messages():
+					if err := applier.AddMessage(partition, msg.Offset, msg.Key, msg.Value); err != nil {
+						return errors.Trace(err)
+					}
+				}
+			}
+		})
+	}
+	errg.Go(func() error {
+		return applier.Run(ctx)
+	})
+	errg.Go(func() error {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case err := <-errCh:
+			return errors.Trace(err)
+		}
+	})
+	err = errg.Wait()
+	log.Info("apply is stopped", zap.Uint64("checkpointTs", applier.CheckpointTs()), zap.Error(err))
+	return err
+}
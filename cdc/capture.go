@@ -24,8 +24,11 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/security"
+	"github.com/pingcap/ticdc/pkg/timewheel"
 	"github.com/pingcap/ticdc/pkg/util"
 	pd "github.com/tikv/pd/client"
 	"go.etcd.io/etcd/clientv3"
@@ -45,6 +48,11 @@ const (
 // processorOpts records options for processor
 type processorOpts struct {
 	flushCheckpointInterval time.Duration
+	// observer makes the capture read-only, it's never scheduled any table
+	observer bool
+	// zone is the zone of the capture, the tables are preferred to be
+	// scheduled to the captures in the zones of their leaders
+	zone string
 }
 
 // Capture represents a Capture server, it monitors the changefeed information in etcd and schedules Task on it.
@@ -63,6 +71,10 @@ type Capture struct {
 	election *concurrency.Election
 
 	opts *processorOpts
+	// ddlPuller is shared by the processors if it's not nil
+	ddlPuller *sharedDDLPuller
+	// wheel drives the periodic work of the processors
+	wheel *timewheel.Wheel
 }
 
 // NewCapture returns a new Capture instance
@@ -112,14 +124,19 @@ func NewCapture(
 	if err != nil {
 		return nil, errors.Annotate(cerror.WrapError(cerror.ErrNewCaptureFailed, err), "create capture session")
 	}
-	elec := concurrency.NewElection(sess, kv.CaptureOwnerKey)
 	cli := kv.NewCDCEtcdClient(ctx, etcdCli)
+	elec := concurrency.NewElection(sess, cli.CaptureOwnerKey())
 	id := uuid.New().String()
 	info := &model.CaptureInfo{
 		ID:            id,
 		AdvertiseAddr: advertiseAddr,
+		Observer:      opts != nil && opts.observer,
 	}
-	log.Info("creating capture", zap.String("capture-id", id), util.ZapFieldCapture(ctx))
+	if opts != nil {
+		info.Zone = opts.zone
+	}
+	log.Info("creating capture", zap.String("capture-id", id),
+		zap.Bool("observer", info.Observer), zap.String("zone", info.Zone), util.ZapFieldCapture(ctx))
 
 	c = &Capture{
 		processors: make(map[string]*processor),
@@ -130,6 +147,17 @@ func NewCapture(
 		info:       info,
 		opts:       opts,
 		pdCli:      pdCli,
+		wheel:      timewheel.NewWheel(processorWheelResolution, processorWheelSlots),
+	}
+	if cfg := config.GetDDLPullerConfig(); cfg.Shared && !info.Observer {
+		c.ddlPuller = newSharedDDLPuller(ctx, cfg.MaxSharedEntries, func(ctx context.Context, startTs uint64) puller.Puller {
+			kvStorage, err := util.KVStorageFromCtx(ctx)
+			if err != nil {
+				log.Panic("kv storage is not set in the context of the capture", zap.Error(err))
+			}
+			return puller.NewPuller(ctx, pdCli, credential, kvStorage, startTs, ddlSpans(),
+				puller.NewBlurResourceLimmter(defaultMemBufferCapacity), false)
+		})
 	}
 
 	return
@@ -140,16 +168,28 @@ func (c *Capture) Run(ctx context.Context) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	// TODO: we'd better to add some wait mechanism to ensure no routine is blocked
 	defer cancel()
+	defer c.ddlPuller.close()
+	go c.wheel.Run(ctx)
 	err = c.register(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	// the errors of the processors which failed to be recorded in etcd are
+	// uploaded once the capture is connected to etcd again
+	if err := uploadCrashRecords(ctx, c.etcdClient, c.info.AdvertiseAddr); err != nil {
+		log.Warn("failed to upload the crash records of the processors", zap.Error(err))
+	}
+	if c.info.Observer {
+		return c.runObserver(ctx)
+	}
 
 	taskWatcher := NewTaskWatcher(c, &TaskWatcherConfig{
-		Prefix:      kv.TaskStatusKeyPrefix + "/" + c.info.ID,
+		Prefix:      c.etcdClient.TaskStatusKeyPrefix() + "/" + c.info.ID,
 		ChannelSize: 128,
 	})
 	log.Info("waiting for tasks", zap.String("capture-id", c.info.ID))
+	handler := newTaskHandler(ctx, c, c.info.AdvertiseAddr)
+	defer handler.close()
 	var ev *TaskEvent
 	wch := taskWatcher.Watch(ctx)
 	for {
@@ -162,6 +202,7 @@ func (c *Capture) Run(ctx context.Context) (err error) {
 		case <-c.session.Done():
 			if ctx.Err() != context.Canceled {
 				log.Info("capture session done, capture suicide itself", zap.String("capture-id", c.info.ID))
+				recordSessionLoss(c.info.AdvertiseAddr, c.session.Lease())
 				return cerror.ErrCaptureSuicide.GenWithStackByArgs()
 			}
 		case ev = <-wch:
@@ -171,22 +212,48 @@ func (c *Capture) Run(ctx context.Context) (err error) {
 			if ev.Err != nil {
 				return errors.Trace(ev.Err)
 			}
-			failpoint.Inject("captureHandleTaskDelay", nil)
-			if err := c.handleTaskEvent(ctx, ev); err != nil {
-				// We check ttl of lease instead of check `session.Done`, because
-				// `session.Done` is only notified when etcd client establish a
-				// new keepalive request, there could be a time window as long as
-				// 1/3 of session ttl that `session.Done` can't be triggered even
-				// the lease is already revoked.
-				lease, inErr := c.etcdClient.Client.TimeToLive(ctx, c.session.Lease())
-				if inErr != nil {
-					return cerror.WrapError(cerror.ErrPDEtcdAPIError, inErr)
-				}
-				if lease.TTL == int64(-1) {
-					log.Warn("handle task event failed because session is disconnected", zap.Error(err))
-					return cerror.ErrCaptureSuicide.GenWithStackByArgs()
-				}
-				return errors.Trace(err)
+			handler.dispatch(ev)
+		case err := <-handler.errorCh():
+			// We check ttl of lease instead of check `session.Done`, because
+			// `session.Done` is only notified when etcd client establish a
+			// new keepalive request, there could be a time window as long as
+			// 1/3 of session ttl that `session.Done` can't be triggered even
+			// the lease is already revoked.
+			lease, inErr := c.etcdClient.Client.TimeToLive(ctx, c.session.Lease())
+			if inErr != nil {
+				return cerror.WrapError(cerror.ErrPDEtcdAPIError, inErr)
+			}
+			if lease.TTL == int64(-1) {
+				log.Warn("handle task event failed because session is disconnected", zap.Error(err))
+				recordSessionLoss(c.info.AdvertiseAddr, c.session.Lease())
+				return cerror.ErrCaptureSuicide.GenWithStackByArgs()
+			}
+			return errors.Trace(err)
+		}
+	}
+}
+
+// runObserver runs the observer capture, which exports the metrics derived
+// from the states in etcd until the session is done, no task is handled.
+func (c *Capture) runObserver(ctx context.Context) error {
+	log.Info("running as an observer", zap.String("capture-id", c.info.ID))
+	observer := newChangefeedObserver(c.etcdClient)
+	defer observer.close()
+	ticker := time.NewTicker(observerMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.session.Done():
+			if ctx.Err() != context.Canceled {
+				log.Info("capture session done, capture suicide itself", zap.String("capture-id", c.info.ID))
+				recordSessionLoss(c.info.AdvertiseAddr, c.session.Lease())
+				return cerror.ErrCaptureSuicide.GenWithStackByArgs()
+			}
+		case <-ticker.C:
+			if err := observer.observe(ctx, time.Now()); err != nil {
+				log.Warn("observe the changefeeds failed", zap.Error(err))
 			}
 		}
 	}
@@ -223,24 +290,39 @@ func (c *Capture) Close(ctx context.Context) error {
 	return errors.Trace(c.etcdClient.DeleteCaptureInfo(ctx, c.info.ID))
 }
 
-func (c *Capture) handleTaskEvent(ctx context.Context, ev *TaskEvent) error {
-	task := ev.Task
-	if ev.Op == TaskOpCreate {
-		if _, ok := c.processors[task.ChangeFeedID]; !ok {
-			p, err := c.assignTask(ctx, task)
-			if err != nil {
-				return err
-			}
-			c.processors[task.ChangeFeedID] = p
-		}
-	} else if ev.Op == TaskOpDelete {
-		if p, ok := c.processors[task.ChangeFeedID]; ok {
-			if err := p.stop(ctx); err != nil {
-				return errors.Trace(err)
-			}
-			delete(c.processors, task.ChangeFeedID)
-		}
+// getProcessor returns the processor of the changefeed running in the capture,
+// nil is returned if it's not found.
+func (c *Capture) getProcessor(changefeedID model.ChangeFeedID) *processor {
+	c.procLock.Lock()
+	defer c.procLock.Unlock()
+	return c.processors[changefeedID]
+}
+
+// startTask starts the processor of the task, it's called by the task handler.
+func (c *Capture) startTask(ctx context.Context, task *Task) error {
+	p, err := c.assignTask(ctx, task)
+	if err != nil {
+		return err
+	}
+	c.procLock.Lock()
+	c.processors[task.ChangeFeedID] = p
+	c.procLock.Unlock()
+	return nil
+}
+
+// stopTask stops the processor of the changefeed, it returns after the sink is
+// closed and the task keys are deleted. It's called by the task handler.
+func (c *Capture) stopTask(ctx context.Context, changefeedID model.ChangeFeedID) error {
+	p := c.getProcessor(changefeedID)
+	if p == nil {
+		return nil
+	}
+	if err := p.stop(ctx); err != nil {
+		return errors.Trace(err)
 	}
+	c.procLock.Lock()
+	delete(c.processors, changefeedID)
+	c.procLock.Unlock()
 	return nil
 }
 
@@ -263,7 +345,7 @@ func (c *Capture) assignTask(ctx context.Context, task *Task) (*processor, error
 		zap.String("changefeed", task.ChangeFeedID))
 
 	p, err := runProcessorImpl(
-		ctx, c.pdCli, c.credential, c.session, *cf, task.ChangeFeedID, *c.info, task.CheckpointTS, c.opts.flushCheckpointInterval)
+		ctx, c.pdCli, c.credential, c.session, *cf, task.ChangeFeedID, *c.info, task.CheckpointTS, c.opts.flushCheckpointInterval, c.ddlPuller, c.wheel)
 	if err != nil {
 		log.Error("run processor failed",
 			zap.String("changefeed", task.ChangeFeedID),
@@ -275,6 +357,37 @@ func (c *Capture) assignTask(ctx context.Context, task *Task) (*processor, error
 	return p, nil
 }
 
+// runResourceMonitor monitors the resource usage of the capture, and pauses
+// the changefeeds running in the capture under resource pressure.
+func (c *Capture) runResourceMonitor(ctx context.Context, cfg *config.ResourceMonitorConfig) error {
+	if cfg == nil || cfg.CheckInterval == 0 {
+		return nil
+	}
+	monitor := newResourceMonitor(cfg, systemResourceReader{}, c.info.AdvertiseAddr)
+	return monitor.run(ctx, c.resourceConsumers)
+}
+
+func (c *Capture) resourceConsumers() []*resourceConsumer {
+	c.procLock.Lock()
+	defer c.procLock.Unlock()
+	consumers := make([]*resourceConsumer, 0, len(c.processors))
+	for changefeedID, p := range c.processors {
+		p := p
+		consumer := &resourceConsumer{
+			changefeedID: changefeedID,
+			priority:     p.changefeed.Config.Priority,
+			pause: func(err error) {
+				p.errs.collect(errOriginProcessor, err)
+			},
+		}
+		if p.changefeed.Engine != model.SortInMemory {
+			consumer.sortDir = p.changefeed.SortDir
+		}
+		consumers = append(consumers, consumer)
+	}
+	return consumers
+}
+
 // register registers the capture information in etcd
 func (c *Capture) register(ctx context.Context) error {
 	err := c.etcdClient.PutCaptureInfo(ctx, c.info, c.session.Lease())
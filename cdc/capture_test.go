@@ -21,13 +21,13 @@ import (
 
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
-	"github.com/pingcap/failpoint"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/etcd"
 	"github.com/pingcap/ticdc/pkg/security"
+	"github.com/pingcap/ticdc/pkg/timewheel"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	pd "github.com/tikv/pd/client"
@@ -115,18 +115,20 @@ func (s *captureSuite) TestCaptureSessionDoneDuringHandleTask(c *check.C) {
 	c.Assert(err, check.IsNil)
 
 	runProcessorCount := 0
-	err = failpoint.Enable("github.com/pingcap/ticdc/cdc/captureHandleTaskDelay", "sleep(500)")
-	c.Assert(err, check.IsNil)
-	defer func() {
-		_ = failpoint.Disable("github.com/pingcap/ticdc/cdc/captureHandleTaskDelay")
-	}()
+	// handling is closed once the task is being handled, the handling waits
+	// for the session to be disconnected
+	handling := make(chan struct{})
+	disconnected := make(chan struct{})
 	runProcessorBackup := runProcessorImpl
 	runProcessorImpl = func(
 		ctx context.Context, _ pd.Client, _ *security.Credential,
 		session *concurrency.Session, info model.ChangeFeedInfo, changefeedID string,
 		captureInfo model.CaptureInfo, checkpointTs uint64, flushCheckpointInterval time.Duration,
+		_ *sharedDDLPuller, _ *timewheel.Wheel,
 	) (*processor, error) {
 		runProcessorCount++
+		close(handling)
+		<-disconnected
 		etcdCli := kv.NewCDCEtcdClient(ctx, session.Client())
 		_, _, err := etcdCli.GetTaskStatus(ctx, changefeedID, captureInfo.ID)
 		return nil, err
@@ -159,14 +161,16 @@ func (s *captureSuite) TestCaptureSessionDoneDuringHandleTask(c *check.C) {
 	// step-1
 	err = s.client.PutTaskStatus(ctx, changefeedID, capture.info.ID, &model.TaskStatus{})
 	c.Assert(err, check.IsNil)
-	// sleep 100ms to ensure step-2 happens, the failpoint injected delay will ensure step-4 is after step-3
-	time.Sleep(time.Millisecond * 100)
+	// step-2
+	<-handling
 
 	// step-3
 	_, err = s.client.Client.Revoke(ctx, capture.session.Lease())
 	c.Assert(err, check.IsNil)
+	// step-4
 	err = s.client.DeleteTaskStatus(ctx, changefeedID, capture.info.ID)
 	c.Assert(err, check.IsNil)
+	close(disconnected)
 
 	wg.Wait()
 
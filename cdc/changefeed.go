@@ -17,6 +17,8 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -36,6 +38,7 @@ import (
 	"github.com/pingcap/tidb/sessionctx/binloginfo"
 	"go.etcd.io/etcd/mvcc/mvccpb"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 type tableIDMap = map[model.TableID]struct{}
@@ -67,6 +70,10 @@ type ChangeFeedRWriter interface {
 	// mapping from captureID to TaskPositions
 	GetAllTaskPositions(ctx context.Context, changefeedID string) (map[string]*model.TaskPosition, error)
 
+	// GetProcessorInfosOfLiveCaptures queries all task status and the task positions
+	// of the live captures of a changefeed at the same revision
+	GetProcessorInfosOfLiveCaptures(ctx context.Context, changefeedID string) (int64, model.ProcessorsInfos, map[string]*model.TaskPosition, error)
+
 	// RemoveAllTaskPositions removes all task partitions of a changefeed
 	RemoveAllTaskPositions(ctx context.Context, changefeedID string) error
 
@@ -93,15 +100,47 @@ type changeFeed struct {
 	taskStatus       model.ProcessorsInfos
 	taskPositions    map[model.CaptureID]*model.TaskPosition
 	filter           *filter.Filter
+	tableStartTs     *tableStartTsMatcher
+	partitionPolicy  *partitionPolicyMatcher
 	sink             sink.Sink
 	scheduler        scheduler.Scheduler
+	// locality is the locality of the tables resolved by localityResolver in
+	// the current tick, nil if it's disabled
+	localityResolver *localityResolver
+	locality         *scheduler.Locality
 
 	cyclicEnabled bool
 
+	// schemaBootstrap indicates whether to send schema bootstrap events,
+	// bootstrapTables are the tables waiting to be bootstrapped.
+	schemaBootstrap   bool
+	bootstrapTables   map[model.TableID]struct{}
+	lastBootstrapTime map[model.TableID]time.Time
+
 	ddlHandler    OwnerDDLHandler
 	ddlResolvedTs uint64
 	ddlJobHistory []*timodel.Job
 	ddlExecutedTs uint64
+	// ddlExecution is the DDL being executed by the sink, it's nil if there
+	// is none.
+	ddlExecution *ddlExecution
+	// recoveredDDL is the DDL dispatched to the downstream by a previous
+	// owner without being recorded as done, it's nil if there is none.
+	recoveredDDL *recoveredDDL
+
+	// ddlRateLimiter limits the rate of executing DDLs in the downstream,
+	// it's nil if the rate is unlimited.
+	ddlRateLimiter    *rate.Limiter
+	throttledDDLJobID int64
+	// throttledDDL is the DDL waiting for the rate limiter to be executed in
+	// the downstream, it's nil if there is none.
+	throttledDDL *throttledDDL
+	// skipDDLJobs are the queued DDL jobs which are skipped by operator.
+	skipDDLJobs map[int64]struct{}
+
+	// steadySince is when the changefeed last entered the steady state before
+	// the initial scan milestone is reached, zero if it's not in the state.
+	steadySince time.Time
 
 	schemas map[model.SchemaID]tableIDMap
 	tables  map[model.TableID]model.TableName
@@ -115,12 +154,42 @@ type changeFeed struct {
 
 	lastRebalanceTime time.Time
 
+	// addTableFailures are the captures which failed to add the tables, they
+	// are excluded when the tables are dispatched again.
+	addTableFailures map[model.TableID]*addTableFailure
+	// swappedTables are the new physical tables created by the truncate DDLs
+	// to the truncated ones they replace, each pair is dispatched to the
+	// capture of the truncated table in one operation.
+	swappedTables map[model.TableID]model.TableID
+
 	etcdCli kv.CDCEtcdClient
+	// statusWriter persists the status with the executing DDL before the DDL
+	// is dispatched to the downstream
+	statusWriter changefeedStatusWriter
+	history      *historyRecorder
+	// objectDDLSkipTs is the finished ts of the last skipped DDL of a view or
+	// a sequence recorded in the history
+	objectDDLSkipTs uint64
 
 	// context cancel function for all internal goroutines
 	cancel context.CancelFunc
 }
 
+// addTableFailureTTL is the duration the captures which failed to add a table
+// are excluded for, so the table is retried on them once they may have
+// recovered, e.g. the disk space is freed.
+const addTableFailureTTL = time.Minute
+
+// addTableFailure records the captures which failed to add a table.
+type addTableFailure struct {
+	// reasons are the errors reported by the captures
+	reasons map[model.CaptureID]string
+	// schemaError is set if the downstream schema of the table is
+	// incompatible, which fails the table on any capture
+	schemaError string
+	lastTime    time.Time
+}
+
 // String implements fmt.Stringer interface.
 func (c *changeFeed) String() string {
 	format := "{\n ID: %s\n info: %+v\n status: %+v\n State: %v\n ProcessorInfos: %+v\n tables: %+v\n orphanTables: %+v\n toCleanTables: %v\n ddlResolvedTs: %d\n ddlJobHistory: %+v\n}\n\n"
@@ -141,6 +210,62 @@ func (c *changeFeed) updateProcessorInfos(processInfos model.ProcessorsInfos, po
 	c.taskPositions = positions
 }
 
+// scanProgress sums up the incremental scan progress reported by the processors,
+// it returns nil if no processor is initializing.
+func (c *changeFeed) scanProgress() *model.IncrementalScanProgress {
+	var progress *model.IncrementalScanProgress
+	for _, position := range c.taskPositions {
+		if position.ScanProgress == nil {
+			continue
+		}
+		if progress == nil {
+			progress = new(model.IncrementalScanProgress)
+		}
+		progress.Add(*position.ScanProgress)
+	}
+	return progress
+}
+
+// largeTxns describes the large transactions reported by the processors, the
+// largest transaction is the first.
+func (c *changeFeed) largeTxns() []string {
+	var txns []*model.LargeTxnInfo
+	for _, position := range c.taskPositions {
+		txns = append(txns, position.LargeTxns...)
+	}
+	if len(txns) == 0 {
+		return nil
+	}
+	sort.Slice(txns, func(i, j int) bool { return txns[i].Rows > txns[j].Rows })
+	descs := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		descs = append(descs, txn.String())
+	}
+	return descs
+}
+
+// budgetWarnings returns the budgets exceeded by the processors, which are
+// sorted by the captures.
+func (c *changeFeed) budgetWarnings() []string {
+	captureIDs := make([]model.CaptureID, 0, len(c.taskPositions))
+	for captureID, position := range c.taskPositions {
+		if len(position.BudgetExceeded) != 0 {
+			captureIDs = append(captureIDs, captureID)
+		}
+	}
+	if len(captureIDs) == 0 {
+		return nil
+	}
+	sort.Strings(captureIDs)
+	var warnings []string
+	for _, captureID := range captureIDs {
+		for _, resource := range c.taskPositions[captureID].BudgetExceeded {
+			warnings = append(warnings, fmt.Sprintf("%s is exceeded on capture %s", resource, captureID))
+		}
+	}
+	return warnings
+}
+
 func (c *changeFeed) addSchema(schemaID model.SchemaID) {
 	if _, ok := c.schemas[schemaID]; ok {
 		log.Warn("add schema already exists", zap.Int64("schemaID", schemaID))
@@ -176,11 +301,16 @@ func (c *changeFeed) addTable(tblInfo *model.TableInfo, targetTs model.Ts) {
 		return
 	}
 
+	if !tblInfo.HasRows() {
+		return
+	}
+
 	if _, ok := c.schemas[tblInfo.SchemaID]; !ok {
 		c.schemas[tblInfo.SchemaID] = make(tableIDMap)
 	}
 	c.schemas[tblInfo.SchemaID][tblInfo.ID] = struct{}{}
 	c.tables[tblInfo.ID] = tblInfo.TableName
+	targetTs = c.tableStartTs.adjust(tblInfo.TableName, targetTs)
 	if pi := tblInfo.GetPartitionInfo(); pi != nil {
 		delete(c.partitions, tblInfo.ID)
 		for _, partition := range pi.Definitions {
@@ -190,6 +320,7 @@ func (c *changeFeed) addTable(tblInfo *model.TableInfo, targetTs model.Ts) {
 	} else {
 		c.orphanTables[tblInfo.ID] = targetTs
 	}
+	c.requestSchemaBootstrap(tblInfo.ID)
 }
 
 func (c *changeFeed) removeTable(sid model.SchemaID, tid model.TableID, targetTs model.Ts) {
@@ -199,6 +330,15 @@ func (c *changeFeed) removeTable(sid model.SchemaID, tid model.TableID, targetTs
 	delete(c.tables, tid)
 
 	removeFunc := func(id int64) {
+		if c.status != nil {
+			if table, ok := c.status.PausedTables[id]; ok {
+				delete(c.status.PausedTables, id)
+				// the table resumed by the circuit breaker is replicated
+				if table.Epoch >= c.status.BreakerEpoch {
+					return
+				}
+			}
+		}
 		if _, ok := c.orphanTables[id]; ok {
 			delete(c.orphanTables, id)
 		} else {
@@ -232,12 +372,13 @@ func (c *changeFeed) updatePartition(tblInfo *timodel.TableInfo, startTs uint64)
 		return
 	}
 	newPartitionIDs := make([]int64, 0, len(pi.Definitions))
+	partitionStartTs := c.tableStartTs.adjust(c.tables[tid], startTs)
 	for _, partition := range pi.Definitions {
 		pid := partition.ID
 		_, ok := c.orphanTables[pid]
 		if !ok {
 			// new partition.
-			c.orphanTables[pid] = startTs
+			c.orphanTables[pid] = partitionStartTs
 		}
 		delete(oldIDs, partition.ID)
 		newPartitionIDs = append(newPartitionIDs, partition.ID)
@@ -257,7 +398,16 @@ func (c *changeFeed) updatePartition(tblInfo *timodel.TableInfo, startTs uint64)
 
 func (c *changeFeed) tryBalance(ctx context.Context, captures map[string]*model.CaptureInfo, rebalanceNow bool,
 	manualMoveCommands []*model.MoveTableJob) error {
-	err := c.balanceOrphanTables(ctx, captures)
+	err := c.rescheduleFailedTables(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = c.reconcileFinishedDeletes(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.refreshLocality(ctx, captures)
+	err = c.balanceOrphanTables(ctx, captures)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -288,6 +438,167 @@ func findTaskStatusWithTable(infos model.ProcessorsInfos, tableID model.TableID)
 	return "", nil, false
 }
 
+// rescheduleFailedTables removes the tables which the processors failed to add
+// from the task status, they are orphan again and dispatched to other captures.
+func (c *changeFeed) rescheduleFailedTables(ctx context.Context) error {
+	for captureID, status := range c.taskStatus {
+		var failedTables []model.TableID
+		for tableID, op := range status.Operation {
+			if !op.Delete && op.Error != nil {
+				failedTables = append(failedTables, tableID)
+			}
+		}
+		if len(failedTables) == 0 {
+			continue
+		}
+		var removed map[model.TableID]*model.TableOperation
+		newStatus, _, err := c.etcdCli.AtomicPutTaskStatus(ctx, c.id, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+			removed = make(map[model.TableID]*model.TableOperation, len(failedTables))
+			for _, tableID := range failedTables {
+				op, ok := status.Operation[tableID]
+				if !ok || op.Delete || op.Error == nil {
+					continue
+				}
+				delete(status.Tables, tableID)
+				delete(status.Operation, tableID)
+				delete(status.Readiness, tableID)
+				removed[tableID] = op
+			}
+			return len(removed) > 0, nil
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.taskStatus[captureID] = newStatus.Clone()
+		for tableID, op := range removed {
+			log.Warn("failed to add the table, dispatch it to another capture",
+				zap.String("changefeed", c.id),
+				zap.String("capture-id", captureID),
+				zap.Int64("tableID", tableID),
+				zap.String("error", op.Error.Message))
+			c.orphanTables[tableID] = op.BoundaryTs
+			if c.addTableFailures == nil {
+				c.addTableFailures = make(map[model.TableID]*addTableFailure)
+			}
+			failure, ok := c.addTableFailures[tableID]
+			if !ok {
+				failure = &addTableFailure{reasons: make(map[model.CaptureID]string)}
+				c.addTableFailures[tableID] = failure
+			}
+			failure.reasons[captureID] = op.Error.Message
+			if op.Error.Code == string(cerror.ErrTableSchemaIncompatible.RFCCode()) {
+				failure.schemaError = op.Error.Message
+			}
+			failure.lastTime = time.Now()
+		}
+	}
+	return nil
+}
+
+// avoidFailedCaptures moves the tables distributed to the captures which
+// failed to add them to other captures, the tables which can't be added by
+// any capture are kept orphan and recorded in the changefeed status.
+func (c *changeFeed) avoidFailedCaptures(
+	operations map[model.CaptureID]map[model.TableID]*model.TableOperation,
+	captures map[model.CaptureID]*model.CaptureInfo,
+) {
+	now := time.Now()
+	for tableID, failure := range c.addTableFailures {
+		if _, ok := c.orphanTables[tableID]; !ok || now.Sub(failure.lastTime) > addTableFailureTTL {
+			delete(c.addTableFailures, tableID)
+		}
+	}
+	var unscheduled map[model.TableID]string
+	if len(c.addTableFailures) > 0 {
+		captureIDs := make([]model.CaptureID, 0, len(captures))
+		for captureID := range captures {
+			captureIDs = append(captureIDs, captureID)
+		}
+		sort.Strings(captureIDs)
+		// the tables are collected first, as the operations are moved among the captures
+		targets := make(map[model.CaptureID]map[model.TableID]*model.TableOperation)
+		for captureID, ops := range operations {
+			for tableID, op := range ops {
+				failure, ok := c.addTableFailures[tableID]
+				if !ok {
+					continue
+				}
+				if failure.schemaError != "" {
+					// the table is kept unscheduled until the failure expires,
+					// when the downstream schema is checked again
+					delete(ops, tableID)
+					if unscheduled == nil {
+						unscheduled = make(map[model.TableID]string)
+					}
+					unscheduled[tableID] = failure.schemaError
+					continue
+				}
+				if _, failed := failure.reasons[captureID]; !failed {
+					continue
+				}
+				delete(ops, tableID)
+				target := ""
+				for _, id := range captureIDs {
+					if _, failed := failure.reasons[id]; !failed {
+						target = id
+						break
+					}
+				}
+				if target == "" {
+					if unscheduled == nil {
+						unscheduled = make(map[model.TableID]string)
+					}
+					reasons := make([]string, 0, len(failure.reasons))
+					for _, id := range captureIDs {
+						if reason, ok := failure.reasons[id]; ok {
+							reasons = append(reasons, reason)
+						}
+					}
+					unscheduled[tableID] = cerror.ErrNoCaptureSortCapacity.GenWithStackByArgs(
+						tableID, strings.Join(reasons, "; ")).Error()
+					continue
+				}
+				if targets[target] == nil {
+					targets[target] = make(map[model.TableID]*model.TableOperation)
+				}
+				targets[target][tableID] = op
+			}
+		}
+		for captureID, ops := range targets {
+			if operations[captureID] == nil {
+				operations[captureID] = make(map[model.TableID]*model.TableOperation)
+			}
+			for tableID, op := range ops {
+				operations[captureID][tableID] = op
+			}
+		}
+	}
+	c.status.UnscheduledTables = unscheduled
+}
+
+// refreshLocality resolves the locality of the replicated and the orphan
+// tables, the tables are rebalanced in the next tick if the leaders of many
+// of them are moved to other zones.
+func (c *changeFeed) refreshLocality(ctx context.Context, captures map[model.CaptureID]*model.CaptureInfo) {
+	if c.localityResolver == nil {
+		return
+	}
+	tableIDs := make([]model.TableID, 0, len(c.orphanTables))
+	for tableID := range c.orphanTables {
+		tableIDs = append(tableIDs, tableID)
+	}
+	for _, status := range c.taskStatus {
+		for tableID := range status.Tables {
+			tableIDs = append(tableIDs, tableID)
+		}
+	}
+	var migrated bool
+	c.locality, migrated = c.localityResolver.resolve(ctx, captures, tableIDs, time.Now())
+	if migrated {
+		c.rebalanceNextTick = true
+	}
+}
+
 func (c *changeFeed) balanceOrphanTables(ctx context.Context, captures map[model.CaptureID]*model.CaptureInfo) error {
 	if len(captures) == 0 {
 		return nil
@@ -302,7 +613,38 @@ func (c *changeFeed) balanceOrphanTables(ctx context.Context, captures map[model
 	}
 	c.scheduler.AlignCapture(captureIDs)
 
+	// the truncated tables are swapped before the other tables are cleaned
+	// or dispatched, the pairs which aren't dispatched keep waiting.
+	swapping := make(map[model.TableID]struct{}, 2*len(c.swappedTables))
+	for newID, oldID := range c.swappedTables {
+		startTs, orphan := c.orphanTables[newID]
+		captureID, _, found := findTaskStatusWithTable(c.taskStatus, oldID)
+		if _, ok := c.toCleanTables[oldID]; !ok || !orphan || !found {
+			// the tables are cleaned and dispatched separately
+			delete(c.swappedTables, newID)
+			continue
+		}
+		swapping[newID] = struct{}{}
+		swapping[oldID] = struct{}{}
+		info, ok := c.orphanTableReplicaInfo(newID, startTs)
+		if !ok {
+			continue
+		}
+		oldID, newID := oldID, newID
+		updateFuncs[captureID] = append(updateFuncs[captureID], func(_ int64, status *model.TaskStatus) (bool, error) {
+			if !status.SwapTable(oldID, newID, info, startTs) {
+				status.AddTable(newID, info, startTs)
+			}
+			return true, nil
+		})
+		cleanedTables[oldID] = struct{}{}
+		addedTables[newID] = struct{}{}
+	}
+
 	for id, targetTs := range c.toCleanTables {
+		if _, ok := swapping[id]; ok {
+			continue
+		}
 		captureID, _, ok := findTaskStatusWithTable(c.taskStatus, id)
 		if !ok {
 			log.Warn("ignore clean table id", zap.Int64("id", id))
@@ -319,34 +661,32 @@ func (c *changeFeed) balanceOrphanTables(ctx context.Context, captures map[model
 		cleanedTables[id] = struct{}{}
 	}
 
-	operations := c.scheduler.DistributeTables(c.orphanTables)
+	// the table recovered after it's dropped has the same table id, it's
+	// dispatched after the removal is finished, otherwise the new add
+	// operation overwrites the delete one which is not applied yet.
+	orphanTables := make(map[model.TableID]model.Ts, len(c.orphanTables))
+	for tableID, startTs := range c.orphanTables {
+		if _, ok := swapping[tableID]; ok {
+			continue
+		}
+		if c.isRemovingTable(tableID) {
+			log.Info("balance orphan tables delay, the table is being removed",
+				zap.String("changefeed", c.id),
+				zap.Int64("tableID", tableID))
+			continue
+		}
+		orphanTables[tableID] = startTs
+	}
+	c.scheduler.ResetTableGroups(c.partitionPolicy.tableGroups(c.partitions, c.tables))
+	c.scheduler.ResetLocality(c.locality)
+	operations := c.scheduler.DistributeTables(orphanTables)
+	c.avoidFailedCaptures(operations, captures)
 	for captureID, operation := range operations {
-		schemaSnapshot := c.schema
 		for tableID, op := range operation {
-			var orphanMarkTableID model.TableID
-			tableName, found := schemaSnapshot.GetTableNameByID(tableID)
-			if !found {
-				log.Warn("balance orphan tables delay, table not found",
-					zap.String("changefeed", c.id),
-					zap.Int64("tableID", tableID))
+			info, ok := c.orphanTableReplicaInfo(tableID, op.BoundaryTs)
+			if !ok {
 				continue
 			}
-			if c.cyclicEnabled {
-				markTableSchameName, markTableTableName := mark.GetMarkTableName(tableName.Schema, tableName.Table)
-				orphanMarkTableID, found = schemaSnapshot.GetTableIDByName(markTableSchameName, markTableTableName)
-				if !found {
-					// Mark table is not created yet, skip and wait.
-					log.Info("balance orphan tables delay, wait mark table",
-						zap.String("changefeed", c.id),
-						zap.Int64("tableID", tableID),
-						zap.String("markTableName", markTableTableName))
-					continue
-				}
-			}
-			info := &model.TableReplicaInfo{
-				StartTs:     op.BoundaryTs,
-				MarkTableID: orphanMarkTableID,
-			}
 			tableID := tableID
 			op := op
 			updateFuncs[captureID] = append(updateFuncs[captureID], func(_ int64, status *model.TaskStatus) (bool, error) {
@@ -371,11 +711,80 @@ func (c *changeFeed) balanceOrphanTables(ctx context.Context, captures map[model
 	}
 	for tableID := range addedTables {
 		delete(c.orphanTables, tableID)
+		delete(c.swappedTables, tableID)
 	}
 
 	return nil
 }
 
+// orphanTableReplicaInfo returns the replica info of the orphan table to
+// dispatch, false is returned if the table can't be dispatched yet.
+func (c *changeFeed) orphanTableReplicaInfo(tableID model.TableID, startTs model.Ts) (*model.TableReplicaInfo, bool) {
+	var orphanMarkTableID model.TableID
+	tableName, found := c.schema.GetTableNameByID(tableID)
+	if !found {
+		log.Warn("balance orphan tables delay, table not found",
+			zap.String("changefeed", c.id),
+			zap.Int64("tableID", tableID))
+		return nil, false
+	}
+	if c.cyclicEnabled {
+		markTableSchameName, markTableTableName := mark.GetMarkTableName(tableName.Schema, tableName.Table)
+		orphanMarkTableID, found = c.schema.GetTableIDByName(markTableSchameName, markTableTableName)
+		if !found {
+			// Mark table is not created yet, skip and wait.
+			log.Info("balance orphan tables delay, wait mark table",
+				zap.String("changefeed", c.id),
+				zap.Int64("tableID", tableID),
+				zap.String("markTableName", markTableTableName))
+			return nil, false
+		}
+	}
+	return &model.TableReplicaInfo{
+		StartTs:     startTs,
+		MarkTableID: orphanMarkTableID,
+	}, true
+}
+
+// swapTables links the truncated physical tables to the new ones replacing
+// them, so that the new tables are added from the commit ts of the truncate
+// exactly, by the processors removing the truncated tables at the same time.
+func (c *changeFeed) swapTables(swaps []entry.PhysicalTableSwap, commitTs model.Ts) {
+	for _, swap := range swaps {
+		if _, ok := c.toCleanTables[swap.OldTableID]; !ok {
+			continue
+		}
+		if _, ok := c.orphanTables[swap.NewTableID]; !ok {
+			continue
+		}
+		if c.swappedTables == nil {
+			c.swappedTables = make(map[model.TableID]model.TableID)
+		}
+		c.toCleanTables[swap.OldTableID] = commitTs
+		c.orphanTables[swap.NewTableID] = commitTs
+		c.swappedTables[swap.NewTableID] = swap.OldTableID
+		log.Info("swap the truncated table",
+			zap.String("changefeed", c.id),
+			zap.Int64("oldTableID", swap.OldTableID),
+			zap.Int64("newTableID", swap.NewTableID),
+			zap.Uint64("commitTs", commitTs))
+	}
+}
+
+// isRemovingTable returns true if the table is to be removed, or its delete
+// operation is not applied by the processor yet
+func (c *changeFeed) isRemovingTable(tableID model.TableID) bool {
+	if _, ok := c.toCleanTables[tableID]; ok {
+		return true
+	}
+	for _, status := range c.taskStatus {
+		if op, ok := status.Operation[tableID]; ok && op.Delete && !op.TableApplied() {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *changeFeed) updateTaskStatus(ctx context.Context, taskStatus map[model.CaptureID]*model.TaskStatus) error {
 	for captureID, status := range taskStatus {
 		newStatus, _, err := c.etcdCli.AtomicPutTaskStatus(ctx, c.id, captureID, func(modRevision int64, taskStatus *model.TaskStatus) (bool, error) {
@@ -385,6 +794,12 @@ func (c *changeFeed) updateTaskStatus(ctx context.Context, taskStatus map[model.
 			}
 			taskStatus.Tables = status.Tables
 			taskStatus.Operation = status.Operation
+			// the drain boundaries consumed by the owner are removed
+			for tableID := range taskStatus.DrainBoundary {
+				if _, exist := status.DrainBoundary[tableID]; !exist {
+					delete(taskStatus.DrainBoundary, tableID)
+				}
+			}
 			return true, nil
 		})
 		if err != nil {
@@ -458,21 +873,112 @@ func (c *changeFeed) rebalanceTables(ctx context.Context, captures map[model.Cap
 	c.lastRebalanceTime = time.Now()
 	c.rebalanceNextTick = false
 
-	captureIDs := make(map[model.CaptureID]struct{}, len(captures))
+	plan, err := c.rebalancePlan(ctx, captures)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.applyRebalancePlan(plan)
+	return nil
+}
+
+// rebalancePlan computes the rebalance plan of the current workloads of the
+// captures, nothing is changed by it.
+func (c *changeFeed) rebalancePlan(ctx context.Context, captures map[model.CaptureID]*model.CaptureInfo) (*scheduler.RebalancePlan, error) {
+	return c.rebalanceSnapshot(captures).plan(ctx)
+}
+
+// rebalanceSnapshot is the state of the changefeed which the rebalance plan is
+// computed from, the workloads of the captures are loaded from etcd by plan.
+// It's taken under the owner lock, and the plan is computed without the lock.
+type rebalanceSnapshot struct {
+	id           model.ChangeFeedID
+	etcdCli      kv.CDCEtcdClient
+	captureIDs   []model.CaptureID
+	markTableIDs map[model.TableID]struct{}
+	input        scheduler.RebalanceInput
+}
+
+func (c *changeFeed) rebalanceSnapshot(captures map[model.CaptureID]*model.CaptureInfo) *rebalanceSnapshot {
+	snap := &rebalanceSnapshot{
+		id:           c.id,
+		etcdCli:      c.etcdCli,
+		captureIDs:   make([]model.CaptureID, 0, len(captures)),
+		markTableIDs: c.markTableIDs(),
+		input: scheduler.RebalanceInput{
+			Tp:        c.info.Config.Scheduler.Tp,
+			Workloads: make(map[model.CaptureID]model.TaskWorkload, len(captures)),
+			Groups:    c.partitionPolicy.tableGroups(c.partitions, c.tables),
+			Locality:  c.locality,
+		},
+	}
 	for cid := range captures {
-		captureIDs[cid] = struct{}{}
-		workloads, err := c.etcdCli.GetTaskWorkload(ctx, c.id, cid)
+		snap.captureIDs = append(snap.captureIDs, cid)
+	}
+	return snap
+}
+
+// plan loads the workloads of the captures and computes the rebalance plan
+func (s *rebalanceSnapshot) plan(ctx context.Context) (*scheduler.RebalancePlan, error) {
+	for _, cid := range s.captureIDs {
+		workloads, err := s.etcdCli.GetTaskWorkload(ctx, s.id, cid)
 		if err != nil {
-			return errors.Trace(err)
+			return nil, errors.Trace(err)
 		}
+		s.input.Workloads[cid] = removeMarkTables(workloads, s.markTableIDs)
+	}
+	return scheduler.CalRebalancePlan(s.input), nil
+}
+
+// applyRebalancePlan moves the tables of the plan, and the scheduler is reset
+// to the projected workloads, which the orphan tables are distributed by.
+func (c *changeFeed) applyRebalancePlan(plan *scheduler.RebalancePlan) {
+	captureIDs := make(map[model.CaptureID]struct{}, len(plan.Workloads))
+	for cid, workloads := range plan.Workloads {
+		captureIDs[cid] = struct{}{}
 		c.scheduler.ResetWorkloads(cid, workloads)
 	}
 	c.scheduler.AlignCapture(captureIDs)
-
-	_, moveTableJobs := c.scheduler.CalRebalanceOperates(0)
-	log.Info("rebalance operations", zap.Reflect("moveTableJobs", moveTableJobs))
+	moveTableJobs := plan.MoveTableJobs()
+	log.Info("rebalance operations", zap.Reflect("moveTableJobs", moveTableJobs),
+		zap.Float64("skewnessBefore", plan.SkewnessBefore), zap.Float64("skewnessAfter", plan.SkewnessAfter))
 	c.moveTableJobs = moveTableJobs
-	return nil
+}
+
+// dataTableWorkloads removes the workloads of the mark tables, which are
+// listened with the data tables referencing them and never scheduled alone.
+func (c *changeFeed) dataTableWorkloads(workloads model.TaskWorkload) model.TaskWorkload {
+	return removeMarkTables(workloads, c.markTableIDs())
+}
+
+// markTableIDs returns the mark tables of the replicated tables, nil is
+// returned if the cyclic replication isn't enabled.
+func (c *changeFeed) markTableIDs() map[model.TableID]struct{} {
+	if !c.cyclicEnabled {
+		return nil
+	}
+	markTableIDs := make(map[model.TableID]struct{})
+	for _, status := range c.taskStatus {
+		for _, replicaInfo := range status.Tables {
+			if replicaInfo != nil && replicaInfo.MarkTableID != 0 {
+				markTableIDs[replicaInfo.MarkTableID] = struct{}{}
+			}
+		}
+	}
+	return markTableIDs
+}
+
+// removeMarkTables returns the workloads without the mark tables
+func removeMarkTables(workloads model.TaskWorkload, markTableIDs map[model.TableID]struct{}) model.TaskWorkload {
+	if markTableIDs == nil {
+		return workloads
+	}
+	filtered := make(model.TaskWorkload, len(workloads))
+	for tableID, workload := range workloads {
+		if _, ok := markTableIDs[tableID]; !ok {
+			filtered[tableID] = workload
+		}
+	}
+	return filtered
 }
 
 func (c *changeFeed) handleMoveTableJobs(ctx context.Context, captures map[model.CaptureID]*model.CaptureInfo) error {
@@ -526,19 +1032,37 @@ func (c *changeFeed) handleMoveTableJobs(ctx context.Context, captures map[model
 			log.Info("handle the move job, remove table from the source capture", zap.Reflect("job", job))
 		case model.MoveTableStatusDeleted:
 			// add table to target capture
+			startTs := c.status.CheckpointTs
+			// the drain boundary is the exact ts up to which the source
+			// processor has applied the data of the table, it's preferred
+			// over the global checkpoint ts.
+			if source := c.taskStatus[job.From]; source != nil {
+				if boundaryTs, exist := source.DrainBoundary[tableID]; exist {
+					log.Info("move the table from the drain boundary",
+						zap.Int64("tableID", tableID),
+						zap.Uint64("boundaryTs", boundaryTs),
+						zap.Uint64("checkpointTs", c.status.CheckpointTs))
+					startTs = boundaryTs
+					if status, exist := cloneStatus(job.From); exist {
+						delete(status.DrainBoundary, tableID)
+					}
+				}
+			}
 			status, exist := cloneStatus(job.To)
 			replicaInfo := job.TableReplicaInfo.Clone()
-			replicaInfo.StartTs = c.status.CheckpointTs
+			replicaInfo.StartTs = startTs
 			if !exist {
 				// the target capture is not exist, add table to orphanTables.
 				c.orphanTables[tableID] = replicaInfo.StartTs
 				log.Warn("the target capture is not exist, sent the table to orphanTables", zap.Reflect("job", job))
 				continue
 			}
-			status.AddTable(tableID, replicaInfo, c.status.CheckpointTs)
+			status.AddTable(tableID, replicaInfo, startTs)
 			job.Status = model.MoveTableStatusFinished
 			delete(c.moveTableJobs, tableID)
 			log.Info("handle the move job, add table to the target capture", zap.Reflect("job", job))
+			c.history.record(c.id, model.ChangefeedEventMoveTable, c.status.CheckpointTs, "",
+				"move table %d from capture %s to capture %s", tableID, job.From, job.To)
 		}
 	}
 	err := c.updateTaskStatus(ctx, newTaskStatus)
@@ -563,6 +1087,8 @@ func (c *changeFeed) applyJob(ctx context.Context, job *timodel.Job) (skip bool,
 		case timodel.ActionDropSchema:
 			c.dropSchema(schemaID, job.BinlogInfo.FinishedTS)
 		case timodel.ActionCreateTable, timodel.ActionRecoverTable:
+			// the table recovered or flashed back is added from the commit ts
+			// of the job, and it's filtered by its new name.
 			addID := job.BinlogInfo.TableInfo.ID
 			table, exist := c.schema.TableByID(addID)
 			if !exist {
@@ -605,6 +1131,18 @@ func (c *changeFeed) applyJob(ctx context.Context, job *timodel.Job) (skip bool,
 // if the status is in ChangeFeedWaitToExecDDL.
 // After executing the DDL successfully, the status will be changed to be ChangeFeedSyncDML.
 func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.CaptureInfo) error {
+	if c.ddlExecution != nil {
+		return c.waitDDLExecution(ctx)
+	}
+	if c.recoveredDDL != nil {
+		return c.recoverDDLExecution(ctx)
+	}
+	if c.throttledDDL != nil {
+		if c.skipThrottledDDL() {
+			return nil
+		}
+		return c.executeDDL(ctx, c.throttledDDL.job, c.throttledDDL.event)
+	}
 	if c.ddlState != model.ChangeFeedWaitToExecDDL {
 		return nil
 	}
@@ -626,6 +1164,9 @@ func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.C
 		return nil
 	}
 
+	_, skipOnce := c.skipDDLJobs[todoDDLJob.ID]
+	delete(c.skipDDLJobs, todoDDLJob.ID)
+
 	log.Info("apply job", zap.Stringer("job", todoDDLJob),
 		zap.String("schema", todoDDLJob.SchemaName),
 		zap.String("query", todoDDLJob.Query),
@@ -650,7 +1191,6 @@ func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.C
 	// Execute DDL Job asynchronously
 	c.ddlState = model.ChangeFeedExecDDL
 
-	// TODO consider some newly added DDL types such as `ActionCreateSequence`
 	skip, err := c.applyJob(ctx, todoDDLJob)
 	if err != nil {
 		return errors.Trace(err)
@@ -662,45 +1202,45 @@ func (c *changeFeed) handleDDL(ctx context.Context, captures map[string]*model.C
 		c.ddlState = model.ChangeFeedSyncDML
 		return nil
 	}
+	c.swapTables(entry.TruncateTableSwaps(preTableInfo, todoDDLJob), todoDDLJob.BinlogInfo.FinishedTS)
 
 	err = c.balanceOrphanTables(ctx, captures)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	executed := false
-	if !c.cyclicEnabled || c.info.Config.Cyclic.SyncDDL {
+	if skipOnce {
+		log.Warn("DDL skipped by operator", zap.String("changefeed", c.id), zap.Reflect("ddlJob", todoDDLJob))
+	} else if c.tableStartTs.beforeStartTs(ddlEvent) {
+		log.Info("DDL skipped, it's committed before the start ts of the table",
+			zap.String("changefeed", c.id), zap.Reflect("ddlJob", todoDDLJob))
+	} else if !c.cyclicEnabled || c.info.Config.Cyclic.SyncDDL {
 		failpoint.Inject("InjectChangefeedDDLError", func() {
 			failpoint.Return(cerror.ErrExecDDLFailed.GenWithStackByArgs())
 		})
 
 		ddlEvent.Query = binloginfo.AddSpecialComment(ddlEvent.Query)
 		log.Debug("DDL processed to make special features mysql-compatible", zap.String("query", ddlEvent.Query))
-		err = c.sink.EmitDDLEvent(ctx, ddlEvent)
-		// If DDL executing failed, pause the changefeed and print log, rather
-		// than return an error and break the running of this owner.
-		if err != nil {
-			if cerror.ErrDDLEventIgnored.NotEqual(err) {
-				c.ddlState = model.ChangeFeedDDLExecuteFailed
-				log.Error("Execute DDL failed",
-					zap.String("ChangeFeedID", c.id),
-					zap.Error(err),
-					zap.Reflect("ddlJob", todoDDLJob))
-				return cerror.ErrExecDDLFailed.GenWithStackByArgs()
-			}
-		} else {
-			executed = true
-		}
+		return c.executeDDL(ctx, todoDDLJob, ddlEvent)
 	}
+	c.finishDDL(todoDDLJob, false)
+	return nil
+}
+
+// finishDDL moves the DDL barrier over the DDL job
+func (c *changeFeed) finishDDL(job *timodel.Job, executed bool) {
 	if executed {
-		log.Info("Execute DDL succeeded", zap.String("changefeed", c.id), zap.Reflect("ddlJob", todoDDLJob))
+		log.Info("Execute DDL succeeded", zap.String("changefeed", c.id), zap.Reflect("ddlJob", job))
 	} else {
-		log.Info("Execute DDL ignored", zap.String("changefeed", c.id), zap.Reflect("ddlJob", todoDDLJob))
+		log.Info("Execute DDL ignored", zap.String("changefeed", c.id), zap.Reflect("ddlJob", job))
 	}
 
-	c.ddlJobHistory = c.ddlJobHistory[1:]
-	c.ddlExecutedTs = todoDDLJob.BinlogInfo.FinishedTS
+	// the DDL recovered from a previous owner is not queued
+	if len(c.ddlJobHistory) > 0 && c.ddlJobHistory[0].ID == job.ID {
+		c.ddlJobHistory = c.ddlJobHistory[1:]
+	}
+	c.ddlExecutedTs = job.BinlogInfo.FinishedTS
 	c.ddlState = model.ChangeFeedSyncDML
-	return nil
+	c.status.PausedDDL = nil
 }
 
 // handleSyncPoint record every syncpoint to downstream if the syncpoint feature is enable
@@ -835,6 +1375,12 @@ func (c *changeFeed) calcResolvedTs(ctx context.Context) error {
 	}
 	checkUpdateTs()
 
+	// the events after pauseTs must not be sent to the sinks of a pausing changefeed
+	if pausing := c.status.Pausing; pausing != nil && minResolvedTs > pausing.PauseTs {
+		minResolvedTs = pausing.PauseTs
+	}
+	checkUpdateTs()
+
 	// if minResolvedTs is greater than ddlResolvedTs,
 	// it means that ddlJobHistory in memory is not intact,
 	// there are some ddl jobs which finishedTs is smaller than minResolvedTs we don't know.
@@ -866,6 +1412,21 @@ func (c *changeFeed) calcResolvedTs(ctx context.Context) error {
 		minCheckpointTs = minResolvedTs
 	}
 	checkUpdateTs()
+	c.clearResumedTables(minCheckpointTs)
+
+	// the published status must never regress, a smaller ts is calculated if
+	// the view of the processors is stale, e.g. a capture joins with an older
+	// resolved ts, so it's clamped to the previous published ts
+	if minResolvedTs < c.status.ResolvedTs {
+		changefeedStatusClampCounter.WithLabelValues(c.id, "resolved-ts").Inc()
+		log.Debug("clamp the regressed resolved ts", zap.String("changefeed", c.id),
+			zap.Uint64("minResolvedTs", minResolvedTs), zap.Uint64("resolvedTs", c.status.ResolvedTs))
+	}
+	if minCheckpointTs < c.status.CheckpointTs {
+		changefeedStatusClampCounter.WithLabelValues(c.id, "checkpoint-ts").Inc()
+		log.Debug("clamp the regressed checkpoint ts", zap.String("changefeed", c.id),
+			zap.Uint64("minCheckpointTs", minCheckpointTs), zap.Uint64("checkpointTs", c.status.CheckpointTs))
+	}
 
 	var tsUpdated bool
 
@@ -914,6 +1475,7 @@ func (c *changeFeed) pullDDLJob() error {
 	for _, ddl := range ddlJobs {
 		if c.filter.ShouldDiscardDDL(ddl.Type) {
 			log.Info("discard the ddl job", zap.Int64("jobID", ddl.ID), zap.String("query", ddl.Query))
+			c.recordObjectDDLSkip(ddl)
 			continue
 		}
 		c.ddlJobHistory = append(c.ddlJobHistory, ddl)
@@ -957,6 +1519,9 @@ func (c *changeFeed) Close() {
 	if err != nil && errors.Cause(err) != context.Canceled {
 		log.Warn("failed to close ddl handler", zap.Error(err))
 	}
+	if c.ddlExecution != nil {
+		c.ddlExecution.stop()
+	}
 	err = c.sink.Close()
 	if err != nil && errors.Cause(err) != context.Canceled {
 		log.Warn("failed to close owner sink", zap.Error(err))
@@ -0,0 +1,134 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// changefeedHistoryFlushInterval is the minimum interval between two writes of
+// the changefeed history, events recorded in the interval are written in batch.
+const changefeedHistoryFlushInterval = 5 * time.Second
+
+// historyRecorder buffers the lifecycle events of changefeeds recorded by the
+// owner, and appends them to the changefeed history in etcd periodically, so
+// that etcd is not written too frequently.
+// All methods are no-op on a nil recorder.
+type historyRecorder struct {
+	owner string
+
+	mu        sync.Mutex
+	pending   map[model.ChangeFeedID][]*model.ChangefeedEvent
+	lastFlush time.Time
+}
+
+func newHistoryRecorder(owner string) *historyRecorder {
+	return &historyRecorder{
+		owner:   owner,
+		pending: make(map[model.ChangeFeedID][]*model.ChangefeedEvent),
+	}
+}
+
+// record adds an event to the history of the changefeed
+func (r *historyRecorder) record(
+	changefeedID model.ChangeFeedID,
+	typ model.ChangefeedEventType,
+	ts uint64,
+	client string,
+	format string, args ...interface{},
+) {
+	if r == nil {
+		return
+	}
+	event := &model.ChangefeedEvent{
+		Time:    time.Now(),
+		Type:    typ,
+		Owner:   r.owner,
+		Client:  client,
+		Ts:      ts,
+		Message: fmt.Sprintf(format, args...),
+	}
+	log.Info("record changefeed event", zap.String("changefeed", changefeedID), zap.Reflect("event", event))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := append(r.pending[changefeedID], event)
+	// the pending events exceeding the limit would be trimmed anyway
+	if len(events) > model.ChangefeedHistoryLimit {
+		events = events[len(events)-model.ChangefeedHistoryLimit:]
+	}
+	r.pending[changefeedID] = events
+}
+
+// pendingEvents returns the events of the changefeed which are not flushed yet
+func (r *historyRecorder) pendingEvents(changefeedID model.ChangeFeedID) []*model.ChangefeedEvent {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*model.ChangefeedEvent(nil), r.pending[changefeedID]...)
+}
+
+// discard drops the pending events of the changefeed
+func (r *historyRecorder) discard(changefeedID model.ChangeFeedID) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, changefeedID)
+}
+
+// flush appends the pending events to the changefeed history in etcd, it
+// does nothing if the last flush is within changefeedHistoryFlushInterval,
+// unless force is true.
+func (r *historyRecorder) flush(ctx context.Context, cli kv.CDCEtcdClient, force bool) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	if len(r.pending) == 0 || (!force && time.Since(r.lastFlush) < changefeedHistoryFlushInterval) {
+		r.mu.Unlock()
+		return nil
+	}
+	pending := r.pending
+	r.pending = make(map[model.ChangeFeedID][]*model.ChangefeedEvent)
+	r.lastFlush = time.Now()
+	r.mu.Unlock()
+
+	var firstErr error
+	for changefeedID, events := range pending {
+		err := cli.AppendChangeFeedHistory(ctx, changefeedID, events...)
+		if err != nil {
+			log.Warn("failed to write changefeed history", zap.String("changefeed", changefeedID), zap.Error(err))
+			// put the events back to retry in the next flush
+			r.mu.Lock()
+			r.pending[changefeedID] = append(events, r.pending[changefeedID]...)
+			r.mu.Unlock()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return errors.Trace(firstErr)
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+	"golang.org/x/sync/errgroup"
+)
+
+type historyRecorderSuite struct {
+	e      *embed.Etcd
+	client kv.CDCEtcdClient
+}
+
+var _ = check.Suite(&historyRecorderSuite{})
+
+func (s *historyRecorderSuite) SetUpTest(c *check.C) {
+	dir := c.MkDir()
+	url, e, err := etcd.SetupEmbedEtcd(dir)
+	c.Assert(err, check.IsNil)
+	s.e = e
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{url.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	s.client = kv.NewCDCEtcdClient(context.TODO(), client)
+}
+
+func (s *historyRecorderSuite) TearDownTest(c *check.C) {
+	s.client.Close() //nolint:errcheck
+	s.e.Close()
+}
+
+func (s *historyRecorderSuite) TestNilRecorder(c *check.C) {
+	defer testleak.AfterTest(c)()
+	var r *historyRecorder
+	r.record("test", model.ChangefeedEventPause, 1, "", "changefeed is paused")
+	r.discard("test")
+	c.Assert(r.pendingEvents("test"), check.HasLen, 0)
+	c.Assert(r.flush(context.Background(), s.client, true), check.IsNil)
+}
+
+func (s *historyRecorderSuite) TestRecordAndFlush(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	r := newHistoryRecorder("127.0.0.1:8300")
+	r.record("cf1", model.ChangefeedEventPause, 10, "root@host", "changefeed is paused")
+	r.record("cf1", model.ChangefeedEventResume, 10, "root@host", "changefeed is resumed")
+	r.record("cf2", model.ChangefeedEventMoveTable, 20, "", "move table %d", 1)
+	pending := r.pendingEvents("cf1")
+	c.Assert(pending, check.HasLen, 2)
+	c.Assert(pending[0].Owner, check.Equals, "127.0.0.1:8300")
+	c.Assert(pending[0].Client, check.Equals, "root@host")
+	c.Assert(pending[1].Type, check.Equals, model.ChangefeedEventResume)
+
+	err := r.flush(ctx, s.client, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.pendingEvents("cf1"), check.HasLen, 0)
+	_, history, err := s.client.GetChangeFeedHistory(ctx, "cf1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 2)
+	_, history, err = s.client.GetChangeFeedHistory(ctx, "cf2")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 1)
+	c.Assert(history.Events[0].Message, check.Equals, "move table 1")
+
+	// the flush is rate limited
+	r.record("cf1", model.ChangefeedEventPause, 30, "", "changefeed is paused")
+	err = r.flush(ctx, s.client, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.pendingEvents("cf1"), check.HasLen, 1)
+	_, history, err = s.client.GetChangeFeedHistory(ctx, "cf1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 2)
+	err = r.flush(ctx, s.client, true)
+	c.Assert(err, check.IsNil)
+	_, history, err = s.client.GetChangeFeedHistory(ctx, "cf1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 3)
+
+	r.record("cf1", model.ChangefeedEventRemove, 30, "", "changefeed is removed")
+	r.discard("cf1")
+	c.Assert(r.pendingEvents("cf1"), check.HasLen, 0)
+}
+
+func (s *historyRecorderSuite) TestPendingEventsTrimmed(c *check.C) {
+	defer testleak.AfterTest(c)()
+	r := newHistoryRecorder("127.0.0.1:8300")
+	for i := 0; i < model.ChangefeedHistoryLimit+10; i++ {
+		r.record("cf", model.ChangefeedEventMoveTable, uint64(i), "", "move table")
+	}
+	pending := r.pendingEvents("cf")
+	c.Assert(pending, check.HasLen, model.ChangefeedHistoryLimit)
+	c.Assert(pending[0].Ts, check.Equals, uint64(10))
+}
+
+func (s *historyRecorderSuite) TestOwnerSwitch(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	// the old owner flushes its remaining events while the new owner
+	// records the owner change, both of them should be kept.
+	oldOwner := newHistoryRecorder("127.0.0.1:8300")
+	newOwner := newHistoryRecorder("127.0.0.1:8301")
+	for i := 0; i < 50; i++ {
+		oldOwner.record("cf", model.ChangefeedEventMoveTable, uint64(i), "", "move table")
+		newOwner.record("cf", model.ChangefeedEventOwnerChange, uint64(i), "", "the owner is changed")
+	}
+	var errg errgroup.Group
+	for _, r := range []*historyRecorder{oldOwner, newOwner} {
+		r := r
+		errg.Go(func() error {
+			return r.flush(ctx, s.client, true)
+		})
+	}
+	c.Assert(errg.Wait(), check.IsNil)
+	_, history, err := s.client.GetChangeFeedHistory(ctx, "cf")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 100)
+	owners := make(map[string]int)
+	for _, event := range history.Events {
+		owners[event.Owner]++
+	}
+	c.Assert(owners, check.DeepEquals, map[string]int{"127.0.0.1:8300": 50, "127.0.0.1:8301": 50})
+}
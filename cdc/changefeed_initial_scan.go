@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+)
+
+const (
+	// initialScanLagThreshold is the checkpoint lag under which the
+	// changefeed is considered caught up with the history
+	initialScanLagThreshold = 30 * time.Second
+	// initialScanSteadyPeriod is how long the changefeed must stay caught up
+	// before the initial scan milestone is reached
+	initialScanSteadyPeriod = time.Minute
+)
+
+// initializingTables returns the tables whose incremental scan is not
+// finished in ascending order, which are reported by the processors or
+// dispatched to the processors but not added yet.
+func (c *changeFeed) initializingTables() []model.TableID {
+	tables := make(map[model.TableID]struct{})
+	for _, status := range c.taskStatus {
+		for tableID, op := range status.Operation {
+			if !op.Delete && !op.TableProcessed() {
+				tables[tableID] = struct{}{}
+			}
+		}
+	}
+	for _, position := range c.taskPositions {
+		for _, tableID := range position.InitializingTables {
+			tables[tableID] = struct{}{}
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	sorted := make([]model.TableID, 0, len(tables))
+	for tableID := range tables {
+		sorted = append(sorted, tableID)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// checkInitialScan updates the initializing tables in the status, and records
+// the initial scan milestone once all tables finished the incremental scan and
+// the checkpoint lag stayed under initialScanLagThreshold for
+// initialScanSteadyPeriod. It returns true only in the call which reaches the
+// milestone, the tables added after it don't reset the milestone.
+func (c *changeFeed) checkInitialScan(now time.Time) bool {
+	c.status.InitializingTables = c.initializingTables()
+	if c.status.InitialScanFinished != nil {
+		return false
+	}
+	steady := len(c.taskStatus) != 0 && len(c.status.InitializingTables) == 0 && c.status.CheckpointTs != 0 &&
+		util.TsLag(now, c.status.CheckpointTs) < initialScanLagThreshold.Seconds()
+	for captureID := range c.taskStatus {
+		// the processor which hasn't reported its position may be scanning
+		if _, ok := c.taskPositions[captureID]; !ok {
+			steady = false
+		}
+	}
+	if !steady {
+		c.steadySince = time.Time{}
+		return false
+	}
+	if c.steadySince.IsZero() {
+		c.steadySince = now
+	}
+	if now.Sub(c.steadySince) < initialScanSteadyPeriod {
+		return false
+	}
+	c.status.InitialScanFinished = &model.InitialScanMilestone{
+		Time:         now,
+		CheckpointTs: c.status.CheckpointTs,
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type initialScanSuite struct{}
+
+var _ = check.Suite(&initialScanSuite{})
+
+func newInitialScanChangefeed(startTime time.Time) *changeFeed {
+	return &changeFeed{
+		id:     "test-initial-scan",
+		info:   &model.ChangeFeedInfo{State: model.StateNormal, Config: config.GetDefaultReplicaConfig()},
+		status: &model.ChangeFeedStatus{CheckpointTs: oracle.ComposeTS(oracle.GetPhysical(startTime), 0)},
+		taskStatus: model.ProcessorsInfos{
+			"capture-1": {Tables: map[model.TableID]*model.TableReplicaInfo{1: {}, 2: {}}},
+			"capture-2": {Tables: map[model.TableID]*model.TableReplicaInfo{3: {}}},
+		},
+		taskPositions: map[model.CaptureID]*model.TaskPosition{
+			"capture-1": {InitializingTables: []model.TableID{2, 1}},
+			"capture-2": {InitializingTables: []model.TableID{3}},
+		},
+	}
+}
+
+// advance moves the checkpoint of the changefeed to lag behind now
+func advance(cf *changeFeed, now time.Time, lag time.Duration) {
+	cf.status.CheckpointTs = oracle.ComposeTS(oracle.GetPhysical(now.Add(-lag)), 0)
+}
+
+func (s *initialScanSuite) TestMilestoneReachedOnce(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Now()
+	cf := newInitialScanChangefeed(now.Add(-24 * time.Hour))
+
+	// the tables are scanning the history
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	c.Assert(cf.status.InitializingTables, check.DeepEquals, []model.TableID{1, 2, 3})
+	c.Assert(cf.status.InitialScanFinished, check.IsNil)
+
+	// all tables finished the incremental scan, but the checkpoint is
+	// still catching up
+	cf.taskPositions["capture-1"].InitializingTables = nil
+	cf.taskPositions["capture-2"].InitializingTables = nil
+	now = now.Add(time.Hour)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	c.Assert(cf.status.InitializingTables, check.HasLen, 0)
+	now = now.Add(time.Hour)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+
+	// the lag must stay under the threshold for the sustained period
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	now = now.Add(initialScanSteadyPeriod / 2)
+	advance(cf, now, 2*initialScanLagThreshold)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	now = now.Add(initialScanSteadyPeriod / 2)
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+
+	now = now.Add(initialScanSteadyPeriod / 2)
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsTrue)
+	milestone := cf.status.InitialScanFinished
+	c.Assert(milestone, check.NotNil)
+	c.Assert(milestone.Time, check.Equals, now)
+	c.Assert(milestone.CheckpointTs, check.Equals, cf.status.CheckpointTs)
+
+	// the milestone is reached only once
+	for i := 0; i < 3; i++ {
+		now = now.Add(initialScanSteadyPeriod)
+		advance(cf, now, time.Second)
+		c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	}
+	c.Assert(cf.status.InitialScanFinished, check.Equals, milestone)
+}
+
+func (s *initialScanSuite) TestAddedTablesKeepMilestone(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Now()
+	cf := newInitialScanChangefeed(now)
+	cf.taskPositions["capture-1"].InitializingTables = nil
+	cf.taskPositions["capture-2"].InitializingTables = nil
+
+	// a processor which hasn't reported its position may be scanning
+	cf.taskStatus["capture-3"] = &model.TaskStatus{}
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	now = now.Add(initialScanSteadyPeriod)
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	cf.taskPositions["capture-3"] = &model.TaskPosition{}
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	now = now.Add(initialScanSteadyPeriod)
+	advance(cf, now, time.Second)
+	c.Assert(cf.checkInitialScan(now), check.IsTrue)
+	milestone := cf.status.InitialScanFinished
+
+	// a table dispatched later is initializing until the processor adds it
+	// and finishes the incremental scan of it
+	cf.taskStatus["capture-3"].Operation = map[model.TableID]*model.TableOperation{
+		4: {Status: model.OperDispatched},
+	}
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	c.Assert(cf.status.InitializingTables, check.DeepEquals, []model.TableID{4})
+	cf.taskStatus["capture-3"].Operation[4].Status = model.OperProcessed
+	cf.taskPositions["capture-3"].InitializingTables = []model.TableID{4}
+	now = now.Add(time.Hour)
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	c.Assert(cf.status.InitializingTables, check.DeepEquals, []model.TableID{4})
+	c.Assert(cf.status.InitialScanFinished, check.Equals, milestone)
+
+	cf.taskPositions["capture-3"].InitializingTables = nil
+	c.Assert(cf.checkInitialScan(now), check.IsFalse)
+	c.Assert(cf.status.InitializingTables, check.HasLen, 0)
+	c.Assert(cf.status.InitialScanFinished, check.Equals, milestone)
+}
+
+func (s *initialScanSuite) TestNotifyMilestone(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Now()
+	cf := newInitialScanChangefeed(now)
+	cf.taskPositions["capture-1"].InitializingTables = nil
+	cf.taskPositions["capture-2"].InitializingTables = nil
+	cf.info.Config.Notify.WebhookURL = "http://127.0.0.1:1/alert"
+	owner := &Owner{
+		changeFeeds:  map[model.ChangeFeedID]*changeFeed{cf.id: cf},
+		history:      newHistoryRecorder("owner"),
+		notifier:     newWebhookNotifier(nil),
+		stateMetrics: newChangefeedStateMetrics(),
+	}
+	defer owner.stateMetrics.drop(cf.id)
+
+	reached := 0
+	for i := 0; i < 5; i++ {
+		advance(cf, now, time.Second)
+		if cf.checkInitialScan(now) {
+			reached++
+			owner.onInitialScanFinished(cf)
+		}
+		now = now.Add(initialScanSteadyPeriod)
+	}
+	c.Assert(reached, check.Equals, 1)
+	c.Assert(owner.notifier.queue, check.HasLen, 1)
+	notification := <-owner.notifier.queue
+	c.Assert(notification.url, check.Equals, "http://127.0.0.1:1/alert")
+	c.Assert(notification.payload.Event, check.Equals, NotifyEventInitialScanFinished)
+	c.Assert(notification.payload.CheckpointTs, check.Equals, cf.status.InitialScanFinished.CheckpointTs)
+	events := owner.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventInitialScanFinished)
+
+	owner.stateMetrics.setInitialScanFinished(cf.id, cf.status.InitialScanFinished != nil)
+	c.Assert(testutil.ToFloat64(initialScanFinishedGauge.WithLabelValues(cf.id)), check.Equals, float64(1))
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// stuckOperationThreshold is the duration after which a pending table
+// operation is considered stuck, the operations are applied in seconds
+// normally, unless the processor crashed in the middle of them.
+const stuckOperationThreshold = 10 * time.Minute
+
+// ChangefeedOperationResp is a table operation pending on a capture
+type ChangefeedOperationResp struct {
+	CaptureID   string        `json:"capture-id"`
+	CaptureAddr string        `json:"capture-address"`
+	TableID     model.TableID `json:"table-id"`
+	// Operation is the type and the state of the operation, e.g. "delete (processed)"
+	Operation  string   `json:"operation"`
+	BoundaryTs model.Ts `json:"boundary-ts"`
+	// DispatchTime and Age are empty if the operation is dispatched by an
+	// owner of old versions.
+	DispatchTime *time.Time `json:"dispatch-time,omitempty"`
+	Age          string     `json:"age,omitempty"`
+	// Stuck is set if the operation is pending longer than expected
+	Stuck bool `json:"stuck"`
+}
+
+// ListChangefeedOperations lists the table operations of the changefeed which
+// are not applied by the processors yet.
+func ListChangefeedOperations(
+	ctx context.Context, etcdCli kv.CDCEtcdClient, changefeedID string,
+) ([]*ChangefeedOperationResp, error) {
+	if _, err := etcdCli.GetChangeFeedInfo(ctx, changefeedID); err != nil {
+		return nil, errors.Trace(err)
+	}
+	_, captures, err := etcdCli.GetCaptures(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	taskStatus, err := etcdCli.GetAllTaskStatus(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	captureAddrs := make(map[model.CaptureID]string, len(captures))
+	for _, capture := range captures {
+		captureAddrs[capture.ID] = capture.AdvertiseAddr
+	}
+	return collectPendingOperations(taskStatus, captureAddrs, time.Now()), nil
+}
+
+// collectPendingOperations returns the operations not applied in the task
+// status, which are sorted by the tables and the captures.
+func collectPendingOperations(
+	taskStatus model.ProcessorsInfos, captureAddrs map[model.CaptureID]string, now time.Time,
+) []*ChangefeedOperationResp {
+	operations := make([]*ChangefeedOperationResp, 0)
+	for captureID, status := range taskStatus {
+		for tableID, op := range status.Operation {
+			if op.TableApplied() {
+				continue
+			}
+			resp := &ChangefeedOperationResp{
+				CaptureID:   captureID,
+				CaptureAddr: captureAddrs[captureID],
+				TableID:     tableID,
+				Operation:   tableOperationString(op),
+				BoundaryTs:  op.BoundaryTs,
+			}
+			if op.DispatchTime != nil {
+				dispatchTime := *op.DispatchTime
+				age := now.Sub(dispatchTime)
+				resp.DispatchTime = &dispatchTime
+				resp.Age = age.Truncate(time.Second).String()
+				resp.Stuck = age > stuckOperationThreshold
+			}
+			operations = append(operations, resp)
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].TableID != operations[j].TableID {
+			return operations[i].TableID < operations[j].TableID
+		}
+		return operations[i].CaptureID < operations[j].CaptureID
+	})
+	return operations
+}
+
+// stuckOperations describes the operations pending longer than
+// stuckOperationThreshold, they block the scheduling of the changefeed.
+func (c *changeFeed) stuckOperations(now time.Time) []string {
+	var descs []string
+	for _, op := range collectPendingOperations(c.taskStatus, nil, now) {
+		if op.Stuck {
+			descs = append(descs, fmt.Sprintf("%s of table %d on capture %s is pending for %s",
+				op.Operation, op.TableID, op.CaptureID, op.Age))
+		}
+	}
+	return descs
+}
+
+// isLostTable returns true if the table is replicated by the changefeed, but
+// neither dispatched to any capture nor waiting to be dispatched.
+func (c *changeFeed) isLostTable(tableID model.TableID) bool {
+	replicated := false
+	if _, ok := c.tables[tableID]; ok {
+		_, partitioned := c.partitions[tableID]
+		replicated = !partitioned
+	}
+	for _, pids := range c.partitions {
+		for _, pid := range pids {
+			if pid == tableID {
+				replicated = true
+			}
+		}
+	}
+	if !replicated || c.isRemovingTable(tableID) {
+		return false
+	}
+	if _, ok := c.orphanTables[tableID]; ok {
+		return false
+	}
+	if _, ok := c.moveTableJobs[tableID]; ok {
+		return false
+	}
+	_, _, dispatched := findTaskStatusWithTable(c.taskStatus, tableID)
+	return !dispatched
+}
+
+// reconcileFinishedDeletes dispatches the tables removed by the finished
+// delete operations again if they are not moved to any capture, e.g. the move
+// job is lost as the owner is changed before the operation, which is forced to
+// finish by the unsafe command, is finished. The tables are started from the
+// drain boundaries, or the boundary ts of the operations.
+func (c *changeFeed) reconcileFinishedDeletes(ctx context.Context) error {
+	for captureID, status := range c.taskStatus {
+		var lostTables []model.TableID
+		for tableID, op := range status.Operation {
+			if op.Delete && op.TableApplied() && c.isLostTable(tableID) {
+				lostTables = append(lostTables, tableID)
+			}
+		}
+		if len(lostTables) == 0 {
+			continue
+		}
+		var boundaries map[model.TableID]model.Ts
+		newStatus, _, err := c.etcdCli.AtomicPutTaskStatus(ctx, c.id, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+			boundaries = make(map[model.TableID]model.Ts, len(lostTables))
+			for _, tableID := range lostTables {
+				op, ok := status.Operation[tableID]
+				if !ok || !op.Delete || !op.TableApplied() {
+					continue
+				}
+				boundaryTs := op.BoundaryTs
+				if ts, ok := status.DrainBoundary[tableID]; ok {
+					boundaryTs = ts
+				}
+				delete(status.Operation, tableID)
+				delete(status.DrainBoundary, tableID)
+				boundaries[tableID] = boundaryTs
+			}
+			return len(boundaries) > 0, nil
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.taskStatus[captureID] = newStatus.Clone()
+		for tableID, boundaryTs := range boundaries {
+			log.Warn("the removed table is not moved to any capture, dispatch it again",
+				zap.String("changefeed", c.id),
+				zap.String("capture-id", captureID),
+				zap.Int64("tableID", tableID),
+				zap.Uint64("boundaryTs", boundaryTs))
+			c.orphanTables[tableID] = boundaryTs
+		}
+	}
+	return nil
+}
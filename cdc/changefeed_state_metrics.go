@@ -0,0 +1,240 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// changefeedMetricState is the value of changefeedStateGauge
+type changefeedMetricState float64
+
+// All the values of changefeedStateGauge
+const (
+	changefeedMetricStateNormal changefeedMetricState = iota
+	// changefeedMetricStateWarning means the checkpoint lag of the running
+	// changefeed exceeds the lag threshold, its budget is exceeded for a
+	// sustained period, or some of its table operations are stuck
+	changefeedMetricStateWarning
+	// changefeedMetricStateError means the changefeed is stopped by an error,
+	// or failed to be initialized, it may be resumed or retried
+	changefeedMetricStateError
+	changefeedMetricStateFailed
+	changefeedMetricStateStopped
+	changefeedMetricStateFinished
+)
+
+// changefeedStateMetrics exports one series of changefeedStateGauge for each
+// changefeed known by the owner, one series of maintainTableNumGauge for
+// each processor of the running changefeeds, and one series of
+// stuckOperationNumGauge and initialScanFinishedGauge for each running
+// changefeed. The series of the changefeeds which are removed are deleted, so
+// are the series whose info labels change.
+// It's only accessed by the owner. All methods are no-op on a nil
+// changefeedStateMetrics.
+type changefeedStateMetrics struct {
+	// labels records the label values of the exported state series
+	labels map[model.ChangeFeedID][]string
+	// finished records the finished changefeeds, whose info is deleted, the
+	// series of them are kept until their status expires, see syncFinished.
+	finished map[model.ChangeFeedID]struct{}
+	// tables records the capture label of the exported table num series
+	tables map[model.ChangeFeedID]map[model.CaptureID]string
+}
+
+func newChangefeedStateMetrics() *changefeedStateMetrics {
+	return &changefeedStateMetrics{
+		labels:   make(map[model.ChangeFeedID][]string),
+		finished: make(map[model.ChangeFeedID]struct{}),
+		tables:   make(map[model.ChangeFeedID]map[model.CaptureID]string),
+	}
+}
+
+// sinkScheme returns the lower case scheme of the sink URI, or an empty string
+// if the URI is invalid.
+func sinkScheme(sinkURI string) string {
+	u, err := url.Parse(sinkURI)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// setState exports the state of the changefeed, the label values exported
+// before are kept if info is nil.
+func (m *changefeedStateMetrics) setState(
+	changefeedID model.ChangeFeedID, info *model.ChangeFeedInfo, state changefeedMetricState,
+) {
+	if m == nil {
+		return
+	}
+	prev, exported := m.labels[changefeedID]
+	labels := prev
+	if info != nil || !exported {
+		labels = []string{changefeedID, "", ""}
+		if info != nil {
+			labels[1] = sinkScheme(info.SinkURI)
+			labels[2] = string(info.Engine)
+		}
+	}
+	if exported && (prev[1] != labels[1] || prev[2] != labels[2]) {
+		changefeedStateGauge.DeleteLabelValues(prev...)
+	}
+	m.labels[changefeedID] = labels
+	if state == changefeedMetricStateFinished {
+		m.finished[changefeedID] = struct{}{}
+	} else {
+		delete(m.finished, changefeedID)
+	}
+	changefeedStateGauge.WithLabelValues(labels...).Set(float64(state))
+}
+
+// setTables exports the number of the tables in the task status of each
+// processor, the series of the processors which are gone are deleted.
+func (m *changefeedStateMetrics) setTables(
+	changefeedID model.ChangeFeedID,
+	taskStatus map[model.CaptureID]*model.TaskStatus,
+	captures map[model.CaptureID]*model.CaptureInfo,
+) {
+	if m == nil {
+		return
+	}
+	tables, ok := m.tables[changefeedID]
+	if !ok {
+		tables = make(map[model.CaptureID]string, len(taskStatus))
+		m.tables[changefeedID] = tables
+	}
+	for captureID, capture := range tables {
+		if _, ok := taskStatus[captureID]; !ok {
+			maintainTableNumGauge.DeleteLabelValues(changefeedID, capture)
+			delete(tables, captureID)
+		}
+	}
+	for captureID, status := range taskStatus {
+		capture, ok := tables[captureID]
+		if !ok {
+			capture = captureID
+			if info, ok := captures[captureID]; ok {
+				capture = info.AdvertiseAddr
+			}
+			tables[captureID] = capture
+		}
+		maintainTableNumGauge.WithLabelValues(changefeedID, capture).Set(float64(len(status.Tables)))
+	}
+}
+
+// setStuckOperations exports the number of the stuck table operations of the
+// running changefeed
+func (m *changefeedStateMetrics) setStuckOperations(changefeedID model.ChangeFeedID, n int) {
+	if m == nil {
+		return
+	}
+	stuckOperationNumGauge.WithLabelValues(changefeedID).Set(float64(n))
+}
+
+// setInitialScanFinished exports whether the running changefeed reached the
+// initial scan milestone
+func (m *changefeedStateMetrics) setInitialScanFinished(changefeedID model.ChangeFeedID, finished bool) {
+	if m == nil {
+		return
+	}
+	var v float64
+	if finished {
+		v = 1
+	}
+	initialScanFinishedGauge.WithLabelValues(changefeedID).Set(v)
+}
+
+// dropTables deletes the table num series, the stuck operation series and
+// the initial scan series of the changefeed which is not running
+func (m *changefeedStateMetrics) dropTables(changefeedID model.ChangeFeedID) {
+	if m == nil {
+		return
+	}
+	stuckOperationNumGauge.DeleteLabelValues(changefeedID)
+	initialScanFinishedGauge.DeleteLabelValues(changefeedID)
+	for _, capture := range m.tables[changefeedID] {
+		maintainTableNumGauge.DeleteLabelValues(changefeedID, capture)
+	}
+	delete(m.tables, changefeedID)
+}
+
+// drop deletes all the series of the changefeed
+func (m *changefeedStateMetrics) drop(changefeedID model.ChangeFeedID) {
+	if m == nil {
+		return
+	}
+	m.dropTables(changefeedID)
+	if labels, ok := m.labels[changefeedID]; ok {
+		changefeedStateGauge.DeleteLabelValues(labels...)
+		delete(m.labels, changefeedID)
+	}
+	delete(m.finished, changefeedID)
+}
+
+// syncFinished exports the finished changefeeds derived from the persisted
+// status, so that they're kept across the owner changes, and drops the finished
+// changefeeds whose status expires or is removed.
+func (m *changefeedStateMetrics) syncFinished(finished map[model.ChangeFeedID]struct{}) {
+	if m == nil {
+		return
+	}
+	for changefeedID := range m.finished {
+		if _, ok := finished[changefeedID]; !ok {
+			m.drop(changefeedID)
+		}
+	}
+	for changefeedID := range finished {
+		if _, ok := m.finished[changefeedID]; !ok {
+			m.dropTables(changefeedID)
+			m.setState(changefeedID, nil, changefeedMetricStateFinished)
+		}
+	}
+}
+
+// retain drops the changefeeds which are neither in alive nor finished
+func (m *changefeedStateMetrics) retain(alive map[model.ChangeFeedID]struct{}) {
+	if m == nil {
+		return
+	}
+	for changefeedID := range m.labels {
+		_, ok := alive[changefeedID]
+		_, finished := m.finished[changefeedID]
+		if !ok && !finished {
+			m.drop(changefeedID)
+		}
+	}
+	for changefeedID := range m.tables {
+		if _, ok := alive[changefeedID]; !ok {
+			m.dropTables(changefeedID)
+		}
+	}
+}
+
+// reset drops all the changefeeds, it's called when the owner steps down, so
+// that the series are only exported by the current owner.
+func (m *changefeedStateMetrics) reset() {
+	if m == nil {
+		return
+	}
+	for changefeedID := range m.labels {
+		m.drop(changefeedID)
+	}
+	for changefeedID := range m.tables {
+		m.dropTables(changefeedID)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+type changefeedStateMetricsSuite struct{}
+
+var _ = check.Suite(&changefeedStateMetricsSuite{})
+
+// collectSeries returns the values of the series of the changefeed exported
+// by the gauge, keyed by the label values joined by comma.
+func collectSeries(c *check.C, gauge *prometheus.GaugeVec, changefeedID model.ChangeFeedID) map[string]float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		gauge.Collect(ch)
+		close(ch)
+	}()
+	series := make(map[string]float64)
+	for metric := range ch {
+		m := &dto.Metric{}
+		c.Assert(metric.Write(m), check.IsNil)
+		values := make([]string, 0, len(m.GetLabel()))
+		matched := false
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "changefeed" {
+				matched = label.GetValue() == changefeedID
+				continue
+			}
+			values = append(values, label.GetValue())
+		}
+		if matched {
+			series[strings.Join(values, ",")] = m.GetGauge().GetValue()
+		}
+	}
+	return series
+}
+
+func newStateMetricsTestDetails(c *check.C, infos map[model.ChangeFeedID]*model.ChangeFeedInfo) map[model.ChangeFeedID]*mvccpb.KeyValue {
+	details := make(map[model.ChangeFeedID]*mvccpb.KeyValue, len(infos))
+	for id, info := range infos {
+		value, err := info.Marshal()
+		c.Assert(err, check.IsNil)
+		details[id] = &mvccpb.KeyValue{Value: []byte(value)}
+	}
+	return details
+}
+
+func (s *changefeedStateMetricsSuite) TestLabelLifecycle(c *check.C) {
+	defer testleak.AfterTest(c)()
+	id := "test-state-metrics"
+	info := &model.ChangeFeedInfo{SinkURI: "MySQL://root@127.0.0.1:3306/", Engine: model.SortUnified}
+	o := &Owner{
+		changeFeeds:  make(map[model.ChangeFeedID]*changeFeed),
+		stoppedFeeds: make(map[model.ChangeFeedID]*model.ChangeFeedStatus),
+		captures: map[model.CaptureID]*model.CaptureInfo{
+			"capture-1": {ID: "capture-1", AdvertiseAddr: "127.0.0.1:8300"},
+		},
+		stateMetrics: newChangefeedStateMetrics(),
+	}
+	details := newStateMetricsTestDetails(c, map[model.ChangeFeedID]*model.ChangeFeedInfo{id: info})
+
+	// the changefeed is created
+	o.changeFeeds[id] = &changeFeed{
+		id:   id,
+		info: info,
+		taskStatus: map[model.CaptureID]*model.TaskStatus{
+			"capture-1": {Tables: map[model.TableID]*model.TableReplicaInfo{1: {}, 2: {}}},
+			"capture-2": {Tables: map[model.TableID]*model.TableReplicaInfo{3: {}}},
+		},
+	}
+	o.updateStateMetrics(details)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{"mysql,unified": float64(changefeedMetricStateNormal)})
+	c.Assert(collectSeries(c, maintainTableNumGauge, id), check.DeepEquals,
+		map[string]float64{"127.0.0.1:8300": 2, "capture-2": 1})
+
+	// the table num series of the processor which is gone is deleted
+	delete(o.changeFeeds[id].taskStatus, "capture-2")
+	o.updateStateMetrics(details)
+	c.Assert(collectSeries(c, maintainTableNumGauge, id), check.DeepEquals,
+		map[string]float64{"127.0.0.1:8300": 2})
+
+	// the changefeed is paused
+	delete(o.changeFeeds, id)
+	o.stoppedFeeds[id] = &model.ChangeFeedStatus{AdminJobType: model.AdminStop}
+	o.updateStateMetrics(details)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{"mysql,unified": float64(changefeedMetricStateStopped)})
+	c.Assert(collectSeries(c, maintainTableNumGauge, id), check.HasLen, 0)
+
+	// the changefeed is stopped by an error, and the sort engine is updated
+	info.Error = &model.RunningError{Code: "CDC:ErrSinkURIInvalid"}
+	info.Engine = model.SortInMemory
+	details = newStateMetricsTestDetails(c, map[model.ChangeFeedID]*model.ChangeFeedInfo{id: info})
+	o.updateStateMetrics(details)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{"mysql,memory": float64(changefeedMetricStateError)})
+
+	// the changefeed is failed
+	info.State = model.StateFailed
+	details = newStateMetricsTestDetails(c, map[model.ChangeFeedID]*model.ChangeFeedInfo{id: info})
+	o.updateStateMetrics(details)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{"mysql,memory": float64(changefeedMetricStateFailed)})
+
+	// the changefeed is removed
+	delete(o.stoppedFeeds, id)
+	o.updateStateMetrics(nil)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.HasLen, 0)
+}
+
+func (s *changefeedStateMetricsSuite) TestFinished(c *check.C) {
+	defer testleak.AfterTest(c)()
+	id := "test-state-metrics-finished"
+	m := newChangefeedStateMetrics()
+	info := &model.ChangeFeedInfo{SinkURI: "kafka://127.0.0.1:9092/topic", Engine: model.SortInFile}
+	m.setState(id, info, changefeedMetricStateNormal)
+	m.setTables(id, map[model.CaptureID]*model.TaskStatus{"capture-1": {}}, nil)
+
+	// the finished changefeed is kept with the labels exported before
+	m.dropTables(id)
+	m.setState(id, nil, changefeedMetricStateFinished)
+	m.retain(nil)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{"kafka,file": float64(changefeedMetricStateFinished)})
+	c.Assert(collectSeries(c, maintainTableNumGauge, id), check.HasLen, 0)
+
+	// all the series are deleted once the owner steps down
+	m.reset()
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.HasLen, 0)
+
+	// the finished changefeed is exported again from the persisted status by
+	// the next owner, and it's dropped once the status expires
+	m.syncFinished(map[model.ChangeFeedID]struct{}{id: {}})
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.DeepEquals,
+		map[string]float64{",": float64(changefeedMetricStateFinished)})
+	m.syncFinished(nil)
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.HasLen, 0)
+
+	// no-op on a nil changefeedStateMetrics
+	var nilMetrics *changefeedStateMetrics
+	nilMetrics.setState(id, info, changefeedMetricStateNormal)
+	nilMetrics.reset()
+	c.Assert(collectSeries(c, changefeedStateGauge, id), check.HasLen, 0)
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type changefeedStatusSuite struct{}
+
+var _ = check.Suite(&changefeedStatusSuite{})
+
+func (s *changefeedStatusSuite) TestStatusNeverRegresses(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfID := "test-status-never-regresses"
+	replicaConfig := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(replicaConfig)
+	c.Assert(err, check.IsNil)
+	cfSink, err := sink.NewSink(ctx, cfID, "blackhole://", f, replicaConfig, map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	defer cfSink.Close() //nolint:errcheck
+
+	cf := &changeFeed{
+		id:            cfID,
+		info:          &model.ChangeFeedInfo{},
+		status:        &model.ChangeFeedStatus{ResolvedTs: 100, CheckpointTs: 90},
+		targetTs:      math.MaxUint64,
+		ddlState:      model.ChangeFeedSyncDML,
+		ddlResolvedTs: math.MaxUint64,
+		taskStatus: model.ProcessorsInfos{
+			"capture-1": {},
+		},
+		taskPositions: map[model.CaptureID]*model.TaskPosition{
+			"capture-1": {ResolvedTs: 100, CheckPointTs: 90},
+		},
+		sink: cfSink,
+	}
+	resolvedClamps := changefeedStatusClampCounter.WithLabelValues(cfID, "resolved-ts")
+	checkpointClamps := changefeedStatusClampCounter.WithLabelValues(cfID, "checkpoint-ts")
+
+	// a capture joins with an older resolved ts
+	cf.taskStatus["capture-2"] = &model.TaskStatus{}
+	cf.taskPositions["capture-2"] = &model.TaskPosition{ResolvedTs: 50, CheckPointTs: 40}
+	err = cf.calcResolvedTs(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.status.ResolvedTs, check.Equals, uint64(100))
+	c.Assert(cf.status.CheckpointTs, check.Equals, uint64(90))
+	c.Assert(testutil.ToFloat64(resolvedClamps), check.Equals, float64(1))
+	c.Assert(testutil.ToFloat64(checkpointClamps), check.Equals, float64(1))
+
+	// the new capture catches up, but not beyond the published status yet
+	cf.taskPositions["capture-2"] = &model.TaskPosition{ResolvedTs: 95, CheckPointTs: 85}
+	err = cf.calcResolvedTs(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.status.ResolvedTs, check.Equals, uint64(100))
+	c.Assert(cf.status.CheckpointTs, check.Equals, uint64(90))
+	c.Assert(testutil.ToFloat64(resolvedClamps), check.Equals, float64(2))
+	c.Assert(testutil.ToFloat64(checkpointClamps), check.Equals, float64(2))
+
+	// the status advances once all captures are beyond the published status
+	cf.taskPositions["capture-1"] = &model.TaskPosition{ResolvedTs: 130, CheckPointTs: 115}
+	cf.taskPositions["capture-2"] = &model.TaskPosition{ResolvedTs: 120, CheckPointTs: 110}
+	err = cf.calcResolvedTs(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.status.ResolvedTs, check.Equals, uint64(120))
+	c.Assert(cf.status.CheckpointTs, check.Equals, uint64(110))
+	c.Assert(testutil.ToFloat64(resolvedClamps), check.Equals, float64(2))
+	c.Assert(testutil.ToFloat64(checkpointClamps), check.Equals, float64(2))
+}
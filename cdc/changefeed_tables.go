@@ -0,0 +1,208 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	tidbkv "github.com/pingcap/tidb/kv"
+)
+
+// ChangefeedTableResp is the replication status of a table on a capture
+type ChangefeedTableResp struct {
+	CaptureID   string        `json:"capture-id"`
+	CaptureAddr string        `json:"capture-address"`
+	TableID     model.TableID `json:"table-id"`
+	// TableName is empty if the table is not found in the schema snapshot,
+	// e.g. the table is dropped after the checkpoint ts.
+	TableName    string   `json:"table-name"`
+	ResolvedTs   model.Ts `json:"resolved-ts"`
+	CheckpointTs model.Ts `json:"checkpoint-ts"`
+	// Operation is the pending operation of the table, e.g. "delete (processed)",
+	// it's empty if there is no pending operation.
+	Operation string `json:"operation,omitempty"`
+	// MarkTableID is the mark table of the table in the cyclic replication,
+	// and MarkTable is set if the table is a mark table, which is listened
+	// with the tables referencing it rather than replicated by itself.
+	MarkTableID model.TableID `json:"mark-table-id,omitempty"`
+	MarkTable   bool          `json:"mark-table,omitempty"`
+}
+
+// ListChangefeedTables lists the tables of the changefeed with the captures
+// replicating them. The table names are resolved by the schema snapshot at the
+// checkpoint ts of the changefeed. If tableName is not empty, only the tables
+// whose name matches tableName (in the form of schema.table) are returned.
+func ListChangefeedTables(
+	ctx context.Context, etcdCli kv.CDCEtcdClient, kvStore tidbkv.Storage, changefeedID string, tableName string,
+) ([]*ChangefeedTableResp, error) {
+	info, err := etcdCli.GetChangeFeedInfo(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	checkpointTs := info.GetCheckpointTs(nil)
+	status, _, err := etcdCli.GetChangeFeedStatus(ctx, changefeedID)
+	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+		return nil, errors.Trace(err)
+	}
+	if status != nil {
+		checkpointTs = status.CheckpointTs
+	}
+	_, captures, err := etcdCli.GetCaptures(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	taskStatus, err := etcdCli.GetAllTaskStatus(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	taskPositions, err := etcdCli.GetAllTaskPositions(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	meta, err := kv.GetSnapshotMeta(kvStore, checkpointTs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	snap, err := entry.NewSingleSchemaSnapshotFromMeta(meta, checkpointTs, info.Config.ForceReplicate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tableNameByID := func(tableID model.TableID) string {
+		name, ok := snap.GetTableNameByID(tableID)
+		if !ok {
+			return ""
+		}
+		return name.String()
+	}
+
+	tables := collectChangefeedTables(captures, taskStatus, taskPositions, tableNameByID)
+	if tableName == "" {
+		return tables, nil
+	}
+	matched := make([]*ChangefeedTableResp, 0, len(tables))
+	for _, table := range tables {
+		if strings.EqualFold(table.TableName, tableName) {
+			matched = append(matched, table)
+		}
+	}
+	return matched, nil
+}
+
+// collectChangefeedTables joins the table assignments and the pending
+// operations in the task status with the progress in the task position of
+// each capture. A table being moved is listed on both the source capture
+// (with a delete operation) and the target capture (with an add operation).
+// The mark tables of the cyclic replication are listed once on each capture
+// listening them.
+func collectChangefeedTables(
+	captures []*model.CaptureInfo,
+	taskStatus model.ProcessorsInfos,
+	taskPositions map[model.CaptureID]*model.TaskPosition,
+	tableNameByID func(model.TableID) string,
+) []*ChangefeedTableResp {
+	captureAddrs := make(map[model.CaptureID]string, len(captures))
+	for _, capture := range captures {
+		captureAddrs[capture.ID] = capture.AdvertiseAddr
+	}
+	tables := make([]*ChangefeedTableResp, 0)
+	for captureID, status := range taskStatus {
+		tableIDs := make(map[model.TableID]struct{}, len(status.Tables))
+		markTableIDs := make(map[model.TableID]struct{})
+		for tableID, replicaInfo := range status.Tables {
+			tableIDs[tableID] = struct{}{}
+			if replicaInfo != nil && replicaInfo.MarkTableID != 0 {
+				markTableIDs[replicaInfo.MarkTableID] = struct{}{}
+			}
+		}
+		// the table being removed is deleted from the table list, but it's
+		// still replicated by the capture until the operation is finished.
+		for tableID := range status.Operation {
+			tableIDs[tableID] = struct{}{}
+		}
+		position := taskPositions[captureID]
+		for tableID := range tableIDs {
+			table := &ChangefeedTableResp{
+				CaptureID:   captureID,
+				CaptureAddr: captureAddrs[captureID],
+				TableID:     tableID,
+				TableName:   tableNameByID(tableID),
+				Operation:   tableOperationString(status.Operation[tableID]),
+			}
+			if replicaInfo := status.Tables[tableID]; replicaInfo != nil {
+				table.MarkTableID = replicaInfo.MarkTableID
+			}
+			if position != nil {
+				table.CheckpointTs = position.CheckPointTs
+				table.ResolvedTs = position.ResolvedTs
+				// only the slowest tables are published, and the
+				// processors of old versions don't publish the progress
+				// of each table
+				if ts, ok := position.TableResolvedTs[tableID]; ok {
+					table.ResolvedTs = ts
+					if ts < table.CheckpointTs {
+						table.CheckpointTs = ts
+					}
+				}
+			}
+			tables = append(tables, table)
+		}
+		for tableID := range markTableIDs {
+			table := &ChangefeedTableResp{
+				CaptureID:   captureID,
+				CaptureAddr: captureAddrs[captureID],
+				TableID:     tableID,
+				TableName:   tableNameByID(tableID),
+				MarkTable:   true,
+			}
+			if position != nil {
+				table.CheckpointTs = position.CheckPointTs
+				table.ResolvedTs = position.ResolvedTs
+			}
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].TableID != tables[j].TableID {
+			return tables[i].TableID < tables[j].TableID
+		}
+		return tables[i].CaptureID < tables[j].CaptureID
+	})
+	return tables
+}
+
+func tableOperationString(op *model.TableOperation) string {
+	if op == nil {
+		return ""
+	}
+	typ := "add"
+	if op.Delete {
+		typ = "delete"
+	}
+	status := "dispatched"
+	switch {
+	case op.Status == model.OperFinished:
+		status = "finished"
+	case op.TableProcessed():
+		status = "processed"
+	}
+	return typ + " (" + status + ")"
+}
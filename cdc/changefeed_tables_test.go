@@ -0,0 +1,141 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type changefeedTablesSuite struct{}
+
+var _ = check.Suite(&changefeedTablesSuite{})
+
+func (s *changefeedTablesSuite) TestCollectChangefeedTables(c *check.C) {
+	defer testleak.AfterTest(c)()
+	captures := []*model.CaptureInfo{
+		{ID: "capture-1", AdvertiseAddr: "127.0.0.1:8300"},
+		{ID: "capture-2", AdvertiseAddr: "127.0.0.1:8301"},
+	}
+	taskStatus := model.ProcessorsInfos{
+		"capture-1": {
+			Tables: map[model.TableID]*model.TableReplicaInfo{
+				45: {StartTs: 100},
+			},
+			// table 47 is being moved to capture-2
+			Operation: map[model.TableID]*model.TableOperation{
+				47: {Delete: true, BoundaryTs: 120, Status: model.OperProcessed},
+			},
+		},
+		"capture-2": {
+			Tables: map[model.TableID]*model.TableReplicaInfo{
+				47: {StartTs: 120},
+			},
+			Operation: map[model.TableID]*model.TableOperation{
+				47: {BoundaryTs: 120, Status: model.OperDispatched},
+			},
+		},
+	}
+	taskPositions := map[model.CaptureID]*model.TaskPosition{
+		"capture-1": {
+			CheckPointTs:    130,
+			ResolvedTs:      140,
+			TableResolvedTs: map[model.TableID]model.Ts{45: 150, 47: 140},
+		},
+		// the processor of an old version doesn't publish the progress of tables
+		"capture-2": {CheckPointTs: 110, ResolvedTs: 120},
+	}
+	names := map[model.TableID]string{45: "test.t1", 47: "test.t2"}
+	tables := collectChangefeedTables(captures, taskStatus, taskPositions, func(id model.TableID) string {
+		return names[id]
+	})
+	c.Assert(tables, check.DeepEquals, []*ChangefeedTableResp{
+		{
+			CaptureID: "capture-1", CaptureAddr: "127.0.0.1:8300", TableID: 45, TableName: "test.t1",
+			ResolvedTs: 150, CheckpointTs: 130,
+		},
+		{
+			CaptureID: "capture-1", CaptureAddr: "127.0.0.1:8300", TableID: 47, TableName: "test.t2",
+			ResolvedTs: 140, CheckpointTs: 130, Operation: "delete (processed)",
+		},
+		{
+			CaptureID: "capture-2", CaptureAddr: "127.0.0.1:8301", TableID: 47, TableName: "test.t2",
+			ResolvedTs: 120, CheckpointTs: 110, Operation: "add (dispatched)",
+		},
+	})
+
+	// the task position is not published yet
+	tables = collectChangefeedTables(nil, model.ProcessorsInfos{
+		"capture-3": {Tables: map[model.TableID]*model.TableReplicaInfo{49: {StartTs: 100}}},
+	}, nil, func(id model.TableID) string { return "" })
+	c.Assert(tables, check.DeepEquals, []*ChangefeedTableResp{{CaptureID: "capture-3", TableID: 49}})
+
+	tables = collectChangefeedTables(nil, nil, nil, func(id model.TableID) string { return "" })
+	c.Assert(tables, check.HasLen, 0)
+}
+
+func (s *changefeedTablesSuite) TestCollectMarkTables(c *check.C) {
+	defer testleak.AfterTest(c)()
+	captures := []*model.CaptureInfo{{ID: "capture-1", AdvertiseAddr: "127.0.0.1:8300"}}
+	// the mark table 60 is shared by the partitions 45 and 47 of the table
+	taskStatus := model.ProcessorsInfos{
+		"capture-1": {
+			Tables: map[model.TableID]*model.TableReplicaInfo{
+				45: {StartTs: 100, MarkTableID: 60},
+				47: {StartTs: 100, MarkTableID: 60},
+			},
+		},
+	}
+	taskPositions := map[model.CaptureID]*model.TaskPosition{
+		"capture-1": {CheckPointTs: 130, ResolvedTs: 140},
+	}
+	names := map[model.TableID]string{45: "test.t1", 47: "test.t1", 60: "tidb_cdc.repl_mark_test_t1"}
+	tables := collectChangefeedTables(captures, taskStatus, taskPositions, func(id model.TableID) string {
+		return names[id]
+	})
+	c.Assert(tables, check.HasLen, 3)
+	c.Assert(tables[0].MarkTableID, check.Equals, model.TableID(60))
+	c.Assert(tables[0].MarkTable, check.IsFalse)
+	c.Assert(tables[1].MarkTableID, check.Equals, model.TableID(60))
+	c.Assert(tables[2], check.DeepEquals, &ChangefeedTableResp{
+		CaptureID: "capture-1", CaptureAddr: "127.0.0.1:8300", TableID: 60, TableName: "tidb_cdc.repl_mark_test_t1",
+		ResolvedTs: 140, CheckpointTs: 130, MarkTable: true,
+	})
+}
+
+func (s *changefeedTablesSuite) TestTableOperationString(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(tableOperationString(nil), check.Equals, "")
+	c.Assert(tableOperationString(&model.TableOperation{}), check.Equals, "add (dispatched)")
+	c.Assert(tableOperationString(&model.TableOperation{Status: model.OperProcessed}), check.Equals, "add (processed)")
+	c.Assert(tableOperationString(&model.TableOperation{Delete: true, Done: true}), check.Equals, "delete (processed)")
+	c.Assert(tableOperationString(&model.TableOperation{Delete: true, Status: model.OperFinished}), check.Equals, "delete (finished)")
+}
+
+func (s *changefeedTablesSuite) TestSlowestTablesResolvedTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	p := &processor{tables: make(map[int64]*tableInfo)}
+	c.Assert(p.slowestTablesResolvedTs(), check.IsNil)
+	for i := 0; i < maxReportedTableResolvedTs*2; i++ {
+		id := int64(100 + i)
+		p.tables[id] = &tableInfo{id: id, resolvedTs: uint64(1000 - i)}
+	}
+	resolvedTs := p.slowestTablesResolvedTs()
+	c.Assert(resolvedTs, check.HasLen, maxReportedTableResolvedTs)
+	for id, ts := range resolvedTs {
+		c.Assert(id >= int64(100+maxReportedTableResolvedTs), check.IsTrue)
+		c.Assert(ts, check.Equals, uint64(1000-(id-100)))
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+// checkpointGuardPersistInterval is the min interval of persisting the guard
+const checkpointGuardPersistInterval = 5 * time.Second
+
+// checkpointGuard stops the processor when the global checkpoint ts of the
+// changefeed moves backwards, e.g. by a bug of the owner, so that the events
+// already replicated are not applied to the downstream again. The global
+// checkpoint ts is never higher than the checkpoint ts flushed by any
+// processor, so the highest one observed is recorded in a separate etcd key
+// of each processor. The guards of all processors are loaded on startup. A
+// nil guard means the guard is disabled.
+type checkpointGuard struct {
+	etcdCli      kv.CDCEtcdClient
+	changefeedID model.ChangeFeedID
+	capture      model.CaptureInfo
+	createTime   time.Time
+	tolerance    time.Duration
+
+	guardTs     model.Ts
+	persistedTs model.Ts
+	lastPersist time.Time
+}
+
+// newCheckpointGuard loads the guards of the changefeed recorded by all
+// processors, nil is returned if the guard is disabled. The guards are
+// removed if the guard is disabled, so that it starts over once enabled.
+func newCheckpointGuard(
+	ctx context.Context, etcdCli kv.CDCEtcdClient, changefeedID model.ChangeFeedID,
+	capture model.CaptureInfo, info *model.ChangeFeedInfo,
+) (*checkpointGuard, error) {
+	if info.Config == nil || info.Config.CheckpointGuard == nil || !info.Config.CheckpointGuard.Enable {
+		return nil, errors.Trace(etcdCli.RemoveAllCheckpointGuards(ctx, changefeedID))
+	}
+	guards, err := etcdCli.GetCheckpointGuards(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	g := &checkpointGuard{
+		etcdCli:      etcdCli,
+		changefeedID: changefeedID,
+		capture:      capture,
+		createTime:   info.CreateTime,
+		tolerance:    time.Duration(info.Config.CheckpointGuard.Tolerance) * time.Second,
+	}
+	stale := make(map[model.CaptureID]*model.CheckpointGuard)
+	for id, guard := range guards {
+		if !guard.CreateTime.Equal(info.CreateTime) {
+			stale[id] = guard
+			continue
+		}
+		if guard.CheckpointTs > g.guardTs {
+			g.guardTs = guard.CheckpointTs
+		}
+	}
+	// the guards recorded before the changefeed is recreated are removed
+	if err := etcdCli.DeleteCheckpointGuards(ctx, changefeedID, stale); err != nil {
+		return nil, errors.Trace(err)
+	}
+	g.persistedTs = g.guardTs
+	log.Info("checkpoint guard loaded", zap.Uint64("guardTs", g.guardTs),
+		zap.Duration("tolerance", g.tolerance), util.ZapFieldChangefeed(ctx))
+	return g, nil
+}
+
+// check returns an error if the global checkpoint ts is lower than the
+// guard by more than the tolerance, otherwise the guard is advanced to it.
+// It's no-op on a nil guard.
+func (g *checkpointGuard) check(ctx context.Context, checkpointTs model.Ts) error {
+	if g == nil || checkpointTs == 0 {
+		return nil
+	}
+	if checkpointTs < g.guardTs {
+		lag := oracle.GetTimeFromTS(g.guardTs).Sub(oracle.GetTimeFromTS(checkpointTs))
+		if lag > g.tolerance {
+			log.Error("the global checkpoint ts moves backwards, refuse to replicate the events again",
+				zap.Uint64("checkpointTs", checkpointTs), zap.Uint64("guardTs", g.guardTs),
+				zap.Duration("lag", lag), zap.Duration("tolerance", g.tolerance),
+				util.ZapFieldChangefeed(ctx))
+			checkpointRegressedCounter.WithLabelValues(g.changefeedID, g.capture.AdvertiseAddr).Inc()
+			return cerror.ErrCheckpointRegressed.GenWithStackByArgs(checkpointTs, g.guardTs, g.tolerance)
+		}
+		return nil
+	}
+	g.guardTs = checkpointTs
+	if g.guardTs > g.persistedTs && time.Since(g.lastPersist) >= checkpointGuardPersistInterval {
+		return errors.Trace(g.persist(ctx))
+	}
+	return nil
+}
+
+// persist records the guard in the key of the processor, the keys of the
+// other processors which are not higher than it are removed, as they don't
+// guard anything more.
+func (g *checkpointGuard) persist(ctx context.Context) error {
+	err := g.etcdCli.PutCheckpointGuard(ctx, g.changefeedID, g.capture.ID, &model.CheckpointGuard{
+		CheckpointTs: g.guardTs,
+		CreateTime:   g.createTime,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	g.persistedTs = g.guardTs
+	g.lastPersist = time.Now()
+	guards, err := g.etcdCli.GetCheckpointGuards(ctx, g.changefeedID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for id, guard := range guards {
+		if id == g.capture.ID || guard.CheckpointTs > g.guardTs {
+			delete(guards, id)
+		}
+	}
+	return errors.Trace(g.etcdCli.DeleteCheckpointGuards(ctx, g.changefeedID, guards))
+}
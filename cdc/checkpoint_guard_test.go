@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type checkpointGuardSuite struct{}
+
+var _ = check.Suite(&checkpointGuardSuite{})
+
+func newCheckpointGuardTestInfo(enable bool, tolerance int) *model.ChangeFeedInfo {
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.CheckpointGuard = &config.CheckpointGuardConfig{Enable: enable, Tolerance: tolerance}
+	return &model.ChangeFeedInfo{CreateTime: time.Unix(1600000000, 0), Config: cfg}
+}
+
+func (s *checkpointGuardSuite) TestCheck(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+	feedID := "test-changefeed"
+	now := time.Now()
+	ts := func(d time.Duration) model.Ts {
+		return oracle.ComposeTS(oracle.GetPhysical(now.Add(d)), 0)
+	}
+	info := newCheckpointGuardTestInfo(true, 60)
+
+	guard, err := newCheckpointGuard(ctx, etcdCli, feedID, model.CaptureInfo{ID: "capture-1"}, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(guard.check(ctx, ts(0)), check.IsNil)
+	guards, err := etcdCli.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 1)
+	c.Assert(guards["capture-1"].CheckpointTs, check.Equals, ts(0))
+
+	// the global checkpoint moving backwards within the tolerance is allowed
+	c.Assert(guard.check(ctx, ts(-30*time.Second)), check.IsNil)
+	c.Assert(guard.guardTs, check.Equals, ts(0))
+	err = guard.check(ctx, ts(-2*time.Minute))
+	c.Assert(cerror.ErrCheckpointRegressed.Equal(err), check.IsTrue, check.Commentf("%v", err))
+
+	// the guard persisted is loaded by the processor on another capture
+	guard, err = newCheckpointGuard(ctx, etcdCli, feedID, model.CaptureInfo{ID: "capture-2"}, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(guard.guardTs, check.Equals, ts(0))
+	err = guard.check(ctx, ts(-2*time.Minute))
+	c.Assert(cerror.ErrCheckpointRegressed.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	// the guard of capture-1 is removed once capture-2 persists a higher one
+	c.Assert(guard.check(ctx, ts(time.Minute)), check.IsNil)
+	guards, err = etcdCli.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 1)
+	c.Assert(guards["capture-2"].CheckpointTs, check.Equals, ts(time.Minute))
+
+	// the guards recorded before the changefeed is recreated are ignored
+	recreated := newCheckpointGuardTestInfo(true, 60)
+	recreated.CreateTime = info.CreateTime.Add(time.Hour)
+	guard, err = newCheckpointGuard(ctx, etcdCli, feedID, model.CaptureInfo{ID: "capture-1"}, recreated)
+	c.Assert(err, check.IsNil)
+	c.Assert(guard.check(ctx, ts(-2*time.Minute)), check.IsNil)
+
+	// the guards are removed once the guard is disabled
+	guard, err = newCheckpointGuard(ctx, etcdCli, feedID, model.CaptureInfo{ID: "capture-1"}, newCheckpointGuardTestInfo(false, 0))
+	c.Assert(err, check.IsNil)
+	c.Assert(guard, check.IsNil)
+	c.Assert(guard.check(ctx, ts(-time.Hour)), check.IsNil)
+	guards, err = etcdCli.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 0)
+}
+
+func (s *checkpointGuardSuite) TestGlobalStatusRegressed(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feedID := "test-changefeed"
+	checkpointTs := oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	regressedTs := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Hour)), 0)
+
+	// the guard recorded by the processor on another capture
+	err := etcdCli.PutCheckpointGuard(ctx, feedID, "capture-2", &model.CheckpointGuard{
+		CheckpointTs: checkpointTs,
+		CreateTime:   time.Unix(1600000000, 0),
+	})
+	c.Assert(err, check.IsNil)
+	err = etcdCli.PutChangeFeedStatus(ctx, feedID, &model.ChangeFeedStatus{
+		ResolvedTs:   checkpointTs,
+		CheckpointTs: checkpointTs,
+	})
+	c.Assert(err, check.IsNil)
+
+	p := newProcessorForTest(withOutputSize(1))
+	p.changefeedID = feedID
+	p.changefeed = *newCheckpointGuardTestInfo(true, 60)
+	p.etcdCli = etcdCli
+	p.checkpointTs = checkpointTs
+	p.schemaGCWorker = entry.NewSchemaGCWorker(nil, func() uint64 { return 0 })
+	p.schemaGCFloor = newSchemaGCFloor(&config.SchemaGCConfig{})
+	done := make(chan error, 1)
+	go func() {
+		done <- p.globalStatusWorker(ctx)
+	}()
+	for atomic.LoadUint64(&p.globalcheckpointTs) != checkpointTs {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the owner writes a global checkpoint ts an hour behind the guard
+	err = etcdCli.PutChangeFeedStatus(ctx, feedID, &model.ChangeFeedStatus{
+		ResolvedTs:   checkpointTs,
+		CheckpointTs: regressedTs,
+	})
+	c.Assert(err, check.IsNil)
+	select {
+	case err := <-done:
+		c.Assert(cerror.ErrCheckpointRegressed.Equal(errors.Cause(err)), check.IsTrue, check.Commentf("%v", err))
+	case <-time.After(10 * time.Second):
+		c.Fatal("the checkpoint guard doesn't trip")
+	}
+	c.Assert(atomic.LoadUint64(&p.globalcheckpointTs), check.Equals, checkpointTs)
+}
@@ -0,0 +1,402 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// validationBreaker collects the validation failures detected by the sink and
+// the mounter of a processor, which are reported to the owner in the task
+// position. Each detector trips once for each table in a breaker epoch, the
+// trips are dropped once the breaker is reset and the epoch is increased.
+// All methods are no-op on a nil breaker.
+type validationBreaker struct {
+	captureID           model.CaptureID
+	quarantineThreshold int
+
+	mu sync.Mutex
+	// epochKnown is false until the epoch of the changefeed is read, the
+	// trips before it are taken as the trips of the first epoch read
+	epochKnown  bool
+	epoch       uint64
+	trips       []*model.BreakerTrip
+	tripped     map[breakerTripKey]struct{}
+	quarantined map[model.TableID]int
+	// version is increased once the trips are changed
+	version uint64
+}
+
+type breakerTripKey struct {
+	detector model.BreakerDetector
+	tableID  model.TableID
+}
+
+func newValidationBreaker(captureID model.CaptureID, cfg *config.CircuitBreakerConfig) *validationBreaker {
+	if cfg == nil {
+		cfg = config.GetDefaultReplicaConfig().CircuitBreaker
+	}
+	return &validationBreaker{
+		captureID:           captureID,
+		quarantineThreshold: cfg.QuarantineThreshold,
+		tripped:             make(map[breakerTripKey]struct{}),
+		quarantined:         make(map[model.TableID]int),
+	}
+}
+
+// ReportValidationFailure implements sink.ValidationReporter
+func (b *validationBreaker) ReportValidationFailure(detector model.BreakerDetector, tableID model.TableID, message string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trip(detector, tableID, message)
+}
+
+// observeQuarantine implements entry.QuarantineObserver, the breaker is
+// tripped once the quarantined rows of the table exceed the threshold.
+func (b *validationBreaker) observeQuarantine(tableID model.TableID, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.quarantined[tableID]++
+	if rows := b.quarantined[tableID]; rows > b.quarantineThreshold {
+		b.trip(model.BreakerDetectorQuarantinedRows, tableID,
+			fmt.Sprintf("%d malformed rows are quarantined, the last error: %s", rows, err))
+	}
+}
+
+// trip records the failure, the caller must hold mu.
+func (b *validationBreaker) trip(detector model.BreakerDetector, tableID model.TableID, message string) {
+	key := breakerTripKey{detector: detector, tableID: tableID}
+	if _, ok := b.tripped[key]; ok {
+		return
+	}
+	b.tripped[key] = struct{}{}
+	trip := &model.BreakerTrip{
+		Detector:  detector,
+		TableID:   tableID,
+		CaptureID: b.captureID,
+		Epoch:     b.epoch,
+		Message:   message,
+		Time:      time.Now(),
+	}
+	b.trips = append(b.trips, trip)
+	b.version++
+	log.Warn("the circuit breaker is tripped by the validation failure", zap.Reflect("trip", trip))
+}
+
+// setEpoch sets the breaker epoch of the changefeed, the trips of the
+// previous epochs are dropped.
+func (b *validationBreaker) setEpoch(epoch uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.epochKnown {
+		b.epochKnown = true
+		b.epoch = epoch
+		for _, trip := range b.trips {
+			trip.Epoch = epoch
+		}
+		b.version++
+		return
+	}
+	if epoch <= b.epoch {
+		return
+	}
+	b.epoch = epoch
+	b.trips = nil
+	b.tripped = make(map[breakerTripKey]struct{})
+	b.quarantined = make(map[model.TableID]int)
+	b.version++
+}
+
+// snapshot returns the trips of the current epoch and the version of them
+func (b *validationBreaker) snapshot() ([]*model.BreakerTrip, uint64) {
+	if b == nil {
+		return nil, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	trips := make([]*model.BreakerTrip, 0, len(b.trips))
+	for _, trip := range b.trips {
+		t := *trip
+		trips = append(trips, &t)
+	}
+	return trips, b.version
+}
+
+// breakerAction returns the action configured for the failures of the detector
+func breakerAction(cfg *config.CircuitBreakerConfig, detector model.BreakerDetector) string {
+	if cfg == nil {
+		return config.BreakerActionWarn
+	}
+	switch detector {
+	case model.BreakerDetectorConsistencyMismatch:
+		return cfg.ConsistencyMismatch
+	case model.BreakerDetectorOrderingViolation:
+		return cfg.OrderingViolation
+	case model.BreakerDetectorQuarantinedRows:
+		return cfg.QuarantinedRows
+	}
+	return config.BreakerActionWarn
+}
+
+// newBreakerTrips returns the trips of the current epoch reported by the
+// processors which are not handled yet, in the order of the captures.
+func (c *changeFeed) newBreakerTrips() []*model.BreakerTrip {
+	captureIDs := make([]model.CaptureID, 0, len(c.taskPositions))
+	for captureID, position := range c.taskPositions {
+		if len(position.BreakerTrips) != 0 {
+			captureIDs = append(captureIDs, captureID)
+		}
+	}
+	sort.Strings(captureIDs)
+	var trips []*model.BreakerTrip
+	for _, captureID := range captureIDs {
+	next:
+		for _, trip := range c.taskPositions[captureID].BreakerTrips {
+			if trip.Epoch != c.status.BreakerEpoch {
+				continue
+			}
+			for _, handled := range c.status.BreakerTrips {
+				if handled.SameTrip(trip) {
+					continue next
+				}
+			}
+			t := *trip
+			trips = append(trips, &t)
+		}
+	}
+	return trips
+}
+
+// pauseTable stops replicating the table tripping the breaker. It's removed
+// from the processor at the checkpoint ts, and replicated from there after the
+// breaker is reset. The other tables keep replicating, the data after the ts
+// of the paused table is retained by the service gc safepoint. The DDLs of the
+// table executed during the pause are not replayed.
+func (c *changeFeed) pauseTable(ctx context.Context, trip *model.BreakerTrip) error {
+	tableID := trip.TableID
+	startTs := c.status.CheckpointTs
+	if table, ok := c.status.PausedTables[tableID]; ok {
+		if table.Epoch >= c.status.BreakerEpoch {
+			return nil
+		}
+		// the table is paused again before it catches up with the ts it's
+		// resumed from
+		startTs = table.StartTs
+	}
+	delete(c.moveTableJobs, tableID)
+	if ts, ok := c.orphanTables[tableID]; ok {
+		delete(c.orphanTables, tableID)
+		startTs = ts
+	} else if captureID, _, ok := findTaskStatusWithTable(c.taskStatus, tableID); ok {
+		newStatus, _, err := c.etcdCli.AtomicPutTaskStatus(ctx, c.id, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+			_, exist := status.RemoveTable(tableID, startTs)
+			return exist, nil
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.taskStatus[captureID] = newStatus.Clone()
+	} else {
+		log.Warn("the table tripping the circuit breaker is not replicated, ignore it",
+			zap.String("changefeed", c.id), zap.Int64("tableID", tableID))
+		return nil
+	}
+	if c.status.PausedTables == nil {
+		c.status.PausedTables = make(map[model.TableID]*model.PausedTable)
+	}
+	c.status.PausedTables[tableID] = &model.PausedTable{
+		StartTs:  startTs,
+		Epoch:    c.status.BreakerEpoch,
+		Detector: trip.Detector,
+		Message:  trip.Message,
+		Time:     trip.Time,
+	}
+	log.Warn("the table is paused by the circuit breaker",
+		zap.String("changefeed", c.id), zap.Int64("tableID", tableID), zap.Uint64("startTs", startTs))
+	return nil
+}
+
+// restoreBreaker restores the state of the circuit breaker from the status of
+// the changefeed which is just created, the paused tables are kept unscheduled
+// unless the breaker is reset after they're paused, and the resumed tables are
+// kept in the status until they catch up with the ts they're resumed from.
+func (c *changeFeed) restoreBreaker(status *model.ChangeFeedStatus) {
+	c.status.BreakerEpoch = status.BreakerEpoch
+	c.status.BreakerTrips = status.BreakerTrips
+	for tableID, table := range status.PausedTables {
+		_, orphan := c.orphanTables[tableID]
+		if table.Epoch < status.BreakerEpoch {
+			if orphan {
+				c.orphanTables[tableID] = table.StartTs
+			} else if _, _, ok := findTaskStatusWithTable(c.taskStatus, tableID); !ok {
+				// the table is dropped after it's resumed
+				continue
+			}
+		} else if !orphan {
+			// the table is dropped during the pause
+			continue
+		} else {
+			delete(c.orphanTables, tableID)
+		}
+		if c.status.PausedTables == nil {
+			c.status.PausedTables = make(map[model.TableID]*model.PausedTable)
+		}
+		c.status.PausedTables[tableID] = table
+	}
+}
+
+// resetBreaker resets the circuit breaker, the paused tables are replicated
+// again from the ts they are paused at. They're kept in the status with the
+// previous epoch, so that the ts is retained until they catch up with it,
+// even if the owner is switched before.
+func (c *changeFeed) resetBreaker() {
+	epoch := c.status.BreakerEpoch
+	c.status.BreakerEpoch++
+	c.status.BreakerTrips = nil
+	for tableID, table := range c.status.PausedTables {
+		if table.Epoch < epoch {
+			// resumed by a previous reset
+			continue
+		}
+		c.orphanTables[tableID] = table.StartTs
+		log.Info("the table paused by the circuit breaker is resumed",
+			zap.String("changefeed", c.id), zap.Int64("tableID", tableID), zap.Uint64("startTs", table.StartTs))
+	}
+}
+
+// clearResumedTables drops the tables resumed by a reset of the circuit
+// breaker from the status once they're scheduled and the checkpoint of the
+// processors passes the ts they're resumed from.
+func (c *changeFeed) clearResumedTables(checkpointTs uint64) {
+	for tableID, table := range c.status.PausedTables {
+		if table.Epoch >= c.status.BreakerEpoch || checkpointTs <= table.StartTs {
+			continue
+		}
+		if _, ok := c.orphanTables[tableID]; ok {
+			continue
+		}
+		delete(c.status.PausedTables, tableID)
+		log.Info("the table resumed by the circuit breaker catches up",
+			zap.String("changefeed", c.id), zap.Int64("tableID", tableID), zap.Uint64("startTs", table.StartTs))
+	}
+}
+
+// handleBreakerTrips handles the new trips of the circuit breakers of every
+// changefeed with the actions configured.
+func (o *Owner) handleBreakerTrips(ctx context.Context) error {
+	for _, cf := range o.changeFeeds {
+		for _, trip := range cf.newBreakerTrips() {
+			trip.Action = breakerAction(cf.info.Config.CircuitBreaker, trip.Detector)
+			cf.status.BreakerTrips = append(cf.status.BreakerTrips, trip)
+			log.Warn("handle the trip of the circuit breaker", zap.String("changefeed", cf.id), zap.Reflect("trip", trip))
+			o.history.record(cf.id, model.ChangefeedEventBreakerTrip, cf.status.CheckpointTs, "",
+				"the %s of table %d detected by capture %s trips the circuit breaker, action %s: %s",
+				trip.Detector, trip.TableID, trip.CaptureID, trip.Action, trip.Message)
+			runningErr := &model.RunningError{
+				Addr:    util.CaptureAddrFromCtx(ctx),
+				Code:    string(cerror.ErrCircuitBreakerTripped.RFCCode()),
+				Message: cerror.ErrCircuitBreakerTripped.GenWithStackByArgs(trip.Detector, trip.TableID, trip.Message).Error(),
+			}
+			o.notifier.notify(cf.id, cf.info, NotifyEventBreakerTripped, cf.info.State, runningErr, cf.status.CheckpointTs)
+			switch trip.Action {
+			case config.BreakerActionPauseTable:
+				if err := cf.pauseTable(ctx, trip); err != nil {
+					return errors.Trace(err)
+				}
+			case config.BreakerActionPauseChangefeed:
+				err := o.EnqueueJob(model.AdminJob{CfID: cf.id, Type: model.AdminStop, Error: runningErr})
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// breakerReset is a reset of the circuit breaker of a changefeed
+type breakerReset struct {
+	note   string
+	client string
+}
+
+// ResetBreaker requests to reset the circuit breaker of the changefeed, the
+// note acknowledges the trips and is recorded in the changefeed history.
+func (o *Owner) ResetBreaker(changefeedID model.ChangeFeedID, note string, client string) {
+	o.breakerMu.Lock()
+	defer o.breakerMu.Unlock()
+	o.breakerCommand[changefeedID] = append(o.breakerCommand[changefeedID], breakerReset{note: note, client: client})
+}
+
+// resetBreakers resets the circuit breakers requested. The paused tables of a
+// running changefeed are resumed immediately, those of a stopped changefeed
+// are resumed once the changefeed is resumed.
+func (o *Owner) resetBreakers(ctx context.Context) error {
+	o.breakerMu.Lock()
+	commands := o.breakerCommand
+	o.breakerCommand = make(map[model.ChangeFeedID][]breakerReset)
+	o.breakerMu.Unlock()
+	for id, resets := range commands {
+		for _, reset := range resets {
+			var checkpointTs uint64
+			if cf, ok := o.changeFeeds[id]; ok {
+				cf.resetBreaker()
+				checkpointTs = cf.status.CheckpointTs
+			} else {
+				status, _, err := o.etcdClient.GetChangeFeedStatus(ctx, id)
+				if cerror.ErrChangeFeedNotExists.Equal(err) {
+					log.Warn("reset the circuit breaker of the changefeed not found, ignore it", zap.String("changefeed", id))
+					break
+				}
+				if err != nil {
+					return errors.Trace(err)
+				}
+				status.BreakerEpoch++
+				status.BreakerTrips = nil
+				if err := o.etcdClient.PutChangeFeedStatus(ctx, id, status); err != nil {
+					return errors.Trace(err)
+				}
+				if stopped, ok := o.stoppedFeeds[id]; ok {
+					stopped.BreakerEpoch, stopped.BreakerTrips = status.BreakerEpoch, nil
+				}
+				checkpointTs = status.CheckpointTs
+			}
+			log.Info("the circuit breaker is reset", zap.String("changefeed", id), zap.String("note", reset.note))
+			o.history.record(id, model.ChangefeedEventBreakerReset, checkpointTs, reset.client,
+				"the circuit breaker is reset: %s", reset.note)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type breakerSuite struct{}
+
+var _ = check.Suite(&breakerSuite{})
+
+// mockDetector reports the validation failures to the breaker like the sinks
+// and the mounter of a processor do.
+type mockDetector struct {
+	breaker *validationBreaker
+}
+
+func (d *mockDetector) mismatch(tableID model.TableID) {
+	d.breaker.ReportValidationFailure(model.BreakerDetectorConsistencyMismatch, tableID, "1 rows mismatched")
+}
+
+func (d *mockDetector) outOfOrder(tableID model.TableID) {
+	d.breaker.ReportValidationFailure(model.BreakerDetectorOrderingViolation, tableID, "out-of-order row")
+}
+
+func (d *mockDetector) quarantine(tableID model.TableID, rows int) {
+	for i := 0; i < rows; i++ {
+		d.breaker.observeQuarantine(tableID, errors.New("malformed row"))
+	}
+}
+
+func (s *breakerSuite) TestValidationBreaker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig().CircuitBreaker
+	cfg.QuarantineThreshold = 2
+	breaker := newValidationBreaker("capture-1", cfg)
+	detector := &mockDetector{breaker: breaker}
+
+	// the trips before the epoch is read are taken as the trips of it
+	detector.mismatch(1)
+	detector.mismatch(1)
+	trips, version := breaker.snapshot()
+	c.Assert(trips, check.HasLen, 1)
+	c.Assert(trips[0].Epoch, check.Equals, uint64(0))
+	c.Assert(trips[0].CaptureID, check.Equals, "capture-1")
+	breaker.setEpoch(3)
+	trips, newVersion := breaker.snapshot()
+	c.Assert(trips[0].Epoch, check.Equals, uint64(3))
+	c.Assert(newVersion > version, check.IsTrue)
+
+	// the quarantined rows trip the breaker once they exceed the threshold
+	detector.quarantine(2, 2)
+	trips, _ = breaker.snapshot()
+	c.Assert(trips, check.HasLen, 1)
+	detector.quarantine(2, 1)
+	detector.outOfOrder(2)
+	trips, version = breaker.snapshot()
+	c.Assert(trips, check.HasLen, 3)
+	c.Assert(trips[1].Detector, check.Equals, model.BreakerDetectorQuarantinedRows)
+	c.Assert(trips[2].Detector, check.Equals, model.BreakerDetectorOrderingViolation)
+
+	// the trips are kept in the same epoch, and dropped once it's reset
+	breaker.setEpoch(3)
+	trips, newVersion = breaker.snapshot()
+	c.Assert(trips, check.HasLen, 3)
+	c.Assert(newVersion, check.Equals, version)
+	breaker.setEpoch(4)
+	trips, _ = breaker.snapshot()
+	c.Assert(trips, check.HasLen, 0)
+	detector.mismatch(1)
+	trips, _ = breaker.snapshot()
+	c.Assert(trips, check.HasLen, 1)
+	c.Assert(trips[0].Epoch, check.Equals, uint64(4))
+
+	// the nil breaker is no-op
+	var nilBreaker *validationBreaker
+	nilBreaker.ReportValidationFailure(model.BreakerDetectorConsistencyMismatch, 1, "")
+	nilBreaker.setEpoch(1)
+	trips, _ = nilBreaker.snapshot()
+	c.Assert(trips, check.HasLen, 0)
+}
+
+func (s *breakerSuite) newChangefeed(c *check.C, ctx context.Context, etcdCli kv.CDCEtcdClient) *changeFeed {
+	replicaConfig := config.GetDefaultReplicaConfig()
+	replicaConfig.CircuitBreaker = &config.CircuitBreakerConfig{
+		ConsistencyMismatch: config.BreakerActionPauseTable,
+		OrderingViolation:   config.BreakerActionPauseChangefeed,
+		QuarantinedRows:     config.BreakerActionWarn,
+		QuarantineThreshold: 1,
+	}
+	taskStatus := &model.TaskStatus{Tables: map[model.TableID]*model.TableReplicaInfo{
+		1: {StartTs: 50},
+		2: {StartTs: 50},
+	}}
+	c.Assert(etcdCli.PutTaskStatus(ctx, "breaker", "capture-1", taskStatus), check.IsNil)
+	return &changeFeed{
+		id:      "breaker",
+		etcdCli: etcdCli,
+		info:    &model.ChangeFeedInfo{Config: replicaConfig},
+		status:  &model.ChangeFeedStatus{ResolvedTs: 100, CheckpointTs: 100},
+		taskStatus: model.ProcessorsInfos{
+			"capture-1": taskStatus.Clone(),
+		},
+		taskPositions: map[model.CaptureID]*model.TaskPosition{
+			"capture-1": {ResolvedTs: 100, CheckPointTs: 100},
+		},
+		orphanTables:  map[model.TableID]model.Ts{3: 80},
+		toCleanTables: make(map[model.TableID]model.Ts),
+		moveTableJobs: make(map[model.TableID]*model.MoveTableJob),
+	}
+}
+
+// reportTrips sets the trips of the breaker in the position of the processor
+func reportTrips(cf *changeFeed, breaker *validationBreaker) {
+	breaker.setEpoch(cf.status.BreakerEpoch)
+	cf.taskPositions["capture-1"].BreakerTrips, _ = breaker.snapshot()
+}
+
+func (s *breakerSuite) TestBreakerActions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+	cf := s.newChangefeed(c, ctx, etcdCli)
+	owner := &Owner{
+		changeFeeds:    map[model.ChangeFeedID]*changeFeed{cf.id: cf},
+		etcdClient:     etcdCli,
+		history:        newHistoryRecorder("owner"),
+		breakerCommand: make(map[model.ChangeFeedID][]breakerReset),
+	}
+	breaker := newValidationBreaker("capture-1", cf.info.Config.CircuitBreaker)
+	detector := &mockDetector{breaker: breaker}
+
+	// warn records the trip and keeps replicating
+	detector.quarantine(2, 2)
+	reportTrips(cf, breaker)
+	c.Assert(owner.handleBreakerTrips(ctx), check.IsNil)
+	c.Assert(cf.status.BreakerTrips, check.HasLen, 1)
+	c.Assert(cf.status.BreakerTrips[0].Action, check.Equals, config.BreakerActionWarn)
+	c.Assert(cf.status.PausedTables, check.HasLen, 0)
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+	events := owner.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventBreakerTrip)
+
+	// the trips handled are not handled again
+	c.Assert(owner.handleBreakerTrips(ctx), check.IsNil)
+	c.Assert(cf.status.BreakerTrips, check.HasLen, 1)
+
+	// pause-table removes only the table tripping the breaker
+	detector.mismatch(1)
+	detector.mismatch(3)
+	reportTrips(cf, breaker)
+	c.Assert(owner.handleBreakerTrips(ctx), check.IsNil)
+	c.Assert(cf.status.BreakerTrips, check.HasLen, 3)
+	c.Assert(owner.adminJobs, check.HasLen, 0)
+	c.Assert(cf.status.PausedTables, check.HasLen, 2)
+	c.Assert(cf.status.PausedTables[1].StartTs, check.Equals, uint64(100))
+	c.Assert(cf.status.PausedTables[3].StartTs, check.Equals, uint64(80))
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	op := cf.taskStatus["capture-1"].Operation[1]
+	c.Assert(op.Delete, check.IsTrue)
+	c.Assert(op.BoundaryTs, check.Equals, uint64(100))
+	c.Assert(cf.taskStatus["capture-1"].Tables, check.HasKey, model.TableID(2))
+	_, etcdStatus, err := etcdCli.GetTaskStatus(ctx, cf.id, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(etcdStatus.Tables, check.Not(check.HasKey), model.TableID(1))
+	c.Assert(etcdStatus.Tables, check.HasKey, model.TableID(2))
+
+	// the paused tables don't block the other tables, but the data after
+	// them is retained
+	cf.status.CheckpointTs, cf.status.ResolvedTs = 200, 200
+	c.Assert(cf.status.MinRetainedTs(), check.Equals, uint64(80))
+
+	// pause-changefeed stops the changefeed with the error
+	detector.outOfOrder(2)
+	reportTrips(cf, breaker)
+	c.Assert(owner.handleBreakerTrips(ctx), check.IsNil)
+	c.Assert(owner.adminJobs, check.HasLen, 1)
+	c.Assert(owner.adminJobs[0].Type, check.Equals, model.AdminStop)
+	c.Assert(owner.adminJobs[0].Error.Code, check.Equals, string(cerror.ErrCircuitBreakerTripped.RFCCode()))
+
+	// reset resumes the paused tables from where they're paused
+	owner.ResetBreaker(cf.id, "the downstream is repaired", "test-client")
+	c.Assert(owner.resetBreakers(ctx), check.IsNil)
+	c.Assert(cf.status.BreakerEpoch, check.Equals, uint64(1))
+	c.Assert(cf.status.BreakerTrips, check.HasLen, 0)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{1: 100, 3: 80})
+	// the resumed tables retain the data until they catch up
+	c.Assert(cf.status.PausedTables, check.HasLen, 2)
+	c.Assert(cf.status.MinRetainedTs(), check.Equals, uint64(80))
+	cf.clearResumedTables(200)
+	c.Assert(cf.status.PausedTables, check.HasLen, 2)
+	cf.orphanTables = make(map[model.TableID]model.Ts)
+	cf.clearResumedTables(90)
+	c.Assert(cf.status.PausedTables, check.HasLen, 1)
+	c.Assert(cf.status.PausedTables, check.HasKey, model.TableID(1))
+	c.Assert(cf.status.MinRetainedTs(), check.Equals, uint64(100))
+	cf.clearResumedTables(101)
+	c.Assert(cf.status.PausedTables, check.HasLen, 0)
+	events = owner.history.pendingEvents(cf.id)
+	c.Assert(events[len(events)-1].Type, check.Equals, model.ChangefeedEventBreakerReset)
+	c.Assert(events[len(events)-1].Client, check.Equals, "test-client")
+
+	// the trips of the previous epoch are ignored, until the processor
+	// reads the new epoch
+	c.Assert(cf.newBreakerTrips(), check.HasLen, 0)
+	reportTrips(cf, breaker)
+	c.Assert(cf.taskPositions["capture-1"].BreakerTrips, check.HasLen, 0)
+	detector.mismatch(1)
+	reportTrips(cf, breaker)
+	trips := cf.newBreakerTrips()
+	c.Assert(trips, check.HasLen, 1)
+	c.Assert(trips[0].Epoch, check.Equals, uint64(1))
+}
+
+func (s *breakerSuite) TestRestoreBreaker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := &changeFeed{
+		status:       &model.ChangeFeedStatus{},
+		orphanTables: map[model.TableID]model.Ts{1: 100, 2: 100, 3: 100},
+		taskStatus: model.ProcessorsInfos{
+			"capture-1": {Tables: map[model.TableID]*model.TableReplicaInfo{5: {StartTs: 40}}},
+		},
+	}
+	cf.restoreBreaker(&model.ChangeFeedStatus{
+		BreakerEpoch: 2,
+		PausedTables: map[model.TableID]*model.PausedTable{
+			// the breaker is reset after the table is paused
+			1: {StartTs: 50, Epoch: 1},
+			2: {StartTs: 60, Epoch: 2},
+			// the table is dropped during the pause
+			4: {StartTs: 70, Epoch: 2},
+			// the table is resumed and scheduled before the owner is switched
+			5: {StartTs: 40, Epoch: 0},
+			// the table is dropped after it's resumed
+			6: {StartTs: 40, Epoch: 1},
+		},
+	})
+	c.Assert(cf.status.BreakerEpoch, check.Equals, uint64(2))
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{1: 50, 3: 100})
+	c.Assert(cf.status.PausedTables, check.HasLen, 3)
+	c.Assert(cf.status.PausedTables[1].StartTs, check.Equals, uint64(50))
+	c.Assert(cf.status.PausedTables[2].StartTs, check.Equals, uint64(60))
+	c.Assert(cf.status.PausedTables[5].StartTs, check.Equals, uint64(40))
+}
+
+func (s *breakerSuite) TestValidateBreakerConfig(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig().CircuitBreaker
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.OrderingViolation = "pause"
+	c.Assert(cerror.ErrInvalidBreakerConfig.Equal(cfg.Validate()), check.IsTrue)
+	cfg.OrderingViolation = config.BreakerActionPauseTable
+	cfg.QuarantineThreshold = 0
+	c.Assert(cerror.ErrInvalidBreakerConfig.Equal(cfg.Validate()), check.IsTrue)
+}
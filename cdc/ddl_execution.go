@@ -0,0 +1,343 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	// ddlExecutionWaitTime is the time the owner waits for the DDL in a tick,
+	// the DDL not finished in it is checked again in the following ticks, so
+	// that the status is updated while a long DDL is running
+	ddlExecutionWaitTime = 200 * time.Millisecond
+	// ddlProgressPollInterval is the interval between two polls of the
+	// progress of a running DDL from the downstream
+	ddlProgressPollInterval = 10 * time.Second
+	ddlProgressPollTimeout  = 3 * time.Second
+	// ddlCancelWaitTime is the time to wait for a canceled DDL to exit
+	ddlCancelWaitTime = 3 * time.Second
+)
+
+// ddlExecution is a DDL being executed by the sink of the changefeed in the
+// background
+type ddlExecution struct {
+	job      *timodel.Job
+	event    *model.DDLEvent
+	start    time.Time
+	lastPoll time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+	// err is set before done is closed
+	err error
+}
+
+// stop cancels the DDL and waits for it to exit for at most ddlCancelWaitTime,
+// it returns whether the DDL is exited.
+func (e *ddlExecution) stop() bool {
+	e.cancel()
+	select {
+	case <-e.done:
+		return true
+	case <-time.After(ddlCancelWaitTime):
+		log.Warn("the canceled DDL is not exited in time",
+			zap.String("query", e.event.Query), zap.Duration("wait", ddlCancelWaitTime))
+		return false
+	}
+}
+
+// changefeedStatusWriter persists the status of a changefeed
+type changefeedStatusWriter interface {
+	PutChangeFeedStatus(ctx context.Context, changefeedID string, status *model.ChangeFeedStatus) error
+}
+
+// startDDLExecution executes the DDL by the sink in the background. The DDL
+// is recorded as executing in the status, which is persisted before the DDL
+// is dispatched, so that a new owner taking over the changefeed before the
+// DDL is recorded as done knows the DDL may be executed.
+func (c *changeFeed) startDDLExecution(ctx context.Context, job *timodel.Job, event *model.DDLEvent) error {
+	start := time.Now()
+	c.status.ExecutingDDL = &model.ExecutingDDL{
+		JobID:       job.ID,
+		CommitTs:    job.BinlogInfo.FinishedTS,
+		Query:       event.Query,
+		StartTime:   start,
+		Elapsed:     time.Duration(0).String(),
+		ExecutionID: uuid.New().String(),
+		Event:       event,
+	}
+	if timeout := c.info.Config.GetDDLTimeout(); timeout > 0 {
+		c.status.ExecutingDDL.Timeout = timeout.String()
+	}
+	if err := c.statusWriter.PutChangeFeedStatus(ctx, c.id, c.status); err != nil {
+		c.status.ExecutingDDL = nil
+		return errors.Trace(err)
+	}
+	log.Info("DDL is dispatched to the downstream", zap.String("changefeed", c.id),
+		zap.String("query", event.Query), zap.String("executionID", c.status.ExecutingDDL.ExecutionID))
+
+	ctx, cancel := context.WithCancel(ctx)
+	e := &ddlExecution{
+		job:    job,
+		event:  event,
+		start:  start,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.ddlExecution = e
+	go func() {
+		defer close(e.done)
+		e.err = c.sink.EmitDDLEvent(ctx, event)
+		failpoint.Inject("OwnerPanicAfterDDLExecuted", func() {
+			log.Info("Prepare to panic for OwnerPanicAfterDDLExecuted")
+			panic("OwnerPanicAfterDDLExecuted")
+		})
+	}()
+	return nil
+}
+
+// waitDDLExecution waits for the executing DDL for at most
+// ddlExecutionWaitTime. The DDL is finished if it's done, otherwise the
+// elapsed time and the progress are updated in the status, and the
+// ddl-unsupported-action is taken if the DDL times out.
+func (c *changeFeed) waitDDLExecution(ctx context.Context) error {
+	e := c.ddlExecution
+	timer := time.NewTimer(ddlExecutionWaitTime)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+		return c.finishDDLExecution(e)
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-timer.C:
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(e.start)
+	c.status.ExecutingDDL.Elapsed = elapsed.Round(time.Second).String()
+	if timeout := c.info.Config.GetDDLTimeout(); timeout > 0 && elapsed >= timeout {
+		return c.handleDDLTimeout(e, timeout)
+	}
+	reporter, ok := sink.Unwrap(c.sink).(sink.DDLProgressReporter)
+	if !ok || now.Sub(e.lastPoll) < ddlProgressPollInterval {
+		return nil
+	}
+	e.lastPoll = now
+	pollCtx, cancel := context.WithTimeout(ctx, ddlProgressPollTimeout)
+	defer cancel()
+	progress, err := reporter.DDLProgress(pollCtx, e.event)
+	if err != nil {
+		log.Warn("failed to poll the progress of the DDL",
+			zap.String("changefeed", c.id), zap.String("query", e.event.Query), zap.Error(err))
+		return nil
+	}
+	c.status.ExecutingDDL.Progress = progress
+	log.Info("DDL is being executed by the downstream",
+		zap.String("changefeed", c.id), zap.String("query", e.event.Query),
+		zap.Duration("elapsed", elapsed), zap.String("progress", progress))
+	return nil
+}
+
+// finishDDLExecution handles the result of the done DDL
+func (c *changeFeed) finishDDLExecution(e *ddlExecution) error {
+	c.ddlExecution = nil
+	c.status.ExecutingDDL = nil
+	duration := time.Since(e.start)
+	if e.err == nil {
+		c.recordDDLExecution(e, duration, "succeeded")
+		c.finishDDL(e.job, true)
+		return nil
+	}
+	// If DDL executing failed, pause the changefeed and print log, rather
+	// than return an error and break the running of this owner.
+	if cerror.ErrDDLUnsupportedByDownstream.Equal(e.err) {
+		c.recordDDLExecution(e, duration, "unsupported")
+		skipped, err := c.handleUnsupportedDDL(e.job, e.err)
+		if !skipped {
+			return err
+		}
+	} else if cerror.ErrDDLEventIgnored.NotEqual(e.err) {
+		c.recordDDLExecution(e, duration, "failed")
+		c.ddlState = model.ChangeFeedDDLExecuteFailed
+		log.Error("Execute DDL failed",
+			zap.String("ChangeFeedID", c.id),
+			zap.Error(e.err),
+			zap.Reflect("ddlJob", e.job))
+		return cerror.ErrExecDDLFailed.GenWithStackByArgs()
+	}
+	c.finishDDL(e.job, false)
+	return nil
+}
+
+// handleDDLTimeout cancels the DDL not finished in the timeout, and applies
+// the ddl-unsupported-action of the changefeed to it. The DDL can't be
+// skipped, as it may be still running in the downstream, so the changefeed is
+// paused for the pause action, and stopped with an error otherwise.
+func (c *changeFeed) handleDDLTimeout(e *ddlExecution, timeout time.Duration) error {
+	if e.stop() && e.err == nil {
+		// the DDL is finished before it's canceled
+		return c.finishDDLExecution(e)
+	}
+	c.ddlExecution = nil
+	c.status.ExecutingDDL = nil
+	c.recordDDLExecution(e, time.Since(e.start), "timed out")
+	c.ddlState = model.ChangeFeedDDLExecuteFailed
+	err := cerror.ErrDDLExecutionTimeout.GenWithStackByArgs(e.job.Query, timeout)
+	if c.info.Config.GetDDLUnsupportedAction() != config.DDLUnsupportedPause {
+		log.Error("Execute DDL failed, the DDL is not finished by the downstream in time",
+			zap.String("changefeed", c.id), zap.Reflect("ddlJob", e.job), zap.Duration("timeout", timeout))
+		return err
+	}
+	log.Warn("changefeed is pausing, the DDL is not finished by the downstream in time",
+		zap.String("changefeed", c.id), zap.Reflect("ddlJob", e.job), zap.Duration("timeout", timeout))
+	c.status.PausedDDL = &model.UnsupportedDDL{
+		JobID:    e.job.ID,
+		CommitTs: e.job.BinlogInfo.FinishedTS,
+		Query:    e.job.Query,
+		Error:    err.Error(),
+		Time:     time.Now(),
+	}
+	return cerror.ErrPausedOnDDLTimeout.GenWithStackByArgs(e.job.Query, timeout)
+}
+
+// recoveredDDL is a DDL dispatched to the downstream by a previous owner,
+// whose execution is not recorded as done
+type recoveredDDL struct {
+	record    *model.ExecutingDDL
+	lastProbe time.Time
+	warned    bool
+}
+
+// job returns the DDL job of the record, which has the fields used to execute
+// the DDL and to record the execution
+func (r *recoveredDDL) job() *timodel.Job {
+	return &timodel.Job{
+		ID:         r.record.JobID,
+		Type:       r.record.Event.Type,
+		Query:      r.record.Query,
+		BinlogInfo: &timodel.HistoryInfo{FinishedTS: r.record.CommitTs},
+	}
+}
+
+// restoreExecutingDDL restores the DDL recorded as executing by a previous
+// owner. The changefeed is restarted at the checkpoint ts, which is the commit
+// ts of the DDL if the DDL is not recorded as done, and the DDL is probed and
+// executed again if necessary before any row after it is replicated.
+func (c *changeFeed) restoreExecutingDDL(record *model.ExecutingDDL) {
+	if record == nil || record.CommitTs != c.status.CheckpointTs {
+		return
+	}
+	if record.Event == nil {
+		// the record is persisted by an owner of an older version
+		log.Warn("the DDL recorded as executing can't be recovered",
+			zap.String("changefeed", c.id), zap.Int64("jobID", record.JobID), zap.String("query", record.Query))
+		return
+	}
+	log.Info("found the DDL dispatched by the previous owner", zap.String("changefeed", c.id),
+		zap.Int64("jobID", record.JobID), zap.String("query", record.Query),
+		zap.String("executionID", record.ExecutionID))
+	c.status.ExecutingDDL = record
+	c.recoveredDDL = &recoveredDDL{record: record}
+	// the resolved ts is held at the DDL barrier until the DDL is done
+	c.ddlState = model.ChangeFeedExecDDL
+}
+
+// recoverDDLExecution decides whether the DDL dispatched by the previous
+// owner is executed again. The idempotent DDLs are executed again, and the
+// others are probed in the downstream. The DDL is held at the barrier if its
+// execution can't be told, until it's skipped by operator.
+func (c *changeFeed) recoverDDLExecution(ctx context.Context) error {
+	r := c.recoveredDDL
+	if _, ok := c.skipDDLJobs[r.record.JobID]; ok {
+		delete(c.skipDDLJobs, r.record.JobID)
+		log.Warn("DDL dispatched by the previous owner is skipped by operator",
+			zap.String("changefeed", c.id), zap.Int64("jobID", r.record.JobID), zap.String("query", r.record.Query))
+		c.finishRecoveredDDL("skipped by operator")
+		return nil
+	}
+	executed := false
+	if !sink.IsIdempotentDDL(r.record.Event.Type) {
+		now := time.Now()
+		if now.Sub(r.lastProbe) < ddlProgressPollInterval {
+			return nil
+		}
+		r.lastProbe = now
+		var err error
+		executed, err = c.probeDDLExecution(ctx, r.record.Event)
+		if err != nil {
+			if !r.warned {
+				r.warned = true
+				log.Warn("can't tell whether the DDL dispatched by the previous owner is executed, "+
+					"skip it by operator once it's executed in the downstream",
+					zap.String("changefeed", c.id), zap.Int64("jobID", r.record.JobID),
+					zap.String("query", r.record.Query), zap.Error(err))
+			}
+			c.status.ExecutingDDL.Progress = err.Error()
+			return nil
+		}
+	}
+	if executed {
+		log.Info("DDL dispatched by the previous owner is executed by the downstream",
+			zap.String("changefeed", c.id), zap.Int64("jobID", r.record.JobID),
+			zap.String("query", r.record.Query), zap.String("executionID", r.record.ExecutionID))
+		c.finishRecoveredDDL("executed by the previous owner")
+		return nil
+	}
+	log.Info("execute the DDL dispatched by the previous owner again",
+		zap.String("changefeed", c.id), zap.Int64("jobID", r.record.JobID),
+		zap.String("query", r.record.Query), zap.String("executionID", r.record.ExecutionID))
+	c.recoveredDDL = nil
+	if err := c.startDDLExecution(ctx, r.job(), r.record.Event); err != nil {
+		return errors.Trace(err)
+	}
+	return c.waitDDLExecution(ctx)
+}
+
+func (c *changeFeed) probeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error) {
+	prober, ok := sink.Unwrap(c.sink).(sink.DDLExecutionProber)
+	if !ok {
+		return false, cerror.ErrDDLExecutionUnknown.GenWithStackByArgs(ddl.Query, "the sink can't tell it")
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, ddlProgressPollTimeout)
+	defer cancel()
+	return prober.ProbeDDLExecution(pollCtx, ddl)
+}
+
+// finishRecoveredDDL moves the DDL barrier over the recovered DDL without
+// executing it
+func (c *changeFeed) finishRecoveredDDL(outcome string) {
+	r := c.recoveredDDL
+	c.recoveredDDL = nil
+	c.status.ExecutingDDL = nil
+	c.history.record(c.id, model.ChangefeedEventDDL, r.record.CommitTs, "",
+		"DDL %s of job %d %s", r.record.Query, r.record.JobID, outcome)
+	c.finishDDL(r.job(), false)
+}
+
+func (c *changeFeed) recordDDLExecution(e *ddlExecution, duration time.Duration, outcome string) {
+	c.history.record(c.id, model.ChangefeedEventDDL, e.job.BinlogInfo.FinishedTS, "",
+		"DDL %s of job %d %s in %s", e.job.Query, e.job.ID, outcome, duration.Round(time.Millisecond))
+}
@@ -0,0 +1,430 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlExecutionSuite struct{}
+
+var _ = check.Suite(&ddlExecutionSuite{})
+
+// slowDDLSink executes a DDL for delay, as a downstream adding an index
+type slowDDLSink struct {
+	sink.Sink
+	delay    time.Duration
+	canceled int32
+}
+
+func (s *slowDDLSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	select {
+	case <-ctx.Done():
+		atomic.StoreInt32(&s.canceled, 1)
+		return ctx.Err()
+	case <-time.After(s.delay):
+		return nil
+	}
+}
+
+func (s *slowDDLSink) DDLProgress(ctx context.Context, ddl *model.DDLEvent) (string, error) {
+	return "stage: alter table (read PK and internal sort) 50/100", nil
+}
+
+func (s *ddlExecutionSuite) newChangefeed(c *check.C, action string, timeout int, delay time.Duration) *changeFeed {
+	cf := (&ddlUnsupportedSuite{}).newChangefeed(c, action)
+	cf.info.Config.DDLTimeoutSeconds = timeout
+	cf.sink = &slowDDLSink{delay: delay}
+	cf.history = newHistoryRecorder("test-owner")
+	return cf
+}
+
+// waitDDL calls handleDDL until the DDL is not executing or an error is returned
+func waitDDL(c *check.C, cf *changeFeed) error {
+	for i := 0; i < 100; i++ {
+		if err := cf.handleDDL(context.Background(), nil); err != nil || cf.ddlExecution == nil {
+			return err
+		}
+	}
+	c.Fatal("the DDL is not finished")
+	return nil
+}
+
+func (s *ddlExecutionSuite) TestLongDDLStatus(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer func(interval time.Duration) { ddlProgressPollInterval = interval }(ddlProgressPollInterval)
+	ddlProgressPollInterval = 0
+
+	cf := s.newChangefeed(c, "", 0, time.Second)
+	c.Assert(cf.handleDDL(context.Background(), nil), check.IsNil)
+	// the DDL is running, it's surfaced in the status
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedExecDDL)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+	executing := cf.status.ExecutingDDL
+	c.Assert(executing, check.NotNil)
+	c.Assert(executing.JobID, check.Equals, int64(1))
+	c.Assert(executing.CommitTs, check.Equals, uint64(100))
+	c.Assert(executing.Query, check.Equals, "create database test")
+	c.Assert(executing.Timeout, check.Equals, "")
+	c.Assert(executing.Progress, check.Matches, ".*50/100")
+	c.Assert(time.Since(executing.StartTime) < time.Second, check.IsTrue)
+
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	// the state is cleared when the DDL is done
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 0)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventDDL)
+	c.Assert(events[0].Ts, check.Equals, uint64(100))
+	c.Assert(events[0].Message, check.Matches, "DDL create database test of job 1 succeeded in 1.*s")
+}
+
+func (s *ddlExecutionSuite) TestDDLTimeout(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// the changefeed is stopped with an error by default
+	cf := s.newChangefeed(c, "", 1, time.Hour)
+	c.Assert(cf.handleDDL(context.Background(), nil), check.IsNil)
+	c.Assert(cf.status.ExecutingDDL.Timeout, check.Equals, "1s")
+	err := waitDDL(c, cf)
+	c.Assert(cerror.ErrDDLExecutionTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(atomic.LoadInt32(&cf.sink.(*slowDDLSink).canceled), check.Equals, int32(1))
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.status.PausedDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedDDLExecuteFailed)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Message, check.Matches, ".*timed out in 1.*s")
+
+	// the DDL can't be skipped, as it may be still running in the downstream
+	cf = s.newChangefeed(c, config.DDLUnsupportedSkip, 1, time.Hour)
+	err = waitDDL(c, cf)
+	c.Assert(cerror.ErrDDLExecutionTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+
+	// the changefeed is paused at the checkpoint before the DDL
+	cf = s.newChangefeed(c, config.DDLUnsupportedPause, 1, time.Hour)
+	err = waitDDL(c, cf)
+	c.Assert(cerror.ErrPausedOnDDLTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(cf.status.PausedDDL.Query, check.Equals, "create database test")
+	c.Assert(cf.status.PausedDDL.Error, check.Matches, ".*not finished by the downstream in 1s.*")
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+
+	owner := &Owner{changeFeeds: map[model.ChangeFeedID]*changeFeed{
+		cf.id: s.newChangefeed(c, config.DDLUnsupportedPause, 1, time.Hour),
+	}}
+	for len(owner.adminJobs) == 0 {
+		c.Assert(owner.handleDDL(context.Background()), check.IsNil)
+	}
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: cf.id, Type: model.AdminStop}})
+}
+
+func (s *ddlExecutionSuite) TestValidateDDLTimeout(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(config.ValidateDDLTimeout(0), check.IsNil)
+	c.Assert(config.ValidateDDLTimeout(3600), check.IsNil)
+	c.Assert(cerror.ErrInvalidDDLTimeout.Equal(config.ValidateDDLTimeout(-1)), check.IsTrue)
+	c.Assert((*config.ReplicaConfig)(nil).GetDDLTimeout(), check.Equals, time.Duration(0))
+}
+
+// memStatusWriter keeps the persisted status of the changefeed in memory
+type memStatusWriter struct {
+	mu     sync.Mutex
+	status string
+}
+
+func (w *memStatusWriter) PutChangeFeedStatus(ctx context.Context, changefeedID string, status *model.ChangeFeedStatus) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, err := status.Marshal()
+	w.status = data
+	return err
+}
+
+func (w *memStatusWriter) get(c *check.C) *model.ChangeFeedStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := new(model.ChangeFeedStatus)
+	c.Assert(status.Unmarshal([]byte(w.status)), check.IsNil)
+	return status
+}
+
+// renameDownstream is a downstream which renames the tables, it counts the
+// executions of the DDLs
+type renameDownstream struct {
+	sink.Sink
+	mu       sync.Mutex
+	tables   map[string]struct{}
+	executed int
+	// hang makes the DDLs hang without being executed until they're canceled
+	hang bool
+}
+
+func newRenameDownstream() *renameDownstream {
+	return &renameDownstream{tables: map[string]struct{}{"`test`.`t1`": {}}}
+}
+
+func (d *renameDownstream) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	d.mu.Lock()
+	hang := d.hang
+	d.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.executed++
+	if ddl.Type == timodel.ActionRenameTable {
+		oldName := quotes.QuoteSchema(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)
+		if _, ok := d.tables[oldName]; !ok {
+			return errors.Errorf("table %s doesn't exist", oldName)
+		}
+		delete(d.tables, oldName)
+		d.tables[quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table)] = struct{}{}
+	}
+	return nil
+}
+
+func (d *renameDownstream) ProbeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error) {
+	if ddl.Type != timodel.ActionRenameTable {
+		return false, cerror.ErrDDLExecutionUnknown.GenWithStackByArgs(ddl.Query, "it's not a rename")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, oldExists := d.tables[quotes.QuoteSchema(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)]
+	_, newExists := d.tables[quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table)]
+	return newExists && !oldExists, nil
+}
+
+func (d *renameDownstream) setHang(hang bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hang = hang
+}
+
+func (d *renameDownstream) state() (int, map[string]struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tables := make(map[string]struct{}, len(d.tables))
+	for table := range d.tables {
+		tables[table] = struct{}{}
+	}
+	return d.executed, tables
+}
+
+func newRenameDDL() (*timodel.Job, *model.DDLEvent) {
+	job := &timodel.Job{
+		ID:         2,
+		Type:       timodel.ActionRenameTable,
+		Query:      "rename table t1 to t2",
+		BinlogInfo: &timodel.HistoryInfo{FinishedTS: 100},
+	}
+	event := &model.DDLEvent{
+		CommitTs:     100,
+		Type:         timodel.ActionRenameTable,
+		Query:        job.Query,
+		PreTableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+		TableInfo:    &model.SimpleTableInfo{Schema: "test", Table: "t2"},
+	}
+	return job, event
+}
+
+// newFailoverChangefeed returns a changefeed started at the DDL barrier with
+// the status persisted by the previous owner
+func (s *ddlExecutionSuite) newFailoverChangefeed(
+	c *check.C, downstream sink.Sink, writer *memStatusWriter,
+) *changeFeed {
+	cf := s.newChangefeed(c, "", 0, 0)
+	cf.sink = downstream
+	cf.statusWriter = writer
+	cf.ddlJobHistory = nil
+	cf.ddlState = model.ChangeFeedSyncDML
+	cf.skipDDLJobs = make(map[int64]struct{})
+	return cf
+}
+
+// crashAfterDispatch dispatches the DDL by a changefeed, which exits before
+// the DDL is recorded as done, as the owner crashes. It returns the status
+// persisted by the owner.
+func (s *ddlExecutionSuite) crashAfterDispatch(
+	c *check.C, downstream sink.Sink, job *timodel.Job, event *model.DDLEvent,
+) (*memStatusWriter, *model.ChangeFeedStatus) {
+	writer := &memStatusWriter{}
+	cf := s.newFailoverChangefeed(c, downstream, writer)
+	cf.ddlJobHistory = []*timodel.Job{job}
+	cf.ddlState = model.ChangeFeedExecDDL
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Assert(cf.startDDLExecution(ctx, job, event), check.IsNil)
+	select {
+	case <-cf.ddlExecution.done:
+	case <-time.After(100 * time.Millisecond):
+		// the DDL is not executed by the downstream when the owner crashes
+		cancel()
+		<-cf.ddlExecution.done
+	}
+	cancel()
+	status := writer.get(c)
+	c.Assert(status.ExecutingDDL.JobID, check.Equals, job.ID)
+	c.Assert(status.ExecutingDDL.ExecutionID, check.Not(check.Equals), "")
+	c.Assert(status.ExecutingDDL.Event, check.DeepEquals, event)
+	return writer, status
+}
+
+func (s *ddlExecutionSuite) TestRecoverExecutedDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	downstream := newRenameDownstream()
+	job, event := newRenameDDL()
+	writer, status := s.crashAfterDispatch(c, downstream, job, event)
+	executed, tables := downstream.state()
+	c.Assert(executed, check.Equals, 1)
+	c.Assert(tables, check.DeepEquals, map[string]struct{}{"`test`.`t2`": {}})
+
+	// the new owner finds the rename executed, and doesn't execute it again
+	cf := s.newFailoverChangefeed(c, downstream, writer)
+	cf.restoreExecutingDDL(status.ExecutingDDL)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedExecDDL)
+	c.Assert(cf.status.ExecutingDDL, check.DeepEquals, status.ExecutingDDL)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	executed, tables = downstream.state()
+	c.Assert(executed, check.Equals, 1)
+	c.Assert(tables, check.DeepEquals, map[string]struct{}{"`test`.`t2`": {}})
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Message, check.Equals, "DDL rename table t1 to t2 of job 2 executed by the previous owner")
+}
+
+func (s *ddlExecutionSuite) TestRecoverNotExecutedDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	downstream := newRenameDownstream()
+	downstream.setHang(true)
+	job, event := newRenameDDL()
+	writer, status := s.crashAfterDispatch(c, downstream, job, event)
+	executed, _ := downstream.state()
+	c.Assert(executed, check.Equals, 0)
+
+	// the new owner finds the rename not executed, and executes it once
+	downstream.setHang(false)
+	cf := s.newFailoverChangefeed(c, downstream, writer)
+	cf.restoreExecutingDDL(status.ExecutingDDL)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	executed, tables := downstream.state()
+	c.Assert(executed, check.Equals, 1)
+	c.Assert(tables, check.DeepEquals, map[string]struct{}{"`test`.`t2`": {}})
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+	// the DDL is recorded as executing again before it's dispatched again
+	executing := writer.get(c).ExecutingDDL
+	c.Assert(executing.Event, check.DeepEquals, event)
+	c.Assert(executing.ExecutionID, check.Not(check.Equals), status.ExecutingDDL.ExecutionID)
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Message, check.Matches, "DDL rename table t1 to t2 of job 2 succeeded in .*")
+}
+
+func (s *ddlExecutionSuite) TestRecoverIdempotentDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	downstream := newRenameDownstream()
+	job := &timodel.Job{
+		ID:         1,
+		Type:       timodel.ActionCreateSchema,
+		Query:      "create database test",
+		BinlogInfo: &timodel.HistoryInfo{FinishedTS: 100},
+	}
+	event := &model.DDLEvent{
+		CommitTs:  100,
+		Type:      timodel.ActionCreateSchema,
+		Query:     job.Query,
+		TableInfo: &model.SimpleTableInfo{Schema: "test"},
+	}
+	writer, status := s.crashAfterDispatch(c, downstream, job, event)
+
+	// the idempotent DDL is executed again without the probe, which can't
+	// tell whether it's executed
+	cf := s.newFailoverChangefeed(c, downstream, writer)
+	cf.restoreExecutingDDL(status.ExecutingDDL)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	executed, _ := downstream.state()
+	c.Assert(executed, check.Equals, 2)
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+
+	// the DDL recorded before the checkpoint is done
+	cf = s.newFailoverChangefeed(c, downstream, writer)
+	cf.status.CheckpointTs = 101
+	cf.restoreExecutingDDL(status.ExecutingDDL)
+	c.Assert(cf.recoveredDDL, check.IsNil)
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+}
+
+func (s *ddlExecutionSuite) TestRecoverUnknownDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer func(interval time.Duration) { ddlProgressPollInterval = interval }(ddlProgressPollInterval)
+	ddlProgressPollInterval = 0
+	downstream := newRenameDownstream()
+	job := &timodel.Job{
+		ID:         3,
+		Type:       timodel.ActionExchangeTablePartition,
+		Query:      "alter table t1 exchange partition p0 with table t2",
+		BinlogInfo: &timodel.HistoryInfo{FinishedTS: 100},
+	}
+	event := &model.DDLEvent{
+		CommitTs:  100,
+		Type:      timodel.ActionExchangeTablePartition,
+		Query:     job.Query,
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+	}
+	writer, status := s.crashAfterDispatch(c, downstream, job, event)
+
+	// the DDL is held at the barrier until it's skipped by operator
+	cf := s.newFailoverChangefeed(c, downstream, writer)
+	cf.restoreExecutingDDL(status.ExecutingDDL)
+	for i := 0; i < 3; i++ {
+		c.Assert(cf.handleDDL(context.Background(), nil), check.IsNil)
+		c.Assert(cf.recoveredDDL, check.NotNil)
+		c.Assert(cf.ddlState, check.Equals, model.ChangeFeedExecDDL)
+		c.Assert(cf.status.ExecutingDDL.Progress, check.Matches, ".*can't tell whether DDL .* is executed.*")
+	}
+	c.Assert(cf.skipDDLOnce(4), check.IsFalse)
+	c.Assert(cf.skipDDLOnce(3), check.IsTrue)
+	c.Assert(cf.handleDDL(context.Background(), nil), check.IsNil)
+	executed, _ := downstream.state()
+	c.Assert(executed, check.Equals, 1)
+	c.Assert(cf.recoveredDDL, check.IsNil)
+	c.Assert(cf.status.ExecutingDDL, check.IsNil)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+	c.Assert(cf.skipDDLJobs, check.HasLen, 0)
+}
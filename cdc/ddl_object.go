@@ -0,0 +1,68 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/filter"
+)
+
+// recordObjectDDLSkip records a notice in the changefeed history if the DDL of
+// a view or a sequence, which is not filtered out by the table rules, is
+// skipped by the ddl-include-views or ddl-include-sequences options
+func (c *changeFeed) recordObjectDDLSkip(job *timodel.Job) {
+	object := filter.ClassifyDDL(job.Type)
+	if object != filter.DDLObjectView && object != filter.DDLObjectSequence {
+		return
+	}
+	var table string
+	if job.BinlogInfo != nil && job.BinlogInfo.TableInfo != nil {
+		table = job.BinlogInfo.TableInfo.Name.O
+	} else if name, ok := c.schema.GetTableNameByID(job.TableID); ok {
+		table = name.Table
+	}
+	schema := job.SchemaName
+	if schema == "" {
+		if schemaInfo, ok := c.schema.SchemaByID(job.SchemaID); ok {
+			schema = schemaInfo.Name.O
+		}
+	}
+	if table != "" && c.filter.ShouldIgnoreTable(schema, table) {
+		return
+	}
+	var finishedTs uint64
+	if job.BinlogInfo != nil {
+		finishedTs = job.BinlogInfo.FinishedTS
+	}
+	if finishedTs != 0 && finishedTs <= c.objectDDLSkipTs {
+		return
+	}
+	c.objectDDLSkipTs = finishedTs
+	c.history.record(c.id, model.ChangefeedEventSkipDDL, finishedTs, "",
+		"%s DDL %s of job %d is skipped, set ddl-include-%ss to replicate it", object, job.Query, job.ID, object)
+}
+
+// lastObjectDDLSkipTs returns the ts of the last skipped DDL of a view or a
+// sequence in the changefeed history, the DDLs pulled again by a new owner
+// are already recorded by the previous owner.
+func lastObjectDDLSkipTs(history *model.ChangefeedHistory) uint64 {
+	var ts uint64
+	for _, event := range history.Events {
+		if event.Type == model.ChangefeedEventSkipDDL && event.Ts > ts {
+			ts = event.Ts
+		}
+	}
+	return ts
+}
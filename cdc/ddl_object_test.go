@@ -0,0 +1,191 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlObjectSuite struct{}
+
+var _ = check.Suite(&ddlObjectSuite{})
+
+// jobsDDLHandler returns the jobs once
+type jobsDDLHandler struct {
+	resolvedTs uint64
+	jobs       []*timodel.Job
+}
+
+func (h *jobsDDLHandler) PullDDL() (uint64, []*timodel.Job, error) {
+	jobs := h.jobs
+	h.jobs = nil
+	return h.resolvedTs, jobs, nil
+}
+
+func (h *jobsDDLHandler) Close() error {
+	return nil
+}
+
+// recordDDLSink records the DDLs executed
+type recordDDLSink struct {
+	sink.Sink
+	mu   sync.Mutex
+	ddls []string
+}
+
+func (s *recordDDLSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ddls = append(s.ddls, ddl.Query)
+	return nil
+}
+
+func newObjectDDLJob(
+	id int64, tp timodel.ActionType, schema string, schemaID int64, query string, table *timodel.TableInfo,
+) *timodel.Job {
+	return &timodel.Job{
+		ID:         id,
+		Type:       tp,
+		SchemaID:   schemaID,
+		TableID:    table.ID,
+		SchemaName: schema,
+		State:      timodel.JobStateSynced,
+		Query:      query,
+		BinlogInfo: &timodel.HistoryInfo{
+			SchemaVersion: id,
+			TableInfo:     table,
+			FinishedTS:    uint64(100 + id),
+		},
+	}
+}
+
+func (s *ddlObjectSuite) newChangefeed(c *check.C, includeSequences, includeViews bool, jobs ...*timodel.Job) *changeFeed {
+	cf := (&ddlUnsupportedSuite{}).newChangefeed(c, "")
+	cf.info.Config.Filter.Rules = []string{"test.*"}
+	cf.info.Config.DDLIncludeSequences = includeSequences
+	cf.info.Config.DDLIncludeViews = includeViews
+	f, err := filter.NewFilter(cf.info.Config)
+	c.Assert(err, check.IsNil)
+	cf.filter = f
+	cf.sink = &recordDDLSink{}
+	cf.history = newHistoryRecorder("test-owner")
+	// the DDL of the schema is pulled with the other jobs
+	jobs = append(cf.ddlJobHistory, jobs...)
+	cf.ddlJobHistory = nil
+	cf.ddlState = model.ChangeFeedSyncDML
+	cf.ddlHandler = &jobsDDLHandler{resolvedTs: 110, jobs: jobs}
+	return cf
+}
+
+// objectDDLJobs are the DDL jobs creating a view and a sequence
+func objectDDLJobs() []*timodel.Job {
+	return []*timodel.Job{
+		newObjectDDLJob(2, timodel.ActionCreateView, "test", 1, "create view test.v1 as select 1",
+			&timodel.TableInfo{ID: 10, Name: timodel.NewCIStr("v1"), View: &timodel.ViewInfo{}}),
+		newObjectDDLJob(3, timodel.ActionCreateSequence, "test", 1, "create sequence test.seq1",
+			&timodel.TableInfo{ID: 11, Name: timodel.NewCIStr("seq1"), Sequence: &timodel.SequenceInfo{}}),
+	}
+}
+
+func (s *ddlObjectSuite) TestSkipObjectDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the schema is filtered out by the table rules
+	jobs := append(objectDDLJobs(),
+		newObjectDDLJob(4, timodel.ActionCreateView, "other", 2, "create view other.v1 as select 1",
+			&timodel.TableInfo{ID: 12, Name: timodel.NewCIStr("v1"), View: &timodel.ViewInfo{}}))
+
+	// the DDLs of the views and the sequences are skipped with the notices if
+	// they're not included, except the ones filtered out by the table rules
+	cf := s.newChangefeed(c, false, false, jobs...)
+	c.Assert(cf.pullDDLJob(), check.IsNil)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+	c.Assert(cf.ddlJobHistory[0].Type, check.Equals, timodel.ActionCreateSchema)
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 2)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventSkipDDL)
+	c.Assert(events[0].Ts, check.Equals, uint64(102))
+	c.Assert(events[0].Message, check.Equals,
+		"view DDL create view test.v1 as select 1 of job 2 is skipped, set ddl-include-views to replicate it")
+	c.Assert(events[1].Type, check.Equals, model.ChangefeedEventSkipDDL)
+	c.Assert(events[1].Ts, check.Equals, uint64(103))
+	c.Assert(events[1].Message, check.Equals,
+		"sequence DDL create sequence test.seq1 of job 3 is skipped, set ddl-include-sequences to replicate it")
+
+	// only the views are replicated
+	cf = s.newChangefeed(c, false, true, jobs...)
+	c.Assert(cf.pullDDLJob(), check.IsNil)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 3)
+	c.Assert(cf.ddlJobHistory[1].Type, check.Equals, timodel.ActionCreateView)
+	c.Assert(cf.ddlJobHistory[2].Query, check.Equals, "create view other.v1 as select 1")
+	events = cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Message, check.Matches, "sequence DDL .* is skipped.*")
+}
+
+func (s *ddlObjectSuite) TestSkipObjectDDLAfterOwnerSwitch(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := s.newChangefeed(c, false, true, objectDDLJobs()...)
+	c.Assert(cf.pullDDLJob(), check.IsNil)
+	events := cf.history.pendingEvents(cf.id)
+	c.Assert(events, check.HasLen, 1)
+
+	// the new owner pulls the jobs again, the notice recorded by the previous
+	// owner is not recorded again
+	cf = s.newChangefeed(c, false, true, objectDDLJobs()...)
+	cf.objectDDLSkipTs = lastObjectDDLSkipTs(&model.ChangefeedHistory{Events: events})
+	c.Assert(cf.objectDDLSkipTs, check.Equals, uint64(103))
+	c.Assert(cf.pullDDLJob(), check.IsNil)
+	c.Assert(cf.history.pendingEvents(cf.id), check.HasLen, 0)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 2)
+}
+
+func (s *ddlObjectSuite) TestReplicateObjectDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	cf := s.newChangefeed(c, true, true, objectDDLJobs()...)
+	c.Assert(cf.pullDDLJob(), check.IsNil)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 3)
+	for len(cf.ddlJobHistory) > 0 {
+		job := cf.ddlJobHistory[0]
+		cf.status.CheckpointTs = job.BinlogInfo.FinishedTS
+		cf.ddlState = model.ChangeFeedWaitToExecDDL
+		c.Assert(waitDDL(c, cf), check.IsNil)
+		c.Assert(cf.ddlExecutedTs, check.Equals, job.BinlogInfo.FinishedTS)
+	}
+	c.Assert(cf.sink.(*recordDDLSink).ddls, check.DeepEquals, []string{
+		"create database test",
+		"create view test.v1 as select 1",
+		"create sequence test.seq1",
+	})
+	for _, event := range cf.history.pendingEvents(cf.id) {
+		c.Assert(event.Type, check.Not(check.Equals), model.ChangefeedEventSkipDDL)
+	}
+	// the views and the sequences are never scheduled
+	for _, id := range []model.TableID{10, 11} {
+		table, ok := cf.schema.TableByID(id)
+		c.Assert(ok, check.IsTrue)
+		c.Assert(table.HasRows(), check.IsFalse)
+		cf.addTable(table, 200)
+	}
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+}
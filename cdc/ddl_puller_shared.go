@@ -0,0 +1,290 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/notify"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// ddlSpans returns the spans pulled by the DDL pullers
+func ddlSpans() []regionspan.Span {
+	return []regionspan.Span{regionspan.GetDDLSpan(), regionspan.GetAddIndexDDLSpan()}
+}
+
+// sharedDDLPuller shares one DDL puller among the processors in a capture,
+// since all of them pull the DDL entries of the same upstream. The puller is
+// started at the checkpoint ts of the first subscriber, and its sorted output
+// is retained as a log replayed to each subscriber from its own checkpoint ts.
+// At most maxEntries DDL entries are retained, a subscriber starting before
+// the retained entries can't be served, the processor runs its own DDL puller
+// instead.
+type sharedDDLPuller struct {
+	ctx        context.Context
+	maxEntries int
+	// newPuller creates the DDL puller started at the ts
+	newPuller func(ctx context.Context, startTs uint64) puller.Puller
+
+	mu     sync.Mutex
+	log    *sharedDDLLog
+	cancel context.CancelFunc
+}
+
+func newSharedDDLPuller(
+	ctx context.Context, maxEntries int, newPuller func(ctx context.Context, startTs uint64) puller.Puller,
+) *sharedDDLPuller {
+	return &sharedDDLPuller{
+		ctx:        ctx,
+		maxEntries: maxEntries,
+		newPuller:  newPuller,
+	}
+}
+
+// subscribe returns a puller outputting the DDL entries after the start ts,
+// nil is returned if the entries are not retained anymore or the shared DDL
+// puller is nil.
+func (h *sharedDDLPuller) subscribe(startTs uint64) puller.Puller {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.log == nil {
+		h.start(startTs)
+	}
+	l := h.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if startTs < l.retainedTs {
+		log.Info("the ddl entries are not retained by the shared ddl puller, run a dedicated ddl puller",
+			zap.Uint64("startTs", startTs), zap.Uint64("retainedTs", l.retainedTs))
+		return nil
+	}
+	return &ddlSubscriber{
+		log:        l,
+		startTs:    startTs,
+		next:       l.offset,
+		readTs:     startTs,
+		resolvedTs: startTs,
+		outputCh:   make(chan *model.RawKVEntry, 128),
+	}
+}
+
+// start runs the DDL puller in the background until it fails or the shared
+// DDL puller is closed, the puller is started again by the next subscriber
+// once it fails.
+func (h *sharedDDLPuller) start(startTs uint64) {
+	ctx, cancel := context.WithCancel(util.PutTableInfoInCtx(h.ctx, 0, "ticdc-shared-ddl"))
+	l := &sharedDDLLog{retainedTs: startTs, resolvedTs: startTs}
+	plr := h.newPuller(ctx, startTs)
+	h.log = l
+	h.cancel = cancel
+	log.Info("start the shared ddl puller", zap.Uint64("startTs", startTs))
+	go func() {
+		errg, cctx := errgroup.WithContext(ctx)
+		errg.Go(func() error {
+			return plr.Run(cctx)
+		})
+		errg.Go(func() error {
+			rawDDLCh, sortErrCh := puller.SortOutput(cctx, plr.Output())
+			for {
+				select {
+				case <-cctx.Done():
+					return errors.Trace(cctx.Err())
+				case err := <-sortErrCh:
+					return errors.Trace(err)
+				case rawDDL := <-rawDDLCh:
+					if rawDDL != nil {
+						l.append(rawDDL, h.maxEntries)
+					}
+				}
+			}
+		})
+		err := errg.Wait()
+		if errors.Cause(err) != context.Canceled {
+			log.Warn("the shared ddl puller exited", zap.Error(err))
+		}
+		h.mu.Lock()
+		if h.log == l {
+			h.log = nil
+			h.cancel = nil
+		}
+		h.mu.Unlock()
+		cancel()
+		l.fail(err)
+	}()
+}
+
+// close stops the DDL puller, it's no-op on a nil shared DDL puller
+func (h *sharedDDLPuller) close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// sharedDDLLog is the sorted output of a run of the shared DDL puller
+type sharedDDLLog struct {
+	mu sync.Mutex
+	// retainedTs is the commit ts of the last dropped entry, all entries after
+	// it are retained
+	retainedTs uint64
+	resolvedTs uint64
+	entries    []*model.RawKVEntry
+	// offset is the sequence number of entries[0]
+	offset   int
+	err      error
+	notifier notify.Notifier
+}
+
+func (l *sharedDDLLog) append(rawDDL *model.RawKVEntry, maxEntries int) {
+	l.mu.Lock()
+	if rawDDL.OpType == model.OpTypeResolved {
+		l.resolvedTs = rawDDL.CRTs
+	} else {
+		l.entries = append(l.entries, rawDDL)
+		if len(l.entries) > maxEntries {
+			l.retainedTs = l.entries[0].CRTs
+			l.entries[0] = nil
+			l.entries = l.entries[1:]
+			l.offset++
+		}
+	}
+	l.mu.Unlock()
+	l.notifier.Notify()
+}
+
+func (l *sharedDDLLog) fail(err error) {
+	l.mu.Lock()
+	l.err = err
+	l.mu.Unlock()
+	l.notifier.Notify()
+}
+
+// ddlSubscriber implements puller.Puller, it outputs the entries in the log
+// after its start ts.
+type ddlSubscriber struct {
+	log     *sharedDDLLog
+	startTs uint64
+	// next is the sequence number of the next entry to read, readTs is the
+	// commit ts of the last entry read
+	next       int
+	readTs     uint64
+	resolvedTs uint64
+	outputCh   chan *model.RawKVEntry
+}
+
+// read returns the entries not read yet and the resolved ts of the log
+func (s *ddlSubscriber) read() ([]*model.RawKVEntry, uint64, error) {
+	l := s.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s.next < l.offset {
+		// the dropped entries may have the same commit ts as the last entry read
+		if l.retainedTs > s.readTs || (l.retainedTs == s.readTs && s.readTs > s.startTs) {
+			return nil, 0, cerror.ErrDDLPullerLagged.GenWithStackByArgs(len(l.entries))
+		}
+		s.next = l.offset
+	}
+	entries := make([]*model.RawKVEntry, 0, l.offset+len(l.entries)-s.next)
+	entries = append(entries, l.entries[s.next-l.offset:]...)
+	s.next += len(entries)
+	if len(entries) > 0 {
+		s.readTs = entries[len(entries)-1].CRTs
+	}
+	if l.err != nil {
+		return entries, l.resolvedTs, errors.Trace(l.err)
+	}
+	return entries, l.resolvedTs, nil
+}
+
+func (s *ddlSubscriber) output(ctx context.Context, rawDDL *model.RawKVEntry) error {
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case s.outputCh <- rawDDL:
+		return nil
+	}
+}
+
+// Run implements puller.Puller
+func (s *ddlSubscriber) Run(ctx context.Context) error {
+	receiver, err := s.log.notifier.NewReceiver(0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer receiver.Stop()
+	for {
+		entries, resolvedTs, readErr := s.read()
+		for _, entry := range entries {
+			if entry.CRTs <= s.startTs {
+				continue
+			}
+			if err := s.output(ctx, entry); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if readErr != nil {
+			return errors.Trace(readErr)
+		}
+		if resolvedTs > atomic.LoadUint64(&s.resolvedTs) {
+			if err := s.output(ctx, &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: resolvedTs}); err != nil {
+				return errors.Trace(err)
+			}
+			atomic.StoreUint64(&s.resolvedTs, resolvedTs)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-receiver.C:
+		}
+	}
+}
+
+// GetResolvedTs implements puller.Puller
+func (s *ddlSubscriber) GetResolvedTs() uint64 {
+	return atomic.LoadUint64(&s.resolvedTs)
+}
+
+// Output implements puller.Puller
+func (s *ddlSubscriber) Output() <-chan *model.RawKVEntry {
+	return s.outputCh
+}
+
+// IsInitialized implements puller.Puller
+func (s *ddlSubscriber) IsInitialized() bool {
+	return true
+}
+
+// ScanProgress implements puller.Puller, the DDL entries are not scanned by
+// the subscriber
+func (s *ddlSubscriber) ScanProgress() model.IncrementalScanProgress {
+	return model.IncrementalScanProgress{}
+}
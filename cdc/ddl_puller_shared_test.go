@@ -0,0 +1,142 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type sharedDDLPullerSuite struct{}
+
+var _ = check.Suite(&sharedDDLPullerSuite{})
+
+// ddlTestPuller outputs the entries sent by the test
+type ddlTestPuller struct {
+	startTs  uint64
+	outputCh chan *model.RawKVEntry
+	errCh    chan error
+}
+
+func (p *ddlTestPuller) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case err := <-p.errCh:
+		return err
+	}
+}
+
+func (p *ddlTestPuller) GetResolvedTs() uint64            { return 0 }
+func (p *ddlTestPuller) Output() <-chan *model.RawKVEntry { return p.outputCh }
+func (p *ddlTestPuller) IsInitialized() bool              { return true }
+func (p *ddlTestPuller) ScanProgress() model.IncrementalScanProgress {
+	return model.IncrementalScanProgress{}
+}
+
+func (p *ddlTestPuller) send(tss ...uint64) {
+	for _, ts := range tss {
+		p.outputCh <- &model.RawKVEntry{OpType: model.OpTypePut, CRTs: ts}
+	}
+	p.outputCh <- &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: tss[len(tss)-1]}
+}
+
+// receive asserts the subscriber outputs the entries followed by the resolved ts
+func receive(c *check.C, plr puller.Puller, tss ...uint64) {
+	for _, ts := range tss {
+		entry := <-plr.Output()
+		c.Assert(entry.OpType, check.Equals, model.OpTypePut)
+		c.Assert(entry.CRTs, check.Equals, ts)
+	}
+	entry := <-plr.Output()
+	c.Assert(entry.OpType, check.Equals, model.OpTypeResolved)
+	c.Assert(entry.CRTs, check.Equals, tss[len(tss)-1])
+}
+
+func (s *sharedDDLPullerSuite) TestReplay(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var plrs []*ddlTestPuller
+	h := newSharedDDLPuller(ctx, 3, func(ctx context.Context, startTs uint64) puller.Puller {
+		plr := &ddlTestPuller{startTs: startTs, outputCh: make(chan *model.RawKVEntry), errCh: make(chan error, 1)}
+		plrs = append(plrs, plr)
+		return plr
+	})
+	defer h.close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	run := func(plr puller.Puller) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- plr.Run(ctx)
+		}()
+	}
+
+	sub1 := h.subscribe(10)
+	c.Assert(sub1, check.NotNil)
+	c.Assert(plrs, check.HasLen, 1)
+	c.Assert(plrs[0].startTs, check.Equals, uint64(10))
+	run(sub1)
+	plrs[0].send(11, 12)
+	receive(c, sub1, 11, 12)
+	c.Assert(sub1.GetResolvedTs(), check.Equals, uint64(12))
+
+	// the entries after the start ts are replayed to the later subscriber
+	sub2 := h.subscribe(11)
+	c.Assert(sub2, check.NotNil)
+	run(sub2)
+	receive(c, sub2, 12)
+
+	// the entry of 11 is dropped
+	plrs[0].send(13, 14)
+	receive(c, sub1, 13, 14)
+	receive(c, sub2, 13, 14)
+	c.Assert(h.subscribe(10), check.IsNil)
+	sub3 := h.subscribe(11)
+	c.Assert(sub3, check.NotNil)
+	run(sub3)
+	receive(c, sub3, 12, 13, 14)
+	c.Assert(plrs, check.HasLen, 1)
+
+	// the subscribers fail with the puller, the puller is started again by the
+	// next subscriber
+	plrs[0].errCh <- errors.New("puller failed")
+	for i := 0; i < 3; i++ {
+		c.Assert(<-errs, check.ErrorMatches, "puller failed")
+	}
+	wg.Wait()
+	for {
+		h.mu.Lock()
+		stopped := h.log == nil
+		h.mu.Unlock()
+		if stopped {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(h.subscribe(20), check.NotNil)
+	c.Assert(plrs, check.HasLen, 2)
+	c.Assert(plrs[1].startTs, check.Equals, uint64(20))
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// newDDLRateLimiter returns a limiter which allows at most maxDDLPerMinute DDLs
+// to be executed in the downstream per minute, nil means unlimited.
+func newDDLRateLimiter(maxDDLPerMinute int) *rate.Limiter {
+	if maxDDLPerMinute <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(maxDDLPerMinute)), 1)
+}
+
+// throttledDDL is a DDL applied to the schema and the tables of the
+// changefeed, whose execution in the downstream waits for the rate limiter.
+type throttledDDL struct {
+	job   *timodel.Job
+	event *model.DDLEvent
+}
+
+// executeDDL dispatches the DDL to the downstream unless it's throttled, the
+// throttled DDL is retried in the next tick. Only the DDLs executed in the
+// downstream are charged by the rate limiter, the DDLs skipped, e.g. the ones
+// committed before the start ts of the table, are not.
+func (c *changeFeed) executeDDL(ctx context.Context, job *timodel.Job, event *model.DDLEvent) error {
+	if c.ddlThrottled(job, time.Now()) {
+		c.throttledDDL = &throttledDDL{job: job, event: event}
+		return nil
+	}
+	c.throttledDDL = nil
+	if err := c.startDDLExecution(ctx, job, event); err != nil {
+		return errors.Trace(err)
+	}
+	return c.waitDDLExecution(ctx)
+}
+
+// skipThrottledDDL finishes the throttled DDL without executing it in the
+// downstream if it's skipped by operator while waiting for the rate limiter.
+func (c *changeFeed) skipThrottledDDL() bool {
+	job := c.throttledDDL.job
+	if _, ok := c.skipDDLJobs[job.ID]; !ok {
+		return false
+	}
+	delete(c.skipDDLJobs, job.ID)
+	c.throttledDDL = nil
+	log.Warn("DDL skipped by operator", zap.String("changefeed", c.id), zap.Reflect("ddlJob", job))
+	c.finishDDL(job, false)
+	return true
+}
+
+// ddlThrottled checks whether the DDL job should wait for the rate limiter.
+// A throttled job stays at the head of ddlJobHistory, so the DDLs are still
+// executed in order, and the resolved ts is held at the DDL barrier until the
+// job is executed.
+func (c *changeFeed) ddlThrottled(job *timodel.Job, now time.Time) bool {
+	if c.ddlRateLimiter == nil {
+		return false
+	}
+	// the DDL skipped by operator is not executed in the downstream
+	if _, ok := c.skipDDLJobs[job.ID]; ok {
+		return false
+	}
+	if c.ddlRateLimiter.AllowN(now, 1) {
+		return false
+	}
+	// only warn once for each throttled job, the owner ticks frequently
+	if c.throttledDDLJobID != job.ID {
+		c.throttledDDLJobID = job.ID
+		log.Warn("DDL execution is throttled by the rate limit",
+			zap.String("changefeed", c.id),
+			zap.Int64("jobID", job.ID),
+			zap.String("query", job.Query),
+			zap.Int("queueDepth", len(c.ddlJobHistory)))
+	}
+	return true
+}
+
+// skipDDLOnce marks the queued DDL job to not be executed in the downstream,
+// the job is still applied to the schema of the owner. It returns false if
+// the job is not queued in the changefeed. The DDL recovered from a previous
+// owner can be skipped too, which is recorded as done without execution.
+func (c *changeFeed) skipDDLOnce(jobID int64) bool {
+	if c.recoveredDDL != nil && c.recoveredDDL.record.JobID == jobID {
+		c.skipDDLJobs[jobID] = struct{}{}
+		return true
+	}
+	for _, job := range c.ddlJobHistory {
+		if job.ID == jobID {
+			c.skipDDLJobs[jobID] = struct{}{}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlRateLimitSuite struct{}
+
+var _ = check.Suite(&ddlRateLimitSuite{})
+
+func (s *ddlRateLimitSuite) TestUnlimited(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(newDDLRateLimiter(0), check.IsNil)
+	c.Assert(newDDLRateLimiter(-1), check.IsNil)
+
+	cf := &changeFeed{skipDDLJobs: make(map[int64]struct{})}
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		c.Assert(cf.ddlThrottled(&timodel.Job{ID: int64(i)}, now), check.IsFalse)
+	}
+}
+
+func (s *ddlRateLimitSuite) TestPacingAndOrdering(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := &changeFeed{
+		ddlRateLimiter: newDDLRateLimiter(6),
+		skipDDLJobs:    make(map[int64]struct{}),
+	}
+	// enqueue a burst of DDL jobs
+	for i := 1; i <= 5; i++ {
+		cf.ddlJobHistory = append(cf.ddlJobHistory, &timodel.Job{ID: int64(i)})
+	}
+
+	// tick every second as the owner does, and execute the head job if it's not throttled
+	start := time.Now()
+	var executedIDs []int64
+	var executedAt []time.Duration
+	for tick := 0; tick <= 60 && len(cf.ddlJobHistory) > 0; tick++ {
+		now := start.Add(time.Duration(tick) * time.Second)
+		job := cf.ddlJobHistory[0]
+		if cf.ddlThrottled(job, now) {
+			continue
+		}
+		executedIDs = append(executedIDs, job.ID)
+		executedAt = append(executedAt, now.Sub(start))
+		cf.ddlJobHistory = cf.ddlJobHistory[1:]
+	}
+	c.Assert(executedIDs, check.DeepEquals, []int64{1, 2, 3, 4, 5})
+	// 6 DDLs per minute means one DDL every 10 seconds
+	c.Assert(executedAt, check.DeepEquals, []time.Duration{
+		0, 10 * time.Second, 20 * time.Second, 30 * time.Second, 40 * time.Second,
+	})
+}
+
+func (s *ddlRateLimitSuite) TestSkipDDLOnce(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := &changeFeed{
+		ddlRateLimiter: newDDLRateLimiter(1),
+		skipDDLJobs:    make(map[int64]struct{}),
+		ddlJobHistory:  []*timodel.Job{{ID: 1}, {ID: 2}, {ID: 3}},
+	}
+	// the job not queued can't be skipped
+	c.Assert(cf.skipDDLOnce(4), check.IsFalse)
+	c.Assert(cf.skipDDLOnce(2), check.IsTrue)
+	c.Assert(cf.skipDDLJobs, check.DeepEquals, map[int64]struct{}{2: {}})
+
+	now := time.Now()
+	c.Assert(cf.ddlThrottled(cf.ddlJobHistory[0], now), check.IsFalse)
+	cf.ddlJobHistory = cf.ddlJobHistory[1:]
+	// the skipped job is not throttled, because it's not executed in the downstream
+	c.Assert(cf.ddlThrottled(cf.ddlJobHistory[0], now), check.IsFalse)
+	cf.ddlJobHistory = cf.ddlJobHistory[1:]
+	c.Assert(cf.ddlThrottled(cf.ddlJobHistory[0], now), check.IsTrue)
+	c.Assert(cf.throttledDDLJobID, check.Equals, int64(3))
+	c.Assert(cf.ddlThrottled(cf.ddlJobHistory[0], now.Add(time.Minute)), check.IsFalse)
+}
+
+// executedDDLSink records the DDLs executed in the downstream
+type executedDDLSink struct {
+	sink.Sink
+	ddls []*model.DDLEvent
+}
+
+func (s *executedDDLSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	s.ddls = append(s.ddls, ddl)
+	return nil
+}
+
+func (s *ddlRateLimitSuite) TestThrottledDDLHeld(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	ddlSink := &executedDDLSink{}
+	cf := &changeFeed{
+		ddlRateLimiter: newDDLRateLimiter(1),
+		skipDDLJobs:    make(map[int64]struct{}),
+		sink:           ddlSink,
+		info:           &model.ChangeFeedInfo{Config: config.GetDefaultReplicaConfig()},
+		status:         &model.ChangeFeedStatus{},
+		statusWriter:   &memStatusWriter{},
+		ddlState:       model.ChangeFeedExecDDL,
+	}
+	jobs := []*timodel.Job{
+		{ID: 1, BinlogInfo: &timodel.HistoryInfo{FinishedTS: 100}},
+		{ID: 2, BinlogInfo: &timodel.HistoryInfo{FinishedTS: 200}},
+	}
+	cf.ddlJobHistory = append(cf.ddlJobHistory, jobs...)
+
+	c.Assert(cf.executeDDL(ctx, jobs[0], &model.DDLEvent{CommitTs: 100}), check.IsNil)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	c.Assert(ddlSink.ddls, check.HasLen, 1)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+
+	// the next DDL is applied but waits for the budget to be executed
+	cf.ddlState = model.ChangeFeedExecDDL
+	c.Assert(cf.executeDDL(ctx, jobs[1], &model.DDLEvent{CommitTs: 200}), check.IsNil)
+	for i := 0; i < 2; i++ {
+		c.Assert(cf.throttledDDL, check.NotNil)
+		c.Assert(cf.throttledDDL.job.ID, check.Equals, int64(2))
+		c.Assert(ddlSink.ddls, check.HasLen, 1)
+		c.Assert(cf.ddlState, check.Equals, model.ChangeFeedExecDDL)
+		c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+		c.Assert(cf.status.ExecutingDDL, check.IsNil)
+		c.Assert(cf.handleDDL(ctx, nil), check.IsNil)
+	}
+
+	// the budget is refilled
+	cf.ddlRateLimiter = newDDLRateLimiter(1)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	c.Assert(cf.throttledDDL, check.IsNil)
+	c.Assert(ddlSink.ddls, check.HasLen, 2)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(200))
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 0)
+}
+
+func (s *ddlRateLimitSuite) TestSkipThrottledDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	ddlSink := &executedDDLSink{}
+	cf := &changeFeed{
+		ddlRateLimiter: newDDLRateLimiter(1),
+		skipDDLJobs:    make(map[int64]struct{}),
+		sink:           ddlSink,
+		info:           &model.ChangeFeedInfo{Config: config.GetDefaultReplicaConfig()},
+		status:         &model.ChangeFeedStatus{},
+		statusWriter:   &memStatusWriter{},
+		ddlState:       model.ChangeFeedExecDDL,
+	}
+	jobs := []*timodel.Job{
+		{ID: 1, BinlogInfo: &timodel.HistoryInfo{FinishedTS: 100}},
+		{ID: 2, BinlogInfo: &timodel.HistoryInfo{FinishedTS: 200}},
+	}
+	cf.ddlJobHistory = append(cf.ddlJobHistory, jobs...)
+
+	c.Assert(cf.executeDDL(ctx, jobs[0], &model.DDLEvent{CommitTs: 100}), check.IsNil)
+	c.Assert(waitDDL(c, cf), check.IsNil)
+	cf.ddlState = model.ChangeFeedExecDDL
+	c.Assert(cf.executeDDL(ctx, jobs[1], &model.DDLEvent{CommitTs: 200}), check.IsNil)
+	c.Assert(cf.throttledDDL, check.NotNil)
+
+	// the DDL held by the rate limiter is skipped by operator
+	c.Assert(cf.skipDDLOnce(2), check.IsTrue)
+	c.Assert(cf.handleDDL(ctx, nil), check.IsNil)
+	c.Assert(cf.throttledDDL, check.IsNil)
+	c.Assert(cf.skipDDLJobs, check.HasLen, 0)
+	c.Assert(ddlSink.ddls, check.HasLen, 1)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(200))
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 0)
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// handleUnsupportedDDL applies the ddl-unsupported-action of the changefeed to
+// the DDL job rejected by the sink because the downstream doesn't support it.
+// It returns whether the DDL is skipped, otherwise the DDL is not applied and
+// the returned error stops or pauses the changefeed.
+func (c *changeFeed) handleUnsupportedDDL(job *timodel.Job, err error) (bool, error) {
+	ddl := &model.UnsupportedDDL{
+		JobID:    job.ID,
+		CommitTs: job.BinlogInfo.FinishedTS,
+		Query:    job.Query,
+		Error:    err.Error(),
+		Time:     time.Now(),
+	}
+	switch action := c.info.Config.GetDDLUnsupportedAction(); action {
+	case config.DDLUnsupportedSkip:
+		log.Warn("DDL skipped, it's not supported by the downstream",
+			zap.String("changefeed", c.id), zap.Reflect("ddlJob", job), zap.Error(err))
+		c.status.AddSkippedDDL(ddl)
+		return true, nil
+	case config.DDLUnsupportedPause:
+		log.Warn("changefeed is pausing, the DDL is not supported by the downstream",
+			zap.String("changefeed", c.id), zap.Reflect("ddlJob", job), zap.Error(err))
+		c.ddlState = model.ChangeFeedDDLExecuteFailed
+		c.status.PausedDDL = ddl
+		return false, cerror.ErrPausedOnUnsupportedDDL.GenWithStackByArgs(job.Query)
+	default:
+		log.Error("Execute DDL failed, the DDL is not supported by the downstream",
+			zap.String("changefeed", c.id), zap.Reflect("ddlJob", job), zap.Error(err))
+		c.ddlState = model.ChangeFeedDDLExecuteFailed
+		return false, err
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/meta"
+	"github.com/pingcap/tidb/store/mockstore"
+)
+
+type ddlUnsupportedSuite struct{}
+
+var _ = check.Suite(&ddlUnsupportedSuite{})
+
+// unsupportedDDLSink rejects all the DDLs as a downstream not supporting them
+type unsupportedDDLSink struct {
+	sink.Sink
+	ddls []*model.DDLEvent
+}
+
+func (s *unsupportedDDLSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	s.ddls = append(s.ddls, ddl)
+	return cerror.ErrDDLUnsupportedByDownstream.GenWithStackByArgs(ddl.Query,
+		"Error 1064: You have an error in your SQL syntax")
+}
+
+func (s *ddlUnsupportedSuite) newChangefeed(c *check.C, action string) *changeFeed {
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	txn, err := store.Begin()
+	c.Assert(err, check.IsNil)
+	defer txn.Rollback() //nolint:errcheck
+	schemaSnap, err := entry.NewSingleSchemaSnapshotFromMeta(meta.NewMeta(txn), 0, false)
+	c.Assert(err, check.IsNil)
+
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.DDLUnsupportedAction = action
+	f, err := filter.NewFilter(cfg)
+	c.Assert(err, check.IsNil)
+	return &changeFeed{
+		id:            "test-changefeed",
+		info:          &model.ChangeFeedInfo{Config: cfg},
+		status:        &model.ChangeFeedStatus{ResolvedTs: 100, CheckpointTs: 100},
+		schema:        schemaSnap,
+		schemas:       make(map[model.SchemaID]tableIDMap),
+		tables:        make(map[model.TableID]model.TableName),
+		partitions:    make(map[model.TableID][]int64),
+		orphanTables:  make(map[model.TableID]model.Ts),
+		toCleanTables: make(map[model.TableID]model.Ts),
+		filter:        f,
+		sink:          &unsupportedDDLSink{},
+		statusWriter:  &memStatusWriter{},
+		ddlState:      model.ChangeFeedWaitToExecDDL,
+		ddlJobHistory: []*timodel.Job{{
+			ID:       1,
+			SchemaID: 1,
+			Type:     timodel.ActionCreateSchema,
+			State:    timodel.JobStateSynced,
+			Query:    "create database test",
+			BinlogInfo: &timodel.HistoryInfo{
+				SchemaVersion: 1,
+				DBInfo:        &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")},
+				FinishedTS:    100,
+			},
+		}},
+	}
+}
+
+func (s *ddlUnsupportedSuite) TestUnsupportedDDLActions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+
+	// the changefeed is stopped with the classified error by default
+	cf := s.newChangefeed(c, "")
+	err := cf.handleDDL(ctx, nil)
+	c.Assert(cerror.ErrDDLUnsupportedByDownstream.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, ".*create database test.*1064.*")
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedDDLExecuteFailed)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+	c.Assert(cf.status.SkippedDDLs, check.HasLen, 0)
+
+	// the DDL is skipped and recorded, and the barrier is advanced
+	cf = s.newChangefeed(c, config.DDLUnsupportedSkip)
+	c.Assert(cf.handleDDL(ctx, nil), check.IsNil)
+	c.Assert(cf.sink.(*unsupportedDDLSink).ddls, check.HasLen, 1)
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedSyncDML)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 0)
+	c.Assert(cf.ddlExecutedTs, check.Equals, uint64(100))
+	c.Assert(cf.status.SkippedDDLs, check.HasLen, 1)
+	c.Assert(cf.status.SkippedDDLs[0].JobID, check.Equals, int64(1))
+	c.Assert(cf.status.SkippedDDLs[0].CommitTs, check.Equals, uint64(100))
+	c.Assert(cf.status.SkippedDDLs[0].Error, check.Matches, ".*1064.*")
+
+	// the changefeed is paused at the checkpoint before the DDL
+	cf = s.newChangefeed(c, config.DDLUnsupportedPause)
+	err = cf.handleDDL(ctx, nil)
+	c.Assert(cerror.ErrPausedOnUnsupportedDDL.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(cf.ddlState, check.Equals, model.ChangeFeedDDLExecuteFailed)
+	c.Assert(cf.ddlJobHistory, check.HasLen, 1)
+	c.Assert(cf.status.PausedDDL.Query, check.Equals, "create database test")
+
+	owner := &Owner{changeFeeds: map[model.ChangeFeedID]*changeFeed{cf.id: s.newChangefeed(c, config.DDLUnsupportedPause)}}
+	c.Assert(owner.handleDDL(ctx), check.IsNil)
+	c.Assert(owner.adminJobs, check.DeepEquals, []model.AdminJob{{CfID: cf.id, Type: model.AdminStop}})
+}
+
+func (s *ddlUnsupportedSuite) TestValidateDDLUnsupportedAction(c *check.C) {
+	defer testleak.AfterTest(c)()
+	for _, action := range []string{"", config.DDLUnsupportedError, config.DDLUnsupportedSkip, config.DDLUnsupportedPause} {
+		c.Assert(config.ValidateDDLUnsupportedAction(action), check.IsNil)
+	}
+	err := config.ValidateDDLUnsupportedAction("ignore")
+	c.Assert(cerror.ErrInvalidDDLAction.Equal(err), check.IsTrue)
+	c.Assert((*config.ReplicaConfig)(nil).GetDDLUnsupportedAction(), check.Equals, config.DDLUnsupportedError)
+}
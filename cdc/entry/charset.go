@@ -0,0 +1,64 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"bytes"
+	"strings"
+
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// nonUTF8Charsets are the charsets whose values are stored in their own
+// encodings rather than UTF-8, the values are decoded into UTF-8 by the
+// mounter, so that the sinks don't need to know the charsets.
+var nonUTF8Charsets = map[string]encoding.Encoding{
+	"gbk":     simplifiedchinese.GBK,
+	"gb18030": simplifiedchinese.GB18030,
+}
+
+// decodeCharset decodes the value of the string column into UTF-8 if the
+// charset of the column is one of nonUTF8Charsets, and returns the charset.
+// The value is returned as it is with an empty charset if it's not decoded,
+// e.g. the binary columns, or the bytes are not valid in the charset, which
+// are kept so that they are replicated byte-exactly.
+func decodeCharset(colInfo *timodel.ColumnInfo, value interface{}) (interface{}, string, string) {
+	b, ok := value.([]byte)
+	if !ok || len(b) == 0 {
+		return value, "", ""
+	}
+	switch colInfo.Tp {
+	case mysql.TypeString, mysql.TypeVarString, mysql.TypeVarchar,
+		mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+	default:
+		return value, "", ""
+	}
+	charset := strings.ToLower(colInfo.Charset)
+	enc, ok := nonUTF8Charsets[charset]
+	if !ok {
+		return value, "", ""
+	}
+	decoded, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return value, "", "the value can't be decoded from charset " + charset
+	}
+	// the invalid bytes are replaced by the decoder silently
+	if encoded, err := enc.NewEncoder().Bytes(decoded); err != nil || !bytes.Equal(encoded, b) {
+		return value, "", "the value is not valid in charset " + charset + ", it's replicated as it is"
+	}
+	return decoded, charset, ""
+}
@@ -25,6 +25,13 @@ var (
 			Name:      "input_chan_size",
 			Help:      "mounter input chan size",
 		}, []string{"capture", "changefeed"})
+	mounterQueuedBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "queued_bytes",
+			Help:      "the size of the events sent to the mounter and not decoded yet",
+		}, []string{"capture", "changefeed"})
 	mountDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "ticdc",
@@ -33,10 +40,85 @@ var (
 			Help:      "Bucketed histogram of processing time (s) of unmarshal and mount in mounter.",
 			Buckets:   prometheus.ExponentialBuckets(0.000001, 10, 10),
 		}, []string{"capture", "changefeed"})
+	schemaWaitingWorkersGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "schema_waiting_workers",
+			Help:      "number of mounter workers waiting for the schema storage resolved ts",
+		}, []string{"capture", "changefeed"})
+	schemaWaitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "schema_wait_duration",
+			Help:      "Bucketed histogram of waiting time (s) for the schema storage resolved ts in mounter.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 18),
+		}, []string{"capture", "changefeed"})
+	slowPrepareCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "slow_prepare_count",
+			Help:      "number of times waiting for a row to be mounted exceeds the warn threshold",
+		}, []string{"capture", "changefeed"})
+	decodeTimeoutCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "decode_timeout_count",
+			Help:      "number of rows whose decoding times out",
+		}, []string{"capture", "changefeed"})
+	malformedRowCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "mounter",
+			Name:      "malformed_row_count",
+			Help:      "number of rows failed to be decoded",
+		}, []string{"capture", "changefeed"})
+	schemaGCDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "schema_storage",
+			Name:      "gc_duration",
+			Help:      "Bucketed histogram of gc time (s) of the schema storage.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 18),
+		}, []string{"capture", "changefeed"})
+	schemaGCReclaimedSnapsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "schema_storage",
+			Name:      "gc_reclaimed_snapshots",
+			Help:      "number of schema snapshots reclaimed by the gc of the schema storage",
+		}, []string{"capture", "changefeed"})
+	schemaGCTsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "schema_storage",
+			Name:      "gc_ts",
+			Help:      "the physical part of the effective gc ts of the schema storage",
+		}, []string{"capture", "changefeed"})
+	schemaSnapshotsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "schema_storage",
+			Name:      "snapshots",
+			Help:      "number of schema snapshots held by the schema storage",
+		}, []string{"capture", "changefeed"})
 )
 
 // InitMetrics registers all metrics in this file
 func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(mounterInputChanSizeGauge)
+	registry.MustRegister(mounterQueuedBytesGauge)
 	registry.MustRegister(mountDuration)
+	registry.MustRegister(schemaWaitingWorkersGauge)
+	registry.MustRegister(schemaWaitDuration)
+	registry.MustRegister(slowPrepareCounter)
+	registry.MustRegister(decodeTimeoutCounter)
+	registry.MustRegister(malformedRowCounter)
+	registry.MustRegister(schemaGCDuration)
+	registry.MustRegister(schemaGCReclaimedSnapsCounter)
+	registry.MustRegister(schemaGCTsGauge)
+	registry.MustRegister(schemaSnapshotsGauge)
 }
@@ -17,17 +17,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
 	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/tidb/kv"
@@ -39,7 +44,10 @@ import (
 )
 
 const (
-	defaultOutputChanSize = 128000
+	// defaultInputChanSize is the size of the input channel of each worker,
+	// which is kept small as the events in the channels are not sorted or
+	// spilled to the disk.
+	defaultInputChanSize = 1024
 )
 
 type baseKVEntry struct {
@@ -62,6 +70,9 @@ type rowKVEntry struct {
 	// or row data that does not contain any Datum.
 	RowExist    bool
 	PreRowExist bool
+	// PreRowFromKey is true if the PreRow of the deleted row can only be
+	// recovered from the handle in its key, because the old value is disabled.
+	PreRowFromKey bool
 }
 
 type indexKVEntry struct {
@@ -127,7 +138,98 @@ func isDistinct(index *timodel.IndexInfo, indexValue []types.Datum) bool {
 // Mounter is used to parse SQL events from KV events
 type Mounter interface {
 	Run(ctx context.Context) error
-	Input() chan<- *model.PolymorphicEvent
+	// AddEntry sends an event to the mounter, it blocks until there is room
+	// in the input of the mounter or the context is done
+	AddEntry(ctx context.Context, ev *model.PolymorphicEvent) error
+	// WaitPrepare waits for an event sent to the mounter to be mounted
+	WaitPrepare(ctx context.Context, ev *model.PolymorphicEvent) error
+}
+
+// MemoryTracker tracks the memory used by the events, the events queued in
+// the mounter are added to it until they're decoded.
+type MemoryTracker interface {
+	Add(n int64)
+}
+
+// the statuses of mounting an event
+const (
+	mountDecoding      = "decoding"
+	mountWaitingSchema = "waiting-schema"
+)
+
+// mountProgress is the progress of mounting an event, it's updated by the
+// decoding and read by the decode timeout and the prepare watchdog
+type mountProgress struct {
+	event *model.PolymorphicEvent
+
+	mu      sync.Mutex
+	status  string
+	tableID int64
+	// since is the time entering the status
+	since time.Time
+}
+
+type mountProgressKey struct{}
+
+// progressFromCtx returns the progress of the event decoded with the context,
+// nil is returned if the context is not from a mounter worker
+func progressFromCtx(ctx context.Context) *mountProgress {
+	p, _ := ctx.Value(mountProgressKey{}).(*mountProgress)
+	return p
+}
+
+func (p *mountProgress) setStatus(status string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.status = status
+	p.since = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *mountProgress) setTableID(tableID int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.tableID = tableID
+	p.mu.Unlock()
+}
+
+// decodingTime returns the time of decoding since the last time the schema
+// storage was waited for, 0 is returned if it's waiting for the schema storage
+func (p *mountProgress) decodingTime(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status != mountDecoding {
+		return 0
+	}
+	return now.Sub(p.since)
+}
+
+func (p *mountProgress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("%s table %d at ts %d for %s", p.status, p.tableID, p.event.CRTs, time.Since(p.since))
+}
+
+// mounterWorker records the event being mounted by a worker
+type mounterWorker struct {
+	mu       sync.Mutex
+	progress *mountProgress
+}
+
+func (w *mounterWorker) setProgress(p *mountProgress) {
+	w.mu.Lock()
+	w.progress = p
+	w.mu.Unlock()
+}
+
+func (w *mounterWorker) getProgress() *mountProgress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress
 }
 
 type mounterImpl struct {
@@ -136,29 +238,105 @@ type mounterImpl struct {
 	tz               *time.Location
 	workerNum        int
 	enableOldValue   bool
+
+	// schemaWaitTimeout is the max duration waiting for the schema storage
+	// to be resolved, 0 means waiting forever
+	schemaWaitTimeout       time.Duration
+	schemaWaitWarnThreshold time.Duration
+
+	// prepareTimeout is the max duration waiting for an event to be mounted,
+	// 0 means waiting forever
+	prepareTimeout       time.Duration
+	prepareWarnThreshold time.Duration
+	// decodeTimeout is the max duration of decoding an event, 0 disables the
+	// timeout
+	decodeTimeout    time.Duration
+	skipMalformedRow bool
+	// quarantineDir is the dir which the raw entries of the skipped malformed
+	// rows are written to
+	quarantineDir string
+	// quarantineObserver is called for each row quarantined, it's nil if
+	// nobody observes the quarantined rows
+	quarantineObserver QuarantineObserver
+
+	workers []*mounterWorker
+
+	memTracker MemoryTracker
+	// queuedBytes is the size of the events sent to the mounter and not
+	// decoded yet
+	queuedBytes int64
 }
 
-// NewMounter creates a mounter
-func NewMounter(schemaStorage *SchemaStorage, workerNum int, enableOldValue bool) Mounter {
+// NewMounter creates a mounter, the memory of the events queued in it is
+// tracked by memTracker if it's not nil. The malformed rows skipped are
+// quarantined in quarantineDir.
+func NewMounter(
+	schemaStorage *SchemaStorage, cfg *config.MounterConfig, enableOldValue bool, memTracker MemoryTracker, quarantineDir string,
+) Mounter {
+	workerNum := cfg.WorkerNum
 	if workerNum <= 0 {
 		workerNum = defaultMounterWorkerNum
 	}
+	inputChanSize := cfg.InputChanSize
+	if inputChanSize <= 0 {
+		inputChanSize = defaultInputChanSize
+	}
+	schemaWaitWarnThreshold := time.Duration(cfg.SchemaWaitWarnThreshold) * time.Second
+	if schemaWaitWarnThreshold <= 0 {
+		schemaWaitWarnThreshold = defaultSchemaWaitWarnThreshold
+	}
+	prepareWarnThreshold := time.Duration(cfg.PrepareWarnThreshold) * time.Second
+	if prepareWarnThreshold <= 0 {
+		prepareWarnThreshold = defaultPrepareWarnThreshold
+	}
 	chs := make([]chan *model.PolymorphicEvent, workerNum)
+	workers := make([]*mounterWorker, workerNum)
 	for i := 0; i < workerNum; i++ {
-		chs[i] = make(chan *model.PolymorphicEvent, defaultOutputChanSize)
+		chs[i] = make(chan *model.PolymorphicEvent, inputChanSize)
+		workers[i] = &mounterWorker{}
 	}
 	return &mounterImpl{
 		schemaStorage:    schemaStorage,
 		rawRowChangedChs: chs,
 		workerNum:        workerNum,
 		enableOldValue:   enableOldValue,
+
+		schemaWaitTimeout:       time.Duration(cfg.SchemaWaitTimeout) * time.Second,
+		schemaWaitWarnThreshold: schemaWaitWarnThreshold,
+
+		prepareTimeout:       time.Duration(cfg.PrepareTimeout) * time.Second,
+		prepareWarnThreshold: prepareWarnThreshold,
+		decodeTimeout:        time.Duration(cfg.DecodeTimeout) * time.Second,
+		skipMalformedRow:     cfg.SkipMalformedRow,
+		quarantineDir:        quarantineDir,
+
+		workers:    workers,
+		memTracker: memTracker,
 	}
 }
 
-const defaultMounterWorkerNum = 32
+// QuarantineObserver is called with the table and the error of each malformed
+// row quarantined by the mounter
+type QuarantineObserver func(tableID model.TableID, err error)
+
+// SetQuarantineObserver sets the observer of the rows quarantined by the
+// mounter, it must be called before the mounter runs.
+func SetQuarantineObserver(m Mounter, observer QuarantineObserver) {
+	if m, ok := m.(*mounterImpl); ok {
+		m.quarantineObserver = observer
+	}
+}
+
+const (
+	defaultMounterWorkerNum        = 32
+	defaultSchemaWaitWarnThreshold = time.Minute
+	defaultPrepareWarnThreshold    = time.Minute
+	schemaWaitCheckInterval        = 10 * time.Millisecond
+)
 
 func (m *mounterImpl) Run(ctx context.Context) error {
 	m.tz = util.TimezoneFromCtx(ctx)
+	q := newQuarantine(m.quarantineDir, util.ChangefeedIDFromCtx(ctx), maxQuarantineFileBytes)
 	errg, ctx := errgroup.WithContext(ctx)
 	errg.Go(func() error {
 		m.collectMetrics(ctx)
@@ -167,16 +345,19 @@ func (m *mounterImpl) Run(ctx context.Context) error {
 	for i := 0; i < m.workerNum; i++ {
 		index := i
 		errg.Go(func() error {
-			return m.codecWorker(ctx, index)
+			return m.codecWorker(ctx, index, q)
 		})
 	}
 	return errg.Wait()
 }
 
-func (m *mounterImpl) codecWorker(ctx context.Context, index int) error {
+func (m *mounterImpl) codecWorker(ctx context.Context, index int, q *quarantine) error {
 	captureAddr := util.CaptureAddrFromCtx(ctx)
 	changefeedID := util.ChangefeedIDFromCtx(ctx)
 	metricMountDuration := mountDuration.WithLabelValues(captureAddr, changefeedID)
+	metricDecodeTimeout := decodeTimeoutCounter.WithLabelValues(captureAddr, changefeedID)
+	metricMalformedRow := malformedRowCounter.WithLabelValues(captureAddr, changefeedID)
+	worker := m.workers[index]
 
 	for {
 		var pEvent *model.PolymorphicEvent
@@ -186,14 +367,49 @@ func (m *mounterImpl) codecWorker(ctx context.Context, index int) error {
 		case pEvent = <-m.rawRowChangedChs[index]:
 		}
 		if pEvent.RawKV.OpType == model.OpTypeResolved {
+			m.dequeue(0)
 			pEvent.PrepareFinished()
 			continue
 		}
+		// the size is taken before the raw kv is reset
+		size := pEvent.RawKV.ApproximateSize()
 		startTime := time.Now()
-		rowEvent, err := m.unmarshalAndMountRowChanged(ctx, pEvent.RawKV)
+		progress := &mountProgress{event: pEvent, status: mountDecoding, since: startTime}
+		worker.setProgress(progress)
+		rowEvent, err := m.mount(context.WithValue(ctx, mountProgressKey{}, progress), progress)
+		worker.setProgress(nil)
+		if cerror.ErrMounterDecodeTimeout.Equal(err) {
+			metricDecodeTimeout.Inc()
+			if !m.skipMalformedRow {
+				return errors.Trace(err)
+			}
+			log.Warn("skip the row whose decoding times out", append(util.ZapFieldsFromCtx(ctx), zap.Error(err))...)
+			// the raw kv may still be read by the decoding, so it's not reset
+			m.dequeue(size)
+			pEvent.PrepareFinished()
+			continue
+		}
+		if isMalformedRow(err) {
+			metricMalformedRow.Inc()
+			if !m.skipMalformedRow {
+				return errors.Trace(err)
+			}
+			if err := m.quarantineRow(ctx, q, progress, err); err != nil {
+				return errors.Trace(err)
+			}
+			m.dequeue(size)
+			pEvent.RawKV.Key = nil
+			pEvent.RawKV.Value = nil
+			pEvent.PrepareFinished()
+			continue
+		}
 		if err != nil {
 			return errors.Trace(err)
 		}
+		m.dequeue(size)
+		if rowEvent != nil {
+			rowEvent.Sampled = pEvent.Sampled
+		}
 		pEvent.Row = rowEvent
 		pEvent.RawKV.Key = nil
 		pEvent.RawKV.Value = nil
@@ -202,14 +418,176 @@ func (m *mounterImpl) codecWorker(ctx context.Context, index int) error {
 	}
 }
 
-func (m *mounterImpl) Input() chan<- *model.PolymorphicEvent {
-	return m.rawRowChangedChs[rand.Intn(m.workerNum)]
+// quarantineRow logs the malformed row and writes its raw kv to the quarantine
+// file, the row is skipped only if it's quarantined.
+func (m *mounterImpl) quarantineRow(ctx context.Context, q *quarantine, progress *mountProgress, mountErr error) error {
+	raw := progress.event.RawKV
+	progress.mu.Lock()
+	tableID := progress.tableID
+	progress.mu.Unlock()
+	log.Warn("skip the malformed row", append(util.ZapFieldsFromCtx(ctx),
+		zap.String("key", hex.EncodeToString(raw.Key)), zap.Uint64("commitTs", raw.CRTs),
+		zap.Int64("table-id", tableID), zap.Error(mountErr))...)
+	err := q.write(&QuarantineEntry{
+		Time:         time.Now(),
+		ChangefeedID: util.ChangefeedIDFromCtx(ctx),
+		TableID:      tableID,
+		OpType:       raw.OpType,
+		Key:          raw.Key,
+		Value:        raw.Value,
+		OldValue:     raw.OldValue,
+		StartTs:      raw.StartTs,
+		CRTs:         raw.CRTs,
+		Error:        mountErr.Error(),
+	})
+	if err != nil {
+		return err
+	}
+	if m.quarantineObserver != nil {
+		m.quarantineObserver(tableID, mountErr)
+	}
+	return nil
+}
+
+// mount decodes the raw kv of the event. If it takes more than decodeTimeout,
+// with the time waiting for the schema storage excluded, it gives up the
+// decoding and returns ErrMounterDecodeTimeout, the decoding keeps running in
+// the background until it finishes or the context is canceled.
+func (m *mounterImpl) mount(ctx context.Context, progress *mountProgress) (*model.RowChangedEvent, error) {
+	raw := progress.event.RawKV
+	if m.decodeTimeout <= 0 {
+		return m.unmarshalAndMountRowChanged(ctx, raw)
+	}
+	type result struct {
+		row *model.RowChangedEvent
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		row, err := m.unmarshalAndMountRowChanged(ctx, raw)
+		resultCh <- result{row: row, err: err}
+	}()
+	timer := time.NewTimer(m.decodeTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.Trace(ctx.Err())
+		case res := <-resultCh:
+			return res.row, res.err
+		case <-timer.C:
+		}
+		if elapsed := progress.decodingTime(time.Now()); elapsed < m.decodeTimeout {
+			timer.Reset(m.decodeTimeout - elapsed)
+			continue
+		}
+		progress.mu.Lock()
+		tableID := progress.tableID
+		progress.mu.Unlock()
+		return nil, cerror.ErrMounterDecodeTimeout.GenWithStackByArgs(tableID, raw.CRTs, m.decodeTimeout)
+	}
+}
+
+// WaitPrepare waits for the event to be mounted. A warning with the states of
+// the workers is logged every prepareWarnThreshold of waiting, and
+// ErrMounterPrepareTimeout is returned once prepareTimeout is reached.
+func (m *mounterImpl) WaitPrepare(ctx context.Context, ev *model.PolymorphicEvent) error {
+	if ev.IsPrepared() {
+		return nil
+	}
+	startTime := time.Now()
+	warnTime := startTime.Add(m.prepareWarnThreshold)
+	for {
+		deadline := warnTime
+		if m.prepareTimeout > 0 && startTime.Add(m.prepareTimeout).Before(deadline) {
+			deadline = startTime.Add(m.prepareTimeout)
+		}
+		waitCtx, cancel := context.WithDeadline(ctx, deadline)
+		err := ev.WaitPrepare(waitCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return errors.Trace(ctx.Err())
+		}
+		now := time.Now()
+		duration := now.Sub(startTime)
+		tableID, workers := m.describeWorkers(ev)
+		fields := append(util.ZapFieldsFromCtx(ctx),
+			zap.Int64("table-id", tableID), zap.Uint64("commit-ts", ev.CRTs), zap.Uint64("start-ts", ev.StartTs),
+			zap.Duration("duration", duration), zap.Strings("busy-workers", workers))
+		if m.prepareTimeout > 0 && duration >= m.prepareTimeout {
+			log.Error("the row is not mounted in time, the mounter workers may be stuck", fields...)
+			return cerror.ErrMounterPrepareTimeout.GenWithStackByArgs(tableID, ev.CRTs, m.prepareTimeout)
+		}
+		if !now.Before(warnTime) {
+			slowPrepareCounter.WithLabelValues(util.CaptureAddrFromCtx(ctx), util.ChangefeedIDFromCtx(ctx)).Inc()
+			log.Warn("waiting for the row to be mounted too long, the mounter workers may be stuck", fields...)
+			warnTime = now.Add(m.prepareWarnThreshold)
+		}
+	}
+}
+
+// describeWorkers returns the states of the busy workers, and the table ID
+// of the event if it's being mounted, otherwise the event is still queued
+// and 0 is returned.
+func (m *mounterImpl) describeWorkers(ev *model.PolymorphicEvent) (int64, []string) {
+	var tableID int64
+	workers := make([]string, 0, len(m.workers))
+	for i, w := range m.workers {
+		progress := w.getProgress()
+		if progress == nil {
+			continue
+		}
+		if progress.event == ev {
+			progress.mu.Lock()
+			tableID = progress.tableID
+			progress.mu.Unlock()
+		}
+		workers = append(workers, fmt.Sprintf("worker %d: %s", i, progress))
+	}
+	return tableID, workers
+}
+
+// AddEntry implements Mounter interface. The memory of the row changed event
+// is added to the memory tracker before it's queued, and released once it's
+// decoded, so the memory of the events waiting in the mounter is not missed.
+func (m *mounterImpl) AddEntry(ctx context.Context, ev *model.PolymorphicEvent) error {
+	var size int64
+	if ev.RawKV.OpType != model.OpTypeResolved {
+		size = ev.RawKV.ApproximateSize()
+	}
+	m.enqueue(size)
+	select {
+	case <-ctx.Done():
+		m.dequeue(size)
+		return errors.Trace(ctx.Err())
+	case m.rawRowChangedChs[rand.Intn(m.workerNum)] <- ev:
+		return nil
+	}
+}
+
+func (m *mounterImpl) enqueue(size int64) {
+	atomic.AddInt64(&m.queuedBytes, size)
+	if m.memTracker != nil && size != 0 {
+		m.memTracker.Add(size)
+	}
+}
+
+// dequeue releases the size of an event, which is decoded or not queued.
+func (m *mounterImpl) dequeue(size int64) {
+	atomic.AddInt64(&m.queuedBytes, -size)
+	if m.memTracker != nil && size != 0 {
+		m.memTracker.Add(-size)
+	}
 }
 
 func (m *mounterImpl) collectMetrics(ctx context.Context) {
 	captureAddr := util.CaptureAddrFromCtx(ctx)
 	changefeedID := util.ChangefeedIDFromCtx(ctx)
 	metricMounterInputChanSize := mounterInputChanSizeGauge.WithLabelValues(captureAddr, changefeedID)
+	metricMounterQueuedBytes := mounterQueuedBytesGauge.WithLabelValues(captureAddr, changefeedID)
 
 	for {
 		select {
@@ -221,6 +599,56 @@ func (m *mounterImpl) collectMetrics(ctx context.Context) {
 				chSize += len(ch)
 			}
 			metricMounterInputChanSize.Set(float64(chSize))
+			metricMounterQueuedBytes.Set(float64(atomic.LoadInt64(&m.queuedBytes)))
+		}
+	}
+}
+
+// getSnapshot returns the schema snapshot of ts. If the schema storage is not
+// resolved to ts yet, usually because the DDL puller lags behind, it waits
+// until the schema storage catches up or schemaWaitTimeout is reached.
+func (m *mounterImpl) getSnapshot(ctx context.Context, ts uint64, tableID int64) (*schemaSnapshot, error) {
+	snap, err := m.schemaStorage.getTableSnapshot(tableID, ts)
+	if cerror.ErrSchemaStorageUnresolved.NotEqual(err) {
+		return snap, err
+	}
+
+	captureAddr := util.CaptureAddrFromCtx(ctx)
+	changefeedID := util.ChangefeedIDFromCtx(ctx)
+	metricWaitingWorkers := schemaWaitingWorkersGauge.WithLabelValues(captureAddr, changefeedID)
+	metricWaitingWorkers.Inc()
+	defer metricWaitingWorkers.Dec()
+	progress := progressFromCtx(ctx)
+	progress.setStatus(mountWaitingSchema)
+	defer progress.setStatus(mountDecoding)
+	startTime := time.Now()
+	defer func() {
+		schemaWaitDuration.WithLabelValues(captureAddr, changefeedID).Observe(time.Since(startTime).Seconds())
+	}()
+
+	ticker := time.NewTicker(schemaWaitCheckInterval)
+	defer ticker.Stop()
+	nextWarnTime := startTime.Add(m.schemaWaitWarnThreshold)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.Trace(ctx.Err())
+		case <-ticker.C:
+		}
+		snap, err = m.schemaStorage.getTableSnapshot(tableID, ts)
+		if cerror.ErrSchemaStorageUnresolved.NotEqual(err) {
+			return snap, err
+		}
+		now := time.Now()
+		resolvedTs := m.schemaStorage.ResolvedTs()
+		if m.schemaWaitTimeout > 0 && now.Sub(startTime) >= m.schemaWaitTimeout {
+			return nil, cerror.ErrSchemaStorageWaitTimeout.GenWithStackByArgs(ts, m.schemaWaitTimeout, resolvedTs)
+		}
+		if now.After(nextWarnTime) {
+			log.Warn("mounter is waiting for the schema storage too long, the DDL puller may lag behind",
+				append(util.ZapFieldsFromCtx(ctx), zap.Int64("table-id", tableID), zap.Uint64("ts", ts),
+					zap.Uint64("resolvedTs", resolvedTs), zap.Duration("duration", now.Sub(startTime)))...)
+			nextWarnTime = now.Add(m.schemaWaitWarnThreshold)
 		}
 	}
 }
@@ -231,31 +659,41 @@ func (m *mounterImpl) unmarshalAndMountRowChanged(ctx context.Context, raw *mode
 	}
 	key, physicalTableID, err := decodeTableID(raw.Key)
 	if err != nil {
-		return nil, err
+		return nil, cerror.ErrMounterMalformedRow.Wrap(err).GenWithStackByArgs(0, raw.CRTs, err)
 	}
+	progressFromCtx(ctx).setTableID(physicalTableID)
 	baseInfo := baseKVEntry{
 		StartTs:         raw.StartTs,
 		CRTs:            raw.CRTs,
 		PhysicalTableID: physicalTableID,
 		Delete:          raw.OpType == model.OpTypeDelete,
 	}
-	snap, err := m.schemaStorage.GetSnapshot(ctx, raw.CRTs)
+	snap, err := m.getSnapshot(ctx, raw.CRTs, physicalTableID)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, errors.Annotatef(err, "table %d", physicalTableID)
 	}
+	failpoint.Inject("MounterDecodeStuck", func() {
+		<-ctx.Done()
+		failpoint.Return(nil, errors.Trace(ctx.Err()))
+	})
 	row, err := func() (*model.RowChangedEvent, error) {
 		if snap.IsIneligibleTableID(physicalTableID) {
-			log.Debug("skip the DML of ineligible table", zap.Uint64("ts", raw.CRTs), zap.Int64("tableID", physicalTableID))
+			log.Debug("skip the DML of ineligible table",
+				append(util.ZapFieldsFromCtx(ctx), zap.Int64("table-id", physicalTableID), zap.Uint64("ts", raw.CRTs))...)
 			return nil, nil
 		}
 		tableInfo, exist := snap.PhysicalTableByID(physicalTableID)
 		if !exist {
 			if snap.IsTruncateTableID(physicalTableID) {
-				log.Debug("skip the DML of truncated table", zap.Uint64("ts", raw.CRTs), zap.Int64("tableID", physicalTableID))
+				log.Debug("skip the DML of truncated table",
+					append(util.ZapFieldsFromCtx(ctx), zap.Int64("table-id", physicalTableID), zap.Uint64("ts", raw.CRTs))...)
 				return nil, nil
 			}
 			return nil, cerror.ErrSnapshotTableNotFound.GenWithStackByArgs(physicalTableID)
 		}
+		failpoint.Inject("MounterDecodeMalformed", func() {
+			failpoint.Return(nil, errors.New("injected malformed row"))
+		})
 		switch {
 		case bytes.HasPrefix(key, recordPrefix):
 			rowKV, err := m.unmarshalRowKVEntry(tableInfo, raw.Key, raw.Value, raw.OldValue, baseInfo)
@@ -279,10 +717,26 @@ func (m *mounterImpl) unmarshalAndMountRowChanged(ctx context.Context, raw *mode
 		return nil, nil
 	}()
 	if err != nil {
-		log.Error("failed to mount and unmarshals entry, start to print debug info", zap.Error(err))
+		log.Error("failed to mount and unmarshals entry, start to print debug info",
+			append(util.ZapFieldsFromCtx(ctx), zap.Int64("table-id", physicalTableID), zap.Error(err))...)
 		snap.PrintStatus(log.Error)
+		if cerror.ErrSnapshotTableNotFound.Equal(err) {
+			return nil, errors.Annotatef(err, "table %d", physicalTableID)
+		}
+		// the other errors are raised by decoding the raw kv
+		return nil, cerror.ErrMounterMalformedRow.Wrap(err).GenWithStackByArgs(physicalTableID, raw.CRTs, err)
 	}
-	return row, err
+	return row, nil
+}
+
+// isMalformedRow returns whether the err is raised by decoding a malformed
+// row. ErrMounterMalformedRow wraps the decoding error as its cause, so it
+// can't be checked by Equal, which compares the cause.
+func isMalformedRow(err error) bool {
+	return errors.Find(err, func(err error) bool {
+		rfcErr, ok := err.(*errors.Error)
+		return ok && rfcErr.ID() == cerror.ErrMounterMalformedRow.ID()
+	}) != nil
 }
 
 func (m *mounterImpl) unmarshalRowKVEntry(tableInfo *model.TableInfo, rawKey []byte, rawValue []byte, rawOldValue []byte, base baseKVEntry) (*rowKVEntry, error) {
@@ -321,11 +775,12 @@ func (m *mounterImpl) unmarshalRowKVEntry(tableInfo *model.TableInfo, rawKey []b
 
 	base.RecordID = recordID
 	return &rowKVEntry{
-		baseKVEntry: base,
-		Row:         row,
-		PreRow:      preRow,
-		RowExist:    rowExist,
-		PreRowExist: preRowExist,
+		baseKVEntry:   base,
+		Row:           row,
+		PreRow:        preRow,
+		RowExist:      rowExist,
+		PreRowExist:   preRowExist,
+		PreRowFromKey: base.Delete && !m.enableOldValue,
 	}, nil
 }
 
@@ -343,7 +798,6 @@ func (m *mounterImpl) unmarshalIndexKVEntry(restKey []byte, rawValue []byte, raw
 		return nil, errors.Trace(err)
 	}
 	var handle kv.Handle
-
 	if len(rawValue) == 8 {
 		// primary key or unique index
 		var recordID int64
@@ -414,6 +868,7 @@ func datum2Column(tableInfo *model.TableInfo, datums map[int64]types.Datum, fill
 		colName := colInfo.Name.O
 		colDatums, exist := datums[colInfo.ID]
 		var colValue interface{}
+		var charset string
 		if exist {
 			var err error
 			var warn string
@@ -424,28 +879,59 @@ func datum2Column(tableInfo *model.TableInfo, datums map[int64]types.Datum, fill
 			if warn != "" {
 				log.Warn(warn, zap.String("table", tableInfo.TableName.String()), zap.String("column", colInfo.Name.String()))
 			}
+			colValue, charset, warn = decodeCharset(colInfo, colValue)
+			if warn != "" {
+				log.Warn(warn, zap.String("table", tableInfo.TableName.String()), zap.String("column", colInfo.Name.String()))
+			}
 		} else if fillWithDefaultValue {
 			colValue = getDefaultOrZeroValue(colInfo)
 		} else {
 			continue
 		}
 		cols[tableInfo.RowColumnsOffset[colInfo.ID]] = &model.Column{
-			Name:  colName,
-			Type:  colInfo.Tp,
-			Value: colValue,
-			Flag:  tableInfo.ColumnsFlag[colInfo.ID],
+			Name:    colName,
+			Type:    colInfo.Tp,
+			Value:   colValue,
+			Flag:    tableInfo.ColumnsFlag[colInfo.ID],
+			Charset: charset,
 		}
 	}
 	return cols, nil
 }
 
+// appendTiDBRowIDColumn appends the hidden _tidb_rowid column to non-empty cols
+func appendTiDBRowIDColumn(cols []*model.Column, rowID int64) []*model.Column {
+	if len(cols) == 0 {
+		return cols
+	}
+	return append(cols, &model.Column{
+		Name:  timodel.ExtraHandleName.O,
+		Type:  mysql.TypeLonglong,
+		Value: rowID,
+		Flag:  model.TiDBRowIDFlag,
+	})
+}
+
+// setRecoveredFromKey marks the pre-columns of a deleted row as recovered
+// from its key, so that they are not taken as the full pre-image
+func setRecoveredFromKey(preCols []*model.Column) {
+	for _, col := range preCols {
+		if col != nil {
+			col.Flag.SetIsRecoveredFromKey()
+		}
+	}
+}
+
 func (m *mounterImpl) mountRowKVEntry(tableInfo *model.TableInfo, row *rowKVEntry, dataSize int64) (*model.RowChangedEvent, error) {
 	// if m.enableOldValue == true, go into this function
 	// if m.enableNewValue == false and row.Delete == false, go into this function
 	// if m.enableNewValue == false and row.Delete == true and use explict row id, go into this function
-	// only if m.enableNewValue == false and row.Delete == true and use implicit row id(_tidb_rowid), skip this function
+	// if m.enableNewValue == false and row.Delete == true and use implicit row id(_tidb_rowid),
+	// skip this function unless the table has no handle index, whose deletes are output by
+	// the deletes of the handle index kvs, see mountIndexKVEntry
 	useImplicitTiDBRowID := !tableInfo.PKIsHandle && !tableInfo.IsCommonHandle
-	if !m.enableOldValue && row.Delete && useImplicitTiDBRowID {
+	ineligible := tableInfo.HandleIndexID == model.HandleIndexTableIneligible
+	if !m.enableOldValue && row.Delete && useImplicitTiDBRowID && !ineligible {
 		return nil, nil
 	}
 
@@ -459,6 +945,9 @@ func (m *mounterImpl) mountRowKVEntry(tableInfo *model.TableInfo, row *rowKVEntr
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
+		if row.PreRowFromKey {
+			setRecoveredFromKey(preCols)
+		}
 	}
 
 	var cols []*model.Column
@@ -474,6 +963,18 @@ func (m *mounterImpl) mountRowKVEntry(tableInfo *model.TableInfo, row *rowKVEntr
 	var intRowID int64
 	if row.RecordID.IsInt() {
 		intRowID = row.RecordID.IntValue()
+		// the table has neither primary key nor not null unique key, attach the
+		// _tidb_rowid as a hidden column so that the sinks can identify the row
+		if useImplicitTiDBRowID && ineligible {
+			if row.PreRowFromKey {
+				// only the _tidb_rowid can be recovered from the key
+				preCols = appendTiDBRowIDColumn(make([]*model.Column, len(tableInfo.RowColumnsOffset)), intRowID)
+				setRecoveredFromKey(preCols)
+			} else {
+				preCols = appendTiDBRowIDColumn(preCols, intRowID)
+			}
+			cols = appendTiDBRowIDColumn(cols, intRowID)
+		}
 	}
 	return &model.RowChangedEvent{
 		StartTs:          row.StartTs,
@@ -528,17 +1029,25 @@ func (m *mounterImpl) mountIndexKVEntry(tableInfo *model.TableInfo, idx *indexKV
 		if warn != "" {
 			log.Warn(warn, zap.String("table", tableInfo.TableName.String()), zap.String("column", colInfo.Name.String()))
 		}
+		value, charset, warn := decodeCharset(colInfo, value)
+		if warn != "" {
+			log.Warn(warn, zap.String("table", tableInfo.TableName.String()), zap.String("column", colInfo.Name.String()))
+		}
 		preCols[tableInfo.RowColumnsOffset[colInfo.ID]] = &model.Column{
-			Name:  colInfo.Name.O,
-			Type:  colInfo.Tp,
-			Value: value,
-			Flag:  tableInfo.ColumnsFlag[colInfo.ID],
+			Name:    colInfo.Name.O,
+			Type:    colInfo.Tp,
+			Value:   value,
+			Flag:    tableInfo.ColumnsFlag[colInfo.ID],
+			Charset: charset,
 		}
 	}
 	var intRowID int64
 	if idx.RecordID != nil && idx.RecordID.IsInt() {
 		intRowID = idx.RecordID.IntValue()
 	}
+	// the _tidb_rowid can't be recovered, because the value of the deleted
+	// index kv is not available without old value
+	setRecoveredFromKey(preCols)
 	return &model.RowChangedEvent{
 		StartTs:  idx.StartTs,
 		CommitTs: idx.CRTs,
@@ -15,21 +15,32 @@ package entry
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	ticonfig "github.com/pingcap/tidb/config"
 	tidbkv "github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/session"
 	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/types"
 	"github.com/pingcap/tidb/util/testkit"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type mountTxnsSuite struct{}
@@ -257,7 +268,7 @@ func testMounterDisableOldValue(c *check.C, tc struct {
 	ver, err := store.CurrentVersion()
 	c.Assert(err, check.IsNil)
 	scheamStorage.AdvanceResolvedTs(ver.Ver)
-	mounter := NewMounter(scheamStorage, 1, false).(*mounterImpl)
+	mounter := NewMounter(scheamStorage, &config.MounterConfig{WorkerNum: 1}, false, nil, "").(*mounterImpl)
 	mounter.tz = time.Local
 	ctx := context.Background()
 
@@ -323,6 +334,593 @@ func testMounterDisableOldValue(c *check.C, tc struct {
 	c.Assert(rows, check.Equals, len(tc.values))
 }
 
+func (s *mountTxnsSuite) TestMounterColumnOrderAfterAddColumn(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table column_order(id int primary key, a int, c int)")
+	tk.MustExec("insert into column_order values (1, 1, 1)")
+	verBeforeDDL, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	tk.MustExec("alter table column_order add column b int default 2 after a")
+	tk.MustExec("insert into column_order(id, a, b, c) values (2, 1, 2, 3)")
+	verAfterDDL, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	scheamStorage, err := NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		err := scheamStorage.HandleDDLJob(job)
+		c.Assert(err, check.IsNil)
+	}
+	scheamStorage.AdvanceResolvedTs(verAfterDDL.Ver)
+	tableInfo, ok := scheamStorage.GetLastSnapshot().GetTableByName("test", "column_order")
+	c.Assert(ok, check.IsTrue)
+
+	mounter := NewMounter(scheamStorage, &config.MounterConfig{WorkerNum: 1}, false, nil, "").(*mounterImpl)
+	mounter.tz = time.Local
+	ctx := context.Background()
+
+	columnNames := func(cols []*model.Column) []string {
+		names := make([]string, 0, len(cols))
+		for _, col := range cols {
+			if col != nil {
+				names = append(names, col.Name)
+			}
+		}
+		return names
+	}
+	var rows int
+	walkTableSpanInStore(c, store, tableInfo.ID, func(key []byte, value []byte) {
+		// mount the first row before the DDL and the second row after the DDL
+		ts := verBeforeDDL.Ver
+		expected := []string{"id", "a", "c"}
+		if rows > 0 {
+			ts = verAfterDDL.Ver
+			expected = []string{"id", "a", "b", "c"}
+		}
+		row, err := mounter.unmarshalAndMountRowChanged(ctx, &model.RawKVEntry{
+			OpType:  model.OpTypePut,
+			Key:     key,
+			Value:   value,
+			StartTs: ts - 1,
+			CRTs:    ts,
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(row, check.NotNil)
+		c.Assert(columnNames(row.Columns), check.DeepEquals, expected)
+		rows++
+	})
+	c.Assert(rows, check.Equals, 2)
+}
+
+// gcedStorage fails to read the snapshots before gcTs as TiKV does after GC
+type gcedStorage struct {
+	tidbkv.Storage
+	gcTs uint64
+}
+
+func (s *gcedStorage) GetSnapshot(ver tidbkv.Version) tidbkv.Snapshot {
+	snap := s.Storage.GetSnapshot(ver)
+	if ver.Ver < s.gcTs {
+		return &gcedSnapshot{Snapshot: snap}
+	}
+	return snap
+}
+
+type gcedSnapshot struct {
+	tidbkv.Snapshot
+}
+
+func (s *gcedSnapshot) Get(ctx context.Context, k tidbkv.Key) ([]byte, error) {
+	return nil, errors.New("GC life time is shorter than transaction duration")
+}
+
+func (s *gcedSnapshot) Iter(k tidbkv.Key, upperBound tidbkv.Key) (tidbkv.Iterator, error) {
+	return nil, errors.New("GC life time is shorter than transaction duration")
+}
+
+func (s *mountTxnsSuite) TestMounterTableHistory(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table late_added(id int primary key, a int, c int)")
+	tk.MustExec("create table other(id int primary key, a int)")
+	tk.MustExec("insert into late_added values (1, 1, 1)")
+	startVer, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	tk.MustExec("alter table late_added add column b int default 2 after a")
+	tk.MustExec("insert into late_added(id, a, b, c) values (2, 1, 2, 3)")
+	midVer, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	tk.MustExec("alter table late_added drop column c")
+	tk.MustExec("alter table other add column b int")
+	tk.MustExec("insert into late_added(id, a, b) values (3, 1, 2)")
+	checkpointVer, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	// the DDL puller starts from the checkpoint, after the schema changes
+	meta, err := kv.GetSnapshotMeta(store, checkpointVer.Ver)
+	c.Assert(err, check.IsNil)
+	schemaStorage, err := NewSchemaStorage(meta, checkpointVer.Ver, nil, false)
+	c.Assert(err, check.IsNil)
+	schemaStorage.AdvanceResolvedTs(checkpointVer.Ver)
+	tableInfo, ok := schemaStorage.GetLastSnapshot().GetTableByName("test", "late_added")
+	c.Assert(ok, check.IsTrue)
+	otherInfo, ok := schemaStorage.GetLastSnapshot().GetTableByName("test", "other")
+	c.Assert(ok, check.IsTrue)
+
+	mounter := NewMounter(schemaStorage, &config.MounterConfig{WorkerNum: 1}, false, nil, "").(*mounterImpl)
+	mounter.tz = time.Local
+	ctx := context.Background()
+
+	columnNames := func(cols []*model.Column) []string {
+		names := make([]string, 0, len(cols))
+		for _, col := range cols {
+			if col != nil {
+				names = append(names, col.Name)
+			}
+		}
+		return names
+	}
+	var rawKVs []*model.RawKVEntry
+	walkTableSpanInStore(c, store, tableInfo.ID, func(key []byte, value []byte) {
+		rawKVs = append(rawKVs, &model.RawKVEntry{
+			OpType: model.OpTypePut,
+			Key:    key,
+			Value:  value,
+		})
+	})
+	c.Assert(rawKVs, check.HasLen, 3)
+	// each row is mounted at the ts it's written
+	for i, ts := range []uint64{startVer.Ver, midVer.Ver, checkpointVer.Ver} {
+		rawKVs[i].StartTs = ts - 1
+		rawKVs[i].CRTs = ts
+	}
+
+	// the rows before the first snapshot can't be mounted
+	_, err = mounter.unmarshalAndMountRowChanged(ctx, rawKVs[0])
+	c.Assert(cerror.ErrSchemaSnapshotNotFound.Equal(err), check.IsTrue)
+
+	// the GCed history fails with a precise error
+	err = schemaStorage.ExtendTableHistory(&gcedStorage{Storage: store, gcTs: midVer.Ver}, tableInfo.ID, startVer.Ver)
+	c.Assert(err, check.ErrorMatches, ".*ErrSchemaHistoryNotFound.*the start ts may be earlier than the GC safepoint.*")
+	c.Assert(errors.Cause(err), check.ErrorMatches, ".*GC life time is shorter than transaction duration.*")
+
+	err = schemaStorage.ExtendTableHistory(store, tableInfo.ID, startVer.Ver)
+	c.Assert(err, check.IsNil)
+	expected := [][]string{{"id", "a", "c"}, {"id", "a", "b", "c"}, {"id", "a", "b"}}
+	for i, rawKV := range rawKVs {
+		row, err := mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+		c.Assert(err, check.IsNil)
+		c.Assert(row, check.NotNil)
+		c.Assert(columnNames(row.Columns), check.DeepEquals, expected[i])
+	}
+
+	// the history only serves the table it's loaded for
+	_, err = schemaStorage.getTableSnapshot(otherInfo.ID, startVer.Ver)
+	c.Assert(cerror.ErrSchemaSnapshotNotFound.Equal(err), check.IsTrue)
+	// the start ts after the first snapshot needs no history
+	err = schemaStorage.ExtendTableHistory(&gcedStorage{Storage: store, gcTs: checkpointVer.Ver}, otherInfo.ID, checkpointVer.Ver)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *mountTxnsSuite) TestMounterTiDBRowID(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table no_handle(a int, b int unique key)")
+	tk.MustExec("create table with_handle(a int, b int not null unique key)")
+	// duplicate rows can only be told apart by _tidb_rowid
+	tk.MustExec("insert into no_handle values (1, null), (1, null)")
+	tk.MustExec("insert into with_handle values (1, 1), (1, 2)")
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	// tables without handle key are only replicated with force-replicate
+	scheamStorage, err := NewSchemaStorage(nil, 0, nil, true)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		err := scheamStorage.HandleDDLJob(job)
+		c.Assert(err, check.IsNil)
+	}
+	scheamStorage.AdvanceResolvedTs(ver.Ver)
+	mounter := NewMounter(scheamStorage, &config.MounterConfig{WorkerNum: 1}, true, nil, "").(*mounterImpl)
+	mounter.tz = time.Local
+	ctx := context.Background()
+
+	mountRows := func(tableName string, opType model.OpType) []*model.RowChangedEvent {
+		tableInfo, ok := scheamStorage.GetLastSnapshot().GetTableByName("test", tableName)
+		c.Assert(ok, check.IsTrue)
+		var rows []*model.RowChangedEvent
+		walkTableSpanInStore(c, store, tableInfo.ID, func(key []byte, value []byte) {
+			rawKV := &model.RawKVEntry{OpType: opType, Key: key, Value: value, StartTs: ver.Ver - 1, CRTs: ver.Ver}
+			if opType == model.OpTypeDelete {
+				rawKV.Value = nil
+				rawKV.OldValue = value
+			}
+			row, err := mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+			c.Assert(err, check.IsNil)
+			// the index kvs are skipped
+			if row != nil {
+				rows = append(rows, row)
+			}
+		})
+		return rows
+	}
+
+	rowIDs := make(map[int64]struct{})
+	rows := mountRows("no_handle", model.OpTypePut)
+	c.Assert(rows, check.HasLen, 2)
+	for _, row := range rows {
+		c.Assert(row.Columns, check.HasLen, 3)
+		col := row.Columns[2]
+		c.Assert(col.Name, check.Equals, "_tidb_rowid")
+		c.Assert(col.Type, check.Equals, mysql.TypeLonglong)
+		c.Assert(col.Flag.IsTiDBRowID(), check.IsTrue)
+		c.Assert(col.Flag.IsHandleKey(), check.IsFalse)
+		c.Assert(col.Value, check.Equals, row.RowID)
+		rowIDs[row.RowID] = struct{}{}
+	}
+	c.Assert(rowIDs, check.HasLen, 2)
+	rows = mountRows("no_handle", model.OpTypeDelete)
+	c.Assert(rows, check.HasLen, 2)
+	for _, row := range rows {
+		c.Assert(row.Columns, check.HasLen, 0)
+		c.Assert(row.PreColumns, check.HasLen, 3)
+		c.Assert(row.PreColumns[2].Flag.IsTiDBRowID(), check.IsTrue)
+		c.Assert(row.PreColumns[2].Value, check.Equals, row.RowID)
+	}
+	// the table has a handle key, no hidden column attached
+	rows = mountRows("with_handle", model.OpTypePut)
+	c.Assert(rows, check.HasLen, 2)
+	for _, row := range rows {
+		c.Assert(row.Columns, check.HasLen, 2)
+	}
+}
+
+func (s *mountTxnsSuite) TestMounterDeleteRecoveredFromKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("set @@tidb_enable_clustered_index=1;")
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table int_handle(id int primary key, a int, b int unique key)")
+	tk.MustExec("create table common_handle(id varchar(32), k int, v int, primary key(id, k))")
+	tk.MustExec("create table rowid(id int not null, v int, unique key uk(id))")
+	tk.MustExec("create table no_handle(a int, b int)")
+	tk.MustExec("insert into int_handle values (1, 2, 3)")
+	tk.MustExec("insert into common_handle values ('a', 1, 2)")
+	tk.MustExec("insert into rowid values (1, 2)")
+	tk.MustExec("insert into no_handle values (1, 2)")
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	// tables without handle key are only replicated with force-replicate
+	scheamStorage, err := NewSchemaStorage(nil, 0, nil, true)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		err := scheamStorage.HandleDDLJob(job)
+		c.Assert(err, check.IsNil)
+	}
+	scheamStorage.AdvanceResolvedTs(ver.Ver)
+	ctx := context.Background()
+
+	// mountDeletes returns the pre-columns of the deletes mounted, and checks
+	// they're flagged as recovered from key only if old value is disabled
+	mountDeletes := func(tableName string, enableOldValue bool) []string {
+		mounter := NewMounter(scheamStorage, &config.MounterConfig{WorkerNum: 1}, enableOldValue, nil, "").(*mounterImpl)
+		mounter.tz = time.Local
+		tableInfo, ok := scheamStorage.GetLastSnapshot().GetTableByName("test", tableName)
+		c.Assert(ok, check.IsTrue)
+		var rows []string
+		walkTableSpanInStore(c, store, tableInfo.ID, func(key []byte, value []byte) {
+			rawKV := &model.RawKVEntry{OpType: model.OpTypeDelete, Key: key, StartTs: ver.Ver - 1, CRTs: ver.Ver}
+			if enableOldValue {
+				rawKV.OldValue = value
+			}
+			row, err := mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+			c.Assert(err, check.IsNil)
+			if row == nil {
+				return
+			}
+			var pre []string
+			for _, col := range row.PreColumns {
+				if col == nil {
+					continue
+				}
+				c.Assert(col.Flag.IsRecoveredFromKey(), check.Equals, !enableOldValue, check.Commentf("%s", col.Name))
+				value := col.Value
+				if b, ok := value.([]byte); ok {
+					value = string(b)
+				}
+				pre = append(pre, fmt.Sprintf("%s=%v", col.Name, value))
+			}
+			rows = append(rows, strings.Join(pre, ","))
+		})
+		return rows
+	}
+
+	// all the handle columns are recovered from the key
+	c.Assert(mountDeletes("int_handle", false), check.DeepEquals, []string{"id=1"})
+	c.Assert(mountDeletes("common_handle", false), check.DeepEquals, []string{"id=a,k=1"})
+	// the columns of the handle index are recovered from the deleted index kv
+	c.Assert(mountDeletes("rowid", false), check.DeepEquals, []string{"id=1"})
+	// only the _tidb_rowid is recovered if the table has no handle index
+	rows := mountDeletes("no_handle", false)
+	c.Assert(rows, check.HasLen, 1)
+	c.Assert(rows[0], check.Matches, "_tidb_rowid=[0-9]+")
+
+	// the full pre-images are not flagged
+	c.Assert(mountDeletes("int_handle", true), check.DeepEquals, []string{"id=1,a=2,b=3"})
+	c.Assert(mountDeletes("common_handle", true), check.DeepEquals, []string{"id=a,k=1,v=2"})
+	c.Assert(mountDeletes("rowid", true), check.DeepEquals, []string{"id=1,v=2"})
+	rows = mountDeletes("no_handle", true)
+	c.Assert(rows, check.HasLen, 1)
+	c.Assert(rows[0], check.Matches, "a=1,b=2,_tidb_rowid=[0-9]+")
+}
+
+func (s *mountTxnsSuite) TestMounterWaitSchemaStorage(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table wait_schema(id int primary key)")
+	tk.MustExec("insert into wait_schema values (1)")
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	scheamStorage, err := NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		err := scheamStorage.HandleDDLJob(job)
+		c.Assert(err, check.IsNil)
+	}
+	// the DDL puller is held back, the schema storage isn't resolved to the
+	// commit ts of the row
+	c.Assert(scheamStorage.ResolvedTs(), check.Less, ver.Ver)
+	tableInfo, ok := scheamStorage.GetLastSnapshot().GetTableByName("test", "wait_schema")
+	c.Assert(ok, check.IsTrue)
+	var rawKV *model.RawKVEntry
+	walkTableSpanInStore(c, store, tableInfo.ID, func(key []byte, value []byte) {
+		rawKV = &model.RawKVEntry{OpType: model.OpTypePut, Key: key, Value: value, StartTs: ver.Ver - 1, CRTs: ver.Ver}
+	})
+	c.Assert(rawKV, check.NotNil)
+
+	mounter := NewMounter(scheamStorage, &config.MounterConfig{WorkerNum: 1}, false, nil, "").(*mounterImpl)
+	mounter.tz = time.Local
+	mounter.schemaWaitWarnThreshold = 50 * time.Millisecond
+	logs, restore := util.ObserveLogs(zapcore.WarnLevel)
+	defer restore()
+	ctx := util.PutChangefeedIDInCtx(context.Background(), "test-changefeed")
+
+	// the row is decoded once the schema storage catches up
+	type result struct {
+		row *model.RowChangedEvent
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		row, err := mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+		resultCh <- result{row: row, err: err}
+	}()
+	select {
+	case <-resultCh:
+		c.Fatal("the row is decoded before the schema storage is resolved")
+	case <-time.After(200 * time.Millisecond):
+	}
+	scheamStorage.AdvanceResolvedTs(ver.Ver)
+	select {
+	case res := <-resultCh:
+		c.Assert(res.err, check.IsNil)
+		c.Assert(res.row, check.NotNil)
+		c.Assert(res.row.Table.Table, check.Equals, "wait_schema")
+		c.Assert(res.row.Columns[0].Value, check.Equals, int64(1))
+	case <-time.After(5 * time.Second):
+		c.Fatal("the row is not decoded after the schema storage is resolved")
+	}
+	// the warnings are logged with the changefeed and the table
+	entries := logs.FilterMessage("mounter is waiting for the schema storage too long, the DDL puller may lag behind").All()
+	c.Assert(len(entries) > 0, check.IsTrue)
+	c.Assert(entries[0].ContextMap()["changefeed"], check.Equals, "test-changefeed")
+	c.Assert(entries[0].ContextMap()["table-id"], check.Equals, tableInfo.ID)
+
+	// the typed error is returned after the timeout
+	mounter.schemaWaitTimeout = 100 * time.Millisecond
+	rawKV.CRTs = ver.Ver + 1
+	_, err = mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+	c.Assert(cerror.ErrSchemaStorageWaitTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf("table %d: .*", tableInfo.ID))
+
+	// the waiting is canceled with the context
+	mounter.schemaWaitTimeout = 0
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = mounter.unmarshalAndMountRowChanged(ctx, rawKV)
+	c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+}
+
+// newStuckMounterTest creates a mounter with a worker and a row of the
+// table stuck_mount, the decoding of the rows is stuck by the failpoint
+func newStuckMounterTest(c *check.C) (*mounterImpl, func() *model.PolymorphicEvent, int64, func()) {
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+	tk.MustExec("create table stuck_mount(id int primary key)")
+	tk.MustExec("insert into stuck_mount values (1)")
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	schemaStorage, err := NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		c.Assert(schemaStorage.HandleDDLJob(job), check.IsNil)
+	}
+	schemaStorage.AdvanceResolvedTs(ver.Ver)
+	tableInfo, ok := schemaStorage.GetLastSnapshot().GetTableByName("test", "stuck_mount")
+	c.Assert(ok, check.IsTrue)
+	var key, value []byte
+	walkTableSpanInStore(c, store, tableInfo.ID, func(k []byte, v []byte) {
+		key, value = k, v
+	})
+	c.Assert(key, check.NotNil)
+	newEvent := func() *model.PolymorphicEvent {
+		ev := model.NewPolymorphicEvent(&model.RawKVEntry{
+			OpType: model.OpTypePut, Key: key, Value: value, StartTs: ver.Ver - 1, CRTs: ver.Ver,
+		})
+		ev.SetUpFinishedChan()
+		return ev
+	}
+
+	c.Assert(failpoint.Enable("github.com/pingcap/ticdc/cdc/entry/MounterDecodeStuck", "return(true)"), check.IsNil)
+	mounter := NewMounter(schemaStorage, &config.MounterConfig{WorkerNum: 1}, false, nil, "").(*mounterImpl)
+	return mounter, newEvent, tableInfo.ID, func() {
+		_ = failpoint.Disable("github.com/pingcap/ticdc/cdc/entry/MounterDecodeStuck")
+		domain.Close()
+		store.Close() //nolint:errcheck
+	}
+}
+
+func (s *mountTxnsSuite) TestMounterPrepareWatchdog(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mounter, newEvent, tableID, cleanup := newStuckMounterTest(c)
+	defer cleanup()
+	mounter.prepareWarnThreshold = 50 * time.Millisecond
+	mounter.prepareTimeout = 300 * time.Millisecond
+	logs, restore := util.ObserveLogs(zapcore.WarnLevel)
+	defer restore()
+
+	ctx, cancel := context.WithCancel(util.PutChangefeedIDInCtx(context.Background(), "test-changefeed"))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+
+	ev := newEvent()
+	c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+	err := mounter.WaitPrepare(ctx, ev)
+	c.Assert(cerror.ErrMounterPrepareTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+
+	// the warnings are logged with the event and the stuck worker
+	entries := logs.FilterMessage("waiting for the row to be mounted too long, the mounter workers may be stuck").All()
+	c.Assert(len(entries) > 0, check.IsTrue)
+	fields := entries[0].ContextMap()
+	c.Assert(fields["changefeed"], check.Equals, "test-changefeed")
+	c.Assert(fields["table-id"], check.Equals, tableID)
+	c.Assert(fields["commit-ts"], check.Equals, ev.CRTs)
+	c.Assert(fields["busy-workers"], check.HasLen, 1)
+	c.Assert(fields["busy-workers"].([]interface{})[0], check.Matches, fmt.Sprintf("worker 0: decoding table %d at ts .*", tableID))
+	c.Assert(logs.FilterMessage("the row is not mounted in time, the mounter workers may be stuck").Len(), check.Equals, 1)
+
+	// the waiting is canceled with the context
+	cancel()
+	c.Assert(errors.Cause(mounter.WaitPrepare(ctx, ev)), check.Equals, context.Canceled)
+	c.Assert(errors.Cause(<-errCh), check.Equals, context.Canceled)
+}
+
+func (s *mountTxnsSuite) TestMounterDecodeTimeout(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mounter, newEvent, tableID, cleanup := newStuckMounterTest(c)
+	defer cleanup()
+	mounter.decodeTimeout = 100 * time.Millisecond
+
+	// the changefeed fails with the typed error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+	c.Assert(mounter.AddEntry(ctx, newEvent()), check.IsNil)
+	err := <-errCh
+	c.Assert(cerror.ErrMounterDecodeTimeout.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*decoding the row of table %d at commit ts .*", tableID))
+
+	// the row is skipped, and the following rows are mounted by the worker
+	mounter.skipMalformedRow = true
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+	ev := newEvent()
+	c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+	c.Assert(mounter.WaitPrepare(ctx, ev), check.IsNil)
+	c.Assert(ev.Row, check.IsNil)
+	c.Assert(ev.RawKV.Key, check.NotNil)
+
+	c.Assert(failpoint.Disable("github.com/pingcap/ticdc/cdc/entry/MounterDecodeStuck"), check.IsNil)
+	ev = newEvent()
+	c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+	c.Assert(mounter.WaitPrepare(ctx, ev), check.IsNil)
+	c.Assert(ev.Row, check.NotNil)
+	c.Assert(ev.Row.Table.Table, check.Equals, "stuck_mount")
+	cancel()
+	c.Assert(errors.Cause(<-errCh), check.Equals, context.Canceled)
+}
+
 func prepareInsertSQL(c *check.C, tableInfo *model.TableInfo, columnLens int) string {
 	var sb strings.Builder
 	_, err := sb.WriteString("INSERT INTO " + tableInfo.Name.O + "(")
@@ -394,3 +992,151 @@ func walkTableSpanInStore(c *check.C, store tidbkv.Storage, tableID int64, f fun
 		c.Assert(err, check.IsNil)
 	}
 }
+
+func (s *mountTxnsSuite) TestDecodeCharset(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// "中文" in gbk, and "中文𠀀" in gb18030
+	gbkValue := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	gb18030Value := []byte{0xd6, 0xd0, 0xce, 0xc4, 0x95, 0x32, 0x82, 0x36}
+	newCol := func(id int64, name string, tp byte, charset string) *timodel.ColumnInfo {
+		ft := types.NewFieldType(tp)
+		ft.Charset = charset
+		return &timodel.ColumnInfo{ID: id, Name: timodel.NewCIStr(name), Offset: int(id) - 1, FieldType: *ft, State: timodel.StatePublic}
+	}
+	tableInfo := model.WrapTableInfo(1, "test", 1, &timodel.TableInfo{
+		ID:   2,
+		Name: timodel.NewCIStr("t"),
+		Columns: []*timodel.ColumnInfo{
+			newCol(1, "a", mysql.TypeVarchar, "gbk"),
+			newCol(2, "b", mysql.TypeBlob, "gb18030"),
+			newCol(3, "c", mysql.TypeVarchar, "binary"),
+			newCol(4, "d", mysql.TypeVarchar, "utf8mb4"),
+			newCol(5, "e", mysql.TypeVarchar, "gbk"),
+		},
+	})
+	cols, err := datum2Column(tableInfo, map[int64]types.Datum{
+		1: types.NewBytesDatum(gbkValue),
+		2: types.NewBytesDatum(gb18030Value),
+		3: types.NewBytesDatum(gbkValue),
+		4: types.NewBytesDatum([]byte("中文")),
+		// 0xd6 is an incomplete character in gbk
+		5: types.NewBytesDatum([]byte{0xd6}),
+	}, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(cols, check.HasLen, 5)
+	c.Assert(cols[0].Value, check.DeepEquals, []byte("中文"))
+	c.Assert(cols[0].Charset, check.Equals, "gbk")
+	c.Assert(cols[1].Value, check.DeepEquals, []byte("中文𠀀"))
+	c.Assert(cols[1].Charset, check.Equals, "gb18030")
+	// the binary and utf8 values are kept as they are
+	c.Assert(cols[2].Value, check.DeepEquals, gbkValue)
+	c.Assert(cols[2].Charset, check.Equals, "")
+	c.Assert(cols[3].Value, check.DeepEquals, []byte("中文"))
+	c.Assert(cols[3].Charset, check.Equals, "")
+	// the invalid bytes are replicated byte-exactly
+	c.Assert(cols[4].Value, check.DeepEquals, []byte{0xd6})
+	c.Assert(cols[4].Charset, check.Equals, "")
+}
+
+func (s *mountTxnsSuite) TestMounterQueuedMemory(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mounter, newEvent, _, cleanup := newStuckMounterTest(c)
+	defer cleanup()
+	c.Assert(failpoint.Disable("github.com/pingcap/ticdc/cdc/entry/MounterDecodeStuck"), check.IsNil)
+	limitter := puller.NewBlurResourceLimmter(1024 * 1024)
+	mounter.memTracker = limitter
+	mounter.rawRowChangedChs[0] = make(chan *model.PolymorphicEvent, 2)
+
+	// the workers are not running, so the events are queued in the mounter
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := []*model.PolymorphicEvent{newEvent(), newEvent()}
+	var queued int64
+	for _, ev := range events {
+		c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+		queued += ev.RawKV.ApproximateSize()
+	}
+	c.Assert(queued > 0, check.IsTrue)
+	c.Assert(limitter.Used(), check.Equals, queued)
+	c.Assert(mounter.queuedBytes, check.Equals, queued)
+
+	// the input is full, the event not queued is not charged
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	err := mounter.AddEntry(timeoutCtx, newEvent())
+	timeoutCancel()
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
+	c.Assert(limitter.Used(), check.Equals, queued)
+
+	// the memory is released once the events are decoded
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+	for _, ev := range events {
+		c.Assert(mounter.WaitPrepare(ctx, ev), check.IsNil)
+		c.Assert(ev.Row, check.NotNil)
+	}
+	c.Assert(limitter.Used(), check.Equals, int64(0))
+	c.Assert(mounter.queuedBytes, check.Equals, int64(0))
+	cancel()
+	c.Assert(errors.Cause(<-errCh), check.Equals, context.Canceled)
+}
+
+func (s *mountTxnsSuite) TestMounterSkipMalformedRow(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mounter, newEvent, tableID, cleanup := newStuckMounterTest(c)
+	defer cleanup()
+	c.Assert(failpoint.Disable("github.com/pingcap/ticdc/cdc/entry/MounterDecodeStuck"), check.IsNil)
+	mounter.quarantineDir = c.MkDir()
+	newMalformedEvent := func() *model.PolymorphicEvent {
+		ev := newEvent()
+		ev.RawKV.Value = []byte{0xff, 0x01, 0x02}
+		return ev
+	}
+
+	// the changefeed fails with the typed error by default
+	ctx, cancel := context.WithCancel(util.PutChangefeedIDInCtx(context.Background(), "test-changefeed"))
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+	c.Assert(mounter.AddEntry(ctx, newMalformedEvent()), check.IsNil)
+	err := <-errCh
+	c.Assert(isMalformedRow(err), check.IsTrue, check.Commentf("%v", err))
+	// the decoding error is kept as the cause
+	cause := errors.Cause(err)
+	c.Assert(cause, check.Not(check.ErrorMatches), ".*malformed row of table.*")
+	c.Assert(strings.Contains(err.Error(), cause.Error()), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*malformed row of table %d at commit ts .*", tableID))
+	entries, err := ReadQuarantine(mounter.quarantineDir, "test-changefeed")
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 0)
+
+	// the row is quarantined and skipped, and the following rows are mounted
+	mounter.skipMalformedRow = true
+	go func() {
+		errCh <- mounter.Run(ctx)
+	}()
+	malformed := newMalformedEvent()
+	c.Assert(mounter.AddEntry(ctx, malformed), check.IsNil)
+	c.Assert(mounter.WaitPrepare(ctx, malformed), check.IsNil)
+	c.Assert(malformed.Row, check.IsNil)
+	ev := newEvent()
+	c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+	c.Assert(mounter.WaitPrepare(ctx, ev), check.IsNil)
+	c.Assert(ev.Row, check.NotNil)
+	c.Assert(ev.Row.Table.Table, check.Equals, "stuck_mount")
+
+	entries, err = ReadQuarantine(mounter.quarantineDir, "test-changefeed")
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].ChangefeedID, check.Equals, "test-changefeed")
+	c.Assert(entries[0].TableID, check.Equals, tableID)
+	c.Assert(entries[0].CRTs, check.Equals, malformed.CRTs)
+	c.Assert(entries[0].Key, check.NotNil)
+	c.Assert(entries[0].Value, check.DeepEquals, []byte{0xff, 0x01, 0x02})
+	c.Assert(entries[0].Error, check.Matches, ".*malformed row.*")
+	cancel()
+	c.Assert(errors.Cause(<-errCh), check.Equals, context.Canceled)
+}
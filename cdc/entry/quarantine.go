@@ -0,0 +1,162 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+const (
+	// quarantineDirName is the dir in the sort dir which the malformed rows
+	// are quarantined in
+	quarantineDirName = "quarantine"
+	quarantineFileExt = ".quarantine"
+	// maxQuarantineFileBytes is the size of a quarantine file to be rotated,
+	// only one rotated file is kept, so a changefeed takes at most twice of
+	// it in the sort dir
+	maxQuarantineFileBytes = 32 * 1024 * 1024
+)
+
+// QuarantineDir returns the dir of the quarantine files in the sort dir
+func QuarantineDir(sortDir string) string {
+	return filepath.Join(sortDir, quarantineDirName)
+}
+
+// QuarantineEntry is a raw kv entry which fails to be decoded, it's recorded
+// in the quarantine file of the changefeed for offline analysis
+type QuarantineEntry struct {
+	Time         time.Time          `json:"time"`
+	ChangefeedID model.ChangeFeedID `json:"changefeed"`
+	TableID      model.TableID      `json:"table-id"`
+	OpType       model.OpType       `json:"op-type"`
+	Key          []byte             `json:"key"`
+	Value        []byte             `json:"value"`
+	OldValue     []byte             `json:"old-value"`
+	StartTs      uint64             `json:"start-ts"`
+	CRTs         uint64             `json:"crts"`
+	Error        string             `json:"error"`
+}
+
+// quarantine appends the malformed entries of a changefeed to its quarantine
+// file, the file is rotated once it exceeds maxBytes.
+type quarantine struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+func newQuarantine(dir string, changefeedID model.ChangeFeedID, maxBytes int64) *quarantine {
+	return &quarantine{
+		path:     filepath.Join(dir, changefeedID+quarantineFileExt),
+		maxBytes: maxBytes,
+	}
+}
+
+// write appends the entry to the quarantine file. The malformed rows are
+// rare, so the file is opened for each entry, and nothing is left open when
+// the mounter exits.
+func (q *quarantine) write(entry *QuarantineEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	data = append(data, '\n')
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	if info, err := os.Stat(q.path); err == nil && info.Size()+int64(len(data)) > q.maxBytes {
+		if err := os.Rename(q.path, q.path+".1"); err != nil {
+			return cerror.WrapError(cerror.ErrMounterQuarantine, err)
+		}
+	}
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close() //nolint:errcheck
+		return cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	return cerror.WrapError(cerror.ErrMounterQuarantine, f.Close())
+}
+
+// ReadQuarantine reads the quarantined entries of the changefeed in the dir,
+// or of all changefeeds if changefeedID is empty, the entries are sorted by
+// the time they're quarantined.
+func ReadQuarantine(dir string, changefeedID model.ChangeFeedID) ([]*QuarantineEntry, error) {
+	pattern := "*" + quarantineFileExt
+	if changefeedID != "" {
+		pattern = changefeedID + quarantineFileExt
+	}
+	current, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var entries []*QuarantineEntry
+	for _, path := range current {
+		// the rotated file is older than the current one
+		for _, p := range []string{path + ".1", path} {
+			fileEntries, err := readQuarantineFile(p)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, fileEntries...)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+func readQuarantineFile(path string) ([]*QuarantineEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	defer f.Close() //nolint:errcheck
+	var entries []*QuarantineEntry
+	scanner := bufio.NewScanner(f)
+	// an entry holds a raw kv, which may be much larger than a line of text
+	scanner.Buffer(nil, maxQuarantineFileBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := &QuarantineEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			return nil, cerror.ErrMounterQuarantine.GenWithStack("invalid entry in %s: %s", path, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, cerror.WrapError(cerror.ErrMounterQuarantine, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type quarantineSuite struct{}
+
+var _ = check.Suite(&quarantineSuite{})
+
+func (s *quarantineSuite) TestQuarantineRotate(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := filepath.Join(c.MkDir(), "quarantine")
+	now := time.Now()
+	newEntry := func(changefeedID string, ts uint64) *QuarantineEntry {
+		return &QuarantineEntry{
+			Time:         now.Add(time.Duration(ts) * time.Second),
+			ChangefeedID: changefeedID,
+			TableID:      1,
+			OpType:       model.OpTypePut,
+			Key:          []byte("key"),
+			Value:        make([]byte, 100),
+			CRTs:         ts,
+			Error:        "malformed",
+		}
+	}
+
+	// the dir is created with the first entry, and the file is rotated once
+	// it's full
+	q := newQuarantine(dir, "test-changefeed", 1024)
+	for ts := uint64(1); ts <= 10; ts++ {
+		c.Assert(q.write(newEntry("test-changefeed", ts)), check.IsNil)
+	}
+	info, err := os.Stat(filepath.Join(dir, "test-changefeed.quarantine"))
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Size() <= 1024, check.IsTrue)
+	info, err = os.Stat(filepath.Join(dir, "test-changefeed.quarantine.1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Size() <= 1024, check.IsTrue)
+
+	// the entries of the current and the rotated files are read in order
+	entries, err := ReadQuarantine(dir, "test-changefeed")
+	c.Assert(err, check.IsNil)
+	c.Assert(len(entries) > 0 && len(entries) < 10, check.IsTrue)
+	for i, entry := range entries {
+		c.Assert(entry.CRTs, check.Equals, uint64(10-len(entries)+i+1))
+		c.Assert(entry.Key, check.DeepEquals, []byte("key"))
+	}
+
+	// the entries of all changefeeds are read without the changefeed id
+	c.Assert(newQuarantine(dir, "other-changefeed", 1024).write(newEntry("other-changefeed", 20)), check.IsNil)
+	all, err := ReadQuarantine(dir, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, len(entries)+1)
+	c.Assert(all[len(all)-1].ChangefeedID, check.Equals, "other-changefeed")
+
+	// nothing is quarantined in the missing dir
+	entries, err = ReadQuarantine(filepath.Join(dir, "missing"), "")
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 0)
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSchemaGCBatchSize     = 64
+	defaultSchemaGCBatchInterval = 5 * time.Millisecond
+)
+
+// SchemaGCWorker removes the outdated snapshots of a SchemaStorage in the
+// background, so that the callers requesting GC are not blocked by it.
+type SchemaGCWorker struct {
+	storage *SchemaStorage
+	// floor returns the minimum commit ts of the events which are not mounted
+	// yet, the snapshots needed by these events must not be removed.
+	floor func() uint64
+
+	pendingTs uint64
+	notifyCh  chan struct{}
+
+	batchSize     int
+	batchInterval time.Duration
+}
+
+// NewSchemaGCWorker creates a SchemaGCWorker of the storage, floor can be nil
+// if there is no in-flight event to protect.
+func NewSchemaGCWorker(storage *SchemaStorage, floor func() uint64) *SchemaGCWorker {
+	return &SchemaGCWorker{
+		storage:       storage,
+		floor:         floor,
+		notifyCh:      make(chan struct{}, 1),
+		batchSize:     defaultSchemaGCBatchSize,
+		batchInterval: defaultSchemaGCBatchInterval,
+	}
+}
+
+// Request requests a GC with the specified ts. It never blocks, the requests
+// which are not handled yet are coalesced to the largest ts.
+func (w *SchemaGCWorker) Request(ts uint64) {
+	for {
+		pendingTs := atomic.LoadUint64(&w.pendingTs)
+		if ts <= pendingTs {
+			break
+		}
+		if atomic.CompareAndSwapUint64(&w.pendingTs, pendingTs, ts) {
+			break
+		}
+	}
+	select {
+	case w.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run handles the GC requests until the context is canceled
+func (w *SchemaGCWorker) Run(ctx context.Context) error {
+	captureAddr := util.CaptureAddrFromCtx(ctx)
+	changefeedID := util.ChangefeedIDFromCtx(ctx)
+	metricGCDuration := schemaGCDuration.WithLabelValues(captureAddr, changefeedID)
+	metricReclaimedSnaps := schemaGCReclaimedSnapsCounter.WithLabelValues(captureAddr, changefeedID)
+	metricGCTs := schemaGCTsGauge.WithLabelValues(captureAddr, changefeedID)
+	metricSnapshots := schemaSnapshotsGauge.WithLabelValues(captureAddr, changefeedID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-w.notifyCh:
+		}
+		ts := w.gcTs()
+		startTime := time.Now()
+		removed, err := w.gc(ctx, ts)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		metricGCTs.Set(float64(oracle.ExtractPhysical(ts)))
+		metricSnapshots.Set(float64(w.storage.snapshotCount()))
+		if removed == 0 {
+			continue
+		}
+		duration := time.Since(startTime)
+		metricGCDuration.Observe(duration.Seconds())
+		metricReclaimedSnaps.Add(float64(removed))
+		log.Info("finished gc in schema storage",
+			zap.String("changefeed", changefeedID), zap.Uint64("gcTs", atomic.LoadUint64(&w.storage.gcTs)),
+			zap.Int("reclaimed", removed), zap.Duration("duration", duration))
+	}
+}
+
+// gcTs returns the requested ts, which is capped by the floor
+func (w *SchemaGCWorker) gcTs() uint64 {
+	ts := atomic.LoadUint64(&w.pendingTs)
+	if w.floor != nil {
+		if floor := w.floor(); floor < ts {
+			log.Debug("schema storage gc is limited by the in-flight events",
+				zap.Uint64("requestedTs", ts), zap.Uint64("floor", floor))
+			ts = floor
+		}
+	}
+	return ts
+}
+
+// gc removes the snapshots before ts in batches, and yields between the
+// batches to let the readers of the storage go ahead.
+func (w *SchemaGCWorker) gc(ctx context.Context, ts uint64) (int, error) {
+	total := 0
+	for {
+		removed, more := w.storage.gcSnapshots(ts, w.batchSize)
+		total += removed
+		if !more {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, errors.Trace(ctx.Err())
+		case <-time.After(w.batchInterval):
+		}
+	}
+}
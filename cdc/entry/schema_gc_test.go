@@ -0,0 +1,157 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type schemaGCSuite struct{}
+
+var _ = check.Suite(&schemaGCSuite{})
+
+// newSyntheticSchemaStorage creates a schema storage with a snapshot for each
+// of the ts from 1 to snapCount, the snapshots contain tableCount tables.
+func newSyntheticSchemaStorage(snapCount int, tableCount int) *SchemaStorage {
+	snap := newEmptySchemaSnapshot(false)
+	db := &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}
+	if err := snap.createSchema(db); err != nil {
+		panic(err)
+	}
+	for i := 0; i < tableCount; i++ {
+		tblInfo := &timodel.TableInfo{
+			ID:         int64(i + 100),
+			Name:       timodel.NewCIStr(fmt.Sprintf("t%d", i)),
+			PKIsHandle: true,
+			Columns: []*timodel.ColumnInfo{
+				{ID: 1, Name: timodel.NewCIStr("id"), State: timodel.StatePublic},
+			},
+		}
+		tblInfo.Columns[0].Flag = mysql.PriKeyFlag
+		if err := snap.createTable(model.WrapTableInfo(db.ID, db.Name.O, 1, tblInfo)); err != nil {
+			panic(err)
+		}
+	}
+	snaps := make([]*schemaSnapshot, 0, snapCount)
+	for i := 1; i <= snapCount; i++ {
+		s := snap.Clone()
+		s.currentTs = uint64(i)
+		snaps = append(snaps, s)
+	}
+	return &SchemaStorage{snaps: snaps, resolvedTs: uint64(snapCount)}
+}
+
+func (s *schemaGCSuite) TestGCSnapshotsInBatches(c *check.C) {
+	defer testleak.AfterTest(c)()
+	storage := newSyntheticSchemaStorage(10, 1)
+
+	removed, more := storage.gcSnapshots(8, 3)
+	c.Assert(removed, check.Equals, 3)
+	c.Assert(more, check.IsTrue)
+	c.Assert(storage.gcTs, check.Equals, uint64(4))
+	removed, more = storage.gcSnapshots(8, 3)
+	c.Assert(removed, check.Equals, 3)
+	c.Assert(more, check.IsTrue)
+	removed, more = storage.gcSnapshots(8, 3)
+	c.Assert(removed, check.Equals, 1)
+	c.Assert(more, check.IsFalse)
+	c.Assert(storage.gcTs, check.Equals, uint64(8))
+	removed, more = storage.gcSnapshots(8, 3)
+	c.Assert(removed, check.Equals, 0)
+	c.Assert(more, check.IsFalse)
+
+	// the snapshot at gc ts is kept
+	snap, err := storage.getSnapshot(8)
+	c.Assert(err, check.IsNil)
+	c.Assert(snap.currentTs, check.Equals, uint64(8))
+	_, err = storage.getSnapshot(7)
+	c.Assert(cerror.ErrSchemaStorageGCed.Equal(err), check.IsTrue)
+}
+
+func (s *schemaGCSuite) TestGCWorker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	storage := newSyntheticSchemaStorage(100, 1)
+	floor := uint64(30)
+	worker := NewSchemaGCWorker(storage, func() uint64 {
+		return atomic.LoadUint64(&floor)
+	})
+	worker.batchSize = 7
+	worker.batchInterval = time.Millisecond
+
+	// the requests are coalesced to the largest ts
+	worker.Request(10)
+	worker.Request(50)
+	worker.Request(20)
+	c.Assert(worker.pendingTs, check.Equals, uint64(50))
+	c.Assert(len(worker.notifyCh), check.Equals, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- worker.Run(ctx)
+	}()
+	waitGCTs := func(ts uint64) {
+		for i := 0; i < 100; i++ {
+			if atomic.LoadUint64(&storage.gcTs) == ts {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Fatalf("gc ts %d is expected, got %d", ts, atomic.LoadUint64(&storage.gcTs))
+	}
+	// the gc is limited by the floor of the in-flight events
+	waitGCTs(30)
+	_, err := storage.getSnapshot(30)
+	c.Assert(err, check.IsNil)
+
+	atomic.StoreUint64(&floor, 80)
+	worker.Request(60)
+	waitGCTs(60)
+
+	cancel()
+	c.Assert(errors.Cause(<-done), check.Equals, context.Canceled)
+	// the snapshots from 60 to 100 are held
+	c.Assert(testutil.ToFloat64(schemaSnapshotsGauge.WithLabelValues("", "")), check.Equals, float64(41))
+}
+
+// BenchmarkSchemaGC benchmarks the gc of a long schema history
+func BenchmarkSchemaGC(b *testing.B) {
+	const snapCount = 2000
+	for i := 0; i < b.N; i++ {
+		// copying the snapshot pointers is cheap compared with the gc
+		storage := newSyntheticSchemaStorage(snapCount, 100)
+		worker := NewSchemaGCWorker(storage, nil)
+		worker.batchInterval = 0
+		removed, err := worker.gc(context.Background(), snapCount)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if removed != snapCount-1 {
+			b.Fatalf("%d snapshots are removed", removed)
+		}
+	}
+}
@@ -28,6 +28,7 @@ import (
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/filter"
 	"github.com/pingcap/ticdc/pkg/retry"
+	tidbkv "github.com/pingcap/tidb/kv"
 	timeta "github.com/pingcap/tidb/meta"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -63,15 +64,59 @@ func (s *SingleSchemaSnapshot) HandleDDL(job *timodel.Job) error {
 	return s.handleDDL(job)
 }
 
+// PhysicalTableSwap is a physical table replaced by a new one, e.g. by
+// truncating the table or its partitions, the rows written after the DDL are
+// only in the new physical table.
+type PhysicalTableSwap struct {
+	OldTableID model.TableID
+	NewTableID model.TableID
+}
+
+// TruncateTableSwaps returns the physical tables swapped by the truncate job,
+// preTable is the table info overwritten by the job, see PreTableInfo. The
+// partitions are paired by their names. Nil is returned for the other jobs.
+func TruncateTableSwaps(preTable *model.TableInfo, job *timodel.Job) []PhysicalTableSwap {
+	if preTable == nil || job.BinlogInfo == nil || job.BinlogInfo.TableInfo == nil {
+		return nil
+	}
+	newTable := job.BinlogInfo.TableInfo
+	switch job.Type {
+	case timodel.ActionTruncateTable:
+		if preTable.GetPartitionInfo() == nil && newTable.GetPartitionInfo() == nil {
+			return []PhysicalTableSwap{{OldTableID: job.TableID, NewTableID: newTable.ID}}
+		}
+	case timodel.ActionTruncateTablePartition:
+	default:
+		return nil
+	}
+	oldPi, newPi := preTable.GetPartitionInfo(), newTable.GetPartitionInfo()
+	if oldPi == nil || newPi == nil {
+		return nil
+	}
+	oldIDs := make(map[string]model.TableID, len(oldPi.Definitions))
+	for _, partition := range oldPi.Definitions {
+		oldIDs[partition.Name.L] = partition.ID
+	}
+	var swaps []PhysicalTableSwap
+	for _, partition := range newPi.Definitions {
+		oldID, ok := oldIDs[partition.Name.L]
+		if ok && oldID != partition.ID {
+			swaps = append(swaps, PhysicalTableSwap{OldTableID: oldID, NewTableID: partition.ID})
+		}
+	}
+	return swaps
+}
+
 // PreTableInfo returns the table info which will be overwritten by the specified job
 func (s *SingleSchemaSnapshot) PreTableInfo(job *timodel.Job) (*model.TableInfo, error) {
 	switch job.Type {
 	case timodel.ActionCreateSchema, timodel.ActionModifySchemaCharsetAndCollate, timodel.ActionDropSchema:
 		return nil, nil
-	case timodel.ActionCreateTable, timodel.ActionCreateView, timodel.ActionRecoverTable:
+	case timodel.ActionCreateTable, timodel.ActionCreateView, timodel.ActionCreateSequence, timodel.ActionRecoverTable:
 		// no pre table info
 		return nil, nil
-	case timodel.ActionRenameTable, timodel.ActionDropTable, timodel.ActionDropView, timodel.ActionTruncateTable:
+	case timodel.ActionRenameTable, timodel.ActionDropTable, timodel.ActionDropView, timodel.ActionDropSequence,
+		timodel.ActionTruncateTable:
 		// get the table will be dropped
 		table, ok := s.TableByID(job.TableID)
 		if !ok {
@@ -574,12 +619,12 @@ func (s *schemaSnapshot) handleDDL(job *timodel.Job) error {
 		if err != nil {
 			return errors.Trace(err)
 		}
-	case timodel.ActionCreateTable, timodel.ActionCreateView, timodel.ActionRecoverTable:
+	case timodel.ActionCreateTable, timodel.ActionCreateView, timodel.ActionCreateSequence, timodel.ActionRecoverTable:
 		err := s.createTable(getWrapTableInfo(job))
 		if err != nil {
 			return errors.Trace(err)
 		}
-	case timodel.ActionDropTable, timodel.ActionDropView:
+	case timodel.ActionDropTable, timodel.ActionDropView, timodel.ActionDropSequence:
 		err := s.dropTable(job.TableID)
 		if err != nil {
 			return errors.Trace(err)
@@ -640,6 +685,11 @@ type SchemaStorage struct {
 	snapsMu    sync.RWMutex
 	gcTs       uint64
 	resolvedTs uint64
+	// histories are the snapshots of the tables added with the start ts
+	// before the first snapshot, each of them is only valid for its table,
+	// since only the DDL jobs of the table are replayed. They're guarded by
+	// snapsMu too.
+	histories map[model.TableID][]*schemaSnapshot
 
 	filter         *filter.Filter
 	explicitTables bool
@@ -686,6 +736,98 @@ func (s *SchemaStorage) getSnapshot(ts uint64) (*schemaSnapshot, error) {
 	return s.snaps[i-1], nil
 }
 
+// getTableSnapshot is like getSnapshot, but the snapshot is taken from the
+// history of the table if ts is before the first snapshot.
+func (s *SchemaStorage) getTableSnapshot(tableID model.TableID, ts uint64) (*schemaSnapshot, error) {
+	s.snapsMu.RLock()
+	history := s.histories[tableID]
+	covered := len(history) > 0 && len(s.snaps) > 0 && ts < s.snaps[0].currentTs
+	s.snapsMu.RUnlock()
+	if !covered {
+		return s.getSnapshot(ts)
+	}
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].currentTs > ts
+	})
+	if i <= 0 {
+		return nil, cerror.ErrSchemaSnapshotNotFound.GenWithStackByArgs(ts)
+	}
+	return history[i-1], nil
+}
+
+// ExtendTableHistory loads the schema history of the table from startTs to
+// the first snapshot from the meta of TiKV, so that the events of the table
+// added with a start ts before the first snapshot are mounted with the table
+// infos at their commit ts. Only the DDL jobs of the table are replayed on
+// the snapshot at startTs, so the history is not used by the other tables.
+// ErrSchemaHistoryNotFound is returned if the meta at startTs is GCed.
+func (s *SchemaStorage) ExtendTableHistory(storage tidbkv.Storage, tableID model.TableID, startTs uint64) error {
+	s.snapsMu.RLock()
+	if len(s.snaps) == 0 {
+		// there is no snapshot before which the history is needed
+		s.snapsMu.RUnlock()
+		return nil
+	}
+	firstTs := s.snaps[0].currentTs
+	history := s.histories[tableID]
+	s.snapsMu.RUnlock()
+	if startTs >= firstTs || (len(history) > 0 && history[0].currentTs <= startTs) {
+		return nil
+	}
+	history, err := s.loadTableHistory(storage, tableID, startTs, firstTs)
+	if err != nil {
+		return cerror.ErrSchemaHistoryNotFound.Wrap(err).GenWithStackByArgs(tableID, startTs, firstTs)
+	}
+	s.snapsMu.Lock()
+	defer s.snapsMu.Unlock()
+	if s.histories == nil {
+		s.histories = make(map[model.TableID][]*schemaSnapshot)
+	}
+	s.histories[tableID] = history
+	log.Info("the schema history of the table is loaded", zap.Int64("tableID", tableID),
+		zap.Uint64("startTs", startTs), zap.Uint64("firstSnapshotTs", firstTs), zap.Int("snapshots", len(history)))
+	return nil
+}
+
+func (s *SchemaStorage) loadTableHistory(
+	storage tidbkv.Storage, tableID model.TableID, startTs uint64, firstTs uint64,
+) ([]*schemaSnapshot, error) {
+	snap, err := newSchemaSnapshotFromMeta(timeta.NewSnapshotMeta(storage.GetSnapshot(tidbkv.NewVersion(startTs))), startTs, s.explicitTables)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// the DDL jobs of a partition are the ones of its logical table
+	logicalTableID := tableID
+	if info, ok := snap.PhysicalTableByID(tableID); ok {
+		logicalTableID = info.ID
+	}
+	jobs, err := timeta.NewSnapshotMeta(storage.GetSnapshot(tidbkv.NewVersion(firstTs))).GetAllHistoryDDLJobs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var tableJobs []*timodel.Job
+	for _, job := range jobs {
+		if job.TableID != logicalTableID || job.BinlogInfo == nil || s.skipJob(job) {
+			continue
+		}
+		if job.BinlogInfo.FinishedTS > startTs && job.BinlogInfo.FinishedTS <= firstTs {
+			tableJobs = append(tableJobs, job)
+		}
+	}
+	sort.Slice(tableJobs, func(i, j int) bool {
+		return tableJobs[i].BinlogInfo.FinishedTS < tableJobs[j].BinlogInfo.FinishedTS
+	})
+	history := []*schemaSnapshot{snap}
+	for _, job := range tableJobs {
+		snap = snap.Clone()
+		if err := snap.handleDDL(job); err != nil {
+			return nil, errors.Trace(err)
+		}
+		history = append(history, snap)
+	}
+	return history, nil
+}
+
 // GetSnapshot returns the snapshot which of ts is specified
 func (s *SchemaStorage) GetSnapshot(ctx context.Context, ts uint64) (*schemaSnapshot, error) {
 	var snap *schemaSnapshot
@@ -753,6 +895,11 @@ func (s *SchemaStorage) HandleDDLJob(job *timodel.Job) error {
 	return nil
 }
 
+// ResolvedTs returns the resolved ts of the schema storage
+func (s *SchemaStorage) ResolvedTs() uint64 {
+	return atomic.LoadUint64(&s.resolvedTs)
+}
+
 // AdvanceResolvedTs advances the resolved
 func (s *SchemaStorage) AdvanceResolvedTs(ts uint64) {
 	var swapped bool
@@ -767,6 +914,16 @@ func (s *SchemaStorage) AdvanceResolvedTs(ts uint64) {
 
 // DoGC removes snaps which of ts less than this specified ts
 func (s *SchemaStorage) DoGC(ts uint64) {
+	if removed, _ := s.gcSnapshots(ts, 0); removed > 0 {
+		log.Info("finished gc in schema storage", zap.Uint64("gcTs", atomic.LoadUint64(&s.gcTs)))
+	}
+}
+
+// gcSnapshots removes at most limit snaps which of ts less than the specified
+// ts, the last snap before ts is kept to serve the events at ts. A limit of 0
+// means no limit. It returns the number of removed snaps and whether there
+// are more snaps to remove.
+func (s *SchemaStorage) gcSnapshots(ts uint64, limit int) (removed int, more bool) {
 	s.snapsMu.Lock()
 	defer s.snapsMu.Unlock()
 	var startIdx int
@@ -777,7 +934,11 @@ func (s *SchemaStorage) DoGC(ts uint64) {
 		startIdx = i
 	}
 	if startIdx == 0 {
-		return
+		return 0, false
+	}
+	if limit > 0 && startIdx > limit {
+		startIdx = limit
+		more = true
 	}
 	if log.GetLevel() == zapcore.DebugLevel {
 		log.Debug("Do GC in schema storage")
@@ -785,9 +946,25 @@ func (s *SchemaStorage) DoGC(ts uint64) {
 			s.snaps[i].PrintStatus(log.Debug)
 		}
 	}
+	// release the references in the underlying array, so that the removed
+	// snaps can be reclaimed before the array is reallocated
+	for i := 0; i < startIdx; i++ {
+		s.snaps[i] = nil
+	}
 	s.snaps = s.snaps[startIdx:]
 	atomic.StoreUint64(&s.gcTs, s.snaps[0].currentTs)
-	log.Info("finished gc in schema storage", zap.Uint64("gcTs", s.snaps[0].currentTs))
+	// the histories end before the first snapshot
+	for tableID := range s.histories {
+		delete(s.histories, tableID)
+	}
+	return startIdx, more
+}
+
+// snapshotCount returns the number of the snaps held by the storage
+func (s *SchemaStorage) snapshotCount() int {
+	s.snapsMu.RLock()
+	defer s.snapsMu.RUnlock()
+	return len(s.snaps)
 }
 
 // SkipJob skip the job should not be executed
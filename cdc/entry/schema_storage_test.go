@@ -25,6 +25,8 @@ import (
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	ticonfig "github.com/pingcap/tidb/config"
 	"github.com/pingcap/tidb/domain"
@@ -241,6 +243,7 @@ func (*schemaSuite) TestTable(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(preTableInfo.TableName, check.Equals, model.TableName{Schema: "Test", Table: "T"})
 	c.Assert(preTableInfo.ID, check.Equals, int64(2))
+	c.Assert(TruncateTableSwaps(preTableInfo, job), check.DeepEquals, []PhysicalTableSwap{{OldTableID: 2, NewTableID: 9}})
 
 	err = snap.handleDDL(job)
 	c.Assert(err, check.IsNil)
@@ -268,6 +271,7 @@ func (*schemaSuite) TestTable(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(preTableInfo.TableName, check.Equals, model.TableName{Schema: "Test", Table: "T"})
 	c.Assert(preTableInfo.ID, check.Equals, int64(9))
+	c.Assert(TruncateTableSwaps(preTableInfo, job), check.IsNil)
 
 	err = snap.handleDDL(job)
 	c.Assert(err, check.IsNil)
@@ -482,6 +486,53 @@ func (s *getUniqueKeysSuite) TestPKShouldBeInTheFirstPlaceWhenPKIsHandle(c *chec
 	})
 }
 
+func (t *schemaSuite) TestExtendTableHistoryWithoutSnapshot(c *check.C) {
+	defer testleak.AfterTest(c)()
+	schemaStorage := &SchemaStorage{histories: make(map[model.TableID][]*schemaSnapshot)}
+	err := schemaStorage.ExtendTableHistory(nil, 1, 100)
+	c.Assert(err, check.IsNil)
+}
+
+func (t *schemaSuite) TestTruncatePartitionSwaps(c *check.C) {
+	defer testleak.AfterTest(c)()
+	newTable := func(id int64, partitionIDs ...int64) *timodel.TableInfo {
+		pi := &timodel.PartitionInfo{Enable: true}
+		for i, pid := range partitionIDs {
+			pi.Definitions = append(pi.Definitions, timodel.PartitionDefinition{
+				ID: pid, Name: timodel.NewCIStr(fmt.Sprintf("p%d", i)),
+			})
+		}
+		return &timodel.TableInfo{ID: id, Name: timodel.NewCIStr("t"), Partition: pi}
+	}
+	preTable := model.WrapTableInfo(1, "test", 100, newTable(10, 11, 12, 13))
+
+	// all the partitions are swapped by truncating the table
+	job := &timodel.Job{
+		SchemaID:   1,
+		TableID:    10,
+		Type:       timodel.ActionTruncateTable,
+		BinlogInfo: &timodel.HistoryInfo{TableInfo: newTable(20, 21, 22, 23), FinishedTS: 110},
+	}
+	c.Assert(TruncateTableSwaps(preTable, job), check.DeepEquals, []PhysicalTableSwap{
+		{OldTableID: 11, NewTableID: 21}, {OldTableID: 12, NewTableID: 22}, {OldTableID: 13, NewTableID: 23},
+	})
+
+	// only the truncated partitions are swapped, paired by their names
+	job = &timodel.Job{
+		SchemaID:   1,
+		TableID:    10,
+		Type:       timodel.ActionTruncateTablePartition,
+		BinlogInfo: &timodel.HistoryInfo{TableInfo: newTable(10, 11, 24, 13), FinishedTS: 110},
+	}
+	c.Assert(TruncateTableSwaps(preTable, job), check.DeepEquals, []PhysicalTableSwap{{OldTableID: 12, NewTableID: 24}})
+
+	// the partitions added or dropped aren't swapped
+	job.Type = timodel.ActionAddTablePartition
+	job.BinlogInfo.TableInfo = newTable(10, 11, 12, 13, 25)
+	c.Assert(TruncateTableSwaps(preTable, job), check.IsNil)
+	c.Assert(TruncateTableSwaps(nil, job), check.IsNil)
+}
+
 func (t *schemaSuite) TestMultiVersionStorage(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -929,6 +980,91 @@ func (t *schemaSuite) TestSchemaStorage(c *check.C) {
 	}
 }
 
+func (t *schemaSuite) TestSchemaStorageSequenceAndView(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	for _, ddlSQL := range []string{
+		"create database test_seq",
+		"create table test_seq.t1 (id bigint primary key)",
+		"create sequence test_seq.seq1 start with 1 increment by 2", // ActionCreateSequence
+		"alter sequence test_seq.seq1 increment by 3",               // ActionAlterSequence
+		"create view test_seq.v1 as select * from test_seq.t1",      // ActionCreateView
+		"create sequence test_seq.seq2",                             // ActionCreateSequence
+		"drop sequence test_seq.seq2",                               // ActionDropSequence
+		"create view test_seq.v2 as select id from test_seq.t1",     // ActionCreateView
+		"drop view test_seq.v2",                                     // ActionDropView
+	} {
+		tk.MustExec(ddlSQL)
+	}
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	newStorage := func(includeSequences, includeViews bool) *SchemaStorage {
+		cfg := config.GetDefaultReplicaConfig()
+		cfg.DDLIncludeSequences = includeSequences
+		cfg.DDLIncludeViews = includeViews
+		f, err := filter.NewFilter(cfg)
+		c.Assert(err, check.IsNil)
+		storage, err := NewSchemaStorage(nil, 0, f, false)
+		c.Assert(err, check.IsNil)
+		for _, job := range jobs {
+			c.Assert(storage.HandleDDLJob(job), check.IsNil, check.Commentf("%s", job.Query))
+		}
+		return storage
+	}
+	lastTs := jobs[len(jobs)-1].BinlogInfo.FinishedTS
+
+	// the sequences and the views are replayed as in the meta, they're
+	// eligible but have no rows
+	storage := newStorage(true, true)
+	for _, job := range jobs {
+		ts := job.BinlogInfo.FinishedTS
+		meta, err := kv.GetSnapshotMeta(store, ts)
+		c.Assert(err, check.IsNil)
+		snapFromMeta, err := newSchemaSnapshotFromMeta(meta, ts, false)
+		c.Assert(err, check.IsNil)
+		snapFromSchemaStore, err := storage.GetSnapshot(ctx, ts)
+		c.Assert(err, check.IsNil)
+		tidySchemaSnapshot(snapFromMeta)
+		tidySchemaSnapshot(snapFromSchemaStore)
+		c.Assert(snapFromMeta, check.DeepEquals, snapFromSchemaStore,
+			check.Commentf("%s", cmp.Diff(snapFromMeta, snapFromSchemaStore, cmp.AllowUnexported(schemaSnapshot{}, model.TableInfo{}))))
+	}
+	snap, err := storage.GetSnapshot(ctx, lastTs)
+	c.Assert(err, check.IsNil)
+	for _, name := range []string{"seq1", "v1"} {
+		table, ok := snap.GetTableByName("test_seq", name)
+		c.Assert(ok, check.IsTrue, check.Commentf("%s", name))
+		c.Assert(table.IsEligible(false), check.IsTrue)
+		c.Assert(table.HasRows(), check.IsFalse)
+	}
+	table, ok := snap.GetTableByName("test_seq", "t1")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(table.HasRows(), check.IsTrue)
+	_, ok = snap.GetTableByName("test_seq", "seq2")
+	c.Assert(ok, check.IsFalse)
+
+	// the DDLs of the sequences and the views are skipped if they're not included
+	storage = newStorage(false, false)
+	snap, err = storage.GetSnapshot(ctx, lastTs)
+	c.Assert(err, check.IsNil)
+	for _, name := range []string{"seq1", "seq2", "v1", "v2"} {
+		_, ok := snap.GetTableByName("test_seq", name)
+		c.Assert(ok, check.IsFalse, check.Commentf("%s", name))
+	}
+	_, ok = snap.GetTableByName("test_seq", "t1")
+	c.Assert(ok, check.IsTrue)
+}
+
 func tidySchemaSnapshot(snap *schemaSnapshot) {
 	for _, dbInfo := range snap.schemas {
 		if len(dbInfo.Tables) == 0 {
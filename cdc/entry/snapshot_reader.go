@@ -0,0 +1,71 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	tidbkv "github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+// SnapshotRowReader reads rows from the snapshots of the upstream TiKV, and
+// mounts them with the schema storage of the processor.
+type SnapshotRowReader struct {
+	storage tidbkv.Storage
+	mounter *mounterImpl
+}
+
+// NewSnapshotRowReader creates a new SnapshotRowReader
+func NewSnapshotRowReader(storage tidbkv.Storage, schemaStorage *SchemaStorage, tz *time.Location) *SnapshotRowReader {
+	return &SnapshotRowReader{
+		storage: storage,
+		mounter: &mounterImpl{
+			schemaStorage: schemaStorage,
+			tz:            tz,
+		},
+	}
+}
+
+// ReadRow reads the row with the int handle from the physical table in the
+// snapshot of ts, exist is false if the row is not found.
+func (r *SnapshotRowReader) ReadRow(
+	ctx context.Context, tableID model.TableID, handle int64, ts uint64,
+) (cols []*model.Column, exist bool, err error) {
+	key := tablecodec.EncodeRowKeyWithHandle(tableID, tidbkv.IntHandle(handle))
+	value, err := r.storage.GetSnapshot(tidbkv.NewVersion(ts)).Get(ctx, key)
+	if err != nil {
+		if tidbkv.IsErrNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, cerror.WrapError(cerror.ErrGetStoreSnapshot, err)
+	}
+	row, err := r.mounter.unmarshalAndMountRowChanged(ctx, &model.RawKVEntry{
+		OpType: model.OpTypePut,
+		Key:    key,
+		Value:  value,
+		CRTs:   ts,
+	})
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	if row == nil {
+		return nil, false, cerror.ErrSnapshotTableNotFound.GenWithStackByArgs(tableID)
+	}
+	return row.Columns, true, nil
+}
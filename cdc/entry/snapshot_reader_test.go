@@ -0,0 +1,94 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/session"
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/util/testkit"
+)
+
+type snapshotReaderSuite struct{}
+
+var _ = check.Suite(&snapshotReaderSuite{})
+
+func (s *snapshotReaderSuite) TestReadRow(c *check.C) {
+	defer testleak.AfterTest(c)()
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+
+	tk.MustExec("create table snapshot_read(id int primary key, a varchar(10))")
+	tk.MustExec("insert into snapshot_read values (1, 'a'), (2, 'b')")
+	ver1, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	tk.MustExec("update snapshot_read set a = 'c' where id = 1")
+	tk.MustExec("delete from snapshot_read where id = 2")
+	ver2, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+
+	jobs, err := getAllHistoryDDLJob(store)
+	c.Assert(err, check.IsNil)
+	scheamStorage, err := NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		err := scheamStorage.HandleDDLJob(job)
+		c.Assert(err, check.IsNil)
+	}
+	scheamStorage.AdvanceResolvedTs(ver2.Ver)
+	tableInfo, ok := scheamStorage.GetLastSnapshot().GetTableByName("test", "snapshot_read")
+	c.Assert(ok, check.IsTrue)
+
+	reader := NewSnapshotRowReader(store, scheamStorage, time.Local)
+	ctx := context.Background()
+	values := func(cols []*model.Column) []interface{} {
+		res := make([]interface{}, 0, len(cols))
+		for _, col := range cols {
+			if col != nil {
+				res = append(res, col.Value)
+			}
+		}
+		return res
+	}
+
+	cols, exist, err := reader.ReadRow(ctx, tableInfo.ID, 1, ver1.Ver)
+	c.Assert(err, check.IsNil)
+	c.Assert(exist, check.IsTrue)
+	c.Assert(values(cols), check.DeepEquals, []interface{}{int64(1), []byte("a")})
+	cols, exist, err = reader.ReadRow(ctx, tableInfo.ID, 1, ver2.Ver)
+	c.Assert(err, check.IsNil)
+	c.Assert(exist, check.IsTrue)
+	c.Assert(values(cols), check.DeepEquals, []interface{}{int64(1), []byte("c")})
+
+	_, exist, err = reader.ReadRow(ctx, tableInfo.ID, 2, ver1.Ver)
+	c.Assert(err, check.IsNil)
+	c.Assert(exist, check.IsTrue)
+	_, exist, err = reader.ReadRow(ctx, tableInfo.ID, 2, ver2.Ver)
+	c.Assert(err, check.IsNil)
+	c.Assert(exist, check.IsFalse)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+)
+
+// TableSpans returns the spans to pull for the physical table, which include
+// the row kvs and only the index kvs used by the mounter. The pre-columns of
+// the deleted rows are got from the old values or the handles of the row kvs,
+// unless the old value is disabled and the table uses the implicit _tidb_rowid
+// as the handle, in which case they are got from the deletes of the handle
+// index, see mountIndexKVEntry. The whole table is pulled if the table info is
+// not found and the index kvs may be needed.
+func TableSpans(tableID model.TableID, tableInfo *model.TableInfo, enableOldValue bool) []regionspan.Span {
+	recordSpan := regionspan.GetTableSpan(tableID, true)
+	switch {
+	case enableOldValue:
+		return []regionspan.Span{recordSpan}
+	case tableInfo == nil:
+		return []regionspan.Span{regionspan.GetTableSpan(tableID, false)}
+	case tableInfo.PKIsHandle || tableInfo.IsCommonHandle || tableInfo.HandleIndexID < 0:
+		return []regionspan.Span{recordSpan}
+	}
+	return []regionspan.Span{recordSpan, regionspan.GetTableIndexSpan(tableID, tableInfo.HandleIndexID)}
+}
+
+// TableSpansMayChange returns true if the spans of the table may be changed by
+// the DDLs which change the handle index of the table.
+func TableSpansMayChange(tableInfo *model.TableInfo, enableOldValue bool) bool {
+	return !enableOldValue && tableInfo != nil && !tableInfo.PKIsHandle && !tableInfo.IsCommonHandle
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	ticonfig "github.com/pingcap/tidb/config"
+	tidbkv "github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/session"
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/util/testkit"
+	"go.uber.org/zap"
+)
+
+type tableSpansSuite struct{}
+
+var _ = check.Suite(&tableSpansSuite{})
+
+type tableSpansTest struct {
+	c       *check.C
+	store   tidbkv.Storage
+	tk      *testkit.TestKit
+	storage *SchemaStorage
+	close   func()
+}
+
+func newTableSpansTest(c *check.C) *tableSpansTest {
+	// the int primary keys are the handles, which is changed globally by
+	// the other tests
+	alterPrimaryKey := ticonfig.GetGlobalConfig().AlterPrimaryKey
+	ticonfig.UpdateGlobal(func(conf *ticonfig.Config) {
+		conf.AlterPrimaryKey = false
+	})
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+	storage, err := NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	return &tableSpansTest{
+		c:       c,
+		store:   store,
+		tk:      tk,
+		storage: storage,
+		close: func() {
+			domain.Close()
+			store.Close() //nolint:errcheck
+			ticonfig.UpdateGlobal(func(conf *ticonfig.Config) {
+				conf.AlterPrimaryKey = alterPrimaryKey
+			})
+		},
+	}
+}
+
+// tableInfo handles the DDL jobs executed, and returns the table info in the
+// last snapshot
+func (t *tableSpansTest) tableInfo(name string) *model.TableInfo {
+	jobs, err := getAllHistoryDDLJob(t.store)
+	t.c.Assert(err, check.IsNil)
+	for _, job := range jobs {
+		t.c.Assert(t.storage.HandleDDLJob(job), check.IsNil)
+	}
+	ver, err := t.store.CurrentVersion()
+	t.c.Assert(err, check.IsNil)
+	t.storage.AdvanceResolvedTs(ver.Ver)
+	tableInfo, ok := t.storage.GetLastSnapshot().GetTableByName("test", name)
+	t.c.Assert(ok, check.IsTrue)
+	return tableInfo
+}
+
+func (t *tableSpansTest) walk(spans []regionspan.Span, f func(key []byte, value []byte)) {
+	txn, err := t.store.Begin()
+	t.c.Assert(err, check.IsNil)
+	defer txn.Rollback() //nolint:errcheck
+	for _, span := range spans {
+		iter, err := txn.Iter(span.Start, span.End)
+		t.c.Assert(err, check.IsNil)
+		for iter.Valid() {
+			f(iter.Key(), iter.Value())
+			t.c.Assert(iter.Next(), check.IsNil)
+		}
+		iter.Close()
+	}
+}
+
+// deletedRows mounts the deletes of the kvs in the spans, and returns the
+// pre-columns of the rows mounted
+func (t *tableSpansTest) deletedRows(spans []regionspan.Span, enableOldValue bool) []string {
+	// the rows are deleted after the last DDL
+	ts := t.storage.ResolvedTs()
+	mounter := NewMounter(t.storage, &config.MounterConfig{WorkerNum: 1}, enableOldValue, nil, "").(*mounterImpl)
+	mounter.tz = time.Local
+	var rows []string
+	t.walk(spans, func(key []byte, value []byte) {
+		raw := &model.RawKVEntry{
+			OpType:  model.OpTypeDelete,
+			Key:     key,
+			StartTs: ts - 1,
+			CRTs:    ts,
+		}
+		if enableOldValue {
+			raw.OldValue = value
+		}
+		row, err := mounter.unmarshalAndMountRowChanged(context.Background(), raw)
+		t.c.Assert(err, check.IsNil)
+		if row == nil {
+			return
+		}
+		var pre string
+		for _, col := range row.PreColumns {
+			if col != nil {
+				pre += fmt.Sprintf("%s=%v,", col.Name, col.Value)
+			}
+		}
+		rows = append(rows, pre)
+	})
+	return rows
+}
+
+func (t *tableSpansTest) size(spans []regionspan.Span) (size int) {
+	t.walk(spans, func(key []byte, value []byte) {
+		size += len(key) + len(value)
+	})
+	return
+}
+
+func (s *tableSpansSuite) TestNarrowedSpans(c *check.C) {
+	defer testleak.AfterTest(c)()
+	t := newTableSpansTest(c)
+	defer t.close()
+	t.tk.MustExec(`create table narrow(id int not null, a int, b int, c int, d int, e int, f int, g int, v varchar(32),
+		unique key uk(id), key ia(a), key ib(b), key ic(c), key id(d), key ie(e), key i_f(f), key ig(g))`)
+	for i := 0; i < 200; i++ {
+		t.tk.MustExec("insert into narrow values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, fmt.Sprintf("value-%d", i))
+	}
+	tableInfo := t.tableInfo("narrow")
+	c.Assert(tableInfo.Indices, check.HasLen, 8)
+	fullSpans := []regionspan.Span{regionspan.GetTableSpan(tableInfo.ID, false)}
+
+	// only the handle index is pulled besides the rows if old value is disabled
+	spans := TableSpans(tableInfo.ID, tableInfo, false)
+	c.Assert(spans, check.DeepEquals, []regionspan.Span{
+		regionspan.GetTableSpan(tableInfo.ID, true),
+		regionspan.GetTableIndexSpan(tableInfo.ID, tableInfo.HandleIndexID),
+	})
+	c.Assert(TableSpansMayChange(tableInfo, false), check.IsTrue)
+	fullSize, narrowedSize := t.size(fullSpans), t.size(spans)
+	log.Info("the size of the kvs pulled of the table with 8 secondary indexes",
+		zap.Int("full", fullSize), zap.Int("narrowed", narrowedSize),
+		zap.Float64("reduction", 1-float64(narrowedSize)/float64(fullSize)))
+	c.Assert(narrowedSize*2, check.Less, fullSize)
+
+	// the pre-columns of the deleted rows are the same as pulling the whole table
+	rows := t.deletedRows(spans, false)
+	c.Assert(rows, check.HasLen, 200)
+	c.Assert(rows, check.DeepEquals, t.deletedRows(fullSpans, false))
+
+	// only the rows are pulled if old value is enabled
+	spans = TableSpans(tableInfo.ID, tableInfo, true)
+	c.Assert(spans, check.DeepEquals, []regionspan.Span{regionspan.GetTableSpan(tableInfo.ID, true)})
+	c.Assert(TableSpansMayChange(tableInfo, true), check.IsFalse)
+	rows = t.deletedRows(spans, true)
+	c.Assert(rows, check.HasLen, 200)
+	c.Assert(rows[0], check.Equals, "id=0,a=1,b=2,c=3,d=4,e=5,f=6,g=7,v=[118 97 108 117 101 45 48],")
+
+	// the whole table is pulled if the table info is not found
+	c.Assert(TableSpans(tableInfo.ID, nil, false), check.DeepEquals, fullSpans)
+}
+
+func (s *tableSpansSuite) TestPKIsHandle(c *check.C) {
+	defer testleak.AfterTest(c)()
+	t := newTableSpansTest(c)
+	defer t.close()
+	t.tk.MustExec("create table pk(id int primary key, a int, b int, key ia(a), unique key ub(b))")
+	for i := 0; i < 10; i++ {
+		t.tk.MustExec("insert into pk values (?, ?, ?)", i, i+1, i+2)
+	}
+	tableInfo := t.tableInfo("pk")
+	spans := TableSpans(tableInfo.ID, tableInfo, false)
+	c.Assert(spans, check.DeepEquals, []regionspan.Span{regionspan.GetTableSpan(tableInfo.ID, true)})
+	c.Assert(TableSpansMayChange(tableInfo, false), check.IsFalse)
+	rows := t.deletedRows(spans, false)
+	c.Assert(rows, check.HasLen, 10)
+	c.Assert(rows, check.DeepEquals, t.deletedRows([]regionspan.Span{regionspan.GetTableSpan(tableInfo.ID, false)}, false))
+}
+
+func (s *tableSpansSuite) TestSpansAfterDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	t := newTableSpansTest(c)
+	defer t.close()
+	// the table without a handle index is replicated only if it's forced
+	var err error
+	t.storage, err = NewSchemaStorage(nil, 0, nil, true)
+	c.Assert(err, check.IsNil)
+	t.tk.MustExec("create table ddl(id int not null, a int, key ia(a))")
+	t.tk.MustExec("insert into ddl values (1, 2), (3, 4)")
+	tableInfo := t.tableInfo("ddl")
+	recordSpan := regionspan.GetTableSpan(tableInfo.ID, true)
+	// the deletes of the table without a handle index can't be mounted
+	c.Assert(TableSpans(tableInfo.ID, tableInfo, false), check.DeepEquals, []regionspan.Span{recordSpan})
+	c.Assert(TableSpansMayChange(tableInfo, false), check.IsTrue)
+
+	// the unique index added becomes the handle index, and is pulled
+	t.tk.MustExec("alter table ddl add unique index uk(id)")
+	tableInfo = t.tableInfo("ddl")
+	spans := TableSpans(tableInfo.ID, tableInfo, false)
+	c.Assert(spans, check.DeepEquals, []regionspan.Span{
+		recordSpan, regionspan.GetTableIndexSpan(tableInfo.ID, tableInfo.HandleIndexID),
+	})
+	rows := t.deletedRows(spans, false)
+	c.Assert(rows, check.DeepEquals, []string{"id=1,", "id=3,"})
+
+	// the index isn't needed after it's dropped
+	t.tk.MustExec("alter table ddl drop index uk")
+	tableInfo = t.tableInfo("ddl")
+	c.Assert(TableSpans(tableInfo.ID, tableInfo, false), check.DeepEquals, []regionspan.Span{recordSpan})
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"net/http"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// apiV1ConfigSchemaPath is the path of the changefeed config schema in the v1 HTTP API
+const apiV1ConfigSchemaPath = "/api/v1/config/schema"
+
+// ConfigSchemaResp describes the config of a changefeed for the UI builders
+type ConfigSchemaResp struct {
+	// SortEngines are the sort engines a changefeed can be created with, the
+	// sort engine is an option of the changefeed rather than of its config
+	SortEngines []model.SortEngine `json:"sort-engines"`
+	// ReplicaConfig is the schema of the config file of a changefeed
+	ReplicaConfig []*config.FieldSchema `json:"replica-config"`
+}
+
+// handleConfigSchema serves `GET /api/v1/config/schema`, which returns the
+// fields of the changefeed config with their types, defaults, constraints and
+// whether they can be updated while the changefeed is running.
+func handleConfigSchema(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportGetOnly.GenWithStackByArgs())
+		return
+	}
+	schema, err := config.GetReplicaConfigSchema()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, &ConfigSchemaResp{
+		SortEngines:   []model.SortEngine{model.SortUnified, model.SortInMemory, model.SortInFile},
+		ReplicaConfig: schema,
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type httpConfigSuite struct{}
+
+var _ = check.Suite(&httpConfigSuite{})
+
+func findFieldSchema(fields []*config.FieldSchema, path string) *config.FieldSchema {
+	var field *config.FieldSchema
+	for _, name := range strings.Split(path, ".") {
+		field = nil
+		for _, f := range fields {
+			if f.Name == name {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			return nil
+		}
+		fields = field.Fields
+	}
+	return field
+}
+
+// checkFieldSchemas checks the schema of each field of the struct against
+// the type and the value of the field
+func checkFieldSchemas(c *check.C, fields []*config.FieldSchema, t reflect.Type, v reflect.Value, path string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+			if fv.IsValid() {
+				if fv.IsNil() {
+					fv = reflect.Value{}
+				} else {
+					fv = fv.Elem()
+				}
+			}
+		}
+		if field.Anonymous && name == "" {
+			checkFieldSchemas(c, fields, ft, fv, path)
+			continue
+		}
+		fieldPath := path + name
+		schema := findFieldSchema(fields, name)
+		c.Assert(schema, check.NotNil, check.Commentf("field %s", fieldPath))
+		expectedType := map[reflect.Kind]string{
+			reflect.Bool:    config.SchemaTypeBool,
+			reflect.Int:     config.SchemaTypeInt,
+			reflect.Int64:   config.SchemaTypeInt,
+			reflect.Uint8:   config.SchemaTypeUint,
+			reflect.Uint64:  config.SchemaTypeUint,
+			reflect.Float64: config.SchemaTypeFloat,
+			reflect.String:  config.SchemaTypeString,
+			reflect.Slice:   config.SchemaTypeArray,
+			reflect.Struct:  config.SchemaTypeObject,
+		}[ft.Kind()]
+		c.Assert(schema.Type, check.Equals, expectedType, check.Commentf("field %s", fieldPath))
+		switch ft.Kind() {
+		case reflect.Struct:
+			c.Assert(schema.Default, check.IsNil, check.Commentf("field %s", fieldPath))
+			checkFieldSchemas(c, schema.Fields, ft, fv, fieldPath+".")
+			continue
+		case reflect.Slice:
+			c.Assert(schema.Items, check.NotNil, check.Commentf("field %s", fieldPath))
+			if !fv.IsValid() || fv.Len() == 0 {
+				c.Assert(schema.Default, check.IsNil, check.Commentf("field %s", fieldPath))
+				continue
+			}
+		}
+		// the fields of the configs disabled by default, which are nil, have
+		// no defaults
+		if !fv.IsValid() {
+			c.Assert(schema.Default, check.IsNil, check.Commentf("field %s", fieldPath))
+			continue
+		}
+		// the defaults are compared in the form of json, as they're read from
+		// the response
+		raw, err := json.Marshal(fv.Interface())
+		c.Assert(err, check.IsNil)
+		var expected interface{}
+		c.Assert(json.Unmarshal(raw, &expected), check.IsNil)
+		c.Assert(schema.Default, check.DeepEquals, expected, check.Commentf("field %s", fieldPath))
+	}
+}
+
+func (s *httpConfigSuite) TestHandleConfigSchema(c *check.C) {
+	defer testleak.AfterTest(c)()
+	rec := httptest.NewRecorder()
+	handleConfigSchema(rec, httptest.NewRequest(http.MethodGet, apiV1ConfigSchemaPath, nil))
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	resp := &ConfigSchemaResp{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), resp), check.IsNil)
+	c.Assert(resp.SortEngines, check.DeepEquals, []model.SortEngine{model.SortUnified, model.SortInMemory, model.SortInFile})
+
+	// every field of the config is in the schema with its default
+	defaultConfig := config.GetDefaultReplicaConfig()
+	checkFieldSchemas(c, resp.ReplicaConfig, reflect.TypeOf(*defaultConfig), reflect.ValueOf(defaultConfig).Elem(), "")
+	c.Assert(resp.ReplicaConfig, check.HasLen, reflect.TypeOf(*defaultConfig).NumField())
+
+	field := findFieldSchema(resp.ReplicaConfig, "latency.sample-rate")
+	c.Assert(*field.Min, check.Equals, float64(0))
+	c.Assert(*field.Max, check.Equals, float64(1))
+	c.Assert(field.HotReload, check.IsFalse)
+	field = findFieldSchema(resp.ReplicaConfig, "sink.protocol")
+	c.Assert(field.Enum, check.DeepEquals, []string{"default", "canal", "avro", "maxwell", "canal-json"})
+	c.Assert(field.Default, check.Equals, "default")
+	field = findFieldSchema(resp.ReplicaConfig, "sink.dispatchers")
+	c.Assert(findFieldSchema(field.Items.Fields, "dispatcher").Enum, check.HasLen, 5)
+	// the fields in a hot reloadable section are hot reloadable
+	c.Assert(findFieldSchema(resp.ReplicaConfig, "budget.memory-quota").HotReload, check.IsTrue)
+	field = findFieldSchema(resp.ReplicaConfig, "throttle-schedule.windows")
+	c.Assert(field.HotReload, check.IsTrue)
+	c.Assert(findFieldSchema(field.Items.Fields, "days").Items.Enum, check.HasLen, 7)
+	// the embedded filter rules are flattened
+	c.Assert(findFieldSchema(resp.ReplicaConfig, "filter.do-dbs"), check.NotNil)
+
+	rec = httptest.NewRecorder()
+	handleConfigSchema(rec, httptest.NewRequest(http.MethodPost, apiV1ConfigSchemaPath, nil))
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *httpConfigSuite) TestGenerateSchemaInvalidTag(c *check.C) {
+	defer testleak.AfterTest(c)()
+	_, err := config.GenerateSchema(&struct {
+		Size int `toml:"size" schema:"min=a"`
+	}{})
+	c.Assert(err, check.ErrorMatches, ".*field size.*invalid min a.*")
+	_, err = config.GenerateSchema(&struct {
+		Size int `toml:"size" schema:"unknown"`
+	}{})
+	c.Assert(err, check.ErrorMatches, ".*unknown option unknown.*")
+	_, err = config.GenerateSchema(1)
+	c.Assert(err, check.ErrorMatches, ".*is not a struct.*")
+}
@@ -19,12 +19,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/logutil"
+	"github.com/pingcap/ticdc/pkg/scheduler"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.uber.org/zap"
@@ -39,10 +42,35 @@ const (
 	APIOpVarTargetCaptureID = "target-cp-id"
 	// APIOpVarTableID is the key of table ID in HTTP API
 	APIOpVarTableID = "table-id"
+	// APIOpVarDDLJobID is the key of DDL job ID in HTTP API
+	APIOpVarDDLJobID = "ddl-job-id"
 	// APIOpForceRemoveChangefeed is used when remove a changefeed
 	APIOpForceRemoveChangefeed = "force-remove"
+	// APIOpOverwriteCheckpointTs is used when resume a changefeed from another checkpoint ts
+	APIOpOverwriteCheckpointTs = "overwrite-checkpoint-ts"
+	// APIOpVarClient is the key of the client info recorded in the changefeed history in HTTP API
+	APIOpVarClient = "client"
+	// APIOpVarOffset is the key of pagination offset in HTTP API
+	APIOpVarOffset = "offset"
+	// APIOpVarLimit is the key of pagination limit in HTTP API
+	APIOpVarLimit = "limit"
+	// APIOpVarTableName is the key of table name in the form of schema.table in HTTP API
+	APIOpVarTableName = "table"
+	// APIOpVarLocal is the key of the option to return the numbers of this capture only in HTTP API
+	APIOpVarLocal = "local"
+	// APIOpVarMemoryQuota is the key of the memory quota of the changefeed budget in HTTP API
+	APIOpVarMemoryQuota = "memory-quota"
+	// APIOpVarEventsPerSecond is the key of the events per second of the changefeed budget in HTTP API
+	APIOpVarEventsPerSecond = "events-per-second"
+	// APIOpVarStatisticsWindow is the key of the window of the table statistics, e.g. 10m, in HTTP API
+	APIOpVarStatisticsWindow = "statistics-window"
+	// APIOpVarNote is the key of the acknowledgment note of resetting the circuit breaker in HTTP API
+	APIOpVarNote = "note"
 )
 
+// apiV1ChangefeedsPrefix is the path prefix of the changefeed resources in the v1 HTTP API
+const apiV1ChangefeedsPrefix = "/api/v1/changefeeds/"
+
 type commonResp struct {
 	Status  bool   `json:"status"`
 	Message string `json:"message"`
@@ -54,6 +82,57 @@ type ChangefeedResp struct {
 	TSO          uint64              `json:"tso"`
 	Checkpoint   string              `json:"checkpoint"`
 	RunningError *model.RunningError `json:"error"`
+	// Initializing is the progress of the incremental scan, it's only set
+	// during the catch-up phase, e.g. "1534/8200 regions".
+	Initializing string `json:"initializing,omitempty"`
+	// InitialScanFinished records when the changefeed finished catching up
+	// with the history, it's nil before the milestone is reached
+	InitialScanFinished *model.InitialScanMilestone `json:"initial-scan-finished,omitempty"`
+	// InitializingTables are the tables whose incremental scan is not finished
+	InitializingTables []model.TableID `json:"initializing-tables,omitempty"`
+	// Pause is set if the changefeed is paused by a pause command
+	Pause *model.PauseInfo `json:"pause,omitempty"`
+	// DDLUnsupportedAction is the action taken when a DDL is not supported
+	// by the downstream
+	DDLUnsupportedAction string `json:"ddl-unsupported-action,omitempty"`
+	// SkippedDDLs are the latest DDLs skipped because they're not supported
+	// by the downstream
+	SkippedDDLs []*model.UnsupportedDDL `json:"skipped-ddls,omitempty"`
+	// PausedDDL is the DDL not supported by the downstream which the
+	// changefeed is paused on
+	PausedDDL *model.UnsupportedDDL `json:"paused-ddl,omitempty"`
+}
+
+// ChangefeedHistoryResp holds a page of the event history of a changefeed
+type ChangefeedHistoryResp struct {
+	// Total is the number of events kept in the history
+	Total  int                      `json:"total"`
+	Events []*model.ChangefeedEvent `json:"events"`
+}
+
+// RebalancePlanResp holds the rebalance plan of a changefeed previewed by the
+// owner, the tables are not moved.
+type RebalancePlanResp struct {
+	MoveCount int                   `json:"move-count"`
+	Moves     []scheduler.TableMove `json:"moves"`
+	// SkewnessBefore and SkewnessAfter are the projected imbalance of the
+	// workloads of the captures before and after the rebalance
+	SkewnessBefore float64 `json:"skewness-before"`
+	SkewnessAfter  float64 `json:"skewness-after"`
+}
+
+// GCSafepointResp holds the service GC safepoint of TiCDC last pushed to PD
+type GCSafepointResp struct {
+	ServiceID string `json:"service-id"`
+	// Safepoint is the minimum checkpoint ts of the changefeeds pushed as the
+	// service GC safepoint, 0 means the safepoint is cleared or not pushed yet.
+	Safepoint uint64 `json:"safepoint"`
+	// PDMinSafepoint is the minimal service GC safepoint of all the services
+	// returned by PD when the safepoint is pushed
+	PDMinSafepoint uint64 `json:"pd-min-safepoint"`
+	// Holder is the changefeed with the minimum checkpoint ts
+	Holder     model.ChangeFeedID `json:"holder"`
+	UpdateTime string             `json:"update-time,omitempty"`
 }
 
 func handleOwnerResp(w http.ResponseWriter, err error) {
@@ -132,10 +211,26 @@ func (s *Server) handleChangefeedAdmin(w http.ResponseWriter, req *http.Request)
 		}
 		opts.ForceRemove = forceRemoveOpt
 	}
+	if tsStr := req.Form.Get(APIOpOverwriteCheckpointTs); tsStr != "" {
+		ts, err := strconv.ParseUint(tsStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid overwrite checkpoint ts: %s", tsStr))
+			return
+		}
+		opts.OverwriteCheckpointTs = ts
+	}
+	// the changefeeds paused by the users are stopped after the sinks are flushed
+	opts.Graceful = model.AdminJobType(typ) == model.AdminStop
+	client := req.Form.Get(APIOpVarClient)
+	if client == "" {
+		client = req.RemoteAddr
+	}
 	job := model.AdminJob{
-		CfID: req.Form.Get(APIOpVarChangefeedID),
-		Type: model.AdminJobType(typ),
-		Opts: opts,
+		CfID:   req.Form.Get(APIOpVarChangefeedID),
+		Type:   model.AdminJobType(typ),
+		Opts:   opts,
+		Client: client,
 	}
 	err = s.owner.EnqueueJob(job)
 	handleOwnerResp(w, err)
@@ -169,6 +264,47 @@ func (s *Server) handleRebalanceTrigger(w http.ResponseWriter, req *http.Request
 	handleOwnerResp(w, nil)
 }
 
+func (s *Server) handleRebalancePlan(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	plan, err := s.owner.PreviewRebalance(req.Context(), changefeedID)
+	if err != nil {
+		if cerror.ErrChangeFeedNotExists.Equal(err) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, &RebalancePlanResp{
+		MoveCount:      len(plan.Moves),
+		Moves:          plan.Moves,
+		SkewnessBefore: plan.SkewnessBefore,
+		SkewnessAfter:  plan.SkewnessAfter,
+	})
+}
+
 func (s *Server) handleMoveTable(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
@@ -210,11 +346,12 @@ func (s *Server) handleMoveTable(w http.ResponseWriter, req *http.Request) {
 	handleOwnerResp(w, nil)
 }
 
-func (s *Server) handleChangefeedQuery(w http.ResponseWriter, req *http.Request) {
+func (s *Server) handleSchemaBootstrap(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
 		return
 	}
+
 	s.ownerLock.RLock()
 	defer s.ownerLock.RUnlock()
 	if s.owner == nil {
@@ -224,7 +361,7 @@ func (s *Server) handleChangefeedQuery(w http.ResponseWriter, req *http.Request)
 
 	err := req.ParseForm()
 	if err != nil {
-		writeInternalServerError(w, err)
+		writeInternalServerError(w, cerror.WrapError(cerror.ErrInternalServerError, err))
 		return
 	}
 	changefeedID := req.Form.Get(APIOpVarChangefeedID)
@@ -233,33 +370,343 @@ func (s *Server) handleChangefeedQuery(w http.ResponseWriter, req *http.Request)
 			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
 		return
 	}
-	cf, status, feedState, err := s.owner.collectChangefeedInfo(req.Context(), changefeedID)
-	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+	tableIDStr := req.Form.Get(APIOpVarTableID)
+	tableID, err := strconv.ParseInt(tableIDStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid tableID: %s", tableIDStr))
+		return
+	}
+	s.owner.TriggerSchemaBootstrap(changefeedID, tableID)
+	handleOwnerResp(w, nil)
+}
+
+func (s *Server) handleSkipDDL(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, cerror.WrapError(cerror.ErrInternalServerError, err))
+		return
+	}
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	jobIDStr := req.Form.Get(APIOpVarDDLJobID)
+	jobID, err := strconv.ParseInt(jobIDStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid DDL job id: %s", jobIDStr))
+		return
+	}
+	s.owner.SkipDDLOnce(changefeedID, jobID)
+	handleOwnerResp(w, nil)
+}
+
+func (s *Server) handleUpdateBudget(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, cerror.WrapError(cerror.ErrInternalServerError, err))
+		return
+	}
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	// the budget not in the form is not changed
+	memoryQuota := int64(-1)
+	if quotaStr := req.Form.Get(APIOpVarMemoryQuota); quotaStr != "" {
+		memoryQuota, err = strconv.ParseInt(quotaStr, 10, 64)
+		if err != nil || memoryQuota < 0 {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid memory quota: %s", quotaStr))
+			return
+		}
+	}
+	eventsPerSecond := -1
+	if rateStr := req.Form.Get(APIOpVarEventsPerSecond); rateStr != "" {
+		eventsPerSecond, err = strconv.Atoi(rateStr)
+		if err != nil || eventsPerSecond < 0 {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid events per second: %s", rateStr))
+			return
+		}
+	}
+	s.owner.UpdateBudget(changefeedID, memoryQuota, eventsPerSecond, req.Form.Get(APIOpVarClient))
+	handleOwnerResp(w, nil)
+}
+
+func (s *Server) handleResetBreaker(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, cerror.WrapError(cerror.ErrInternalServerError, err))
+		return
+	}
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	// the note acknowledges the trips, it's required
+	note := strings.TrimSpace(req.Form.Get(APIOpVarNote))
+	if note == "" {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("the acknowledgment note is required"))
+		return
+	}
+	s.owner.ResetBreaker(changefeedID, note, req.Form.Get(APIOpVarClient))
+	handleOwnerResp(w, nil)
+}
+
+func (s *Server) handleChangefeedQuery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil && !s.isObserver() {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
 		writeInternalServerError(w, err)
 		return
 	}
-	feedInfo, err := s.owner.etcdClient.GetChangeFeedInfo(req.Context(), changefeedID)
-	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	resp, err := s.queryChangefeed(req.Context(), changefeedID)
+	if err != nil {
 		writeInternalServerError(w, err)
 		return
 	}
+	writeData(w, resp)
+}
+
+// isObserver returns true if the server runs an observer capture, which
+// answers the queries from etcd without the owner.
+func (s *Server) isObserver() bool {
+	return s.capture != nil && s.capture.info.Observer
+}
+
+// queryChangefeed queries the changefeed from the owner, or from etcd if the
+// server is an observer. The ownerLock must be held.
+func (s *Server) queryChangefeed(ctx context.Context, changefeedID model.ChangeFeedID) (*ChangefeedResp, error) {
+	var (
+		cf         *changeFeed
+		status     *model.ChangeFeedStatus
+		feedState  model.FeedState
+		etcdClient kv.CDCEtcdClient
+		err        error
+	)
+	if s.owner != nil {
+		etcdClient = s.owner.etcdClient
+		cf, status, feedState, err = s.owner.collectChangefeedInfo(ctx, changefeedID)
+	} else {
+		etcdClient = s.capture.etcdClient
+		status, feedState, err = collectChangefeedInfoFromEtcd(ctx, etcdClient, changefeedID)
+	}
+	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+		return nil, err
+	}
+	feedInfo, err := etcdClient.GetChangeFeedInfo(ctx, changefeedID)
+	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+		return nil, err
+	}
 
 	resp := &ChangefeedResp{
 		FeedState: string(feedState),
 	}
 	if cf != nil {
 		resp.RunningError = cf.info.Error
+		resp.DDLUnsupportedAction = cf.info.Config.GetDDLUnsupportedAction()
+		if progress := cf.scanProgress(); progress != nil {
+			resp.Initializing = progress.String()
+		}
 	} else if feedInfo != nil {
 		resp.RunningError = feedInfo.Error
+		resp.DDLUnsupportedAction = feedInfo.Config.GetDDLUnsupportedAction()
 	}
 	if status != nil {
 		resp.TSO = status.CheckpointTs
 		tm := oracle.GetTimeFromTS(status.CheckpointTs)
 		resp.Checkpoint = tm.Format("2006-01-02 15:04:05.000")
+		resp.Pause = status.Pause
+		resp.SkippedDDLs = status.SkippedDDLs
+		resp.PausedDDL = status.PausedDDL
+		resp.InitialScanFinished = status.InitialScanFinished
+		resp.InitializingTables = status.InitializingTables
+	}
+	return resp, nil
+}
+
+func (s *Server) handleChangefeedHistory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	changefeedID := req.Form.Get(APIOpVarChangefeedID)
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	var offset, limit int64
+	if offsetStr := req.Form.Get(APIOpVarOffset); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid offset: %s", offsetStr))
+			return
+		}
+	}
+	if limitStr := req.Form.Get(APIOpVarLimit); limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid limit: %s", limitStr))
+			return
+		}
+	}
+	history, err := s.owner.changefeedHistory(req.Context(), changefeedID)
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, &ChangefeedHistoryResp{
+		Total:  len(history.Events),
+		Events: history.Page(int(offset), int(limit)),
+	})
+}
+
+func (s *Server) handleRefreshGCSafepoint(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportPostOnly.GenWithStackByArgs())
+		return
+	}
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+	resp, err := s.owner.RefreshGCSafepoint(req.Context())
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
 	}
 	writeData(w, resp)
 }
 
+func (s *Server) handleGCSafepoint(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportGetOnly.GenWithStackByArgs())
+		return
+	}
+	s.ownerLock.RLock()
+	defer s.ownerLock.RUnlock()
+	if s.owner == nil {
+		handleOwnerResp(w, concurrency.ErrElectionNotLeader)
+		return
+	}
+	writeData(w, s.owner.GCSafepoint())
+}
+
+// handleChangefeedAPI serves the requests of `/api/v1/changefeeds/{id}/...`,
+// only `GET /api/v1/changefeeds/{id}/tables` is supported now.
+func (s *Server) handleChangefeedAPI(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, apiV1ChangefeedsPrefix), "/")
+	if len(parts) != 2 || parts[1] != "tables" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportGetOnly.GenWithStackByArgs())
+		return
+	}
+	changefeedID := parts[0]
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	kvStorage := s.getKVStorage()
+	if s.capture == nil || kvStorage == nil {
+		writeError(w, http.StatusServiceUnavailable,
+			cerror.ErrInternalServerError.GenWithStack("the capture is not initialized"))
+		return
+	}
+	tables, err := ListChangefeedTables(req.Context(), s.capture.etcdClient, kvStorage,
+		changefeedID, req.URL.Query().Get(APIOpVarTableName))
+	if err != nil {
+		if cerror.ErrChangeFeedNotExists.Equal(err) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeInternalServerError(w, err)
+		return
+	}
+	writeData(w, tables)
+}
+
 func handleAdminLogLevel(w http.ResponseWriter, r *http.Request) {
 	var level string
 	data, err := ioutil.ReadAll(r.Body)
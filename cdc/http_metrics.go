@@ -0,0 +1,267 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/httputil"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// apiV1MetricsChangefeedsPrefix is the path prefix of the changefeed metrics in the v1 HTTP API
+const apiV1MetricsChangefeedsPrefix = "/api/v1/metrics/changefeeds/"
+
+// processorMetricsTimeout is the timeout of reading the metrics of a processor
+// from another capture
+const processorMetricsTimeout = 3 * time.Second
+
+// ProcessorMetrics holds the key health numbers of the processor of a
+// changefeed on a capture, the lags are in seconds.
+type ProcessorMetrics struct {
+	CheckpointTs  uint64  `json:"checkpoint-ts"`
+	CheckpointLag float64 `json:"checkpoint-lag"`
+	ResolvedTs    uint64  `json:"resolved-ts"`
+	ResolvedLag   float64 `json:"resolved-lag"`
+	TableCount    int     `json:"table-count"`
+	// OutputChanSize is the number of the events waiting to be sent to the sink
+	OutputChanSize int `json:"output-chan-size"`
+	// SinkFlushP99 is the 99th percentile of the duration (s) of flushing the
+	// events to the sink since the capture starts
+	SinkFlushP99 float64 `json:"sink-flush-p99"`
+	// Error is the primary error of the processor if it fails
+	Error string `json:"error,omitempty"`
+	// StatisticsWindow is the duration (s) covered by the table statistics,
+	// the tables and the stores are only returned if the window is requested
+	StatisticsWindow float64            `json:"statistics-window,omitempty"`
+	Tables           []*TableStatistics `json:"tables,omitempty"`
+	Stores           []*StoreStatistics `json:"stores,omitempty"`
+}
+
+// TableStatistics holds the rows and bytes of a table emitted to the sink by
+// a processor in the statistics window and since the processor starts
+type TableStatistics struct {
+	TableID    model.TableID `json:"table-id"`
+	Table      string        `json:"table"`
+	Rows       uint64        `json:"rows"`
+	Bytes      uint64        `json:"bytes"`
+	TotalRows  uint64        `json:"total-rows"`
+	TotalBytes uint64        `json:"total-bytes"`
+}
+
+// StoreStatistics holds the events and bytes pulled from a TiKV store by a
+// processor in the statistics window and since the processor starts
+type StoreStatistics struct {
+	StoreID     uint64 `json:"store-id"`
+	Events      uint64 `json:"events"`
+	Bytes       uint64 `json:"bytes"`
+	TotalEvents uint64 `json:"total-events"`
+	TotalBytes  uint64 `json:"total-bytes"`
+}
+
+// CaptureMetrics holds the numbers of a changefeed on a capture
+type CaptureMetrics struct {
+	AdvertiseAddr string `json:"address"`
+	// TableCount, CheckpointTs and ResolvedTs are read from etcd
+	TableCount   int    `json:"table-count"`
+	CheckpointTs uint64 `json:"checkpoint-ts"`
+	ResolvedTs   uint64 `json:"resolved-ts"`
+	// Processor is read from the capture running the processor, and
+	// ProcessorError is set instead if it can't be read.
+	Processor      *ProcessorMetrics `json:"processor,omitempty"`
+	ProcessorError string            `json:"processor-error,omitempty"`
+}
+
+// ChangefeedMetricsResp holds the key health numbers of a changefeed, the lags
+// are in seconds.
+type ChangefeedMetricsResp struct {
+	ID string `json:"id"`
+	// SampleTime is the time the numbers are sampled at
+	SampleTime    time.Time                           `json:"sample-time"`
+	State         model.FeedState                     `json:"state"`
+	Error         *model.RunningError                 `json:"error"`
+	CheckpointTs  uint64                              `json:"checkpoint-ts"`
+	CheckpointLag float64                             `json:"checkpoint-lag"`
+	ResolvedTs    uint64                              `json:"resolved-ts"`
+	ResolvedLag   float64                             `json:"resolved-lag"`
+	Captures      map[model.CaptureID]*CaptureMetrics `json:"captures"`
+}
+
+// handleChangefeedMetrics serves `GET /api/v1/metrics/changefeeds/{id}`, which
+// works on any capture. The numbers of the changefeed and the tables of each
+// capture are read from etcd, and the numbers of the processors are read from
+// the captures running them. With `local=true`, only the numbers of the
+// processor on this capture are returned. With `statistics-window={duration}`,
+// the rows and bytes of each table emitted to the sink and the events and
+// bytes pulled from each TiKV store in the window are returned with the
+// processors, the window is at most an hour.
+func (s *Server) handleChangefeedMetrics(w http.ResponseWriter, req *http.Request) {
+	changefeedID := strings.TrimPrefix(req.URL.Path, apiV1MetricsChangefeedsPrefix)
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportGetOnly.GenWithStackByArgs())
+		return
+	}
+	if err := model.ValidateChangefeedID(changefeedID); err != nil {
+		writeError(w, http.StatusBadRequest,
+			cerror.ErrAPIInvalidParam.GenWithStack("invalid changefeed id: %s", changefeedID))
+		return
+	}
+	if s.capture == nil {
+		writeError(w, http.StatusServiceUnavailable,
+			cerror.ErrInternalServerError.GenWithStack("the capture is not initialized"))
+		return
+	}
+	var window time.Duration
+	if windowStr := req.URL.Query().Get(APIOpVarStatisticsWindow); windowStr != "" {
+		var err error
+		window, err = time.ParseDuration(windowStr)
+		if err != nil || window <= 0 || window > maxStatisticsWindow {
+			writeError(w, http.StatusBadRequest,
+				cerror.ErrAPIInvalidParam.GenWithStack("invalid statistics window %s, it must be in (0, %s]", windowStr, maxStatisticsWindow))
+			return
+		}
+	}
+	now := time.Now()
+	if req.URL.Query().Get(APIOpVarLocal) == "true" {
+		p := s.capture.getProcessor(changefeedID)
+		if p == nil {
+			writeError(w, http.StatusNotFound, cerror.ErrProcessorNotFound.GenWithStackByArgs(changefeedID))
+			return
+		}
+		writeData(w, p.metrics(now, window))
+		return
+	}
+
+	ctx := req.Context()
+	cli := s.capture.etcdClient
+	info, err := cli.GetChangeFeedInfo(ctx, changefeedID)
+	if err != nil {
+		if cerror.ErrChangeFeedNotExists.Equal(err) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeInternalServerError(w, err)
+		return
+	}
+	resp := &ChangefeedMetricsResp{
+		ID:         changefeedID,
+		SampleTime: now,
+		State:      info.State,
+		Error:      info.Error,
+		Captures:   make(map[model.CaptureID]*CaptureMetrics),
+	}
+	status, _, err := cli.GetChangeFeedStatus(ctx, changefeedID)
+	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
+		writeInternalServerError(w, err)
+		return
+	}
+	if status != nil {
+		resp.CheckpointTs = status.CheckpointTs
+		resp.CheckpointLag = util.TsLag(now, status.CheckpointTs)
+		resp.ResolvedTs = status.ResolvedTs
+		resp.ResolvedLag = util.TsLag(now, status.ResolvedTs)
+	}
+	_, captures, err := cli.GetCaptures(ctx)
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	_, statuses, positions, err := cli.GetProcessorInfosOfLiveCaptures(ctx, changefeedID)
+	if err != nil {
+		writeInternalServerError(w, err)
+		return
+	}
+	for _, capture := range captures {
+		taskStatus, ok := statuses[capture.ID]
+		if !ok {
+			continue
+		}
+		m := &CaptureMetrics{AdvertiseAddr: capture.AdvertiseAddr, TableCount: len(taskStatus.Tables)}
+		if position, ok := positions[capture.ID]; ok {
+			m.CheckpointTs = position.CheckPointTs
+			m.ResolvedTs = position.ResolvedTs
+		}
+		if capture.ID == s.capture.info.ID {
+			if p := s.capture.getProcessor(changefeedID); p != nil {
+				m.Processor = p.metrics(now, window)
+			} else {
+				m.ProcessorError = cerror.ErrProcessorNotFound.GenWithStackByArgs(changefeedID).Error()
+			}
+		} else {
+			m.Processor, err = s.readProcessorMetrics(ctx, capture.AdvertiseAddr, changefeedID, window)
+			if err != nil {
+				log.Warn("failed to read the processor metrics",
+					zap.String("changefeed", changefeedID),
+					zap.String("capture", capture.AdvertiseAddr), zap.Error(err))
+				m.ProcessorError = err.Error()
+			}
+		}
+		resp.Captures[capture.ID] = m
+	}
+	writeData(w, resp)
+}
+
+// readProcessorMetrics reads the numbers of the processor of the changefeed
+// from another capture.
+func (s *Server) readProcessorMetrics(
+	ctx context.Context, addr string, changefeedID model.ChangeFeedID, window time.Duration,
+) (*ProcessorMetrics, error) {
+	scheme := "http"
+	if s.opts.credential != nil && s.opts.credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	cli, err := httputil.NewClient(s.opts.credential)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer cli.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(ctx, processorMetricsTimeout)
+	defer cancel()
+	uri := fmt.Sprintf("%s://%s%s%s?%s=true", scheme, addr, apiV1MetricsChangefeedsPrefix, changefeedID, APIOpVarLocal)
+	if window > 0 {
+		uri += fmt.Sprintf("&%s=%s", APIOpVarStatisticsWindow, window)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s, status code %d", string(body), resp.StatusCode)
+	}
+	m := new(ProcessorMetrics)
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return m, nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type httpMetricsSuite struct{}
+
+var _ = check.Suite(&httpMetricsSuite{})
+
+func newMetricsTestProcessor(changefeedID string, capture model.CaptureInfo, ts uint64, tableCount int) *processor {
+	p := newProcessorForTest()
+	p.changefeedID = changefeedID
+	p.captureInfo = capture
+	p.checkpointTs = ts
+	p.localResolvedTs = ts + 10
+	p.statistics = newProcessorStatistics(time.Now().Add(-time.Hour))
+	for i := 0; i < tableCount; i++ {
+		p.tables[int64(i)] = &tableInfo{id: int64(i)}
+	}
+	return p
+}
+
+func getChangefeedMetrics(handler http.HandlerFunc, uri string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, uri, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func (s *httpMetricsSuite) TestHandleChangefeedMetrics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	clientURL, e, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	defer e.Close()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	etcdCli := kv.NewCDCEtcdClient(ctx, client)
+	defer etcdCli.Close() //nolint:errcheck
+
+	const changefeedID = "test-changefeed"
+	ts := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	newServer := func(info *model.CaptureInfo) *Server {
+		return &Server{capture: &Capture{
+			etcdClient: etcdCli,
+			info:       info,
+			processors: make(map[string]*processor),
+		}}
+	}
+
+	// the remote capture is served by another status server
+	remoteInfo := &model.CaptureInfo{ID: "capture-remote"}
+	remote := newServer(remoteInfo)
+	remoteHTTP := httptest.NewServer(http.HandlerFunc(remote.handleChangefeedMetrics))
+	defer remoteHTTP.Close()
+	remoteInfo.AdvertiseAddr = strings.TrimPrefix(remoteHTTP.URL, "http://")
+	remoteProcessor := newMetricsTestProcessor(changefeedID, *remoteInfo, ts, 1)
+	remoteProcessor.errs.collect(errOriginSink, errors.New("downstream is unavailable"))
+	remote.capture.processors[changefeedID] = remoteProcessor
+
+	localInfo := &model.CaptureInfo{ID: "capture-local", AdvertiseAddr: "127.0.0.1:8300"}
+	local := newServer(localInfo)
+	localProcessor := newMetricsTestProcessor(changefeedID, *localInfo, ts, 2)
+	localProcessor.output <- outputRow{event: model.NewResolvedPolymorphicEvent(0, ts)}
+	local.capture.processors[changefeedID] = localProcessor
+
+	// the processor of the dead capture is skipped
+	deadInfo := &model.CaptureInfo{ID: "capture-dead", AdvertiseAddr: "127.0.0.1:1"}
+
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://", State: model.StateNormal}
+	c.Assert(etcdCli.SaveChangeFeedInfo(ctx, info, changefeedID), check.IsNil)
+	c.Assert(etcdCli.PutChangeFeedStatus(ctx, changefeedID, &model.ChangeFeedStatus{CheckpointTs: ts, ResolvedTs: ts + 10}), check.IsNil)
+	tableCounts := map[model.CaptureID]int{localInfo.ID: 2, remoteInfo.ID: 1, deadInfo.ID: 3}
+	for _, capture := range []*model.CaptureInfo{localInfo, remoteInfo, deadInfo} {
+		status := &model.TaskStatus{Tables: make(map[model.TableID]*model.TableReplicaInfo)}
+		for i := 0; i < tableCounts[capture.ID]; i++ {
+			status.Tables[model.TableID(i)] = &model.TableReplicaInfo{StartTs: ts}
+		}
+		c.Assert(etcdCli.PutTaskStatus(ctx, changefeedID, capture.ID, status), check.IsNil)
+		_, err := etcdCli.PutTaskPositionOnChange(ctx, changefeedID, capture.ID, &model.TaskPosition{CheckPointTs: ts, ResolvedTs: ts + 5})
+		c.Assert(err, check.IsNil)
+		if capture != deadInfo {
+			c.Assert(etcdCli.PutCaptureInfo(ctx, capture, clientv3.NoLease), check.IsNil)
+		}
+	}
+
+	rec := getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+changefeedID)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	resp := new(ChangefeedMetricsResp)
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), resp), check.IsNil)
+	c.Assert(resp.ID, check.Equals, changefeedID)
+	c.Assert(resp.SampleTime.IsZero(), check.IsFalse)
+	c.Assert(resp.State, check.Equals, model.StateNormal)
+	c.Assert(resp.CheckpointTs, check.Equals, ts)
+	c.Assert(resp.ResolvedTs, check.Equals, ts+10)
+	c.Assert(resp.CheckpointLag >= 60, check.IsTrue)
+	c.Assert(resp.Captures, check.HasLen, 2)
+
+	localMetrics := resp.Captures[localInfo.ID]
+	c.Assert(localMetrics.TableCount, check.Equals, 2)
+	c.Assert(localMetrics.ResolvedTs, check.Equals, ts+5)
+	c.Assert(localMetrics.Processor, check.NotNil)
+	c.Assert(localMetrics.Processor.CheckpointTs, check.Equals, ts)
+	c.Assert(localMetrics.Processor.ResolvedTs, check.Equals, ts+10)
+	c.Assert(localMetrics.Processor.TableCount, check.Equals, 2)
+	c.Assert(localMetrics.Processor.OutputChanSize, check.Equals, 1)
+	c.Assert(localMetrics.Processor.Error, check.Equals, "")
+
+	// the numbers of the remote processor are read from the remote capture
+	remoteMetrics := resp.Captures[remoteInfo.ID]
+	c.Assert(remoteMetrics.AdvertiseAddr, check.Equals, remoteInfo.AdvertiseAddr)
+	c.Assert(remoteMetrics.TableCount, check.Equals, 1)
+	c.Assert(remoteMetrics.ProcessorError, check.Equals, "")
+	c.Assert(remoteMetrics.Processor, check.NotNil)
+	c.Assert(remoteMetrics.Processor.TableCount, check.Equals, 1)
+	c.Assert(remoteMetrics.Processor.Error, check.Matches, ".*sink: downstream is unavailable")
+
+	// the table statistics are returned with the window
+	emitted := func(table string, size int64) []*model.PolymorphicEvent {
+		return []*model.PolymorphicEvent{{Row: &model.RowChangedEvent{
+			Table: &model.TableName{Schema: "test", Table: table, TableID: 1}, ApproximateSize: size,
+		}}}
+	}
+	localProcessor.statistics.observe(emitted("t1", 10), time.Now())
+	remoteProcessor.statistics.observe(emitted("t1", 20), time.Now())
+	c.Assert(resp.Captures[localInfo.ID].Processor.Tables, check.HasLen, 0)
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+changefeedID+"?statistics-window=10m")
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	resp = new(ChangefeedMetricsResp)
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), resp), check.IsNil)
+	for id, size := range map[model.CaptureID]uint64{localInfo.ID: 10, remoteInfo.ID: 20} {
+		p := resp.Captures[id].Processor
+		c.Assert(p.StatisticsWindow > 540 && p.StatisticsWindow <= 600, check.IsTrue)
+		c.Assert(p.Tables, check.DeepEquals, []*TableStatistics{
+			{TableID: 1, Table: "`test`.`t1`", Rows: 1, Bytes: size, TotalRows: 1, TotalBytes: size},
+		})
+	}
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+changefeedID+"?statistics-window=2h")
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+
+	// the processor is removed from the remote capture
+	remote.capture.procLock.Lock()
+	delete(remote.capture.processors, changefeedID)
+	remote.capture.procLock.Unlock()
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+changefeedID)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	resp = new(ChangefeedMetricsResp)
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), resp), check.IsNil)
+	c.Assert(resp.Captures[remoteInfo.ID].Processor, check.IsNil)
+	c.Assert(resp.Captures[remoteInfo.ID].ProcessorError, check.Matches, ".*processor of changefeed test-changefeed not found.*")
+
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+"not-exist")
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+"not-exist?local=true")
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+	rec = getChangefeedMetrics(local.handleChangefeedMetrics, apiV1MetricsChangefeedsPrefix+"invalid/id")
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	req := httptest.NewRequest(http.MethodPost, apiV1MetricsChangefeedsPrefix+changefeedID, nil)
+	rec = httptest.NewRecorder()
+	local.handleChangefeedMetrics(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *httpMetricsSuite) TestObservedQuantile(c *check.C) {
+	defer testleak.AfterTest(c)()
+	observer := sinkFlushRowChangedDuration.WithLabelValues("test-quantile", "127.0.0.1:8300")
+	p99, err := observedQuantile(observer, 0.99)
+	c.Assert(err, check.IsNil)
+	c.Assert(p99, check.Equals, float64(0))
+
+	// the upper bounds of the buckets are 0.002, 0.004, 0.008, ...
+	for i := 0; i < 98; i++ {
+		observer.Observe(0.001)
+	}
+	observer.Observe(0.003)
+	observer.Observe(0.003)
+	p50, err := observedQuantile(observer, 0.5)
+	c.Assert(err, check.IsNil)
+	c.Assert(p50 > 0 && p50 <= 0.002, check.IsTrue)
+	p99, err = observedQuantile(observer, 0.99)
+	c.Assert(err, check.IsNil)
+	c.Assert(p99, check.Equals, 0.003)
+
+	// the upper bound of the highest bucket is returned for the +Inf bucket
+	for i := 0; i < 1000; i++ {
+		observer.Observe(3600)
+	}
+	p99, err = observedQuantile(observer, 0.99)
+	c.Assert(err, check.IsNil)
+	c.Assert(p99, check.Equals, 0.002*float64(1<<19))
+}
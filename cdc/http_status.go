@@ -27,6 +27,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/kv"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/leaktest"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/version"
 	"github.com/prometheus/client_golang/prometheus"
@@ -46,11 +47,23 @@ func (s *Server) startStatusHTTP() error {
 
 	serverMux.HandleFunc("/status", s.handleStatus)
 	serverMux.HandleFunc("/debug/info", s.handleDebugInfo)
+	serverMux.HandleFunc("/debug/goroutines", handleDebugGoroutines)
 	serverMux.HandleFunc("/capture/owner/resign", s.handleResignOwner)
 	serverMux.HandleFunc("/capture/owner/admin", s.handleChangefeedAdmin)
 	serverMux.HandleFunc("/capture/owner/rebalance_trigger", s.handleRebalanceTrigger)
+	serverMux.HandleFunc("/capture/owner/rebalance_plan", s.handleRebalancePlan)
 	serverMux.HandleFunc("/capture/owner/move_table", s.handleMoveTable)
+	serverMux.HandleFunc("/capture/owner/schema_bootstrap", s.handleSchemaBootstrap)
+	serverMux.HandleFunc("/capture/owner/skip_ddl", s.handleSkipDDL)
 	serverMux.HandleFunc("/capture/owner/changefeed/query", s.handleChangefeedQuery)
+	serverMux.HandleFunc("/capture/owner/changefeed/history", s.handleChangefeedHistory)
+	serverMux.HandleFunc("/capture/owner/changefeed/budget", s.handleUpdateBudget)
+	serverMux.HandleFunc("/capture/owner/changefeed/reset_breaker", s.handleResetBreaker)
+	serverMux.HandleFunc("/capture/owner/gc", s.handleGCSafepoint)
+	serverMux.HandleFunc("/capture/owner/gc/refresh", s.handleRefreshGCSafepoint)
+	serverMux.HandleFunc(apiV1ChangefeedsPrefix, s.handleChangefeedAPI)
+	serverMux.HandleFunc(apiV1MetricsChangefeedsPrefix, s.handleChangefeedMetrics)
+	serverMux.HandleFunc(apiV1ConfigSchemaPath, handleConfigSchema)
 
 	serverMux.HandleFunc("/admin/log", handleAdminLogLevel)
 
@@ -89,15 +102,17 @@ func (s *Server) startStatusHTTP() error {
 
 // status of cdc server
 type status struct {
-	Version string `json:"version"`
-	GitHash string `json:"git_hash"`
-	ID      string `json:"id"`
-	Pid     int    `json:"pid"`
-	IsOwner bool   `json:"is_owner"`
+	Version    string `json:"version"`
+	GitHash    string `json:"git_hash"`
+	ID         string `json:"id"`
+	Pid        int    `json:"pid"`
+	IsOwner    bool   `json:"is_owner"`
+	IsObserver bool   `json:"is_observer,omitempty"`
+	ClusterID  string `json:"cluster_id,omitempty"`
 }
 
 func (s *Server) writeEtcdInfo(ctx context.Context, cli kv.CDCEtcdClient, w io.Writer) {
-	resp, err := cli.Client.Get(ctx, kv.EtcdKeyBase, clientv3.WithPrefix())
+	resp, err := cli.Client.Get(ctx, cli.KeyBase()+"/", clientv3.WithPrefix())
 	if err != nil {
 		fmt.Fprintf(w, "failed to get info: %s\n\n", err.Error())
 		return
@@ -124,18 +139,31 @@ func (s *Server) handleDebugInfo(w http.ResponseWriter, req *http.Request) {
 	s.writeEtcdInfo(req.Context(), s.capture.etcdClient, w)
 }
 
+// handleDebugGoroutines summarizes the goroutines registered by the
+// components, the ones outliving their changefeeds or tables are flagged as
+// orphans.
+func handleDebugGoroutines(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, cerror.ErrSupportGetOnly.GenWithStackByArgs())
+		return
+	}
+	writeData(w, leaktest.Summarize())
+}
+
 func (s *Server) handleStatus(w http.ResponseWriter, req *http.Request) {
 	s.ownerLock.RLock()
 	defer s.ownerLock.RUnlock()
 	st := status{
-		Version: version.ReleaseVersion,
-		GitHash: version.GitHash,
-		Pid:     os.Getpid(),
+		Version:   version.ReleaseVersion,
+		GitHash:   version.GitHash,
+		Pid:       os.Getpid(),
+		ClusterID: s.opts.clusterID,
 	}
 	if s.capture != nil {
 		st.ID = s.capture.info.ID
 	}
 	st.IsOwner = s.owner != nil
+	st.IsObserver = s.isObserver()
 	writeData(w, st)
 }
 
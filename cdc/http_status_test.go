@@ -14,6 +14,7 @@
 package cdc
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/pingcap/check"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/leaktest"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	"go.etcd.io/etcd/clientv3/concurrency"
 )
@@ -72,6 +74,8 @@ func (s *httpStatusSuite) TestHTTPStatus(c *check.C) {
 	testHandleRebalance(c)
 	testHandleMoveTable(c)
 	testHandleChangefeedQuery(c)
+	testHandleGCSafepoint(c)
+	testHandleDebugGoroutines(c)
 }
 
 func testPprof(c *check.C) {
@@ -113,6 +117,37 @@ func testHandleChangefeedQuery(c *check.C) {
 	testRequestNonOwnerFailed(c, uri)
 }
 
+func testHandleGCSafepoint(c *check.C) {
+	uri := fmt.Sprintf("http://%s/capture/owner/gc/refresh", testingServerOptions.advertiseAddr)
+	testHTTPPostOnly(c, uri)
+	testRequestNonOwnerFailed(c, uri)
+
+	uri = fmt.Sprintf("http://%s/capture/owner/gc", testingServerOptions.advertiseAddr)
+	resp, err := http.Get(uri)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusBadRequest)
+	c.Assert(string(data), check.Equals, concurrency.ErrElectionNotLeader.Error())
+}
+
+func testHandleDebugGoroutines(c *check.C) {
+	uri := fmt.Sprintf("http://%s/debug/goroutines", testingServerOptions.advertiseAddr)
+	resp, err := http.Get(uri)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	var summary leaktest.Summary
+	c.Assert(json.NewDecoder(resp.Body).Decode(&summary), check.IsNil)
+	c.Assert(summary.Goroutines, check.Greater, 0)
+
+	resp, err = http.PostForm(uri, url.Values{})
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusBadRequest)
+}
+
 func testHTTPPostOnly(c *check.C, uri string) {
 	resp, err := http.Get(uri)
 	c.Assert(err, check.IsNil)
@@ -402,6 +402,29 @@ type PullerInitialization interface {
 	IsInitialized() bool
 }
 
+// IncrementalScanObserver observes the progress of the incremental scan of
+// regions. The PullerInitialization passed to EventFeed can optionally
+// implement it to receive the progress.
+type IncrementalScanObserver interface {
+	// OnRegionStart is called when a region starts the incremental scan.
+	OnRegionStart()
+	// OnRegionScanned is called when rows are received before the region
+	// finishes the incremental scan.
+	OnRegionScanned(rows, bytes int)
+	// OnRegionInitialized is called when a region finishes the incremental scan.
+	OnRegionInitialized()
+	// OnRegionStop is called when the event feed of a region stops,
+	// initialized tells whether the region has finished the incremental scan.
+	OnRegionStop(initialized bool)
+}
+
+type noopScanObserver struct{}
+
+func (noopScanObserver) OnRegionStart()           {}
+func (noopScanObserver) OnRegionScanned(int, int) {}
+func (noopScanObserver) OnRegionInitialized()     {}
+func (noopScanObserver) OnRegionStop(bool)        {}
+
 // EventFeed divides a EventFeed request on range boundaries and establishes
 // a EventFeed to each of the individual region. It streams back result on the
 // provided channel.
@@ -437,6 +460,7 @@ type eventFeedSession struct {
 
 	lockResolver txnutil.LockResolver
 	isPullerInit PullerInitialization
+	scanObserver IncrementalScanObserver
 
 	// The whole range that is being subscribed.
 	totalSpan regionspan.ComparableSpan
@@ -478,6 +502,10 @@ func newEventFeedSession(
 	eventCh chan<- *model.RegionFeedEvent,
 ) *eventFeedSession {
 	id := strconv.FormatUint(allocID(), 10)
+	scanObserver, ok := isPullerInit.(IncrementalScanObserver)
+	if !ok {
+		scanObserver = noopScanObserver{}
+	}
 	return &eventFeedSession{
 		client:            client,
 		regionCache:       regionCache,
@@ -491,6 +519,7 @@ func newEventFeedSession(
 		enableOldValue:    enableOldValue,
 		lockResolver:      lockResolver,
 		isPullerInit:      isPullerInit,
+		scanObserver:      scanObserver,
 		id:                id,
 		regionChSizeGauge: clientChannelSize.WithLabelValues(id, "region"),
 		errChSizeGauge:    clientChannelSize.WithLabelValues(id, "err"),
@@ -1046,6 +1075,11 @@ func (s *eventFeedSession) receiveFromStream(
 	captureAddr := util.CaptureAddrFromCtx(ctx)
 	changefeedID := util.ChangefeedIDFromCtx(ctx)
 	metricSendEventBatchResolvedSize := batchResolvedEventSize.WithLabelValues(captureAddr, changefeedID)
+	// the pullers out of a changefeed, e.g. in the tests, aren't counted
+	var pullStats *storePullStats
+	if changefeedID != "" {
+		pullStats = defaultStorePullRegistry.get(captureAddr, changefeedID).store(storeID)
+	}
 
 	// Each region has it's own goroutine to handle its messages. `regionStates` stores states of these regions.
 	regionStates := make(map[uint64]*regionFeedState)
@@ -1099,6 +1133,16 @@ func (s *eventFeedSession) receiveFromStream(
 				zap.Int("size", size), zap.Int("event length", len(cevent.Events)),
 				zap.Int("resolved region count", regionCount))
 		}
+		if pullStats != nil {
+			events := len(cevent.Events)
+			if cevent.ResolvedTs != nil {
+				events++
+			}
+			err = pullStats.observe(ctx, size, events)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
 
 		for _, event := range cevent.Events {
 			err = s.sendRegionChangeEvent(ctx, g, event, regionStates, pendingRegions, addr, limiter)
@@ -1241,6 +1285,10 @@ func (s *eventFeedSession) singleEventFeed(
 	metricSendEventCommittedCounter := sendEventCounter.WithLabelValues("committed", captureAddr, changefeedID)
 
 	initialized := false
+	s.scanObserver.OnRegionStart()
+	defer func() {
+		s.scanObserver.OnRegionStop(initialized)
+	}()
 
 	matcher := newMatcher()
 	advanceCheckTicker := time.NewTicker(time.Second * 5)
@@ -1345,6 +1393,18 @@ func (s *eventFeedSession) singleEventFeed(
 			metricEventSize.Observe(float64(event.changeEvent.Event.Size()))
 			switch x := event.changeEvent.Event.(type) {
 			case *cdcpb.Event_Entries_:
+				if !initialized {
+					rows, bytes := 0, 0
+					for _, entry := range x.Entries.GetEntries() {
+						if entry.Type != cdcpb.Event_INITIALIZED {
+							rows++
+							bytes += len(entry.Key) + len(entry.Value) + len(entry.OldValue)
+						}
+					}
+					if rows > 0 {
+						s.scanObserver.OnRegionScanned(rows, bytes)
+					}
+				}
 				for _, entry := range x.Entries.GetEntries() {
 					switch entry.Type {
 					case cdcpb.Event_INITIALIZED:
@@ -1354,6 +1414,9 @@ func (s *eventFeedSession) singleEventFeed(
 								zap.Uint64("regionID", regionID))
 						}
 						metricPullEventInitializedCounter.Inc()
+						if !initialized {
+							s.scanObserver.OnRegionInitialized()
+						}
 						initialized = true
 						for _, cacheEntry := range matcher.cachedCommit {
 							value, ok := matcher.matchRow(cacheEntry)
@@ -17,6 +17,7 @@ import (
 	"context"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -749,6 +750,130 @@ func (s *etcdSuite) TestHandleFeedEvent(c *check.C) {
 	cancel()
 }
 
+type mockScanObserver struct {
+	mockPullerInit
+	regions     int64
+	initialized int64
+	rows        int64
+	bytes       int64
+}
+
+func (o *mockScanObserver) OnRegionStart() {
+	atomic.AddInt64(&o.regions, 1)
+}
+
+func (o *mockScanObserver) OnRegionScanned(rows, bytes int) {
+	atomic.AddInt64(&o.rows, int64(rows))
+	atomic.AddInt64(&o.bytes, int64(bytes))
+}
+
+func (o *mockScanObserver) OnRegionInitialized() {
+	atomic.AddInt64(&o.initialized, 1)
+}
+
+func (o *mockScanObserver) OnRegionStop(initialized bool) {
+	atomic.AddInt64(&o.regions, -1)
+	if initialized {
+		atomic.AddInt64(&o.initialized, -1)
+	}
+}
+
+func (s *etcdSuite) TestIncrementalScanProgress(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	ch1 := make(chan *cdcpb.ChangeDataEvent, 10)
+	srv1 := newMockChangeDataService(c, ch1)
+	server1, addr1 := newMockService(ctx, c, srv1, wg)
+	defer func() {
+		close(ch1)
+		server1.Stop()
+		wg.Wait()
+	}()
+	// Cancel first, and then close the server.
+	defer cancel()
+
+	rpcClient, cluster, pdClient, err := mocktikv.NewTiKVAndPDClient("")
+	c.Assert(err, check.IsNil)
+	pdClient = &mockPDClient{Client: pdClient, version: version.MinTiKVVersion.String()}
+	defer pdClient.Close() //nolint:errcheck
+	kvStorage, err := tikv.NewTestTiKVStore(rpcClient, pdClient, nil, nil, 0)
+	c.Assert(err, check.IsNil)
+	defer kvStorage.Close() //nolint:errcheck
+
+	cluster.AddStore(1, addr1)
+	cluster.Bootstrap(3, []uint64{1}, []uint64{4}, 4)
+
+	baseAllocatedID := currentRequestID()
+	lockresolver := txnutil.NewLockerResolver(kvStorage.(tikv.Storage))
+	observer := &mockScanObserver{}
+	cdcClient := NewCDCClient(ctx, pdClient, kvStorage.(tikv.Storage), &security.Credential{})
+	eventCh := make(chan *model.RegionFeedEvent, 10)
+	wg.Add(1)
+	go func() {
+		err := cdcClient.EventFeed(ctx, regionspan.ComparableSpan{Start: []byte("a"), End: []byte("b")}, 1, false, lockresolver, observer, eventCh)
+		c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+		cdcClient.Close() //nolint:errcheck
+		wg.Done()
+	}()
+
+	// new session, new request
+	waitRequestID(c, baseAllocatedID+1)
+
+	scanned := &cdcpb.ChangeDataEvent{Events: []*cdcpb.Event{
+		{
+			RegionId:  3,
+			RequestId: currentRequestID(),
+			Event: &cdcpb.Event_Entries_{
+				Entries: &cdcpb.Event_Entries{
+					Entries: []*cdcpb.Event_Row{{
+						Type:     cdcpb.Event_COMMITTED,
+						OpType:   cdcpb.Event_Row_PUT,
+						Key:      []byte("aaa"),
+						Value:    []byte("value"),
+						StartTs:  1,
+						CommitTs: 2,
+					}, {
+						Type:     cdcpb.Event_COMMITTED,
+						OpType:   cdcpb.Event_Row_PUT,
+						Key:      []byte("aab"),
+						Value:    []byte("value"),
+						StartTs:  1,
+						CommitTs: 2,
+					}},
+				},
+			},
+		},
+	}}
+	ch1 <- scanned
+	// the resolved event with the start ts and the scanned rows
+	for i := 0; i < 3; i++ {
+		select {
+		case <-eventCh:
+		case <-time.After(time.Second):
+			c.Fatalf("recving message takes too long")
+		}
+	}
+	c.Assert(atomic.LoadInt64(&observer.regions), check.Equals, int64(1))
+	c.Assert(atomic.LoadInt64(&observer.initialized), check.Equals, int64(0))
+	c.Assert(atomic.LoadInt64(&observer.rows), check.Equals, int64(2))
+	c.Assert(atomic.LoadInt64(&observer.bytes), check.Equals, int64(16))
+
+	ch1 <- mockInitializedEvent(3 /* regionID */, currentRequestID())
+	err = retry.Run(time.Millisecond*20, 10, func() error {
+		if atomic.LoadInt64(&observer.initialized) == 1 {
+			return nil
+		}
+		return errors.New("region is not initialized")
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt64(&observer.regions), check.Equals, int64(1))
+	// the INITIALIZED entry is not counted as a scanned row
+	c.Assert(atomic.LoadInt64(&observer.rows), check.Equals, int64(2))
+	cancel()
+}
+
 // TODO enable the test
 func (s *etcdSuite) TodoTestIncompatibleTiKV(c *check.C) {
 	rpcClient, cluster, pdClient, err := mocktikv.NewTiKVAndPDClient("")
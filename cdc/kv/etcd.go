@@ -15,6 +15,7 @@ package kv
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -36,80 +37,152 @@ import (
 const (
 	// EtcdKeyBase is the common prefix of the keys in CDC
 	EtcdKeyBase = "/tidb/cdc"
-	// CaptureOwnerKey is the capture owner path that is saved to etcd
-	CaptureOwnerKey = EtcdKeyBase + "/owner"
-	// CaptureInfoKeyPrefix is the capture info path that is saved to etcd
-	CaptureInfoKeyPrefix = EtcdKeyBase + "/capture"
+)
 
-	// TaskKeyPrefix is the prefix of task keys
-	TaskKeyPrefix = EtcdKeyBase + "/task"
+// GetEtcdKeyBase returns the common prefix of the keys of a TiCDC cluster.
+// The keys of the default cluster (with an empty cluster ID) are prefixed
+// with EtcdKeyBase for compatibility.
+func GetEtcdKeyBase(clusterID string) string {
+	if clusterID == "" {
+		return EtcdKeyBase
+	}
+	return EtcdKeyBase + "-" + clusterID
+}
 
-	// TaskWorkloadKeyPrefix is the prefix of task workload keys
-	TaskWorkloadKeyPrefix = TaskKeyPrefix + "/workload"
+// KeyBase returns the common prefix of the keys of the cluster
+func (c CDCEtcdClient) KeyBase() string {
+	return GetEtcdKeyBase(c.ClusterID)
+}
 
-	// TaskStatusKeyPrefix is the prefix of task status keys
-	TaskStatusKeyPrefix = TaskKeyPrefix + "/status"
+// CaptureOwnerKey returns the capture owner path that is saved to etcd
+func (c CDCEtcdClient) CaptureOwnerKey() string {
+	return c.KeyBase() + "/owner"
+}
 
-	// TaskPositionKeyPrefix is the prefix of task position keys
-	TaskPositionKeyPrefix = TaskKeyPrefix + "/position"
+// CaptureInfoKeyPrefix returns the capture info path that is saved to etcd
+func (c CDCEtcdClient) CaptureInfoKeyPrefix() string {
+	return c.KeyBase() + "/capture"
+}
 
-	// JobKeyPrefix is the prefix of job keys
-	JobKeyPrefix = EtcdKeyBase + "/job"
-)
+// TaskKeyPrefix returns the prefix of task keys
+func (c CDCEtcdClient) TaskKeyPrefix() string {
+	return c.KeyBase() + "/task"
+}
+
+// TaskWorkloadKeyPrefix returns the prefix of task workload keys
+func (c CDCEtcdClient) TaskWorkloadKeyPrefix() string {
+	return c.TaskKeyPrefix() + "/workload"
+}
+
+// TaskStatusKeyPrefix returns the prefix of task status keys
+func (c CDCEtcdClient) TaskStatusKeyPrefix() string {
+	return c.TaskKeyPrefix() + "/status"
+}
+
+// TaskTablesKeyPrefix returns the prefix of task tables keys. The tables of a
+// task status are stored apart from the operations in the task status key, as
+// the tables are mostly static and huge for a capture holding many tables,
+// while the operations change on every scheduling.
+func (c CDCEtcdClient) TaskTablesKeyPrefix() string {
+	return c.TaskKeyPrefix() + "/tables"
+}
+
+// TaskPositionKeyPrefix returns the prefix of task position keys
+func (c CDCEtcdClient) TaskPositionKeyPrefix() string {
+	return c.TaskKeyPrefix() + "/position"
+}
+
+// DirtyStopKeyPrefix returns the prefix of the dirty stop keys
+func (c CDCEtcdClient) DirtyStopKeyPrefix() string {
+	return c.KeyBase() + "/dirty-stop"
+}
+
+// CheckpointGuardKeyPrefix returns the prefix of the checkpoint guard keys
+func (c CDCEtcdClient) CheckpointGuardKeyPrefix() string {
+	return c.KeyBase() + "/checkpoint-guard"
+}
+
+// JobKeyPrefix returns the prefix of job keys
+func (c CDCEtcdClient) JobKeyPrefix() string {
+	return c.KeyBase() + "/job"
+}
 
 // GetEtcdKeyChangeFeedList returns the prefix key of all changefeed config
-func GetEtcdKeyChangeFeedList() string {
-	return fmt.Sprintf("%s/changefeed/info", EtcdKeyBase)
+func (c CDCEtcdClient) GetEtcdKeyChangeFeedList() string {
+	return fmt.Sprintf("%s/changefeed/info", c.KeyBase())
 }
 
 // GetEtcdKeyChangeFeedInfo returns the key of a changefeed config
-func GetEtcdKeyChangeFeedInfo(changefeedID string) string {
-	return fmt.Sprintf("%s/%s", GetEtcdKeyChangeFeedList(), changefeedID)
+func (c CDCEtcdClient) GetEtcdKeyChangeFeedInfo(changefeedID string) string {
+	return fmt.Sprintf("%s/%s", c.GetEtcdKeyChangeFeedList(), changefeedID)
 }
 
 // GetEtcdKeyChangeFeedStatus returns the key of a changefeed status
-func GetEtcdKeyChangeFeedStatus(changefeedID string) string {
-	return GetEtcdKeyJob(changefeedID)
+func (c CDCEtcdClient) GetEtcdKeyChangeFeedStatus(changefeedID string) string {
+	return c.GetEtcdKeyJob(changefeedID)
+}
+
+// GetEtcdKeyChangeFeedHistory returns the key of a changefeed event history
+func (c CDCEtcdClient) GetEtcdKeyChangeFeedHistory(changefeedID string) string {
+	return fmt.Sprintf("%s/changefeed/history/%s", c.KeyBase(), changefeedID)
 }
 
 // GetEtcdKeyTaskStatusList returns the key of a task status without captureID part
-func GetEtcdKeyTaskStatusList(changefeedID string) string {
-	return fmt.Sprintf("%s/changefeed/task/status/%s", EtcdKeyBase, changefeedID)
+func (c CDCEtcdClient) GetEtcdKeyTaskStatusList(changefeedID string) string {
+	return fmt.Sprintf("%s/changefeed/task/status/%s", c.KeyBase(), changefeedID)
 }
 
 // GetEtcdKeyTaskPositionList returns the key of a task position without captureID part
-func GetEtcdKeyTaskPositionList(changefeedID string) string {
-	return fmt.Sprintf("%s/changefeed/task/position/%s", EtcdKeyBase, changefeedID)
+func (c CDCEtcdClient) GetEtcdKeyTaskPositionList(changefeedID string) string {
+	return fmt.Sprintf("%s/changefeed/task/position/%s", c.KeyBase(), changefeedID)
 }
 
 // GetEtcdKeyTaskPosition returns the key of a task position
-func GetEtcdKeyTaskPosition(changefeedID, captureID string) string {
-	return TaskPositionKeyPrefix + "/" + captureID + "/" + changefeedID
+func (c CDCEtcdClient) GetEtcdKeyTaskPosition(changefeedID, captureID string) string {
+	return c.TaskPositionKeyPrefix() + "/" + captureID + "/" + changefeedID
 }
 
 // GetEtcdKeyCaptureInfo returns the key of a capture info
-func GetEtcdKeyCaptureInfo(id string) string {
-	return CaptureInfoKeyPrefix + "/" + id
+func (c CDCEtcdClient) GetEtcdKeyCaptureInfo(id string) string {
+	return c.CaptureInfoKeyPrefix() + "/" + id
 }
 
 // GetEtcdKeyTaskStatus returns the key for the task status
-func GetEtcdKeyTaskStatus(changeFeedID, captureID string) string {
-	return TaskStatusKeyPrefix + "/" + captureID + "/" + changeFeedID
+func (c CDCEtcdClient) GetEtcdKeyTaskStatus(changeFeedID, captureID string) string {
+	return c.TaskStatusKeyPrefix() + "/" + captureID + "/" + changeFeedID
+}
+
+// GetEtcdKeyTaskTables returns the key for the tables of the task status
+func (c CDCEtcdClient) GetEtcdKeyTaskTables(changeFeedID, captureID string) string {
+	return c.TaskTablesKeyPrefix() + "/" + captureID + "/" + changeFeedID
 }
 
 // GetEtcdKeyTaskWorkload returns the key for the task workload
-func GetEtcdKeyTaskWorkload(changeFeedID, captureID string) string {
-	return TaskWorkloadKeyPrefix + "/" + captureID + "/" + changeFeedID
+func (c CDCEtcdClient) GetEtcdKeyTaskWorkload(changeFeedID, captureID string) string {
+	return c.TaskWorkloadKeyPrefix() + "/" + captureID + "/" + changeFeedID
+}
+
+// GetEtcdKeyDirtyStop returns the key for the dirty stop of a processor
+func (c CDCEtcdClient) GetEtcdKeyDirtyStop(changeFeedID, captureID string) string {
+	return c.DirtyStopKeyPrefix() + "/" + changeFeedID + "/" + captureID
+}
+
+// GetEtcdKeyCheckpointGuard returns the key for the checkpoint guard of a processor
+func (c CDCEtcdClient) GetEtcdKeyCheckpointGuard(changeFeedID, captureID string) string {
+	return c.CheckpointGuardKeyPrefix() + "/" + changeFeedID + "/" + captureID
 }
 
 // GetEtcdKeyJob returns the key for a job status
-func GetEtcdKeyJob(changeFeedID string) string {
-	return JobKeyPrefix + "/" + changeFeedID
+func (c CDCEtcdClient) GetEtcdKeyJob(changeFeedID string) string {
+	return c.JobKeyPrefix() + "/" + changeFeedID
 }
 
 // CDCEtcdClient is a wrap of etcd client
 type CDCEtcdClient struct {
 	Client *etcd.Client
+	// ClusterID namespaces the keys of the TiCDC cluster, so that multiple
+	// TiCDC clusters can share one etcd.
+	ClusterID string
 }
 
 // NewCDCEtcdClient returns a new CDCEtcdClient
@@ -123,7 +196,7 @@ func NewCDCEtcdClient(ctx context.Context, cli *clientv3.Client) CDCEtcdClient {
 		etcd.EtcdGrant:  etcdRequestCounter.WithLabelValues(etcd.EtcdGrant, captureAddr),
 		etcd.EtcdRevoke: etcdRequestCounter.WithLabelValues(etcd.EtcdRevoke, captureAddr),
 	}
-	return CDCEtcdClient{Client: etcd.Wrap(cli, metrics)}
+	return CDCEtcdClient{Client: etcd.Wrap(cli, metrics), ClusterID: util.ClusterIDFromCtx(ctx)}
 }
 
 // Close releases resources in CDCEtcdClient
@@ -133,13 +206,13 @@ func (c CDCEtcdClient) Close() error {
 
 // ClearAllCDCInfo delete all keys created by CDC
 func (c CDCEtcdClient) ClearAllCDCInfo(ctx context.Context) error {
-	_, err := c.Client.Delete(ctx, EtcdKeyBase, clientv3.WithPrefix())
+	_, err := c.Client.Delete(ctx, c.KeyBase()+"/", clientv3.WithPrefix())
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
 // GetAllCDCInfo get all keys created by CDC
 func (c CDCEtcdClient) GetAllCDCInfo(ctx context.Context) ([]*mvccpb.KeyValue, error) {
-	resp, err := c.Client.Get(ctx, EtcdKeyBase, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.KeyBase()+"/", clientv3.WithPrefix())
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -159,7 +232,7 @@ func (c CDCEtcdClient) RevokeAllLeases(ctx context.Context, leases map[string]in
 
 // GetChangeFeeds returns kv revision and a map mapping from changefeedID to changefeed detail mvccpb.KeyValue
 func (c CDCEtcdClient) GetChangeFeeds(ctx context.Context) (int64, map[string]*mvccpb.KeyValue, error) {
-	key := GetEtcdKeyChangeFeedList()
+	key := c.GetEtcdKeyChangeFeedList()
 
 	resp, err := c.Client.Get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
@@ -179,7 +252,7 @@ func (c CDCEtcdClient) GetChangeFeeds(ctx context.Context) (int64, map[string]*m
 
 // GetChangeFeedInfo queries the config of a given changefeed
 func (c CDCEtcdClient) GetChangeFeedInfo(ctx context.Context, id string) (*model.ChangeFeedInfo, error) {
-	key := GetEtcdKeyChangeFeedInfo(id)
+	key := c.GetEtcdKeyChangeFeedInfo(id)
 	resp, err := c.Client.Get(ctx, key)
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -194,14 +267,14 @@ func (c CDCEtcdClient) GetChangeFeedInfo(ctx context.Context, id string) (*model
 
 // DeleteChangeFeedInfo deletes a changefeed config from etcd
 func (c CDCEtcdClient) DeleteChangeFeedInfo(ctx context.Context, id string) error {
-	key := GetEtcdKeyChangeFeedInfo(id)
+	key := c.GetEtcdKeyChangeFeedInfo(id)
 	_, err := c.Client.Delete(ctx, key)
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
 // GetAllChangeFeedStatus queries all changefeed job status
 func (c CDCEtcdClient) GetAllChangeFeedStatus(ctx context.Context) (map[string]*model.ChangeFeedStatus, error) {
-	key := JobKeyPrefix
+	key := c.JobKeyPrefix()
 	resp, err := c.Client.Get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -224,7 +297,7 @@ func (c CDCEtcdClient) GetAllChangeFeedStatus(ctx context.Context) (map[string]*
 
 // GetChangeFeedStatus queries the checkpointTs and resovledTs of a given changefeed
 func (c CDCEtcdClient) GetChangeFeedStatus(ctx context.Context, id string) (*model.ChangeFeedStatus, int64, error) {
-	key := GetEtcdKeyJob(id)
+	key := c.GetEtcdKeyJob(id)
 	resp, err := c.Client.Get(ctx, key)
 	if err != nil {
 		return nil, 0, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -239,7 +312,7 @@ func (c CDCEtcdClient) GetChangeFeedStatus(ctx context.Context, id string) (*mod
 
 // GetCaptures returns kv revision and CaptureInfo list
 func (c CDCEtcdClient) GetCaptures(ctx context.Context) (int64, []*model.CaptureInfo, error) {
-	key := CaptureInfoKeyPrefix
+	key := c.CaptureInfoKeyPrefix()
 
 	resp, err := c.Client.Get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
@@ -260,7 +333,7 @@ func (c CDCEtcdClient) GetCaptures(ctx context.Context) (int64, []*model.Capture
 
 // GetCaptureLeases returns a map mapping from capture ID to its lease
 func (c CDCEtcdClient) GetCaptureLeases(ctx context.Context) (map[string]int64, error) {
-	key := CaptureInfoKeyPrefix
+	key := c.CaptureInfoKeyPrefix()
 
 	resp, err := c.Client.Get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
@@ -282,8 +355,8 @@ func (c CDCEtcdClient) CreateChangefeedInfo(ctx context.Context, info *model.Cha
 	if err := model.ValidateChangefeedID(changeFeedID); err != nil {
 		return err
 	}
-	infoKey := GetEtcdKeyChangeFeedInfo(changeFeedID)
-	jobKey := GetEtcdKeyJob(changeFeedID)
+	infoKey := c.GetEtcdKeyChangeFeedInfo(changeFeedID)
+	jobKey := c.GetEtcdKeyJob(changeFeedID)
 	value, err := info.Marshal()
 	if err != nil {
 		return errors.Trace(err)
@@ -308,7 +381,7 @@ func (c CDCEtcdClient) CreateChangefeedInfo(ctx context.Context, info *model.Cha
 // SaveChangeFeedInfo stores change feed info into etcd
 // TODO: this should be called from outer system, such as from a TiDB client
 func (c CDCEtcdClient) SaveChangeFeedInfo(ctx context.Context, info *model.ChangeFeedInfo, changeFeedID string) error {
-	key := GetEtcdKeyChangeFeedInfo(changeFeedID)
+	key := c.GetEtcdKeyChangeFeedInfo(changeFeedID)
 	value, err := info.Marshal()
 	if err != nil {
 		return errors.Trace(err)
@@ -320,7 +393,7 @@ func (c CDCEtcdClient) SaveChangeFeedInfo(ctx context.Context, info *model.Chang
 // GetAllTaskPositions queries all task positions of a changefeed, and returns a map
 // mapping from captureID to TaskPositions
 func (c CDCEtcdClient) GetAllTaskPositions(ctx context.Context, changefeedID string) (map[string]*model.TaskPosition, error) {
-	resp, err := c.Client.Get(ctx, TaskPositionKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.TaskPositionKeyPrefix(), clientv3.WithPrefix())
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -350,7 +423,7 @@ func (c CDCEtcdClient) GetAllTaskPositions(ctx context.Context, changefeedID str
 
 // RemoveAllTaskPositions removes all task positions of a changefeed
 func (c CDCEtcdClient) RemoveAllTaskPositions(ctx context.Context, changefeedID string) error {
-	resp, err := c.Client.Get(ctx, TaskPositionKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.TaskPositionKeyPrefix(), clientv3.WithPrefix())
 	if err != nil {
 		return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -367,7 +440,7 @@ func (c CDCEtcdClient) RemoveAllTaskPositions(ctx context.Context, changefeedID
 		if changeFeed != changefeedID {
 			continue
 		}
-		key := GetEtcdKeyTaskPosition(changefeedID, captureID)
+		key := c.GetEtcdKeyTaskPosition(changefeedID, captureID)
 		_, err = c.Client.Delete(ctx, key)
 		if err != nil {
 			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -379,7 +452,7 @@ func (c CDCEtcdClient) RemoveAllTaskPositions(ctx context.Context, changefeedID
 // GetProcessors queries all processors of the cdc cluster,
 // and returns a slice of ProcInfoSnap(without table info)
 func (c CDCEtcdClient) GetProcessors(ctx context.Context) ([]*model.ProcInfoSnap, error) {
-	resp, err := c.Client.Get(ctx, TaskStatusKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.TaskStatusKeyPrefix(), clientv3.WithPrefix())
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -406,28 +479,42 @@ func (c CDCEtcdClient) GetProcessors(ctx context.Context) ([]*model.ProcInfoSnap
 // GetAllTaskStatus queries all task status of a changefeed, and returns a map
 // mapping from captureID to TaskStatus
 func (c CDCEtcdClient) GetAllTaskStatus(ctx context.Context, changefeedID string) (model.ProcessorsInfos, error) {
-	resp, err := c.Client.Get(ctx, TaskStatusKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Txn(ctx).Then(
+		clientv3.OpGet(c.TaskStatusKeyPrefix(), clientv3.WithPrefix()),
+		clientv3.OpGet(c.TaskTablesKeyPrefix(), clientv3.WithPrefix()),
+	).Commit()
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
-	pinfo := make(map[string]*model.TaskStatus, resp.Count)
-	for _, rawKv := range resp.Kvs {
-		changeFeed, err := model.ExtractKeySuffix(string(rawKv.Key))
+	return decodeAllTaskStatus(changefeedID,
+		resp.Responses[0].GetResponseRange().Kvs, resp.Responses[1].GetResponseRange().Kvs)
+}
+
+// decodeAllTaskStatus decodes the task status of the changefeed from the kvs
+// of the task status keys and the task tables keys read at the same revision.
+func decodeAllTaskStatus(changefeedID string, statusKvs, tablesKvs []*mvccpb.KeyValue) (model.ProcessorsInfos, error) {
+	tables := make(map[string]*mvccpb.KeyValue)
+	for _, rawKv := range tablesKvs {
+		changeFeed, captureID, err := extractTaskKey(rawKv.Key)
 		if err != nil {
 			return nil, err
 		}
-		endIndex := len(rawKv.Key) - len(changeFeed) - 1
-		captureID, err := model.ExtractKeySuffix(string(rawKv.Key[0:endIndex]))
+		if changeFeed == changefeedID {
+			tables[captureID] = rawKv
+		}
+	}
+	pinfo := make(model.ProcessorsInfos)
+	for _, rawKv := range statusKvs {
+		changeFeed, captureID, err := extractTaskKey(rawKv.Key)
 		if err != nil {
 			return nil, err
 		}
 		if changeFeed != changefeedID {
 			continue
 		}
-		info := &model.TaskStatus{}
-		err = info.Unmarshal(rawKv.Value)
+		info, err := decodeTaskStatus(rawKv, tables[captureID])
 		if err != nil {
-			return nil, cerror.ErrDecodeFailed.GenWithStackByArgs("failed to unmarshal task status: %s", err)
+			return nil, errors.Trace(err)
 		}
 		info.ModRevision = rawKv.ModRevision
 		pinfo[captureID] = info
@@ -435,9 +522,85 @@ func (c CDCEtcdClient) GetAllTaskStatus(ctx context.Context, changefeedID string
 	return pinfo, nil
 }
 
+// GetProcessorInfosOfLiveCaptures queries all task status and task positions
+// of a changefeed together with the captures in one transaction, so they are
+// read at the same revision. The capture info is bound to the session lease of
+// the capture and removed once the lease expires, so the task positions of the
+// captures without the capture info are excluded. It returns the revision, the
+// task status and the task positions of the live captures.
+func (c CDCEtcdClient) GetProcessorInfosOfLiveCaptures(
+	ctx context.Context, changefeedID string,
+) (int64, model.ProcessorsInfos, map[string]*model.TaskPosition, error) {
+	resp, err := c.Client.Txn(ctx).Then(
+		clientv3.OpGet(c.TaskStatusKeyPrefix(), clientv3.WithPrefix()),
+		clientv3.OpGet(c.TaskPositionKeyPrefix(), clientv3.WithPrefix()),
+		clientv3.OpGet(c.CaptureInfoKeyPrefix(), clientv3.WithPrefix()),
+		clientv3.OpGet(c.TaskTablesKeyPrefix(), clientv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return 0, nil, nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	statusKvs := resp.Responses[0].GetResponseRange().Kvs
+	positionKvs := resp.Responses[1].GetResponseRange().Kvs
+	captureKvs := resp.Responses[2].GetResponseRange().Kvs
+	tablesKvs := resp.Responses[3].GetResponseRange().Kvs
+
+	liveCaptures := make(map[string]struct{}, len(captureKvs))
+	for _, rawKv := range captureKvs {
+		captureID, err := model.ExtractKeySuffix(string(rawKv.Key))
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		liveCaptures[captureID] = struct{}{}
+	}
+
+	pinfo, err := decodeAllTaskStatus(changefeedID, statusKvs, tablesKvs)
+	if err != nil {
+		return 0, nil, nil, errors.Trace(err)
+	}
+
+	positions := make(map[string]*model.TaskPosition)
+	for _, rawKv := range positionKvs {
+		changeFeed, captureID, err := extractTaskKey(rawKv.Key)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if changeFeed != changefeedID {
+			continue
+		}
+		if _, ok := liveCaptures[captureID]; !ok {
+			log.Debug("ignore the task position of the expired capture",
+				zap.String("changefeed", changefeedID), zap.String("capture-id", captureID))
+			continue
+		}
+		info := &model.TaskPosition{}
+		err = info.Unmarshal(rawKv.Value)
+		if err != nil {
+			return 0, nil, nil, cerror.ErrDecodeFailed.GenWithStackByArgs("failed to unmarshal task position: %s", err)
+		}
+		positions[captureID] = info
+	}
+	return resp.Header.Revision, pinfo, positions, nil
+}
+
+// extractTaskKey extracts the changefeed ID and the capture ID from the key of
+// a task status or a task position.
+func extractTaskKey(key []byte) (changefeedID string, captureID string, err error) {
+	changefeedID, err = model.ExtractKeySuffix(string(key))
+	if err != nil {
+		return "", "", err
+	}
+	endIndex := len(key) - len(changefeedID) - 1
+	captureID, err = model.ExtractKeySuffix(string(key[0:endIndex]))
+	if err != nil {
+		return "", "", err
+	}
+	return changefeedID, captureID, nil
+}
+
 // RemoveAllTaskStatus removes all task status of a changefeed
 func (c CDCEtcdClient) RemoveAllTaskStatus(ctx context.Context, changefeedID string) error {
-	resp, err := c.Client.Get(ctx, TaskStatusKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.TaskStatusKeyPrefix(), clientv3.WithPrefix())
 	if err != nil {
 		return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -454,8 +617,10 @@ func (c CDCEtcdClient) RemoveAllTaskStatus(ctx context.Context, changefeedID str
 		if changeFeed != changefeedID {
 			continue
 		}
-		key := GetEtcdKeyTaskStatus(changefeedID, captureID)
-		_, err = c.Client.Delete(ctx, key)
+		_, err = c.Client.Txn(ctx).Then(
+			clientv3.OpDelete(c.GetEtcdKeyTaskStatus(changefeedID, captureID)),
+			clientv3.OpDelete(c.GetEtcdKeyTaskTables(changefeedID, captureID)),
+		).Commit()
 		if err != nil {
 			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 		}
@@ -472,17 +637,84 @@ func (c CDCEtcdClient) GetTaskStatus(
 	changefeedID string,
 	captureID string,
 ) (int64, *model.TaskStatus, error) {
-	key := GetEtcdKeyTaskStatus(changefeedID, captureID)
-	resp, err := c.Client.Get(ctx, key)
+	snap, err := c.getTaskStatus(ctx, changefeedID, captureID)
 	if err != nil {
-		return 0, nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		return 0, nil, errors.Trace(err)
 	}
-	if resp.Count == 0 {
-		return 0, nil, cerror.ErrTaskStatusNotExists.GenWithStackByArgs(key)
+	return snap.modRevision, snap.status, nil
+}
+
+// taskStatusSnapshot is a task status read from etcd with the revisions of the
+// keys, and a copy of the tables to tell whether they're changed by the
+// updates.
+type taskStatusSnapshot struct {
+	status         *model.TaskStatus
+	modRevision    int64
+	tablesRevision int64
+	tables         map[model.TableID]model.TableReplicaInfo
+}
+
+func (s *taskStatusSnapshot) tablesChanged() bool {
+	if len(s.status.Tables) != len(s.tables) {
+		return true
 	}
-	info := &model.TaskStatus{}
-	err = info.Unmarshal(resp.Kvs[0].Value)
-	return resp.Kvs[0].ModRevision, info, errors.Trace(err)
+	for tableID, table := range s.status.Tables {
+		if old, ok := s.tables[tableID]; !ok || table == nil || *table != old {
+			return true
+		}
+	}
+	return false
+}
+
+// getTaskStatus reads the task status key and the task tables key in one
+// transaction, ErrTaskStatusNotExists is returned with the revision of the
+// task tables key if the task status key doesn't exist.
+func (c CDCEtcdClient) getTaskStatus(ctx context.Context, changefeedID, captureID string) (*taskStatusSnapshot, error) {
+	key := c.GetEtcdKeyTaskStatus(changefeedID, captureID)
+	resp, err := c.Client.Txn(ctx).Then(
+		clientv3.OpGet(key),
+		clientv3.OpGet(c.GetEtcdKeyTaskTables(changefeedID, captureID)),
+	).Commit()
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	snap := &taskStatusSnapshot{}
+	var tablesKv *mvccpb.KeyValue
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) != 0 {
+		tablesKv = kvs[0]
+		snap.tablesRevision = tablesKv.ModRevision
+	}
+	statusKvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(statusKvs) == 0 {
+		return snap, cerror.ErrTaskStatusNotExists.GenWithStackByArgs(key)
+	}
+	snap.modRevision = statusKvs[0].ModRevision
+	snap.status, err = decodeTaskStatus(statusKvs[0], tablesKv)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	snap.tables = make(map[model.TableID]model.TableReplicaInfo, len(snap.status.Tables))
+	for tableID, table := range snap.status.Tables {
+		snap.tables[tableID] = *table
+	}
+	return snap, nil
+}
+
+// encodeTaskStatus encodes the task status without the tables, which are
+// encoded by encodeTaskTables into the task tables key.
+func encodeTaskStatus(info *model.TaskStatus) (string, error) {
+	withoutTables := *info
+	withoutTables.Tables = nil
+	data, err := withoutTables.Marshal()
+	return data, errors.Trace(err)
+}
+
+func encodeTaskTables(info *model.TaskStatus) (string, error) {
+	data, err := json.Marshal(info.Tables)
+	if err != nil {
+		return "", cerror.WrapError(cerror.ErrMarshalFailed, err)
+	}
+	return string(data), nil
 }
 
 // PutTaskStatus puts task status into etcd.
@@ -492,14 +724,19 @@ func (c CDCEtcdClient) PutTaskStatus(
 	captureID string,
 	info *model.TaskStatus,
 ) error {
-	data, err := info.Marshal()
+	status, err := encodeTaskStatus(info)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tables, err := encodeTaskTables(info)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	key := GetEtcdKeyTaskStatus(changefeedID, captureID)
-
-	_, err = c.Client.Put(ctx, key, data)
+	_, err = c.Client.Txn(ctx).Then(
+		clientv3.OpPut(c.GetEtcdKeyTaskStatus(changefeedID, captureID), status),
+		clientv3.OpPut(c.GetEtcdKeyTaskTables(changefeedID, captureID), tables),
+	).Commit()
 	if err != nil {
 		return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -515,7 +752,7 @@ func (c CDCEtcdClient) GetTaskWorkload(
 	changefeedID string,
 	captureID string,
 ) (model.TaskWorkload, error) {
-	key := GetEtcdKeyTaskWorkload(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskWorkload(changefeedID, captureID)
 	resp, err := c.Client.Get(ctx, key)
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -540,7 +777,7 @@ func (c CDCEtcdClient) PutTaskWorkload(
 		return errors.Trace(err)
 	}
 
-	key := GetEtcdKeyTaskWorkload(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskWorkload(changefeedID, captureID)
 
 	_, err = c.Client.Put(ctx, key, data)
 	if err != nil {
@@ -556,7 +793,7 @@ func (c CDCEtcdClient) DeleteTaskWorkload(
 	changefeedID string,
 	captureID string,
 ) error {
-	key := GetEtcdKeyTaskWorkload(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskWorkload(changefeedID, captureID)
 	_, err := c.Client.Delete(ctx, key)
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
@@ -564,7 +801,7 @@ func (c CDCEtcdClient) DeleteTaskWorkload(
 // GetAllTaskWorkloads queries all task workloads of a changefeed, and returns a map
 // mapping from captureID to TaskWorkloads
 func (c CDCEtcdClient) GetAllTaskWorkloads(ctx context.Context, changefeedID string) (map[string]*model.TaskWorkload, error) {
-	resp, err := c.Client.Get(ctx, TaskWorkloadKeyPrefix, clientv3.WithPrefix())
+	resp, err := c.Client.Get(ctx, c.TaskWorkloadKeyPrefix(), clientv3.WithPrefix())
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 	}
@@ -595,7 +832,10 @@ func (c CDCEtcdClient) GetAllTaskWorkloads(ctx context.Context, changefeedID str
 // UpdateTaskStatusFunc is a function that updates the task status
 type UpdateTaskStatusFunc func(int64, *model.TaskStatus) (updated bool, err error)
 
-// AtomicPutTaskStatus puts task status into etcd atomically.
+// AtomicPutTaskStatus puts task status into etcd atomically. The task status
+// key and the task tables key are compared and written in one transaction,
+// the task tables key is rewritten only if the tables are changed, and the
+// tables of the task status written by the previous versions are moved to it.
 func (c CDCEtcdClient) AtomicPutTaskStatus(
 	ctx context.Context,
 	changefeedID string,
@@ -610,19 +850,21 @@ func (c CDCEtcdClient) AtomicPutTaskStatus(
 			return errors.Trace(ctx.Err())
 		default:
 		}
-		var modRevision int64
-		var err error
-		modRevision, status, err = c.GetTaskStatus(ctx, changefeedID, captureID)
-		key := GetEtcdKeyTaskStatus(changefeedID, captureID)
-		var writeCmp clientv3.Cmp
+		snap, err := c.getTaskStatus(ctx, changefeedID, captureID)
+		key := c.GetEtcdKeyTaskStatus(changefeedID, captureID)
+		tablesKey := c.GetEtcdKeyTaskTables(changefeedID, captureID)
 		if err != nil {
 			if cerror.ErrTaskStatusNotExists.NotEqual(err) {
 				return errors.Trace(err)
 			}
-			status = new(model.TaskStatus)
-			writeCmp = clientv3.Compare(clientv3.ModRevision(key), "=", 0)
-		} else {
-			writeCmp = clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)
+			// the stale tables left without the task status are overwritten
+			snap.status = new(model.TaskStatus)
+		}
+		status = snap.status
+		modRevision := snap.modRevision
+		writeCmps := []clientv3.Cmp{
+			clientv3.Compare(clientv3.ModRevision(key), "=", modRevision),
+			clientv3.Compare(clientv3.ModRevision(tablesKey), "=", snap.tablesRevision),
 		}
 		updated := false
 		for _, updateFunc := range updateFuncs {
@@ -635,14 +877,20 @@ func (c CDCEtcdClient) AtomicPutTaskStatus(
 		if !updated {
 			return nil
 		}
-		value, err := status.Marshal()
+		value, err := encodeTaskStatus(status)
 		if err != nil {
 			return errors.Trace(err)
 		}
+		ops := []clientv3.Op{clientv3.OpPut(key, value)}
+		if modRevision == 0 || snap.tablesRevision == 0 || snap.tablesChanged() {
+			tables, err := encodeTaskTables(status)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			ops = append(ops, clientv3.OpPut(tablesKey, tables))
+		}
 
-		resp, err := c.Client.Txn(ctx).If(writeCmp).Then(
-			clientv3.OpPut(key, value),
-		).Commit()
+		resp, err := c.Client.Txn(ctx).If(writeCmps...).Then(ops...).Commit()
 		if err != nil {
 			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 		}
@@ -660,6 +908,113 @@ func (c CDCEtcdClient) AtomicPutTaskStatus(
 	return status, newModRevision, nil
 }
 
+// ForceAdvanceTableResolvedTs adds an operation to the task status of the
+// capture replicating the table, which forces the resolved ts of the table to
+// advance to targetTs, and records it in the changefeed history. The capture
+// is returned, ErrTableNotReplicated is returned if the table is not found.
+func (c CDCEtcdClient) ForceAdvanceTableResolvedTs(
+	ctx context.Context,
+	changefeedID string,
+	tableID model.TableID,
+	targetTs model.Ts,
+	client string,
+) (model.CaptureID, error) {
+	statuses, err := c.GetAllTaskStatus(ctx, changefeedID)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	var captureID model.CaptureID
+	for id, status := range statuses {
+		if _, ok := status.Tables[tableID]; ok {
+			captureID = id
+			break
+		}
+	}
+	if captureID == "" {
+		return "", cerror.ErrTableNotReplicated.GenWithStackByArgs(tableID, changefeedID)
+	}
+	_, _, err = c.AtomicPutTaskStatus(ctx, changefeedID, captureID,
+		func(_ int64, status *model.TaskStatus) (bool, error) {
+			// the table may be moved to another capture in the meantime
+			if _, ok := status.Tables[tableID]; !ok {
+				return false, cerror.ErrTableNotReplicated.GenWithStackByArgs(tableID, changefeedID)
+			}
+			status.ForceAdvanceTable(tableID, targetTs)
+			return true, nil
+		})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	err = c.AppendChangeFeedHistory(ctx, changefeedID, &model.ChangefeedEvent{
+		Time:    time.Now(),
+		Type:    model.ChangefeedEventForceAdvance,
+		Client:  client,
+		Ts:      targetTs,
+		Message: fmt.Sprintf("the resolved ts of table %d on capture %s is forced to advance", tableID, captureID),
+	})
+	return captureID, errors.Trace(err)
+}
+
+// FinishTableOperation forces the pending operation of the table on the
+// capture to finish, it unblocks the scheduling of the changefeed when the
+// processor can't finish the operation, e.g. the processor crashed in the middle
+// of it. The operation is only finished once it's processed, otherwise the
+// table isn't started or stopped. The delete operation without a drain
+// boundary records its boundary ts as the drain boundary. Besides the finished
+// operation, it returns the ts from which the table is started, which is the
+// drain boundary for the delete operation.
+func (c CDCEtcdClient) FinishTableOperation(
+	ctx context.Context,
+	changefeedID string,
+	captureID model.CaptureID,
+	tableID model.TableID,
+	client string,
+) (*model.TableOperation, model.Ts, error) {
+	var finished *model.TableOperation
+	var startTs model.Ts
+	_, _, err := c.AtomicPutTaskStatus(ctx, changefeedID, captureID,
+		func(_ int64, status *model.TaskStatus) (bool, error) {
+			op, ok := status.Operation[tableID]
+			if !ok || op.TableApplied() {
+				return false, cerror.ErrTableOperationNotPending.GenWithStackByArgs(tableID, captureID, changefeedID)
+			}
+			typ := "add"
+			if op.Delete {
+				typ = "delete"
+			}
+			if !op.TableProcessed() {
+				return false, cerror.ErrTableOperationNotProcessed.GenWithStackByArgs(typ, tableID, captureID)
+			}
+			op.Done = true
+			op.Status = model.OperFinished
+			startTs = op.BoundaryTs
+			if op.Delete {
+				if boundaryTs, ok := status.DrainBoundary[tableID]; ok {
+					startTs = boundaryTs
+				} else {
+					status.SetDrainBoundary(tableID, op.BoundaryTs)
+				}
+			}
+			finished = op.Clone()
+			return true, nil
+		})
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	typ := "add"
+	if finished.Delete {
+		typ = "delete"
+	}
+	err = c.AppendChangeFeedHistory(ctx, changefeedID, &model.ChangefeedEvent{
+		Time:    time.Now(),
+		Type:    model.ChangefeedEventFinishOperation,
+		Client:  client,
+		Ts:      startTs,
+		Message: fmt.Sprintf("the %s operation of table %d on capture %s is forced to finish", typ, tableID, captureID),
+	})
+	return finished, startTs, errors.Trace(err)
+}
+
 // GetTaskPosition queries task process from etcd, returns
 //  - ModRevision of the given key
 //  - *model.TaskPosition unmarshaled from the value
@@ -669,7 +1024,7 @@ func (c CDCEtcdClient) GetTaskPosition(
 	changefeedID string,
 	captureID string,
 ) (int64, *model.TaskPosition, error) {
-	key := GetEtcdKeyTaskPosition(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskPosition(changefeedID, captureID)
 	resp, err := c.Client.Get(ctx, key)
 	if err != nil {
 		return 0, nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -696,7 +1051,7 @@ func (c CDCEtcdClient) PutTaskPositionOnChange(
 		return false, errors.Trace(err)
 	}
 
-	key := GetEtcdKeyTaskPosition(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskPosition(changefeedID, captureID)
 	resp, err := c.Client.Txn(ctx).If(
 		clientv3.Compare(clientv3.ModRevision(key), ">", 0),
 		clientv3.Compare(clientv3.Value(key), "=", data),
@@ -709,17 +1064,145 @@ func (c CDCEtcdClient) PutTaskPositionOnChange(
 
 // DeleteTaskPosition remove task position from etcd
 func (c CDCEtcdClient) DeleteTaskPosition(ctx context.Context, changefeedID string, captureID string) error {
-	key := GetEtcdKeyTaskPosition(changefeedID, captureID)
+	key := c.GetEtcdKeyTaskPosition(changefeedID, captureID)
 	_, err := c.Client.Delete(ctx, key)
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
+// DeleteTaskKeys deletes the task position, the task status and the task
+// workload of a processor in one transaction, it succeeds if the keys are
+// already deleted. If dirtyStop is not nil, it's put in the same transaction.
+func (c CDCEtcdClient) DeleteTaskKeys(
+	ctx context.Context,
+	changefeedID string,
+	captureID string,
+	dirtyStop *model.DirtyStop,
+) error {
+	ops := []clientv3.Op{
+		clientv3.OpDelete(c.GetEtcdKeyTaskPosition(changefeedID, captureID)),
+		clientv3.OpDelete(c.GetEtcdKeyTaskStatus(changefeedID, captureID)),
+		clientv3.OpDelete(c.GetEtcdKeyTaskTables(changefeedID, captureID)),
+		clientv3.OpDelete(c.GetEtcdKeyTaskWorkload(changefeedID, captureID)),
+	}
+	if dirtyStop != nil {
+		value, err := dirtyStop.Marshal()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		ops = append(ops, clientv3.OpPut(c.GetEtcdKeyDirtyStop(changefeedID, captureID), value))
+	}
+	_, err := c.Client.Txn(ctx).Then(ops...).Commit()
+	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+}
+
+// GetDirtyStops queries the dirty stops of the processors of a changefeed,
+// which are not merged into the changefeed status yet.
+func (c CDCEtcdClient) GetDirtyStops(ctx context.Context, changefeedID string) (map[model.CaptureID]*model.DirtyStop, error) {
+	resp, err := c.Client.Get(ctx, c.DirtyStopKeyPrefix()+"/"+changefeedID+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	stops := make(map[model.CaptureID]*model.DirtyStop, resp.Count)
+	for _, rawKv := range resp.Kvs {
+		captureID, err := model.ExtractKeySuffix(string(rawKv.Key))
+		if err != nil {
+			return nil, err
+		}
+		stop := &model.DirtyStop{}
+		if err := stop.Unmarshal(rawKv.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		stop.ModRevision = rawKv.ModRevision
+		stops[captureID] = stop
+	}
+	return stops, nil
+}
+
+// DeleteDirtyStops deletes the dirty stops of a changefeed, the ones updated
+// after they are read are kept.
+func (c CDCEtcdClient) DeleteDirtyStops(ctx context.Context, changefeedID string, stops map[model.CaptureID]*model.DirtyStop) error {
+	for captureID, stop := range stops {
+		key := c.GetEtcdKeyDirtyStop(changefeedID, captureID)
+		_, err := c.Client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", stop.ModRevision)).
+			Then(clientv3.OpDelete(key)).Commit()
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		}
+	}
+	return nil
+}
+
+// RemoveAllDirtyStops removes all the dirty stops of a changefeed
+func (c CDCEtcdClient) RemoveAllDirtyStops(ctx context.Context, changefeedID string) error {
+	_, err := c.Client.Delete(ctx, c.DirtyStopKeyPrefix()+"/"+changefeedID+"/", clientv3.WithPrefix())
+	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+}
+
+// GetCheckpointGuards queries the checkpoint guards of the processors of a
+// changefeed
+func (c CDCEtcdClient) GetCheckpointGuards(ctx context.Context, changefeedID string) (map[model.CaptureID]*model.CheckpointGuard, error) {
+	resp, err := c.Client.Get(ctx, c.CheckpointGuardKeyPrefix()+"/"+changefeedID+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	guards := make(map[model.CaptureID]*model.CheckpointGuard, resp.Count)
+	for _, rawKv := range resp.Kvs {
+		captureID, err := model.ExtractKeySuffix(string(rawKv.Key))
+		if err != nil {
+			return nil, err
+		}
+		guard := &model.CheckpointGuard{}
+		if err := guard.Unmarshal(rawKv.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		guard.ModRevision = rawKv.ModRevision
+		guards[captureID] = guard
+	}
+	return guards, nil
+}
+
+// PutCheckpointGuard puts the checkpoint guard of a processor into etcd
+func (c CDCEtcdClient) PutCheckpointGuard(
+	ctx context.Context, changefeedID, captureID string, guard *model.CheckpointGuard,
+) error {
+	value, err := guard.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = c.Client.Put(ctx, c.GetEtcdKeyCheckpointGuard(changefeedID, captureID), value)
+	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+}
+
+// DeleteCheckpointGuards deletes the checkpoint guards of a changefeed, the
+// ones updated after they are read are kept.
+func (c CDCEtcdClient) DeleteCheckpointGuards(
+	ctx context.Context, changefeedID string, guards map[model.CaptureID]*model.CheckpointGuard,
+) error {
+	for captureID, guard := range guards {
+		key := c.GetEtcdKeyCheckpointGuard(changefeedID, captureID)
+		_, err := c.Client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", guard.ModRevision)).
+			Then(clientv3.OpDelete(key)).Commit()
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		}
+	}
+	return nil
+}
+
+// RemoveAllCheckpointGuards removes all the checkpoint guards of a changefeed
+func (c CDCEtcdClient) RemoveAllCheckpointGuards(ctx context.Context, changefeedID string) error {
+	_, err := c.Client.Delete(ctx, c.CheckpointGuardKeyPrefix()+"/"+changefeedID+"/", clientv3.WithPrefix())
+	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+}
+
 // RemoveChangeFeedStatus removes changefeed job status from etcd
 func (c CDCEtcdClient) RemoveChangeFeedStatus(
 	ctx context.Context,
 	changefeedID string,
 ) error {
-	key := GetEtcdKeyJob(changefeedID)
+	key := c.GetEtcdKeyJob(changefeedID)
 	_, err := c.Client.Delete(ctx, key)
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
@@ -730,7 +1213,7 @@ func (c CDCEtcdClient) PutChangeFeedStatus(
 	changefeedID string,
 	status *model.ChangeFeedStatus,
 ) error {
-	key := GetEtcdKeyJob(changefeedID)
+	key := c.GetEtcdKeyJob(changefeedID)
 	value, err := status.Marshal()
 	if err != nil {
 		return errors.Trace(err)
@@ -745,7 +1228,7 @@ func (c CDCEtcdClient) SetChangeFeedStatusTTL(
 	changefeedID string,
 	ttl int64,
 ) error {
-	key := GetEtcdKeyJob(changefeedID)
+	key := c.GetEtcdKeyJob(changefeedID)
 	leaseResp, err := c.Client.Grant(ctx, ttl)
 	if err != nil {
 		return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
@@ -762,6 +1245,81 @@ func (c CDCEtcdClient) SetChangeFeedStatusTTL(
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
+// GetChangeFeedHistory queries the event history of a changefeed from etcd,
+// an empty history is returned if the history doesn't exist.
+func (c CDCEtcdClient) GetChangeFeedHistory(
+	ctx context.Context,
+	changefeedID string,
+) (int64, *model.ChangefeedHistory, error) {
+	key := c.GetEtcdKeyChangeFeedHistory(changefeedID)
+	resp, err := c.Client.Get(ctx, key)
+	if err != nil {
+		return 0, nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	history := &model.ChangefeedHistory{}
+	if resp.Count == 0 {
+		return 0, history, nil
+	}
+	err = history.Unmarshal(resp.Kvs[0].Value)
+	return resp.Kvs[0].ModRevision, history, errors.Trace(err)
+}
+
+// AppendChangeFeedHistory appends events to the event history of a changefeed,
+// the history is trimmed to keep at most model.ChangefeedHistoryLimit events.
+// The history is updated with compare-and-swap, so that events are not lost
+// if there are multiple writers (e.g. the old and new owner during owner switch).
+func (c CDCEtcdClient) AppendChangeFeedHistory(
+	ctx context.Context,
+	changefeedID string,
+	events ...*model.ChangefeedEvent,
+) error {
+	if len(events) == 0 {
+		return nil
+	}
+	key := c.GetEtcdKeyChangeFeedHistory(changefeedID)
+	return retry.Run(20*time.Millisecond, 10, func() error {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		default:
+		}
+		modRevision, history, err := c.GetChangeFeedHistory(ctx, changefeedID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// events are copied since the IDs are assigned in each attempt
+		copied := make([]*model.ChangefeedEvent, 0, len(events))
+		for _, event := range events {
+			e := *event
+			copied = append(copied, &e)
+		}
+		history.Append(model.ChangefeedHistoryLimit, copied...)
+		value, err := history.Marshal()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		resp, err := c.Client.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(key), "=", modRevision),
+		).Then(
+			clientv3.OpPut(key, value),
+		).Commit()
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		}
+		if !resp.Succeeded {
+			return cerror.ErrWriteTsConflict.GenWithStackByArgs(key)
+		}
+		return nil
+	})
+}
+
+// DeleteChangeFeedHistory deletes the event history of a changefeed from etcd
+func (c CDCEtcdClient) DeleteChangeFeedHistory(ctx context.Context, changefeedID string) error {
+	key := c.GetEtcdKeyChangeFeedHistory(changefeedID)
+	_, err := c.Client.Delete(ctx, key)
+	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+}
+
 // PutAllChangeFeedStatus puts ChangeFeedStatus of each changefeed into etcd
 func (c CDCEtcdClient) PutAllChangeFeedStatus(ctx context.Context, infos map[model.ChangeFeedID]*model.ChangeFeedStatus) error {
 	var (
@@ -773,7 +1331,7 @@ func (c CDCEtcdClient) PutAllChangeFeedStatus(ctx context.Context, infos map[mod
 		if err != nil {
 			return errors.Trace(err)
 		}
-		key := GetEtcdKeyJob(changefeedID)
+		key := c.GetEtcdKeyJob(changefeedID)
 		ops = append(ops, clientv3.OpPut(key, storeVal))
 		if uint(len(ops)) >= embed.DefaultMaxTxnOps {
 			_, err = txn.Then(ops...).Commit()
@@ -799,8 +1357,10 @@ func (c CDCEtcdClient) DeleteTaskStatus(
 	cfID string,
 	captureID string,
 ) error {
-	key := GetEtcdKeyTaskStatus(cfID, captureID)
-	_, err := c.Client.Delete(ctx, key)
+	_, err := c.Client.Txn(ctx).Then(
+		clientv3.OpDelete(c.GetEtcdKeyTaskStatus(cfID, captureID)),
+		clientv3.OpDelete(c.GetEtcdKeyTaskTables(cfID, captureID)),
+	).Commit()
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
@@ -811,14 +1371,14 @@ func (c CDCEtcdClient) PutCaptureInfo(ctx context.Context, info *model.CaptureIn
 		return errors.Trace(err)
 	}
 
-	key := GetEtcdKeyCaptureInfo(info.ID)
+	key := c.GetEtcdKeyCaptureInfo(info.ID)
 	_, err = c.Client.Put(ctx, key, string(data), clientv3.WithLease(leaseID))
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
 
 // DeleteCaptureInfo delete capture info from etcd.
 func (c CDCEtcdClient) DeleteCaptureInfo(ctx context.Context, id string) error {
-	key := GetEtcdKeyCaptureInfo(id)
+	key := c.GetEtcdKeyCaptureInfo(id)
 	_, err := c.Client.Delete(ctx, key)
 	return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
 }
@@ -826,7 +1386,7 @@ func (c CDCEtcdClient) DeleteCaptureInfo(ctx context.Context, id string) error {
 // GetCaptureInfo get capture info from etcd.
 // return errCaptureNotExist if the capture not exists.
 func (c CDCEtcdClient) GetCaptureInfo(ctx context.Context, id string) (info *model.CaptureInfo, err error) {
-	key := GetEtcdKeyCaptureInfo(id)
+	key := c.GetEtcdKeyCaptureInfo(id)
 
 	resp, err := c.Client.Get(ctx, key)
 	if err != nil {
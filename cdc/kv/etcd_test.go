@@ -16,8 +16,11 @@ package kv
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
 	"sort"
+	"testing"
 	"time"
 
 	"github.com/pingcap/check"
@@ -89,7 +92,7 @@ func (s *etcdSuite) TestGetChangeFeeds(c *check.C) {
 	}
 	for _, tc := range testCases {
 		for i := 0; i < len(tc.ids); i++ {
-			_, err := s.client.Client.Put(context.Background(), GetEtcdKeyChangeFeedInfo(tc.ids[i]), tc.details[i])
+			_, err := s.client.Client.Put(context.Background(), s.client.GetEtcdKeyChangeFeedInfo(tc.ids[i]), tc.details[i])
 			c.Assert(err, check.IsNil)
 		}
 		_, result, err := s.client.GetChangeFeeds(context.Background())
@@ -139,6 +142,110 @@ func (s *etcdSuite) TestGetPutTaskStatus(c *check.C) {
 	c.Assert(cerror.ErrTaskStatusNotExists.Equal(err), check.IsTrue)
 }
 
+func (s *etcdSuite) TestForceAdvanceTableResolvedTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	feedID := "feedid"
+
+	err := s.client.PutTaskStatus(ctx, feedID, "capture-1", &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 100}},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.client.PutTaskStatus(ctx, feedID, "capture-2", &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{2: {StartTs: 100}},
+	})
+	c.Assert(err, check.IsNil)
+
+	captureID, err := s.client.ForceAdvanceTableResolvedTs(ctx, feedID, 2, 200, "root@localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(captureID, check.Equals, "capture-2")
+	_, status, err := s.client.GetTaskStatus(ctx, feedID, "capture-2")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.ForceAdvance, check.DeepEquals, map[model.TableID]*model.TableForceAdvance{
+		2: {TargetTs: 200, Status: model.OperDispatched},
+	})
+	_, history, err := s.client.GetChangeFeedHistory(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 1)
+	c.Assert(history.Events[0].Type, check.Equals, model.ChangefeedEventForceAdvance)
+	c.Assert(history.Events[0].Ts, check.Equals, uint64(200))
+	c.Assert(history.Events[0].Client, check.Equals, "root@localhost")
+
+	_, err = s.client.ForceAdvanceTableResolvedTs(ctx, feedID, 3, 200, "root@localhost")
+	c.Assert(cerror.ErrTableNotReplicated.Equal(err), check.IsTrue, check.Commentf("%v", err))
+}
+
+func (s *etcdSuite) TestFinishTableOperation(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	feedID := "feedid"
+
+	err := s.client.PutTaskStatus(ctx, feedID, "capture-1", &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{2: {StartTs: 100}, 3: {StartTs: 100}},
+		Operation: map[model.TableID]*model.TableOperation{
+			1: {Delete: true, BoundaryTs: 90, Status: model.OperProcessed},
+			2: {BoundaryTs: 100, Status: model.OperProcessed},
+			3: {BoundaryTs: 100, Status: model.OperDispatched},
+			4: {Delete: true, BoundaryTs: 80, Status: model.OperFinished},
+			6: {Delete: true, BoundaryTs: 90, Status: model.OperProcessed},
+			7: {Delete: true, BoundaryTs: 90, Status: model.OperDispatched},
+		},
+		DrainBoundary: map[model.TableID]model.Ts{6: 95},
+	})
+	c.Assert(err, check.IsNil)
+
+	// the finished delete operation records its boundary ts as the drain boundary
+	op, startTs, err := s.client.FinishTableOperation(ctx, feedID, "capture-1", 1, "root@localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(op.Delete, check.IsTrue)
+	c.Assert(op.TableApplied(), check.IsTrue)
+	c.Assert(startTs, check.Equals, uint64(90))
+	_, status, err := s.client.GetTaskStatus(ctx, feedID, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Operation[1].TableApplied(), check.IsTrue)
+	c.Assert(status.DrainBoundary, check.DeepEquals, map[model.TableID]model.Ts{1: 90, 6: 95})
+
+	op, startTs, err = s.client.FinishTableOperation(ctx, feedID, "capture-1", 2, "root@localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(op.Delete, check.IsFalse)
+	c.Assert(startTs, check.Equals, uint64(100))
+	_, status, err = s.client.GetTaskStatus(ctx, feedID, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.SomeOperationsUnapplied(), check.IsTrue)
+	c.Assert(status.Operation[2].TableApplied(), check.IsTrue)
+	c.Assert(status.DrainBoundary, check.HasLen, 2)
+	_, history, err := s.client.GetChangeFeedHistory(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 2)
+	c.Assert(history.Events[0].Type, check.Equals, model.ChangefeedEventFinishOperation)
+	c.Assert(history.Events[0].Ts, check.Equals, uint64(90))
+	c.Assert(history.Events[0].Client, check.Equals, "root@localhost")
+
+	// the delete operation is started on the target capture from the drain
+	// boundary the processor recorded
+	_, startTs, err = s.client.FinishTableOperation(ctx, feedID, "capture-1", 6, "root@localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(startTs, check.Equals, uint64(95))
+	_, status, err = s.client.GetTaskStatus(ctx, feedID, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.DrainBoundary[6], check.Equals, uint64(95))
+
+	// the operations not processed aren't finished, the table isn't started
+	// or stopped
+	for _, tableID := range []model.TableID{3, 7} {
+		_, _, err = s.client.FinishTableOperation(ctx, feedID, "capture-1", tableID, "root@localhost")
+		c.Assert(cerror.ErrTableOperationNotProcessed.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	}
+	for _, tableID := range []model.TableID{4, 5} {
+		_, _, err = s.client.FinishTableOperation(ctx, feedID, "capture-1", tableID, "root@localhost")
+		c.Assert(cerror.ErrTableOperationNotPending.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	}
+	_, _, err = s.client.FinishTableOperation(ctx, feedID, "capture-2", 1, "root@localhost")
+	c.Assert(cerror.ErrTableOperationNotPending.Equal(err), check.IsTrue, check.Commentf("%v", err))
+}
+
 func (s *etcdSuite) TestDeleteTaskStatus(c *check.C) {
 	defer testleak.AfterTest(c)()
 	defer s.TearDownTest(c)
@@ -158,6 +265,97 @@ func (s *etcdSuite) TestDeleteTaskStatus(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, _, err = s.client.GetTaskStatus(ctx, feedID, captureID)
 	c.Assert(cerror.ErrTaskStatusNotExists.Equal(err), check.IsTrue)
+	resp, err := s.client.Client.Get(ctx, s.client.GetEtcdKeyTaskTables(feedID, captureID))
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Kvs, check.HasLen, 0)
+}
+
+func (s *etcdSuite) TestSplitTaskStatus(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	feedID := "feedid"
+	captureID := "captureid"
+	statusKey := s.client.GetEtcdKeyTaskStatus(feedID, captureID)
+	tablesKey := s.client.GetEtcdKeyTaskTables(feedID, captureID)
+	getModRevision := func(key string) int64 {
+		resp, err := s.client.Client.Get(ctx, key)
+		c.Assert(err, check.IsNil)
+		if len(resp.Kvs) == 0 {
+			return 0
+		}
+		return resp.Kvs[0].ModRevision
+	}
+
+	// the task status written by the previous versions keeps the tables
+	_, err := s.client.Client.Put(ctx, statusKey,
+		`{"tables":{"1":{"start-ts":100,"mark-table-id":0}},"operation":null,"admin-job-type":0}`)
+	c.Assert(err, check.IsNil)
+	_, status, err := s.client.GetTaskStatus(ctx, feedID, captureID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.DeepEquals, map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 100}})
+
+	// the tables are moved to the task tables key on the next write
+	_, _, err = s.client.AtomicPutTaskStatus(ctx, feedID, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+		status.AddTable(2, &model.TableReplicaInfo{StartTs: 200}, 200)
+		return true, nil
+	})
+	c.Assert(err, check.IsNil)
+	resp, err := s.client.Client.Get(ctx, statusKey)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(resp.Kvs[0].Value), check.Not(check.Matches), `.*start-ts.*`)
+	statuses, err := s.client.GetAllTaskStatus(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses[captureID].Tables, check.DeepEquals, map[model.TableID]*model.TableReplicaInfo{
+		1: {StartTs: 100},
+		2: {StartTs: 200},
+	})
+	c.Assert(statuses[captureID].Operation, check.HasKey, model.TableID(2))
+	tablesRevision := getModRevision(tablesKey)
+	c.Assert(tablesRevision, check.Not(check.Equals), int64(0))
+
+	// the tables are not rewritten if only the operations are changed
+	_, newModRevision, err := s.client.AtomicPutTaskStatus(ctx, feedID, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+		status.Operation[2].Status = model.OperFinished
+		status.Operation[2].Done = true
+		return true, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(getModRevision(statusKey), check.Equals, newModRevision)
+	c.Assert(getModRevision(tablesKey), check.Equals, tablesRevision)
+	_, status, err = s.client.GetTaskStatus(ctx, feedID, captureID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.HasLen, 2)
+	c.Assert(status.Operation[2].Done, check.IsTrue)
+
+	// the tables changed in place are rewritten
+	_, _, err = s.client.AtomicPutTaskStatus(ctx, feedID, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+		status.Tables[1].StartTs = 150
+		return true, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(getModRevision(tablesKey) > tablesRevision, check.IsTrue)
+	_, status, err = s.client.GetTaskStatus(ctx, feedID, captureID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(150))
+
+	// the write conflicting with a concurrent write of the tables is retried
+	attempts := 0
+	_, _, err = s.client.AtomicPutTaskStatus(ctx, feedID, captureID, func(_ int64, status *model.TaskStatus) (bool, error) {
+		attempts++
+		if attempts == 1 {
+			_, err := s.client.Client.Put(ctx, tablesKey, `{}`)
+			c.Assert(err, check.IsNil)
+		}
+		status.Operation[2].Status = model.OperProcessed
+		return true, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(attempts, check.Equals, 2)
+	_, status, err = s.client.GetTaskStatus(ctx, feedID, captureID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.HasLen, 0)
+	c.Assert(status.Operation[2].Status, check.Equals, model.OperProcessed)
 }
 
 func (s *etcdSuite) TestGetPutTaskPosition(c *check.C) {
@@ -215,6 +413,45 @@ func (s *etcdSuite) TestDeleteTaskPosition(c *check.C) {
 	c.Assert(cerror.ErrTaskPositionNotExists.Equal(err), check.IsTrue)
 }
 
+func (s *etcdSuite) TestGetProcessorInfosOfLiveCaptures(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feedID := "feedid"
+
+	sess, err := concurrency.NewSession(s.client.Client.Unwrap(),
+		concurrency.WithTTL(10), concurrency.WithContext(ctx))
+	c.Assert(err, check.IsNil)
+	err = s.client.PutCaptureInfo(ctx, &model.CaptureInfo{ID: "capture-1"}, sess.Lease())
+	c.Assert(err, check.IsNil)
+	// capture-2 is expired, only its task status and task position are left
+	for _, captureID := range []string{"capture-1", "capture-2"} {
+		err = s.client.PutTaskStatus(ctx, feedID, captureID, &model.TaskStatus{})
+		c.Assert(err, check.IsNil)
+		_, err = s.client.PutTaskPositionOnChange(ctx, feedID, captureID, &model.TaskPosition{ResolvedTs: 100})
+		c.Assert(err, check.IsNil)
+	}
+	// the task position of another changefeed
+	_, err = s.client.PutTaskPositionOnChange(ctx, "feedid-2", "capture-1", &model.TaskPosition{ResolvedTs: 50})
+	c.Assert(err, check.IsNil)
+
+	rev, statuses, positions, err := s.client.GetProcessorInfosOfLiveCaptures(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(rev, check.Greater, int64(0))
+	c.Assert(statuses, check.HasLen, 2)
+	c.Assert(positions, check.DeepEquals, map[string]*model.TaskPosition{
+		"capture-1": {ResolvedTs: 100},
+	})
+
+	err = s.client.RevokeAllLeases(ctx, map[string]int64{"capture-1": int64(sess.Lease())})
+	c.Assert(err, check.IsNil)
+	_, statuses, positions, err = s.client.GetProcessorInfosOfLiveCaptures(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses, check.HasLen, 2)
+	c.Assert(positions, check.HasLen, 0)
+}
+
 func (s *etcdSuite) TestOpChangeFeedDetail(c *check.C) {
 	defer testleak.AfterTest(c)()
 	defer s.TearDownTest(c)
@@ -268,7 +505,7 @@ func (s *etcdSuite) TestPutAllChangeFeedStatus(c *check.C) {
 
 	for _, tc := range testCases {
 		for changefeedID := range tc.infos {
-			_, err = s.client.Client.Delete(context.Background(), GetEtcdKeyChangeFeedStatus(changefeedID))
+			_, err = s.client.Client.Delete(context.Background(), s.client.GetEtcdKeyChangeFeedStatus(changefeedID))
 			c.Assert(err, check.IsNil)
 		}
 
@@ -276,7 +513,7 @@ func (s *etcdSuite) TestPutAllChangeFeedStatus(c *check.C) {
 		c.Assert(err, check.IsNil)
 
 		for changefeedID, info := range tc.infos {
-			resp, err := s.client.Client.Get(context.Background(), GetEtcdKeyChangeFeedStatus(changefeedID))
+			resp, err := s.client.Client.Get(context.Background(), s.client.GetEtcdKeyChangeFeedStatus(changefeedID))
 			c.Assert(err, check.IsNil)
 			c.Assert(resp.Count, check.Equals, int64(1))
 			infoStr, err := info.Marshal()
@@ -380,6 +617,110 @@ func (s *etcdSuite) TestDeleteTaskWorkload(c *check.C) {
 	c.Assert(len(tw), check.Equals, 0)
 }
 
+func (s *etcdSuite) TestDeleteTaskKeys(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	feedID := "feedid"
+	captureID := "captureid"
+
+	err := s.client.PutTaskStatus(ctx, feedID, captureID, &model.TaskStatus{})
+	c.Assert(err, check.IsNil)
+	_, err = s.client.PutTaskPositionOnChange(ctx, feedID, captureID, &model.TaskPosition{CheckPointTs: 100})
+	c.Assert(err, check.IsNil)
+	err = s.client.PutTaskWorkload(ctx, feedID, captureID, &model.TaskWorkload{})
+	c.Assert(err, check.IsNil)
+
+	// deleting the keys is idempotent
+	for i := 0; i < 2; i++ {
+		err = s.client.DeleteTaskKeys(ctx, feedID, captureID, nil)
+		c.Assert(err, check.IsNil)
+		resp, err := s.client.Client.Get(ctx, s.client.TaskKeyPrefix(), clientv3.WithPrefix())
+		c.Assert(err, check.IsNil)
+		c.Assert(resp.Kvs, check.HasLen, 0)
+	}
+	stops, err := s.client.GetDirtyStops(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 0)
+
+	dirtyStop := &model.DirtyStop{CaptureID: captureID, CheckpointTs: 100, Reason: "timeout"}
+	err = s.client.DeleteTaskKeys(ctx, feedID, captureID, dirtyStop)
+	c.Assert(err, check.IsNil)
+	err = s.client.DeleteTaskKeys(ctx, "feedid2", captureID, dirtyStop)
+	c.Assert(err, check.IsNil)
+	stops, err = s.client.GetDirtyStops(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 1)
+	c.Assert(stops[captureID].CheckpointTs, check.Equals, uint64(100))
+	c.Assert(stops[captureID].Reason, check.Equals, "timeout")
+
+	// the dirty stop updated after it's read is not deleted
+	err = s.client.DeleteTaskKeys(ctx, feedID, captureID, dirtyStop)
+	c.Assert(err, check.IsNil)
+	err = s.client.DeleteDirtyStops(ctx, feedID, stops)
+	c.Assert(err, check.IsNil)
+	stops, err = s.client.GetDirtyStops(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 1)
+	err = s.client.DeleteDirtyStops(ctx, feedID, stops)
+	c.Assert(err, check.IsNil)
+	stops, err = s.client.GetDirtyStops(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 0)
+
+	err = s.client.RemoveAllDirtyStops(ctx, "feedid2")
+	c.Assert(err, check.IsNil)
+	stops, err = s.client.GetDirtyStops(ctx, "feedid2")
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 0)
+}
+
+func (s *etcdSuite) TestCheckpointGuards(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	feedID := "feedid"
+	createTime := time.Unix(1600000000, 0)
+
+	guards, err := s.client.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 0)
+	for i, captureID := range []string{"capture1", "capture2"} {
+		err = s.client.PutCheckpointGuard(ctx, feedID, captureID, &model.CheckpointGuard{
+			CheckpointTs: uint64(100 * (i + 1)),
+			CreateTime:   createTime,
+		})
+		c.Assert(err, check.IsNil)
+	}
+	err = s.client.PutCheckpointGuard(ctx, "feedid2", "capture1", &model.CheckpointGuard{CheckpointTs: 300})
+	c.Assert(err, check.IsNil)
+	guards, err = s.client.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 2)
+	c.Assert(guards["capture1"].CheckpointTs, check.Equals, uint64(100))
+	c.Assert(guards["capture2"].CheckpointTs, check.Equals, uint64(200))
+	c.Assert(guards["capture2"].CreateTime.Equal(createTime), check.IsTrue)
+
+	// the guard updated after it's read is not deleted
+	err = s.client.PutCheckpointGuard(ctx, feedID, "capture1", &model.CheckpointGuard{CheckpointTs: 150})
+	c.Assert(err, check.IsNil)
+	err = s.client.DeleteCheckpointGuards(ctx, feedID, guards)
+	c.Assert(err, check.IsNil)
+	guards, err = s.client.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 1)
+	c.Assert(guards["capture1"].CheckpointTs, check.Equals, uint64(150))
+
+	err = s.client.RemoveAllCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	guards, err = s.client.GetCheckpointGuards(ctx, feedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 0)
+	guards, err = s.client.GetCheckpointGuards(ctx, "feedid2")
+	c.Assert(err, check.IsNil)
+	c.Assert(guards, check.HasLen, 1)
+}
+
 func (s *etcdSuite) TestGetAllTaskWorkload(c *check.C) {
 	defer testleak.AfterTest(c)()
 	defer s.TearDownTest(c)
@@ -507,13 +848,256 @@ func (s *etcdSuite) TestGetAllCDCInfo(c *check.C) {
 		value string
 	}{{
 		key:   "/tidb/cdc/task/status/CAPTURE_ID/CHANGEFEED_ID",
-		value: "{\"tables\":{\"11\":{\"start-ts\":22,\"mark-table-id\":0}},\"operation\":null,\"admin-job-type\":0}",
+		value: "{\"tables\":null,\"operation\":null,\"admin-job-type\":0}",
+	}, {
+		key:   "/tidb/cdc/task/tables/CAPTURE_ID/CHANGEFEED_ID",
+		value: "{\"11\":{\"start-ts\":22,\"mark-table-id\":0}}",
 	}, {
 		key:   "/tidb/cdc/task/workload/CAPTURE_ID/CHANGEFEED_ID",
 		value: "{\"11\":{\"workload\":1},\"22\":{\"workload\":22}}",
 	}}
+	c.Assert(kvs, check.HasLen, len(expected))
 	for i, kv := range kvs {
 		c.Assert(string(kv.Key), check.Equals, expected[i].key)
 		c.Assert(string(kv.Value), check.Equals, expected[i].value)
 	}
 }
+
+func (s *etcdSuite) TestClusterIsolation(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	// another cluster shares the same etcd with the default cluster
+	other := NewCDCEtcdClient(util.PutClusterIDInCtx(ctx, "cluster-2"), s.client.Client.Unwrap())
+	c.Assert(other.ClusterID, check.Equals, "cluster-2")
+	c.Assert(other.KeyBase(), check.Equals, "/tidb/cdc-cluster-2")
+	c.Assert(s.client.KeyBase(), check.Equals, EtcdKeyBase)
+
+	changefeedID := "test-changefeed"
+	captureID := "test-capture"
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://"}
+	err := s.client.SaveChangeFeedInfo(ctx, info, changefeedID)
+	c.Assert(err, check.IsNil)
+	err = s.client.PutChangeFeedStatus(ctx, changefeedID, &model.ChangeFeedStatus{ResolvedTs: 1})
+	c.Assert(err, check.IsNil)
+	err = s.client.PutTaskStatus(ctx, changefeedID, captureID, &model.TaskStatus{})
+	c.Assert(err, check.IsNil)
+	_, err = s.client.PutTaskPositionOnChange(ctx, changefeedID, captureID, &model.TaskPosition{CheckPointTs: 1})
+	c.Assert(err, check.IsNil)
+	err = s.client.PutTaskWorkload(ctx, changefeedID, captureID, &model.TaskWorkload{1: model.WorkloadInfo{Workload: 1}})
+	c.Assert(err, check.IsNil)
+
+	sess, err := concurrency.NewSession(s.client.Client.Unwrap(),
+		concurrency.WithTTL(10), concurrency.WithContext(ctx))
+	c.Assert(err, check.IsNil)
+	defer sess.Close() //nolint:errcheck
+	err = s.client.PutCaptureInfo(ctx, &model.CaptureInfo{ID: captureID, AdvertiseAddr: "127.0.0.1:8300"}, sess.Lease())
+	c.Assert(err, check.IsNil)
+	err = concurrency.NewElection(sess, s.client.CaptureOwnerKey()).Campaign(ctx, captureID)
+	c.Assert(err, check.IsNil)
+
+	// nothing of the default cluster is visible to the other cluster
+	_, changefeeds, err := other.GetChangeFeeds(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(changefeeds, check.HasLen, 0)
+	_, err = other.GetChangeFeedInfo(ctx, changefeedID)
+	c.Assert(cerror.ErrChangeFeedNotExists.Equal(err), check.IsTrue)
+	_, _, err = other.GetChangeFeedStatus(ctx, changefeedID)
+	c.Assert(cerror.ErrChangeFeedNotExists.Equal(err), check.IsTrue)
+	statuses, err := other.GetAllTaskStatus(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses, check.HasLen, 0)
+	positions, err := other.GetAllTaskPositions(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(positions, check.HasLen, 0)
+	workloads, err := other.GetAllTaskWorkloads(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(workloads, check.HasLen, 0)
+	_, captures, err := other.GetCaptures(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(captures, check.HasLen, 0)
+	_, err = other.GetOwnerID(ctx, other.CaptureOwnerKey())
+	c.Assert(err, check.Equals, concurrency.ErrElectionNoLeader)
+	ownerID, err := s.client.GetOwnerID(ctx, s.client.CaptureOwnerKey())
+	c.Assert(err, check.IsNil)
+	c.Assert(ownerID, check.Equals, captureID)
+
+	// and vice versa
+	err = other.SaveChangeFeedInfo(ctx, info, "other-changefeed")
+	c.Assert(err, check.IsNil)
+	_, changefeeds, err = s.client.GetChangeFeeds(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(changefeeds, check.HasLen, 1)
+	c.Assert(changefeeds, check.HasKey, changefeedID)
+	kvs, err := s.client.GetAllCDCInfo(ctx)
+	c.Assert(err, check.IsNil)
+	for _, kv := range kvs {
+		c.Assert(string(kv.Key), check.Not(check.Matches), other.KeyBase()+".*")
+	}
+
+	// clearing the other cluster doesn't touch the default cluster
+	err = other.ClearAllCDCInfo(ctx)
+	c.Assert(err, check.IsNil)
+	_, changefeeds, err = other.GetChangeFeeds(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(changefeeds, check.HasLen, 0)
+	_, err = s.client.GetChangeFeedInfo(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *etcdSuite) TestGetEtcdKeyBase(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	c.Assert(GetEtcdKeyBase(""), check.Equals, "/tidb/cdc")
+	c.Assert(GetEtcdKeyBase("cluster-1"), check.Equals, "/tidb/cdc-cluster-1")
+	cli := CDCEtcdClient{ClusterID: "cluster-1"}
+	c.Assert(cli.CaptureOwnerKey(), check.Equals, "/tidb/cdc-cluster-1/owner")
+	c.Assert(cli.GetEtcdKeyTaskStatus("cf", "capture"), check.Equals, "/tidb/cdc-cluster-1/task/status/capture/cf")
+	c.Assert(cli.GetEtcdKeyChangeFeedInfo("cf"), check.Equals, "/tidb/cdc-cluster-1/changefeed/info/cf")
+}
+
+func (s *etcdSuite) TestChangeFeedHistory(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	changefeedID := "test-changefeed-history"
+
+	_, history, err := s.client.GetChangeFeedHistory(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 0)
+
+	err = s.client.AppendChangeFeedHistory(ctx, changefeedID, &model.ChangefeedEvent{
+		Type:   model.ChangefeedEventCreate,
+		Client: "root@localhost",
+	})
+	c.Assert(err, check.IsNil)
+	events := make([]*model.ChangefeedEvent, 0, model.ChangefeedHistoryLimit)
+	for i := 0; i < model.ChangefeedHistoryLimit; i++ {
+		events = append(events, &model.ChangefeedEvent{Type: model.ChangefeedEventMoveTable, Ts: uint64(i)})
+	}
+	err = s.client.AppendChangeFeedHistory(ctx, changefeedID, events...)
+	c.Assert(err, check.IsNil)
+	// the events passed in are not modified
+	c.Assert(events[0].ID, check.Equals, int64(0))
+
+	// the oldest event is trimmed
+	_, history, err = s.client.GetChangeFeedHistory(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.LastID, check.Equals, int64(model.ChangefeedHistoryLimit+1))
+	c.Assert(history.Events, check.HasLen, model.ChangefeedHistoryLimit)
+	c.Assert(history.Events[0].ID, check.Equals, int64(2))
+	c.Assert(history.Events[0].Type, check.Equals, model.ChangefeedEventMoveTable)
+
+	err = s.client.DeleteChangeFeedHistory(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	_, history, err = s.client.GetChangeFeedHistory(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 0)
+}
+
+func (s *etcdSuite) TestConcurrentAppendChangeFeedHistory(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := context.Background()
+	changefeedID := "test-changefeed-history"
+
+	// the old owner and the new owner write the history at the same time
+	// during owner switch, no events should be lost.
+	const eventsPerWriter = 60
+	writers := []string{"old-owner", "new-owner"}
+	var errg errgroup.Group
+	for _, writer := range writers {
+		writer := writer
+		cli := NewCDCEtcdClient(ctx, s.client.Client.Unwrap())
+		errg.Go(func() error {
+			for i := 0; i < eventsPerWriter; i++ {
+				err := cli.AppendChangeFeedHistory(ctx, changefeedID, &model.ChangefeedEvent{
+					Type:  model.ChangefeedEventOwnerChange,
+					Owner: writer,
+					Ts:    uint64(i),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	c.Assert(errg.Wait(), check.IsNil)
+
+	_, history, err := s.client.GetChangeFeedHistory(ctx, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.LastID, check.Equals, int64(eventsPerWriter*len(writers)))
+	c.Assert(history.Events, check.HasLen, eventsPerWriter*len(writers))
+	nextTs := make(map[string]uint64)
+	for i, event := range history.Events {
+		c.Assert(event.ID, check.Equals, int64(i+1))
+		c.Assert(event.Ts, check.Equals, nextTs[event.Owner])
+		nextTs[event.Owner]++
+	}
+}
+
+// BenchmarkAtomicPutTaskStatus measures the updates of the operations of a
+// task status of 8k tables, which is what the processor flushes on scheduling.
+func BenchmarkAtomicPutTaskStatus(b *testing.B) {
+	dir, err := ioutil.TempDir("", "etcd-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clientURL, e, err := etcd.SetupEmbedEtcd(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer e.Close()
+	logConfig := logutil.DefaultZapLoggerConfig
+	logConfig.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 3 * time.Second,
+		LogConfig:   &logConfig,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	cli := NewCDCEtcdClient(context.Background(), client)
+	defer cli.Close() //nolint:errcheck
+	ctx := context.Background()
+
+	const tableNum = 8192
+	status := &model.TaskStatus{
+		Tables:    make(map[model.TableID]*model.TableReplicaInfo, tableNum),
+		Operation: make(map[model.TableID]*model.TableOperation, tableNum),
+	}
+	for i := 0; i < tableNum; i++ {
+		status.Tables[model.TableID(i)] = &model.TableReplicaInfo{StartTs: 420000000000000000 + uint64(i)}
+	}
+	if err := cli.PutTaskStatus(ctx, "feed", "capture", status); err != nil {
+		b.Fatal(err)
+	}
+
+	var writtenBytes int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tableID := model.TableID(i % tableNum)
+		_, revision, err := cli.AtomicPutTaskStatus(ctx, "feed", "capture", func(_ int64, status *model.TaskStatus) (bool, error) {
+			status.Operation[tableID] = &model.TableOperation{BoundaryTs: uint64(i), Status: model.OperFinished, Done: true}
+			return true, nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		resp, err := client.Get(ctx, cli.TaskKeyPrefix(), clientv3.WithPrefix())
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, kv := range resp.Kvs {
+			if kv.ModRevision == revision {
+				writtenBytes += int64(len(kv.Value))
+			}
+		}
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(writtenBytes)/float64(b.N), "written-bytes/op")
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+	"go.uber.org/zap"
+)
+
+// maxCorruptedValueLen is the max length of the corrupted value kept in the
+// error, the value of a task status may be huge.
+const maxCorruptedValueLen = 256
+
+// maxWarnedUnknownFields is the max number of the keys whose unknown fields
+// are remembered, the warnings are logged again once it's exceeded.
+const maxWarnedUnknownFields = 4096
+
+var warnedUnknownFields struct {
+	sync.Mutex
+	keys map[string]string
+}
+
+// warnUnknownFields logs the unknown fields of the etcd key, which are written
+// by a newer version. The same unknown fields of a key are logged only once,
+// since the keys are decoded repeatedly, e.g. the task status is decoded in
+// each tick of the owner.
+func warnUnknownFields(kind, key string, unknown error) {
+	msg := unknown.Error()
+	warnedUnknownFields.Lock()
+	if warnedUnknownFields.keys[key] == msg {
+		warnedUnknownFields.Unlock()
+		return
+	}
+	if warnedUnknownFields.keys == nil || len(warnedUnknownFields.keys) >= maxWarnedUnknownFields {
+		warnedUnknownFields.keys = make(map[string]string)
+	}
+	warnedUnknownFields.keys[key] = msg
+	warnedUnknownFields.Unlock()
+	log.Warn("ignore the unknown fields of the "+kind, zap.String("key", key), zap.Error(unknown))
+}
+
+func truncateValue(value []byte) string {
+	if len(value) <= maxCorruptedValueLen {
+		return string(value)
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", value[:maxCorruptedValueLen], len(value)-maxCorruptedValueLen)
+}
+
+// unmarshalMetadata unmarshals the value of the etcd key into v. The unknown
+// fields, which may be written by a newer version, are ignored and returned
+// as unknown. ErrEtcdValueCorrupted naming the key is returned if the value
+// is not a valid json of v.
+func unmarshalMetadata(key string, value []byte, v interface{}) (unknown error, err error) {
+	// the value is decoded strictly first, and it's decoded again ignoring
+	// the unknown fields only if there are any
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.DisallowUnknownFields()
+	unknown = decoder.Decode(v)
+	if unknown == nil {
+		// the values followed by anything else are rejected, as json.Unmarshal
+		// does
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(
+				key, "invalid data after the top-level value", truncateValue(value))
+		}
+		return nil, nil
+	}
+	if !strings.HasPrefix(unknown.Error(), "json: unknown field ") {
+		return nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(key, unknown, truncateValue(value))
+	}
+	// the fields decoded before the unknown field are reset
+	elem := reflect.ValueOf(v).Elem()
+	elem.Set(reflect.Zero(elem.Type()))
+	if err := json.Unmarshal(value, v); err != nil {
+		return nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(key, err, truncateValue(value))
+	}
+	return unknown, nil
+}
+
+// UnmarshalTaskStatus unmarshals the task status stored in the etcd key, the
+// unknown fields are ignored with a warning. ErrEtcdValueCorrupted is returned
+// if the value is not a valid task status, e.g. it's edited by hand.
+func UnmarshalTaskStatus(key string, value []byte) (*model.TaskStatus, error) {
+	status, unknown, err := unmarshalTaskStatus(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if unknown != nil {
+		warnUnknownFields("task status", key, unknown)
+	}
+	return status, nil
+}
+
+func unmarshalTaskStatus(key string, value []byte) (status *model.TaskStatus, unknown error, err error) {
+	status = &model.TaskStatus{}
+	unknown, err = unmarshalMetadata(key, value, status)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the null tables and operations are unmarshaled into nil pointers
+	for tableID, table := range status.Tables {
+		if table == nil {
+			return nil, nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(
+				key, fmt.Sprintf("the replica info of table %d is null", tableID), truncateValue(value))
+		}
+	}
+	for tableID, op := range status.Operation {
+		if op == nil {
+			return nil, nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(
+				key, fmt.Sprintf("the operation of table %d is null", tableID), truncateValue(value))
+		}
+	}
+	for tableID, op := range status.ForceAdvance {
+		if op == nil {
+			return nil, nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(
+				key, fmt.Sprintf("the force advance operation of table %d is null", tableID), truncateValue(value))
+		}
+	}
+	return status, unknown, nil
+}
+
+// unmarshalTaskTables unmarshals the tables of a task status stored in the
+// task tables key.
+func unmarshalTaskTables(key string, value []byte) (tables map[model.TableID]*model.TableReplicaInfo, unknown error, err error) {
+	unknown, err = unmarshalMetadata(key, value, &tables)
+	if err != nil {
+		return nil, nil, err
+	}
+	for tableID, table := range tables {
+		if table == nil {
+			return nil, nil, cerror.ErrEtcdValueCorrupted.GenWithStackByArgs(
+				key, fmt.Sprintf("the replica info of table %d is null", tableID), truncateValue(value))
+		}
+	}
+	return tables, unknown, nil
+}
+
+// decodeTaskStatus decodes the task status stored in the task status key and
+// the task tables key. The task status written by the previous versions keeps
+// the tables in itself, which are used if the task tables key doesn't exist.
+func decodeTaskStatus(statusKv, tablesKv *mvccpb.KeyValue) (*model.TaskStatus, error) {
+	status, err := UnmarshalTaskStatus(string(statusKv.Key), statusKv.Value)
+	if err != nil {
+		return nil, err
+	}
+	if tablesKv == nil {
+		return status, nil
+	}
+	tables, unknown, err := unmarshalTaskTables(string(tablesKv.Key), tablesKv.Value)
+	if err != nil {
+		return nil, err
+	}
+	if unknown != nil {
+		warnUnknownFields("task tables", string(tablesKv.Key), unknown)
+	}
+	status.Tables = tables
+	return status, nil
+}
+
+// GetCDCInfo queries the etcd key of the cluster, the key is relative to the
+// key base unless it's prefixed by the key base.
+func (c CDCEtcdClient) GetCDCInfo(ctx context.Context, key string) (*mvccpb.KeyValue, error) {
+	if !strings.HasPrefix(key, c.KeyBase()+"/") {
+		key = c.KeyBase() + "/" + strings.TrimPrefix(key, "/")
+	}
+	resp, err := c.Client.Get(ctx, key)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+	}
+	if resp.Count == 0 {
+		return nil, cerror.ErrInvalidEtcdKey.GenWithStackByArgs(key)
+	}
+	return resp.Kvs[0], nil
+}
+
+// ValidateMetadata checks whether the value of the etcd key of the cluster
+// can be unmarshaled into the type stored in the key. The unknown fields are
+// returned as unknown, and the kind of the key is empty if the key is not
+// recognized, which is not validated.
+func (c CDCEtcdClient) ValidateMetadata(key string, value []byte) (kind string, unknown error, err error) {
+	var v interface{}
+	switch {
+	case strings.HasPrefix(key, c.TaskStatusKeyPrefix()+"/"):
+		_, unknown, err = unmarshalTaskStatus(key, value)
+		return "task status", unknown, err
+	case strings.HasPrefix(key, c.TaskTablesKeyPrefix()+"/"):
+		_, unknown, err = unmarshalTaskTables(key, value)
+		return "task tables", unknown, err
+	case strings.HasPrefix(key, c.TaskPositionKeyPrefix()+"/"):
+		kind, v = "task position", &model.TaskPosition{}
+	case strings.HasPrefix(key, c.TaskWorkloadKeyPrefix()+"/"):
+		kind, v = "task workload", &model.TaskWorkload{}
+	case strings.HasPrefix(key, c.GetEtcdKeyChangeFeedList()+"/"):
+		kind, v = "changefeed info", &model.ChangeFeedInfo{}
+	case strings.HasPrefix(key, c.JobKeyPrefix()+"/"):
+		kind, v = "changefeed status", &model.ChangeFeedStatus{}
+	case strings.HasPrefix(key, c.CaptureInfoKeyPrefix()+"/"):
+		kind, v = "capture info", &model.CaptureInfo{}
+	case strings.HasPrefix(key, c.DirtyStopKeyPrefix()+"/"):
+		kind, v = "dirty stop", &model.DirtyStop{}
+	case strings.HasPrefix(key, c.CheckpointGuardKeyPrefix()+"/"):
+		kind, v = "checkpoint guard", &model.CheckpointGuard{}
+	default:
+		return "", nil, nil
+	}
+	unknown, err = unmarshalMetadata(key, value, v)
+	return kind, unknown, err
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type metadataSuite struct{}
+
+var _ = check.Suite(&metadataSuite{})
+
+func (s *metadataSuite) TestUnmarshalTaskStatus(c *check.C) {
+	defer testleak.AfterTest(c)()
+	key := "/tidb/cdc/task/status/capture-1/test-changefeed"
+
+	status, err := UnmarshalTaskStatus(key, []byte(`{"tables":{"1":{"start-ts":10}},"operation":null,"admin-job-type":0}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(10))
+
+	// the unknown fields are ignored
+	status, err = UnmarshalTaskStatus(key, []byte(`{"tables":{"1":{"start-ts":10,"new-field":1}},"new-field":"x"}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(10))
+	_, unknown, err := unmarshalTaskStatus(key, []byte(`{"new-field":"x"}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(unknown, check.ErrorMatches, ".*unknown field.*new-field.*")
+	// the fields decoded before the unknown field are kept
+	status, unknown, err = unmarshalTaskStatus(key, []byte(`{"admin-job-type":1,"new-field":"x","tables":{"1":{"start-ts":10}}}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(unknown, check.NotNil)
+	c.Assert(status.AdminJobType, check.Equals, model.AdminStop)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(10))
+	// the unknown fields of a key are remembered once they're warned
+	c.Assert(warnedUnknownFields.keys[key], check.Equals, unknown.Error())
+
+	for _, value := range []string{
+		`{"tables":{"1":{"start-ts":10}}`,
+		`{"tables":{"1":{"start-ts":10}}}}`,
+		`{"tables":{"1":{"start-ts":"10"}}}`,
+		`{"tables":{"a":{"start-ts":10}}}`,
+		`{"tables":{"1":null}}`,
+		`{"operation":{"1":null}}`,
+		`[]`,
+		``,
+	} {
+		_, err := UnmarshalTaskStatus(key, []byte(value))
+		c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue, check.Commentf("%s: %v", value, err))
+		c.Assert(err, check.ErrorMatches, ".*"+key+".*")
+	}
+
+	// the value is truncated in the error
+	value := `{"tables":{` + strings.Repeat(`"1":{"start-ts":10},`, 100) + `}}`
+	_, err = UnmarshalTaskStatus(key, []byte(value))
+	c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*bytes truncated.*")
+	c.Assert(len(err.Error()) < len(value), check.IsTrue)
+}
+
+func (s *metadataSuite) TestUnmarshalCorruptedTaskStatus(c *check.C) {
+	defer testleak.AfterTest(c)()
+	key := "/tidb/cdc/task/status/capture-1/test-changefeed"
+	status := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 10}, 2: {StartTs: 20, MarkTableID: 3}},
+		Operation: map[model.TableID]*model.TableOperation{
+			2: {BoundaryTs: 20, Status: model.OperDispatched},
+		},
+		DrainBoundary: map[model.TableID]model.Ts{4: 40},
+	}
+	data, err := status.Marshal()
+	c.Assert(err, check.IsNil)
+
+	// the corrupted payloads never cause a panic, either the task status or
+	// ErrEtcdValueCorrupted is returned
+	alphabet := []byte(`{}[]":,0123456789-.abcdefnrstu `)
+	rnd := rand.New(rand.NewSource(0))
+	for i := 0; i < 10000; i++ {
+		value := []byte(data)
+		switch rnd.Intn(3) {
+		case 0:
+			value = value[:rnd.Intn(len(value))]
+		case 1:
+			value[rnd.Intn(len(value))] = alphabet[rnd.Intn(len(alphabet))]
+		case 2:
+			pos := rnd.Intn(len(value))
+			value = append(value[:pos:pos], value[pos+rnd.Intn(len(value)-pos):]...)
+		}
+		status, err := UnmarshalTaskStatus(key, value)
+		if err != nil {
+			c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue, check.Commentf("%s: %v", value, err))
+			continue
+		}
+		for _, table := range status.Tables {
+			c.Assert(table, check.NotNil)
+		}
+		for _, op := range status.Operation {
+			c.Assert(op, check.NotNil)
+		}
+		status.AppliedTs()
+		status.Snapshot("test-changefeed", "capture-1", 100)
+	}
+}
+
+func (s *etcdSuite) TestValidateMetadata(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx := s.ctx
+
+	_, err := s.client.GetCDCInfo(ctx, "task/status/capture-1/feed")
+	c.Assert(cerror.ErrInvalidEtcdKey.Equal(err), check.IsTrue)
+
+	_, err = s.client.Client.Put(ctx, s.client.GetEtcdKeyTaskStatus("feed", "capture-1"), `{"tables":{"1":null}}`)
+	c.Assert(err, check.IsNil)
+	_, err = s.client.Client.Put(ctx, s.client.GetEtcdKeyTaskPosition("feed", "capture-1"), `{"checkpoint-ts":1,"new-field":1}`)
+	c.Assert(err, check.IsNil)
+	_, err = s.client.Client.Put(ctx, s.client.GetEtcdKeyJob("feed"), `{"checkpoint-ts":1}`)
+	c.Assert(err, check.IsNil)
+	_, err = s.client.Client.Put(ctx, s.client.KeyBase()+"/unknown", `not json`)
+	c.Assert(err, check.IsNil)
+
+	// the key base can be omitted
+	kv, err := s.client.GetCDCInfo(ctx, "/task/status/capture-1/feed")
+	c.Assert(err, check.IsNil)
+	kind, _, err := s.client.ValidateMetadata(string(kv.Key), kv.Value)
+	c.Assert(kind, check.Equals, "task status")
+	c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue)
+	_, _, err = s.client.GetTaskStatus(ctx, "feed", "capture-1")
+	c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue)
+
+	_, err = s.client.Client.Put(ctx, s.client.GetEtcdKeyTaskTables("feed", "capture-1"), `{"1":null}`)
+	c.Assert(err, check.IsNil)
+	kv, err = s.client.GetCDCInfo(ctx, s.client.GetEtcdKeyTaskTables("feed", "capture-1"))
+	c.Assert(err, check.IsNil)
+	kind, _, err = s.client.ValidateMetadata(string(kv.Key), kv.Value)
+	c.Assert(kind, check.Equals, "task tables")
+	c.Assert(cerror.ErrEtcdValueCorrupted.Equal(err), check.IsTrue)
+
+	kv, err = s.client.GetCDCInfo(ctx, s.client.GetEtcdKeyTaskPosition("feed", "capture-1"))
+	c.Assert(err, check.IsNil)
+	kind, unknown, err := s.client.ValidateMetadata(string(kv.Key), kv.Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(kind, check.Equals, "task position")
+	c.Assert(unknown, check.NotNil)
+
+	kv, err = s.client.GetCDCInfo(ctx, s.client.GetEtcdKeyJob("feed"))
+	c.Assert(err, check.IsNil)
+	kind, unknown, err = s.client.ValidateMetadata(string(kv.Key), kv.Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(kind, check.Equals, "changefeed status")
+	c.Assert(unknown, check.IsNil)
+
+	kv, err = s.client.GetCDCInfo(ctx, "unknown")
+	c.Assert(err, check.IsNil)
+	kind, _, err = s.client.ValidateMetadata(string(kv.Key), kv.Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(kind, check.Equals, "")
+}
@@ -75,6 +75,27 @@ var (
 			Help:      "The number of region in one batch resolved ts event",
 			Buckets:   prometheus.ExponentialBuckets(2, 2, 16),
 		}, []string{"capture", "changefeed"})
+	regionInfoRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "kvclient",
+			Name:      "region_info_request_count",
+			Help:      "The number of region info requests, by the source they're served by, the requests not served by pd are saved",
+		}, []string{"capture", "method", "source"})
+	storePullBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "kvclient",
+			Name:      "store_pull_bytes",
+			Help:      "The bytes received from each tikv store by the pullers of the changefeed",
+		}, []string{"capture", "changefeed", "store"})
+	storePullEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "kvclient",
+			Name:      "store_pull_event_count",
+			Help:      "The number of events received from each tikv store by the pullers of the changefeed",
+		}, []string{"capture", "changefeed", "store"})
 	etcdRequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "ticdc",
@@ -94,5 +115,8 @@ func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(sendEventCounter)
 	registry.MustRegister(clientChannelSize)
 	registry.MustRegister(batchResolvedEventSize)
+	registry.MustRegister(regionInfoRequestCounter)
+	registry.MustRegister(storePullBytesCounter)
+	registry.MustRegister(storePullEventCounter)
 	registry.MustRegister(etcdRequestCounter)
 }
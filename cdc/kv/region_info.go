@@ -0,0 +1,408 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/btree"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/log"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultRegionInfoTTL is the time a region loaded from PD is served from
+	// the cache, which bounds the staleness of the region info
+	DefaultRegionInfoTTL = 500 * time.Millisecond
+	// DefaultRegionScanBatchWindow is the time the concurrent region scans are
+	// collected for before they're batched into one
+	DefaultRegionScanBatchWindow = 5 * time.Millisecond
+
+	// maxRegionScanBatchSize is the number of scans in a batch, the batch is
+	// sent without waiting for the window once it's full
+	maxRegionScanBatchSize = 64
+	// maxBatchScanRegions is the limit of the regions of a batched scan, the
+	// scans not covered by it are sent alone
+	maxBatchScanRegions = 1024
+)
+
+// the sources the region info requests are served by
+const (
+	regionInfoSourcePD        = "pd"
+	regionInfoSourceCache     = "cache"
+	regionInfoSourceCoalesced = "coalesced"
+	regionInfoSourceBatched   = "batched"
+)
+
+// RegionInfoClient is a pd client shared by the kv clients of all tables in a
+// capture, which reduces the region info requests to PD:
+//   - the regions loaded in the last TTL are served from the cache, so the
+//     region info served is never staler than the TTL
+//   - the concurrent requests of the same key or range are coalesced into one
+//   - the concurrent region scans are batched into one scan from the first
+//     range to the last one, which covers the contiguous tables with one call
+//
+// The other requests are passed through to the underlying client.
+type RegionInfoClient struct {
+	pd.Client
+	captureAddr string
+	ttl         time.Duration
+	batchWindow time.Duration
+	group       singleflight.Group
+
+	mu        sync.Mutex
+	regions   *btree.BTree
+	byID      map[uint64]*cachedRegion
+	batch     *regionScanBatch
+	lastPurge time.Time
+}
+
+var _ pd.Client = &RegionInfoClient{}
+
+type cachedRegion struct {
+	region   *pd.Region
+	loadTime time.Time
+}
+
+// Less implements btree.Item
+func (r *cachedRegion) Less(than btree.Item) bool {
+	return bytes.Compare(r.region.Meta.StartKey, than.(*cachedRegion).region.Meta.StartKey) < 0
+}
+
+func (r *cachedRegion) contains(key []byte) bool {
+	meta := r.region.Meta
+	return bytes.Compare(meta.StartKey, key) <= 0 && (len(meta.EndKey) == 0 || bytes.Compare(key, meta.EndKey) < 0)
+}
+
+func (r *cachedRegion) overlaps(startKey, endKey []byte) bool {
+	meta := r.region.Meta
+	return (len(endKey) == 0 || bytes.Compare(meta.StartKey, endKey) < 0) &&
+		(len(meta.EndKey) == 0 || bytes.Compare(startKey, meta.EndKey) < 0)
+}
+
+func regionPivot(key []byte) *cachedRegion {
+	return &cachedRegion{region: &pd.Region{Meta: &metapb.Region{StartKey: key}}}
+}
+
+// regionScanBatch collects the concurrent scans, the first scan joining the
+// batch sends it after the batch window, and the others wait for it.
+type regionScanBatch struct {
+	startKey []byte
+	endKey   []byte
+	size     int
+	// full is notified when the batch is full
+	full chan struct{}
+	done chan struct{}
+}
+
+func (b *regionScanBatch) add(startKey, endKey []byte) {
+	if bytes.Compare(startKey, b.startKey) < 0 {
+		b.startKey = startKey
+	}
+	// an empty end key is unbounded
+	if len(b.endKey) != 0 && (len(endKey) == 0 || bytes.Compare(endKey, b.endKey) > 0) {
+		b.endKey = endKey
+	}
+	b.size++
+}
+
+// NewRegionInfoClient wraps the pd client, the regions are cached for ttl and
+// the scans are batched in batchWindow, which is disabled if it's zero.
+// Closing it closes the underlying client.
+func NewRegionInfoClient(pdCli pd.Client, captureAddr string, ttl, batchWindow time.Duration) *RegionInfoClient {
+	return &RegionInfoClient{
+		Client:      pdCli,
+		captureAddr: captureAddr,
+		ttl:         ttl,
+		batchWindow: batchWindow,
+		regions:     btree.New(32),
+		byID:        make(map[uint64]*cachedRegion),
+	}
+}
+
+// GetRegion implements pd.Client
+func (c *RegionInfoClient) GetRegion(ctx context.Context, key []byte) (*pd.Region, error) {
+	c.mu.Lock()
+	cached := c.lookupLocked(key, time.Now())
+	c.mu.Unlock()
+	if cached != nil {
+		c.observe("get-region", regionInfoSourceCache)
+		return cached.region, nil
+	}
+	return c.load("get-region", fmt.Sprintf("key/%x", key), func() (*pd.Region, error) {
+		return c.Client.GetRegion(ctx, key)
+	})
+}
+
+// GetRegionByID implements pd.Client
+func (c *RegionInfoClient) GetRegionByID(ctx context.Context, regionID uint64) (*pd.Region, error) {
+	c.mu.Lock()
+	cached, ok := c.byID[regionID]
+	if ok && !c.fresh(cached, time.Now()) {
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		c.observe("get-region-by-id", regionInfoSourceCache)
+		return cached.region, nil
+	}
+	return c.load("get-region-by-id", fmt.Sprintf("id/%d", regionID), func() (*pd.Region, error) {
+		return c.Client.GetRegionByID(ctx, regionID)
+	})
+}
+
+// load loads a region from PD, the concurrent loads of the same key are
+// coalesced
+func (c *RegionInfoClient) load(method, key string, fn func() (*pd.Region, error)) (*pd.Region, error) {
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		loadTime := time.Now()
+		region, err := fn()
+		c.observe(method, regionInfoSourcePD)
+		if err != nil {
+			return nil, err
+		}
+		c.putRegions(loadTime, region)
+		return region, nil
+	})
+	if shared {
+		c.observe(method, regionInfoSourceCoalesced)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*pd.Region), nil
+}
+
+// ScanRegions implements pd.Client
+func (c *RegionInfoClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*pd.Region, error) {
+	if regions := c.scanCached(key, endKey, limit); regions != nil {
+		c.observe("scan-regions", regionInfoSourceCache)
+		return regions, nil
+	}
+	if c.batchWindow > 0 {
+		if err := c.waitBatch(ctx, key, endKey); err != nil {
+			return nil, err
+		}
+		if regions := c.scanCached(key, endKey, limit); regions != nil {
+			c.observe("scan-regions", regionInfoSourceBatched)
+			return regions, nil
+		}
+	}
+	v, err, shared := c.group.Do(fmt.Sprintf("scan/%x/%x/%d", key, endKey, limit), func() (interface{}, error) {
+		loadTime := time.Now()
+		regions, err := c.Client.ScanRegions(ctx, key, endKey, limit)
+		c.observe("scan-regions", regionInfoSourcePD)
+		if err != nil {
+			return nil, err
+		}
+		c.putRegions(loadTime, regions...)
+		return regions, nil
+	})
+	if shared {
+		c.observe("scan-regions", regionInfoSourceCoalesced)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.([]*pd.Region), nil
+}
+
+// waitBatch joins the scan to the open batch, or opens one, and returns after
+// the batch is sent. The regions loaded by the batch are put into the cache,
+// the scan is sent alone if it's not covered by them.
+func (c *RegionInfoClient) waitBatch(ctx context.Context, key, endKey []byte) error {
+	c.mu.Lock()
+	b := c.batch
+	leader := b == nil
+	if leader {
+		b = &regionScanBatch{
+			startKey: key,
+			endKey:   endKey,
+			size:     1,
+			full:     make(chan struct{}, 1),
+			done:     make(chan struct{}),
+		}
+		c.batch = b
+	} else {
+		b.add(key, endKey)
+	}
+	full := b.size >= maxRegionScanBatchSize
+	if full {
+		c.batch = nil
+	}
+	c.mu.Unlock()
+
+	if !leader {
+		if full {
+			// wakes up the leader
+			b.full <- struct{}{}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return nil
+		}
+	}
+
+	defer close(b.done)
+	timer := time.NewTimer(c.batchWindow)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		c.closeBatch(b)
+		return ctx.Err()
+	case <-timer.C:
+	case <-b.full:
+	}
+	startKey, batchEndKey, size := c.closeBatch(b)
+	if size == 1 {
+		// nothing to batch with
+		return nil
+	}
+	loadTime := time.Now()
+	regions, err := c.Client.ScanRegions(ctx, startKey, batchEndKey, maxBatchScanRegions)
+	c.observe("scan-regions", regionInfoSourcePD)
+	if err != nil {
+		// the scans in the batch are sent alone
+		log.Warn("batch scan regions failed",
+			zap.Binary("startKey", startKey), zap.Binary("endKey", batchEndKey), zap.Int("size", size), zap.Error(err))
+		return nil
+	}
+	c.putRegions(loadTime, regions...)
+	return nil
+}
+
+// closeBatch stops the batch from being joined, and returns its range and size
+func (c *RegionInfoClient) closeBatch(b *regionScanBatch) ([]byte, []byte, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.batch == b {
+		c.batch = nil
+	}
+	return b.startKey, b.endKey, b.size
+}
+
+// scanCached returns the regions of the range if the fresh regions in the
+// cache cover it, or up to limit regions of it, without a gap.
+func (c *RegionInfoClient) scanCached(key, endKey []byte, limit int) []*pd.Region {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var regions []*pd.Region
+	next := key
+	for {
+		cached := c.lookupLocked(next, now)
+		if cached == nil {
+			return nil
+		}
+		regions = append(regions, cached.region)
+		next = cached.region.Meta.EndKey
+		if limit > 0 && len(regions) >= limit {
+			return regions
+		}
+		if len(next) == 0 || (len(endKey) != 0 && bytes.Compare(next, endKey) >= 0) {
+			return regions
+		}
+	}
+}
+
+// lookupLocked returns the fresh region containing the key
+func (c *RegionInfoClient) lookupLocked(key []byte, now time.Time) *cachedRegion {
+	var found *cachedRegion
+	c.regions.DescendLessOrEqual(regionPivot(key), func(item btree.Item) bool {
+		found = item.(*cachedRegion)
+		return false
+	})
+	if found == nil || !found.contains(key) || !c.fresh(found, now) {
+		return nil
+	}
+	return found
+}
+
+func (c *RegionInfoClient) fresh(r *cachedRegion, now time.Time) bool {
+	return now.Sub(r.loadTime) < c.ttl
+}
+
+// putRegions puts the regions loaded at loadTime into the cache, the cached
+// regions overlapping them are removed, as they're split or merged.
+func (c *RegionInfoClient) putRegions(loadTime time.Time, regions ...*pd.Region) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, region := range regions {
+		// PD returns nil if it doesn't know the region temporarily
+		if region == nil || region.Meta == nil {
+			continue
+		}
+		if old, ok := c.byID[region.Meta.Id]; ok {
+			c.removeLocked(old)
+		}
+		var overlapped []*cachedRegion
+		c.regions.DescendLessOrEqual(regionPivot(region.Meta.StartKey), func(item btree.Item) bool {
+			overlapped = append(overlapped, item.(*cachedRegion))
+			return false
+		})
+		c.regions.AscendGreaterOrEqual(regionPivot(region.Meta.StartKey), func(item btree.Item) bool {
+			r := item.(*cachedRegion)
+			if len(region.Meta.EndKey) != 0 && bytes.Compare(r.region.Meta.StartKey, region.Meta.EndKey) >= 0 {
+				return false
+			}
+			overlapped = append(overlapped, r)
+			return true
+		})
+		for _, r := range overlapped {
+			if r.overlaps(region.Meta.StartKey, region.Meta.EndKey) {
+				c.removeLocked(r)
+			}
+		}
+		cached := &cachedRegion{region: region, loadTime: loadTime}
+		c.regions.ReplaceOrInsert(cached)
+		c.byID[region.Meta.Id] = cached
+	}
+	// the expired regions are useless, they're purged once per TTL so that
+	// the cache holds only the regions being used
+	if loadTime.Sub(c.lastPurge) >= c.ttl {
+		c.lastPurge = loadTime
+		var expired []*cachedRegion
+		c.regions.Ascend(func(item btree.Item) bool {
+			if r := item.(*cachedRegion); !c.fresh(r, loadTime) {
+				expired = append(expired, r)
+			}
+			return true
+		})
+		for _, r := range expired {
+			c.removeLocked(r)
+		}
+	}
+}
+
+func (c *RegionInfoClient) removeLocked(r *cachedRegion) {
+	if item := c.regions.Get(r); item == r {
+		c.regions.Delete(r)
+	}
+	if c.byID[r.region.Meta.Id] == r {
+		delete(c.byID, r.region.Meta.Id)
+	}
+}
+
+func (c *RegionInfoClient) observe(method, source string) {
+	regionInfoRequestCounter.WithLabelValues(c.captureAddr, method, source).Inc()
+}
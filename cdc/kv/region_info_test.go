@@ -0,0 +1,209 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	pd "github.com/tikv/pd/client"
+)
+
+type regionInfoSuite struct{}
+
+var _ = check.Suite(&regionInfoSuite{})
+
+// mockRegionPDClient serves the contiguous regions, the leaders of the regions
+// are on the store of the current epoch, which is bumped by a leader transfer
+type mockRegionPDClient struct {
+	pd.Client
+	regions []*metapb.Region
+	epoch   uint64
+	delay   time.Duration
+
+	scanCalls int64
+	getCalls  int64
+}
+
+func newMockRegionPDClient(count int, delay time.Duration) *mockRegionPDClient {
+	m := &mockRegionPDClient{epoch: 1, delay: delay}
+	for i := 0; i < count; i++ {
+		m.regions = append(m.regions, &metapb.Region{
+			Id:       uint64(i + 1),
+			StartKey: regionTestKey(i),
+			EndKey:   regionTestKey(i + 1),
+		})
+	}
+	return m
+}
+
+func regionTestKey(i int) []byte {
+	return []byte(fmt.Sprintf("k%06d", i))
+}
+
+func (m *mockRegionPDClient) transferLeaders() {
+	atomic.AddUint64(&m.epoch, 1)
+}
+
+func (m *mockRegionPDClient) region(meta *metapb.Region) *pd.Region {
+	return &pd.Region{Meta: meta, Leader: &metapb.Peer{StoreId: atomic.LoadUint64(&m.epoch)}}
+}
+
+func (m *mockRegionPDClient) GetRegion(ctx context.Context, key []byte) (*pd.Region, error) {
+	atomic.AddInt64(&m.getCalls, 1)
+	time.Sleep(m.delay)
+	for _, meta := range m.regions {
+		if bytes.Compare(meta.StartKey, key) <= 0 && bytes.Compare(key, meta.EndKey) < 0 {
+			return m.region(meta), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRegionPDClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*pd.Region, error) {
+	atomic.AddInt64(&m.scanCalls, 1)
+	time.Sleep(m.delay)
+	var regions []*pd.Region
+	for _, meta := range m.regions {
+		if bytes.Compare(meta.EndKey, key) <= 0 {
+			continue
+		}
+		if (len(endKey) != 0 && bytes.Compare(meta.StartKey, endKey) >= 0) || len(regions) >= limit {
+			break
+		}
+		regions = append(regions, m.region(meta))
+	}
+	return regions, nil
+}
+
+func (m *mockRegionPDClient) Close() {}
+
+// scanTables scans the regions of each table concurrently, and checks the
+// regions returned, the leaders of them are on a store not older than minEpoch
+func scanTables(c *check.C, cli pd.Client, tables, regionsPerTable int, minEpoch uint64) {
+	var wg sync.WaitGroup
+	for t := 0; t < tables; t++ {
+		wg.Add(1)
+		go func(t int) {
+			defer wg.Done()
+			startKey, endKey := regionTestKey(t*regionsPerTable), regionTestKey((t+1)*regionsPerTable)
+			regions, err := cli.ScanRegions(context.Background(), startKey, endKey, 20)
+			c.Assert(err, check.IsNil)
+			c.Assert(regions, check.HasLen, regionsPerTable)
+			for i, region := range regions {
+				c.Assert(region.Meta.StartKey, check.DeepEquals, regionTestKey(t*regionsPerTable+i))
+				c.Assert(region.Leader.StoreId >= minEpoch, check.IsTrue,
+					check.Commentf("table %d region %d leader %d", t, i, region.Leader.StoreId))
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (s *regionInfoSuite) TestBatchScanRegions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	const tables, regionsPerTable = 256, 4
+	mock := newMockRegionPDClient(tables*regionsPerTable, time.Millisecond)
+	cli := NewRegionInfoClient(mock, "test", DefaultRegionInfoTTL, DefaultRegionScanBatchWindow)
+	scanTables(c, cli, tables, regionsPerTable, 1)
+	// the contiguous tables are scanned in batches of maxRegionScanBatchSize
+	calls := atomic.LoadInt64(&mock.scanCalls)
+	c.Assert(calls <= tables/8, check.IsTrue, check.Commentf("%d calls", calls))
+
+	// the regions are served from the cache in the TTL
+	scanTables(c, cli, tables, regionsPerTable, 1)
+	c.Assert(atomic.LoadInt64(&mock.scanCalls), check.Equals, calls)
+	region, err := cli.GetRegion(context.Background(), regionTestKey(10))
+	c.Assert(err, check.IsNil)
+	c.Assert(region.Meta.Id, check.Equals, uint64(11))
+	region, err = cli.GetRegionByID(context.Background(), 12)
+	c.Assert(err, check.IsNil)
+	c.Assert(region.Meta.StartKey, check.DeepEquals, regionTestKey(11))
+	c.Assert(atomic.LoadInt64(&mock.getCalls), check.Equals, int64(0))
+}
+
+func (s *regionInfoSuite) TestCoalesceGetRegion(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mock := newMockRegionPDClient(16, 20*time.Millisecond)
+	cli := NewRegionInfoClient(mock, "test", DefaultRegionInfoTTL, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			region, err := cli.GetRegion(context.Background(), regionTestKey(3))
+			c.Assert(err, check.IsNil)
+			c.Assert(region.Meta.Id, check.Equals, uint64(4))
+		}()
+	}
+	wg.Wait()
+	c.Assert(atomic.LoadInt64(&mock.getCalls), check.Equals, int64(1))
+}
+
+func (s *regionInfoSuite) TestRegionSplit(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cli := NewRegionInfoClient(newMockRegionPDClient(0, 0), "test", time.Minute, 0)
+	now := time.Now()
+	cli.putRegions(now, &pd.Region{Meta: &metapb.Region{Id: 1, StartKey: []byte("a"), EndKey: []byte("c")}})
+	c.Assert(cli.scanCached([]byte("a"), []byte("c"), 10), check.HasLen, 1)
+	// the region is split, the old region overlapping the new regions is removed
+	cli.putRegions(now,
+		&pd.Region{Meta: &metapb.Region{Id: 1, StartKey: []byte("a"), EndKey: []byte("b")}},
+		&pd.Region{Meta: &metapb.Region{Id: 2, StartKey: []byte("b"), EndKey: []byte("d")}})
+	regions := cli.scanCached([]byte("a"), []byte("c"), 10)
+	c.Assert(regions, check.HasLen, 2)
+	c.Assert(regions[1].Meta.Id, check.Equals, uint64(2))
+	c.Assert(cli.regions.Len(), check.Equals, 2)
+	c.Assert(cli.byID, check.HasLen, 2)
+	// the regions are merged
+	cli.putRegions(now, &pd.Region{Meta: &metapb.Region{Id: 3, StartKey: []byte("a"), EndKey: []byte("e")}})
+	c.Assert(cli.regions.Len(), check.Equals, 1)
+	c.Assert(cli.byID, check.HasLen, 1)
+	// there is a gap in the cache
+	c.Assert(cli.scanCached([]byte("a"), []byte("f"), 10), check.IsNil)
+	c.Assert(cli.scanCached([]byte("b"), []byte("d"), 10), check.HasLen, 1)
+}
+
+func (s *regionInfoSuite) TestLeaderTransferWave(c *check.C) {
+	defer testleak.AfterTest(c)()
+	const tables, regionsPerTable, waves = 64, 4, 5
+	ttl := 50 * time.Millisecond
+	mock := newMockRegionPDClient(tables*regionsPerTable, time.Millisecond)
+	cli := NewRegionInfoClient(mock, "test", ttl, DefaultRegionScanBatchWindow)
+	requests := int64(0)
+	for wave := 0; wave < waves; wave++ {
+		mock.transferLeaders()
+		epoch := atomic.LoadUint64(&mock.epoch)
+		// the leaders may be stale in the TTL after the transfer
+		deadline := time.Now().Add(ttl)
+		for time.Now().Before(deadline) {
+			scanTables(c, cli, tables, regionsPerTable, epoch-1)
+			requests += tables
+		}
+		// the new leaders are always seen after the TTL
+		for i := 0; i < 3; i++ {
+			scanTables(c, cli, tables, regionsPerTable, epoch)
+			requests += tables
+		}
+	}
+	calls := atomic.LoadInt64(&mock.scanCalls)
+	c.Assert(calls*8 <= requests, check.IsTrue, check.Commentf("%d calls for %d requests", calls, requests))
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// StorePullTotal is the bytes and the events received from a TiKV store by
+// the pullers of a changefeed on a capture
+type StorePullTotal struct {
+	Bytes  uint64
+	Events uint64
+}
+
+// storePullStats counts the messages received from a store, the limiter is
+// shared by all the streams of the changefeed to the store.
+type storePullStats struct {
+	bytes  uint64
+	events uint64
+
+	mu      sync.Mutex
+	limiter *rate.Limiter
+
+	bytesCounter  prometheus.Counter
+	eventsCounter prometheus.Counter
+}
+
+// changefeedPullStats is the pull load of a changefeed on a capture, by the
+// TiKV stores. The messages are attributed to the store of the stream they
+// are received from, so a region moved to another store is counted on the
+// new store from then on.
+type changefeedPullStats struct {
+	captureAddr  string
+	changefeedID string
+
+	mu sync.Mutex
+	// bytesPerSecond is the pull rate cap of each store, 0 means unlimited
+	bytesPerSecond int64
+	stores         map[uint64]*storePullStats
+}
+
+type changefeedPullKey struct {
+	captureAddr  string
+	changefeedID string
+}
+
+type storePullRegistry struct {
+	sync.Mutex
+	changefeeds map[changefeedPullKey]*changefeedPullStats
+}
+
+var defaultStorePullRegistry = &storePullRegistry{
+	changefeeds: make(map[changefeedPullKey]*changefeedPullStats),
+}
+
+func (r *storePullRegistry) get(captureAddr, changefeedID string) *changefeedPullStats {
+	key := changefeedPullKey{captureAddr: captureAddr, changefeedID: changefeedID}
+	r.Lock()
+	defer r.Unlock()
+	stats, ok := r.changefeeds[key]
+	if !ok {
+		stats = &changefeedPullStats{
+			captureAddr:  captureAddr,
+			changefeedID: changefeedID,
+			stores:       make(map[uint64]*storePullStats),
+		}
+		r.changefeeds[key] = stats
+	}
+	return stats
+}
+
+func (r *storePullRegistry) lookup(captureAddr, changefeedID string) *changefeedPullStats {
+	r.Lock()
+	defer r.Unlock()
+	return r.changefeeds[changefeedPullKey{captureAddr: captureAddr, changefeedID: changefeedID}]
+}
+
+func (r *storePullRegistry) drop(captureAddr, changefeedID string) *changefeedPullStats {
+	key := changefeedPullKey{captureAddr: captureAddr, changefeedID: changefeedID}
+	r.Lock()
+	defer r.Unlock()
+	stats := r.changefeeds[key]
+	delete(r.changefeeds, key)
+	return stats
+}
+
+func storePullLimit(bytesPerSecond int64) (rate.Limit, int) {
+	if bytesPerSecond <= 0 {
+		return rate.Inf, 0
+	}
+	return rate.Limit(bytesPerSecond), int(bytesPerSecond)
+}
+
+func (s *changefeedPullStats) store(storeID uint64) *storePullStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.stores[storeID]
+	if !ok {
+		store := strconv.FormatUint(storeID, 10)
+		stats = &storePullStats{
+			limiter:       rate.NewLimiter(storePullLimit(s.bytesPerSecond)),
+			bytesCounter:  storePullBytesCounter.WithLabelValues(s.captureAddr, s.changefeedID, store),
+			eventsCounter: storePullEventCounter.WithLabelValues(s.captureAddr, s.changefeedID, store),
+		}
+		s.stores[storeID] = stats
+	}
+	return stats
+}
+
+// observe counts a message received from the store, and blocks until the
+// message is allowed by the pull rate cap of the store. The stream is paused
+// while it's blocked, the waiting streams to the store are resumed in the
+// order they're blocked, so that they take turns to pull from the store.
+func (s *storePullStats) observe(ctx context.Context, bytes, events int) error {
+	atomic.AddUint64(&s.bytes, uint64(bytes))
+	atomic.AddUint64(&s.events, uint64(events))
+	s.bytesCounter.Add(float64(bytes))
+	s.eventsCounter.Add(float64(events))
+	s.mu.Lock()
+	limiter := s.limiter
+	s.mu.Unlock()
+	if limiter.Limit() == rate.Inf {
+		return nil
+	}
+	// a message larger than the burst is waited in pieces
+	for bytes > 0 {
+		n := bytes
+		if burst := limiter.Burst(); n > burst {
+			n = burst
+		}
+		if err := limiter.WaitN(ctx, n); err != nil {
+			return errors.Trace(err)
+		}
+		bytes -= n
+	}
+	return nil
+}
+
+// SetStorePullRateLimit sets the max bytes per second received from each
+// TiKV store by the pullers of the changefeed on the capture, 0 means
+// unlimited. It takes effect on the running streams from the next messages
+// they receive.
+func SetStorePullRateLimit(captureAddr, changefeedID string, bytesPerSecond int64) {
+	stats := defaultStorePullRegistry.get(captureAddr, changefeedID)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	stats.bytesPerSecond = bytesPerSecond
+	// the limiters are replaced rather than adjusted, an unlimited limiter
+	// can't be limited again with SetLimit
+	for _, store := range stats.stores {
+		store.mu.Lock()
+		store.limiter = rate.NewLimiter(storePullLimit(bytesPerSecond))
+		store.mu.Unlock()
+	}
+}
+
+// StorePullTotals returns the bytes and the events received from each TiKV
+// store by the pullers of the changefeed on the capture since they start.
+func StorePullTotals(captureAddr, changefeedID string) map[uint64]StorePullTotal {
+	stats := defaultStorePullRegistry.lookup(captureAddr, changefeedID)
+	if stats == nil {
+		return nil
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	totals := make(map[uint64]StorePullTotal, len(stats.stores))
+	for storeID, store := range stats.stores {
+		totals[storeID] = StorePullTotal{
+			Bytes:  atomic.LoadUint64(&store.bytes),
+			Events: atomic.LoadUint64(&store.events),
+		}
+	}
+	return totals
+}
+
+// DropStorePullStats removes the pull statistics and the metrics of the
+// changefeed on the capture, it's called once the processor stops.
+func DropStorePullStats(captureAddr, changefeedID string) {
+	stats := defaultStorePullRegistry.drop(captureAddr, changefeedID)
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	for storeID := range stats.stores {
+		store := strconv.FormatUint(storeID, 10)
+		storePullBytesCounter.DeleteLabelValues(captureAddr, changefeedID, store)
+		storePullEventCounter.DeleteLabelValues(captureAddr, changefeedID, store)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/cdcpb"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/security"
+	"github.com/pingcap/ticdc/pkg/txnutil"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/ticdc/pkg/version"
+	"github.com/pingcap/tidb/store/mockstore/mocktikv"
+	"github.com/pingcap/tidb/store/tikv"
+)
+
+// waitStorePullEvents waits the events received from the store reach the count
+func waitStorePullEvents(c *check.C, captureAddr, changefeedID string, storeID uint64, count uint64) {
+	err := retry.Run(time.Millisecond*20, 50, func() error {
+		if total := StorePullTotals(captureAddr, changefeedID)[storeID]; total.Events < count {
+			return errors.Errorf("%d events are received from store %d, less than %d", total.Events, storeID, count)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+}
+
+// Use etcdSuite to workaround the race. See comments of `TestConnArray`.
+func (s *etcdSuite) TestStorePullStatistics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	const (
+		captureAddr  = "127.0.0.1:8300"
+		changefeedID = "store-pull-test"
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = util.PutCaptureAddrInCtx(util.PutChangefeedIDInCtx(ctx, changefeedID), captureAddr)
+	defer DropStorePullStats(captureAddr, changefeedID)
+	wg := &sync.WaitGroup{}
+
+	ch1 := make(chan *cdcpb.ChangeDataEvent, 10)
+	srv1 := newMockChangeDataService(c, ch1)
+	server1, addr1 := newMockService(ctx, c, srv1, wg)
+
+	ch2 := make(chan *cdcpb.ChangeDataEvent, 10)
+	srv2 := newMockChangeDataService(c, ch2)
+	server2, addr2 := newMockService(ctx, c, srv2, wg)
+
+	defer func() {
+		close(ch1)
+		server1.Stop()
+		close(ch2)
+		server2.Stop()
+		wg.Wait()
+	}()
+	// Cancel first, and then close the server.
+	defer cancel()
+
+	rpcClient, cluster, pdClient, err := mocktikv.NewTiKVAndPDClient("")
+	c.Assert(err, check.IsNil)
+	pdClient = &mockPDClient{Client: pdClient, version: version.MinTiKVVersion.String()}
+	kvStorage, err := tikv.NewTestTiKVStore(rpcClient, pdClient, nil, nil, 0)
+	c.Assert(err, check.IsNil)
+	defer kvStorage.Close() //nolint:errcheck
+
+	cluster.AddStore(1, addr1)
+	cluster.AddStore(2, addr2)
+	cluster.Bootstrap(3, []uint64{1, 2}, []uint64{4, 5}, 4)
+
+	baseAllocatedID := currentRequestID()
+	lockresolver := txnutil.NewLockerResolver(kvStorage.(tikv.Storage))
+	isPullInit := &mockPullerInit{}
+	cdcClient := NewCDCClient(ctx, pdClient, kvStorage.(tikv.Storage), &security.Credential{})
+	eventCh := make(chan *model.RegionFeedEvent, 10)
+	wg.Add(1)
+	go func() {
+		err := cdcClient.EventFeed(ctx, regionspan.ComparableSpan{Start: []byte("a"), End: []byte("b")}, 100, false, lockresolver, isPullInit, eventCh)
+		c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+		cdcClient.Close() //nolint:errcheck
+		wg.Done()
+	}()
+
+	// the region is pulled from store 1
+	waitRequestID(c, baseAllocatedID+1)
+	ch1 <- mockInitializedEvent(3 /* regionID */, currentRequestID())
+	waitStorePullEvents(c, captureAddr, changefeedID, 1, 1)
+	_, ok := StorePullTotals(captureAddr, changefeedID)[2]
+	c.Assert(ok, check.IsFalse)
+
+	// the region is moved to store 2, the events are attributed to store 2
+	// from then on
+	ch1 <- &cdcpb.ChangeDataEvent{Events: []*cdcpb.Event{
+		{
+			RegionId:  3,
+			RequestId: currentRequestID(),
+			Event: &cdcpb.Event_Error{
+				Error: &cdcpb.Error{
+					NotLeader: &errorpb.NotLeader{
+						RegionId: 3,
+						Leader:   &metapb.Peer{StoreId: 2},
+					},
+				},
+			},
+		},
+	}}
+	cluster.ChangeLeader(3, 5)
+	waitRequestID(c, baseAllocatedID+2)
+	ch2 <- mockInitializedEvent(3 /* regionID */, currentRequestID())
+	waitStorePullEvents(c, captureAddr, changefeedID, 2, 1)
+	totals := StorePullTotals(captureAddr, changefeedID)
+	c.Assert(totals[1].Events, check.Equals, uint64(2))
+	c.Assert(totals[1].Bytes > 0, check.IsTrue)
+
+	// the pull rate of store 2 is capped, the second large row is delayed
+	// for about a second
+	SetStorePullRateLimit(captureAddr, changefeedID, 10000)
+	makeRow := func(commitTs uint64) *cdcpb.ChangeDataEvent {
+		return &cdcpb.ChangeDataEvent{Events: []*cdcpb.Event{
+			{
+				RegionId:  3,
+				RequestId: currentRequestID(),
+				Event: &cdcpb.Event_Entries_{
+					Entries: &cdcpb.Event_Entries{
+						Entries: []*cdcpb.Event_Row{{
+							Type:     cdcpb.Event_COMMITTED,
+							OpType:   cdcpb.Event_Row_PUT,
+							Key:      []byte("a"),
+							Value:    make([]byte, 10000),
+							CommitTs: commitTs,
+						}},
+					},
+				},
+			},
+		}}
+	}
+	start := time.Now()
+	ch2 <- makeRow(110)
+	ch2 <- makeRow(111)
+	for rows := 0; rows < 2; {
+		select {
+		case event := <-eventCh:
+			if event.Val != nil {
+				rows++
+			}
+		case <-time.After(10 * time.Second):
+			c.Fatalf("recving message takes too long")
+		}
+	}
+	c.Assert(time.Since(start) >= 800*time.Millisecond, check.IsTrue)
+	totals = StorePullTotals(captureAddr, changefeedID)
+	c.Assert(totals[2].Events, check.Equals, uint64(3))
+	c.Assert(totals[2].Bytes > 20000, check.IsTrue)
+	c.Assert(totals[1].Events, check.Equals, uint64(2))
+
+	// the cap is lifted
+	SetStorePullRateLimit(captureAddr, changefeedID, 0)
+	start = time.Now()
+	for ts := uint64(112); ts < 115; ts++ {
+		ch2 <- makeRow(ts)
+	}
+	for rows := 0; rows < 3; {
+		select {
+		case event := <-eventCh:
+			if event.Val != nil {
+				rows++
+			}
+		case <-time.After(10 * time.Second):
+			c.Fatalf("recving message takes too long")
+		}
+	}
+	c.Assert(time.Since(start) < 800*time.Millisecond, check.IsTrue)
+	cancel()
+}
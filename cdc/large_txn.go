@@ -0,0 +1,125 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sync/atomic"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// largeTxnDetector detects the large transactions of a table from the sorted
+// events, whose rows exceed the threshold, so that they are noticed before
+// they stall the changefeed at flush time. The events are observed by the
+// sorterConsume of the table, and the transaction in progress is read by
+// other goroutines. All methods are no-op on a nil detector.
+type largeTxnDetector struct {
+	changefeedID string
+	tableName    string
+	threshold    int64
+	gauge        prometheus.Gauge
+
+	// commitTs and rows are of the transaction being received, they're
+	// accessed atomically
+	commitTs uint64
+	rows     int64
+	// nextWarnRows is the number of the rows to log the next warning at, it's
+	// doubled after each warning to avoid flooding the logs
+	nextWarnRows int64
+}
+
+// newLargeTxnDetector creates a largeTxnDetector, it returns nil if the
+// threshold is not positive.
+func newLargeTxnDetector(changefeedID, captureAddr, tableName string, threshold int64) *largeTxnDetector {
+	if threshold <= 0 {
+		return nil
+	}
+	return &largeTxnDetector{
+		changefeedID: changefeedID,
+		tableName:    tableName,
+		threshold:    threshold,
+		gauge:        largeTxnInProgressGauge.WithLabelValues(changefeedID, captureAddr, tableName),
+		nextWarnRows: threshold,
+	}
+}
+
+// observe counts a row changed event of the transaction committed at commitTs
+func (d *largeTxnDetector) observe(commitTs uint64) {
+	if d == nil {
+		return
+	}
+	// the events are sorted, so the previous transaction is finished
+	if commitTs != atomic.LoadUint64(&d.commitTs) {
+		d.reset()
+		atomic.StoreUint64(&d.commitTs, commitTs)
+	}
+	rows := atomic.AddInt64(&d.rows, 1)
+	if rows < d.threshold {
+		return
+	}
+	d.gauge.Set(float64(rows))
+	if rows >= d.nextWarnRows {
+		log.Warn("large transaction in progress, it may take a long time to flush it to the sink",
+			zap.String("changefeed", d.changefeedID), zap.String("table", d.tableName),
+			zap.Uint64("commitTs", commitTs), zap.Int64("rows", rows))
+		d.nextWarnRows = rows * 2
+	}
+}
+
+// resolve resets the detector once the resolved ts passes the commit ts of
+// the transaction in progress, which means all its rows are received.
+func (d *largeTxnDetector) resolve(resolvedTs uint64) {
+	if d == nil {
+		return
+	}
+	commitTs := atomic.LoadUint64(&d.commitTs)
+	if commitTs == 0 || resolvedTs < commitTs {
+		return
+	}
+	if rows := atomic.LoadInt64(&d.rows); rows >= d.threshold {
+		log.Info("large transaction is received",
+			zap.String("changefeed", d.changefeedID), zap.String("table", d.tableName),
+			zap.Uint64("commitTs", commitTs), zap.Int64("rows", rows))
+	}
+	d.reset()
+}
+
+func (d *largeTxnDetector) reset() {
+	if atomic.LoadInt64(&d.rows) >= d.threshold {
+		d.gauge.Set(0)
+	}
+	atomic.StoreUint64(&d.commitTs, 0)
+	atomic.StoreInt64(&d.rows, 0)
+	d.nextWarnRows = d.threshold
+}
+
+// info returns the large transaction in progress, it returns nil if there is
+// no large transaction.
+func (d *largeTxnDetector) info() *model.LargeTxnInfo {
+	if d == nil {
+		return nil
+	}
+	rows := atomic.LoadInt64(&d.rows)
+	if rows < d.threshold {
+		return nil
+	}
+	return &model.LargeTxnInfo{
+		Table:    d.tableName,
+		CommitTs: atomic.LoadUint64(&d.commitTs),
+		Rows:     rows,
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/notify"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type largeTxnSuite struct{}
+
+var _ = check.Suite(&largeTxnSuite{})
+
+// discardMounter drops the events sent to it
+type discardMounter struct {
+	input chan *model.PolymorphicEvent
+}
+
+func (m *discardMounter) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.input:
+		}
+	}
+}
+
+func (m *discardMounter) AddEntry(ctx context.Context, ev *model.PolymorphicEvent) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case m.input <- ev:
+		return nil
+	}
+}
+
+func (m *discardMounter) WaitPrepare(ctx context.Context, ev *model.PolymorphicEvent) error {
+	return ev.WaitPrepare(ctx)
+}
+
+// passThroughSorter outputs the events in the order they are added, which
+// are expected to be sorted already
+type passThroughSorter struct {
+	ch            chan *model.PolymorphicEvent
+	stopping      int32
+	stopped       bool
+	maxResolvedTs uint64
+}
+
+func (s *passThroughSorter) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *passThroughSorter) AddEntry(ctx context.Context, entry *model.PolymorphicEvent) {
+	if s.stopped {
+		return
+	}
+	s.ch <- entry
+	if entry.RawKV.OpType == model.OpTypeResolved {
+		atomic.StoreUint64(&s.maxResolvedTs, entry.CRTs)
+		if atomic.LoadInt32(&s.stopping) != 0 {
+			s.stopped = true
+			close(s.ch)
+		}
+	}
+}
+
+func (s *passThroughSorter) SafeStop() {
+	atomic.StoreInt32(&s.stopping, 1)
+}
+
+func (s *passThroughSorter) MaxResolvedTs() model.Ts {
+	return atomic.LoadUint64(&s.maxResolvedTs)
+}
+
+func (s *passThroughSorter) Output() <-chan *model.PolymorphicEvent {
+	return s.ch
+}
+
+// processorTestOption customizes the processor built by newProcessorForTest
+type processorTestOption func(p *processor)
+
+// withReplicaConfig sets the replica config of the changefeed
+func withReplicaConfig(cfg *config.ReplicaConfig) processorTestOption {
+	return func(p *processor) {
+		p.changefeed.Config = cfg
+	}
+}
+
+// withOutputSize sets the buffer size of the output channel
+func withOutputSize(size int) processorTestOption {
+	return func(p *processor) {
+		p.output = make(chan outputRow, size)
+	}
+}
+
+// newProcessorForTest returns a processor of "test-changefeed" on
+// "capture-1" with the default replica config, whose mounter drops the
+// events. The options are applied in order, and the fields which are not
+// covered by them can be set on the result directly.
+func newProcessorForTest(opts ...processorTestOption) *processor {
+	p := &processor{
+		changefeedID:             "test-changefeed",
+		captureInfo:              model.CaptureInfo{ID: "capture-1", AdvertiseAddr: "127.0.0.1:8300"},
+		changefeed:               model.ChangeFeedInfo{Config: config.GetDefaultReplicaConfig()},
+		mounter:                  &discardMounter{input: make(chan *model.PolymorphicEvent, 16)},
+		output:                   make(chan outputRow, 16),
+		tables:                   make(map[int64]*tableInfo),
+		pendingOpTables:          make(map[int64]*uint64),
+		markTables:               newMarkTableManager(),
+		localResolvedNotifier:    new(notify.Notifier),
+		globalResolvedTsNotifier: new(notify.Notifier),
+		eventLogFormatter:        model.DefaultEventLogFormatter,
+		errs:                     newErrorCollector(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// waitOutput reads n events from the output channel of the processor
+func waitOutput(c *check.C, p *processor, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-p.output:
+		case <-time.After(5 * time.Second):
+			c.Fatal("the event is not received")
+		}
+	}
+}
+
+func (s *largeTxnSuite) TestDetectLargeTxn(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	const tableName = "`test`.`orders`"
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Dedup = nil
+	cfg.LargeTxn = &config.LargeTxnConfig{RowThreshold: 100, AnnotateStatus: true}
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	// the sorted events are fed to the sorter directly, so that the rows of
+	// a transaction are observed before it's resolved
+	sorter := puller.NewRectifier(&passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}, math.MaxUint64)
+	table := &tableInfo{
+		id:            1,
+		name:          tableName,
+		sorter:        sorter,
+		pendingEvents: new(int64),
+		largeTxn:      newLargeTxnDetector(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName, cfg.LargeTxn.RowThreshold),
+	}
+	p.tables[table.id] = table
+	gauge := largeTxnInProgressGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_ = sorter.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = p.mounter.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		p.newTablePipeline(table.id, tableName, &table.resolvedTs, table.pendingEvents,
+			table.largeTxn, nil, &model.TableReplicaInfo{StartTs: 1}).consume(ctx, sorter)
+	}()
+
+	// a small transaction is not reported
+	for i := 0; i < 10; i++ {
+		sorter.AddEntry(ctx, newDrainTestEvent(1, 5))
+	}
+	waitOutput(c, p, 10)
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 6))
+	c.Assert(table.largeTxn.info(), check.IsNil)
+
+	// the rows of the large transaction are counted before it's resolved
+	go func() {
+		for i := 0; i < 250; i++ {
+			sorter.AddEntry(ctx, newDrainTestEvent(1, 10))
+		}
+	}()
+	waitOutput(c, p, 250)
+	info := table.largeTxn.info()
+	c.Assert(info, check.DeepEquals, &model.LargeTxnInfo{Table: tableName, CommitTs: 10, Rows: 250})
+	c.Assert(testutil.ToFloat64(gauge), check.Equals, float64(250))
+	c.Assert(p.largeTxns(), check.DeepEquals, []*model.LargeTxnInfo{info})
+
+	// the owner shows the large transactions reported by the processors
+	cf := &changeFeed{taskPositions: map[model.CaptureID]*model.TaskPosition{
+		"capture-1": {LargeTxns: p.largeTxns()},
+		"capture-2": {LargeTxns: []*model.LargeTxnInfo{{Table: "`test`.`items`", CommitTs: 10, Rows: 3200000}}},
+		"capture-3": {},
+	}}
+	c.Assert(cf.largeTxns(), check.DeepEquals, []string{
+		"applying large transaction (3.2M rows so far) on `test`.`items`",
+		"applying large transaction (250 rows so far) on `test`.`orders`",
+	})
+
+	// the counter is reset once the resolved ts passes the commit ts
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 10))
+	sorter.AddEntry(ctx, newDrainTestEvent(1, 12))
+	waitOutput(c, p, 1)
+	c.Assert(table.largeTxn.info(), check.IsNil)
+	c.Assert(testutil.ToFloat64(gauge), check.Equals, float64(0))
+	c.Assert(p.largeTxns(), check.HasLen, 0)
+	cf.taskPositions = map[model.CaptureID]*model.TaskPosition{"capture-1": {LargeTxns: p.largeTxns()}}
+	c.Assert(cf.largeTxns(), check.IsNil)
+}
+
+func (s *largeTxnSuite) TestDisabledDetector(c *check.C) {
+	defer testleak.AfterTest(c)()
+	d := newLargeTxnDetector("test-changefeed", "127.0.0.1:8300", "`test`.`t`", 0)
+	c.Assert(d, check.IsNil)
+	// all methods are no-op on a nil detector
+	d.observe(10)
+	d.resolve(10)
+	c.Assert(d.info(), check.IsNil)
+}
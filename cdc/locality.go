@@ -0,0 +1,229 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/scheduler"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+)
+
+var (
+	// localityStoreTTL is how long the zones of the stores are cached
+	localityStoreTTL = 5 * time.Minute
+	// localityTableTTL is how long the leader zones of a table are cached
+	localityTableTTL = time.Minute
+	// localityRegionSamples is the number of the regions sampled from the
+	// start of a table to count its leaders in each zone
+	localityRegionSamples = 32
+	// localityRefreshBudget is the most tables whose leaders are loaded from
+	// PD in a tick, the others keep their cached leaders until the next ticks
+	localityRefreshBudget = 64
+	// localityMigrationRatio is the ratio of the tables whose leaders are
+	// mostly moved to other zones, which triggers a rebalance
+	localityMigrationRatio = 0.1
+)
+
+// tableLeaders are the sampled region leaders of a table in each zone
+type tableLeaders struct {
+	zones    map[string]int
+	majority string
+	loadTime time.Time
+}
+
+// localityResolver resolves the zones of the region leaders of the tables of
+// a changefeed from PD, which are sampled and cached, for the scheduler to
+// place the tables in the captures in the same zones. A nil resolver means
+// the locality is disabled.
+type localityResolver struct {
+	pdClient pd.Client
+	weight   float64
+	label    string
+
+	storeZones     map[uint64]string
+	storesLoadTime time.Time
+	tables         map[model.TableID]*tableLeaders
+	// migrated is the number of the tables whose majority zones are changed
+	// since the last rebalance
+	migrated int
+}
+
+// newLocalityResolver creates a localityResolver, nil is returned if the
+// locality is disabled by the config.
+func newLocalityResolver(pdClient pd.Client, cfg *config.SchedulerConfig) *localityResolver {
+	if pdClient == nil || cfg == nil || cfg.LocalityWeight <= 0 || cfg.LocalityLabel == "" {
+		return nil
+	}
+	return &localityResolver{
+		pdClient: pdClient,
+		weight:   cfg.LocalityWeight,
+		label:    cfg.LocalityLabel,
+		tables:   make(map[model.TableID]*tableLeaders),
+	}
+}
+
+// resolve returns the locality of the tables for the captures, and whether
+// the leaders of many tables are moved to other zones so that the tables
+// should be rebalanced. The leaders are loaded only if the captures are in
+// more than one zone, the errors from PD are logged and the cached leaders
+// are used, as the locality is only a preference of the scheduling.
+func (r *localityResolver) resolve(
+	ctx context.Context, captures map[model.CaptureID]*model.CaptureInfo, tableIDs []model.TableID, now time.Time,
+) (*scheduler.Locality, bool) {
+	if r == nil {
+		return nil, false
+	}
+	locality := &scheduler.Locality{
+		Weight:       r.weight,
+		CaptureZones: make(map[model.CaptureID]string, len(captures)),
+	}
+	for captureID, info := range captures {
+		locality.CaptureZones[captureID] = info.Zone
+	}
+	if !locality.Enabled() {
+		return nil, false
+	}
+	if err := r.refreshStores(ctx, now); err != nil {
+		log.Warn("failed to load the zones of the stores", zap.Error(err))
+	}
+	r.refreshTables(ctx, tableIDs, now)
+
+	locality.TableLeaders = make(map[model.TableID]map[string]int, len(tableIDs))
+	for _, tableID := range tableIDs {
+		if leaders, ok := r.tables[tableID]; ok {
+			locality.TableLeaders[tableID] = leaders.zones
+		}
+	}
+	migrated := false
+	if len(r.tables) > 0 && float64(r.migrated) >= localityMigrationRatio*float64(len(r.tables)) {
+		log.Info("the region leaders of the tables are migrated to other zones",
+			zap.Int("migrated", r.migrated), zap.Int("tables", len(r.tables)))
+		migrated = true
+		r.migrated = 0
+	}
+	return locality, migrated
+}
+
+func (r *localityResolver) refreshStores(ctx context.Context, now time.Time) error {
+	if r.storeZones != nil && now.Sub(r.storesLoadTime) < localityStoreTTL {
+		return nil
+	}
+	stores, err := r.pdClient.GetAllStores(ctx, pd.WithExcludeTombstone())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	zones := make(map[uint64]string, len(stores))
+	for _, store := range stores {
+		for _, label := range store.GetLabels() {
+			if label.GetKey() == r.label {
+				zones[store.GetId()] = label.GetValue()
+				break
+			}
+		}
+	}
+	r.storeZones = zones
+	r.storesLoadTime = now
+	return nil
+}
+
+// refreshTables loads the leaders of the tables not cached or expired, the
+// ones never loaded first, then the least recently loaded ones, for at most
+// localityRefreshBudget tables.
+func (r *localityResolver) refreshTables(ctx context.Context, tableIDs []model.TableID, now time.Time) {
+	known := make(map[model.TableID]struct{}, len(tableIDs))
+	var expired []model.TableID
+	for _, tableID := range tableIDs {
+		known[tableID] = struct{}{}
+		if leaders, ok := r.tables[tableID]; !ok || now.Sub(leaders.loadTime) >= localityTableTTL {
+			expired = append(expired, tableID)
+		}
+	}
+	for tableID := range r.tables {
+		if _, ok := known[tableID]; !ok {
+			delete(r.tables, tableID)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		var ti, tj time.Time
+		if leaders, ok := r.tables[expired[i]]; ok {
+			ti = leaders.loadTime
+		}
+		if leaders, ok := r.tables[expired[j]]; ok {
+			tj = leaders.loadTime
+		}
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return expired[i] < expired[j]
+	})
+	if len(expired) > localityRefreshBudget {
+		expired = expired[:localityRefreshBudget]
+	}
+	for _, tableID := range expired {
+		zones, err := r.loadTableLeaders(ctx, tableID)
+		if err != nil {
+			log.Warn("failed to load the region leaders of the table", zap.Int64("tableID", tableID), zap.Error(err))
+			return
+		}
+		leaders := &tableLeaders{zones: zones, majority: majorityZone(zones), loadTime: now}
+		if old, ok := r.tables[tableID]; ok && old.majority != "" && old.majority != leaders.majority {
+			r.migrated++
+		}
+		r.tables[tableID] = leaders
+	}
+}
+
+// loadTableLeaders counts the leaders of the sampled regions of the table in
+// each zone
+func (r *localityResolver) loadTableLeaders(ctx context.Context, tableID model.TableID) (map[string]int, error) {
+	span := regionspan.GetTableSpan(tableID, false)
+	regions, err := r.pdClient.ScanRegions(ctx, span.Start, span.End, localityRegionSamples)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	zones := make(map[string]int)
+	for _, region := range regions {
+		if region.Leader == nil {
+			continue
+		}
+		if zone := r.storeZones[region.Leader.GetStoreId()]; zone != "" {
+			zones[zone]++
+		}
+	}
+	return zones, nil
+}
+
+// majorityZone returns the zone with the most leaders, the ties are broken by
+// the names of the zones
+func majorityZone(zones map[string]int) string {
+	var (
+		majority string
+		most     int
+	)
+	for zone, n := range zones {
+		if n > most || (n == most && zone < majority) {
+			majority, most = zone, n
+		}
+	}
+	return majority
+}
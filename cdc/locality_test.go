@@ -0,0 +1,168 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	pd "github.com/tikv/pd/client"
+)
+
+type localitySuite struct{}
+
+var _ = check.Suite(&localitySuite{})
+
+// mockLocalityPDClient serves the stores in the zones, and the regions of the
+// tables whose leaders are in the stores
+type mockLocalityPDClient struct {
+	pd.Client
+	storeZones   map[uint64]string
+	tableLeaders map[model.TableID][]uint64
+	scans        int
+}
+
+func (m *mockLocalityPDClient) GetAllStores(ctx context.Context, opts ...pd.GetStoreOption) ([]*metapb.Store, error) {
+	stores := make([]*metapb.Store, 0, len(m.storeZones))
+	for id, zone := range m.storeZones {
+		stores = append(stores, &metapb.Store{
+			Id:     id,
+			Labels: []*metapb.StoreLabel{{Key: "host", Value: "h"}, {Key: "zone", Value: zone}},
+		})
+	}
+	return stores, nil
+}
+
+func (m *mockLocalityPDClient) ScanRegions(ctx context.Context, key, endKey []byte, limit int) ([]*pd.Region, error) {
+	m.scans++
+	for tableID, leaders := range m.tableLeaders {
+		if string(regionspan.GetTableSpan(tableID, false).Start) != string(key) {
+			continue
+		}
+		regions := make([]*pd.Region, 0, len(leaders))
+		for _, storeID := range leaders {
+			regions = append(regions, &pd.Region{Meta: &metapb.Region{}, Leader: &metapb.Peer{StoreId: storeID}})
+		}
+		return regions, nil
+	}
+	return nil, nil
+}
+
+func (s *localitySuite) TestResolveLocality(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	cli := &mockLocalityPDClient{
+		storeZones: map[uint64]string{1: "a", 2: "a", 3: "b", 4: "b"},
+		tableLeaders: map[model.TableID][]uint64{
+			10: {1, 2, 3},
+			11: {3, 4, 1},
+			12: {4},
+		},
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"capture-a": {ID: "capture-a", Zone: "a"},
+		"capture-b": {ID: "capture-b", Zone: "b"},
+	}
+	cfg := config.GetDefaultReplicaConfig().Scheduler
+	r := newLocalityResolver(cli, cfg)
+	c.Assert(r, check.NotNil)
+	now := time.Now()
+	locality, migrated := r.resolve(ctx, captures, []model.TableID{10, 11, 12}, now)
+	c.Assert(migrated, check.IsFalse)
+	c.Assert(locality.Weight, check.Equals, cfg.LocalityWeight)
+	c.Assert(locality.CaptureZones, check.DeepEquals, map[model.CaptureID]string{"capture-a": "a", "capture-b": "b"})
+	c.Assert(locality.TableLeaders, check.DeepEquals, map[model.TableID]map[string]int{
+		10: {"a": 2, "b": 1},
+		11: {"a": 1, "b": 2},
+		12: {"b": 1},
+	})
+	c.Assert(cli.scans, check.Equals, 3)
+
+	// the leaders are cached
+	_, migrated = r.resolve(ctx, captures, []model.TableID{10, 11, 12}, now.Add(time.Second))
+	c.Assert(migrated, check.IsFalse)
+	c.Assert(cli.scans, check.Equals, 3)
+
+	// the leaders of the table 10 are transferred to the zone b, which are
+	// loaded after they're expired
+	cli.tableLeaders[10] = []uint64{3, 4, 1}
+	locality, migrated = r.resolve(ctx, captures, []model.TableID{10, 11, 12}, now.Add(localityTableTTL))
+	c.Assert(migrated, check.IsTrue)
+	c.Assert(locality.TableLeaders[10], check.DeepEquals, map[string]int{"a": 1, "b": 2})
+	c.Assert(cli.scans, check.Equals, 6)
+}
+
+func (s *localitySuite) TestRefreshBudget(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer func(budget int) { localityRefreshBudget = budget }(localityRefreshBudget)
+	localityRefreshBudget = 2
+
+	cli := &mockLocalityPDClient{
+		storeZones:   map[uint64]string{1: "a", 2: "b"},
+		tableLeaders: map[model.TableID][]uint64{1: {1}, 2: {1}, 3: {2}},
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"capture-a": {ID: "capture-a", Zone: "a"},
+		"capture-b": {ID: "capture-b", Zone: "b"},
+	}
+	r := newLocalityResolver(cli, config.GetDefaultReplicaConfig().Scheduler)
+	now := time.Now()
+	locality, _ := r.resolve(context.Background(), captures, []model.TableID{1, 2, 3}, now)
+	c.Assert(locality.TableLeaders, check.HasLen, 2)
+	c.Assert(cli.scans, check.Equals, 2)
+	// the tables never loaded are loaded first in the next tick
+	locality, _ = r.resolve(context.Background(), captures, []model.TableID{1, 2, 3}, now.Add(time.Second))
+	c.Assert(locality.TableLeaders, check.HasLen, 3)
+	c.Assert(locality.TableLeaders[3], check.DeepEquals, map[string]int{"b": 1})
+	c.Assert(cli.scans, check.Equals, 3)
+
+	// the removed tables are not cached
+	locality, _ = r.resolve(context.Background(), captures, []model.TableID{3}, now.Add(2*time.Second))
+	c.Assert(locality.TableLeaders, check.HasLen, 1)
+	c.Assert(r.tables, check.HasLen, 1)
+}
+
+func (s *localitySuite) TestLocalityDisabled(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cli := &mockLocalityPDClient{storeZones: map[uint64]string{1: "a"}}
+	cfg := config.GetDefaultReplicaConfig().Scheduler
+	cfg.LocalityWeight = 0
+	c.Assert(newLocalityResolver(cli, cfg), check.IsNil)
+	locality, migrated := (*localityResolver)(nil).resolve(context.Background(), nil, []model.TableID{1}, time.Now())
+	c.Assert(locality, check.IsNil)
+	c.Assert(migrated, check.IsFalse)
+
+	// PD is not queried if the captures are in one zone
+	r := newLocalityResolver(cli, config.GetDefaultReplicaConfig().Scheduler)
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"capture-1": {ID: "capture-1", Zone: "a"},
+		"capture-2": {ID: "capture-2", Zone: "a"},
+		"capture-3": {ID: "capture-3"},
+	}
+	locality, _ = r.resolve(context.Background(), captures, []model.TableID{1}, time.Now())
+	c.Assert(locality, check.IsNil)
+	c.Assert(cli.scans, check.Equals, 0)
+	c.Assert(r.storeZones, check.IsNil)
+
+	cfg = config.GetDefaultReplicaConfig().Scheduler
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.LocalityWeight = 1.5
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*invalid locality-weight 1.5.*")
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/puller"
 	"github.com/pingcap/ticdc/cdc/puller/sorter"
 	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/cdc/sink/producer/kafka"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -37,9 +38,11 @@ func init() {
 	kv.InitMetrics(registry)
 	puller.InitMetrics(registry)
 	sink.InitMetrics(registry)
+	kafka.InitMetrics(registry)
 	entry.InitMetrics(registry)
 	sorter.InitMetrics(registry)
 	initProcessorMetrics(registry)
 	initOwnerMetrics(registry)
+	initObserverMetrics(registry)
 	initServerMetrics(registry)
 }
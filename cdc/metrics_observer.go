@@ -0,0 +1,39 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	observerCheckpointTsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "observer",
+			Name:      "checkpoint_ts",
+			Help:      "checkpoint ts of changefeeds observed in etcd",
+		}, []string{"changefeed"})
+	observerCheckpointTsLagGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "observer",
+			Name:      "checkpoint_ts_lag",
+			Help:      "checkpoint ts lag of changefeeds observed in etcd",
+		}, []string{"changefeed"})
+)
+
+// initObserverMetrics registers all metrics used in observer
+func initObserverMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(observerCheckpointTsGauge)
+	registry.MustRegister(observerCheckpointTsLagGauge)
+}
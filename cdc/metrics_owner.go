@@ -30,6 +30,48 @@ var (
 			Name:      "checkpoint_ts_lag",
 			Help:      "checkpoint ts lag of changefeeds",
 		}, []string{"changefeed"})
+	ddlQueueDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "ddl_queue_depth",
+			Help:      "number of DDL jobs waiting to be executed in changefeeds",
+		}, []string{"changefeed"})
+	changefeedStatusClampCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "status_clamp_count",
+			Help:      "The counter of the regressed resolved ts and checkpoint ts clamped to the published status of changefeeds",
+		}, []string{"changefeed", "type"})
+	changefeedStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "changefeed_state",
+			Help:      "state of changefeeds, 0 normal, 1 warning, 2 error, 3 failed, 4 stopped, 5 finished",
+		}, []string{"changefeed", "sink_scheme", "sort_engine"})
+	maintainTableNumGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "maintain_table_num",
+			Help:      "number of tables maintained by the processors of changefeeds",
+		}, []string{"changefeed", "capture"})
+	stuckOperationNumGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "stuck_operation_num",
+			Help:      "number of table operations pending longer than expected in changefeeds",
+		}, []string{"changefeed"})
+	initialScanFinishedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "owner",
+			Name:      "initial_scan_finished",
+			Help:      "whether changefeeds finished the initial scan and reached the steady state, 1 finished, 0 not",
+		}, []string{"changefeed"})
 	ownershipCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: "ticdc",
@@ -43,5 +85,11 @@ var (
 func initOwnerMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(changefeedCheckpointTsGauge)
 	registry.MustRegister(changefeedCheckpointTsLagGauge)
+	registry.MustRegister(ddlQueueDepthGauge)
+	registry.MustRegister(changefeedStatusClampCounter)
+	registry.MustRegister(changefeedStateGauge)
+	registry.MustRegister(maintainTableNumGauge)
+	registry.MustRegister(stuckOperationNumGauge)
+	registry.MustRegister(initialScanFinishedGauge)
 	registry.MustRegister(ownershipCounter)
 }
@@ -14,7 +14,9 @@
 package cdc
 
 import (
+	"github.com/pingcap/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
@@ -60,6 +62,13 @@ var (
 			Name:      "num_of_tables",
 			Help:      "number of synchronized table of processor",
 		}, []string{"changefeed", "capture"})
+	dormantTableGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "num_of_dormant_tables",
+			Help:      "number of the tables without writes whose sorters are detached",
+		}, []string{"changefeed", "capture"})
 	txnCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "ticdc",
@@ -97,6 +106,83 @@ var (
 			Help:      "Bucketed histogram of processing time (s) of flushing events in processor",
 			Buckets:   prometheus.ExponentialBuckets(0.002 /* 2ms */, 2, 20),
 		}, []string{"changefeed", "capture"})
+	sinkFlushedRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "flushed_rows_count",
+			Help:      "counter for rows written to the downstream by the flushes of the sink",
+		}, []string{"changefeed", "capture"})
+	sinkFlushedBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "flushed_bytes_count",
+			Help:      "counter for bytes written to the downstream by the flushes of the sink",
+		}, []string{"changefeed", "capture"})
+	tableDuplicateEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "table_duplicate_event_count",
+			Help:      "counter for the duplicate events re-delivered by the puller and dropped",
+		}, []string{"changefeed", "capture", "table"})
+	tableForceDroppedEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "table_force_dropped_event_count",
+			Help:      "counter for the events dropped since the resolved ts of the table is forced to advance",
+		}, []string{"changefeed", "capture", "table"})
+	largeTxnInProgressGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "large_txn_in_progress",
+			Help:      "the rows received so far of the large transaction in progress of a table, 0 if there is none",
+		}, []string{"changefeed", "capture", "table"})
+	checkpointRegressedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "checkpoint_regressed_count",
+			Help:      "counter for the global checkpoint ts moving backwards, which stops the changefeed",
+		}, []string{"changefeed", "capture"})
+	budgetGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "budget",
+			Help:      "the resource budget of the changefeed, 0 means unlimited",
+		}, []string{"changefeed", "capture", "resource"})
+	budgetUsageGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "budget_usage",
+			Help:      "the resource used by the changefeed, the memory in bytes and the events per second",
+		}, []string{"changefeed", "capture", "resource"})
+	budgetExceededGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "budget_exceeded",
+			Help:      "1 if the resource budget of the changefeed is reached for a sustained period, otherwise 0",
+		}, []string{"changefeed", "capture", "resource"})
+	mounterInputBlockDurationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "mounter_input_block_duration",
+			Help:      "the total seconds the sorted events wait to be sent to the mounter",
+		}, []string{"changefeed", "capture"})
+	throttleLimitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "processor",
+			Name:      "throttle_limit",
+			Help:      "the events per second limit applied to the changefeed by the budget and the throttle schedule, 0 means unlimited",
+		}, []string{"changefeed", "capture"})
 )
 
 // initProcessorMetrics registers all metrics used in processor
@@ -107,9 +193,57 @@ func initProcessorMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(checkpointTsGauge)
 	registry.MustRegister(checkpointTsLagGauge)
 	registry.MustRegister(syncTableNumGauge)
+	registry.MustRegister(dormantTableGauge)
 	registry.MustRegister(txnCounter)
 	registry.MustRegister(updateInfoDuration)
 	registry.MustRegister(tableOutputChanSizeGauge)
 	registry.MustRegister(processorErrorCounter)
 	registry.MustRegister(sinkFlushRowChangedDuration)
+	registry.MustRegister(sinkFlushedRowsCounter)
+	registry.MustRegister(sinkFlushedBytesCounter)
+	registry.MustRegister(tableDuplicateEventCounter)
+	registry.MustRegister(tableForceDroppedEventCounter)
+	registry.MustRegister(largeTxnInProgressGauge)
+	registry.MustRegister(checkpointRegressedCounter)
+	registry.MustRegister(budgetGauge)
+	registry.MustRegister(budgetUsageGauge)
+	registry.MustRegister(budgetExceededGauge)
+	registry.MustRegister(throttleLimitGauge)
+	registry.MustRegister(mounterInputBlockDurationCounter)
+}
+
+// observedQuantile returns the q-quantile of the values observed by a
+// histogram since it's created, it's estimated from the buckets in the same
+// way as histogram_quantile of Prometheus.
+func observedQuantile(observer prometheus.Observer, q float64) (float64, error) {
+	m := &dto.Metric{}
+	if err := observer.(prometheus.Metric).Write(m); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return histogramQuantile(q, m.GetHistogram()), nil
+}
+
+// histogramQuantile estimates the q-quantile by the linear interpolation in
+// the bucket which the quantile falls into, the upper bound of the highest
+// bucket is returned if the quantile falls into the +Inf bucket. It returns 0
+// if nothing is observed.
+func histogramQuantile(q float64, h *dto.Histogram) float64 {
+	total := h.GetSampleCount()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var lowerBound float64
+	var lowerCount uint64
+	for _, b := range h.GetBucket() {
+		if float64(b.GetCumulativeCount()) >= rank {
+			count := b.GetCumulativeCount() - lowerCount
+			if count == 0 {
+				return b.GetUpperBound()
+			}
+			return lowerBound + (b.GetUpperBound()-lowerBound)*(rank-float64(lowerCount))/float64(count)
+		}
+		lowerBound, lowerCount = b.GetUpperBound(), b.GetCumulativeCount()
+	}
+	return lowerBound
 }
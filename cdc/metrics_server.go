@@ -26,7 +26,50 @@ var etcdHealthCheckDuration = prometheus.NewHistogramVec(
 		Buckets:   prometheus.ExponentialBuckets(0.0001 /* 0.1ms */, 2, 18),
 	}, []string{"capture", "pd"})
 
+var (
+	resourceUsageGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "server",
+			Name:      "resource_usage_percentage",
+			Help:      "Percentage of the used memory and the used disk space of sort dirs",
+		}, []string{"capture", "resource"})
+	resourcePressurePauseCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "server",
+			Name:      "resource_pressure_pause_count",
+			Help:      "The number of changefeeds paused because of resource pressure",
+		}, []string{"capture", "level"})
+	sessionLossCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "server",
+			Name:      "session_loss_count",
+			Help:      "The number of the etcd sessions of the capture lost unexpectedly",
+		}, []string{"capture"})
+	taskCoalescedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "server",
+			Name:      "task_coalesced_count",
+			Help:      "The number of the task events coalesced into the later events of the same changefeeds",
+		}, []string{"capture"})
+	taskHandoffGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "server",
+			Name:      "task_max_handoff_duration_seconds",
+			Help:      "The longest duration from stopping a processor to starting the next one of the same changefeed",
+		}, []string{"capture"})
+)
+
 // initServerMetrics registers all metrics used in processor
 func initServerMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(etcdHealthCheckDuration)
+	registry.MustRegister(resourceUsageGauge)
+	registry.MustRegister(resourcePressurePauseCounter)
+	registry.MustRegister(sessionLossCounter)
+	registry.MustRegister(taskCoalescedCounter)
+	registry.MustRegister(taskHandoffGauge)
 }
@@ -24,6 +24,13 @@ import (
 type CaptureInfo struct {
 	ID            CaptureID `json:"id"`
 	AdvertiseAddr string    `json:"address"`
+	// Observer is true if the capture is read-only, it serves the queries and
+	// the metrics but never campaigns the owner or replicates any table.
+	Observer bool `json:"observer,omitempty"`
+	// Zone is the zone of the capture, such as the availability zone it's
+	// deployed in, the tables are preferred to be replicated by the captures
+	// in the same zones as their region leaders.
+	Zone string `json:"zone,omitempty"`
 }
 
 // Marshal using json.Marshal.
@@ -85,8 +85,21 @@ type ChangeFeedInfo struct {
 
 	SyncPointEnabled  bool          `json:"sync-point-enabled"`
 	SyncPointInterval time.Duration `json:"sync-point-interval"`
+
+	// SnapshotOnly means only the snapshot of the tables at the start ts is
+	// replicated, and the changefeed finishes without following the changes.
+	SnapshotOnly bool `json:"snapshot-only,omitempty"`
+
+	// ConfigText is the original config file the changefeed is created or
+	// updated with, it's kept for reviewing the config and diffing the
+	// updates, and empty if the file is larger than MaxConfigTextSize.
+	ConfigText string `json:"config-text,omitempty"`
 }
 
+// MaxConfigTextSize is the max size of the original config file stored with
+// the changefeed info
+const MaxConfigTextSize = 64 * 1024
+
 var changeFeedIDRe *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9]+(\-[a-zA-Z0-9]+)*$`)
 
 // ValidateChangefeedID returns true if the changefeed ID matches
@@ -113,6 +126,8 @@ func (info *ChangeFeedInfo) String() (str string) {
 		return
 	}
 	clone.SinkURI = "***"
+	// the config file may contain the sink uris of the targets
+	clone.ConfigText = ""
 	str, err = clone.Marshal()
 	if err != nil {
 		log.Error("failed to marshal changefeed info", zap.Error(err))
@@ -130,15 +145,28 @@ func (info *ChangeFeedInfo) GetStartTs() uint64 {
 }
 
 // GetCheckpointTs returns CheckpointTs if it's specified in ChangeFeedStatus, otherwise StartTs is returned.
+// If the start ts of some tables are overridden to be less than StartTs, the minimum
+// of them is returned, so that the changefeed starts from the earliest table.
 func (info *ChangeFeedInfo) GetCheckpointTs(status *ChangeFeedStatus) uint64 {
 	if status != nil {
 		return status.CheckpointTs
 	}
-	return info.GetStartTs()
+	startTs := info.GetStartTs()
+	if info.Config != nil {
+		if minTs := info.Config.MinTableStartTs(); minTs != 0 && minTs < startTs {
+			startTs = minTs
+		}
+	}
+	return startTs
 }
 
 // GetTargetTs returns TargetTs if it's specified, otherwise MaxUint64 is returned.
+// The target ts of a snapshot-only changefeed is the next ts of the start ts,
+// which the tables are resolved to once their snapshots are scanned.
 func (info *ChangeFeedInfo) GetTargetTs() uint64 {
+	if info.SnapshotOnly {
+		return info.GetStartTs() + 1
+	}
 	if info.TargetTs > 0 {
 		return info.TargetTs
 	}
@@ -193,6 +221,57 @@ func (info *ChangeFeedInfo) VerifyAndFix() error {
 	if info.Config.Scheduler == nil {
 		info.Config.Scheduler = defaultConfig.Scheduler
 	}
+	if info.Config.ConsistencyCheck == nil {
+		info.Config.ConsistencyCheck = defaultConfig.ConsistencyCheck
+	}
+	if info.Config.EventLog == nil {
+		info.Config.EventLog = defaultConfig.EventLog
+	}
+	if info.Config.Dedup == nil {
+		info.Config.Dedup = defaultConfig.Dedup
+	}
+	if info.Config.DownstreamWriteCheck == nil {
+		info.Config.DownstreamWriteCheck = defaultConfig.DownstreamWriteCheck
+	}
+	if info.Config.LargeTxn == nil {
+		info.Config.LargeTxn = defaultConfig.LargeTxn
+	}
+	if info.Config.SortDir == nil {
+		info.Config.SortDir = defaultConfig.SortDir
+	}
+	if info.Config.Notify == nil {
+		info.Config.Notify = defaultConfig.Notify
+	}
+	if info.Config.Latency == nil {
+		info.Config.Latency = defaultConfig.Latency
+	}
+	if info.Config.SchemaCheck == nil {
+		info.Config.SchemaCheck = defaultConfig.SchemaCheck
+	}
+	if info.Config.CheckpointGuard == nil {
+		info.Config.CheckpointGuard = defaultConfig.CheckpointGuard
+	}
+	if info.Config.DDLUnsupportedAction == "" {
+		info.Config.DDLUnsupportedAction = defaultConfig.DDLUnsupportedAction
+	}
+	if info.Config.SchemaGC == nil {
+		info.Config.SchemaGC = defaultConfig.SchemaGC
+	}
+	if info.Config.Budget == nil {
+		info.Config.Budget = defaultConfig.Budget
+	}
+	if info.Config.Audit == nil {
+		info.Config.Audit = defaultConfig.Audit
+	}
+	if info.Config.ThrottleSchedule == nil {
+		info.Config.ThrottleSchedule = defaultConfig.ThrottleSchedule
+	}
+	if info.Config.Compact == nil {
+		info.Config.Compact = defaultConfig.Compact
+	}
+	if info.Config.CircuitBreaker == nil {
+		info.Config.CircuitBreaker = defaultConfig.CircuitBreaker
+	}
 	return nil
 }
 
@@ -0,0 +1,139 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// ChangefeedHistoryLimit is the maximum number of events kept in the history
+// of a changefeed, older events are trimmed.
+const ChangefeedHistoryLimit = 200
+
+// ChangefeedEventType is the type of a changefeed lifecycle event
+type ChangefeedEventType string
+
+// All ChangefeedEvent types
+const (
+	ChangefeedEventCreate      ChangefeedEventType = "create"
+	ChangefeedEventPause       ChangefeedEventType = "pause"
+	ChangefeedEventResume      ChangefeedEventType = "resume"
+	ChangefeedEventRemove      ChangefeedEventType = "remove"
+	ChangefeedEventFinish      ChangefeedEventType = "finish"
+	ChangefeedEventOwnerChange ChangefeedEventType = "owner-change"
+	ChangefeedEventMoveTable   ChangefeedEventType = "move-table"
+	ChangefeedEventError       ChangefeedEventType = "error"
+	ChangefeedEventGCSafePoint ChangefeedEventType = "gc-safepoint"
+	ChangefeedEventDirtyStop   ChangefeedEventType = "dirty-stop"
+	// ChangefeedEventForceAdvance is recorded when the resolved ts of a table
+	// is forced to advance by the unsafe command
+	ChangefeedEventForceAdvance ChangefeedEventType = "force-advance"
+	// ChangefeedEventOverwriteCheckpoint is recorded when a paused changefeed
+	// is resumed from another checkpoint ts
+	ChangefeedEventOverwriteCheckpoint ChangefeedEventType = "overwrite-checkpoint"
+	// ChangefeedEventUpdateBudget is recorded when the budget of a running
+	// changefeed is updated
+	ChangefeedEventUpdateBudget ChangefeedEventType = "update-budget"
+	// ChangefeedEventDDL is recorded when a DDL is executed by the downstream,
+	// with the duration and the outcome of it
+	ChangefeedEventDDL ChangefeedEventType = "ddl"
+	// ChangefeedEventFinishOperation is recorded when a pending table
+	// operation is forced to finish by the unsafe command
+	ChangefeedEventFinishOperation ChangefeedEventType = "finish-operation"
+	// ChangefeedEventBreakerTrip is recorded when a validation failure
+	// detected by a processor trips the circuit breaker
+	ChangefeedEventBreakerTrip ChangefeedEventType = "breaker-trip"
+	// ChangefeedEventBreakerReset is recorded when the circuit breaker is
+	// reset by the operator, with the acknowledgment note
+	ChangefeedEventBreakerReset ChangefeedEventType = "breaker-reset"
+	// ChangefeedEventSkipDDL is recorded when the DDL of a view or a sequence
+	// is skipped by the ddl-include-views or ddl-include-sequences options
+	ChangefeedEventSkipDDL ChangefeedEventType = "skip-ddl"
+	// ChangefeedEventInitialScanFinished is recorded when the changefeed
+	// finishes catching up with the history and reaches the steady state
+	ChangefeedEventInitialScanFinished ChangefeedEventType = "initial-scan-finished"
+)
+
+// ChangefeedEvent is an entry of the lifecycle history of a changefeed
+type ChangefeedEvent struct {
+	// ID is assigned when the event is persisted, it's increasing in a changefeed
+	ID   int64               `json:"id"`
+	Time time.Time           `json:"time"`
+	Type ChangefeedEventType `json:"type"`
+	// Owner is the address of the owner which records the event, it's empty
+	// if the event is recorded by a client.
+	Owner string `json:"owner,omitempty"`
+	// Client describes the client which initiates the operation
+	Client  string `json:"client,omitempty"`
+	Ts      uint64 `json:"ts,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ChangefeedHistory is the append-only and size-bounded event history of a changefeed
+type ChangefeedHistory struct {
+	LastID int64              `json:"last-id"`
+	Events []*ChangefeedEvent `json:"events"`
+}
+
+// Append assigns IDs to the events and appends them to the history, the
+// oldest events are trimmed if there are more than `limit` events.
+func (h *ChangefeedHistory) Append(limit int, events ...*ChangefeedEvent) {
+	for _, event := range events {
+		h.LastID++
+		event.ID = h.LastID
+		h.Events = append(h.Events, event)
+	}
+	if len(h.Events) > limit {
+		h.Events = append(h.Events[:0:0], h.Events[len(h.Events)-limit:]...)
+	}
+}
+
+// Page returns at most `limit` events which are skipped by `offset` events,
+// from the newest to the oldest. All remaining events are returned if limit
+// is not positive.
+func (h *ChangefeedHistory) Page(offset, limit int) []*ChangefeedEvent {
+	if offset < 0 {
+		offset = 0
+	}
+	end := len(h.Events) - offset
+	if end <= 0 {
+		return []*ChangefeedEvent{}
+	}
+	start := 0
+	if limit > 0 && end-limit > 0 {
+		start = end - limit
+	}
+	page := make([]*ChangefeedEvent, 0, end-start)
+	for i := end - 1; i >= start; i-- {
+		page = append(page, h.Events[i])
+	}
+	return page
+}
+
+// Marshal returns json encoded string of ChangefeedHistory
+func (h *ChangefeedHistory) Marshal() (string, error) {
+	data, err := json.Marshal(h)
+	return string(data), cerror.WrapError(cerror.ErrMarshalFailed, err)
+}
+
+// Unmarshal unmarshals into *ChangefeedHistory from json marshal byte slice
+func (h *ChangefeedHistory) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, h)
+	return errors.Annotatef(
+		cerror.WrapError(cerror.ErrUnmarshalFailed, err), "Unmarshal data: %v", data)
+}
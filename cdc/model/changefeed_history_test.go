@@ -0,0 +1,73 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type changefeedHistorySuite struct{}
+
+var _ = check.Suite(&changefeedHistorySuite{})
+
+func (s *changefeedHistorySuite) TestAppendAndTrim(c *check.C) {
+	defer testleak.AfterTest(c)()
+	h := &ChangefeedHistory{}
+	h.Append(3, &ChangefeedEvent{Type: ChangefeedEventCreate})
+	c.Assert(h.LastID, check.Equals, int64(1))
+	c.Assert(h.Events, check.HasLen, 1)
+	c.Assert(h.Events[0].ID, check.Equals, int64(1))
+
+	h.Append(3,
+		&ChangefeedEvent{Type: ChangefeedEventPause},
+		&ChangefeedEvent{Type: ChangefeedEventResume},
+		&ChangefeedEvent{Type: ChangefeedEventPause},
+		&ChangefeedEvent{Type: ChangefeedEventRemove},
+	)
+	c.Assert(h.LastID, check.Equals, int64(5))
+	c.Assert(h.Events, check.HasLen, 3)
+	for i, event := range h.Events {
+		c.Assert(event.ID, check.Equals, int64(i+3))
+	}
+	c.Assert(h.Events[2].Type, check.Equals, ChangefeedEventRemove)
+
+	data, err := h.Marshal()
+	c.Assert(err, check.IsNil)
+	h2 := &ChangefeedHistory{}
+	err = h2.Unmarshal([]byte(data))
+	c.Assert(err, check.IsNil)
+	c.Assert(h2, check.DeepEquals, h)
+}
+
+func (s *changefeedHistorySuite) TestPage(c *check.C) {
+	defer testleak.AfterTest(c)()
+	h := &ChangefeedHistory{}
+	for i := 0; i < 5; i++ {
+		h.Append(ChangefeedHistoryLimit, &ChangefeedEvent{Type: ChangefeedEventMoveTable})
+	}
+	ids := func(events []*ChangefeedEvent) []int64 {
+		res := make([]int64, 0, len(events))
+		for _, event := range events {
+			res = append(res, event.ID)
+		}
+		return res
+	}
+	c.Assert(ids(h.Page(0, 0)), check.DeepEquals, []int64{5, 4, 3, 2, 1})
+	c.Assert(ids(h.Page(0, 2)), check.DeepEquals, []int64{5, 4})
+	c.Assert(ids(h.Page(2, 2)), check.DeepEquals, []int64{3, 2})
+	c.Assert(ids(h.Page(4, 2)), check.DeepEquals, []int64{1})
+	c.Assert(ids(h.Page(5, 2)), check.DeepEquals, []int64{})
+	c.Assert(ids(h.Page(-1, 10)), check.DeepEquals, []int64{5, 4, 3, 2, 1})
+}
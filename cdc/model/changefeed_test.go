@@ -175,6 +175,7 @@ func (s *configSuite) TestVerifyAndFix(c *check.C) {
 			CaseSensitive:    true,
 			EnableOldValue:   true,
 			CheckGCSafePoint: true,
+			DDLIncludeViews:  true,
 		},
 	}
 
@@ -273,8 +274,23 @@ func (s *changefeedSuite) TestGetTs(c *check.C) {
 	c.Assert(info.GetTargetTs(), check.Equals, uint64(math.MaxUint64))
 	info.TargetTs = targetTs
 	c.Assert(info.GetTargetTs(), check.Equals, targetTs)
+	// a snapshot-only changefeed finishes once the snapshot is replicated
+	info.SnapshotOnly = true
+	c.Assert(info.GetTargetTs(), check.Equals, startTs+1)
+	info.SnapshotOnly = false
 
 	c.Assert(info.GetCheckpointTs(nil), check.Equals, startTs)
 	status := &ChangeFeedStatus{CheckpointTs: checkpointTs}
 	c.Assert(info.GetCheckpointTs(status), check.Equals, checkpointTs)
+
+	// the changefeed starts from the minimum start ts of tables
+	info.Config = &config.ReplicaConfig{TableStartTs: []*config.TableStartTsRule{
+		{Matcher: []string{"test.a"}, StartTs: startTs + 10},
+	}}
+	c.Assert(info.GetCheckpointTs(nil), check.Equals, startTs)
+	info.Config.TableStartTs = append(info.Config.TableStartTs, &config.TableStartTsRule{
+		Matcher: []string{"test.b"}, StartTs: startTs - 10,
+	})
+	c.Assert(info.GetCheckpointTs(nil), check.Equals, startTs-10)
+	c.Assert(info.GetCheckpointTs(status), check.Equals, checkpointTs)
 }
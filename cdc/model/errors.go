@@ -18,4 +18,6 @@ type RunningError struct {
 	Addr    string `json:"addr"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Origin is the component which the error comes from
+	Origin string `json:"origin,omitempty"`
 }
@@ -0,0 +1,240 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultMaxLogValueBytes is the max bytes of a column value in the logs if
+// it's not configured
+const DefaultMaxLogValueBytes = 256
+
+// DefaultEventLogFormatter is used where the config of the changefeed is not
+// available, it truncates the values to the default limit.
+var DefaultEventLogFormatter = &EventLogFormatter{maxValueBytes: DefaultMaxLogValueBytes}
+
+// sensitiveColumnRule matches the sensitive columns of the tables
+type sensitiveColumnRule struct {
+	filter.Filter
+	column string
+}
+
+// EventLogFormatter formats the events for logging, the column values are
+// truncated to the configured limit and the values of the sensitive columns
+// are replaced with their hashes. A nil formatter uses the default limit and
+// treats no column as sensitive.
+type EventLogFormatter struct {
+	maxValueBytes int
+	sensitive     []sensitiveColumnRule
+}
+
+// NewEventLogFormatter creates an EventLogFormatter from the replica config
+func NewEventLogFormatter(cfg *config.ReplicaConfig) (*EventLogFormatter, error) {
+	f := &EventLogFormatter{maxValueBytes: DefaultMaxLogValueBytes}
+	if cfg.EventLog != nil && cfg.EventLog.MaxValueBytes > 0 {
+		f.maxValueBytes = cfg.EventLog.MaxValueBytes
+	}
+	if cfg.Filter == nil {
+		return f, nil
+	}
+	for _, rule := range cfg.Filter.SensitiveColumns {
+		idx := strings.LastIndex(rule, ".")
+		if idx <= 0 || idx == len(rule)-1 {
+			return nil, cerror.ErrFilterRuleInvalid.GenWithStack("sensitive column %s is invalid", rule)
+		}
+		tableFilter, err := filter.Parse([]string{rule[:idx]})
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if !cfg.CaseSensitive {
+			tableFilter = filter.CaseInsensitive(tableFilter)
+		}
+		f.sensitive = append(f.sensitive, sensitiveColumnRule{Filter: tableFilter, column: rule[idx+1:]})
+	}
+	return f, nil
+}
+
+// Row returns a zap field which logs the row changed event safely
+func (f *EventLogFormatter) Row(key string, row *RowChangedEvent) zap.Field {
+	if row == nil {
+		return zap.Skip()
+	}
+	return zap.Object(key, &rowLogMarshaler{formatter: f, row: row})
+}
+
+// Rows returns a zap field which logs the row changed events safely
+func (f *EventLogFormatter) Rows(key string, rows []*RowChangedEvent) zap.Field {
+	return zap.Array(key, zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		for _, row := range rows {
+			if row == nil {
+				continue
+			}
+			if err := enc.AppendObject(&rowLogMarshaler{formatter: f, row: row}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// Event returns a zap field which logs the polymorphic event safely, the
+// value of the raw KV is never logged
+func (f *EventLogFormatter) Event(key string, event *PolymorphicEvent) zap.Field {
+	if event == nil {
+		return zap.Skip()
+	}
+	return zap.Object(key, &eventLogMarshaler{formatter: f, event: event})
+}
+
+// RawKV returns a zap field which logs the raw KV entry without its value
+func (f *EventLogFormatter) RawKV(key string, raw *RawKVEntry) zap.Field {
+	if raw == nil {
+		return zap.Skip()
+	}
+	return zap.Object(key, &rawKVLogMarshaler{formatter: f, raw: raw})
+}
+
+func (f *EventLogFormatter) limit() int {
+	if f == nil {
+		return DefaultMaxLogValueBytes
+	}
+	return f.maxValueBytes
+}
+
+func (f *EventLogFormatter) isSensitive(table *TableName, column string) bool {
+	if f == nil || table == nil {
+		return false
+	}
+	for _, rule := range f.sensitive {
+		if strings.EqualFold(rule.column, column) && rule.MatchTable(table.Schema, table.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValue returns the string of the column value to be logged
+func (f *EventLogFormatter) formatValue(table *TableName, col *Column) string {
+	value := ColumnValueString(col.Value)
+	if col.Value == nil {
+		return value
+	}
+	if f.isSensitive(table, col.Name) {
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return truncateLogValue(value, f.limit())
+}
+
+// truncateLogValue truncates the value to at most limit bytes, and appends
+// the original size if the value is truncated
+func truncateLogValue(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return fmt.Sprintf("%s...(%d bytes)", value[:limit], len(value))
+}
+
+// rowOpType returns the operation type of the row changed event
+func rowOpType(row *RowChangedEvent) string {
+	switch {
+	case row.IsDelete():
+		return "delete"
+	case len(row.PreColumns) != 0:
+		return "update"
+	default:
+		return "insert"
+	}
+}
+
+type rowLogMarshaler struct {
+	formatter *EventLogFormatter
+	row       *RowChangedEvent
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (m *rowLogMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	row := m.row
+	if row.Table != nil {
+		enc.AddString("table", row.Table.String())
+	}
+	enc.AddUint64("start-ts", row.StartTs)
+	enc.AddUint64("commit-ts", row.CommitTs)
+	enc.AddString("op-type", rowOpType(row))
+	if err := enc.AddArray("columns", m.columns(row.Columns)); err != nil {
+		return err
+	}
+	return enc.AddArray("pre-columns", m.columns(row.PreColumns))
+}
+
+func (m *rowLogMarshaler) columns(cols []*Column) zapcore.ArrayMarshaler {
+	return zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		for _, col := range cols {
+			if col == nil {
+				continue
+			}
+			enc.AppendString(col.Name + ": " + m.formatter.formatValue(m.row.Table, col))
+		}
+		return nil
+	})
+}
+
+type eventLogMarshaler struct {
+	formatter *EventLogFormatter
+	event     *PolymorphicEvent
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (m *eventLogMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	event := m.event
+	enc.AddUint64("start-ts", event.StartTs)
+	enc.AddUint64("crts", event.CRTs)
+	if event.RawKV != nil {
+		if err := enc.AddObject("raw-kv", &rawKVLogMarshaler{formatter: m.formatter, raw: event.RawKV}); err != nil {
+			return err
+		}
+	}
+	if event.Row != nil {
+		return enc.AddObject("row", &rowLogMarshaler{formatter: m.formatter, row: event.Row})
+	}
+	return nil
+}
+
+type rawKVLogMarshaler struct {
+	formatter *EventLogFormatter
+	raw       *RawKVEntry
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (m *rawKVLogMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	raw := m.raw
+	enc.AddInt("op-type", int(raw.OpType))
+	enc.AddString("key", truncateLogValue(fmt.Sprintf("%x", raw.Key), m.formatter.limit()))
+	enc.AddInt("value-bytes", len(raw.Value))
+	enc.AddInt("old-value-bytes", len(raw.OldValue))
+	enc.AddUint64("start-ts", raw.StartTs)
+	enc.AddUint64("crts", raw.CRTs)
+	enc.AddUint64("region-id", raw.RegionID)
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logFormatterSuite struct{}
+
+var _ = check.Suite(&logFormatterSuite{})
+
+func encodeLogField(field zap.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+	return enc.Fields
+}
+
+func (s *logFormatterSuite) TestTruncateAndHash(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.CaseSensitive = false
+	cfg.EventLog.MaxValueBytes = 8
+	cfg.Filter.SensitiveColumns = []string{"test.user*.Password"}
+	f, err := NewEventLogFormatter(cfg)
+	c.Assert(err, check.IsNil)
+
+	blob := []byte(strings.Repeat("a", 1024))
+	row := &RowChangedEvent{
+		StartTs:  1,
+		CommitTs: 2,
+		Table:    &TableName{Schema: "test", Table: "users"},
+		PreColumns: []*Column{
+			{Name: "id", Value: int64(1)},
+			{Name: "password", Value: "secret"},
+		},
+		Columns: []*Column{
+			{Name: "id", Value: int64(1)},
+			{Name: "password", Value: "secret2"},
+			{Name: "data", Value: blob},
+			{Name: "empty", Value: nil},
+		},
+	}
+	fields := encodeLogField(f.Row("row", row))
+	obj := fields["row"].(map[string]interface{})
+	c.Assert(obj["table"], check.Equals, "test.users")
+	c.Assert(obj["start-ts"], check.Equals, uint64(1))
+	c.Assert(obj["commit-ts"], check.Equals, uint64(2))
+	c.Assert(obj["op-type"], check.Equals, "update")
+
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	c.Assert(obj["columns"], check.DeepEquals, []interface{}{
+		"id: 1",
+		"password: " + hash("secret2"),
+		"data: aaaaaaaa...(1024 bytes)",
+		"empty: null",
+	})
+	c.Assert(obj["pre-columns"], check.DeepEquals, []interface{}{
+		"id: 1",
+		"password: " + hash("secret"),
+	})
+
+	// the columns of the other tables are not sensitive
+	row.Table = &TableName{Schema: "test", Table: "orders"}
+	row.PreColumns = nil
+	obj = encodeLogField(f.Row("row", row))["row"].(map[string]interface{})
+	c.Assert(obj["op-type"], check.Equals, "insert")
+	c.Assert(obj["columns"].([]interface{})[1], check.Equals, "password: secret2")
+}
+
+func (s *logFormatterSuite) TestEvent(c *check.C) {
+	defer testleak.AfterTest(c)()
+	raw := &RawKVEntry{
+		OpType:   OpTypeDelete,
+		Key:      []byte("key"),
+		OldValue: []byte(strings.Repeat("v", 100)),
+		StartTs:  1,
+		CRTs:     2,
+		RegionID: 3,
+	}
+	event := NewPolymorphicEvent(raw)
+	event.Row = &RowChangedEvent{
+		StartTs:    1,
+		CommitTs:   2,
+		Table:      &TableName{Schema: "test", Table: "t"},
+		PreColumns: []*Column{{Name: "id", Value: int64(1)}},
+	}
+	obj := encodeLogField(DefaultEventLogFormatter.Event("event", event))["event"].(map[string]interface{})
+	c.Assert(obj["crts"], check.Equals, uint64(2))
+	c.Assert(obj["raw-kv"], check.DeepEquals, map[string]interface{}{
+		"op-type":         int(OpTypeDelete),
+		"key":             "6b6579",
+		"value-bytes":     0,
+		"old-value-bytes": 100,
+		"start-ts":        uint64(1),
+		"crts":            uint64(2),
+		"region-id":       uint64(3),
+	})
+	row := obj["row"].(map[string]interface{})
+	c.Assert(row["op-type"], check.Equals, "delete")
+	c.Assert(row["pre-columns"], check.DeepEquals, []interface{}{"id: 1"})
+
+	// a nil formatter uses the default limit
+	var f *EventLogFormatter
+	value := strings.Repeat("a", DefaultMaxLogValueBytes+1)
+	obj = encodeLogField(f.Row("row", &RowChangedEvent{Columns: []*Column{{Name: "a", Value: value}}}))["row"].(map[string]interface{})
+	c.Assert(obj["columns"], check.DeepEquals, []interface{}{
+		"a: " + value[:DefaultMaxLogValueBytes] + "...(257 bytes)",
+	})
+}
+
+func (s *logFormatterSuite) TestInvalidSensitiveColumn(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	for _, rule := range []string{"password", "test.t.", ".password"} {
+		cfg.Filter.SensitiveColumns = []string{rule}
+		_, err := NewEventLogFormatter(cfg)
+		c.Assert(err, check.ErrorMatches, ".*CDC:ErrFilterRuleInvalid.*")
+	}
+}
@@ -26,6 +26,12 @@ type PolymorphicEvent struct {
 	RawKV    *RawKVEntry
 	Row      *RowChangedEvent
 	finished chan struct{}
+
+	// Sampled is carried to the row once it's mounted, see RowChangedEvent.Sampled
+	Sampled bool
+	// MarkTable is set if the event is of a mark table of the cyclic
+	// replication, which isn't counted as a replicated row
+	MarkTable bool
 }
 
 // NewPolymorphicEvent creates a new PolymorphicEvent with a raw KV
@@ -71,6 +77,19 @@ func (e *PolymorphicEvent) PrepareFinished() {
 	}
 }
 
+// IsPrepared returns whether the prepare process is finished, it doesn't block
+func (e *PolymorphicEvent) IsPrepared() bool {
+	if e.finished == nil {
+		return true
+	}
+	select {
+	case <-e.finished:
+		return true
+	default:
+		return false
+	}
+}
+
 // WaitPrepare waits for prepare process finished
 func (e *PolymorphicEvent) WaitPrepare(ctx context.Context) error {
 	if e.finished != nil {
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/pingcap/errors"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
@@ -28,6 +29,13 @@ type AdminJobType int
 // AdminJobOption records addition options of an admin job
 type AdminJobOption struct {
 	ForceRemove bool
+	// Graceful indicates the changefeed is stopped after the sinks are
+	// flushed, it's set for the pause commands of the users, but not for the
+	// changefeeds stopped by the errors.
+	Graceful bool
+	// OverwriteCheckpointTs is the ts a paused changefeed is resumed from
+	// instead of its checkpoint ts, 0 means it's not overwritten.
+	OverwriteCheckpointTs uint64
 }
 
 // AdminJob holds an admin job
@@ -36,6 +44,9 @@ type AdminJob struct {
 	Type  AdminJobType
 	Opts  *AdminJobOption
 	Error *RunningError
+	// Client describes the client which submits the job, it's recorded in
+	// the changefeed history.
+	Client string
 }
 
 // All AdminJob types
@@ -83,6 +94,75 @@ type TaskPosition struct {
 	Count uint64 `json:"count"`
 	// Error code when error happens
 	Error *RunningError `json:"error"`
+	// The progress of incremental scan, it's only set while any table of
+	// the processor is still initializing.
+	ScanProgress *IncrementalScanProgress `json:"scan-progress,omitempty"`
+	// The tables whose incremental scan is not finished, it's only set while
+	// any table of the processor is still initializing.
+	InitializingTables []TableID `json:"initializing-tables,omitempty"`
+	// The resolved ts of the slowest tables replicated by the processor, it's
+	// capped to bound the size of the position, the resolved ts of the other
+	// tables is at least the resolved ts of the processor. The checkpoint ts
+	// of a table is bounded by the checkpoint ts of the processor, since all
+	// tables are flushed to the sink together.
+	TableResolvedTs map[TableID]Ts `json:"table-resolved-ts,omitempty"`
+	// The large transactions being received by the processor, it's only set
+	// if the large transactions are reported to the owner.
+	LargeTxns []*LargeTxnInfo `json:"large-txns,omitempty"`
+	// The number of the events dropped by each table since the resolved ts
+	// of the table is forced to advance, see TableForceAdvance.
+	DroppedEvents map[TableID]uint64 `json:"dropped-events,omitempty"`
+	// The resources whose budget is exceeded by the processor for a
+	// sustained period, see BudgetConfig.
+	BudgetExceeded []string `json:"budget-exceeded,omitempty"`
+	// The validation failures detected by the processor in the current
+	// breaker epoch, see CircuitBreakerConfig.
+	BreakerTrips []*BreakerTrip `json:"breaker-trips,omitempty"`
+}
+
+// LargeTxnInfo records a large transaction of a table, whose rows exceed the
+// threshold, being received by a processor
+type LargeTxnInfo struct {
+	// Table is the quoted schema and table name
+	Table    string `json:"table"`
+	CommitTs uint64 `json:"commit-ts"`
+	// Rows is the number of the rows received so far
+	Rows int64 `json:"rows"`
+}
+
+// String implements fmt.Stringer interface.
+func (t *LargeTxnInfo) String() string {
+	var rows string
+	switch {
+	case t.Rows >= 1000000:
+		rows = fmt.Sprintf("%.1fM", float64(t.Rows)/1e6)
+	case t.Rows >= 1000:
+		rows = fmt.Sprintf("%.1fK", float64(t.Rows)/1e3)
+	default:
+		rows = fmt.Sprintf("%d", t.Rows)
+	}
+	return fmt.Sprintf("applying large transaction (%s rows so far) on %s", rows, t.Table)
+}
+
+// IncrementalScanProgress records the progress of the incremental scan of tables
+type IncrementalScanProgress struct {
+	TotalRegions       int64 `json:"total-regions"`
+	InitializedRegions int64 `json:"initialized-regions"`
+	ScannedRows        int64 `json:"scanned-rows"`
+	ScannedBytes       int64 `json:"scanned-bytes"`
+}
+
+// Add accumulates another progress into the progress
+func (p *IncrementalScanProgress) Add(other IncrementalScanProgress) {
+	p.TotalRegions += other.TotalRegions
+	p.InitializedRegions += other.InitializedRegions
+	p.ScannedRows += other.ScannedRows
+	p.ScannedBytes += other.ScannedBytes
+}
+
+// String implements fmt.Stringer interface.
+func (p *IncrementalScanProgress) String() string {
+	return fmt.Sprintf("%d/%d regions", p.InitializedRegions, p.TotalRegions)
 }
 
 // Marshal returns the json marshal format of a TaskStatus
@@ -138,6 +218,18 @@ type TableOperation struct {
 	BoundaryTs uint64 `json:"boundary_ts"`
 	Done       bool   `json:"done"` // deprecated, will be removed in the next version
 	Status     uint64 `json:"status,omitempty"`
+	// Error is set by the processor if the table can't be added, e.g. the
+	// sort dir has no capacity, the owner then moves the table to another
+	// capture. The table is kept unscheduled if the downstream schema of the
+	// table is incompatible in the strict mode.
+	Error *RunningError `json:"error,omitempty"`
+	// SwapTableID is set on the add operation of the physical table which
+	// replaces a truncated one, the delete operation of the truncated table is
+	// applied after the table is added.
+	SwapTableID TableID `json:"swap-table-id,omitempty"`
+	// DispatchTime is when the operation is dispatched by the owner, it's
+	// nil if the operation is dispatched by an owner of old versions.
+	DispatchTime *time.Time `json:"dispatch-time,omitempty"`
 }
 
 // TableProcessed returns whether the table has been processed by processor
@@ -159,6 +251,14 @@ func (o *TableOperation) Clone() *TableOperation {
 		return nil
 	}
 	clone := *o
+	if o.Error != nil {
+		err := *o.Error
+		clone.Error = &err
+	}
+	if o.DispatchTime != nil {
+		dispatchTime := *o.DispatchTime
+		clone.DispatchTime = &dispatchTime
+	}
 	return &clone
 }
 
@@ -202,13 +302,56 @@ func (i *TableReplicaInfo) Clone() *TableReplicaInfo {
 	return &clone
 }
 
+// TableReadiness is the result of checking whether the downstream schema of a
+// table is compatible with the upstream table
+type TableReadiness struct {
+	Table string `json:"table"`
+	Ready bool   `json:"ready"`
+	// Reason describes the incompatibilities if the table is not ready
+	Reason string `json:"reason,omitempty"`
+}
+
+// TableForceAdvance is an operation to force the resolved ts of a table to
+// advance, it's written by the unsafe command advance-table-resolved-ts and
+// applied by processor. The events of the table at or below the target ts are
+// dropped by the processor once it's applied.
+type TableForceAdvance struct {
+	TargetTs Ts     `json:"target-ts"`
+	Status   uint64 `json:"status,omitempty"`
+	// Error is set if the operation can't be applied by the processor
+	Error *RunningError `json:"error,omitempty"`
+}
+
+// Clone returns a deep-clone of the struct
+func (f *TableForceAdvance) Clone() *TableForceAdvance {
+	if f == nil {
+		return nil
+	}
+	clone := *f
+	if f.Error != nil {
+		err := *f.Error
+		clone.Error = &err
+	}
+	return &clone
+}
+
 // TaskStatus records the task information of a capture
 type TaskStatus struct {
 	// Table information list, containing tables that processor should process, updated by ownrer, processor is read only.
 	Tables       map[TableID]*TableReplicaInfo `json:"tables"`
 	Operation    map[TableID]*TableOperation   `json:"operation"`
 	AdminJobType AdminJobType                  `json:"admin-job-type"`
-	ModRevision  int64                         `json:"-"`
+	// DrainBoundary records the ts up to which the sink has applied the data
+	// of the removed tables, updated by processor, and the owner starts the
+	// moved tables from it in the target processor.
+	DrainBoundary map[TableID]Ts `json:"drain-boundary,omitempty"`
+	// Readiness records the results of checking the downstream schema of the
+	// tables before they're added, updated by processor.
+	Readiness map[TableID]*TableReadiness `json:"readiness,omitempty"`
+	// ForceAdvance records the operations forcing the resolved ts of the
+	// tables to advance, see TableForceAdvance.
+	ForceAdvance map[TableID]*TableForceAdvance `json:"force-advance,omitempty"`
+	ModRevision  int64                          `json:"-"`
 	// true means Operation record has been changed
 	Dirty bool `json:"-"`
 }
@@ -229,12 +372,17 @@ func (ts *TaskStatus) RemoveTable(id TableID, boundaryTs Ts) (*TableReplicaInfo,
 		return nil, false
 	}
 	delete(ts.Tables, id)
+	delete(ts.DrainBoundary, id)
+	delete(ts.Readiness, id)
+	delete(ts.ForceAdvance, id)
 	if ts.Operation == nil {
 		ts.Operation = make(map[TableID]*TableOperation)
 	}
+	dispatchTime := time.Now()
 	ts.Operation[id] = &TableOperation{
-		Delete:     true,
-		BoundaryTs: boundaryTs,
+		Delete:       true,
+		BoundaryTs:   boundaryTs,
+		DispatchTime: &dispatchTime,
 	}
 	return table, true
 }
@@ -249,13 +397,63 @@ func (ts *TaskStatus) AddTable(id TableID, table *TableReplicaInfo, boundaryTs T
 		return
 	}
 	ts.Tables[id] = table
+	delete(ts.DrainBoundary, id)
+	delete(ts.Readiness, id)
+	delete(ts.ForceAdvance, id)
 	if ts.Operation == nil {
 		ts.Operation = make(map[TableID]*TableOperation)
 	}
+	dispatchTime := time.Now()
 	ts.Operation[id] = &TableOperation{
-		Delete:     false,
-		BoundaryTs: boundaryTs,
-		Status:     OperDispatched,
+		Delete:       false,
+		BoundaryTs:   boundaryTs,
+		Status:       OperDispatched,
+		DispatchTime: &dispatchTime,
+	}
+}
+
+// SwapTable removes the truncated physical table and adds the new one which
+// replaces it from the same boundary ts, the operations are linked so that the
+// processor applies them atomically. False is returned if the truncated table
+// is not in the status.
+func (ts *TaskStatus) SwapTable(oldID, newID TableID, table *TableReplicaInfo, boundaryTs Ts) bool {
+	if _, exist := ts.RemoveTable(oldID, boundaryTs); !exist {
+		return false
+	}
+	ts.AddTable(newID, table, boundaryTs)
+	if op, ok := ts.Operation[newID]; ok && !op.Delete {
+		op.SwapTableID = oldID
+	}
+	return true
+}
+
+// SetDrainBoundary records the ts up to which the sink has applied the data
+// of the removed table
+func (ts *TaskStatus) SetDrainBoundary(id TableID, boundaryTs Ts) {
+	if ts.DrainBoundary == nil {
+		ts.DrainBoundary = make(map[TableID]Ts)
+	}
+	ts.DrainBoundary[id] = boundaryTs
+}
+
+// SetReadiness records the result of checking the downstream schema of the
+// table
+func (ts *TaskStatus) SetReadiness(id TableID, readiness *TableReadiness) {
+	if ts.Readiness == nil {
+		ts.Readiness = make(map[TableID]*TableReadiness)
+	}
+	ts.Readiness[id] = readiness
+}
+
+// ForceAdvanceTable adds an operation to force the resolved ts of the table
+// to advance to targetTs
+func (ts *TaskStatus) ForceAdvanceTable(id TableID, targetTs Ts) {
+	if ts.ForceAdvance == nil {
+		ts.ForceAdvance = make(map[TableID]*TableForceAdvance)
+	}
+	ts.ForceAdvance[id] = &TableForceAdvance{
+		TargetTs: targetTs,
+		Status:   OperDispatched,
 	}
 }
 
@@ -328,6 +526,28 @@ func (ts *TaskStatus) Clone() *TaskStatus {
 		operation[tableID] = opt.Clone()
 	}
 	clone.Operation = operation
+	if ts.DrainBoundary != nil {
+		boundary := make(map[TableID]Ts, len(ts.DrainBoundary))
+		for tableID, boundaryTs := range ts.DrainBoundary {
+			boundary[tableID] = boundaryTs
+		}
+		clone.DrainBoundary = boundary
+	}
+	if ts.Readiness != nil {
+		readiness := make(map[TableID]*TableReadiness, len(ts.Readiness))
+		for tableID, r := range ts.Readiness {
+			cloned := *r
+			readiness[tableID] = &cloned
+		}
+		clone.Readiness = readiness
+	}
+	if ts.ForceAdvance != nil {
+		forceAdvance := make(map[TableID]*TableForceAdvance, len(ts.ForceAdvance))
+		for tableID, f := range ts.ForceAdvance {
+			forceAdvance[tableID] = f.Clone()
+		}
+		clone.ForceAdvance = forceAdvance
+	}
 	return &clone
 }
 
@@ -397,6 +617,247 @@ type ChangeFeedStatus struct {
 	ResolvedTs   uint64       `json:"resolved-ts"`
 	CheckpointTs uint64       `json:"checkpoint-ts"`
 	AdminJobType AdminJobType `json:"admin-job-type"`
+	// Pause records how the changefeed is paused, it's nil if the changefeed
+	// is not paused by a pause command.
+	Pause *PauseInfo `json:"pause,omitempty"`
+	// Pausing is set while the changefeed is being paused by a pause command,
+	// it's persisted so that the pause is finished by the next owner if the
+	// owner is changed.
+	Pausing *PausingInfo `json:"pausing,omitempty"`
+	// DirtyStops records the latest processors which were stopped before
+	// their sinks were flushed and closed.
+	DirtyStops []*DirtyStop `json:"dirty-stops,omitempty"`
+	// LargeTxns describes the large transactions being applied, which are
+	// reported by the processors.
+	LargeTxns []string `json:"large-txns,omitempty"`
+	// BudgetWarnings describes the budgets exceeded by the processors for a
+	// sustained period.
+	BudgetWarnings []string `json:"budget-warnings,omitempty"`
+	// StuckOperations describes the table operations which are pending for
+	// longer than expected, e.g. the processor crashed in the middle of it.
+	StuckOperations []string `json:"stuck-operations,omitempty"`
+	// UnscheduledTables are the tables which can't be added by any capture,
+	// the values are the reasons.
+	UnscheduledTables map[TableID]string `json:"unscheduled-tables,omitempty"`
+	// SkippedDDLs records the latest DDLs skipped because they're not
+	// supported by the downstream.
+	SkippedDDLs []*UnsupportedDDL `json:"skipped-ddls,omitempty"`
+	// PausedDDL is the DDL not supported by the downstream which the
+	// changefeed is paused on, it's cleared after the DDL is handled.
+	PausedDDL *UnsupportedDDL `json:"paused-ddl,omitempty"`
+	// ExecutingDDL is the DDL being executed by the downstream, it's nil if
+	// there is none.
+	ExecutingDDL *ExecutingDDL `json:"executing-ddl,omitempty"`
+	// BreakerEpoch is increased each time the circuit breaker is reset, the
+	// trips detected in the previous epochs are ignored.
+	BreakerEpoch uint64 `json:"breaker-epoch,omitempty"`
+	// BreakerTrips are the trips of the circuit breaker handled by the owner
+	// since it's reset.
+	BreakerTrips []*BreakerTrip `json:"breaker-trips,omitempty"`
+	// PausedTables are the tables paused by the circuit breaker, they're not
+	// replicated until the breaker is reset. The tables resumed by a reset are
+	// kept with the previous epoch until they catch up with StartTs.
+	PausedTables map[TableID]*PausedTable `json:"paused-tables,omitempty"`
+	// InitialScanFinished records when the changefeed finished catching up
+	// with the history, it's nil before the milestone is reached and it's
+	// never reset.
+	InitialScanFinished *InitialScanMilestone `json:"initial-scan-finished,omitempty"`
+	// InitializingTables are the tables whose incremental scan is not
+	// finished, including the tables added after the milestone.
+	InitializingTables []TableID `json:"initializing-tables,omitempty"`
+}
+
+// InitialScanMilestone records when the changefeed reaches the steady state,
+// i.e. all tables finished the incremental scan and the checkpoint lag stayed
+// under the threshold for a sustained period.
+type InitialScanMilestone struct {
+	Time         time.Time `json:"time"`
+	CheckpointTs uint64    `json:"checkpoint-ts"`
+}
+
+// maxDirtyStops is the max number of the dirty stops kept in the changefeed status
+const maxDirtyStops = 10
+
+// DirtyStop records a processor which was stopped without its sink flushed
+// and closed in time, the events after CheckpointTs may be written to the
+// downstream again by the processors taking over the tables.
+type DirtyStop struct {
+	CaptureID    CaptureID `json:"capture-id"`
+	CheckpointTs uint64    `json:"checkpoint-ts"`
+	Time         time.Time `json:"time"`
+	Reason       string    `json:"reason"`
+	ModRevision  int64     `json:"-"`
+}
+
+// Marshal returns the json marshal format of a DirtyStop
+func (s *DirtyStop) Marshal() (string, error) {
+	data, err := json.Marshal(s)
+	return string(data), cerror.WrapError(cerror.ErrMarshalFailed, err)
+}
+
+// Unmarshal unmarshals into *DirtyStop from json marshal byte slice
+func (s *DirtyStop) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, s)
+	return errors.Annotatef(
+		cerror.WrapError(cerror.ErrUnmarshalFailed, err), "Unmarshal data: %v", data)
+}
+
+// AddDirtyStops appends the dirty stops to the status, only the latest
+// maxDirtyStops ones are kept.
+func (status *ChangeFeedStatus) AddDirtyStops(stops ...*DirtyStop) {
+	status.DirtyStops = append(status.DirtyStops, stops...)
+	if len(status.DirtyStops) > maxDirtyStops {
+		status.DirtyStops = append([]*DirtyStop{}, status.DirtyStops[len(status.DirtyStops)-maxDirtyStops:]...)
+	}
+}
+
+// maxSkippedDDLs is the max number of the skipped DDLs kept in the changefeed status
+const maxSkippedDDLs = 10
+
+// UnsupportedDDL records a DDL which is not supported by the downstream
+type UnsupportedDDL struct {
+	JobID    int64     `json:"job-id"`
+	CommitTs uint64    `json:"commit-ts"`
+	Query    string    `json:"query"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// AddSkippedDDL appends the skipped DDL to the status, only the latest
+// maxSkippedDDLs ones are kept.
+func (status *ChangeFeedStatus) AddSkippedDDL(ddl *UnsupportedDDL) {
+	status.SkippedDDLs = append(status.SkippedDDLs, ddl)
+	if len(status.SkippedDDLs) > maxSkippedDDLs {
+		status.SkippedDDLs = append([]*UnsupportedDDL{}, status.SkippedDDLs[len(status.SkippedDDLs)-maxSkippedDDLs:]...)
+	}
+}
+
+// BreakerDetector is the detector of the validation failures which trip the
+// circuit breaker
+type BreakerDetector string
+
+// All BreakerDetector types
+const (
+	BreakerDetectorConsistencyMismatch BreakerDetector = "consistency-mismatch"
+	BreakerDetectorOrderingViolation   BreakerDetector = "ordering-violation"
+	BreakerDetectorQuarantinedRows     BreakerDetector = "quarantined-rows"
+)
+
+// BreakerTrip is a validation failure of a table detected by a processor, a
+// detector trips once for each table in a breaker epoch.
+type BreakerTrip struct {
+	Detector  BreakerDetector `json:"detector"`
+	TableID   TableID         `json:"table-id"`
+	CaptureID CaptureID       `json:"capture-id"`
+	Epoch     uint64          `json:"epoch"`
+	Message   string          `json:"message"`
+	Time      time.Time       `json:"time"`
+	// Action is the action taken by the owner, it's set once the trip is
+	// handled.
+	Action string `json:"action,omitempty"`
+}
+
+// SameTrip returns whether the trips are the same failure reported by a
+// processor
+func (t *BreakerTrip) SameTrip(other *BreakerTrip) bool {
+	return t.Detector == other.Detector && t.TableID == other.TableID &&
+		t.CaptureID == other.CaptureID && t.Epoch == other.Epoch && t.Time.Equal(other.Time)
+}
+
+// PausedTable records a table paused by the circuit breaker
+type PausedTable struct {
+	// StartTs is the ts the table is replicated from once it's resumed
+	StartTs uint64 `json:"start-ts"`
+	// Epoch is the breaker epoch the table is paused in, the table is
+	// resumed once the breaker is reset to a later epoch.
+	Epoch    uint64          `json:"epoch"`
+	Detector BreakerDetector `json:"detector"`
+	Message  string          `json:"message"`
+	Time     time.Time       `json:"time"`
+}
+
+// MinRetainedTs returns the min ts of the data still needed by the changefeed,
+// it's the checkpoint ts unless a table is paused or resumed before it.
+func (status *ChangeFeedStatus) MinRetainedTs() uint64 {
+	ts := status.CheckpointTs
+	for _, table := range status.PausedTables {
+		if table.StartTs < ts {
+			ts = table.StartTs
+		}
+	}
+	return ts
+}
+
+// ExecutingDDL describes a DDL being executed by the downstream, which is
+// updated by the owner until the DDL is finished, so that a long DDL is not
+// taken as a stuck changefeed.
+type ExecutingDDL struct {
+	JobID     int64     `json:"job-id"`
+	CommitTs  uint64    `json:"commit-ts"`
+	Query     string    `json:"query"`
+	StartTime time.Time `json:"start-time"`
+	// Elapsed is the time the DDL has been executed for when it's updated
+	Elapsed string `json:"elapsed"`
+	// Timeout is the time the DDL can be executed for, it's empty if there
+	// is no timeout
+	Timeout string `json:"timeout,omitempty"`
+	// Progress is reported by the downstream, it's empty if the downstream
+	// doesn't report it
+	Progress string `json:"progress,omitempty"`
+	// ExecutionID identifies a dispatch of the DDL to the downstream, it's
+	// changed each time the DDL is dispatched again.
+	ExecutionID string `json:"execution-id,omitempty"`
+	// Event is the DDL dispatched to the downstream. The record is persisted
+	// before the dispatch, so that a new owner finding it after a failover
+	// can tell whether to execute the DDL again.
+	Event *DDLEvent `json:"event,omitempty"`
+}
+
+// CheckpointGuard records the highest global checkpoint ts of a changefeed
+// observed by a processor, which is persisted independently of the owner.
+// The global checkpoint ts is expected to never move below it.
+type CheckpointGuard struct {
+	CheckpointTs uint64 `json:"checkpoint-ts"`
+	// CreateTime is the create time of the changefeed, the guards recorded
+	// before the changefeed is recreated with the same ID are ignored.
+	CreateTime  time.Time `json:"create-time"`
+	ModRevision int64     `json:"-"`
+}
+
+// Marshal returns the json marshal format of a CheckpointGuard
+func (g *CheckpointGuard) Marshal() (string, error) {
+	data, err := json.Marshal(g)
+	return string(data), cerror.WrapError(cerror.ErrMarshalFailed, err)
+}
+
+// Unmarshal unmarshals into *CheckpointGuard from json marshal byte slice
+func (g *CheckpointGuard) Unmarshal(data []byte) error {
+	err := json.Unmarshal(data, g)
+	return errors.Annotatef(
+		cerror.WrapError(cerror.ErrUnmarshalFailed, err), "Unmarshal data: %v", data)
+}
+
+// PauseInfo records the checkpoint of a paused changefeed
+type PauseInfo struct {
+	// PausedAtTs is the checkpoint ts when the changefeed is paused, the
+	// changefeed is resumed from it.
+	PausedAtTs uint64 `json:"paused-at-ts"`
+	// Clean indicates whether all the events before PausedAtTs were flushed
+	// to the sink before the changefeed was stopped. If the flush times out,
+	// the changefeed is stopped anyway and Clean is false.
+	Clean bool `json:"clean"`
+}
+
+// PausingInfo records a changefeed being paused. The resolved ts of the
+// changefeed is capped at PauseTs, so that the processors flush their sinks up
+// to PauseTs and then the checkpoint catches up with it.
+type PausingInfo struct {
+	PauseTs uint64 `json:"pause-ts"`
+	// Deadline is the time when the changefeed is stopped even if the sinks
+	// are not flushed.
+	Deadline time.Time `json:"deadline"`
+	// Client describes the client which submits the pause command.
+	Client string `json:"client,omitempty"`
 }
 
 // Marshal returns json encoded string of ChangeFeedStatus, only contains necessary fields stored in storage
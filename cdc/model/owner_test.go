@@ -14,6 +14,7 @@
 package model
 
 import (
+	"fmt"
 	"math"
 	"testing"
 
@@ -86,6 +87,32 @@ func (s *ownerCommonSuite) TestTaskPositionMarshal(c *check.C) {
 	c.Assert(newPos, check.DeepEquals, pos)
 }
 
+func (s *ownerCommonSuite) TestIncrementalScanProgress(c *check.C) {
+	defer testleak.AfterTest(c)()
+	progress := &IncrementalScanProgress{}
+	progress.Add(IncrementalScanProgress{TotalRegions: 8000, InitializedRegions: 1500, ScannedRows: 10, ScannedBytes: 100})
+	progress.Add(IncrementalScanProgress{TotalRegions: 200, InitializedRegions: 34, ScannedRows: 20, ScannedBytes: 200})
+	c.Assert(progress, check.DeepEquals, &IncrementalScanProgress{
+		TotalRegions: 8200, InitializedRegions: 1534, ScannedRows: 30, ScannedBytes: 300,
+	})
+	c.Assert(progress.String(), check.Equals, "1534/8200 regions")
+
+	pos := &TaskPosition{
+		ResolvedTs:   420875942036766723,
+		CheckPointTs: 420875940070686721,
+		ScanProgress: progress,
+	}
+	expected := `{"checkpoint-ts":420875940070686721,"resolved-ts":420875942036766723,"count":0,"error":null,` +
+		`"scan-progress":{"total-regions":8200,"initialized-regions":1534,"scanned-rows":30,"scanned-bytes":300}}`
+	data, err := pos.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.Equals, expected)
+	newPos := &TaskPosition{}
+	err = newPos.Unmarshal([]byte(data))
+	c.Assert(err, check.IsNil)
+	c.Assert(newPos, check.DeepEquals, pos)
+}
+
 func (s *ownerCommonSuite) TestChangeFeedStatusMarshal(c *check.C) {
 	defer testleak.AfterTest(c)()
 	status := &ChangeFeedStatus{
@@ -104,6 +131,65 @@ func (s *ownerCommonSuite) TestChangeFeedStatusMarshal(c *check.C) {
 	c.Assert(newStatus, check.DeepEquals, status)
 }
 
+func (s *ownerCommonSuite) TestPausedChangeFeedStatusMarshal(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &ChangeFeedStatus{
+		ResolvedTs:   420875942036766723,
+		CheckpointTs: 420875940070686721,
+		AdminJobType: AdminStop,
+		Pause:        &PauseInfo{PausedAtTs: 420875940070686721},
+	}
+	expected := `{"resolved-ts":420875942036766723,"checkpoint-ts":420875940070686721,"admin-job-type":1,` +
+		`"pause":{"paused-at-ts":420875940070686721,"clean":false}}`
+
+	data, err := status.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.Equals, expected)
+
+	newStatus := &ChangeFeedStatus{}
+	err = newStatus.Unmarshal([]byte(data))
+	c.Assert(err, check.IsNil)
+	c.Assert(newStatus, check.DeepEquals, status)
+}
+
+func (s *ownerCommonSuite) TestLargeTxnInfoString(c *check.C) {
+	defer testleak.AfterTest(c)()
+	info := &LargeTxnInfo{Table: "`db`.`orders`", CommitTs: 420875940070686721, Rows: 3210000}
+	c.Assert(info.String(), check.Equals, "applying large transaction (3.2M rows so far) on `db`.`orders`")
+	info.Rows = 150000
+	c.Assert(info.String(), check.Equals, "applying large transaction (150.0K rows so far) on `db`.`orders`")
+	info.Rows = 500
+	c.Assert(info.String(), check.Equals, "applying large transaction (500 rows so far) on `db`.`orders`")
+}
+
+func (s *ownerCommonSuite) TestAddDirtyStops(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &ChangeFeedStatus{CheckpointTs: 420875940070686721}
+	status.AddDirtyStops(&DirtyStop{CaptureID: "capture-0", CheckpointTs: 420875940070686700})
+	data, err := status.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.Equals, `{"resolved-ts":0,"checkpoint-ts":420875940070686721,"admin-job-type":0,`+
+		`"dirty-stops":[{"capture-id":"capture-0","checkpoint-ts":420875940070686700,"time":"0001-01-01T00:00:00Z","reason":""}]}`)
+
+	for i := 1; i < 15; i++ {
+		status.AddDirtyStops(&DirtyStop{CaptureID: fmt.Sprintf("capture-%d", i)})
+	}
+	c.Assert(status.DirtyStops, check.HasLen, maxDirtyStops)
+	c.Assert(status.DirtyStops[0].CaptureID, check.Equals, "capture-5")
+	c.Assert(status.DirtyStops[maxDirtyStops-1].CaptureID, check.Equals, "capture-14")
+}
+
+func (s *ownerCommonSuite) TestAddSkippedDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &ChangeFeedStatus{}
+	for i := 0; i < 15; i++ {
+		status.AddSkippedDDL(&UnsupportedDDL{JobID: int64(i)})
+	}
+	c.Assert(status.SkippedDDLs, check.HasLen, maxSkippedDDLs)
+	c.Assert(status.SkippedDDLs[0].JobID, check.Equals, int64(5))
+	c.Assert(status.SkippedDDLs[maxSkippedDDLs-1].JobID, check.Equals, int64(14))
+}
+
 func (s *ownerCommonSuite) TestTableOperationState(c *check.C) {
 	defer testleak.AfterTest(c)()
 	processedMap := map[uint64]bool{
@@ -262,6 +348,8 @@ func (s *taskStatusSuite) TestAddTable(c *check.C) {
 	}
 	status := &TaskStatus{}
 	status.AddTable(1, &TableReplicaInfo{StartTs: ts}, ts)
+	c.Assert(status.Operation[1].DispatchTime, check.NotNil)
+	expected.Operation[1].DispatchTime = status.Operation[1].DispatchTime
 	c.Assert(status, check.DeepEquals, expected)
 
 	// add existing table does nothing
@@ -269,6 +357,24 @@ func (s *taskStatusSuite) TestAddTable(c *check.C) {
 	c.Assert(status, check.DeepEquals, expected)
 }
 
+func (s *taskStatusSuite) TestSwapTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &TaskStatus{Tables: map[TableID]*TableReplicaInfo{1: {StartTs: 100}}}
+	c.Assert(status.SwapTable(1, 2, &TableReplicaInfo{StartTs: 120}, 120), check.IsTrue)
+	c.Assert(status, check.DeepEquals, &TaskStatus{
+		Tables: map[TableID]*TableReplicaInfo{2: {StartTs: 120}},
+		Operation: map[TableID]*TableOperation{
+			1: {Delete: true, BoundaryTs: 120, DispatchTime: status.Operation[1].DispatchTime},
+			2: {BoundaryTs: 120, Status: OperDispatched, SwapTableID: 1, DispatchTime: status.Operation[2].DispatchTime},
+		},
+	})
+
+	// the table not in the status isn't swapped
+	c.Assert(status.SwapTable(3, 4, &TableReplicaInfo{StartTs: 130}, 130), check.IsFalse)
+	c.Assert(status.Tables, check.HasLen, 1)
+	c.Assert(status.Operation, check.HasLen, 2)
+}
+
 func (s *taskStatusSuite) TestTaskStatusApplyState(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ts1 := uint64(420875042036766723)
@@ -285,6 +391,86 @@ func (s *taskStatusSuite) TestTaskStatusApplyState(c *check.C) {
 	c.Assert(status.AppliedTs(), check.Equals, uint64(math.MaxUint64))
 }
 
+func (s *taskStatusSuite) TestDrainBoundary(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &TaskStatus{}
+	status.AddTable(1, &TableReplicaInfo{StartTs: 10}, 10)
+	status.AddTable(2, &TableReplicaInfo{StartTs: 10}, 10)
+	status.RemoveTable(1, 20)
+	status.SetDrainBoundary(1, 25)
+	status.SetDrainBoundary(2, 30)
+
+	clone := status.Clone()
+	status.DrainBoundary[1] = 26
+	c.Assert(clone.DrainBoundary, check.DeepEquals, map[TableID]Ts{1: 25, 2: 30})
+
+	data, err := clone.Marshal()
+	c.Assert(err, check.IsNil)
+	unmarshaled := &TaskStatus{}
+	c.Assert(unmarshaled.Unmarshal([]byte(data)), check.IsNil)
+	c.Assert(unmarshaled.DrainBoundary, check.DeepEquals, clone.DrainBoundary)
+
+	// the stale drain boundary is removed when the table is added or removed
+	clone.AddTable(1, &TableReplicaInfo{StartTs: 30}, 30)
+	clone.RemoveTable(2, 40)
+	c.Assert(clone.DrainBoundary, check.HasLen, 0)
+}
+
+func (s *taskStatusSuite) TestReadiness(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &TaskStatus{}
+	status.AddTable(1, &TableReplicaInfo{StartTs: 10}, 10)
+	status.AddTable(2, &TableReplicaInfo{StartTs: 10}, 10)
+	status.SetReadiness(1, &TableReadiness{Table: "`test`.`t1`", Ready: true})
+	status.SetReadiness(2, &TableReadiness{Table: "`test`.`t2`", Reason: "missing"})
+
+	clone := status.Clone()
+	status.Readiness[1].Ready = false
+	c.Assert(clone.Readiness[1].Ready, check.IsTrue)
+
+	data, err := clone.Marshal()
+	c.Assert(err, check.IsNil)
+	unmarshaled := &TaskStatus{}
+	c.Assert(unmarshaled.Unmarshal([]byte(data)), check.IsNil)
+	c.Assert(unmarshaled.Readiness, check.DeepEquals, clone.Readiness)
+
+	// the readiness is checked again when the table is added
+	clone.RemoveTable(1, 20)
+	clone.AddTable(1, &TableReplicaInfo{StartTs: 30}, 30)
+	clone.RemoveTable(2, 40)
+	c.Assert(clone.Readiness, check.HasLen, 0)
+}
+
+func (s *taskStatusSuite) TestForceAdvance(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &TaskStatus{}
+	status.AddTable(1, &TableReplicaInfo{StartTs: 10}, 10)
+	status.AddTable(2, &TableReplicaInfo{StartTs: 10}, 10)
+	status.ForceAdvanceTable(1, 100)
+	status.ForceAdvanceTable(2, 200)
+	c.Assert(status.ForceAdvance[1], check.DeepEquals, &TableForceAdvance{TargetTs: 100, Status: OperDispatched})
+
+	clone := status.Clone()
+	status.ForceAdvance[1].Status = OperFinished
+	status.ForceAdvance[1].Error = &RunningError{Message: "table not found"}
+	c.Assert(clone.ForceAdvance[1].Status, check.Equals, OperDispatched)
+	c.Assert(status.Clone().ForceAdvance[1].Error, check.Not(check.Equals), status.ForceAdvance[1].Error)
+
+	data, err := status.Marshal()
+	c.Assert(err, check.IsNil)
+	unmarshaled := &TaskStatus{}
+	c.Assert(unmarshaled.Unmarshal([]byte(data)), check.IsNil)
+	c.Assert(unmarshaled.ForceAdvance, check.DeepEquals, status.ForceAdvance)
+
+	// the operations are discarded once the tables are moved, adding an
+	// existing table keeps the operation
+	clone.RemoveTable(1, 20)
+	clone.AddTable(2, &TableReplicaInfo{StartTs: 30}, 30)
+	c.Assert(clone.ForceAdvance, check.HasLen, 1)
+	clone.RemoveTable(2, 40)
+	c.Assert(clone.ForceAdvance, check.HasLen, 0)
+}
+
 type removeTableSuite struct{}
 
 var _ = check.Suite(&removeTableSuite{})
@@ -15,6 +15,7 @@ package model
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/pingcap/log"
 
@@ -81,14 +82,26 @@ func WrapTableInfo(schemaID int64, schemaName string, version uint64, info *mode
 		rowColFieldTps:   make(map[int64]*types.FieldType, len(info.Columns)),
 	}
 
+	// The columns of the row changed events are arranged in the ordinal order of
+	// the table (e.g. after `ADD COLUMN ... AFTER`), which is indicated by the
+	// offset of the columns, rather than the order they are stored in.
+	ordinalCols := make([]*model.ColumnInfo, len(ti.Columns))
+	copy(ordinalCols, ti.Columns)
+	sort.SliceStable(ordinalCols, func(i, j int) bool {
+		return ordinalCols[i].Offset < ordinalCols[j].Offset
+	})
 	rowColumnsCurrentOffset := 0
+	for _, col := range ordinalCols {
+		if IsColCDCVisible(col) {
+			ti.RowColumnsOffset[col.ID] = rowColumnsCurrentOffset
+			rowColumnsCurrentOffset++
+		}
+	}
 
 	for i, col := range ti.Columns {
 		ti.columnsOffset[col.ID] = i
 		pkIsHandle := false
 		if IsColCDCVisible(col) {
-			ti.RowColumnsOffset[col.ID] = rowColumnsCurrentOffset
-			rowColumnsCurrentOffset++
 			pkIsHandle = (ti.PKIsHandle && mysql.HasPriKeyFlag(col.Flag)) || col.ID == model.ExtraHandleID
 			if pkIsHandle {
 				// pk is handle
@@ -305,17 +318,24 @@ func (ti *TableInfo) ExistTableUniqueColumn() bool {
 	return len(ti.uniqueColumns) != 0
 }
 
-// IsEligible returns whether the table is a eligible table
+// IsEligible returns whether the table is a eligible table, the views and
+// the sequences are eligible so that their DDLs are replicated
 func (ti *TableInfo) IsEligible(forceReplicate bool) bool {
 	if forceReplicate {
 		return true
 	}
-	if ti.IsView() {
+	if ti.IsView() || ti.IsSequence() {
 		return true
 	}
 	return ti.ExistTableUniqueColumn()
 }
 
+// HasRows returns whether the table has rows to be replicated, the views and
+// the sequences have none, so they're never scheduled
+func (ti *TableInfo) HasRows() bool {
+	return !ti.IsView() && !ti.IsSequence()
+}
+
 // IsIndexUnique returns whether the index is unique
 func (ti *TableInfo) IsIndexUnique(indexInfo *model.IndexInfo) bool {
 	if indexInfo.Primary {
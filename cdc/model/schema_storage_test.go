@@ -440,3 +440,23 @@ func (s *schemaStorageSuite) TestTableInfoClone(c *check.C) {
 	cloned.SchemaID = 100
 	c.Assert(info.SchemaID, check.Equals, int64(10))
 }
+
+func (s *schemaStorageSuite) TestRowColumnsOffsetInOrdinalOrder(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the column `b` is added by `ADD COLUMN b AFTER a`, and it's still
+	// stored at the end of the columns
+	t := timodel.TableInfo{
+		Columns: []*timodel.ColumnInfo{
+			{ID: 1, Name: timodel.NewCIStr("a"), Offset: 0, State: timodel.StatePublic},
+			{ID: 2, Name: timodel.NewCIStr("c"), Offset: 2, State: timodel.StatePublic},
+			{ID: 3, Name: timodel.NewCIStr("b"), Offset: 1, State: timodel.StatePublic},
+			{ID: 4, Name: timodel.NewCIStr("d"), Offset: 3, State: timodel.StateWriteOnly},
+		},
+	}
+	info := WrapTableInfo(1, "test", 0, &t)
+	c.Assert(info.RowColumnsOffset, check.DeepEquals, map[int64]int{1: 0, 3: 1, 2: 2})
+	// the column infos can still be found by the ID
+	col, ok := info.GetColumnInfo(3)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(col.Name.O, check.Equals, "b")
+}
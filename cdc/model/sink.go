@@ -58,6 +58,13 @@ const (
 	NullableFlag
 	// UnsignedFlag means the column stores an unsigned integer
 	UnsignedFlag
+	// TiDBRowIDFlag means the column is the hidden _tidb_rowid of a table
+	// without primary key or not null unique key
+	TiDBRowIDFlag
+	// RecoveredFromKeyFlag means the column of a deleted row is recovered
+	// from the key encoding instead of the full pre-image, which happens if
+	// old value is disabled
+	RecoveredFromKeyFlag
 )
 
 // SetIsBinary sets BinaryFlag
@@ -180,6 +187,36 @@ func (b *ColumnFlagType) UnsetIsUnsigned() {
 	(*util.Flag)(b).Remove(util.Flag(UnsignedFlag))
 }
 
+// IsTiDBRowID shows whether TiDBRowIDFlag is set
+func (b *ColumnFlagType) IsTiDBRowID() bool {
+	return (*util.Flag)(b).HasAll(util.Flag(TiDBRowIDFlag))
+}
+
+// SetIsTiDBRowID sets TiDBRowIDFlag
+func (b *ColumnFlagType) SetIsTiDBRowID() {
+	(*util.Flag)(b).Add(util.Flag(TiDBRowIDFlag))
+}
+
+// UnsetIsTiDBRowID unsets TiDBRowIDFlag
+func (b *ColumnFlagType) UnsetIsTiDBRowID() {
+	(*util.Flag)(b).Remove(util.Flag(TiDBRowIDFlag))
+}
+
+// IsRecoveredFromKey shows whether RecoveredFromKeyFlag is set
+func (b *ColumnFlagType) IsRecoveredFromKey() bool {
+	return (*util.Flag)(b).HasAll(util.Flag(RecoveredFromKeyFlag))
+}
+
+// SetIsRecoveredFromKey sets RecoveredFromKeyFlag
+func (b *ColumnFlagType) SetIsRecoveredFromKey() {
+	(*util.Flag)(b).Add(util.Flag(RecoveredFromKeyFlag))
+}
+
+// UnsetIsRecoveredFromKey unsets RecoveredFromKeyFlag
+func (b *ColumnFlagType) UnsetIsRecoveredFromKey() {
+	(*util.Flag)(b).Remove(util.Flag(RecoveredFromKeyFlag))
+}
+
 // TableName represents name of a table, includes table name and schema name.
 type TableName struct {
 	Schema      string `toml:"db-name" json:"db-name"`
@@ -230,6 +267,10 @@ type RowChangedEvent struct {
 
 	// approximate size of this event, calculate by tikv proto bytes size
 	ApproximateSize int64
+
+	// Sampled indicates the end-to-end latency of the row is measured when
+	// the sink flushes it, which is decided by the processor.
+	Sampled bool `json:"-"`
 }
 
 // IsDelete returns true if the row is a delete event
@@ -276,19 +317,49 @@ func (r *RowChangedEvent) HandleKeyColumns() []*Column {
 	}
 
 	if len(pkeyCols) == 0 {
-		// TODO redact the message
-		log.Panic("Cannot find handle key columns, bug?", zap.Reflect("event", r))
+		log.Panic("Cannot find handle key columns, bug?", DefaultEventLogFormatter.Row("event", r))
 	}
 
 	return pkeyCols
 }
 
+// WithoutTiDBRowID returns a copy of the row without the hidden _tidb_rowid
+// column, the row itself is returned if it doesn't contain the column.
+func (r *RowChangedEvent) WithoutTiDBRowID() *RowChangedEvent {
+	cols, colsRemoved := removeTiDBRowIDColumn(r.Columns)
+	preCols, preColsRemoved := removeTiDBRowIDColumn(r.PreColumns)
+	if !colsRemoved && !preColsRemoved {
+		return r
+	}
+	row := *r
+	row.Columns = cols
+	row.PreColumns = preCols
+	return &row
+}
+
+// removeTiDBRowIDColumn removes the hidden _tidb_rowid column, which is
+// always the last column if exists.
+func removeTiDBRowIDColumn(cols []*Column) ([]*Column, bool) {
+	if len(cols) == 0 {
+		return cols, false
+	}
+	last := cols[len(cols)-1]
+	if last == nil || !last.Flag.IsTiDBRowID() {
+		return cols, false
+	}
+	return cols[:len(cols)-1], true
+}
+
 // Column represents a column value in row changed event
 type Column struct {
 	Name  string         `json:"name"`
 	Type  byte           `json:"type"`
 	Flag  ColumnFlagType `json:"flag"`
 	Value interface{}    `json:"value"`
+	// Charset is the charset of the string column whose value is decoded
+	// from it into UTF-8, e.g. gbk. It's empty if the value is the original
+	// bytes of the column.
+	Charset string `json:"charset,omitempty"`
 }
 
 // ColumnValueString returns the string representation of the column value
@@ -366,6 +437,9 @@ type DDLEvent struct {
 	PreTableInfo *SimpleTableInfo
 	Query        string
 	Type         model.ActionType
+	// IsBootstrap marks a synthetic DDL event which carries the full schema
+	// of a table, it's sent to help consumers learn the current table schema.
+	IsBootstrap bool
 }
 
 // FromJob fills the values of DDLEvent from DDL job
@@ -425,7 +499,32 @@ func (t *SingleTableTxn) Append(row *RowChangedEvent) {
 			zap.Uint64("startTs of txn", t.StartTs),
 			zap.Uint64("commitTs of txn", t.CommitTs),
 			zap.Any("table of txn", t.Table),
-			zap.Any("row", row))
+			DefaultEventLogFormatter.Row("row", row))
 	}
 	t.Rows = append(t.Rows, row)
 }
+
+// FlushResult is the result of flushing the rows to the downstream
+type FlushResult struct {
+	// CheckpointTs is the ts which all the rows are flushed to
+	CheckpointTs uint64
+	// FlushedRows is the number of the rows written to the downstream since
+	// the last flush
+	FlushedRows uint64
+	// FlushedBytes is the bytes written to the downstream since the last
+	// flush, which are the sizes of the messages for the MQ sinks, the sizes
+	// of the files for the cdclog sinks, and the approximate sizes of the
+	// rows for the others
+	FlushedBytes uint64
+}
+
+// Merge merges the flush result of another sink, the checkpoint ts of the
+// merged result is the smaller one.
+func (r FlushResult) Merge(other FlushResult) FlushResult {
+	if other.CheckpointTs < r.CheckpointTs {
+		r.CheckpointTs = other.CheckpointTs
+	}
+	r.FlushedRows += other.FlushedRows
+	r.FlushedBytes += other.FlushedBytes
+	return r
+}
@@ -56,6 +56,14 @@ func (s *columnFlagTypeSuite) TestSetFlag(c *check.C) {
 	c.Assert(flag.IsNullable(), check.IsTrue)
 	flag.UnsetIsNullable()
 	c.Assert(flag.IsNullable(), check.IsFalse)
+	flag.SetIsTiDBRowID()
+	c.Assert(flag.IsTiDBRowID(), check.IsTrue)
+	flag.UnsetIsTiDBRowID()
+	c.Assert(flag.IsTiDBRowID(), check.IsFalse)
+	flag.SetIsRecoveredFromKey()
+	c.Assert(flag.IsRecoveredFromKey(), check.IsTrue)
+	flag.UnsetIsRecoveredFromKey()
+	c.Assert(flag.IsRecoveredFromKey(), check.IsFalse)
 }
 
 func (s *columnFlagTypeSuite) TestFlagValue(c *check.C) {
@@ -67,6 +75,9 @@ func (s *columnFlagTypeSuite) TestFlagValue(c *check.C) {
 	c.Assert(UniqueKeyFlag, check.Equals, ColumnFlagType(0b10000))
 	c.Assert(MultipleKeyFlag, check.Equals, ColumnFlagType(0b100000))
 	c.Assert(NullableFlag, check.Equals, ColumnFlagType(0b1000000))
+	c.Assert(UnsignedFlag, check.Equals, ColumnFlagType(0b10000000))
+	c.Assert(TiDBRowIDFlag, check.Equals, ColumnFlagType(0b100000000))
+	c.Assert(RecoveredFromKeyFlag, check.Equals, ColumnFlagType(0b1000000000))
 }
 
 type commonDataStructureSuite struct{}
@@ -147,6 +158,34 @@ func (s *commonDataStructureSuite) TestRowChangedEventFuncs(c *check.C) {
 	c.Assert(insertRow.HandleKeyColumns(), check.DeepEquals, expectedHandleKeyCols)
 }
 
+func (s *commonDataStructureSuite) TestWithoutTiDBRowID(c *check.C) {
+	defer testleak.AfterTest(c)()
+	row := &RowChangedEvent{
+		Table: &TableName{Schema: "test", Table: "t1"},
+		Columns: []*Column{
+			{Name: "a", Value: 1},
+			{Name: "_tidb_rowid", Value: int64(10), Flag: TiDBRowIDFlag},
+		},
+		PreColumns: []*Column{
+			{Name: "a", Value: 2},
+			{Name: "_tidb_rowid", Value: int64(10), Flag: TiDBRowIDFlag},
+		},
+	}
+	stripped := row.WithoutTiDBRowID()
+	c.Assert(stripped.Columns, check.DeepEquals, []*Column{{Name: "a", Value: 1}})
+	c.Assert(stripped.PreColumns, check.DeepEquals, []*Column{{Name: "a", Value: 2}})
+	// the original row is not changed
+	c.Assert(row.Columns, check.HasLen, 2)
+	c.Assert(row.PreColumns, check.HasLen, 2)
+	c.Assert(stripped.WithoutTiDBRowID(), check.Equals, stripped)
+
+	deleteRow := &RowChangedEvent{
+		Table:      &TableName{Schema: "test", Table: "t1"},
+		PreColumns: []*Column{{Name: "a", Value: 2}, nil},
+	}
+	c.Assert(deleteRow.WithoutTiDBRowID(), check.Equals, deleteRow)
+}
+
 func (s *commonDataStructureSuite) TestColumnValueString(c *check.C) {
 	defer testleak.AfterTest(c)()
 	testCases := []struct {
@@ -233,3 +272,11 @@ func (s *commonDataStructureSuite) TestDDLEventFromJob(c *check.C) {
 	event.FromJob(job, nil)
 	c.Assert(event.PreTableInfo, check.IsNil)
 }
+
+func (s *commonDataStructureSuite) TestFlushResultMerge(c *check.C) {
+	defer testleak.AfterTest(c)()
+	result := FlushResult{CheckpointTs: 10}
+	result = result.Merge(FlushResult{CheckpointTs: 8, FlushedRows: 2, FlushedBytes: 20})
+	result = result.Merge(FlushResult{CheckpointTs: 9, FlushedRows: 1, FlushedBytes: 10})
+	c.Assert(result, check.DeepEquals, FlushResult{CheckpointTs: 8, FlushedRows: 3, FlushedBytes: 30})
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+const observerMetricsInterval = 5 * time.Second
+
+// changefeedObserver exports the checkpoint metrics of the running
+// changefeeds derived from their statuses in etcd. It's run by the observer
+// captures, so that the metrics are computed centrally without the owner.
+type changefeedObserver struct {
+	etcdClient kv.CDCEtcdClient
+	// observed are the changefeeds whose series are exported
+	observed map[model.ChangeFeedID]struct{}
+}
+
+func newChangefeedObserver(etcdClient kv.CDCEtcdClient) *changefeedObserver {
+	return &changefeedObserver{
+		etcdClient: etcdClient,
+		observed:   make(map[model.ChangeFeedID]struct{}),
+	}
+}
+
+// observe exports the metrics of the running changefeeds, the series of the
+// changefeeds which are stopped or removed are deleted.
+func (o *changefeedObserver) observe(ctx context.Context, now time.Time) error {
+	statuses, err := o.etcdClient.GetAllChangeFeedStatus(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	observed := make(map[model.ChangeFeedID]struct{}, len(statuses))
+	for id, status := range statuses {
+		switch status.AdminJobType {
+		case model.AdminStop, model.AdminRemove, model.AdminFinish:
+			continue
+		}
+		phyTs := oracle.ExtractPhysical(status.CheckpointTs)
+		observerCheckpointTsGauge.WithLabelValues(id).Set(float64(phyTs))
+		observerCheckpointTsLagGauge.WithLabelValues(id).Set(float64(oracle.GetPhysical(now)-phyTs) / 1e3)
+		observed[id] = struct{}{}
+	}
+	for id := range o.observed {
+		if _, ok := observed[id]; !ok {
+			o.drop(id)
+		}
+	}
+	o.observed = observed
+	return nil
+}
+
+func (o *changefeedObserver) drop(id model.ChangeFeedID) {
+	observerCheckpointTsGauge.DeleteLabelValues(id)
+	observerCheckpointTsLagGauge.DeleteLabelValues(id)
+}
+
+// close deletes all the series exported by the observer
+func (o *changefeedObserver) close() {
+	for id := range o.observed {
+		o.drop(id)
+	}
+	o.observed = make(map[model.ChangeFeedID]struct{})
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+)
+
+type observerSuite struct {
+	e       *embed.Etcd
+	etcdCli kv.CDCEtcdClient
+}
+
+var _ = check.Suite(&observerSuite{})
+
+func (s *observerSuite) SetUpTest(c *check.C) {
+	clientURL, e, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	s.e = e
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	s.etcdCli = kv.NewCDCEtcdClient(context.Background(), client)
+}
+
+func (s *observerSuite) TearDownTest(c *check.C) {
+	s.etcdCli.Close() //nolint:errcheck
+	s.e.Close()
+}
+
+func (s *observerSuite) TestObserveChangefeeds(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	now := time.Now()
+	checkpointTs := oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Minute)), 0)
+	err := s.etcdCli.PutAllChangeFeedStatus(ctx, map[model.ChangeFeedID]*model.ChangeFeedStatus{
+		"running": {CheckpointTs: checkpointTs},
+		"stopped": {CheckpointTs: checkpointTs, AdminJobType: model.AdminStop},
+	})
+	c.Assert(err, check.IsNil)
+
+	observer := newChangefeedObserver(s.etcdCli)
+	defer observer.close()
+	err = observer.observe(ctx, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(observer.observed, check.DeepEquals, map[model.ChangeFeedID]struct{}{"running": {}})
+	c.Assert(testutil.ToFloat64(observerCheckpointTsGauge.WithLabelValues("running")),
+		check.Equals, float64(oracle.ExtractPhysical(checkpointTs)))
+	c.Assert(testutil.ToFloat64(observerCheckpointTsLagGauge.WithLabelValues("running")), check.Equals, float64(60))
+	c.Assert(testutil.CollectAndCount(observerCheckpointTsLagGauge), check.Equals, 1)
+
+	// the series of the stopped changefeed are deleted
+	err = s.etcdCli.PutAllChangeFeedStatus(ctx, map[model.ChangeFeedID]*model.ChangeFeedStatus{
+		"running": {CheckpointTs: checkpointTs, AdminJobType: model.AdminStop},
+	})
+	c.Assert(err, check.IsNil)
+	err = observer.observe(ctx, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(observer.observed, check.HasLen, 0)
+	c.Assert(testutil.CollectAndCount(observerCheckpointTsGauge), check.Equals, 0)
+	c.Assert(testutil.CollectAndCount(observerCheckpointTsLagGauge), check.Equals, 0)
+}
+
+func queryChangefeedByHTTP(c *check.C, handler http.HandlerFunc, changefeedID string) *httptest.ResponseRecorder {
+	form := url.Values{APIOpVarChangefeedID: {changefeedID}}
+	req := httptest.NewRequest(http.MethodPost, "/capture/owner/changefeed/query", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func (s *observerSuite) TestObserverQueryChangefeed(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	checkpointTs := oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	for id, adminJobType := range map[model.ChangeFeedID]model.AdminJobType{
+		"running": model.AdminNone,
+		"stopped": model.AdminStop,
+	} {
+		info := &model.ChangeFeedInfo{
+			SinkURI:      "blackhole://",
+			State:        model.StateNormal,
+			AdminJobType: adminJobType,
+			Config:       config.GetDefaultReplicaConfig(),
+		}
+		err := s.etcdCli.SaveChangeFeedInfo(ctx, info, id)
+		c.Assert(err, check.IsNil)
+		err = s.etcdCli.PutAllChangeFeedStatus(ctx, map[model.ChangeFeedID]*model.ChangeFeedStatus{
+			id: {CheckpointTs: checkpointTs, AdminJobType: adminJobType},
+		})
+		c.Assert(err, check.IsNil)
+	}
+	runningInfo, err := s.etcdCli.GetChangeFeedInfo(ctx, "running")
+	c.Assert(err, check.IsNil)
+	runningStatus, _, err := s.etcdCli.GetChangeFeedStatus(ctx, "running")
+	c.Assert(err, check.IsNil)
+
+	// the owner runs the running changefeed in memory
+	owner := &Owner{
+		etcdClient: s.etcdCli,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"running": {id: "running", info: runningInfo, status: runningStatus},
+		},
+	}
+	ownerServer := &Server{owner: owner, capture: &Capture{
+		etcdClient: s.etcdCli,
+		info:       &model.CaptureInfo{ID: "capture-owner"},
+	}}
+	observerServer := &Server{capture: &Capture{
+		etcdClient: s.etcdCli,
+		info:       &model.CaptureInfo{ID: "capture-observer", Observer: true},
+	}}
+
+	for _, id := range []model.ChangeFeedID{"running", "stopped", "not-exist"} {
+		ownerResp := queryChangefeedByHTTP(c, ownerServer.handleChangefeedQuery, id)
+		c.Assert(ownerResp.Code, check.Equals, http.StatusOK)
+		observerResp := queryChangefeedByHTTP(c, observerServer.handleChangefeedQuery, id)
+		c.Assert(observerResp.Code, check.Equals, http.StatusOK)
+		c.Assert(observerResp.Body.String(), check.Equals, ownerResp.Body.String(), check.Commentf("changefeed %s", id))
+	}
+	var resp ChangefeedResp
+	err = json.Unmarshal(queryChangefeedByHTTP(c, observerServer.handleChangefeedQuery, "stopped").Body.Bytes(), &resp)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.FeedState, check.Equals, string(model.StateStopped))
+	c.Assert(resp.TSO, check.Equals, checkpointTs)
+
+	// the captures which are neither the owner nor the observers don't answer
+	captureServer := &Server{capture: &Capture{
+		etcdClient: s.etcdCli,
+		info:       &model.CaptureInfo{ID: "capture-normal"},
+	}}
+	rec := queryChangefeedByHTTP(c, captureServer.handleChangefeedQuery, "running")
+	c.Assert(rec.Code, check.Not(check.Equals), http.StatusOK)
+}
@@ -19,6 +19,8 @@ import (
 	"io"
 	"math"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,6 +32,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
 	"github.com/pingcap/ticdc/pkg/cyclic/mark"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/filter"
@@ -43,6 +46,7 @@ import (
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.etcd.io/etcd/mvcc"
+	"go.etcd.io/etcd/mvcc/mvccpb"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
@@ -86,6 +90,18 @@ type Owner struct {
 	manualScheduleCommand     map[model.ChangeFeedID][]*model.MoveTableJob
 	rebalanceMu               sync.Mutex
 
+	schemaBootstrapCommand map[model.ChangeFeedID][]model.TableID
+	schemaBootstrapMu      sync.Mutex
+
+	skipDDLCommand map[model.ChangeFeedID][]int64
+	skipDDLMu      sync.Mutex
+
+	breakerCommand map[model.ChangeFeedID][]breakerReset
+	breakerMu      sync.Mutex
+
+	budgetCommand map[model.ChangeFeedID][]budgetUpdate
+	budgetMu      sync.Mutex
+
 	cfRWriter ChangeFeedRWriter
 
 	l sync.RWMutex
@@ -107,10 +123,35 @@ type Owner struct {
 	gcTTL int64
 	// last update gc safepoint time. zero time means has not updated or cleared
 	gcSafepointLastUpdate time.Time
+	// gcSafepointHolder is the changefeed with the minimum checkpoint ts,
+	// which holds the gc safepoint.
+	gcSafepointHolder model.ChangeFeedID
+	// gcSafepoint is the last service gc safepoint pushed to PD, and
+	// pdMinGCSafepoint is the minimal service gc safepoint returned by PD.
+	gcSafepoint      uint64
+	pdMinGCSafepoint uint64
 	// record last time that flushes all changefeeds' replication status
 	lastFlushChangefeeds    time.Time
 	flushChangefeedInterval time.Duration
 	feedChangeNotifier      *notify.Notifier
+	// pauseTimeout is the max time to wait for the sinks to be flushed when
+	// pausing a changefeed.
+	pauseTimeout time.Duration
+
+	history *historyRecorder
+	// ownerChangeRecorded indicates whether the owner change event is
+	// recorded in the history of the existing changefeeds.
+	ownerChangeRecorded bool
+
+	// notifier notifies the webhooks of the state transitions and the lag of
+	// the changefeeds, nil means no webhook.
+	notifier *webhookNotifier
+	// stateMetrics exports the state of the changefeeds and the table num of
+	// their processors
+	stateMetrics *changefeedStateMetrics
+	// lastFinishedFeedsLoad is the last time the finished changefeeds are
+	// loaded from the changefeed status for stateMetrics
+	lastFinishedFeedsLoad time.Time
 }
 
 const (
@@ -118,6 +159,12 @@ const (
 	CDCServiceSafePointID = "ticdc"
 	// GCSafepointUpdateInterval is the minimual interval that CDC can update gc safepoint
 	GCSafepointUpdateInterval = time.Duration(2 * time.Second)
+
+	defaultPauseTimeout = 30 * time.Second
+
+	// finishedFeedsLoadInterval is the interval to load the finished
+	// changefeeds from the changefeed status
+	finishedFeedsLoadInterval = time.Minute
 )
 
 // NewOwner creates a new Owner instance
@@ -143,18 +190,31 @@ func NewOwner(
 		captures:                make(map[model.CaptureID]*model.CaptureInfo),
 		rebalanceTigger:         make(map[model.ChangeFeedID]bool),
 		manualScheduleCommand:   make(map[model.ChangeFeedID][]*model.MoveTableJob),
+		schemaBootstrapCommand:  make(map[model.ChangeFeedID][]model.TableID),
+		skipDDLCommand:          make(map[model.ChangeFeedID][]int64),
+		breakerCommand:          make(map[model.ChangeFeedID][]breakerReset),
+		budgetCommand:           make(map[model.ChangeFeedID][]budgetUpdate),
 		pdEndpoints:             endpoints,
 		cfRWriter:               cli,
 		etcdClient:              cli,
 		gcTTL:                   gcTTL,
 		flushChangefeedInterval: flushChangefeedInterval,
 		feedChangeNotifier:      new(notify.Notifier),
+		pauseTimeout:            defaultPauseTimeout,
+		history:                 newHistoryRecorder(util.CaptureAddrFromCtx(ctx)),
+		stateMetrics:            newChangefeedStateMetrics(),
 	}
 
 	return owner, nil
 }
 
 func (o *Owner) addCapture(info *model.CaptureInfo) {
+	// the observers are never scheduled any table
+	if info.Observer {
+		log.Info("ignore the observer capture",
+			zap.String("capture-id", info.ID), zap.String("capture", info.AdvertiseAddr))
+		return
+	}
 	o.l.Lock()
 	o.captures[info.ID] = info
 	o.l.Unlock()
@@ -164,6 +224,9 @@ func (o *Owner) addCapture(info *model.CaptureInfo) {
 }
 
 func (o *Owner) removeCapture(info *model.CaptureInfo) {
+	if info.Observer {
+		return
+	}
 	o.l.Lock()
 	defer o.l.Unlock()
 
@@ -255,6 +318,14 @@ func (o *Owner) newChangeFeed(
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	tableStartTs, err := newTableStartTsMatcher(info.Config, info.GetStartTs())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	partitionPolicy, err := newPartitionPolicyMatcher(info.Config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	if info.Engine == model.SortInFile {
 		err = os.MkdirAll(info.SortDir, 0o755)
@@ -298,6 +369,12 @@ func (o *Owner) newChangeFeed(
 	tables := make(map[model.TableID]model.TableName)
 	partitions := make(map[model.TableID][]int64)
 	orphanTables := make(map[model.TableID]model.Ts)
+	bootstrapTables := make(map[model.TableID]struct{})
+	schemaBootstrap := info.Config.Sink.SchemaBootstrap
+	if schemaBootstrap && !sink.IsMQSinkURI(info.SinkURI) {
+		log.Warn("schema bootstrap is only supported by MQ sinks, ignore it", zap.String("changefeed", id))
+		schemaBootstrap = false
+	}
 	sinkTableInfo := make([]*model.SimpleTableInfo, len(schemaSnap.CloneTables()))
 	j := 0
 	for tid, table := range schemaSnap.CloneTables() {
@@ -330,6 +407,10 @@ func (o *Owner) newChangeFeed(
 			log.Warn("skip ineligible table", zap.Int64("tid", tid), zap.Stringer("table", table))
 			continue
 		}
+		if !tblInfo.HasRows() {
+			log.Debug("skip the view or the sequence", zap.Int64("tid", tid), zap.Stringer("table", table))
+			continue
+		}
 		// `existingTables` are tables dispatched to a processor, however the
 		// capture that this processor belongs to could have crashed or exited.
 		// So we check this before task dispatching, but after the update of
@@ -338,6 +419,9 @@ func (o *Owner) newChangeFeed(
 			log.Info("ignore known table", zap.Int64("tid", tid), zap.Stringer("table", table), zap.Uint64("ts", ts))
 			continue
 		}
+		if schemaBootstrap {
+			bootstrapTables[tid] = struct{}{}
+		}
 		if pi := tblInfo.GetPartitionInfo(); pi != nil {
 			delete(partitions, tid)
 			for _, partition := range pi.Definitions {
@@ -347,10 +431,10 @@ func (o *Owner) newChangeFeed(
 					log.Info("ignore known table partition", zap.Int64("tid", tid), zap.Int64("partitionID", id), zap.Stringer("table", table), zap.Uint64("ts", ts))
 					continue
 				}
-				orphanTables[id] = checkpointTs
+				orphanTables[id] = tableStartTs.adjust(table, checkpointTs)
 			}
 		} else {
-			orphanTables[tid] = checkpointTs
+			orphanTables[tid] = tableStartTs.adjust(table, checkpointTs)
 		}
 
 		sinkTableInfo[j-1] = new(model.SimpleTableInfo)
@@ -393,6 +477,13 @@ func (o *Owner) newChangeFeed(
 		log.Error("error on running owner", zap.Error(err))
 	}
 
+	// the DDLs of the views and the sequences re-pulled after an owner switch
+	// are not recorded in the history again
+	_, history, err := o.etcdClient.GetChangeFeedHistory(ctx, id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	var syncpointStore sink.SyncpointStore
 	if info.SyncPointEnabled {
 		syncpointStore, err = sink.NewSyncpointStore(ctx, id, info.SinkURI)
@@ -416,6 +507,7 @@ func (o *Owner) newChangeFeed(
 			CheckpointTs: checkpointTs,
 		},
 		scheduler:         scheduler.NewScheduler(info.Config.Scheduler.Tp),
+		localityResolver:  newLocalityResolver(o.pdClient, info.Config.Scheduler),
 		ddlState:          model.ChangeFeedSyncDML,
 		ddlExecutedTs:     checkpointTs,
 		targetTs:          info.GetTargetTs(),
@@ -427,9 +519,19 @@ func (o *Owner) newChangeFeed(
 		taskStatus:        processorsInfos,
 		taskPositions:     taskPositions,
 		etcdCli:           o.etcdClient,
+		statusWriter:      o.etcdClient,
 		filter:            filter,
+		tableStartTs:      tableStartTs,
+		partitionPolicy:   partitionPolicy,
 		sink:              primarySink,
 		cyclicEnabled:     info.Config.Cyclic.IsEnabled(),
+		schemaBootstrap:   schemaBootstrap,
+		bootstrapTables:   bootstrapTables,
+		lastBootstrapTime: make(map[model.TableID]time.Time),
+		ddlRateLimiter:    newDDLRateLimiter(info.Config.MaxDDLPerMinute),
+		skipDDLJobs:       make(map[int64]struct{}),
+		history:           o.history,
+		objectDDLSkipTs:   lastObjectDDLSkipTs(history),
 		lastRebalanceTime: time.Now(),
 		cancel:            cancel,
 	}
@@ -448,7 +550,7 @@ func (o *Owner) checkAndCleanTasksInfo(ctx context.Context) error {
 	for changefeedID := range details {
 		_, err := o.cfRWriter.GetAllTaskStatus(ctx, changefeedID)
 		if err != nil {
-			if cerror.ErrDecodeFailed.NotEqual(err) {
+			if cerror.ErrEtcdValueCorrupted.NotEqual(err) {
 				return errors.Trace(err)
 			}
 			err := o.cfRWriter.RemoveAllTaskStatus(ctx, changefeedID)
@@ -469,18 +571,56 @@ func (o *Owner) loadChangeFeeds(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	o.updateStateMetrics(details)
+	if err := o.loadFinishedFeeds(ctx, details); err != nil {
+		return errors.Trace(err)
+	}
+	if !o.ownerChangeRecorded {
+		for changeFeedID := range details {
+			o.history.record(changeFeedID, model.ChangefeedEventOwnerChange, 0, "", "the owner is changed")
+		}
+		o.ownerChangeRecorded = true
+	}
 	errorFeeds := make(map[model.ChangeFeedID]*model.RunningError)
 	for changeFeedID, cfInfoRawValue := range details {
-		taskStatus, err := o.cfRWriter.GetAllTaskStatus(ctx, changeFeedID)
-		if err != nil {
-			return err
-		}
-		taskPositions, err := o.cfRWriter.GetAllTaskPositions(ctx, changeFeedID)
+		// the task status and the task positions are read at the same revision,
+		// and the task positions of the expired captures are excluded, otherwise
+		// the resolved ts may be calculated from a stale view of the processors
+		_, taskStatus, taskPositions, err := o.cfRWriter.GetProcessorInfosOfLiveCaptures(ctx, changeFeedID)
 		if err != nil {
-			return err
+			if cerror.ErrEtcdValueCorrupted.NotEqual(err) {
+				return err
+			}
+			// a corrupted task status stops the changefeed rather than the owner
+			log.Error("the task status of the changefeed is corrupted",
+				zap.String("changefeed", changeFeedID), zap.Error(err))
+			if _, exist := o.changeFeeds[changeFeedID]; exist {
+				errorFeeds[changeFeedID] = &model.RunningError{
+					Addr:    util.CaptureAddrFromCtx(ctx),
+					Code:    string(cerror.ErrEtcdValueCorrupted.RFCCode()),
+					Message: err.Error(),
+				}
+			}
+			continue
 		}
 		if cf, exist := o.changeFeeds[changeFeedID]; exist {
+			// a processor may record a dirty stop when its task is deleted
+			taskDeleted := false
+			for captureID := range cf.taskStatus {
+				if _, ok := taskStatus[captureID]; !ok {
+					taskDeleted = true
+					break
+				}
+			}
 			cf.updateProcessorInfos(taskStatus, taskPositions)
+			cf.status.LargeTxns = cf.largeTxns()
+			cf.status.BudgetWarnings = cf.budgetWarnings()
+			cf.status.StuckOperations = cf.stuckOperations(time.Now())
+			if taskDeleted {
+				if err := o.mergeDirtyStops(ctx, cf); err != nil {
+					return errors.Trace(err)
+				}
+			}
 			for _, pos := range taskPositions {
 				// TODO: only record error of one capture,
 				// is it necessary to record all captures' error
@@ -576,11 +716,14 @@ func (o *Owner) loadChangeFeeds(ctx context.Context) error {
 			if filter.ChangefeedFastFailError(err) {
 				log.Error("create changefeed with fast fail error, mark changefeed as failed",
 					zap.Error(err), zap.String("changefeed", changeFeedID))
+				o.history.record(changeFeedID, model.ChangefeedEventError, checkpointTs, "",
+					"changefeed is failed: %s", err)
 				cfInfo.State = model.StateFailed
 				err := o.etcdClient.SaveChangeFeedInfo(ctx, cfInfo, changeFeedID)
 				if err != nil {
 					return err
 				}
+				o.notifier.notify(changeFeedID, cfInfo, NotifyEventFailed, cfInfo.State, cfInfo.Error, checkpointTs)
 				continue
 			}
 
@@ -592,6 +735,9 @@ func (o *Owner) loadChangeFeeds(ctx context.Context) error {
 			// don't need to return an error.
 			log.Warn("create changefeed failed, retry later",
 				zap.String("changefeed", changeFeedID), zap.Error(err))
+			o.history.record(changeFeedID, model.ChangefeedEventError, checkpointTs, "",
+				"failed to create changefeed: %s", err)
+			o.notifier.notify(changeFeedID, cfInfo, NotifyEventError, cfInfo.State, cfInfo.Error, checkpointTs)
 			continue
 		}
 
@@ -607,8 +753,25 @@ func (o *Owner) loadChangeFeeds(ctx context.Context) error {
 			log.Info("syncpoint is off")
 		}
 
+		if status != nil {
+			// the DDLs not supported by the downstream are kept across the
+			// restarts of the changefeed
+			newCf.status.SkippedDDLs = status.SkippedDDLs
+			newCf.status.PausedDDL = status.PausedDDL
+			// the pause in progress when the owner is changed is finished by
+			// the new owner
+			newCf.status.Pausing = status.Pausing
+			newCf.restoreBreaker(status)
+			newCf.restoreExecutingDDL(status.ExecutingDDL)
+		}
 		o.changeFeeds[changeFeedID] = newCf
 		delete(o.stoppedFeeds, changeFeedID)
+		o.stateMetrics.setState(changeFeedID, newCf.info, changefeedMetricStateNormal)
+		// the processors stopped while the changefeed was paused or the owner
+		// was changed may have recorded dirty stops
+		if err := o.mergeDirtyStops(ctx, newCf); err != nil {
+			return errors.Trace(err)
+		}
 	}
 	o.adminJobsLock.Lock()
 	for cfID, err := range errorFeeds {
@@ -623,6 +786,74 @@ func (o *Owner) loadChangeFeeds(ctx context.Context) error {
 	return nil
 }
 
+// updateStateMetrics exports the state of the changefeeds in details, which
+// reflects the transitions in the last tick, and deletes the series of the
+// changefeeds which are removed.
+func (o *Owner) updateStateMetrics(details map[model.ChangeFeedID]*mvccpb.KeyValue) {
+	if o.stateMetrics == nil {
+		return
+	}
+	alive := make(map[model.ChangeFeedID]struct{}, len(details))
+	for changeFeedID, cfInfoRawValue := range details {
+		alive[changeFeedID] = struct{}{}
+		if cf, ok := o.changeFeeds[changeFeedID]; ok {
+			state := changefeedMetricStateNormal
+			var stuckOperations int
+			if cf.status != nil {
+				stuckOperations = len(cf.status.StuckOperations)
+			}
+			if o.notifier.isLagging(changeFeedID) || (cf.status != nil && len(cf.status.BudgetWarnings) != 0) || stuckOperations != 0 {
+				state = changefeedMetricStateWarning
+			}
+			o.stateMetrics.setState(changeFeedID, cf.info, state)
+			o.stateMetrics.setTables(changeFeedID, cf.taskStatus, o.captures)
+			o.stateMetrics.setStuckOperations(changeFeedID, stuckOperations)
+			o.stateMetrics.setInitialScanFinished(changeFeedID, cf.status != nil && cf.status.InitialScanFinished != nil)
+			continue
+		}
+		o.stateMetrics.dropTables(changeFeedID)
+		cfInfo := &model.ChangeFeedInfo{}
+		if err := cfInfo.Unmarshal(cfInfoRawValue.Value); err != nil {
+			log.Warn("unmarshal changefeed info failed", zap.String("changefeed", changeFeedID), zap.Error(err))
+			continue
+		}
+		state := changefeedMetricStateNormal
+		_, stopped := o.stoppedFeeds[changeFeedID]
+		switch {
+		case cfInfo.State == model.StateFailed:
+			state = changefeedMetricStateFailed
+		case cfInfo.Error != nil:
+			state = changefeedMetricStateError
+		case stopped:
+			state = changefeedMetricStateStopped
+		}
+		o.stateMetrics.setState(changeFeedID, cfInfo, state)
+	}
+	o.stateMetrics.retain(alive)
+}
+
+// loadFinishedFeeds exports the finished changefeeds recorded in the
+// changefeed status, whose info is deleted, it's done every
+// finishedFeedsLoadInterval.
+func (o *Owner) loadFinishedFeeds(ctx context.Context, details map[model.ChangeFeedID]*mvccpb.KeyValue) error {
+	if o.stateMetrics == nil || time.Since(o.lastFinishedFeedsLoad) < finishedFeedsLoadInterval {
+		return nil
+	}
+	statuses, err := o.etcdClient.GetAllChangeFeedStatus(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	finished := make(map[model.ChangeFeedID]struct{})
+	for changeFeedID, status := range statuses {
+		if _, ok := details[changeFeedID]; !ok && status.AdminJobType == model.AdminFinish {
+			finished[changeFeedID] = struct{}{}
+		}
+	}
+	o.stateMetrics.syncFinished(finished)
+	o.lastFinishedFeedsLoad = time.Now()
+	return nil
+}
+
 func (o *Owner) balanceTables(ctx context.Context) error {
 	rebalanceForAllChangefeed := false
 	o.rebalanceMu.Lock()
@@ -655,28 +886,65 @@ func (o *Owner) balanceTables(ctx context.Context) error {
 	return nil
 }
 
-func (o *Owner) flushChangeFeedInfos(ctx context.Context) error {
-	// no running or stopped changefeed, clear gc safepoint.
-	if len(o.changeFeeds) == 0 && len(o.stoppedFeeds) == 0 {
-		if !o.gcSafepointLastUpdate.IsZero() {
-			log.Info("clean service safe point", zap.String("service-id", CDCServiceSafePointID))
-			_, err := o.pdClient.UpdateServiceGCSafePoint(ctx, CDCServiceSafePointID, 0, 0)
-			if err != nil {
-				log.Warn("failed to update service safe point", zap.Error(err))
-			} else {
-				o.gcSafepointLastUpdate = time.Time{}
-			}
-		}
+// mergeDirtyStops merges the dirty stops recorded by the processors of the
+// changefeed into the changefeed status, and deletes them from etcd once the
+// status is saved.
+func (o *Owner) mergeDirtyStops(ctx context.Context, cf *changeFeed) error {
+	stops, err := o.etcdClient.GetDirtyStops(ctx, cf.id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(stops) == 0 {
 		return nil
 	}
+	sorted := make([]*model.DirtyStop, 0, len(stops))
+	for _, stop := range stops {
+		sorted = append(sorted, stop)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	for _, stop := range sorted {
+		log.Warn("the processor is stopped without its sink closed, the events after the checkpoint may be written to the downstream again",
+			zap.String("changefeed", cf.id), zap.String("capture", stop.CaptureID),
+			zap.Uint64("checkpointTs", stop.CheckpointTs), zap.String("reason", stop.Reason))
+		o.history.record(cf.id, model.ChangefeedEventDirtyStop, stop.CheckpointTs, "",
+			"the processor on capture %s is stopped without its sink closed: %s", stop.CaptureID, stop.Reason)
+	}
+	cf.status.AddDirtyStops(sorted...)
+	err = o.cfRWriter.PutAllChangeFeedStatus(ctx, map[model.ChangeFeedID]*model.ChangeFeedStatus{cf.id: cf.status})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(o.etcdClient.DeleteDirtyStops(ctx, cf.id, stops))
+}
+
+// onInitialScanFinished logs, records and notifies the initial scan milestone
+// of the changefeed
+func (o *Owner) onInitialScanFinished(cf *changeFeed) {
+	milestone := cf.status.InitialScanFinished
+	log.Info("the changefeed finished the initial scan",
+		zap.String("changefeed", cf.id), zap.Uint64("checkpointTs", milestone.CheckpointTs))
+	o.history.record(cf.id, model.ChangefeedEventInitialScanFinished, milestone.CheckpointTs, "",
+		"all tables finished the incremental scan and the checkpoint lag stayed under %s for %s",
+		initialScanLagThreshold, initialScanSteadyPeriod)
+	o.notifier.notify(cf.id, cf.info, NotifyEventInitialScanFinished, cf.info.State, nil, milestone.CheckpointTs)
+}
+
+// serviceSafePointID returns the service GC safe point ID of the TiCDC cluster
+func (o *Owner) serviceSafePointID() string {
+	return util.ServiceSafePointID(CDCServiceSafePointID, o.etcdClient.ClusterID)
+}
 
-	minCheckpointTs := uint64(math.MaxUint64)
+func (o *Owner) flushChangeFeedInfos(ctx context.Context) error {
 	if len(o.changeFeeds) > 0 {
 		snapshot := make(map[model.ChangeFeedID]*model.ChangeFeedStatus, len(o.changeFeeds))
+		// the initial scan milestone is saved immediately, so that it's
+		// notified once even if the owner changes
+		milestoneReached := false
 		for id, changefeed := range o.changeFeeds {
 			snapshot[id] = changefeed.status
-			if changefeed.status.CheckpointTs < minCheckpointTs {
-				minCheckpointTs = changefeed.status.CheckpointTs
+			if changefeed.checkInitialScan(time.Now()) {
+				milestoneReached = true
+				o.onInitialScanFinished(changefeed)
 			}
 
 			phyTs := oracle.ExtractPhysical(changefeed.status.CheckpointTs)
@@ -684,8 +952,9 @@ func (o *Owner) flushChangeFeedInfos(ctx context.Context) error {
 			// It is more accurate to get tso from PD, but in most cases we have
 			// deployed NTP service, a little bias is acceptable here.
 			changefeedCheckpointTsLagGauge.WithLabelValues(id).Set(float64(oracle.GetPhysical(time.Now())-phyTs) / 1e3)
+			o.notifier.checkLag(id, changefeed.info, changefeed.status.CheckpointTs, time.Now())
 		}
-		if time.Since(o.lastFlushChangefeeds) > o.flushChangefeedInterval {
+		if milestoneReached || time.Since(o.lastFlushChangefeeds) > o.flushChangefeedInterval {
 			err := o.cfRWriter.PutAllChangeFeedStatus(ctx, snapshot)
 			if err != nil {
 				return errors.Trace(err)
@@ -693,22 +962,107 @@ func (o *Owner) flushChangeFeedInfos(ctx context.Context) error {
 			o.lastFlushChangefeeds = time.Now()
 		}
 	}
-	for _, status := range o.stoppedFeeds {
-		if status.CheckpointTs < minCheckpointTs {
-			minCheckpointTs = status.CheckpointTs
+	if err := o.updateGCSafepoint(ctx, false /* force */); err != nil {
+		log.Warn("failed to update service safe point", zap.Error(err))
+	}
+	return nil
+}
+
+// minCheckpointTs returns the minimum checkpoint ts of the running and stopped
+// changefeeds, and the changefeed holding it. The tables paused by the circuit
+// breaker hold the ts they're paused at. ok is false if there's no changefeed.
+func (o *Owner) minCheckpointTs() (ts model.Ts, holder model.ChangeFeedID, ok bool) {
+	ts = uint64(math.MaxUint64)
+	for id, changefeed := range o.changeFeeds {
+		if retainedTs := changefeed.status.MinRetainedTs(); retainedTs < ts {
+			ts = retainedTs
+			holder = id
+		}
+	}
+	for id, status := range o.stoppedFeeds {
+		if retainedTs := status.MinRetainedTs(); retainedTs < ts {
+			ts = retainedTs
+			holder = id
 		}
 	}
-	if time.Since(o.gcSafepointLastUpdate) > GCSafepointUpdateInterval {
-		_, err := o.pdClient.UpdateServiceGCSafePoint(ctx, CDCServiceSafePointID, o.gcTTL, minCheckpointTs)
+	return ts, holder, len(o.changeFeeds) > 0 || len(o.stoppedFeeds) > 0
+}
+
+// updateGCSafepoint pushes the minimum checkpoint ts of the changefeeds to PD
+// as the service gc safepoint, or clears the safepoint if there's no running
+// or stopped changefeed. The safepoint is pushed at most once in
+// GCSafepointUpdateInterval unless force is set.
+func (o *Owner) updateGCSafepoint(ctx context.Context, force bool) error {
+	minCheckpointTs, gcSafepointHolder, ok := o.minCheckpointTs()
+	if !ok {
+		if o.gcSafepointLastUpdate.IsZero() && !force {
+			return nil
+		}
+		log.Info("clean service safe point", zap.String("service-id", o.serviceSafePointID()))
+		pdMinGCSafepoint, err := o.pdClient.UpdateServiceGCSafePoint(ctx, o.serviceSafePointID(), 0, 0)
 		if err != nil {
-			log.Warn("failed to update service safe point", zap.Error(err))
-		} else {
-			o.gcSafepointLastUpdate = time.Now()
+			return errors.Trace(err)
 		}
+		o.gcSafepointLastUpdate = time.Time{}
+		o.gcSafepointHolder = ""
+		o.gcSafepoint = 0
+		o.pdMinGCSafepoint = pdMinGCSafepoint
+		return nil
+	}
+	if time.Since(o.gcSafepointLastUpdate) <= GCSafepointUpdateInterval && !force {
+		return nil
+	}
+	pdMinGCSafepoint, err := o.pdClient.UpdateServiceGCSafePoint(ctx, o.serviceSafePointID(), o.gcTTL, minCheckpointTs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	o.gcSafepointLastUpdate = time.Now()
+	o.gcSafepoint = minCheckpointTs
+	o.pdMinGCSafepoint = pdMinGCSafepoint
+	// only the change of the holder is recorded, to avoid flooding the history
+	if gcSafepointHolder != o.gcSafepointHolder {
+		o.history.record(gcSafepointHolder, model.ChangefeedEventGCSafePoint, minCheckpointTs, "",
+			"the service gc safepoint is held by the changefeed")
+		o.gcSafepointHolder = gcSafepointHolder
 	}
 	return nil
 }
 
+// gcSafepointResp returns the service gc safepoint last pushed to PD
+func (o *Owner) gcSafepointResp() *GCSafepointResp {
+	resp := &GCSafepointResp{
+		ServiceID:      o.serviceSafePointID(),
+		Safepoint:      o.gcSafepoint,
+		PDMinSafepoint: o.pdMinGCSafepoint,
+		Holder:         o.gcSafepointHolder,
+	}
+	if !o.gcSafepointLastUpdate.IsZero() {
+		resp.UpdateTime = o.gcSafepointLastUpdate.Format("2006-01-02 15:04:05.000")
+	}
+	return resp
+}
+
+// RefreshGCSafepoint pushes the service gc safepoint to PD immediately, and
+// returns the safepoint pushed.
+func (o *Owner) RefreshGCSafepoint(ctx context.Context) (*GCSafepointResp, error) {
+	o.l.Lock()
+	defer o.l.Unlock()
+	if err := o.updateGCSafepoint(ctx, true /* force */); err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Info("the service gc safepoint is refreshed manually",
+		zap.Uint64("safepoint", o.gcSafepoint), zap.Uint64("pdMinSafepoint", o.pdMinGCSafepoint),
+		zap.String("holder", o.gcSafepointHolder))
+	return o.gcSafepointResp(), nil
+}
+
+// GCSafepoint returns the service gc safepoint last pushed to PD
+func (o *Owner) GCSafepoint() *GCSafepointResp {
+	o.l.RLock()
+	defer o.l.RUnlock()
+	return o.gcSafepointResp()
+}
+
 // calcResolvedTs call calcResolvedTs of every changefeeds
 func (o *Owner) calcResolvedTs(ctx context.Context) error {
 	for _, cf := range o.changeFeeds {
@@ -721,8 +1075,28 @@ func (o *Owner) calcResolvedTs(ctx context.Context) error {
 
 // handleDDL call handleDDL of every changefeeds
 func (o *Owner) handleDDL(ctx context.Context) error {
-	for _, cf := range o.changeFeeds {
+	for id, cf := range o.changeFeeds {
+		o.skipDDLMu.Lock()
+		jobIDs := o.skipDDLCommand[id]
+		delete(o.skipDDLCommand, id)
+		o.skipDDLMu.Unlock()
+		for _, jobID := range jobIDs {
+			if !cf.skipDDLOnce(jobID) {
+				log.Warn("skip the DDL job not queued in changefeed, ignore it",
+					zap.String("changefeed", id), zap.Int64("jobID", jobID))
+			}
+		}
+		ddlQueueDepthGauge.WithLabelValues(id).Set(float64(len(cf.ddlJobHistory)))
 		err := cf.handleDDL(ctx, o.captures)
+		if cerror.ErrPausedOnUnsupportedDDL.Equal(err) || cerror.ErrPausedOnDDLTimeout.Equal(err) {
+			// the sinks are flushed at the DDL barrier, so the changefeed is
+			// paused cleanly at the checkpoint before the DDL
+			err = o.EnqueueJob(model.AdminJob{CfID: cf.id, Type: model.AdminStop})
+			if err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
 		if err != nil {
 			var code string
 			if terror, ok := err.(*errors.Error); ok {
@@ -747,6 +1121,23 @@ func (o *Owner) handleDDL(ctx context.Context) error {
 	return nil
 }
 
+// handleSchemaBootstrap call handleSchemaBootstrap of every changefeeds
+func (o *Owner) handleSchemaBootstrap(ctx context.Context) error {
+	for id, cf := range o.changeFeeds {
+		o.schemaBootstrapMu.Lock()
+		tableIDs := o.schemaBootstrapCommand[id]
+		delete(o.schemaBootstrapCommand, id)
+		o.schemaBootstrapMu.Unlock()
+		for _, tableID := range tableIDs {
+			cf.requestSchemaBootstrap(tableID)
+		}
+		if err := cf.handleSchemaBootstrap(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 // handleSyncPoint call handleSyncPoint of every changefeeds
 func (o *Owner) handleSyncPoint(ctx context.Context) error {
 	for _, cf := range o.changeFeeds {
@@ -768,6 +1159,14 @@ func (o *Owner) dispatchJob(ctx context.Context, job model.AdminJob) error {
 			taskStatus.AdminJobType = job.Type
 			return true, nil
 		})
+		if cerror.ErrEtcdValueCorrupted.Equal(err) {
+			// the processor is stopped anyway, the corrupted task status is
+			// overwritten so that the processor can exit.
+			log.Warn("overwrite the corrupted task status", zap.String("changefeed", cf.id),
+				zap.String("capture-id", captureID), zap.Error(err))
+			newStatus = &model.TaskStatus{AdminJobType: job.Type}
+			err = cf.etcdCli.PutTaskStatus(ctx, cf.id, captureID, newStatus)
+		}
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -788,6 +1187,7 @@ func (o *Owner) dispatchJob(ctx context.Context, job model.AdminJob) error {
 		o.stoppedFeeds[job.CfID] = cf.status
 	}
 	delete(o.changeFeeds, job.CfID)
+	ddlQueueDepthGauge.DeleteLabelValues(job.CfID)
 	return nil
 }
 
@@ -802,15 +1202,26 @@ func (o *Owner) collectChangefeedInfo(ctx context.Context, cid model.ChangeFeedI
 	if ok {
 		return cf, cf.status, cf.info.State, nil
 	}
+	status, feedState, err = collectChangefeedInfoFromEtcd(ctx, o.etcdClient, cid)
+	return
+}
+
+// collectChangefeedInfoFromEtcd returns the status and the state of the
+// changefeed derived from its info and status in etcd.
+func collectChangefeedInfoFromEtcd(ctx context.Context, etcdClient kv.CDCEtcdClient, cid model.ChangeFeedID) (
+	status *model.ChangeFeedStatus,
+	feedState model.FeedState,
+	err error,
+) {
 	feedState = model.StateNormal
 
 	var cfInfo *model.ChangeFeedInfo
-	cfInfo, err = o.etcdClient.GetChangeFeedInfo(ctx, cid)
+	cfInfo, err = etcdClient.GetChangeFeedInfo(ctx, cid)
 	if err != nil && cerror.ErrChangeFeedNotExists.NotEqual(err) {
 		return
 	}
 
-	status, _, err = o.etcdClient.GetChangeFeedStatus(ctx, cid)
+	status, _, err = etcdClient.GetChangeFeedStatus(ctx, cid)
 	if err != nil {
 		if cerror.ErrChangeFeedNotExists.Equal(err) {
 			// Only changefeed info exists and error field is not nil means
@@ -854,6 +1265,107 @@ func (o *Owner) checkClusterHealth(_ context.Context) error {
 	return nil
 }
 
+// stopChangefeed stops the changefeed by the AdminStop job
+func (o *Owner) stopChangefeed(ctx context.Context, cf *changeFeed, job model.AdminJob) error {
+	cf.status.Pausing = nil
+	cf.info.AdminJobType = model.AdminStop
+	cf.info.Error = job.Error
+	if job.Error != nil {
+		cf.info.ErrorHis = append(cf.info.ErrorHis, time.Now().UnixNano()/1e6)
+	}
+	err := o.etcdClient.SaveChangeFeedInfo(ctx, cf.info, job.CfID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = o.dispatchJob(ctx, job)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cf.stopSyncPointTicker()
+	o.notifier.forget(job.CfID)
+	o.stateMetrics.dropTables(job.CfID)
+	if job.Error != nil {
+		o.stateMetrics.setState(job.CfID, cf.info, changefeedMetricStateError)
+	} else {
+		o.stateMetrics.setState(job.CfID, cf.info, changefeedMetricStateStopped)
+	}
+	switch {
+	case job.Error != nil:
+		o.history.record(job.CfID, model.ChangefeedEventError, cf.status.CheckpointTs, job.Client,
+			"changefeed is stopped by error: [%s] %s", job.Error.Code, job.Error.Message)
+		o.notifier.notify(job.CfID, cf.info, NotifyEventError, model.StateStopped, job.Error, cf.status.CheckpointTs)
+	case cf.status.PausedDDL != nil:
+		o.history.record(job.CfID, model.ChangefeedEventPause, cf.status.CheckpointTs, job.Client,
+			"changefeed is paused on the DDL not supported by the downstream: %s", cf.status.PausedDDL.Query)
+	case cf.status.Pause != nil && !cf.status.Pause.Clean:
+		o.history.record(job.CfID, model.ChangefeedEventPause, cf.status.CheckpointTs, job.Client,
+			"changefeed is paused, but the sink is not flushed in time")
+	default:
+		o.history.record(job.CfID, model.ChangefeedEventPause, cf.status.CheckpointTs, job.Client,
+			"changefeed is paused")
+	}
+	return nil
+}
+
+// overwriteCheckpointTs sets the checkpoint ts of a paused changefeed to ts
+// before it's resumed. The task keys left by the processors are removed, so
+// all the tables are restarted from ts. If ts is before the checkpoint ts, the
+// rows between them are replayed, they are written in safe mode by the sink
+// since they may be written to the downstream already.
+func (o *Owner) overwriteCheckpointTs(ctx context.Context, id model.ChangeFeedID, info *model.ChangeFeedInfo, status *model.ChangeFeedStatus, ts uint64) error {
+	log.Info("overwrite the checkpoint ts of the changefeed", zap.String("changefeed", id),
+		zap.Uint64("checkpointTs", status.CheckpointTs), zap.Uint64("overwriteCheckpointTs", ts))
+	if ts < status.CheckpointTs {
+		safeModeTs := status.CheckpointTs
+		if s, ok := info.Opts[sink.OptSafeModeTs]; ok {
+			// the range replayed by the last overwrite may be not replicated yet
+			if prev, err := strconv.ParseUint(s, 10, 64); err == nil && prev > safeModeTs {
+				safeModeTs = prev
+			}
+		}
+		if info.Opts == nil {
+			info.Opts = make(map[string]string)
+		}
+		info.Opts[sink.OptSafeModeTs] = strconv.FormatUint(safeModeTs, 10)
+	}
+	status.CheckpointTs = ts
+	status.ResolvedTs = ts
+	if err := o.etcdClient.RemoveAllTaskStatus(ctx, id); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(o.etcdClient.RemoveAllTaskPositions(ctx, id))
+}
+
+// handlePausingChangefeeds stops the pausing changefeeds whose checkpoint have
+// reached the pause ts, or whose sinks are not flushed before the deadline.
+func (o *Owner) handlePausingChangefeeds(ctx context.Context) error {
+	for _, cf := range o.changeFeeds {
+		pausing := cf.status.Pausing
+		if pausing == nil {
+			continue
+		}
+		clean := cf.status.CheckpointTs >= pausing.PauseTs
+		if !clean {
+			if time.Now().Before(pausing.Deadline) {
+				continue
+			}
+			log.Warn("the sinks are not flushed in time, pause the changefeed anyway",
+				zap.String("changefeed", cf.id),
+				zap.Uint64("pauseTs", pausing.PauseTs),
+				zap.Uint64("checkpointTs", cf.status.CheckpointTs))
+		}
+		cf.status.Pause = &model.PauseInfo{PausedAtTs: cf.status.CheckpointTs, Clean: clean}
+		job := model.AdminJob{CfID: cf.id, Type: model.AdminStop, Client: pausing.Client}
+		if err := o.stopChangefeed(ctx, cf, job); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("changefeed is paused", zap.String("changefeed", cf.id),
+			zap.Uint64("pausedAtTs", cf.status.CheckpointTs), zap.Bool("clean", clean))
+	}
+	return nil
+}
+
 func (o *Owner) handleAdminJob(ctx context.Context) error {
 	removeIdx := 0
 	o.adminJobsLock.Lock()
@@ -899,23 +1411,35 @@ func (o *Owner) handleAdminJob(ctx context.Context) error {
 				log.Warn("invalid admin job, changefeed not found", zap.String("changefeed", job.CfID))
 				continue
 			}
-
-			cf.info.AdminJobType = model.AdminStop
-			cf.info.Error = job.Error
-			if job.Error != nil {
-				cf.info.ErrorHis = append(cf.info.ErrorHis, time.Now().UnixNano()/1e6)
-			}
-			err := o.etcdClient.SaveChangeFeedInfo(ctx, cf.info, job.CfID)
-			if err != nil {
-				return errors.Trace(err)
+			if job.Error == nil && job.Opts != nil && job.Opts.Graceful {
+				// a pause command stops the changefeed after the sinks are
+				// flushed, see handlePausingChangefeeds.
+				if cf.status.Pausing != nil {
+					log.Info("changefeed is being paused, pause command will do nothing")
+					continue
+				}
+				cf.status.Pausing = &model.PausingInfo{
+					PauseTs:  cf.status.ResolvedTs,
+					Deadline: time.Now().Add(o.pauseTimeout),
+					Client:   job.Client,
+				}
+				err := o.etcdClient.PutChangeFeedStatus(ctx, job.CfID, cf.status)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				log.Info("changefeed is pausing", zap.String("changefeed", job.CfID),
+					zap.Uint64("pauseTs", cf.status.ResolvedTs),
+					zap.Uint64("checkpointTs", cf.status.CheckpointTs))
+				continue
 			}
-
-			err = o.dispatchJob(ctx, job)
-			if err != nil {
+			if err := o.stopChangefeed(ctx, cf, job); err != nil {
 				return errors.Trace(err)
 			}
-			cf.stopSyncPointTicker()
 		case model.AdminRemove, model.AdminFinish:
+			o.notifier.forget(job.CfID)
+			if job.Type == model.AdminRemove {
+				o.stateMetrics.drop(job.CfID)
+			}
 			if cf != nil {
 				cf.stopSyncPointTicker()
 				err := o.dispatchJob(ctx, job)
@@ -952,18 +1476,45 @@ func (o *Owner) handleAdminJob(ctx context.Context) error {
 			if err != nil {
 				return errors.Trace(err)
 			}
+			err = o.etcdClient.RemoveAllCheckpointGuards(ctx, job.CfID)
+			if err != nil {
+				return errors.Trace(err)
+			}
 			if job.Opts != nil && job.Opts.ForceRemove {
 				// if `ForceRemove` is enabled, remove all information related to this changefeed
 				err := o.etcdClient.RemoveChangeFeedStatus(ctx, job.CfID)
 				if err != nil {
 					return errors.Trace(err)
 				}
+				o.history.discard(job.CfID)
+				err = o.etcdClient.DeleteChangeFeedHistory(ctx, job.CfID)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				err = o.etcdClient.RemoveAllDirtyStops(ctx, job.CfID)
+				if err != nil {
+					return errors.Trace(err)
+				}
 			} else {
 				// set ttl to changefeed status
 				err = o.etcdClient.SetChangeFeedStatusTTL(ctx, job.CfID, 24*3600 /*24 hours*/)
 				if err != nil {
 					return errors.Trace(err)
 				}
+				if job.Type == model.AdminFinish {
+					o.stateMetrics.dropTables(job.CfID)
+					o.stateMetrics.setState(job.CfID, nil, changefeedMetricStateFinished)
+					o.history.record(job.CfID, model.ChangefeedEventFinish, status.CheckpointTs, job.Client,
+						"changefeed is finished")
+					var info *model.ChangeFeedInfo
+					if cf != nil {
+						info = cf.info
+					}
+					o.notifier.notify(job.CfID, info, NotifyEventFinished, model.StateFinished, nil, status.CheckpointTs)
+				} else {
+					o.history.record(job.CfID, model.ChangefeedEventRemove, status.CheckpointTs, job.Client,
+						"changefeed is removed")
+				}
 			}
 		case model.AdminResume:
 			// resume changefeed must read checkpoint from ChangeFeedStatus
@@ -975,6 +1526,24 @@ func (o *Owner) handleAdminJob(ctx context.Context) error {
 				log.Info("changefeed has been removed or finished, cannot be resumed anymore")
 				continue
 			}
+			var overwriteTs uint64
+			if job.Opts != nil {
+				overwriteTs = job.Opts.OverwriteCheckpointTs
+			}
+			if overwriteTs != 0 && (cf != nil || feedState != model.StateStopped) {
+				log.Warn("only the paused changefeed can be resumed from another checkpoint ts, resume command will do nothing",
+					zap.String("changefeed", job.CfID), zap.Uint64("overwriteCheckpointTs", overwriteTs))
+				continue
+			}
+			if cf != nil && cf.status.Pausing != nil {
+				log.Info("changefeed is resumed before it is paused, cancel the pause", zap.String("changefeed", job.CfID))
+				cf.status.Pausing = nil
+				err := o.etcdClient.PutChangeFeedStatus(ctx, job.CfID, cf.status)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
 			cfInfo, err := o.etcdClient.GetChangeFeedInfo(ctx, job.CfID)
 			if err != nil {
 				return errors.Trace(err)
@@ -982,6 +1551,17 @@ func (o *Owner) handleAdminJob(ctx context.Context) error {
 
 			// set admin job in changefeed status to tell owner resume changefeed
 			status.AdminJobType = model.AdminResume
+			if status.Pause != nil {
+				// resume from the exact ts where the changefeed is paused
+				status.CheckpointTs = status.Pause.PausedAtTs
+				status.Pause = nil
+			}
+			oldCheckpointTs := status.CheckpointTs
+			if overwriteTs != 0 {
+				if err := o.overwriteCheckpointTs(ctx, job.CfID, cfInfo, status, overwriteTs); err != nil {
+					return errors.Trace(err)
+				}
+			}
 			err = o.etcdClient.PutChangeFeedStatus(ctx, job.CfID, status)
 			if err != nil {
 				return errors.Trace(err)
@@ -996,6 +1576,14 @@ func (o *Owner) handleAdminJob(ctx context.Context) error {
 			if err != nil {
 				return errors.Trace(err)
 			}
+			if overwriteTs != 0 {
+				o.history.record(job.CfID, model.ChangefeedEventOverwriteCheckpoint, overwriteTs, job.Client,
+					"the checkpoint ts is overwritten from %d to %d", oldCheckpointTs, overwriteTs)
+			}
+			o.history.record(job.CfID, model.ChangefeedEventResume, status.CheckpointTs, job.Client,
+				"changefeed is resumed")
+			o.stateMetrics.setState(job.CfID, cfInfo, changefeedMetricStateNormal)
+			o.notifier.notify(job.CfID, cfInfo, NotifyEventResumed, cfInfo.State, nil, status.CheckpointTs)
 		}
 		// TODO: we need a better admin job workflow. Supposing uses create
 		// multiple admin jobs to a specific changefeed at the same time, such
@@ -1058,6 +1646,7 @@ func (o *Owner) Run(ctx context.Context, tickTime time.Duration) error {
 	if err := o.throne(ctx); err != nil {
 		return err
 	}
+	go o.notifier.run(ctx)
 
 	ctx1, cancel1 := context.WithCancel(ctx)
 	defer cancel1()
@@ -1095,6 +1684,12 @@ loop:
 	for _, cf := range o.changeFeeds {
 		cf.Close()
 	}
+	o.stateMetrics.reset()
+	// it's best effort to flush the remaining changefeed history, since the
+	// context may be canceled.
+	if err := o.history.flush(ctx, o.etcdClient, true /* force */); err != nil {
+		log.Warn("flush changefeed history failed", zap.Error(err))
+	}
 	if o.stepDown != nil {
 		if err := o.stepDown(ctx); err != nil {
 			return err
@@ -1106,7 +1701,7 @@ loop:
 
 // watchCampaignKey watches the aliveness of campaign owner key in etcd
 func (o *Owner) watchCampaignKey(ctx context.Context) error {
-	key := fmt.Sprintf("%s/%x", kv.CaptureOwnerKey, o.session.Lease())
+	key := fmt.Sprintf("%s/%x", o.etcdClient.CaptureOwnerKey(), o.session.Lease())
 restart:
 	resp, err := o.etcdClient.Client.Get(ctx, key)
 	if err != nil {
@@ -1144,7 +1739,7 @@ func (o *Owner) watchFeedChange(ctx context.Context) {
 			default:
 			}
 			cctx, cancel := context.WithCancel(ctx)
-			wch := o.etcdClient.Client.Watch(cctx, kv.TaskPositionKeyPrefix, clientv3.WithFilterDelete(), clientv3.WithPrefix())
+			wch := o.etcdClient.Client.Watch(cctx, o.etcdClient.TaskPositionKeyPrefix(), clientv3.WithFilterDelete(), clientv3.WithPrefix())
 
 			for resp := range wch {
 				if resp.Err() != nil {
@@ -1200,11 +1795,36 @@ func (o *Owner) run(ctx context.Context) error {
 		return errors.Trace(err)
 	}
 
+	err = o.handleSchemaBootstrap(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
 	err = o.handleSyncPoint(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	err = o.updateBudgets(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = o.handleBreakerTrips(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = o.resetBreakers(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = o.handlePausingChangefeeds(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
 	err = o.handleAdminJob(ctx)
 	if err != nil {
 		return errors.Trace(err)
@@ -1220,6 +1840,12 @@ func (o *Owner) run(ctx context.Context) error {
 		return errors.Trace(err)
 	}
 
+	// the changefeed history is not critical, failing to write it should not
+	// break the owner.
+	if err := o.history.flush(ctx, o.etcdClient, false /* force */); err != nil {
+		log.Warn("flush changefeed history failed", zap.Error(err))
+	}
+
 	return nil
 }
 
@@ -1236,6 +1862,21 @@ func (o *Owner) EnqueueJob(job model.AdminJob) error {
 	return nil
 }
 
+// changefeedHistory returns the event history of the changefeed, including
+// the events which are not flushed to etcd yet. The IDs of the unflushed
+// events are tentative.
+func (o *Owner) changefeedHistory(ctx context.Context, changefeedID model.ChangeFeedID) (*model.ChangefeedHistory, error) {
+	_, history, err := o.etcdClient.GetChangeFeedHistory(ctx, changefeedID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, event := range o.history.pendingEvents(changefeedID) {
+		e := *event
+		history.Append(model.ChangefeedHistoryLimit, &e)
+	}
+	return history, nil
+}
+
 // TriggerRebalance triggers the rebalance in the specified changefeed
 func (o *Owner) TriggerRebalance(changefeedID model.ChangeFeedID) {
 	o.rebalanceMu.Lock()
@@ -1244,6 +1885,23 @@ func (o *Owner) TriggerRebalance(changefeedID model.ChangeFeedID) {
 	// TODO(leoppro) throw an error if the changefeed is not exist
 }
 
+// PreviewRebalance computes the rebalance plan of the running changefeed
+// against the current workloads of the captures, without moving any table.
+func (o *Owner) PreviewRebalance(ctx context.Context, changefeedID model.ChangeFeedID) (*scheduler.RebalancePlan, error) {
+	// the lock is released before the workloads are loaded from etcd,
+	// otherwise the owner is blocked by the reads
+	o.l.RLock()
+	cf, ok := o.changeFeeds[changefeedID]
+	if !ok {
+		o.l.RUnlock()
+		return nil, cerror.ErrChangeFeedNotExists.GenWithStackByArgs(changefeedID)
+	}
+	snap := cf.rebalanceSnapshot(o.captures)
+	o.l.RUnlock()
+	plan, err := snap.plan(ctx)
+	return plan, errors.Trace(err)
+}
+
 // ManualSchedule moves the table from a capture to another capture
 func (o *Owner) ManualSchedule(changefeedID model.ChangeFeedID, to model.CaptureID, tableID model.TableID) {
 	o.rebalanceMu.Lock()
@@ -1254,6 +1912,82 @@ func (o *Owner) ManualSchedule(changefeedID model.ChangeFeedID, to model.Capture
 	})
 }
 
+// TriggerSchemaBootstrap requests to send the schema bootstrap event of the table
+// in the specified changefeed
+func (o *Owner) TriggerSchemaBootstrap(changefeedID model.ChangeFeedID, tableID model.TableID) {
+	o.schemaBootstrapMu.Lock()
+	defer o.schemaBootstrapMu.Unlock()
+	o.schemaBootstrapCommand[changefeedID] = append(o.schemaBootstrapCommand[changefeedID], tableID)
+}
+
+// SkipDDLOnce requests to skip executing the queued DDL job in the downstream
+// of the specified changefeed
+func (o *Owner) SkipDDLOnce(changefeedID model.ChangeFeedID, jobID int64) {
+	o.skipDDLMu.Lock()
+	defer o.skipDDLMu.Unlock()
+	o.skipDDLCommand[changefeedID] = append(o.skipDDLCommand[changefeedID], jobID)
+}
+
+// budgetUpdate is an update of the budget of a changefeed, the negative
+// values are not changed.
+type budgetUpdate struct {
+	memoryQuota     int64
+	eventsPerSecond int
+	client          string
+}
+
+// UpdateBudget requests to update the budget of the running changefeed, the
+// negative memoryQuota or eventsPerSecond is not changed.
+func (o *Owner) UpdateBudget(changefeedID model.ChangeFeedID, memoryQuota int64, eventsPerSecond int, client string) {
+	o.budgetMu.Lock()
+	defer o.budgetMu.Unlock()
+	o.budgetCommand[changefeedID] = append(o.budgetCommand[changefeedID], budgetUpdate{
+		memoryQuota:     memoryQuota,
+		eventsPerSecond: eventsPerSecond,
+		client:          client,
+	})
+}
+
+// updateBudgets applies the budget updates to the infos of the running
+// changefeeds, and the processors apply the new budgets once the infos are
+// changed. The updates of the changefeeds not running are ignored.
+func (o *Owner) updateBudgets(ctx context.Context) error {
+	o.budgetMu.Lock()
+	commands := o.budgetCommand
+	o.budgetCommand = make(map[model.ChangeFeedID][]budgetUpdate)
+	o.budgetMu.Unlock()
+	for id, updates := range commands {
+		cf, ok := o.changeFeeds[id]
+		if !ok {
+			log.Warn("update the budget of the changefeed not running, ignore it", zap.String("changefeed", id))
+			continue
+		}
+		budget := config.BudgetConfig{}
+		if cf.info.Config.Budget != nil {
+			budget = *cf.info.Config.Budget
+		}
+		var client string
+		for _, update := range updates {
+			if update.memoryQuota >= 0 {
+				budget.MemoryQuota = update.memoryQuota
+			}
+			if update.eventsPerSecond >= 0 {
+				budget.EventsPerSecond = update.eventsPerSecond
+			}
+			client = update.client
+		}
+		cf.info.Config.Budget = &budget
+		if err := o.etcdClient.SaveChangeFeedInfo(ctx, cf.info, id); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("the budget of the changefeed is updated", zap.String("changefeed", id), zap.Any("budget", budget))
+		o.history.record(id, model.ChangefeedEventUpdateBudget, cf.status.CheckpointTs, client,
+			"the budget is updated to memory-quota=%d, events-per-second=%d",
+			budget.MemoryQuota, budget.EventsPerSecond)
+	}
+	return nil
+}
+
 func (o *Owner) writeDebugInfo(w io.Writer) {
 	for _, info := range o.changeFeeds {
 		// fmt.Fprintf(w, "%+v\n", *info)
@@ -1275,6 +2009,12 @@ func (o *Owner) cleanUpStaleTasks(ctx context.Context) error {
 	for changeFeedID := range changefeeds {
 		statuses, err := o.etcdClient.GetAllTaskStatus(ctx, changeFeedID)
 		if err != nil {
+			if cerror.ErrEtcdValueCorrupted.Equal(err) {
+				// the changefeed is stopped by loadChangeFeeds
+				log.Warn("skip cleaning up the stale tasks of the changefeed with corrupted task status",
+					zap.String("changefeed", changeFeedID), zap.Error(err))
+				continue
+			}
 			return errors.Trace(err)
 		}
 		positions, err := o.etcdClient.GetAllTaskPositions(ctx, changeFeedID)
@@ -1375,9 +2115,9 @@ func (o *Owner) watchCapture(ctx context.Context) error {
 	}
 
 	log.Info("monitoring captures",
-		zap.String("key", kv.CaptureInfoKeyPrefix),
+		zap.String("key", o.etcdClient.CaptureInfoKeyPrefix()),
 		zap.Int64("rev", rev))
-	ch := o.etcdClient.Client.Watch(ctx, kv.CaptureInfoKeyPrefix,
+	ch := o.etcdClient.Client.Watch(ctx, o.etcdClient.CaptureInfoKeyPrefix(),
 		clientv3.WithPrefix(),
 		clientv3.WithRev(rev+1),
 		clientv3.WithPrevKV())
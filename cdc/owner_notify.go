@@ -0,0 +1,269 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// NotifyEventType is the type of the event notified to the webhook
+type NotifyEventType string
+
+// the events notified to the webhook
+const (
+	// NotifyEventError means the changefeed meets an error and is stopped
+	NotifyEventError NotifyEventType = "error"
+	// NotifyEventFailed means the changefeed fails and can't be resumed
+	NotifyEventFailed NotifyEventType = "failed"
+	// NotifyEventFinished means the changefeed reaches its target ts
+	NotifyEventFinished NotifyEventType = "finished"
+	// NotifyEventResumed means the changefeed is resumed
+	NotifyEventResumed NotifyEventType = "resumed"
+	// NotifyEventLagExceeded means the checkpoint lag exceeds the threshold
+	NotifyEventLagExceeded NotifyEventType = "lag-exceeded"
+	// NotifyEventLagRecovered means the checkpoint lag gets back under the threshold
+	NotifyEventLagRecovered NotifyEventType = "lag-recovered"
+	// NotifyEventBreakerTripped means a validation failure trips the circuit breaker
+	NotifyEventBreakerTripped NotifyEventType = "breaker-tripped"
+	// NotifyEventInitialScanFinished means the changefeed finishes catching
+	// up with the history and reaches the steady state
+	NotifyEventInitialScanFinished NotifyEventType = "initial-scan-finished"
+)
+
+const (
+	// webhookQueueSize is the max number of the notifications waiting to be
+	// sent, the notifications exceeding it are dropped.
+	webhookQueueSize = 1024
+	// webhookTimeout is the timeout of each call of the webhook
+	webhookTimeout = 5 * time.Second
+	// webhookMaxRetries is the max number of retries of a notification
+	webhookMaxRetries = 3
+)
+
+// webhookRetryInterval is the initial interval between the retries of a
+// notification, it's a variable to be shortened in tests.
+var webhookRetryInterval = 500 * time.Millisecond
+
+// WebhookPayload is the JSON body POSTed to the webhook, the lag is in seconds.
+type WebhookPayload struct {
+	ChangefeedID  model.ChangeFeedID `json:"changefeed-id"`
+	Event         NotifyEventType    `json:"event"`
+	State         model.FeedState    `json:"state"`
+	ErrorCode     string             `json:"error-code,omitempty"`
+	ErrorMessage  string             `json:"error-message,omitempty"`
+	CheckpointTs  uint64             `json:"checkpoint-ts"`
+	CheckpointLag float64            `json:"checkpoint-lag"`
+	Time          time.Time          `json:"time"`
+}
+
+type webhookNotification struct {
+	url     string
+	payload *WebhookPayload
+}
+
+// webhookNotifier notifies the webhooks of the state transitions and the lag
+// threshold crossings of the changefeeds. The notifications are queued by the
+// owner and sent by run in the background, so that the owner is never blocked
+// by an unreachable webhook.
+// All methods are no-op on a nil notifier.
+type webhookNotifier struct {
+	global config.NotifyConfig
+	queue  chan *webhookNotification
+	client *http.Client
+
+	// lagging records the changefeeds whose lag exceeds the threshold, it's
+	// only accessed by the owner.
+	lagging map[model.ChangeFeedID]struct{}
+}
+
+// newWebhookNotifier returns a notifier with the global config, which is
+// overridden by the config of each changefeed.
+func newWebhookNotifier(global *config.NotifyConfig) *webhookNotifier {
+	n := &webhookNotifier{
+		queue:   make(chan *webhookNotification, webhookQueueSize),
+		client:  &http.Client{Timeout: webhookTimeout},
+		lagging: make(map[model.ChangeFeedID]struct{}),
+	}
+	if global != nil {
+		n.global = *global
+	}
+	return n
+}
+
+// config returns the config of the changefeed merged with the global config
+func (n *webhookNotifier) config(info *model.ChangeFeedInfo) config.NotifyConfig {
+	cfg := n.global
+	if info == nil || info.Config == nil || info.Config.Notify == nil {
+		return cfg
+	}
+	if info.Config.Notify.WebhookURL != "" {
+		cfg.WebhookURL = info.Config.Notify.WebhookURL
+	}
+	if info.Config.Notify.LagThreshold != 0 {
+		cfg.LagThreshold = info.Config.Notify.LagThreshold
+	}
+	return cfg
+}
+
+// notify queues a notification of the state transition of the changefeed
+func (n *webhookNotifier) notify(
+	changefeedID model.ChangeFeedID,
+	info *model.ChangeFeedInfo,
+	event NotifyEventType,
+	state model.FeedState,
+	runningErr *model.RunningError,
+	checkpointTs uint64,
+) {
+	if n == nil {
+		return
+	}
+	url := n.config(info).WebhookURL
+	if url == "" {
+		return
+	}
+	now := time.Now()
+	payload := &WebhookPayload{
+		ChangefeedID:  changefeedID,
+		Event:         event,
+		State:         state,
+		CheckpointTs:  checkpointTs,
+		CheckpointLag: util.TsLag(now, checkpointTs),
+		Time:          now,
+	}
+	if runningErr != nil {
+		payload.ErrorCode = runningErr.Code
+		payload.ErrorMessage = runningErr.Message
+	}
+	select {
+	case n.queue <- &webhookNotification{url: url, payload: payload}:
+	default:
+		log.Error("the webhook queue is full, drop the notification",
+			zap.String("url", url), zap.Reflect("payload", payload))
+	}
+}
+
+// checkLag notifies when the checkpoint lag of the changefeed exceeds the
+// threshold and when it gets back under the threshold, each crossing is
+// notified once.
+func (n *webhookNotifier) checkLag(
+	changefeedID model.ChangeFeedID,
+	info *model.ChangeFeedInfo,
+	checkpointTs uint64,
+	now time.Time,
+) {
+	if n == nil {
+		return
+	}
+	threshold := n.config(info).LagThreshold
+	_, lagging := n.lagging[changefeedID]
+	exceeded := threshold > 0 && util.TsLag(now, checkpointTs) > float64(threshold)
+	if exceeded == lagging {
+		return
+	}
+	state := model.StateNormal
+	if info != nil {
+		state = info.State
+	}
+	if exceeded {
+		n.lagging[changefeedID] = struct{}{}
+		n.notify(changefeedID, info, NotifyEventLagExceeded, state, nil, checkpointTs)
+	} else {
+		delete(n.lagging, changefeedID)
+		n.notify(changefeedID, info, NotifyEventLagRecovered, state, nil, checkpointTs)
+	}
+}
+
+// forget drops the lag state of the changefeed which is no longer running
+func (n *webhookNotifier) forget(changefeedID model.ChangeFeedID) {
+	if n == nil {
+		return
+	}
+	delete(n.lagging, changefeedID)
+}
+
+// isLagging returns whether the checkpoint lag of the changefeed exceeds the
+// threshold
+func (n *webhookNotifier) isLagging(changefeedID model.ChangeFeedID) bool {
+	if n == nil {
+		return false
+	}
+	_, lagging := n.lagging[changefeedID]
+	return lagging
+}
+
+// run sends the queued notifications until the context is done. A
+// notification is retried for webhookMaxRetries times, and is written to the
+// log as a dead letter if all the calls fail.
+func (n *webhookNotifier) run(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			err := retry.Run(webhookRetryInterval, webhookMaxRetries, func() error {
+				err := n.send(ctx, notification)
+				if err != nil && ctx.Err() != nil {
+					// stop retrying once the owner exits
+					return errors.Trace(ctx.Err())
+				}
+				return err
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Error("failed to call the webhook, drop the notification",
+					zap.String("url", notification.url),
+					zap.Reflect("payload", notification.payload), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (n *webhookNotifier) send(ctx context.Context, notification *webhookNotification) error {
+	body, err := json.Marshal(notification.payload)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notification.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	// drain the body so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returns status code %d", resp.StatusCode)
+	}
+	return nil
+}
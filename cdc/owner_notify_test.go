@@ -0,0 +1,218 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap/zapcore"
+)
+
+type ownerNotifySuite struct{}
+
+var _ = check.Suite(&ownerNotifySuite{})
+
+// newWebhookServer returns an in-process webhook, which sends the received
+// payloads to the returned channel and responds with the status code.
+func newWebhookServer(statusCode int) (*httptest.Server, chan *WebhookPayload) {
+	payloads := make(chan *WebhookPayload, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload := new(WebhookPayload)
+		if err := json.NewDecoder(req.Body).Decode(payload); err == nil {
+			payloads <- payload
+		}
+		w.WriteHeader(statusCode)
+	}))
+	return server, payloads
+}
+
+// runNotifier runs the notifier until the returned function is called
+func runNotifier(n *webhookNotifier) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.run(ctx)
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func receivePayload(c *check.C, payloads chan *WebhookPayload) *WebhookPayload {
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(5 * time.Second):
+		c.Fatal("the webhook is not called")
+	}
+	return nil
+}
+
+func (s *ownerNotifySuite) TestNotifyStateTransition(c *check.C) {
+	defer testleak.AfterTest(c)()
+	server, payloads := newWebhookServer(http.StatusOK)
+	defer server.Close()
+	n := newWebhookNotifier(&config.NotifyConfig{WebhookURL: server.URL})
+	defer runNotifier(n)()
+
+	checkpointTs := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	runningErr := &model.RunningError{Addr: "127.0.0.1:8300", Code: "CDC:ErrSinkURIInvalid", Message: "sink uri invalid"}
+	n.notify("test-changefeed", nil, NotifyEventError, model.StateStopped, runningErr, checkpointTs)
+	payload := receivePayload(c, payloads)
+	c.Assert(payload.ChangefeedID, check.Equals, "test-changefeed")
+	c.Assert(payload.Event, check.Equals, NotifyEventError)
+	c.Assert(payload.State, check.Equals, model.StateStopped)
+	c.Assert(payload.ErrorCode, check.Equals, "CDC:ErrSinkURIInvalid")
+	c.Assert(payload.ErrorMessage, check.Equals, "sink uri invalid")
+	c.Assert(payload.CheckpointTs, check.Equals, checkpointTs)
+	c.Assert(payload.CheckpointLag >= 60, check.IsTrue)
+	c.Assert(payload.Time.IsZero(), check.IsFalse)
+
+	n.notify("test-changefeed", nil, NotifyEventResumed, model.StateNormal, nil, checkpointTs)
+	payload = receivePayload(c, payloads)
+	c.Assert(payload.Event, check.Equals, NotifyEventResumed)
+	c.Assert(payload.ErrorCode, check.Equals, "")
+}
+
+func (s *ownerNotifySuite) TestNotifyLagCrossing(c *check.C) {
+	defer testleak.AfterTest(c)()
+	n := newWebhookNotifier(&config.NotifyConfig{WebhookURL: "http://127.0.0.1:1/alert", LagThreshold: 30})
+	info := &model.ChangeFeedInfo{State: model.StateNormal, Config: config.GetDefaultReplicaConfig()}
+	now := time.Now()
+	laggingTs := oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Minute)), 0)
+	freshTs := oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Second)), 0)
+
+	n.checkLag("test-changefeed", info, freshTs, now)
+	c.Assert(n.queue, check.HasLen, 0)
+	// the crossings are notified once
+	n.checkLag("test-changefeed", info, laggingTs, now)
+	n.checkLag("test-changefeed", info, laggingTs, now)
+	c.Assert(n.queue, check.HasLen, 1)
+	notification := <-n.queue
+	c.Assert(notification.payload.Event, check.Equals, NotifyEventLagExceeded)
+	c.Assert(notification.payload.CheckpointTs, check.Equals, laggingTs)
+	n.checkLag("test-changefeed", info, freshTs, now)
+	n.checkLag("test-changefeed", info, freshTs, now)
+	c.Assert(n.queue, check.HasLen, 1)
+	notification = <-n.queue
+	c.Assert(notification.payload.Event, check.Equals, NotifyEventLagRecovered)
+
+	// the lag is notified again after the changefeed is restarted
+	n.checkLag("test-changefeed", info, laggingTs, now)
+	n.forget("test-changefeed")
+	n.checkLag("test-changefeed", info, laggingTs, now)
+	c.Assert(n.queue, check.HasLen, 2)
+
+	// the threshold of the changefeed overrides the global one
+	info.Config.Notify.LagThreshold = 120
+	n.forget("test-changefeed")
+	n.checkLag("test-changefeed", info, laggingTs, now)
+	c.Assert(n.queue, check.HasLen, 2)
+}
+
+func (s *ownerNotifySuite) TestChangefeedConfigOverride(c *check.C) {
+	defer testleak.AfterTest(c)()
+	n := newWebhookNotifier(&config.NotifyConfig{WebhookURL: "http://127.0.0.1:1/global"})
+	cfg := config.GetDefaultReplicaConfig()
+	n.notify("changefeed-1", &model.ChangeFeedInfo{Config: cfg}, NotifyEventFinished, model.StateFinished, nil, 0)
+	cfg = config.GetDefaultReplicaConfig()
+	cfg.Notify.WebhookURL = "http://127.0.0.1:1/changefeed"
+	n.notify("changefeed-2", &model.ChangeFeedInfo{Config: cfg}, NotifyEventFinished, model.StateFinished, nil, 0)
+	c.Assert((<-n.queue).url, check.Equals, "http://127.0.0.1:1/global")
+	c.Assert((<-n.queue).url, check.Equals, "http://127.0.0.1:1/changefeed")
+
+	// nothing is notified without a webhook
+	n = newWebhookNotifier(nil)
+	n.notify("changefeed-1", &model.ChangeFeedInfo{Config: config.GetDefaultReplicaConfig()},
+		NotifyEventFinished, model.StateFinished, nil, 0)
+	c.Assert(n.queue, check.HasLen, 0)
+
+	// all methods are no-op on a nil notifier
+	n = nil
+	n.notify("changefeed-1", nil, NotifyEventFinished, model.StateFinished, nil, 0)
+	n.checkLag("changefeed-1", nil, 0, time.Now())
+	n.forget("changefeed-1")
+	n.run(context.Background())
+}
+
+func (s *ownerNotifySuite) TestWebhookDeadLetter(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.InfoLevel)
+	defer restore()
+	originalInterval := webhookRetryInterval
+	webhookRetryInterval = time.Millisecond
+	defer func() {
+		webhookRetryInterval = originalInterval
+	}()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	n := newWebhookNotifier(&config.NotifyConfig{WebhookURL: server.URL})
+	defer runNotifier(n)()
+
+	n.notify("test-changefeed", nil, NotifyEventFailed, model.StateFailed, nil, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for logs.FilterMessage("failed to call the webhook, drop the notification").Len() == 0 {
+		if time.Now().After(deadline) {
+			c.Fatal("the dead letter is not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(webhookMaxRetries+1))
+	entry := logs.FilterMessage("failed to call the webhook, drop the notification").All()[0]
+	fields := entry.ContextMap()
+	c.Assert(fields["url"], check.Equals, server.URL)
+	c.Assert(fields["payload"], check.NotNil)
+}
+
+func (s *ownerNotifySuite) TestFullQueueNotBlocking(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.InfoLevel)
+	defer restore()
+	// the notifier is not running, so the queue is never consumed
+	n := newWebhookNotifier(&config.NotifyConfig{WebhookURL: "http://127.0.0.1:1/alert"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < webhookQueueSize+10; i++ {
+			n.notify("test-changefeed", nil, NotifyEventError, model.StateStopped, nil, 0)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("notify is blocked by the full queue")
+	}
+	c.Assert(n.queue, check.HasLen, webhookQueueSize)
+	c.Assert(logs.FilterMessage("the webhook queue is full, drop the notification").Len(), check.Equals, 10)
+}
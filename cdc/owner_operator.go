@@ -24,7 +24,6 @@ import (
 	"github.com/pingcap/ticdc/cdc/entry"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/puller"
-	"github.com/pingcap/ticdc/pkg/regionspan"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
 	pd "github.com/tikv/pd/client"
@@ -45,7 +44,7 @@ type ddlHandler struct {
 func newDDLHandler(pdCli pd.Client, credential *security.Credential, kvStorage tidbkv.Storage, checkpointTS uint64) *ddlHandler {
 	// TODO: context should be passed from outter caller
 	ctx, cancel := context.WithCancel(context.Background())
-	plr := puller.NewPuller(ctx, pdCli, credential, kvStorage, checkpointTS, []regionspan.Span{regionspan.GetDDLSpan(), regionspan.GetAddIndexDDLSpan()}, nil, false)
+	plr := puller.NewPuller(ctx, pdCli, credential, kvStorage, checkpointTS, ddlSpans(), nil, false)
 	h := &ddlHandler{
 		puller: plr,
 		cancel: cancel,
@@ -59,13 +58,15 @@ func newDDLHandler(pdCli pd.Client, credential *security.Credential, kvStorage t
 		return plr.Run(ctx)
 	})
 
-	rawDDLCh := puller.SortOutput(ctx, plr.Output())
+	rawDDLCh, sortErrCh := puller.SortOutput(ctx, plr.Output())
 
 	errg.Go(func() error {
 		for {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case err := <-sortErrCh:
+				return errors.Trace(err)
 			case e := <-rawDDLCh:
 				if e == nil {
 					continue
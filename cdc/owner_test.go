@@ -35,6 +35,7 @@ import (
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/etcd"
 	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/scheduler"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
@@ -107,6 +108,86 @@ func (s *ownerSuite) TestOwnerFlushChangeFeedInfos(c *check.C) {
 	s.TearDownTest(c)
 }
 
+// gcSafepointUpdate is a call of UpdateServiceGCSafePoint
+type gcSafepointUpdate struct {
+	serviceID string
+	ttl       int64
+	safepoint uint64
+}
+
+// mockGCPDClient captures the UpdateServiceGCSafePoint calls
+type mockGCPDClient struct {
+	pd.Client
+	updates          []gcSafepointUpdate
+	minServiceGCSafe uint64
+	err              error
+}
+
+func (m *mockGCPDClient) UpdateServiceGCSafePoint(ctx context.Context, serviceID string, ttl int64, safePoint uint64) (uint64, error) {
+	m.updates = append(m.updates, gcSafepointUpdate{serviceID: serviceID, ttl: ttl, safepoint: safePoint})
+	return m.minServiceGCSafe, m.err
+}
+
+func (s *ownerSuite) TestOwnerRefreshGCSafepoint(c *check.C) {
+	defer testleak.AfterTest(c)()
+	mockPDCli := &mockGCPDClient{minServiceGCSafe: 90}
+	mockOwner := Owner{
+		pdClient: mockPDCli,
+		gcTTL:    86400,
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{
+			"cf-1": {status: &model.ChangeFeedStatus{CheckpointTs: 200}},
+			"cf-2": {status: &model.ChangeFeedStatus{CheckpointTs: 100}},
+		},
+		stoppedFeeds: map[model.ChangeFeedID]*model.ChangeFeedStatus{
+			"cf-3": {CheckpointTs: 150},
+		},
+		// the safepoint is not pushed by the timer within the interval
+		gcSafepointLastUpdate: time.Now(),
+		history:               newHistoryRecorder("owner"),
+	}
+	c.Assert(mockOwner.updateGCSafepoint(s.ctx, false), check.IsNil)
+	c.Assert(mockPDCli.updates, check.HasLen, 0)
+
+	resp, err := mockOwner.RefreshGCSafepoint(s.ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(mockPDCli.updates, check.DeepEquals, []gcSafepointUpdate{
+		{serviceID: CDCServiceSafePointID, ttl: 86400, safepoint: 100},
+	})
+	c.Assert(resp.ServiceID, check.Equals, CDCServiceSafePointID)
+	c.Assert(resp.Safepoint, check.Equals, uint64(100))
+	c.Assert(resp.PDMinSafepoint, check.Equals, uint64(90))
+	c.Assert(resp.Holder, check.Equals, "cf-2")
+	c.Assert(resp.UpdateTime, check.Not(check.Equals), "")
+	c.Assert(mockOwner.GCSafepoint(), check.DeepEquals, resp)
+	c.Assert(mockOwner.history.pendingEvents("cf-2"), check.HasLen, 1)
+
+	// the stopped changefeed holds the safepoint after the removal
+	delete(mockOwner.changeFeeds, "cf-2")
+	resp, err = mockOwner.RefreshGCSafepoint(s.ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(mockPDCli.updates[1].safepoint, check.Equals, uint64(150))
+	c.Assert(resp.Holder, check.Equals, "cf-3")
+
+	// the last safepoint pushed is kept if the refresh fails
+	mockPDCli.err = errors.New("mock error")
+	mockOwner.changeFeeds["cf-1"].status.CheckpointTs = 120
+	_, err = mockOwner.RefreshGCSafepoint(s.ctx)
+	c.Assert(err, check.ErrorMatches, ".*mock error.*")
+	c.Assert(mockOwner.GCSafepoint(), check.DeepEquals, resp)
+
+	// the safepoint is cleared if there's no changefeed
+	mockPDCli.err = nil
+	mockOwner.changeFeeds = map[model.ChangeFeedID]*changeFeed{}
+	mockOwner.stoppedFeeds = map[model.ChangeFeedID]*model.ChangeFeedStatus{}
+	resp, err = mockOwner.RefreshGCSafepoint(s.ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(mockPDCli.updates[len(mockPDCli.updates)-1], check.DeepEquals,
+		gcSafepointUpdate{serviceID: CDCServiceSafePointID, ttl: 0, safepoint: 0})
+	c.Assert(resp.Safepoint, check.Equals, uint64(0))
+	c.Assert(resp.Holder, check.Equals, "")
+	c.Assert(resp.UpdateTime, check.Equals, "")
+}
+
 /*
 type handlerForPrueDMLTest struct {
 	mu               sync.RWMutex
@@ -483,7 +564,7 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 	sampleCF := &changeFeed{
 		id:       cfID,
 		info:     &model.ChangeFeedInfo{},
-		status:   &model.ChangeFeedStatus{},
+		status:   &model.ChangeFeedStatus{ResolvedTs: 100, CheckpointTs: 90},
 		ddlState: model.ChangeFeedSyncDML,
 		taskStatus: model.ProcessorsInfos{
 			"capture_1": {},
@@ -517,7 +598,7 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 	sampleCF.etcdCli = owner.etcdClient
 	owner.changeFeeds = map[model.ChangeFeedID]*changeFeed{cfID: sampleCF}
 	for cid, pinfo := range sampleCF.taskPositions {
-		key := kv.GetEtcdKeyTaskStatus(cfID, cid)
+		key := owner.etcdClient.GetEtcdKeyTaskStatus(cfID, cid)
 		pinfoStr, err := pinfo.Marshal()
 		c.Assert(err, check.IsNil)
 		_, err = s.client.Client.Put(ctx, key, pinfoStr)
@@ -533,10 +614,23 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 		owner.adminJobsLock.Unlock()
 	}
 
-	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminStop}), check.IsNil)
+	pauseJob := model.AdminJob{CfID: cfID, Type: model.AdminStop, Opts: &model.AdminJobOption{Graceful: true}}
+	c.Assert(owner.EnqueueJob(pauseJob), check.IsNil)
 	checkAdminJobLen(1)
 	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
 	checkAdminJobLen(0)
+	// the changefeed is stopped after the checkpoint reaches the pause ts
+	c.Assert(len(owner.changeFeeds), check.Equals, 1)
+	c.Assert(sampleCF.status.Pausing.PauseTs, check.Equals, uint64(100))
+	// the pausing state is persisted for the next owner
+	st, _, err := owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.Pausing, check.NotNil)
+	c.Assert(st.Pausing.PauseTs, check.Equals, uint64(100))
+	c.Assert(owner.handlePausingChangefeeds(ctx), check.IsNil)
+	c.Assert(len(owner.changeFeeds), check.Equals, 1)
+	sampleCF.status.CheckpointTs = 100
+	c.Assert(owner.handlePausingChangefeeds(ctx), check.IsNil)
 	c.Assert(len(owner.changeFeeds), check.Equals, 0)
 	// check changefeed info is set admin job
 	info, err := owner.etcdClient.GetChangeFeedInfo(ctx, cfID)
@@ -549,9 +643,11 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 		c.Assert(subInfo.AdminJobType, check.Equals, model.AdminStop)
 	}
 	// check changefeed status is set admin job
-	st, _, err := owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
 	c.Assert(err, check.IsNil)
 	c.Assert(st.AdminJobType, check.Equals, model.AdminStop)
+	c.Assert(st.Pause, check.DeepEquals, &model.PauseInfo{PausedAtTs: 100, Clean: true})
+	c.Assert(st.Pausing, check.IsNil)
 	// check changefeed context is canceled
 	select {
 	case <-cctx.Done():
@@ -573,7 +669,41 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
 	c.Assert(err, check.IsNil)
 	c.Assert(st.AdminJobType, check.Equals, model.AdminResume)
+	c.Assert(st.CheckpointTs, check.Equals, uint64(100))
+	c.Assert(st.Pause, check.IsNil)
+
+	// the changefeed is stopped anyway if the sinks are not flushed in time
+	sampleCF.status = st
+	sampleCF.status.ResolvedTs = 200
+	owner.changeFeeds[cfID] = sampleCF
+	owner.pauseTimeout = 0
+	c.Assert(owner.EnqueueJob(pauseJob), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	c.Assert(owner.handlePausingChangefeeds(ctx), check.IsNil)
+	c.Assert(len(owner.changeFeeds), check.Equals, 0)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.AdminJobType, check.Equals, model.AdminStop)
+	c.Assert(st.Pause, check.DeepEquals, &model.PauseInfo{PausedAtTs: 100, Clean: false})
+
+	// the changefeeds stopped by the owner itself aren't stopped gracefully
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminResume}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	sampleCF.status = st
+	owner.changeFeeds[cfID] = sampleCF
+	owner.pauseTimeout = time.Hour
+	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminStop}), check.IsNil)
+	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+	c.Assert(len(owner.changeFeeds), check.Equals, 0)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.AdminJobType, check.Equals, model.AdminStop)
+	c.Assert(st.Pausing, check.IsNil)
 
+	cctx, cancel = context.WithCancel(ctx)
+	sampleCF.cancel = cancel
 	owner.changeFeeds[cfID] = sampleCF
 	c.Assert(owner.EnqueueJob(model.AdminJob{CfID: cfID, Type: model.AdminRemove}), check.IsNil)
 	c.Assert(owner.handleAdminJob(ctx), check.IsNil)
@@ -601,6 +731,144 @@ func (s *ownerSuite) TestHandleAdmin(c *check.C) {
 	owner.etcdClient.Close() //nolint:errcheck
 }
 
+func (s *ownerSuite) TestHandleAdminResumeFromOverwrittenCheckpoint(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	cfID := "test_overwrite_checkpoint"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	capture, err := NewCapture(ctx, []string{s.clientURL.String()}, nil,
+		&security.Credential{}, "127.0.0.1:12034", &processorOpts{})
+	c.Assert(err, check.IsNil)
+	owner, err := NewOwner(ctx, nil, &security.Credential{}, capture.session, DefaultCDCGCSafePointTTL, time.Millisecond*200)
+	c.Assert(err, check.IsNil)
+	defer owner.etcdClient.Close() //nolint:errcheck
+
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://", AdminJobType: model.AdminStop}
+	c.Assert(owner.etcdClient.SaveChangeFeedInfo(ctx, info, cfID), check.IsNil)
+	status := &model.ChangeFeedStatus{
+		ResolvedTs:   200,
+		CheckpointTs: 150,
+		AdminJobType: model.AdminStop,
+		Pause:        &model.PauseInfo{PausedAtTs: 200, Clean: true},
+	}
+	c.Assert(owner.etcdClient.PutChangeFeedStatus(ctx, cfID, status), check.IsNil)
+	// the task keys left by a processor which is not stopped cleanly
+	err = owner.etcdClient.PutTaskStatus(ctx, cfID, "capture_1", &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 150}},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = owner.etcdClient.PutTaskPositionOnChange(ctx, cfID, "capture_1",
+		&model.TaskPosition{CheckPointTs: 180, ResolvedTs: 200})
+	c.Assert(err, check.IsNil)
+
+	resume := func(ts uint64) *model.ChangeFeedInfo {
+		c.Assert(owner.EnqueueJob(model.AdminJob{
+			CfID: cfID,
+			Type: model.AdminResume,
+			Opts: &model.AdminJobOption{OverwriteCheckpointTs: ts},
+		}), check.IsNil)
+		c.Assert(owner.handleAdminJob(ctx), check.IsNil)
+		info, err := owner.etcdClient.GetChangeFeedInfo(ctx, cfID)
+		c.Assert(err, check.IsNil)
+		return info
+	}
+
+	// the changefeed is resumed from the overwritten checkpoint ts, and all
+	// the tables are restarted from it
+	info = resume(120)
+	c.Assert(info.AdminJobType, check.Equals, model.AdminResume)
+	c.Assert(info.Opts[sink.OptSafeModeTs], check.Equals, "200")
+	st, _, err := owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.CheckpointTs, check.Equals, uint64(120))
+	c.Assert(st.ResolvedTs, check.Equals, uint64(120))
+	c.Assert(st.Pause, check.IsNil)
+	taskStatus, err := owner.etcdClient.GetAllTaskStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(taskStatus, check.HasLen, 0)
+	positions, err := owner.etcdClient.GetAllTaskPositions(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(positions, check.HasLen, 0)
+	events := owner.history.pendingEvents(cfID)
+	c.Assert(events, check.HasLen, 2)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventOverwriteCheckpoint)
+	c.Assert(events[0].Ts, check.Equals, uint64(120))
+	c.Assert(events[0].Message, check.Equals, "the checkpoint ts is overwritten from 200 to 120")
+	c.Assert(events[1].Type, check.Equals, model.ChangefeedEventResume)
+
+	// the running changefeed can't be resumed from another checkpoint ts
+	info = resume(100)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.CheckpointTs, check.Equals, uint64(120))
+
+	// the safe mode ts isn't decreased if the replayed range is not
+	// replicated before the changefeed is paused again
+	st.AdminJobType = model.AdminStop
+	st.CheckpointTs = 130
+	c.Assert(owner.etcdClient.PutChangeFeedStatus(ctx, cfID, st), check.IsNil)
+	info = resume(110)
+	c.Assert(info.Opts[sink.OptSafeModeTs], check.Equals, "200")
+
+	// the safe mode isn't enabled if the checkpoint ts is moved forward
+	delete(info.Opts, sink.OptSafeModeTs)
+	c.Assert(owner.etcdClient.SaveChangeFeedInfo(ctx, info, cfID), check.IsNil)
+	st.CheckpointTs = 130
+	c.Assert(owner.etcdClient.PutChangeFeedStatus(ctx, cfID, st), check.IsNil)
+	info = resume(300)
+	_, ok := info.Opts[sink.OptSafeModeTs]
+	c.Assert(ok, check.IsFalse)
+	st, _, err = owner.etcdClient.GetChangeFeedStatus(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.CheckpointTs, check.Equals, uint64(300))
+}
+
+func (s *ownerSuite) TestUpdateBudget(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	cfID := "test_update_budget"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	capture, err := NewCapture(ctx, []string{s.clientURL.String()}, nil,
+		&security.Credential{}, "127.0.0.1:12034", &processorOpts{})
+	c.Assert(err, check.IsNil)
+	owner, err := NewOwner(ctx, nil, &security.Credential{}, capture.session, DefaultCDCGCSafePointTTL, time.Millisecond*200)
+	c.Assert(err, check.IsNil)
+	defer owner.etcdClient.Close() //nolint:errcheck
+
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://", Config: config.GetDefaultReplicaConfig()}
+	c.Assert(owner.etcdClient.SaveChangeFeedInfo(ctx, info, cfID), check.IsNil)
+	owner.changeFeeds[cfID] = &changeFeed{
+		id:     cfID,
+		info:   info,
+		status: &model.ChangeFeedStatus{CheckpointTs: 100},
+	}
+
+	// the updates are merged, the negative values are not changed
+	owner.UpdateBudget(cfID, 1024, -1, "client-1")
+	owner.UpdateBudget(cfID, -1, 10, "client-2")
+	// the update of the changefeed not running is ignored
+	owner.UpdateBudget("not_running", 1024, 10, "client-1")
+	c.Assert(owner.updateBudgets(ctx), check.IsNil)
+	info, err = owner.etcdClient.GetChangeFeedInfo(ctx, cfID)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Config.Budget, check.DeepEquals, &config.BudgetConfig{MemoryQuota: 1024, EventsPerSecond: 10})
+	_, err = owner.etcdClient.GetChangeFeedInfo(ctx, "not_running")
+	c.Assert(cerror.ErrChangeFeedNotExists.Equal(err), check.IsTrue)
+	events := owner.history.pendingEvents(cfID)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, model.ChangefeedEventUpdateBudget)
+	c.Assert(events[0].Client, check.Equals, "client-2")
+	c.Assert(events[0].Message, check.Equals, "the budget is updated to memory-quota=1024, events-per-second=10")
+
+	// the commands are consumed
+	c.Assert(owner.updateBudgets(ctx), check.IsNil)
+	c.Assert(owner.history.pendingEvents(cfID), check.HasLen, 1)
+}
+
 func (s *ownerSuite) TestChangefeedApplyDDLJob(c *check.C) {
 	defer testleak.AfterTest(c)()
 	var (
@@ -830,7 +1098,7 @@ func (s *ownerSuite) TestWatchCampaignKey(c *check.C) {
 	// ensure the watch loop has started
 	time.Sleep(time.Millisecond * 100)
 	etcdCli := owner.etcdClient.Client.Unwrap()
-	key := fmt.Sprintf("%s/%x", kv.CaptureOwnerKey, owner.session.Lease())
+	key := fmt.Sprintf("%s/%x", owner.etcdClient.CaptureOwnerKey(), owner.session.Lease())
 	_, err = etcdCli.Delete(ctx, key)
 	c.Assert(err, check.IsNil)
 	wg.Wait()
@@ -1030,3 +1298,498 @@ func (s *ownerSuite) TestWatchFeedChange(c *check.C) {
 		c.Assert(errors.Cause(err), check.Equals, context.Canceled)
 	}
 }
+
+func (s *ownerSuite) TestMoveTableFromDrainBoundary(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changefeedID := "test-move-table"
+	source := &model.TaskStatus{
+		Tables:        map[model.TableID]*model.TableReplicaInfo{2: {StartTs: 10}},
+		DrainBoundary: map[model.TableID]model.Ts{1: 120, 3: 130},
+	}
+	target := &model.TaskStatus{}
+	for captureID, status := range map[model.CaptureID]*model.TaskStatus{"source": source, "target": target} {
+		err := s.client.PutTaskStatus(ctx, changefeedID, captureID, status)
+		c.Assert(err, check.IsNil)
+	}
+	cf := &changeFeed{
+		id:           changefeedID,
+		etcdCli:      s.client,
+		status:       &model.ChangeFeedStatus{CheckpointTs: 100},
+		orphanTables: make(map[model.TableID]model.Ts),
+		taskStatus: model.ProcessorsInfos{
+			"source": source.Clone(),
+			"target": target.Clone(),
+		},
+		moveTableJobs: map[model.TableID]*model.MoveTableJob{
+			1: {
+				From: "source", To: "target", TableID: 1,
+				TableReplicaInfo: &model.TableReplicaInfo{StartTs: 100},
+				Status:           model.MoveTableStatusDeleted,
+			},
+		},
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"source": {ID: "source"},
+		"target": {ID: "target"},
+	}
+	err := cf.handleMoveTableJobs(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.moveTableJobs, check.HasLen, 0)
+
+	// the table starts from the drain boundary instead of the checkpoint ts
+	_, status, err := s.client.GetTaskStatus(ctx, changefeedID, "target")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(120))
+	c.Assert(status.Operation[1].BoundaryTs, check.Equals, uint64(120))
+
+	// the consumed drain boundary is removed from the source capture
+	_, status, err = s.client.GetTaskStatus(ctx, changefeedID, "source")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.DrainBoundary, check.DeepEquals, map[model.TableID]model.Ts{3: 130})
+	c.Assert(status.Tables, check.HasLen, 1)
+
+	// the table without a drain boundary starts from the checkpoint ts
+	cf.moveTableJobs = map[model.TableID]*model.MoveTableJob{
+		2: {
+			From: "source", To: "target", TableID: 2,
+			TableReplicaInfo: &model.TableReplicaInfo{StartTs: 10},
+			Status:           model.MoveTableStatusDeleted,
+		},
+	}
+	// the processor of the target capture finishes adding the table
+	_, status, err = s.client.GetTaskStatus(ctx, changefeedID, "target")
+	c.Assert(err, check.IsNil)
+	status.Operation = nil
+	err = s.client.PutTaskStatus(ctx, changefeedID, "target", status)
+	c.Assert(err, check.IsNil)
+	cf.taskStatus["target"] = status
+	err = cf.handleMoveTableJobs(ctx, captures)
+	c.Assert(err, check.IsNil)
+	_, status, err = s.client.GetTaskStatus(ctx, changefeedID, "target")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[2].StartTs, check.Equals, uint64(100))
+}
+
+func (s *ownerSuite) TestFinishStuckOperation(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the table 1 is moved from the source capture, but the signal of the
+	// operation done is lost after the processor removed the table
+	changefeedID := "test-stuck-operation"
+	source := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 10}, 2: {StartTs: 10}},
+	}
+	source.RemoveTable(1, 100)
+	source.Operation[1].Status = model.OperProcessed
+	dispatchTime := time.Now().Add(-2 * stuckOperationThreshold)
+	source.Operation[1].DispatchTime = &dispatchTime
+	target := &model.TaskStatus{}
+	for captureID, status := range map[model.CaptureID]*model.TaskStatus{"source": source, "target": target} {
+		err := s.client.PutTaskStatus(ctx, changefeedID, captureID, status)
+		c.Assert(err, check.IsNil)
+	}
+	err := s.client.SaveChangeFeedInfo(ctx, &model.ChangeFeedInfo{SinkURI: "blackhole://"}, changefeedID)
+	c.Assert(err, check.IsNil)
+	cf := &changeFeed{
+		id:            changefeedID,
+		etcdCli:       s.client,
+		status:        &model.ChangeFeedStatus{CheckpointTs: 100},
+		tables:        map[model.TableID]model.TableName{1: {Table: "t1"}, 2: {Table: "t2"}},
+		orphanTables:  make(map[model.TableID]model.Ts),
+		toCleanTables: make(map[model.TableID]model.Ts),
+		taskStatus: model.ProcessorsInfos{
+			"source": source.Clone(),
+			"target": target.Clone(),
+		},
+		moveTableJobs: map[model.TableID]*model.MoveTableJob{
+			1: {
+				From: "source", To: "target", TableID: 1,
+				TableReplicaInfo: &model.TableReplicaInfo{StartTs: 100},
+				Status:           model.MoveTableStatusDeleted,
+			},
+		},
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"source": {ID: "source"},
+		"target": {ID: "target"},
+	}
+	refresh := func() {
+		taskStatus, err := s.client.GetAllTaskStatus(ctx, changefeedID)
+		c.Assert(err, check.IsNil)
+		cf.taskStatus = taskStatus
+	}
+
+	// the move job is blocked by the stuck operation, which is flagged
+	err = cf.handleMoveTableJobs(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.moveTableJobs, check.HasLen, 1)
+	c.Assert(cf.stuckOperations(time.Now()), check.HasLen, 1)
+	c.Assert(cf.stuckOperations(time.Now())[0], check.Matches, "delete \\(processed\\) of table 1 on capture source is pending for .*")
+	operations, err := ListChangefeedOperations(ctx, s.client, changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(operations, check.HasLen, 1)
+	c.Assert(operations[0].CaptureID, check.Equals, "source")
+	c.Assert(operations[0].TableID, check.Equals, model.TableID(1))
+	c.Assert(operations[0].Stuck, check.IsTrue)
+
+	// the manual finish unblocks the move job, the table is added to the
+	// target capture from the boundary ts of the delete operation
+	_, _, err = s.client.FinishTableOperation(ctx, changefeedID, "source", 1, "root@localhost")
+	c.Assert(err, check.IsNil)
+	refresh()
+	c.Assert(cf.stuckOperations(time.Now()), check.HasLen, 0)
+	cf.status.CheckpointTs = 110
+	err = cf.handleMoveTableJobs(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.moveTableJobs, check.HasLen, 0)
+	_, status, err := s.client.GetTaskStatus(ctx, changefeedID, "target")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1].StartTs, check.Equals, uint64(100))
+	c.Assert(status.Operation[1].BoundaryTs, check.Equals, uint64(100))
+	_, status, err = s.client.GetTaskStatus(ctx, changefeedID, "source")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.DrainBoundary, check.HasLen, 0)
+
+	// the table 2 is being moved when the owner is changed, the move job of
+	// the new owner is lost
+	_, _, err = s.client.AtomicPutTaskStatus(ctx, changefeedID, "source", func(_ int64, status *model.TaskStatus) (bool, error) {
+		status.RemoveTable(2, 110)
+		status.Operation[2].Status = model.OperProcessed
+		return true, nil
+	})
+	c.Assert(err, check.IsNil)
+	refresh()
+	c.Assert(cf.reconcileFinishedDeletes(ctx), check.IsNil)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	_, _, err = s.client.FinishTableOperation(ctx, changefeedID, "source", 2, "root@localhost")
+	c.Assert(err, check.IsNil)
+	refresh()
+	c.Assert(cf.reconcileFinishedDeletes(ctx), check.IsNil)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{2: 110})
+	_, status, err = s.client.GetTaskStatus(ctx, changefeedID, "source")
+	c.Assert(err, check.IsNil)
+	_, exist := status.Operation[2]
+	c.Assert(exist, check.IsFalse)
+	c.Assert(status.DrainBoundary, check.HasLen, 0)
+
+	// the table dispatched again isn't reconciled
+	c.Assert(cf.reconcileFinishedDeletes(ctx), check.IsNil)
+	c.Assert(cf.isLostTable(1), check.IsFalse)
+}
+
+func newRecoverTestJob(tp timodel.ActionType, tableID model.TableID, name string, finishedTs model.Ts) *timodel.Job {
+	return &timodel.Job{
+		ID:       int64(finishedTs),
+		SchemaID: 1,
+		TableID:  tableID,
+		Type:     tp,
+		State:    timodel.JobStateSynced,
+		BinlogInfo: &timodel.HistoryInfo{
+			SchemaVersion: int64(finishedTs),
+			FinishedTS:    finishedTs,
+			TableInfo: &timodel.TableInfo{
+				ID:         tableID,
+				Name:       timodel.NewCIStr(name),
+				PKIsHandle: true,
+				Columns: []*timodel.ColumnInfo{
+					{ID: 1, FieldType: types.FieldType{Flag: mysql.PriKeyFlag}, State: timodel.StatePublic},
+				},
+			},
+		},
+	}
+}
+
+func (s *ownerSuite) newRecoverTestChangefeed(c *check.C) *changeFeed {
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	txn, err := store.Begin()
+	c.Assert(err, check.IsNil)
+	defer txn.Rollback() //nolint:errcheck
+	schemaSnap, err := entry.NewSingleSchemaSnapshotFromMeta(meta.NewMeta(txn), 0, false)
+	c.Assert(err, check.IsNil)
+	err = schemaSnap.HandleDDL(&timodel.Job{
+		ID:         1,
+		SchemaID:   1,
+		Type:       timodel.ActionCreateSchema,
+		State:      timodel.JobStateSynced,
+		BinlogInfo: &timodel.HistoryInfo{SchemaVersion: 1, DBInfo: &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test")}},
+	})
+	c.Assert(err, check.IsNil)
+
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Filter.Rules = []string{"test.t*"}
+	f, err := filter.NewFilter(cfg)
+	c.Assert(err, check.IsNil)
+	partitionPolicy, err := newPartitionPolicyMatcher(cfg)
+	c.Assert(err, check.IsNil)
+	return &changeFeed{
+		id:              "test-recover-table",
+		info:            &model.ChangeFeedInfo{Config: cfg},
+		status:          &model.ChangeFeedStatus{ResolvedTs: 100, CheckpointTs: 100},
+		etcdCli:         s.client,
+		schema:          schemaSnap,
+		schemas:         make(map[model.SchemaID]tableIDMap),
+		tables:          make(map[model.TableID]model.TableName),
+		partitions:      make(map[model.TableID][]int64),
+		orphanTables:    make(map[model.TableID]model.Ts),
+		toCleanTables:   make(map[model.TableID]model.Ts),
+		taskStatus:      make(model.ProcessorsInfos),
+		filter:          f,
+		scheduler:       scheduler.NewScheduler(cfg.Scheduler.Tp),
+		partitionPolicy: partitionPolicy,
+	}
+}
+
+func (s *ownerSuite) TestChangefeedApplyRecoverTableJob(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	cf := s.newRecoverTestChangefeed(c)
+	applyJob := func(job *timodel.Job) {
+		err := cf.schema.HandleDDL(job)
+		c.Assert(err, check.IsNil)
+		_, err = cf.applyJob(context.Background(), job)
+		c.Assert(err, check.IsNil)
+	}
+
+	applyJob(newRecoverTestJob(timodel.ActionCreateTable, 47, "t1", 100))
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 100})
+	// the table is dispatched to a processor
+	delete(cf.orphanTables, 47)
+
+	// the recovered table is added again from the commit ts of the recover job
+	applyJob(newRecoverTestJob(timodel.ActionDropTable, 47, "t1", 110))
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 110})
+	applyJob(newRecoverTestJob(timodel.ActionRecoverTable, 47, "t1", 120))
+	c.Assert(cf.tables, check.DeepEquals, map[model.TableID]model.TableName{47: {Schema: "test", Table: "t1"}})
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 120})
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 110})
+	delete(cf.orphanTables, 47)
+	delete(cf.toCleanTables, 47)
+
+	// the table flashed back to a new name is filtered by the new name
+	applyJob(newRecoverTestJob(timodel.ActionDropTable, 47, "t1", 130))
+	applyJob(newRecoverTestJob(timodel.ActionRecoverTable, 47, "ignored", 140))
+	c.Assert(cf.tables, check.HasLen, 0)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	c.Assert(cf.toCleanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 130})
+	applyJob(newRecoverTestJob(timodel.ActionDropTable, 47, "ignored", 150))
+	applyJob(newRecoverTestJob(timodel.ActionRecoverTable, 47, "t2", 160))
+	c.Assert(cf.tables, check.DeepEquals, map[model.TableID]model.TableName{47: {Schema: "test", Table: "t2"}})
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 160})
+}
+
+func (s *ownerSuite) TestBalanceRecoveredTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cf := s.newRecoverTestChangefeed(c)
+	err := cf.schema.HandleDDL(newRecoverTestJob(timodel.ActionCreateTable, 47, "t1", 100))
+	c.Assert(err, check.IsNil)
+	status := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{47: {StartTs: 100}},
+	}
+	err = s.client.PutTaskStatus(ctx, cf.id, "capture-1", status)
+	c.Assert(err, check.IsNil)
+	cf.taskStatus["capture-1"] = status.Clone()
+	captures := map[model.CaptureID]*model.CaptureInfo{"capture-1": {ID: "capture-1"}}
+
+	// the table is dropped and recovered before the removal is dispatched
+	cf.toCleanTables[47] = 110
+	cf.orphanTables[47] = 120
+	err = cf.balanceOrphanTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.toCleanTables, check.HasLen, 0)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 120})
+	_, status, err = s.client.GetTaskStatus(ctx, cf.id, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.HasLen, 0)
+	c.Assert(status.Operation[47], check.DeepEquals,
+		&model.TableOperation{Delete: true, BoundaryTs: 110, DispatchTime: status.Operation[47].DispatchTime})
+
+	// the add operation doesn't overwrite the delete one not applied yet
+	err = cf.balanceOrphanTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 120})
+
+	// the processor finishes removing the table
+	status.Operation[47].Done = true
+	status.Operation[47].Status = model.OperFinished
+	err = s.client.PutTaskStatus(ctx, cf.id, "capture-1", status)
+	c.Assert(err, check.IsNil)
+	cf.taskStatus["capture-1"] = status.Clone()
+	err = cf.balanceOrphanTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	_, status, err = s.client.GetTaskStatus(ctx, cf.id, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[47].StartTs, check.Equals, uint64(120))
+	c.Assert(status.Operation[47].Delete, check.IsFalse)
+	c.Assert(status.Operation[47].BoundaryTs, check.Equals, uint64(120))
+}
+
+func (s *ownerSuite) TestObserverNeverScheduled(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	owner := &Owner{
+		etcdClient: s.client,
+		captures:   make(map[model.CaptureID]*model.CaptureInfo),
+	}
+	observer := &model.CaptureInfo{ID: "capture-observer", Observer: true}
+	owner.addCapture(observer)
+	c.Assert(owner.captures, check.HasLen, 0)
+
+	cf := s.newRecoverTestChangefeed(c)
+	owner.changeFeeds = map[model.ChangeFeedID]*changeFeed{cf.id: cf}
+	err := cf.schema.HandleDDL(newRecoverTestJob(timodel.ActionCreateTable, 47, "t1", 100))
+	c.Assert(err, check.IsNil)
+	cf.orphanTables[47] = 100
+
+	// the orphan table waits for a capture which isn't an observer
+	err = cf.balanceOrphanTables(ctx, owner.captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{47: 100})
+
+	owner.addCapture(&model.CaptureInfo{ID: "capture-1"})
+	c.Assert(owner.captures, check.HasLen, 1)
+	err = cf.balanceOrphanTables(ctx, owner.captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	_, status, err := s.client.GetTaskStatus(ctx, cf.id, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.HasKey, model.TableID(47))
+	_, _, err = s.client.GetTaskStatus(ctx, cf.id, observer.ID)
+	c.Assert(cerror.ErrTaskStatusNotExists.Equal(err), check.IsTrue)
+
+	// removing the observer doesn't touch the tables of the changefeeds
+	owner.removeCapture(observer)
+	c.Assert(owner.captures, check.HasLen, 1)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+}
+
+func (s *ownerSuite) TestSwapTruncatedTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cf := s.newRecoverTestChangefeed(c)
+	applyJob := func(job *timodel.Job) {
+		preTable, err := cf.schema.PreTableInfo(job)
+		c.Assert(err, check.IsNil)
+		err = cf.schema.HandleDDL(job)
+		c.Assert(err, check.IsNil)
+		_, err = cf.applyJob(ctx, job)
+		c.Assert(err, check.IsNil)
+		cf.swapTables(entry.TruncateTableSwaps(preTable, job), job.BinlogInfo.FinishedTS)
+	}
+	captures := map[model.CaptureID]*model.CaptureInfo{
+		"capture-1": {ID: "capture-1"},
+		"capture-2": {ID: "capture-2"},
+	}
+	applyJob(newRecoverTestJob(timodel.ActionCreateTable, 47, "t1", 100))
+	err := cf.balanceOrphanTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	holder, _, ok := findTaskStatusWithTable(cf.taskStatus, 47)
+	c.Assert(ok, check.IsTrue)
+
+	truncate := newRecoverTestJob(timodel.ActionTruncateTable, 49, "t1", 110)
+	truncate.TableID = 47
+	applyJob(truncate)
+	c.Assert(cf.swappedTables, check.DeepEquals, map[model.TableID]model.TableID{49: 47})
+
+	// the pair is dispatched to the capture of the truncated table in one
+	// operation, the new table is added from the commit ts of the truncate
+	err = cf.balanceOrphanTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.orphanTables, check.HasLen, 0)
+	c.Assert(cf.toCleanTables, check.HasLen, 0)
+	c.Assert(cf.swappedTables, check.HasLen, 0)
+	_, status, err := s.client.GetTaskStatus(ctx, cf.id, holder)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables, check.DeepEquals, map[model.TableID]*model.TableReplicaInfo{49: {StartTs: 110}})
+	c.Assert(status.Operation[47], check.DeepEquals,
+		&model.TableOperation{Delete: true, BoundaryTs: 110, DispatchTime: status.Operation[47].DispatchTime})
+	c.Assert(status.Operation[49], check.DeepEquals,
+		&model.TableOperation{BoundaryTs: 110, Status: model.OperDispatched, SwapTableID: 47, DispatchTime: status.Operation[49].DispatchTime})
+	for captureID := range captures {
+		if captureID != holder {
+			_, _, err := s.client.GetTaskStatus(ctx, cf.id, captureID)
+			c.Assert(cerror.ErrTaskStatusNotExists.Equal(err), check.IsTrue)
+		}
+	}
+}
+
+func (s *ownerSuite) TestDataTableWorkloads(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := &changeFeed{
+		cyclicEnabled: true,
+		taskStatus: model.ProcessorsInfos{
+			"capture-1": {Tables: map[model.TableID]*model.TableReplicaInfo{45: {StartTs: 100, MarkTableID: 60}}},
+			"capture-2": {Tables: map[model.TableID]*model.TableReplicaInfo{47: {StartTs: 100, MarkTableID: 61}}},
+		},
+	}
+	// the workload of the mark table reported by the processor is ignored
+	workloads := model.TaskWorkload{45: {Workload: 1}, 60: {Workload: 1}, 61: {Workload: 1}}
+	c.Assert(cf.dataTableWorkloads(workloads), check.DeepEquals, model.TaskWorkload{45: {Workload: 1}})
+
+	cf.cyclicEnabled = false
+	c.Assert(cf.dataTableWorkloads(workloads), check.HasLen, 3)
+}
+
+func (s *ownerSuite) TestPreviewRebalance(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer s.TearDownTest(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cf := s.newRecoverTestChangefeed(c)
+	workloads := map[model.CaptureID]model.TaskWorkload{
+		"capture-1": {1: {Workload: 1}, 2: {Workload: 1}, 3: {Workload: 1}, 4: {Workload: 1}, 5: {Workload: 1}, 6: {Workload: 1}},
+		"capture-2": {7: {Workload: 1}},
+		"capture-3": {},
+	}
+	captures := make(map[model.CaptureID]*model.CaptureInfo)
+	for captureID, workload := range workloads {
+		workload := workload
+		err := s.client.PutTaskWorkload(ctx, cf.id, captureID, &workload)
+		c.Assert(err, check.IsNil)
+		captures[captureID] = &model.CaptureInfo{ID: captureID}
+	}
+	owner := &Owner{
+		changeFeeds: map[model.ChangeFeedID]*changeFeed{cf.id: cf},
+		captures:    captures,
+	}
+
+	// the preview moves no table
+	plan, err := owner.PreviewRebalance(ctx, cf.id)
+	c.Assert(err, check.IsNil)
+	c.Assert(plan.Moves, check.HasLen, 3)
+	c.Assert(plan.SkewnessAfter < plan.SkewnessBefore, check.IsTrue)
+	c.Assert(cf.moveTableJobs, check.HasLen, 0)
+	again, err := owner.PreviewRebalance(ctx, cf.id)
+	c.Assert(err, check.IsNil)
+	c.Assert(again, check.DeepEquals, plan)
+
+	// the applied rebalance moves the tables of the preview
+	cf.rebalanceNextTick = true
+	err = cf.rebalanceTables(ctx, captures)
+	c.Assert(err, check.IsNil)
+	c.Assert(cf.moveTableJobs, check.DeepEquals, plan.MoveTableJobs())
+
+	_, err = owner.PreviewRebalance(ctx, "not-exist")
+	c.Assert(cerror.ErrChangeFeedNotExists.Equal(err), check.IsTrue)
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/scheduler"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+)
+
+// partitionPolicyMatcher matches the partitioned tables with the partition
+// policies of a changefeed. The partitions of the tables which don't match any
+// policy are spread across the captures. A nil matcher means there is no
+// policy.
+type partitionPolicyMatcher struct {
+	rules []struct {
+		filter.Filter
+		coLocate bool
+	}
+}
+
+// newPartitionPolicyMatcher creates a partitionPolicyMatcher, nil is returned
+// if there is no partition policy in the config.
+func newPartitionPolicyMatcher(cfg *config.ReplicaConfig) (*partitionPolicyMatcher, error) {
+	if cfg.Scheduler == nil || len(cfg.Scheduler.PartitionPolicies) == 0 {
+		return nil, nil
+	}
+	m := &partitionPolicyMatcher{}
+	for _, rule := range cfg.Scheduler.PartitionPolicies {
+		f, err := filter.Parse(rule.Matcher)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if !cfg.CaseSensitive {
+			f = filter.CaseInsensitive(f)
+		}
+		m.rules = append(m.rules, struct {
+			filter.Filter
+			coLocate bool
+		}{Filter: f, coLocate: rule.Policy == config.PartitionPolicyCoLocate})
+	}
+	return m, nil
+}
+
+// coLocate returns whether the partitions of the table should be placed in
+// the same capture, the first matched rule wins
+func (m *partitionPolicyMatcher) coLocate(name model.TableName) bool {
+	if m == nil {
+		return false
+	}
+	for _, rule := range m.rules {
+		if rule.MatchTable(name.Schema, name.Table) {
+			return rule.coLocate
+		}
+	}
+	return false
+}
+
+// tableGroups returns the groups of the partitions, keyed by the partition IDs
+func (m *partitionPolicyMatcher) tableGroups(
+	partitions map[model.TableID][]int64, tables map[model.TableID]model.TableName,
+) map[model.TableID]scheduler.TableGroup {
+	groups := make(map[model.TableID]scheduler.TableGroup)
+	for tableID, partitionIDs := range partitions {
+		group := scheduler.TableGroup{ID: tableID, CoLocate: m.coLocate(tables[tableID])}
+		for _, partitionID := range partitionIDs {
+			groups[partitionID] = group
+		}
+	}
+	return groups
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/scheduler"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type partitionPolicySuite struct{}
+
+var _ = check.Suite(&partitionPolicySuite{})
+
+func (s *partitionPolicySuite) TestPartitionPolicyMatcher(c *check.C) {
+	defer testleak.AfterTest(c)()
+	partitions := map[model.TableID][]int64{1: {11, 12}, 2: {21}}
+	tables := map[model.TableID]model.TableName{
+		1: {Schema: "test", Table: "orders"},
+		2: {Schema: "test", Table: "users"},
+		3: {Schema: "test", Table: "items"},
+	}
+
+	cfg := config.GetDefaultReplicaConfig()
+	m, err := newPartitionPolicyMatcher(cfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.IsNil)
+	// the partitions are spread by default
+	c.Assert(m.tableGroups(partitions, tables), check.DeepEquals, map[model.TableID]scheduler.TableGroup{
+		11: {ID: 1}, 12: {ID: 1}, 21: {ID: 2},
+	})
+
+	cfg.CaseSensitive = false
+	cfg.Scheduler.PartitionPolicies = []*config.PartitionPolicyRule{
+		{Matcher: []string{"TEST.ORDERS"}, Policy: config.PartitionPolicyCoLocate},
+		{Matcher: []string{"test.*"}, Policy: config.PartitionPolicySpread},
+	}
+	m, err = newPartitionPolicyMatcher(cfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.tableGroups(partitions, tables), check.DeepEquals, map[model.TableID]scheduler.TableGroup{
+		11: {ID: 1, CoLocate: true}, 12: {ID: 1, CoLocate: true}, 21: {ID: 2},
+	})
+
+	cfg.Scheduler.PartitionPolicies = []*config.PartitionPolicyRule{{Matcher: []string{"[test.a"}}}
+	_, err = newPartitionPolicyMatcher(cfg)
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrFilterRuleInvalid.*")
+}
@@ -14,10 +14,12 @@
 package cdc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -28,18 +30,22 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/ticdc/cdc/entry"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	cdcprocessor "github.com/pingcap/ticdc/cdc/processor"
 	"github.com/pingcap/ticdc/cdc/puller"
-	psorter "github.com/pingcap/ticdc/cdc/puller/sorter"
 	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/leaktest"
 	"github.com/pingcap/ticdc/pkg/notify"
 	"github.com/pingcap/ticdc/pkg/regionspan"
 	"github.com/pingcap/ticdc/pkg/retry"
 	"github.com/pingcap/ticdc/pkg/security"
+	"github.com/pingcap/ticdc/pkg/timewheel"
 	"github.com/pingcap/ticdc/pkg/util"
 	tidbkv "github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -62,24 +68,91 @@ const (
 	defaultMemBufferCapacity int64 = 10 * 1024 * 1024 * 1024 // 10G
 
 	defaultSyncResolvedBatch = 1024
-
-	schemaStorageGCLag = time.Minute * 20
+	// syncResolvedCheckInterval is the interval of checking whether the
+	// pending resolved ts can be acted upon in syncResolved
+	syncResolvedCheckInterval = 100 * time.Millisecond
+
+	// defaultOpDoneChanSize is the buffer size of the operation done signals,
+	// signals are not sent if it's full, and they are retried later.
+	defaultOpDoneChanSize = 1024
+
+	// scanProgressFlushInterval is the interval to flush the task position
+	// with the incremental scan progress while tables are initializing.
+	scanProgressFlushInterval = time.Second * 5
+
+	// maxReportedTableResolvedTs is the max number of the tables whose
+	// resolved ts is reported in the task position, only the slowest tables
+	// are reported.
+	maxReportedTableResolvedTs = 32
+
+	// tableNameTimeout is the max duration to wait for the schema snapshot at
+	// the start ts of a new table to be resolved.
+	tableNameTimeout = time.Second * 5
+
+	// schemaCheckTimeout is the max duration to fetch the downstream schema
+	// of a new table.
+	schemaCheckTimeout = time.Second * 10
+
+	// createdTableCheckWait is the max duration to wait for the table created
+	// at its start ts to be created in the downstream, before its downstream
+	// schema is checked.
+	createdTableCheckWait = time.Minute
+	// createdTableCheckInterval is the interval to check whether the table
+	// created at its start ts is created in the downstream.
+	createdTableCheckInterval = time.Second
+
+	// minReceiverTick and maxReceiverTick are the tick intervals of the
+	// receivers of the processor, the receivers back off to maxReceiverTick
+	// if the changefeed is idle.
+	minReceiverTick = 50 * time.Millisecond
+	maxReceiverTick = time.Second
+
+	// processorWheelResolution and processorWheelSlots make the wheel of a
+	// capture, which drives the periodic work of its processors.
+	processorWheelResolution = time.Second
+	processorWheelSlots      = 64
 )
 
+// sinkCloseTimeout is the max duration to wait for the sink to be flushed and
+// closed when the processor is stopped, it's a variable for testing.
+var sinkCloseTimeout = 30 * time.Second
+
 type processor struct {
 	id           string
 	captureInfo  model.CaptureInfo
 	changefeedID string
 	changefeed   model.ChangeFeedInfo
 	limitter     *puller.BlurResourceLimitter
-	stopped      int32
+	// budget limits the resources used by the processor, the limitter is
+	// the memory budget of it.
+	budget *changefeedBudget
+	// budgetConfig is the budget config applied, it's only accessed by the
+	// budgetWorker.
+	budgetConfig *config.BudgetConfig
+	// throttle is the throttle schedule config applied, it's only accessed
+	// by the budgetWorker.
+	throttle *config.ThrottleScheduleConfig
+	// breaker collects the validation failures detected by the sink and the
+	// mounter, which are reported in the task position
+	breaker *validationBreaker
+	stopped int32
+	// stopMu serializes the calls of stop, dirtyStop is set if the sink is not
+	// closed in time by the first call.
+	stopMu    sync.Mutex
+	dirtyStop *model.DirtyStop
 
 	pdCli      pd.Client
 	credential *security.Credential
 	etcdCli    kv.CDCEtcdClient
 	session    *concurrency.Session
+	// sessionDone is set once the session is done, no new operation is
+	// accepted after it
+	sessionDone int32
 
 	sink sink.Sink
+	// wheel drives the periodic work, it's shared by the processors in a
+	// capture, the time.Ticker is used if it's nil.
+	wheel *timewheel.Wheel
 
 	sinkEmittedResolvedTs   uint64
 	globalResolvedTs        uint64
@@ -91,15 +164,30 @@ type processor struct {
 	ddlPuller       puller.Puller
 	ddlPullerCancel context.CancelFunc
 	schemaStorage   *entry.SchemaStorage
-
-	output  chan *model.PolymorphicEvent
-	mounter entry.Mounter
+	schemaGCWorker  *entry.SchemaGCWorker
+	schemaGCFloor   *schemaGCFloor
+
+	// output is the row lane of the processor output, and controlOutput is
+	// the control lane of the resolved events, see outputLane
+	output        chan outputRow
+	controlOutput chan model.Ts
+	outputLanes   sync.Map
+	// outputLaneGen is the generation of the last lane acquired
+	outputLaneGen uint64
+	mounter       entry.Mounter
+	// eventLogFormatter formats the events in the logs
+	eventLogFormatter *model.EventLogFormatter
+	// statistics counts the rows and bytes of each table emitted to the sink
+	statistics *processorStatistics
+	// schemaChecks are the downstream schema checks of the tables to add
+	schemaChecksMu sync.Mutex
+	schemaChecks   map[model.TableID]*tableSchemaCheck
 
 	stateMu           sync.Mutex
 	status            *model.TaskStatus
 	position          *model.TaskPosition
 	tables            map[int64]*tableInfo
-	markTableIDs      map[int64]struct{}
+	markTables        *markTableManager
 	statusModRevision int64
 
 	sinkEmittedResolvedNotifier *notify.Notifier
@@ -108,21 +196,41 @@ type processor struct {
 	localResolvedReceiver       *notify.Receiver
 	localCheckpointTsNotifier   *notify.Notifier
 	localCheckpointTsReceiver   *notify.Receiver
+	globalResolvedTsNotifier    *notify.Notifier
+	// taskStatusChangedCh is notified when the task status is changed by
+	// others, e.g. the owner writes new operations.
+	taskStatusChangedCh chan struct{}
 
 	wg       *errgroup.Group
-	errCh    chan<- error
+	errs     *errorCollector
 	opDoneCh chan int64
+
+	pendingOpMu     sync.Mutex
+	pendingOpTables map[int64]*uint64
 }
 
 type tableInfo struct {
-	id          int64
-	name        string // quoted schema and table, used in metircs only
-	resolvedTs  uint64
-	markTableID int64
-	mResolvedTs uint64
-	sorter      *puller.Rectifier
-	workload    model.WorkloadInfo
-	cancel      context.CancelFunc
+	id   int64
+	name string // quoted schema and table, used in metircs only
+	// tableName is the schema and table name, it's empty if the name is not
+	// found in the schema snapshots
+	tableName  model.TableName
+	resolvedTs uint64
+	markTable  *markTable
+	puller     puller.Puller
+	sorter     tableSorter
+	workload   model.WorkloadInfo
+	cancel     context.CancelFunc
+	// pendingEvents is the number of the events sent to the output channel
+	// but not emitted to the sink yet, it's accessed atomically, and shared
+	// with the dying table replaced by this table.
+	pendingEvents *int64
+	// largeTxn detects the large transactions of the table, it's nil if the
+	// detection is disabled.
+	largeTxn *largeTxnDetector
+	// forced is the resolved ts forced by the unsafe command, it's nil for
+	// the mark tables.
+	forced *forcedResolvedTs
 	// isDying shows that the table is being removed.
 	// In the case the same table is added back before safe removal is finished,
 	// this flag is used to tell whether it's safe to kill the table.
@@ -131,8 +239,8 @@ type tableInfo struct {
 
 func (t *tableInfo) loadResolvedTs() uint64 {
 	tableRts := atomic.LoadUint64(&t.resolvedTs)
-	if t.markTableID != 0 {
-		mTableRts := atomic.LoadUint64(&t.mResolvedTs)
+	if t.markTable != nil {
+		mTableRts := atomic.LoadUint64(&t.markTable.resolvedTs)
 		if mTableRts < tableRts {
 			return mTableRts
 		}
@@ -140,6 +248,13 @@ func (t *tableInfo) loadResolvedTs() uint64 {
 	return tableRts
 }
 
+// isDormant returns true if the sorter of the table is detached since it has
+// no writes
+func (t *tableInfo) isDormant() bool {
+	pipeline, ok := t.sorter.(*tablePipeline)
+	return ok && pipeline != nil && pipeline.isDormant()
+}
+
 // safeStop will stop the table change feed safety
 func (t *tableInfo) safeStop() (stopped bool, checkpointTs model.Ts) {
 	atomic.StoreUint32(&t.isDying, 1)
@@ -162,12 +277,17 @@ func newProcessor(
 	changefeedID string,
 	captureInfo model.CaptureInfo,
 	checkpointTs uint64,
-	errCh chan error,
 	flushCheckpointInterval time.Duration,
+	sharedDDLPuller *sharedDDLPuller,
+	wheel *timewheel.Wheel,
 ) (*processor, error) {
 	etcdCli := session.Client()
 	cdcEtcdCli := kv.NewCDCEtcdClient(ctx, etcdCli)
-	limitter := puller.NewBlurResourceLimmter(defaultMemBufferCapacity)
+	budget := newChangefeedBudget(changefeedID, captureInfo.AdvertiseAddr, changefeed.Config.Budget)
+	if err := budget.updateSchedule(changefeed.Config.ThrottleSchedule); err != nil {
+		log.Warn("invalid throttle schedule, ignore it", util.ZapFieldChangefeed(ctx), zap.Error(err))
+	}
+	limitter := budget.memory
 
 	log.Info("start processor with startts",
 		zap.Uint64("startts", checkpointTs), util.ZapFieldChangefeed(ctx))
@@ -175,8 +295,12 @@ func newProcessor(
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	ddlspans := []regionspan.Span{regionspan.GetDDLSpan(), regionspan.GetAddIndexDDLSpan()}
-	ddlPuller := puller.NewPuller(ctx, pdCli, credential, kvStorage, checkpointTs, ddlspans, limitter, false)
+	// the DDL puller is not limited by the memory budget, as the events
+	// charged by the mounter are only released once the DDLs are pulled
+	ddlPuller := sharedDDLPuller.subscribe(checkpointTs)
+	if ddlPuller == nil {
+		ddlPuller = puller.NewPuller(ctx, pdCli, credential, kvStorage, checkpointTs, ddlSpans(), nil, false)
+	}
 	filter, err := filter.NewFilter(changefeed.Config)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -185,26 +309,37 @@ func newProcessor(
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	eventLogFormatter, err := model.NewEventLogFormatter(changefeed.Config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	sinkEmittedResolvedNotifier := new(notify.Notifier)
 	localResolvedNotifier := new(notify.Notifier)
 	localCheckpointTsNotifier := new(notify.Notifier)
-	sinkEmittedResolvedReceiver, err := sinkEmittedResolvedNotifier.NewReceiver(50 * time.Millisecond)
+	sinkEmittedResolvedReceiver, err := sinkEmittedResolvedNotifier.NewAdaptiveReceiver(minReceiverTick, maxReceiverTick)
 	if err != nil {
 		return nil, err
 	}
-	localResolvedReceiver, err := localResolvedNotifier.NewReceiver(50 * time.Millisecond)
+	localResolvedReceiver, err := localResolvedNotifier.NewAdaptiveReceiver(minReceiverTick, maxReceiverTick)
 	if err != nil {
 		return nil, err
 	}
-	localCheckpointTsReceiver, err := localCheckpointTsNotifier.NewReceiver(50 * time.Millisecond)
+	localCheckpointTsReceiver, err := localCheckpointTsNotifier.NewAdaptiveReceiver(minReceiverTick, maxReceiverTick)
 	if err != nil {
 		return nil, err
 	}
 
+	// the malformed rows skipped by the mounter are quarantined in the sort dir
+	mounter := entry.NewMounter(schemaStorage, changefeed.Config.Mounter, changefeed.Config.EnableOldValue, limitter,
+		entry.QuarantineDir(changefeed.SortDir))
 	p := &processor{
 		id:            uuid.New().String(),
 		limitter:      limitter,
+		budget:        budget,
+		budgetConfig:  changefeed.Config.Budget,
+		throttle:      changefeed.Config.ThrottleSchedule,
+		breaker:       newValidationBreaker(captureInfo.ID, changefeed.Config.CircuitBreaker),
 		captureInfo:   captureInfo,
 		changefeedID:  changefeedID,
 		changefeed:    changefeed,
@@ -213,15 +348,22 @@ func newProcessor(
 		etcdCli:       cdcEtcdCli,
 		session:       session,
 		sink:          sink,
+		wheel:         wheel,
 		ddlPuller:     ddlPuller,
-		mounter:       entry.NewMounter(schemaStorage, changefeed.Config.Mounter.WorkerNum, changefeed.Config.EnableOldValue),
+		mounter:       mounter,
 		schemaStorage: schemaStorage,
-		errCh:         errCh,
+		errs:          newErrorCollector(),
+
+		eventLogFormatter: eventLogFormatter,
+		statistics:        newProcessorStatistics(time.Now()),
 
 		flushCheckpointInterval: flushCheckpointInterval,
 
 		position: &model.TaskPosition{CheckPointTs: checkpointTs},
-		output:   make(chan *model.PolymorphicEvent, defaultOutputChanSize),
+		output:   make(chan outputRow, defaultOutputChanSize),
+		// the resolved events are sent to the control lane, so that they're
+		// not starved behind the rows
+		controlOutput: make(chan model.Ts, defaultControlOutputChanSize),
 
 		sinkEmittedResolvedNotifier: sinkEmittedResolvedNotifier,
 		sinkEmittedResolvedReceiver: sinkEmittedResolvedReceiver,
@@ -233,10 +375,14 @@ func newProcessor(
 		localCheckpointTsNotifier: localCheckpointTsNotifier,
 		localCheckpointTsReceiver: localCheckpointTsReceiver,
 
-		tables:       make(map[int64]*tableInfo),
-		markTableIDs: make(map[int64]struct{}),
+		tables:     make(map[int64]*tableInfo),
+		markTables: newMarkTableManager(),
+
+		globalResolvedTsNotifier: new(notify.Notifier),
+		taskStatusChangedCh:      make(chan struct{}, 1),
 
-		opDoneCh: make(chan int64, 256),
+		opDoneCh:        make(chan int64, defaultOpDoneChanSize),
+		pendingOpTables: make(map[int64]*uint64),
 	}
 	modRevision, status, err := p.etcdCli.GetTaskStatus(ctx, p.changefeedID, p.captureInfo.ID)
 	if err != nil {
@@ -244,6 +390,14 @@ func newProcessor(
 	}
 	p.status = status
 	p.statusModRevision = modRevision
+	// the events before the local checkpoint ts are all flushed to the sink,
+	// so that the snapshots before it are not needed by the mounter anymore.
+	p.schemaGCWorker = entry.NewSchemaGCWorker(schemaStorage, func() uint64 {
+		return atomic.LoadUint64(&p.checkpointTs)
+	})
+	p.schemaGCFloor = newSchemaGCFloor(changefeed.Config.SchemaGC)
+	p.setUpstreamRowReader(ctx, kvStorage)
+	p.setValidationBreaker()
 
 	for tableID, replicaInfo := range p.status.Tables {
 		p.addTable(ctx, tableID, replicaInfo)
@@ -251,57 +405,101 @@ func newProcessor(
 	return p, nil
 }
 
+// setUpstreamRowReader allows the sink to read rows from upstream snapshots for
+// the consistency check, with the schema storage of the processor.
+func (p *processor) setUpstreamRowReader(ctx context.Context, kvStorage tidbkv.Storage) {
+	reader := entry.NewSnapshotRowReader(kvStorage, p.schemaStorage, util.TimezoneFromCtx(ctx))
+	sink.SetUpstreamRowReader(p.sink, reader)
+}
+
+// setValidationBreaker reports the validation failures detected by the sink
+// and the mounter to the circuit breaker of the processor.
+func (p *processor) setValidationBreaker() {
+	sink.SetValidationReporter(p.sink, p.breaker)
+	entry.SetQuarantineObserver(p.mounter, p.breaker.observeQuarantine)
+}
+
 func (p *processor) Run(ctx context.Context) {
 	wg, cctx := errgroup.WithContext(ctx)
 	p.wg = wg
 	ddlPullerCtx, ddlPullerCancel :=
 		context.WithCancel(util.PutTableInfoInCtx(cctx, 0, "ticdc-processor-ddl"))
 	p.ddlPullerCancel = ddlPullerCancel
+	leaktest.AddOwner(p.changefeedID, 0)
+
+	// the errors are collected once the routines return, so the root cause is
+	// recorded before the other routines are canceled
+	goWithOrigin := func(origin string, fn func() error) {
+		deregister := leaktest.Register(origin, p.changefeedID, 0)
+		wg.Go(func() error {
+			defer deregister()
+			err := fn()
+			p.errs.collect(origin, err)
+			return err
+		})
+	}
+
+	goWithOrigin(errOriginSorter, p.checkSortDir)
+
+	goWithOrigin(errOriginSorter, func() error {
+		return p.sortDirCapacityWorker(cctx)
+	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginEtcd, func() error {
 		return p.positionWorker(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginEtcd, func() error {
 		return p.globalStatusWorker(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginEtcd, func() error {
+		return p.taskStatusWorker(cctx)
+	})
+
+	goWithOrigin(errOriginEtcd, func() error {
+		return p.budgetWorker(cctx)
+	})
+
+	goWithOrigin(errOriginSink, func() error {
 		return p.sinkDriver(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginSink, func() error {
 		return p.syncResolved(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginProcessor, func() error {
 		return p.collectMetrics(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginPuller, func() error {
 		return p.ddlPuller.Run(ddlPullerCtx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginPuller, func() error {
 		return p.ddlPullWorker(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginMounter, func() error {
 		return p.mounter.Run(cctx)
 	})
 
-	wg.Go(func() error {
+	goWithOrigin(errOriginProcessor, func() error {
+		return p.schemaGCWorker.Run(cctx)
+	})
+
+	goWithOrigin(errOriginEtcd, func() error {
 		return p.workloadWorker(cctx)
 	})
 
-	go func() {
-		if err := wg.Wait(); err != nil {
-			select {
-			case p.errCh <- err:
-			default:
-			}
-		}
-	}()
+	goWithOrigin(errOriginEtcd, func() error {
+		return p.opDoneWorker(cctx)
+	})
+
+	goWithOrigin(errOriginEtcd, func() error {
+		return p.sessionWatcher(cctx)
+	})
 }
 
 // wait blocks until all routines in processor are returned
@@ -320,15 +518,155 @@ func (p *processor) wait() {
 func (p *processor) writeDebugInfo(w io.Writer) {
 	fmt.Fprintf(w, "changefeedID: %s, info: %+v, status: %+v\n", p.changefeedID, p.changefeed, p.status)
 
+	var dispatchers map[string]string
+	if s, ok := sink.Unwrap(p.sink).(sink.TableDispatchSink); ok {
+		dispatchers = s.TableDispatchers()
+	}
+	var conflicts map[model.TableID]string
+	if s, ok := sink.Unwrap(p.sink).(sink.TableConflictSink); ok {
+		conflicts = s.TableConflicts()
+	}
 	p.stateMu.Lock()
 	for _, table := range p.tables {
-		fmt.Fprintf(w, "\ttable id: %d, resolveTS: %d\n", table.id, table.loadResolvedTs())
+		fmt.Fprintf(w, "\ttable id: %d, resolveTS: %d", table.id, table.loadResolvedTs())
+		if table.isDormant() {
+			fmt.Fprintf(w, ", state: dormant")
+		} else {
+			fmt.Fprintf(w, ", state: active")
+		}
+		if d, ok := dispatchers[table.tableName.QuoteString()]; ok {
+			fmt.Fprintf(w, ", dispatcher: %s", d)
+		}
+		if d, ok := conflicts[table.id]; ok {
+			fmt.Fprintf(w, ", conflicts: %s", d)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if progress := p.scanProgress(); progress != nil {
+		fmt.Fprintf(w, "\tinitializing: %s, scanProgress: %+v\n", progress, *progress)
 	}
 	p.stateMu.Unlock()
+	if p.errs != nil {
+		for _, e := range p.errs.errorStrings() {
+			fmt.Fprintf(w, "\terror: %s\n", e)
+		}
+	}
 
 	fmt.Fprintf(w, "\n")
 }
 
+// metrics samples the key health numbers of the processor at now, the table
+// statistics are returned if the window is not zero.
+func (p *processor) metrics(now time.Time, window time.Duration) *ProcessorMetrics {
+	checkpointTs := atomic.LoadUint64(&p.checkpointTs)
+	resolvedTs := atomic.LoadUint64(&p.localResolvedTs)
+	m := &ProcessorMetrics{
+		CheckpointTs:   checkpointTs,
+		CheckpointLag:  util.TsLag(now, checkpointTs),
+		ResolvedTs:     resolvedTs,
+		ResolvedLag:    util.TsLag(now, resolvedTs),
+		OutputChanSize: len(p.output),
+	}
+	p.stateMu.Lock()
+	m.TableCount = len(p.tables)
+	p.stateMu.Unlock()
+	flushP99, err := observedQuantile(sinkFlushRowChangedDuration.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr), 0.99)
+	if err != nil {
+		log.Warn("failed to get the sink flush duration", zap.String("changefeed", p.changefeedID), zap.Error(err))
+	}
+	m.SinkFlushP99 = flushP99
+	if p.errs != nil {
+		if e := p.errs.first(); e != nil {
+			m.Error = e.String()
+		}
+	}
+	if window > 0 && p.statistics != nil {
+		var covered time.Duration
+		m.Tables, covered = p.statistics.snapshot(window, now)
+		m.Stores = p.statistics.storeSnapshot(window, now)
+		m.StatisticsWindow = covered.Seconds()
+	}
+	return m
+}
+
+// scanProgress sums up the incremental scan progress of all tables while any
+// table is still initializing, it returns nil if all tables are initialized.
+// The caller must hold stateMu.
+func (p *processor) scanProgress() *model.IncrementalScanProgress {
+	progress := new(model.IncrementalScanProgress)
+	initializing := false
+	for _, table := range p.tables {
+		if table.puller == nil {
+			continue
+		}
+		if !table.puller.IsInitialized() {
+			initializing = true
+		}
+		progress.Add(table.puller.ScanProgress())
+	}
+	if !initializing {
+		return nil
+	}
+	return progress
+}
+
+// initializingTables returns the tables whose incremental scan is not
+// finished in ascending order, the caller must hold stateMu.
+func (p *processor) initializingTables() []model.TableID {
+	var tables []model.TableID
+	for _, table := range p.tables {
+		if table.puller != nil && !table.puller.IsInitialized() {
+			tables = append(tables, table.id)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i] < tables[j] })
+	return tables
+}
+
+// slowestTablesResolvedTs returns the resolved ts of the slowest tables, at
+// most maxReportedTableResolvedTs tables are returned to bound the size of the
+// task position, the caller must hold stateMu.
+func (p *processor) slowestTablesResolvedTs() map[model.TableID]model.Ts {
+	if len(p.tables) == 0 {
+		return nil
+	}
+	type tableTs struct {
+		id model.TableID
+		ts model.Ts
+	}
+	tables := make([]tableTs, 0, len(p.tables))
+	for _, table := range p.tables {
+		tables = append(tables, tableTs{id: table.id, ts: table.loadResolvedTs()})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].ts != tables[j].ts {
+			return tables[i].ts < tables[j].ts
+		}
+		return tables[i].id < tables[j].id
+	})
+	if len(tables) > maxReportedTableResolvedTs {
+		tables = tables[:maxReportedTableResolvedTs]
+	}
+	resolvedTs := make(map[model.TableID]model.Ts, len(tables))
+	for _, table := range tables {
+		resolvedTs[table.id] = table.ts
+	}
+	return resolvedTs
+}
+
+// largeTxns returns the large transactions in progress of all tables, the
+// caller must hold stateMu.
+func (p *processor) largeTxns() []*model.LargeTxnInfo {
+	var txns []*model.LargeTxnInfo
+	for _, table := range p.tables {
+		if info := table.largeTxn.info(); info != nil {
+			txns = append(txns, info)
+		}
+	}
+	sort.Slice(txns, func(i, j int) bool { return txns[i].Table < txns[j].Table })
+	return txns
+}
+
 // localResolvedWorker do the flowing works.
 // 1, update resolve ts by scanning all table's resolve ts.
 // 2, update checkpoint ts by consuming entry from p.executedTxns.
@@ -336,6 +674,8 @@ func (p *processor) writeDebugInfo(w io.Writer) {
 // 4, check admin command in TaskStatus and apply corresponding command
 func (p *processor) positionWorker(ctx context.Context) error {
 	lastFlushTime := time.Now()
+	lastScanProgressFlushTime := time.Now()
+	var lastBreakerVersion uint64
 	retryFlushTaskStatusAndPosition := func() error {
 		t0Update := time.Now()
 		err := retry.Run(500*time.Millisecond, 3, func() error {
@@ -353,6 +693,9 @@ func (p *processor) positionWorker(ctx context.Context) error {
 				if p.isStopped() || cerror.ErrAdminStopProcessor.Equal(inErr) {
 					return backoff.Permanent(cerror.ErrAdminStopProcessor.FastGenByArgs())
 				}
+				if cerror.ErrCaptureSessionDone.Equal(inErr) {
+					return backoff.Permanent(inErr)
+				}
 			}
 			return inErr
 		})
@@ -369,7 +712,9 @@ func (p *processor) positionWorker(ctx context.Context) error {
 		p.localResolvedReceiver.Stop()
 		p.localCheckpointTsReceiver.Stop()
 
-		if !p.isStopped() {
+		// the position is not flushed with a done session, the tables may be
+		// rescheduled to other captures already
+		if !p.isStopped() && !p.isSessionDone() {
 			err := retryFlushTaskStatusAndPosition()
 			if err != nil && errors.Cause(err) != context.Canceled {
 				log.Warn("failed to update info before exit", util.ZapFieldChangefeed(ctx), zap.Error(err))
@@ -392,11 +737,20 @@ func (p *processor) positionWorker(ctx context.Context) error {
 			p.stateMu.Lock()
 			for _, table := range p.tables {
 				ts := table.loadResolvedTs()
-
 				if ts < minResolvedTs {
 					minResolvedTs = ts
 				}
 			}
+			tableResolvedTs := p.slowestTablesResolvedTs()
+			p.position.ScanProgress = p.scanProgress()
+			p.position.InitializingTables = p.initializingTables()
+			if cfg := p.changefeed.Config.LargeTxn; cfg != nil && cfg.AnnotateStatus {
+				p.position.LargeTxns = p.largeTxns()
+			}
+			p.position.DroppedEvents = p.droppedEvents()
+			p.position.BudgetExceeded = p.budget.exceededResources()
+			trips, breakerVersion := p.breaker.snapshot()
+			p.position.BreakerTrips = trips
 			p.stateMu.Unlock()
 			atomic.StoreUint64(&p.localResolvedTs, minResolvedTs)
 
@@ -406,11 +760,29 @@ func (p *processor) positionWorker(ctx context.Context) error {
 			metricResolvedTsLagGauge.Set(float64(oracle.GetPhysical(time.Now())-phyTs) / 1e3)
 			resolvedTsGauge.Set(float64(phyTs))
 
-			if p.position.ResolvedTs < minResolvedTs {
-				p.position.ResolvedTs = minResolvedTs
+			if p.position.ResolvedTs < minResolvedTs || breakerVersion != lastBreakerVersion {
+				// the trips of the circuit breaker are reported immediately
+				if p.position.ResolvedTs < minResolvedTs {
+					p.position.ResolvedTs = minResolvedTs
+					// the resolved ts of the tables is only updated with the
+					// resolved ts of the processor, so it doesn't cause the
+					// position to be written by the checkpoint flushes.
+					p.position.TableResolvedTs = tableResolvedTs
+				}
+				if err := retryFlushTaskStatusAndPosition(); err != nil {
+					return errors.Trace(err)
+				}
+				lastBreakerVersion = breakerVersion
+			} else if (p.position.ScanProgress != nil || len(p.position.LargeTxns) != 0 ||
+				len(p.position.BudgetExceeded) != 0) &&
+				time.Since(lastScanProgressFlushTime) >= scanProgressFlushInterval {
+				// the resolved ts is not advanced during the incremental scan
+				// or a large transaction, or it's slowed down by the budget,
+				// flush the position to report the progress periodically.
 				if err := retryFlushTaskStatusAndPosition(); err != nil {
 					return errors.Trace(err)
 				}
+				lastScanProgressFlushTime = time.Now()
 			}
 		case <-p.localCheckpointTsReceiver.C:
 			checkpointTs := atomic.LoadUint64(&p.checkpointTs)
@@ -433,17 +805,24 @@ func (p *processor) positionWorker(ctx context.Context) error {
 				return errors.Trace(err)
 			}
 			lastFlushTime = time.Now()
+		case <-p.taskStatusChangedCh:
+			// handle the new operations in the task status immediately
+			if err := retryFlushTaskStatusAndPosition(); err != nil {
+				return errors.Trace(err)
+			}
 		}
 	}
 }
 
 func (p *processor) ddlPullWorker(ctx context.Context) error {
-	ddlRawKVCh := puller.SortOutput(ctx, p.ddlPuller.Output())
+	ddlRawKVCh, sortErrCh := puller.SortOutput(ctx, p.ddlPuller.Output())
 	var ddlRawKV *model.RawKVEntry
 	for {
 		select {
 		case <-ctx.Done():
 			return errors.Trace(ctx.Err())
+		case err := <-sortErrCh:
+			return errors.Trace(err)
 		case ddlRawKV = <-ddlRawKVCh:
 		}
 		if ddlRawKV == nil {
@@ -464,11 +843,13 @@ func (p *processor) ddlPullWorker(ctx context.Context) error {
 		if err := p.schemaStorage.HandleDDLJob(job); err != nil {
 			return errors.Trace(err)
 		}
+		p.adjustTableSpans(ctx, job)
 	}
 }
 
 func (p *processor) workloadWorker(ctx context.Context) error {
-	t := time.NewTicker(10 * time.Second)
+	t := p.wheel.NewTicker(10 * time.Second)
+	defer t.Stop()
 	err := p.etcdCli.PutTaskWorkload(ctx, p.changefeedID, p.captureInfo.ID, nil)
 	if err != nil {
 		return errors.Trace(err)
@@ -524,6 +905,9 @@ func (p *processor) flushTaskStatusAndPosition(ctx context.Context) error {
 	if p.isStopped() {
 		return cerror.ErrAdminStopProcessor.GenWithStackByArgs()
 	}
+	if p.isSessionDone() {
+		return cerror.ErrCaptureSessionDone.GenWithStackByArgs(p.captureInfo.ID, p.session.Lease())
+	}
 	var tablesToRemove []model.TableID
 	newTaskStatus, newModRevision, err := p.etcdCli.AtomicPutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID,
 		func(modRevision int64, taskStatus *model.TaskStatus) (bool, error) {
@@ -562,7 +946,7 @@ func (p *processor) flushTaskStatusAndPosition(ctx context.Context) error {
 	}
 	// newModRevision == 0 means status is not updated
 	if newModRevision > 0 {
-		p.statusModRevision = newModRevision
+		atomic.StoreInt64(&p.statusModRevision, newModRevision)
 		p.status = newTaskStatus
 	}
 	syncTableNumGauge.
@@ -589,23 +973,45 @@ func (p *processor) removeTable(tableID int64) {
 	}
 	table.cancel()
 	delete(p.tables, tableID)
-	if table.markTableID != 0 {
-		delete(p.markTableIDs, table.markTableID)
+	p.releaseOutputLane(tableID)
+	leaktest.RemoveOwner(p.changefeedID, tableID)
+	if table.markTable != nil {
+		p.markTables.release(table.markTable.id, tableID)
 	}
+	if s, ok := sink.Unwrap(p.sink).(sink.TableDispatchSink); ok && table.tableName.Table != "" {
+		s.RemoveTable(table.tableName)
+	}
+	sink.RemoveAuditedTable(p.sink, tableID)
+	sink.RemoveCompactedTable(p.sink, tableID)
 	tableResolvedTsGauge.DeleteLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, table.name)
+	tableDuplicateEventCounter.DeleteLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, table.name)
+	tableForceDroppedEventCounter.DeleteLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, table.name)
+	largeTxnInProgressGauge.DeleteLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, table.name)
 	syncTableNumGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr).Dec()
 }
 
 // handleTables handles table scheduler on this processor, add or remove table puller
 func (p *processor) handleTables(ctx context.Context, status *model.TaskStatus) (tablesToRemove []model.TableID, err error) {
+	p.schemaGCFloor.observe(status, time.Now())
+	// the truncated tables are removed after the new tables replacing them
+	// are added, so that one of them is always pulled
+	swapping := make(map[model.TableID]struct{})
+	for _, opt := range status.Operation {
+		if !opt.Delete && opt.SwapTableID != 0 && !opt.TableProcessed() {
+			swapping[opt.SwapTableID] = struct{}{}
+		}
+	}
 	for tableID, opt := range status.Operation {
 		if opt.TableProcessed() {
 			continue
 		}
 		if opt.Delete {
+			if _, ok := swapping[tableID]; ok {
+				continue
+			}
 			if opt.BoundaryTs <= p.position.CheckPointTs {
-				table, exist := p.tables[tableID]
-				if !exist {
+				resolvedTs, pendingEvents, err := p.drainTable(tableID)
+				if err != nil {
 					log.Warn("table which will be deleted is not found",
 						util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID))
 					opt.Done = true
@@ -613,17 +1019,17 @@ func (p *processor) handleTables(ctx context.Context, status *model.TaskStatus)
 					status.Dirty = true
 					continue
 				}
-				stopped, checkpointTs := table.safeStop()
-				log.Debug("safeStop table", zap.Int64("tableID", tableID),
-					util.ZapFieldChangefeed(ctx), zap.Bool("stopped", stopped),
-					zap.Uint64("checkpointTs", checkpointTs))
-				if stopped {
-					opt.BoundaryTs = checkpointTs
-					if checkpointTs <= p.position.CheckPointTs {
-						tablesToRemove = append(tablesToRemove, tableID)
-						opt.Done = true
-						opt.Status = model.OperFinished
-					}
+				log.Debug("drain table", zap.Int64("tableID", tableID),
+					util.ZapFieldChangefeed(ctx), zap.Uint64("resolvedTs", resolvedTs),
+					zap.Int("pendingEvents", pendingEvents))
+				if resolvedTs != 0 {
+					// the owner starts the table from the drain boundary
+					// after it's moved to another processor.
+					opt.BoundaryTs = resolvedTs
+					status.SetDrainBoundary(tableID, resolvedTs)
+					tablesToRemove = append(tablesToRemove, tableID)
+					opt.Done = true
+					opt.Status = model.OperFinished
 					status.Dirty = true
 				}
 			}
@@ -635,11 +1041,55 @@ func (p *processor) handleTables(ctx context.Context, status *model.TaskStatus)
 			if p.changefeed.Config.Cyclic.IsEnabled() && replicaInfo.MarkTableID == 0 {
 				return tablesToRemove, cerror.ErrProcessorTableNotFound.GenWithStack("normal table(%d) and mark table not match ", tableID)
 			}
-			p.addTable(ctx, tableID, replicaInfo)
+			// the table is not started if the sort dir has no capacity, the
+			// operation is kept unapplied with the error, and the owner
+			// moves the table to another capture.
+			if _, err := p.checkSortDirCapacity(); cerror.ErrCaptureSortDirCapacity.Equal(err) {
+				log.Warn("table is not added", util.ZapFieldChangefeed(ctx),
+					zap.Int64("tableID", tableID), zap.Error(err))
+				opt.Error = &model.RunningError{
+					Addr:    p.captureInfo.AdvertiseAddr,
+					Code:    string(cerror.ErrCaptureSortDirCapacity.RFCCode()),
+					Message: err.Error(),
+					Origin:  errOriginSorter,
+				}
+				opt.Status = model.OperProcessed
+				status.Dirty = true
+				continue
+			} else if err != nil {
+				log.Warn("check the capacity of the sort dir failed", util.ZapFieldChangefeed(ctx), zap.Error(err))
+			}
+			// the table is not started in the strict mode if the downstream
+			// schema is incompatible, the owner keeps it unscheduled. The
+			// check runs in the background, the operation is kept unapplied
+			// and handled again until the check is done.
+			checked, err := p.checkTableSchema(ctx, tableID, replicaInfo.StartTs, status)
+			if !checked {
+				continue
+			}
+			if err != nil {
+				log.Warn("table is not added", util.ZapFieldChangefeed(ctx),
+					zap.Int64("tableID", tableID), zap.Error(err))
+				opt.Error = &model.RunningError{
+					Addr:    p.captureInfo.AdvertiseAddr,
+					Code:    string(cerror.ErrTableSchemaIncompatible.RFCCode()),
+					Message: err.Error(),
+					Origin:  errOriginSink,
+				}
+				opt.Status = model.OperProcessed
+				status.Dirty = true
+				continue
+			}
+			if opt.SwapTableID != 0 {
+				p.swapTable(ctx, opt.SwapTableID, tableID, replicaInfo)
+			} else {
+				p.addTable(ctx, tableID, replicaInfo)
+			}
 			opt.Status = model.OperProcessed
 			status.Dirty = true
 		}
 	}
+	p.handleForceAdvance(ctx, status)
 
 	for {
 		select {
@@ -677,31 +1127,41 @@ func (p *processor) globalStatusWorker(ctx context.Context) error {
 	log.Info("Global status worker started", util.ZapFieldChangefeed(ctx))
 
 	var (
-		changefeedStatus         *model.ChangeFeedStatus
-		statusRev                int64
-		lastCheckPointTs         uint64
-		lastResolvedTs           uint64
-		watchKey                 = kv.GetEtcdKeyJob(p.changefeedID)
-		globalResolvedTsNotifier = new(notify.Notifier)
+		changefeedStatus *model.ChangeFeedStatus
+		statusRev        int64
+		lastCheckPointTs uint64
+		lastResolvedTs   uint64
+		watchKey         = p.etcdCli.GetEtcdKeyJob(p.changefeedID)
 	)
-	defer globalResolvedTsNotifier.Close()
-	globalResolvedTsReceiver, err := globalResolvedTsNotifier.NewReceiver(1 * time.Second)
+	defer p.globalResolvedTsNotifier.Close()
+	globalResolvedTsReceiver, err := p.globalResolvedTsNotifier.NewReceiver(1 * time.Second)
 	if err != nil {
 		return err
 	}
 
-	updateStatus := func(changefeedStatus *model.ChangeFeedStatus) {
+	// the global status is checked by the guard before the events are emitted
+	guard, err := newCheckpointGuard(ctx, p.etcdCli, p.changefeedID, p.captureInfo, &p.changefeed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := guard.check(ctx, atomic.LoadUint64(&p.checkpointTs)); err != nil {
+		return errors.Trace(err)
+	}
+
+	updateStatus := func(changefeedStatus *model.ChangeFeedStatus) error {
+		if err := guard.check(ctx, changefeedStatus.CheckpointTs); err != nil {
+			return errors.Trace(err)
+		}
 		atomic.StoreUint64(&p.globalcheckpointTs, changefeedStatus.CheckpointTs)
+		p.breaker.setEpoch(changefeedStatus.BreakerEpoch)
 		if lastResolvedTs == changefeedStatus.ResolvedTs &&
 			lastCheckPointTs == changefeedStatus.CheckpointTs {
-			return
+			return nil
 		}
 		if lastCheckPointTs < changefeedStatus.CheckpointTs {
-			// Delay GC to accommodate pullers starting from a startTs that's too small
-			// TODO fix startTs problem and remove GC delay, or use other mechanism that prevents the problem deterministically
-			gcTime := oracle.GetTimeFromTS(changefeedStatus.CheckpointTs).Add(-schemaStorageGCLag)
-			gcTs := oracle.ComposeTS(gcTime.Unix(), 0)
-			p.schemaStorage.DoGC(gcTs)
+			// the pullers of the tables added recently may start from a ts
+			// before the checkpoint ts, the snapshots after it are kept
+			p.schemaGCWorker.Request(p.schemaGCFloor.gcTs(changefeedStatus.CheckpointTs, time.Now()))
 			lastCheckPointTs = changefeedStatus.CheckpointTs
 		}
 		if lastResolvedTs < changefeedStatus.ResolvedTs {
@@ -709,8 +1169,9 @@ func (p *processor) globalStatusWorker(ctx context.Context) error {
 			atomic.StoreUint64(&p.globalResolvedTs, lastResolvedTs)
 			log.Debug("Update globalResolvedTs",
 				zap.Uint64("globalResolvedTs", lastResolvedTs), util.ZapFieldChangefeed(ctx))
-			globalResolvedTsNotifier.Notify()
+			p.globalResolvedTsNotifier.Notify()
 		}
+		return nil
 	}
 
 	go func() {
@@ -730,8 +1191,7 @@ func (p *processor) globalStatusWorker(ctx context.Context) error {
 				select {
 				case <-ctx.Done():
 					return
-				case p.output <- model.NewResolvedPolymorphicEvent(0, globalResolvedTs):
-					// regionID = 0 means the event is produced by TiCDC
+				case p.controlOutput <- globalResolvedTs:
 				}
 			}
 		}
@@ -766,7 +1226,9 @@ func (p *processor) globalStatusWorker(ctx context.Context) error {
 			return errors.Trace(err)
 		}
 
-		updateStatus(changefeedStatus)
+		if err := updateStatus(changefeedStatus); err != nil {
+			return errors.Trace(err)
+		}
 
 		ch := p.etcdCli.Client.Watch(ctx, watchKey, clientv3.WithRev(statusRev+1), clientv3.WithFilterDelete())
 		for resp := range ch {
@@ -781,14 +1243,133 @@ func (p *processor) globalStatusWorker(ctx context.Context) error {
 				if err := status.Unmarshal(ev.Kv.Value); err != nil {
 					return err
 				}
-				updateStatus(&status)
+				if err := updateStatus(&status); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+	}
+}
+
+// taskStatusWorker watches the task status of the processor, and notifies the
+// position worker when the task status is changed by others, so that the new
+// operations written by the owner are handled without waiting for the next
+// flush of the task position.
+func (p *processor) taskStatusWorker(ctx context.Context) error {
+	watchKey := p.etcdCli.GetEtcdKeyTaskStatus(p.changefeedID, p.captureInfo.ID)
+	notify := func() {
+		select {
+		case p.taskStatusChangedCh <- struct{}{}:
+		default:
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Task status worker exited", util.ZapFieldChangefeed(ctx))
+			return ctx.Err()
+		default:
+		}
+
+		resp, err := p.etcdCli.Client.Get(ctx, watchKey)
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		}
+		// the task status may be changed before the watch is (re)started,
+		// e.g. the watch is canceled by the compaction.
+		notify()
+
+		ch := p.etcdCli.Client.Watch(ctx, watchKey, clientv3.WithRev(resp.Header.Revision+1), clientv3.WithFilterDelete())
+		for resp := range ch {
+			if resp.Err() == mvcc.ErrCompacted {
+				log.Info("task status watch is compacted, restart it", util.ZapFieldChangefeed(ctx))
+				break
+			}
+			if resp.Err() != nil {
+				return cerror.WrapError(cerror.ErrProcessorEtcdWatch, resp.Err())
+			}
+			for _, ev := range resp.Events {
+				// skip the changes written by this processor, which are
+				// applied to the local status already.
+				if ev.Kv.ModRevision == atomic.LoadInt64(&p.statusModRevision) {
+					continue
+				}
+				notify()
 			}
 		}
 	}
 }
 
+// budgetWorker watches the changefeed info, and applies the budget config on
+// the change, so that the budget can be adjusted without restarting the
+// changefeed.
+func (p *processor) budgetWorker(ctx context.Context) error {
+	watchKey := p.etcdCli.GetEtcdKeyChangeFeedInfo(p.changefeedID)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Budget worker exited", util.ZapFieldChangefeed(ctx))
+			return ctx.Err()
+		default:
+		}
+
+		resp, err := p.etcdCli.Client.Get(ctx, watchKey)
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPDEtcdAPIError, err)
+		}
+		if len(resp.Kvs) != 0 {
+			p.applyBudget(ctx, resp.Kvs[0].Value)
+		}
+
+		ch := p.etcdCli.Client.Watch(ctx, watchKey, clientv3.WithRev(resp.Header.Revision+1), clientv3.WithFilterDelete())
+		for resp := range ch {
+			if resp.Err() == mvcc.ErrCompacted {
+				log.Info("changefeed info watch is compacted, restart it", util.ZapFieldChangefeed(ctx))
+				break
+			}
+			if resp.Err() != nil {
+				return cerror.WrapError(cerror.ErrProcessorEtcdWatch, resp.Err())
+			}
+			for _, ev := range resp.Events {
+				p.applyBudget(ctx, ev.Kv.Value)
+			}
+		}
+	}
+}
+
+// applyBudget applies the budget config and the throttle schedule config in
+// the raw changefeed info.
+func (p *processor) applyBudget(ctx context.Context, rawInfo []byte) {
+	info := &model.ChangeFeedInfo{}
+	if err := info.Unmarshal(rawInfo); err != nil {
+		log.Warn("unmarshal changefeed info failed", util.ZapFieldChangefeed(ctx), zap.Error(err))
+		return
+	}
+	if info.Config == nil {
+		return
+	}
+	if info.Config.Budget != nil && (p.budgetConfig == nil || *p.budgetConfig != *info.Config.Budget) {
+		log.Info("the budget of the changefeed is updated", util.ZapFieldChangefeed(ctx),
+			zap.Any("old", p.budgetConfig), zap.Any("new", info.Config.Budget))
+		p.budgetConfig = info.Config.Budget
+		p.budget.update(p.budgetConfig)
+	}
+	if !reflect.DeepEqual(p.throttle, info.Config.ThrottleSchedule) {
+		log.Info("the throttle schedule of the changefeed is updated", util.ZapFieldChangefeed(ctx),
+			zap.Any("old", p.throttle), zap.Any("new", info.Config.ThrottleSchedule))
+		// the invalid schedule is recorded as well, so that it's not warned
+		// on every change of the info
+		p.throttle = info.Config.ThrottleSchedule
+		if err := p.budget.updateSchedule(p.throttle); err != nil {
+			log.Warn("invalid throttle schedule, keep the old one", util.ZapFieldChangefeed(ctx), zap.Error(err))
+		}
+	}
+}
+
 func (p *processor) sinkDriver(ctx context.Context) error {
 	metricFlushDuration := sinkFlushRowChangedDuration.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr)
+	metricFlushedRows := sinkFlushedRowsCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr)
+	metricFlushedBytes := sinkFlushedBytesCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr)
 	for {
 		select {
 		case <-ctx.Done():
@@ -807,20 +1388,34 @@ func (p *processor) sinkDriver(ctx context.Context) error {
 			}
 			start := time.Now()
 
-			checkpointTs, err := p.sink.FlushRowChangedEvents(ctx, minTs)
+			result, err := p.sink.FlushRowChangedEvents(ctx, minTs)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			metricFlushedRows.Add(float64(result.FlushedRows))
+			metricFlushedBytes.Add(float64(result.FlushedBytes))
+			if result.FlushedRows != 0 {
+				log.Debug("rows flushed to the downstream", util.ZapFieldChangefeed(ctx),
+					zap.Uint64("checkpointTs", result.CheckpointTs),
+					zap.Uint64("rows", result.FlushedRows), zap.Uint64("bytes", result.FlushedBytes))
+			}
+			checkpointTs := result.CheckpointTs
 			if checkpointTs != 0 {
 				atomic.StoreUint64(&p.checkpointTs, checkpointTs)
 				p.localCheckpointTsNotifier.Notify()
 			}
+			if checkpointTs < minTs {
+				// the rows are being flushed, keep polling the sink at the
+				// minimum interval until they are flushed.
+				p.sinkEmittedResolvedReceiver.Wake()
+			}
 
 			dur := time.Since(start)
 			metricFlushDuration.Observe(dur.Seconds())
 			if dur > 3*time.Second {
 				log.Warn("flush row changed events too slow",
-					zap.Duration("duration", dur), util.ZapFieldChangefeed(ctx))
+					zap.Duration("duration", dur), util.ZapFieldChangefeed(ctx),
+					zap.Uint64("rows", result.FlushedRows), zap.Uint64("bytes", result.FlushedBytes))
 			}
 		}
 	}
@@ -833,38 +1428,24 @@ func (p *processor) syncResolved(ctx context.Context) error {
 		log.Info("syncResolved stopped", util.ZapFieldChangefeed(ctx))
 	}()
 
-	events := make([]*model.PolymorphicEvent, 0, defaultSyncResolvedBatch)
-	rows := make([]*model.RowChangedEvent, 0, defaultSyncResolvedBatch)
+	emitter := cdcprocessor.NewRowEmitter(p.sink, p.mounter, defaultSyncResolvedBatch, func(events []*model.PolymorphicEvent) {
+		p.markEventsEmitted(events)
+		p.statistics.observe(events, time.Now())
+	})
 
 	flushRowChangedEvents := func() error {
-		for _, ev := range events {
-			err := ev.WaitPrepare(ctx)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			if ev.Row == nil {
-				continue
-			}
-			rows = append(rows, ev.Row)
-		}
 		failpoint.Inject("ProcessorSyncResolvedPreEmit", func() {
 			log.Info("Prepare to panic for ProcessorSyncResolvedPreEmit")
 			time.Sleep(10 * time.Second)
 			panic("ProcessorSyncResolvedPreEmit")
 		})
-		err := p.sink.EmitRowChangedEvents(ctx, rows...)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		events = events[:0]
-		rows = rows[:0]
-		return nil
+		return errors.Trace(emitter.Emit(ctx))
 	}
 
 	processRowChangedEvent := func(row *model.PolymorphicEvent) error {
-		events = append(events, row)
+		emitter.Append(row)
 
-		if len(events) >= defaultSyncResolvedBatch {
+		if emitter.Len() >= defaultSyncResolvedBatch {
 			err := flushRowChangedEvents()
 			if err != nil {
 				return errors.Trace(err)
@@ -873,28 +1454,73 @@ func (p *processor) syncResolved(ctx context.Context) error {
 		return nil
 	}
 
-	var resolvedTs uint64
+	var (
+		resolvedTs uint64
+		// pendingResolvedTs is received from the control lane, it's acted upon
+		// once the rows before it are all consumed from the row lane, and
+		// blocking is the lane whose rows before it are not consumed yet
+		pendingResolvedTs uint64
+		hasPending        bool
+		blocking          *outputLane
+	)
+	tryResolve := func() error {
+		if !hasPending || (blocking != nil && !blocking.emittedBefore(pendingResolvedTs)) {
+			return nil
+		}
+		if blocking = p.blockingOutputLane(pendingResolvedTs); blocking != nil {
+			return nil
+		}
+		err := flushRowChangedEvents()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		hasPending = false
+		resolvedTs = pendingResolvedTs
+		atomic.StoreUint64(&p.sinkEmittedResolvedTs, resolvedTs)
+		p.sinkEmittedResolvedNotifier.Notify()
+		return nil
+	}
+	// the lanes of the removed tables are not waited, which is checked
+	// periodically since no more rows of them are received
+	ticker := time.NewTicker(syncResolvedCheckInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case row := <-p.output:
+		case ts := <-p.controlOutput:
+			failpoint.Inject("ProcessorSyncResolvedError", func() {
+				failpoint.Return(errors.New("processor sync resolved injected error"))
+			})
+			pendingResolvedTs, hasPending, blocking = ts, true, nil
+			if err := tryResolve(); err != nil {
+				return errors.Trace(err)
+			}
+		case <-ticker.C:
+			blocking = nil
+			if err := tryResolve(); err != nil {
+				return errors.Trace(err)
+			}
+		case out := <-p.output:
+			row := out.event
 			if row == nil {
 				continue
 			}
 			failpoint.Inject("ProcessorSyncResolvedError", func() {
 				failpoint.Return(errors.New("processor sync resolved injected error"))
 			})
-			if row.RawKV != nil && row.RawKV.OpType == model.OpTypeResolved {
-				err := flushRowChangedEvents()
-				if err != nil {
-					return errors.Trace(err)
-				}
-				resolvedTs = row.CRTs
-				atomic.StoreUint64(&p.sinkEmittedResolvedTs, row.CRTs)
-				p.sinkEmittedResolvedNotifier.Notify()
+			lane, released := p.outputLaneOf(out)
+			if released {
+				// the table is removed after the row is sent, the rows after
+				// its drain boundary are replicated by the target capture
+				log.Debug("drop the row of the removed table",
+					zap.String("changefeed", p.changefeedID),
+					p.eventLogFormatter.Event("row", row))
 				continue
 			}
+			if lane != nil {
+				lane.consume()
+			}
 			// Global resolved ts should fallback in some table rebalance cases,
 			// since the start-ts(from checkpoint ts) or a rebalanced table could
 			// be less then the global resolved ts.
@@ -908,28 +1534,42 @@ func (p *processor) syncResolved(ctx context.Context) error {
 				resolvedTs = localResolvedTs
 			}
 			if row.CRTs <= resolvedTs {
+				// the table may be forced to advance after the row is sent
+				if p.dropForcedEvent(ctx, row) {
+					continue
+				}
 				_ = row.WaitPrepare(ctx)
 				log.Panic("The CRTs must be greater than the resolvedTs",
 					zap.String("model", "processor"),
 					zap.String("changefeed", p.changefeedID),
 					zap.Uint64("resolvedTs", resolvedTs),
-					zap.Any("row", row))
+					p.eventLogFormatter.Event("row", row))
 			}
 			err := processRowChangedEvent(row)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			if hasPending && lane == blocking {
+				if err := tryResolve(); err != nil {
+					return errors.Trace(err)
+				}
+			}
 		}
 	}
 }
 
 func (p *processor) collectMetrics(ctx context.Context) error {
+	t := p.wheel.NewTicker(defaultMetricInterval)
+	defer t.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(defaultMetricInterval):
+		case <-t.C:
 			tableOutputChanSizeGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr).Set(float64(len(p.output)))
+			now := time.Now()
+			p.budget.observe(now)
+			p.statistics.observeStores(kv.StorePullTotals(p.captureInfo.AdvertiseAddr, p.changefeedID), now)
 		}
 	}
 }
@@ -947,268 +1587,350 @@ func createSchemaStorage(
 	return entry.NewSchemaStorage(meta, checkpointTs, filter, forceReplicate)
 }
 
+// getTableName returns the name of the table in the schema snapshot at ts,
+// so that the tables created after the processor starts are found. The last
+// snapshot is used if the snapshot at ts is not resolved in time.
+func (p *processor) getTableName(ctx context.Context, tableID model.TableID, ts uint64) (model.TableName, bool) {
+	ctx, cancel := context.WithTimeout(ctx, tableNameTimeout)
+	defer cancel()
+	snap, err := p.schemaStorage.GetSnapshot(ctx, ts)
+	if err == nil {
+		if name, ok := snap.GetTableNameByID(tableID); ok {
+			return name, true
+		}
+	} else {
+		log.Warn("get the schema snapshot at the start ts of the table", util.ZapFieldChangefeed(ctx),
+			zap.Int64("tableID", tableID), zap.Uint64("ts", ts), zap.Error(err))
+	}
+	return p.schemaStorage.GetLastSnapshot().GetTableNameByID(tableID)
+}
+
+// getTableInfo is like getTableName, but returns the table info
+func (p *processor) getTableInfo(ctx context.Context, tableID model.TableID, ts uint64) (*model.TableInfo, bool) {
+	ctx, cancel := context.WithTimeout(ctx, tableNameTimeout)
+	defer cancel()
+	snap, err := p.schemaStorage.GetSnapshot(ctx, ts)
+	if err == nil {
+		if info, ok := snap.PhysicalTableByID(tableID); ok {
+			return info, true
+		}
+	} else {
+		log.Warn("get the schema snapshot at the start ts of the table", util.ZapFieldChangefeed(ctx),
+			zap.Int64("tableID", tableID), zap.Uint64("ts", ts), zap.Error(err))
+	}
+	return p.schemaStorage.GetLastSnapshot().PhysicalTableByID(tableID)
+}
+
+// tableSpans returns the spans to pull for the table from startTs, and whether
+// they may be changed by the DDLs after it. The spans needed by the table infos
+// at startTs and in the last snapshot are both included, since the DDLs between
+// them are handled before the table is added.
+func (p *processor) tableSpans(ctx context.Context, tableID model.TableID, startTs uint64) ([]regionspan.Span, bool) {
+	enableOldValue := p.changefeed.Config.EnableOldValue
+	info, ok := p.getTableInfo(ctx, tableID, startTs)
+	if !ok {
+		info = nil
+	}
+	spans := entry.TableSpans(tableID, info, enableOldValue)
+	if !entry.TableSpansMayChange(info, enableOldValue) {
+		return spans, false
+	}
+	if last, ok := p.schemaStorage.GetLastSnapshot().PhysicalTableByID(tableID); ok {
+		spans = appendMissingSpans(spans, entry.TableSpans(tableID, last, enableOldValue))
+	}
+	return spans, true
+}
+
+// appendMissingSpans appends the spans not in the pulled spans to them
+func appendMissingSpans(pulled []regionspan.Span, spans []regionspan.Span) []regionspan.Span {
+	for _, span := range spans {
+		if !containsSpan(pulled, span) {
+			pulled = append(pulled, span)
+		}
+	}
+	return pulled
+}
+
+func containsSpan(spans []regionspan.Span, span regionspan.Span) bool {
+	for _, s := range spans {
+		if bytes.Equal(s.Start, span.Start) && bytes.Equal(s.End, span.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustTableSpans adds the index spans needed by the tables to their pullers
+// after the DDL job changes the handle indexes of them, e.g. a unique index is
+// added to a table without a primary key. The spans not needed any more are
+// still pulled until the table is added again.
+func (p *processor) adjustTableSpans(ctx context.Context, job *timodel.Job) {
+	if job.BinlogInfo == nil {
+		return
+	}
+	enableOldValue := p.changefeed.Config.EnableOldValue
+	snap := p.schemaStorage.GetLastSnapshot()
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	for _, table := range p.tables {
+		plr, ok := table.puller.(*puller.AdjustablePuller)
+		if !ok {
+			continue
+		}
+		info, ok := snap.PhysicalTableByID(table.id)
+		if !ok || info.ID != job.TableID {
+			continue
+		}
+		pulled := plr.Spans()
+		missing := appendMissingSpans(pulled, entry.TableSpans(table.id, info, enableOldValue))[len(pulled):]
+		if len(missing) == 0 {
+			continue
+		}
+		log.Info("pull the spans needed by the table after the DDL",
+			append(util.ZapFieldsFromCtx(ctx), zap.Int64("tableID", table.id), zap.String("table", table.name),
+				zap.Int64("jobID", job.ID), zap.Uint64("finishedTs", job.BinlogInfo.FinishedTS),
+				zap.Reflect("spans", missing))...)
+		plr.AddSpans(job.BinlogInfo.FinishedTS, missing)
+	}
+}
+
 func (p *processor) addTable(ctx context.Context, tableID int64, replicaInfo *model.TableReplicaInfo) {
+	name, tableName := p.tableNameForMetrics(ctx, tableID, replicaInfo.StartTs)
 	p.stateMu.Lock()
 	defer p.stateMu.Unlock()
+	p.addTableLocked(ctx, tableID, name, tableName, replicaInfo)
+}
 
-	var tableName string
+// swapTable adds the new physical table replacing the truncated one, the
+// truncated table is checked and the new table is added under stateMu, so
+// that there is no moment when neither of them is in the processor. The
+// truncated table is removed by its delete operation later.
+func (p *processor) swapTable(ctx context.Context, oldTableID, newTableID model.TableID, replicaInfo *model.TableReplicaInfo) {
+	name, tableName := p.tableNameForMetrics(ctx, newTableID, replicaInfo.StartTs)
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if _, ok := p.tables[oldTableID]; !ok {
+		log.Warn("the truncated table is not found, add the new table only", util.ZapFieldChangefeed(ctx),
+			zap.Int64("oldTableID", oldTableID), zap.Int64("newTableID", newTableID))
+	} else {
+		log.Info("swap the truncated table", util.ZapFieldChangefeed(ctx),
+			zap.Int64("oldTableID", oldTableID), zap.Int64("newTableID", newTableID),
+			zap.Uint64("startTs", replicaInfo.StartTs))
+	}
+	p.addTableLocked(ctx, newTableID, name, tableName, replicaInfo)
+}
+
+// tableNameForMetrics returns the name of the table, and its quoted name used
+// in the metrics, which is the table id if the name is not found.
+func (p *processor) tableNameForMetrics(ctx context.Context, tableID int64, startTs uint64) (model.TableName, string) {
+	var name model.TableName
 	err := retry.Run(time.Millisecond*5, 3, func() error {
-		if name, ok := p.schemaStorage.GetLastSnapshot().GetTableNameByID(tableID); ok {
-			tableName = name.QuoteString()
+		var ok bool
+		if name, ok = p.getTableName(ctx, tableID, startTs); ok {
 			return nil
 		}
 		return errors.Errorf("failed to get table name, fallback to use table id: %d", tableID)
 	})
+	var tableName string
 	if err != nil {
 		log.Warn("get table name for metric", util.ZapFieldChangefeed(ctx), zap.String("error", err.Error()))
 		tableName = strconv.Itoa(int(tableID))
+	} else {
+		tableName = name.QuoteString()
 	}
+	return name, tableName
+}
+
+// addTableLocked starts the table, the caller must hold stateMu.
+func (p *processor) addTableLocked(
+	ctx context.Context, tableID int64, name model.TableName, tableName string, replicaInfo *model.TableReplicaInfo,
+) {
+	// the mark table is shared by the data tables, so its puller is not stopped
+	// with the context of the data table
+	processorCtx := ctx
+	ctx = util.PutTableInfoInCtx(ctx, tableID, tableName)
 
+	var dyingTable *tableInfo
 	if table, ok := p.tables[tableID]; ok {
 		if atomic.SwapUint32(&table.isDying, 0) == 1 {
-			log.Warn("The same table exists but is dying. Cancel it and continue.", util.ZapFieldChangefeed(ctx), zap.Int64("ID", tableID))
+			log.Warn("The same table exists but is dying. Cancel it and continue.", util.ZapFieldsFromCtx(ctx)...)
 			table.cancel()
+			dyingTable = table
 		} else {
-			log.Warn("Ignore existing table", util.ZapFieldChangefeed(ctx), zap.Int64("ID", tableID))
+			log.Warn("Ignore existing table", util.ZapFieldsFromCtx(ctx)...)
 			return
 		}
 	}
+	p.schemaGCFloor.addTable(tableID, replicaInfo.StartTs, time.Now())
 
 	globalcheckpointTs := atomic.LoadUint64(&p.globalcheckpointTs)
 
 	if replicaInfo.StartTs < globalcheckpointTs {
-		log.Warn("addTable: startTs < checkpoint",
-			util.ZapFieldChangefeed(ctx),
-			zap.Int64("tableID", tableID),
+		log.Warn("addTable: startTs < checkpoint", append(util.ZapFieldsFromCtx(ctx),
 			zap.Uint64("checkpoint", globalcheckpointTs),
-			zap.Uint64("startTs", replicaInfo.StartTs))
+			zap.Uint64("startTs", replicaInfo.StartTs))...)
 	}
 
 	globalResolvedTs := atomic.LoadUint64(&p.sinkEmittedResolvedTs)
-	log.Debug("Add table", zap.Int64("tableID", tableID),
-		util.ZapFieldChangefeed(ctx),
-		zap.String("name", tableName),
+	log.Debug("Add table", append(util.ZapFieldsFromCtx(ctx),
 		zap.Any("replicaInfo", replicaInfo),
-		zap.Uint64("globalResolvedTs", globalResolvedTs))
+		zap.Uint64("globalResolvedTs", globalResolvedTs))...)
 
-	ctx = util.PutTableInfoInCtx(ctx, tableID, tableName)
 	ctx, cancel := context.WithCancel(ctx)
 	table := &tableInfo{
 		id:         tableID,
 		name:       tableName,
+		tableName:  name,
 		resolvedTs: replicaInfo.StartTs,
 		cancel:     cancel,
+		forced:     new(forcedResolvedTs),
+	}
+	if dyingTable != nil {
+		// the events of the dying table may be still in the output channel
+		table.pendingEvents = dyingTable.pendingEvents
+	} else {
+		table.pendingEvents = new(int64)
 	}
 	// TODO(leoppro) calculate the workload of this table
 	// We temporarily set the value to constant 1
 	table.workload = model.WorkloadInfo{Workload: 1}
+	if cfg := p.changefeed.Config.LargeTxn; cfg != nil {
+		table.largeTxn = newLargeTxnDetector(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName, cfg.RowThreshold)
+	}
 
-	startPuller := func(tableID model.TableID, pResolvedTs *uint64) *puller.Rectifier {
+	startPuller := func(
+		ctx context.Context, tableID model.TableID, pResolvedTs *uint64, pPendingEvents *int64,
+		largeTxn *largeTxnDetector, forced *forcedResolvedTs, isMarkTable bool,
+	) (puller.Puller, *tablePipeline) {
 		// start table puller
 		enableOldValue := p.changefeed.Config.EnableOldValue
-		span := regionspan.GetTableSpan(tableID, enableOldValue)
 		kvStorage, err := util.KVStorageFromCtx(ctx)
 		if err != nil {
-			p.errCh <- err
-			return nil
+			p.errs.collect(errOriginProcessor, util.AnnotateTableErrFromCtx(ctx, err))
+			return nil, nil
 		}
-		plr := puller.NewPuller(ctx, p.pdCli, p.credential, kvStorage, replicaInfo.StartTs, []regionspan.Span{span}, p.limitter, enableOldValue)
-		go func() {
-			err := plr.Run(ctx)
-			if errors.Cause(err) != context.Canceled {
-				p.errCh <- err
-			}
-		}()
-
-		var sorterImpl puller.EventSorter
-		switch p.changefeed.Engine {
-		case model.SortInMemory:
-			sorterImpl = puller.NewEntrySorter()
-		case model.SortInFile, model.SortUnified:
-			err := util.IsDirAndWritable(p.changefeed.SortDir)
-			if err != nil {
-				if os.IsNotExist(errors.Cause(err)) {
-					err = os.MkdirAll(p.changefeed.SortDir, 0o755)
-					if err != nil {
-						p.errCh <- errors.Annotate(cerror.WrapError(cerror.ErrProcessorSortDir, err), "create dir")
-						return nil
-					}
-				} else {
-					p.errCh <- errors.Annotate(cerror.WrapError(cerror.ErrProcessorSortDir, err), "sort dir check")
-					return nil
-				}
+		// the DDL puller starts from the checkpoint ts of the processor, the
+		// schema changes of the table before it are loaded from the meta
+		if err := p.schemaStorage.ExtendTableHistory(kvStorage, tableID, replicaInfo.StartTs); err != nil {
+			p.errs.collect(errOriginProcessor, util.AnnotateTableErrFromCtx(ctx, err))
+			return nil, nil
+		}
+		var plr puller.Puller
+		if p.changefeed.SnapshotOnly {
+			// only the rows are scanned, the indexes are not needed
+			span := regionspan.GetTableSpan(tableID, true)
+			plr = puller.NewSnapshotPuller(kvStorage, replicaInfo.StartTs, p.changefeed.GetTargetTs(), span)
+		} else {
+			newPuller := func(startTs uint64, spans []regionspan.Span) puller.Puller {
+				return puller.NewPuller(ctx, p.pdCli, p.credential, kvStorage, startTs, spans, p.limitter, enableOldValue)
 			}
-
-			if p.changefeed.Engine == model.SortInFile {
-				sorterImpl = puller.NewFileSorter(p.changefeed.SortDir)
+			spans, mayChange := p.tableSpans(ctx, tableID, replicaInfo.StartTs)
+			if mayChange {
+				// the resolved ts is bounded by the schema storage, so that the
+				// spans needed after a DDL are added before the rows after it
+				// are output, see adjustTableSpans
+				plr = puller.NewAdjustablePuller(newPuller, replicaInfo.StartTs, spans, p.schemaStorage.ResolvedTs)
 			} else {
-				// Unified Sorter
-				sorterImpl = psorter.NewUnifiedSorter(p.changefeed.SortDir, tableName, util.CaptureAddrFromCtx(ctx))
+				plr = newPuller(replicaInfo.StartTs, spans)
 			}
-		default:
-			p.errCh <- cerror.ErrUnknownSortEngine.GenWithStackByArgs(p.changefeed.Engine)
-			return nil
 		}
-		sorter := puller.NewRectifier(sorterImpl, p.changefeed.GetTargetTs())
-
+		deregisterPuller := leaktest.Register(errOriginPuller, p.changefeedID, tableID)
 		go func() {
-			err := sorter.Run(ctx)
+			defer deregisterPuller()
+			err := plr.Run(ctx)
 			if errors.Cause(err) != context.Canceled {
-				p.errCh <- err
+				p.errs.collect(errOriginPuller, util.AnnotateTableErrFromCtx(ctx, err))
 			}
 		}()
 
-		go func() {
-			p.pullerConsume(ctx, plr, sorter)
-		}()
+		if err := prepareSortDir(p.changefeed.Engine, p.changefeed.SortDir); err != nil {
+			p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, err))
+			return nil, nil
+		}
+		newSorter := func() puller.EventSorter {
+			return cdcprocessor.NewSorter(p.changefeed.Engine, p.changefeed.SortDir, tableName, util.CaptureAddrFromCtx(ctx))
+		}
+		pipeline := p.newTablePipeline(tableID, tableName, pResolvedTs, pPendingEvents, largeTxn, forced, replicaInfo)
+		pipeline.markTable = isMarkTable
+		if cfg := p.changefeed.Config.DormantTable; cfg != nil && cfg.IdleSeconds > 0 {
+			pipeline.enableDormant(time.Duration(cfg.IdleSeconds)*time.Second, p.changefeed.GetTargetTs(), newSorter)
+		}
+		p.addPendingOpTable(tableID, &pipeline.lastResolvedTs)
+		pipeline.start(ctx, puller.NewRectifier(newSorter(), p.changefeed.GetTargetTs()))
 
+		deregisterConsumer := leaktest.Register(errOriginPuller, p.changefeedID, tableID)
 		go func() {
-			p.sorterConsume(ctx, tableID, tableName, sorter, pResolvedTs, replicaInfo)
+			defer deregisterConsumer()
+			defer p.removePendingOpTable(tableID, &pipeline.lastResolvedTs)
+			defer pipeline.close()
+			p.pullerConsume(ctx, plr, pipeline)
 		}()
 
-		return sorter
+		return plr, pipeline
 	}
 
 	if p.changefeed.Config.Cyclic.IsEnabled() && replicaInfo.MarkTableID != 0 {
-		mTableID := replicaInfo.MarkTableID
-		// we should to make sure a mark table is only listened once.
-		if _, exist := p.markTableIDs[mTableID]; !exist {
-			p.markTableIDs[mTableID] = struct{}{}
-			table.markTableID = mTableID
-			table.mResolvedTs = replicaInfo.StartTs
-
-			startPuller(mTableID, &table.mResolvedTs)
-		}
+		// a mark table is only listened once, no matter how many data tables
+		// share it.
+		table.markTable = p.markTables.acquire(replicaInfo.MarkTableID, tableID, replicaInfo.StartTs,
+			func(mt *markTable) context.CancelFunc {
+				mctx := util.PutTableInfoInCtx(processorCtx, mt.id, tableName+"-mark")
+				mctx, mcancel := context.WithCancel(mctx)
+				leaktest.AddOwner(p.changefeedID, mt.id)
+				startPuller(mctx, mt.id, &mt.resolvedTs, nil, nil, nil, true)
+				return func() {
+					mcancel()
+					p.releaseOutputLane(mt.id)
+					leaktest.RemoveOwner(p.changefeedID, mt.id)
+				}
+			})
+	}
+	if dyingTable != nil && dyingTable.markTable != nil && dyingTable.markTable != table.markTable {
+		p.markTables.release(dyingTable.markTable.id, tableID)
 	}
 
 	p.tables[tableID] = table
+	leaktest.AddOwner(p.changefeedID, tableID)
 	if p.position.CheckPointTs > replicaInfo.StartTs {
 		p.position.CheckPointTs = replicaInfo.StartTs
 	}
+	// the events of the new table after the start ts are not mounted yet,
+	// lower the local checkpoint ts to protect the schema snapshots from gc.
+	if atomic.LoadUint64(&p.checkpointTs) > replicaInfo.StartTs {
+		atomic.StoreUint64(&p.checkpointTs, replicaInfo.StartTs)
+	}
 	if p.position.ResolvedTs > replicaInfo.StartTs {
 		p.position.ResolvedTs = replicaInfo.StartTs
 	}
 
 	atomic.StoreUint64(&p.localResolvedTs, p.position.ResolvedTs)
-	table.sorter = startPuller(tableID, &table.resolvedTs)
-
-	syncTableNumGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr).Inc()
-}
-
-// sorterConsume receives sorted PolymorphicEvent from sorter of each table and
-// sends to processor's output chan
-func (p *processor) sorterConsume(
-	ctx context.Context,
-	tableID int64,
-	tableName string,
-	sorter *puller.Rectifier,
-	pResolvedTs *uint64,
-	replicaInfo *model.TableReplicaInfo,
-) {
-	var lastResolvedTs uint64
-	opDone := false
-	resolvedTsGauge := tableResolvedTsGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName)
-	checkDoneTicker := time.NewTicker(1 * time.Second)
-	checkDone := func() {
-		localResolvedTs := atomic.LoadUint64(&p.localResolvedTs)
-		globalResolvedTs := atomic.LoadUint64(&p.globalResolvedTs)
-		if !opDone && lastResolvedTs >= localResolvedTs && localResolvedTs >= globalResolvedTs {
-			log.Debug("localResolvedTs >= globalResolvedTs, sending operation done signal",
-				zap.Uint64("localResolvedTs", localResolvedTs), zap.Uint64("globalResolvedTs", globalResolvedTs),
-				zap.Int64("tableID", tableID), util.ZapFieldChangefeed(ctx))
-
-			opDone = true
-			checkDoneTicker.Stop()
-			select {
-			case <-ctx.Done():
-				if errors.Cause(ctx.Err()) != context.Canceled {
-					p.errCh <- ctx.Err()
-				}
-				return
-			case p.opDoneCh <- tableID:
-			}
-		}
-		if !opDone {
-			log.Debug("addTable not done",
-				util.ZapFieldChangefeed(ctx),
-				zap.Uint64("tableResolvedTs", lastResolvedTs),
-				zap.Uint64("localResolvedTs", localResolvedTs),
-				zap.Uint64("globalResolvedTs", globalResolvedTs),
-				zap.Int64("tableID", tableID))
+	if s, ok := sink.Unwrap(p.sink).(sink.TableDispatchSink); ok && name.Table != "" {
+		dispatcher, err := s.AddTable(name)
+		if err != nil {
+			p.errs.collect(errOriginSink, util.AnnotateTableErrFromCtx(ctx, err))
+		} else {
+			log.Info("the dispatcher of the table is chosen",
+				append(util.ZapFieldsFromCtx(ctx), zap.String("dispatcher", dispatcher))...)
 		}
 	}
+	table.puller, table.sorter = startPuller(ctx, tableID, &table.resolvedTs, table.pendingEvents, table.largeTxn, table.forced, false)
 
-	for {
-		select {
-		case <-ctx.Done():
-			if errors.Cause(ctx.Err()) != context.Canceled {
-				p.errCh <- ctx.Err()
-			}
-			return
-		case pEvent := <-sorter.Output():
-			if pEvent == nil {
-				continue
-			}
-
-			pEvent.SetUpFinishedChan()
-			select {
-			case <-ctx.Done():
-				if errors.Cause(ctx.Err()) != context.Canceled {
-					p.errCh <- ctx.Err()
-				}
-				return
-			case p.mounter.Input() <- pEvent:
-			}
-
-			if pEvent.RawKV != nil && pEvent.RawKV.OpType == model.OpTypeResolved {
-				atomic.StoreUint64(pResolvedTs, pEvent.CRTs)
-				lastResolvedTs = pEvent.CRTs
-				p.localResolvedNotifier.Notify()
-				resolvedTsGauge.Set(float64(oracle.ExtractPhysical(pEvent.CRTs)))
-				if !opDone {
-					checkDone()
-				}
-				continue
-			}
-			sinkResolvedTs := atomic.LoadUint64(&p.sinkEmittedResolvedTs)
-			if pEvent.CRTs <= lastResolvedTs || pEvent.CRTs < replicaInfo.StartTs {
-				log.Panic("The CRTs of event is not expected, please report a bug",
-					util.ZapFieldChangefeed(ctx),
-					zap.String("model", "sorter"),
-					zap.Uint64("globalResolvedTs", sinkResolvedTs),
-					zap.Uint64("resolvedTs", lastResolvedTs),
-					zap.Int64("tableID", tableID),
-					zap.Any("replicaInfo", replicaInfo),
-					zap.Any("row", pEvent))
-			}
-			select {
-			case <-ctx.Done():
-				if errors.Cause(ctx.Err()) != context.Canceled {
-					p.errCh <- ctx.Err()
-				}
-				return
-			case p.output <- pEvent:
-			}
-		case <-checkDoneTicker.C:
-			if !opDone {
-				checkDone()
-			}
-		}
-	}
+	syncTableNumGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr).Inc()
 }
 
-// pullerConsume receives RawKVEntry from a given puller and sends to sorter
-// for data sorting and mounter for data encode
+// pullerConsume receives RawKVEntry from a given puller and sends to the
+// pipeline of the table for data sorting and mounter for data encode
 func (p *processor) pullerConsume(
 	ctx context.Context,
 	plr puller.Puller,
-	sorter *puller.Rectifier,
+	pipeline *tablePipeline,
 ) {
+	var recent []*model.RawKVEntry
 	for {
 		select {
 		case <-ctx.Done():
 			if errors.Cause(ctx.Err()) != context.Canceled {
-				p.errCh <- ctx.Err()
+				p.errs.collect(errOriginPuller, util.AnnotateTableErrFromCtx(ctx, ctx.Err()))
 			}
 			return
 		case rawKV := <-plr.Output():
@@ -1216,32 +1938,101 @@ func (p *processor) pullerConsume(
 				continue
 			}
 			pEvent := model.NewPolymorphicEvent(rawKV)
-			sorter.AddEntry(ctx, pEvent)
+			pipeline.addEntry(ctx, pEvent)
+			failpoint.Inject("ProcessorPullerRedeliver", func(val failpoint.Value) {
+				// re-deliver the recent entries after they are resolved, like
+				// the kv client does for the overlap window after region retries
+				if rawKV.OpType != model.OpTypeResolved {
+					recent = append(recent, rawKV)
+					if len(recent) > val.(int) {
+						recent = recent[1:]
+					}
+					return
+				}
+				for _, entry := range recent {
+					pipeline.addEntry(ctx, model.NewPolymorphicEvent(entry))
+				}
+				recent = recent[:0]
+			})
 		}
 	}
 }
 
+// stop stops the processor. The inputs are canceled and the sink is flushed
+// and closed before the task keys are deleted, so that the owner doesn't
+// reassign the tables while the sink may still write to the downstream. If the
+// sink isn't closed in sinkCloseTimeout, the task keys are still deleted with a
+// dirty stop recorded, which is merged into the changefeed status by the owner.
+// It's safe to call stop more than once, the later calls only delete the task
+// keys again.
 func (p *processor) stop(ctx context.Context) error {
+	p.stopMu.Lock()
+	defer p.stopMu.Unlock()
 	log.Info("stop processor", zap.String("id", p.id), zap.String("capture", p.captureInfo.AdvertiseAddr), zap.String("changefeed", p.changefeedID))
-	p.stateMu.Lock()
-	for _, tbl := range p.tables {
-		tbl.cancel()
-	}
-	p.ddlPullerCancel()
-	// mark tables share the same context with its original table, don't need to cancel
-	p.stateMu.Unlock()
-	failpoint.Inject("processorStopDelay", nil)
-	atomic.StoreInt32(&p.stopped, 1)
-	if err := p.etcdCli.DeleteTaskPosition(ctx, p.changefeedID, p.captureInfo.ID); err != nil {
-		return err
+	var closeErr error
+	if atomic.CompareAndSwapInt32(&p.stopped, 0, 1) {
+		p.stateMu.Lock()
+		for _, tbl := range p.tables {
+			tbl.cancel()
+		}
+		p.ddlPullerCancel()
+		// the mark tables are shared by the data tables, they're stopped by
+		// the manager rather than the tables
+		p.markTables.releaseAll()
+		p.stateMu.Unlock()
+		// the goroutines registered after the processor is stopped are orphans
+		leaktest.RemoveOwner(p.changefeedID, 0)
+		failpoint.Inject("processorStopDelay", nil)
+		closeErr = p.closeSink(ctx)
+		p.budget.deleteMetrics()
+		kv.DropStorePullStats(p.captureInfo.AdvertiseAddr, p.changefeedID)
+		if cerror.ErrProcessorSinkCloseTimeout.Equal(closeErr) {
+			p.dirtyStop = &model.DirtyStop{
+				CaptureID:    p.captureInfo.ID,
+				CheckpointTs: atomic.LoadUint64(&p.checkpointTs),
+				Time:         time.Now(),
+				Reason:       closeErr.Error(),
+			}
+			log.Warn("the sink is not closed in time, the events after the checkpoint may be written to the downstream again",
+				zap.String("changefeed", p.changefeedID), zap.String("capture", p.captureInfo.AdvertiseAddr),
+				zap.Uint64("checkpointTs", p.dirtyStop.CheckpointTs), zap.Error(closeErr))
+			closeErr = nil
+		}
 	}
-	if err := p.etcdCli.DeleteTaskStatus(ctx, p.changefeedID, p.captureInfo.ID); err != nil {
-		return err
+	if err := p.etcdCli.DeleteTaskKeys(ctx, p.changefeedID, p.captureInfo.ID, p.dirtyStop); err != nil {
+		return errors.Trace(err)
 	}
-	if err := p.etcdCli.DeleteTaskWorkload(ctx, p.changefeedID, p.captureInfo.ID); err != nil {
-		return err
+	return closeErr
+}
+
+// closeSink flushes the events emitted to the sink and closes the sink, it
+// returns ErrProcessorSinkCloseTimeout if it's not done in sinkCloseTimeout.
+func (p *processor) closeSink(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sinkCloseTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		resolvedTs := atomic.LoadUint64(&p.sinkEmittedResolvedTs)
+		if globalResolvedTs := atomic.LoadUint64(&p.globalResolvedTs); globalResolvedTs < resolvedTs {
+			resolvedTs = globalResolvedTs
+		}
+		if resolvedTs != 0 {
+			if _, err := p.sink.FlushRowChangedEvents(ctx, resolvedTs); err != nil {
+				log.Warn("failed to flush the sink before closing it",
+					zap.String("changefeed", p.changefeedID), zap.Error(err))
+			}
+		}
+		done <- p.sink.Close()
+	}()
+	select {
+	case err := <-done:
+		return errors.Trace(err)
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return cerror.ErrProcessorSinkCloseTimeout.GenWithStackByArgs(sinkCloseTimeout)
+		}
+		return errors.Trace(ctx.Err())
 	}
-	return p.sink.Close()
 }
 
 func (p *processor) isStopped() bool {
@@ -1261,27 +2052,37 @@ func runProcessor(
 	captureInfo model.CaptureInfo,
 	checkpointTs uint64,
 	flushCheckpointInterval time.Duration,
+	sharedDDLPuller *sharedDDLPuller,
+	wheel *timewheel.Wheel,
 ) (*processor, error) {
-	opts := make(map[string]string, len(info.Opts)+2)
+	opts := make(map[string]string, len(info.Opts)+3)
 	for k, v := range info.Opts {
 		opts[k] = v
 	}
 	opts[sink.OptChangefeedID] = changefeedID
 	opts[sink.OptCaptureAddr] = captureInfo.AdvertiseAddr
+	if cfg := info.Config.Latency; cfg != nil {
+		opts[sink.OptLatencyTopNTables] = strconv.Itoa(cfg.TopNTables)
+	}
 	ctx = util.PutChangefeedIDInCtx(ctx, changefeedID)
+	// the config is validated when the changefeed is created or updated, it's
+	// checked again in case the changefeed is saved by an older version.
+	if err := sink.ValidateConfig(info.SinkURI, info.Config); err != nil {
+		return nil, errors.Trace(err)
+	}
 	filter, err := filter.NewFilter(info.Config)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	ctx, cancel := context.WithCancel(ctx)
-	errCh := make(chan error, 1)
-	sink, err := sink.NewSink(ctx, changefeedID, info.SinkURI, filter, info.Config, opts, errCh)
+	sinkErrCh := make(chan error, 1)
+	sink, err := sink.NewSink(ctx, changefeedID, info.SinkURI, filter, info.Config, opts, sinkErrCh)
 	if err != nil {
 		cancel()
 		return nil, errors.Trace(err)
 	}
 	processor, err := newProcessor(ctx, pdCli, credential, session, info, sink,
-		changefeedID, captureInfo, checkpointTs, errCh, flushCheckpointInterval)
+		changefeedID, captureInfo, checkpointTs, flushCheckpointInterval, sharedDDLPuller, wheel)
 	if err != nil {
 		cancel()
 		return nil, err
@@ -1291,37 +2092,64 @@ func runProcessor(
 	processorErrorCounter.WithLabelValues(changefeedID, captureInfo.AdvertiseAddr).Add(0)
 	processor.Run(ctx)
 
+	deregisterSinkErr := leaktest.Register(errOriginSink, changefeedID, 0)
 	go func() {
-		err := <-errCh
+		defer deregisterSinkErr()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-sinkErrCh:
+				processor.errs.collect(errOriginSink, err)
+			}
+		}
+	}()
+
+	deregisterErrs := leaktest.Register(errOriginProcessor, changefeedID, 0)
+	go func() {
+		defer deregisterErrs()
+		primary := processor.errs.wait()
+		err := primary.err
 		cause := errors.Cause(err)
-		if cause != nil && cause != context.Canceled && cerror.ErrAdminStopProcessor.NotEqual(cause) {
+		if cerror.ErrCaptureSessionDone.Equal(cause) {
+			// the error can't be recorded in etcd without the session, the
+			// capture re-registers itself and the owner reschedules the tables
 			processorErrorCounter.WithLabelValues(changefeedID, captureInfo.AdvertiseAddr).Inc()
-			log.Error("error on running processor",
+			log.Warn("processor exited because the session is done",
 				util.ZapFieldCapture(ctx),
 				zap.String("changefeed", changefeedID),
 				zap.String("processor", processor.id),
 				zap.Error(err))
+		} else if cause != nil && cause != context.Canceled && cerror.ErrAdminStopProcessor.NotEqual(cause) {
+			processorErrorCounter.WithLabelValues(changefeedID, captureInfo.AdvertiseAddr).Inc()
+			log.Error("error on running processor",
+				util.ZapFieldCapture(ctx),
+				zap.String("changefeed", changefeedID),
+				zap.String("processor", processor.id),
+				zap.String("origin", primary.origin),
+				zap.Time("time", primary.time),
+				zap.Error(err),
+				zap.Strings("errors", processor.errs.errorStrings()))
 			// record error information in etcd
+			// the errors of the tables are annotated, the code is taken from the cause
 			var code string
-			if terror, ok := err.(*errors.Error); ok {
+			if terror, ok := cause.(*errors.Error); ok {
 				code = string(terror.RFCCode())
 			} else {
 				code = string(cerror.ErrProcessorUnknown.RFCCode())
 			}
-			processor.position.Error = &model.RunningError{
+			processor.recordError(ctx, &model.RunningError{
 				Addr:    captureInfo.AdvertiseAddr,
 				Code:    code,
 				Message: err.Error(),
-			}
-			_, err = processor.etcdCli.PutTaskPositionOnChange(ctx, processor.changefeedID, processor.captureInfo.ID, processor.position)
-			if err != nil {
-				log.Warn("upload processor error failed", util.ZapFieldChangefeed(ctx), zap.Error(err))
-			}
+				Origin:  primary.origin,
+			}, primary.time)
 		} else {
 			log.Info("processor exited",
 				util.ZapFieldCapture(ctx),
 				zap.String("changefeed", changefeedID),
-				zap.String("processor", processor.id))
+				zap.String("processor", processor.id),
+				zap.Strings("errors", processor.errs.errorStrings()))
 		}
 		cancel()
 	}()
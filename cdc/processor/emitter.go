@@ -0,0 +1,115 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package processor contains the parts of the processor which don't depend on
+// the capture, PD and etcd, so that they're shared with the tools replaying the
+// captured events.
+package processor
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// emitPrefixRows is the min number of the mounted rows emitted before the
+// rest of the batch is mounted, see RowEmitter.Emit
+var emitPrefixRows = 256
+
+// RowSink is the part of the sink the rows are emitted to
+type RowSink interface {
+	EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error
+}
+
+// RowEmitter emits the rows of the mounted events to a sink in batches.
+type RowEmitter struct {
+	sink      RowSink
+	mounter   entry.Mounter
+	onEmitted func(events []*model.PolymorphicEvent)
+
+	events []*model.PolymorphicEvent
+	rows   []*model.RowChangedEvent
+}
+
+// NewRowEmitter creates a RowEmitter, the events are mounted by the mounter,
+// onEmitted is called with the events after their rows are emitted, it can be
+// nil.
+func NewRowEmitter(
+	s RowSink, mounter entry.Mounter, batchSize int, onEmitted func(events []*model.PolymorphicEvent),
+) *RowEmitter {
+	return &RowEmitter{
+		sink:      s,
+		mounter:   mounter,
+		onEmitted: onEmitted,
+		events:    make([]*model.PolymorphicEvent, 0, batchSize),
+		rows:      make([]*model.RowChangedEvent, 0, batchSize),
+	}
+}
+
+// Append appends an event to the batch, the event must be sent to the
+// mounter.
+func (e *RowEmitter) Append(event *model.PolymorphicEvent) {
+	e.events = append(e.events, event)
+}
+
+// Len returns the number of the events in the batch.
+func (e *RowEmitter) Len() int {
+	return len(e.events)
+}
+
+// Emit waits for the events in the batch to be mounted and emits their rows
+// to the sink in the order of the batch, the batch is empty afterwards. The
+// events are mounted by the workers of the mounter concurrently, so waiting
+// for them in order costs no more than the slowest one. To overlap the sink IO
+// with the decoding, once emitPrefixRows rows are mounted before an event not
+// mounted yet, the rows are emitted before waiting for the event.
+func (e *RowEmitter) Emit(ctx context.Context) error {
+	emitted := 0
+	for i, ev := range e.events {
+		if len(e.rows) >= emitPrefixRows && !ev.IsPrepared() {
+			if err := e.emit(ctx, e.events[emitted:i]); err != nil {
+				return errors.Trace(err)
+			}
+			emitted = i
+		}
+		err := e.mounter.WaitPrepare(ctx, ev)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if ev.Row == nil {
+			continue
+		}
+		e.rows = append(e.rows, ev.Row)
+	}
+	if err := e.emit(ctx, e.events[emitted:]); err != nil {
+		return errors.Trace(err)
+	}
+	e.events = e.events[:0]
+	return nil
+}
+
+// emit emits the rows collected to the sink, events are the events of the
+// rows.
+func (e *RowEmitter) emit(ctx context.Context, events []*model.PolymorphicEvent) error {
+	err := e.sink.EmitRowChangedEvents(ctx, e.rows...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if e.onEmitted != nil {
+		e.onEmitted(events)
+	}
+	e.rows = e.rows[:0]
+	return nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"golang.org/x/sync/errgroup"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type emitterSuite struct{}
+
+var _ = check.Suite(&emitterSuite{})
+
+// delayMounter mounts the events with the workers, each event takes the
+// delay returned by delay to be mounted
+type delayMounter struct {
+	workers int
+	delay   func(ev *model.PolymorphicEvent) time.Duration
+	input   chan *model.PolymorphicEvent
+}
+
+func newDelayMounter(workers int, delay func(ev *model.PolymorphicEvent) time.Duration) *delayMounter {
+	return &delayMounter{
+		workers: workers,
+		delay:   delay,
+		input:   make(chan *model.PolymorphicEvent, 4096),
+	}
+}
+
+func (m *delayMounter) Run(ctx context.Context) error {
+	errg, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < m.workers; i++ {
+		errg.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ev := <-m.input:
+					time.Sleep(m.delay(ev))
+					mountEvent(ev)
+				}
+			}
+		})
+	}
+	return errg.Wait()
+}
+
+func (m *delayMounter) AddEntry(ctx context.Context, ev *model.PolymorphicEvent) error {
+	ev.SetUpFinishedChan()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case m.input <- ev:
+	}
+	return nil
+}
+
+func (m *delayMounter) WaitPrepare(ctx context.Context, ev *model.PolymorphicEvent) error {
+	return ev.WaitPrepare(ctx)
+}
+
+// mountEvent mounts the event with a row of its ts, the deleted rows of the
+// odd start ts are mounted to nil
+func mountEvent(ev *model.PolymorphicEvent) {
+	if ev.StartTs%2 == 0 {
+		ev.Row = &model.RowChangedEvent{StartTs: ev.StartTs, CommitTs: ev.CRTs}
+	}
+	ev.PrepareFinished()
+}
+
+func newEmitterTestEvent(ts uint64) *model.PolymorphicEvent {
+	ev := model.NewPolymorphicEvent(&model.RawKVEntry{OpType: model.OpTypePut, StartTs: ts, CRTs: ts})
+	ev.SetUpFinishedChan()
+	return ev
+}
+
+// batchSink records the rows of each call of EmitRowChangedEvents, onEmit
+// is called with the rows before they're recorded if it's set
+type batchSink struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	onEmit  func(rows []*model.RowChangedEvent)
+	batches [][]uint64
+}
+
+func (s *batchSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	if s.delay > 0 {
+		time.Sleep(s.delay * time.Duration(len(rows)))
+	}
+	if s.onEmit != nil {
+		s.onEmit(rows)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		batch = append(batch, row.StartTs)
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *batchSink) rows() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []uint64
+	for _, batch := range s.batches {
+		rows = append(rows, batch...)
+	}
+	return rows
+}
+
+// emittedRecorder records the ts of the events passed to onEmitted
+type emittedRecorder struct {
+	batches [][]uint64
+}
+
+func (r *emittedRecorder) onEmitted(events []*model.PolymorphicEvent) {
+	batch := make([]uint64, 0, len(events))
+	for _, ev := range events {
+		batch = append(batch, ev.StartTs)
+	}
+	r.batches = append(r.batches, batch)
+}
+
+func setEmitPrefixRows(rows int) func() {
+	old := emitPrefixRows
+	emitPrefixRows = rows
+	return func() {
+		emitPrefixRows = old
+	}
+}
+
+func (s *emitterSuite) TestEmitOrder(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer setEmitPrefixRows(16)()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the events are mounted out of order by the workers
+	mounter := newDelayMounter(8, func(ev *model.PolymorphicEvent) time.Duration {
+		return time.Duration(rand.Intn(200)) * time.Microsecond
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := mounter.Run(ctx)
+		c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	s1 := &batchSink{}
+	recorder := &emittedRecorder{}
+	emitter := NewRowEmitter(s1, mounter, 256, recorder.onEmitted)
+	var expectedRows, expectedEvents []uint64
+	ts := uint64(0)
+	for batch := 0; batch < 10; batch++ {
+		for i := 0; i < 256; i++ {
+			ts++
+			ev := newEmitterTestEvent(ts)
+			c.Assert(mounter.AddEntry(ctx, ev), check.IsNil)
+			emitter.Append(ev)
+			expectedEvents = append(expectedEvents, ts)
+			if ts%2 == 0 {
+				expectedRows = append(expectedRows, ts)
+			}
+		}
+		c.Assert(emitter.Emit(ctx), check.IsNil)
+		c.Assert(emitter.Len(), check.Equals, 0)
+	}
+	// the rows are emitted in the order of the events, and each event is
+	// passed to onEmitted once in the order
+	c.Assert(s1.rows(), check.DeepEquals, expectedRows)
+	var emittedEvents []uint64
+	for _, batch := range recorder.batches {
+		emittedEvents = append(emittedEvents, batch...)
+	}
+	c.Assert(emittedEvents, check.DeepEquals, expectedEvents)
+}
+
+func (s *emitterSuite) TestEmitPrefix(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer setEmitPrefixRows(2)()
+	ctx := context.Background()
+
+	events := make([]*model.PolymorphicEvent, 0, 8)
+	for ts := uint64(0); ts < 8; ts++ {
+		events = append(events, newEmitterTestEvent(ts))
+	}
+	// the events are mounted in the reverse order after the prefix is
+	// emitted, so the rest is mounted while the prefix is being emitted
+	for _, ev := range events[:5] {
+		mountEvent(ev)
+	}
+	s1 := &batchSink{}
+	s1.onEmit = func(rows []*model.RowChangedEvent) {
+		c.Assert(events[5].IsPrepared(), check.IsFalse)
+		for i := len(events) - 1; i >= 5; i-- {
+			mountEvent(events[i])
+		}
+		s1.onEmit = nil
+	}
+	recorder := &emittedRecorder{}
+	emitter := NewRowEmitter(s1, &delayMounter{}, 8, recorder.onEmitted)
+	for _, ev := range events {
+		emitter.Append(ev)
+	}
+	c.Assert(emitter.Emit(ctx), check.IsNil)
+	c.Assert(s1.batches, check.DeepEquals, [][]uint64{{0, 2, 4}, {6}})
+	c.Assert(recorder.batches, check.DeepEquals, [][]uint64{{0, 1, 2, 3, 4}, {5, 6, 7}})
+
+	// the mounted events are emitted at once however many they are
+	s1.batches = nil
+	recorder.batches = nil
+	for ts := uint64(10); ts < 16; ts++ {
+		ev := newEmitterTestEvent(ts)
+		mountEvent(ev)
+		emitter.Append(ev)
+	}
+	c.Assert(emitter.Emit(ctx), check.IsNil)
+	c.Assert(s1.batches, check.DeepEquals, [][]uint64{{10, 12, 14}})
+	c.Assert(recorder.batches, check.DeepEquals, [][]uint64{{10, 11, 12, 13, 14, 15}})
+}
+
+func (s *emitterSuite) TestEmitCanceled(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer setEmitPrefixRows(1)()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first, second := newEmitterTestEvent(0), newEmitterTestEvent(2)
+	mountEvent(first)
+	s1 := &batchSink{}
+	s1.onEmit = func(rows []*model.RowChangedEvent) {
+		cancel()
+	}
+	recorder := &emittedRecorder{}
+	emitter := NewRowEmitter(s1, &delayMounter{}, 2, recorder.onEmitted)
+	emitter.Append(first)
+	emitter.Append(second)
+	err := emitter.Emit(ctx)
+	c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+	// only the prefix mounted is emitted
+	c.Assert(s1.batches, check.DeepEquals, [][]uint64{{0}})
+	c.Assert(recorder.batches, check.DeepEquals, [][]uint64{{0}})
+}
+
+// BenchmarkEmitWideRows emits the batches of the wide rows, which are slow to
+// be decoded, to a sink with latency, and compares waiting for the whole
+// batch to be mounted before emitting it with emitting the mounted prefix.
+func BenchmarkEmitWideRows(b *testing.B) {
+	const (
+		batchSize = 1024
+		workers   = 16
+		decode    = time.Millisecond
+		sinkDelay = 60 * time.Microsecond
+	)
+	for _, bench := range []struct {
+		name       string
+		prefixRows int
+	}{
+		{name: "serial", prefixRows: batchSize + 1},
+		{name: "prefix", prefixRows: emitPrefixRows},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			defer setEmitPrefixRows(bench.prefixRows)()
+			ctx, cancel := context.WithCancel(context.Background())
+			mounter := newDelayMounter(workers, func(ev *model.PolymorphicEvent) time.Duration {
+				return decode
+			})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = mounter.Run(ctx)
+			}()
+			emitter := NewRowEmitter(&batchSink{delay: sinkDelay}, mounter, batchSize, nil)
+			b.ResetTimer()
+			start := time.Now()
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < batchSize; i++ {
+					ev := newEmitterTestEvent(uint64(i * 2))
+					if err := mounter.AddEntry(ctx, ev); err != nil {
+						b.Fatal(err)
+					}
+					emitter.Append(ev)
+				}
+				if err := emitter.Emit(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N*batchSize)/time.Since(start).Seconds(), "rows/s")
+			cancel()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	psorter "github.com/pingcap/ticdc/cdc/puller/sorter"
+)
+
+// NewSorter creates the sorter of the sort engine, the events are sorted in
+// memory if the engine is unknown. The sort dir must exist for the file and
+// unified sort engines.
+func NewSorter(engine model.SortEngine, sortDir string, tableName string, captureAddr string) puller.EventSorter {
+	switch engine {
+	case model.SortInFile:
+		return puller.NewFileSorter(sortDir)
+	case model.SortUnified:
+		return psorter.NewUnifiedSorter(sortDir, tableName, captureAddr)
+	default:
+		return puller.NewEntrySorter()
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// The resources limited by the budget of a changefeed, which are the values of
+// the resource label of the budget metrics.
+const (
+	budgetResourceMemory = "memory-quota"
+	budgetResourceEvents = "events-per-second"
+	// the store bytes per second is enforced by the kv client, only its
+	// budget is exported.
+	budgetResourceStoreBytes = "store-bytes-per-second"
+)
+
+// budgetWarnDuration is how long the usage of a resource stays at its budget
+// before the budget is reported as exceeded.
+var budgetWarnDuration = 30 * time.Second
+
+// changefeedBudget limits the resources used by the processor of a changefeed,
+// so that a changefeed can't crowd out the others on the same capture. The
+// memory of the pullers and the mounter is a hard cap, the pullers are
+// blocked until the buffered events are consumed and decoded. The events per second is a soft cap, the
+// row changed events are delayed before they're sent to the mounter, while
+// the resolved events are never delayed. The events per second limit follows
+// the throttle schedule if any. The bytes pulled from each TiKV store per
+// second is capped by the kv client.
+type changefeedBudget struct {
+	changefeedID string
+	captureAddr  string
+
+	memory *puller.BlurResourceLimitter
+	events *rate.Limiter
+
+	// consumed and throttled are the number of the events passed and delayed
+	// since the last observation
+	consumed  int64
+	throttled int64
+
+	mu           sync.Mutex
+	lastObserved time.Time
+	// reachedSince records since when the usage of each resource stays at
+	// its budget
+	reachedSince map[string]time.Time
+	exceeded     []string
+
+	// eventsPerSecond is the events per second of the budget config, which
+	// applies out of the windows of the schedule.
+	eventsPerSecond int
+	schedule        *throttleSchedule
+	// eventsRate is the events per second measured at the last observation.
+	eventsRate float64
+	// the limit moves from rampFrom to target since rampStart in the
+	// transition of the schedule.
+	target    rate.Limit
+	rampFrom  rate.Limit
+	rampStart time.Time
+	// now is the clock the schedule is evaluated with.
+	now func() time.Time
+}
+
+func newChangefeedBudget(changefeedID, captureAddr string, cfg *config.BudgetConfig) *changefeedBudget {
+	b := &changefeedBudget{
+		changefeedID: changefeedID,
+		captureAddr:  captureAddr,
+		memory:       puller.NewBlurResourceLimmter(defaultMemBufferCapacity),
+		events:       rate.NewLimiter(rate.Inf, 0),
+		lastObserved: time.Now(),
+		reachedSince: make(map[string]time.Time),
+		now:          time.Now,
+	}
+	b.update(cfg)
+	return b
+}
+
+// update applies the budget config, the new budget takes effect on the
+// pullers and the tables immediately.
+func (b *changefeedBudget) update(cfg *config.BudgetConfig) {
+	memoryQuota := defaultMemBufferCapacity
+	var eventsPerSecond int
+	var storeBytesPerSecond int64
+	if cfg != nil {
+		if cfg.MemoryQuota > 0 {
+			memoryQuota = cfg.MemoryQuota
+		}
+		eventsPerSecond = cfg.EventsPerSecond
+		storeBytesPerSecond = cfg.StoreBytesPerSecond
+	}
+	b.memory.SetBudget(memoryQuota)
+	kv.SetStorePullRateLimit(b.captureAddr, b.changefeedID, storeBytesPerSecond)
+	b.mu.Lock()
+	b.eventsPerSecond = eventsPerSecond
+	b.throttle(b.now())
+	b.mu.Unlock()
+	budgetGauge.WithLabelValues(b.changefeedID, b.captureAddr, budgetResourceMemory).Set(float64(memoryQuota))
+	budgetGauge.WithLabelValues(b.changefeedID, b.captureAddr, budgetResourceEvents).Set(float64(eventsPerSecond))
+	budgetGauge.WithLabelValues(b.changefeedID, b.captureAddr, budgetResourceStoreBytes).Set(float64(storeBytesPerSecond))
+}
+
+// updateSchedule applies the throttle schedule config, nil removes the
+// schedule. The schedule is kept if the config is invalid.
+func (b *changefeedBudget) updateSchedule(cfg *config.ThrottleScheduleConfig) error {
+	var schedule *throttleSchedule
+	if cfg != nil {
+		var err error
+		schedule, err = newThrottleSchedule(cfg)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.schedule = schedule
+	b.throttle(b.now())
+	return nil
+}
+
+// throttle sets the events per second limit at now by the schedule, it must
+// be called with mu held. A new limit is reached linearly in the transition
+// of the schedule, starting from the measured events rate if the old limit
+// is unlimited. The limit is lifted at once if the new limit is unlimited.
+func (b *changefeedBudget) throttle(now time.Time) {
+	target := rate.Inf
+	if eventsPerSecond := b.schedule.eventsPerSecond(now, b.eventsPerSecond); eventsPerSecond > 0 {
+		target = rate.Limit(eventsPerSecond)
+	}
+	if target != b.target {
+		b.rampFrom = b.events.Limit()
+		if b.rampFrom == rate.Inf {
+			b.rampFrom = rate.Limit(b.eventsRate)
+		}
+		b.target = target
+		b.rampStart = now
+	}
+
+	limit := b.target
+	if b.schedule != nil && limit != rate.Inf && b.rampFrom > 0 {
+		if elapsed := now.Sub(b.rampStart); elapsed >= 0 && elapsed < b.schedule.transition {
+			limit = b.rampFrom + (limit-b.rampFrom)*rate.Limit(elapsed)/rate.Limit(b.schedule.transition)
+		}
+	}
+	if limit != b.events.Limit() {
+		if limit != rate.Inf {
+			burst := int(limit)
+			if burst < 1 {
+				burst = 1
+			}
+			b.events.SetBurst(burst)
+		}
+		b.events.SetLimit(limit)
+	}
+	value := 0.0
+	if limit != rate.Inf {
+		value = float64(limit)
+	}
+	throttleLimitGauge.WithLabelValues(b.changefeedID, b.captureAddr).Set(value)
+}
+
+// waitEvent blocks until a row changed event is allowed by the events per
+// second budget. It never blocks if the budget is nil.
+func (b *changefeedBudget) waitEvent(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	atomic.AddInt64(&b.consumed, 1)
+	if b.events.Allow() {
+		return nil
+	}
+	atomic.AddInt64(&b.throttled, 1)
+	return errors.Trace(b.events.Wait(ctx))
+}
+
+// observe exports the usage of the budget at now, and records the resources
+// which stay at their budget for budgetWarnDuration as exceeded. The limit of
+// the schedule at now is applied as well.
+func (b *changefeedBudget) observe(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	consumed := atomic.SwapInt64(&b.consumed, 0)
+	throttled := atomic.SwapInt64(&b.throttled, 0)
+	if elapsed := now.Sub(b.lastObserved).Seconds(); elapsed > 0 {
+		b.eventsRate = float64(consumed) / elapsed
+		budgetUsageGauge.WithLabelValues(b.changefeedID, b.captureAddr, budgetResourceEvents).Set(b.eventsRate)
+	}
+	b.lastObserved = now
+	budgetUsageGauge.WithLabelValues(b.changefeedID, b.captureAddr, budgetResourceMemory).Set(float64(b.memory.Used()))
+
+	var exceeded []string
+	for _, resource := range []string{budgetResourceMemory, budgetResourceEvents} {
+		reached := throttled > 0
+		if resource == budgetResourceMemory {
+			reached = b.memory.Waiting()
+		}
+		since, ok := b.reachedSince[resource]
+		value := 0.0
+		switch {
+		case !reached:
+			delete(b.reachedSince, resource)
+		case !ok:
+			b.reachedSince[resource] = now
+		case now.Sub(since) >= budgetWarnDuration:
+			exceeded = append(exceeded, resource)
+			value = 1
+		}
+		budgetExceededGauge.WithLabelValues(b.changefeedID, b.captureAddr, resource).Set(value)
+	}
+	if len(exceeded) > len(b.exceeded) {
+		eventsPerSecond := 0
+		if limit := b.events.Limit(); limit != rate.Inf {
+			eventsPerSecond = int(limit)
+		}
+		log.Warn("the budget of the changefeed is exceeded", zap.String("changefeed", b.changefeedID),
+			zap.Strings("resources", exceeded), zap.Int64("memoryQuota", b.memory.Budget()),
+			zap.Int("eventsPerSecond", eventsPerSecond))
+	}
+	b.exceeded = exceeded
+	b.throttle(now)
+}
+
+// exceededResources returns the resources whose budget is exceeded at the
+// last observation.
+func (b *changefeedBudget) exceededResources() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+func (b *changefeedBudget) deleteMetrics() {
+	if b == nil {
+		return
+	}
+	for _, resource := range []string{budgetResourceMemory, budgetResourceEvents} {
+		budgetGauge.DeleteLabelValues(b.changefeedID, b.captureAddr, resource)
+		budgetUsageGauge.DeleteLabelValues(b.changefeedID, b.captureAddr, resource)
+		budgetExceededGauge.DeleteLabelValues(b.changefeedID, b.captureAddr, resource)
+	}
+	budgetGauge.DeleteLabelValues(b.changefeedID, b.captureAddr, budgetResourceStoreBytes)
+	throttleLimitGauge.DeleteLabelValues(b.changefeedID, b.captureAddr)
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+type processorBudgetSuite struct{}
+
+var _ = check.Suite(&processorBudgetSuite{})
+
+func (s *processorBudgetSuite) TestUpdate(c *check.C) {
+	defer testleak.AfterTest(c)()
+	b := newChangefeedBudget("test-changefeed", "127.0.0.1:8300", &config.BudgetConfig{})
+	defer b.deleteMetrics()
+	c.Assert(b.memory.Budget(), check.Equals, defaultMemBufferCapacity)
+	c.Assert(b.events.Limit(), check.Equals, rate.Inf)
+
+	b.update(&config.BudgetConfig{MemoryQuota: 1024, EventsPerSecond: 100})
+	c.Assert(b.memory.Budget(), check.Equals, int64(1024))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(100))
+	c.Assert(b.events.Burst(), check.Equals, 100)
+	c.Assert(testutil.ToFloat64(budgetGauge.WithLabelValues("test-changefeed", "127.0.0.1:8300", budgetResourceMemory)),
+		check.Equals, float64(1024))
+	c.Assert(testutil.ToFloat64(budgetGauge.WithLabelValues("test-changefeed", "127.0.0.1:8300", budgetResourceEvents)),
+		check.Equals, float64(100))
+
+	// 0 means the default memory quota and unlimited events
+	b.update(&config.BudgetConfig{})
+	c.Assert(b.memory.Budget(), check.Equals, defaultMemBufferCapacity)
+	c.Assert(b.events.Limit(), check.Equals, rate.Inf)
+}
+
+func (s *processorBudgetSuite) TestObserve(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer func(d time.Duration) { budgetWarnDuration = d }(budgetWarnDuration)
+	budgetWarnDuration = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newChangefeedBudget("test-changefeed", "127.0.0.1:8300", &config.BudgetConfig{MemoryQuota: 100})
+	defer b.deleteMetrics()
+	memoryExceeded := budgetExceededGauge.WithLabelValues("test-changefeed", "127.0.0.1:8300", budgetResourceMemory)
+
+	// the puller is blocked by the memory quota
+	b.memory.Add(100)
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- b.memory.Wait(ctx)
+	}()
+	for !b.memory.Waiting() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	now := time.Now()
+	b.observe(now)
+	c.Assert(b.exceededResources(), check.HasLen, 0)
+	c.Assert(testutil.ToFloat64(budgetUsageGauge.WithLabelValues("test-changefeed", "127.0.0.1:8300", budgetResourceMemory)),
+		check.Equals, float64(100))
+	b.observe(now.Add(30 * time.Second))
+	c.Assert(b.exceededResources(), check.HasLen, 0)
+	// the memory quota is exceeded after it's reached for budgetWarnDuration
+	b.observe(now.Add(time.Minute))
+	c.Assert(b.exceededResources(), check.DeepEquals, []string{budgetResourceMemory})
+	c.Assert(testutil.ToFloat64(memoryExceeded), check.Equals, float64(1))
+
+	// the puller is unblocked after the memory is released
+	b.memory.Add(-100)
+	c.Assert(<-waitDone, check.IsNil)
+	b.observe(now.Add(2 * time.Minute))
+	c.Assert(b.exceededResources(), check.HasLen, 0)
+	c.Assert(testutil.ToFloat64(memoryExceeded), check.Equals, float64(0))
+
+	// the events are throttled in every observation
+	b.update(&config.BudgetConfig{MemoryQuota: 100, EventsPerSecond: 100})
+	now = time.Now()
+	for i := 0; i < 3; i++ {
+		c.Assert(b.waitEvent(ctx), check.IsNil)
+		c.Assert(b.waitEvent(ctx), check.IsNil)
+		b.observe(now.Add(time.Duration(i) * time.Minute))
+	}
+	c.Assert(b.exceededResources(), check.DeepEquals, []string{budgetResourceEvents})
+
+	// the nil budget doesn't limit anything
+	var nilBudget *changefeedBudget
+	c.Assert(nilBudget.waitEvent(ctx), check.IsNil)
+	nilBudget.observe(now)
+	c.Assert(nilBudget.exceededResources(), check.HasLen, 0)
+}
+
+func (s *processorBudgetSuite) TestApplyBudget(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	cfg := config.GetDefaultReplicaConfig()
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	p.budget = newChangefeedBudget(p.changefeedID, p.captureInfo.AdvertiseAddr, cfg.Budget)
+	p.budgetConfig = cfg.Budget
+	defer p.budget.deleteMetrics()
+
+	info := &model.ChangeFeedInfo{Config: config.GetDefaultReplicaConfig()}
+	info.Config.Budget = &config.BudgetConfig{MemoryQuota: 1024, EventsPerSecond: 10}
+	raw, err := info.Marshal()
+	c.Assert(err, check.IsNil)
+	p.applyBudget(ctx, []byte(raw))
+	c.Assert(p.budget.memory.Budget(), check.Equals, int64(1024))
+	c.Assert(p.budget.events.Limit(), check.Equals, rate.Limit(10))
+	c.Assert(p.budgetConfig, check.DeepEquals, info.Config.Budget)
+
+	// the invalid info is ignored
+	p.applyBudget(ctx, []byte("invalid"))
+	c.Assert(p.budget.memory.Budget(), check.Equals, int64(1024))
+}
+
+// newBudgetTestPipeline returns a table pipeline of a processor with the
+// budget, whose mounter and output are drained.
+func newBudgetTestPipeline(ctx context.Context, changefeedID string, cfg *config.BudgetConfig) (*processor, *tablePipeline) {
+	p := newProcessorForTest()
+	p.changefeedID = changefeedID
+	p.budget = newChangefeedBudget(changefeedID, p.captureInfo.AdvertiseAddr, cfg)
+	go p.mounter.Run(ctx) //nolint:errcheck
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.output:
+			}
+		}
+	}()
+	pipeline := p.newTablePipeline(1, "`test`.`t`", new(uint64), new(int64), nil, nil,
+		&model.TableReplicaInfo{StartTs: 1})
+	sorter := &passThroughSorter{ch: make(chan *model.PolymorphicEvent, 1024)}
+	pipeline.start(ctx, puller.NewRectifier(sorter, 1000))
+	return p, pipeline
+}
+
+func (s *processorBudgetSuite) TestCappedChangefeedDoesNotCrowdOut(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	capped, cappedPipeline := newBudgetTestPipeline(ctx, "capped-changefeed", &config.BudgetConfig{EventsPerSecond: 10})
+	defer capped.budget.deleteMetrics()
+	normal, normalPipeline := newBudgetTestPipeline(ctx, "normal-changefeed", &config.BudgetConfig{})
+	defer normal.budget.deleteMetrics()
+
+	// the shared source sends the same events to both changefeeds
+	for ts := uint64(2); ts <= 201; ts++ {
+		cappedPipeline.addEntry(ctx, newDrainTestEvent(1, ts))
+		normalPipeline.addEntry(ctx, newDrainTestEvent(1, ts))
+	}
+	cappedPipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 202))
+	normalPipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 202))
+
+	// the resolved ts of the normal changefeed advances without waiting for
+	// the capped one, which is throttled by its budget
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(normalPipeline.pResolvedTs) != 202 {
+		c.Assert(time.Now().Before(deadline), check.IsTrue)
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadUint64(cappedPipeline.pResolvedTs), check.Less, uint64(202))
+	c.Assert(atomic.LoadInt64(normalPipeline.pPendingEvents), check.Equals, int64(200))
+	c.Assert(atomic.LoadInt64(cappedPipeline.pPendingEvents), check.Less, int64(200))
+
+	cancel()
+	<-cappedPipeline.sorterDone
+	<-normalPipeline.sorterDone
+	c.Assert(capped.errs.first(), check.IsNil)
+}
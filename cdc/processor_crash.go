@@ -0,0 +1,220 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+	"go.uber.org/zap"
+)
+
+const (
+	// crashDirName is the dir in the sort dir which the errors of the
+	// processors are written to if they can't be recorded in etcd
+	crashDirName = "crash"
+	crashFileExt = ".crash"
+)
+
+// the retry budget of recording the error of a processor in etcd, the error
+// is written to a crash file once the budget is used up
+var (
+	processorErrorUploadRetries uint64 = 5
+	processorErrorUploadBackoff        = 200 * time.Millisecond
+	// processorErrorUploadTimeout is the timeout of each attempt, so that an
+	// unreachable etcd doesn't hang the attempt
+	processorErrorUploadTimeout = 3 * time.Second
+)
+
+// crashDir returns the dir of the crash files in the sort dir
+func crashDir(sortDir string) string {
+	return filepath.Join(sortDir, crashDirName)
+}
+
+// processorCrashRecord is the minimal error record of a processor which fails
+// to be recorded in etcd, it's uploaded to the changefeed history by the
+// capture on the next connection to etcd.
+type processorCrashRecord struct {
+	Changefeed   model.ChangeFeedID  `json:"changefeed"`
+	CaptureAddr  string              `json:"capture-addr"`
+	Time         time.Time           `json:"time"`
+	CheckpointTs model.Ts            `json:"checkpoint-ts"`
+	Error        *model.RunningError `json:"error"`
+}
+
+// recordError records the error in the task position with the bounded
+// retries, the error is written to a crash file in the sort dir if etcd is
+// unreachable.
+func (p *processor) recordError(ctx context.Context, runningErr *model.RunningError, errTime time.Time) {
+	p.position.Error = runningErr
+	retryCfg := backoff.NewExponentialBackOff()
+	retryCfg.InitialInterval = processorErrorUploadBackoff
+	attempts := 0
+	err := backoff.Retry(func() error {
+		attempts++
+		attemptCtx, cancel := context.WithTimeout(ctx, processorErrorUploadTimeout)
+		defer cancel()
+		_, err := p.etcdCli.PutTaskPositionOnChange(attemptCtx, p.changefeedID, p.captureInfo.ID, p.position)
+		if err != nil {
+			log.Warn("upload processor error failed",
+				zap.String("changefeed", p.changefeedID),
+				zap.Int("attempts", attempts),
+				zap.Uint64("maxRetries", processorErrorUploadRetries),
+				zap.Error(err))
+		}
+		return err
+	}, backoff.WithMaxRetries(backoff.WithContext(retryCfg, ctx), processorErrorUploadRetries))
+	if err == nil {
+		return
+	}
+	record := &processorCrashRecord{
+		Changefeed:   p.changefeedID,
+		CaptureAddr:  p.captureInfo.AdvertiseAddr,
+		Time:         errTime,
+		CheckpointTs: p.position.CheckPointTs,
+		Error:        runningErr,
+	}
+	path, err := writeCrashRecord(p.changefeed.SortDir, p.captureInfo.ID, record)
+	if err != nil {
+		log.Error("processor error is lost, it can't be written to the crash file",
+			zap.String("changefeed", p.changefeedID),
+			zap.Reflect("error", runningErr),
+			zap.Error(err))
+		return
+	}
+	log.Warn("processor error is written to the crash file, it's uploaded on the next connection to etcd",
+		zap.String("changefeed", p.changefeedID),
+		zap.String("path", path))
+}
+
+func writeCrashRecord(sortDir string, captureID string, record *processorCrashRecord) (string, error) {
+	dir := crashDir(sortDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", cerror.WrapError(cerror.ErrMarshalFailed, err)
+	}
+	name := fmt.Sprintf("%s-%s-%d%s", record.Changefeed, captureID, record.Time.UnixNano(), crashFileExt)
+	path := filepath.Join(dir, name)
+	// the record is renamed after it's written, so that a partial file is
+	// never uploaded
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0o644); err != nil {
+		return "", cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	return path, nil
+}
+
+// uploadCrashRecords appends the errors in the crash files written by the
+// processors of the capture address to the histories of the changefeeds, with
+// the original time of the errors. The crash files are looked up in the sort
+// dirs of the changefeeds, and removed after they're uploaded.
+func uploadCrashRecords(ctx context.Context, cli kv.CDCEtcdClient, captureAddr string) error {
+	_, infos, err := cli.GetChangeFeeds(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	dirs := make(map[string]struct{})
+	for changefeedID, rawKv := range infos {
+		info := new(model.ChangeFeedInfo)
+		if err := info.Unmarshal(rawKv.Value); err != nil {
+			log.Warn("failed to unmarshal changefeed info", zap.String("changefeed", changefeedID), zap.Error(err))
+			continue
+		}
+		dirs[crashDir(info.SortDir)] = struct{}{}
+	}
+	for dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return cerror.WrapError(cerror.ErrProcessorSortDir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), crashFileExt) {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			if err := uploadCrashRecord(ctx, cli, captureAddr, path, infos); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+func uploadCrashRecord(
+	ctx context.Context, cli kv.CDCEtcdClient, captureAddr string, path string, infos map[model.ChangeFeedID]*mvccpb.KeyValue,
+) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	record := new(processorCrashRecord)
+	if err := json.Unmarshal(data, record); err != nil {
+		log.Warn("the malformed crash file is removed", zap.String("path", path), zap.Error(err))
+		return errors.Trace(removeCrashFile(path))
+	}
+	// the sort dir may be shared by the captures on the same host
+	if record.CaptureAddr != captureAddr {
+		return nil
+	}
+	if _, ok := infos[record.Changefeed]; !ok {
+		log.Warn("the crash file of the removed changefeed is dropped",
+			zap.String("path", path), zap.Reflect("record", record))
+		return errors.Trace(removeCrashFile(path))
+	}
+	message := fmt.Sprintf("processor of capture %s failed, the error is recorded late", record.CaptureAddr)
+	if record.Error != nil {
+		message += fmt.Sprintf(": [%s] %s", record.Error.Code, record.Error.Message)
+	}
+	err = cli.AppendChangeFeedHistory(ctx, record.Changefeed, &model.ChangefeedEvent{
+		Time:    record.Time,
+		Type:    model.ChangefeedEventError,
+		Ts:      record.CheckpointTs,
+		Message: message,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("the processor error in the crash file is uploaded",
+		zap.String("changefeed", record.Changefeed), zap.String("path", path))
+	return errors.Trace(removeCrashFile(path))
+}
+
+func removeCrashFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorCrashSuite struct{}
+
+var _ = check.Suite(&processorCrashSuite{})
+
+func setProcessorErrorUploadBudget(retries uint64, timeout time.Duration) func() {
+	oldRetries, oldBackoff, oldTimeout := processorErrorUploadRetries, processorErrorUploadBackoff, processorErrorUploadTimeout
+	processorErrorUploadRetries, processorErrorUploadBackoff, processorErrorUploadTimeout = retries, 10*time.Millisecond, timeout
+	return func() {
+		processorErrorUploadRetries, processorErrorUploadBackoff, processorErrorUploadTimeout = oldRetries, oldBackoff, oldTimeout
+	}
+}
+
+func (s *processorCrashSuite) TestRecordError(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer setProcessorErrorUploadBudget(2, time.Second)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+
+	p, _ := newStopTestProcessor(c, etcdCli, nil)
+	p.changefeed.SortDir = c.MkDir()
+	p.position = &model.TaskPosition{CheckPointTs: 100}
+	runningErr := &model.RunningError{Addr: p.captureInfo.AdvertiseAddr, Code: "CDC:ErrSinkURIInvalid", Message: "test"}
+	p.recordError(ctx, runningErr, time.Now())
+
+	// the error is recorded in the task position, no crash file is written
+	_, position, err := etcdCli.GetTaskPosition(ctx, p.changefeedID, p.captureInfo.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(position.Error, check.DeepEquals, runningErr)
+	files, err := ioutil.ReadDir(crashDir(p.changefeed.SortDir))
+	c.Assert(err, check.NotNil)
+	c.Assert(files, check.HasLen, 0)
+}
+
+func (s *processorCrashSuite) TestUploadCrashRecord(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer setProcessorErrorUploadBudget(2, 200*time.Millisecond)()
+	ctx := context.Background()
+	sortDir := c.MkDir()
+
+	// etcd is cut during the error path, so the error is written to the
+	// crash file after the retries
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	p, _ := newStopTestProcessor(c, etcdCli, nil)
+	p.changefeed.SortDir = sortDir
+	p.position = &model.TaskPosition{CheckPointTs: 100}
+	teardown()
+	errTime := time.Unix(1600000000, 0)
+	runningErr := &model.RunningError{Addr: p.captureInfo.AdvertiseAddr, Code: "CDC:ErrSinkURIInvalid", Message: "test"}
+	p.recordError(ctx, runningErr, errTime)
+	files, err := ioutil.ReadDir(crashDir(sortDir))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+	c.Assert(strings.HasSuffix(files[0].Name(), crashFileExt), check.IsTrue)
+
+	// the crash file is uploaded on the next connection to etcd
+	etcdCli, teardown = setUpStopTestEtcd(c)
+	defer teardown()
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://", SortDir: sortDir}
+	c.Assert(etcdCli.SaveChangeFeedInfo(ctx, info, p.changefeedID), check.IsNil)
+	// the files of the other captures are kept
+	c.Assert(uploadCrashRecords(ctx, etcdCli, "127.0.0.1:8301"), check.IsNil)
+	_, history, err := etcdCli.GetChangeFeedHistory(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 0)
+
+	c.Assert(uploadCrashRecords(ctx, etcdCli, p.captureInfo.AdvertiseAddr), check.IsNil)
+	_, history, err = etcdCli.GetChangeFeedHistory(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 1)
+	event := history.Events[0]
+	c.Assert(event.Type, check.Equals, model.ChangefeedEventError)
+	c.Assert(event.Time.Equal(errTime), check.IsTrue)
+	c.Assert(event.Ts, check.Equals, uint64(100))
+	c.Assert(event.Message, check.Matches, ".*recorded late: \\[CDC:ErrSinkURIInvalid\\] test")
+	files, err = ioutil.ReadDir(crashDir(sortDir))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+
+	// the uploaded record is not uploaded again
+	c.Assert(uploadCrashRecords(ctx, etcdCli, p.captureInfo.AdvertiseAddr), check.IsNil)
+	_, history, err = etcdCli.GetChangeFeedHistory(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 1)
+}
+
+func (s *processorCrashSuite) TestUploadCrashRecordOfRemovedChangefeed(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+	sortDir := c.MkDir()
+
+	info := &model.ChangeFeedInfo{SinkURI: "blackhole://", SortDir: sortDir}
+	c.Assert(etcdCli.SaveChangeFeedInfo(ctx, info, "test-changefeed"), check.IsNil)
+	_, err := writeCrashRecord(sortDir, "capture-1", &processorCrashRecord{
+		Changefeed:  "removed-changefeed",
+		CaptureAddr: "127.0.0.1:8300",
+		Time:        time.Now(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(uploadCrashRecords(ctx, etcdCli, "127.0.0.1:8300"), check.IsNil)
+	files, err := ioutil.ReadDir(crashDir(sortDir))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+	_, history, err := etcdCli.GetChangeFeedHistory(ctx, "removed-changefeed")
+	c.Assert(err, check.IsNil)
+	c.Assert(history.Events, check.HasLen, 0)
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"hash/fnv"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// dedupKey identifies a row changed event of a table, the hash covers the key
+// and the values of the event, so only the exact duplicates are matched.
+type dedupKey struct {
+	crts    model.Ts
+	startTs model.Ts
+	opType  model.OpType
+	hash    uint64
+}
+
+func newDedupKey(raw *model.RawKVEntry) dedupKey {
+	h := fnv.New64a()
+	// Write of hash.Hash never returns an error
+	_, _ = h.Write(raw.Key)
+	_, _ = h.Write(raw.Value)
+	_, _ = h.Write(raw.OldValue)
+	return dedupKey{
+		crts:    raw.CRTs,
+		startTs: raw.StartTs,
+		opType:  raw.OpType,
+		hash:    h.Sum64(),
+	}
+}
+
+// eventDeduplicator remembers the recent events of a table and finds the
+// events re-delivered by the puller, e.g. by the kv client for the overlap
+// window after a region leader transfer. The memory is bounded by the window
+// size, the oldest events are forgotten first.
+type eventDeduplicator struct {
+	windowSize int
+	seen       map[dedupKey]struct{}
+	// window is a ring buffer of the remembered events, it grows to the window
+	// size on demand, so the idle tables take little memory
+	window []dedupKey
+	next   int
+}
+
+// newEventDeduplicator creates an eventDeduplicator, a nil deduplicator is
+// returned if the window size is not positive, which never finds duplicates.
+func newEventDeduplicator(windowSize int) *eventDeduplicator {
+	if windowSize <= 0 {
+		return nil
+	}
+	return &eventDeduplicator{
+		windowSize: windowSize,
+		seen:       make(map[dedupKey]struct{}),
+	}
+}
+
+// isDuplicate returns true if the event is in the window, otherwise the event
+// is remembered. The resolved events are never duplicates.
+func (d *eventDeduplicator) isDuplicate(event *model.PolymorphicEvent) bool {
+	if d == nil || event.RawKV == nil || event.RawKV.OpType == model.OpTypeResolved {
+		return false
+	}
+	key := newDedupKey(event.RawKV)
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if len(d.window) < d.windowSize {
+		d.window = append(d.window, key)
+	} else {
+		delete(d.seen, d.window[d.next])
+		d.window[d.next] = key
+		d.next = (d.next + 1) % len(d.window)
+	}
+	d.seen[key] = struct{}{}
+	return false
+}
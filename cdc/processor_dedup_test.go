@@ -0,0 +1,93 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type dedupSuite struct{}
+
+var _ = check.Suite(&dedupSuite{})
+
+func newDedupTestEvent(key string, value string, startTs, crts uint64) *model.PolymorphicEvent {
+	return model.NewPolymorphicEvent(&model.RawKVEntry{
+		OpType:  model.OpTypePut,
+		Key:     []byte(key),
+		Value:   []byte(value),
+		StartTs: startTs,
+		CRTs:    crts,
+	})
+}
+
+func (s *dedupSuite) TestDropRedeliveredEvents(c *check.C) {
+	defer testleak.AfterTest(c)()
+	d := newEventDeduplicator(4)
+	events := []*model.PolymorphicEvent{
+		newDedupTestEvent("a", "1", 1, 2),
+		newDedupTestEvent("b", "1", 1, 2),
+		newDedupTestEvent("a", "2", 3, 4),
+	}
+	for _, ev := range events {
+		c.Assert(d.isDuplicate(ev), check.IsFalse)
+	}
+	// the events re-delivered after a region retry, the copies are not the
+	// same objects as the original events
+	for _, ev := range events {
+		raw := *ev.RawKV
+		c.Assert(d.isDuplicate(model.NewPolymorphicEvent(&raw)), check.IsTrue)
+	}
+
+	// only the exact duplicates are dropped
+	c.Assert(d.isDuplicate(newDedupTestEvent("a", "3", 3, 4)), check.IsFalse)
+	c.Assert(d.isDuplicate(newDedupTestEvent("a", "2", 3, 5)), check.IsFalse)
+	deleted := newDedupTestEvent("a", "2", 3, 4)
+	deleted.RawKV.OpType = model.OpTypeDelete
+	c.Assert(d.isDuplicate(deleted), check.IsFalse)
+
+	// the resolved events are never dropped
+	c.Assert(d.isDuplicate(model.NewResolvedPolymorphicEvent(0, 5)), check.IsFalse)
+	c.Assert(d.isDuplicate(model.NewResolvedPolymorphicEvent(0, 5)), check.IsFalse)
+}
+
+func (s *dedupSuite) TestWindowIsBounded(c *check.C) {
+	defer testleak.AfterTest(c)()
+	d := newEventDeduplicator(3)
+	for i := uint64(1); i <= 10; i++ {
+		c.Assert(d.isDuplicate(newDedupTestEvent("a", "v", i, i+1)), check.IsFalse)
+		c.Assert(d.seen, check.HasLen, int(minUint64(i, 3)))
+		c.Assert(d.window, check.HasLen, int(minUint64(i, 3)))
+	}
+	// the last 3 events are remembered, the older ones are forgotten
+	for i := uint64(8); i <= 10; i++ {
+		c.Assert(d.isDuplicate(newDedupTestEvent("a", "v", i, i+1)), check.IsTrue)
+	}
+	c.Assert(d.isDuplicate(newDedupTestEvent("a", "v", 7, 8)), check.IsFalse)
+	c.Assert(d.seen, check.HasLen, 3)
+
+	// the dedup is disabled if the window size is 0
+	d = newEventDeduplicator(0)
+	c.Assert(d, check.IsNil)
+	c.Assert(d.isDuplicate(newDedupTestEvent("a", "v", 1, 2)), check.IsFalse)
+	c.Assert(d.isDuplicate(newDedupTestEvent("a", "v", 1, 2)), check.IsFalse)
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
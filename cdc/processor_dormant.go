@@ -0,0 +1,438 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/leaktest"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// dormantCheckInterval is the interval of checking whether the sorter of a
+// table is stopped, while waiting for the sorted events of the table to be all
+// consumed before its sorter is detached. The waiting is woken up once the
+// table is resolved.
+const dormantCheckInterval = 500 * time.Millisecond
+
+// tableSorter is the sorter of a table, which can be stopped safely at a
+// resolved ts
+type tableSorter interface {
+	SafeStop()
+	GetStatus() model.SorterStatus
+	GetMaxResolvedTs() model.Ts
+}
+
+// tablePipeline sorts the events pulled for a table and sends them to the
+// mounter and the output channel of the processor.
+//
+// The table is dormant if no row changed events are pulled for the idle
+// period, the sorter and its consumer are detached then, and the resolved
+// events are tracked by the puller consumer directly without going through
+// the sorter and the mounter. The sorter is attached again on the next row
+// changed event, which is added to the new sorter before any other events.
+type tablePipeline struct {
+	p              *processor
+	tableID        model.TableID
+	tableName      string
+	pResolvedTs    *uint64
+	pPendingEvents *int64
+	largeTxn       *largeTxnDetector
+	forced         *forcedResolvedTs
+	replicaInfo    *model.TableReplicaInfo
+	deduplicator   *eventDeduplicator
+	lane           *outputLane
+	// lastResolvedTs is loaded by opDoneWorker atomically
+	lastResolvedTs uint64
+	// resolvedCh is notified once the table is resolved
+	resolvedCh chan struct{}
+	// markTable is set if the table is a mark table of the cyclic replication
+	markTable bool
+
+	resolvedTsGauge          prometheus.Gauge
+	duplicateEventCounter    prometheus.Counter
+	forceDroppedEventCounter prometheus.Counter
+
+	// the fields below are used to detach and attach the sorter, idle is 0
+	// if the table never becomes dormant, and newSorter is nil then.
+	idle         time.Duration
+	targetTs     model.Ts
+	newSorter    func() puller.EventSorter
+	lastDataTime time.Time
+
+	mu     sync.Mutex
+	sorter *puller.Rectifier
+	// cancelSorter stops the sorter and its consumer, which close sorterDone
+	// after they exit.
+	cancelSorter context.CancelFunc
+	sorterDone   chan struct{}
+	// status and maxSentResolvedTs are maintained like the Rectifier while
+	// the table is dormant
+	status            model.SorterStatus
+	maxSentResolvedTs model.Ts
+}
+
+func (p *processor) newTablePipeline(
+	tableID model.TableID,
+	tableName string,
+	pResolvedTs *uint64,
+	pPendingEvents *int64,
+	largeTxn *largeTxnDetector,
+	forced *forcedResolvedTs,
+	replicaInfo *model.TableReplicaInfo,
+) *tablePipeline {
+	t := &tablePipeline{
+		p:                        p,
+		tableID:                  tableID,
+		tableName:                tableName,
+		pResolvedTs:              pResolvedTs,
+		pPendingEvents:           pPendingEvents,
+		largeTxn:                 largeTxn,
+		forced:                   forced,
+		replicaInfo:              replicaInfo,
+		lane:                     p.acquireOutputLane(tableID, replicaInfo.StartTs),
+		resolvedTsGauge:          tableResolvedTsGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName),
+		duplicateEventCounter:    tableDuplicateEventCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName),
+		forceDroppedEventCounter: tableForceDroppedEventCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, tableName),
+		lastDataTime:             time.Now(),
+		resolvedCh:               make(chan struct{}, 1),
+	}
+	if p.changefeed.Config.Dedup != nil {
+		t.deduplicator = newEventDeduplicator(p.changefeed.Config.Dedup.WindowSize)
+	}
+	return t
+}
+
+// enableDormant makes the table dormant after it's idle for the period, the
+// sorters are created by newSorter.
+func (t *tablePipeline) enableDormant(idle time.Duration, targetTs model.Ts, newSorter func() puller.EventSorter) {
+	t.idle = idle
+	t.targetTs = targetTs
+	t.newSorter = newSorter
+}
+
+// start attaches a sorter to the table, and runs the sorter and its consumer
+func (t *tablePipeline) start(ctx context.Context, sorter *puller.Rectifier) {
+	sorterCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	t.sorter = sorter
+	t.cancelSorter = cancel
+	t.sorterDone = done
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	deregisterSorter := leaktest.Register(errOriginSorter, t.p.changefeedID, t.tableID)
+	deregisterConsumer := leaktest.Register(errOriginSorter, t.p.changefeedID, t.tableID)
+	go func() {
+		defer wg.Done()
+		defer deregisterSorter()
+		err := sorter.Run(sorterCtx)
+		if errors.Cause(err) != context.Canceled {
+			t.p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, err))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer deregisterConsumer()
+		t.consume(sorterCtx, sorter)
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+}
+
+// isDormant returns true if the sorter of the table is detached
+func (t *tablePipeline) isDormant() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sorter == nil
+}
+
+// close is called after the puller consumer exits
+func (t *tablePipeline) close() {
+	if t.isDormant() {
+		dormantTableGauge.WithLabelValues(t.p.changefeedID, t.p.captureInfo.AdvertiseAddr).Dec()
+	}
+}
+
+// SafeStop implements tableSorter
+func (t *tablePipeline) SafeStop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sorter != nil {
+		t.sorter.SafeStop()
+		return
+	}
+	if t.status == model.SorterStatusWorking {
+		t.status = model.SorterStatusStopping
+	}
+}
+
+// GetStatus implements tableSorter
+func (t *tablePipeline) GetStatus() model.SorterStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sorter != nil {
+		return t.sorter.GetStatus()
+	}
+	return t.status
+}
+
+// GetMaxResolvedTs implements tableSorter
+func (t *tablePipeline) GetMaxResolvedTs() model.Ts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sorter != nil {
+		return t.sorter.GetMaxResolvedTs()
+	}
+	return t.maxSentResolvedTs
+}
+
+// addEntry adds the event pulled to the table, it's called by the puller
+// consumer only, which is the only one attaching and detaching the sorter.
+func (t *tablePipeline) addEntry(ctx context.Context, pEvent *model.PolymorphicEvent) {
+	isResolved := pEvent.RawKV.OpType == model.OpTypeResolved
+	if t.sorter == nil {
+		if isResolved {
+			t.resolveDormant(pEvent.CRTs)
+			return
+		}
+		// the event is kept until the new sorter is attached, so that it's
+		// sorted before the events pulled after it
+		if !t.wakeUp(ctx) {
+			return
+		}
+	}
+	if !isResolved {
+		t.lastDataTime = time.Now()
+	}
+	t.sorter.AddEntry(ctx, pEvent)
+	if isResolved && t.idle > 0 && time.Since(t.lastDataTime) >= t.idle {
+		t.sleep(ctx, pEvent.CRTs)
+	}
+}
+
+// sleep detaches the sorter after the resolved event added is consumed, and
+// all the events before it are sent to the mounter and the output channel.
+func (t *tablePipeline) sleep(ctx context.Context, resolvedTs model.Ts) {
+	for atomic.LoadUint64(&t.lastResolvedTs) < resolvedTs {
+		status := t.sorter.GetStatus()
+		if status == model.SorterStatusStopped || status == model.SorterStatusFinished {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.resolvedCh:
+		case <-time.After(dormantCheckInterval):
+		}
+	}
+
+	t.mu.Lock()
+	status := t.sorter.GetStatus()
+	if status == model.SorterStatusStopped || status == model.SorterStatusFinished {
+		t.mu.Unlock()
+		return
+	}
+	t.status = status
+	t.maxSentResolvedTs = t.sorter.GetMaxResolvedTs()
+	t.sorter = nil
+	cancel, done := t.cancelSorter, t.sorterDone
+	t.mu.Unlock()
+	cancel()
+	<-done
+
+	dormantTableGauge.WithLabelValues(t.p.changefeedID, t.p.captureInfo.AdvertiseAddr).Inc()
+	log.Debug("the table is dormant", append(util.ZapFieldsFromCtx(ctx),
+		zap.Uint64("resolvedTs", resolvedTs), zap.Duration("idle", time.Since(t.lastDataTime)))...)
+}
+
+// wakeUp attaches a new sorter to the dormant table, it returns false if the
+// table is stopped already.
+func (t *tablePipeline) wakeUp(ctx context.Context) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status == model.SorterStatusStopped || t.status == model.SorterStatusFinished {
+		return false
+	}
+	sorter := puller.NewRectifier(t.newSorter(), t.targetTs)
+	if t.status == model.SorterStatusStopping {
+		sorter.SafeStop()
+	}
+	t.start(ctx, sorter)
+	dormantTableGauge.WithLabelValues(t.p.changefeedID, t.p.captureInfo.AdvertiseAddr).Dec()
+	log.Debug("the table is woken up", util.ZapFieldsFromCtx(ctx)...)
+	return true
+}
+
+// resolveDormant advances the resolved ts of the dormant table, and stops the
+// table like the Rectifier does.
+func (t *tablePipeline) resolveDormant(resolvedTs model.Ts) {
+	t.mu.Lock()
+	if t.status == model.SorterStatusStopped || t.status == model.SorterStatusFinished {
+		t.mu.Unlock()
+		return
+	}
+	finished := resolvedTs > t.targetTs
+	if finished {
+		resolvedTs = t.targetTs
+	}
+	t.mu.Unlock()
+
+	t.resolve(resolvedTs)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxSentResolvedTs = resolvedTs
+	switch {
+	case finished:
+		t.status = model.SorterStatusFinished
+	case t.status == model.SorterStatusStopping:
+		t.status = model.SorterStatusStopped
+	}
+}
+
+// resolve advances the resolved ts of the table to the resolved event sorted
+func (t *tablePipeline) resolve(crts model.Ts) {
+	t.largeTxn.resolve(crts)
+	resolvedTs := t.forced.resolve(crts)
+	atomic.StoreUint64(t.pResolvedTs, resolvedTs)
+	atomic.StoreUint64(&t.lastResolvedTs, resolvedTs)
+	select {
+	case t.resolvedCh <- struct{}{}:
+	default:
+	}
+	t.lane.resolve(resolvedTs)
+	t.p.localResolvedNotifier.Notify()
+	t.resolvedTsGauge.Set(float64(oracle.ExtractPhysical(crts)))
+}
+
+// consume receives the sorted events from the sorter and sends them to the
+// mounter and the output channel of the processor
+func (t *tablePipeline) consume(ctx context.Context, sorter *puller.Rectifier) {
+	p := t.p
+	// the rows are sampled here once, the sink measures the latency of the
+	// sampled rows when they are flushed.
+	var sampleRate float64
+	var sampler *rand.Rand
+	if cfg := p.changefeed.Config.Latency; cfg != nil && cfg.SampleRate > 0 {
+		sampleRate = cfg.SampleRate
+		sampler = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	metricMounterBlockDuration := mounterInputBlockDurationCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Cause(ctx.Err()) != context.Canceled {
+				p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, ctx.Err()))
+			}
+			return
+		case pEvent := <-sorter.Output():
+			if pEvent == nil {
+				continue
+			}
+			// the events re-delivered by the puller are dropped before they
+			// are mounted, otherwise they may reach the sink twice.
+			if t.deduplicator.isDuplicate(pEvent) {
+				t.duplicateEventCounter.Inc()
+				log.Debug("drop the duplicate event",
+					append(util.ZapFieldsFromCtx(ctx), p.eventLogFormatter.Event("row", pEvent))...)
+				continue
+			}
+			// the events below the forced resolved ts are behind the resolved
+			// ts already, they're dropped instead of replicated.
+			if pEvent.RawKV != nil && pEvent.RawKV.OpType != model.OpTypeResolved && t.forced.shouldDrop(pEvent) {
+				t.forceDroppedEventCounter.Inc()
+				log.Warn("drop the event below the forced resolved ts",
+					append(util.ZapFieldsFromCtx(ctx), zap.Uint64("forcedTs", t.forced.load()),
+						p.eventLogFormatter.Event("row", pEvent))...)
+				continue
+			}
+
+			// the resolved events are never delayed by the budget, so that
+			// the resolved ts of the table is still reported in time.
+			if pEvent.RawKV != nil && pEvent.RawKV.OpType != model.OpTypeResolved {
+				if err := p.budget.waitEvent(ctx); err != nil {
+					if errors.Cause(err) != context.Canceled {
+						p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, err))
+					}
+					return
+				}
+			}
+			pEvent.SetUpFinishedChan()
+			if sampler != nil && pEvent.RawKV != nil && pEvent.RawKV.OpType != model.OpTypeResolved {
+				pEvent.Sampled = sampler.Float64() < sampleRate
+			}
+			pEvent.MarkTable = t.markTable
+			// the mounter input is small, the sorter is blocked once the
+			// mounter falls behind
+			startTime := time.Now()
+			if err := p.mounter.AddEntry(ctx, pEvent); err != nil {
+				if errors.Cause(err) != context.Canceled {
+					p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, err))
+				}
+				return
+			}
+			metricMounterBlockDuration.Add(time.Since(startTime).Seconds())
+
+			if pEvent.RawKV != nil && pEvent.RawKV.OpType == model.OpTypeResolved {
+				t.resolve(pEvent.CRTs)
+				continue
+			}
+			lastResolvedTs := atomic.LoadUint64(&t.lastResolvedTs)
+			sinkResolvedTs := atomic.LoadUint64(&p.sinkEmittedResolvedTs)
+			if pEvent.CRTs <= lastResolvedTs || pEvent.CRTs < t.replicaInfo.StartTs {
+				log.Panic("The CRTs of event is not expected, please report a bug",
+					append(util.ZapFieldsFromCtx(ctx),
+						zap.String("model", "sorter"),
+						zap.Uint64("globalResolvedTs", sinkResolvedTs),
+						zap.Uint64("resolvedTs", lastResolvedTs),
+						zap.Any("replicaInfo", t.replicaInfo),
+						p.eventLogFormatter.Event("row", pEvent))...)
+			}
+			t.largeTxn.observe(pEvent.CRTs)
+			// the event must be counted before it's sent, otherwise it may
+			// be emitted to the sink before counted.
+			if t.pPendingEvents != nil {
+				atomic.AddInt64(t.pPendingEvents, 1)
+			}
+			t.lane.send()
+			select {
+			case <-ctx.Done():
+				if t.pPendingEvents != nil {
+					atomic.AddInt64(t.pPendingEvents, -1)
+				}
+				t.lane.unsend()
+				if errors.Cause(ctx.Err()) != context.Canceled {
+					p.errs.collect(errOriginSorter, util.AnnotateTableErrFromCtx(ctx, ctx.Err()))
+				}
+				return
+			case p.output <- outputRow{event: pEvent, gen: t.lane.gen}:
+			}
+		}
+	}
+}
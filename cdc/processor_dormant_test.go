@@ -0,0 +1,189 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type processorDormantSuite struct{}
+
+var _ = check.Suite(&processorDormantSuite{})
+
+const dormantTestIdle = 50 * time.Millisecond
+
+func newDormantTestPipeline(targetTs model.Ts) (*processor, *tablePipeline) {
+	p := newProcessorForTest()
+	pipeline := p.newTablePipeline(1, "`test`.`t`", new(uint64), new(int64), nil, nil,
+		&model.TableReplicaInfo{StartTs: 1})
+	pipeline.enableDormant(dormantTestIdle, targetTs, func() puller.EventSorter {
+		return &passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}
+	})
+	return p, pipeline
+}
+
+// makeDormant adds a resolved event after the table is idle, and waits for
+// the sorter to be detached
+func makeDormant(ctx context.Context, c *check.C, pipeline *tablePipeline, resolvedTs model.Ts) {
+	time.Sleep(dormantTestIdle)
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, resolvedTs))
+	c.Assert(pipeline.isDormant(), check.IsTrue)
+	c.Assert(atomic.LoadUint64(pipeline.pResolvedTs), check.Equals, resolvedTs)
+}
+
+func (s *processorDormantSuite) TestSleepAndWakeUp(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, pipeline := newDormantTestPipeline(100)
+	pipeline.start(ctx, puller.NewRectifier(pipeline.newSorter(), 100))
+	dormantTables := dormantTableGauge.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr)
+	dormantTables.Set(0)
+
+	// the table with writes stays active
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 5))
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 6))
+	c.Assert(pipeline.isDormant(), check.IsFalse)
+	c.Assert((<-p.output).event.CRTs, check.Equals, uint64(5))
+
+	// the sorter is detached after the table is idle, and its consumer exits
+	makeDormant(ctx, c, pipeline, 10)
+	<-pipeline.sorterDone
+	c.Assert(testutil.ToFloat64(dormantTables), check.Equals, float64(1))
+
+	// the resolved events advance the resolved ts of the dormant table directly
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 20))
+	c.Assert(pipeline.isDormant(), check.IsTrue)
+	c.Assert(atomic.LoadUint64(pipeline.pResolvedTs), check.Equals, uint64(20))
+	c.Assert(pipeline.GetMaxResolvedTs(), check.Equals, uint64(20))
+	c.Assert(pipeline.GetStatus(), check.Equals, model.SorterStatusWorking)
+
+	// the row changed event wakes up the table, and it's output before the
+	// events added after it
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 25))
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 26))
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 30))
+	c.Assert(pipeline.isDormant(), check.IsFalse)
+	c.Assert(testutil.ToFloat64(dormantTables), check.Equals, float64(0))
+	c.Assert((<-p.output).event.CRTs, check.Equals, uint64(25))
+	c.Assert((<-p.output).event.CRTs, check.Equals, uint64(26))
+	for atomic.LoadUint64(pipeline.pResolvedTs) != 30 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt64(pipeline.pPendingEvents), check.Equals, int64(3))
+
+	// the dormant table is not counted after it's closed
+	makeDormant(ctx, c, pipeline, 40)
+	c.Assert(testutil.ToFloat64(dormantTables), check.Equals, float64(1))
+	pipeline.close()
+	c.Assert(testutil.ToFloat64(dormantTables), check.Equals, float64(0))
+}
+
+func (s *processorDormantSuite) TestStopDormant(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, pipeline := newDormantTestPipeline(100)
+	defer pipeline.close()
+	pipeline.start(ctx, puller.NewRectifier(pipeline.newSorter(), 100))
+	makeDormant(ctx, c, pipeline, 10)
+
+	// the dormant table is stopped at the next resolved ts like the Rectifier
+	pipeline.SafeStop()
+	c.Assert(pipeline.GetStatus(), check.Equals, model.SorterStatusStopping)
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 20))
+	c.Assert(pipeline.GetStatus(), check.Equals, model.SorterStatusStopped)
+	c.Assert(pipeline.GetMaxResolvedTs(), check.Equals, uint64(20))
+
+	// the stopped table ignores the events pulled after it
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 25))
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 30))
+	c.Assert(pipeline.isDormant(), check.IsTrue)
+	c.Assert(atomic.LoadUint64(pipeline.pResolvedTs), check.Equals, uint64(20))
+	c.Assert(p.output, check.HasLen, 0)
+}
+
+func (s *processorDormantSuite) TestStopWakingUp(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, pipeline := newDormantTestPipeline(100)
+	defer pipeline.close()
+	pipeline.start(ctx, puller.NewRectifier(pipeline.newSorter(), 100))
+	makeDormant(ctx, c, pipeline, 10)
+
+	// the table stopping while it's dormant is stopped by the new sorter
+	pipeline.SafeStop()
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 15))
+	c.Assert(pipeline.isDormant(), check.IsFalse)
+	c.Assert(pipeline.GetStatus(), check.Equals, model.SorterStatusStopping)
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 20))
+	c.Assert((<-p.output).event.CRTs, check.Equals, uint64(15))
+	for pipeline.GetStatus() != model.SorterStatusStopped {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(pipeline.GetMaxResolvedTs(), check.Equals, uint64(20))
+	cancel()
+	<-pipeline.sorterDone
+}
+
+func (s *processorDormantSuite) TestFinishDormant(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, pipeline := newDormantTestPipeline(100)
+	defer pipeline.close()
+	pipeline.start(ctx, puller.NewRectifier(pipeline.newSorter(), 100))
+	makeDormant(ctx, c, pipeline, 10)
+
+	// the resolved ts of the dormant table doesn't exceed the target ts
+	pipeline.addEntry(ctx, model.NewResolvedPolymorphicEvent(0, 120))
+	c.Assert(pipeline.GetStatus(), check.Equals, model.SorterStatusFinished)
+	c.Assert(pipeline.GetMaxResolvedTs(), check.Equals, uint64(100))
+	c.Assert(atomic.LoadUint64(pipeline.pResolvedTs), check.Equals, uint64(100))
+	pipeline.addEntry(ctx, newDrainTestEvent(1, 125))
+	c.Assert(pipeline.isDormant(), check.IsTrue)
+}
+
+func BenchmarkResolveDormantTables(b *testing.B) {
+	ctx := context.Background()
+	p := newProcessorForTest()
+	// 10k idle tables whose sorters are detached, the resolved events are
+	// tracked without going through the sorters and the mounter
+	pipelines := make([]*tablePipeline, 10000)
+	for i := range pipelines {
+		pipelines[i] = p.newTablePipeline(int64(i), "`test`.`t`", new(uint64), new(int64), nil, nil,
+			&model.TableReplicaInfo{StartTs: 1})
+		pipelines[i].enableDormant(dormantTestIdle, math.MaxUint64, func() puller.EventSorter {
+			return &passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}
+		})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event := model.NewResolvedPolymorphicEvent(0, uint64(i+2))
+		for _, pipeline := range pipelines {
+			pipeline.addEntry(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sync/atomic"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+// loadPendingEvents returns the number of the events of the table which are
+// sent to the output channel but not emitted to the sink yet
+func (t *tableInfo) loadPendingEvents() int64 {
+	if t.pendingEvents == nil {
+		return 0
+	}
+	return atomic.LoadInt64(t.pendingEvents)
+}
+
+// drainTable stops the puller input of the table, and checks whether all the
+// events of the table have been applied by the sink. The sorter of the table
+// stops at a resolved ts, the table is drained once the events already sent to
+// the output channel and the mounter are emitted to the sink, and the sink is
+// flushed to the resolved ts. The returned resolved ts is then the exact ts up
+// to which the sink has applied the data of the table, which is the boundary to
+// migrate the table to another processor. A zero resolved ts is returned if the
+// table is not drained yet, and pendingEvents is the number of the events of
+// the table not emitted to the sink.
+func (p *processor) drainTable(tableID model.TableID) (resolvedTs model.Ts, pendingEvents int, err error) {
+	p.stateMu.Lock()
+	table, ok := p.tables[tableID]
+	p.stateMu.Unlock()
+	if !ok {
+		return 0, 0, cerror.ErrProcessorTableNotFound.GenWithStack("table(%d) to drain", tableID)
+	}
+	stopped, maxResolvedTs := table.safeStop()
+	pendingEvents = int(table.loadPendingEvents())
+	if !stopped || pendingEvents > 0 || maxResolvedTs > atomic.LoadUint64(&p.checkpointTs) {
+		return 0, pendingEvents, nil
+	}
+	return maxResolvedTs, 0, nil
+}
+
+// markEventsEmitted decreases the pending events of the tables whose events
+// are emitted to the sink. The events of the tables are interleaved in the
+// output channel, so the table of each event is decoded from its key.
+func (p *processor) markEventsEmitted(events []*model.PolymorphicEvent) {
+	if len(events) == 0 {
+		return
+	}
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	for _, ev := range events {
+		if ev.RawKV == nil {
+			continue
+		}
+		// the events of the mark tables are not counted
+		table, ok := p.tables[tablecodec.DecodeTableID(ev.RawKV.Key)]
+		if !ok || table.pendingEvents == nil {
+			continue
+		}
+		atomic.AddInt64(table.pendingEvents, -1)
+	}
+}
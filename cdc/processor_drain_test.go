@@ -0,0 +1,171 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+type drainTableSuite struct{}
+
+var _ = check.Suite(&drainTableSuite{})
+
+func newDrainTestEvent(tableID model.TableID, crts uint64) *model.PolymorphicEvent {
+	return model.NewPolymorphicEvent(&model.RawKVEntry{
+		OpType:  model.OpTypePut,
+		Key:     tablecodec.GenTableRecordPrefix(tableID),
+		StartTs: crts - 1,
+		CRTs:    crts,
+	})
+}
+
+// forwardSortedEvents reads n events from the sorter and sends the row
+// changed events to the output channel like the table pipeline does
+func forwardSortedEvents(c *check.C, p *processor, table *tableInfo, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-table.sorter.(*puller.Rectifier).Output():
+			if ev.RawKV.OpType == model.OpTypeResolved {
+				continue
+			}
+			atomic.AddInt64(table.pendingEvents, 1)
+			p.output <- outputRow{event: ev}
+		case <-time.After(5 * time.Second):
+			c.Fatal("the sorted event is not received")
+		}
+	}
+}
+
+// emitEvents reads n events from the output channel and emits them to the
+// sink like syncResolved does
+func emitEvents(c *check.C, p *processor, n int) []model.TableID {
+	events := make([]*model.PolymorphicEvent, 0, n)
+	tableIDs := make([]model.TableID, 0, n)
+	for i := 0; i < n; i++ {
+		ev := (<-p.output).event
+		events = append(events, ev)
+		tableIDs = append(tableIDs, tablecodec.DecodeTableID(ev.RawKV.Key))
+	}
+	p.markEventsEmitted(events)
+	return tableIDs
+}
+
+func (s *drainTableSuite) TestDrainTableInterleaved(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	p := newProcessorForTest()
+	for _, tableID := range []model.TableID{1, 2} {
+		sorter := puller.NewRectifier(puller.NewEntrySorter(), math.MaxUint64)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sorter.Run(ctx)
+		}()
+		p.tables[tableID] = &tableInfo{
+			id:            tableID,
+			sorter:        sorter,
+			cancel:        func() {},
+			pendingEvents: new(int64),
+		}
+	}
+	table1, table2 := p.tables[1], p.tables[2]
+
+	table1.sorter.(*puller.Rectifier).AddEntry(ctx, newDrainTestEvent(1, 5))
+	table1.sorter.(*puller.Rectifier).AddEntry(ctx, newDrainTestEvent(1, 8))
+	table1.sorter.(*puller.Rectifier).AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 10))
+	table2.sorter.(*puller.Rectifier).AddEntry(ctx, newDrainTestEvent(2, 6))
+	table2.sorter.(*puller.Rectifier).AddEntry(ctx, newDrainTestEvent(2, 7))
+	table2.sorter.(*puller.Rectifier).AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 10))
+
+	// the events of the two tables are interleaved in the output channel,
+	// and the sorter of table 1 is stopped at the resolved ts 10
+	forwardSortedEvents(c, p, table1, 1)
+	forwardSortedEvents(c, p, table2, 1)
+	forwardSortedEvents(c, p, table1, 1)
+	resolvedTs, pendingEvents, err := p.drainTable(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(resolvedTs, check.Equals, uint64(0))
+	c.Assert(pendingEvents, check.Equals, 2)
+	forwardSortedEvents(c, p, table2, 1)
+	forwardSortedEvents(c, p, table1, 1)
+	for table1.sorter.GetStatus() != model.SorterStatusStopped {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(table1.sorter.GetMaxResolvedTs(), check.Equals, uint64(10))
+
+	// the events of table 1 are still in the output channel
+	c.Assert(emitEvents(c, p, 2), check.DeepEquals, []model.TableID{1, 2})
+	resolvedTs, pendingEvents, err = p.drainTable(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(resolvedTs, check.Equals, uint64(0))
+	c.Assert(pendingEvents, check.Equals, 1)
+	c.Assert(table2.loadPendingEvents(), check.Equals, int64(1))
+
+	// all the events of table 1 are emitted, but the sink is not flushed to
+	// the resolved ts yet
+	atomic.StoreUint64(&p.checkpointTs, 8)
+	c.Assert(emitEvents(c, p, 1), check.DeepEquals, []model.TableID{1})
+	resolvedTs, pendingEvents, err = p.drainTable(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(resolvedTs, check.Equals, uint64(0))
+	c.Assert(pendingEvents, check.Equals, 0)
+
+	atomic.StoreUint64(&p.checkpointTs, 12)
+	resolvedTs, pendingEvents, err = p.drainTable(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(resolvedTs, check.Equals, uint64(10))
+	c.Assert(pendingEvents, check.Equals, 0)
+
+	// the pending event of table 2 is not affected by draining table 1
+	c.Assert(table2.sorter.GetStatus(), check.Equals, model.SorterStatusWorking)
+	c.Assert(table2.loadPendingEvents(), check.Equals, int64(1))
+	c.Assert(emitEvents(c, p, 1), check.DeepEquals, []model.TableID{2})
+	c.Assert(table2.loadPendingEvents(), check.Equals, int64(0))
+
+	_, _, err = p.drainTable(3)
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrProcessorTableNotFound.*")
+}
+
+func (s *drainTableSuite) TestMarkEventsEmitted(c *check.C) {
+	defer testleak.AfterTest(c)()
+	p := newProcessorForTest()
+	p.tables[1] = &tableInfo{id: 1, pendingEvents: new(int64)}
+	// the table added without counting the events
+	p.tables[2] = &tableInfo{id: 2}
+	atomic.StoreInt64(p.tables[1].pendingEvents, 2)
+
+	p.markEventsEmitted([]*model.PolymorphicEvent{
+		newDrainTestEvent(1, 5),
+		// the events of the mark tables and the removed tables are ignored
+		newDrainTestEvent(100, 5),
+		newDrainTestEvent(2, 6),
+		model.NewResolvedPolymorphicEvent(0, 6),
+	})
+	c.Assert(p.tables[1].loadPendingEvents(), check.Equals, int64(1))
+	c.Assert(p.tables[2].loadPendingEvents(), check.Equals, int64(0))
+}
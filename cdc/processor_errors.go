@@ -0,0 +1,170 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// the origins of the errors collected by the processor
+const (
+	errOriginPuller    = "puller"
+	errOriginSorter    = "sorter"
+	errOriginMounter   = "mounter"
+	errOriginSink      = "sink"
+	errOriginEtcd      = "etcd"
+	errOriginProcessor = "processor"
+)
+
+const (
+	// maxCollectedErrors is the max number of errors kept besides the primary one
+	maxCollectedErrors = 16
+	// defaultRootCauseWait is the duration to wait for the root cause if only
+	// the errors of cancellation are collected
+	defaultRootCauseWait = time.Second
+)
+
+type collectedError struct {
+	origin string
+	time   time.Time
+	err    error
+}
+
+// String implements fmt.Stringer interface.
+func (e *collectedError) String() string {
+	return fmt.Sprintf("[%s] %s: %s", e.time.Format(time.RFC3339Nano), e.origin, e.err)
+}
+
+func isCancelError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
+// errorCollector collects the errors of the routines of a processor. Once a
+// routine fails the others are canceled and fail with the errors of
+// cancellation, so the first error which is not caused by cancellation is
+// recorded as the primary one, it's the root cause in most cases. The
+// subsequent distinct errors are kept in arrival order, up to a limit.
+// Collecting errors never blocks.
+type errorCollector struct {
+	rootCauseWait time.Duration
+
+	mu      sync.Mutex
+	primary *collectedError
+	others  []*collectedError
+	dropped int
+
+	// doneCh is closed once any error is collected, and rootCauseCh is closed
+	// once the primary error is collected.
+	doneCh      chan struct{}
+	rootCauseCh chan struct{}
+}
+
+func newErrorCollector() *errorCollector {
+	return &errorCollector{
+		rootCauseWait: defaultRootCauseWait,
+		doneCh:        make(chan struct{}),
+		rootCauseCh:   make(chan struct{}),
+	}
+}
+
+// collect records an error with the origin routine, nil errors are ignored.
+func (c *errorCollector) collect(origin string, err error) {
+	if err == nil {
+		return
+	}
+	e := &collectedError{origin: origin, time: time.Now(), err: err}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.primary == nil && len(c.others) == 0 {
+		close(c.doneCh)
+	}
+	if c.primary == nil && !isCancelError(err) {
+		c.primary = e
+		close(c.rootCauseCh)
+		return
+	}
+	msg := err.Error()
+	if c.primary != nil && c.primary.err.Error() == msg {
+		return
+	}
+	for _, other := range c.others {
+		if other.err.Error() == msg {
+			return
+		}
+	}
+	if len(c.others) >= maxCollectedErrors {
+		c.dropped++
+		return
+	}
+	c.others = append(c.others, e)
+}
+
+// wait blocks until an error is collected, and returns the primary error. If
+// only the errors of cancellation are collected, it waits for the root cause
+// for a while, and returns the first error of cancellation if the root cause
+// is not collected in time.
+func (c *errorCollector) wait() *collectedError {
+	<-c.doneCh
+	select {
+	case <-c.rootCauseCh:
+	case <-time.After(c.rootCauseWait):
+	}
+	return c.first()
+}
+
+// first returns the primary error, or the first error if the primary one is
+// not collected yet, nil is returned if no error is collected.
+func (c *errorCollector) first() *collectedError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.primary != nil {
+		return c.primary
+	}
+	if len(c.others) > 0 {
+		return c.others[0]
+	}
+	return nil
+}
+
+// all returns all errors collected, the primary one goes first, and the
+// number of the errors dropped because of the limit.
+func (c *errorCollector) all() ([]*collectedError, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := make([]*collectedError, 0, len(c.others)+1)
+	if c.primary != nil {
+		errs = append(errs, c.primary)
+	}
+	errs = append(errs, c.others...)
+	return errs, c.dropped
+}
+
+// errorStrings formats all errors collected, the primary one goes first.
+func (c *errorCollector) errorStrings() []string {
+	errs, dropped := c.all()
+	strs := make([]string, 0, len(errs)+1)
+	for _, e := range errs {
+		strs = append(strs, e.String())
+	}
+	if dropped > 0 {
+		strs = append(strs, fmt.Sprintf("%d more errors are dropped", dropped))
+	}
+	return strs
+}
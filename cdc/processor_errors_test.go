@@ -0,0 +1,122 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type errorCollectorSuite struct{}
+
+var _ = check.Suite(&errorCollectorSuite{})
+
+func (s *errorCollectorSuite) TestPrimaryIsRootCause(c *check.C) {
+	defer testleak.AfterTest(c)()
+	collector := newErrorCollector()
+	rootCause := cerror.ErrPDEtcdAPIError.GenWithStackByArgs("etcd is unavailable")
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	// the errors of cancellation are fired by the other routines nearly at
+	// the same time, some of them before the root cause
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			switch i % 3 {
+			case 0:
+				collector.collect(errOriginSorter, context.Canceled)
+			case 1:
+				collector.collect(errOriginPuller, errors.Trace(context.DeadlineExceeded))
+			default:
+				collector.collect(errOriginMounter, nil)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-start
+		collector.collect(errOriginEtcd, rootCause)
+	}()
+	close(start)
+	wg.Wait()
+	// the secondary errors after the root cause
+	collector.collect(errOriginSink, errors.New("sink is closed"))
+	collector.collect(errOriginSink, errors.New("sink is closed"))
+	collector.collect(errOriginProcessor, rootCause)
+
+	primary := collector.wait()
+	c.Assert(primary.err, check.Equals, rootCause)
+	c.Assert(primary.origin, check.Equals, errOriginEtcd)
+	c.Assert(primary.time.IsZero(), check.IsFalse)
+
+	errs, dropped := collector.all()
+	c.Assert(dropped, check.Equals, 0)
+	// the primary one, the distinct errors of cancellation and the sink error
+	c.Assert(errs, check.HasLen, 4)
+	c.Assert(errs[0], check.Equals, primary)
+	c.Assert(errs[3].origin, check.Equals, errOriginSink)
+	strs := collector.errorStrings()
+	c.Assert(strs, check.HasLen, 4)
+	c.Assert(strs[0], check.Matches, `\[.*\] etcd: .*etcd is unavailable.*`)
+}
+
+func (s *errorCollectorSuite) TestWaitForRootCause(c *check.C) {
+	defer testleak.AfterTest(c)()
+	collector := newErrorCollector()
+	collector.rootCauseWait = 10 * time.Second
+	rootCause := errors.New("region is unavailable")
+
+	collector.collect(errOriginSorter, context.Canceled)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		collector.collect(errOriginPuller, rootCause)
+	}()
+	primary := collector.wait()
+	c.Assert(primary.err, check.Equals, rootCause)
+	c.Assert(primary.origin, check.Equals, errOriginPuller)
+
+	// the first error of cancellation is returned without any root cause
+	collector = newErrorCollector()
+	collector.rootCauseWait = 10 * time.Millisecond
+	collector.collect(errOriginSorter, context.Canceled)
+	collector.collect(errOriginPuller, errors.Trace(context.Canceled))
+	primary = collector.wait()
+	c.Assert(primary.err, check.Equals, context.Canceled)
+	c.Assert(primary.origin, check.Equals, errOriginSorter)
+}
+
+func (s *errorCollectorSuite) TestCollectedErrorsAreBounded(c *check.C) {
+	defer testleak.AfterTest(c)()
+	collector := newErrorCollector()
+	for i := 0; i < maxCollectedErrors+10; i++ {
+		collector.collect(errOriginSink, fmt.Errorf("error %d", i))
+	}
+	errs, dropped := collector.all()
+	c.Assert(errs, check.HasLen, maxCollectedErrors+1)
+	c.Assert(dropped, check.Equals, 9)
+	c.Assert(errs[0].err, check.ErrorMatches, "error 0")
+	strs := collector.errorStrings()
+	c.Assert(strs[len(strs)-1], check.Equals, "9 more errors are dropped")
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
+)
+
+// forcedResolvedTs is the resolved ts of a table forced by the unsafe command
+// advance-table-resolved-ts. The events of the table at or below it are dropped
+// and counted instead of replicated, since they're already behind the resolved
+// ts. It's shared by the table and its sorter consumer, and accessed atomically.
+// All methods are no-op on a nil forcedResolvedTs, which is used by the mark
+// tables.
+type forcedResolvedTs struct {
+	ts      uint64
+	dropped uint64
+}
+
+// load returns the forced resolved ts, it's zero if the table is not forced
+func (f *forcedResolvedTs) load() uint64 {
+	if f == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&f.ts)
+}
+
+// advance raises the forced resolved ts to ts, it never moves backwards
+func (f *forcedResolvedTs) advance(ts uint64) {
+	for {
+		old := atomic.LoadUint64(&f.ts)
+		if old >= ts || atomic.CompareAndSwapUint64(&f.ts, old, ts) {
+			return
+		}
+	}
+}
+
+// resolve returns the resolved ts of the table bounded by the forced one
+func (f *forcedResolvedTs) resolve(resolvedTs uint64) uint64 {
+	if forcedTs := f.load(); resolvedTs < forcedTs {
+		return forcedTs
+	}
+	return resolvedTs
+}
+
+// shouldDrop returns true if the event is at or below the forced resolved ts,
+// the dropped event is counted.
+func (f *forcedResolvedTs) shouldDrop(ev *model.PolymorphicEvent) bool {
+	if f == nil || ev.CRTs > f.load() {
+		return false
+	}
+	atomic.AddUint64(&f.dropped, 1)
+	return true
+}
+
+// droppedEvents returns the number of the dropped events
+func (f *forcedResolvedTs) droppedEvents() uint64 {
+	if f == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// handleForceAdvance applies the operations forcing the resolved ts of the
+// tables to advance. The resolved ts of the table is raised to the target ts,
+// and the events at or below it received later are dropped, so the data of the
+// table between the original resolved ts and the target ts may be lost.
+func (p *processor) handleForceAdvance(ctx context.Context, status *model.TaskStatus) {
+	for tableID, op := range status.ForceAdvance {
+		if op.Status != model.OperDispatched {
+			continue
+		}
+		p.stateMu.Lock()
+		table, ok := p.tables[tableID]
+		p.stateMu.Unlock()
+		if !ok {
+			err := cerror.ErrProcessorTableNotFound.GenWithStack("table(%d) to force advance", tableID)
+			log.Warn("table whose resolved ts is forced to advance is not found",
+				util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID))
+			op.Error = &model.RunningError{
+				Addr:    p.captureInfo.AdvertiseAddr,
+				Code:    string(cerror.ErrProcessorTableNotFound.RFCCode()),
+				Message: err.Error(),
+				Origin:  errOriginProcessor,
+			}
+			op.Status = model.OperFinished
+			status.Dirty = true
+			continue
+		}
+		resolvedTs := atomic.LoadUint64(&table.resolvedTs)
+		log.Warn("!!! FORCE ADVANCE THE RESOLVED TS OF THE TABLE, THE EVENTS AT OR BELOW THE TARGET TS ARE DROPPED !!!",
+			util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID), zap.String("table", table.name),
+			zap.Uint64("resolvedTs", resolvedTs), zap.Uint64("targetTs", op.TargetTs))
+		table.forced.advance(op.TargetTs)
+		for resolvedTs < op.TargetTs && !atomic.CompareAndSwapUint64(&table.resolvedTs, resolvedTs, op.TargetTs) {
+			resolvedTs = atomic.LoadUint64(&table.resolvedTs)
+		}
+		op.Status = model.OperFinished
+		status.Dirty = true
+		p.localResolvedNotifier.Notify()
+	}
+}
+
+// dropForcedEvent drops the event in the output channel if its table is forced
+// to advance beyond it, the event may be sent to the output channel before the
+// table is forced. It returns false if the event is not dropped.
+func (p *processor) dropForcedEvent(ctx context.Context, ev *model.PolymorphicEvent) bool {
+	if ev.RawKV == nil {
+		return false
+	}
+	p.stateMu.Lock()
+	table, ok := p.tables[tablecodec.DecodeTableID(ev.RawKV.Key)]
+	p.stateMu.Unlock()
+	if !ok || !table.forced.shouldDrop(ev) {
+		return false
+	}
+	tableForceDroppedEventCounter.WithLabelValues(p.changefeedID, p.captureInfo.AdvertiseAddr, table.name).Inc()
+	log.Warn("drop the event below the forced resolved ts",
+		append(util.ZapFieldsFromCtx(ctx), zap.String("table", table.name), p.eventLogFormatter.Event("row", ev))...)
+	p.markEventsEmitted([]*model.PolymorphicEvent{ev})
+	return true
+}
+
+// droppedEvents returns the number of the events dropped by each table whose
+// resolved ts is forced to advance, the caller must hold stateMu.
+func (p *processor) droppedEvents() map[model.TableID]uint64 {
+	var dropped map[model.TableID]uint64
+	for tableID, table := range p.tables {
+		if n := table.forced.droppedEvents(); n > 0 {
+			if dropped == nil {
+				dropped = make(map[model.TableID]uint64)
+			}
+			dropped[tableID] = n
+		}
+	}
+	return dropped
+}
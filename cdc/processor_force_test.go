@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorForceSuite struct{}
+
+var _ = check.Suite(&processorForceSuite{})
+
+func (s *processorForceSuite) TestForceAdvance(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const tableName = "`test`.`t`"
+	table := &tableInfo{
+		id:            1,
+		name:          tableName,
+		resolvedTs:    100,
+		pendingEvents: new(int64),
+		forced:        new(forcedResolvedTs),
+	}
+	p := newProcessorForTest()
+	p.tables[table.id] = table
+
+	// the operation of the table not in the processor fails
+	status := &model.TaskStatus{}
+	status.ForceAdvanceTable(1, 200)
+	status.ForceAdvanceTable(2, 300)
+	p.handleForceAdvance(ctx, status)
+	c.Assert(status.Dirty, check.IsTrue)
+	c.Assert(status.ForceAdvance[1], check.DeepEquals, &model.TableForceAdvance{TargetTs: 200, Status: model.OperFinished})
+	c.Assert(status.ForceAdvance[2].Status, check.Equals, model.OperFinished)
+	c.Assert(status.ForceAdvance[2].Error.Code, check.Equals, "CDC:ErrProcessorTableNotFound")
+	c.Assert(atomic.LoadUint64(&table.resolvedTs), check.Equals, uint64(200))
+
+	// the forced resolved ts never moves backwards
+	status = &model.TaskStatus{}
+	status.ForceAdvanceTable(1, 150)
+	p.handleForceAdvance(ctx, status)
+	c.Assert(status.ForceAdvance[1].Status, check.Equals, model.OperFinished)
+	c.Assert(table.forced.load(), check.Equals, uint64(200))
+	c.Assert(atomic.LoadUint64(&table.resolvedTs), check.Equals, uint64(200))
+
+	// the finished operations are not applied again
+	status.Dirty = false
+	p.handleForceAdvance(ctx, status)
+	c.Assert(status.Dirty, check.IsFalse)
+
+	sorter := puller.NewRectifier(&passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}, math.MaxUint64)
+	sorterDone := make(chan struct{})
+	go func() {
+		defer close(sorterDone)
+		_ = sorter.Run(ctx)
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.newTablePipeline(1, tableName, &table.resolvedTs, table.pendingEvents, nil, table.forced,
+			&model.TableReplicaInfo{StartTs: 100}).consume(ctx, sorter)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		<-sorterDone
+	}()
+
+	// the events at or below the forced resolved ts are dropped instead of
+	// panicking, and the resolved ts of the table doesn't move backwards
+	sorter.AddEntry(ctx, newDrainTestEvent(1, 150))
+	sorter.AddEntry(ctx, newDrainTestEvent(1, 200))
+	sorter.AddEntry(ctx, newDrainTestEvent(1, 250))
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 180))
+	sorter.AddEntry(ctx, newDrainTestEvent(1, 260))
+	for _, crts := range []uint64{250, 260} {
+		ev := (<-p.output).event
+		c.Assert(ev.CRTs, check.Equals, crts)
+	}
+	c.Assert(atomic.LoadUint64(&table.resolvedTs), check.Equals, uint64(200))
+	c.Assert(table.forced.droppedEvents(), check.Equals, uint64(2))
+	c.Assert(atomic.LoadInt64(table.pendingEvents), check.Equals, int64(2))
+
+	// the event sent to the output channel before the table is forced is
+	// dropped by the sink driver
+	atomic.AddInt64(table.pendingEvents, 1)
+	c.Assert(p.dropForcedEvent(ctx, newDrainTestEvent(1, 190)), check.IsTrue)
+	c.Assert(p.dropForcedEvent(ctx, newDrainTestEvent(1, 300)), check.IsFalse)
+	c.Assert(p.dropForcedEvent(ctx, newDrainTestEvent(2, 190)), check.IsFalse)
+	c.Assert(atomic.LoadInt64(table.pendingEvents), check.Equals, int64(2))
+	p.stateMu.Lock()
+	c.Assert(p.droppedEvents(), check.DeepEquals, map[model.TableID]uint64{1: 3})
+	p.stateMu.Unlock()
+}
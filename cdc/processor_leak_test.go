@@ -0,0 +1,100 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/leaktest"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorLeakSuite struct{}
+
+var _ = check.Suite(&processorLeakSuite{})
+
+// leakedSorter ignores the cancellation of the context until it's released
+type leakedSorter struct {
+	passThroughSorter
+	release chan struct{}
+}
+
+func (s *leakedSorter) Run(ctx context.Context) error {
+	<-s.release
+	return context.Canceled
+}
+
+// errorRecorder records the leaks reported by leaktest.Check
+type errorRecorder struct {
+	errs []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (s *processorLeakSuite) TestTableGoroutinesDeregistered(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	p, pipeline := newDormantTestPipeline(100)
+	defer pipeline.close()
+	leaktest.AddOwner(p.changefeedID, 0)
+	leaktest.AddOwner(p.changefeedID, pipeline.tableID)
+	pipeline.start(ctx, puller.NewRectifier(pipeline.newSorter(), 100))
+
+	// the sorter and its consumer are registered
+	summary := leaktest.Summarize()
+	c.Assert(summary.Components[errOriginSorter], check.Equals, 2)
+	c.Assert(summary.Orphans, check.HasLen, 0)
+
+	cancel()
+	<-pipeline.sorterDone
+	leaktest.RemoveOwner(p.changefeedID, 0)
+	leaktest.Check(c)
+}
+
+func (s *processorLeakSuite) TestLeakedSorterDetected(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	p, pipeline := newDormantTestPipeline(100)
+	defer pipeline.close()
+	leaktest.AddOwner(p.changefeedID, 0)
+	leaktest.AddOwner(p.changefeedID, pipeline.tableID)
+	sorter := &leakedSorter{
+		passThroughSorter: passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)},
+		release:           make(chan struct{}),
+	}
+	pipeline.start(ctx, puller.NewRectifier(sorter, 100))
+
+	// the sorter outlives the removed table, while its consumer exits
+	cancel()
+	leaktest.RemoveOwner(p.changefeedID, pipeline.tableID)
+	recorder := new(errorRecorder)
+	leaktest.Check(recorder)
+	c.Assert(recorder.errs, check.HasLen, 1)
+	c.Assert(recorder.errs[0], check.Matches, "the sorter goroutine of changefeed test-changefeed table 1 .* appears to have leaked")
+	summary := leaktest.Summarize()
+	c.Assert(summary.Orphans, check.HasLen, 1)
+	c.Assert(summary.Orphans[0].Component, check.Equals, errOriginSorter)
+	c.Assert(summary.Orphans[0].Owner, check.Equals, leaktest.Owner{ChangefeedID: p.changefeedID, TableID: pipeline.tableID})
+
+	close(sorter.release)
+	<-pipeline.sorterDone
+	leaktest.RemoveOwner(p.changefeedID, 0)
+	leaktest.Check(c)
+}
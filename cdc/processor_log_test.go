@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.uber.org/zap/zapcore"
+)
+
+type processorLogSuite struct{}
+
+var _ = check.Suite(&processorLogSuite{})
+
+func (s *processorLogSuite) TestTableFieldsInLogs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.DebugLevel)
+	defer restore()
+
+	const tableName = "`test`.`orders`"
+	p := newProcessorForTest()
+	ctx := util.PutCaptureAddrInCtx(context.Background(), p.captureInfo.AdvertiseAddr)
+	ctx = util.PutChangefeedIDInCtx(ctx, p.changefeedID)
+	ctx = util.PutTableInfoInCtx(ctx, 1, tableName)
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	sorter := puller.NewRectifier(&passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}, math.MaxUint64)
+	sorterDone := make(chan struct{})
+	go func() {
+		defer close(sorterDone)
+		_ = sorter.Run(ctx)
+	}()
+	defer func() { <-sorterDone }()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.newTablePipeline(1, tableName, new(uint64), new(int64), nil, nil, &model.TableReplicaInfo{StartTs: 1}).consume(ctx, sorter)
+	}()
+	// the re-delivered event is dropped with a debug log
+	event := newDrainTestEvent(1, 5)
+	sorter.AddEntry(ctx, event)
+	raw := *event.RawKV
+	sorter.AddEntry(ctx, model.NewPolymorphicEvent(&raw))
+	waitOutput(c, p, 1)
+	// the error of the table is annotated with the table once the context expires
+	<-done
+
+	entries := logs.FilterMessage("drop the duplicate event").All()
+	c.Assert(entries, check.HasLen, 1)
+	fields := entries[0].ContextMap()
+	c.Assert(fields["changefeed"], check.Equals, p.changefeedID)
+	c.Assert(fields["capture"], check.Equals, p.captureInfo.AdvertiseAddr)
+	c.Assert(fields["table-id"], check.Equals, int64(1))
+	c.Assert(fields["table-name"], check.Equals, tableName)
+
+	primary := p.errs.first()
+	c.Assert(primary, check.NotNil)
+	c.Assert(primary.err, check.ErrorMatches, "table 1 `test`.`orders`: context deadline exceeded")
+	c.Assert(errors.Cause(primary.err), check.Equals, context.DeadlineExceeded)
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"go.uber.org/zap"
+)
+
+// markTable is the mark table of the cyclic replication, it's shared by all
+// the data tables with the same mark table, and its puller is stopped only
+// when none of the data tables references it.
+type markTable struct {
+	id      model.TableID
+	startTs model.Ts
+	// resolvedTs is accessed atomically
+	resolvedTs uint64
+	refs       map[model.TableID]struct{}
+	cancel     context.CancelFunc
+}
+
+// markTableManager manages the lifecycle of the mark tables of a processor,
+// it's protected by the stateMu of the processor.
+type markTableManager struct {
+	tables map[model.TableID]*markTable
+}
+
+func newMarkTableManager() *markTableManager {
+	return &markTableManager{tables: make(map[model.TableID]*markTable)}
+}
+
+// acquire adds the data table as a reference of the mark table and returns the
+// mark table. If the mark table is not running, start is called to start its
+// puller from startTs, and the returned cancel func is called to stop it.
+func (m *markTableManager) acquire(
+	markTableID, tableID model.TableID, startTs model.Ts,
+	start func(mt *markTable) context.CancelFunc,
+) *markTable {
+	mt, ok := m.tables[markTableID]
+	if !ok {
+		mt = &markTable{
+			id:         markTableID,
+			startTs:    startTs,
+			resolvedTs: startTs,
+			refs:       make(map[model.TableID]struct{}),
+		}
+		mt.cancel = start(mt)
+		m.tables[markTableID] = mt
+	} else if startTs < mt.startTs {
+		log.Warn("the mark table is started after the data table, the marks before are not seen",
+			zap.Int64("markTableID", markTableID), zap.Int64("tableID", tableID),
+			zap.Uint64("markTableStartTs", mt.startTs), zap.Uint64("startTs", startTs))
+	}
+	mt.refs[tableID] = struct{}{}
+	return mt
+}
+
+// release removes the data table from the references of the mark table, the
+// mark table is stopped if no data table references it. It returns true if the
+// mark table is stopped.
+func (m *markTableManager) release(markTableID, tableID model.TableID) bool {
+	mt, ok := m.tables[markTableID]
+	if !ok {
+		return false
+	}
+	delete(mt.refs, tableID)
+	if len(mt.refs) != 0 {
+		return false
+	}
+	mt.cancel()
+	delete(m.tables, markTableID)
+	return true
+}
+
+// releaseAll stops all the mark tables regardless of their references, it's
+// called when the processor is stopped.
+func (m *markTableManager) releaseAll() {
+	for id, mt := range m.tables {
+		mt.cancel()
+		delete(m.tables, id)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type markTableSuite struct{}
+
+var _ = check.Suite(&markTableSuite{})
+
+// mockMarkTableStarter counts the started and stopped mark table pullers
+type mockMarkTableStarter struct {
+	started map[int64]int
+	stopped map[int64]int
+}
+
+func newMockMarkTableStarter() *mockMarkTableStarter {
+	return &mockMarkTableStarter{started: make(map[int64]int), stopped: make(map[int64]int)}
+}
+
+func (m *mockMarkTableStarter) start(mt *markTable) context.CancelFunc {
+	m.started[mt.id]++
+	return func() { m.stopped[mt.id]++ }
+}
+
+func (s *markTableSuite) TestShareMarkTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	starter := newMockMarkTableStarter()
+	m := newMarkTableManager()
+
+	// two data tables share the mark table 100
+	mt1 := m.acquire(100, 1, 10, starter.start)
+	mt2 := m.acquire(100, 2, 20, starter.start)
+	c.Assert(mt1, check.Equals, mt2)
+	c.Assert(starter.started[100], check.Equals, 1)
+	c.Assert(atomic.LoadUint64(&mt1.resolvedTs), check.Equals, uint64(10))
+
+	// the resolved ts of both data tables are limited by the mark table
+	atomic.StoreUint64(&mt1.resolvedTs, 15)
+	t1 := &tableInfo{id: 1, resolvedTs: 30, markTable: mt1}
+	t2 := &tableInfo{id: 2, resolvedTs: 12, markTable: mt2}
+	c.Assert(t1.loadResolvedTs(), check.Equals, uint64(15))
+	c.Assert(t2.loadResolvedTs(), check.Equals, uint64(12))
+
+	// the mark table is stopped when the last data table is removed
+	c.Assert(m.release(100, 1), check.IsFalse)
+	c.Assert(starter.stopped[100], check.Equals, 0)
+	c.Assert(m.release(100, 2), check.IsTrue)
+	c.Assert(starter.stopped[100], check.Equals, 1)
+	c.Assert(m.tables, check.HasLen, 0)
+	// releasing again is a no-op
+	c.Assert(m.release(100, 2), check.IsFalse)
+	c.Assert(starter.stopped[100], check.Equals, 1)
+
+	// all mark tables are stopped when the processor is stopped
+	m.acquire(100, 1, 10, starter.start)
+	m.acquire(101, 2, 10, starter.start)
+	m.releaseAll()
+	c.Assert(starter.stopped[100], check.Equals, 2)
+	c.Assert(starter.stopped[101], check.Equals, 1)
+	c.Assert(m.tables, check.HasLen, 0)
+}
+
+func (s *markTableSuite) TestRemoveThenReAddCyclicTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	starter := newMockMarkTableStarter()
+	p := newProcessorForTest()
+	addTable := func(tableID, markTableID int64, startTs uint64) *tableInfo {
+		table := &tableInfo{
+			id:         tableID,
+			resolvedTs: startTs,
+			cancel:     func() {},
+			markTable:  p.markTables.acquire(markTableID, tableID, startTs, starter.start),
+		}
+		p.tables[tableID] = table
+		return table
+	}
+	removeTable := func(tableID int64) {
+		atomic.StoreUint32(&p.tables[tableID].isDying, 1)
+		p.removeTable(tableID)
+	}
+
+	old := addTable(1, 100, 10)
+	atomic.StoreUint64(&old.markTable.resolvedTs, 50)
+	removeTable(1)
+	c.Assert(starter.started[100], check.Equals, 1)
+	c.Assert(starter.stopped[100], check.Equals, 1)
+	c.Assert(p.tables, check.HasLen, 0)
+
+	// the re-added table gets a new mark table, which starts from the start
+	// ts of the table instead of the stale resolved ts
+	table := addTable(1, 100, 20)
+	c.Assert(starter.started[100], check.Equals, 2)
+	c.Assert(table.markTable, check.Not(check.Equals), old.markTable)
+	c.Assert(table.loadResolvedTs(), check.Equals, uint64(20))
+
+	// removing one of the tables sharing the mark table keeps it running
+	addTable(2, 100, 20)
+	removeTable(1)
+	c.Assert(starter.stopped[100], check.Equals, 1)
+	c.Assert(p.markTables.tables[100].refs, check.HasLen, 1)
+	removeTable(2)
+	c.Assert(starter.stopped[100], check.Equals, 2)
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// addPendingOpTable registers a table waiting for its operation to be done,
+// pResolvedTs is the resolved ts received by the table, which is loaded
+// atomically. The operation is done once the table catches up with the
+// local and global resolved ts.
+func (p *processor) addPendingOpTable(tableID int64, pResolvedTs *uint64) {
+	p.pendingOpMu.Lock()
+	defer p.pendingOpMu.Unlock()
+	p.pendingOpTables[tableID] = pResolvedTs
+}
+
+// removePendingOpTable unregisters the table, it's no-op if the operation of
+// the table is already done, or the table is registered again by a new
+// sorterConsume after it's re-added.
+func (p *processor) removePendingOpTable(tableID int64, pResolvedTs *uint64) {
+	p.pendingOpMu.Lock()
+	defer p.pendingOpMu.Unlock()
+	if p.pendingOpTables[tableID] == pResolvedTs {
+		delete(p.pendingOpTables, tableID)
+	}
+}
+
+// opDoneWorker checks all pending tables in one pass when the local or global
+// resolved ts may advance, so that idle tables don't need to poll themselves.
+func (p *processor) opDoneWorker(ctx context.Context) error {
+	localResolvedReceiver, err := p.localResolvedNotifier.NewReceiver(0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer localResolvedReceiver.Stop()
+	globalResolvedReceiver, err := p.globalResolvedTsNotifier.NewReceiver(0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer globalResolvedReceiver.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-localResolvedReceiver.C:
+		case <-globalResolvedReceiver.C:
+		}
+		p.checkPendingOps(ctx)
+	}
+}
+
+// checkPendingOps sends the tables whose operations are done to opDoneCh. It
+// never blocks, the tables not sent because opDoneCh is full are kept
+// pending and sent in the next pass.
+func (p *processor) checkPendingOps(ctx context.Context) {
+	localResolvedTs := atomic.LoadUint64(&p.localResolvedTs)
+	globalResolvedTs := atomic.LoadUint64(&p.globalResolvedTs)
+	if localResolvedTs < globalResolvedTs {
+		return
+	}
+	p.pendingOpMu.Lock()
+	defer p.pendingOpMu.Unlock()
+	for tableID, pResolvedTs := range p.pendingOpTables {
+		if atomic.LoadUint64(pResolvedTs) < localResolvedTs {
+			continue
+		}
+		select {
+		case p.opDoneCh <- tableID:
+		default:
+			log.Debug("operation done channel is full, retry later",
+				util.ZapFieldChangefeed(ctx), zap.Int("pending", len(p.pendingOpTables)))
+			return
+		}
+		log.Debug("localResolvedTs >= globalResolvedTs, sending operation done signal",
+			zap.Uint64("localResolvedTs", localResolvedTs), zap.Uint64("globalResolvedTs", globalResolvedTs),
+			zap.Int64("tableID", tableID), util.ZapFieldChangefeed(ctx))
+		delete(p.pendingOpTables, tableID)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type opDoneSuite struct{}
+
+var _ = check.Suite(&opDoneSuite{})
+
+func drainOpDoneCh(p *processor) []int64 {
+	var tableIDs []int64
+	for {
+		select {
+		case tableID := <-p.opDoneCh:
+			tableIDs = append(tableIDs, tableID)
+		default:
+			sort.Slice(tableIDs, func(i, j int) bool { return tableIDs[i] < tableIDs[j] })
+			return tableIDs
+		}
+	}
+}
+
+func (s *opDoneSuite) TestCheckPendingOps(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	p := newProcessorForTest()
+	p.opDoneCh = make(chan int64, 2)
+	resolvedTs := make([]uint64, 4)
+	for i := range resolvedTs {
+		p.addPendingOpTable(int64(i), &resolvedTs[i])
+	}
+	atomic.StoreUint64(&p.localResolvedTs, 10)
+	atomic.StoreUint64(&p.globalResolvedTs, 20)
+	atomic.StoreUint64(&resolvedTs[0], 20)
+	// localResolvedTs < globalResolvedTs
+	p.checkPendingOps(ctx)
+	c.Assert(drainOpDoneCh(p), check.HasLen, 0)
+
+	atomic.StoreUint64(&p.localResolvedTs, 20)
+	p.checkPendingOps(ctx)
+	c.Assert(drainOpDoneCh(p), check.DeepEquals, []int64{0})
+	c.Assert(p.pendingOpTables, check.HasLen, 3)
+
+	// the tables not sent because opDoneCh is full are sent in the next pass
+	for i := range resolvedTs {
+		atomic.StoreUint64(&resolvedTs[i], 30)
+	}
+	p.checkPendingOps(ctx)
+	c.Assert(drainOpDoneCh(p), check.HasLen, 2)
+	c.Assert(p.pendingOpTables, check.HasLen, 1)
+	p.checkPendingOps(ctx)
+	c.Assert(drainOpDoneCh(p), check.HasLen, 1)
+	c.Assert(p.pendingOpTables, check.HasLen, 0)
+}
+
+func (s *opDoneSuite) TestRemovePendingOpTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	p := newProcessorForTest()
+	p.opDoneCh = make(chan int64, 1)
+	var oldResolvedTs, newResolvedTs uint64
+	p.addPendingOpTable(1, &oldResolvedTs)
+	// the table is re-added before the old table pipeline exits
+	p.addPendingOpTable(1, &newResolvedTs)
+	p.removePendingOpTable(1, &oldResolvedTs)
+	c.Assert(p.pendingOpTables, check.HasLen, 1)
+	p.removePendingOpTable(1, &newResolvedTs)
+	c.Assert(p.pendingOpTables, check.HasLen, 0)
+}
+
+func (s *opDoneSuite) TestOpDoneWorker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newProcessorForTest()
+	p.opDoneCh = make(chan int64, 1)
+	defer p.localResolvedNotifier.Close()
+	defer p.globalResolvedTsNotifier.Close()
+	var resolvedTs uint64
+	p.addPendingOpTable(1, &resolvedTs)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.opDoneWorker(ctx)
+	}()
+
+	atomic.StoreUint64(&p.localResolvedTs, 10)
+	atomic.StoreUint64(&p.globalResolvedTs, 10)
+	atomic.StoreUint64(&resolvedTs, 10)
+	// the worker is notified when the resolved ts advance
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+loop:
+	for {
+		select {
+		case tableID := <-p.opDoneCh:
+			c.Assert(tableID, check.Equals, int64(1))
+			break loop
+		case <-ticker.C:
+			p.globalResolvedTsNotifier.Notify()
+		case <-timeout:
+			c.Fatal("operation done signal is not received")
+		}
+	}
+	cancel()
+	c.Assert(<-errCh, check.ErrorMatches, "context canceled")
+}
+
+func BenchmarkCheckPendingOpsIdle(b *testing.B) {
+	ctx := context.Background()
+	p := newProcessorForTest()
+	p.opDoneCh = make(chan int64, defaultOpDoneChanSize)
+	atomic.StoreUint64(&p.localResolvedTs, 20)
+	atomic.StoreUint64(&p.globalResolvedTs, 10)
+	// 10k idle tables which don't catch up with the local resolved ts
+	resolvedTs := make([]uint64, 10000)
+	for i := range resolvedTs {
+		resolvedTs[i] = 10
+		p.addPendingOpTable(int64(i), &resolvedTs[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.checkPendingOps(ctx)
+	}
+}
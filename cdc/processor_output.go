@@ -0,0 +1,189 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+// defaultControlOutputChanSize is the size of the control lane of the
+// processor output, the resolved events are small and consumed promptly
+const defaultControlOutputChanSize = 16
+
+// outputLane tracks the rows of a table in the row lane of the processor
+// output, p.output. The rows of all the tables are interleaved in the row
+// lane, while the resolved events are sent to the control lane, so that they
+// aren't queued behind the row backlog. A resolved ts is acted upon once the
+// emitted watermarks of all the tables reach it instead.
+//
+// The rows of a table are sent in the order of the commit ts, and the table
+// is resolved after the rows before the resolved ts are sent. The resolved ts
+// is marked with the number of the rows sent before it, the rows before the
+// resolved ts are all consumed once the consumer reaches the mark.
+type outputLane struct {
+	mu       sync.Mutex
+	sent     uint64
+	consumed uint64
+	// marks are the resolved ts not reached by the consumer yet, in the order
+	// of the rows sent before them
+	marks []outputLaneMark
+	// resolvedTs is the last resolved ts of the table, and emittedTs is the
+	// watermark before which the rows of the table are all consumed
+	resolvedTs model.Ts
+	emittedTs  model.Ts
+	// released is set once the table is removed, the rows left are not waited
+	released bool
+	// gen is the generation of the lane, which tells the rows of the removed
+	// table from the ones of the table added back with the same id
+	gen uint64
+}
+
+type outputLaneMark struct {
+	seq uint64
+	ts  model.Ts
+}
+
+// outputRow is a row sent to the row lane, tagged with the generation of the
+// lane it's counted in
+type outputRow struct {
+	event *model.PolymorphicEvent
+	gen   uint64
+}
+
+func newOutputLane(startTs model.Ts, gen uint64) *outputLane {
+	return &outputLane{resolvedTs: startTs, emittedTs: startTs, gen: gen}
+}
+
+// send is called before a row is sent to the row lane
+func (l *outputLane) send() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sent++
+}
+
+// unsend is called if the row counted isn't sent
+func (l *outputLane) unsend() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sent--
+}
+
+// resolve marks the resolved ts of the table, the rows before it are all sent
+func (l *outputLane) resolve(ts model.Ts) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ts <= l.resolvedTs {
+		return
+	}
+	l.resolvedTs = ts
+	if l.consumed >= l.sent {
+		l.emittedTs = ts
+		return
+	}
+	if n := len(l.marks); n > 0 && l.marks[n-1].seq == l.sent {
+		l.marks[n-1].ts = ts
+		return
+	}
+	l.marks = append(l.marks, outputLaneMark{seq: l.sent, ts: ts})
+}
+
+// consume is called after a row is received from the row lane
+func (l *outputLane) consume() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.consumed >= l.sent {
+		// the row is sent by the table removed before
+		return
+	}
+	l.consumed++
+	i := 0
+	for ; i < len(l.marks) && l.marks[i].seq <= l.consumed; i++ {
+		l.emittedTs = l.marks[i].ts
+	}
+	l.marks = l.marks[i:]
+	if l.consumed == l.sent {
+		l.emittedTs = l.resolvedTs
+	}
+}
+
+// emittedBefore returns whether the rows of the table before the resolved ts
+// are all consumed. The table resolved before the resolved ts is added after
+// the global resolved ts is calculated, only the rows before its own resolved
+// ts are waited, see the global resolved ts fallback in syncResolved.
+func (l *outputLane) emittedBefore(resolvedTs model.Ts) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return true
+	}
+	if l.resolvedTs < resolvedTs {
+		resolvedTs = l.resolvedTs
+	}
+	return l.emittedTs >= resolvedTs
+}
+
+// acquireOutputLane returns the lane of the table, the lane is shared with
+// the dying table replaced by the table like the pending events.
+func (p *processor) acquireOutputLane(tableID model.TableID, startTs model.Ts) *outputLane {
+	if lane, ok := p.outputLanes.Load(tableID); ok {
+		return lane.(*outputLane)
+	}
+	gen := atomic.AddUint64(&p.outputLaneGen, 1)
+	lane, _ := p.outputLanes.LoadOrStore(tableID, newOutputLane(startTs, gen))
+	return lane.(*outputLane)
+}
+
+// releaseOutputLane removes the lane of the table removed
+func (p *processor) releaseOutputLane(tableID model.TableID) {
+	if lane, ok := p.outputLanes.Load(tableID); ok {
+		l := lane.(*outputLane)
+		l.mu.Lock()
+		l.released = true
+		l.mu.Unlock()
+		p.outputLanes.Delete(tableID)
+	}
+}
+
+// outputLaneOf returns the lane of the row received from the row lane, nil is
+// returned if the row isn't counted in any lane. released is true if the lane
+// the row is counted in is released, even if the table is added back with a
+// new lane, the row should be dropped.
+func (p *processor) outputLaneOf(row outputRow) (lane *outputLane, released bool) {
+	if row.event.RawKV == nil || row.gen == 0 {
+		return nil, false
+	}
+	l, ok := p.outputLanes.Load(tablecodec.DecodeTableID(row.event.RawKV.Key))
+	if !ok || l.(*outputLane).gen != row.gen {
+		return nil, true
+	}
+	return l.(*outputLane), false
+}
+
+// blockingOutputLane returns a lane whose rows before the resolved ts are not
+// all consumed, nil is returned if the resolved ts can be acted upon.
+func (p *processor) blockingOutputLane(resolvedTs model.Ts) *outputLane {
+	var blocking *outputLane
+	p.outputLanes.Range(func(_, lane interface{}) bool {
+		if l := lane.(*outputLane); !l.emittedBefore(resolvedTs) {
+			blocking = l
+			return false
+		}
+		return true
+	})
+	return blocking
+}
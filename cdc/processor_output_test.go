@@ -0,0 +1,361 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/notify"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+type outputLaneSuite struct{}
+
+var _ = check.Suite(&outputLaneSuite{})
+
+func (s *outputLaneSuite) TestOutputLane(c *check.C) {
+	defer testleak.AfterTest(c)()
+	l := newOutputLane(10, 1)
+	c.Assert(l.emittedBefore(10), check.IsTrue)
+
+	// the rows before 20 are sent, and the rows after it are sent before the
+	// table is resolved again
+	l.send()
+	l.send()
+	l.resolve(20)
+	l.send()
+	l.resolve(25)
+	l.resolve(30)
+	l.send()
+	c.Assert(l.marks, check.HasLen, 2)
+	c.Assert(l.emittedBefore(20), check.IsFalse)
+	l.consume()
+	c.Assert(l.emittedBefore(20), check.IsFalse)
+	l.consume()
+	c.Assert(l.emittedBefore(20), check.IsTrue)
+	c.Assert(l.emittedBefore(21), check.IsFalse)
+	c.Assert(l.emittedBefore(30), check.IsFalse)
+	l.consume()
+	c.Assert(l.emittedBefore(30), check.IsTrue)
+	l.consume()
+	c.Assert(l.marks, check.HasLen, 0)
+	c.Assert(l.emittedTs, check.Equals, uint64(30))
+
+	// the table resolved before the resolved ts only waits for its own rows
+	l.send()
+	c.Assert(l.emittedBefore(100), check.IsTrue)
+	l.resolve(40)
+	c.Assert(l.emittedBefore(100), check.IsFalse)
+	c.Assert(l.emittedBefore(30), check.IsTrue)
+	l.unsend()
+	l.resolve(50)
+	c.Assert(l.emittedBefore(50), check.IsTrue)
+
+	// the rows of the removed table are not waited or counted
+	l.send()
+	l.resolve(60)
+	c.Assert(l.emittedBefore(60), check.IsFalse)
+	p := newProcessorForTest()
+	p.outputLanes.Store(int64(1), l)
+	c.Assert(p.blockingOutputLane(60), check.Equals, l)
+	p.releaseOutputLane(1)
+	c.Assert(l.emittedBefore(60), check.IsTrue)
+	c.Assert(p.blockingOutputLane(60), check.IsNil)
+	l.consume()
+	l.consume()
+	c.Assert(l.consumed, check.Equals, l.sent)
+}
+
+// outputTestSink checks that the rows are emitted after the resolved ts acted
+// upon by syncResolved
+type outputTestSink struct {
+	sink.Sink
+	p *processor
+	c *check.C
+
+	mu       sync.Mutex
+	rows     map[model.TableID][]uint64
+	violated error
+	// backlog is the length of the row lane when the resolved ts emitted is
+	// first observed
+	observedTs uint64
+	backlog    int
+}
+
+func newOutputTestSink(c *check.C, p *processor) *outputTestSink {
+	return &outputTestSink{p: p, c: c, rows: make(map[model.TableID][]uint64), backlog: -1}
+}
+
+func (s *outputTestSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resolvedTs := atomic.LoadUint64(&s.p.sinkEmittedResolvedTs)
+	if resolvedTs > s.observedTs && s.backlog < 0 {
+		s.observedTs, s.backlog = resolvedTs, len(s.p.output)
+	}
+	for _, row := range rows {
+		if row.CommitTs <= resolvedTs && s.violated == nil {
+			s.violated = errors.Errorf("row %d of table %d is emitted after the resolved ts %d",
+				row.CommitTs, row.Table.TableID, resolvedTs)
+		}
+		s.rows[row.Table.TableID] = append(s.rows[row.Table.TableID], row.CommitTs)
+	}
+	return nil
+}
+
+func newOutputTestProcessor(c *check.C, outputSize int) *processor {
+	notifier := new(notify.Notifier)
+	receiver, err := notifier.NewReceiver(time.Hour)
+	c.Assert(err, check.IsNil)
+	formatter, err := model.NewEventLogFormatter(config.GetDefaultReplicaConfig())
+	c.Assert(err, check.IsNil)
+	p := newProcessorForTest(withOutputSize(outputSize))
+	p.controlOutput = make(chan model.Ts, defaultControlOutputChanSize)
+	p.statistics = newProcessorStatistics(time.Now())
+	p.eventLogFormatter = formatter
+	p.localResolvedTs = math.MaxUint64
+	p.sinkEmittedResolvedNotifier = notifier
+	p.sinkEmittedResolvedReceiver = receiver
+	return p
+}
+
+// newOutputTestRow counts a row of the table in the lane and returns it
+func newOutputTestRow(lane *outputLane, tableID model.TableID, crts uint64) outputRow {
+	lane.send()
+	ev := model.NewPolymorphicEvent(&model.RawKVEntry{
+		OpType:  model.OpTypePut,
+		Key:     tablecodec.GenTableRecordPrefix(tableID),
+		StartTs: crts - 1,
+		CRTs:    crts,
+	})
+	ev.Row = &model.RowChangedEvent{
+		StartTs:  crts - 1,
+		CommitTs: crts,
+		Table:    &model.TableName{Schema: "test", Table: "t", TableID: tableID},
+	}
+	return outputRow{event: ev, gen: lane.gen}
+}
+
+// runSyncResolved runs syncResolved in the background, wait returns the error
+// it returns once the ctx is canceled
+func runSyncResolved(ctx context.Context, p *processor) (wait func() error) {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.syncResolved(ctx)
+	}()
+	return func() error {
+		return <-errCh
+	}
+}
+
+func waitSinkEmittedResolvedTs(c *check.C, p *processor, ts uint64) {
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&p.sinkEmittedResolvedTs) != ts {
+		if time.Now().After(deadline) {
+			c.Fatalf("the resolved ts %d is not emitted, the last one is %d", ts, atomic.LoadUint64(&p.sinkEmittedResolvedTs))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *outputLaneSuite) TestReleasedLaneDropped(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newOutputTestProcessor(c, 16)
+	testSink := newOutputTestSink(c, p)
+	p.sink = testSink
+
+	// the table is removed with the rows left in the row lane, and added back
+	// before they're received
+	released := p.acquireOutputLane(1, 1)
+	for _, ts := range []uint64{5, 8} {
+		p.output <- newOutputTestRow(released, 1, ts)
+	}
+	p.releaseOutputLane(1)
+	lane := p.acquireOutputLane(1, 8)
+	c.Assert(lane, check.Not(check.Equals), released)
+	c.Assert(lane.gen, check.Not(check.Equals), released.gen)
+	p.output <- newOutputTestRow(lane, 1, 9)
+	lane.resolve(10)
+	p.controlOutput <- 10
+
+	wait := runSyncResolved(ctx, p)
+	waitSinkEmittedResolvedTs(c, p, 10)
+	cancel()
+	c.Assert(errors.Cause(wait()), check.Equals, context.Canceled)
+
+	// the rows of the released lane are dropped instead of being counted in
+	// the lane of the table added back
+	testSink.mu.Lock()
+	defer testSink.mu.Unlock()
+	c.Assert(testSink.violated, check.IsNil)
+	c.Assert(testSink.rows[1], check.DeepEquals, []uint64{9})
+	c.Assert(lane.consumed, check.Equals, lane.sent)
+}
+
+func (s *outputLaneSuite) TestResolvedNotStarved(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	const backlog = 20000
+	p := newOutputTestProcessor(c, backlog+16)
+	testSink := newOutputTestSink(c, p)
+	p.sink = testSink
+
+	// the rows of table 1 before 10 are followed by the backlog of table 2
+	lane1, lane2 := p.acquireOutputLane(1, 1), p.acquireOutputLane(2, 1)
+	lane2.resolve(10)
+	for _, ts := range []uint64{5, 8} {
+		p.output <- newOutputTestRow(lane1, 1, ts)
+	}
+	lane1.resolve(10)
+	for i := 0; i < backlog; i++ {
+		p.output <- newOutputTestRow(lane2, 2, uint64(20+i))
+	}
+	p.controlOutput <- 10
+
+	wait := runSyncResolved(ctx, p)
+	waitSinkEmittedResolvedTs(c, p, 10)
+	lane2.resolve(backlog + 20)
+	p.controlOutput <- backlog + 20
+	waitSinkEmittedResolvedTs(c, p, backlog+20)
+	cancel()
+	c.Assert(errors.Cause(wait()), check.Equals, context.Canceled)
+
+	testSink.mu.Lock()
+	defer testSink.mu.Unlock()
+	c.Assert(testSink.violated, check.IsNil)
+	c.Assert(testSink.rows[1], check.DeepEquals, []uint64{5, 8})
+	c.Assert(testSink.rows[2], check.HasLen, backlog)
+	// the resolved ts 10 is acted upon long before the backlog is consumed
+	c.Assert(testSink.observedTs, check.Equals, uint64(10))
+	c.Assert(testSink.backlog > backlog/2, check.IsTrue, check.Commentf("backlog %d", testSink.backlog))
+}
+
+// TestRandomInterleavings sends the rows and the resolved events of the
+// tables in random interleavings like the table pipelines and the global
+// resolved worker do, the rows before a resolved ts must be all emitted
+// before the resolved ts is acted upon.
+func (s *outputLaneSuite) TestRandomInterleavings(c *check.C) {
+	defer testleak.AfterTest(c)()
+	seed := time.Now().UnixNano()
+	for round := 0; round < 20; round++ {
+		rnd := rand.New(rand.NewSource(seed + int64(round)))
+		s.testRandomInterleaving(c, rnd, check.Commentf("seed %d, round %d", seed, round))
+	}
+}
+
+func (s *outputLaneSuite) testRandomInterleaving(c *check.C, rnd *rand.Rand, comment check.CommentInterface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newOutputTestProcessor(c, 1+rnd.Intn(64))
+	testSink := newOutputTestSink(c, p)
+	p.sink = testSink
+	wait := runSyncResolved(ctx, p)
+
+	tableCount := 1 + rnd.Intn(6)
+	const maxTs = 2000
+	// resolvedTs are the resolved ts of the tables, the global resolved ts is
+	// the min of them like the owner calculates
+	resolvedTs := make([]uint64, tableCount)
+	expected := make(map[model.TableID][]uint64, tableCount)
+	var wg sync.WaitGroup
+	for i := 0; i < tableCount; i++ {
+		tableID := model.TableID(i + 1)
+		lane := p.acquireOutputLane(tableID, 1)
+		// the rows of a table are generated before the table is started
+		var rows []uint64
+		for ts := uint64(2); ts < maxTs; ts++ {
+			for n := rnd.Intn(3); rnd.Intn(4) == 0 && n > 0; n-- {
+				rows = append(rows, ts)
+			}
+		}
+		expected[tableID] = rows
+		seed := rnd.Int63()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			next := 0
+			for ts := uint64(2); ts <= maxTs; ts += uint64(1 + rnd.Intn(50)) {
+				for ; next < len(rows) && rows[next] <= ts; next++ {
+					p.output <- newOutputTestRow(lane, tableID, rows[next])
+					if rnd.Intn(8) == 0 {
+						runtime.Gosched()
+					}
+				}
+				lane.resolve(ts)
+				atomic.StoreUint64(&resolvedTs[i], ts)
+			}
+			for ; next < len(rows); next++ {
+				p.output <- newOutputTestRow(lane, tableID, rows[next])
+			}
+			lane.resolve(maxTs)
+			atomic.StoreUint64(&resolvedTs[i], maxTs)
+		}(i)
+	}
+
+	// the global resolved worker sends the min resolved ts of the tables
+	globalResolvedTs := func() uint64 {
+		ts := uint64(math.MaxUint64)
+		for i := range resolvedTs {
+			if rts := atomic.LoadUint64(&resolvedTs[i]); rts < ts {
+				ts = rts
+			}
+		}
+		return ts
+	}
+	last := uint64(0)
+	deadline := time.Now().Add(20 * time.Second)
+	for last < maxTs {
+		if time.Now().After(deadline) {
+			c.Fatal("the resolved ts is not advanced in time", comment)
+		}
+		if ts := globalResolvedTs(); ts > last {
+			last = ts
+			p.controlOutput <- ts
+		}
+		if rnd.Intn(4) == 0 {
+			time.Sleep(time.Duration(rnd.Intn(100)) * time.Microsecond)
+		} else {
+			runtime.Gosched()
+		}
+	}
+	wg.Wait()
+	waitSinkEmittedResolvedTs(c, p, maxTs)
+	cancel()
+	c.Assert(errors.Cause(wait()), check.Equals, context.Canceled, comment)
+
+	testSink.mu.Lock()
+	defer testSink.mu.Unlock()
+	c.Assert(testSink.violated, check.IsNil, comment)
+	for tableID, rows := range expected {
+		if len(rows) == 0 {
+			c.Assert(testSink.rows[tableID], check.HasLen, 0, comment)
+			continue
+		}
+		c.Assert(testSink.rows[tableID], check.DeepEquals, rows, comment)
+	}
+}
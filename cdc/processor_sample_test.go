@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorSampleSuite struct{}
+
+var _ = check.Suite(&processorSampleSuite{})
+
+// sampledEvents runs the table pipeline with the sample rate, and returns whether
+// each output event is sampled
+func sampledEvents(c *check.C, sampleRate float64, n int) []bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Latency = &config.LatencyConfig{SampleRate: sampleRate}
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	sorter := puller.NewRectifier(&passThroughSorter{ch: make(chan *model.PolymorphicEvent, 16)}, math.MaxUint64)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_ = sorter.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = p.mounter.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		p.newTablePipeline(1, "`test`.`t`", new(uint64), new(int64), nil, nil, &model.TableReplicaInfo{StartTs: 1}).consume(ctx, sorter)
+	}()
+
+	sampled := make([]bool, 0, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			sorter.AddEntry(ctx, newDrainTestEvent(1, uint64(i+5)))
+		}
+	}()
+	for i := 0; i < n; i++ {
+		select {
+		case event := <-p.output:
+			sampled = append(sampled, event.event.Sampled)
+		case <-time.After(5 * time.Second):
+			c.Fatal("the event is not received")
+		}
+	}
+	return sampled
+}
+
+func (s *processorSampleSuite) TestSampleEvents(c *check.C) {
+	defer testleak.AfterTest(c)()
+	for _, sampled := range sampledEvents(c, 1, 10) {
+		c.Assert(sampled, check.IsTrue)
+	}
+	for _, sampled := range sampledEvents(c, 0, 10) {
+		c.Assert(sampled, check.IsFalse)
+	}
+	count := 0
+	for _, sampled := range sampledEvents(c, 0.5, 1000) {
+		if sampled {
+			count++
+		}
+	}
+	c.Assert(count > 300 && count < 700, check.IsTrue, check.Commentf("%d of 1000 events are sampled", count))
+}
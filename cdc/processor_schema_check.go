@@ -0,0 +1,148 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// tableSchemaCheck is a downstream schema check of a table to add, which runs
+// in the background so the other tables are not blocked by it
+type tableSchemaCheck struct {
+	startTs uint64
+	done    bool
+	// readiness is nil if the check can't be done
+	readiness *model.TableReadiness
+	err       error
+}
+
+// checkTableSchema checks whether the downstream table is compatible with the
+// table to add, and records the readiness of the table in the task status. The
+// check runs in the background, and false is returned until it's done. The
+// incompatibilities are returned in the strict mode, and only logged in the
+// lenient mode. The table is added if the check can't be done.
+func (p *processor) checkTableSchema(ctx context.Context, tableID model.TableID, startTs uint64, status *model.TaskStatus) (bool, error) {
+	cfg := p.changefeed.Config.SchemaCheck
+	if !cfg.Enabled() {
+		return true, nil
+	}
+	checker, ok := sink.Unwrap(p.sink).(sink.TableSchemaChecker)
+	if !ok {
+		return true, nil
+	}
+
+	p.schemaChecksMu.Lock()
+	check, ok := p.schemaChecks[tableID]
+	if !ok || check.startTs != startTs {
+		if p.schemaChecks == nil {
+			p.schemaChecks = make(map[model.TableID]*tableSchemaCheck)
+		}
+		check = &tableSchemaCheck{startTs: startTs}
+		p.schemaChecks[tableID] = check
+		go p.runTableSchemaCheck(ctx, checker, tableID, check)
+	}
+	if !check.done {
+		p.schemaChecksMu.Unlock()
+		return false, nil
+	}
+	delete(p.schemaChecks, tableID)
+	p.schemaChecksMu.Unlock()
+
+	if check.readiness == nil {
+		return true, nil
+	}
+	status.SetReadiness(tableID, check.readiness)
+	status.Dirty = true
+	if check.err != nil && cfg.Mode == config.SchemaCheckLenient {
+		log.Warn("the downstream schema of the table is incompatible, replicate it anyway",
+			util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID), zap.Error(check.err))
+		return true, nil
+	}
+	return true, check.err
+}
+
+// runTableSchemaCheck runs the downstream schema check of the table. A table
+// created at its start ts may not be created in the downstream yet, it's not
+// ready rather than incompatible, so it's checked again until it's created.
+func (p *processor) runTableSchemaCheck(ctx context.Context, checker sink.TableSchemaChecker, tableID model.TableID, check *tableSchemaCheck) {
+	readiness, err := p.doTableSchemaCheck(ctx, checker, tableID, check.startTs)
+	p.schemaChecksMu.Lock()
+	defer p.schemaChecksMu.Unlock()
+	check.readiness, check.err, check.done = readiness, err, true
+}
+
+func (p *processor) doTableSchemaCheck(
+	ctx context.Context, checker sink.TableSchemaChecker, tableID model.TableID, startTs uint64,
+) (*model.TableReadiness, error) {
+	info, ok := p.getTableInfo(ctx, tableID, startTs)
+	if !ok {
+		log.Warn("the table is not found, skip checking the downstream schema",
+			util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID))
+		return nil, nil
+	}
+	created := p.tableCreatedAt(ctx, tableID, startTs)
+	deadline := time.Now().Add(createdTableCheckWait)
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, schemaCheckTimeout)
+		err := checker.CheckTableSchema(checkCtx, info)
+		cancel()
+		if created && cerror.ErrDownstreamTableNotExists.Equal(err) {
+			if time.Now().After(deadline) {
+				log.Warn("the created table is not found in the downstream, skip checking the downstream schema",
+					util.ZapFieldChangefeed(ctx), zap.Int64("tableID", tableID), zap.String("table", info.TableName.QuoteString()))
+				return nil, nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil, nil
+			case <-time.After(createdTableCheckInterval):
+			}
+			continue
+		}
+		if err != nil && cerror.ErrTableSchemaIncompatible.NotEqual(err) && cerror.ErrDownstreamTableNotExists.NotEqual(err) {
+			log.Warn("failed to check the downstream schema of the table", util.ZapFieldChangefeed(ctx),
+				zap.Int64("tableID", tableID), zap.String("table", info.TableName.QuoteString()), zap.Error(err))
+			return nil, nil
+		}
+		readiness := &model.TableReadiness{Table: info.TableName.QuoteString(), Ready: err == nil}
+		if err != nil {
+			readiness.Reason = err.Error()
+		}
+		return readiness, err
+	}
+}
+
+// tableCreatedAt returns whether the table is created by the DDL at ts
+func (p *processor) tableCreatedAt(ctx context.Context, tableID model.TableID, ts uint64) bool {
+	if ts == 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, tableNameTimeout)
+	defer cancel()
+	snap, err := p.schemaStorage.GetSnapshot(ctx, ts-1)
+	if err != nil {
+		return false
+	}
+	_, ok := snap.PhysicalTableByID(tableID)
+	return !ok
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorSchemaCheckSuite struct{}
+
+var _ = check.Suite(&processorSchemaCheckSuite{})
+
+// schemaCheckTestSink returns err for checking the downstream schema
+type schemaCheckTestSink struct {
+	sink.Sink
+	mu      sync.Mutex
+	err     error
+	checked []string
+}
+
+func (s *schemaCheckTestSink) CheckTableSchema(ctx context.Context, table *model.TableInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checked = append(s.checked, table.TableName.QuoteString())
+	return s.err
+}
+
+func (s *schemaCheckTestSink) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// checkTableSchemaUntilDone waits for the background schema check of the table
+func checkTableSchemaUntilDone(c *check.C, p *processor, tableID model.TableID, startTs uint64, status *model.TaskStatus) error {
+	for i := 0; i < 500; i++ {
+		done, err := p.checkTableSchema(context.Background(), tableID, startTs, status)
+		if done {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatal("the schema check of the table is not done")
+	return nil
+}
+
+// handleTablesUntilChecked handles the tables until the operation of the table
+// is processed, which waits for the background schema check of the table
+func handleTablesUntilChecked(c *check.C, p *processor, tableID model.TableID, status *model.TaskStatus) {
+	for i := 0; i < 500; i++ {
+		_, err := p.handleTables(context.Background(), status)
+		c.Assert(err, check.IsNil)
+		if status.Operation[tableID].TableProcessed() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatal("the operation of the table is not processed")
+}
+
+// newSchemaCheckTestProcessor returns a processor, whose schema storage has
+// the table `test`.`orders` with id 2 created at ts 110
+func newSchemaCheckTestProcessor(c *check.C, mode string, s sink.Sink) *processor {
+	storage, err := entry.NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	jobs := []*timodel.Job{
+		{
+			ID:       1,
+			State:    timodel.JobStateSynced,
+			SchemaID: 1,
+			Type:     timodel.ActionCreateSchema,
+			BinlogInfo: &timodel.HistoryInfo{
+				SchemaVersion: 1,
+				DBInfo:        &timodel.DBInfo{ID: 1, Name: timodel.NewCIStr("test"), State: timodel.StatePublic},
+				FinishedTS:    100,
+			},
+		},
+		{
+			ID:       2,
+			State:    timodel.JobStateSynced,
+			SchemaID: 1,
+			TableID:  2,
+			Type:     timodel.ActionCreateTable,
+			BinlogInfo: &timodel.HistoryInfo{
+				SchemaVersion: 2,
+				TableInfo:     &timodel.TableInfo{ID: 2, Name: timodel.NewCIStr("orders"), State: timodel.StatePublic},
+				FinishedTS:    110,
+			},
+		},
+	}
+	for _, job := range jobs {
+		c.Assert(storage.HandleDDLJob(job), check.IsNil)
+	}
+	storage.AdvanceResolvedTs(200)
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.SchemaCheck.Mode = mode
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	p.schemaStorage = storage
+	p.sink = s
+	return p
+}
+
+func (s *processorSchemaCheckSuite) TestStrictMode(c *check.C) {
+	defer testleak.AfterTest(c)()
+	checkSink := &schemaCheckTestSink{
+		err: cerror.ErrTableSchemaIncompatible.GenWithStackByArgs("`test`.`orders`", "the table doesn't exist in the downstream"),
+	}
+	p := newSchemaCheckTestProcessor(c, config.SchemaCheckStrict, checkSink)
+
+	// the table is not added, and the error is recorded in the operation
+	status := &model.TaskStatus{
+		Tables:    map[model.TableID]*model.TableReplicaInfo{2: {StartTs: 120}},
+		Operation: map[model.TableID]*model.TableOperation{2: {BoundaryTs: 120}},
+	}
+	handleTablesUntilChecked(c, p, 2, status)
+	c.Assert(checkSink.checked, check.DeepEquals, []string{"`test`.`orders`"})
+	c.Assert(p.tables, check.HasLen, 0)
+	c.Assert(status.Dirty, check.IsTrue)
+	op := status.Operation[2]
+	c.Assert(op.Status, check.Equals, model.OperProcessed)
+	c.Assert(op.Error, check.NotNil)
+	c.Assert(op.Error.Code, check.Equals, string(cerror.ErrTableSchemaIncompatible.RFCCode()))
+	c.Assert(op.Error.Origin, check.Equals, errOriginSink)
+	c.Assert(status.Readiness[2].Table, check.Equals, "`test`.`orders`")
+	c.Assert(status.Readiness[2].Ready, check.IsFalse)
+	c.Assert(status.Readiness[2].Reason, check.Matches, ".*the table doesn't exist in the downstream.*")
+}
+
+func (s *processorSchemaCheckSuite) TestLenientMode(c *check.C) {
+	defer testleak.AfterTest(c)()
+	checkSink := &schemaCheckTestSink{
+		err: cerror.ErrTableSchemaIncompatible.GenWithStackByArgs("`test`.`orders`", "the table doesn't exist in the downstream"),
+	}
+	p := newSchemaCheckTestProcessor(c, config.SchemaCheckLenient, checkSink)
+
+	// the incompatibility is recorded, but the table is added
+	status := &model.TaskStatus{}
+	c.Assert(checkTableSchemaUntilDone(c, p, 2, 120, status), check.IsNil)
+	c.Assert(status.Readiness[2].Ready, check.IsFalse)
+	c.Assert(status.Dirty, check.IsTrue)
+
+	checkSink.setErr(nil)
+	status = &model.TaskStatus{}
+	c.Assert(checkTableSchemaUntilDone(c, p, 2, 120, status), check.IsNil)
+	c.Assert(status.Readiness[2], check.DeepEquals, &model.TableReadiness{Table: "`test`.`orders`", Ready: true})
+
+	// the table is added if the check can't be done
+	checkSink.setErr(cerror.ErrMySQLQueryError.GenWithStackByArgs())
+	p.changefeed.Config.SchemaCheck.Mode = config.SchemaCheckStrict
+	status = &model.TaskStatus{}
+	c.Assert(checkTableSchemaUntilDone(c, p, 2, 120, status), check.IsNil)
+	c.Assert(status.Readiness, check.HasLen, 0)
+
+	// nothing is checked if the check is off
+	p.changefeed.Config.SchemaCheck.Mode = config.SchemaCheckOff
+	checkSink.checked = nil
+	done, err := p.checkTableSchema(context.Background(), 2, 120, status)
+	c.Assert(done, check.IsTrue)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkSink.checked, check.HasLen, 0)
+}
+
+func (s *processorSchemaCheckSuite) TestWaitCreatedTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	checkSink := &schemaCheckTestSink{
+		err: cerror.ErrDownstreamTableNotExists.GenWithStackByArgs("`test`.`orders`"),
+	}
+	p := newSchemaCheckTestProcessor(c, config.SchemaCheckStrict, checkSink)
+	ctx := context.Background()
+
+	// the table created at its start ts is not ready until it's created in
+	// the downstream, rather than incompatible
+	status := &model.TaskStatus{}
+	done, err := p.checkTableSchema(ctx, 2, 110, status)
+	c.Assert(done, check.IsFalse)
+	c.Assert(err, check.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	done, err = p.checkTableSchema(ctx, 2, 110, status)
+	c.Assert(done, check.IsFalse)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Readiness, check.HasLen, 0)
+
+	checkSink.setErr(nil)
+	c.Assert(checkTableSchemaUntilDone(c, p, 2, 110, status), check.IsNil)
+	c.Assert(status.Readiness[2], check.DeepEquals, &model.TableReadiness{Table: "`test`.`orders`", Ready: true})
+
+	// the missing table is incompatible if it's not created at its start ts
+	checkSink.setErr(cerror.ErrDownstreamTableNotExists.GenWithStackByArgs("`test`.`orders`"))
+	status = &model.TaskStatus{}
+	err = checkTableSchemaUntilDone(c, p, 2, 120, status)
+	c.Assert(cerror.ErrDownstreamTableNotExists.Equal(err), check.IsTrue)
+	c.Assert(status.Readiness[2].Ready, check.IsFalse)
+}
+
+func (s *processorSchemaCheckSuite) TestKeepIncompatibleTableUnscheduled(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+
+	const changefeedID = "test-changefeed"
+	failedStatus := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 100}},
+		Operation: map[model.TableID]*model.TableOperation{
+			1: {BoundaryTs: 100, Status: model.OperProcessed, Error: &model.RunningError{
+				Code:    string(cerror.ErrTableSchemaIncompatible.RFCCode()),
+				Message: "the downstream schema of table `test`.`orders` is incompatible",
+			}},
+		},
+		Readiness: map[model.TableID]*model.TableReadiness{1: {Table: "`test`.`orders`"}},
+	}
+	c.Assert(etcdCli.PutTaskStatus(ctx, changefeedID, "capture-1", failedStatus), check.IsNil)
+	cf := &changeFeed{
+		id:           changefeedID,
+		etcdCli:      etcdCli,
+		status:       &model.ChangeFeedStatus{},
+		taskStatus:   model.ProcessorsInfos{"capture-1": failedStatus.Clone()},
+		orphanTables: make(map[model.TableID]model.Ts),
+	}
+	c.Assert(cf.rescheduleFailedTables(ctx), check.IsNil)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{1: 100})
+	c.Assert(cf.taskStatus["capture-1"].Readiness, check.HasLen, 0)
+
+	// the table isn't moved to other captures, as it fails on any capture
+	captures := map[model.CaptureID]*model.CaptureInfo{"capture-1": {ID: "capture-1"}, "capture-2": {ID: "capture-2"}}
+	operations := map[model.CaptureID]map[model.TableID]*model.TableOperation{
+		"capture-2": {1: {BoundaryTs: 100}},
+	}
+	cf.avoidFailedCaptures(operations, captures)
+	c.Assert(operations["capture-1"], check.HasLen, 0)
+	c.Assert(operations["capture-2"], check.HasLen, 0)
+	c.Assert(cf.status.UnscheduledTables[1], check.Equals, "the downstream schema of table `test`.`orders` is incompatible")
+
+	// the downstream schema is checked again once the failure expires
+	cf.addTableFailures[1].lastTime = time.Now().Add(-2 * addTableFailureTTL)
+	operations = map[model.CaptureID]map[model.TableID]*model.TableOperation{
+		"capture-1": {1: {BoundaryTs: 100}},
+	}
+	cf.avoidFailedCaptures(operations, captures)
+	c.Assert(operations["capture-1"][1], check.NotNil)
+	c.Assert(cf.status.UnscheduledTables, check.IsNil)
+}
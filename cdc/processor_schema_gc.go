@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// schemaGCFloor tracks the start ts of the tables added recently and the
+// tables to be added, the schema snapshots after them are needed by their
+// pullers, which may start from a ts before the global checkpoint ts.
+type schemaGCFloor struct {
+	window time.Duration
+	margin time.Duration
+
+	mu sync.Mutex
+	// tables are the start ts of the tables and the last time they're seen
+	// added or to be added
+	tables map[model.TableID]addedTable
+}
+
+type addedTable struct {
+	startTs  model.Ts
+	lastSeen time.Time
+}
+
+func newSchemaGCFloor(cfg *config.SchemaGCConfig) *schemaGCFloor {
+	return &schemaGCFloor{
+		window: time.Duration(cfg.AddTableWindow) * time.Second,
+		margin: time.Duration(cfg.Margin) * time.Second,
+		tables: make(map[model.TableID]addedTable),
+	}
+}
+
+// addTable records the start ts of the table added
+func (f *schemaGCFloor) addTable(tableID model.TableID, startTs model.Ts, now time.Time) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tables[tableID] = addedTable{startTs: startTs, lastSeen: now}
+}
+
+// observe records the start ts of the tables whose add operations are not
+// applied yet, they're kept until the window passes after they're applied.
+func (f *schemaGCFloor) observe(status *model.TaskStatus, now time.Time) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for tableID, op := range status.Operation {
+		if op.Delete || op.TableApplied() {
+			continue
+		}
+		replicaInfo, exist := status.Tables[tableID]
+		if !exist {
+			continue
+		}
+		f.tables[tableID] = addedTable{startTs: replicaInfo.StartTs, lastSeen: now}
+	}
+}
+
+// gcTs returns the ts before which the schema snapshots can be removed, it's
+// the minimum of the checkpoint ts and the start ts of the tables added
+// within the window, minus the margin.
+func (f *schemaGCFloor) gcTs(checkpointTs model.Ts, now time.Time) model.Ts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	floor := checkpointTs
+	for tableID, table := range f.tables {
+		if now.Sub(table.lastSeen) > f.window {
+			delete(f.tables, tableID)
+			continue
+		}
+		if table.startTs < floor {
+			floor = table.startTs
+		}
+	}
+	physical := oracle.ExtractPhysical(floor) - f.margin.Milliseconds()
+	if physical <= 0 {
+		return 0
+	}
+	return oracle.ComposeTS(physical, 0)
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type schemaGCFloorSuite struct{}
+
+var _ = check.Suite(&schemaGCFloorSuite{})
+
+func (s *schemaGCFloorSuite) TestGCTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Now()
+	ts := func(t time.Time) model.Ts {
+		return oracle.ComposeTS(oracle.GetPhysical(t), 0)
+	}
+	checkpointTs := ts(now)
+	floor := newSchemaGCFloor(&config.SchemaGCConfig{AddTableWindow: 300, Margin: 60})
+
+	// the gc ts is the checkpoint ts minus the margin without tables added
+	c.Assert(floor.gcTs(checkpointTs, now), check.Equals, ts(now.Add(-time.Minute)))
+
+	// the table to be added starts from a ts long before the checkpoint ts,
+	// its snapshots are kept while the add operation is not applied
+	startTs := ts(now.Add(-30 * time.Minute))
+	status := &model.TaskStatus{}
+	status.AddTable(1, &model.TableReplicaInfo{StartTs: startTs}, startTs)
+	status.AddTable(2, &model.TableReplicaInfo{StartTs: checkpointTs}, checkpointTs)
+	floor.observe(status, now)
+	c.Assert(floor.gcTs(checkpointTs, now), check.Equals, ts(now.Add(-31*time.Minute)))
+	now = now.Add(25 * time.Minute)
+	floor.observe(status, now)
+	c.Assert(floor.gcTs(ts(now), now), check.Equals, ts(now.Add(-56*time.Minute)))
+
+	// the table is added, and the snapshots are kept within the window
+	floor.addTable(1, startTs, now)
+	status.Operation[1].Status = model.OperFinished
+	status.Operation[2].Status = model.OperFinished
+	now = now.Add(4 * time.Minute)
+	floor.observe(status, now)
+	c.Assert(floor.gcTs(ts(now), now), check.Equals, ts(now.Add(-60*time.Minute)))
+	now = now.Add(2 * time.Minute)
+	c.Assert(floor.gcTs(ts(now), now), check.Equals, ts(now.Add(-time.Minute)))
+	c.Assert(floor.tables, check.HasLen, 0)
+
+	// the tables to be deleted are not tracked
+	status = &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{3: {StartTs: startTs}},
+	}
+	status.RemoveTable(3, startTs)
+	floor.observe(status, now)
+	c.Assert(floor.gcTs(ts(now), now), check.Equals, ts(now.Add(-time.Minute)))
+	c.Assert(floor.tables, check.HasLen, 0)
+
+	// the gc ts doesn't underflow
+	c.Assert(floor.gcTs(100, now), check.Equals, uint64(0))
+}
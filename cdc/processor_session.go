@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// lostSessions are the leases of the lost sessions, a lost session is counted
+// once by the capture and its processors
+var lostSessions sync.Map
+
+// recordSessionLoss counts the lost session of the capture, it returns false
+// if the session is counted already.
+func recordSessionLoss(captureAddr string, lease clientv3.LeaseID) bool {
+	if _, loaded := lostSessions.LoadOrStore(lease, struct{}{}); loaded {
+		return false
+	}
+	sessionLossCounter.WithLabelValues(captureAddr).Inc()
+	return true
+}
+
+// sessionWatcher watches the etcd session of the capture. Once the session is
+// done, e.g. the lease is expired during an etcd hiccup, the processor stops
+// accepting new operations and exits with ErrCaptureSessionDone, since the
+// tables may be rescheduled to other captures by the owner. The local
+// progress is logged instead of being flushed to etcd.
+func (p *processor) sessionWatcher(ctx context.Context) error {
+	if p.session == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-p.session.Done():
+	}
+	if ctx.Err() != nil {
+		// the session is closed by the exiting capture
+		return errors.Trace(ctx.Err())
+	}
+	atomic.StoreInt32(&p.sessionDone, 1)
+	recordSessionLoss(p.captureInfo.AdvertiseAddr, p.session.Lease())
+	p.logLocalProgress()
+	return cerror.ErrCaptureSessionDone.GenWithStackByArgs(p.captureInfo.ID, p.session.Lease())
+}
+
+func (p *processor) isSessionDone() bool {
+	return atomic.LoadInt32(&p.sessionDone) == 1
+}
+
+// logLocalProgress logs the progress of the processor and its tables, which
+// is the last bookkeeping of a processor whose session is done.
+func (p *processor) logLocalProgress() {
+	p.stateMu.Lock()
+	tableResolvedTs := make(map[model.TableID]model.Ts, len(p.tables))
+	for _, table := range p.tables {
+		tableResolvedTs[table.id] = table.loadResolvedTs()
+	}
+	p.stateMu.Unlock()
+	log.Warn("the etcd session of the capture is done, the processor exits",
+		zap.String("changefeed", p.changefeedID),
+		zap.String("capture-id", p.captureInfo.ID),
+		zap.String("capture", p.captureInfo.AdvertiseAddr),
+		zap.Uint64("checkpointTs", atomic.LoadUint64(&p.checkpointTs)),
+		zap.Uint64("resolvedTs", atomic.LoadUint64(&p.localResolvedTs)),
+		zap.Uint64("sinkEmittedResolvedTs", atomic.LoadUint64(&p.sinkEmittedResolvedTs)),
+		zap.Any("tableResolvedTs", tableResolvedTs))
+}
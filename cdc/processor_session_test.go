@@ -0,0 +1,99 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+type processorSessionSuite struct{}
+
+var _ = check.Suite(&processorSessionSuite{})
+
+const testSessionTTL = 2
+
+func (s *processorSessionSuite) TestSessionDone(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+
+	session, err := concurrency.NewSession(etcdCli.Client.Unwrap(), concurrency.WithTTL(testSessionTTL))
+	c.Assert(err, check.IsNil)
+	defer session.Close() //nolint:errcheck
+	p, _ := newStopTestProcessor(c, etcdCli, &stopTestSink{closeCh: make(chan struct{})})
+	p.captureInfo.AdvertiseAddr = "127.0.0.1:8301"
+	p.session = session
+	p.errs = newErrorCollector()
+	counter := sessionLossCounter.WithLabelValues(p.captureInfo.AdvertiseAddr)
+	losses := testutil.ToFloat64(counter)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.errs.collect(errOriginEtcd, p.sessionWatcher(ctx))
+	}()
+	c.Assert(p.flushTaskStatusAndPosition(ctx), check.IsNil)
+
+	// the lease is killed
+	start := time.Now()
+	_, err = etcdCli.Client.Revoke(ctx, session.Lease())
+	c.Assert(err, check.IsNil)
+	select {
+	case <-done:
+	case <-time.After(testSessionTTL*time.Second + time.Second):
+		c.Fatal("the processor is not exited in time")
+	}
+	c.Assert(time.Since(start) < testSessionTTL*time.Second+time.Second, check.IsTrue)
+	primary := p.errs.wait()
+	c.Assert(primary.origin, check.Equals, errOriginEtcd)
+	c.Assert(primary.err, check.ErrorMatches, ".*the etcd session of capture capture-1 is done.*")
+	c.Assert(p.isSessionDone(), check.IsTrue)
+
+	// no new operation is accepted
+	err = p.flushTaskStatusAndPosition(ctx)
+	c.Assert(err, check.ErrorMatches, ".*ErrCaptureSessionDone.*")
+	// the lost session is counted once for the capture and its processors
+	c.Assert(testutil.ToFloat64(counter), check.Equals, losses+1)
+	c.Assert(recordSessionLoss(p.captureInfo.AdvertiseAddr, session.Lease()), check.IsFalse)
+	c.Assert(testutil.ToFloat64(counter), check.Equals, losses+1)
+}
+
+func (s *processorSessionSuite) TestSessionWatcherCanceled(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+
+	session, err := concurrency.NewSession(etcdCli.Client.Unwrap(), concurrency.WithTTL(testSessionTTL))
+	c.Assert(err, check.IsNil)
+	p, _ := newStopTestProcessor(c, etcdCli, &stopTestSink{closeCh: make(chan struct{})})
+	p.session = session
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(p.sessionWatcher(ctx), check.ErrorMatches, "context canceled")
+	// the session closed by the exiting capture is not a loss
+	c.Assert(session.Close(), check.IsNil)
+	c.Assert(p.sessionWatcher(ctx), check.ErrorMatches, "context canceled")
+	c.Assert(p.isSessionDone(), check.IsFalse)
+
+	p.session = nil
+	c.Assert(p.sessionWatcher(context.Background()), check.IsNil)
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// maxStatisticsWindow is the longest window of the table statistics, the rows
+// and bytes are counted in per-minute buckets within it
+const maxStatisticsWindow = time.Hour
+
+const statisticsBuckets = int(maxStatisticsWindow / time.Minute)
+
+type statisticsBucket struct {
+	// minute is the unix minute of the bucket
+	minute int64
+	rows   uint64
+	bytes  uint64
+}
+
+// tableStatistics counts the rows and bytes of a table emitted to the sink
+type tableStatistics struct {
+	name       string
+	totalRows  uint64
+	totalBytes uint64
+	buckets    [statisticsBuckets]statisticsBucket
+}
+
+func (s *tableStatistics) add(rows, bytes uint64, now time.Time) {
+	s.totalRows += rows
+	s.totalBytes += bytes
+	minute := now.Unix() / 60
+	bucket := &s.buckets[minute%int64(statisticsBuckets)]
+	if bucket.minute != minute {
+		*bucket = statisticsBucket{minute: minute}
+	}
+	bucket.rows += rows
+	bucket.bytes += bytes
+}
+
+// sum sums up the buckets of the minutes in [from, to]
+func (s *tableStatistics) sum(from, to int64) (rows, bytes uint64) {
+	for _, bucket := range s.buckets {
+		if bucket.minute >= from && bucket.minute <= to {
+			rows += bucket.rows
+			bytes += bucket.bytes
+		}
+	}
+	return
+}
+
+// processorStatistics counts the rows and bytes of each table emitted to the
+// sink since the processor starts. The numbers of a table moved away are
+// kept until the processor stops, the capture which the table is moved to
+// counts the table from then on. The events and bytes pulled from each TiKV
+// store are counted as well, the rows of the store statistics are the events.
+type processorStatistics struct {
+	mu        sync.Mutex
+	startTime time.Time
+	tables    map[model.TableID]*tableStatistics
+	stores    map[uint64]*tableStatistics
+	// storeTotals are the totals of the stores at the last observation
+	storeTotals map[uint64]kv.StorePullTotal
+}
+
+func newProcessorStatistics(now time.Time) *processorStatistics {
+	return &processorStatistics{
+		startTime:   now,
+		tables:      make(map[model.TableID]*tableStatistics),
+		stores:      make(map[uint64]*tableStatistics),
+		storeTotals: make(map[uint64]kv.StorePullTotal),
+	}
+}
+
+// observe counts the rows of the events emitted to the sink except the rows
+// of the mark tables, it's no-op on a nil processorStatistics
+func (s *processorStatistics) observe(events []*model.PolymorphicEvent, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range events {
+		row := ev.Row
+		// the rows of the mark tables aren't replicated to the downstream
+		if row == nil || row.Table == nil || ev.MarkTable {
+			continue
+		}
+		table, ok := s.tables[row.Table.TableID]
+		if !ok {
+			table = &tableStatistics{name: row.Table.QuoteString()}
+			s.tables[row.Table.TableID] = table
+		}
+		table.add(1, uint64(row.ApproximateSize), now)
+	}
+}
+
+// observeStores counts the events and bytes pulled from the stores since the
+// last observation, the totals are read from the kv client. It's no-op on a
+// nil processorStatistics.
+func (s *processorStatistics) observeStores(totals map[uint64]kv.StorePullTotal, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for storeID, total := range totals {
+		last := s.storeTotals[storeID]
+		if total.Bytes < last.Bytes || total.Events < last.Events {
+			// the totals are reset, as the statistics of the kv client are
+			// dropped and counted again
+			last = kv.StorePullTotal{}
+		}
+		store, ok := s.stores[storeID]
+		if !ok {
+			store = &tableStatistics{}
+			s.stores[storeID] = store
+		}
+		store.add(total.Events-last.Events, total.Bytes-last.Bytes, now)
+		s.storeTotals[storeID] = total
+	}
+}
+
+// window returns the minutes of the buckets in the window before now, and the
+// time the window actually covers, see snapshot.
+func (s *processorStatistics) window(window time.Duration, now time.Time) (from, to int64, covered time.Duration) {
+	if window > maxStatisticsWindow {
+		window = maxStatisticsWindow
+	}
+	to = now.Unix() / 60
+	from = to - int64((window+time.Minute-1)/time.Minute) + 1
+	covered = now.Sub(time.Unix(from*60, 0))
+	if uptime := now.Sub(s.startTime); uptime < covered {
+		covered = uptime
+	}
+	return
+}
+
+// snapshot returns the statistics of the tables in the window before now,
+// sorted by the table IDs. The window is rounded up to whole minutes with the
+// current minute included, the returned duration is the time it actually
+// covers, which is bounded by the uptime of the processor.
+func (s *processorStatistics) snapshot(window time.Duration, now time.Time) ([]*TableStatistics, time.Duration) {
+	from, to, covered := s.window(window, now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tables := make([]*TableStatistics, 0, len(s.tables))
+	for id, table := range s.tables {
+		rows, bytes := table.sum(from, to)
+		tables = append(tables, &TableStatistics{
+			TableID:    id,
+			Table:      table.name,
+			Rows:       rows,
+			Bytes:      bytes,
+			TotalRows:  table.totalRows,
+			TotalBytes: table.totalBytes,
+		})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].TableID < tables[j].TableID
+	})
+	return tables, covered
+}
+
+// storeSnapshot returns the statistics of the stores in the window before now
+// like snapshot, sorted by the store IDs.
+func (s *processorStatistics) storeSnapshot(window time.Duration, now time.Time) []*StoreStatistics {
+	from, to, _ := s.window(window, now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stores := make([]*StoreStatistics, 0, len(s.stores))
+	for id, store := range s.stores {
+		events, bytes := store.sum(from, to)
+		stores = append(stores, &StoreStatistics{
+			StoreID:     id,
+			Events:      events,
+			Bytes:       bytes,
+			TotalEvents: store.totalRows,
+			TotalBytes:  store.totalBytes,
+		})
+	}
+	sort.Slice(stores, func(i, j int) bool {
+		return stores[i].StoreID < stores[j].StoreID
+	})
+	return stores
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorStatisticsSuite struct{}
+
+var _ = check.Suite(&processorStatisticsSuite{})
+
+func newStatisticsTestEvents(tableID model.TableID, count int, size int64) []*model.PolymorphicEvent {
+	events := make([]*model.PolymorphicEvent, 0, count+1)
+	for i := 0; i < count; i++ {
+		events = append(events, &model.PolymorphicEvent{Row: &model.RowChangedEvent{
+			Table:           &model.TableName{Schema: "test", Table: "t", TableID: tableID},
+			ApproximateSize: size,
+		}})
+	}
+	// the events without rows, e.g. filtered, are not counted
+	return append(events, &model.PolymorphicEvent{})
+}
+
+func (s *processorStatisticsSuite) TestScriptedStream(c *check.C) {
+	defer testleak.AfterTest(c)()
+	start := time.Unix(1600000000/60*60, 0)
+	stats := newProcessorStatistics(start)
+
+	// table 1 emits 10 rows of 100 bytes per minute for 90 minutes, table 2
+	// emits 1 row of 10 bytes in the 5th minute
+	for minute := 0; minute < 90; minute++ {
+		now := start.Add(time.Duration(minute)*time.Minute + 30*time.Second)
+		stats.observe(newStatisticsTestEvents(1, 10, 100), now)
+		if minute == 5 {
+			stats.observe(newStatisticsTestEvents(2, 1, 10), now)
+		}
+	}
+	now := start.Add(89*time.Minute + 30*time.Second)
+
+	tables, covered := stats.snapshot(10*time.Minute, now)
+	c.Assert(covered, check.Equals, 9*time.Minute+30*time.Second)
+	c.Assert(tables, check.DeepEquals, []*TableStatistics{
+		{TableID: 1, Table: "`test`.`t`", Rows: 100, Bytes: 10000, TotalRows: 900, TotalBytes: 90000},
+		{TableID: 2, Table: "`test`.`t`", Rows: 0, Bytes: 0, TotalRows: 1, TotalBytes: 10},
+	})
+
+	// the window is rounded up to minutes and bounded by an hour
+	tables, covered = stats.snapshot(90*time.Second, now)
+	c.Assert(covered, check.Equals, time.Minute+30*time.Second)
+	c.Assert(tables[0].Rows, check.Equals, uint64(20))
+	tables, covered = stats.snapshot(2*time.Hour, now)
+	c.Assert(covered, check.Equals, 59*time.Minute+30*time.Second)
+	c.Assert(tables[0].Rows, check.Equals, uint64(600))
+
+	// the window is bounded by the uptime of the processor
+	tables, covered = stats.snapshot(time.Hour, start.Add(5*time.Minute+30*time.Second))
+	c.Assert(covered, check.Equals, 5*time.Minute+30*time.Second)
+	c.Assert(tables[1].Rows, check.Equals, uint64(1))
+
+	// the buckets out of the window are not counted
+	tables, _ = stats.snapshot(time.Hour, now.Add(30*time.Minute))
+	c.Assert(tables[0].Rows, check.Equals, uint64(300))
+	c.Assert(tables[0].TotalRows, check.Equals, uint64(900))
+}
+
+func (s *processorStatisticsSuite) TestStoreStatistics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	start := time.Unix(1600000000/60*60, 0)
+	stats := newProcessorStatistics(start)
+
+	// store 1 serves 10 events of 1000 bytes per minute for 10 minutes, the
+	// region is moved to store 2 in the 8th minute
+	totals := map[uint64]kv.StorePullTotal{}
+	for minute := 0; minute < 10; minute++ {
+		storeID := uint64(1)
+		if minute >= 8 {
+			storeID = 2
+		}
+		total := totals[storeID]
+		total.Events += 10
+		total.Bytes += 1000
+		totals[storeID] = total
+		stats.observeStores(totals, start.Add(time.Duration(minute)*time.Minute+30*time.Second))
+	}
+	now := start.Add(9*time.Minute + 30*time.Second)
+	c.Assert(stats.storeSnapshot(5*time.Minute, now), check.DeepEquals, []*StoreStatistics{
+		{StoreID: 1, Events: 30, Bytes: 3000, TotalEvents: 80, TotalBytes: 8000},
+		{StoreID: 2, Events: 20, Bytes: 2000, TotalEvents: 20, TotalBytes: 2000},
+	})
+
+	// the totals of the kv client are reset
+	stats.observeStores(map[uint64]kv.StorePullTotal{2: {Events: 5, Bytes: 500}}, now)
+	stores := stats.storeSnapshot(time.Minute, now)
+	c.Assert(stores[1].Events, check.Equals, uint64(15))
+	c.Assert(stores[1].TotalBytes, check.Equals, uint64(2500))
+}
+
+func (s *processorStatisticsSuite) TestMarkTableRows(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Unix(1600000000/60*60, 0)
+	stats := newProcessorStatistics(now)
+	events := newStatisticsTestEvents(1, 5, 100)
+	// the rows of the mark table are emitted to the sink with the data rows
+	markEvents := newStatisticsTestEvents(60, 5, 10)
+	for _, ev := range markEvents {
+		ev.MarkTable = true
+	}
+	stats.observe(append(events, markEvents...), now)
+	tables, _ := stats.snapshot(time.Minute, now)
+	c.Assert(tables, check.DeepEquals, []*TableStatistics{
+		{TableID: 1, Table: "`test`.`t`", Rows: 5, Bytes: 500, TotalRows: 5, TotalBytes: 500},
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type processorStatusSuite struct{}
+
+var _ = check.Suite(&processorStatusSuite{})
+
+func (s *processorStatusSuite) TestTaskStatusWorker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	clientURL, e, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	defer e.Close()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	etcdCli := kv.NewCDCEtcdClient(ctx, client)
+	defer etcdCli.Close() //nolint:errcheck
+
+	p := newProcessorForTest()
+	p.etcdCli = etcdCli
+	p.taskStatusChangedCh = make(chan struct{}, 1)
+	status := &model.TaskStatus{Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 10}}}
+	c.Assert(etcdCli.PutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID, status), check.IsNil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.taskStatusWorker(ctx)
+	}()
+	expectNotified := func(notified bool) {
+		select {
+		case <-p.taskStatusChangedCh:
+			c.Assert(notified, check.IsTrue)
+		case <-time.After(500 * time.Millisecond):
+			c.Assert(notified, check.IsFalse)
+		}
+	}
+	// the worker notifies once it starts watching
+	expectNotified(true)
+
+	// the operations written by the owner are notified
+	status.Tables[2] = &model.TableReplicaInfo{StartTs: 20}
+	status.Operation = map[model.TableID]*model.TableOperation{2: {BoundaryTs: 20}}
+	c.Assert(etcdCli.PutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID, status), check.IsNil)
+	expectNotified(true)
+
+	// the changes written by the processor itself are skipped
+	resp, err := client.Get(ctx, "/")
+	c.Assert(err, check.IsNil)
+	atomic.StoreInt64(&p.statusModRevision, resp.Header.Revision+1)
+	status.Operation[2].Status = model.OperProcessed
+	c.Assert(etcdCli.PutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID, status), check.IsNil)
+	expectNotified(false)
+
+	cancel()
+	c.Assert(errors.Cause(<-done), check.Equals, context.Canceled)
+}
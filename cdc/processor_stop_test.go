@@ -0,0 +1,170 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/kv"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/etcd"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type processorStopSuite struct{}
+
+var _ = check.Suite(&processorStopSuite{})
+
+// stopTestSink blocks Close until closeCh is closed
+type stopTestSink struct {
+	sink.Sink
+	flushedTs  uint64
+	closeCount int32
+	closeCh    chan struct{}
+}
+
+func (s *stopTestSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	atomic.StoreUint64(&s.flushedTs, resolvedTs)
+	return model.FlushResult{CheckpointTs: resolvedTs}, nil
+}
+
+func (s *stopTestSink) Close() error {
+	atomic.AddInt32(&s.closeCount, 1)
+	<-s.closeCh
+	return nil
+}
+
+// newStopTestProcessor returns a processor with one table, whose context is
+// returned to check whether the table is canceled
+func newStopTestProcessor(c *check.C, etcdCli kv.CDCEtcdClient, s sink.Sink) (*processor, context.Context) {
+	ctx := context.Background()
+	p := newProcessorForTest()
+	p.etcdCli = etcdCli
+	p.sink = s
+	p.sinkEmittedResolvedTs = 110
+	p.globalResolvedTs = 120
+	p.checkpointTs = 100
+	p.ddlPullerCancel = func() {}
+	tableCtx, tableCancel := context.WithCancel(ctx)
+	p.tables[1] = &tableInfo{id: 1, cancel: tableCancel}
+
+	c.Assert(etcdCli.PutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID, &model.TaskStatus{}), check.IsNil)
+	_, err := etcdCli.PutTaskPositionOnChange(ctx, p.changefeedID, p.captureInfo.ID, &model.TaskPosition{CheckPointTs: 100})
+	c.Assert(err, check.IsNil)
+	c.Assert(etcdCli.PutTaskWorkload(ctx, p.changefeedID, p.captureInfo.ID, &model.TaskWorkload{}), check.IsNil)
+	return p, tableCtx
+}
+
+func assertTaskKeysDeleted(c *check.C, etcdCli kv.CDCEtcdClient) {
+	resp, err := etcdCli.Client.Get(context.Background(), etcdCli.TaskKeyPrefix(), clientv3.WithPrefix())
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Kvs, check.HasLen, 0)
+}
+
+func setUpStopTestEtcd(c *check.C) (kv.CDCEtcdClient, func()) {
+	clientURL, e, err := etcd.SetupEmbedEtcd(c.MkDir())
+	c.Assert(err, check.IsNil)
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 3 * time.Second,
+	})
+	c.Assert(err, check.IsNil)
+	etcdCli := kv.NewCDCEtcdClient(context.Background(), client)
+	return etcdCli, func() {
+		etcdCli.Close() //nolint:errcheck
+		e.Close()
+	}
+}
+
+func (s *processorStopSuite) TestStopTwice(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+
+	testSink := &stopTestSink{closeCh: make(chan struct{})}
+	close(testSink.closeCh)
+	p, tableCtx := newStopTestProcessor(c, etcdCli, testSink)
+	c.Assert(p.stop(ctx), check.IsNil)
+	c.Assert(p.isStopped(), check.IsTrue)
+	c.Assert(tableCtx.Err(), check.Equals, context.Canceled)
+	c.Assert(p.dirtyStop, check.IsNil)
+	// the emitted events are flushed before the sink is closed
+	c.Assert(atomic.LoadUint64(&testSink.flushedTs), check.Equals, uint64(110))
+	c.Assert(atomic.LoadInt32(&testSink.closeCount), check.Equals, int32(1))
+	assertTaskKeysDeleted(c, etcdCli)
+
+	// the keys written again, e.g. by a stale flush, are deleted by the second call
+	c.Assert(etcdCli.PutTaskStatus(ctx, p.changefeedID, p.captureInfo.ID, &model.TaskStatus{}), check.IsNil)
+	c.Assert(p.stop(ctx), check.IsNil)
+	c.Assert(atomic.LoadInt32(&testSink.closeCount), check.Equals, int32(1))
+	assertTaskKeysDeleted(c, etcdCli)
+	stops, err := etcdCli.GetDirtyStops(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 0)
+}
+
+func (s *processorStopSuite) TestStopSinkCloseTimeout(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+	originalTimeout := sinkCloseTimeout
+	sinkCloseTimeout = 100 * time.Millisecond
+	defer func() {
+		sinkCloseTimeout = originalTimeout
+	}()
+
+	testSink := &stopTestSink{closeCh: make(chan struct{})}
+	defer close(testSink.closeCh)
+	p, _ := newStopTestProcessor(c, etcdCli, testSink)
+	c.Assert(p.stop(ctx), check.IsNil)
+	// the keys are deleted even if the sink is not closed
+	assertTaskKeysDeleted(c, etcdCli)
+	c.Assert(p.dirtyStop, check.NotNil)
+	stops, err := etcdCli.GetDirtyStops(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 1)
+	stop := stops[p.captureInfo.ID]
+	c.Assert(stop.CaptureID, check.Equals, p.captureInfo.ID)
+	c.Assert(stop.CheckpointTs, check.Equals, uint64(100))
+	c.Assert(stop.Reason, check.Matches, ".*not flushed and closed in 100ms.*")
+
+	// the sink is not closed again by the second call
+	c.Assert(p.stop(ctx), check.IsNil)
+	c.Assert(atomic.LoadInt32(&testSink.closeCount), check.Equals, int32(1))
+	assertTaskKeysDeleted(c, etcdCli)
+
+	// the owner merges the dirty stop into the changefeed status
+	o := &Owner{etcdClient: etcdCli, cfRWriter: etcdCli}
+	cf := &changeFeed{id: p.changefeedID, status: &model.ChangeFeedStatus{CheckpointTs: 100}}
+	c.Assert(o.mergeDirtyStops(ctx, cf), check.IsNil)
+	c.Assert(cf.status.DirtyStops, check.HasLen, 1)
+	c.Assert(cf.status.DirtyStops[0].CaptureID, check.Equals, p.captureInfo.ID)
+	status, _, err := etcdCli.GetChangeFeedStatus(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.DirtyStops, check.HasLen, 1)
+	c.Assert(status.DirtyStops[0].CheckpointTs, check.Equals, uint64(100))
+	stops, err = etcdCli.GetDirtyStops(ctx, p.changefeedID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stops, check.HasLen, 0)
+	// the merged dirty stops are not merged again
+	c.Assert(o.mergeDirtyStops(ctx, cf), check.IsNil)
+	c.Assert(cf.status.DirtyStops, check.HasLen, 1)
+}
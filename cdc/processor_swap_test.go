@@ -0,0 +1,53 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type processorSwapSuite struct{}
+
+var _ = check.Suite(&processorSwapSuite{})
+
+func (s *processorSwapSuite) TestRemoveTruncatedTableAfterSwap(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the new table is not started, as its downstream schema is incompatible
+	checkSink := &schemaCheckTestSink{
+		err: cerror.ErrTableSchemaIncompatible.GenWithStackByArgs("`test`.`orders`", "the table doesn't exist in the downstream"),
+	}
+	p := newSchemaCheckTestProcessor(c, config.SchemaCheckStrict, checkSink)
+	p.position = &model.TaskPosition{CheckPointTs: 120, ResolvedTs: 120}
+	status := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{2: {StartTs: 120}},
+		Operation: map[model.TableID]*model.TableOperation{
+			5: {Delete: true, BoundaryTs: 120},
+			2: {BoundaryTs: 120, SwapTableID: 5},
+		},
+	}
+
+	// the truncated table is kept until the new table is processed
+	handleTablesUntilChecked(c, p, 2, status)
+	c.Assert(status.Operation[5].TableProcessed(), check.IsFalse)
+
+	_, err := p.handleTables(context.Background(), status)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Operation[5].TableApplied(), check.IsTrue)
+}
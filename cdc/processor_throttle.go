@@ -0,0 +1,104 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util"
+)
+
+type throttleWindow struct {
+	// start and end are the minutes since the midnight
+	start int
+	end   int
+	// days are the weekdays the window starts on, nil means every day
+	days            map[time.Weekday]struct{}
+	eventsPerSecond int
+}
+
+func (w *throttleWindow) startsOn(day time.Weekday) bool {
+	if w.days == nil {
+		return true
+	}
+	_, ok := w.days[day]
+	return ok
+}
+
+// contains returns true if the time of the day, which is on the day, is in
+// the window. The window wrapping to the next day contains the time before
+// its end if it starts on the previous day.
+func (w *throttleWindow) contains(day time.Weekday, minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end && w.startsOn(day)
+	}
+	return (minute >= w.start && w.startsOn(day)) ||
+		(minute < w.end && w.startsOn((day+6)%7))
+}
+
+// throttleSchedule is the parsed throttle schedule config of a changefeed.
+type throttleSchedule struct {
+	location   *time.Location
+	transition time.Duration
+	windows    []throttleWindow
+}
+
+func newThrottleSchedule(cfg *config.ThrottleScheduleConfig) (*throttleSchedule, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	location, err := util.GetTimezone(cfg.TimeZone)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &throttleSchedule{
+		location:   location,
+		transition: time.Duration(cfg.TransitionSeconds) * time.Second,
+		windows:    make([]throttleWindow, 0, len(cfg.Windows)),
+	}
+	for _, w := range cfg.Windows {
+		// the config is validated, so the errors are impossible
+		start, _ := config.ParseClock(w.Start)
+		end, _ := config.ParseClock(w.End)
+		window := throttleWindow{start: start, end: end, eventsPerSecond: w.EventsPerSecond}
+		if len(w.Days) != 0 {
+			window.days = make(map[time.Weekday]struct{}, len(w.Days))
+			for _, day := range w.Days {
+				weekday, _ := config.ParseWeekday(day)
+				window.days[weekday] = struct{}{}
+			}
+		}
+		s.windows = append(s.windows, window)
+	}
+	return s, nil
+}
+
+// eventsPerSecond returns the events per second limit at now, which is the
+// limit of the first window containing now, or the limit of the budget if
+// now is out of the windows. 0 means unlimited.
+func (s *throttleSchedule) eventsPerSecond(now time.Time, budget int) int {
+	if s == nil {
+		return budget
+	}
+	local := now.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	for i := range s.windows {
+		if s.windows[i].contains(local.Weekday(), minute) {
+			return s.windows[i].eventsPerSecond
+		}
+	}
+	return budget
+}
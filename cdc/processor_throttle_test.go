@@ -0,0 +1,184 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+type processorThrottleSuite struct{}
+
+var _ = check.Suite(&processorThrottleSuite{})
+
+func (s *processorThrottleSuite) TestScheduleWindows(c *check.C) {
+	defer testleak.AfterTest(c)()
+	schedule, err := newThrottleSchedule(&config.ThrottleScheduleConfig{
+		TimeZone: "Asia/Shanghai",
+		Windows: []*config.ThrottleWindow{
+			{Start: "22:00", End: "02:00", Days: []string{"Sat"}, EventsPerSecond: 5},
+			{Start: "00:00", End: "07:00", EventsPerSecond: 0},
+			{Start: "12:00", End: "13:00", Days: []string{"mon", "tue"}, EventsPerSecond: 100},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	c.Assert(err, check.IsNil)
+	// 2021-06-05 is a Saturday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, 6, day, hour, minute, 0, 0, shanghai)
+	}
+	testCases := []struct {
+		now      time.Time
+		expected int
+	}{
+		{at(7, 3, 0), 0},
+		{at(7, 7, 0), 20000},
+		{at(7, 12, 30), 100},
+		{at(9, 12, 30), 20000},
+		{at(5, 21, 59), 20000},
+		{at(5, 22, 0), 5},
+		// the window starting on Saturday wraps to Sunday, and it's checked
+		// before the nightly window
+		{at(6, 1, 59), 5},
+		{at(6, 2, 0), 0},
+		{at(7, 1, 0), 0},
+		// the windows are evaluated in the time zone of the schedule
+		{at(7, 3, 0).UTC(), 0},
+		{at(7, 12, 30).UTC(), 100},
+	}
+	for _, tc := range testCases {
+		c.Assert(schedule.eventsPerSecond(tc.now, 20000), check.Equals, tc.expected, check.Commentf("%s", tc.now))
+	}
+
+	// the nil schedule always applies the budget
+	var nilSchedule *throttleSchedule
+	c.Assert(nilSchedule.eventsPerSecond(at(7, 3, 0), 20000), check.Equals, 20000)
+
+	for _, cfg := range []*config.ThrottleScheduleConfig{
+		{TimeZone: "Mars/Olympus"},
+		{TransitionSeconds: -1},
+		{Windows: []*config.ThrottleWindow{{Start: "7:00", End: "08:00"}}},
+		{Windows: []*config.ThrottleWindow{{Start: "07:00", End: "24:01"}}},
+		{Windows: []*config.ThrottleWindow{{Start: "07:00", End: "08:00", Days: []string{"monday"}}}},
+		{Windows: []*config.ThrottleWindow{{Start: "07:00", End: "08:00", EventsPerSecond: -1}}},
+	} {
+		_, err := newThrottleSchedule(cfg)
+		c.Assert(cerror.ErrInvalidThrottleConfig.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	}
+}
+
+func (s *processorThrottleSuite) TestScheduleTransition(c *check.C) {
+	defer testleak.AfterTest(c)()
+	b := newChangefeedBudget("test-changefeed", "127.0.0.1:8300", &config.BudgetConfig{EventsPerSecond: 20000})
+	defer b.deleteMetrics()
+	limitGauge := throttleLimitGauge.WithLabelValues("test-changefeed", "127.0.0.1:8300")
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(20000))
+
+	now := time.Date(2021, 6, 7, 6, 59, 30, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	c.Assert(b.updateSchedule(&config.ThrottleScheduleConfig{
+		TimeZone:          "UTC",
+		TransitionSeconds: 60,
+		Windows:           []*config.ThrottleWindow{{Start: "00:00", End: "07:00"}},
+	}), check.IsNil)
+	// the limit is lifted at once in the window
+	c.Assert(b.events.Limit(), check.Equals, rate.Inf)
+	c.Assert(testutil.ToFloat64(limitGauge), check.Equals, float64(0))
+
+	// the changefeed catches up at 100000 events per second at night
+	b.lastObserved = now
+	b.consumed = 1500000
+	b.observe(now.Add(15 * time.Second))
+	c.Assert(b.eventsRate, check.Equals, float64(100000))
+	c.Assert(b.events.Limit(), check.Equals, rate.Inf)
+
+	// the limit moves from the measured rate to the budget since 07:00
+	now = time.Date(2021, 6, 7, 7, 0, 0, 0, time.UTC)
+	b.consumed = 1500000
+	b.observe(now)
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(100000))
+	b.observe(now.Add(30 * time.Second))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(60000))
+	c.Assert(b.events.Burst(), check.Equals, 60000)
+	c.Assert(testutil.ToFloat64(limitGauge), check.Equals, float64(60000))
+	b.observe(now.Add(time.Minute))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(20000))
+	b.observe(now.Add(2 * time.Minute))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(20000))
+	c.Assert(testutil.ToFloat64(limitGauge), check.Equals, float64(20000))
+
+	// the reloaded schedule moves the limit from the current one
+	now = now.Add(2 * time.Minute)
+	c.Assert(b.updateSchedule(&config.ThrottleScheduleConfig{
+		TimeZone:          "UTC",
+		TransitionSeconds: 60,
+		Windows: []*config.ThrottleWindow{
+			{Start: "00:00", End: "07:00"},
+			{Start: "07:00", End: "08:00", EventsPerSecond: 10000},
+		},
+	}), check.IsNil)
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(20000))
+	b.observe(now.Add(15 * time.Second))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(17500))
+	b.observe(now.Add(time.Minute))
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(10000))
+
+	// the invalid schedule is not applied
+	err := b.updateSchedule(&config.ThrottleScheduleConfig{TimeZone: "Mars/Olympus"})
+	c.Assert(cerror.ErrInvalidThrottleConfig.Equal(err), check.IsTrue)
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(10000))
+
+	// the budget applies at once without the schedule
+	c.Assert(b.updateSchedule(nil), check.IsNil)
+	c.Assert(b.events.Limit(), check.Equals, rate.Limit(20000))
+}
+
+func (s *processorThrottleSuite) TestApplySchedule(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Budget.EventsPerSecond = 100
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	p.budget = newChangefeedBudget(p.changefeedID, p.captureInfo.AdvertiseAddr, cfg.Budget)
+	p.budgetConfig = cfg.Budget
+	p.throttle = cfg.ThrottleSchedule
+	defer p.budget.deleteMetrics()
+	c.Assert(p.budget.events.Limit(), check.Equals, rate.Limit(100))
+
+	// the window covering the whole day lifts the limit
+	info := &model.ChangeFeedInfo{Config: cfg.Clone()}
+	info.Config.ThrottleSchedule.Windows = []*config.ThrottleWindow{{Start: "00:00", End: "24:00"}}
+	raw, err := info.Marshal()
+	c.Assert(err, check.IsNil)
+	p.applyBudget(ctx, []byte(raw))
+	c.Assert(p.throttle, check.DeepEquals, info.Config.ThrottleSchedule)
+	c.Assert(p.budget.events.Limit(), check.Equals, rate.Inf)
+
+	// the invalid schedule is recorded, but the old one is kept
+	info.Config.ThrottleSchedule.TimeZone = "Mars/Olympus"
+	raw, err = info.Marshal()
+	c.Assert(err, check.IsNil)
+	p.applyBudget(ctx, []byte(raw))
+	c.Assert(p.throttle.TimeZone, check.Equals, "Mars/Olympus")
+	c.Assert(p.budget.events.Limit(), check.Equals, rate.Inf)
+}
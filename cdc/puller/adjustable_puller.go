@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// the interval to advance the resolved ts when the bound ts is advanced
+const adjustablePullerTickInterval = 100 * time.Millisecond
+
+// AdjustablePuller is a Puller that more spans can be added to after it's
+// started. The spans added are pulled by a new puller from the given ts, and
+// the outputs of all the pullers are merged, the resolved ts is the minimum
+// one of them.
+type AdjustablePuller struct {
+	newPuller func(startTs uint64, spans []regionspan.Span) Puller
+	boundTs   func() uint64
+	outputCh  chan *model.RawKVEntry
+	notify    chan struct{}
+
+	mu         sync.Mutex
+	spans      []regionspan.Span
+	children   []*adjustedPuller
+	resolvedTs uint64
+}
+
+type adjustedPuller struct {
+	Puller
+	// resolvedTs is the last resolved ts output by the puller, it's accessed
+	// atomically.
+	resolvedTs uint64
+}
+
+// NewAdjustablePuller creates an AdjustablePuller pulling the spans from
+// startTs. The resolved ts output doesn't exceed boundTs if it's not nil, so
+// that the spans needed after it can be added before the events after it is
+// output.
+func NewAdjustablePuller(
+	newPuller func(startTs uint64, spans []regionspan.Span) Puller,
+	startTs uint64,
+	spans []regionspan.Span,
+	boundTs func() uint64,
+) *AdjustablePuller {
+	p := &AdjustablePuller{
+		newPuller:  newPuller,
+		boundTs:    boundTs,
+		outputCh:   make(chan *model.RawKVEntry, defaultPullerOutputChanSize),
+		notify:     make(chan struct{}, 1),
+		resolvedTs: startTs,
+	}
+	p.AddSpans(startTs, spans)
+	return p
+}
+
+// AddSpans pulls the spans from startTs, the events before the resolved ts
+// output are lost if startTs is less than it.
+func (p *AdjustablePuller) AddSpans(startTs uint64, spans []regionspan.Span) {
+	if len(spans) == 0 {
+		return
+	}
+	p.mu.Lock()
+	if startTs < p.resolvedTs {
+		log.Warn("the spans are added before the resolved ts of the puller",
+			zap.Uint64("startTs", startTs), zap.Uint64("resolvedTs", p.resolvedTs))
+		startTs = p.resolvedTs
+	}
+	p.spans = append(p.spans, spans...)
+	p.children = append(p.children, &adjustedPuller{
+		Puller:     p.newPuller(startTs, spans),
+		resolvedTs: startTs,
+	})
+	p.mu.Unlock()
+	p.wakeUp()
+}
+
+// Spans returns all the spans pulled
+func (p *AdjustablePuller) Spans() []regionspan.Span {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]regionspan.Span{}, p.spans...)
+}
+
+func (p *AdjustablePuller) wakeUp() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the pullers of the spans, including the ones added after it's
+// started.
+func (p *AdjustablePuller) Run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		ticker := time.NewTicker(adjustablePullerTickInterval)
+		defer ticker.Stop()
+		started := 0
+		for {
+			p.mu.Lock()
+			children := p.children[started:]
+			started = len(p.children)
+			p.mu.Unlock()
+			for _, child := range children {
+				child := child
+				g.Go(func() error {
+					return child.Run(ctx)
+				})
+				g.Go(func() error {
+					return p.forward(ctx, child)
+				})
+			}
+			if err := p.advance(ctx); err != nil {
+				return errors.Trace(err)
+			}
+			select {
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			case <-p.notify:
+			case <-ticker.C:
+			}
+		}
+	})
+	return g.Wait()
+}
+
+// forward outputs the kv events of the child, and records its resolved ts.
+// The kv events are output before the resolved ts after them is recorded, so
+// they're output before the resolved event.
+func (p *AdjustablePuller) forward(ctx context.Context, child *adjustedPuller) error {
+	for {
+		var raw *model.RawKVEntry
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case raw = <-child.Output():
+		}
+		if raw.OpType == model.OpTypeResolved {
+			atomic.StoreUint64(&child.resolvedTs, raw.CRTs)
+			p.wakeUp()
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case p.outputCh <- raw:
+		}
+	}
+}
+
+// advance outputs the minimum resolved ts of the children if it's advanced
+func (p *AdjustablePuller) advance(ctx context.Context) error {
+	p.mu.Lock()
+	resolvedTs := uint64(0)
+	for i, child := range p.children {
+		ts := atomic.LoadUint64(&child.resolvedTs)
+		if i == 0 || ts < resolvedTs {
+			resolvedTs = ts
+		}
+	}
+	if p.boundTs != nil {
+		if bound := p.boundTs(); bound < resolvedTs {
+			resolvedTs = bound
+		}
+	}
+	if resolvedTs <= p.resolvedTs {
+		p.mu.Unlock()
+		return nil
+	}
+	atomic.StoreUint64(&p.resolvedTs, resolvedTs)
+	p.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case p.outputCh <- &model.RawKVEntry{CRTs: resolvedTs, OpType: model.OpTypeResolved}:
+	}
+	log.Debug("adjustable puller is resolved", append(util.ZapFieldsFromCtx(ctx), zap.Uint64("resolvedTs", resolvedTs))...)
+	return nil
+}
+
+// Output implements Puller.Output
+func (p *AdjustablePuller) Output() <-chan *model.RawKVEntry {
+	return p.outputCh
+}
+
+// GetResolvedTs implements Puller.GetResolvedTs
+func (p *AdjustablePuller) GetResolvedTs() uint64 {
+	return atomic.LoadUint64(&p.resolvedTs)
+}
+
+// IsInitialized implements Puller.IsInitialized, it returns true if all the
+// pullers are initialized.
+func (p *AdjustablePuller) IsInitialized() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, child := range p.children {
+		if !child.IsInitialized() {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanProgress implements Puller.ScanProgress, it returns the sum of the
+// progresses of all the pullers.
+func (p *AdjustablePuller) ScanProgress() model.IncrementalScanProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var progress model.IncrementalScanProgress
+	for _, child := range p.children {
+		progress.Add(child.ScanProgress())
+	}
+	return progress
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type adjustablePullerSuite struct{}
+
+var _ = check.Suite(&adjustablePullerSuite{})
+
+// chanPuller outputs the events sent to its channel
+type chanPuller struct {
+	startTs  uint64
+	spans    []regionspan.Span
+	outputCh chan *model.RawKVEntry
+}
+
+func (p *chanPuller) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p *chanPuller) GetResolvedTs() uint64            { return 0 }
+func (p *chanPuller) Output() <-chan *model.RawKVEntry { return p.outputCh }
+func (p *chanPuller) IsInitialized() bool              { return true }
+func (p *chanPuller) ScanProgress() model.IncrementalScanProgress {
+	return model.IncrementalScanProgress{}
+}
+
+func (p *chanPuller) put(ts uint64) {
+	p.outputCh <- &model.RawKVEntry{OpType: model.OpTypePut, Key: []byte("k"), CRTs: ts}
+}
+
+func (p *chanPuller) resolve(ts uint64) {
+	p.outputCh <- &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: ts}
+}
+
+func newTestAdjustablePuller(startTs uint64, boundTs func() uint64) (*AdjustablePuller, func() []*chanPuller) {
+	var mu sync.Mutex
+	var pullers []*chanPuller
+	newPuller := func(startTs uint64, spans []regionspan.Span) Puller {
+		mu.Lock()
+		defer mu.Unlock()
+		p := &chanPuller{startTs: startTs, spans: spans, outputCh: make(chan *model.RawKVEntry, 16)}
+		pullers = append(pullers, p)
+		return p
+	}
+	plr := NewAdjustablePuller(newPuller, startTs, []regionspan.Span{regionspan.GetTableSpan(1, true)}, boundTs)
+	return plr, func() []*chanPuller {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*chanPuller{}, pullers...)
+	}
+}
+
+func (s *adjustablePullerSuite) TestAddSpans(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	plr, pullers := newTestAdjustablePuller(10, nil)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = plr.Run(ctx)
+	}()
+	first := pullers()[0]
+	first.put(11)
+	first.resolve(20)
+	c.Assert((<-plr.Output()).CRTs, check.Equals, uint64(11))
+	resolved := <-plr.Output()
+	c.Assert(resolved.OpType, check.Equals, model.OpTypeResolved)
+	c.Assert(resolved.CRTs, check.Equals, uint64(20))
+
+	// the resolved ts is held by the puller of the spans added
+	indexSpan := regionspan.GetTableIndexSpan(1, 2)
+	plr.AddSpans(25, []regionspan.Span{indexSpan})
+	c.Assert(plr.Spans(), check.DeepEquals, []regionspan.Span{regionspan.GetTableSpan(1, true), indexSpan})
+	second := pullers()[1]
+	c.Assert(second.startTs, check.Equals, uint64(25))
+	c.Assert(second.spans, check.DeepEquals, []regionspan.Span{indexSpan})
+	first.resolve(40)
+	resolved = <-plr.Output()
+	c.Assert(resolved.OpType, check.Equals, model.OpTypeResolved)
+	c.Assert(resolved.CRTs, check.Equals, uint64(25))
+	second.put(30)
+	c.Assert((<-plr.Output()).CRTs, check.Equals, uint64(30))
+	second.resolve(50)
+	resolved = <-plr.Output()
+	c.Assert(resolved.CRTs, check.Equals, uint64(40))
+	c.Assert(plr.GetResolvedTs(), check.Equals, uint64(40))
+
+	// the spans can't be pulled before the resolved ts output
+	plr.AddSpans(30, []regionspan.Span{regionspan.GetTableIndexSpan(1, 3)})
+	c.Assert(pullers()[2].startTs, check.Equals, uint64(40))
+}
+
+func (s *adjustablePullerSuite) TestBoundTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	boundTs := uint64(15)
+	plr, pullers := newTestAdjustablePuller(10, func() uint64 {
+		return atomic.LoadUint64(&boundTs)
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = plr.Run(ctx)
+	}()
+	first := pullers()[0]
+	first.resolve(20)
+	c.Assert((<-plr.Output()).CRTs, check.Equals, uint64(15))
+
+	// the resolved ts is advanced after the bound ts is advanced
+	atomic.StoreUint64(&boundTs, 30)
+	select {
+	case resolved := <-plr.Output():
+		c.Assert(resolved.CRTs, check.Equals, uint64(20))
+	case <-time.After(10 * adjustablePullerTickInterval):
+		c.Fatal("the resolved ts is not advanced")
+	}
+}
@@ -20,9 +20,9 @@ import (
 	"unsafe"
 
 	"github.com/edwingeng/deque"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
-	cerror "github.com/pingcap/ticdc/pkg/errors"
 )
 
 const (
@@ -92,14 +92,17 @@ func makeMemBuffer(limitter *BlurResourceLimitter) *memBuffer {
 	}
 }
 
-// AddEntry implements EventBuffer interface.
+// AddEntry implements EventBuffer interface. The kv entries are blocked until
+// the used resource is under the budget, while the resolved entries are added
+// anyway, otherwise the resolved ts can't advance once the budget is used up.
 func (b *memBuffer) AddEntry(ctx context.Context, entry model.RegionFeedEvent) error {
-	b.mu.Lock()
-	if b.limitter != nil && b.limitter.OverBucget() {
-		b.mu.Unlock()
-		return cerror.ErrBufferReachLimit.GenWithStackByArgs()
+	if b.limitter != nil && entry.Val != nil {
+		if err := b.limitter.Wait(ctx); err != nil {
+			return err
+		}
 	}
 
+	b.mu.Lock()
 	b.mu.entries.PushBack(entry)
 	if b.limitter != nil {
 		b.limitter.Add(int64(entrySize(entry)))
@@ -168,21 +171,88 @@ func entrySize(e model.RegionFeedEvent) int {
 type BlurResourceLimitter struct {
 	budget int64
 	used   int64
+
+	// waiting is the number of the goroutines waiting for the resource
+	waiting int32
+	mu      sync.Mutex
+	// released is closed to wake up the waiting goroutines when the resource
+	// is released or the budget is increased
+	released chan struct{}
 }
 
 // NewBlurResourceLimmter create a BlurResourceLimitter.
 func NewBlurResourceLimmter(budget int64) *BlurResourceLimitter {
 	return &BlurResourceLimitter{
-		budget: budget,
+		budget:   budget,
+		released: make(chan struct{}),
 	}
 }
 
 // Add used resource into limmter
 func (rl *BlurResourceLimitter) Add(n int64) {
 	atomic.AddInt64(&rl.used, n)
+	if n < 0 {
+		rl.wakeUp()
+	}
 }
 
 // OverBucget retun true if over budget.
 func (rl *BlurResourceLimitter) OverBucget() bool {
 	return atomic.LoadInt64(&rl.used) >= atomic.LoadInt64(&rl.budget)
 }
+
+// SetBudget changes the budget of the limitter.
+func (rl *BlurResourceLimitter) SetBudget(budget int64) {
+	if old := atomic.SwapInt64(&rl.budget, budget); budget > old {
+		rl.wakeUp()
+	}
+}
+
+// Budget returns the budget of the limitter.
+func (rl *BlurResourceLimitter) Budget() int64 {
+	return atomic.LoadInt64(&rl.budget)
+}
+
+// Used returns the used resource.
+func (rl *BlurResourceLimitter) Used() int64 {
+	return atomic.LoadInt64(&rl.used)
+}
+
+// Waiting returns true if any goroutine is waiting for the resource.
+func (rl *BlurResourceLimitter) Waiting() bool {
+	return atomic.LoadInt32(&rl.waiting) > 0
+}
+
+// Wait blocks until the used resource is under the budget.
+func (rl *BlurResourceLimitter) Wait(ctx context.Context) error {
+	if !rl.OverBucget() {
+		return nil
+	}
+	atomic.AddInt32(&rl.waiting, 1)
+	defer atomic.AddInt32(&rl.waiting, -1)
+	for {
+		// the channel is loaded before the resource is checked, so the
+		// release after the check closes it
+		rl.mu.Lock()
+		released := rl.released
+		rl.mu.Unlock()
+		if !rl.OverBucget() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-released:
+		}
+	}
+}
+
+func (rl *BlurResourceLimitter) wakeUp() {
+	if atomic.LoadInt32(&rl.waiting) == 0 {
+		return
+	}
+	rl.mu.Lock()
+	close(rl.released)
+	rl.released = make(chan struct{})
+	rl.mu.Unlock()
+}
@@ -19,8 +19,8 @@ import (
 	"time"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/ticdc/cdc/model"
-	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/regionspan"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 )
@@ -110,7 +110,9 @@ func (bs *memBufferSuite) TestMemBuffer(c *check.C) {
 				Value: make([]byte, 1024),
 			},
 		}
-		err = bf.AddEntry(context.Background(), entry)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err = bf.AddEntry(ctx, entry)
+		cancel()
 		if err != nil {
 			break
 		}
@@ -118,12 +120,31 @@ func (bs *memBufferSuite) TestMemBuffer(c *check.C) {
 		entries = append(entries, entry)
 	}
 
-	c.Assert(cerror.ErrBufferReachLimit.Equal(err), check.IsTrue)
+	// the kv entries are blocked once the budget is used up
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
 	num := float64(bf.mu.entries.Len())
 	nearNum := 1024.0
 	c.Assert(num >= nearNum*0.9, check.IsTrue)
 	c.Assert(num <= nearNum*1.1, check.IsTrue)
 
+	// the resolved entries are not blocked
+	resolved := model.RegionFeedEvent{Resolved: &model.ResolvedSpan{ResolvedTs: 1}}
+	c.Assert(bf.AddEntry(context.Background(), resolved), check.IsNil)
+	entries = append(entries, resolved)
+
+	// the blocked kv entry is added after the entries are got
+	blocked := model.RegionFeedEvent{Val: &model.RawKVEntry{Value: make([]byte, 1024)}}
+	added := make(chan error, 1)
+	go func() {
+		added <- bf.AddEntry(context.Background(), blocked)
+	}()
+	select {
+	case <-added:
+		c.Fatal("the kv entry is added over the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+	entries = append(entries, blocked)
+
 	// Check can get back the entries.
 	var getEntries []model.RegionFeedEvent
 	for len(getEntries) < len(entries) {
@@ -131,5 +152,27 @@ func (bs *memBufferSuite) TestMemBuffer(c *check.C) {
 		c.Assert(err, check.IsNil)
 		getEntries = append(getEntries, entry)
 	}
+	c.Assert(<-added, check.IsNil)
 	c.Assert(getEntries, check.DeepEquals, entries)
 }
+
+func (bs *memBufferSuite) TestSetBudget(c *check.C) {
+	defer testleak.AfterTest(c)()
+	limitter := NewBlurResourceLimmter(100)
+	limitter.Add(100)
+	c.Assert(limitter.OverBucget(), check.IsTrue)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limitter.Wait(context.Background())
+	}()
+	for !limitter.Waiting() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the waiting goroutine is woken up once the budget is increased
+	limitter.SetBudget(200)
+	c.Assert(<-done, check.IsNil)
+	c.Assert(limitter.Waiting(), check.IsFalse)
+	c.Assert(limitter.Budget(), check.Equals, int64(200))
+	c.Assert(limitter.Used(), check.Equals, int64(100))
+}
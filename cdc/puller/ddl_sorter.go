@@ -0,0 +1,270 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ddlSortRun is a sorted run of the unresolved entries spilled to a file
+type ddlSortRun struct {
+	path    string
+	file    *os.File
+	rd      *bufio.Reader
+	readBuf *bytes.Reader
+	// head is the next entry of the run, nil means the run is exhausted
+	head *model.PolymorphicEvent
+}
+
+func (r *ddlSortRun) next() error {
+	ev, err := readPolymorphicEvent(r.rd, r.readBuf)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.head = ev
+	return nil
+}
+
+func (r *ddlSortRun) close() {
+	if err := r.file.Close(); err != nil {
+		log.Warn("failed to close the spilled ddl entries", zap.String("file", r.path), zap.Error(err))
+	}
+	if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		log.Warn("failed to remove the spilled ddl entries", zap.String("file", r.path), zap.Error(err))
+	}
+}
+
+// ddlSorter sorts the raw kv entries of a DDL puller like EntrySorter, but it
+// buffers at most maxMemEntries unresolved entries in memory. Once the bound is
+// reached, the entries in memory are sorted and spilled to a file as a sorted
+// run, the runs are merged with the entries in memory when a resolved ts
+// arrives. The input is never blocked by the unresolved entries, otherwise the
+// resolved ts following them can't be received, only the output of the
+// resolved entries is blocked by a slow consumer.
+type ddlSorter struct {
+	maxMemEntries int
+	dir           string
+
+	mem  []*model.PolymorphicEvent
+	runs []*ddlSortRun
+	// spilled is the number of the entries in the runs not output yet
+	spilled int
+	// maxMem is the high-water mark of the number of the entries in memory
+	maxMem int
+
+	outputCh chan *model.RawKVEntry
+
+	metricMemPending   prometheus.Gauge
+	metricDiskPending  prometheus.Gauge
+	metricSpilledCount prometheus.Counter
+}
+
+func newDDLSorter(ctx context.Context, maxMemEntries int, dir string) *ddlSorter {
+	captureAddr := util.CaptureAddrFromCtx(ctx)
+	changefeedID := util.ChangefeedIDFromCtx(ctx)
+	return &ddlSorter{
+		maxMemEntries: maxMemEntries,
+		dir:           dir,
+		outputCh:      make(chan *model.RawKVEntry, 128),
+
+		metricMemPending:   ddlSorterPendingGauge.WithLabelValues(captureAddr, changefeedID, "memory"),
+		metricDiskPending:  ddlSorterPendingGauge.WithLabelValues(captureAddr, changefeedID, "disk"),
+		metricSpilledCount: ddlSorterSpilledCounter.WithLabelValues(captureAddr, changefeedID),
+	}
+}
+
+func (s *ddlSorter) run(ctx context.Context, input <-chan *model.RawKVEntry) error {
+	defer s.cleanUp()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case rawKV := <-input:
+			if rawKV == nil {
+				continue
+			}
+			var err error
+			if rawKV.OpType == model.OpTypeResolved {
+				err = s.resolve(ctx, rawKV)
+			} else {
+				err = s.add(ctx, model.NewPolymorphicEvent(rawKV))
+			}
+			if err != nil {
+				return errors.Trace(err)
+			}
+			s.metricMemPending.Set(float64(len(s.mem)))
+			s.metricDiskPending.Set(float64(s.spilled))
+		}
+	}
+}
+
+func (s *ddlSorter) add(ctx context.Context, ev *model.PolymorphicEvent) error {
+	s.mem = append(s.mem, ev)
+	if len(s.mem) > s.maxMem {
+		s.maxMem = len(s.mem)
+	}
+	if len(s.mem) < s.maxMemEntries {
+		return nil
+	}
+	return s.spill(ctx)
+}
+
+// spill writes the sorted entries in memory to a new run
+func (s *ddlSorter) spill(ctx context.Context) error {
+	s.sortMem()
+	path := filepath.Join(s.dir, randomFileName("ddl-sorter"))
+	if _, err := flushEventsToFile(ctx, path, s.mem); err != nil {
+		_ = os.Remove(path)
+		return errors.Trace(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return cerror.WrapError(cerror.ErrFileSorterOpenFile, err)
+	}
+	run := &ddlSortRun{path: path, file: f, rd: bufio.NewReader(f), readBuf: new(bytes.Reader)}
+	s.runs = append(s.runs, run)
+	if err := run.next(); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("spill the unresolved ddl entries", zap.String("file", path),
+		zap.Int("count", len(s.mem)), zap.Int("runs", len(s.runs)))
+	s.spilled += len(s.mem)
+	s.metricSpilledCount.Add(float64(len(s.mem)))
+	for i := range s.mem {
+		s.mem[i] = nil
+	}
+	s.mem = s.mem[:0]
+	return nil
+}
+
+// resolve merges the entries in memory and the runs, outputs the entries
+// before the resolved ts, then outputs the resolved entry
+func (s *ddlSorter) resolve(ctx context.Context, resolved *model.RawKVEntry) error {
+	resolvedTs := resolved.CRTs
+	s.sortMem()
+	h := make(sortHeap, 0, len(s.runs)+1)
+	// the fileIndex of the entries in memory is -1
+	if len(s.mem) > 0 && s.mem[0].CRTs <= resolvedTs {
+		h = append(h, &sortItem{entry: s.mem[0], fileIndex: -1})
+	}
+	for i, run := range s.runs {
+		if run.head != nil && run.head.CRTs <= resolvedTs {
+			h = append(h, &sortItem{entry: run.head, fileIndex: i})
+		}
+	}
+	heap.Init(&h)
+	memIdx := 0
+	for h.Len() > 0 {
+		item := heap.Pop(&h).(*sortItem)
+		if err := s.output(ctx, item.entry.RawKV); err != nil {
+			return errors.Trace(err)
+		}
+		if item.fileIndex < 0 {
+			memIdx++
+			if memIdx < len(s.mem) && s.mem[memIdx].CRTs <= resolvedTs {
+				heap.Push(&h, &sortItem{entry: s.mem[memIdx], fileIndex: -1})
+			}
+			continue
+		}
+		run := s.runs[item.fileIndex]
+		s.spilled--
+		if err := run.next(); err != nil {
+			return errors.Trace(err)
+		}
+		if run.head != nil && run.head.CRTs <= resolvedTs {
+			heap.Push(&h, &sortItem{entry: run.head, fileIndex: item.fileIndex})
+		}
+	}
+
+	n := copy(s.mem, s.mem[memIdx:])
+	for i := n; i < len(s.mem); i++ {
+		s.mem[i] = nil
+	}
+	s.mem = s.mem[:n]
+	runs := s.runs[:0]
+	for _, run := range s.runs {
+		if run.head == nil {
+			run.close()
+			continue
+		}
+		runs = append(runs, run)
+	}
+	for i := len(runs); i < len(s.runs); i++ {
+		s.runs[i] = nil
+	}
+	s.runs = runs
+	return s.output(ctx, resolved)
+}
+
+func (s *ddlSorter) sortMem() {
+	sort.Slice(s.mem, func(i, j int) bool {
+		if s.mem[i].CRTs == s.mem[j].CRTs {
+			return s.mem[i].RawKV.OpType == model.OpTypeDelete && s.mem[j].RawKV.OpType != model.OpTypeDelete
+		}
+		return s.mem[i].CRTs < s.mem[j].CRTs
+	})
+}
+
+func (s *ddlSorter) output(ctx context.Context, rawKV *model.RawKVEntry) error {
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case s.outputCh <- rawKV:
+		return nil
+	}
+}
+
+func (s *ddlSorter) cleanUp() {
+	for _, run := range s.runs {
+		run.close()
+	}
+	s.runs = nil
+	s.mem = nil
+	s.spilled = 0
+	s.metricMemPending.Set(0)
+	s.metricDiskPending.Set(0)
+}
+
+// SortOutput receives a channel from a puller, then sort event and output to the channel returned.
+// At most DDLPullerConfig.MaxMemEntries unresolved entries are buffered in memory, the others are
+// spilled to the disk until they are resolved. The error of the sorter is sent to the error channel
+// returned, and no more entries are output after it.
+func SortOutput(ctx context.Context, input <-chan *model.RawKVEntry) (<-chan *model.RawKVEntry, <-chan error) {
+	cfg := config.GetDDLPullerConfig()
+	sorter := newDDLSorter(ctx, cfg.MaxMemEntries, cfg.GetSpillDir())
+	errCh := make(chan error, 1)
+	go func() {
+		if err := sorter.run(ctx, input); errors.Cause(err) != context.Canceled {
+			log.Error("sorter exited with error", append(util.ZapFieldsFromCtx(ctx), zap.Error(err))...)
+			errCh <- err
+		}
+	}()
+	return sorter.outputCh, errCh
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sync"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlSorterSuite struct{}
+
+var _ = check.Suite(&ddlSorterSuite{})
+
+func (s *ddlSorterSuite) TestBurst(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := c.MkDir()
+	const (
+		jobs          = 50000
+		maxMemEntries = 1000
+	)
+	sorter := newDDLSorter(ctx, maxMemEntries, dir)
+	input := make(chan *model.RawKVEntry)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sorter.run(ctx, input)
+		c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+	}()
+
+	// the burst of the jobs is received before any resolved ts, the first
+	// resolved ts resolves half of them
+	go func() {
+		for i := 0; i < jobs; i++ {
+			input <- &model.RawKVEntry{OpType: model.OpTypePut, CRTs: uint64(rand.Intn(jobs)) + 1, Value: []byte("job")}
+		}
+		input <- &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: jobs / 2}
+		input <- &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: jobs}
+	}()
+
+	var lastTs, resolvedTs uint64
+	count := 0
+	for resolvedTs < jobs {
+		entry := <-sorter.outputCh
+		c.Assert(entry.CRTs, check.GreaterEqual, lastTs)
+		lastTs = entry.CRTs
+		if entry.OpType == model.OpTypeResolved {
+			resolvedTs = entry.CRTs
+			continue
+		}
+		c.Assert(entry.CRTs, check.Greater, resolvedTs)
+		c.Assert(entry.Value, check.DeepEquals, []byte("job"))
+		count++
+	}
+	c.Assert(count, check.Equals, jobs)
+	cancel()
+	wg.Wait()
+
+	c.Assert(sorter.maxMem, check.LessEqual, maxMemEntries)
+	// the spilled runs are removed
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+}
+
+func (s *ddlSorterSuite) TestKeepUnresolvedEntries(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := c.MkDir()
+	sorter := newDDLSorter(ctx, 2, dir)
+
+	for _, ts := range []uint64{5, 1, 4, 2, 3} {
+		c.Assert(sorter.add(ctx, model.NewPolymorphicEvent(&model.RawKVEntry{OpType: model.OpTypePut, CRTs: ts})), check.IsNil)
+	}
+	c.Assert(sorter.runs, check.HasLen, 2)
+	c.Assert(sorter.spilled, check.Equals, 4)
+
+	c.Assert(sorter.resolve(ctx, &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: 3}), check.IsNil)
+	for _, ts := range []uint64{1, 2, 3, 3} {
+		c.Assert((<-sorter.outputCh).CRTs, check.Equals, ts)
+	}
+	// both runs have an entry after the resolved ts
+	c.Assert(sorter.mem, check.HasLen, 0)
+	c.Assert(sorter.runs, check.HasLen, 2)
+	c.Assert(sorter.spilled, check.Equals, 2)
+
+	c.Assert(sorter.resolve(ctx, &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: 5}), check.IsNil)
+	for _, ts := range []uint64{4, 5, 5} {
+		c.Assert((<-sorter.outputCh).CRTs, check.Equals, ts)
+	}
+	c.Assert(sorter.runs, check.HasLen, 0)
+	c.Assert(sorter.spilled, check.Equals, 0)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+}
+
+func (s *ddlSorterSuite) TestSortOutputError(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the entries can't be spilled to the missing dir
+	config.SetDDLPullerConfig(&config.DDLPullerConfig{
+		MaxMemEntries: 1,
+		SpillDir:      filepath.Join(c.MkDir(), "missing"),
+	})
+	defer config.SetDDLPullerConfig(nil)
+
+	input := make(chan *model.RawKVEntry, 2)
+	input <- &model.RawKVEntry{OpType: model.OpTypePut, CRTs: 1}
+	input <- &model.RawKVEntry{OpType: model.OpTypePut, CRTs: 2}
+	_, errCh := SortOutput(ctx, input)
+	c.Assert(<-errCh, check.ErrorMatches, ".*ErrFileSorterOpenFile.*no such file or directory.*")
+}
@@ -21,11 +21,10 @@ import (
 	"time"
 
 	"github.com/pingcap/errors"
-	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
+	psorter "github.com/pingcap/ticdc/cdc/puller/sorter"
 	"github.com/pingcap/ticdc/pkg/notify"
 	"github.com/pingcap/ticdc/pkg/util"
-	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -35,6 +34,7 @@ type EntrySorter struct {
 	lock            sync.Mutex
 	resolvedTsGroup []uint64
 	closed          int32
+	stopper         psorter.SafeStopper
 
 	outputCh         chan *model.PolymorphicEvent
 	resolvedNotifier *notify.Notifier
@@ -97,12 +97,14 @@ func (es *EntrySorter) Run(ctx context.Context) error {
 	}
 
 	errg, ctx := errgroup.WithContext(ctx)
-	receiver, err := es.resolvedNotifier.NewReceiver(1000 * time.Millisecond)
+	receiver, err := es.resolvedNotifier.NewAdaptiveReceiver(time.Second, 10*time.Second)
 	if err != nil {
 		return err
 	}
 	defer es.resolvedNotifier.Close()
 	errg.Go(func() error {
+		metricTicker := time.NewTicker(defaultMetricInterval)
+		defer metricTicker.Stop()
 		var sorted []*model.PolymorphicEvent
 		for {
 			select {
@@ -110,7 +112,7 @@ func (es *EntrySorter) Run(ctx context.Context) error {
 				atomic.StoreInt32(&es.closed, 1)
 				close(es.outputCh)
 				return errors.Trace(ctx.Err())
-			case <-time.After(defaultMetricInterval):
+			case <-metricTicker.C:
 				metricEntrySorterOutputChanSizeGauge.Set(float64(len(es.outputCh)))
 				es.lock.Lock()
 				metricEntrySorterResolvedChanSizeGuage.Set(float64(len(es.resolvedTsGroup)))
@@ -152,6 +154,14 @@ func (es *EntrySorter) Run(ctx context.Context) error {
 				})
 				metricEntrySorterMergeDuration.Observe(time.Since(startTime).Seconds())
 				sorted = merged
+				es.stopper.ResolvedOutput(maxResolvedTs)
+				if es.stopper.Stopped() {
+					// nothing is added after the resolved ts it stops at
+					close(es.outputCh)
+					<-ctx.Done()
+					atomic.StoreInt32(&es.closed, 1)
+					return errors.Trace(ctx.Err())
+				}
 			}
 		}
 	})
@@ -160,7 +170,7 @@ func (es *EntrySorter) Run(ctx context.Context) error {
 
 // AddEntry adds an RawKVEntry to the EntryGroup
 func (es *EntrySorter) AddEntry(ctx context.Context, entry *model.PolymorphicEvent) {
-	if atomic.LoadInt32(&es.closed) != 0 {
+	if atomic.LoadInt32(&es.closed) != 0 || !es.stopper.Admit(entry) {
 		return
 	}
 	es.lock.Lock()
@@ -178,48 +188,12 @@ func (es *EntrySorter) Output() <-chan *model.PolymorphicEvent {
 	return es.outputCh
 }
 
-// SortOutput receives a channel from a puller, then sort event and output to the channel returned.
-func SortOutput(ctx context.Context, input <-chan *model.RawKVEntry) <-chan *model.RawKVEntry {
-	ctx, cancel := context.WithCancel(ctx)
-	sorter := NewEntrySorter()
-	outputCh := make(chan *model.RawKVEntry, 128)
-	output := func(rawKV *model.RawKVEntry) {
-		select {
-		case <-ctx.Done():
-			if errors.Cause(ctx.Err()) != context.Canceled {
-				log.Error("sorter exited with error", zap.Error(ctx.Err()))
-			}
-			return
-		case outputCh <- rawKV:
-		}
-	}
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				if errors.Cause(ctx.Err()) != context.Canceled {
-					log.Error("sorter exited with error", zap.Error(ctx.Err()))
-				}
-				return
-			case rawKV := <-input:
-				if rawKV == nil {
-					continue
-				}
-				sorter.AddEntry(ctx, model.NewPolymorphicEvent(rawKV))
-			case sorted := <-sorter.Output():
-				if sorted != nil {
-					output(sorted.RawKV)
-				}
-			}
-		}
-	}()
-	go func() {
-		if err := sorter.Run(ctx); err != nil {
-			if errors.Cause(ctx.Err()) != context.Canceled {
-				log.Error("sorter exited with error", zap.Error(ctx.Err()))
-			}
-		}
-		cancel()
-	}()
-	return outputCh
+// SafeStop implements the EventSorter interface
+func (es *EntrySorter) SafeStop() {
+	es.stopper.SafeStop()
+}
+
+// MaxResolvedTs implements the EventSorter interface
+func (es *EntrySorter) MaxResolvedTs() model.Ts {
+	return es.stopper.MaxResolvedTs()
 }
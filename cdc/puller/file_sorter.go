@@ -33,6 +33,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
+	psorter "github.com/pingcap/ticdc/cdc/puller/sorter"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
@@ -162,6 +163,17 @@ func (cache *fileCache) finishSorting(newLastSortedFile string, toRemoveFiles []
 	cache.lastSortedFile = newLastSortedFile
 }
 
+// dropLastSortedFile removes the events left after the last sorting round,
+// which are never output since the file sorter is stopped.
+func (cache *fileCache) dropLastSortedFile() {
+	cache.fileLock.Lock()
+	defer cache.fileLock.Unlock()
+	if cache.lastSortedFile != "" {
+		cache.toRemoveFiles = append(cache.toRemoveFiles, cache.lastSortedFile)
+		cache.lastSortedFile = ""
+	}
+}
+
 func (cache *fileCache) flush(ctx context.Context, entries []*model.PolymorphicEvent) error {
 	cache.fileLock.Lock()
 	defer cache.fileLock.Unlock()
@@ -182,6 +194,7 @@ type FileSorter struct {
 	outputCh chan *model.PolymorphicEvent
 	inputCh  chan *model.PolymorphicEvent
 	cache    *fileCache
+	stopper  psorter.SafeStopper
 }
 
 // flushEventsToFile writes a slice of model.PolymorphicEvent to a given file in sequence
@@ -305,6 +318,9 @@ func (fs *FileSorter) output(ctx context.Context, entry *model.PolymorphicEvent)
 	case <-ctx.Done():
 		return
 	case fs.outputCh <- entry:
+		if entry.RawKV != nil && entry.RawKV.OpType == model.OpTypeResolved {
+			fs.stopper.ResolvedOutput(entry.CRTs)
+		}
 	}
 }
 
@@ -475,6 +491,9 @@ func (fs *FileSorter) rotate(ctx context.Context, resolvedTs uint64) error {
 
 // AddEntry adds an RawKVEntry to file sorter cache
 func (fs *FileSorter) AddEntry(ctx context.Context, entry *model.PolymorphicEvent) {
+	if !fs.stopper.Admit(entry) {
+		return
+	}
 	select {
 	case <-ctx.Done():
 		return
@@ -487,6 +506,16 @@ func (fs *FileSorter) Output() <-chan *model.PolymorphicEvent {
 	return fs.outputCh
 }
 
+// SafeStop implements the EventSorter interface
+func (fs *FileSorter) SafeStop() {
+	fs.stopper.SafeStop()
+}
+
+// MaxResolvedTs implements the EventSorter interface
+func (fs *FileSorter) MaxResolvedTs() model.Ts {
+	return fs.stopper.MaxResolvedTs()
+}
+
 // Run implements EventSorter.Run, runs in background, sorts and sends sorted events to output channel
 func (fs *FileSorter) Run(ctx context.Context) error {
 	wg, ctx := errgroup.WithContext(ctx)
@@ -528,6 +557,13 @@ func (fs *FileSorter) sortAndOutput(ctx context.Context) error {
 				if err != nil {
 					return errors.Trace(err)
 				}
+				if fs.stopper.Stopped() {
+					// the rotation outputs all the events before the stop
+					// ts, and nothing is added after it
+					fs.cache.dropLastSortedFile()
+					close(fs.outputCh)
+					return nil
+				}
 				continue
 			}
 			buffer = append(buffer, ev)
@@ -66,6 +66,20 @@ var (
 			Name:      "event_chan_size",
 			Help:      "Puller event channel size",
 		}, []string{"capture", "changefeed", "table"})
+	incrementalScanRegionGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "puller",
+			Name:      "incremental_scan_region_count",
+			Help:      "The number of regions being fed and regions finished incremental scan",
+		}, []string{"capture", "changefeed", "table", "type"})
+	incrementalScanSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "puller",
+			Name:      "incremental_scan_size",
+			Help:      "The number of rows and bytes scanned in incremental scan",
+		}, []string{"capture", "changefeed", "table", "type"})
 	entrySorterResolvedChanSizeGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "ticdc",
@@ -103,6 +117,20 @@ var (
 			Help:      "Bucketed histogram of processing time (s) of merge in entry sorter.",
 			Buckets:   prometheus.ExponentialBuckets(0.000001, 10, 10),
 		}, []string{"capture", "changefeed", "table"})
+	ddlSorterPendingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "puller",
+			Name:      "ddl_sorter_pending_count",
+			Help:      "The number of the unresolved DDL entries buffered in memory and spilled to the disk by the DDL puller",
+		}, []string{"capture", "changefeed", "type"})
+	ddlSorterSpilledCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "puller",
+			Name:      "ddl_sorter_spilled_count",
+			Help:      "The number of the unresolved DDL entries spilled to the disk by the DDL puller",
+		}, []string{"capture", "changefeed"})
 )
 
 // InitMetrics registers all metrics in this file
@@ -113,9 +141,13 @@ func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(memBufferSizeGauge)
 	registry.MustRegister(outputChanSizeGauge)
 	registry.MustRegister(eventChanSizeGauge)
+	registry.MustRegister(incrementalScanRegionGauge)
+	registry.MustRegister(incrementalScanSizeGauge)
 	registry.MustRegister(entrySorterResolvedChanSizeGauge)
 	registry.MustRegister(entrySorterOutputChanSizeGauge)
 	registry.MustRegister(entrySorterUnsortedSizeGauge)
 	registry.MustRegister(entrySorterSortDuration)
 	registry.MustRegister(entrySorterMergeDuration)
+	registry.MustRegister(ddlSorterPendingGauge)
+	registry.MustRegister(ddlSorterSpilledCounter)
 }
@@ -47,6 +47,8 @@ type Puller interface {
 	GetResolvedTs() uint64
 	Output() <-chan *model.RawKVEntry
 	IsInitialized() bool
+	// ScanProgress returns the progress of the incremental scan
+	ScanProgress() model.IncrementalScanProgress
 }
 
 type pullerImpl struct {
@@ -62,6 +64,12 @@ type pullerImpl struct {
 	resolvedTs     uint64
 	initialized    int64
 	enableOldValue bool
+
+	// the progress of incremental scan, updated by the kv client
+	totalRegions       int64
+	initializedRegions int64
+	scannedRows        int64
+	scannedBytes       int64
 }
 
 // NewPuller create a new Puller fetch event start from checkpointTs
@@ -130,7 +138,7 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 
 	captureAddr := util.CaptureAddrFromCtx(ctx)
 	changefeedID := util.ChangefeedIDFromCtx(ctx)
-	tableID, tableName := util.TableIDFromCtx(ctx)
+	_, tableName := util.TableIDFromCtx(ctx)
 	metricOutputChanSize := outputChanSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName)
 	metricEventChanSize := eventChanSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName)
 	metricMemBufferSize := memBufferSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName)
@@ -139,6 +147,10 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 	metricEventCounterResolved := kvEventCounter.WithLabelValues(captureAddr, changefeedID, "resolved")
 	metricTxnCollectCounterKv := txnCollectCounter.WithLabelValues(captureAddr, changefeedID, tableName, "kv")
 	metricTxnCollectCounterResolved := txnCollectCounter.WithLabelValues(captureAddr, changefeedID, tableName, "resolved")
+	metricScanTotalRegions := incrementalScanRegionGauge.WithLabelValues(captureAddr, changefeedID, tableName, "total")
+	metricScanInitializedRegions := incrementalScanRegionGauge.WithLabelValues(captureAddr, changefeedID, tableName, "initialized")
+	metricScannedRows := incrementalScanSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName, "rows")
+	metricScannedBytes := incrementalScanSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName, "bytes")
 	defer func() {
 		outputChanSizeGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
 		eventChanSizeGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
@@ -148,6 +160,10 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 		kvEventCounter.DeleteLabelValues(captureAddr, changefeedID, "resolved")
 		txnCollectCounter.DeleteLabelValues(captureAddr, changefeedID, tableName, "kv")
 		txnCollectCounter.DeleteLabelValues(captureAddr, changefeedID, tableName, "resolved")
+		incrementalScanRegionGauge.DeleteLabelValues(captureAddr, changefeedID, tableName, "total")
+		incrementalScanRegionGauge.DeleteLabelValues(captureAddr, changefeedID, tableName, "initialized")
+		incrementalScanSizeGauge.DeleteLabelValues(captureAddr, changefeedID, tableName, "rows")
+		incrementalScanSizeGauge.DeleteLabelValues(captureAddr, changefeedID, tableName, "bytes")
 	}()
 	g.Go(func() error {
 		for {
@@ -159,6 +175,11 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 				metricMemBufferSize.Set(float64(p.buffer.Size()))
 				metricOutputChanSize.Set(float64(len(p.outputCh)))
 				metricPullerResolvedTs.Set(float64(oracle.ExtractPhysical(atomic.LoadUint64(&p.resolvedTs))))
+				progress := p.ScanProgress()
+				metricScanTotalRegions.Set(float64(progress.TotalRegions))
+				metricScanInitializedRegions.Set(float64(progress.InitializedRegions))
+				metricScannedRows.Set(float64(progress.ScannedRows))
+				metricScannedBytes.Set(float64(progress.ScannedBytes))
 			}
 		}
 	})
@@ -200,10 +221,10 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 		output := func(raw *model.RawKVEntry) error {
 			if raw.CRTs < p.resolvedTs || (raw.CRTs == p.resolvedTs && raw.OpType != model.OpTypeResolved) {
 				log.Panic("The CRTs must be greater than the resolvedTs",
-					zap.Reflect("row", raw),
-					zap.Uint64("CRTs", raw.CRTs),
-					zap.Uint64("resolvedTs", p.resolvedTs),
-					zap.Int64("tableID", tableID))
+					append(util.ZapFieldsFromCtx(ctx),
+						model.DefaultEventLogFormatter.RawKV("row", raw),
+						zap.Uint64("CRTs", raw.CRTs),
+						zap.Uint64("resolvedTs", p.resolvedTs))...)
 			}
 			select {
 			case <-ctx.Done():
@@ -229,10 +250,9 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 				metricTxnCollectCounterResolved.Inc()
 				if !regionspan.IsSubSpan(e.Resolved.Span, p.spans...) {
 					log.Panic("the resolved span is not in the total span",
-						zap.Reflect("resolved", e.Resolved),
-						zap.Int64("tableID", tableID),
-						zap.Reflect("spans", p.spans),
-					)
+						append(util.ZapFieldsFromCtx(ctx),
+							zap.Reflect("resolved", e.Resolved),
+							zap.Reflect("spans", p.spans))...)
 				}
 				// Forward is called in a single thread
 				p.tsTracker.Forward(e.Resolved.Span, e.Resolved.ResolvedTs)
@@ -248,11 +268,10 @@ func (p *pullerImpl) Run(ctx context.Context) error {
 						spans = append(spans, p.spans[i].String())
 					}
 					log.Info("puller is initialized",
-						zap.Duration("duration", time.Since(start)),
-						zap.String("changefeed", changefeedID),
-						zap.Int64("tableID", tableID),
-						zap.Strings("spans", spans),
-						zap.Uint64("resolvedTs", resolvedTs))
+						append(util.ZapFieldsFromCtx(ctx),
+							zap.Duration("duration", time.Since(start)),
+							zap.Strings("spans", spans),
+							zap.Uint64("resolvedTs", resolvedTs))...)
 				}
 				if !initialized || resolvedTs == lastResolvedTs {
 					continue
@@ -276,3 +295,37 @@ func (p *pullerImpl) GetResolvedTs() uint64 {
 func (p *pullerImpl) IsInitialized() bool {
 	return atomic.LoadInt64(&p.initialized) > 0
 }
+
+func (p *pullerImpl) ScanProgress() model.IncrementalScanProgress {
+	return model.IncrementalScanProgress{
+		TotalRegions:       atomic.LoadInt64(&p.totalRegions),
+		InitializedRegions: atomic.LoadInt64(&p.initializedRegions),
+		ScannedRows:        atomic.LoadInt64(&p.scannedRows),
+		ScannedBytes:       atomic.LoadInt64(&p.scannedBytes),
+	}
+}
+
+// OnRegionStart implements kv.IncrementalScanObserver
+func (p *pullerImpl) OnRegionStart() {
+	atomic.AddInt64(&p.totalRegions, 1)
+}
+
+// OnRegionScanned implements kv.IncrementalScanObserver
+func (p *pullerImpl) OnRegionScanned(rows, bytes int) {
+	atomic.AddInt64(&p.scannedRows, int64(rows))
+	atomic.AddInt64(&p.scannedBytes, int64(bytes))
+}
+
+// OnRegionInitialized implements kv.IncrementalScanObserver
+func (p *pullerImpl) OnRegionInitialized() {
+	atomic.AddInt64(&p.initializedRegions, 1)
+}
+
+// OnRegionStop implements kv.IncrementalScanObserver
+func (p *pullerImpl) OnRegionStop(initialized bool) {
+	// the region will be scanned again after it is re-requested
+	atomic.AddInt64(&p.totalRegions, -1)
+	if initialized {
+		atomic.AddInt64(&p.initializedRegions, -1)
+	}
+}
@@ -51,6 +51,9 @@ func (mc *mockPdClientForPullerTest) GetClusterID(ctx context.Context) uint64 {
 
 type mockCDCKVClient struct {
 	expectations chan *model.RegionFeedEvent
+	// progress stages of the incremental scan reported to the puller
+	stages    chan func(kv.IncrementalScanObserver)
+	stageDone chan struct{}
 }
 
 type mockInjectedPuller struct {
@@ -66,6 +69,8 @@ func newMockCDCKVClient(
 ) kv.CDCKVClient {
 	return &mockCDCKVClient{
 		expectations: make(chan *model.RegionFeedEvent, 1024),
+		stages:       make(chan func(kv.IncrementalScanObserver)),
+		stageDone:    make(chan struct{}),
 	}
 }
 
@@ -87,6 +92,9 @@ func (mc *mockCDCKVClient) EventFeed(
 				return nil
 			}
 			eventCh <- ev
+		case stage := <-mc.stages:
+			stage(isPullerInit.(kv.IncrementalScanObserver))
+			mc.stageDone <- struct{}{}
 		}
 	}
 }
@@ -107,6 +115,13 @@ func (mc *mockCDCKVClient) Returns(ev *model.RegionFeedEvent) {
 	mc.expectations <- ev
 }
 
+// ReportsProgress reports a stage of the incremental scan progress, and waits
+// until the stage is reported.
+func (mc *mockCDCKVClient) ReportsProgress(stage func(kv.IncrementalScanObserver)) {
+	mc.stages <- stage
+	<-mc.stageDone
+}
+
 func (s *pullerSuite) newPullerForTest(
 	c *check.C,
 	spans []regionspan.Span,
@@ -217,3 +232,56 @@ func (s *pullerSuite) TestPullerRawKV(c *check.C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *pullerSuite) TestPullerScanProgress(c *check.C) {
+	defer testleak.AfterTest(c)()
+	spans := []regionspan.Span{
+		{Start: []byte("t_a"), End: []byte("t_e")},
+	}
+	checkpointTs := uint64(996)
+	plr, cancel, wg, store := s.newPullerForTest(c, spans, checkpointTs)
+	c.Assert(plr.ScanProgress(), check.DeepEquals, model.IncrementalScanProgress{})
+
+	// three regions start the incremental scan
+	plr.cli.ReportsProgress(func(o kv.IncrementalScanObserver) {
+		for i := 0; i < 3; i++ {
+			o.OnRegionStart()
+		}
+		o.OnRegionScanned(10, 1000)
+	})
+	c.Assert(plr.ScanProgress(), check.DeepEquals, model.IncrementalScanProgress{
+		TotalRegions: 3, ScannedRows: 10, ScannedBytes: 1000,
+	})
+
+	// a region is initialized, another region fails and is re-requested
+	plr.cli.ReportsProgress(func(o kv.IncrementalScanObserver) {
+		o.OnRegionScanned(5, 500)
+		o.OnRegionInitialized()
+		o.OnRegionStop(false)
+		o.OnRegionStart()
+	})
+	c.Assert(plr.ScanProgress(), check.DeepEquals, model.IncrementalScanProgress{
+		TotalRegions: 3, InitializedRegions: 1, ScannedRows: 15, ScannedBytes: 1500,
+	})
+
+	// all regions are initialized
+	plr.cli.ReportsProgress(func(o kv.IncrementalScanObserver) {
+		o.OnRegionInitialized()
+		o.OnRegionInitialized()
+	})
+	c.Assert(plr.ScanProgress(), check.DeepEquals, model.IncrementalScanProgress{
+		TotalRegions: 3, InitializedRegions: 3, ScannedRows: 15, ScannedBytes: 1500,
+	})
+
+	// an initialized region stops
+	plr.cli.ReportsProgress(func(o kv.IncrementalScanObserver) {
+		o.OnRegionStop(true)
+	})
+	progress := plr.ScanProgress()
+	c.Assert(progress.TotalRegions, check.Equals, int64(2))
+	c.Assert(progress.InitializedRegions, check.Equals, int64(2))
+
+	store.Close()
+	cancel()
+	wg.Wait()
+}
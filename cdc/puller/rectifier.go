@@ -21,6 +21,7 @@ import (
 
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -54,11 +55,20 @@ func (r *Rectifier) GetMaxResolvedTs() model.Ts {
 	return atomic.LoadUint64(&r.maxSentResolvedTs)
 }
 
-// SafeStop stops the Rectifier and Sorter safety
+// MaxResolvedTs implements the EventSorter interface, the resolved ts sent
+// is never larger than the target ts.
+func (r *Rectifier) MaxResolvedTs() model.Ts {
+	return r.GetMaxResolvedTs()
+}
+
+// SafeStop stops the Rectifier and Sorter safety, the Rectifier is stopped at
+// the next resolved event it sends, and the sorter is stopped at or after it.
 func (r *Rectifier) SafeStop() {
-	atomic.CompareAndSwapInt32(&r.status,
+	if atomic.CompareAndSwapInt32(&r.status,
 		model.SorterStatusWorking,
-		model.SorterStatusStopping)
+		model.SorterStatusStopping) {
+		r.EventSorter.SafeStop()
+	}
 }
 
 // Run running the Rectifier
@@ -66,7 +76,7 @@ func (r *Rectifier) Run(ctx context.Context) error {
 	output := func(event *model.PolymorphicEvent) {
 		select {
 		case <-ctx.Done():
-			log.Warn("failed to send to output channel", zap.Error(ctx.Err()))
+			log.Warn("failed to send to output channel", append(util.ZapFieldsFromCtx(ctx), zap.Error(ctx.Err()))...)
 		case r.outputCh <- event:
 		}
 	}
@@ -79,28 +89,31 @@ func (r *Rectifier) Run(ctx context.Context) error {
 		for {
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
-			case event := <-r.EventSorter.Output():
-				if event == nil {
-					return nil
+				return r.canceled(ctx)
+			case event, ok := <-r.EventSorter.Output():
+				if !ok {
+					// the sorter closes its output after it's stopped safely
+					return r.canceled(ctx)
+				}
+				switch atomic.LoadInt32(&r.status) {
+				case model.SorterStatusStopped, model.SorterStatusFinished:
+					// the events after the stop are drained until the sorter
+					// is stopped too, so that it never blocks the puller
+					continue
 				}
 				if event.CRTs > r.targetTs {
 					output(model.NewResolvedPolymorphicEvent(event.RegionID(), r.targetTs))
 					atomic.StoreUint64(&r.maxSentResolvedTs, r.targetTs)
 					atomic.StoreInt32(&r.status, model.SorterStatusFinished)
-					return nil
+					r.EventSorter.SafeStop()
+					continue
 				}
 				output(event)
 				if event.RawKV.OpType == model.OpTypeResolved {
 					atomic.StoreUint64(&r.maxSentResolvedTs, event.CRTs)
-					switch atomic.LoadInt32(&r.status) {
-					case model.SorterStatusStopping:
-						atomic.StoreInt32(&r.status, model.SorterStatusStopped)
-						return nil
-					case model.SorterStatusStopped:
-						return nil
-					case model.SorterStatusWorking:
-					}
+					atomic.CompareAndSwapInt32(&r.status,
+						model.SorterStatusStopping,
+						model.SorterStatusStopped)
 				}
 			}
 		}
@@ -108,6 +121,17 @@ func (r *Rectifier) Run(ctx context.Context) error {
 	return errg.Wait()
 }
 
+// canceled returns the error of the Rectifier canceled or whose sorter output
+// is closed, which is nil if the Rectifier is stopped or finished already and
+// only drains the sorter.
+func (r *Rectifier) canceled(ctx context.Context) error {
+	switch atomic.LoadInt32(&r.status) {
+	case model.SorterStatusStopped, model.SorterStatusFinished:
+		return nil
+	}
+	return ctx.Err()
+}
+
 // Output returns the output streams
 func (r *Rectifier) Output() <-chan *model.PolymorphicEvent {
 	return r.outputCh
@@ -21,7 +21,9 @@ import (
 
 	"github.com/pingcap/check"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -29,8 +31,12 @@ type rectifierSuite struct{}
 
 var _ = check.Suite(&rectifierSuite{})
 
+// mockSorter outputs the events in the order they are added
 type mockSorter struct {
-	outputCh chan *model.PolymorphicEvent
+	outputCh      chan *model.PolymorphicEvent
+	stopping      int32
+	stopped       bool
+	maxResolvedTs uint64
 }
 
 func newMockSorter() *mockSorter {
@@ -45,11 +51,29 @@ func (m *mockSorter) Run(ctx context.Context) error {
 }
 
 func (m *mockSorter) AddEntry(ctx context.Context, entry *model.PolymorphicEvent) {
+	if m.stopped {
+		return
+	}
 	select {
 	case <-ctx.Done():
 		return
 	case m.outputCh <- entry:
 	}
+	if entry.RawKV.OpType == model.OpTypeResolved {
+		atomic.StoreUint64(&m.maxResolvedTs, entry.CRTs)
+		if atomic.LoadInt32(&m.stopping) != 0 {
+			m.stopped = true
+			close(m.outputCh)
+		}
+	}
+}
+
+func (m *mockSorter) SafeStop() {
+	atomic.StoreInt32(&m.stopping, 1)
+}
+
+func (m *mockSorter) MaxResolvedTs() model.Ts {
+	return atomic.LoadUint64(&m.maxResolvedTs)
 }
 
 func (m *mockSorter) Output() <-chan *model.PolymorphicEvent {
@@ -196,3 +220,31 @@ func (s *rectifierSuite) TestRectifierFinished(c *check.C) {
 	cancel()
 	c.Assert(errg.Wait(), check.IsNil)
 }
+
+func (s *rectifierSuite) TestTableFieldsInLogs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.WarnLevel)
+	defer restore()
+	ctx := util.PutChangefeedIDInCtx(context.Background(), "test-changefeed")
+	ctx = util.PutTableInfoInCtx(ctx, 1, "`test`.`t`")
+	ctx, cancel := context.WithCancel(ctx)
+
+	sorter := newMockSorter()
+	r := NewRectifier(sorter, math.MaxUint64)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Run(ctx)
+	}()
+	// the output is not consumed, the event can't be sent out before canceled
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 1))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-errCh
+
+	entries := logs.FilterMessage("failed to send to output channel").All()
+	c.Assert(entries, check.HasLen, 1)
+	fields := entries[0].ContextMap()
+	c.Assert(fields["changefeed"], check.Equals, "test-changefeed")
+	c.Assert(fields["table-id"], check.Equals, int64(1))
+	c.Assert(fields["table-name"], check.Equals, "`test`.`t`")
+}
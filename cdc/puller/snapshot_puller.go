@@ -0,0 +1,142 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util"
+	tidbkv "github.com/pingcap/tidb/kv"
+	"go.uber.org/zap"
+)
+
+type snapshotPuller struct {
+	kvStorage  tidbkv.Storage
+	snapshotTs uint64
+	targetTs   uint64
+	span       regionspan.Span
+	outputCh   chan *model.RawKVEntry
+
+	resolvedTs   uint64
+	initialized  int64
+	scannedRows  int64
+	scannedBytes int64
+}
+
+// NewSnapshotPuller creates a Puller which only scans the snapshot of the span
+// at snapshotTs, and doesn't follow the changes after it. The rows are output
+// at targetTs, which must be greater than snapshotTs, and the puller is
+// resolved to targetTs once the scan is done.
+func NewSnapshotPuller(
+	kvStorage tidbkv.Storage,
+	snapshotTs uint64,
+	targetTs uint64,
+	span regionspan.Span,
+) Puller {
+	return &snapshotPuller{
+		kvStorage:  kvStorage,
+		snapshotTs: snapshotTs,
+		targetTs:   targetTs,
+		span:       span,
+		outputCh:   make(chan *model.RawKVEntry, defaultPullerOutputChanSize),
+		resolvedTs: snapshotTs,
+	}
+}
+
+func (p *snapshotPuller) Output() <-chan *model.RawKVEntry {
+	return p.outputCh
+}
+
+// Run scans the snapshot and outputs the rows, it returns after the resolved
+// ts is output and never closes the output channel.
+func (p *snapshotPuller) Run(ctx context.Context) error {
+	changefeedID := util.ChangefeedIDFromCtx(ctx)
+	tableID, _ := util.TableIDFromCtx(ctx)
+	output := func(raw *model.RawKVEntry) error {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case p.outputCh <- raw:
+		}
+		return nil
+	}
+
+	start := time.Now()
+	// the snapshot has been replicated if the table is restarted from the
+	// target ts, only the resolved ts is output
+	if p.snapshotTs < p.targetTs {
+		iter, err := p.kvStorage.GetSnapshot(tidbkv.NewVersion(p.snapshotTs)).Iter(p.span.Start, p.span.End)
+		if err != nil {
+			return cerror.WrapError(cerror.ErrPullerSnapshotScan, err)
+		}
+		defer iter.Close()
+		for iter.Valid() {
+			raw := &model.RawKVEntry{
+				OpType:  model.OpTypePut,
+				Key:     append([]byte{}, iter.Key()...),
+				Value:   append([]byte{}, iter.Value()...),
+				StartTs: p.snapshotTs,
+				CRTs:    p.targetTs,
+			}
+			if err := output(raw); err != nil {
+				return errors.Trace(err)
+			}
+			atomic.AddInt64(&p.scannedRows, 1)
+			atomic.AddInt64(&p.scannedBytes, raw.ApproximateSize())
+			if err := iter.Next(); err != nil {
+				return cerror.WrapError(cerror.ErrPullerSnapshotScan, err)
+			}
+		}
+	}
+	atomic.StoreInt64(&p.initialized, 1)
+	if err := output(&model.RawKVEntry{CRTs: p.targetTs, OpType: model.OpTypeResolved}); err != nil {
+		return errors.Trace(err)
+	}
+	atomic.StoreUint64(&p.resolvedTs, p.targetTs)
+	log.Info("snapshot puller is finished",
+		zap.Duration("duration", time.Since(start)),
+		zap.String("changefeed", changefeedID),
+		zap.Int64("tableID", tableID),
+		zap.Stringer("span", p.span),
+		zap.Uint64("snapshotTs", p.snapshotTs),
+		zap.Int64("rows", atomic.LoadInt64(&p.scannedRows)))
+	return nil
+}
+
+func (p *snapshotPuller) GetResolvedTs() uint64 {
+	return atomic.LoadUint64(&p.resolvedTs)
+}
+
+func (p *snapshotPuller) IsInitialized() bool {
+	return atomic.LoadInt64(&p.initialized) > 0
+}
+
+func (p *snapshotPuller) ScanProgress() model.IncrementalScanProgress {
+	progress := model.IncrementalScanProgress{
+		TotalRegions: 1,
+		ScannedRows:  atomic.LoadInt64(&p.scannedRows),
+		ScannedBytes: atomic.LoadInt64(&p.scannedBytes),
+	}
+	if atomic.LoadUint64(&p.resolvedTs) >= p.targetTs {
+		progress.InitializedRegions = 1
+	}
+	return progress
+}
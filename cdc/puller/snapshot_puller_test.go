@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package puller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	tidbkv "github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+type snapshotPullerSuite struct{}
+
+var _ = check.Suite(&snapshotPullerSuite{})
+
+func (s *snapshotPullerSuite) TestScanSnapshot(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := mockstore.NewMockStore(mockstore.WithStoreType(mockstore.MockTiKV))
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+
+	const tableID = 100
+	put := func(handles ...int64) {
+		txn, err := store.Begin()
+		c.Assert(err, check.IsNil)
+		for _, h := range handles {
+			err = txn.Set(tablecodec.EncodeRowKeyWithHandle(tableID, tidbkv.IntHandle(h)), []byte(fmt.Sprintf("row-%d", h)))
+			c.Assert(err, check.IsNil)
+		}
+		// the keys of the other tables are not scanned
+		err = txn.Set(tablecodec.EncodeRowKeyWithHandle(tableID+1, tidbkv.IntHandle(1)), []byte("other"))
+		c.Assert(err, check.IsNil)
+		c.Assert(txn.Commit(ctx), check.IsNil)
+	}
+	put(1, 2, 3)
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	snapshotTs := ver.Ver
+	// the rows committed after the snapshot ts are not scanned
+	put(4)
+
+	span := regionspan.GetTableSpan(tableID, true)
+	plr := NewSnapshotPuller(store, snapshotTs, snapshotTs+1, span)
+	c.Assert(plr.IsInitialized(), check.IsFalse)
+	c.Assert(plr.Run(ctx), check.IsNil)
+	c.Assert(plr.IsInitialized(), check.IsTrue)
+	c.Assert(plr.GetResolvedTs(), check.Equals, snapshotTs+1)
+
+	for i := int64(1); i <= 3; i++ {
+		raw := <-plr.Output()
+		c.Assert(raw.OpType, check.Equals, model.OpTypePut)
+		c.Assert(raw.CRTs, check.Equals, snapshotTs+1)
+		c.Assert(raw.StartTs, check.Equals, snapshotTs)
+		c.Assert([]byte(raw.Key), check.DeepEquals, []byte(tablecodec.EncodeRowKeyWithHandle(tableID, tidbkv.IntHandle(i))))
+		c.Assert(string(raw.Value), check.Equals, fmt.Sprintf("row-%d", i))
+	}
+	raw := <-plr.Output()
+	c.Assert(raw.OpType, check.Equals, model.OpTypeResolved)
+	c.Assert(raw.CRTs, check.Equals, snapshotTs+1)
+	c.Assert(plr.Output(), check.HasLen, 0)
+	progress := plr.ScanProgress()
+	c.Assert(progress.ScannedRows, check.Equals, int64(3))
+	c.Assert(progress.InitializedRegions, check.Equals, progress.TotalRegions)
+
+	// the table restarted from the target ts only outputs the resolved ts
+	plr = NewSnapshotPuller(store, snapshotTs+1, snapshotTs+1, span)
+	c.Assert(plr.Run(ctx), check.IsNil)
+	raw = <-plr.Output()
+	c.Assert(raw.OpType, check.Equals, model.OpTypeResolved)
+	c.Assert(plr.Output(), check.HasLen, 0)
+}
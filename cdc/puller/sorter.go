@@ -20,9 +20,28 @@ import (
 )
 
 // EventSorter accepts unsorted PolymorphicEvents, sort them in background and returns
-// sorted PolymorphicEvents in Output channel
+// sorted PolymorphicEvents in Output channel.
+//
+// Every implementation holds the guarantees below, which are checked by the
+// conformance tests of the sorters:
+//   - AddEntry is called by one goroutine, and each resolved event added means
+//     no events with the smaller or equal ts are added after it.
+//   - The events are output in the order of the commit ts, and a resolved event
+//     output means all the events with the smaller or equal ts are output.
+//   - SafeStop can be called at any time, even before Run, and more than once.
+//     The sorter stops at the last resolved ts added if it's not output yet,
+//     otherwise at the next one added: the events added after that resolved
+//     event are dropped without blocking AddEntry, the events before it are
+//     sorted and output, and the Output channel is closed after the resolved
+//     event is output.
+//   - MaxResolvedTs returns the max resolved ts output, which is the ts the
+//     sorter stops at once the Output channel is closed by SafeStop.
+//   - Run returns after the context is canceled or the sorter fails, the
+//     sorter stopped safely is still running until then.
 type EventSorter interface {
 	Run(ctx context.Context) error
 	AddEntry(ctx context.Context, entry *model.PolymorphicEvent)
 	Output() <-chan *model.PolymorphicEvent
+	SafeStop()
+	MaxResolvedTs() model.Ts
 }
@@ -56,14 +56,16 @@ type heapSorter struct {
 
 	poolHandle    workerpool.EventHandle
 	internalState *heapSorterInternalState
+	stats         *sorterStats
 }
 
-func newHeapSorter(id int, out chan *flushTask) *heapSorter {
+func newHeapSorter(id int, out chan *flushTask, stats *sorterStats) *heapSorter {
 	return &heapSorter{
 		id:       id,
 		inputCh:  make(chan *model.PolymorphicEvent, 1024*1024),
 		outputCh: out,
 		heap:     make(sortHeap, 0, 65536),
+		stats:    stats,
 	}
 }
 
@@ -85,6 +87,8 @@ func (h *heapSorter) flush(ctx context.Context, maxResolvedTs uint64) error {
 	}
 
 	sorterFlushCountHistogram.WithLabelValues(captureAddr, changefeedID, tableName).Observe(float64(h.heap.Len()))
+	metricSorterFlushDuration := sorterFlushDurationHistogram.WithLabelValues(captureAddr, changefeedID, tableName)
+	metricSorterWriteBytes := sorterIOBytesCounter.WithLabelValues(captureAddr, changefeedID, tableName, "write")
 
 	// We check if the heap contains only one entry and that entry is a ResolvedEvent.
 	// As an optimization, when the condition is true, we clear the heap and send an empty flush.
@@ -106,6 +110,9 @@ func (h *heapSorter) flush(ctx context.Context, maxResolvedTs uint64) error {
 		}
 
 		finishCh = make(chan error, 1)
+		if _, ok := backEnd.(*fileBackEnd); ok {
+			atomic.AddInt64(&h.stats.onDiskBackends, 1)
+		}
 	}
 
 	task := &flushTask{
@@ -120,9 +127,13 @@ func (h *heapSorter) flush(ctx context.Context, maxResolvedTs uint64) error {
 
 	var oldHeap sortHeap
 	if !isEmptyFlush {
+		stats := h.stats
 		task.dealloc = func() error {
 			if task.backend != nil {
 				task.backend = nil
+				if _, ok := backEnd.(*fileBackEnd); ok {
+					atomic.AddInt64(&stats.onDiskBackends, -1)
+				}
 				return pool.dealloc(backEnd)
 			}
 			return nil
@@ -144,6 +155,7 @@ func (h *heapSorter) flush(ctx context.Context, maxResolvedTs uint64) error {
 	if !isEmptyFlush {
 		backEndFinal := backEnd
 		err := heapSorterIOPool.Go(ctx, func() {
+			startTime := time.Now()
 			writer, err := backEnd.writer()
 			if err != nil {
 				if backEndFinal != nil {
@@ -186,6 +198,8 @@ func (h *heapSorter) flush(ctx context.Context, maxResolvedTs uint64) error {
 			}
 
 			backEndFinal = nil
+			metricSorterFlushDuration.Observe(time.Since(startTime).Seconds())
+			metricSorterWriteBytes.Add(float64(dataSize))
 
 			failpoint.Inject("sorterDebug", func() {
 				log.Debug("Unified Sorter flushTask finished",
@@ -230,6 +244,7 @@ func (h *heapSorter) init(ctx context.Context, onError func(err error)) {
 	state := &heapSorterInternalState{
 		sorterConfig: config.GetSorterConfig(),
 	}
+	logger := log.With(util.ZapFieldsFromCtx(ctx)...)
 
 	poolHandle := heapSorterPool.RegisterEvent(func(ctx context.Context, eventI interface{}) error {
 		event := eventI.(*model.PolymorphicEvent)
@@ -238,18 +253,20 @@ func (h *heapSorter) init(ctx context.Context, onError func(err error)) {
 
 		if isResolvedEvent {
 			if event.RawKV.CRTs < state.maxResolved {
-				log.Panic("ResolvedTs regression, bug?", zap.Uint64("event-resolvedTs", event.RawKV.CRTs),
+				logger.Panic("ResolvedTs regression, bug?", zap.Uint64("event-resolvedTs", event.RawKV.CRTs),
 					zap.Uint64("max-resolvedTs", state.maxResolved))
 			}
 			state.maxResolved = event.RawKV.CRTs
 		}
 
 		if event.RawKV.CRTs < state.maxResolved {
-			log.Panic("Bad input to sorter", zap.Uint64("cur-ts", event.RawKV.CRTs), zap.Uint64("maxResolved", state.maxResolved))
+			logger.Panic("Bad input to sorter", zap.Uint64("cur-ts", event.RawKV.CRTs), zap.Uint64("maxResolved", state.maxResolved))
 		}
 
 		// 5 * 8 is for the 5 fields in PolymorphicEvent
-		state.heapSizeBytesEstimate += event.RawKV.ApproximateSize() + 40
+		eventSize := event.RawKV.ApproximateSize() + 40
+		state.heapSizeBytesEstimate += eventSize
+		atomic.AddInt64(&h.stats.heapSizeBytes, eventSize)
 		needFlush := state.heapSizeBytesEstimate >= int64(state.sorterConfig.ChunkSizeLimit) ||
 			(isResolvedEvent && state.rateCounter < flushRateLimitPerSecond)
 
@@ -259,6 +276,7 @@ func (h *heapSorter) init(ctx context.Context, onError func(err error)) {
 			if err != nil {
 				return errors.Trace(err)
 			}
+			atomic.AddInt64(&h.stats.heapSizeBytes, -state.heapSizeBytesEstimate)
 			state.heapSizeBytesEstimate = 0
 		}
 
@@ -271,6 +289,7 @@ func (h *heapSorter) init(ctx context.Context, onError func(err error)) {
 			if err != nil {
 				return errors.Trace(err)
 			}
+			atomic.AddInt64(&h.stats.heapSizeBytes, -state.heapSizeBytesEstimate)
 			state.heapSizeBytesEstimate = 0
 		}
 		return nil
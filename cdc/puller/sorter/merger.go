@@ -18,6 +18,7 @@ import (
 	"context"
 	"math"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -30,10 +31,18 @@ import (
 	"go.uber.org/zap"
 )
 
-func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out chan *model.PolymorphicEvent) error {
+// runMerger merges the flushed tasks of the heap sorters and outputs the events
+// to out. stopAt tells whether the sorter stops at the resolved ts, out is
+// closed after the resolved event is output, and the tasks flushed after are
+// only cleaned up.
+func runMerger(
+	ctx context.Context, numSorters int, in <-chan *flushTask, out chan *model.PolymorphicEvent,
+	stats *sorterStats, stopAt func(resolvedTs uint64) bool,
+) error {
 	captureAddr := util.CaptureAddrFromCtx(ctx)
 	changefeedID := util.ChangefeedIDFromCtx(ctx)
 	_, tableName := util.TableIDFromCtx(ctx)
+	logger := log.With(util.ZapFieldsFromCtx(ctx)...)
 
 	metricSorterEventCount := sorterEventCount.MustCurryWith(map[string]string{
 		"capture":    captureAddr,
@@ -43,13 +52,15 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 	metricSorterResolvedTsGauge := sorterResolvedTsGauge.WithLabelValues(captureAddr, changefeedID, tableName)
 	metricSorterMergerStartTsGauge := sorterMergerStartTsGauge.WithLabelValues(captureAddr, changefeedID, tableName)
 	metricSorterMergeCountHistogram := sorterMergeCountHistogram.WithLabelValues(captureAddr, changefeedID, tableName)
+	metricSorterMergeDurationHistogram := sorterMergeDurationHistogram.WithLabelValues(captureAddr, changefeedID, tableName)
+	metricSorterReadBytes := sorterIOBytesCounter.WithLabelValues(captureAddr, changefeedID, tableName, "read")
 
 	lastResolvedTs := make([]uint64, numSorters)
 	minResolvedTs := uint64(0)
 
 	pendingSet := make(map[*flushTask]*model.PolymorphicEvent)
 	defer func() {
-		log.Info("Unified Sorter: merger exiting, cleaning up resources", zap.Int("pending-set-size", len(pendingSet)))
+		logger.Info("Unified Sorter: merger exiting, cleaning up resources", zap.Int("pending-set-size", len(pendingSet)))
 		// clean up resources
 		for task := range pendingSet {
 			if task.reader != nil {
@@ -71,12 +82,19 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 		case out <- model.NewResolvedPolymorphicEvent(0, ts):
 			metricSorterEventCount.WithLabelValues("resolved").Inc()
 			metricSorterResolvedTsGauge.Set(float64(oracle.ExtractPhysical(ts)))
+			atomic.StoreUint64(&stats.outputResolvedTs, ts)
 			return nil
 		}
 	}
 
+	// onTaskDrained is called when all the events of task have been read
+	onTaskDrained := func(task *flushTask) {
+		metricSorterReadBytes.Add(float64(atomic.LoadInt64(&task.dataSize)))
+	}
+
 	onMinResolvedTsUpdate := func() error {
 		metricSorterMergerStartTsGauge.Set(float64(oracle.ExtractPhysical(minResolvedTs)))
+		startTime := time.Now()
 
 		workingSet := make(map[*flushTask]struct{})
 		sortHeap := new(sortHeap)
@@ -133,7 +151,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 				}
 
 				if event == nil {
-					log.Panic("Unexpected end of backEnd data, bug?",
+					logger.Panic("Unexpected end of backEnd data, bug?",
 						zap.Uint64("minResolvedTs", task.maxResolvedTs))
 				}
 			}
@@ -169,6 +187,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 
 			if nextEvent == nil {
 				delete(pendingSet, task)
+				onTaskDrained(task)
 
 				err := task.reader.resetAndClose()
 				if err != nil {
@@ -183,7 +202,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 			} else {
 				pendingSet[task] = nextEvent
 				if nextEvent.CRTs < minResolvedTs {
-					log.Panic("remaining event CRTs too small", zap.Uint64("next-ts", nextEvent.CRTs), zap.Uint64("minResolvedTs", minResolvedTs))
+					logger.Panic("remaining event CRTs too small", zap.Uint64("next-ts", nextEvent.CRTs), zap.Uint64("minResolvedTs", minResolvedTs))
 				}
 			}
 			return nil
@@ -191,8 +210,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 
 		failpoint.Inject("sorterDebug", func() {
 			if sortHeap.Len() > 0 {
-				log.Debug("Unified Sorter: start merging",
-					zap.String("table", tableNameFromCtx(ctx)),
+				logger.Debug("Unified Sorter: start merging",
 					zap.Uint64("minResolvedTs", minResolvedTs))
 			}
 		})
@@ -204,7 +222,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 			event := item.entry
 
 			if event.CRTs < task.lastTs {
-				log.Panic("unified sorter: ts regressed in one backEnd, bug?", zap.Uint64("cur-ts", event.CRTs), zap.Uint64("last-ts", task.lastTs))
+				logger.Panic("unified sorter: ts regressed in one backEnd, bug?", zap.Uint64("cur-ts", event.CRTs), zap.Uint64("last-ts", task.lastTs))
 			}
 			task.lastTs = event.CRTs
 
@@ -214,9 +232,9 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 						item := heap.Pop(sortHeap).(*sortItem)
 						task := item.data.(*flushTask)
 						event := item.entry
-						log.Debug("dump", zap.Reflect("event", event), zap.Int("heap-id", task.heapSorterID))
+						logger.Debug("dump", zap.Reflect("event", event), zap.Int("heap-id", task.heapSorterID))
 					}
-					log.Panic("unified sorter: output ts regressed, bug?",
+					logger.Panic("unified sorter: output ts regressed, bug?",
 						zap.Int("counter", counter),
 						zap.Uint64("minResolvedTs", minResolvedTs),
 						zap.Int("cur-heap-id", task.heapSorterID),
@@ -239,6 +257,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 					return ctx.Err()
 				case out <- event:
 					metricSorterEventCount.WithLabelValues("kv").Inc()
+					atomic.AddInt64(&stats.outputCount, 1)
 				}
 			}
 			counter += 1
@@ -261,6 +280,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 				// EOF
 				delete(workingSet, task)
 				delete(pendingSet, task)
+				onTaskDrained(task)
 
 				err := task.reader.resetAndClose()
 				if err != nil {
@@ -290,8 +310,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 
 			failpoint.Inject("sorterDebug", func() {
 				if counter%10 == 0 {
-					log.Debug("Merging progress",
-						zap.String("table", tableNameFromCtx(ctx)),
+					logger.Debug("Merging progress",
 						zap.Int("counter", counter))
 				}
 			})
@@ -303,13 +322,12 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 		}
 
 		if len(workingSet) != 0 {
-			log.Panic("unified sorter: merging ended prematurely, bug?", zap.Uint64("resolvedTs", minResolvedTs))
+			logger.Panic("unified sorter: merging ended prematurely, bug?", zap.Uint64("resolvedTs", minResolvedTs))
 		}
 
 		failpoint.Inject("sorterDebug", func() {
 			if counter > 0 {
-				log.Debug("Unified Sorter: merging ended",
-					zap.String("table", tableNameFromCtx(ctx)),
+				logger.Debug("Unified Sorter: merging ended",
 					zap.Uint64("resolvedTs", minResolvedTs), zap.Int("count", counter))
 			}
 		})
@@ -321,6 +339,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 		if counter > 0 {
 			// ignore empty merges for better visualization of metrics
 			metricSorterMergeCountHistogram.Observe(float64(counter))
+			metricSorterMergeDurationHistogram.Observe(time.Since(startTime).Seconds())
 		}
 
 		return nil
@@ -335,8 +354,7 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 			return ctx.Err()
 		case task := <-in:
 			if task == nil {
-				log.Info("Merger input channel closed, exiting",
-					zap.String("table", tableNameFromCtx(ctx)),
+				logger.Info("Merger input channel closed, exiting",
 					zap.Uint64("max-output", minResolvedTs))
 				return nil
 			}
@@ -362,6 +380,12 @@ func runMerger(ctx context.Context, numSorters int, in <-chan *flushTask, out ch
 				if err != nil {
 					return errors.Trace(err)
 				}
+				if stopAt != nil && stopAt(minResolvedTs) {
+					logger.Info("Unified Sorter: merger stopped safely", zap.Uint64("resolvedTs", minResolvedTs))
+					close(out)
+					mergerCleanUp(in)
+					return nil
+				}
 			}
 		case <-resolveTicker.C:
 			err := sendResolvedEvent(minResolvedTs)
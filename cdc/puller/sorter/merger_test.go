@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sorter
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"go.uber.org/zap/zapcore"
+)
+
+type mergerSuite struct{}
+
+var _ = check.Suite(&mergerSuite{})
+
+func (s *mergerSuite) TestTableFieldsInLogs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.InfoLevel)
+	defer restore()
+	ctx := util.PutCaptureAddrInCtx(context.Background(), "127.0.0.1:8300")
+	ctx = util.PutChangefeedIDInCtx(ctx, "test-changefeed")
+	ctx = util.PutTableInfoInCtx(ctx, 1, "`test`.`t`")
+
+	// the merger exits once the input is closed
+	in := make(chan *flushTask)
+	close(in)
+	err := runMerger(ctx, 1, in, make(chan *model.PolymorphicEvent, 1), &sorterStats{}, nil)
+	c.Assert(err, check.IsNil)
+
+	for _, msg := range []string{"Merger input channel closed, exiting", "Unified Sorter: merger exiting, cleaning up resources"} {
+		entries := logs.FilterMessage(msg).All()
+		c.Assert(entries, check.HasLen, 1)
+		fields := entries[0].ContextMap()
+		c.Assert(fields["changefeed"], check.Equals, "test-changefeed")
+		c.Assert(fields["capture"], check.Equals, "127.0.0.1:8300")
+		c.Assert(fields["table-id"], check.Equals, int64(1))
+		c.Assert(fields["table-name"], check.Equals, "`test`.`t`")
+	}
+}
@@ -82,6 +82,50 @@ var (
 		Help:      "Bucketed histogram of the number of events in individual merges performed by the sorter",
 		Buckets:   prometheus.ExponentialBuckets(16, 4, 10),
 	}, []string{"capture", "changefeed", "table"})
+
+	sorterFlushDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "flush_duration",
+		Help:      "Bucketed histogram of the time (s) spent in writing individual flushes to the backends",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+	}, []string{"capture", "changefeed", "table"})
+
+	sorterMergeDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "merge_duration",
+		Help:      "Bucketed histogram of the time (s) spent in individual merges performed by the sorter",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+	}, []string{"capture", "changefeed", "table"})
+
+	sorterIOBytesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "io_bytes",
+		Help:      "the amount of data written to and read from the backends by the sorter",
+	}, []string{"capture", "changefeed", "table", "type"})
+
+	sorterOnDiskBackendCountGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "on_disk_backend_count_gauge",
+		Help:      "the number of on-disk backends held by the sorter",
+	}, []string{"capture", "changefeed", "table"})
+
+	sorterHeapSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "heap_size_gauge",
+		Help:      "the estimated amount of data in the heaps of the sorter which are not flushed yet",
+	}, []string{"capture", "changefeed", "table"})
+
+	sorterResolvedTsLagGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ticdc",
+		Subsystem: "sorter",
+		Name:      "resolved_ts_lag_gauge",
+		Help:      "the lag (s) of the resolved ts output by the sorter behind the resolved ts input to the sorter",
+	}, []string{"capture", "changefeed", "table"})
 )
 
 // InitMetrics registers all metrics in this file
@@ -95,4 +139,10 @@ func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(sorterOpenFileCountGauge)
 	registry.MustRegister(sorterFlushCountHistogram)
 	registry.MustRegister(sorterMergeCountHistogram)
+	registry.MustRegister(sorterFlushDurationHistogram)
+	registry.MustRegister(sorterMergeDurationHistogram)
+	registry.MustRegister(sorterIOBytesCounter)
+	registry.MustRegister(sorterOnDiskBackendCountGauge)
+	registry.MustRegister(sorterHeapSizeGauge)
+	registry.MustRegister(sorterResolvedTsLagGauge)
 }
@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sorter
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// SafeStopper decides the resolved ts a sorter stops at for the SafeStop of
+// the puller.EventSorter. If a resolved ts added is not output yet when
+// SafeStop is called, the sorter stops at the last one added, otherwise it
+// stops at the next one added. The events added after the stop ts are
+// dropped, so nothing after the stop ts is sorted or output.
+type SafeStopper struct {
+	// dropping is set once the stop ts is decided, the entries are checked
+	// with it without the lock
+	dropping int32
+
+	mu               sync.Mutex
+	stopping         bool
+	stopTs           uint64
+	inputResolvedTs  uint64
+	outputResolvedTs uint64
+}
+
+// SafeStop requests the sorter to stop
+func (s *SafeStopper) SafeStop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return
+	}
+	s.stopping = true
+	if s.inputResolvedTs > s.outputResolvedTs {
+		s.stopAt(s.inputResolvedTs)
+	}
+}
+
+func (s *SafeStopper) stopAt(ts uint64) {
+	s.stopTs = ts
+	atomic.StoreInt32(&s.dropping, 1)
+}
+
+// Admit is called before the entry is added to the sorter, it returns false
+// if the entry is added after the stop ts and must be dropped.
+func (s *SafeStopper) Admit(entry *model.PolymorphicEvent) bool {
+	if atomic.LoadInt32(&s.dropping) != 0 {
+		return false
+	}
+	if entry.RawKV == nil || entry.RawKV.OpType != model.OpTypeResolved {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if atomic.LoadInt32(&s.dropping) != 0 {
+		return false
+	}
+	s.inputResolvedTs = entry.CRTs
+	if s.stopping {
+		s.stopAt(entry.CRTs)
+	}
+	return true
+}
+
+// ResolvedOutput is called after the resolved event is output by the sorter
+func (s *SafeStopper) ResolvedOutput(ts uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ts > s.outputResolvedTs {
+		s.outputResolvedTs = ts
+	}
+}
+
+// Stopped returns true if the resolved event of the stop ts is output, the
+// sorter must close its output then.
+func (s *SafeStopper) Stopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return atomic.LoadInt32(&s.dropping) != 0 && s.outputResolvedTs >= s.stopTs
+}
+
+// MaxResolvedTs returns the max resolved ts output
+func (s *SafeStopper) MaxResolvedTs() model.Ts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outputResolvedTs
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sorter
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type safeStopSuite struct{}
+
+var _ = check.Suite(&safeStopSuite{})
+
+func (s *safeStopSuite) TestStopAtNextResolvedTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	stopper := &SafeStopper{}
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 5)), check.IsTrue)
+	stopper.ResolvedOutput(5)
+
+	// all the resolved ts added are output, the sorter stops at the next one
+	stopper.SafeStop()
+	c.Assert(stopper.Stopped(), check.IsFalse)
+	c.Assert(stopper.Admit(model.NewPolymorphicEvent(&model.RawKVEntry{OpType: model.OpTypePut, CRTs: 6})), check.IsTrue)
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 10)), check.IsTrue)
+	c.Assert(stopper.Admit(model.NewPolymorphicEvent(&model.RawKVEntry{OpType: model.OpTypePut, CRTs: 11})), check.IsFalse)
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 20)), check.IsFalse)
+	c.Assert(stopper.Stopped(), check.IsFalse)
+	stopper.ResolvedOutput(9)
+	c.Assert(stopper.Stopped(), check.IsFalse)
+	stopper.ResolvedOutput(10)
+	c.Assert(stopper.Stopped(), check.IsTrue)
+	c.Assert(stopper.MaxResolvedTs(), check.Equals, uint64(10))
+}
+
+func (s *safeStopSuite) TestStopAtResolvedTsAdded(c *check.C) {
+	defer testleak.AfterTest(c)()
+	stopper := &SafeStopper{}
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 5)), check.IsTrue)
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 8)), check.IsTrue)
+	stopper.ResolvedOutput(5)
+
+	// the resolved ts added but not output yet is the one the sorter stops at
+	stopper.SafeStop()
+	stopper.SafeStop()
+	c.Assert(stopper.Admit(model.NewResolvedPolymorphicEvent(0, 10)), check.IsFalse)
+	c.Assert(stopper.Stopped(), check.IsFalse)
+	stopper.ResolvedOutput(8)
+	c.Assert(stopper.Stopped(), check.IsTrue)
+	c.Assert(stopper.MaxResolvedTs(), check.Equals, uint64(8))
+}
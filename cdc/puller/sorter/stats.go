@@ -0,0 +1,136 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sorter
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const (
+	statsUpdateInterval = 1 * time.Second
+	// slowMergeThreshold is the number of consecutive update intervals in
+	// which the merger outputs less events than the sorter receives, before
+	// the merger is reported to be slow.
+	slowMergeThreshold = 30
+)
+
+// sorterStats collects the statistics of the UnifiedSorter of a table, the
+// fields are accessed atomically.
+type sorterStats struct {
+	inputCount       int64
+	outputCount      int64
+	onDiskBackends   int64
+	heapSizeBytes    int64
+	inputResolvedTs  uint64
+	outputResolvedTs uint64
+}
+
+// slowMergeDetector detects whether the merger falls behind the input of the
+// sorter for a sustained period.
+type slowMergeDetector struct {
+	threshold  int
+	slowTicks  int
+	lastInput  int64
+	lastOutput int64
+}
+
+// observe is called once per update interval with the total number of the
+// events input to and output by the sorter. It returns true if the merger has
+// been slower than the input for threshold intervals, and then restarts the
+// detection.
+func (d *slowMergeDetector) observe(input, output int64) bool {
+	inputRate := input - d.lastInput
+	outputRate := output - d.lastOutput
+	d.lastInput = input
+	d.lastOutput = output
+	if outputRate >= inputRate {
+		d.slowTicks = 0
+		return false
+	}
+	d.slowTicks++
+	if d.slowTicks < d.threshold {
+		return false
+	}
+	d.slowTicks = 0
+	return true
+}
+
+// runStats updates the gauges of the sorter and detects the slow merges until
+// the context is canceled. The metrics of the table are deleted on exit.
+func (s *UnifiedSorter) runStats(ctx context.Context, captureAddr, changefeedID, tableName string) error {
+	metricOnDiskBackendCount := sorterOnDiskBackendCountGauge.WithLabelValues(captureAddr, changefeedID, tableName)
+	metricHeapSize := sorterHeapSizeGauge.WithLabelValues(captureAddr, changefeedID, tableName)
+	metricResolvedTsLag := sorterResolvedTsLagGauge.WithLabelValues(captureAddr, changefeedID, tableName)
+	defer deleteTableMetrics(captureAddr, changefeedID, tableName)
+
+	detector := &slowMergeDetector{threshold: slowMergeThreshold}
+	ticker := time.NewTicker(statsUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		metricOnDiskBackendCount.Set(float64(atomic.LoadInt64(&s.stats.onDiskBackends)))
+		metricHeapSize.Set(float64(atomic.LoadInt64(&s.stats.heapSizeBytes)))
+
+		inputResolvedTs := atomic.LoadUint64(&s.stats.inputResolvedTs)
+		outputResolvedTs := atomic.LoadUint64(&s.stats.outputResolvedTs)
+		var lag float64
+		if inputResolvedTs > outputResolvedTs {
+			lag = float64(oracle.ExtractPhysical(inputResolvedTs)-oracle.ExtractPhysical(outputResolvedTs)) / 1e3
+		}
+		metricResolvedTsLag.Set(lag)
+
+		input := atomic.LoadInt64(&s.stats.inputCount)
+		output := atomic.LoadInt64(&s.stats.outputCount)
+		if detector.observe(input, output) {
+			log.Warn("Unified Sorter: merging is slower than the input",
+				zap.String("table", tableName),
+				zap.String("changefeed", changefeedID),
+				zap.Duration("duration", statsUpdateInterval*slowMergeThreshold),
+				zap.Int64("pending-events", input-output),
+				zap.Uint64("input-resolvedTs", inputResolvedTs),
+				zap.Uint64("output-resolvedTs", outputResolvedTs))
+		}
+	}
+}
+
+// deleteTableMetrics deletes the label sets of the table from the metrics of
+// the sorter.
+func deleteTableMetrics(captureAddr, changefeedID, tableName string) {
+	for _, tp := range []string{"kv", "resolved"} {
+		sorterConsumeCount.DeleteLabelValues(captureAddr, changefeedID, tableName, tp)
+		sorterEventCount.DeleteLabelValues(captureAddr, changefeedID, tableName, tp)
+	}
+	for _, tp := range []string{"read", "write"} {
+		sorterIOBytesCounter.DeleteLabelValues(captureAddr, changefeedID, tableName, tp)
+	}
+	sorterResolvedTsGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterMergerStartTsGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterFlushCountHistogram.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterMergeCountHistogram.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterFlushDurationHistogram.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterMergeDurationHistogram.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterOnDiskBackendCountGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterHeapSizeGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
+	sorterResolvedTsLagGauge.DeleteLabelValues(captureAddr, changefeedID, tableName)
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sorter
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type sorterStatsSuite struct{}
+
+var _ = check.Suite(&sorterStatsSuite{})
+
+func (s *sorterStatsSuite) TestSlowMergeDetector(c *check.C) {
+	defer testleak.AfterTest(c)()
+	d := &slowMergeDetector{threshold: 3}
+
+	// the merger keeps up with the input
+	c.Assert(d.observe(100, 100), check.IsFalse)
+	c.Assert(d.observe(200, 200), check.IsFalse)
+
+	// the merger is slower than the input, but not for long enough
+	c.Assert(d.observe(300, 250), check.IsFalse)
+	c.Assert(d.observe(400, 300), check.IsFalse)
+	c.Assert(d.observe(400, 400), check.IsFalse)
+
+	c.Assert(d.observe(500, 450), check.IsFalse)
+	c.Assert(d.observe(600, 500), check.IsFalse)
+	c.Assert(d.observe(700, 550), check.IsTrue)
+	// the detection is restarted after reporting
+	c.Assert(d.observe(800, 600), check.IsFalse)
+}
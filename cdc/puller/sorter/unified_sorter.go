@@ -16,6 +16,7 @@ package sorter
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
@@ -33,6 +34,8 @@ type UnifiedSorter struct {
 	dir       string
 	pool      *backEndPool
 	tableName string // used only for debugging and tracing
+	stats     *sorterStats
+	stopper   SafeStopper
 }
 
 type ctxKey struct {
@@ -54,6 +57,7 @@ func NewUnifiedSorter(dir string, tableName string, captureAddr string) *Unified
 		dir:       dir,
 		pool:      pool,
 		tableName: tableName,
+		stats:     &sorterStats{},
 	}
 }
 
@@ -94,7 +98,7 @@ func (s *UnifiedSorter) Run(ctx context.Context) error {
 	heapSorters := make([]*heapSorter, sorterConfig.NumConcurrentWorker)
 	for i := range heapSorters {
 		finalI := i
-		heapSorters[finalI] = newHeapSorter(finalI, heapSorterCollectCh)
+		heapSorters[finalI] = newHeapSorter(finalI, heapSorterCollectCh, s.stats)
 		heapSorters[finalI].init(subctx, func(err error) {
 			heapSorterErrOnce.Do(func() {
 				heapSorterErrCh <- err
@@ -123,7 +127,14 @@ func (s *UnifiedSorter) Run(ctx context.Context) error {
 	})
 
 	errg.Go(func() error {
-		return printError(runMerger(subctx, numConcurrentHeaps, heapSorterCollectCh, s.outputCh))
+		return printError(runMerger(subctx, numConcurrentHeaps, heapSorterCollectCh, s.outputCh, s.stats, s.stopAt))
+	})
+
+	errg.Go(func() error {
+		captureAddr := util.CaptureAddrFromCtx(ctx)
+		changefeedID := util.ChangefeedIDFromCtx(ctx)
+		_, tableName := util.TableIDFromCtx(ctx)
+		return s.runStats(subctx, captureAddr, changefeedID, tableName)
 	})
 
 	errg.Go(func() error {
@@ -144,6 +155,7 @@ func (s *UnifiedSorter) Run(ctx context.Context) error {
 				return subctx.Err()
 			case event := <-s.inputCh:
 				if event.RawKV != nil && event.RawKV.OpType == model.OpTypeResolved {
+					atomic.StoreUint64(&s.stats.inputResolvedTs, event.CRTs)
 					// broadcast resolved events
 					for _, sorter := range heapSorters {
 						select {
@@ -172,6 +184,7 @@ func (s *UnifiedSorter) Run(ctx context.Context) error {
 						return errors.Trace(err)
 					}
 					metricSorterConsumeCount.WithLabelValues("kv").Inc()
+					atomic.AddInt64(&s.stats.inputCount, 1)
 				}
 			}
 		}
@@ -182,6 +195,9 @@ func (s *UnifiedSorter) Run(ctx context.Context) error {
 
 // AddEntry implements the EventSorter interface
 func (s *UnifiedSorter) AddEntry(ctx context.Context, entry *model.PolymorphicEvent) {
+	if !s.stopper.Admit(entry) {
+		return
+	}
 	select {
 	case <-ctx.Done():
 		return
@@ -194,6 +210,23 @@ func (s *UnifiedSorter) Output() <-chan *model.PolymorphicEvent {
 	return s.outputCh
 }
 
+// SafeStop implements the EventSorter interface
+func (s *UnifiedSorter) SafeStop() {
+	s.stopper.SafeStop()
+}
+
+// MaxResolvedTs implements the EventSorter interface
+func (s *UnifiedSorter) MaxResolvedTs() model.Ts {
+	return s.stopper.MaxResolvedTs()
+}
+
+// stopAt records the resolved ts output by the merger, and returns true if the
+// sorter stops at it
+func (s *UnifiedSorter) stopAt(resolvedTs uint64) bool {
+	s.stopper.ResolvedOutput(resolvedTs)
+	return s.stopper.Stopped()
+}
+
 // RunWorkerPool runs the worker pool used by the heapSorters
 // It **must** be running for Unified Sorter to work.
 func RunWorkerPool(ctx context.Context) error {
@@ -210,3 +210,95 @@ func testSorter(ctx context.Context, c *check.C, sorter EventSorter, count int)
 	}
 	c.Assert(err, check.IsNil)
 }
+
+// TestSorterSafeStop checks the EventSorter contract of SafeStop, which every
+// sorter implementation must hold.
+func (s *sorterSuite) TestSorterSafeStop(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer sorter2.UnifiedSorterCleanUp()
+
+	config.SetSorterConfig(&config.SorterConfig{
+		NumConcurrentWorker:    4,
+		ChunkSizeLimit:         1 * 1024 * 1024 * 1024,
+		MaxMemoryPressure:      60,
+		MaxMemoryConsumption:   16 * 1024 * 1024 * 1024,
+		NumWorkerPoolGoroutine: 4,
+	})
+
+	sorters := map[string]func() EventSorter{
+		"memory": func() EventSorter { return NewEntrySorter() },
+		"file":   func() EventSorter { return NewFileSorter(c.MkDir()) },
+		"unified": func() EventSorter {
+			return sorter2.NewUnifiedSorter(c.MkDir(), "test", "0.0.0.0:0")
+		},
+	}
+	for name, newSorter := range sorters {
+		testSorterSafeStop(c, name, newSorter())
+	}
+}
+
+func testSorterSafeStop(c *check.C, name string, sorter EventSorter) {
+	comment := check.Commentf("sorter: %s", name)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		return sorter.Run(ctx)
+	})
+	errg.Go(func() error {
+		return sorter2.RunWorkerPool(ctx)
+	})
+
+	// read the output until the resolved event of the ts, or until the output
+	// is closed if the ts is zero
+	readOutput := func(resolvedTs uint64) (puts []uint64, closed bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				c.Fatalf("the output is not received, %s", comment.CheckCommentString())
+			case event, ok := <-sorter.Output():
+				if !ok {
+					return puts, true
+				}
+				if event.RawKV.OpType != model.OpTypeResolved {
+					puts = append(puts, event.CRTs)
+					continue
+				}
+				if resolvedTs != 0 && event.CRTs >= resolvedTs {
+					return puts, false
+				}
+			}
+		}
+	}
+
+	for _, ts := range []uint64{3, 1, 2, 5, 4} {
+		sorter.AddEntry(ctx, model.NewPolymorphicEvent(generateMockRawKV(ts)))
+	}
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 5))
+	puts, closed := readOutput(5)
+	c.Assert(closed, check.IsFalse, comment)
+	c.Assert(puts, check.DeepEquals, []uint64{1, 2, 3, 4, 5}, comment)
+
+	// the sorter stops at the next resolved ts added, the events after it are
+	// dropped without blocking, even if they're more than the channels hold
+	sorter.SafeStop()
+	sorter.SafeStop()
+	for _, ts := range []uint64{8, 11, 6, 7} {
+		sorter.AddEntry(ctx, model.NewPolymorphicEvent(generateMockRawKV(ts)))
+	}
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 10))
+	for ts := uint64(12); ts < 200012; ts++ {
+		sorter.AddEntry(ctx, model.NewPolymorphicEvent(generateMockRawKV(ts)))
+	}
+	sorter.AddEntry(ctx, model.NewResolvedPolymorphicEvent(0, 300000))
+	puts, closed = readOutput(0)
+	c.Assert(closed, check.IsTrue, comment)
+	c.Assert(puts, check.DeepEquals, []uint64{6, 7, 8}, comment)
+	c.Assert(sorter.MaxResolvedTs(), check.Equals, uint64(10), comment)
+
+	cancel()
+	err := errg.Wait()
+	if errors.Cause(err) != context.Canceled {
+		c.Assert(err, check.IsNil, comment)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// resourceReader reads the resource usage of a capture
+type resourceReader interface {
+	// diskUsage returns the used and total bytes of the file system of dir
+	diskUsage(dir string) (used uint64, total uint64, err error)
+	// memoryUsage returns the RSS and the memory limit of the process
+	memoryUsage() (rss uint64, limit uint64, err error)
+}
+
+type systemResourceReader struct{}
+
+func (systemResourceReader) diskUsage(dir string) (uint64, uint64, error) {
+	return util.DiskUsage(dir)
+}
+
+func (systemResourceReader) memoryUsage() (uint64, uint64, error) {
+	return util.ProcessMemoryUsage()
+}
+
+type pressureLevel int
+
+const (
+	pressureNone pressureLevel = iota
+	pressureSoft
+	pressureHard
+)
+
+func (l pressureLevel) String() string {
+	switch l {
+	case pressureSoft:
+		return "soft"
+	case pressureHard:
+		return "hard"
+	}
+	return "none"
+}
+
+type resourcePressure struct {
+	level  pressureLevel
+	reason string
+}
+
+// resourceConsumer is a changefeed running in the capture
+type resourceConsumer struct {
+	changefeedID model.ChangeFeedID
+	priority     int
+	// sortDir is empty if the changefeed doesn't sort on disk
+	sortDir string
+	pause   func(err error)
+}
+
+// resourceMonitor samples the disk usage of sort dirs and the memory usage of
+// the capture, and pauses changefeeds before the resources are exhausted.
+type resourceMonitor struct {
+	cfg         *config.ResourceMonitorConfig
+	reader      resourceReader
+	captureAddr string
+	// paused records the changefeeds paused by the monitor which are still
+	// running in the capture, they are not paused again.
+	paused map[model.ChangeFeedID]struct{}
+}
+
+func newResourceMonitor(cfg *config.ResourceMonitorConfig, reader resourceReader, captureAddr string) *resourceMonitor {
+	return &resourceMonitor{
+		cfg:         cfg,
+		reader:      reader,
+		captureAddr: captureAddr,
+		paused:      make(map[model.ChangeFeedID]struct{}),
+	}
+}
+
+func (m *resourceMonitor) run(ctx context.Context, consumers func() []*resourceConsumer) error {
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-ticker.C:
+		}
+		m.check(consumers())
+	}
+}
+
+func (m *resourceMonitor) pressure(used, total uint64, softLimit, hardLimit int) (pressureLevel, int) {
+	if total == 0 {
+		return pressureNone, 0
+	}
+	percentage := int(used * 100 / total)
+	switch {
+	case hardLimit > 0 && percentage >= hardLimit:
+		return pressureHard, percentage
+	case softLimit > 0 && percentage >= softLimit:
+		return pressureSoft, percentage
+	}
+	return pressureNone, percentage
+}
+
+func (m *resourceMonitor) memoryPressure() resourcePressure {
+	if m.cfg.MemorySoftLimit == 0 && m.cfg.MemoryHardLimit == 0 {
+		return resourcePressure{}
+	}
+	rss, limit, err := m.reader.memoryUsage()
+	if err != nil {
+		log.Warn("get memory usage failed", zap.Error(err))
+		return resourcePressure{}
+	}
+	level, percentage := m.pressure(rss, limit, m.cfg.MemorySoftLimit, m.cfg.MemoryHardLimit)
+	resourceUsageGauge.WithLabelValues(m.captureAddr, "memory").Set(float64(percentage))
+	if level == pressureNone {
+		return resourcePressure{}
+	}
+	return resourcePressure{
+		level: level,
+		reason: fmt.Sprintf("memory usage %d%% (%d of %d bytes) reaches the %s limit",
+			percentage, rss, limit, level),
+	}
+}
+
+func (m *resourceMonitor) diskPressure(dirs map[string]struct{}) map[string]resourcePressure {
+	res := make(map[string]resourcePressure, len(dirs))
+	if m.cfg.DiskSoftLimit == 0 && m.cfg.DiskHardLimit == 0 {
+		return res
+	}
+	maxPercentage := 0
+	for dir := range dirs {
+		used, total, err := m.reader.diskUsage(dir)
+		if err != nil {
+			log.Warn("get disk usage failed", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		level, percentage := m.pressure(used, total, m.cfg.DiskSoftLimit, m.cfg.DiskHardLimit)
+		if percentage > maxPercentage {
+			maxPercentage = percentage
+		}
+		if level != pressureNone {
+			res[dir] = resourcePressure{
+				level: level,
+				reason: fmt.Sprintf("disk usage %d%% (%d of %d bytes) of sort dir %s reaches the %s limit",
+					percentage, used, total, dir, level),
+			}
+		}
+	}
+	resourceUsageGauge.WithLabelValues(m.captureAddr, "disk").Set(float64(maxPercentage))
+	return res
+}
+
+// check samples the resource usage and pauses changefeeds according to it.
+// All changefeeds under hard pressure are paused. Under soft pressure, the
+// changefeeds with the lowest priority are paused in each check, but the
+// running changefeeds with the highest priority are kept.
+func (m *resourceMonitor) check(consumers []*resourceConsumer) {
+	running := make(map[model.ChangeFeedID]struct{}, len(consumers))
+	dirs := make(map[string]struct{})
+	for _, consumer := range consumers {
+		running[consumer.changefeedID] = struct{}{}
+		if consumer.sortDir != "" {
+			dirs[consumer.sortDir] = struct{}{}
+		}
+	}
+	for changefeedID := range m.paused {
+		if _, ok := running[changefeedID]; !ok {
+			delete(m.paused, changefeedID)
+		}
+	}
+
+	memPressure := m.memoryPressure()
+	diskPressure := m.diskPressure(dirs)
+	var softConsumers []*resourceConsumer
+	softPressure := make(map[model.ChangeFeedID]resourcePressure)
+	for _, consumer := range consumers {
+		if _, ok := m.paused[consumer.changefeedID]; ok {
+			continue
+		}
+		pressure := memPressure
+		if p, ok := diskPressure[consumer.sortDir]; ok && p.level > pressure.level {
+			pressure = p
+		}
+		switch pressure.level {
+		case pressureHard:
+			m.pause(consumer, pressure)
+		case pressureSoft:
+			softConsumers = append(softConsumers, consumer)
+			softPressure[consumer.changefeedID] = pressure
+		}
+	}
+	if len(softConsumers) == 0 {
+		return
+	}
+
+	sort.Slice(softConsumers, func(i, j int) bool {
+		if softConsumers[i].priority != softConsumers[j].priority {
+			return softConsumers[i].priority < softConsumers[j].priority
+		}
+		return softConsumers[i].changefeedID < softConsumers[j].changefeedID
+	})
+	lowest := softConsumers[0].priority
+	highest := softConsumers[len(softConsumers)-1].priority
+	if lowest == highest {
+		log.Warn("capture is under resource pressure, no changefeed with lower priority can be paused",
+			zap.String("capture", m.captureAddr),
+			zap.String("reason", softPressure[softConsumers[0].changefeedID].reason))
+		return
+	}
+	for _, consumer := range softConsumers {
+		if consumer.priority != lowest {
+			break
+		}
+		m.pause(consumer, softPressure[consumer.changefeedID])
+	}
+}
+
+func (m *resourceMonitor) pause(consumer *resourceConsumer, pressure resourcePressure) {
+	log.Warn("pause changefeed because of resource pressure",
+		zap.String("capture", m.captureAddr),
+		zap.String("changefeed", consumer.changefeedID),
+		zap.Int("priority", consumer.priority),
+		zap.Stringer("level", pressure.level),
+		zap.String("reason", pressure.reason))
+	resourcePressurePauseCounter.WithLabelValues(m.captureAddr, pressure.level.String()).Inc()
+	m.paused[consumer.changefeedID] = struct{}{}
+	consumer.pause(cerror.ErrCaptureResourcePressure.GenWithStackByArgs(m.captureAddr, pressure.reason))
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type resourceMonitorSuite struct{}
+
+var _ = check.Suite(&resourceMonitorSuite{})
+
+type mockResourceReader struct {
+	// disk maps the dir to the used percentage
+	disk   map[string]uint64
+	memory uint64
+}
+
+func (r *mockResourceReader) diskUsage(dir string) (uint64, uint64, error) {
+	used, ok := r.disk[dir]
+	if !ok {
+		return 0, 0, errors.New("no such dir")
+	}
+	return used, 100, nil
+}
+
+func (r *mockResourceReader) memoryUsage() (uint64, uint64, error) {
+	return r.memory, 100, nil
+}
+
+type mockConsumers struct {
+	consumers []*resourceConsumer
+	paused    []model.ChangeFeedID
+	errs      []error
+}
+
+func (m *mockConsumers) add(changefeedID model.ChangeFeedID, priority int, sortDir string) {
+	m.consumers = append(m.consumers, &resourceConsumer{
+		changefeedID: changefeedID,
+		priority:     priority,
+		sortDir:      sortDir,
+		pause: func(err error) {
+			m.paused = append(m.paused, changefeedID)
+			m.errs = append(m.errs, err)
+		},
+	})
+}
+
+func (m *mockConsumers) drain() []model.ChangeFeedID {
+	paused := m.paused
+	m.paused = nil
+	return paused
+}
+
+func newTestResourceMonitor(reader resourceReader) *resourceMonitor {
+	return newResourceMonitor(&config.ResourceMonitorConfig{
+		DiskSoftLimit:   85,
+		DiskHardLimit:   95,
+		MemorySoftLimit: 80,
+		MemoryHardLimit: 90,
+	}, reader, "127.0.0.1:8300")
+}
+
+func (s *resourceMonitorSuite) TestPauseByPriority(c *check.C) {
+	defer testleak.AfterTest(c)()
+	reader := &mockResourceReader{memory: 50}
+	monitor := newTestResourceMonitor(reader)
+	consumers := &mockConsumers{}
+	consumers.add("cf-a", 1, "")
+	consumers.add("cf-b", 2, "")
+	consumers.add("cf-c", 3, "")
+	consumers.add("cf-d", 1, "")
+
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.HasLen, 0)
+
+	// the changefeeds with the lowest priority are paused first
+	reader.memory = 85
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.DeepEquals, []model.ChangeFeedID{"cf-a", "cf-d"})
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.DeepEquals, []model.ChangeFeedID{"cf-b"})
+	// the changefeed with the highest priority keeps running
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.HasLen, 0)
+
+	// all changefeeds are paused under hard pressure
+	reader.memory = 90
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.DeepEquals, []model.ChangeFeedID{"cf-c"})
+	for _, err := range consumers.errs {
+		c.Assert(cerror.ErrCaptureResourcePressure.Equal(err), check.IsTrue)
+	}
+	c.Assert(consumers.errs[0], check.ErrorMatches, ".*memory usage 85% .* reaches the soft limit.*")
+	c.Assert(consumers.errs[3], check.ErrorMatches, ".*memory usage 90% .* reaches the hard limit.*")
+
+	// the paused changefeeds are removed from the capture, and added back
+	// after they are resumed
+	monitor.check(nil)
+	c.Assert(monitor.paused, check.HasLen, 0)
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.HasLen, 4)
+}
+
+func (s *resourceMonitorSuite) TestDiskPressure(c *check.C) {
+	defer testleak.AfterTest(c)()
+	reader := &mockResourceReader{
+		memory: 10,
+		disk:   map[string]uint64{"/dir1": 96, "/dir2": 86},
+	}
+	monitor := newTestResourceMonitor(reader)
+	consumers := &mockConsumers{}
+	consumers.add("cf-dir1-a", 10, "/dir1")
+	consumers.add("cf-dir1-b", 20, "/dir1")
+	consumers.add("cf-dir2-a", 1, "/dir2")
+	consumers.add("cf-dir2-b", 2, "/dir2")
+	consumers.add("cf-memory", 0, "")
+	// the usage of dir3 can't be read
+	consumers.add("cf-dir3", 0, "/dir3")
+
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.DeepEquals, []model.ChangeFeedID{"cf-dir1-a", "cf-dir1-b", "cf-dir2-a"})
+	c.Assert(consumers.errs[0], check.ErrorMatches, ".*of sort dir /dir1 reaches the hard limit.*")
+	c.Assert(consumers.errs[2], check.ErrorMatches, ".*of sort dir /dir2 reaches the soft limit.*")
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.HasLen, 0)
+
+	// the limits are disabled
+	monitor.cfg.DiskSoftLimit = 0
+	monitor.cfg.DiskHardLimit = 0
+	monitor.check(nil)
+	monitor.check(consumers.consumers)
+	c.Assert(consumers.drain(), check.HasLen, 0)
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/tidb/executor"
+	"github.com/pingcap/tidb/util/mock"
+	"go.uber.org/zap"
+)
+
+// schemaBootstrapInterval is the minimum interval between two schema bootstrap
+// events of the same table, requests within the interval are postponed.
+const schemaBootstrapInterval = time.Minute
+
+// requestSchemaBootstrap marks the table to send a schema bootstrap event,
+// it's no-op if the schema bootstrap is not enabled in the changefeed.
+func (c *changeFeed) requestSchemaBootstrap(tableID model.TableID) {
+	if !c.schemaBootstrap {
+		return
+	}
+	c.bootstrapTables[tableID] = struct{}{}
+}
+
+// handleSchemaBootstrap sends schema bootstrap events of the requested tables
+// to the sink. The schema of the tables is taken from the schema snapshot of
+// the owner, which contains all the DDLs before the resolved ts, because the
+// resolved ts never exceeds the commit ts of a DDL which is not executed.
+func (c *changeFeed) handleSchemaBootstrap(ctx context.Context) error {
+	if !c.schemaBootstrap || len(c.bootstrapTables) == 0 {
+		return nil
+	}
+	if c.ddlState != model.ChangeFeedSyncDML {
+		return nil
+	}
+	ts := c.status.ResolvedTs
+	if ts < c.status.CheckpointTs {
+		ts = c.status.CheckpointTs
+	}
+	now := time.Now()
+	for tableID := range c.bootstrapTables {
+		if last, ok := c.lastBootstrapTime[tableID]; ok && now.Sub(last) < schemaBootstrapInterval {
+			continue
+		}
+		delete(c.bootstrapTables, tableID)
+		if _, ok := c.tables[tableID]; !ok {
+			log.Info("skip schema bootstrap of the table not replicated",
+				zap.String("changefeed", c.id), zap.Int64("tableID", tableID))
+			continue
+		}
+		tblInfo, ok := c.schema.TableByID(tableID)
+		if !ok {
+			return cerror.ErrSnapshotTableNotFound.GenWithStackByArgs(tableID)
+		}
+		ddlEvent, err := newSchemaBootstrapEvent(tblInfo, ts)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		err = c.sink.EmitDDLEvent(ctx, ddlEvent)
+		if err != nil && cerror.ErrDDLEventIgnored.NotEqual(err) {
+			return errors.Trace(err)
+		}
+		c.lastBootstrapTime[tableID] = now
+		log.Info("schema bootstrap event sent", zap.String("changefeed", c.id),
+			zap.Stringer("table", tblInfo.TableName), zap.Uint64("ts", ts))
+	}
+	return nil
+}
+
+// newSchemaBootstrapEvent builds a DDL event which carries the
+// `CREATE TABLE IF NOT EXISTS` statement of the table, so that consumers can
+// apply it idempotently.
+func newSchemaBootstrapEvent(tblInfo *model.TableInfo, ts uint64) (*model.DDLEvent, error) {
+	if tblInfo.IsView() || tblInfo.IsSequence() {
+		return nil, cerror.ErrSchemaBootstrapFailed.GenWithStack("table %d is not a base table", tblInfo.ID)
+	}
+	buf := new(bytes.Buffer)
+	err := executor.ConstructResultOfShowCreateTable(mock.NewContext(), tblInfo.TableInfo, nil, buf)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrSchemaBootstrapFailed, err)
+	}
+	query := strings.Replace(buf.String(), "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)
+
+	ddlEvent := &model.DDLEvent{
+		StartTs:     ts,
+		CommitTs:    ts,
+		Query:       query,
+		Type:        timodel.ActionCreateTable,
+		IsBootstrap: true,
+		TableInfo: &model.SimpleTableInfo{
+			Schema:     tblInfo.TableName.Schema,
+			Table:      tblInfo.TableName.Table,
+			TableID:    tblInfo.ID,
+			ColumnInfo: make([]*model.ColumnInfo, len(tblInfo.Columns)),
+		},
+	}
+	for i, colInfo := range tblInfo.Columns {
+		ddlEvent.TableInfo.ColumnInfo[i] = new(model.ColumnInfo)
+		ddlEvent.TableInfo.ColumnInfo[i].FromTiColumnInfo(colInfo)
+	}
+	return ddlEvent, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type schemaBootstrapSuite struct{}
+
+var _ = check.Suite(&schemaBootstrapSuite{})
+
+func (s *schemaBootstrapSuite) TestNewSchemaBootstrapEvent(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ft := types.NewFieldType(mysql.TypeLong)
+	ft.Flag |= mysql.PriKeyFlag | mysql.NotNullFlag
+	ft.Charset, ft.Collate = "binary", "binary"
+	tblInfo := model.WrapTableInfo(1, "test", 10, &timodel.TableInfo{
+		ID:         2,
+		Name:       timodel.NewCIStr("t1"),
+		PKIsHandle: true,
+		Columns: []*timodel.ColumnInfo{{
+			ID:        1,
+			Name:      timodel.NewCIStr("id"),
+			FieldType: *ft,
+			State:     timodel.StatePublic,
+		}},
+	})
+
+	ddl, err := newSchemaBootstrapEvent(tblInfo, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(ddl.IsBootstrap, check.IsTrue)
+	c.Assert(ddl.CommitTs, check.Equals, uint64(100))
+	c.Assert(ddl.Type, check.Equals, timodel.ActionCreateTable)
+	c.Assert(ddl.TableInfo.Schema, check.Equals, "test")
+	c.Assert(ddl.TableInfo.Table, check.Equals, "t1")
+	c.Assert(ddl.TableInfo.TableID, check.Equals, int64(2))
+	c.Assert(ddl.TableInfo.ColumnInfo, check.HasLen, 1)
+	c.Assert(strings.HasPrefix(ddl.Query, "CREATE TABLE IF NOT EXISTS `t1` ("), check.IsTrue, check.Commentf("query: %s", ddl.Query))
+	c.Assert(ddl.Query, check.Matches, "(?s).*PRIMARY KEY \\(`id`\\).*")
+}
+
+func (s *schemaBootstrapSuite) TestRequestSchemaBootstrap(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cf := &changeFeed{}
+	// no-op if the schema bootstrap is disabled
+	cf.requestSchemaBootstrap(1)
+	c.Assert(cf.bootstrapTables, check.HasLen, 0)
+
+	cf = &changeFeed{
+		schemaBootstrap:   true,
+		bootstrapTables:   make(map[model.TableID]struct{}),
+		lastBootstrapTime: make(map[model.TableID]time.Time),
+	}
+	cf.requestSchemaBootstrap(1)
+	cf.requestSchemaBootstrap(1)
+	c.Assert(cf.bootstrapTables, check.DeepEquals, map[model.TableID]struct{}{1: {}})
+}
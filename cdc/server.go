@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -27,11 +28,13 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/puller/sorter"
+	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/httputil"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/version"
+	tidbkv "github.com/pingcap/tidb/kv"
 	"github.com/prometheus/client_golang/prometheus"
 	pd "github.com/tikv/pd/client"
 	"go.etcd.io/etcd/mvcc"
@@ -49,6 +52,17 @@ const (
 	DefaultCDCGCSafePointTTL = 24 * 60 * 60
 )
 
+// The modes of the server
+const (
+	// ServerModeNormal runs the owner election and replicates the tables
+	ServerModeNormal = "normal"
+	// ServerModeObserver runs a read-only capture, which serves the queries
+	// and the metrics derived from etcd without replicating any table
+	ServerModeObserver = "observer"
+)
+
+var clusterIDRe = regexp.MustCompile(`^[a-zA-Z0-9]+(\-[a-zA-Z0-9]+)*$`)
+
 type options struct {
 	pdEndpoints            string
 	credential             *security.Credential
@@ -58,6 +72,11 @@ type options struct {
 	timezone               *time.Location
 	ownerFlushInterval     time.Duration
 	processorFlushInterval time.Duration
+	clusterID              string
+	resourceMonitor        *config.ResourceMonitorConfig
+	notify                 *config.NotifyConfig
+	mode                   string
+	zone                   string
 }
 
 func (o *options) validateAndAdjust() error {
@@ -80,9 +99,30 @@ func (o *options) validateAndAdjust() error {
 	} else {
 		return cerror.ErrInvalidServerOption.GenWithStack("advertise address or address does not contain a port")
 	}
+	if o.clusterID != "" && !clusterIDRe.MatchString(o.clusterID) {
+		return cerror.ErrInvalidServerOption.GenWithStack("cluster ID %s doesn't match the pattern %s", o.clusterID, clusterIDRe)
+	}
 	if o.gcTTL == 0 {
 		return cerror.ErrInvalidServerOption.GenWithStack("empty GC TTL is not allowed")
 	}
+	switch o.mode {
+	case "":
+		o.mode = ServerModeNormal
+	case ServerModeNormal, ServerModeObserver:
+	default:
+		return cerror.ErrInvalidServerOption.GenWithStack("invalid mode %s, it should be %s or %s",
+			o.mode, ServerModeNormal, ServerModeObserver)
+	}
+	if o.resourceMonitor != nil {
+		if err := o.resourceMonitor.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.notify != nil {
+		if err := o.notify.Validate(); err != nil {
+			return err
+		}
+	}
 	var tlsConfig *tls.Config
 	if o.credential != nil {
 		var err error
@@ -164,6 +204,46 @@ func Credential(credential *security.Credential) ServerOption {
 	}
 }
 
+// ClusterID returns a ServerOption that sets the ID of the TiCDC cluster, which
+// namespaces the keys in etcd, so that multiple TiCDC clusters can share one PD.
+func ClusterID(id string) ServerOption {
+	return func(o *options) {
+		o.clusterID = id
+	}
+}
+
+// ResourceMonitor returns a ServerOption that sets the thresholds of pausing
+// changefeeds when the disk or memory of the capture is under pressure.
+func ResourceMonitor(cfg *config.ResourceMonitorConfig) ServerOption {
+	return func(o *options) {
+		o.resourceMonitor = cfg
+	}
+}
+
+// Notify returns a ServerOption that sets the global webhook notified of the
+// state transitions and the checkpoint lag of the changefeeds.
+func Notify(cfg *config.NotifyConfig) ServerOption {
+	return func(o *options) {
+		o.notify = cfg
+	}
+}
+
+// Mode returns a ServerOption that sets the mode of the server, which is
+// ServerModeNormal by default.
+func Mode(mode string) ServerOption {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// Zone returns a ServerOption that sets the zone of the server, the tables are
+// preferred to be replicated by the captures in the zones of their leaders.
+func Zone(zone string) ServerOption {
+	return func(o *options) {
+		o.zone = zone
+	}
+}
+
 // A ServerOption sets options such as the addr of PD.
 type ServerOption func(*options)
 
@@ -176,6 +256,10 @@ type Server struct {
 	statusServer *http.Server
 	pdClient     pd.Client
 	pdEndpoints  []string
+
+	// the status server is started before the kv storage is created
+	kvStorageMu sync.RWMutex
+	kvStorage   tidbkv.Storage
 }
 
 // NewServer creates a Server instance.
@@ -195,6 +279,11 @@ func NewServer(opt ...ServerOption) (*Server, error) {
 		zap.Any("timezone", opts.timezone),
 		zap.Duration("owner-flush-interval", opts.ownerFlushInterval),
 		zap.Duration("processor-flush-interval", opts.processorFlushInterval),
+		zap.String("cluster-id", opts.clusterID),
+		zap.Any("resource-monitor", opts.resourceMonitor),
+		zap.Any("notify", opts.notify),
+		zap.String("mode", opts.mode),
+		zap.String("zone", opts.zone),
 	)
 
 	s := &Server{
@@ -228,7 +317,9 @@ func (s *Server) Run(ctx context.Context) error {
 	if err != nil {
 		return cerror.WrapError(cerror.ErrServerNewPDClient, err)
 	}
-	s.pdClient = pdClient
+	// the region info requests of the kv clients of all tables in the capture
+	// are cached, coalesced and batched by the shared client
+	s.pdClient = kv.NewRegionInfoClient(pdClient, s.opts.advertiseAddr, kv.DefaultRegionInfoTTL, kv.DefaultRegionScanBatchWindow)
 
 	// To not block CDC server startup, we need to warn instead of error
 	// when TiKV is incompatible.
@@ -246,13 +337,16 @@ func (s *Server) Run(ctx context.Context) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	s.setKVStorage(kvStore)
 	defer func() {
+		s.setKVStorage(nil)
 		err := kvStore.Close()
 		if err != nil {
 			log.Warn("kv store close failed", zap.Error(err))
 		}
 	}()
 	ctx = util.PutKVStorageInCtx(ctx, kvStore)
+	ctx = util.PutClusterIDInCtx(ctx, s.opts.clusterID)
 	// When a capture suicided, restart it
 	for {
 		if err := s.run(ctx); cerror.ErrCaptureSuicide.NotEqual(err) {
@@ -262,6 +356,18 @@ func (s *Server) Run(ctx context.Context) error {
 	}
 }
 
+func (s *Server) setKVStorage(kvStorage tidbkv.Storage) {
+	s.kvStorageMu.Lock()
+	defer s.kvStorageMu.Unlock()
+	s.kvStorage = kvStorage
+}
+
+func (s *Server) getKVStorage() tidbkv.Storage {
+	s.kvStorageMu.RLock()
+	defer s.kvStorageMu.RUnlock()
+	return s.kvStorage
+}
+
 func (s *Server) setOwner(owner *Owner) {
 	s.ownerLock.Lock()
 	defer s.ownerLock.Unlock()
@@ -300,6 +406,7 @@ func (s *Server) campaignOwnerLoop(ctx context.Context) error {
 			log.Warn("create new owner failed", zap.Error(err))
 			continue
 		}
+		owner.notifier = newWebhookNotifier(s.opts.notify)
 
 		s.setOwner(owner)
 		if err := owner.Run(ctx, ownerRunInterval); err != nil {
@@ -370,7 +477,12 @@ func (s *Server) run(ctx context.Context) (err error) {
 	ctx = util.PutCaptureAddrInCtx(ctx, s.opts.advertiseAddr)
 	ctx = util.PutTimezoneInCtx(ctx, s.opts.timezone)
 
-	procOpts := &processorOpts{flushCheckpointInterval: s.opts.processorFlushInterval}
+	observer := s.opts.mode == ServerModeObserver
+	procOpts := &processorOpts{
+		flushCheckpointInterval: s.opts.processorFlushInterval,
+		observer:                observer,
+		zone:                    s.opts.zone,
+	}
 	capture, err := NewCapture(ctx, s.pdEndpoints, s.pdClient, s.opts.credential, s.opts.advertiseAddr, procOpts)
 	if err != nil {
 		return err
@@ -381,6 +493,18 @@ func (s *Server) run(ctx context.Context) (err error) {
 
 	wg, cctx := errgroup.WithContext(ctx)
 
+	// the observer only serves the read paths, it neither campaigns the
+	// owner nor runs the processors
+	if observer {
+		wg.Go(func() error {
+			return s.etcdHealthChecker(cctx)
+		})
+		wg.Go(func() error {
+			return s.capture.Run(cctx)
+		})
+		return wg.Wait()
+	}
+
 	wg.Go(func() error {
 		return s.campaignOwnerLoop(cctx)
 	})
@@ -397,6 +521,10 @@ func (s *Server) run(ctx context.Context) (err error) {
 		return s.capture.Run(cctx)
 	})
 
+	wg.Go(func() error {
+		return s.capture.runResourceMonitor(cctx, s.opts.resourceMonitor)
+	})
+
 	return wg.Wait()
 }
 
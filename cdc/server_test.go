@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/config"
 	"github.com/pingcap/ticdc/pkg/etcd"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
@@ -102,6 +103,39 @@ func (s *serverSuite) TestNewServer(c *check.C) {
 		AdvertiseAddress("advertise"))
 	c.Assert(err, check.ErrorMatches, ".*does not contain a port")
 	c.Assert(svr, check.IsNil)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		ClusterID("cluster/1"))
+	c.Assert(err, check.ErrorMatches, ".*cluster ID cluster/1 doesn't match.*")
+	c.Assert(svr, check.IsNil)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		ClusterID("cluster-1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(svr, check.NotNil)
+	c.Assert(svr.opts.clusterID, check.Equals, "cluster-1")
+	c.Assert(svr.opts.mode, check.Equals, ServerModeNormal)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		Mode("readonly"))
+	c.Assert(err, check.ErrorMatches, ".*invalid mode readonly.*")
+	c.Assert(svr, check.IsNil)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		Mode(ServerModeObserver))
+	c.Assert(err, check.IsNil)
+	c.Assert(svr, check.NotNil)
+	c.Assert(svr.opts.mode, check.Equals, ServerModeObserver)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		ResourceMonitor(&config.ResourceMonitorConfig{CheckInterval: time.Second, MemorySoftLimit: 95, MemoryHardLimit: 90}))
+	c.Assert(err, check.ErrorMatches, ".*memory soft limit 95% is larger than the hard limit 90%.*")
+	c.Assert(svr, check.IsNil)
+
+	svr, err = NewServer(PDEndpoints("http://pd"), Address("cdc:1234"), GCTTL(DefaultCDCGCSafePointTTL),
+		ResourceMonitor(&config.ResourceMonitorConfig{CheckInterval: time.Second, DiskHardLimit: 101}))
+	c.Assert(err, check.ErrorMatches, ".*disk limits must be in \\[0, 100\\].*")
+	c.Assert(svr, check.IsNil)
 }
 
 func (s *serverSuite) TestEtcdHealthChecker(c *check.C) {
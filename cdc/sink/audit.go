@@ -0,0 +1,257 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/pingcap/failpoint"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultAuditCacheSize is the number of the keys tracked by the audit sink if
+// the cache size is not set
+const defaultAuditCacheSize = 100000
+
+// The types of the violations found by the audit sink
+const (
+	// auditViolationOutOfOrder means a row of a key arrives after a row of
+	// the same key with a greater commit ts
+	auditViolationOutOfOrder = "out-of-order"
+	// auditViolationBelowResolvedTs means a row arrives with the commit ts not
+	// greater than the resolved ts flushed before
+	auditViolationBelowResolvedTs = "below-resolved-ts"
+)
+
+// auditEntry is the last row of a key sent to the audit sink
+type auditEntry struct {
+	key uint64
+	row *model.RowChangedEvent
+	// generation is the generation of the table when the row is sent, the
+	// entries of the previous generations are ignored.
+	generation uint64
+}
+
+// auditTable is the state of a table sent to the audit sink
+type auditTable struct {
+	generation uint64
+	// flushedTs is the max resolved ts flushed after the table is seen
+	flushedTs uint64
+}
+
+// auditSink wraps a sink and validates the order of the rows sent to it. The
+// commit ts of the rows of a handle key must be non-decreasing, and no row of
+// a table may arrive with the commit ts not greater than the resolved ts
+// flushed after the first row of the table. The violations are logged and
+// counted, the rows are still sent to the wrapped sink. The keys are tracked
+// by their hashes in an LRU cache, so the memory is bounded, and a hash
+// collision may be reported as a false violation.
+type auditSink struct {
+	Sink
+	changefeedID string
+	cacheSize    int
+	formatter    *model.EventLogFormatter
+
+	mu             sync.Mutex
+	keys           map[uint64]*list.Element
+	lru            *list.List
+	tables         map[model.TableID]*auditTable
+	nextGeneration uint64
+	reporter       ValidationReporter
+
+	outOfOrderCounter      prometheus.Counter
+	belowResolvedTsCounter prometheus.Counter
+}
+
+func newAuditSink(s Sink, cfg *config.ReplicaConfig, opts map[string]string) *auditSink {
+	cacheSize := cfg.Audit.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultAuditCacheSize
+	}
+	formatter, err := model.NewEventLogFormatter(cfg)
+	if err != nil {
+		log.Warn("invalid event log config, the default one is used by the audit sink", zap.Error(err))
+		formatter = model.DefaultEventLogFormatter
+	}
+	changefeedID, captureAddr := opts[OptChangefeedID], opts[OptCaptureAddr]
+	log.Info("the order of the rows sent to the sink is audited",
+		zap.String("changefeed", changefeedID), zap.Int("cacheSize", cacheSize))
+	return &auditSink{
+		Sink:                   s,
+		changefeedID:           changefeedID,
+		cacheSize:              cacheSize,
+		formatter:              formatter,
+		keys:                   make(map[uint64]*list.Element),
+		lru:                    list.New(),
+		tables:                 make(map[model.TableID]*auditTable),
+		outOfOrderCounter:      auditViolationCounter.WithLabelValues(captureAddr, changefeedID, auditViolationOutOfOrder),
+		belowResolvedTsCounter: auditViolationCounter.WithLabelValues(captureAddr, changefeedID, auditViolationBelowResolvedTs),
+	}
+}
+
+// Unwrap returns the sink wrapped by the audit sink and the compact sink, or
+// the sink itself if it's not wrapped. The optional interfaces of the sinks,
+// e.g. TableDispatchSink, are asserted on the unwrapped sink.
+func Unwrap(s Sink) Sink {
+	if audited, ok := s.(*auditSink); ok {
+		s = audited.Sink
+	}
+	if compacted, ok := s.(*compactSink); ok {
+		s = compacted.Sink
+	}
+	return s
+}
+
+// RemoveAuditedTable forgets the rows of the table sent to the audit sink, so
+// that the rows replicated again after the table is added back are not taken
+// as violations. It's no-op if the sink is not audited.
+func RemoveAuditedTable(s Sink, tableID model.TableID) {
+	if s, ok := s.(*auditSink); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.tables, tableID)
+	}
+}
+
+// ValidationReporter is reported the validation failures of the rows detected
+// by the sinks, e.g. by the processor tripping the circuit breaker.
+type ValidationReporter interface {
+	ReportValidationFailure(detector model.BreakerDetector, tableID model.TableID, message string)
+}
+
+// SetValidationReporter sets the reporter of the ordering violations found by
+// the audit sink and the mismatched rows found by the consistency checker,
+// it's no-op for the detectors not enabled for the sink.
+func SetValidationReporter(s Sink, reporter ValidationReporter) {
+	if audited, ok := s.(*auditSink); ok {
+		audited.mu.Lock()
+		audited.reporter = reporter
+		audited.mu.Unlock()
+	}
+	if s, ok := Unwrap(s).(*mysqlSink); ok {
+		s.checker.setReporter(reporter)
+	}
+}
+
+func (s *auditSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.mu.Lock()
+	for _, row := range rows {
+		s.audit(row)
+	}
+	s.mu.Unlock()
+	return s.Sink.EmitRowChangedEvents(ctx, rows...)
+}
+
+func (s *auditSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	// all the rows before the resolved ts are sent before the flush
+	s.mu.Lock()
+	for _, table := range s.tables {
+		if table.flushedTs < resolvedTs {
+			table.flushedTs = resolvedTs
+		}
+	}
+	s.mu.Unlock()
+	return s.Sink.FlushRowChangedEvents(ctx, resolvedTs)
+}
+
+// audit checks the row against the rows sent before, the caller must hold mu.
+func (s *auditSink) audit(row *model.RowChangedEvent) {
+	table, ok := s.tables[row.Table.TableID]
+	if !ok {
+		s.nextGeneration++
+		table = &auditTable{generation: s.nextGeneration}
+		s.tables[row.Table.TableID] = table
+	}
+	if row.CommitTs <= table.flushedTs {
+		s.belowResolvedTsCounter.Inc()
+		s.violate(auditViolationBelowResolvedTs, row, nil, zap.Uint64("flushedResolvedTs", table.flushedTs))
+	}
+	for _, key := range auditKeys(row) {
+		elem, ok := s.keys[key]
+		if !ok {
+			elem = s.lru.PushFront(&auditEntry{key: key})
+			s.keys[key] = elem
+			if s.lru.Len() > s.cacheSize {
+				oldest := s.lru.Back()
+				s.lru.Remove(oldest)
+				delete(s.keys, oldest.Value.(*auditEntry).key)
+			}
+		} else {
+			s.lru.MoveToFront(elem)
+		}
+		entry := elem.Value.(*auditEntry)
+		if entry.row != nil && entry.generation == table.generation && entry.row.CommitTs > row.CommitTs {
+			s.outOfOrderCounter.Inc()
+			s.violate(auditViolationOutOfOrder, row, entry.row)
+		}
+		entry.row = row
+		entry.generation = table.generation
+	}
+}
+
+func (s *auditSink) violate(typ string, row, last *model.RowChangedEvent, fields ...zap.Field) {
+	fields = append(fields, zap.String("changefeed", s.changefeedID), zap.String("type", typ),
+		zap.Uint64("commitTs", row.CommitTs), s.formatter.Row("row", row))
+	if last != nil {
+		fields = append(fields, zap.Uint64("lastCommitTs", last.CommitTs), s.formatter.Row("lastRow", last))
+	}
+	log.Error("the row sent to the sink violates the order", fields...)
+	if s.reporter != nil {
+		var message string
+		if last != nil {
+			message = fmt.Sprintf("%s row of commit ts %d after commit ts %d", typ, row.CommitTs, last.CommitTs)
+		} else {
+			message = fmt.Sprintf("%s row of commit ts %d", typ, row.CommitTs)
+		}
+		s.reporter.ReportValidationFailure(model.BreakerDetectorOrderingViolation, row.Table.TableID, message)
+	}
+	failpoint.Inject("SinkAuditPanicOnViolation", func() {
+		log.Panic("the row sent to the sink violates the order", fields...)
+	})
+}
+
+// auditKeys returns the hashes of the handle keys of the row before and after
+// the change, it's empty if the table has no handle key.
+func auditKeys(row *model.RowChangedEvent) []uint64 {
+	var keys []uint64
+	for _, cols := range [][]*model.Column{row.PreColumns, row.Columns} {
+		key, ok := hashHandleKey(row.Table.TableID, cols)
+		if ok && (len(keys) == 0 || keys[0] != key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func hashHandleKey(tableID model.TableID, cols []*model.Column) (uint64, bool) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d", tableID)
+	found := false
+	for _, col := range cols {
+		if col == nil || !col.Flag.IsHandleKey() {
+			continue
+		}
+		found = true
+		fmt.Fprintf(h, ",%s=%v", col.Name, col.Value)
+	}
+	return h.Sum64(), found
+}
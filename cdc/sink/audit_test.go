@@ -0,0 +1,169 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type auditSinkSuite struct{}
+
+var _ = check.Suite(&auditSinkSuite{})
+
+// discardSink discards the rows without checking them like the blackhole sink
+type discardSink struct {
+	*blackHoleSink
+}
+
+func (s *discardSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	return nil
+}
+
+func (s *discardSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	return model.FlushResult{CheckpointTs: resolvedTs}, nil
+}
+
+func newAuditTestSink(c *check.C, cacheSize int) *auditSink {
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Audit = &config.AuditConfig{Enable: true, CacheSize: cacheSize}
+	opts := map[string]string{OptChangefeedID: c.TestName(), OptCaptureAddr: "127.0.0.1:8300"}
+	return newAuditSink(&discardSink{}, cfg, opts)
+}
+
+func newAuditTestRow(tableID model.TableID, handle int64, commitTs uint64) *model.RowChangedEvent {
+	return &model.RowChangedEvent{
+		CommitTs: commitTs,
+		Table:    &model.TableName{Schema: "test", Table: "t", TableID: tableID},
+		Columns: []*model.Column{
+			{Name: "id", Value: handle, Flag: model.HandleKeyFlag},
+			{Name: "v", Value: "a"},
+		},
+	}
+}
+
+func (s *auditSinkSuite) TestOutOfOrder(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink := newAuditTestSink(c, 0)
+	emit := func(rows ...*model.RowChangedEvent) {
+		c.Assert(sink.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	}
+
+	emit(newAuditTestRow(1, 1, 10), newAuditTestRow(1, 1, 12), newAuditTestRow(1, 2, 5))
+	emit(newAuditTestRow(1, 1, 12))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(0))
+
+	// the row of a key arrives after a row of the key with a greater commit ts
+	emit(newAuditTestRow(1, 1, 11))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(1))
+	// the same handle of another table is another key
+	emit(newAuditTestRow(2, 1, 3))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(1))
+
+	// the handle key before the change is checked too
+	update := newAuditTestRow(1, 3, 4)
+	update.PreColumns = newAuditTestRow(1, 2, 4).Columns
+	emit(update)
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(2))
+
+	// the rows without handle key are not checked
+	row := newAuditTestRow(1, 1, 1)
+	row.Columns[0].Flag = 0
+	emit(row)
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(2))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(0))
+}
+
+func (s *auditSinkSuite) TestBelowResolvedTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink := newAuditTestSink(c, 0)
+	emit := func(rows ...*model.RowChangedEvent) {
+		c.Assert(sink.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	}
+	flush := func(resolvedTs uint64) {
+		_, err := sink.FlushRowChangedEvents(ctx, resolvedTs)
+		c.Assert(err, check.IsNil)
+	}
+
+	emit(newAuditTestRow(1, 1, 10))
+	flush(20)
+	// the row arrives after the resolved ts flushed
+	emit(newAuditTestRow(1, 2, 20))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(1))
+	emit(newAuditTestRow(1, 2, 21))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(1))
+
+	// the table added after the flush may start from an earlier ts
+	emit(newAuditTestRow(2, 1, 15))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(1))
+	flush(30)
+	emit(newAuditTestRow(2, 1, 25))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(2))
+
+	// the table added back is replicated from an earlier ts again
+	RemoveAuditedTable(sink, 1)
+	emit(newAuditTestRow(1, 2, 15))
+	c.Assert(testutil.ToFloat64(sink.belowResolvedTsCounter), check.Equals, float64(2))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(0))
+	emit(newAuditTestRow(1, 2, 14))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(1))
+}
+
+func (s *auditSinkSuite) TestCacheSize(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink := newAuditTestSink(c, 2)
+	emit := func(rows ...*model.RowChangedEvent) {
+		c.Assert(sink.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	}
+
+	emit(newAuditTestRow(1, 1, 10), newAuditTestRow(1, 2, 10))
+	// the recently used key is kept
+	emit(newAuditTestRow(1, 1, 11), newAuditTestRow(1, 3, 10))
+	c.Assert(sink.lru.Len(), check.Equals, 2)
+	emit(newAuditTestRow(1, 1, 9))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(1))
+	// the least recently used key is evicted, and not checked anymore
+	emit(newAuditTestRow(1, 2, 1))
+	c.Assert(testutil.ToFloat64(sink.outOfOrderCounter), check.Equals, float64(1))
+	c.Assert(sink.lru.Len(), check.Equals, 2)
+	c.Assert(sink.keys, check.HasLen, 2)
+}
+
+func (s *auditSinkSuite) TestNewSink(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Audit = &config.AuditConfig{Enable: true}
+	sink, err := NewSink(context.Background(), "test", "blackhole://", nil, cfg, map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(sink, check.FitsTypeOf, &auditSink{})
+	c.Assert(sink.(*auditSink).cacheSize, check.Equals, defaultAuditCacheSize)
+	c.Assert(Unwrap(sink), check.FitsTypeOf, &blackHoleSink{})
+
+	// the sink isn't wrapped if the audit is disabled
+	cfg = config.GetDefaultReplicaConfig()
+	sink, err = NewSink(context.Background(), "test", "blackhole://", nil, cfg, map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(sink, check.FitsTypeOf, &blackHoleSink{})
+	c.Assert(Unwrap(sink), check.Equals, sink)
+	// no-op on the sink not audited
+	RemoveAuditedTable(sink, 1)
+}
@@ -34,6 +34,9 @@ type blackHoleSink struct {
 	checkpointTs    uint64
 	accumulated     uint64
 	lastAccumulated uint64
+	// accumulatedSize is the approximate size of the rows emitted, they're
+	// flushed as soon as they're emitted
+	accumulatedSize uint64
 }
 
 func (b *blackHoleSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
@@ -44,15 +47,21 @@ func (b *blackHoleSink) EmitRowChangedEvents(ctx context.Context, rows ...*model
 				zap.Uint64("CommitTs", row.CommitTs),
 				zap.Uint64("checkpointTs", checkpointTs))
 		}
-		log.Debug("BlockHoleSink: EmitRowChangedEvents", zap.Any("row", row))
+		log.Debug("BlockHoleSink: EmitRowChangedEvents", model.DefaultEventLogFormatter.Row("row", row))
 	}
 	rowsCount := len(rows)
+	var size int64
+	for _, row := range rows {
+		size += row.ApproximateSize
+	}
 	atomic.AddUint64(&b.accumulated, uint64(rowsCount))
+	atomic.AddUint64(&b.accumulatedSize, uint64(size))
 	b.statistics.AddRowsCount(rowsCount)
+	b.statistics.AddSampledRows(rows)
 	return nil
 }
 
-func (b *blackHoleSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (b *blackHoleSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	log.Debug("BlockHoleSink: FlushRowChangedEvents", zap.Uint64("resolvedTs", resolvedTs))
 	err := b.statistics.RecordBatchExecution(func() (int, error) {
 		// TODO: add some random replication latency
@@ -61,9 +70,14 @@ func (b *blackHoleSink) FlushRowChangedEvents(ctx context.Context, resolvedTs ui
 		b.lastAccumulated = accumulated
 		return int(batchSize), nil
 	})
+	if err != nil {
+		return model.FlushResult{}, err
+	}
+	b.statistics.AddFlushedBytes(int64(atomic.SwapUint64(&b.accumulatedSize, 0)))
 	b.statistics.PrintStatus(ctx)
 	atomic.StoreUint64(&b.checkpointTs, resolvedTs)
-	return resolvedTs, err
+	b.statistics.ObserveFlushedRows(resolvedTs)
+	return b.statistics.TakeFlushResult(resolvedTs), nil
 }
 
 func (b *blackHoleSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
@@ -15,15 +15,20 @@ package cdclog
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	parsemodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/ticdc/cdc/model"
-	"github.com/pingcap/ticdc/cdc/sink/codec"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/quotes"
 	"github.com/uber-go/atomic"
@@ -34,9 +39,8 @@ const (
 	defaultDirMode  = 0o755
 	defaultFileMode = 0o644
 
-	defaultFileName = "cdclog"
-
-	maxRowFileSize = 10 << 20 // TODO update
+	maxRowFileSize        = 10 << 20 // rotate the log file of a table if it's larger than 10Mb
+	defaultRotateInterval = time.Hour
 )
 
 type logPath struct {
@@ -46,19 +50,23 @@ type logPath struct {
 }
 
 type tableStream struct {
-	dataCh  chan *model.RowChangedEvent
-	rowFile *os.File
+	dataCh chan *model.RowChangedEvent
+	sink   *fileSink
 
-	encoder codec.EventBatchEncoder
+	// mu protects the writer, which is written by the flush worker and
+	// committed by FlushRowChangedEvents
+	mu     sync.Mutex
+	writer *logWriter
 
 	tableID    int64
 	sendEvents *atomic.Int64
 	sendSize   *atomic.Int64
 }
 
-func newTableStream(tableID int64) logUnit {
+func (f *fileSink) newTableStream(tableID int64) logUnit {
 	return &tableStream{
 		tableID: tableID,
+		sink:    f,
 		dataCh:  make(chan *model.RowChangedEvent, defaultBufferChanSize),
 
 		sendEvents: atomic.NewInt64(0),
@@ -91,104 +99,133 @@ func (ts *tableStream) shouldFlush() bool {
 }
 
 func (ts *tableStream) flush(ctx context.Context, sink *logSink) error {
-	var fileName string
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	// the rows before the resolved ts are all emitted before it's flushed
+	resolvedTs := ts.sink.resolvedTs.Load()
 	flushedEvents := ts.sendEvents.Load()
 	flushedSize := ts.sendSize.Load()
 	if flushedEvents == 0 {
 		log.Info("[flushTableStreams] no events to flush")
 		return nil
 	}
-	firstCreated := false
-	if ts.encoder == nil {
-		// create encoder for each file
-		ts.encoder = sink.encoder()
-		firstCreated = true
+	if ts.writer == nil {
+		writer, err := ts.sink.openLogWriter(
+			filepath.Join(sink.root(), makeTableDirectoryName(ts.tableID)), ts.tableID, makeTableFileName)
+		if err != nil {
+			return err
+		}
+		ts.writer = writer
 	}
+	rows := make([]*model.RowChangedEvent, 0, flushedEvents)
 	for event := int64(0); event < flushedEvents; event++ {
 		row := <-ts.dataCh
-		if event == flushedEvents-1 {
-			// the last event
-			fileName = makeTableFileName(row.CommitTs)
+		// the rows committed before the sink is restarted are skipped
+		if ts.writer.committed(row.CommitTs) {
+			continue
 		}
-		_, err := ts.encoder.AppendRowChangedEvent(row)
+		rows = append(rows, row)
+	}
+	// the rows of a table are emitted in the order of the commit ts, the file
+	// is safe once the rows before the resolved ts are written
+	split := sort.Search(len(rows), func(i int) bool {
+		return rows[i].CommitTs > resolvedTs
+	})
+	size, err := ts.write(sink, rows[:split])
+	if err != nil {
+		return err
+	}
+	if split < len(rows) {
+		if err := ts.writer.markSafe(resolvedTs); err != nil {
+			return err
+		}
+		n, err := ts.write(sink, rows[split:])
 		if err != nil {
 			return err
 		}
+		size += n
 	}
-	rowDatas := ts.encoder.MixedBuild(firstCreated)
-	defer func() {
-		if ts.encoder != nil {
-			ts.encoder.Reset()
-		}
-	}()
 
 	log.Debug("[flushTableStreams] build cdc log data",
 		zap.Int64("table id", ts.tableID),
 		zap.Int64("flushed size", flushedSize),
 		zap.Int64("flushed event", flushedEvents),
-		zap.Int("encode size", len(rowDatas)),
-		zap.String("file name", fileName),
+		zap.Int("skipped event", int(flushedEvents)-len(rows)),
+		zap.Int("encode size", size),
 	)
 
-	tableDir := filepath.Join(sink.root(), makeTableDirectoryName(ts.tableID))
+	ts.sendEvents.Sub(flushedEvents)
+	ts.sendSize.Sub(flushedSize)
+	sink.addFlushed(int64(len(rows)), size)
+	return nil
+}
 
-	if ts.rowFile == nil {
-		// create new file to append data
-		err := os.MkdirAll(tableDir, defaultDirMode)
-		if err != nil {
-			return err
+// write encodes the rows in one batch and appends it to the active file
+func (ts *tableStream) write(sink *logSink, rows []*model.RowChangedEvent) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	// the version of the encoder is written once at the start of each file
+	newFile := ts.writer.newFile()
+	encoder := sink.encoder()
+	if !newFile {
+		encoder.Reset()
+	}
+	schemaVersion := uint64(0)
+	for _, row := range rows {
+		if _, err := encoder.AppendRowChangedEvent(row); err != nil {
+			return 0, err
 		}
-		file, err := os.OpenFile(filepath.Join(tableDir, defaultFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, defaultFileMode)
-		if err != nil {
-			return err
+		if row.TableInfoVersion > schemaVersion {
+			schemaVersion = row.TableInfoVersion
 		}
-		ts.rowFile = file
 	}
+	data := encoder.MixedBuild(newFile)
+	err := ts.writer.write(data, rows[0].CommitTs, rows[len(rows)-1].CommitTs, int64(len(rows)), schemaVersion)
+	return len(data), err
+}
 
-	_, err := ts.rowFile.Write(rowDatas)
-	if err != nil {
-		return err
+// commit marks the rows written as safe and commits them in the manifest,
+// the caller makes sure the rows before the resolved ts are all written.
+func (ts *tableStream) commit(resolvedTs uint64) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.writer == nil {
+		return nil
 	}
-
-	stat, err := ts.rowFile.Stat()
-	if err != nil {
+	if err := ts.writer.markSafe(resolvedTs); err != nil {
 		return err
 	}
+	return ts.writer.commit()
+}
 
-	if stat.Size() > maxRowFileSize {
-		// rotate file
-		err := ts.rowFile.Close()
-		if err != nil {
-			return err
-		}
-		oldPath := filepath.Join(tableDir, defaultFileName)
-		newPath := filepath.Join(tableDir, fileName)
-		err = os.Rename(oldPath, newPath)
-		if err != nil {
-			return err
-		}
-		file, err := os.OpenFile(filepath.Join(tableDir, defaultFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, defaultFileMode)
-		if err != nil {
-			return err
-		}
-		ts.rowFile = file
-		ts.encoder = nil
+func (ts *tableStream) close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.writer == nil {
+		return nil
 	}
-
-	ts.sendEvents.Sub(flushedEvents)
-	ts.sendSize.Sub(flushedSize)
-	return nil
+	return ts.writer.closeFile()
 }
 
 type fileSink struct {
 	*logSink
 
+	changefeedID   string
+	rotateSize     int64
+	rotateInterval time.Duration
+	// resolvedTs is the resolved ts being flushed by FlushRowChangedEvents
+	resolvedTs atomic.Uint64
+
 	logMeta *logMeta
 	logPath *logPath
 
-	ddlFile *os.File
+	// ddlWriter is opened by the first DDL, which is emitted by the owner
+	ddlWriter *logWriter
+}
 
-	ddlEncoder codec.EventBatchEncoder
+func (f *fileSink) openLogWriter(dir string, tableID int64, fileName func(uint64) string) (*logWriter, error) {
+	return openLogWriter(dir, f.changefeedID, tableID, fileName, f.rotateSize, f.rotateInterval)
 }
 
 func (f *fileSink) flushLogMeta() error {
@@ -196,32 +233,34 @@ func (f *fileSink) flushLogMeta() error {
 	if err != nil {
 		return cerror.WrapError(cerror.ErrMarshalFailed, err)
 	}
-	// FIXME: if initialize succeed, O_WRONLY is enough, but sometimes it will failed
-	file, err := os.OpenFile(f.logPath.meta, os.O_CREATE|os.O_WRONLY, defaultFileMode)
+	file, err := os.OpenFile(f.logPath.meta, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFileMode)
 	if err != nil {
 		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
 	}
+	defer file.Close() //nolint:errcheck
 	_, err = file.Write(data)
 	return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
 }
 
-func (f *fileSink) createDDLFile(commitTs uint64) (*os.File, error) {
-	fileName := makeDDLFileName(commitTs)
-	file, err := os.OpenFile(filepath.Join(f.logPath.ddl, fileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, defaultFileMode)
-	if err != nil {
-		log.Error("[EmitDDLEvent] create ddl file failed", zap.Error(err))
-		return nil, cerror.WrapError(cerror.ErrFileSinkFileOp, err)
-	}
-	return file, nil
-}
-
 func (f *fileSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
-	return f.emitRowChangedEvents(ctx, newTableStream, rows...)
+	return f.emitRowChangedEvents(ctx, f.newTableStream, rows...)
 }
 
-func (f *fileSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (f *fileSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	log.Debug("[FlushRowChangedEvents] enter", zap.Uint64("ts", resolvedTs))
-	return f.flushRowChangedEvents(ctx, resolvedTs)
+	f.resolvedTs.Store(resolvedTs)
+	result, err := f.flushRowChangedEvents(ctx, resolvedTs)
+	if err != nil {
+		return result, err
+	}
+	// the rows before the resolved ts are written, which are committed in the
+	// manifests before the checkpoint ts is advanced
+	for _, u := range f.units {
+		if err := u.(*tableStream).commit(resolvedTs); err != nil {
+			return model.FlushResult{}, err
+		}
+	}
+	return result, nil
 }
 
 func (f *fileSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
@@ -231,6 +270,20 @@ func (f *fileSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
 }
 
 func (f *fileSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	if f.ddlWriter == nil {
+		writer, err := f.openLogWriter(f.logPath.ddl, 0, makeDDLFileName)
+		if err != nil {
+			return err
+		}
+		f.ddlWriter = writer
+	}
+	// the DDLs are written in the order of the commit ts, the DDLs committed
+	// already are skipped when the owner is restarted
+	if ddl.CommitTs <= f.ddlWriter.safeTs {
+		log.Info("[EmitDDLEvent] skip the committed ddl",
+			zap.Uint64("commitTs", ddl.CommitTs), zap.String("query", ddl.Query))
+		return nil
+	}
 	switch ddl.Type {
 	case parsemodel.ActionCreateTable:
 		f.logMeta.Names[ddl.TableInfo.TableID] = quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table)
@@ -246,64 +299,28 @@ func (f *fileSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error
 			return err
 		}
 	}
-	firstCreated := false
-	if f.ddlEncoder == nil {
-		// create ddl encoder once for each ddl log file
-		f.ddlEncoder = f.encoder()
-		firstCreated = true
+	// the version of the encoder is written once at the start of each file
+	newFile := f.ddlWriter.newFile()
+	encoder := f.encoder()
+	if !newFile {
+		encoder.Reset()
 	}
-	_, err := f.ddlEncoder.EncodeDDLEvent(ddl)
+	_, err := encoder.EncodeDDLEvent(ddl)
 	if err != nil {
 		return err
 	}
-	data := f.ddlEncoder.MixedBuild(firstCreated)
-
-	defer func() {
-		if f.ddlEncoder != nil {
-			f.ddlEncoder.Reset()
-		}
-	}()
-
-	if f.ddlFile == nil {
-		// create file stream
-		file, err := f.createDDLFile(ddl.CommitTs)
-		if err != nil {
-			return err
-		}
-		f.ddlFile = file
-	}
-
-	stat, err := f.ddlFile.Stat()
-	if err != nil {
-		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
-	}
-
-	log.Debug("[EmitDDLEvent] current file stats",
-		zap.String("name", stat.Name()),
-		zap.Int64("size", stat.Size()),
+	data := encoder.MixedBuild(newFile)
+	log.Debug("[EmitDDLEvent] write ddl",
+		zap.Uint64("commitTs", ddl.CommitTs),
 		zap.Int("data size", len(data)),
 	)
-
-	if stat.Size() > maxDDLFlushSize {
-		// rotate file
-		err = f.ddlFile.Close()
-		if err != nil {
-			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
-		}
-		file, err := f.createDDLFile(ddl.CommitTs)
-		if err != nil {
-			return err
-		}
-		f.ddlFile = file
-		// reset ddl encoder for new file
-		f.ddlEncoder = nil
+	if err := f.ddlWriter.write(data, ddl.CommitTs, ddl.CommitTs, 1, 0); err != nil {
+		return err
 	}
-
-	_, err = f.ddlFile.Write(data)
-	if err != nil {
-		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	if err := f.ddlWriter.markSafe(ddl.CommitTs); err != nil {
+		return err
 	}
-	return nil
+	return f.ddlWriter.commit()
 }
 
 func (f *fileSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
@@ -318,33 +335,43 @@ func (f *fileSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTabl
 			}
 		}
 		// update log meta to record the relationship about tableName and tableID
-		f.logMeta = makeLogMetaContent(tableInfo)
-		data, err := f.logMeta.Marshal()
-		if err != nil {
-			return cerror.WrapError(cerror.ErrMarshalFailed, err)
-		}
-		filePath := f.logPath.meta
-		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
-			return cerror.WrapError(cerror.ErrFileSinkMetaAlreadyExists, err)
-		}
-		file, err := os.Create(filePath)
-		if err != nil {
-			return cerror.WrapError(cerror.ErrFileSinkCreateDir, err)
-		}
-		_, err = file.Write(data)
-		if err != nil {
+		logMeta := makeLogMetaContent(tableInfo)
+		data, err := ioutil.ReadFile(f.logPath.meta)
+		if err == nil {
+			// the log is resumed, the names of the dropped tables are kept
+			resumed := newLogMeta()
+			if err := json.Unmarshal(data, resumed); err != nil {
+				return cerror.WrapError(cerror.ErrUnmarshalFailed, err)
+			}
+			for tableID, name := range logMeta.Names {
+				resumed.Names[tableID] = name
+			}
+			logMeta = resumed
+		} else if !os.IsNotExist(err) {
 			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
 		}
+		f.logMeta = logMeta
+		return f.flushLogMeta()
 	}
 	return nil
 }
 
 func (f *fileSink) Close() error {
+	for _, u := range f.units {
+		if err := u.(*tableStream).close(); err != nil {
+			return err
+		}
+	}
+	if f.ddlWriter != nil {
+		return f.ddlWriter.closeFile()
+	}
 	return nil
 }
 
-// NewLocalFileSink support log data to file.
-func NewLocalFileSink(ctx context.Context, sinkURI *url.URL, errCh chan error) (*fileSink, error) {
+// NewLocalFileSink support log data to file. The files of a table are rotated
+// by the max-file-size and rotate-interval of the sink URI, and are committed
+// in the manifest of the table on every FlushRowChangedEvents.
+func NewLocalFileSink(ctx context.Context, changefeedID string, sinkURI *url.URL, errCh chan error) (*fileSink, error) {
 	log.Info("[NewLocalFileSink]",
 		zap.String("host", sinkURI.Host),
 		zap.String("path", sinkURI.Path),
@@ -364,9 +391,28 @@ func NewLocalFileSink(ctx context.Context, sinkURI *url.URL, errCh chan error) (
 	}
 
 	f := &fileSink{
-		logMeta: newLogMeta(),
-		logPath: logPath,
-		logSink: newLogSink(logPath.root, nil),
+		changefeedID:   changefeedID,
+		rotateSize:     maxRowFileSize,
+		rotateInterval: defaultRotateInterval,
+		logMeta:        newLogMeta(),
+		logPath:        logPath,
+		logSink:        newLogSink(logPath.root, nil),
+	}
+	s := sinkURI.Query().Get("max-file-size")
+	if s != "" {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, cerror.ErrSinkURIInvalid.GenWithStack("invalid max-file-size %s", s)
+		}
+		f.rotateSize = size
+	}
+	s = sinkURI.Query().Get("rotate-interval")
+	if s != "" {
+		interval, err := time.ParseDuration(s)
+		if err != nil || interval < 0 {
+			return nil, cerror.ErrSinkURIInvalid.GenWithStack("invalid rotate-interval %s", s)
+		}
+		f.rotateInterval = interval
 	}
 
 	// important! we should flush asynchronously in another goroutine
@@ -0,0 +1,432 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/log"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// manifestFile is the manifest of the files in a table directory or the
+	// ddl directory, it's replaced atomically when the files are committed
+	manifestFile    = "manifest"
+	manifestTmpFile = "manifest.tmp"
+
+	// logFileHeaderSize is the size of the header at the start of each log
+	// file, the header is padded so that it's rewritten in place
+	logFileHeaderSize = 512
+)
+
+// logFileHeader is the header of a log file, which describes the events
+// committed in the file
+type logFileHeader struct {
+	ChangefeedID  string `json:"changefeed-id"`
+	TableID       int64  `json:"table-id"`
+	SchemaVersion uint64 `json:"schema-version"`
+	MinCommitTs   uint64 `json:"min-commit-ts"`
+	MaxCommitTs   uint64 `json:"max-commit-ts"`
+}
+
+func (h *logFileHeader) encode() ([]byte, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrMarshalFailed, err)
+	}
+	if len(data) >= logFileHeaderSize {
+		return nil, cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(h.ChangefeedID, "the header is too large")
+	}
+	header := bytes.Repeat([]byte{' '}, logFileHeaderSize)
+	copy(header, data)
+	header[logFileHeaderSize-1] = '\n'
+	return header, nil
+}
+
+func decodeLogFileHeader(data []byte) (*logFileHeader, error) {
+	if len(data) < logFileHeaderSize || data[logFileHeaderSize-1] != '\n' {
+		return nil, cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs("", "the header is truncated")
+	}
+	h := new(logFileHeader)
+	if err := json.Unmarshal(bytes.TrimRight(data[:logFileHeaderSize], " \n"), h); err != nil {
+		return nil, cerror.WrapError(cerror.ErrUnmarshalFailed, err)
+	}
+	return h, nil
+}
+
+// logFileMeta is the committed state of a log file
+type logFileMeta struct {
+	Name string `json:"name"`
+	// Size is the committed size of the file including the header, the bytes
+	// after it are discarded when the writer resumes
+	Size          int64  `json:"size"`
+	Events        int64  `json:"events"`
+	SchemaVersion uint64 `json:"schema-version"`
+	MinCommitTs   uint64 `json:"min-commit-ts"`
+	MaxCommitTs   uint64 `json:"max-commit-ts"`
+}
+
+func (m *logFileMeta) header(changefeedID string, tableID int64) *logFileHeader {
+	return &logFileHeader{
+		ChangefeedID:  changefeedID,
+		TableID:       tableID,
+		SchemaVersion: m.SchemaVersion,
+		MinCommitTs:   m.MinCommitTs,
+		MaxCommitTs:   m.MaxCommitTs,
+	}
+}
+
+// logManifest is the manifest of the log files in a directory
+type logManifest struct {
+	ChangefeedID string `json:"changefeed-id"`
+	TableID      int64  `json:"table-id"`
+	// ResolvedTs is the ts before which the events are all in the committed
+	// files, the events before it are skipped when the writer resumes
+	ResolvedTs uint64         `json:"resolved-ts"`
+	Files      []*logFileMeta `json:"files"`
+}
+
+// readLogManifest reads the manifest of the directory, nil is returned if
+// there is no manifest
+func readLogManifest(dir string) (*logManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	m := new(logManifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(dir, err.Error())
+	}
+	return m, nil
+}
+
+// writeLogManifest replaces the manifest of the directory atomically
+func writeLogManifest(dir string, m *logManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrMarshalFailed, err)
+	}
+	tmpPath := filepath.Join(dir, manifestTmpFile)
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFileMode)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close() //nolint:errcheck
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close() //nolint:errcheck
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	if err := file.Close(); err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, manifestFile)); err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	defer d.Close() //nolint:errcheck
+	return cerror.WrapError(cerror.ErrFileSinkFileOp, d.Sync())
+}
+
+// logWriter appends the encoded events of a table, or the DDLs, to the log
+// files of a directory, and commits them in the manifest of the directory.
+// The files are rotated by size and time, the events are written in the
+// order of the commit ts. The events written but not committed are discarded
+// when the writer resumes, and the committed events are skipped if they're
+// written again, so that the log is resumed without losing or duplicating
+// events after a crash.
+type logWriter struct {
+	dir            string
+	changefeedID   string
+	tableID        int64
+	fileName       func(commitTs uint64) string
+	rotateSize     int64
+	rotateInterval time.Duration
+
+	manifest *logManifest
+	// resumeTs is the resolved ts committed before the writer is opened
+	resumeTs uint64
+	// files are the safe states of the files, a file is safe if the events
+	// of it are all before the resolved ts
+	files []*logFileMeta
+	// safeTs is the resolved ts of the safe files
+	safeTs uint64
+	// dirty is set if the safe states are changed since the last commit
+	dirty bool
+
+	// file is the active file, active is the state written to it, which may
+	// be ahead of its safe state
+	file     *os.File
+	active   *logFileMeta
+	openTime time.Time
+}
+
+// openLogWriter opens the writer of the directory. The committed files are
+// truncated to their committed sizes, and the uncommitted files written by
+// the writer are removed.
+func openLogWriter(
+	dir, changefeedID string, tableID int64, fileName func(uint64) string, rotateSize int64, rotateInterval time.Duration,
+) (*logWriter, error) {
+	if err := os.MkdirAll(dir, defaultDirMode); err != nil {
+		return nil, cerror.WrapError(cerror.ErrFileSinkCreateDir, err)
+	}
+	m, err := readLogManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = &logManifest{ChangefeedID: changefeedID, TableID: tableID}
+	} else if m.ChangefeedID != changefeedID || m.TableID != tableID {
+		return nil, cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(dir,
+			"the log is written by changefeed "+m.ChangefeedID+" for another table")
+	}
+	w := &logWriter{
+		dir:            dir,
+		changefeedID:   changefeedID,
+		tableID:        tableID,
+		fileName:       fileName,
+		rotateSize:     rotateSize,
+		rotateInterval: rotateInterval,
+		manifest:       m,
+		resumeTs:       m.ResolvedTs,
+		safeTs:         m.ResolvedTs,
+	}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *logWriter) recover() error {
+	committed := make(map[string]struct{}, len(w.manifest.Files))
+	for _, meta := range w.manifest.Files {
+		committed[meta.Name] = struct{}{}
+		path := filepath.Join(w.dir, meta.Name)
+		stat, err := os.Stat(path)
+		if err != nil {
+			return cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(w.dir, err.Error())
+		}
+		if stat.Size() < meta.Size {
+			return cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(w.dir,
+				"the committed file "+meta.Name+" is truncated")
+		}
+		if stat.Size() > meta.Size {
+			log.Info("truncate the uncommitted events of the log file",
+				zap.String("path", path), zap.Int64("size", stat.Size()), zap.Int64("committed", meta.Size))
+			if err := os.Truncate(path, meta.Size); err != nil {
+				return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+			}
+		}
+		meta := *meta
+		w.files = append(w.files, &meta)
+	}
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if _, ok := committed[name]; ok || name == manifestFile || info.IsDir() {
+			continue
+		}
+		path := filepath.Join(w.dir, name)
+		if name != manifestTmpFile && !w.ownsFile(path) {
+			log.Warn("the file not written by the log writer is kept", zap.String("path", path))
+			continue
+		}
+		log.Info("remove the uncommitted log file", zap.String("path", path))
+		if err := os.Remove(path); err != nil {
+			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+		}
+	}
+	if len(w.files) == 0 {
+		return nil
+	}
+	// the last file is resumed to be appended, its header may be ahead of the
+	// manifest
+	last := w.files[len(w.files)-1]
+	file, err := os.OpenFile(filepath.Join(w.dir, last.Name), os.O_RDWR, defaultFileMode)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	active := *last
+	w.file, w.active, w.openTime = file, &active, time.Now()
+	return w.writeHeader()
+}
+
+// ownsFile returns whether the file is written by the writer, which has the
+// header of the changefeed and the table
+func (w *logWriter) ownsFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close() //nolint:errcheck
+	data := make([]byte, logFileHeaderSize)
+	if _, err := file.ReadAt(data, 0); err != nil {
+		return false
+	}
+	h, err := decodeLogFileHeader(data)
+	return err == nil && h.ChangefeedID == w.changefeedID && h.TableID == w.tableID
+}
+
+// committed returns whether the events of the commit ts are committed before
+// the writer is opened
+func (w *logWriter) committed(commitTs uint64) bool {
+	return commitTs <= w.resumeTs
+}
+
+// newFile returns whether the data written next starts a new file, which is
+// prefixed by the version of the encoder
+func (w *logWriter) newFile() bool {
+	return w.file == nil || w.active.Size == logFileHeaderSize
+}
+
+// maxCommitTs returns the max commit ts of the events written to the active
+// file
+func (w *logWriter) maxCommitTs() uint64 {
+	if w.file == nil {
+		return 0
+	}
+	return w.active.MaxCommitTs
+}
+
+// write appends the data of the events in [minTs, maxTs] to the active file,
+// a new file is created if there is no active file.
+func (w *logWriter) write(data []byte, minTs, maxTs uint64, events int64, schemaVersion uint64) error {
+	if w.file == nil {
+		name := w.fileName(minTs)
+		file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_RDWR, defaultFileMode)
+		if err != nil {
+			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+		}
+		w.file, w.openTime = file, time.Now()
+		w.active = &logFileMeta{Name: name, Size: logFileHeaderSize, MinCommitTs: minTs}
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.file.WriteAt(data, w.active.Size); err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	w.active.Size += int64(len(data))
+	w.active.Events += events
+	if maxTs > w.active.MaxCommitTs {
+		w.active.MaxCommitTs = maxTs
+	}
+	if schemaVersion > w.active.SchemaVersion {
+		w.active.SchemaVersion = schemaVersion
+	}
+	return nil
+}
+
+func (w *logWriter) writeHeader() error {
+	header, err := w.active.header(w.changefeedID, w.tableID).encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.file.WriteAt(header, 0)
+	return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+}
+
+// markSafe marks the events written as safe if they're all before the
+// resolved ts, the caller makes sure the events before it are all written.
+// The active file is rotated once it's safe and large or old enough.
+func (w *logWriter) markSafe(resolvedTs uint64) error {
+	if w.file == nil || w.active.MaxCommitTs > resolvedTs {
+		return nil
+	}
+	if resolvedTs > w.safeTs {
+		w.safeTs = resolvedTs
+	}
+	if n := len(w.files); n > 0 && w.files[n-1].Name == w.active.Name {
+		if *w.files[n-1] == *w.active {
+			return nil
+		}
+		*w.files[n-1] = *w.active
+	} else {
+		active := *w.active
+		w.files = append(w.files, &active)
+	}
+	w.dirty = true
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if w.active.Size >= w.rotateSize || (w.rotateInterval > 0 && time.Since(w.openTime) >= w.rotateInterval) {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit syncs the safe files and records them in the manifest
+func (w *logWriter) commit() error {
+	if !w.dirty {
+		return nil
+	}
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+		}
+	}
+	files := make([]*logFileMeta, 0, len(w.files))
+	for _, meta := range w.files {
+		meta := *meta
+		files = append(files, &meta)
+	}
+	m := &logManifest{
+		ChangefeedID: w.changefeedID,
+		TableID:      w.tableID,
+		ResolvedTs:   w.safeTs,
+		Files:        files,
+	}
+	if err := writeLogManifest(w.dir, m); err != nil {
+		return err
+	}
+	w.manifest = m
+	w.dirty = false
+	return nil
+}
+
+func (w *logWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	err := w.file.Close()
+	w.file, w.active = nil, nil
+	return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+}
@@ -175,6 +175,7 @@ func (tb *tableBuffer) flush(ctx context.Context, sink *logSink) error {
 	tb.sendEvents.Sub(sendEvents)
 	tb.sendSize.Sub(flushedSize)
 	tb.uploadParts = hashPart
+	sink.addFlushed(sendEvents, len(rowDatas))
 	return nil
 }
 
@@ -221,7 +222,7 @@ func (s *s3Sink) flushLogMeta(ctx context.Context) error {
 	return cerror.WrapError(cerror.ErrS3SinkWriteStorage, s.storage.Write(ctx, logMetaFile, data))
 }
 
-func (s *s3Sink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (s *s3Sink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	// we should flush all events before resolvedTs, there are two kind of flush policy
 	// 1. flush row events to a s3 chunk: if the event size is not enough,
 	//    TODO: when cdc crashed, we should repair these chunks to a complete file
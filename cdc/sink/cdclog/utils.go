@@ -66,6 +66,11 @@ type logSink struct {
 	storagePath storage.ExternalStorage
 
 	hashMap sync.Map
+
+	// flushedRows and flushedBytes are the rows and bytes written to the
+	// storage since the last FlushRowChangedEvents
+	flushedRows  atomic.Uint64
+	flushedBytes atomic.Uint64
 }
 
 func newLogSink(root string, storage storage.ExternalStorage) *logSink {
@@ -83,6 +88,12 @@ func newLogSink(root string, storage storage.ExternalStorage) *logSink {
 	}
 }
 
+// addFlushed records the rows and bytes written to the storage by the units
+func (l *logSink) addFlushed(rows int64, bytes int) {
+	l.flushedRows.Add(uint64(rows))
+	l.flushedBytes.Add(uint64(bytes))
+}
+
 // s3Sink need this
 func (l *logSink) storage() storage.ExternalStorage {
 	return l.storagePath
@@ -146,6 +157,7 @@ func (l *logSink) startFlush(ctx context.Context) error {
 
 func (l *logSink) emitRowChangedEvents(ctx context.Context, newUnit func(int64) logUnit, rows ...*model.RowChangedEvent) error {
 	for _, row := range rows {
+		row = row.WithoutTiDBRowID()
 		// dispatch row event by tableID
 		tableID := row.Table.GetTableID()
 		var (
@@ -172,11 +184,11 @@ func (l *logSink) emitRowChangedEvents(ctx context.Context, newUnit func(int64)
 	return nil
 }
 
-func (l *logSink) flushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (l *logSink) flushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	// TODO update flush policy with size
 	select {
 	case <-ctx.Done():
-		return 0, ctx.Err()
+		return model.FlushResult{}, ctx.Err()
 
 	default:
 		needFlushedUnits := make([]logUnit, 0, len(l.units))
@@ -188,7 +200,7 @@ func (l *logSink) flushRowChangedEvents(ctx context.Context, resolvedTs uint64)
 		if len(needFlushedUnits) > 0 {
 			select {
 			case <-ctx.Done():
-				return 0, ctx.Err()
+				return model.FlushResult{}, ctx.Err()
 
 			case <-time.After(defaultFlushRowChangedEventDuration):
 				// cannot accumulate enough row events in 5 second
@@ -199,7 +211,11 @@ func (l *logSink) flushRowChangedEvents(ctx context.Context, resolvedTs uint64)
 			}
 		}
 	}
-	return resolvedTs, nil
+	return model.FlushResult{
+		CheckpointTs: resolvedTs,
+		FlushedRows:  l.flushedRows.Swap(0),
+		FlushedBytes: l.flushedBytes.Swap(0),
+	}, nil
 }
 
 type logMeta struct {
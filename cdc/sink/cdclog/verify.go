@@ -0,0 +1,222 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdclog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// LogVerifyReport is the result of verifying a changefeed log
+type LogVerifyReport struct {
+	ChangefeedID string `json:"changefeed-id"`
+	Tables       int    `json:"tables"`
+	Files        int    `json:"files"`
+	Events       int64  `json:"events"`
+	// Problems are the inconsistencies between the manifests and the files
+	Problems []string `json:"problems"`
+	// Uncommitted are the events written but not committed, which are
+	// discarded when the changefeed is resumed
+	Uncommitted []string `json:"uncommitted"`
+}
+
+func (r *LogVerifyReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+func (r *LogVerifyReport) uncommitted(format string, args ...interface{}) {
+	r.Uncommitted = append(r.Uncommitted, fmt.Sprintf(format, args...))
+}
+
+// VerifyLocalLog checks the manifests of the changefeed log in the directory
+// against the files, which are written by the local file sink.
+func VerifyLocalLog(dir string) (*LogVerifyReport, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	report := &LogVerifyReport{}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() || (name != ddlEventsDir && !strings.HasPrefix(name, tablePrefix)) {
+			continue
+		}
+		eventType := model.MqMessageTypeRow
+		if name == ddlEventsDir {
+			eventType = model.MqMessageTypeDDL
+		} else {
+			report.Tables++
+		}
+		if err := verifyLogDir(report, filepath.Join(dir, name), eventType); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func verifyLogDir(report *LogVerifyReport, dir string, eventType model.MqMessageType) error {
+	m, err := readLogManifest(dir)
+	if err != nil {
+		if cerror.ErrFileSinkLogCorrupted.Equal(err) {
+			report.problem("%s: invalid manifest: %s", dir, err.Error())
+			return nil
+		}
+		return err
+	}
+	if m == nil {
+		m = &logManifest{}
+	} else if report.ChangefeedID == "" {
+		report.ChangefeedID = m.ChangefeedID
+	} else if report.ChangefeedID != m.ChangefeedID {
+		report.problem("%s: written by changefeed %s, expected %s", dir, m.ChangefeedID, report.ChangefeedID)
+	}
+
+	committed := make(map[string]struct{}, len(m.Files))
+	lastTs := uint64(0)
+	for i, meta := range m.Files {
+		committed[meta.Name] = struct{}{}
+		path := filepath.Join(dir, meta.Name)
+		if meta.MaxCommitTs > m.ResolvedTs {
+			report.problem("%s: max commit ts %d is after the resolved ts %d", path, meta.MaxCommitTs, m.ResolvedTs)
+		}
+		if i > 0 && meta.MinCommitTs <= lastTs {
+			report.problem("%s: min commit ts %d overlaps the previous file ending at %d", path, meta.MinCommitTs, lastTs)
+		}
+		lastTs = meta.MaxCommitTs
+		report.Files++
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			report.problem("%s: the committed file is missing", path)
+			continue
+		}
+		if err != nil {
+			return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+		}
+		if int64(len(data)) < meta.Size {
+			report.problem("%s: the file is truncated to %d bytes, %d bytes are committed", path, len(data), meta.Size)
+			continue
+		}
+		tail := int64(len(data)) > meta.Size
+		if tail {
+			report.uncommitted("%s: %d bytes after the committed %d bytes", path, int64(len(data))-meta.Size, meta.Size)
+		}
+		header, err := decodeLogFileHeader(data)
+		if err != nil {
+			report.problem("%s: invalid header: %s", path, err.Error())
+			continue
+		}
+		// the header of the active file is rewritten before the manifest, it
+		// may be ahead of the manifest if the tail isn't committed
+		expected := meta.header(m.ChangefeedID, m.TableID)
+		if *header != *expected && !(tail && i == len(m.Files)-1) {
+			report.problem("%s: the header %+v doesn't match the manifest %+v", path, *header, *expected)
+		}
+		verifyLogEvents(report, path, data[logFileHeaderSize:meta.Size], meta, eventType)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrFileSinkFileOp, err)
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if _, ok := committed[name]; ok || name == manifestFile || info.IsDir() {
+			continue
+		}
+		report.uncommitted("%s: the file isn't committed", filepath.Join(dir, name))
+	}
+	return nil
+}
+
+// verifyLogEvents walks the events of the committed part of a file, which is
+// the version of the encoder followed by the keys and values of the events
+func verifyLogEvents(report *LogVerifyReport, path string, data []byte, meta *logFileMeta, eventType model.MqMessageType) {
+	if len(data) == 0 {
+		if meta.Events != 0 {
+			report.problem("%s: %d events are committed in an empty file", path, meta.Events)
+		}
+		return
+	}
+	if len(data) < 8 || binary.BigEndian.Uint64(data[:8]) != codec.BatchVersion1 {
+		report.problem("%s: invalid encoder version", path)
+		return
+	}
+	offset := uint64(8)
+	next := func() ([]byte, bool) {
+		if uint64(len(data))-offset < 8 {
+			return nil, false
+		}
+		size := binary.BigEndian.Uint64(data[offset : offset+8])
+		if uint64(len(data))-offset-8 < size {
+			return nil, false
+		}
+		item := data[offset+8 : offset+8+size]
+		offset += 8 + size
+		return item, true
+	}
+	var (
+		events       int64
+		minTs, maxTs uint64
+	)
+	for offset < uint64(len(data)) {
+		key, ok := next()
+		if !ok {
+			report.problem("%s: the key at offset %d is broken", path, offset)
+			return
+		}
+		if _, ok := next(); !ok {
+			report.problem("%s: the value before offset %d is broken", path, offset)
+			return
+		}
+		var k struct {
+			Ts   uint64              `json:"ts"`
+			Type model.MqMessageType `json:"t"`
+		}
+		if err := json.Unmarshal(key, &k); err != nil {
+			report.problem("%s: invalid key before offset %d: %s", path, offset, err.Error())
+			return
+		}
+		if k.Type != eventType {
+			report.problem("%s: unexpected event type %d before offset %d", path, k.Type, offset)
+			return
+		}
+		if events > 0 && k.Ts < maxTs {
+			report.problem("%s: commit ts %d is before %d", path, k.Ts, maxTs)
+		}
+		if events == 0 {
+			minTs = k.Ts
+		}
+		if k.Ts > maxTs {
+			maxTs = k.Ts
+		}
+		events++
+	}
+	report.Events += events
+	if events != meta.Events {
+		report.problem("%s: %d events are found, %d events are committed", path, events, meta.Events)
+	}
+	if minTs != meta.MinCommitTs || maxTs != meta.MaxCommitTs {
+		report.problem("%s: the commit ts range [%d, %d] doesn't match the manifest [%d, %d]",
+			path, minTs, maxTs, meta.MinCommitTs, meta.MaxCommitTs)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/dispatcher"
+	"github.com/pingcap/ticdc/cdc/sink/producer/kafka"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/cyclic/mark"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	tifilter "github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	"go.uber.org/zap"
+)
+
+// CleanupOptions are the options of cleaning up the downstream artifacts of
+// a removed changefeed.
+type CleanupOptions struct {
+	// Tables are the tables replicated by the changefeed, the mark tables of
+	// them are dropped if the cyclic replication is enabled.
+	Tables []model.TableName
+	// DeleteTopics deletes the topics created by the changefeed automatically.
+	// The topics are kept by default, as they may still be consumed.
+	DeleteTopics bool
+}
+
+// CleanupResult is the result of cleaning up an artifact in the downstream.
+type CleanupResult struct {
+	Item string
+	Err  error
+}
+
+// CleanupDownstream cleans up the artifacts left in the downstream by the
+// changefeed, such as the mark tables, the syncpoint records and the topics.
+// A short-lived connection is made to the sink, the result of each artifact
+// is returned, and the error is returned only if the sink is unreachable.
+func CleanupDownstream(
+	ctx context.Context, changefeedID model.ChangeFeedID, info *model.ChangeFeedInfo, opts CleanupOptions,
+) ([]CleanupResult, error) {
+	sinkURI, err := url.Parse(info.SinkURI)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrSinkURIInvalid, err)
+	}
+	// the sinks are stopped when the cleanup is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	switch strings.ToLower(sinkURI.Scheme) {
+	case "mysql", "tidb", "mysql+ssl", "tidb+ssl":
+		return cleanupMySQLDownstream(ctx, changefeedID, sinkURI, info, opts)
+	case "kafka", "kafka+ssl":
+		return cleanupKafkaDownstream(ctx, sinkURI, info, opts)
+	}
+	log.Info("nothing to clean up in the downstream", zap.String("changefeed", changefeedID),
+		zap.String("scheme", sinkURI.Scheme))
+	return nil, nil
+}
+
+func cleanupMySQLDownstream(
+	ctx context.Context, changefeedID model.ChangeFeedID, sinkURI *url.URL, info *model.ChangeFeedInfo, opts CleanupOptions,
+) ([]CleanupResult, error) {
+	cyclicEnabled := info.Config.Cyclic.IsEnabled()
+	if !cyclicEnabled && !info.SyncPointEnabled {
+		return nil, nil
+	}
+	filter, err := tifilter.NewFilter(info.Config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s, err := createMySQLSink(ctx, changefeedID, sinkURI, filter, info.Config, map[string]string{}, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Warn("close the MySQL sink of the cleanup failed", zap.Error(err))
+		}
+	}()
+
+	var results []CleanupResult
+	if cyclicEnabled {
+		for _, table := range opts.Tables {
+			if mark.IsMarkTable(table.Schema, table.Table) {
+				continue
+			}
+			markTable := quotes.QuoteSchema(mark.GetMarkTableName(table.Schema, table.Table))
+			_, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+markTable)
+			results = append(results, CleanupResult{
+				Item: "mark table " + markTable,
+				Err:  cerror.WrapError(cerror.ErrMySQLTxnError, err),
+			})
+		}
+	}
+	if info.SyncPointEnabled {
+		syncpointTable := quotes.QuoteSchema(mark.SchemaName, syncpointTableName)
+		_, err := s.db.ExecContext(ctx, "DELETE FROM "+syncpointTable+" WHERE cf = ?", changefeedID)
+		if errCode, ok := getSQLErrCode(err); ok && errCode == mysql.ErrNoSuchTable {
+			err = nil
+		}
+		results = append(results, CleanupResult{
+			Item: "syncpoint records in " + syncpointTable,
+			Err:  cerror.WrapError(cerror.ErrMySQLTxnError, err),
+		})
+	}
+	return results, nil
+}
+
+func cleanupKafkaDownstream(
+	ctx context.Context, sinkURI *url.URL, info *model.ChangeFeedInfo, opts CleanupOptions,
+) ([]CleanupResult, error) {
+	if !opts.DeleteTopics {
+		return nil, nil
+	}
+	replicaConfig := info.Config.Clone()
+	config, err := parseKafkaSinkURI(sinkURI, replicaConfig, map[string]string{})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// the topics not created by the changefeed are never deleted
+	if !config.TopicPreProcess {
+		return nil, nil
+	}
+	topics, err := kafkaTopics(replicaConfig, strings.Trim(sinkURI.Path, "/"))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	errs, err := kafka.DeleteTopics(ctx, sinkURI.Host, topics, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	results := make([]CleanupResult, 0, len(topics))
+	for _, topic := range topics {
+		results = append(results, CleanupResult{Item: "topic " + topic, Err: errs[topic]})
+	}
+	return results, nil
+}
+
+// kafkaTopics returns the topics the changefeed sends the events to, the
+// topics of the topic expressions are unknown until the events are sent, so
+// they are not included.
+func kafkaTopics(replicaConfig *config.ReplicaConfig, defaultTopic string) ([]string, error) {
+	if !needTopicRouter(replicaConfig, defaultTopic) {
+		return []string{defaultTopic}, nil
+	}
+	topicDispatcher, err := dispatcher.NewTopicDispatcher(replicaConfig, defaultTopic)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	topics := topicDispatcher.Topics()
+	schemaChangesTopic := replicaConfig.Sink.SchemaChangesTopic
+	if schemaChangesTopic != "" {
+		for _, topic := range topics {
+			if topic == schemaChangesTopic {
+				return topics, nil
+			}
+		}
+		topics = append(topics, schemaChangesTopic)
+	}
+	return topics, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	dmysql "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type cleanupSuite struct{}
+
+var _ = check.Suite(&cleanupSuite{})
+
+func (s *cleanupSuite) TestCleanupMySQLDownstream(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		mock.ExpectExec("DROP TABLE IF EXISTS `tidb_cdc`.`repl_mark_test_t1`").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DROP TABLE IF EXISTS `tidb_cdc`.`repl_mark_test_t2`").
+			WillReturnError(&dmysql.MySQLError{Number: mysql.ErrDBaccessDenied, Message: "access denied"})
+		// the syncpoint table is not created yet
+		mock.ExpectExec("DELETE FROM `tidb_cdc`.`syncpoint_v1` WHERE cf = ?").
+			WithArgs("test-changefeed").
+			WillReturnError(&dmysql.MySQLError{Number: mysql.ErrNoSuchTable, Message: "table doesn't exist"})
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	info := &model.ChangeFeedInfo{
+		SinkURI:          "mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=1",
+		Config:           config.GetDefaultReplicaConfig(),
+		SyncPointEnabled: true,
+	}
+	info.Config.Cyclic = &config.CyclicConfig{Enable: true, ReplicaID: 1}
+	results, err := CleanupDownstream(ctx, "test-changefeed", info, CleanupOptions{
+		Tables: []model.TableName{
+			{Schema: "test", Table: "t1"},
+			{Schema: "test", Table: "t2"},
+			// the mark tables have no mark tables
+			{Schema: "tidb_cdc", Table: "repl_mark_test_t1"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 3)
+	c.Assert(results[0], check.DeepEquals, CleanupResult{Item: "mark table `tidb_cdc`.`repl_mark_test_t1`"})
+	c.Assert(results[1].Item, check.Equals, "mark table `tidb_cdc`.`repl_mark_test_t2`")
+	c.Assert(results[1].Err, check.ErrorMatches, ".*access denied.*")
+	c.Assert(results[2], check.DeepEquals, CleanupResult{Item: "syncpoint records in `tidb_cdc`.`syncpoint_v1`"})
+
+	// nothing is cleaned up without the cyclic replication and the syncpoint
+	info.Config.Cyclic.Enable = false
+	info.SyncPointEnabled = false
+	results, err = CleanupDownstream(ctx, "test-changefeed", info, CleanupOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 0)
+
+	// the unreachable downstream fails the whole cleanup
+	info.SyncPointEnabled = true
+	getDBConnImpl = func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, err = CleanupDownstream(ctx, "test-changefeed", info, CleanupOptions{})
+	c.Assert(err, check.ErrorMatches, ".*connection refused.*")
+}
+
+func (s *cleanupSuite) TestCleanupKafkaDownstream(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	info := &model.ChangeFeedInfo{
+		SinkURI: "kafka://127.0.0.1:9092/cdc?auto-create-topic=false",
+		Config:  config.GetDefaultReplicaConfig(),
+	}
+	// the topics are kept by default, and the topics not created by the
+	// changefeed are never deleted
+	for _, opts := range []CleanupOptions{{}, {DeleteTopics: true}} {
+		results, err := CleanupDownstream(ctx, "test-changefeed", info, opts)
+		c.Assert(err, check.IsNil)
+		c.Assert(results, check.HasLen, 0)
+	}
+
+	// the unsupported sinks have nothing to clean up
+	info.SinkURI = "blackhole://"
+	results, err := CleanupDownstream(ctx, "test-changefeed", info, CleanupOptions{DeleteTopics: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 0)
+}
+
+func (s *cleanupSuite) TestKafkaTopics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	topics, err := kafkaTopics(cfg, "cdc")
+	c.Assert(err, check.IsNil)
+	c.Assert(topics, check.DeepEquals, []string{"cdc"})
+
+	// the schema changes topic is added once
+	cfg.Sink.SchemaChangesTopic = "cdc-ddl"
+	topics, err = kafkaTopics(cfg, "cdc")
+	c.Assert(err, check.IsNil)
+	c.Assert(topics, check.DeepEquals, []string{"cdc", "cdc-ddl"})
+	cfg.Sink.SchemaChangesTopic = "cdc"
+	topics, err = kafkaTopics(cfg, "cdc")
+	c.Assert(err, check.IsNil)
+	c.Assert(topics, check.DeepEquals, []string{"cdc"})
+
+	// the topics of the topic expressions are unknown
+	cfg.Sink.SchemaChangesTopic = ""
+	topics, err = kafkaTopics(cfg, "cdc_{schema}")
+	c.Assert(err, check.IsNil)
+	c.Assert(topics, check.HasLen, 0)
+}
@@ -231,6 +231,9 @@ func ColumnInfoToAvroSchema(name string, columnInfo []*model.Column) (string, er
 	}
 
 	for _, col := range columnInfo {
+		if col == nil {
+			continue
+		}
 		avroType, err := getAvroDataTypeFromColumn(col)
 		if err != nil {
 			return "", err
@@ -100,6 +100,47 @@ func (s *avroBatchEncoderSuite) TestAvroEncodeOnly(c *check.C) {
 	log.Info("TestAvroEncodeOnly", zap.ByteString("result", txt))
 }
 
+func (s *avroBatchEncoderSuite) TestAvroEncodeAfterAddColumn(c *check.C) {
+	defer testleak.AfterTest(c)()
+	table := model.TableName{
+		Schema: "testdb",
+		Table:  "add_column",
+	}
+	// the row before `ALTER TABLE add_column ADD COLUMN b INT AFTER a`
+	r1, err := avroEncode(&table, s.encoder.valueSchemaManager, 1, []*model.Column{
+		{Name: "id", Value: int64(1), Type: mysql.TypeLong, Flag: model.HandleKeyFlag},
+		{Name: "a", Value: int64(1), Type: mysql.TypeLong},
+		{Name: "c", Value: int64(1), Type: mysql.TypeLong},
+	})
+	c.Assert(err, check.IsNil)
+	// the row after the DDL, the table info version is bumped by the DDL
+	r2, err := avroEncode(&table, s.encoder.valueSchemaManager, 2, []*model.Column{
+		{Name: "id", Value: int64(2), Type: mysql.TypeLong, Flag: model.HandleKeyFlag},
+		{Name: "a", Value: int64(2), Type: mysql.TypeLong},
+		nil,
+		{Name: "b", Value: int64(2), Type: mysql.TypeLong},
+		{Name: "c", Value: int64(2), Type: mysql.TypeLong},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(r2.registryID, check.Not(check.Equals), r1.registryID)
+
+	avroCodec, err := goavro.NewCodec(`
+        {
+          "type": "record",
+          "name": "add_column",
+          "fields" : [
+            {"name": "id", "type": "int"},
+            {"name": "a", "type": ["null", "int"], "default": null},
+            {"name": "b", "type": ["null", "int"], "default": null},
+            {"name": "c", "type": ["null", "int"], "default": null}
+          ]
+        }`)
+	c.Assert(err, check.IsNil)
+	res, _, err := avroCodec.NativeFromBinary(r2.data)
+	c.Assert(err, check.IsNil)
+	c.Assert(res.(map[string]interface{})["b"], check.DeepEquals, map[string]interface{}{"int": int32(2)})
+}
+
 func (s *avroBatchEncoderSuite) TestAvroEnvelope(c *check.C) {
 	defer testleak.AfterTest(c)()
 	avroCodec, err := goavro.NewCodec(`
@@ -58,6 +58,8 @@ type canalFlatMessage struct {
 	// A Datum should be a string or nil
 	Data []map[string]interface{} `json:"data"`
 	Old  []map[string]interface{} `json:"old"`
+	// IsBootstrap is a TiCDC extension which marks the DDL as a schema bootstrap message
+	IsBootstrap bool `json:"isBootstrap,omitempty"`
 	// Used internally by CanalFlatEventBatchEncoder
 	tikvTs uint64
 }
@@ -158,6 +160,7 @@ func (c *CanalFlatEventBatchEncoder) newFlatMessageForDDL(e *model.DDLEvent) (*c
 		ExecutionTime: header.ExecuteTime,
 		BuildTime:     0, // ignored by both Canal Adapter and Flink
 		Query:         e.Query,
+		IsBootstrap:   e.IsBootstrap,
 		tikvTs:        e.CommitTs,
 	}
 	return ret, nil
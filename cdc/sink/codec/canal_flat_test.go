@@ -96,6 +96,28 @@ func (s *canalFlatSuite) TestNewCanalFlatMessageFromDDL(c *check.C) {
 	c.Assert(msg.EventType, check.Equals, "CREATE")
 }
 
+func (s *canalFlatSuite) TestNewCanalFlatMessageFromBootstrapDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+
+	msg, err := encoder.newFlatMessageForDDL(testCaseDdl)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg.IsBootstrap, check.IsFalse)
+	data, err := json.Marshal(msg)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Not(check.Matches), ".*isBootstrap.*")
+
+	bootstrapDdl := *testCaseDdl
+	bootstrapDdl.IsBootstrap = true
+	msg, err = encoder.newFlatMessageForDDL(&bootstrapDdl)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg.IsDDL, check.IsTrue)
+	c.Assert(msg.IsBootstrap, check.IsTrue)
+	data, err = json.Marshal(msg)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, `.*"isBootstrap":true.*`)
+}
+
 func (s *canalFlatSuite) TestBatching(c *check.C) {
 	defer testleak.AfterTest(c)()
 	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
@@ -49,11 +49,15 @@ type column struct {
 	WhereHandle *bool                `json:"h,omitempty"`
 	Flag        model.ColumnFlagType `json:"f"`
 	Value       interface{}          `json:"v"`
+	// Charset is the original charset of the string column whose value is
+	// decoded into UTF-8, e.g. gbk.
+	Charset string `json:"c,omitempty"`
 }
 
 func (c *column) FromSinkColumn(col *model.Column) {
 	c.Type = col.Type
 	c.Flag = col.Flag
+	c.Charset = col.Charset
 	if c.Flag.IsHandleKey() {
 		whereHandle := true
 		c.WhereHandle = &whereHandle
@@ -79,6 +83,7 @@ func (c *column) ToSinkColumn(name string) *model.Column {
 	col := new(model.Column)
 	col.Type = c.Type
 	col.Flag = c.Flag
+	col.Charset = c.Charset
 	col.Name = name
 	col.Value = c.Value
 	if c.Value == nil {
@@ -147,11 +152,78 @@ type mqMessageRow struct {
 	Update     map[string]column `json:"u,omitempty"`
 	PreColumns map[string]column `json:"p,omitempty"`
 	Delete     map[string]column `json:"d,omitempty"`
+
+	// columnNames is the ordinal order of the columns in the table, the
+	// columns are encoded in this order, so that consumers see the same order
+	// as the table. Columns not in it are encoded in the order of names.
+	columnNames []string
 }
 
 func (m *mqMessageRow) Encode() ([]byte, error) {
-	data, err := json.Marshal(m)
-	return data, cerror.WrapError(cerror.ErrMarshalFailed, err)
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	fields := []struct {
+		key  string
+		cols map[string]column
+	}{{"u", m.Update}, {"p", m.PreColumns}, {"d", m.Delete}}
+	first := true
+	for _, field := range fields {
+		if len(field.cols) == 0 {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(`"` + field.key + `":`)
+		if err := m.encodeColumns(buf, field.cols); err != nil {
+			return nil, cerror.WrapError(cerror.ErrMarshalFailed, err)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (m *mqMessageRow) encodeColumns(buf *bytes.Buffer, cols map[string]column) error {
+	names := make([]string, 0, len(cols))
+	for _, name := range m.columnNames {
+		if _, ok := cols[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) != len(cols) {
+		ordered := make(map[string]struct{}, len(names))
+		for _, name := range names {
+			ordered[name] = struct{}{}
+		}
+		rest := make([]string, 0, len(cols)-len(names))
+		for name := range cols {
+			if _, ok := ordered[name]; !ok {
+				rest = append(rest, name)
+			}
+		}
+		sort.Strings(rest)
+		names = append(names, rest...)
+	}
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(cols[name])
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return nil
 }
 
 func (m *mqMessageRow) Decode(data []byte) error {
@@ -176,6 +248,9 @@ func (m *mqMessageRow) Decode(data []byte) error {
 type mqMessageDDL struct {
 	Query string             `json:"q"`
 	Type  timodel.ActionType `json:"t"`
+	// Bootstrap indicates that the DDL is a schema bootstrap message which
+	// contains the full `CREATE TABLE` statement of the table.
+	Bootstrap bool `json:"b,omitempty"`
 }
 
 func (m *mqMessageDDL) Encode() ([]byte, error) {
@@ -207,7 +282,7 @@ func rowEventToMqMessage(e *model.RowChangedEvent) (*mqMessageKey, *mqMessageRow
 		Partition: partition,
 		Type:      model.MqMessageTypeRow,
 	}
-	value := &mqMessageRow{}
+	value := &mqMessageRow{columnNames: sinkColumnNames(e.Columns, e.PreColumns)}
 	if e.IsDelete() {
 		value.Delete = sinkColumns2JsonColumns(e.PreColumns)
 	} else {
@@ -217,6 +292,22 @@ func rowEventToMqMessage(e *model.RowChangedEvent) (*mqMessageKey, *mqMessageRow
 	return key, value
 }
 
+// sinkColumnNames returns the names of the columns in the order of the columns,
+// the columns and the pre-columns of a row share the same order.
+func sinkColumnNames(cols, preCols []*model.Column) []string {
+	cs := cols
+	if len(cs) == 0 {
+		cs = preCols
+	}
+	names := make([]string, 0, len(cs))
+	for _, col := range cs {
+		if col != nil {
+			names = append(names, col.Name)
+		}
+	}
+	return names
+}
+
 func sinkColumns2JsonColumns(cols []*model.Column) map[string]column {
 	jsonCols := make(map[string]column, len(cols))
 	for _, col := range cols {
@@ -280,8 +371,9 @@ func ddlEventtoMqMessage(e *model.DDLEvent) (*mqMessageKey, *mqMessageDDL) {
 		Type:   model.MqMessageTypeDDL,
 	}
 	value := &mqMessageDDL{
-		Query: e.Query,
-		Type:  e.Type,
+		Query:     e.Query,
+		Type:      e.Type,
+		Bootstrap: e.IsBootstrap,
 	}
 	return key, value
 }
@@ -296,6 +388,7 @@ func mqMessageToDDLEvent(key *mqMessageKey, value *mqMessageDDL) *model.DDLEvent
 	e.TableInfo.Schema = key.Schema
 	e.Type = value.Type
 	e.Query = value.Query
+	e.IsBootstrap = value.Bootstrap
 	return e
 }
 
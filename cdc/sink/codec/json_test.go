@@ -14,6 +14,7 @@
 package codec
 
 import (
+	"encoding/json"
 	"math"
 	"strconv"
 	"testing"
@@ -22,6 +23,7 @@ import (
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 func Test(t *testing.T) { check.TestingT(t) }
@@ -82,6 +84,14 @@ var _ = check.Suite(&batchSuite{
 		},
 		Query: "create table c",
 		Type:  3,
+	}, {
+		CommitTs: 4,
+		TableInfo: &model.SimpleTableInfo{
+			Schema: "a", Table: "d",
+		},
+		Query:       "create table if not exists d",
+		Type:        3,
+		IsBootstrap: true,
 	}}, {}},
 	resolvedTsCases: [][]uint64{{1}, {1, 2, 3}, {}},
 })
@@ -386,3 +396,118 @@ func (s *columnSuite) TestVarBinaryCol(c *check.C) {
 	col2 := jsonCol2.ToSinkColumn("test")
 	c.Assert(col2, check.DeepEquals, col)
 }
+
+func (s *columnSuite) TestColumnOrder(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the row before and after `ALTER TABLE t ADD COLUMN b INT AFTER a`
+	rowBefore := &model.RowChangedEvent{
+		CommitTs: 1,
+		Table:    &model.TableName{Schema: "test", Table: "t"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Value: int64(1)},
+			{Name: "a", Type: mysql.TypeLong, Value: int64(1)},
+			{Name: "c", Type: mysql.TypeLong, Value: int64(1)},
+		},
+	}
+	rowAfter := &model.RowChangedEvent{
+		CommitTs: 2,
+		Table:    &model.TableName{Schema: "test", Table: "t"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Value: int64(2)},
+			{Name: "a", Type: mysql.TypeLong, Value: int64(2)},
+			nil,
+			{Name: "b", Type: mysql.TypeLong, Value: int64(2)},
+			{Name: "c", Type: mysql.TypeLong, Value: int64(2)},
+		},
+		PreColumns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Value: int64(2)},
+			{Name: "a", Type: mysql.TypeLong, Value: int64(1)},
+			nil,
+			{Name: "b", Type: mysql.TypeLong, Value: int64(1)},
+			{Name: "c", Type: mysql.TypeLong, Value: int64(1)},
+		},
+	}
+	_, value := rowEventToMqMessage(rowBefore)
+	data, err := value.Encode()
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals,
+		`{"u":{"id":{"t":3,"f":0,"v":1},"a":{"t":3,"f":0,"v":1},"c":{"t":3,"f":0,"v":1}}}`)
+
+	_, value = rowEventToMqMessage(rowAfter)
+	data, err = value.Encode()
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals,
+		`{"u":{"id":{"t":3,"f":0,"v":2},"a":{"t":3,"f":0,"v":2},"b":{"t":3,"f":0,"v":2},"c":{"t":3,"f":0,"v":2}},`+
+			`"p":{"id":{"t":3,"f":0,"v":2},"a":{"t":3,"f":0,"v":1},"b":{"t":3,"f":0,"v":1},"c":{"t":3,"f":0,"v":1}}}`)
+
+	// the encoded row can be decoded as before
+	row := new(mqMessageRow)
+	err = row.Decode(data)
+	c.Assert(err, check.IsNil)
+	c.Assert(row.Update, check.HasLen, 4)
+	c.Assert(row.PreColumns, check.HasLen, 4)
+	c.Assert(row.Update["b"].Value, check.Equals, json.Number("2"))
+
+	// the columns out of the order are encoded in the order of names
+	value = &mqMessageRow{Delete: map[string]column{
+		"z": {Type: mysql.TypeLong, Value: int64(1)},
+		"y": {Type: mysql.TypeLong, Value: int64(1)},
+	}, columnNames: []string{"z", "x"}}
+	value.Delete["w"] = column{Type: mysql.TypeLong, Value: int64(1)}
+	data, err = value.Encode()
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals,
+		`{"d":{"z":{"t":3,"f":0,"v":1},"w":{"t":3,"f":0,"v":1},"y":{"t":3,"f":0,"v":1}}}`)
+}
+
+func (s *columnSuite) TestCharsetCol(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// "中文" in gbk, and "中文𠀀" in gb18030
+	gbkValue := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	gb18030Value := []byte{0xd6, 0xd0, 0xce, 0xc4, 0x95, 0x32, 0x82, 0x36}
+	// the values of the charsets are decoded into UTF-8 by the mounter
+	row := &model.RowChangedEvent{
+		CommitTs: 1,
+		Table:    &model.TableName{Schema: "test", Table: "t"},
+		Columns: []*model.Column{
+			{Name: "a", Type: mysql.TypeVarchar, Value: []byte("中文"), Charset: "gbk"},
+			{Name: "b", Type: mysql.TypeBlob, Value: []byte("中文𠀀"), Charset: "gb18030"},
+			{Name: "c", Type: mysql.TypeVarchar, Flag: model.BinaryFlag, Value: gbkValue},
+		},
+	}
+	key, value := rowEventToMqMessage(row)
+	data, err := value.Encode()
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, `.*"a":\{"t":15,"f":0,"v":"中文","c":"gbk"\}.*`)
+	decoded := new(mqMessageRow)
+	err = decoded.Decode(data)
+	c.Assert(err, check.IsNil)
+	cols := mqMessageToRowEvent(key, decoded).Columns
+	c.Assert(cols, check.HasLen, 3)
+	// the columns are sorted by names in descending order
+	c.Assert(cols[2], check.DeepEquals, row.Columns[0])
+	c.Assert(cols[1], check.DeepEquals, row.Columns[1])
+	c.Assert(cols[0], check.DeepEquals, row.Columns[2])
+
+	// the values are encoded back to the original bytes by the charsets
+	encoded, err := simplifiedchinese.GBK.NewEncoder().Bytes(cols[2].Value.([]byte))
+	c.Assert(err, check.IsNil)
+	c.Assert(encoded, check.DeepEquals, gbkValue)
+	encoded, err = simplifiedchinese.GB18030.NewEncoder().Bytes(cols[1].Value.([]byte))
+	c.Assert(err, check.IsNil)
+	c.Assert(encoded, check.DeepEquals, gb18030Value)
+
+	// the DDLs containing the literals of the charsets pass through as they are
+	ddl := &model.DDLEvent{
+		CommitTs:  2,
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t"},
+		Query:     "ALTER TABLE t ADD COLUMN d VARCHAR(10) CHARSET gbk DEFAULT '中文'",
+	}
+	ddlKey, ddlValue := ddlEventtoMqMessage(ddl)
+	data, err = ddlValue.Encode()
+	c.Assert(err, check.IsNil)
+	decodedDDL := new(mqMessageDDL)
+	err = decodedDDL.Decode(data)
+	c.Assert(err, check.IsNil)
+	c.Assert(mqMessageToDDLEvent(ddlKey, decodedDDL).Query, check.Equals, ddl.Query)
+}
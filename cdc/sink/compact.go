@@ -0,0 +1,341 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultCompactMaxKeys is the number of the keys buffered by the compact sink
+// if the max keys is not set
+const defaultCompactMaxKeys = 100000
+
+// compactEntry is the changes of a key in a flush interval, only the first and
+// the last changes matter. The rows without handle keys are entries of their
+// own, whose first and last changes are the same.
+type compactEntry struct {
+	// key is the handle key, it's empty for the rows without handle keys
+	key   string
+	first *model.RowChangedEvent
+	last  *model.RowChangedEvent
+	// merged is the number of the changes merged into the entry
+	merged int
+}
+
+// compactTable is the buffered changes of a table
+type compactTable struct {
+	// entries are in the order of their first changes
+	entries []*compactEntry
+	// open are the entries the next changes of the keys are merged into
+	open map[string]*compactEntry
+}
+
+// close stops merging the changes into the entry
+func (t *compactTable) close(entry *compactEntry) {
+	if t.open[entry.key] == entry {
+		delete(t.open, entry.key)
+	}
+}
+
+// compactSink wraps a sink and compacts the rows sent to it. The rows are
+// merged into the first and the last changes of their handle keys once they're
+// sent, and once a resolved ts is flushed, the keys whose last changes are not
+// after the resolved ts are sent to the wrapped sink before it's flushed, so
+// that only the last change of each handle key in the flush interval is
+// written:
+//
+//   - an insert followed by a delete is dropped
+//   - an insert followed by updates is an insert of the last values
+//   - updates are an update from the first old values to the last values
+//   - a delete followed by an insert is an update
+//
+// An update changing the handle key is taken as a delete of the old key and an
+// insert of the new key, the rows without handle keys are sent as they are.
+// The compacted rows of a table are sent in the order of the commit ts of the
+// last changes, the unique keys other than the handle key may be violated
+// temporarily if they're reused by other keys in the interval.
+//
+// The changes of a key across the resolved ts can't be split, so the key stops
+// taking the later changes, and the wrapped sink is flushed before its first
+// change until its last change is resolved. Once the buffered keys exceed the
+// max keys, all the buffered keys are sent, and the rows sent until the next
+// flush are sent without compaction.
+type compactSink struct {
+	Sink
+	changefeedID string
+	maxKeys      int
+
+	mu     sync.Mutex
+	tables map[model.TableID]*compactTable
+	// entries is the number of the buffered entries of all the tables
+	entries int
+	// spans are the first and the last commit ts of the compacted rows sent
+	// to the wrapped sink on overflow, whose changes are across more than one
+	// commit ts. The wrapped sink is flushed before the first one until the
+	// last one is resolved.
+	spans map[model.TableID][][2]uint64
+	// overflowed means the rows are sent without compaction until the next
+	// flush
+	overflowed bool
+
+	compactedCounter prometheus.Counter
+	overflowCounter  prometheus.Counter
+}
+
+func newCompactSink(s Sink, cfg *config.ReplicaConfig, opts map[string]string) *compactSink {
+	maxKeys := cfg.Compact.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultCompactMaxKeys
+	}
+	changefeedID, captureAddr := opts[OptChangefeedID], opts[OptCaptureAddr]
+	log.Info("the rows sent to the sink are compacted in each flush interval",
+		zap.String("changefeed", changefeedID), zap.Int("maxKeys", maxKeys))
+	return &compactSink{
+		Sink:             s,
+		changefeedID:     changefeedID,
+		maxKeys:          maxKeys,
+		tables:           make(map[model.TableID]*compactTable),
+		spans:            make(map[model.TableID][][2]uint64),
+		compactedCounter: compactedRowsCounter.WithLabelValues(captureAddr, changefeedID),
+		overflowCounter:  compactOverflowCounter.WithLabelValues(captureAddr, changefeedID),
+	}
+}
+
+// RemoveCompactedTable drops the buffered rows of the table removed from the
+// processor, which are after the resolved ts flushed and replicated by the
+// next processor of the table. It's no-op if the sink is not compacted.
+func RemoveCompactedTable(s Sink, tableID model.TableID) {
+	if audited, ok := s.(*auditSink); ok {
+		s = audited.Sink
+	}
+	if s, ok := s.(*compactSink); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if table, ok := s.tables[tableID]; ok {
+			s.entries -= len(table.entries)
+			delete(s.tables, tableID)
+		}
+		delete(s.spans, tableID)
+	}
+}
+
+func (s *compactSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.mu.Lock()
+	if s.overflowed {
+		s.mu.Unlock()
+		return s.Sink.EmitRowChangedEvents(ctx, rows...)
+	}
+	for _, row := range rows {
+		s.add(row)
+	}
+	if s.entries <= s.maxKeys {
+		s.mu.Unlock()
+		return nil
+	}
+	// the buffered keys are sent in the order of their last changes for each
+	// table, the later rows of the tables are not before them
+	var buffered []*model.RowChangedEvent
+	dropped := 0
+	for tableID, table := range s.tables {
+		for _, entry := range table.entries {
+			if entry.first.CommitTs != entry.last.CommitTs {
+				s.spans[tableID] = append(s.spans[tableID], [2]uint64{entry.first.CommitTs, entry.last.CommitTs})
+			}
+		}
+		rows, compacted := compactEntries(table.entries)
+		buffered = append(buffered, rows...)
+		dropped += compacted
+		delete(s.tables, tableID)
+	}
+	s.entries = 0
+	s.overflowed = true
+	s.mu.Unlock()
+	s.compactedCounter.Add(float64(dropped))
+	s.overflowCounter.Inc()
+	log.Warn("too many keys are buffered by the compact sink, the rows are sent without compaction until the next flush",
+		zap.String("changefeed", s.changefeedID), zap.Int("maxKeys", s.maxKeys), zap.Int("rows", len(buffered)))
+	return s.Sink.EmitRowChangedEvents(ctx, buffered...)
+}
+
+// add merges the row into the open entries of its handle keys
+func (s *compactSink) add(row *model.RowChangedEvent) {
+	tableID := row.Table.TableID
+	table, ok := s.tables[tableID]
+	if !ok {
+		table = &compactTable{open: make(map[string]*compactEntry)}
+		s.tables[tableID] = table
+	}
+	merge := func(key string, row *model.RowChangedEvent) {
+		entry, ok := table.open[key]
+		if !ok {
+			entry = &compactEntry{key: key, first: row}
+			table.open[key] = entry
+			table.entries = append(table.entries, entry)
+			s.entries++
+		}
+		entry.last = row
+		entry.merged++
+	}
+	preKey, preOK := handleKeyString(tableID, row.PreColumns)
+	key, ok := handleKeyString(tableID, row.Columns)
+	switch {
+	case !preOK && !ok:
+		table.entries = append(table.entries, &compactEntry{first: row, last: row, merged: 1})
+		s.entries++
+	case preOK && ok && preKey != key:
+		deleted, inserted := *row, *row
+		deleted.Columns = nil
+		inserted.PreColumns = nil
+		merge(preKey, &deleted)
+		merge(key, &inserted)
+	case ok:
+		merge(key, row)
+	default:
+		merge(preKey, row)
+	}
+}
+
+// compactEntries returns the compacted rows of the entries in the order of the
+// commit ts of their last changes, and the number of the changes compacted.
+func compactEntries(entries []*compactEntry) ([]*model.RowChangedEvent, int) {
+	var result []*model.RowChangedEvent
+	compacted := 0
+	for _, entry := range entries {
+		if row := entry.row(); row != nil {
+			result = append(result, row)
+			compacted += entry.merged - 1
+		} else {
+			compacted += entry.merged
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CommitTs < result[j].CommitTs
+	})
+	return result, compacted
+}
+
+func (s *compactSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	s.mu.Lock()
+	flushTs := resolvedTs
+	holdBefore := func(firstTs uint64) {
+		if firstTs > 0 && firstTs-1 < flushTs {
+			flushTs = firstTs - 1
+		}
+	}
+	// the spans sent on overflow are pruned once they're resolved
+	for tableID, spans := range s.spans {
+		var remained [][2]uint64
+		for _, span := range spans {
+			if span[1] > resolvedTs {
+				remained = append(remained, span)
+				holdBefore(span[0])
+			}
+		}
+		if len(remained) == 0 {
+			delete(s.spans, tableID)
+		} else {
+			s.spans[tableID] = remained
+		}
+	}
+	var compacted []*model.RowChangedEvent
+	dropped := 0
+	for tableID, table := range s.tables {
+		var flushed, remained []*compactEntry
+		for _, entry := range table.entries {
+			switch {
+			case entry.last.CommitTs <= resolvedTs:
+				flushed = append(flushed, entry)
+			case entry.first.CommitTs <= resolvedTs:
+				// the changes of the key across the resolved ts are held
+				// until the last one is resolved, the later changes of the
+				// key are taken by a new entry
+				remained = append(remained, entry)
+				holdBefore(entry.first.CommitTs)
+				table.close(entry)
+			default:
+				remained = append(remained, entry)
+			}
+		}
+		for _, entry := range flushed {
+			table.close(entry)
+		}
+		s.entries -= len(flushed)
+		if len(remained) == 0 {
+			delete(s.tables, tableID)
+		} else {
+			table.entries = remained
+		}
+		rows, n := compactEntries(flushed)
+		compacted = append(compacted, rows...)
+		dropped += n
+	}
+	s.overflowed = false
+	s.mu.Unlock()
+	s.compactedCounter.Add(float64(dropped))
+	if len(compacted) > 0 {
+		if err := s.Sink.EmitRowChangedEvents(ctx, compacted...); err != nil {
+			return model.FlushResult{}, err
+		}
+	}
+	return s.Sink.FlushRowChangedEvents(ctx, flushTs)
+}
+
+// row returns the change from the state before the first change to the state
+// after the last change, it's nil if the key exists neither before nor after.
+func (e *compactEntry) row() *model.RowChangedEvent {
+	if e.first == e.last {
+		return e.first
+	}
+	// an insert has no old values, the key doesn't exist before it
+	existedBefore := len(e.first.PreColumns) != 0
+	existsAfter := !e.last.IsDelete()
+	if !existedBefore && !existsAfter {
+		return nil
+	}
+	row := *e.last
+	row.PreColumns = nil
+	if existedBefore {
+		row.PreColumns = e.first.PreColumns
+	}
+	if !existsAfter {
+		row.Columns = nil
+	}
+	return &row
+}
+
+// handleKeyString formats the handle key of the columns, unlike the hashes
+// used by the audit sink, the different keys never collide.
+func handleKeyString(tableID model.TableID, cols []*model.Column) (string, bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d", tableID)
+	found := false
+	for _, col := range cols {
+		if col == nil || !col.Flag.IsHandleKey() {
+			continue
+		}
+		found = true
+		fmt.Fprintf(&b, ",%s=%#v", col.Name, col.Value)
+	}
+	return b.String(), found
+}
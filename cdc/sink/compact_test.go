@@ -0,0 +1,262 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type compactSinkSuite struct{}
+
+var _ = check.Suite(&compactSinkSuite{})
+
+// recordSink records the rows sent to it
+type recordSink struct {
+	discardSink
+	rows []*model.RowChangedEvent
+}
+
+func (s *recordSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *recordSink) take() []*model.RowChangedEvent {
+	rows := s.rows
+	s.rows = nil
+	return rows
+}
+
+func newCompactTestSink(c *check.C, maxKeys int) (*compactSink, *recordSink) {
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Compact = &config.CompactConfig{Enable: true, MaxKeys: maxKeys}
+	opts := map[string]string{OptChangefeedID: c.TestName(), OptCaptureAddr: "127.0.0.1:8300"}
+	inner := &recordSink{}
+	return newCompactSink(inner, cfg, opts), inner
+}
+
+func compactTestColumns(handle int64, value string) []*model.Column {
+	return []*model.Column{
+		{Name: "id", Value: handle, Flag: model.HandleKeyFlag},
+		{Name: "v", Value: value},
+	}
+}
+
+func compactTestInsert(handle int64, value string, commitTs uint64) *model.RowChangedEvent {
+	return &model.RowChangedEvent{
+		CommitTs: commitTs,
+		Table:    &model.TableName{Schema: "test", Table: "t", TableID: 1},
+		Columns:  compactTestColumns(handle, value),
+	}
+}
+
+func compactTestUpdate(handle int64, oldValue, value string, commitTs uint64) *model.RowChangedEvent {
+	row := compactTestInsert(handle, value, commitTs)
+	row.PreColumns = compactTestColumns(handle, oldValue)
+	return row
+}
+
+func compactTestDelete(handle int64, oldValue string, commitTs uint64) *model.RowChangedEvent {
+	row := compactTestInsert(handle, "", commitTs)
+	row.Columns = nil
+	row.PreColumns = compactTestColumns(handle, oldValue)
+	return row
+}
+
+func (s *compactSinkSuite) TestCompactInOneInterval(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink, inner := newCompactTestSink(c, 0)
+	flush := func(resolvedTs uint64) []*model.RowChangedEvent {
+		result, err := sink.FlushRowChangedEvents(ctx, resolvedTs)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.CheckpointTs, check.Equals, resolvedTs)
+		return inner.take()
+	}
+
+	// insert -> update -> delete is dropped
+	c.Assert(sink.EmitRowChangedEvents(ctx,
+		compactTestInsert(1, "a", 10), compactTestUpdate(1, "a", "b", 11), compactTestDelete(1, "b", 12)), check.IsNil)
+	c.Assert(inner.rows, check.HasLen, 0)
+	// the changes are merged once they're sent
+	c.Assert(sink.entries, check.Equals, 1)
+	c.Assert(flush(12), check.HasLen, 0)
+	c.Assert(testutil.ToFloat64(sink.compactedCounter), check.Equals, float64(3))
+
+	// insert -> update is an insert of the last values
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(2, "a", 20), compactTestUpdate(2, "a", "b", 21)), check.IsNil)
+	c.Assert(flush(21), check.DeepEquals, []*model.RowChangedEvent{compactTestInsert(2, "b", 21)})
+
+	// the updates are one update from the first old values
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestUpdate(2, "b", "c", 30), compactTestUpdate(2, "c", "d", 31)), check.IsNil)
+	c.Assert(flush(31), check.DeepEquals, []*model.RowChangedEvent{compactTestUpdate(2, "b", "d", 31)})
+
+	// update -> delete is a delete of the first old values, and delete ->
+	// insert is an update
+	c.Assert(sink.EmitRowChangedEvents(ctx,
+		compactTestUpdate(2, "d", "e", 40), compactTestDelete(2, "e", 41),
+		compactTestDelete(3, "a", 42), compactTestInsert(3, "b", 43)), check.IsNil)
+	c.Assert(flush(43), check.DeepEquals, []*model.RowChangedEvent{
+		compactTestDelete(2, "d", 41), compactTestUpdate(3, "a", "b", 43),
+	})
+
+	// an update changing the handle key is a delete and an insert
+	moved := compactTestUpdate(5, "a", "b", 51)
+	moved.PreColumns = compactTestColumns(4, "a")
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(4, "a", 50), moved), check.IsNil)
+	c.Assert(flush(51), check.DeepEquals, []*model.RowChangedEvent{compactTestInsert(5, "b", 51)})
+
+	// the rows without handle keys are not compacted
+	noHandle := &model.RowChangedEvent{
+		CommitTs: 60,
+		Table:    &model.TableName{Schema: "test", Table: "t", TableID: 1},
+		Columns:  []*model.Column{{Name: "v", Value: "a"}},
+	}
+	c.Assert(sink.EmitRowChangedEvents(ctx, noHandle, noHandle), check.IsNil)
+	c.Assert(flush(60), check.HasLen, 2)
+	c.Assert(sink.entries, check.Equals, 0)
+	c.Assert(sink.tables, check.HasLen, 0)
+}
+
+func (s *compactSinkSuite) TestCompactAcrossIntervals(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink, inner := newCompactTestSink(c, 0)
+	flush := func(resolvedTs, checkpointTs uint64) []*model.RowChangedEvent {
+		result, err := sink.FlushRowChangedEvents(ctx, resolvedTs)
+		c.Assert(err, check.IsNil)
+		c.Assert(result.CheckpointTs, check.Equals, checkpointTs)
+		return inner.take()
+	}
+
+	// the changes of a key across the resolved ts are held until the last
+	// one is resolved, the wrapped sink is flushed before the first one
+	c.Assert(sink.EmitRowChangedEvents(ctx,
+		compactTestInsert(1, "a", 10), compactTestUpdate(1, "a", "b", 20), compactTestDelete(1, "b", 30)), check.IsNil)
+	c.Assert(flush(10, 9), check.HasLen, 0)
+	c.Assert(flush(20, 9), check.HasLen, 0)
+	c.Assert(flush(30, 30), check.HasLen, 0)
+
+	// the resolved changes are flushed, and the held key takes no more
+	// changes, which are merged into a new entry
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(2, "a", 40)), check.IsNil)
+	c.Assert(flush(40, 40), check.DeepEquals, []*model.RowChangedEvent{compactTestInsert(2, "a", 40)})
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestUpdate(2, "a", "b", 50), compactTestDelete(2, "b", 60)), check.IsNil)
+	c.Assert(flush(50, 49), check.HasLen, 0)
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(2, "c", 70)), check.IsNil)
+	c.Assert(sink.entries, check.Equals, 2)
+	c.Assert(flush(70, 70), check.DeepEquals, []*model.RowChangedEvent{
+		compactTestDelete(2, "a", 60), compactTestInsert(2, "c", 70),
+	})
+	c.Assert(sink.entries, check.Equals, 0)
+	c.Assert(sink.tables, check.HasLen, 0)
+}
+
+func (s *compactSinkSuite) TestCompactOverflow(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink, inner := newCompactTestSink(c, 2)
+
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(1, "a", 10), compactTestUpdate(1, "a", "b", 11)), check.IsNil)
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(2, "a", 12)), check.IsNil)
+	c.Assert(inner.rows, check.HasLen, 0)
+	// the third key is exceeded, the buffered keys are sent, and the later
+	// rows are sent without compaction
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(3, "a", 13)), check.IsNil)
+	c.Assert(inner.take(), check.DeepEquals, []*model.RowChangedEvent{
+		compactTestInsert(1, "b", 11), compactTestInsert(2, "a", 12), compactTestInsert(3, "a", 13),
+	})
+	c.Assert(sink.entries, check.Equals, 0)
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestUpdate(3, "a", "b", 14)), check.IsNil)
+	c.Assert(inner.take(), check.HasLen, 1)
+	c.Assert(testutil.ToFloat64(sink.overflowCounter), check.Equals, float64(1))
+	// the wrapped sink is flushed before the changes of the first key, which
+	// are sent as one row
+	result, err := sink.FlushRowChangedEvents(ctx, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.CheckpointTs, check.Equals, uint64(9))
+	result, err = sink.FlushRowChangedEvents(ctx, 14)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.CheckpointTs, check.Equals, uint64(14))
+	c.Assert(inner.take(), check.HasLen, 0)
+	c.Assert(sink.spans, check.HasLen, 0)
+
+	// the rows are compacted again after the flush
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestUpdate(3, "b", "c", 20), compactTestUpdate(3, "c", "d", 21)), check.IsNil)
+	c.Assert(inner.rows, check.HasLen, 0)
+	_, err = sink.FlushRowChangedEvents(ctx, 21)
+	c.Assert(err, check.IsNil)
+	c.Assert(inner.take(), check.DeepEquals, []*model.RowChangedEvent{compactTestUpdate(3, "b", "d", 21)})
+}
+
+func (s *compactSinkSuite) TestRemoveCompactedTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	sink, inner := newCompactTestSink(c, 0)
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestInsert(1, "a", 10)), check.IsNil)
+	_, err := sink.FlushRowChangedEvents(ctx, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(inner.take(), check.HasLen, 1)
+	c.Assert(sink.EmitRowChangedEvents(ctx, compactTestUpdate(1, "a", "b", 20)), check.IsNil)
+
+	// the rows after the resolved ts are dropped with the table
+	RemoveCompactedTable(sink, 1)
+	c.Assert(sink.entries, check.Equals, 0)
+	c.Assert(sink.tables, check.HasLen, 0)
+	_, err = sink.FlushRowChangedEvents(ctx, 20)
+	c.Assert(err, check.IsNil)
+	c.Assert(inner.take(), check.HasLen, 0)
+}
+
+func (s *compactSinkSuite) TestUnwrap(c *check.C) {
+	defer testleak.AfterTest(c)()
+	sink, inner := newCompactTestSink(c, 0)
+	c.Assert(Unwrap(sink), check.Equals, Sink(inner))
+	cfg := config.GetDefaultReplicaConfig()
+	audited := newAuditSink(sink, cfg, map[string]string{OptChangefeedID: c.TestName()})
+	c.Assert(Unwrap(audited), check.Equals, Sink(inner))
+}
+
+func (s *compactSinkSuite) TestValidateCompact(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	c.Assert(cfg.ValidateCompact(), check.IsNil)
+	cfg.Compact.Enable = true
+	c.Assert(cfg.ValidateCompact(), check.IsNil)
+	for _, uri := range []string{"mysql://127.0.0.1:3306/", "blackhole://"} {
+		c.Assert(ValidateConfig(uri, cfg), check.IsNil)
+	}
+	for _, uri := range []string{"kafka://127.0.0.1:9092/test", "pulsar://127.0.0.1:6650/test", "local:///tmp/cdclog", "s3://bucket/prefix"} {
+		err := ValidateConfig(uri, cfg)
+		c.Assert(cerror.ErrSinkIncompatibleConfig.Equal(err), check.IsTrue, check.Commentf("%s", uri))
+	}
+
+	cfg.RequireCompleteness = true
+	c.Assert(cerror.ErrInvalidCompactConfig.Equal(cfg.ValidateCompact()), check.IsTrue)
+	// it's checked again by the server
+	c.Assert(cerror.ErrInvalidCompactConfig.Equal(ValidateConfig("mysql://127.0.0.1:3306/", cfg)), check.IsTrue)
+	cfg.RequireCompleteness = false
+	cfg.Cyclic.Enable = true
+	c.Assert(cerror.ErrInvalidCompactConfig.Equal(cfg.ValidateCompact()), check.IsTrue)
+	cfg.Cyclic.Enable = false
+	cfg.EnableOldValue = false
+	c.Assert(cerror.ErrInvalidCompactConfig.Equal(cfg.ValidateCompact()), check.IsTrue)
+}
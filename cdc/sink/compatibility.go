@@ -0,0 +1,155 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// Requirements declares what a sink and its protocol require from the replica
+// config, and the features they support.
+type Requirements struct {
+	// NeedOldValue means the pre-images of the updated and deleted rows are
+	// required, so the old value must be enabled.
+	NeedOldValue bool
+	// NeedHandleKeys means every row must have a primary key or a not null
+	// unique key, so the ineligible tables can't be force replicated.
+	NeedHandleKeys bool
+	// SupportDDL means the DDLs are replicated to the downstream.
+	SupportDDL bool
+	// SupportCyclic means the marks of the cyclic replication are handled.
+	SupportCyclic bool
+	// SupportTargets means the tables can be routed to the targets in the
+	// sink config, see config.TargetRule.
+	SupportTargets bool
+	// SupportCompact means only the latest states of the rows are required,
+	// so the rows can be compacted in each flush interval. The sinks writing
+	// a change log require the full change history.
+	SupportCompact bool
+}
+
+var schemeRequirements = map[string]Requirements{
+	"blackhole":  {SupportDDL: true, SupportCyclic: true, SupportCompact: true},
+	"mysql":      {SupportDDL: true, SupportCyclic: true, SupportTargets: true, SupportCompact: true},
+	"mysql+ssl":  {SupportDDL: true, SupportCyclic: true, SupportTargets: true, SupportCompact: true},
+	"tidb":       {SupportDDL: true, SupportCyclic: true, SupportTargets: true, SupportCompact: true},
+	"tidb+ssl":   {SupportDDL: true, SupportCyclic: true, SupportTargets: true, SupportCompact: true},
+	"postgres":   {SupportDDL: true, SupportCompact: true},
+	"postgresql": {SupportDDL: true, SupportCompact: true},
+	"local":      {SupportDDL: true},
+	"s3":         {SupportDDL: true},
+}
+
+var protocolRequirements = map[codec.Protocol]Requirements{
+	codec.ProtocolDefault:   {SupportDDL: true},
+	codec.ProtocolCanal:     {NeedOldValue: true, SupportDDL: true},
+	codec.ProtocolCanalJSON: {NeedOldValue: true, SupportDDL: true},
+	codec.ProtocolMaxwell:   {NeedOldValue: true, SupportDDL: true},
+	// the keys of the Avro messages are encoded from the handle key columns,
+	// and the DDLs are not encoded.
+	codec.ProtocolAvro: {NeedHandleKeys: true},
+}
+
+// GetRequirements returns the requirements of the sink, the protocol of the MQ
+// sinks is read from the sink uri first, and then from the replica config. It
+// returns false if the scheme of the sink uri is unknown.
+func GetRequirements(sinkURI *url.URL, cfg *config.ReplicaConfig) (string, Requirements, bool) {
+	scheme := strings.ToLower(sinkURI.Scheme)
+	if req, ok := schemeRequirements[scheme]; ok {
+		return scheme, req, true
+	}
+	if !IsMQSinkURI(sinkURI.String()) {
+		return scheme, Requirements{}, false
+	}
+	protocolStr := sinkURI.Query().Get("protocol")
+	if protocolStr == "" && cfg.Sink != nil {
+		protocolStr = cfg.Sink.Protocol
+	}
+	var protocol codec.Protocol
+	protocol.FromString(protocolStr)
+	if protocolStr == "" {
+		protocolStr = "default"
+	}
+	return scheme + " with protocol " + protocolStr, protocolRequirements[protocol], true
+}
+
+// checkRequirements cross-checks the replica config with the requirements
+// and returns all the violated constraints.
+func checkRequirements(req Requirements, cfg *config.ReplicaConfig) []string {
+	var violations []string
+	if req.NeedOldValue && !cfg.EnableOldValue {
+		violations = append(violations, "the old value must be enabled")
+	}
+	if req.NeedHandleKeys && cfg.ForceReplicate {
+		violations = append(violations, "the tables without a valid index can't be force replicated")
+	}
+	if !req.SupportCyclic && cfg.Cyclic.IsEnabled() {
+		violations = append(violations, "the cyclic replication is not supported")
+	}
+	if cfg.Sink != nil && len(cfg.Sink.Targets) > 0 {
+		if !req.SupportTargets {
+			violations = append(violations, "the targets are not supported")
+		} else if cfg.Cyclic.IsEnabled() {
+			violations = append(violations, "the cyclic replication is not supported with the targets")
+		}
+	}
+	if !req.SupportCompact && cfg.Compact != nil && cfg.Compact.Enable {
+		violations = append(violations, "the rows can't be compacted, the full change history is required")
+	}
+	if !req.SupportDDL {
+		if cfg.Cyclic.IsEnabled() && cfg.Cyclic.SyncDDL {
+			violations = append(violations, "the DDLs can't be synced in the cyclic replication")
+		}
+		if cfg.Sink != nil && cfg.Sink.SchemaChangesTopic != "" {
+			violations = append(violations, "the schema changes topic is not supported")
+		}
+	}
+	return violations
+}
+
+// ValidateConfig checks whether the replica config is compatible with the
+// sink and its protocol, all the violated constraints are reported at once.
+// The options which can't be enabled together are checked first.
+func ValidateConfig(sinkURIStr string, cfg *config.ReplicaConfig) error {
+	sinkURI, err := url.Parse(sinkURIStr)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrSinkURIInvalid, err)
+	}
+	if err := cfg.ValidateCompleteness(); err != nil {
+		return err
+	}
+	if err := cfg.ValidateCompact(); err != nil {
+		return err
+	}
+	name, req, ok := GetRequirements(sinkURI, cfg)
+	if !ok {
+		// the unknown scheme is reported when creating the sink
+		return nil
+	}
+	if req.SupportTargets {
+		if _, err := newMySQLTargetRouter(cfg); err != nil {
+			return err
+		}
+	}
+	violations := checkRequirements(req, cfg)
+	if len(violations) == 0 {
+		return nil
+	}
+	return cerror.ErrSinkIncompatibleConfig.GenWithStackByArgs(name, strings.Join(violations, "; "))
+}
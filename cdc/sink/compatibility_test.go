@@ -0,0 +1,191 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"net/url"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type compatibilitySuite struct{}
+
+var _ = check.Suite(&compatibilitySuite{})
+
+func (s *compatibilitySuite) TestValidateConfig(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cyclic := func(cfg *config.ReplicaConfig) {
+		cfg.Cyclic = &config.CyclicConfig{Enable: true, ReplicaID: 1, FilterReplicaID: []uint64{2}}
+	}
+	testCases := []struct {
+		sinkURI string
+		update  func(cfg *config.ReplicaConfig)
+		// the violated constraints, nil means the config is compatible
+		violations []string
+	}{{
+		sinkURI: "mysql://127.0.0.1:3306/",
+		update:  cyclic,
+	}, {
+		sinkURI: "blackhole:///",
+		update: func(cfg *config.ReplicaConfig) {
+			cfg.EnableOldValue = false
+			cfg.ForceReplicate = true
+		},
+	}, {
+		sinkURI: "kafka://127.0.0.1:9092/topic?protocol=canal-json",
+		update:  func(cfg *config.ReplicaConfig) { cfg.EnableOldValue = false },
+		violations: []string{
+			"the old value must be enabled",
+		},
+	}, {
+		// the protocol in the replica config is used if it's not in the uri
+		sinkURI: "pulsar://127.0.0.1:6650/topic",
+		update: func(cfg *config.ReplicaConfig) {
+			cfg.EnableOldValue = false
+			cfg.Sink.Protocol = "maxwell"
+		},
+		violations: []string{
+			"the old value must be enabled",
+		},
+	}, {
+		sinkURI: "kafka://127.0.0.1:9092/topic?protocol=avro",
+		update: func(cfg *config.ReplicaConfig) {
+			cyclic(cfg)
+			cfg.Cyclic.SyncDDL = true
+			cfg.ForceReplicate = true
+			cfg.Sink.SchemaChangesTopic = "ddl"
+		},
+		violations: []string{
+			"the tables without a valid index can't be force replicated",
+			"the cyclic replication is not supported",
+			"the DDLs can't be synced in the cyclic replication",
+			"the schema changes topic is not supported",
+		},
+	}, {
+		sinkURI: "kafka://127.0.0.1:9092/topic",
+		update: func(cfg *config.ReplicaConfig) {
+			cfg.EnableOldValue = false
+			cfg.ForceReplicate = true
+		},
+	}, {
+		sinkURI: "kafka+ssl://127.0.0.1:9092/topic",
+		update:  cyclic,
+		violations: []string{
+			"the cyclic replication is not supported",
+		},
+	}, {
+		sinkURI: "postgres://127.0.0.1:5432/",
+		update:  cyclic,
+		violations: []string{
+			"the cyclic replication is not supported",
+		},
+	}, {
+		sinkURI: "s3://bucket/prefix",
+		update:  cyclic,
+		violations: []string{
+			"the cyclic replication is not supported",
+		},
+	}, {
+		sinkURI: "mysql://127.0.0.1:3306/",
+		update: func(cfg *config.ReplicaConfig) {
+			cyclic(cfg)
+			cfg.Sink.Targets = []*config.TargetRule{{Matcher: []string{"test.*"}, SinkURI: "mysql://127.0.0.1:3307/"}}
+		},
+		violations: []string{
+			"the cyclic replication is not supported with the targets",
+		},
+	}, {
+		sinkURI: "kafka://127.0.0.1:9092/topic",
+		update: func(cfg *config.ReplicaConfig) {
+			cfg.Sink.Targets = []*config.TargetRule{{Matcher: []string{"test.*"}, SinkURI: "mysql://127.0.0.1:3307/"}}
+		},
+		violations: []string{
+			"the targets are not supported",
+		},
+	}, {
+		sinkURI: "mysql://127.0.0.1:3306/",
+		update:  func(cfg *config.ReplicaConfig) { cfg.Compact.Enable = true },
+	}, {
+		sinkURI: "kafka://127.0.0.1:9092/topic?protocol=canal-json",
+		update:  func(cfg *config.ReplicaConfig) { cfg.Compact.Enable = true },
+		violations: []string{
+			"the rows can't be compacted, the full change history is required",
+		},
+	}, {
+		sinkURI: "local:///tmp/cdclog",
+		update:  func(cfg *config.ReplicaConfig) { cfg.Compact.Enable = true },
+		violations: []string{
+			"the rows can't be compacted, the full change history is required",
+		},
+	}, {
+		// the unknown scheme is reported when creating the sink
+		sinkURI: "unknown://127.0.0.1/",
+		update:  cyclic,
+	}}
+	for _, tc := range testCases {
+		cfg := config.GetDefaultReplicaConfig()
+		tc.update(cfg)
+		sinkURI, err := url.Parse(tc.sinkURI)
+		c.Assert(err, check.IsNil)
+		if _, req, ok := GetRequirements(sinkURI, cfg); ok {
+			c.Assert(checkRequirements(req, cfg), check.DeepEquals, tc.violations, check.Commentf("%s", tc.sinkURI))
+		}
+
+		err = ValidateConfig(tc.sinkURI, cfg)
+		if tc.violations == nil {
+			c.Assert(err, check.IsNil, check.Commentf("%s", tc.sinkURI))
+			continue
+		}
+		c.Assert(cerror.ErrSinkIncompatibleConfig.Equal(err), check.IsTrue, check.Commentf("%s", tc.sinkURI))
+		for _, violation := range tc.violations {
+			c.Assert(err.Error(), check.Matches, ".*"+violation+".*")
+		}
+	}
+}
+
+func (s *compatibilitySuite) TestGetRequirements(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	sinkURI, err := url.Parse("kafka://127.0.0.1:9092/topic")
+	c.Assert(err, check.IsNil)
+	name, req, ok := GetRequirements(sinkURI, cfg)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(name, check.Equals, "kafka with protocol default")
+	c.Assert(req, check.Equals, Requirements{SupportDDL: true})
+
+	sinkURI, err = url.Parse("TiDB://127.0.0.1:4000/")
+	c.Assert(err, check.IsNil)
+	name, req, ok = GetRequirements(sinkURI, cfg)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(name, check.Equals, "tidb")
+	c.Assert(req, check.Equals, Requirements{SupportDDL: true, SupportCyclic: true, SupportTargets: true, SupportCompact: true})
+
+	err = ValidateConfig("://invalid", cfg)
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrSinkURIInvalid.*")
+}
+
+func (s *compatibilitySuite) TestValidateCompleteness(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.RequireCompleteness = true
+	c.Assert(ValidateConfig("mysql://127.0.0.1:3306/", cfg), check.IsNil)
+
+	// the malformed rows can't be skipped, it's checked again by the server
+	cfg.Mounter = &config.MounterConfig{SkipMalformedRow: true}
+	err := ValidateConfig("mysql://127.0.0.1:3306/", cfg)
+	c.Assert(cerror.ErrInvalidMounterConfig.Equal(err), check.IsTrue, check.Commentf("%v", err))
+}
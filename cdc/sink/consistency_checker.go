@@ -0,0 +1,436 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/types/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// consistencyCheckCandidateFactor is the ratio of the number of recently
+// replicated rows kept as the candidates of the check to the sample size
+const consistencyCheckCandidateFactor = 16
+
+// UpstreamRowReader reads rows from the snapshots of the upstream
+type UpstreamRowReader interface {
+	// ReadRow reads the row with the int handle from the physical table in
+	// the snapshot of ts, exist is false if the row is not found.
+	ReadRow(ctx context.Context, tableID model.TableID, handle int64, ts uint64) (cols []*model.Column, exist bool, err error)
+}
+
+// SetUpstreamRowReader sets the reader used by the consistency checker of the
+// sink, it's no-op if the consistency check is not enabled for the sink.
+func SetUpstreamRowReader(s Sink, reader UpstreamRowReader) {
+	if s, ok := Unwrap(s).(*mysqlSink); ok {
+		s.checker.setReader(reader)
+	}
+}
+
+type checkSampleKey struct {
+	tableID model.TableID
+	handle  int64
+}
+
+type checkSample struct {
+	table  *model.TableName
+	handle int64
+	// pkName is the name of the int primary key column, which is the handle
+	pkName string
+}
+
+// consistencyChecker samples the recently replicated rows of a MySQL sink,
+// and compares them between upstream and downstream periodically.
+// Only the rows of tables with an int primary key as the handle are sampled.
+// All methods are no-op on a nil checker.
+type consistencyChecker struct {
+	changefeedID string
+	cfg          *config.ConsistencyCheckConfig
+	db           *sql.DB
+	limiter      *rate.Limiter
+	errCh        chan error
+
+	mu         sync.Mutex
+	reader     UpstreamRowReader
+	reporter   ValidationReporter
+	candidates []*checkSample
+	next       int
+	checking   bool
+	lastCheck  time.Time
+	// sampling is the keys of the rows being checked, they are marked as
+	// dirty if they are written to downstream again during the check.
+	sampling map[checkSampleKey]bool
+
+	metricCheckedRows    prometheus.Counter
+	metricMismatchedRows prometheus.Counter
+}
+
+func newConsistencyChecker(
+	db *sql.DB, cfg *config.ConsistencyCheckConfig, params *sinkParams, errCh chan error,
+) *consistencyChecker {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+	defaultCfg := config.GetDefaultReplicaConfig().ConsistencyCheck
+	checkCfg := *cfg
+	if checkCfg.Interval <= 0 {
+		checkCfg.Interval = defaultCfg.Interval
+	}
+	if checkCfg.SampleSize <= 0 {
+		checkCfg.SampleSize = defaultCfg.SampleSize
+	}
+	if checkCfg.MaxQPS <= 0 {
+		checkCfg.MaxQPS = defaultCfg.MaxQPS
+	}
+	log.Info("consistency check is enabled",
+		zap.String("changefeed", params.changefeedID), zap.Reflect("config", checkCfg))
+	return &consistencyChecker{
+		changefeedID:         params.changefeedID,
+		cfg:                  &checkCfg,
+		db:                   db,
+		limiter:              rate.NewLimiter(rate.Limit(checkCfg.MaxQPS), 1),
+		errCh:                errCh,
+		candidates:           make([]*checkSample, 0, checkCfg.SampleSize*consistencyCheckCandidateFactor),
+		metricCheckedRows:    consistencyCheckRowsCounter.WithLabelValues(params.captureAddr, params.changefeedID),
+		metricMismatchedRows: consistencyMismatchRowsCounter.WithLabelValues(params.captureAddr, params.changefeedID),
+	}
+}
+
+func (c *consistencyChecker) setReader(reader UpstreamRowReader) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reader = reader
+}
+
+func (c *consistencyChecker) setReporter(reporter ValidationReporter) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reporter = reporter
+}
+
+// record records the rows which are going to be written to downstream, it
+// must be called before the rows are executed.
+func (c *consistencyChecker) record(txnsGroup map[model.TableID][]*model.SingleTableTxn) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, txns := range txnsGroup {
+		for _, txn := range txns {
+			for _, row := range txn.Rows {
+				sample := newCheckSample(row)
+				if sample == nil {
+					continue
+				}
+				key := checkSampleKey{tableID: sample.table.TableID, handle: sample.handle}
+				if _, ok := c.sampling[key]; ok {
+					c.sampling[key] = true
+				}
+				if len(c.candidates) < cap(c.candidates) {
+					c.candidates = append(c.candidates, sample)
+				} else {
+					c.candidates[c.next] = sample
+					c.next = (c.next + 1) % len(c.candidates)
+				}
+			}
+		}
+	}
+}
+
+// newCheckSample returns nil if the row can't be sampled
+func newCheckSample(row *model.RowChangedEvent) *checkSample {
+	if row.Table == nil || row.RowID == 0 {
+		return nil
+	}
+	cols := row.Columns
+	if row.IsDelete() {
+		cols = row.PreColumns
+	}
+	var pk *model.Column
+	for _, col := range cols {
+		if col == nil || !col.Flag.IsHandleKey() {
+			continue
+		}
+		if pk != nil || !col.Flag.IsPrimaryKey() {
+			return nil
+		}
+		pk = col
+	}
+	if pk == nil {
+		return nil
+	}
+	// the int primary key is the handle only if its value equals to the row id
+	switch v := pk.Value.(type) {
+	case int64:
+		if v != row.RowID {
+			return nil
+		}
+	case uint64:
+		if int64(v) != row.RowID {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &checkSample{table: row.Table, handle: row.RowID, pkName: pk.Name}
+}
+
+// maybeCheck starts a check in background if the interval is elapsed since
+// the last check. All rows recorded are expected to have been written to
+// downstream, and downstream is consistent with the snapshot of resolvedTs.
+func (c *consistencyChecker) maybeCheck(ctx context.Context, resolvedTs uint64) {
+	if c == nil {
+		return
+	}
+	samples := c.startCheck(time.Now())
+	if len(samples) == 0 {
+		return
+	}
+	go func() {
+		err := c.check(ctx, resolvedTs, samples)
+		if err != nil && errors.Cause(err) != context.Canceled {
+			select {
+			case c.errCh <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// startCheck picks the samples of a check, it returns nil if the check
+// should not be started.
+func (c *consistencyChecker) startCheck(now time.Time) []*checkSample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reader == nil || c.checking || len(c.candidates) == 0 ||
+		now.Sub(c.lastCheck) < time.Duration(c.cfg.Interval)*time.Second {
+		return nil
+	}
+	n := c.cfg.SampleSize
+	if n > len(c.candidates) {
+		n = len(c.candidates)
+	}
+	samples := make([]*checkSample, 0, n)
+	c.sampling = make(map[checkSampleKey]bool, n)
+	for _, i := range rand.Perm(len(c.candidates)) {
+		if len(samples) >= n {
+			break
+		}
+		sample := c.candidates[i]
+		key := checkSampleKey{tableID: sample.table.TableID, handle: sample.handle}
+		if _, ok := c.sampling[key]; ok {
+			continue
+		}
+		c.sampling[key] = false
+		samples = append(samples, sample)
+	}
+	c.checking = true
+	c.lastCheck = now
+	return samples
+}
+
+// check compares the samples between the upstream snapshot of ts and
+// downstream, an error is returned only if there are mismatched rows and
+// fail-on-mismatch is enabled.
+func (c *consistencyChecker) check(ctx context.Context, ts uint64, samples []*checkSample) error {
+	c.mu.Lock()
+	reader, reporter := c.reader, c.reporter
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.checking = false
+		c.sampling = nil
+		c.mu.Unlock()
+	}()
+
+	mismatched := 0
+	mismatchedTables := make(map[model.TableID]int)
+	for _, sample := range samples {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return errors.Trace(err)
+		}
+		key := checkSampleKey{tableID: sample.table.TableID, handle: sample.handle}
+		upstream, exist, err := reader.ReadRow(ctx, sample.table.TableID, sample.handle, ts)
+		if err != nil {
+			log.Warn("failed to read the sampled row from upstream",
+				zap.String("changefeed", c.changefeedID), zap.Stringer("table", sample.table),
+				zap.Int64("handle", sample.handle), zap.Error(err))
+			continue
+		}
+		downstream, err := c.readDownstream(ctx, sample, upstream, exist)
+		if err != nil {
+			log.Warn("failed to read the sampled row from downstream",
+				zap.String("changefeed", c.changefeedID), zap.Stringer("table", sample.table),
+				zap.Int64("handle", sample.handle), zap.Error(err))
+			continue
+		}
+		c.metricCheckedRows.Inc()
+		if rowEqual(upstream, exist, downstream) {
+			continue
+		}
+		// the row is written to downstream again after ts, skip it
+		c.mu.Lock()
+		dirty := c.sampling[key]
+		c.mu.Unlock()
+		if dirty {
+			continue
+		}
+		mismatched++
+		mismatchedTables[sample.table.TableID]++
+		c.metricMismatchedRows.Inc()
+		log.Error("found mismatched row between upstream and downstream",
+			zap.String("changefeed", c.changefeedID),
+			zap.Stringer("table", sample.table),
+			zap.Int64("handle", sample.handle),
+			zap.Uint64("ts", ts),
+			zap.Bool("upstreamExist", exist),
+			zap.Bool("downstreamExist", downstream != nil),
+			zap.Reflect("upstream", upstream),
+			zap.Reflect("downstream", downstream))
+	}
+	log.Info("consistency check finished",
+		zap.String("changefeed", c.changefeedID), zap.Uint64("ts", ts),
+		zap.Int("samples", len(samples)), zap.Int("mismatched", mismatched))
+	if reporter != nil {
+		for tableID, rows := range mismatchedTables {
+			reporter.ReportValidationFailure(model.BreakerDetectorConsistencyMismatch, tableID,
+				fmt.Sprintf("%d sampled rows are mismatched between upstream and downstream at ts %d", rows, ts))
+		}
+	}
+	if mismatched > 0 && c.cfg.FailOnMismatch {
+		return cerror.ErrConsistencyCheckMismatch.GenWithStackByArgs(mismatched, len(samples), ts)
+	}
+	return nil
+}
+
+// readDownstream reads the columns of the upstream row from downstream, nil
+// is returned if the row is not found.
+func (c *consistencyChecker) readDownstream(
+	ctx context.Context, sample *checkSample, upstream []*model.Column, exist bool,
+) ([]sql.NullString, error) {
+	fields := make([]string, 0, len(upstream))
+	for _, col := range upstream {
+		if col == nil {
+			continue
+		}
+		field := quotes.QuoteName(col.Name)
+		switch col.Type {
+		case mysql.TypeEnum, mysql.TypeSet, mysql.TypeBit:
+			// the values of these types are replicated as integers
+			field += "+0"
+		}
+		fields = append(fields, field)
+	}
+	if !exist {
+		fields = append(fields, quotes.QuoteName(sample.pkName))
+	}
+	query := "SELECT " + strings.Join(fields, ",") +
+		" FROM " + quotes.QuoteSchema(sample.table.Schema, sample.table.Table) +
+		" WHERE " + quotes.QuoteName(sample.pkName) + " = ? LIMIT 1"
+	values := make([]sql.NullString, len(fields))
+	dest := make([]interface{}, len(fields))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := c.db.QueryRowContext(ctx, query, sample.handle).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrMySQLQueryError, err)
+	}
+	return values, nil
+}
+
+func rowEqual(upstream []*model.Column, exist bool, downstream []sql.NullString) bool {
+	if !exist || downstream == nil {
+		return !exist && downstream == nil
+	}
+	i := 0
+	for _, col := range upstream {
+		if col == nil {
+			continue
+		}
+		if !columnValueEqual(col, downstream[i]) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// columnValueEqual compares the upstream column value with the value read
+// from downstream in text format
+func columnValueEqual(col *model.Column, value sql.NullString) bool {
+	if col.Value == nil || !value.Valid {
+		return col.Value == nil && !value.Valid
+	}
+	switch col.Type {
+	case mysql.TypeFloat, mysql.TypeDouble:
+		up, ok := col.Value.(float64)
+		if !ok {
+			break
+		}
+		down, err := strconv.ParseFloat(value.String, 64)
+		if err != nil {
+			return false
+		}
+		// the text format of float values may lose precision
+		return math.Abs(up-down) <= 1e-6*math.Max(math.Abs(up), math.Abs(down))
+	case mysql.TypeNewDecimal:
+		up, down := new(types.MyDecimal), new(types.MyDecimal)
+		if up.FromString([]byte(model.ColumnValueString(col.Value))) != nil ||
+			down.FromString([]byte(value.String)) != nil {
+			break
+		}
+		return up.Compare(down) == 0
+	case mysql.TypeJSON:
+		up, err := json.ParseBinaryFromString(model.ColumnValueString(col.Value))
+		if err != nil {
+			break
+		}
+		down, err := json.ParseBinaryFromString(value.String)
+		if err != nil {
+			return false
+		}
+		return json.CompareBinary(up, down) == 0
+	}
+	return model.ColumnValueString(col.Value) == value.String
+}
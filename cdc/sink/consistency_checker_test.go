@@ -0,0 +1,217 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type consistencyCheckerSuite struct{}
+
+var _ = check.Suite(&consistencyCheckerSuite{})
+
+type mockUpstreamRowReader map[int64][]*model.Column
+
+func (r mockUpstreamRowReader) ReadRow(
+	ctx context.Context, tableID model.TableID, handle int64, ts uint64,
+) ([]*model.Column, bool, error) {
+	cols, ok := r[handle]
+	return cols, ok, nil
+}
+
+func newCheckTestRow(id int64, a string) *model.RowChangedEvent {
+	return &model.RowChangedEvent{
+		CommitTs: 10,
+		RowID:    id,
+		Table:    &model.TableName{Schema: "test", Table: "t", TableID: 1},
+		Columns:  newCheckTestColumns(id, a),
+	}
+}
+
+func newCheckTestColumns(id int64, a string) []*model.Column {
+	return []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: id},
+		{Name: "a", Type: mysql.TypeVarchar, Value: []byte(a)},
+	}
+}
+
+func newCheckTestTxns(rows ...*model.RowChangedEvent) map[model.TableID][]*model.SingleTableTxn {
+	return map[model.TableID][]*model.SingleTableTxn{
+		1: {{Table: rows[0].Table, CommitTs: 10, Rows: rows}},
+	}
+}
+
+func newTestConsistencyChecker(c *check.C, failOnMismatch bool) (*consistencyChecker, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mock.MatchExpectationsInOrder(false)
+	checker := newConsistencyChecker(db, &config.ConsistencyCheckConfig{
+		Enable:         true,
+		Interval:       60,
+		SampleSize:     3,
+		MaxQPS:         1000,
+		FailOnMismatch: failOnMismatch,
+	}, &sinkParams{changefeedID: "test-cf", captureAddr: "127.0.0.1:8300"}, make(chan error, 1))
+	c.Assert(checker, check.NotNil)
+	return checker, mock
+}
+
+func (s consistencyCheckerSuite) TestNewCheckSample(c *check.C) {
+	defer testleak.AfterTest(c)()
+	sample := newCheckSample(newCheckTestRow(1, "a"))
+	c.Assert(sample, check.DeepEquals, &checkSample{
+		table:  &model.TableName{Schema: "test", Table: "t", TableID: 1},
+		handle: 1,
+		pkName: "id",
+	})
+
+	// the handle of a delete event is in the pre columns
+	row := newCheckTestRow(2, "b")
+	row.PreColumns, row.Columns = row.Columns, nil
+	sample = newCheckSample(row)
+	c.Assert(sample, check.NotNil)
+	c.Assert(sample.handle, check.Equals, int64(2))
+
+	// the implicit row id is not the primary key
+	row = newCheckTestRow(3, "c")
+	row.RowID = 100
+	c.Assert(newCheckSample(row), check.IsNil)
+
+	// the handle key is not the primary key
+	row = newCheckTestRow(4, "d")
+	row.Columns[0].Flag = model.HandleKeyFlag | model.UniqueKeyFlag
+	c.Assert(newCheckSample(row), check.IsNil)
+
+	// the common handle
+	row = newCheckTestRow(5, "e")
+	row.RowID = 0
+	c.Assert(newCheckSample(row), check.IsNil)
+}
+
+func (s consistencyCheckerSuite) TestCheckMismatch(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	checker, mock := newTestConsistencyChecker(c, true)
+	// the check is not started without upstream reader
+	checker.record(newCheckTestTxns(newCheckTestRow(1, "a"), newCheckTestRow(2, "b"), newCheckTestRow(3, "c")))
+	c.Assert(checker.startCheck(time.Now()), check.HasLen, 0)
+
+	checker.setReader(mockUpstreamRowReader{
+		1: newCheckTestColumns(1, "a"),
+		2: newCheckTestColumns(2, "b"),
+		3: newCheckTestColumns(3, "c"),
+	})
+	now := time.Now()
+	samples := checker.startCheck(now)
+	c.Assert(samples, check.HasLen, 3)
+	// only one check is running at the same time
+	c.Assert(checker.startCheck(now.Add(time.Hour)), check.HasLen, 0)
+
+	query := regexp.QuoteMeta("SELECT `id`,`a` FROM `test`.`t` WHERE `id` = ? LIMIT 1")
+	mock.ExpectQuery(query).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "a"}).AddRow(1, "a"))
+	// the row is corrupted in downstream
+	mock.ExpectQuery(query).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "a"}).AddRow(2, "corrupted"))
+	// the row is lost in downstream
+	mock.ExpectQuery(query).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "a"}))
+	err := checker.check(ctx, 10, samples)
+	c.Assert(cerror.ErrConsistencyCheckMismatch.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, ".*2 of 3 sampled rows are mismatched.*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the next check is started after the interval
+	c.Assert(checker.startCheck(now.Add(time.Second)), check.HasLen, 0)
+	c.Assert(checker.startCheck(now.Add(time.Minute)), check.HasLen, 3)
+}
+
+func (s consistencyCheckerSuite) TestCheckWithoutFail(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	checker, mock := newTestConsistencyChecker(c, false)
+	checker.setReader(mockUpstreamRowReader{1: newCheckTestColumns(1, "a")})
+	// the row 2 is deleted in upstream
+	checker.record(newCheckTestTxns(newCheckTestRow(1, "a"), newCheckTestRow(2, "b")))
+	samples := checker.startCheck(time.Now())
+	c.Assert(samples, check.HasLen, 2)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`a` FROM `test`.`t` WHERE `id` = ? LIMIT 1")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "a"}).AddRow(1, "corrupted"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `test`.`t` WHERE `id` = ? LIMIT 1")).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// the mismatch is only reported
+	err := checker.check(ctx, 10, samples)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s consistencyCheckerSuite) TestDirtyRowSkipped(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	checker, mock := newTestConsistencyChecker(c, true)
+	checker.setReader(mockUpstreamRowReader{1: newCheckTestColumns(1, "a")})
+	checker.record(newCheckTestTxns(newCheckTestRow(1, "a")))
+	samples := checker.startCheck(time.Now())
+	c.Assert(samples, check.HasLen, 1)
+
+	// the row is written again after the snapshot of the check
+	checker.record(newCheckTestTxns(newCheckTestRow(1, "b")))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`a` FROM `test`.`t` WHERE `id` = ? LIMIT 1")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "a"}).AddRow(1, "b"))
+	err := checker.check(ctx, 10, samples)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s consistencyCheckerSuite) TestColumnValueEqual(c *check.C) {
+	defer testleak.AfterTest(c)()
+	valid := func(s string) sql.NullString {
+		return sql.NullString{String: s, Valid: true}
+	}
+	testCases := []struct {
+		col   *model.Column
+		value sql.NullString
+		equal bool
+	}{
+		{&model.Column{Type: mysql.TypeLong, Value: nil}, sql.NullString{}, true},
+		{&model.Column{Type: mysql.TypeLong, Value: int64(1)}, sql.NullString{}, false},
+		{&model.Column{Type: mysql.TypeLong, Value: nil}, valid(""), false},
+		{&model.Column{Type: mysql.TypeLong, Value: int64(-1)}, valid("-1"), true},
+		{&model.Column{Type: mysql.TypeLonglong, Value: uint64(18446744073709551615)}, valid("18446744073709551615"), true},
+		{&model.Column{Type: mysql.TypeFloat, Value: float64(float32(3.14))}, valid("3.14"), true},
+		{&model.Column{Type: mysql.TypeDouble, Value: float64(3.14)}, valid("3.15"), false},
+		{&model.Column{Type: mysql.TypeNewDecimal, Value: "1.5"}, valid("1.50"), true},
+		{&model.Column{Type: mysql.TypeNewDecimal, Value: "1.5"}, valid("1.51"), false},
+		{&model.Column{Type: mysql.TypeJSON, Value: `{"a": 1, "b": [1, 2]}`}, valid(`{"b":[1,2],"a":1}`), true},
+		{&model.Column{Type: mysql.TypeJSON, Value: `{"a": 1}`}, valid(`{"a":2}`), false},
+		{&model.Column{Type: mysql.TypeEnum, Value: uint64(2)}, valid("2"), true},
+		{&model.Column{Type: mysql.TypeDatetime, Value: "2020-01-01 00:00:00"}, valid("2020-01-01 00:00:00"), true},
+		{&model.Column{Type: mysql.TypeBlob, Value: []byte("abc")}, valid("abd"), false},
+	}
+	for _, tc := range testCases {
+		c.Assert(columnValueEqual(tc.col, tc.value), check.Equals, tc.equal, check.Commentf("%#v", tc))
+	}
+}
@@ -33,6 +33,17 @@ func newDefaultDispatcher(partitionNum int32, enableOldValue bool) *defaultDispa
 	}
 }
 
+// scalable returns true if the old value is enabled, then the rows are always
+// dispatched by the tables.
+func (d *defaultDispatcher) scalable() bool {
+	return d.enableOldValue
+}
+
+func (d *defaultDispatcher) setPartitionNum(partitionNum int32) {
+	d.partitionNum = partitionNum
+	d.tbd.setPartitionNum(partitionNum)
+}
+
 func (d *defaultDispatcher) Dispatch(row *model.RowChangedEvent) int32 {
 	if d.enableOldValue {
 		return d.tbd.Dispatch(row)
@@ -14,7 +14,9 @@
 package dispatcher
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc/model"
@@ -30,6 +32,41 @@ type Dispatcher interface {
 	Dispatch(row *model.RowChangedEvent) int32
 }
 
+// RuleMatcher evaluates the dispatch rules for the tables, the rule matched by
+// a table is kept until the table is removed.
+type RuleMatcher interface {
+	// AddTable evaluates the dispatch rules for the table, and returns the
+	// description of the matched rule
+	AddTable(table model.TableName) string
+	// RemoveTable forgets the matched rule of the table
+	RemoveTable(table model.TableName)
+	// TableRules returns the descriptions of the matched rules of the tables,
+	// which are keyed by the quoted table names
+	TableRules() map[string]string
+}
+
+// PartitionScaler changes the partition number the rows are dispatched by,
+// when the partitions are added to the topic at runtime. It must not be called
+// concurrently with Dispatch.
+type PartitionScaler interface {
+	// KeyHashRules returns the descriptions of the rules whose dispatchers map
+	// the keys of the rows to the partitions by hash, the mapping of them is
+	// changed by a new partition number.
+	KeyHashRules() []string
+	// ScalePartitions dispatches the rows by the new partition number, the
+	// dispatchers of the key hash rules keep the old one.
+	ScalePartitions(partitionNum int32)
+}
+
+// partitionScaler is implemented by the dispatchers which may dispatch the rows
+// by a new partition number at a resolved ts boundary
+type partitionScaler interface {
+	// scalable returns false if the dispatcher maps the keys of the rows to
+	// the partitions by hash
+	scalable() bool
+	setPartitionNum(partitionNum int32)
+}
+
 type dispatchRule int
 
 const (
@@ -58,11 +95,39 @@ func (r *dispatchRule) fromString(rule string) {
 	}
 }
 
+func (r dispatchRule) String() string {
+	switch r {
+	case dispatchRuleRowID:
+		return "rowid"
+	case dispatchRuleTS:
+		return "ts"
+	case dispatchRuleTable:
+		return "table"
+	case dispatchRuleIndexValue:
+		return "index-value"
+	default:
+		return "default"
+	}
+}
+
 type dispatcherSwitcher struct {
 	rules []struct {
 		Dispatcher
 		filter.Filter
+		desc string
 	}
+	caseSensitive bool
+
+	mu sync.RWMutex
+	// tables caches the rule matched by each table
+	tables map[model.TableName]tableRule
+}
+
+// tableRule is the rule matched by a table
+type tableRule struct {
+	// name is the name of the table as it's added
+	name  model.TableName
+	index int
 }
 
 func (s *dispatcherSwitcher) Dispatch(row *model.RowChangedEvent) int32 {
@@ -70,25 +135,100 @@ func (s *dispatcherSwitcher) Dispatch(row *model.RowChangedEvent) int32 {
 }
 
 func (s *dispatcherSwitcher) matchDispatcher(row *model.RowChangedEvent) Dispatcher {
-	for _, rule := range s.rules {
-		if !rule.MatchTable(row.Table.Schema, row.Table.Table) {
+	key := s.tableKey(*row.Table)
+	s.mu.RLock()
+	r, ok := s.tables[key]
+	s.mu.RUnlock()
+	if !ok {
+		name := model.TableName{Schema: row.Table.Schema, Table: row.Table.Table}
+		r = tableRule{name: name, index: s.matchRule(key)}
+		s.mu.Lock()
+		s.tables[key] = r
+		s.mu.Unlock()
+	}
+	return s.rules[r.index].Dispatcher
+}
+
+// tableKey returns the key of the table in the cache, the names are compared
+// in the same way as the filter of the changefeed.
+func (s *dispatcherSwitcher) tableKey(table model.TableName) model.TableName {
+	key := model.TableName{Schema: table.Schema, Table: table.Table}
+	if !s.caseSensitive {
+		key.Schema = strings.ToLower(key.Schema)
+		key.Table = strings.ToLower(key.Table)
+	}
+	return key
+}
+
+func (s *dispatcherSwitcher) matchRule(table model.TableName) int {
+	for i, rule := range s.rules {
+		if !rule.MatchTable(table.Schema, table.Table) {
 			continue
 		}
-		return rule.Dispatcher
+		return i
 	}
 	log.Panic("the dispatch rule must cover all tables")
-	return nil
+	return 0
+}
+
+func (s *dispatcherSwitcher) AddTable(table model.TableName) string {
+	key := s.tableKey(table)
+	i := s.matchRule(key)
+	s.mu.Lock()
+	s.tables[key] = tableRule{name: model.TableName{Schema: table.Schema, Table: table.Table}, index: i}
+	s.mu.Unlock()
+	return s.rules[i].desc
+}
+
+func (s *dispatcherSwitcher) RemoveTable(table model.TableName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tables, s.tableKey(table))
+}
+
+func (s *dispatcherSwitcher) TableRules() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make(map[string]string, len(s.tables))
+	for _, r := range s.tables {
+		rules[r.name.QuoteString()] = s.rules[r.index].desc
+	}
+	return rules
+}
+
+// KeyHashRules implements the PartitionScaler interface
+func (s *dispatcherSwitcher) KeyHashRules() []string {
+	var rules []string
+	for _, rule := range s.rules {
+		if scaler, ok := rule.Dispatcher.(partitionScaler); !ok || !scaler.scalable() {
+			rules = append(rules, rule.desc)
+		}
+	}
+	return rules
+}
+
+// ScalePartitions implements the PartitionScaler interface
+func (s *dispatcherSwitcher) ScalePartitions(partitionNum int32) {
+	for _, rule := range s.rules {
+		if scaler, ok := rule.Dispatcher.(partitionScaler); ok && scaler.scalable() {
+			scaler.setPartitionNum(partitionNum)
+		}
+	}
 }
 
 // NewDispatcher creates a new dispatcher
 func NewDispatcher(cfg *config.ReplicaConfig, partitionNum int32) (Dispatcher, error) {
-	ruleConfigs := append(cfg.Sink.DispatchRules, &config.DispatchRule{
+	// copy the rules to not append the default rule to the config
+	ruleConfigs := make([]*config.DispatchRule, 0, len(cfg.Sink.DispatchRules)+1)
+	ruleConfigs = append(ruleConfigs, cfg.Sink.DispatchRules...)
+	ruleConfigs = append(ruleConfigs, &config.DispatchRule{
 		Matcher:    []string{"*.*"},
 		Dispatcher: "default",
 	})
 	rules := make([]struct {
 		Dispatcher
 		filter.Filter
+		desc string
 	}, 0, len(ruleConfigs))
 
 	for _, ruleConfig := range ruleConfigs {
@@ -120,9 +260,12 @@ func NewDispatcher(cfg *config.ReplicaConfig, partitionNum int32) (Dispatcher, e
 		rules = append(rules, struct {
 			Dispatcher
 			filter.Filter
-		}{Dispatcher: d, Filter: f})
+			desc string
+		}{Dispatcher: d, Filter: f, desc: fmt.Sprintf("[%s] %s", strings.Join(ruleConfig.Matcher, ","), rule)})
 	}
 	return &dispatcherSwitcher{
-		rules: rules,
+		rules:         rules,
+		caseSensitive: cfg.CaseSensitive,
+		tables:        make(map[model.TableName]tableRule),
 	}, nil
 }
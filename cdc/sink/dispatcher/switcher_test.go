@@ -77,3 +77,86 @@ func (s SwitcherSuite) TestSwitcher(c *check.C) {
 		},
 	}), check.FitsTypeOf, &indexValueDispatcher{})
 }
+
+func (s SwitcherSuite) TestSwitcherAddTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.CaseSensitive = false
+	cfg.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.t*", "!test.t2"}, Dispatcher: "TABLE"},
+	}
+	d, err := NewDispatcher(cfg, 4)
+	c.Assert(err, check.IsNil)
+	// the default rule is not appended to the config
+	c.Assert(cfg.Sink.DispatchRules, check.HasLen, 1)
+	m := d.(RuleMatcher)
+	c.Assert(m.AddTable(model.TableName{Schema: "test", Table: "t1"}), check.Equals, "[test.t*,!test.t2] table")
+	c.Assert(m.AddTable(model.TableName{Schema: "test", Table: "t2"}), check.Equals, "[*.*] default")
+	// the names are matched case-insensitively like the filter
+	c.Assert(m.AddTable(model.TableName{Schema: "Test", Table: "T3"}), check.Equals, "[test.t*,!test.t2] table")
+	c.Assert(d.(*dispatcherSwitcher).matchDispatcher(&model.RowChangedEvent{
+		Table: &model.TableName{Schema: "TEST", Table: "t3"},
+	}), check.FitsTypeOf, &tableDispatcher{})
+	c.Assert(m.TableRules(), check.DeepEquals, map[string]string{
+		"`test`.`t1`": "[test.t*,!test.t2] table",
+		"`test`.`t2`": "[*.*] default",
+		"`Test`.`T3`": "[test.t*,!test.t2] table",
+	})
+	m.RemoveTable(model.TableName{Schema: "test", Table: "T1"})
+	c.Assert(m.TableRules(), check.HasLen, 2)
+
+	cfg.CaseSensitive = true
+	d, err = NewDispatcher(cfg, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.(RuleMatcher).AddTable(model.TableName{Schema: "Test", Table: "T3"}), check.Equals, "[*.*] default")
+}
+
+func (s SwitcherSuite) TestSwitcherScalePartitions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.EnableOldValue = false
+	cfg.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.table_*"}, Dispatcher: "table"},
+		{Matcher: []string{"test.ts_*"}, Dispatcher: "ts"},
+		{Matcher: []string{"test.*"}, Dispatcher: "index-value"},
+	}
+	d, err := NewDispatcher(cfg, 4)
+	c.Assert(err, check.IsNil)
+	scaler := d.(PartitionScaler)
+	c.Assert(scaler.KeyHashRules(), check.DeepEquals, []string{"[test.*] index-value", "[*.*] default"})
+
+	rows := map[string]*model.RowChangedEvent{}
+	partitions := map[string]int32{}
+	for _, table := range []string{"table_1", "ts_1", "t1", "t2"} {
+		rows[table] = &model.RowChangedEvent{
+			Table:    &model.TableName{Schema: "test", Table: table},
+			CommitTs: 7,
+			Columns:  []*model.Column{{Name: "id", Value: 1, Flag: model.HandleKeyFlag}},
+		}
+		partitions[table] = d.Dispatch(rows[table])
+	}
+	rows["other"] = &model.RowChangedEvent{
+		Table:        &model.TableName{Schema: "other", Table: "t1"},
+		CommitTs:     7,
+		Columns:      []*model.Column{{Name: "id", Value: 1, Flag: model.HandleKeyFlag}},
+		IndexColumns: [][]int{{0}},
+	}
+	partitions["other"] = d.Dispatch(rows["other"])
+
+	// the table and ts dispatchers use the new partitions, and the key hash
+	// dispatchers keep the old mapping
+	scaler.ScalePartitions(16)
+	c.Assert(d.Dispatch(rows["table_1"]), check.Equals, newTableDispatcher(16).Dispatch(rows["table_1"]))
+	c.Assert(d.Dispatch(rows["ts_1"]), check.Equals, int32(7))
+	for _, table := range []string{"t1", "t2", "other"} {
+		c.Assert(d.Dispatch(rows[table]), check.Equals, partitions[table])
+	}
+
+	// the default dispatcher dispatches the rows by the tables if the old
+	// value is enabled, so it's not a key hash rule
+	d, err = NewDispatcher(config.GetDefaultReplicaConfig(), 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.(PartitionScaler).KeyHashRules(), check.HasLen, 0)
+	d.(PartitionScaler).ScalePartitions(16)
+	c.Assert(d.Dispatch(rows["other"]), check.Equals, newTableDispatcher(16).Dispatch(rows["other"]))
+}
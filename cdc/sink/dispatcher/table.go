@@ -30,6 +30,14 @@ func newTableDispatcher(partitionNum int32) *tableDispatcher {
 	}
 }
 
+func (t *tableDispatcher) scalable() bool {
+	return true
+}
+
+func (t *tableDispatcher) setPartitionNum(partitionNum int32) {
+	t.partitionNum = partitionNum
+}
+
 func (t *tableDispatcher) Dispatch(row *model.RowChangedEvent) int32 {
 	t.hasher.Reset()
 	// distribute partition by table
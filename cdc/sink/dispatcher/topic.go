@@ -0,0 +1,110 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+)
+
+// TopicDispatcher is an abstraction for dispatching tables into different topics
+type TopicDispatcher interface {
+	// DispatchTopic returns the topic which the events of the table should be sent to
+	DispatchTopic(schema, table string) string
+	// Topics returns all static topics which may be returned by DispatchTopic,
+	// the topics evaluated from the topic expressions are not included
+	Topics() []string
+}
+
+type topicSwitcher struct {
+	defaultTopic topicExpression
+	topics       []string
+	rules        []struct {
+		topic topicExpression
+		filter.Filter
+	}
+}
+
+func (s *topicSwitcher) DispatchTopic(schema, table string) string {
+	for _, rule := range s.rules {
+		if !rule.MatchTable(schema, table) {
+			continue
+		}
+		// the first matched rule decides both the partition dispatcher and the
+		// topic, a rule without topic sends the table to the default topic.
+		if rule.topic == "" {
+			break
+		}
+		return rule.topic.Substitute(schema, table)
+	}
+	return s.defaultTopic.Substitute(schema, table)
+}
+
+func (s *topicSwitcher) Topics() []string {
+	return s.topics
+}
+
+// NewTopicDispatcher creates a new topic dispatcher, the tables which are not
+// matched by any dispatch rule are sent to the default topic. Both the default
+// topic and the topics of the rules can be topic expressions.
+func NewTopicDispatcher(cfg *config.ReplicaConfig, defaultTopic string) (TopicDispatcher, error) {
+	defaultExpr, err := newTopicExpression(defaultTopic)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &topicSwitcher{defaultTopic: defaultExpr}
+	seen := make(map[string]struct{})
+	addTopic := func(topic string) {
+		if _, ok := seen[topic]; IsTopicExpression(topic) || ok {
+			return
+		}
+		seen[topic] = struct{}{}
+		s.topics = append(s.topics, topic)
+	}
+	addTopic(defaultTopic)
+	for _, ruleConfig := range cfg.Sink.DispatchRules {
+		f, err := filter.Parse(ruleConfig.Matcher)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if !cfg.CaseSensitive {
+			f = filter.CaseInsensitive(f)
+		}
+		expr, err := newTopicExpression(ruleConfig.Topic)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.rules = append(s.rules, struct {
+			topic topicExpression
+			filter.Filter
+		}{topic: expr, Filter: f})
+		if ruleConfig.Topic != "" {
+			addTopic(ruleConfig.Topic)
+		}
+	}
+	return s, nil
+}
+
+// HasTopicRules returns whether some dispatch rules route tables to a topic
+// other than the default one.
+func HasTopicRules(cfg *config.ReplicaConfig) bool {
+	for _, rule := range cfg.Sink.DispatchRules {
+		if rule.Topic != "" {
+			return true
+		}
+	}
+	return false
+}
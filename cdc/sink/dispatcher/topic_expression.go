@@ -0,0 +1,103 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+const (
+	schemaPlaceholder = "{schema}"
+	tablePlaceholder  = "{table}"
+	// maxTopicLength is the max length of a Kafka topic name
+	maxTopicLength = 249
+	// topicHashSuffixLength is the length of the `_<hash>` suffix appended to
+	// the sanitized topics
+	topicHashSuffixLength = 9
+)
+
+var (
+	// invalidTopicChar matches the characters which are not allowed in Kafka
+	// topic names
+	invalidTopicChar = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+	// placeholderRe matches the placeholders in a topic expression, a schema
+	// or table name never contains `{` or `}` after being sanitized
+	placeholderRe = regexp.MustCompile(`\{[^{}]*\}`)
+)
+
+// IsTopicExpression returns true if the topic contains any placeholder, the
+// topic is then evaluated for each table.
+func IsTopicExpression(topic string) bool {
+	return strings.Contains(topic, schemaPlaceholder) || strings.Contains(topic, tablePlaceholder)
+}
+
+// topicExpression is a topic which contains the `{schema}` and `{table}`
+// placeholders, e.g. `cdc_{schema}` or `{schema}_{table}`.
+type topicExpression string
+
+// newTopicExpression checks the expression, the placeholders other than
+// `{schema}` and `{table}` and the characters invalid in Kafka topic names
+// are not allowed. A topic without any brace is a static topic and is not
+// checked.
+func newTopicExpression(expr string) (topicExpression, error) {
+	if !strings.ContainsAny(expr, "{}") {
+		return topicExpression(expr), nil
+	}
+	for _, placeholder := range placeholderRe.FindAllString(expr, -1) {
+		if placeholder != schemaPlaceholder && placeholder != tablePlaceholder {
+			return "", cerror.ErrTopicExpressionInvalid.GenWithStackByArgs(expr,
+				fmt.Sprintf("unknown placeholder %s", placeholder))
+		}
+	}
+	literal := placeholderRe.ReplaceAllString(expr, "")
+	if invalidTopicChar.MatchString(literal) {
+		return "", cerror.ErrTopicExpressionInvalid.GenWithStackByArgs(expr,
+			"only the characters [a-zA-Z0-9._-] are allowed besides the placeholders")
+	}
+	return topicExpression(expr), nil
+}
+
+// Substitute returns the topic of the table, the result is sanitized to be a
+// valid Kafka topic name. A topic without placeholders is returned as is.
+func (e topicExpression) Substitute(schema, table string) string {
+	if !IsTopicExpression(string(e)) {
+		return string(e)
+	}
+	topic := strings.ReplaceAll(string(e), schemaPlaceholder, schema)
+	topic = strings.ReplaceAll(topic, tablePlaceholder, table)
+	return SanitizeTopicName(topic)
+}
+
+// SanitizeTopicName returns a valid Kafka topic name for the topic. The
+// invalid characters are replaced with `_` and the topic is truncated to the
+// max length. If the topic is changed, a hash of the original topic is
+// appended, so different topics never collide after being sanitized.
+func SanitizeTopicName(topic string) string {
+	if !invalidTopicChar.MatchString(topic) && len(topic) <= maxTopicLength && topic != "." && topic != ".." {
+		return topic
+	}
+	h := fnv.New32a()
+	// Write of hash.Hash never returns an error
+	_, _ = h.Write([]byte(topic))
+	sanitized := invalidTopicChar.ReplaceAllString(topic, "_")
+	if len(sanitized) > maxTopicLength-topicHashSuffixLength {
+		sanitized = sanitized[:maxTopicLength-topicHashSuffixLength]
+	}
+	return fmt.Sprintf("%s_%08x", sanitized, h.Sum32())
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type TopicExpressionSuite struct{}
+
+var _ = check.Suite(&TopicExpressionSuite{})
+
+func (s TopicExpressionSuite) TestSubstitute(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(IsTopicExpression("cdc"), check.IsFalse)
+	c.Assert(IsTopicExpression("cdc_{schema}"), check.IsTrue)
+
+	expr, err := newTopicExpression("cdc_{schema}")
+	c.Assert(err, check.IsNil)
+	c.Assert(expr.Substitute("test", "t1"), check.Equals, "cdc_test")
+	expr, err = newTopicExpression("{schema}_{table}")
+	c.Assert(err, check.IsNil)
+	c.Assert(expr.Substitute("test", "t1"), check.Equals, "test_t1")
+	c.Assert(expr.Substitute("test", "t-1.x"), check.Equals, "test_t-1.x")
+	// a static topic is never changed
+	expr, err = newTopicExpression("persistent://public/default/cdc")
+	c.Assert(err, check.IsNil)
+	c.Assert(expr.Substitute("test", "t1"), check.Equals, "persistent://public/default/cdc")
+
+	for _, invalid := range []string{"cdc_{db}", "cdc_{schema", "cdc/{schema}", "{schema}:{table}"} {
+		_, err := newTopicExpression(invalid)
+		c.Assert(err, check.ErrorMatches, ".*CDC:ErrTopicExpressionInvalid.*", check.Commentf("%s", invalid))
+	}
+}
+
+func (s TopicExpressionSuite) TestSanitize(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(SanitizeTopicName("cdc_test"), check.Equals, "cdc_test")
+
+	// the invalid characters are replaced deterministically
+	sanitized := SanitizeTopicName("cdc_测试$")
+	c.Assert(sanitized, check.Matches, `cdc_____[0-9a-f]{8}`)
+	c.Assert(SanitizeTopicName("cdc_测试$"), check.Equals, sanitized)
+
+	// the topics collided after replacing are distinguished by the hash
+	t1 := SanitizeTopicName("a$b")
+	t2 := SanitizeTopicName("a%b")
+	c.Assert(strings.HasPrefix(t1, "a_b_"), check.IsTrue)
+	c.Assert(strings.HasPrefix(t2, "a_b_"), check.IsTrue)
+	c.Assert(t1, check.Not(check.Equals), t2)
+	c.Assert(t1, check.Not(check.Equals), SanitizeTopicName("a_b"))
+
+	// the long topics are truncated
+	long := SanitizeTopicName(strings.Repeat("a", 300))
+	c.Assert(long, check.HasLen, maxTopicLength)
+	c.Assert(long, check.Not(check.Equals), SanitizeTopicName(strings.Repeat("a", 301)))
+	c.Assert(SanitizeTopicName(".."), check.Matches, `\.\._[0-9a-f]{8}`)
+}
+
+func (s TopicExpressionSuite) TestTopicDispatcherExpression(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.t1"}, Dispatcher: "ts", Topic: "topic1"},
+		{Matcher: []string{"test.*"}, Dispatcher: "table", Topic: "test_{table}"},
+	}
+	d, err := NewTopicDispatcher(cfg, "cdc_{schema}")
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Topics(), check.DeepEquals, []string{"topic1"})
+	c.Assert(d.DispatchTopic("test", "t1"), check.Equals, "topic1")
+	c.Assert(d.DispatchTopic("test", "t2"), check.Equals, "test_t2")
+	c.Assert(d.DispatchTopic("other", "t1"), check.Equals, "cdc_other")
+	c.Assert(d.DispatchTopic("other db", "t1"), check.Matches, `cdc_other_db_[0-9a-f]{8}`)
+}
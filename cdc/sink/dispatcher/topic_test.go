@@ -0,0 +1,56 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type TopicSuite struct{}
+
+var _ = check.Suite(&TopicSuite{})
+
+func (s TopicSuite) TestTopicDispatcher(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	c.Assert(HasTopicRules(cfg), check.IsFalse)
+	d, err := NewTopicDispatcher(cfg, "default")
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Topics(), check.DeepEquals, []string{"default"})
+	c.Assert(d.DispatchTopic("test", "t1"), check.Equals, "default")
+
+	cfg.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.t1"}, Dispatcher: "ts", Topic: "topic1"},
+		{Matcher: []string{"test.t2"}, Dispatcher: "ts"},
+		{Matcher: []string{"test.*"}, Dispatcher: "table", Topic: "topic2"},
+		{Matcher: []string{"test2.*"}, Dispatcher: "table", Topic: "topic1"},
+	}
+	c.Assert(HasTopicRules(cfg), check.IsTrue)
+	d, err = NewTopicDispatcher(cfg, "default")
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Topics(), check.DeepEquals, []string{"default", "topic1", "topic2"})
+	c.Assert(d.DispatchTopic("test", "t1"), check.Equals, "topic1")
+	// the first matched rule has no topic
+	c.Assert(d.DispatchTopic("test", "t2"), check.Equals, "default")
+	c.Assert(d.DispatchTopic("test", "t3"), check.Equals, "topic2")
+	c.Assert(d.DispatchTopic("test2", "t1"), check.Equals, "topic1")
+	c.Assert(d.DispatchTopic("other", "t1"), check.Equals, "default")
+
+	cfg.CaseSensitive = false
+	d, err = NewTopicDispatcher(cfg, "default")
+	c.Assert(err, check.IsNil)
+	c.Assert(d.DispatchTopic("TEST", "T1"), check.Equals, "topic1")
+}
@@ -25,6 +25,14 @@ func newTsDispatcher(partitionNum int32) *tsDispatcher {
 	}
 }
 
+func (t *tsDispatcher) scalable() bool {
+	return true
+}
+
+func (t *tsDispatcher) setPartitionNum(partitionNum int32) {
+	t.partitionNum = partitionNum
+}
+
 func (t *tsDispatcher) Dispatch(row *model.RowChangedEvent) int32 {
 	return int32(row.CommitTs % uint64(t.partitionNum))
 }
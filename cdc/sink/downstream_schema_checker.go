@@ -0,0 +1,266 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+)
+
+// downstreamSchemaTTL is the duration the downstream schema of a table is
+// cached for, so the tables fixed manually in the downstream are fetched
+// again when they're retried.
+const downstreamSchemaTTL = 30 * time.Second
+
+const downstreamColumnsQuery = "SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE, COLUMN_DEFAULT, COLUMN_KEY, EXTRA " +
+	"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+
+type downstreamColumn struct {
+	name     string
+	dataType string
+	nullable bool
+	// hasDefault means the column has a default value, or it's filled by
+	// the downstream, e.g. an auto increment or generated column
+	hasDefault bool
+	primary    bool
+}
+
+type downstreamTable struct {
+	columns   []*downstreamColumn
+	fetchTime time.Time
+}
+
+// downstreamSchemaChecker checks whether the downstream tables are compatible
+// with the upstream tables before they're replicated. The schemas of the
+// downstream tables are cached, and invalidated by the DDLs executed by the
+// sink.
+type downstreamSchemaChecker struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	tables map[string]*downstreamTable
+}
+
+func newDownstreamSchemaChecker(db *sql.DB) *downstreamSchemaChecker {
+	return &downstreamSchemaChecker{
+		db:     db,
+		tables: make(map[string]*downstreamTable),
+	}
+}
+
+// fetch returns the schema of the downstream table, it's nil if the table
+// doesn't exist. The missing tables are not cached, as they may be created
+// in the downstream manually.
+func (c *downstreamSchemaChecker) fetch(ctx context.Context, schema, table string) (*downstreamTable, error) {
+	key := quotes.QuoteSchema(schema, table)
+	c.mu.Lock()
+	cached, ok := c.tables[key]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchTime) < downstreamSchemaTTL {
+		return cached, nil
+	}
+
+	rows, err := c.db.QueryContext(ctx, downstreamColumnsQuery, schema, table)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrMySQLQueryError, err)
+	}
+	defer rows.Close()
+	fetched := &downstreamTable{fetchTime: time.Now()}
+	for rows.Next() {
+		var (
+			name, dataType, nullable, key, extra string
+			defaultValue                         sql.NullString
+		)
+		if err := rows.Scan(&name, &dataType, &nullable, &defaultValue, &key, &extra); err != nil {
+			return nil, cerror.WrapError(cerror.ErrMySQLQueryError, err)
+		}
+		extra = strings.ToLower(extra)
+		fetched.columns = append(fetched.columns, &downstreamColumn{
+			name:     name,
+			dataType: strings.ToLower(dataType),
+			nullable: strings.EqualFold(nullable, "YES"),
+			hasDefault: defaultValue.Valid ||
+				strings.Contains(extra, "auto_increment") || strings.Contains(extra, "generated"),
+			primary: strings.EqualFold(key, "PRI"),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, cerror.WrapError(cerror.ErrMySQLQueryError, err)
+	}
+	if len(fetched.columns) == 0 {
+		return nil, nil
+	}
+	c.mu.Lock()
+	c.tables[key] = fetched
+	c.mu.Unlock()
+	return fetched, nil
+}
+
+// invalidate drops the cached schema of the table affected by a DDL, an empty
+// table means all tables of the schema.
+func (c *downstreamSchemaChecker) invalidate(schema, table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if table != "" {
+		delete(c.tables, quotes.QuoteSchema(schema, table))
+		return
+	}
+	prefix := quotes.QuoteName(schema) + "."
+	for key := range c.tables {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.tables, key)
+		}
+	}
+}
+
+// check returns an ErrDownstreamTableNotExists error if the downstream table
+// doesn't exist, or an ErrTableSchemaIncompatible error if it misses the columns of the upstream table, has the columns
+// which can't be filled, has the incoercible types, or has a different
+// primary key.
+func (c *downstreamSchemaChecker) check(ctx context.Context, info *model.TableInfo) error {
+	downstream, err := c.fetch(ctx, info.TableName.Schema, info.TableName.Table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if downstream == nil {
+		return cerror.ErrDownstreamTableNotExists.GenWithStackByArgs(info.TableName.QuoteString())
+	}
+	problems := compareTableSchema(info, downstream)
+	if len(problems) == 0 {
+		return nil
+	}
+	return cerror.ErrTableSchemaIncompatible.GenWithStackByArgs(info.TableName.QuoteString(), strings.Join(problems, "; "))
+}
+
+func compareTableSchema(info *model.TableInfo, downstream *downstreamTable) []string {
+	var problems []string
+	columns := make(map[string]*downstreamColumn, len(downstream.columns))
+	var downstreamPK []string
+	for _, col := range downstream.columns {
+		columns[strings.ToLower(col.name)] = col
+		if col.primary {
+			downstreamPK = append(downstreamPK, strings.ToLower(col.name))
+		}
+	}
+
+	written := make(map[string]struct{}, len(info.Columns))
+	var upstreamPK []string
+	for _, col := range info.Columns {
+		// the generated columns are not written to the downstream
+		if col.Hidden || col.IsGenerated() {
+			continue
+		}
+		name := col.Name.L
+		written[name] = struct{}{}
+		if flag := info.ColumnsFlag[col.ID]; flag.IsPrimaryKey() {
+			upstreamPK = append(upstreamPK, name)
+		}
+		target, ok := columns[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("the column %s doesn't exist in the downstream", quotes.QuoteName(col.Name.O)))
+			continue
+		}
+		if !isTypeCoercible(col.Tp, target.dataType) {
+			problems = append(problems, fmt.Sprintf("the type %s of the column %s can't be coerced to the downstream type %s",
+				types.TypeToStr(col.Tp, col.Charset), quotes.QuoteName(col.Name.O), target.dataType))
+		}
+	}
+	for _, col := range downstream.columns {
+		if _, ok := written[strings.ToLower(col.name)]; ok || col.nullable || col.hasDefault {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("the downstream column %s is not in the upstream, and it's neither nullable nor has a default value",
+			quotes.QuoteName(col.name)))
+	}
+
+	if len(upstreamPK) > 0 {
+		sort.Strings(upstreamPK)
+		sort.Strings(downstreamPK)
+		switch {
+		case len(downstreamPK) == 0:
+			problems = append(problems, "the downstream table has no primary key")
+		case strings.Join(upstreamPK, ",") != strings.Join(downstreamPK, ","):
+			problems = append(problems, fmt.Sprintf("the primary key (%s) doesn't match the downstream primary key (%s)",
+				strings.Join(upstreamPK, ", "), strings.Join(downstreamPK, ", ")))
+		}
+	}
+	return problems
+}
+
+type typeClass int
+
+const (
+	typeClassUnknown typeClass = iota
+	typeClassNumeric
+	typeClassString
+	typeClassTemporal
+	typeClassDuration
+	typeClassJSON
+)
+
+func upstreamTypeClass(tp byte) typeClass {
+	switch tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong,
+		mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal, mysql.TypeBit, mysql.TypeYear:
+		return typeClassNumeric
+	case mysql.TypeVarchar, mysql.TypeVarString, mysql.TypeString, mysql.TypeTinyBlob, mysql.TypeMediumBlob,
+		mysql.TypeLongBlob, mysql.TypeBlob, mysql.TypeEnum, mysql.TypeSet:
+		return typeClassString
+	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeTimestamp, mysql.TypeNewDate:
+		return typeClassTemporal
+	case mysql.TypeDuration:
+		return typeClassDuration
+	case mysql.TypeJSON:
+		return typeClassJSON
+	}
+	return typeClassUnknown
+}
+
+func downstreamTypeClass(dataType string) typeClass {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"float", "double", "real", "decimal", "numeric", "bit", "year":
+		return typeClassNumeric
+	case "char", "varchar", "binary", "varbinary", "tinytext", "text", "mediumtext", "longtext",
+		"tinyblob", "blob", "mediumblob", "longblob", "enum", "set":
+		return typeClassString
+	case "date", "datetime", "timestamp":
+		return typeClassTemporal
+	case "time":
+		return typeClassDuration
+	case "json":
+		return typeClassJSON
+	}
+	return typeClassUnknown
+}
+
+// isTypeCoercible returns whether the values of the upstream type can be
+// written to the downstream type, the values of any type can be written to a
+// string column. The unknown types are not checked.
+func isTypeCoercible(upstream byte, downstream string) bool {
+	from, to := upstreamTypeClass(upstream), downstreamTypeClass(downstream)
+	return from == typeClassUnknown || to == typeClassUnknown || from == to || to == typeClassString
+}
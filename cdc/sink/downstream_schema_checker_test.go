@@ -0,0 +1,195 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type downstreamSchemaCheckerSuite struct{}
+
+var _ = check.Suite(&downstreamSchemaCheckerSuite{})
+
+// newSchemaTestTable returns `test`.`orders` with the columns id bigint
+// primary key, name varchar and created_at datetime
+func newSchemaTestTable() *model.TableInfo {
+	newColumn := func(id int64, name string, tp byte, flag uint) *timodel.ColumnInfo {
+		ft := types.NewFieldType(tp)
+		ft.Flag = flag
+		return &timodel.ColumnInfo{
+			ID:        id,
+			Name:      timodel.NewCIStr(name),
+			Offset:    int(id - 1),
+			FieldType: *ft,
+			State:     timodel.StatePublic,
+		}
+	}
+	return model.WrapTableInfo(1, "test", 0, &timodel.TableInfo{
+		ID:   100,
+		Name: timodel.NewCIStr("orders"),
+		Columns: []*timodel.ColumnInfo{
+			newColumn(1, "id", mysql.TypeLonglong, mysql.PriKeyFlag|mysql.NotNullFlag),
+			newColumn(2, "name", mysql.TypeVarchar, 0),
+			newColumn(3, "created_at", mysql.TypeDatetime, 0),
+		},
+		PKIsHandle: true,
+	})
+}
+
+var schemaTestQuery = regexp.QuoteMeta(downstreamColumnsQuery)
+
+// newSchemaTestRows returns the rows of information_schema.COLUMNS, each row
+// is the name, data type, nullable, default, key and extra of a column
+func newSchemaTestRows(columns ...[]driver.Value) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "COLUMN_KEY", "EXTRA"})
+	for _, col := range columns {
+		rows.AddRow(col...)
+	}
+	return rows
+}
+
+var (
+	schemaTestID        = []driver.Value{"id", "bigint", "NO", nil, "PRI", ""}
+	schemaTestName      = []driver.Value{"name", "varchar", "YES", nil, "", ""}
+	schemaTestCreatedAt = []driver.Value{"created_at", "datetime", "YES", nil, "", ""}
+)
+
+func (s downstreamSchemaCheckerSuite) TestCompatibleTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	checker := newDownstreamSchemaChecker(db)
+	table := newSchemaTestTable()
+
+	// the nullable extra column is compatible, and the values of any type
+	// can be written to a string column
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows(
+		schemaTestID, schemaTestName,
+		[]driver.Value{"created_at", "varchar", "YES", nil, "", ""},
+		[]driver.Value{"note", "text", "YES", nil, "", ""},
+		[]driver.Value{"version", "int", "NO", "0", "", ""},
+		[]driver.Value{"seq", "bigint", "NO", nil, "", "auto_increment"},
+	))
+	c.Assert(checker.check(ctx, table), check.IsNil)
+	// the downstream schema is cached
+	c.Assert(checker.check(ctx, table), check.IsNil)
+
+	// the cached schema is dropped by a DDL of the table or the schema
+	checker.invalidate("test", "orders")
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").
+		WillReturnRows(newSchemaTestRows(schemaTestID, schemaTestName, schemaTestCreatedAt))
+	c.Assert(checker.check(ctx, table), check.IsNil)
+	checker.invalidate("test", "")
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").
+		WillReturnRows(newSchemaTestRows(schemaTestID, schemaTestName, schemaTestCreatedAt))
+	c.Assert(checker.check(ctx, table), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s downstreamSchemaCheckerSuite) TestMissingTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	checker := newDownstreamSchemaChecker(db)
+	table := newSchemaTestTable()
+
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows())
+	err = checker.check(ctx, table)
+	c.Assert(cerror.ErrDownstreamTableNotExists.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*`test`.`orders` is incompatible: the table doesn't exist in the downstream.*")
+
+	// the missing table is not cached, so it's found once it's created
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").
+		WillReturnRows(newSchemaTestRows(schemaTestID, schemaTestName, schemaTestCreatedAt))
+	c.Assert(checker.check(ctx, table), check.IsNil)
+
+	// the query error is not an incompatibility
+	checker.invalidate("test", "orders")
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnError(driver.ErrBadConn)
+	err = checker.check(ctx, table)
+	c.Assert(err, check.NotNil)
+	c.Assert(cerror.ErrTableSchemaIncompatible.Equal(err), check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s downstreamSchemaCheckerSuite) TestExtraDownstreamColumn(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	checker := newDownstreamSchemaChecker(db)
+
+	// the rows can't be inserted without the value of the extra column, and
+	// the missing column can't be written
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows(
+		schemaTestID, schemaTestName,
+		[]driver.Value{"tenant", "int", "NO", nil, "", ""},
+	))
+	err = checker.check(ctx, newSchemaTestTable())
+	c.Assert(cerror.ErrTableSchemaIncompatible.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*the column `created_at` doesn't exist in the downstream; "+
+		"the downstream column `tenant` is not in the upstream, and it's neither nullable nor has a default value.*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s downstreamSchemaCheckerSuite) TestIncompatibleType(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	checker := newDownstreamSchemaChecker(db)
+
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows(
+		schemaTestID,
+		[]driver.Value{"name", "int", "YES", nil, "", ""},
+		[]driver.Value{"CREATED_AT", "timestamp", "YES", nil, "", ""},
+	))
+	err = checker.check(ctx, newSchemaTestTable())
+	c.Assert(cerror.ErrTableSchemaIncompatible.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*incompatible: the type varchar of the column `name` can't be coerced to the downstream type int.*")
+
+	// the primary key must be the same
+	checker.invalidate("test", "orders")
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows(
+		[]driver.Value{"id", "bigint", "NO", nil, "", ""},
+		[]driver.Value{"name", "varchar", "NO", nil, "PRI", ""},
+		schemaTestCreatedAt,
+	))
+	err = checker.check(ctx, newSchemaTestTable())
+	c.Assert(err, check.ErrorMatches, ".*incompatible: the primary key \\(id\\) doesn't match the downstream primary key \\(name\\).*")
+	checker.invalidate("test", "orders")
+	mock.ExpectQuery(schemaTestQuery).WithArgs("test", "orders").WillReturnRows(newSchemaTestRows(
+		[]driver.Value{"id", "bigint", "NO", nil, "", ""}, schemaTestName, schemaTestCreatedAt,
+	))
+	err = checker.check(ctx, newSchemaTestTable())
+	c.Assert(err, check.ErrorMatches, ".*incompatible: the downstream table has no primary key.*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
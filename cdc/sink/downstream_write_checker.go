@@ -0,0 +1,281 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// downstreamWriteCheckTimeout is the max duration of a check, the rows of the
+// sentinel tables are counted in the background so the sink is never blocked
+// by a slow query.
+const downstreamWriteCheckTimeout = 30 * time.Second
+
+type sentinelTable struct {
+	schema string
+	table  string
+	// applied is the number of rows inserted minus the number of rows deleted
+	// by the sink since the baseline is taken
+	applied int64
+	// baseline is the number of rows in the downstream minus applied, it
+	// doesn't change unless the rows are written by others than the sink
+	baseline    int64
+	hasBaseline bool
+	// version is increased when the rows are recorded or the baseline is
+	// reset, the count is discarded if the version is changed during the
+	// query, since the rows may be written by the sink concurrently.
+	version uint64
+
+	metricUnexpectedRows prometheus.Counter
+}
+
+// downstreamWriteChecker detects the rows written to the downstream by others
+// than the changefeed, e.g. an application pointed at the downstream, which
+// makes the data diverge or loops with a misconfigured cyclic replication.
+// The rows of the sentinel tables are counted in the downstream periodically,
+// and compared with the rows applied by the sink. It's diagnostics only, the
+// replication is never blocked. All methods are no-op on a nil checker.
+type downstreamWriteChecker struct {
+	changefeedID string
+	interval     time.Duration
+	// db has its own connection, so the queries of the checker never compete
+	// with the workers of the sink
+	db *sql.DB
+
+	mu        sync.Mutex
+	tables    map[string]*sentinelTable
+	lastCheck time.Time
+	checking  bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// sentinelSnapshot is the state of a sentinel table when a check is started
+type sentinelSnapshot struct {
+	table   *sentinelTable
+	applied int64
+	version uint64
+}
+
+func sentinelTableKey(schema, table string) string {
+	return strings.ToLower(schema) + "." + strings.ToLower(table)
+}
+
+func newDownstreamWriteChecker(
+	db *sql.DB, cfg *config.DownstreamWriteCheckConfig, params *sinkParams,
+) (*downstreamWriteChecker, error) {
+	if cfg == nil || !cfg.Enable || len(cfg.SentinelTables) == 0 {
+		return nil, nil
+	}
+	if !params.enableOldValue {
+		// the updates are indistinguishable from the inserts without the old
+		// value, so the rows applied can't be counted
+		log.Warn("the downstream write check is disabled because the old value is not enabled",
+			zap.String("changefeed", params.changefeedID))
+		return nil, nil
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = config.GetDefaultReplicaConfig().DownstreamWriteCheck.Interval
+	}
+	tables := make(map[string]*sentinelTable, len(cfg.SentinelTables))
+	for _, name := range cfg.SentinelTables {
+		parts := strings.Split(name, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack("invalid sentinel table %s, the format must be schema.table", name)
+		}
+		tables[sentinelTableKey(parts[0], parts[1])] = &sentinelTable{
+			schema:               parts[0],
+			table:                parts[1],
+			metricUnexpectedRows: unexpectedDownstreamRowsCounter.WithLabelValues(params.captureAddr, params.changefeedID, name),
+		}
+	}
+	log.Info("downstream write check is enabled",
+		zap.String("changefeed", params.changefeedID),
+		zap.Strings("sentinelTables", cfg.SentinelTables), zap.Int("interval", interval))
+	ctx, cancel := context.WithCancel(context.Background())
+	return &downstreamWriteChecker{
+		changefeedID: params.changefeedID,
+		interval:     time.Duration(interval) * time.Second,
+		db:           db,
+		tables:       tables,
+		lastCheck:    time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}, nil
+}
+
+// record counts the rows of the sentinel tables which are going to be written
+// to the downstream, it must be called before the rows are executed.
+func (c *downstreamWriteChecker) record(txnsGroup map[model.TableID][]*model.SingleTableTxn) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, txns := range txnsGroup {
+		for _, txn := range txns {
+			if txn.Table == nil {
+				continue
+			}
+			table, ok := c.tables[sentinelTableKey(txn.Table.Schema, txn.Table.Table)]
+			if !ok {
+				continue
+			}
+			if len(txn.Rows) != 0 {
+				table.version++
+			}
+			for _, row := range txn.Rows {
+				switch {
+				case row.IsDelete():
+					table.applied--
+				case len(row.PreColumns) == 0:
+					table.applied++
+				}
+			}
+		}
+	}
+}
+
+// reset discards the baseline of the sentinel tables affected by a DDL, the
+// baseline is taken again in the next check. An empty table means all tables
+// of the schema.
+func (c *downstreamWriteChecker) reset(schema, table string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.tables {
+		if !strings.EqualFold(t.schema, schema) || (table != "" && !strings.EqualFold(t.table, table)) {
+			continue
+		}
+		t.applied = 0
+		t.hasBaseline = false
+		t.version++
+	}
+}
+
+// maybeCheck starts counting the rows of the sentinel tables in the downstream
+// in the background if the interval is elapsed since the last check and no
+// check is running. All rows recorded are expected to have been written to the
+// downstream when it's called, so it must be called in the routine flushing
+// rows. The baseline is taken in the first check, after the rows replayed by
+// the safe mode are written.
+func (c *downstreamWriteChecker) maybeCheck(now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checking || now.Sub(c.lastCheck) < c.interval {
+		return
+	}
+	c.lastCheck = now
+	c.checking = true
+	snaps := make([]sentinelSnapshot, 0, len(c.tables))
+	for _, t := range c.tables {
+		snaps = append(snaps, sentinelSnapshot{table: t, applied: t.applied, version: t.version})
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.check(snaps)
+	}()
+}
+
+// check counts the rows of the sentinel tables and compares them with the rows
+// applied when the check is started.
+func (c *downstreamWriteChecker) check(snaps []sentinelSnapshot) {
+	ctx, cancel := context.WithTimeout(c.ctx, downstreamWriteCheckTimeout)
+	defer cancel()
+	defer func() {
+		c.mu.Lock()
+		c.checking = false
+		c.mu.Unlock()
+	}()
+	for _, snap := range snaps {
+		t := snap.table
+		var count int64
+		query := "SELECT COUNT(*) FROM " + quotes.QuoteSchema(t.schema, t.table)
+		err := c.db.QueryRowContext(ctx, query).Scan(&count)
+		if err != nil {
+			log.Warn("failed to count the rows of the sentinel table in the downstream",
+				zap.String("changefeed", c.changefeedID),
+				zap.String("schema", t.schema), zap.String("table", t.table),
+				zap.Error(cerror.WrapError(cerror.ErrMySQLQueryError, err)))
+			continue
+		}
+		c.compare(snap, count)
+	}
+}
+
+// compare compares the rows counted in the downstream with the rows applied by
+// the sink, the count is discarded if the table is changed during the query.
+func (c *downstreamWriteChecker) compare(snap sentinelSnapshot, count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := snap.table
+	if t.version != snap.version {
+		// the rows written by the sink during the query may be counted or
+		// not, the table is checked again in the next round
+		return
+	}
+	baseline := count - snap.applied
+	if !t.hasBaseline {
+		t.baseline = baseline
+		t.hasBaseline = true
+		return
+	}
+	if baseline == t.baseline {
+		return
+	}
+	unexpected := baseline - t.baseline
+	if unexpected < 0 {
+		t.metricUnexpectedRows.Add(float64(-unexpected))
+	} else {
+		t.metricUnexpectedRows.Add(float64(unexpected))
+	}
+	log.Warn("found the rows written to the downstream by others than the changefeed",
+		zap.String("changefeed", c.changefeedID),
+		zap.String("schema", t.schema), zap.String("table", t.table),
+		zap.Int64("downstreamRows", count),
+		zap.Int64("expectedRows", t.baseline+t.applied),
+		zap.Int64("unexpectedRows", unexpected))
+	// the unexpected rows are reported only once
+	t.baseline = baseline
+}
+
+func (c *downstreamWriteChecker) close() error {
+	if c == nil {
+		return nil
+	}
+	c.cancel()
+	c.wg.Wait()
+	return c.db.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type downstreamWriteCheckerSuite struct{}
+
+var _ = check.Suite(&downstreamWriteCheckerSuite{})
+
+func newSentinelTestTxns(table string, rows ...*model.RowChangedEvent) map[model.TableID][]*model.SingleTableTxn {
+	tableName := &model.TableName{Schema: "test", Table: table, TableID: 1}
+	for _, row := range rows {
+		row.Table = tableName
+	}
+	return map[model.TableID][]*model.SingleTableTxn{
+		1: {{Table: tableName, CommitTs: 10, Rows: rows}},
+	}
+}
+
+func (s downstreamWriteCheckerSuite) TestDetectUnexpectedWrites(c *check.C) {
+	defer testleak.AfterTest(c)()
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	params := &sinkParams{changefeedID: "test-cf", captureAddr: "127.0.0.1:8300", enableOldValue: true}
+	checker, err := newDownstreamWriteChecker(db, &config.DownstreamWriteCheckConfig{
+		Enable:         true,
+		Interval:       60,
+		SentinelTables: []string{"test.sentinel"},
+	}, params)
+	c.Assert(err, check.IsNil)
+	c.Assert(checker, check.NotNil)
+	defer checker.close() //nolint:errcheck
+	metric := unexpectedDownstreamRowsCounter.WithLabelValues("127.0.0.1:8300", "test-cf", "test.sentinel")
+	countQuery := regexp.QuoteMeta("SELECT COUNT(*) FROM `test`.`sentinel`")
+	now := time.Now()
+
+	// the downstream has 2 rows before the changefeed starts
+	insert1, insert2 := newCheckTestRow(1, "a"), newCheckTestRow(2, "b")
+	checker.record(newSentinelTestTxns("sentinel", insert1, insert2))
+	checker.record(newSentinelTestTxns("other", newCheckTestRow(3, "c")))
+	// the check is not started before the interval is elapsed
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+
+	// the updates don't change the number of rows
+	update := newCheckTestRow(1, "aa")
+	update.PreColumns = newCheckTestColumns(1, "a")
+	remove := newCheckTestRow(2, "b")
+	remove.PreColumns, remove.Columns = remove.Columns, nil
+	checker.record(newSentinelTestTxns("sentinel", update, remove))
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(0))
+
+	// a row is written to the downstream manually
+	checker.record(newSentinelTestTxns("sentinel", newCheckTestRow(4, "d")))
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(1))
+	// the unexpected rows are reported only once
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(1))
+
+	// the baseline is taken again after the table is truncated
+	checker.reset("TEST", "")
+	checker.record(newSentinelTestTxns("sentinel", newCheckTestRow(5, "e")))
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	checker.record(newSentinelTestTxns("sentinel", newCheckTestRow(6, "f")))
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(1))
+
+	// the count is discarded if the rows are recorded during the query
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillDelayFor(200 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	checker.maybeCheck(now)
+	checker.record(newSentinelTestTxns("sentinel", newCheckTestRow(7, "g")))
+	// only one check runs at a time
+	checker.maybeCheck(now.Add(time.Hour))
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(1))
+	now = now.Add(time.Minute)
+	mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	checker.maybeCheck(now)
+	checker.wg.Wait()
+	c.Assert(testutil.ToFloat64(metric), check.Equals, float64(1))
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s downstreamWriteCheckerSuite) TestNewDownstreamWriteChecker(c *check.C) {
+	defer testleak.AfterTest(c)()
+	params := &sinkParams{changefeedID: "test-cf", enableOldValue: true}
+	cfg := &config.DownstreamWriteCheckConfig{Enable: true, SentinelTables: []string{"test.t1", "t2"}}
+	_, err := newDownstreamWriteChecker(nil, cfg, params)
+	c.Assert(err, check.ErrorMatches, ".*invalid sentinel table t2.*")
+
+	cfg.SentinelTables = []string{"test.t1"}
+	checker, err := newDownstreamWriteChecker(nil, cfg, params)
+	c.Assert(err, check.IsNil)
+	c.Assert(checker.interval, check.Equals, time.Minute)
+
+	// the rows applied can't be counted without the old value
+	params.enableOldValue = false
+	checker, err = newDownstreamWriteChecker(nil, cfg, params)
+	c.Assert(err, check.IsNil)
+	c.Assert(checker, check.IsNil)
+
+	// all methods are no-op on a nil checker
+	checker.record(newSentinelTestTxns("t1", newCheckTestRow(1, "a")))
+	checker.reset("test", "t1")
+	checker.maybeCheck(time.Now().Add(time.Hour))
+	c.Assert(checker.close(), check.IsNil)
+}
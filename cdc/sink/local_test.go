@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/cdclog"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type localSinkSuite struct{}
+
+var _ = check.Suite(&localSinkSuite{})
+
+func newLocalLogRow(tableID int64, commitTs uint64) *model.RowChangedEvent {
+	return &model.RowChangedEvent{
+		StartTs:          commitTs - 1,
+		CommitTs:         commitTs,
+		TableInfoVersion: 100 + commitTs,
+		Table:            &model.TableName{Schema: "test", Table: "t", TableID: tableID},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(commitTs)},
+		},
+	}
+}
+
+func newLocalLogDDL(commitTs uint64) *model.DDLEvent {
+	return &model.DDLEvent{
+		StartTs:   commitTs - 1,
+		CommitTs:  commitTs,
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t", TableID: 1},
+		Query:     "ALTER TABLE test.t ADD COLUMN c INT",
+		Type:      timodel.ActionAddColumn,
+	}
+}
+
+// runLocalSink emits the rows and the DDLs to the local sink of the log, and
+// flushes them with the resolved ts
+func runLocalSink(c *check.C, dir string, rows []*model.RowChangedEvent, ddls []*model.DDLEvent, resolvedTs uint64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewSink(ctx, "test-changefeed", "local://"+dir, nil, config.GetDefaultReplicaConfig(), map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	for _, ddl := range ddls {
+		c.Assert(s.EmitDDLEvent(ctx, ddl), check.IsNil)
+	}
+	c.Assert(s.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	result, err := s.FlushRowChangedEvents(ctx, resolvedTs)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.CheckpointTs, check.Equals, resolvedTs)
+	cancel()
+	c.Assert(s.Close(), check.IsNil)
+}
+
+func readLocalLogFiles(c *check.C, dir string) []struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+} {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest"))
+	c.Assert(err, check.IsNil)
+	var m struct {
+		Files []struct {
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		} `json:"files"`
+	}
+	c.Assert(json.Unmarshal(data, &m), check.IsNil)
+	return m.Files
+}
+
+func (s *localSinkSuite) TestResumeAfterCrash(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := c.MkDir()
+
+	// the row at 16 is written after the resolved ts 15, but not committed
+	runLocalSink(c, dir, []*model.RowChangedEvent{
+		newLocalLogRow(1, 10), newLocalLogRow(1, 11), newLocalLogRow(2, 11),
+		newLocalLogRow(1, 14), newLocalLogRow(1, 16),
+	}, []*model.DDLEvent{newLocalLogDDL(13), newLocalLogDDL(15)}, 15)
+	report, err := cdclog.VerifyLocalLog(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Problems, check.HasLen, 0)
+	c.Assert(report.ChangefeedID, check.Equals, "test-changefeed")
+	c.Assert(report.Tables, check.Equals, 2)
+	c.Assert(report.Events, check.Equals, int64(6))
+	c.Assert(report.Uncommitted, check.HasLen, 1)
+
+	// the crash happens in the middle of writing the uncommitted row
+	tableDir := filepath.Join(dir, "t_1")
+	files := readLocalLogFiles(c, tableDir)
+	c.Assert(files, check.HasLen, 1)
+	path := filepath.Join(tableDir, files[0].Name)
+	stat, err := os.Stat(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(stat.Size() > files[0].Size+10, check.IsTrue)
+	c.Assert(os.Truncate(path, files[0].Size+10), check.IsNil)
+	report, err = cdclog.VerifyLocalLog(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Problems, check.HasLen, 0)
+	c.Assert(report.Uncommitted, check.HasLen, 1)
+
+	// the changefeed is resumed from the checkpoint ts 12, the rows and the
+	// DDLs committed already are skipped
+	runLocalSink(c, dir, []*model.RowChangedEvent{
+		newLocalLogRow(2, 11), newLocalLogRow(1, 14), newLocalLogRow(1, 16), newLocalLogRow(1, 17),
+	}, []*model.DDLEvent{newLocalLogDDL(13), newLocalLogDDL(15), newLocalLogDDL(18)}, 18)
+	report, err = cdclog.VerifyLocalLog(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Problems, check.HasLen, 0)
+	c.Assert(report.Uncommitted, check.HasLen, 0)
+	// 6 rows and 3 DDLs, without duplication or loss
+	c.Assert(report.Events, check.Equals, int64(9))
+	c.Assert(report.Files, check.Equals, 3)
+
+	// the committed events are truncated
+	files = readLocalLogFiles(c, tableDir)
+	c.Assert(os.Truncate(filepath.Join(tableDir, files[0].Name), files[0].Size-10), check.IsNil)
+	report, err = cdclog.VerifyLocalLog(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Problems, check.HasLen, 1)
+	c.Assert(report.Problems[0], check.Matches, ".*the file is truncated.*")
+}
+
+func (s *localSinkSuite) TestRotateFiles(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := c.MkDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := NewSink(ctx, "test-changefeed", "local://"+dir+"?max-file-size=abc", nil,
+		config.GetDefaultReplicaConfig(), map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.ErrorMatches, ".*invalid max-file-size abc.*")
+
+	// the files are rotated once they're committed
+	sink, err := NewSink(ctx, "test-changefeed", "local://"+dir+"?max-file-size=1", nil,
+		config.GetDefaultReplicaConfig(), map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	for _, ts := range []uint64{10, 12} {
+		c.Assert(sink.EmitDDLEvent(ctx, newLocalLogDDL(ts)), check.IsNil)
+	}
+	c.Assert(sink.EmitRowChangedEvents(ctx, newLocalLogRow(1, 11), newLocalLogRow(1, 13), newLocalLogRow(1, 13)), check.IsNil)
+	_, err = sink.FlushRowChangedEvents(ctx, 12)
+	c.Assert(err, check.IsNil)
+	_, err = sink.FlushRowChangedEvents(ctx, 13)
+	c.Assert(err, check.IsNil)
+	cancel()
+	c.Assert(sink.Close(), check.IsNil)
+
+	c.Assert(readLocalLogFiles(c, filepath.Join(dir, "t_1")), check.HasLen, 2)
+	c.Assert(readLocalLogFiles(c, filepath.Join(dir, "ddls")), check.HasLen, 2)
+	report, err := cdclog.VerifyLocalLog(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Problems, check.HasLen, 0)
+	c.Assert(report.Uncommitted, check.HasLen, 0)
+	c.Assert(report.Events, check.Equals, int64(5))
+	c.Assert(report.Files, check.Equals, 4)
+}
@@ -70,6 +70,107 @@ var (
 			Name:      "total_flushed_rows_count",
 			Help:      "totla count of flushed rows",
 		}, []string{"capture", "changefeed"})
+	consistencyCheckRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "consistency_check_rows",
+			Help:      "total count of rows compared between upstream and downstream",
+		}, []string{"capture", "changefeed"})
+	consistencyMismatchRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "consistency_mismatch_rows",
+			Help:      "total count of mismatched rows found by the consistency check",
+		}, []string{"capture", "changefeed"})
+	unexpectedDownstreamRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "unexpected_downstream_rows",
+			Help:      "total count of rows written to the downstream sentinel tables by others than the changefeed",
+		}, []string{"capture", "changefeed", "table"})
+	fullColumnMatchCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "full_column_match_rows",
+			Help:      "total count of updated or deleted rows matched by all columns in the downstream",
+		}, []string{"capture", "changefeed"})
+	cyclicFilteredRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "cyclic_filtered_rows",
+			Help:      "total count of rows dropped by the loop prevention of the cyclic replication",
+		}, []string{"capture", "changefeed"})
+	tableStatementCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "table_statement_count",
+			Help:      "total count of the statements executed in the downstream by table and statement type",
+		}, []string{"capture", "changefeed", "table", "type"})
+	tableStatementDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "table_statement_duration",
+			Help:      "Bucketed histogram of the execution time (s) of the statements by table and statement type.",
+			Buckets:   prometheus.ExponentialBuckets(0.001 /* 1 ms */, 2, 18),
+		}, []string{"capture", "changefeed", "table", "type"})
+	rowLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "row_latency",
+			Help:      "Bucketed histogram of the end-to-end latency (s) from the commit ts to the flush of the sampled rows.",
+			Buckets:   prometheus.ExponentialBuckets(0.01 /* 10 ms */, 2, 20),
+		}, []string{"capture", "changefeed"})
+	tableRowLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "table_row_latency",
+			Help:      "Bucketed histogram of the end-to-end latency (s) of the sampled rows of the tables with the most sampled rows.",
+			Buckets:   prometheus.ExponentialBuckets(0.01 /* 10 ms */, 2, 20),
+		}, []string{"capture", "changefeed", "table"})
+	auditViolationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "audit_violations",
+			Help:      "total count of the rows violating the order found by the audit of the sink input",
+		}, []string{"capture", "changefeed", "type"})
+	compactedRowsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "compacted_rows",
+			Help:      "total count of the rows dropped by the compaction of the sink input in the flush intervals",
+		}, []string{"capture", "changefeed"})
+	tableConflictCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "table_conflict_count",
+			Help:      "total count of the deadlocks and the lock wait timeouts of the DMLs executed in the downstream by table",
+		}, []string{"capture", "changefeed", "table", "type"})
+	serializedTablesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "serialized_tables",
+			Help:      "number of the tables whose txns are serialized onto one worker for the conflicts in the downstream",
+		}, []string{"capture", "changefeed"})
+	compactOverflowCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "compact_overflow_count",
+			Help:      "total count of the flush intervals in which the rows are sent without compaction for too many keys",
+		}, []string{"capture", "changefeed"})
 )
 
 // InitMetrics registers all metrics in this file
@@ -81,4 +182,18 @@ func InitMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(bucketSizeCounter)
 	registry.MustRegister(totalRowsCountGauge)
 	registry.MustRegister(totalFlushedRowsCountGauge)
+	registry.MustRegister(consistencyCheckRowsCounter)
+	registry.MustRegister(consistencyMismatchRowsCounter)
+	registry.MustRegister(unexpectedDownstreamRowsCounter)
+	registry.MustRegister(fullColumnMatchCounter)
+	registry.MustRegister(cyclicFilteredRowsCounter)
+	registry.MustRegister(tableStatementCounter)
+	registry.MustRegister(tableStatementDurationHistogram)
+	registry.MustRegister(rowLatencyHistogram)
+	registry.MustRegister(tableRowLatencyHistogram)
+	registry.MustRegister(auditViolationCounter)
+	registry.MustRegister(compactedRowsCounter)
+	registry.MustRegister(compactOverflowCounter)
+	registry.MustRegister(tableConflictCounter)
+	registry.MustRegister(serializedTablesGauge)
 }
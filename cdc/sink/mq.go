@@ -15,9 +15,11 @@ package sink
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -44,16 +46,32 @@ type mqSink struct {
 	newEncoder func() codec.EventBatchEncoder
 	filter     *filter.Filter
 	protocol   codec.Protocol
-
+	// enableTiDBRowID means the hidden _tidb_rowid of the tables without
+	// handle key is sent to the consumers
+	enableTiDBRowID bool
+
+	// partitionMu protects the partitions and the dispatcher from being
+	// scaled while the rows are dispatched, they are only scaled by the
+	// FlushRowChangedEvents, which needn't lock them for reads. The workers
+	// needn't lock them either, since they only read them when they start
+	// and when they receive the resolved ts sent by the FlushRowChangedEvents.
+	partitionMu    sync.RWMutex
 	partitionNum   int32
 	partitionInput []chan struct {
 		row        *model.RowChangedEvent
 		resolvedTs uint64
 	}
 	partitionResolvedTs []uint64
-	checkpointTs        uint64
-	resolvedNotifier    *notify.Notifier
-	resolvedReceiver    *notify.Receiver
+
+	// topicPartitionNum is the partition number of the topic last refreshed
+	// by the producer, and partitionChange is the OptPartitionChange parameter
+	topicPartitionNum int32
+	partitionChange   string
+	newPartitionCh    chan int32
+
+	checkpointTs     uint64
+	resolvedNotifier *notify.Notifier
+	resolvedReceiver *notify.Receiver
 
 	statistics *Statistics
 }
@@ -111,6 +129,24 @@ func newMqSink(
 		return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, errors.New("Canal requires old value to be enabled"))
 	}
 
+	enableTiDBRowID := false
+	if s, ok := opts[OptEnableTiDBRowID]; ok {
+		enableTiDBRowID, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+		}
+	}
+	partitionChange := partitionChangeKeep
+	if s, ok := opts[OptPartitionChange]; ok {
+		switch strings.ToLower(s) {
+		case partitionChangeKeep, partitionChangeError:
+			partitionChange = strings.ToLower(s)
+		default:
+			return nil, cerror.ErrKafkaInvalidConfig.GenWithStack(
+				"%s must be %s or %s, but got %s", OptPartitionChange, partitionChangeKeep, partitionChangeError, s)
+		}
+	}
+
 	// pre-flight verification of encoder parameters
 	if err := newEncoder().SetParams(opts); err != nil {
 		return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
@@ -137,9 +173,13 @@ func newMqSink(
 		filter:     filter,
 		protocol:   protocol,
 
+		enableTiDBRowID: enableTiDBRowID,
+
 		partitionNum:        partitionNum,
 		partitionInput:      partitionInput,
 		partitionResolvedTs: make([]uint64, partitionNum),
+		partitionChange:     partitionChange,
+		newPartitionCh:      make(chan int32),
 		resolvedNotifier:    notifier,
 		resolvedReceiver:    resolvedReceiver,
 
@@ -147,7 +187,7 @@ func newMqSink(
 	}
 
 	go func() {
-		if err := k.run(ctx); err != nil && errors.Cause(err) != context.Canceled {
+		if err := k.run(ctx, partitionNum); err != nil && errors.Cause(err) != context.Canceled {
 			select {
 			case <-ctx.Done():
 				return
@@ -159,12 +199,17 @@ func newMqSink(
 }
 
 func (k *mqSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	k.partitionMu.RLock()
+	defer k.partitionMu.RUnlock()
 	rowsCount := 0
 	for _, row := range rows {
 		if k.filter.ShouldIgnoreDMLEvent(row.StartTs, row.Table.Schema, row.Table.Table) {
 			log.Info("Row changed event ignored", zap.Uint64("start-ts", row.StartTs))
 			continue
 		}
+		if !k.enableTiDBRowID {
+			row = row.WithoutTiDBRowID()
+		}
 		partition := k.dispatcher.Dispatch(row)
 		select {
 		case <-ctx.Done():
@@ -177,18 +222,42 @@ func (k *mqSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowCha
 		rowsCount++
 	}
 	k.statistics.AddRowsCount(rowsCount)
+	k.statistics.AddSampledRows(rows)
+	return nil
+}
+
+// AddTable implements the TableDispatchSink interface
+func (k *mqSink) AddTable(table model.TableName) (string, error) {
+	if m, ok := k.dispatcher.(dispatcher.RuleMatcher); ok {
+		return m.AddTable(table), nil
+	}
+	return "", nil
+}
+
+// RemoveTable implements the TableDispatchSink interface
+func (k *mqSink) RemoveTable(table model.TableName) {
+	if m, ok := k.dispatcher.(dispatcher.RuleMatcher); ok {
+		m.RemoveTable(table)
+	}
+}
+
+// TableDispatchers implements the TableDispatchSink interface
+func (k *mqSink) TableDispatchers() map[string]string {
+	if m, ok := k.dispatcher.(dispatcher.RuleMatcher); ok {
+		return m.TableRules()
+	}
 	return nil
 }
 
-func (k *mqSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (k *mqSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	if resolvedTs <= k.checkpointTs {
-		return k.checkpointTs, nil
+		return k.statistics.TakeFlushResult(k.checkpointTs), nil
 	}
 
 	for i := 0; i < int(k.partitionNum); i++ {
 		select {
 		case <-ctx.Done():
-			return 0, ctx.Err()
+			return model.FlushResult{}, ctx.Err()
 		case k.partitionInput[i] <- struct {
 			row        *model.RowChangedEvent
 			resolvedTs uint64
@@ -201,7 +270,7 @@ flushLoop:
 	for {
 		select {
 		case <-ctx.Done():
-			return 0, ctx.Err()
+			return model.FlushResult{}, ctx.Err()
 		case <-k.resolvedReceiver.C:
 			for i := 0; i < int(k.partitionNum); i++ {
 				if resolvedTs > atomic.LoadUint64(&k.partitionResolvedTs[i]) {
@@ -213,11 +282,110 @@ flushLoop:
 	}
 	err := k.mqProducer.Flush(ctx)
 	if err != nil {
-		return 0, errors.Trace(err)
+		return model.FlushResult{}, errors.Trace(err)
+	}
+	if err := k.checkPartitionNum(ctx, resolvedTs); err != nil {
+		return model.FlushResult{}, errors.Trace(err)
 	}
 	k.checkpointTs = resolvedTs
 	k.statistics.PrintStatus(ctx)
-	return k.checkpointTs, nil
+	k.statistics.ObserveFlushedRows(k.checkpointTs)
+	return k.statistics.TakeFlushResult(k.checkpointTs), nil
+}
+
+// the values of the OptPartitionChange parameter
+const (
+	partitionChangeKeep  = "keep"
+	partitionChangeError = "error"
+)
+
+// checkPartitionNum checks the partition number of the topic refreshed by the
+// producer, it's called when all the rows before the resolved ts are flushed.
+// If the partitions are added to the topic, the rows after the resolved ts are
+// dispatched by the new partition number, except the rows of the key hash
+// dispatchers. And a resolved event of the resolved ts is broadcast to all the
+// partitions to mark the switch.
+func (k *mqSink) checkPartitionNum(ctx context.Context, resolvedTs uint64) error {
+	watcher, ok := k.mqProducer.(producer.PartitionWatcher)
+	if !ok {
+		return nil
+	}
+	topicPartitionNum := watcher.TopicPartitionNum()
+	oldTopicPartitionNum := k.topicPartitionNum
+	if topicPartitionNum == 0 || topicPartitionNum == oldTopicPartitionNum {
+		return nil
+	}
+	k.topicPartitionNum = topicPartitionNum
+	// the partition number first refreshed is the baseline
+	if oldTopicPartitionNum == 0 {
+		return nil
+	}
+	if topicPartitionNum < k.partitionNum {
+		return cerror.ErrKafkaPartitionNumChanged.GenWithStackByArgs(oldTopicPartitionNum, topicPartitionNum,
+			fmt.Sprintf("the partitions the rows are sent to are deleted, the rows are sent to %d partitions", k.partitionNum))
+	}
+	if topicPartitionNum < oldTopicPartitionNum {
+		log.Warn("the partitions of the topic are deleted, which the rows are not sent to",
+			zap.Int32("old", oldTopicPartitionNum),
+			zap.Int32("new", topicPartitionNum),
+			zap.Int32("partitionNum", k.partitionNum))
+		return nil
+	}
+	scaler, ok := k.dispatcher.(dispatcher.PartitionScaler)
+	if !ok {
+		return nil
+	}
+	keyHashRules := scaler.KeyHashRules()
+	if len(keyHashRules) > 0 && k.partitionChange == partitionChangeError {
+		return cerror.ErrKafkaPartitionNumChanged.GenWithStackByArgs(oldTopicPartitionNum, topicPartitionNum,
+			fmt.Sprintf("the rows of the rules %s are dispatched by the key hash, and %s is %s",
+				strings.Join(keyHashRules, ", "), OptPartitionChange, k.partitionChange))
+	}
+	log.Warn("the partitions are added to the topic, the rows after the resolved ts are dispatched "+
+		"by the new partition number, except the rules keeping the old partition number",
+		zap.Int32("old", oldTopicPartitionNum),
+		zap.Int32("new", topicPartitionNum),
+		zap.Int32("partitionNum", k.partitionNum),
+		zap.Uint64("resolvedTs", resolvedTs),
+		zap.Strings("keepOldPartitionNum", keyHashRules))
+
+	oldPartitionNum := k.partitionNum
+	k.partitionMu.Lock()
+	for i := oldPartitionNum; i < topicPartitionNum; i++ {
+		k.partitionInput = append(k.partitionInput, make(chan struct {
+			row        *model.RowChangedEvent
+			resolvedTs uint64
+		}, 12800))
+	}
+	partitionResolvedTs := make([]uint64, topicPartitionNum)
+	for i := range k.partitionResolvedTs {
+		partitionResolvedTs[i] = atomic.LoadUint64(&k.partitionResolvedTs[i])
+	}
+	for i := oldPartitionNum; i < topicPartitionNum; i++ {
+		partitionResolvedTs[i] = resolvedTs
+	}
+	k.partitionResolvedTs = partitionResolvedTs
+	k.partitionNum = topicPartitionNum
+	watcher.SetPartitionNum(topicPartitionNum)
+	scaler.ScalePartitions(topicPartitionNum)
+	k.partitionMu.Unlock()
+
+	for i := oldPartitionNum; i < topicPartitionNum; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case k.newPartitionCh <- i:
+		}
+	}
+	encoder := k.newEncoder()
+	msg, err := encoder.EncodeCheckpointEvent(resolvedTs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if msg == nil {
+		return nil
+	}
+	return k.writeToProducer(ctx, msg.Key, msg.Value, codec.EncoderNeedSyncWrite, -1)
 }
 
 func (k *mqSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
@@ -257,6 +425,14 @@ func (k *mqSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
 	return errors.Trace(err)
 }
 
+// ProbeDDLExecution implements the DDLExecutionProber interface. Whether the
+// DDL message is produced can't be told, but the consumers drop the DDLs
+// whose commit ts is not larger than the received ones, so the commit ts is
+// the idempotence key of the DDL and it's always produced again.
+func (k *mqSink) ProbeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error) {
+	return false, nil
+}
+
 // Initialize registers Avro schemas for all tables
 func (k *mqSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
 	// No longer need it for now
@@ -268,15 +444,30 @@ func (k *mqSink) Close() error {
 	return errors.Trace(err)
 }
 
-func (k *mqSink) run(ctx context.Context) error {
+// run starts the workers of the partitions, partitionNum is the partition
+// number when the sink is created, the workers of the partitions added later
+// are started once the partitions are sent to the newPartitionCh.
+func (k *mqSink) run(ctx context.Context, partitionNum int32) error {
 	defer k.resolvedReceiver.Stop()
 	wg, ctx := errgroup.WithContext(ctx)
-	for i := int32(0); i < k.partitionNum; i++ {
-		partition := i
+	startWorker := func(partition int32) {
 		wg.Go(func() error {
 			return k.runWorker(ctx, partition)
 		})
 	}
+	for i := int32(0); i < partitionNum; i++ {
+		startWorker(i)
+	}
+	wg.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case partition := <-k.newPartitionCh:
+				startWorker(partition)
+			}
+		}
+	})
 	return wg.Wait()
 }
 
@@ -287,6 +478,9 @@ func (k *mqSink) runWorker(ctx context.Context, partition int32) error {
 	encoder := k.newEncoder()
 	tick := time.NewTicker(500 * time.Millisecond)
 	defer tick.Stop()
+	// batchRows is the number of the rows appended to the encoder since the
+	// last build, a message may contain multiple rows
+	batchRows := 0
 
 	flushToProducer := func(op codec.EncoderResult) error {
 		return k.statistics.RecordBatchExecution(func() (int, error) {
@@ -295,12 +489,16 @@ func (k *mqSink) runWorker(ctx context.Context, partition int32) error {
 			if thisBatchSize == 0 {
 				return 0, nil
 			}
+			rows := batchRows
+			batchRows = 0
 
+			var size int64
 			for _, msg := range messages {
 				err := k.writeToProducer(ctx, msg.Key, msg.Value, codec.EncoderNeedAsyncWrite, partition)
 				if err != nil {
 					return 0, err
 				}
+				size += int64(msg.Length())
 			}
 
 			if op == codec.EncoderNeedSyncWrite {
@@ -309,8 +507,9 @@ func (k *mqSink) runWorker(ctx context.Context, partition int32) error {
 					return 0, err
 				}
 			}
-			log.Debug("MQSink flushed", zap.Int("thisBatchSize", thisBatchSize))
-			return thisBatchSize, nil
+			k.statistics.AddFlushedBytes(size)
+			log.Debug("MQSink flushed", zap.Int("thisBatchSize", thisBatchSize), zap.Int("rows", rows))
+			return rows, nil
 		})
 	}
 	for {
@@ -348,6 +547,7 @@ func (k *mqSink) runWorker(ctx context.Context, partition int32) error {
 		if err != nil {
 			return errors.Trace(err)
 		}
+		batchRows++
 
 		if encoder.Size() >= batchSizeLimit {
 			op = codec.EncoderNeedAsyncWrite
@@ -386,18 +586,20 @@ func (k *mqSink) writeToProducer(ctx context.Context, key []byte, value []byte,
 	return nil
 }
 
-func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Filter, replicaConfig *config.ReplicaConfig, opts map[string]string, errCh chan error) (*mqSink, error) {
+// parseKafkaSinkURI parses the Kafka config from the sink URI, the options of
+// the encoders and the replica config are set by the URI too.
+func parseKafkaSinkURI(sinkURI *url.URL, replicaConfig *config.ReplicaConfig, opts map[string]string) (kafka.Config, error) {
 	config := kafka.NewKafkaConfig()
 
 	scheme := strings.ToLower(sinkURI.Scheme)
 	if scheme != "kafka" && scheme != "kafka+ssl" {
-		return nil, cerror.ErrKafkaInvalidConfig.GenWithStack("can't create MQ sink with unsupported scheme: %s", scheme)
+		return config, cerror.ErrKafkaInvalidConfig.GenWithStack("can't create MQ sink with unsupported scheme: %s", scheme)
 	}
 	s := sinkURI.Query().Get("partition-num")
 	if s != "" {
 		c, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
 		}
 		config.PartitionNum = int32(c)
 	}
@@ -406,7 +608,7 @@ func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Fi
 	if s != "" {
 		c, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
 		}
 		config.ReplicationFactor = int16(c)
 	}
@@ -420,7 +622,7 @@ func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Fi
 	if s != "" {
 		c, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
 		}
 		config.MaxMessageBytes = c
 		opts["max-message-bytes"] = s
@@ -431,6 +633,28 @@ func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Fi
 		opts["max-batch-size"] = s
 	}
 
+	s = sinkURI.Query().Get(OptEnableTiDBRowID)
+	if s != "" {
+		opts[OptEnableTiDBRowID] = s
+	}
+
+	s = sinkURI.Query().Get(OptPartitionChange)
+	if s != "" {
+		opts[OptPartitionChange] = s
+	}
+
+	s = sinkURI.Query().Get("partition-check-interval")
+	if s != "" {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+		}
+		if interval < 0 {
+			return config, cerror.ErrKafkaInvalidConfig.GenWithStack("partition-check-interval must not be negative, but got %s", s)
+		}
+		config.PartitionCheckInterval = interval
+	}
+
 	s = sinkURI.Query().Get("compression")
 	if s != "" {
 		config.Compression = s
@@ -462,30 +686,77 @@ func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Fi
 	if s != "" {
 		autoCreate, err := strconv.ParseBool(s)
 		if err != nil {
-			return nil, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
 		}
 		config.TopicPreProcess = autoCreate
 	}
 
+	s = sinkURI.Query().Get("enable-idempotent")
+	if s != "" {
+		enable, err := strconv.ParseBool(s)
+		if err != nil {
+			return config, cerror.WrapError(cerror.ErrKafkaInvalidConfig, err)
+		}
+		config.EnableIdempotent = enable
+	}
+
+	s = sinkURI.Query().Get("schema-changes-topic")
+	if s != "" {
+		replicaConfig.Sink.SchemaChangesTopic = s
+	}
+	return config, nil
+}
+
+func newKafkaSaramaSink(ctx context.Context, sinkURI *url.URL, filter *filter.Filter, replicaConfig *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
+	config, err := parseKafkaSinkURI(sinkURI, replicaConfig, opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	topic := strings.TrimFunc(sinkURI.Path, func(r rune) bool {
 		return r == '/'
 	})
-	producer, err := kafka.NewKafkaSaramaProducer(ctx, sinkURI.Host, topic, config, errCh)
+	newTopicSink := func(topic string) (*mqSink, error) {
+		producer, err := kafka.NewKafkaSaramaProducer(ctx, sinkURI.Host, topic, config, errCh)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		sink, err := newMqSink(ctx, config.Credential, producer, filter, replicaConfig, opts, errCh)
+		if err != nil {
+			// not need to check error
+			//nolint:errcheck
+			producer.Close()
+			return nil, errors.Trace(err)
+		}
+		return sink, nil
+	}
+	if !needTopicRouter(replicaConfig, topic) {
+		sink, err := newTopicSink(topic)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return sink, nil
+	}
+
+	topicDispatcher, err := dispatcher.NewTopicDispatcher(replicaConfig, topic)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	sink, err := newMqSink(ctx, config.Credential, producer, filter, replicaConfig, opts, errCh)
+	router, err := newMqTopicRouter(topicDispatcher, replicaConfig.Sink.SchemaChangesTopic, newTopicSink)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return sink, nil
+	return router, nil
 }
 
-func newPulsarSink(ctx context.Context, sinkURI *url.URL, filter *filter.Filter, replicaConfig *config.ReplicaConfig, opts map[string]string, errCh chan error) (*mqSink, error) {
-	producer, err := pulsar.NewProducer(sinkURI, errCh)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
+// needTopicRouter returns true if the events may be sent to more than one
+// topic
+func needTopicRouter(replicaConfig *config.ReplicaConfig, defaultTopic string) bool {
+	return dispatcher.HasTopicRules(replicaConfig) || dispatcher.IsTopicExpression(defaultTopic) ||
+		replicaConfig.Sink.SchemaChangesTopic != ""
+}
+
+func newPulsarSink(ctx context.Context, sinkURI *url.URL, filter *filter.Filter, replicaConfig *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
 	s := sinkURI.Query().Get("protocol")
 	if s != "" {
 		replicaConfig.Sink.Protocol = s
@@ -500,12 +771,56 @@ func newPulsarSink(ctx context.Context, sinkURI *url.URL, filter *filter.Filter,
 	if s != "" {
 		opts["max-batch-size"] = s
 	}
+
+	s = sinkURI.Query().Get(OptEnableTiDBRowID)
+	if s != "" {
+		opts[OptEnableTiDBRowID] = s
+	}
+
+	s = sinkURI.Query().Get("schema-changes-topic")
+	if s != "" {
+		replicaConfig.Sink.SchemaChangesTopic = s
+	}
 	// For now, it's a place holder. Avro format have to make connection to Schema Registery,
 	// and it may needs credential.
 	credential := &security.Credential{}
-	sink, err := newMqSink(ctx, credential, producer, filter, replicaConfig, opts, errCh)
+	newTopicSink := func(topicURI *url.URL) (*mqSink, error) {
+		producer, err := pulsar.NewProducer(topicURI, errCh)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		sink, err := newMqSink(ctx, credential, producer, filter, replicaConfig, opts, errCh)
+		if err != nil {
+			// not need to check error
+			//nolint:errcheck
+			producer.Close()
+			return nil, errors.Trace(err)
+		}
+		return sink, nil
+	}
+	defaultTopic := strings.Trim(sinkURI.Path, "/")
+	if defaultTopic == "" {
+		defaultTopic = sinkURI.Query().Get("topic")
+	}
+	if !needTopicRouter(replicaConfig, defaultTopic) {
+		sink, err := newTopicSink(sinkURI)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return sink, nil
+	}
+
+	topicDispatcher, err := dispatcher.NewTopicDispatcher(replicaConfig, defaultTopic)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	router, err := newMqTopicRouter(topicDispatcher, replicaConfig.Sink.SchemaChangesTopic, func(topic string) (*mqSink, error) {
+		topicURI := *sinkURI
+		topicURI.Path = "/" + topic
+		return newTopicSink(&topicURI)
+	})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return sink, nil
+	return router, nil
 }
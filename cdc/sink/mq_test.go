@@ -17,17 +17,24 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/cdc/sink/dispatcher"
+	"github.com/pingcap/ticdc/cdc/sink/producer"
+	"github.com/pingcap/ticdc/cdc/sink/producer/kafka"
 
 	"github.com/Shopify/sarama"
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/config"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/hash"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 )
 
@@ -46,7 +53,6 @@ func (s mqSinkSuite) TestKafkaSink(c *check.C) {
 	metadataResponse.AddBroker(leader.Addr(), leader.BrokerID())
 	metadataResponse.AddTopicPartition(topic, 0, leader.BrokerID(), nil, nil, nil, sarama.ErrNoError)
 	leader.Returns(metadataResponse)
-	leader.Returns(metadataResponse)
 
 	prodSuccess := new(sarama.ProduceResponse)
 	prodSuccess.AddTopicPartition(topic, 0, sarama.ErrNoError)
@@ -65,7 +71,7 @@ func (s mqSinkSuite) TestKafkaSink(c *check.C) {
 	sink, err := newKafkaSaramaSink(ctx, sinkURI, fr, replicaConfig, opts, errCh)
 	c.Assert(err, check.IsNil)
 
-	encoder := sink.newEncoder()
+	encoder := sink.(*mqSink).newEncoder()
 	c.Assert(encoder, check.FitsTypeOf, &codec.JSONEventBatchEncoder{})
 	c.Assert(encoder.(*codec.JSONEventBatchEncoder).GetMaxBatchSize(), check.Equals, 1)
 	c.Assert(encoder.(*codec.JSONEventBatchEncoder).GetMaxKafkaMessageSize(), check.Equals, 4194304)
@@ -82,13 +88,15 @@ func (s mqSinkSuite) TestKafkaSink(c *check.C) {
 	}
 	err = sink.EmitRowChangedEvents(ctx, row)
 	c.Assert(err, check.IsNil)
-	checkpointTs, err := sink.FlushRowChangedEvents(ctx, uint64(120))
+	result, err := sink.FlushRowChangedEvents(ctx, uint64(120))
 	c.Assert(err, check.IsNil)
-	c.Assert(checkpointTs, check.Equals, uint64(120))
+	c.Assert(result.CheckpointTs, check.Equals, uint64(120))
+	c.Assert(result.FlushedRows, check.Equals, uint64(1))
+	c.Assert(result.FlushedBytes, check.Greater, uint64(0))
 	// flush older resolved ts
-	checkpointTs, err = sink.FlushRowChangedEvents(ctx, uint64(110))
+	result, err = sink.FlushRowChangedEvents(ctx, uint64(110))
 	c.Assert(err, check.IsNil)
-	c.Assert(checkpointTs, check.Equals, uint64(120))
+	c.Assert(result, check.DeepEquals, model.FlushResult{CheckpointTs: 120})
 
 	// mock kafka broker processes 1 checkpoint ts event
 	leader.Returns(prodSuccess)
@@ -141,7 +149,6 @@ func (s mqSinkSuite) TestKafkaSinkFilter(c *check.C) {
 	metadataResponse.AddBroker(leader.Addr(), leader.BrokerID())
 	metadataResponse.AddTopicPartition(topic, 0, leader.BrokerID(), nil, nil, nil, sarama.ErrNoError)
 	leader.Returns(metadataResponse)
-	leader.Returns(metadataResponse)
 
 	prodSuccess := new(sarama.ProduceResponse)
 	prodSuccess.AddTopicPartition(topic, 0, sarama.ErrNoError)
@@ -171,7 +178,7 @@ func (s mqSinkSuite) TestKafkaSinkFilter(c *check.C) {
 	}
 	err = sink.EmitRowChangedEvents(ctx, row)
 	c.Assert(err, check.IsNil)
-	c.Assert(sink.statistics.TotalRowsCount(), check.Equals, uint64(0))
+	c.Assert(sink.(*mqSink).statistics.TotalRowsCount(), check.Equals, uint64(0))
 
 	ddl := &model.DDLEvent{
 		StartTs:  130,
@@ -191,6 +198,152 @@ func (s mqSinkSuite) TestKafkaSinkFilter(c *check.C) {
 	}
 }
 
+func (s mqSinkSuite) TestKafkaSinkCompression(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := "kafka-test"
+	leader := sarama.NewMockBroker(c, 1)
+	defer leader.Close()
+	apiVersions := &sarama.ApiVersionsResponse{ApiVersions: []*sarama.ApiVersionsResponseBlock{
+		{ApiKey: 0, MinVersion: 0, MaxVersion: 7},
+	}}
+	leader.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(leader.Addr(), leader.BrokerID()).
+			SetLeader(topic, 0, leader.BrokerID()),
+		"ApiVersionsRequest": sarama.NewMockWrapper(apiVersions),
+	})
+	newSink := func(query string) (Sink, error) {
+		uri := fmt.Sprintf("kafka://%s/kafka-test?partition-num=1&auto-create-topic=false&%s", leader.Addr(), query)
+		sinkURI, err := url.Parse(uri)
+		c.Assert(err, check.IsNil)
+		replicaConfig := config.GetDefaultReplicaConfig()
+		fr, err := filter.NewFilter(replicaConfig)
+		c.Assert(err, check.IsNil)
+		return newKafkaSaramaSink(ctx, sinkURI, fr, replicaConfig, map[string]string{}, make(chan error, 1))
+	}
+
+	sink, err := newSink("kafka-version=2.1.0&compression=zstd")
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.Close(), check.IsNil)
+
+	// zstd is rejected if the kafka version or the broker doesn't support it
+	_, err = newSink("kafka-version=2.0.0&compression=zstd")
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	apiVersions.ApiVersions[0].MaxVersion = 5
+	_, err = newSink("kafka-version=2.1.0&compression=zstd")
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	_, err = newSink("kafka-version=0.9.0.0&compression=lz4")
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue, check.Commentf("%v", err))
+}
+
+func (s mqSinkSuite) TestMQSinkTiDBRowID(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicaConfig := config.GetDefaultReplicaConfig()
+	fr, err := filter.NewFilter(replicaConfig)
+	c.Assert(err, check.IsNil)
+	d, err := dispatcher.NewDispatcher(replicaConfig, 1)
+	c.Assert(err, check.IsNil)
+	row := &model.RowChangedEvent{
+		Table:    &model.TableName{Schema: "test", Table: "t1"},
+		StartTs:  100,
+		CommitTs: 120,
+		Columns: []*model.Column{
+			{Name: "a", Value: 1},
+			{Name: "_tidb_rowid", Value: int64(10), Flag: model.TiDBRowIDFlag},
+		},
+	}
+	for _, enable := range []bool{false, true} {
+		sink := &mqSink{
+			dispatcher:      d,
+			filter:          fr,
+			enableTiDBRowID: enable,
+			partitionNum:    1,
+			partitionInput: []chan struct {
+				row        *model.RowChangedEvent
+				resolvedTs uint64
+			}{make(chan struct {
+				row        *model.RowChangedEvent
+				resolvedTs uint64
+			}, 1)},
+			statistics: NewStatistics(ctx, "MQ", map[string]string{}),
+		}
+		err = sink.EmitRowChangedEvents(ctx, row)
+		c.Assert(err, check.IsNil)
+		emitted := (<-sink.partitionInput[0]).row
+		if enable {
+			c.Assert(emitted.Columns, check.HasLen, 2)
+		} else {
+			c.Assert(emitted.Columns, check.DeepEquals, []*model.Column{{Name: "a", Value: 1}})
+		}
+	}
+	c.Assert(row.Columns, check.HasLen, 2)
+}
+
+func (s mqSinkSuite) TestMQSinkTableDispatcher(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicaConfig := config.GetDefaultReplicaConfig()
+	replicaConfig.CaseSensitive = false
+	replicaConfig.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.new_*"}, Dispatcher: "ts"},
+	}
+	fr, err := filter.NewFilter(replicaConfig)
+	c.Assert(err, check.IsNil)
+	d, err := dispatcher.NewDispatcher(replicaConfig, 4)
+	c.Assert(err, check.IsNil)
+	sink := &mqSink{
+		dispatcher:   d,
+		filter:       fr,
+		partitionNum: 4,
+		partitionInput: make([]chan struct {
+			row        *model.RowChangedEvent
+			resolvedTs uint64
+		}, 4),
+		statistics: NewStatistics(ctx, "MQ", map[string]string{}),
+	}
+	for i := range sink.partitionInput {
+		sink.partitionInput[i] = make(chan struct {
+			row        *model.RowChangedEvent
+			resolvedTs uint64
+		}, 4)
+	}
+
+	rule, err := sink.AddTable(model.TableName{Schema: "test", Table: "t1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rule, check.Equals, "[*.*] default")
+	// the table is created after the changefeed starts, its rows are
+	// dispatched by the commit ts
+	rule, err = sink.AddTable(model.TableName{Schema: "test", Table: "New_Orders"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rule, check.Equals, "[test.new_*] ts")
+	for _, commitTs := range []uint64{121, 122, 123} {
+		err = sink.EmitRowChangedEvents(ctx, &model.RowChangedEvent{
+			Table:    &model.TableName{Schema: "test", Table: "New_Orders"},
+			CommitTs: commitTs,
+			Columns:  []*model.Column{{Name: "id", Value: 1, Flag: model.HandleKeyFlag}},
+		})
+		c.Assert(err, check.IsNil)
+		emitted := <-sink.partitionInput[commitTs%4]
+		c.Assert(emitted.row.CommitTs, check.Equals, commitTs)
+	}
+	c.Assert(sink.TableDispatchers(), check.DeepEquals, map[string]string{
+		"`test`.`t1`":         "[*.*] default",
+		"`test`.`New_Orders`": "[test.new_*] ts",
+	})
+	sink.RemoveTable(model.TableName{Schema: "test", Table: "New_Orders"})
+	c.Assert(sink.TableDispatchers(), check.DeepEquals, map[string]string{
+		"`test`.`t1`": "[*.*] default",
+	})
+}
+
 func (s mqSinkSuite) TestPulsarSinkEncoderConfig(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -211,9 +364,245 @@ func (s mqSinkSuite) TestPulsarSinkEncoderConfig(c *check.C) {
 	errCh := make(chan error, 1)
 	sink, err := newPulsarSink(ctx, sinkURI, fr, replicaConfig, opts, errCh)
 	c.Assert(err, check.IsNil)
+	c.Assert(sink, check.FitsTypeOf, &mqSink{})
 
-	encoder := sink.newEncoder()
+	encoder := sink.(*mqSink).newEncoder()
 	c.Assert(encoder, check.FitsTypeOf, &codec.JSONEventBatchEncoder{})
 	c.Assert(encoder.(*codec.JSONEventBatchEncoder).GetMaxBatchSize(), check.Equals, 1)
 	c.Assert(encoder.(*codec.JSONEventBatchEncoder).GetMaxKafkaMessageSize(), check.Equals, 4194304)
 }
+
+func (s mqSinkSuite) TestTopicRouterDDLTopics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	replicaConfig := config.GetDefaultReplicaConfig()
+	replicaConfig.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.t1"}, Dispatcher: "table", Topic: "topic1"},
+		{Matcher: []string{"test.*"}, Dispatcher: "table", Topic: "topic2"},
+	}
+	topicDispatcher, err := dispatcher.NewTopicDispatcher(replicaConfig, "default")
+	c.Assert(err, check.IsNil)
+	router, err := newMqTopicRouter(topicDispatcher, "", func(topic string) (*mqSink, error) {
+		return &mqSink{}, nil
+	})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo: &model.SimpleTableInfo{Schema: "test"},
+		Type:      timodel.ActionCreateSchema,
+	}), check.DeepEquals, []string{"default", "topic1", "topic2"})
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+		Type:      timodel.ActionAddColumn,
+	}), check.DeepEquals, []string{"topic1"})
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo:    &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+		PreTableInfo: &model.SimpleTableInfo{Schema: "other", Table: "t0"},
+		Type:         timodel.ActionRenameTable,
+	}), check.DeepEquals, []string{"topic1", "default"})
+}
+
+func (s mqSinkSuite) TestTopicRouterExpression(c *check.C) {
+	defer testleak.AfterTest(c)()
+	replicaConfig := config.GetDefaultReplicaConfig()
+	replicaConfig.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.t1"}, Dispatcher: "table", Topic: "static"},
+		{Matcher: []string{"log.*"}, Dispatcher: "table", Topic: "{schema}_{table}"},
+	}
+	c.Assert(needTopicRouter(replicaConfig, "cdc_{schema}"), check.IsTrue)
+	topicDispatcher, err := dispatcher.NewTopicDispatcher(replicaConfig, "cdc_{schema}")
+	c.Assert(err, check.IsNil)
+	var created []string
+	router, err := newMqTopicRouter(topicDispatcher, "schema_changes", func(topic string) (*mqSink, error) {
+		created = append(created, topic)
+		return &mqSink{}, nil
+	})
+	c.Assert(err, check.IsNil)
+	// only the static topics are created at the beginning
+	c.Assert(created, check.DeepEquals, []string{"static", "schema_changes"})
+
+	c.Assert(router.dispatchTopic("test", "t1"), check.Equals, "static")
+	c.Assert(router.dispatchTopic("test", "t2"), check.Equals, "cdc_test")
+	c.Assert(router.dispatchTopic("log", "t1"), check.Equals, "log_t1")
+	for _, topic := range []string{"cdc_test", "log_t1", "cdc_test"} {
+		_, err := router.getSink(topic)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(created, check.DeepEquals, []string{"static", "schema_changes", "cdc_test", "log_t1"})
+
+	// DDLs of tables are sent to the topics of the tables and the schema
+	// changes topic, other DDLs are broadcast to all active topics
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo: &model.SimpleTableInfo{Schema: "new", Table: "t1"},
+		Type:      timodel.ActionCreateTable,
+	}), check.DeepEquals, []string{"cdc_new", "schema_changes"})
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo:    &model.SimpleTableInfo{Schema: "log", Table: "t2"},
+		PreTableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t2"},
+		Type:         timodel.ActionRenameTable,
+	}), check.DeepEquals, []string{"log_t2", "cdc_test", "schema_changes"})
+	c.Assert(router.ddlTopics(&model.DDLEvent{
+		TableInfo: &model.SimpleTableInfo{Schema: "test"},
+		Type:      timodel.ActionDropSchema,
+	}), check.DeepEquals, []string{"cdc_test", "log_t1", "schema_changes", "static"})
+
+	// the resolved ts is sent to the sinks of all active topics
+	c.Assert(router.activeSinks(), check.HasLen, 4)
+
+	_, err = dispatcher.NewTopicDispatcher(replicaConfig, "cdc_{db}")
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrTopicExpressionInvalid.*")
+}
+
+// broadcastRecorder records the partition numbers of the messages broadcast
+// by the kafka producer
+type broadcastRecorder struct {
+	producer.Producer
+	watcher producer.PartitionWatcher
+
+	mu         sync.Mutex
+	broadcasts []int32
+}
+
+func (r *broadcastRecorder) SyncBroadcastMessage(ctx context.Context, key []byte, value []byte) error {
+	r.mu.Lock()
+	r.broadcasts = append(r.broadcasts, r.GetPartitionNum())
+	r.mu.Unlock()
+	return r.Producer.SyncBroadcastMessage(ctx, key, value)
+}
+
+func (r *broadcastRecorder) TopicPartitionNum() int32 {
+	return r.watcher.TopicPartitionNum()
+}
+
+func (r *broadcastRecorder) SetPartitionNum(partitionNum int32) {
+	r.watcher.SetPartitionNum(partitionNum)
+}
+
+func (s mqSinkSuite) TestKafkaSinkPartitionNumChanged(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := "kafka-test"
+	leader := sarama.NewMockBroker(c, 1)
+	defer leader.Close()
+	setPartitionNum := func(partitionNum int32) {
+		metaResponse := sarama.NewMockMetadataResponse(c).SetBroker(leader.Addr(), leader.BrokerID())
+		for i := int32(0); i < partitionNum; i++ {
+			metaResponse.SetLeader(topic, i, leader.BrokerID())
+		}
+		leader.SetHandlerByMap(map[string]sarama.MockResponse{
+			"MetadataRequest": metaResponse,
+			"ProduceRequest":  sarama.NewMockProduceResponse(c),
+		})
+	}
+	setPartitionNum(2)
+
+	sinkURI, err := url.Parse(fmt.Sprintf("kafka://%s/%s?kafka-version=0.9.0.0&partition-num=2"+
+		"&auto-create-topic=false&partition-check-interval=50ms", leader.Addr(), topic))
+	c.Assert(err, check.IsNil)
+	replicaConfig := config.GetDefaultReplicaConfig()
+	replicaConfig.EnableOldValue = false
+	replicaConfig.Sink.DispatchRules = []*config.DispatchRule{
+		{Matcher: []string{"test.table_*"}, Dispatcher: "table"},
+	}
+	fr, err := filter.NewFilter(replicaConfig)
+	c.Assert(err, check.IsNil)
+	opts := map[string]string{}
+	kafkaConfig, err := parseKafkaSinkURI(sinkURI, replicaConfig, opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(kafkaConfig.PartitionCheckInterval, check.Equals, 50*time.Millisecond)
+	errCh := make(chan error, 1)
+	kafkaProducer, err := kafka.NewKafkaSaramaProducer(ctx, leader.Addr(), topic, kafkaConfig, errCh)
+	c.Assert(err, check.IsNil)
+	recorder := &broadcastRecorder{Producer: kafkaProducer, watcher: kafkaProducer}
+	sink, err := newMqSink(ctx, kafkaConfig.Credential, recorder, fr, replicaConfig, opts, errCh)
+	c.Assert(err, check.IsNil)
+	defer sink.Close() //nolint:errcheck
+
+	waitTopicPartitionNum := func(partitionNum int32) {
+		for i := 0; i < 100 && kafkaProducer.TopicPartitionNum() != partitionNum; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		c.Assert(kafkaProducer.TopicPartitionNum(), check.Equals, partitionNum)
+	}
+	tableRow := &model.RowChangedEvent{
+		Table:    &model.TableName{Schema: "test", Table: "table_1"},
+		CommitTs: 110,
+		Columns:  []*model.Column{{Name: "id", Value: 1, Flag: model.HandleKeyFlag}},
+	}
+	keyRow := &model.RowChangedEvent{
+		Table:        &model.TableName{Schema: "test", Table: "t1"},
+		CommitTs:     110,
+		Columns:      []*model.Column{{Name: "id", Value: 1, Flag: model.HandleKeyFlag}},
+		IndexColumns: [][]int{{0}},
+	}
+	tablePartition := func(partitionNum int32) int32 {
+		hasher := hash.NewPositionInertia()
+		hasher.Write([]byte("test"), []byte("table_1"))
+		return int32(hasher.Sum32() % uint32(partitionNum))
+	}
+	keyPartition := sink.dispatcher.Dispatch(keyRow)
+
+	// the partition number first refreshed is the baseline
+	waitTopicPartitionNum(2)
+	err = sink.EmitRowChangedEvents(ctx, tableRow, keyRow)
+	c.Assert(err, check.IsNil)
+	_, err = sink.FlushRowChangedEvents(ctx, 120)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.topicPartitionNum, check.Equals, int32(2))
+	c.Assert(sink.partitionNum, check.Equals, int32(2))
+
+	// the partitions are added to the topic, the rows of the table dispatcher
+	// are dispatched by the new partition number after the resolved ts, and
+	// the rows of the key hash dispatchers keep the old partition number
+	setPartitionNum(4)
+	waitTopicPartitionNum(4)
+	_, err = sink.FlushRowChangedEvents(ctx, 130)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.partitionNum, check.Equals, int32(4))
+	c.Assert(kafkaProducer.GetPartitionNum(), check.Equals, int32(4))
+	recorder.mu.Lock()
+	c.Assert(recorder.broadcasts, check.DeepEquals, []int32{4})
+	recorder.mu.Unlock()
+	c.Assert(sink.dispatcher.Dispatch(tableRow), check.Equals, tablePartition(4))
+	c.Assert(sink.dispatcher.Dispatch(keyRow), check.Equals, keyPartition)
+
+	// the workers of the added partitions are started
+	tableRow.CommitTs, keyRow.CommitTs = 135, 135
+	err = sink.EmitRowChangedEvents(ctx, tableRow, keyRow)
+	c.Assert(err, check.IsNil)
+	result, err := sink.FlushRowChangedEvents(ctx, 140)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.CheckpointTs, check.Equals, uint64(140))
+	c.Assert(sink.partitionResolvedTs, check.DeepEquals, []uint64{140, 140, 140, 140})
+
+	// the changefeed fails if the rows of the key hash dispatchers can't keep
+	// the old partition number
+	sink.partitionChange = partitionChangeError
+	setPartitionNum(8)
+	waitTopicPartitionNum(8)
+	_, err = sink.FlushRowChangedEvents(ctx, 150)
+	c.Assert(cerror.ErrKafkaPartitionNumChanged.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(sink.partitionNum, check.Equals, int32(4))
+	select {
+	case err := <-errCh:
+		c.Fatalf("unexpected err: %s", err)
+	default:
+	}
+}
+
+func (s mqSinkSuite) TestParsePartitionChange(c *check.C) {
+	defer testleak.AfterTest(c)()
+	uri, err := url.Parse("kafka://127.0.0.1:9092/topic?partition-change=error&partition-check-interval=10s")
+	c.Assert(err, check.IsNil)
+	opts := map[string]string{}
+	kafkaConfig, err := parseKafkaSinkURI(uri, config.GetDefaultReplicaConfig(), opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(kafkaConfig.PartitionCheckInterval, check.Equals, 10*time.Second)
+	c.Assert(opts[OptPartitionChange], check.Equals, "error")
+
+	uri, err = url.Parse("kafka://127.0.0.1:9092/topic?partition-check-interval=-1s")
+	c.Assert(err, check.IsNil)
+	_, err = parseKafkaSinkURI(uri, config.GetDefaultReplicaConfig(), map[string]string{})
+	c.Assert(cerror.ErrKafkaInvalidConfig.Equal(err), check.IsTrue)
+}
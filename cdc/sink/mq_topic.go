@@ -0,0 +1,263 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/dispatcher"
+	"go.uber.org/zap"
+)
+
+// mqTopicRouter routes the events of each table to the mqSink of the topic
+// which the table is dispatched to.
+// DDLs of a table are sent to the topic of the table (and the topic of the
+// table before renaming), DDLs without a table (e.g. `CREATE DATABASE`) and
+// checkpoint events are broadcast to all routed topics. All DDLs are also sent
+// to the schema changes topic if it's configured.
+// The sinks of the topics evaluated from topic expressions are created when
+// the first event is routed to them, the topics are created by the producers
+// if they don't exist.
+type mqTopicRouter struct {
+	topicDispatcher    dispatcher.TopicDispatcher
+	schemaChangesTopic string
+	newTopicSink       func(topic string) (*mqSink, error)
+
+	mu sync.Mutex
+	// sinks are the sinks of all active topics
+	sinks map[string]*mqSink
+	// tableTopics caches the topics of the tables
+	tableTopics map[model.TableName]string
+}
+
+func newMqTopicRouter(
+	topicDispatcher dispatcher.TopicDispatcher,
+	schemaChangesTopic string,
+	newTopicSink func(topic string) (*mqSink, error),
+) (*mqTopicRouter, error) {
+	r := &mqTopicRouter{
+		topicDispatcher:    topicDispatcher,
+		schemaChangesTopic: schemaChangesTopic,
+		newTopicSink:       newTopicSink,
+		sinks:              make(map[string]*mqSink, len(topicDispatcher.Topics())),
+		tableTopics:        make(map[model.TableName]string),
+	}
+	topics := topicDispatcher.Topics()
+	if schemaChangesTopic != "" {
+		topics = append(append([]string{}, topics...), schemaChangesTopic)
+	}
+	for _, topic := range topics {
+		if _, err := r.getSink(topic); err != nil {
+			// not need to check error
+			//nolint:errcheck
+			r.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	log.Info("mq sink routes tables to multiple topics", zap.Strings("topics", topics))
+	return r, nil
+}
+
+// getSink returns the sink of the topic, the sink is created if the topic is
+// not active yet. The caller must not hold r.mu.
+func (r *mqTopicRouter) getSink(topic string) (*mqSink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.sinks[topic]; ok {
+		return s, nil
+	}
+	s, err := r.newTopicSink(topic)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r.sinks[topic] = s
+	log.Info("mq sink starts to send events to a new topic", zap.String("topic", topic))
+	return s, nil
+}
+
+// activeSinks returns the sinks of all active topics
+func (r *mqTopicRouter) activeSinks() map[string]*mqSink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sinks := make(map[string]*mqSink, len(r.sinks))
+	for topic, s := range r.sinks {
+		sinks[topic] = s
+	}
+	return sinks
+}
+
+// dispatchTopic returns the topic of the table
+func (r *mqTopicRouter) dispatchTopic(schema, table string) string {
+	name := model.TableName{Schema: schema, Table: table}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if topic, ok := r.tableTopics[name]; ok {
+		return topic
+	}
+	topic := r.topicDispatcher.DispatchTopic(schema, table)
+	r.tableTopics[name] = topic
+	return topic
+}
+
+// AddTable implements the TableDispatchSink interface, the topic of the table
+// is evaluated again.
+func (r *mqTopicRouter) AddTable(table model.TableName) (string, error) {
+	name := model.TableName{Schema: table.Schema, Table: table.Table}
+	r.mu.Lock()
+	delete(r.tableTopics, name)
+	r.mu.Unlock()
+	topic := r.dispatchTopic(table.Schema, table.Table)
+	s, err := r.getSink(topic)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	rule, err := s.AddTable(table)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("%s, topic %s", rule, topic), nil
+}
+
+// RemoveTable implements the TableDispatchSink interface
+func (r *mqTopicRouter) RemoveTable(table model.TableName) {
+	name := model.TableName{Schema: table.Schema, Table: table.Table}
+	r.mu.Lock()
+	topic, ok := r.tableTopics[name]
+	delete(r.tableTopics, name)
+	s := r.sinks[topic]
+	r.mu.Unlock()
+	if ok && s != nil {
+		s.RemoveTable(table)
+	}
+}
+
+// TableDispatchers implements the TableDispatchSink interface
+func (r *mqTopicRouter) TableDispatchers() map[string]string {
+	dispatchers := make(map[string]string)
+	for topic, s := range r.activeSinks() {
+		for table, rule := range s.TableDispatchers() {
+			dispatchers[table] = fmt.Sprintf("%s, topic %s", rule, topic)
+		}
+	}
+	return dispatchers
+}
+
+func (r *mqTopicRouter) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
+	for _, s := range r.activeSinks() {
+		if err := s.Initialize(ctx, tableInfo); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (r *mqTopicRouter) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	rowsByTopic := make(map[string][]*model.RowChangedEvent)
+	for _, row := range rows {
+		topic := r.dispatchTopic(row.Table.Schema, row.Table.Table)
+		rowsByTopic[topic] = append(rowsByTopic[topic], row)
+	}
+	for topic, topicRows := range rowsByTopic {
+		s, err := r.getSink(topic)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := s.EmitRowChangedEvents(ctx, topicRows...); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (r *mqTopicRouter) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	for _, topic := range r.ddlTopics(ddl) {
+		s, err := r.getSink(topic)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := s.EmitDDLEvent(ctx, ddl); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (r *mqTopicRouter) ddlTopics(ddl *model.DDLEvent) []string {
+	var topics []string
+	addTopic := func(topic string) {
+		for _, t := range topics {
+			if t == topic {
+				return
+			}
+		}
+		topics = append(topics, topic)
+	}
+	if ddl.TableInfo == nil || ddl.TableInfo.Table == "" {
+		for topic := range r.activeSinks() {
+			addTopic(topic)
+		}
+		// keep the order of the topics deterministic
+		sort.Strings(topics)
+	} else {
+		addTopic(r.dispatchTopic(ddl.TableInfo.Schema, ddl.TableInfo.Table))
+		if ddl.Type == timodel.ActionRenameTable && ddl.PreTableInfo != nil {
+			addTopic(r.dispatchTopic(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table))
+		}
+	}
+	if r.schemaChangesTopic != "" {
+		addTopic(r.schemaChangesTopic)
+	}
+	return topics
+}
+
+func (r *mqTopicRouter) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	result := model.FlushResult{CheckpointTs: resolvedTs}
+	for _, s := range r.activeSinks() {
+		sinkResult, err := s.FlushRowChangedEvents(ctx, resolvedTs)
+		if err != nil {
+			return model.FlushResult{}, errors.Trace(err)
+		}
+		result = result.Merge(sinkResult)
+	}
+	return result, nil
+}
+
+func (r *mqTopicRouter) EmitCheckpointTs(ctx context.Context, ts uint64) error {
+	for _, s := range r.activeSinks() {
+		if err := s.EmitCheckpointTs(ctx, ts); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (r *mqTopicRouter) Close() error {
+	var firstErr error
+	for topic, s := range r.activeSinks() {
+		if err := s.Close(); err != nil {
+			log.Warn("close mq sink failed", zap.String("topic", topic), zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return errors.Trace(firstErr)
+}
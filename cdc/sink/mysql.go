@@ -46,6 +46,7 @@ import (
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
 	tddl "github.com/pingcap/tidb/ddl"
+	"github.com/pingcap/tidb/errno"
 	"github.com/pingcap/tidb/infoschema"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -64,8 +65,28 @@ const (
 	defaultWriteTimeout        = "2m"
 	defaultDialTimeout         = "2m"
 	defaultSafeMode            = true
+	defaultTxnAtomicity        = txnAtomicityNone
+	defaultMaxTxnBytes         = 0
 )
 
+// the transaction atomicity levels of the MySQL sink
+const (
+	// txnAtomicityTxn executes each upstream transaction in its own downstream
+	// transaction, it must be enabled explicitly.
+	txnAtomicityTxn = "txn"
+	// txnAtomicityNone allows a worker to merge the consecutive upstream
+	// transactions into one downstream transaction, up to max-txn-row rows and
+	// max-txn-bytes bytes if it's set, which reduces the commits of the small
+	// transactions. It's the default.
+	// The merged transactions never cross a resolved ts, so the checkpoint is
+	// still consistent.
+	txnAtomicityNone = "none"
+)
+
+// connectionCollation is the collation of the downstream connections, the
+// strings are sent in its charset utf8mb4.
+const connectionCollation = "utf8mb4_general_ci"
+
 // SyncpointTableName is the name of table where all syncpoint maps sit
 const syncpointTableName string = "syncpoint_v1"
 
@@ -100,17 +121,42 @@ type mysqlSink struct {
 	// metrics used by mysql sink only
 	metricConflictDetectDurationHis prometheus.Observer
 	metricBucketSizeCounters        []prometheus.Counter
+	metricFullColumnMatchCounter    prometheus.Counter
+	// metricCyclicFilteredRowsCounter counts the data rows dropped by the
+	// loop prevention of the cyclic replication
+	metricCyclicFilteredRowsCounter prometheus.Counter
 
 	forceReplicate bool
+
+	checker       *consistencyChecker
+	writeChecker  *downstreamWriteChecker
+	schemaChecker *downstreamSchemaChecker
+
+	logFormatter *model.EventLogFormatter
+
+	conflicts *conflictTracker
 }
 
 func (s *mysqlSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
 	count := s.txnCache.Append(s.filter, rows...)
 	s.statistics.AddRowsCount(count)
+	s.statistics.AddSampledRows(rows)
 	return nil
 }
 
-func (s *mysqlSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (s *mysqlSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	checkpointTs, err := s.flushedTs(resolvedTs)
+	if err != nil {
+		return model.FlushResult{}, err
+	}
+	s.statistics.PrintStatus(ctx)
+	s.statistics.ObserveFlushedRows(checkpointTs)
+	return s.statistics.TakeFlushResult(checkpointTs), nil
+}
+
+// flushedTs notifies the workers to flush the rows to the resolved ts, and
+// returns the ts which all the rows are flushed to.
+func (s *mysqlSink) flushedTs(resolvedTs uint64) (uint64, error) {
 	atomic.StoreUint64(&s.resolvedTs, resolvedTs)
 	s.resolvedNotifier.Notify()
 
@@ -128,12 +174,12 @@ func (s *mysqlSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64
 			checkpointTs = workerCheckpointTs
 		}
 	}
-	s.statistics.PrintStatus(ctx)
 	return checkpointTs, nil
 }
 
 func (s *mysqlSink) flushRowChangedEvents(ctx context.Context) {
-	receiver, err := s.resolvedNotifier.NewReceiver(50 * time.Millisecond)
+	// the receiver backs off if the resolved ts is not advanced
+	receiver, err := s.resolvedNotifier.NewAdaptiveReceiver(50*time.Millisecond, time.Second)
 	if err != nil {
 		log.Error("flush row changed events routine starts failed", zap.Error(err))
 		return
@@ -151,20 +197,27 @@ func (s *mysqlSink) flushRowChangedEvents(ctx context.Context) {
 				atomic.StoreUint64(&worker.checkpointTs, resolvedTs)
 			}
 			s.txnCache.UpdateCheckpoint(resolvedTs)
+			s.checker.maybeCheck(ctx, resolvedTs)
+			s.writeChecker.maybeCheck(time.Now())
 			continue
 		}
 
 		if s.cyclic != nil {
 			// Filter rows if it is origined from downstream.
-			skippedRowCount := cyclic.FilterAndReduceTxns(
+			markRowCount, filteredRowCount := cyclic.FilterAndReduceTxns(
 				resolvedTxnsMap, s.cyclic.FilterReplicaID(), s.cyclic.ReplicaID())
-			s.statistics.SubRowsCount(skippedRowCount)
+			s.statistics.SubRowsCount(markRowCount + filteredRowCount)
+			s.metricCyclicFilteredRowsCounter.Add(float64(filteredRowCount))
 		}
+		s.checker.record(resolvedTxnsMap)
+		s.writeChecker.record(resolvedTxnsMap)
 		s.dispatchAndExecTxns(ctx, resolvedTxnsMap)
 		for _, worker := range s.workers {
 			atomic.StoreUint64(&worker.checkpointTs, resolvedTs)
 		}
 		s.txnCache.UpdateCheckpoint(resolvedTs)
+		s.checker.maybeCheck(ctx, resolvedTs)
+		s.writeChecker.maybeCheck(time.Now())
 	}
 }
 
@@ -184,9 +237,22 @@ func (s *mysqlSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error
 		return cerror.ErrDDLEventIgnored.GenWithStackByArgs()
 	}
 	err := s.execDDLWithMaxRetries(ctx, ddl, defaultDDLMaxRetryTime)
+	// the downstream schema may be changed even if the DDL fails
+	s.schemaChecker.invalidate(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	if ddl.PreTableInfo != nil {
+		s.schemaChecker.invalidate(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)
+	}
+	if err == nil {
+		s.writeChecker.reset(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	}
 	return errors.Trace(err)
 }
 
+// CheckTableSchema implements the TableSchemaChecker interface
+func (s *mysqlSink) CheckTableSchema(ctx context.Context, table *model.TableInfo) error {
+	return s.schemaChecker.check(ctx, table)
+}
+
 // Initialize is no-op for Mysql sink
 func (s *mysqlSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
 	return nil
@@ -203,6 +269,12 @@ func (s *mysqlSink) execDDLWithMaxRetries(ctx context.Context, ddl *model.DDLEve
 			if errors.Cause(err) == context.Canceled {
 				return backoff.Permanent(err)
 			}
+			if isUnsupportedDDLError(err) {
+				// the DDL can't succeed by retrying
+				log.Warn("execute DDL failed, the DDL is not supported by the downstream",
+					zap.String("query", ddl.Query), zap.Error(err))
+				return backoff.Permanent(cerror.ErrDDLUnsupportedByDownstream.GenWithStackByArgs(ddl.Query, err.Error()))
+			}
 			if err != nil {
 				log.Warn("execute DDL with error, retry later", zap.String("query", ddl.Query), zap.Error(err))
 			}
@@ -237,12 +309,18 @@ func (s *mysqlSink) execDDL(ctx context.Context, ddl *model.DDLEvent) error {
 		}
 	}
 
+	start := time.Now()
 	if _, err = tx.ExecContext(ctx, ddl.Query); err != nil {
 		if rbErr := tx.Rollback(); rbErr != nil {
 			log.Error("Failed to rollback", zap.String("sql", ddl.Query), zap.Error(err))
 		}
 		return cerror.WrapError(cerror.ErrMySQLTxnError, err)
 	}
+	table := quotes.QuoteName(ddl.TableInfo.Schema)
+	if ddl.TableInfo.Table != "" {
+		table = quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	}
+	s.observeStatement(statementDDL, table, ddl.Query, time.Since(start), 1, ddl.CommitTs)
 
 	if err = tx.Commit(); err != nil {
 		return cerror.WrapError(cerror.ErrMySQLTxnError, err)
@@ -291,6 +369,24 @@ type sinkParams struct {
 	safeMode            bool
 	timezone            string
 	tls                 string
+	sessionVariables    []sessionVariable
+	// the rows whose commit ts is not after safeModeTs are written in safe
+	// mode, see OptSafeModeTs
+	safeModeTs uint64
+	// enableTiDBRowID means the hidden _tidb_rowid of the tables without
+	// handle key is written to the downstream and used to identify the rows
+	enableTiDBRowID bool
+	txnAtomicity    string
+	maxTxnBytes     int64
+	// the statements slower than slowStatementThreshold are logged, it's
+	// disabled if the threshold is 0
+	slowStatementThreshold time.Duration
+	// adaptiveConcurrency serializes the txns of a table onto one worker if
+	// it has conflictThreshold deadlocks or lock wait timeouts in the
+	// downstream in a minute, until it has no conflict in conflictCooldown.
+	adaptiveConcurrency bool
+	conflictThreshold   int
+	conflictCooldown    time.Duration
 }
 
 func (s *sinkParams) Clone() *sinkParams {
@@ -308,6 +404,12 @@ var defaultParams = &sinkParams{
 	writeTimeout:        defaultWriteTimeout,
 	dialTimeout:         defaultDialTimeout,
 	safeMode:            defaultSafeMode,
+	txnAtomicity:        defaultTxnAtomicity,
+	maxTxnBytes:         defaultMaxTxnBytes,
+
+	slowStatementThreshold: defaultSlowStatementThreshold,
+	conflictThreshold:      defaultConflictThreshold,
+	conflictCooldown:       defaultConflictCooldown,
 }
 
 func checkTiDBVariable(ctx context.Context, db *sql.DB, variableName, defaultValue string) (string, error) {
@@ -337,6 +439,8 @@ func configureSinkURI(
 		dsnCfg.Params = make(map[string]string, 1)
 	}
 	dsnCfg.DBName = ""
+	// the strings decoded from the charsets of the columns are in UTF-8
+	dsnCfg.Collation = connectionCollation
 	dsnCfg.InterpolateParams = true
 	dsnCfg.MultiStatements = true
 	// if timezone is empty string, we don't pass this variable in dsn
@@ -363,6 +467,20 @@ func configureSinkURI(
 		dsnCfg.Params["tidb_txn_mode"] = txnMode
 	}
 
+	if params.enableTiDBRowID {
+		writeRowID, err := checkTiDBVariable(ctx, testDB, "tidb_opt_write_row_id", "1")
+		if err != nil {
+			return "", err
+		}
+		if writeRowID != "" {
+			dsnCfg.Params["tidb_opt_write_row_id"] = writeRowID
+		} else {
+			log.Warn("the downstream doesn't support writing _tidb_rowid, " +
+				"the rows of tables without handle key are matched by all columns")
+			params.enableTiDBRowID = false
+		}
+	}
+
 	dsnClone := dsnCfg.Clone()
 	dsnClone.Passwd = "******"
 	log.Info("sink uri is configured", zap.String("format dsn", dsnClone.FormatDSN()))
@@ -405,6 +523,57 @@ func parseSinkURI(ctx context.Context, sinkURI *url.URL, opts map[string]string)
 		}
 		params.maxTxnRow = c
 	}
+	s = sinkURI.Query().Get("transaction-atomicity")
+	if s != "" {
+		if s != txnAtomicityTxn && s != txnAtomicityNone {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack(
+				"invalid transaction-atomicity %s, it must be %s or %s", s, txnAtomicityTxn, txnAtomicityNone)
+		}
+		params.txnAtomicity = s
+	}
+	s = sinkURI.Query().Get("max-txn-bytes")
+	if s != "" {
+		c, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || c <= 0 {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack("invalid max-txn-bytes %s, it must be a positive integer", s)
+		}
+		params.maxTxnBytes = c
+	}
+	s = sinkURI.Query().Get("slow-statement-threshold")
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack(
+				"invalid slow-statement-threshold %s, it must be a non-negative duration", s)
+		}
+		params.slowStatementThreshold = d
+	}
+	s = sinkURI.Query().Get("adaptive-concurrency")
+	if s != "" {
+		enable, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrMySQLInvalidConfig, err)
+		}
+		params.adaptiveConcurrency = enable
+	}
+	s = sinkURI.Query().Get("conflict-threshold")
+	if s != "" {
+		c, err := strconv.Atoi(s)
+		if err != nil || c <= 0 {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack(
+				"invalid conflict-threshold %s, it must be a positive integer", s)
+		}
+		params.conflictThreshold = c
+	}
+	s = sinkURI.Query().Get("conflict-cooldown")
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack(
+				"invalid conflict-cooldown %s, it must be a positive duration", s)
+		}
+		params.conflictCooldown = d
+	}
 	s = sinkURI.Query().Get("tidb-txn-mode")
 	if s != "" {
 		if s == "pessimistic" || s == "optimistic" {
@@ -457,6 +626,13 @@ func parseSinkURI(ctx context.Context, sinkURI *url.URL, opts map[string]string)
 		}
 		params.safeMode = safeModeEnabled
 	}
+	if s, ok := opts[OptSafeModeTs]; ok {
+		ts, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrMySQLInvalidConfig, err)
+		}
+		params.safeModeTs = ts
+	}
 
 	if _, ok := sinkURI.Query()["time-zone"]; ok {
 		s = sinkURI.Query().Get("time-zone")
@@ -487,23 +663,47 @@ func parseSinkURI(ctx context.Context, sinkURI *url.URL, opts map[string]string)
 		params.dialTimeout = s
 	}
 
+	s = sinkURI.Query().Get(OptEnableTiDBRowID)
+	if s != "" {
+		enable, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrMySQLInvalidConfig, err)
+		}
+		params.enableTiDBRowID = enable
+	}
+
+	sessionVariables, err := parseSessionVariables(sinkURI.Query())
+	if err != nil {
+		return nil, err
+	}
+	params.sessionVariables = sessionVariables
+
 	return params, nil
 }
 
 var getDBConnImpl = getDBConn
 
-func getDBConn(ctx context.Context, dsnStr string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsnStr)
+func getDBConn(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+	dsnCfg, err := dmysql.ParseDSN(dsnStr)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrMySQLInvalidConfig, err)
+	}
+	connector, err := dmysql.NewConnector(dsnCfg)
 	if err != nil {
 		return nil, errors.Annotate(
 			cerror.WrapError(cerror.ErrMySQLConnectionError, err), "Open database connection failed")
 	}
+	db := sql.OpenDB(newSessionConnector(connector, sessionVariables))
 	err = db.PingContext(ctx)
 	if err != nil {
 		// close db to recycle resources
 		if closeErr := db.Close(); closeErr != nil {
 			log.Warn("close db failed", zap.Error(err))
 		}
+		// the session variables can't be set, it's meaningless to retry
+		if cerror.ErrInvalidSessionVariable.Equal(err) {
+			return nil, errors.Trace(err)
+		}
 		return nil, errors.Annotate(
 			cerror.WrapError(cerror.ErrMySQLConnectionError, err), "fail to open MySQL connection")
 	}
@@ -519,13 +719,40 @@ func newMySQLSink(
 	replicaConfig *config.ReplicaConfig,
 	opts map[string]string,
 ) (Sink, error) {
+	sink, err := createMySQLSink(ctx, changefeedID, sinkURI, filter, replicaConfig, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// createMySQLSink creates a MySQL sink writing to the sink uri, the statistics
+// is shared by the sinks of all the targets, a new one is created if it's nil.
+func createMySQLSink(
+	ctx context.Context,
+	changefeedID model.ChangeFeedID,
+	sinkURI *url.URL,
+	filter *tifilter.Filter,
+	replicaConfig *config.ReplicaConfig,
+	opts map[string]string,
+	statistics *Statistics,
+) (*mysqlSink, error) {
 	opts[OptChangefeedID] = changefeedID
 	params, err := parseSinkURI(ctx, sinkURI, opts)
 	if err != nil {
 		return nil, err
 	}
+	logFormatter, err := model.NewEventLogFormatter(replicaConfig)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	params.enableOldValue = replicaConfig.EnableOldValue
+	if replicaConfig.ForceReplicate && !params.enableTiDBRowID {
+		log.Warn("force-replicate is enabled but enable-tidb-rowid is not, the rows of tables without "+
+			"handle key are matched by all columns, which is ambiguous if there are duplicate rows",
+			zap.String("changefeed", changefeedID))
+	}
 
 	// dsn format of the driver:
 	// [username[:password]@][protocol[(address)]]/dbname[?param1=value1&...&paramN=valueN]
@@ -555,7 +782,7 @@ func newMySQLSink(
 	dsn.Params["readTimeout"] = params.readTimeout
 	dsn.Params["writeTimeout"] = params.writeTimeout
 	dsn.Params["timeout"] = params.dialTimeout
-	testDB, err := getDBConnImpl(ctx, dsn.FormatDSN())
+	testDB, err := getDBConnImpl(ctx, dsn.FormatDSN(), params.sessionVariables)
 	if err != nil {
 		return nil, err
 	}
@@ -565,7 +792,7 @@ func newMySQLSink(
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	db, err := getDBConnImpl(ctx, dsnStr)
+	db, err := getDBConnImpl(ctx, dsnStr, params.sessionVariables)
 	if err != nil {
 		return nil, err
 	}
@@ -583,16 +810,41 @@ func newMySQLSink(
 			params.captureAddr, params.changefeedID, strconv.Itoa(i))
 	}
 
+	if statistics == nil {
+		statistics = NewStatistics(ctx, "mysql", opts)
+	}
 	sink := &mysqlSink{
 		db:                              db,
 		params:                          params,
 		filter:                          filter,
 		txnCache:                        common.NewUnresolvedTxnCache(),
-		statistics:                      NewStatistics(ctx, "mysql", opts),
+		statistics:                      statistics,
 		metricConflictDetectDurationHis: metricConflictDetectDurationHis,
 		metricBucketSizeCounters:        metricBucketSizeCounters,
+		metricFullColumnMatchCounter:    fullColumnMatchCounter.WithLabelValues(params.captureAddr, params.changefeedID),
+		metricCyclicFilteredRowsCounter: cyclicFilteredRowsCounter.WithLabelValues(params.captureAddr, params.changefeedID),
 		errCh:                           make(chan error, 1),
 		forceReplicate:                  replicaConfig.ForceReplicate,
+		logFormatter:                    logFormatter,
+		conflicts:                       newConflictTracker(params),
+	}
+	sink.checker = newConsistencyChecker(db, replicaConfig.ConsistencyCheck, params, sink.errCh)
+	sink.schemaChecker = newDownstreamSchemaChecker(db)
+	if cfg := replicaConfig.DownstreamWriteCheck; cfg != nil && cfg.Enable {
+		checkDB, err := getDBConnImpl(ctx, dsnStr, params.sessionVariables)
+		if err != nil {
+			return nil, err
+		}
+		checkDB.SetMaxIdleConns(1)
+		checkDB.SetMaxOpenConns(1)
+		sink.writeChecker, err = newDownstreamWriteChecker(checkDB, cfg, params)
+		if err != nil {
+			checkDB.Close()
+			return nil, errors.Trace(err)
+		}
+		if sink.writeChecker == nil {
+			checkDB.Close()
+		}
 	}
 
 	if val, ok := opts[mark.OptCyclicConfig]; ok {
@@ -622,33 +874,98 @@ func newMySQLSink(
 }
 
 func (s *mysqlSink) createSinkWorkers(ctx context.Context) error {
-	s.workers = make([]*mysqlSinkWorker, s.params.workerCount)
-	for i := range s.workers {
-		receiver, err := s.execWaitNotifier.NewReceiver(defaultFlushInterval)
+	limit := txnBatchLimit{
+		coalesce: s.params.txnAtomicity == txnAtomicityNone,
+		maxRows:  s.params.maxTxnRow,
+		maxBytes: s.params.maxTxnBytes,
+	}
+	workers, err := startSinkWorkers(ctx, limit, s.metricBucketSizeCounters,
+		s.execWaitNotifier, s.execDMLs, s.errCh)
+	if err != nil {
+		return err
+	}
+	s.workers = workers
+	return nil
+}
+
+func (s *mysqlSink) notifyAndWaitExec(ctx context.Context) {
+	notifyAndWaitExec(ctx, s.execWaitNotifier, s.workers)
+}
+
+func (s *mysqlSink) dispatchAndExecTxns(ctx context.Context, txnsGroup map[model.TableID][]*model.SingleTableTxn) {
+	dispatchAndExecTxns(ctx, txnsGroup, s.workers, s.execWaitNotifier, s.metricConflictDetectDurationHis,
+		s.conflicts.serializedTables())
+}
+
+// TableConflicts implements the TableConflictSink interface
+func (s *mysqlSink) TableConflicts() map[model.TableID]string {
+	return s.conflicts.describe()
+}
+
+// txnBatchLimit limits the upstream transactions executed by a worker in one
+// downstream transaction.
+type txnBatchLimit struct {
+	// coalesce is whether the consecutive transactions can be merged, each
+	// transaction is executed alone if it's false.
+	coalesce bool
+	maxRows  int
+	// maxBytes is the max approximate size of the rows, 0 means unlimited.
+	maxBytes int64
+}
+
+// exceeded returns whether a transaction can't be merged with the pending rows.
+func (l txnBatchLimit) exceeded(pendingRows int, pendingBytes int64, txnRows int, txnBytes int64) bool {
+	if pendingRows == 0 {
+		return false
+	}
+	return !l.coalesce || pendingRows+txnRows > l.maxRows ||
+		(l.maxBytes > 0 && pendingBytes+txnBytes > l.maxBytes)
+}
+
+// startSinkWorkers starts a worker for each bucket, the errors of the workers
+// are sent to errCh.
+func startSinkWorkers(
+	ctx context.Context,
+	limit txnBatchLimit,
+	metricBucketSizeCounters []prometheus.Counter,
+	execWaitNotifier *notify.Notifier,
+	execDMLs func(context.Context, []*model.RowChangedEvent, uint64, int) error,
+	errCh chan error,
+) ([]*mysqlSinkWorker, error) {
+	// the coalescing workers are only flushed when they are notified or the
+	// limit is exceeded, otherwise a periodic flush may split the txns which
+	// could be merged.
+	flushInterval := defaultFlushInterval
+	if limit.coalesce {
+		flushInterval = 0
+	}
+	workers := make([]*mysqlSinkWorker, len(metricBucketSizeCounters))
+	for i := range workers {
+		receiver, err := execWaitNotifier.NewReceiver(flushInterval)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		worker := newMySQLSinkWorker(
-			s.params.maxTxnRow, i, s.metricBucketSizeCounters[i], receiver, s.execDMLs)
-		s.workers[i] = worker
+			limit, i, metricBucketSizeCounters[i], receiver, execDMLs)
+		workers[i] = worker
 		go func() {
 			err := worker.run(ctx)
 			if err != nil && errors.Cause(err) != context.Canceled {
 				select {
-				case s.errCh <- err:
+				case errCh <- err:
 				default:
 				}
 			}
 		}()
 	}
-	return nil
+	return workers, nil
 }
 
-func (s *mysqlSink) notifyAndWaitExec(ctx context.Context) {
-	s.execWaitNotifier.Notify()
+func notifyAndWaitExec(ctx context.Context, execWaitNotifier *notify.Notifier, workers []*mysqlSinkWorker) {
+	execWaitNotifier.Notify()
 	done := make(chan struct{})
 	go func() {
-		for _, w := range s.workers {
+		for _, w := range workers {
 			w.waitAllTxnsExecuted()
 		}
 		close(done)
@@ -663,14 +980,30 @@ func (s *mysqlSink) notifyAndWaitExec(ctx context.Context) {
 	}
 }
 
-func (s *mysqlSink) dispatchAndExecTxns(ctx context.Context, txnsGroup map[model.TableID][]*model.SingleTableTxn) {
-	nWorkers := s.params.workerCount
+// dispatchAndExecTxns dispatches the txns to the workers in the order of
+// commit ts, the txns which conflict with each other are sent to the same
+// worker, or executed after all dispatched txns are executed if they conflict
+// with the txns of several workers. It returns after all txns are executed.
+// As the txns are only merged by the workers before they are notified, the
+// merged txns never cross the resolved ts of a flush, and the pending merges
+// are executed before a DDL, which isn't executed by the owner until the
+// checkpoint reaches it. The txns of the serialized tables which don't
+// conflict with the txns dispatched are sent to one worker of each table.
+func dispatchAndExecTxns(
+	ctx context.Context,
+	txnsGroup map[model.TableID][]*model.SingleTableTxn,
+	workers []*mysqlSinkWorker,
+	execWaitNotifier *notify.Notifier,
+	metricConflictDetectDurationHis prometheus.Observer,
+	serializedTables map[model.TableID]struct{},
+) {
+	nWorkers := len(workers)
 	causality := newCausality()
 	rowsChIdx := 0
 
 	sendFn := func(txn *model.SingleTableTxn, keys [][]byte, idx int) {
 		causality.add(keys, idx)
-		s.workers[idx].appendTxn(ctx, txn)
+		workers[idx].appendTxn(ctx, txn)
 	}
 	resolveConflict := func(txn *model.SingleTableTxn) {
 		keys := genTxnKeys(txn)
@@ -679,9 +1012,15 @@ func (s *mysqlSink) dispatchAndExecTxns(ctx context.Context, txnsGroup map[model
 				sendFn(txn, keys, idx)
 				return
 			}
-			s.notifyAndWaitExec(ctx)
+			notifyAndWaitExec(ctx, execWaitNotifier, workers)
 			causality.reset()
 		}
+		if txn.Table != nil {
+			if _, ok := serializedTables[txn.Table.TableID]; ok {
+				sendFn(txn, keys, int(uint64(txn.Table.TableID)%uint64(nWorkers)))
+				return
+			}
+		}
 		sendFn(txn, keys, rowsChIdx)
 		rowsChIdx++
 		rowsChIdx = rowsChIdx % nWorkers
@@ -690,15 +1029,15 @@ func (s *mysqlSink) dispatchAndExecTxns(ctx context.Context, txnsGroup map[model
 	h.iter(func(txn *model.SingleTableTxn) {
 		startTime := time.Now()
 		resolveConflict(txn)
-		s.metricConflictDetectDurationHis.Observe(time.Since(startTime).Seconds())
+		metricConflictDetectDurationHis.Observe(time.Since(startTime).Seconds())
 	})
-	s.notifyAndWaitExec(ctx)
+	notifyAndWaitExec(ctx, execWaitNotifier, workers)
 }
 
 type mysqlSinkWorker struct {
 	txnCh            chan *model.SingleTableTxn
 	txnWg            sync.WaitGroup
-	maxTxnRow        int
+	limit            txnBatchLimit
 	bucket           int
 	execDMLs         func(context.Context, []*model.RowChangedEvent, uint64, int) error
 	metricBucketSize prometheus.Counter
@@ -707,7 +1046,7 @@ type mysqlSinkWorker struct {
 }
 
 func newMySQLSinkWorker(
-	maxTxnRow int,
+	limit txnBatchLimit,
 	bucket int,
 	metricBucketSize prometheus.Counter,
 	receiver *notify.Receiver,
@@ -715,7 +1054,7 @@ func newMySQLSinkWorker(
 ) *mysqlSinkWorker {
 	return &mysqlSinkWorker{
 		txnCh:            make(chan *model.SingleTableTxn, 1024),
-		maxTxnRow:        maxTxnRow,
+		limit:            limit,
 		bucket:           bucket,
 		metricBucketSize: metricBucketSize,
 		execDMLs:         execDMLs,
@@ -742,6 +1081,7 @@ func (w *mysqlSinkWorker) appendTxn(ctx context.Context, txn *model.SingleTableT
 func (w *mysqlSinkWorker) run(ctx context.Context) (err error) {
 	var (
 		toExecRows   []*model.RowChangedEvent
+		toExecBytes  int64
 		replicaID    uint64
 		txnNum       int
 		lastCommitTs uint64
@@ -772,12 +1112,31 @@ func (w *mysqlSinkWorker) run(ctx context.Context) (err error) {
 		}
 		atomic.StoreUint64(&w.checkpointTs, lastCommitTs)
 		toExecRows = toExecRows[:0]
+		toExecBytes = 0
 		w.metricBucketSize.Add(float64(txnNum))
 		w.txnWg.Add(-1 * txnNum)
 		txnNum = 0
 		return nil
 	}
 
+	appendTxn := func(txn *model.SingleTableTxn) error {
+		var txnBytes int64
+		for _, row := range txn.Rows {
+			txnBytes += row.ApproximateSize
+		}
+		if txn.ReplicaID != replicaID || w.limit.exceeded(len(toExecRows), toExecBytes, len(txn.Rows), txnBytes) {
+			if err := flushRows(); err != nil {
+				return err
+			}
+		}
+		replicaID = txn.ReplicaID
+		toExecRows = append(toExecRows, txn.Rows...)
+		toExecBytes += txnBytes
+		lastCommitTs = txn.CommitTs
+		txnNum++
+		return nil
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -786,16 +1145,27 @@ func (w *mysqlSinkWorker) run(ctx context.Context) (err error) {
 			if txn == nil {
 				return errors.Trace(flushRows())
 			}
-			if txn.ReplicaID != replicaID || len(toExecRows)+len(txn.Rows) > w.maxTxnRow {
-				if err := flushRows(); err != nil {
-					return errors.Trace(err)
-				}
+			if err := appendTxn(txn); err != nil {
+				return errors.Trace(err)
 			}
-			replicaID = txn.ReplicaID
-			toExecRows = append(toExecRows, txn.Rows...)
-			lastCommitTs = txn.CommitTs
-			txnNum++
 		case <-w.receiver.C:
+			// the txns dispatched before the notification may not be received
+			// yet as the select picks a ready case randomly, they are merged
+			// before the flush.
+		drain:
+			for w.limit.coalesce {
+				select {
+				case txn := <-w.txnCh:
+					if txn == nil {
+						return errors.Trace(flushRows())
+					}
+					if err := appendTxn(txn); err != nil {
+						return errors.Trace(err)
+					}
+				default:
+					break drain
+				}
+			}
 			if err := flushRows(); err != nil {
 				return errors.Trace(err)
 			}
@@ -806,12 +1176,36 @@ func (w *mysqlSinkWorker) run(ctx context.Context) (err error) {
 func (s *mysqlSink) Close() error {
 	s.execWaitNotifier.Close()
 	s.resolvedNotifier.Close()
+	s.conflicts.close()
+	if err := s.writeChecker.close(); err != nil {
+		log.Warn("failed to close the connection of the downstream write checker", zap.Error(err))
+	}
 	err := s.db.Close()
 	return cerror.WrapError(cerror.ErrMySQLConnectionError, err)
 }
 
+// observeStatement records the execution of the statement of the table, and
+// logs the statement with its fingerprint if it's slower than the threshold.
+func (s *mysqlSink) observeStatement(
+	typ, table, query string, duration time.Duration, batchSize int, commitTs uint64,
+) {
+	stats := s.statistics.statements.get(table, typ)
+	slow := s.params.slowStatementThreshold > 0 && duration >= s.params.slowStatementThreshold
+	s.statistics.statements.observe(stats, duration, slow)
+	if slow {
+		log.Warn("slow statement",
+			zap.String("changefeed", s.params.changefeedID),
+			zap.String("table", table),
+			zap.String("type", typ),
+			zap.String("fingerprint", stats.fingerprint(query)),
+			zap.Duration("duration", duration),
+			zap.Int("batchSize", batchSize),
+			zap.Uint64("commitTs", commitTs))
+	}
+}
+
 func (s *mysqlSink) execDMLWithMaxRetries(
-	ctx context.Context, dmls *preparedDMLs, maxRetries uint64, bucket int,
+	ctx context.Context, dmls *preparedDMLs, rows []*model.RowChangedEvent, maxRetries uint64, bucket int, commitTs uint64,
 ) error {
 	if len(dmls.sqls) != len(dmls.values) {
 		log.Panic("unexpected number of sqls and values",
@@ -822,6 +1216,9 @@ func (s *mysqlSink) execDMLWithMaxRetries(
 		if errors.Cause(err) == context.Canceled {
 			return backoff.Permanent(err)
 		}
+		if typ := conflictType(err); typ != "" {
+			s.conflicts.record(rows, typ)
+		}
 		log.Warn("execute DMLs with error, retry later", zap.Error(err))
 		return err
 	}
@@ -841,12 +1238,16 @@ func (s *mysqlSink) execDMLWithMaxRetries(
 				for i, query := range dmls.sqls {
 					args := dmls.values[i]
 					log.Debug("exec row", zap.String("sql", query), zap.Any("args", args))
+					start := time.Now()
 					if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 						if rbErr := tx.Rollback(); rbErr != nil {
 							log.Warn("failed to rollback txn", zap.Error(err))
 						}
 						return 0, checkTxnErr(cerror.WrapError(cerror.ErrMySQLTxnError, err))
 					}
+					if typ, table := parseDMLStatement(query); typ != "" {
+						s.observeStatement(typ, table, query, time.Since(start), dmls.rowCount, commitTs)
+					}
 				}
 				if len(dmls.markSQL) != 0 {
 					log.Debug("exec row", zap.String("sql", dmls.markSQL))
@@ -865,6 +1266,7 @@ func (s *mysqlSink) execDMLWithMaxRetries(
 			if err != nil {
 				return errors.Trace(err)
 			}
+			s.statistics.AddFlushedBytes(dmls.size)
 			log.Debug("Exec Rows succeeded",
 				zap.String("changefeed", s.params.changefeedID),
 				zap.Int("num of Rows", dmls.rowCount),
@@ -879,6 +1281,8 @@ type preparedDMLs struct {
 	values   [][]interface{}
 	markSQL  string
 	rowCount int
+	// size is the approximate size of the rows
+	size int64
 }
 
 // prepareDMLs converts model.RowChangedEvent list to query string list and args list
@@ -887,7 +1291,8 @@ func (s *mysqlSink) prepareDMLs(rows []*model.RowChangedEvent, replicaID uint64,
 	values := make([][]interface{}, 0, len(rows))
 	replaces := make(map[string][][]interface{})
 	rowCount := 0
-	translateToInsert := s.params.enableOldValue && !s.params.safeMode
+	var size int64
+	safeMode := !s.params.enableOldValue || s.params.safeMode
 
 	// flush cached batch replace or insert, to keep the sequence of DMLs
 	flushCacheDMLs := func() {
@@ -902,8 +1307,20 @@ func (s *mysqlSink) prepareDMLs(rows []*model.RowChangedEvent, replicaID uint64,
 	for _, row := range rows {
 		var query string
 		var args []interface{}
+		size += row.ApproximateSize
 		quoteTable := quotes.QuoteSchema(row.Table.Schema, row.Table.Table)
+		if !s.params.enableTiDBRowID {
+			row = row.WithoutTiDBRowID()
+		}
+		if s.forceReplicate && len(row.PreColumns) != 0 && !hasRowIdentity(row.PreColumns) &&
+			s.metricFullColumnMatchCounter != nil {
+			// the row is matched by all columns, which may be ambiguous if
+			// there are duplicate rows in the downstream
+			s.metricFullColumnMatchCounter.Inc()
+		}
 
+		// the replayed rows are always written in safe mode
+		translateToInsert := !safeMode && row.CommitTs > s.params.safeModeTs
 		// Translate to UPDATE if old value is enabled, not in safe mode and is update event
 		if translateToInsert && len(row.PreColumns) != 0 && len(row.Columns) != 0 {
 			flushCacheDMLs()
@@ -968,6 +1385,7 @@ func (s *mysqlSink) prepareDMLs(rows []*model.RowChangedEvent, replicaID uint64,
 		// we do not count mark table rows in rowCount.
 	}
 	dmls.rowCount = rowCount
+	dmls.size = size
 	return dmls
 }
 
@@ -983,8 +1401,12 @@ func (s *mysqlSink) execDMLs(ctx context.Context, rows []*model.RowChangedEvent,
 		failpoint.Return(errors.Trace(dmysql.ErrInvalidConn))
 	})
 	dmls := s.prepareDMLs(rows, replicaID, bucket)
-	log.Debug("prepare DMLs", zap.Any("rows", rows), zap.Strings("sqls", dmls.sqls), zap.Any("values", dmls.values))
-	if err := s.execDMLWithMaxRetries(ctx, dmls, defaultDMLMaxRetryTime, bucket); err != nil {
+	log.Debug("prepare DMLs", s.logFormatter.Rows("rows", rows), zap.Strings("sqls", dmls.sqls))
+	var commitTs uint64
+	if len(rows) > 0 {
+		commitTs = rows[len(rows)-1].CommitTs
+	}
+	if err := s.execDMLWithMaxRetries(ctx, dmls, rows, defaultDMLMaxRetryTime, bucket, commitTs); err != nil {
 		ts := make([]uint64, 0, len(rows))
 		for _, row := range rows {
 			if len(ts) == 0 || ts[len(ts)-1] != row.CommitTs {
@@ -1011,7 +1433,7 @@ func prepareReplace(
 			continue
 		}
 		columnNames = append(columnNames, col.Name)
-		args = append(args, col.Value)
+		args = append(args, argValue(col))
 	}
 	if len(args) == 0 {
 		return "", nil
@@ -1075,11 +1497,12 @@ func prepareUpdate(quoteTable string, preCols, cols []*model.Column, forceReplic
 	columnNames := make([]string, 0, len(cols))
 	args := make([]interface{}, 0, len(cols)+len(preCols))
 	for _, col := range cols {
-		if col == nil || col.Flag.IsGeneratedColumn() {
+		// _tidb_rowid is never changed by UPDATE
+		if col == nil || col.Flag.IsGeneratedColumn() || col.Flag.IsTiDBRowID() {
 			continue
 		}
 		columnNames = append(columnNames, col.Name)
-		args = append(args, col.Value)
+		args = append(args, argValue(col))
 	}
 	if len(args) == 0 {
 		return "", nil
@@ -1145,20 +1568,65 @@ func whereSlice(cols []*model.Column, forceReplicate bool) (colNames []string, a
 			continue
 		}
 		colNames = append(colNames, col.Name)
-		args = append(args, col.Value)
+		args = append(args, argValue(col))
+	}
+	if len(colNames) != 0 || !forceReplicate {
+		return
+	}
+	// if no explicit row id but force replicate, use _tidb_rowid if it's
+	// written to the downstream, otherwise use all key-values in where condition
+	for _, col := range cols {
+		if col != nil && col.Flag.IsTiDBRowID() {
+			return []string{col.Name}, []interface{}{col.Value}
+		}
 	}
-	// if no explicit row id but force replicate, use all key-values in where condition
-	if len(colNames) == 0 && forceReplicate {
-		colNames = make([]string, 0, len(cols))
-		args = make([]interface{}, 0, len(cols))
-		for _, col := range cols {
+	// only the columns recovered from the key of the deleted row are
+	// available if old value is disabled, so they're matched rather than
+	// the columns that happen to be filled
+	for _, col := range cols {
+		if col != nil && col.Flag.IsRecoveredFromKey() {
 			colNames = append(colNames, col.Name)
-			args = append(args, col.Value)
+			args = append(args, argValue(col))
 		}
 	}
+	if len(colNames) != 0 {
+		return
+	}
+	colNames = make([]string, 0, len(cols))
+	args = make([]interface{}, 0, len(cols))
+	for _, col := range cols {
+		if col == nil {
+			continue
+		}
+		colNames = append(colNames, col.Name)
+		args = append(args, argValue(col))
+	}
 	return
 }
 
+// argValue returns the value of the column as an argument of the statement.
+// The values decoded from the charsets of the columns are sent as strings,
+// which are converted from the connection charset into the column charsets
+// by the downstream, while the other bytes are sent as the _binary literals,
+// which are written as they are.
+func argValue(col *model.Column) interface{} {
+	if b, ok := col.Value.([]byte); ok && col.Charset != "" {
+		return string(b)
+	}
+	return col.Value
+}
+
+// hasRowIdentity returns whether the row can be identified by the handle key
+// or the _tidb_rowid, rather than all columns.
+func hasRowIdentity(cols []*model.Column) bool {
+	for _, col := range cols {
+		if col != nil && (col.Flag.IsHandleKey() || col.Flag.IsTiDBRowID()) {
+			return true
+		}
+	}
+	return false
+}
+
 func isIgnorableDDLError(err error) bool {
 	errCode, ok := getSQLErrCode(err)
 	if !ok {
@@ -1180,6 +1648,22 @@ func isIgnorableDDLError(err error) bool {
 	}
 }
 
+// isUnsupportedDDLError returns whether the DDL is rejected by the downstream
+// because the downstream doesn't support it, rather than a transient failure.
+func isUnsupportedDDLError(err error) bool {
+	errCode, ok := getSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	switch errCode {
+	case mysql.ErrParse, mysql.ErrSyntax, mysql.ErrNotSupportedYet, mysql.ErrUnknownStorageEngine,
+		mysql.ErrUnknownCharacterSet, mysql.ErrUnknownCollation, errno.ErrUnsupportedDDLOperation:
+		return true
+	default:
+		return false
+	}
+}
+
 func getSQLErrCode(err error) (errors.ErrCode, bool) {
 	mysqlErr, ok := errors.Cause(err).(*dmysql.MySQLError)
 	if !ok {
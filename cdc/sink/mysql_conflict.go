@@ -0,0 +1,227 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// the types of the conflicts of the DMLs in the downstream
+const (
+	conflictDeadlock        = "deadlock"
+	conflictLockWaitTimeout = "lock-wait-timeout"
+)
+
+const (
+	defaultConflictThreshold = 10
+	defaultConflictCooldown  = 5 * time.Minute
+)
+
+// conflictWindow is the window the conflicts of a table are counted in, the
+// table is serialized once the conflicts in a window reach the threshold.
+var conflictWindow = time.Minute
+
+// conflictType returns the type of the conflict the error of the DMLs is
+// caused by, it's empty if the error is not a conflict.
+func conflictType(err error) string {
+	errCode, ok := getSQLErrCode(err)
+	if !ok {
+		return ""
+	}
+	switch errCode {
+	case mysql.ErrLockDeadlock:
+		return conflictDeadlock
+	case mysql.ErrLockWaitTimeout:
+		return conflictLockWaitTimeout
+	}
+	return ""
+}
+
+// tableConflicts is the conflicts of the DMLs of a table in the downstream
+type tableConflicts struct {
+	table            string
+	deadlocks        uint64
+	lockWaitTimeouts uint64
+
+	windowStart  time.Time
+	windowCount  int
+	lastConflict time.Time
+	// serializedAt is when the txns of the table are serialized onto one
+	// worker, it's zero if the table has the full concurrency.
+	serializedAt time.Time
+
+	deadlockCounter        prometheus.Counter
+	lockWaitTimeoutCounter prometheus.Counter
+}
+
+// conflictTracker counts the deadlocks and the lock wait timeouts of the DMLs
+// of each table executed by the MySQL sink. In the adaptive mode, the txns of
+// a table are serialized onto one worker if its conflicts in conflictWindow
+// reach the threshold, and the table is restored to the full concurrency
+// after it has no conflict in the cool-down.
+type conflictTracker struct {
+	captureAddr  string
+	changefeedID string
+	adaptive     bool
+	threshold    int
+	cooldown     time.Duration
+	now          func() time.Time
+
+	mu     sync.Mutex
+	tables map[model.TableID]*tableConflicts
+
+	serializedGauge prometheus.Gauge
+}
+
+func newConflictTracker(params *sinkParams) *conflictTracker {
+	return &conflictTracker{
+		captureAddr:     params.captureAddr,
+		changefeedID:    params.changefeedID,
+		adaptive:        params.adaptiveConcurrency,
+		threshold:       params.conflictThreshold,
+		cooldown:        params.conflictCooldown,
+		now:             time.Now,
+		tables:          make(map[model.TableID]*tableConflicts),
+		serializedGauge: serializedTablesGauge.WithLabelValues(params.captureAddr, params.changefeedID),
+	}
+}
+
+// record records a conflict of the DMLs of the rows, which is counted for each
+// table of the rows since the txns of the tables may be executed together.
+func (t *conflictTracker) record(rows []*model.RowChangedEvent, typ string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	seen := make(map[model.TableID]struct{})
+	for _, row := range rows {
+		if row.Table == nil {
+			continue
+		}
+		if _, ok := seen[row.Table.TableID]; ok {
+			continue
+		}
+		seen[row.Table.TableID] = struct{}{}
+		t.recordTable(row.Table, typ, now)
+	}
+}
+
+func (t *conflictTracker) recordTable(table *model.TableName, typ string, now time.Time) {
+	conflicts, ok := t.tables[table.TableID]
+	if !ok {
+		quoted := table.QuoteString()
+		conflicts = &tableConflicts{
+			table: quoted,
+			deadlockCounter: tableConflictCounter.WithLabelValues(
+				t.captureAddr, t.changefeedID, quoted, conflictDeadlock),
+			lockWaitTimeoutCounter: tableConflictCounter.WithLabelValues(
+				t.captureAddr, t.changefeedID, quoted, conflictLockWaitTimeout),
+		}
+		t.tables[table.TableID] = conflicts
+	}
+	switch typ {
+	case conflictDeadlock:
+		conflicts.deadlocks++
+		conflicts.deadlockCounter.Inc()
+	case conflictLockWaitTimeout:
+		conflicts.lockWaitTimeouts++
+		conflicts.lockWaitTimeoutCounter.Inc()
+	}
+	conflicts.lastConflict = now
+	if now.Sub(conflicts.windowStart) >= conflictWindow {
+		conflicts.windowStart = now
+		conflicts.windowCount = 0
+	}
+	conflicts.windowCount++
+	if !t.adaptive || !conflicts.serializedAt.IsZero() || conflicts.windowCount < t.threshold {
+		return
+	}
+	conflicts.serializedAt = now
+	t.serializedGauge.Inc()
+	log.Warn("the txns of the table are serialized for the conflicts in the downstream",
+		zap.String("changefeed", t.changefeedID),
+		zap.String("table", conflicts.table),
+		zap.Int("conflicts", conflicts.windowCount),
+		zap.Duration("window", conflictWindow),
+		zap.Uint64("deadlocks", conflicts.deadlocks),
+		zap.Uint64("lockWaitTimeouts", conflicts.lockWaitTimeouts))
+}
+
+// serializedTables returns the tables whose txns are serialized onto one
+// worker, the tables without any conflict in the cool-down are restored to
+// the full concurrency.
+func (t *conflictTracker) serializedTables() map[model.TableID]struct{} {
+	if !t.adaptive {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var tables map[model.TableID]struct{}
+	for tableID, conflicts := range t.tables {
+		if conflicts.serializedAt.IsZero() {
+			continue
+		}
+		if now.Sub(conflicts.lastConflict) >= t.cooldown {
+			log.Info("the txns of the table are restored to the full concurrency after the cool-down",
+				zap.String("changefeed", t.changefeedID),
+				zap.String("table", conflicts.table),
+				zap.Duration("serialized", now.Sub(conflicts.serializedAt)),
+				zap.Duration("cooldown", t.cooldown))
+			conflicts.serializedAt = time.Time{}
+			conflicts.windowCount = 0
+			t.serializedGauge.Dec()
+			continue
+		}
+		if tables == nil {
+			tables = make(map[model.TableID]struct{})
+		}
+		tables[tableID] = struct{}{}
+	}
+	return tables
+}
+
+// describe returns the descriptions of the conflicts of the tables
+func (t *conflictTracker) describe() map[model.TableID]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	descriptions := make(map[model.TableID]string, len(t.tables))
+	for tableID, conflicts := range t.tables {
+		desc := fmt.Sprintf("deadlocks: %d, lock-wait-timeouts: %d", conflicts.deadlocks, conflicts.lockWaitTimeouts)
+		if !conflicts.serializedAt.IsZero() {
+			desc += ", serialized since " + conflicts.serializedAt.Format("2006-01-02 15:04:05.000")
+		}
+		descriptions[tableID] = desc
+	}
+	return descriptions
+}
+
+// close deletes the per table conflict metrics
+func (t *conflictTracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, conflicts := range t.tables {
+		tableConflictCounter.DeleteLabelValues(t.captureAddr, t.changefeedID, conflicts.table, conflictDeadlock)
+		tableConflictCounter.DeleteLabelValues(t.captureAddr, t.changefeedID, conflicts.table, conflictLockWaitTimeout)
+	}
+	t.tables = make(map[model.TableID]*tableConflicts)
+	serializedTablesGauge.DeleteLabelValues(t.captureAddr, t.changefeedID)
+}
@@ -0,0 +1,254 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	dmysql "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/notify"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type conflictSuite struct{}
+
+var _ = check.Suite(&conflictSuite{})
+
+func (s *conflictSuite) TestParseConflictParams(c *check.C) {
+	defer testleak.AfterTest(c)()
+	uri, err := url.Parse("mysql://127.0.0.1:3306/?adaptive-concurrency=true&conflict-threshold=3&conflict-cooldown=30s")
+	c.Assert(err, check.IsNil)
+	params, err := parseSinkURI(context.TODO(), uri, map[string]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(params.adaptiveConcurrency, check.IsTrue)
+	c.Assert(params.conflictThreshold, check.Equals, 3)
+	c.Assert(params.conflictCooldown, check.Equals, 30*time.Second)
+
+	for _, query := range []string{"conflict-threshold=0", "conflict-cooldown=-1s", "adaptive-concurrency=yes!"} {
+		uri, err := url.Parse("mysql://127.0.0.1:3306/?" + query)
+		c.Assert(err, check.IsNil)
+		_, err = parseSinkURI(context.TODO(), uri, map[string]string{})
+		c.Assert(err, check.NotNil, check.Commentf("%s", query))
+	}
+}
+
+func newConflictTestTxns(tableID model.TableID, n int) []*model.SingleTableTxn {
+	table := &model.TableName{Schema: "s1", Table: "t" + strconv.Itoa(int(tableID)), TableID: tableID}
+	txns := make([]*model.SingleTableTxn, 0, n)
+	for i := 0; i < n; i++ {
+		ts := uint64(i + 1)
+		txns = append(txns, &model.SingleTableTxn{
+			Table:    table,
+			StartTs:  ts - 1,
+			CommitTs: ts,
+			Rows: []*model.RowChangedEvent{{
+				Table:    table,
+				StartTs:  ts - 1,
+				CommitTs: ts,
+				Columns: []*model.Column{
+					{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: i},
+				},
+				IndexColumns: [][]int{{0}},
+			}},
+		})
+	}
+	return txns
+}
+
+// dispatchConflictTestTxns dispatches the txns of the tables, which have no
+// conflict with each other, to the workers, and returns the buckets of the
+// workers executing the txns of each table.
+func dispatchConflictTestTxns(
+	c *check.C, workerCount int, serializedTables map[model.TableID]struct{}, tableIDs ...model.TableID,
+) map[model.TableID]map[int]struct{} {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifier := new(notify.Notifier)
+	defer notifier.Close()
+
+	var mu sync.Mutex
+	buckets := make(map[model.TableID]map[int]struct{})
+	execDMLs := func(ctx context.Context, rows []*model.RowChangedEvent, replicaID uint64, bucket int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, row := range rows {
+			if buckets[row.Table.TableID] == nil {
+				buckets[row.Table.TableID] = make(map[int]struct{})
+			}
+			buckets[row.Table.TableID][bucket] = struct{}{}
+		}
+		return nil
+	}
+	counters := make([]prometheus.Counter, workerCount)
+	for i := range counters {
+		counters[i] = bucketSizeCounter.WithLabelValues("capture", "changefeed", strconv.Itoa(i))
+	}
+	workers, err := startSinkWorkers(ctx, txnBatchLimit{maxRows: 1}, counters, notifier, execDMLs, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+
+	txnsGroup := make(map[model.TableID][]*model.SingleTableTxn)
+	for _, tableID := range tableIDs {
+		txnsGroup[tableID] = newConflictTestTxns(tableID, 32)
+	}
+	dispatchAndExecTxns(ctx, txnsGroup, workers, notifier,
+		conflictDetectDurationHis.WithLabelValues("capture", "changefeed"), serializedTables)
+	mu.Lock()
+	defer mu.Unlock()
+	return buckets
+}
+
+func (s *conflictSuite) TestSerializeConflictingTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	rows := []*model.RowChangedEvent{{
+		Table:    &model.TableName{Schema: "s1", Table: "t1", TableID: 1},
+		StartTs:  1,
+		CommitTs: 2,
+		Columns: []*model.Column{
+			{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+		},
+	}}
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		// the txn of the table hits a deadlock and a lock wait timeout before
+		// it succeeds by the retries
+		for _, number := range []uint16{mysql.ErrLockDeadlock, mysql.ErrLockWaitTimeout} {
+			mock.ExpectBegin()
+			mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`) VALUES (?)").
+				WithArgs(1).
+				WillReturnError(&dmysql.MySQLError{Number: number})
+			mock.ExpectRollback()
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`) VALUES (?)").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=4" +
+		"&adaptive-concurrency=true&conflict-threshold=2&conflict-cooldown=1m")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	sink, err := newMySQLSink(ctx, "conflict-changefeed", sinkURI, f, rc, map[string]string{})
+	c.Assert(err, check.IsNil)
+	ms := sink.(*mysqlSink)
+	now := time.Now()
+	ms.conflicts.now = func() time.Time { return now }
+
+	err = ms.execDMLs(ctx, rows, 1 /* replicaID */, 0 /* bucket */)
+	c.Assert(err, check.IsNil)
+	c.Assert(testutil.ToFloat64(ms.conflicts.tables[1].deadlockCounter), check.Equals, float64(1))
+	c.Assert(testutil.ToFloat64(ms.conflicts.tables[1].lockWaitTimeoutCounter), check.Equals, float64(1))
+	c.Assert(testutil.ToFloat64(ms.conflicts.serializedGauge), check.Equals, float64(1))
+	conflicts := ms.TableConflicts()
+	c.Assert(conflicts, check.HasLen, 1)
+	c.Assert(strings.HasPrefix(conflicts[1], "deadlocks: 1, lock-wait-timeouts: 1, serialized since "), check.IsTrue,
+		check.Commentf("%s", conflicts[1]))
+
+	// the txns of the conflicting table are executed by one worker, and the
+	// other table keeps the full concurrency
+	serialized := ms.conflicts.serializedTables()
+	c.Assert(serialized, check.DeepEquals, map[model.TableID]struct{}{1: {}})
+	buckets := dispatchConflictTestTxns(c, 4, serialized, 1, 2)
+	c.Assert(buckets[1], check.HasLen, 1)
+	c.Assert(buckets[2], check.HasLen, 4)
+
+	// the table is restored after the cool-down without any conflict
+	now = now.Add(30 * time.Second)
+	c.Assert(ms.conflicts.serializedTables(), check.HasLen, 1)
+	now = now.Add(30 * time.Second)
+	c.Assert(ms.conflicts.serializedTables(), check.HasLen, 0)
+	c.Assert(testutil.ToFloat64(ms.conflicts.serializedGauge), check.Equals, float64(0))
+	c.Assert(ms.TableConflicts()[1], check.Equals, "deadlocks: 1, lock-wait-timeouts: 1")
+	buckets = dispatchConflictTestTxns(c, 4, ms.conflicts.serializedTables(), 1, 2)
+	c.Assert(len(buckets[1]) > 1, check.IsTrue)
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *conflictSuite) TestConflictWindow(c *check.C) {
+	defer testleak.AfterTest(c)()
+	params := defaultParams.Clone()
+	params.adaptiveConcurrency = true
+	params.conflictThreshold = 2
+	tracker := newConflictTracker(params)
+	defer tracker.close()
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+	rows := []*model.RowChangedEvent{
+		{Table: &model.TableName{Schema: "s1", Table: "t1", TableID: 1}},
+		{Table: &model.TableName{Schema: "s1", Table: "t2", TableID: 2}},
+		{Table: &model.TableName{Schema: "s1", Table: "t1", TableID: 1}},
+	}
+
+	// the conflicts of the merged txns are counted for each table once, and
+	// the conflicts in different windows don't serialize the tables
+	tracker.record(rows, conflictDeadlock)
+	c.Assert(tracker.tables[1].deadlocks, check.Equals, uint64(1))
+	c.Assert(tracker.tables[2].deadlocks, check.Equals, uint64(1))
+	now = now.Add(conflictWindow)
+	tracker.record(rows[:1], conflictLockWaitTimeout)
+	c.Assert(tracker.serializedTables(), check.HasLen, 0)
+	tracker.record(rows[:1], conflictLockWaitTimeout)
+	c.Assert(tracker.serializedTables(), check.DeepEquals, map[model.TableID]struct{}{1: {}})
+
+	// the tables are never serialized if the adaptive mode is disabled
+	params.adaptiveConcurrency = false
+	tracker = newConflictTracker(params)
+	defer tracker.close()
+	for i := 0; i < 10; i++ {
+		tracker.record(rows, conflictDeadlock)
+	}
+	c.Assert(tracker.serializedTables(), check.HasLen, 0)
+	c.Assert(tracker.tables[1].deadlocks, check.Equals, uint64(10))
+}
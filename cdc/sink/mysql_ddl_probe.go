@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/quotes"
+)
+
+// tableExistsQuery counts the table in the downstream
+const tableExistsQuery = "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+
+// IsIdempotentDDL returns whether the DDL of the type can be executed again by
+// the downstream after it's executed. The DDLs are executed at the barrier,
+// where no row after them is written, and the errors of the DDLs executed
+// twice, e.g. the table exists, are ignored by the MySQL sink. So only the
+// DDLs whose second execution changes the downstream again are not idempotent.
+func IsIdempotentDDL(tp timodel.ActionType) bool {
+	switch tp {
+	case timodel.ActionRenameTable, timodel.ActionRenameTables, timodel.ActionExchangeTablePartition:
+		return false
+	}
+	return true
+}
+
+// ProbeDDLExecution implements the DDLExecutionProber interface, the renamed
+// table is executed if the table of the new name exists and the table of the
+// old name doesn't. The other DDLs which are not idempotent can't be probed.
+func (s *mysqlSink) ProbeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error) {
+	if ddl.Type != timodel.ActionRenameTable || ddl.PreTableInfo == nil {
+		return false, cerror.ErrDDLExecutionUnknown.GenWithStackByArgs(ddl.Query, "the schema of the downstream can't tell it")
+	}
+	oldExists, err := s.tableExists(ctx, ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	newExists, err := s.tableExists(ctx, ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	switch {
+	case newExists && !oldExists:
+		return true, nil
+	case oldExists && !newExists:
+		return false, nil
+	}
+	return false, cerror.ErrDDLExecutionUnknown.GenWithStackByArgs(ddl.Query,
+		"the table "+quotes.QuoteSchema(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)+" and "+
+			quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table)+" both exist or both don't exist")
+}
+
+func (s *mysqlSink) tableExists(ctx context.Context, schema, table string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, tableExistsQuery, schema, table).Scan(&count)
+	if err != nil {
+		return false, cerror.WrapError(cerror.ErrMySQLQueryError, err)
+	}
+	return count > 0, nil
+}
+
+// ProbeDDLExecution implements the DDLExecutionProber interface, the DDL is
+// probed in the target it's executed in.
+func (s *mysqlTargetsSink) ProbeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error) {
+	if ddl.TableInfo.Table == "" {
+		return false, cerror.ErrDDLExecutionUnknown.GenWithStackByArgs(ddl.Query, "the schema of the downstream can't tell it")
+	}
+	target, err := s.router.route(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return s.targets[target].ProbeDDLExecution(ctx, ddl)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlProbeSuite struct{}
+
+var _ = check.Suite(&ddlProbeSuite{})
+
+func (s *ddlProbeSuite) TestIsIdempotentDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	for _, tp := range []timodel.ActionType{
+		timodel.ActionCreateSchema, timodel.ActionCreateTable, timodel.ActionDropTable,
+		timodel.ActionAddColumn, timodel.ActionAddIndex, timodel.ActionTruncateTable,
+	} {
+		c.Assert(IsIdempotentDDL(tp), check.IsTrue, check.Commentf("%s", tp))
+	}
+	for _, tp := range []timodel.ActionType{
+		timodel.ActionRenameTable, timodel.ActionRenameTables, timodel.ActionExchangeTablePartition,
+	} {
+		c.Assert(IsIdempotentDDL(tp), check.IsFalse, check.Commentf("%s", tp))
+	}
+}
+
+func (s *ddlProbeSuite) TestMySQLProbeRenameTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	ctx := context.Background()
+	sink := &mysqlTargetsSink{targets: []*mysqlSink{{db: db}}}
+	ddl := &model.DDLEvent{
+		Type:         timodel.ActionRenameTable,
+		Query:        "RENAME TABLE `test`.`t1` TO `test`.`t2`",
+		PreTableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+		TableInfo:    &model.SimpleTableInfo{Schema: "test", Table: "t2"},
+	}
+	expectTables := func(oldCount, newCount int) {
+		mock.ExpectQuery(tableExistsQuery).WithArgs("test", "t1").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(oldCount))
+		mock.ExpectQuery(tableExistsQuery).WithArgs("test", "t2").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(newCount))
+	}
+
+	expectTables(0, 1)
+	executed, err := sink.ProbeDDLExecution(ctx, ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(executed, check.IsTrue)
+
+	expectTables(1, 0)
+	executed, err = sink.ProbeDDLExecution(ctx, ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(executed, check.IsFalse)
+
+	// the tables of both names exist, e.g. a table of the old name is
+	// created after the rename
+	expectTables(1, 1)
+	_, err = sink.ProbeDDLExecution(ctx, ddl)
+	c.Assert(cerror.ErrDDLExecutionUnknown.Equal(err), check.IsTrue, check.Commentf("%v", err))
+
+	mock.ExpectQuery(tableExistsQuery).WithArgs("test", "t1").WillReturnError(sql.ErrConnDone)
+	_, err = sink.ProbeDDLExecution(ctx, ddl)
+	c.Assert(err, check.ErrorMatches, ".*ErrMySQLQueryError.*connection is already closed")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the other DDLs which are not idempotent can't be probed
+	_, err = sink.ProbeDDLExecution(ctx, &model.DDLEvent{
+		Type:      timodel.ActionExchangeTablePartition,
+		Query:     "ALTER TABLE `t1` EXCHANGE PARTITION `p0` WITH TABLE `t2`",
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t1"},
+	})
+	c.Assert(cerror.ErrDDLExecutionUnknown.Equal(err), check.IsTrue, check.Commentf("%v", err))
+}
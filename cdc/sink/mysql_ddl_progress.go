@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+const (
+	// ddlProcessListQuery finds the DDL in the process list of the downstream
+	ddlProcessListQuery = "SELECT TIME, STATE FROM information_schema.PROCESSLIST WHERE INFO = ? LIMIT 1"
+	// ddlStageQuery reads the work done by the current stage of the DDL, it's
+	// reported by MySQL for the InnoDB ALTER TABLE if the stage events of the
+	// performance schema are enabled
+	ddlStageQuery = "SELECT stage.EVENT_NAME, stage.WORK_COMPLETED, stage.WORK_ESTIMATED " +
+		"FROM performance_schema.events_stages_current stage " +
+		"JOIN performance_schema.threads thread ON stage.THREAD_ID = thread.THREAD_ID " +
+		"WHERE thread.PROCESSLIST_INFO = ? LIMIT 1"
+)
+
+// DDLProgress implements the DDLProgressReporter interface, it's empty if the
+// DDL is not in the process list of the downstream.
+func (s *mysqlSink) DDLProgress(ctx context.Context, ddl *model.DDLEvent) (string, error) {
+	var (
+		seconds sql.NullInt64
+		state   sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, ddlProcessListQuery, ddl.Query).Scan(&seconds, &state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", cerror.WrapError(cerror.ErrMySQLQueryError, err)
+	}
+	progress := fmt.Sprintf("running for %ds in the downstream", seconds.Int64)
+	if state.String != "" {
+		progress += ", state: " + state.String
+	}
+
+	var (
+		stage     sql.NullString
+		completed sql.NullInt64
+		estimated sql.NullInt64
+	)
+	// the performance schema may be disabled, or not supported by the
+	// downstream, the stage is optional
+	err = s.db.QueryRowContext(ctx, ddlStageQuery, ddl.Query).Scan(&stage, &completed, &estimated)
+	if err == nil && estimated.Int64 > 0 {
+		progress += fmt.Sprintf(", stage: %s %d/%d (%.1f%%)", stage.String, completed.Int64, estimated.Int64,
+			float64(completed.Int64)*100/float64(estimated.Int64))
+	}
+	return progress, nil
+}
+
+// DDLProgress implements the DDLProgressReporter interface, the DDL of a table
+// is executed in the target of the table, and the DDL of a schema is executed
+// in all the targets.
+func (s *mysqlTargetsSink) DDLProgress(ctx context.Context, ddl *model.DDLEvent) (string, error) {
+	targets := s.targets
+	if ddl.TableInfo.Table != "" {
+		target, err := s.router.route(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		targets = s.targets[target : target+1]
+	}
+	for _, target := range targets {
+		progress, err := target.DDLProgress(ctx, ddl)
+		if err != nil || progress != "" {
+			return progress, err
+		}
+	}
+	return "", nil
+}
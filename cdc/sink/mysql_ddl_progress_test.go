@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type ddlProgressSuite struct{}
+
+var _ = check.Suite(&ddlProgressSuite{})
+
+func (s *ddlProgressSuite) TestMySQLDDLProgress(c *check.C) {
+	defer testleak.AfterTest(c)()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, check.IsNil)
+	defer db.Close() //nolint:errcheck
+	ctx := context.Background()
+	sink := &mysqlTargetsSink{targets: []*mysqlSink{{db: db}}}
+	ddl := &model.DDLEvent{
+		Query:     "ALTER TABLE `t` ADD INDEX `idx`(`a`)",
+		TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "t"},
+	}
+
+	// the DDL is finished or not started
+	mock.ExpectQuery(ddlProcessListQuery).WithArgs(ddl.Query).WillReturnError(sql.ErrNoRows)
+	progress, err := sink.DDLProgress(ctx, ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(progress, check.Equals, "")
+
+	// the stage is not reported
+	mock.ExpectQuery(ddlProcessListQuery).WithArgs(ddl.Query).
+		WillReturnRows(sqlmock.NewRows([]string{"TIME", "STATE"}).AddRow(120, "altering table"))
+	mock.ExpectQuery(ddlStageQuery).WithArgs(ddl.Query).WillReturnError(sql.ErrNoRows)
+	progress, err = sink.DDLProgress(ctx, ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(progress, check.Equals, "running for 120s in the downstream, state: altering table")
+
+	mock.ExpectQuery(ddlProcessListQuery).WithArgs(ddl.Query).
+		WillReturnRows(sqlmock.NewRows([]string{"TIME", "STATE"}).AddRow(3600, nil))
+	mock.ExpectQuery(ddlStageQuery).WithArgs(ddl.Query).
+		WillReturnRows(sqlmock.NewRows([]string{"EVENT_NAME", "WORK_COMPLETED", "WORK_ESTIMATED"}).
+			AddRow("stage/innodb/alter table (read PK and internal sort)", 25, 100))
+	progress, err = sink.DDLProgress(ctx, ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(progress, check.Equals,
+		"running for 3600s in the downstream, stage: stage/innodb/alter table (read PK and internal sort) 25/100 (25.0%)")
+
+	mock.ExpectQuery(ddlProcessListQuery).WithArgs(ddl.Query).WillReturnError(sql.ErrConnDone)
+	_, err = sink.DDLProgress(ctx, ddl)
+	c.Assert(err, check.ErrorMatches, ".*ErrMySQLQueryError.*connection is already closed")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
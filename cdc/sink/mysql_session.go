@@ -0,0 +1,177 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	dmysql "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// sessionVariablePrefix is the prefix of sink URI parameters which are set as
+// session variables of every downstream connection, for example,
+// `session-tidb_constraint_check_in_place=1`.
+const sessionVariablePrefix = "session-"
+
+var (
+	sessionVariableNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// reservedSessionVariableNames are the parameters of the go mysql driver,
+	// they are not sent to the downstream as session variables if passed
+	// in the DSN, so we reject them to avoid confusion.
+	reservedSessionVariableNames = map[string]struct{}{
+		"allowallfiles": {}, "allowcleartextpasswords": {}, "allownativepasswords": {},
+		"allowoldpasswords": {}, "charset": {}, "checkconnliveness": {}, "clientfoundrows": {},
+		"collation": {}, "columnswithalias": {}, "interpolateparams": {}, "loc": {},
+		"maxallowedpacket": {}, "multistatements": {}, "parsetime": {}, "readtimeout": {},
+		"rejectreadonly": {}, "serverpubkey": {}, "timeout": {}, "tls": {}, "writetimeout": {},
+	}
+
+	// sensitiveSessionVariableKeywords are the keywords of session variable
+	// names whose values are masked when displayed.
+	sensitiveSessionVariableKeywords = []string{"password", "secret", "token"}
+)
+
+// sessionVariable is a session variable set on every downstream connection,
+// the value is already quoted if it's not a number.
+type sessionVariable struct {
+	name  string
+	value string
+}
+
+func (v sessionVariable) setSQL() string {
+	return fmt.Sprintf("SET SESSION %s = %s", v.name, v.value)
+}
+
+// parseSessionVariables extracts the session variables from the sink URI
+// parameters, the result is sorted by variable name.
+func parseSessionVariables(query url.Values) ([]sessionVariable, error) {
+	var vars []sessionVariable
+	for key := range query {
+		if !strings.HasPrefix(key, sessionVariablePrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, sessionVariablePrefix)
+		if !sessionVariableNameRe.MatchString(name) {
+			return nil, cerror.ErrInvalidSessionVariable.GenWithStackByArgs(name, "invalid name")
+		}
+		if _, ok := reservedSessionVariableNames[strings.ToLower(name)]; ok {
+			return nil, cerror.ErrInvalidSessionVariable.GenWithStackByArgs(
+				name, "it's a parameter of the mysql driver")
+		}
+		value, err := quoteSessionVariableValue(name, query.Get(key))
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, sessionVariable{name: name, value: value})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].name < vars[j].name })
+	return vars, nil
+}
+
+// quoteSessionVariableValue returns the value as it is if it's a number,
+// otherwise returns the value quoted as a string literal. Values which can't
+// be quoted safely without escaping are rejected.
+func quoteSessionVariableValue(name, value string) (string, error) {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, nil
+	}
+	for _, r := range value {
+		if r == '\'' || r == '\\' || r < 0x20 || r == 0x7f {
+			return "", cerror.ErrInvalidSessionVariable.GenWithStackByArgs(
+				name, fmt.Sprintf("unsupported character %q in value %q", r, value))
+		}
+	}
+	return "'" + value + "'", nil
+}
+
+// SessionVariables returns the session variables configured in the sink URI,
+// the values of sensitive variables are masked.
+func SessionVariables(sinkURIStr string) map[string]string {
+	sinkURI, err := url.Parse(sinkURIStr)
+	if err != nil {
+		return nil
+	}
+	if _, ok := validSchemes[strings.ToLower(sinkURI.Scheme)]; !ok {
+		return nil
+	}
+	vars, err := parseSessionVariables(sinkURI.Query())
+	if err != nil || len(vars) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(vars))
+	for _, v := range vars {
+		res[v.name] = v.value
+		lowerName := strings.ToLower(v.name)
+		for _, keyword := range sensitiveSessionVariableKeywords {
+			if strings.Contains(lowerName, keyword) {
+				res[v.name] = "******"
+				break
+			}
+		}
+	}
+	return res
+}
+
+// sessionConnector sets the session variables on every connection created by
+// the underlying connector, including the connections re-established after
+// the old ones are broken.
+type sessionConnector struct {
+	driver.Connector
+	sessionVariables []sessionVariable
+}
+
+func newSessionConnector(connector driver.Connector, vars []sessionVariable) driver.Connector {
+	if len(vars) == 0 {
+		return connector
+	}
+	return &sessionConnector{Connector: connector, sessionVariables: vars}
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, cerror.ErrMySQLInvalidConfig.GenWithStack("the connection doesn't support setting session variables")
+	}
+	for _, v := range c.sessionVariables {
+		_, err := execer.ExecContext(ctx, v.setSQL(), nil)
+		if err != nil {
+			_ = conn.Close()
+			if errors.Cause(err) == driver.ErrBadConn {
+				// the connection is broken, let the pool retry with a new one
+				return nil, err
+			}
+			if _, ok := errors.Cause(err).(*dmysql.MySQLError); ok {
+				// the variable or its value is rejected by the downstream
+				return nil, cerror.ErrInvalidSessionVariable.GenWithStackByArgs(v.name, err)
+			}
+			return nil, cerror.WrapError(cerror.ErrMySQLConnectionError, err)
+		}
+	}
+	return conn, nil
+}
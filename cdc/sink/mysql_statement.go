@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/parser"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the types of the statements executed in the downstream
+const (
+	statementInsert = "insert"
+	statementUpdate = "update"
+	statementDelete = "delete"
+	statementDDL    = "ddl"
+)
+
+const (
+	defaultSlowStatementThreshold = time.Second
+	// slowTablesTopK is the number of the tables spending the most time on
+	// executing the statements, which are printed in the sink status log.
+	slowTablesTopK = 5
+)
+
+// parseDMLStatement returns the statement type and the quoted table of the
+// DML generated by the MySQL sink, they're empty if the DML is not recognized.
+// The results are substrings of the query, so it doesn't allocate.
+func parseDMLStatement(query string) (typ string, table string) {
+	var rest string
+	switch {
+	case strings.HasPrefix(query, "REPLACE INTO "):
+		typ, rest = statementInsert, query[len("REPLACE INTO "):]
+	case strings.HasPrefix(query, "INSERT INTO "):
+		typ, rest = statementInsert, query[len("INSERT INTO "):]
+	case strings.HasPrefix(query, "UPDATE "):
+		typ, rest = statementUpdate, query[len("UPDATE "):]
+	case strings.HasPrefix(query, "DELETE FROM "):
+		typ, rest = statementDelete, query[len("DELETE FROM "):]
+	default:
+		return "", ""
+	}
+	// the table is quoted as `schema`.`table`, and the backquotes in the
+	// names are doubled
+	end := 0
+	for part := 0; part < 2; part++ {
+		if part == 1 {
+			if end >= len(rest) || rest[end] != '.' {
+				return "", ""
+			}
+			end++
+		}
+		if end >= len(rest) || rest[end] != '`' {
+			return "", ""
+		}
+		for end++; ; end++ {
+			if end >= len(rest) {
+				return "", ""
+			}
+			if rest[end] != '`' {
+				continue
+			}
+			if end+1 < len(rest) && rest[end+1] == '`' {
+				end++
+				continue
+			}
+			break
+		}
+		end++
+	}
+	return typ, rest[:end]
+}
+
+// fingerprint normalizes the statement without the values, and the value
+// lists of the batch statements are collapsed into one.
+func fingerprint(query string) string {
+	fp := parser.Normalize(query)
+	for strings.Contains(fp, "( ... ) , ( ... )") {
+		fp = strings.ReplaceAll(fp, "( ... ) , ( ... )", "( ... )")
+	}
+	return fp
+}
+
+type statementKey struct {
+	table string
+	typ   string
+}
+
+// statementStats records the executions of the statements of a table and
+// type. It's cached, so that the metrics and the fingerprint of the DMLs are
+// prepared once rather than for every statement.
+type statementStats struct {
+	table    string
+	typ      string
+	count    prometheus.Counter
+	duration prometheus.Observer
+
+	fingerprintOnce sync.Once
+	dmlFingerprint  string
+}
+
+// fingerprint returns the fingerprint of the statement, the fingerprint of
+// the DMLs of the table is computed once, since they have the same shape.
+func (s *statementStats) fingerprint(query string) string {
+	if s.typ == statementDDL {
+		return fingerprint(query)
+	}
+	s.fingerprintOnce.Do(func() {
+		s.dmlFingerprint = fingerprint(query)
+	})
+	return s.dmlFingerprint
+}
+
+// tableStatementSummary is the executions of the statements of a table since
+// the sink status is printed last time
+type tableStatementSummary struct {
+	table    string
+	count    int
+	slow     int
+	duration time.Duration
+}
+
+func (s *tableStatementSummary) String() string {
+	return fmt.Sprintf("%s: %d statements, %d slow, %s", s.table, s.count, s.slow, s.duration.Round(time.Millisecond))
+}
+
+// statementStatistics maintains the per table statement metrics of the sinks
+// executing statements in the downstream, and summarizes the tables spending
+// the most time on executing the statements in the sink status log.
+type statementStatistics struct {
+	captureAddr  string
+	changefeedID string
+
+	mu     sync.Mutex
+	stats  map[statementKey]*statementStats
+	tables map[string]*tableStatementSummary
+}
+
+func newStatementStatistics(captureAddr, changefeedID string) *statementStatistics {
+	return &statementStatistics{
+		captureAddr:  captureAddr,
+		changefeedID: changefeedID,
+		stats:        make(map[statementKey]*statementStats),
+		tables:       make(map[string]*tableStatementSummary),
+	}
+}
+
+// get returns the cached stats of the statements of the table and type
+func (s *statementStatistics) get(table, typ string) *statementStats {
+	key := statementKey{table: table, typ: typ}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.stats[key]; ok {
+		return stats
+	}
+	stats := &statementStats{
+		table:    table,
+		typ:      typ,
+		count:    tableStatementCounter.WithLabelValues(s.captureAddr, s.changefeedID, table, typ),
+		duration: tableStatementDurationHistogram.WithLabelValues(s.captureAddr, s.changefeedID, table, typ),
+	}
+	s.stats[key] = stats
+	return stats
+}
+
+// observe records an execution of the statement
+func (s *statementStatistics) observe(stats *statementStats, duration time.Duration, slow bool) {
+	stats.count.Inc()
+	stats.duration.Observe(duration.Seconds())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary, ok := s.tables[stats.table]
+	if !ok {
+		summary = &tableStatementSummary{table: stats.table}
+		s.tables[stats.table] = summary
+	}
+	summary.count++
+	summary.duration += duration
+	if slow {
+		summary.slow++
+	}
+}
+
+// slowTables returns the summaries of the k tables spending the most time on
+// executing the statements since the last call
+func (s *statementStatistics) slowTables(k int) []string {
+	s.mu.Lock()
+	summaries := make([]*tableStatementSummary, 0, len(s.tables))
+	for _, summary := range s.tables {
+		summaries = append(summaries, summary)
+	}
+	s.tables = make(map[string]*tableStatementSummary, len(summaries))
+	s.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].duration != summaries[j].duration {
+			return summaries[i].duration > summaries[j].duration
+		}
+		return summaries[i].table < summaries[j].table
+	})
+	if len(summaries) > k {
+		summaries = summaries[:k]
+	}
+	tables := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		tables = append(tables, summary.String())
+	}
+	return tables
+}
+
+// close deletes the per table statement metrics
+func (s *statementStatistics) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.stats {
+		tableStatementCounter.DeleteLabelValues(s.captureAddr, s.changefeedID, key.table, key.typ)
+		tableStatementDurationHistogram.DeleteLabelValues(s.captureAddr, s.changefeedID, key.table, key.typ)
+	}
+	s.stats = make(map[statementKey]*statementStats)
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap/zapcore"
+)
+
+type statementSuite struct{}
+
+var _ = check.Suite(&statementSuite{})
+
+func (s *statementSuite) TestParseDMLStatement(c *check.C) {
+	defer testleak.AfterTest(c)()
+	for _, tc := range []struct {
+		query string
+		typ   string
+		table string
+	}{
+		{"REPLACE INTO `s1`.`t1`(`a`) VALUES (?),(?)", statementInsert, "`s1`.`t1`"},
+		{"INSERT INTO `s1`.`t1`(`a`) VALUES (?);", statementInsert, "`s1`.`t1`"},
+		{"UPDATE `s``1`.`t.1` SET `a`=? WHERE `a`=? LIMIT 1;", statementUpdate, "`s``1`.`t.1`"},
+		{"DELETE FROM `s1`.```t1``` WHERE `a` = ? LIMIT 1;", statementDelete, "`s1`.```t1```"},
+		{"DELETE FROM `s1` WHERE `a` = ? LIMIT 1;", "", ""},
+		{"UPDATE `s1`.`t1", "", ""},
+		{"USE `s1`;", "", ""},
+	} {
+		typ, table := parseDMLStatement(tc.query)
+		c.Assert(typ, check.Equals, tc.typ, check.Commentf("%s", tc.query))
+		c.Assert(table, check.Equals, tc.table, check.Commentf("%s", tc.query))
+	}
+
+	// the value lists of the batch statements are collapsed
+	c.Assert(fingerprint("REPLACE INTO `s1`.`t1`(`a`,`b`) VALUES (?,?),(?,?),(?,?)"), check.Equals,
+		"replace into s1 . t1 ( a , b ) values ( ... )")
+	c.Assert(fingerprint("ALTER TABLE s1.t1 ADD COLUMN c int DEFAULT 10"), check.Equals,
+		"alter table s1 . t1 add column c int default ?")
+
+	// the fingerprint of the DMLs is cached, and the DDLs are not
+	stats := &statementStats{typ: statementUpdate}
+	c.Assert(stats.fingerprint("UPDATE `s1`.`t1` SET `a`=? WHERE `a`=? LIMIT 1;"), check.Equals,
+		"update s1 . t1 set a = ? where a = ? limit ? ;")
+	c.Assert(stats.fingerprint("UPDATE `s1`.`t1` SET `b`=? WHERE `a`=? LIMIT 1;"), check.Equals,
+		"update s1 . t1 set a = ? where a = ? limit ? ;")
+	stats = &statementStats{typ: statementDDL}
+	c.Assert(stats.fingerprint("DROP TABLE t1"), check.Equals, "drop table t1")
+	c.Assert(stats.fingerprint("DROP TABLE t2"), check.Equals, "drop table t2")
+}
+
+func (s *statementSuite) TestSlowTables(c *check.C) {
+	defer testleak.AfterTest(c)()
+	statements := newStatementStatistics("127.0.0.1:8300", "test-slow-tables")
+	defer statements.close()
+
+	t1 := statements.get("`s1`.`t1`", statementInsert)
+	c.Assert(statements.get("`s1`.`t1`", statementInsert), check.Equals, t1)
+	statements.observe(t1, 100*time.Millisecond, true)
+	statements.observe(statements.get("`s1`.`t1`", statementDelete), 10*time.Millisecond, false)
+	statements.observe(statements.get("`s1`.`t2`", statementInsert), 300*time.Millisecond, true)
+	statements.observe(statements.get("`s1`.`t3`", statementUpdate), time.Millisecond, false)
+	c.Assert(testutil.ToFloat64(t1.count), check.Equals, float64(1))
+	c.Assert(sampleCount(c, t1.duration), check.Equals, uint64(1))
+
+	c.Assert(statements.slowTables(2), check.DeepEquals, []string{
+		"`s1`.`t2`: 1 statements, 1 slow, 300ms",
+		"`s1`.`t1`: 2 statements, 1 slow, 110ms",
+	})
+	// the summaries are reset after they're printed
+	c.Assert(statements.slowTables(2), check.HasLen, 0)
+}
+
+func (s MySQLSinkSuite) TestMySQLSinkSlowStatement(c *check.C) {
+	defer testleak.AfterTest(c)()
+	logs, restore := util.ObserveLogs(zapcore.WarnLevel)
+	defer restore()
+
+	ddlQuery := "ALTER TABLE s1.t1 ADD COLUMN b int DEFAULT 10"
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`) VALUES (?)").
+			WithArgs(1).
+			WillDelayFor(100 * time.Millisecond).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `s1`.`t1` WHERE `a` = ? LIMIT 1;").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("USE `s1`;").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(ddlQuery).
+			WillDelayFor(100 * time.Millisecond).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=1&slow-statement-threshold=50ms&transaction-atomicity=txn")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	sink, err := newMySQLSink(ctx, "test-changefeed", sinkURI, f, rc, map[string]string{})
+	c.Assert(err, check.IsNil)
+	statements := sink.(*mysqlSink).statistics.statements
+
+	cols := []*model.Column{
+		{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+	}
+	table := &model.TableName{Schema: "s1", Table: "t1", TableID: 1}
+	err = sink.EmitRowChangedEvents(ctx,
+		&model.RowChangedEvent{StartTs: 1, CommitTs: 2, Table: table, Columns: cols},
+		&model.RowChangedEvent{StartTs: 3, CommitTs: 4, Table: table, PreColumns: cols},
+	)
+	c.Assert(err, check.IsNil)
+	err = retry.Run(time.Millisecond*20, 20, func() error {
+		ts, err := FlushCheckpointTs(ctx, sink, uint64(4))
+		c.Assert(err, check.IsNil)
+		if ts < uint64(4) {
+			return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, 4)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	err = sink.EmitDDLEvent(ctx, &model.DDLEvent{
+		StartTs:   5,
+		CommitTs:  6,
+		TableInfo: &model.SimpleTableInfo{Schema: "s1", Table: "t1"},
+		Type:      timodel.ActionAddColumn,
+		Query:     ddlQuery,
+	})
+	c.Assert(err, check.IsNil)
+
+	// the statements are counted by table and type
+	for _, typ := range []string{statementInsert, statementDelete, statementDDL} {
+		stats := statements.get("`s1`.`t1`", typ)
+		c.Assert(testutil.ToFloat64(stats.count), check.Equals, float64(1), check.Commentf("%s", typ))
+		c.Assert(sampleCount(c, stats.duration), check.Equals, uint64(1), check.Commentf("%s", typ))
+	}
+
+	// the slow statements are logged with the fingerprints
+	entries := logs.FilterMessage("slow statement").All()
+	c.Assert(entries, check.HasLen, 2)
+	fields := entries[0].ContextMap()
+	c.Assert(fields["table"], check.Equals, "`s1`.`t1`")
+	c.Assert(fields["type"], check.Equals, statementInsert)
+	c.Assert(fields["fingerprint"], check.Equals, "replace into s1 . t1 ( a ) values ( ? )")
+	c.Assert(fields["batchSize"], check.Equals, int64(1))
+	c.Assert(fields["commitTs"], check.Equals, uint64(2))
+	fields = entries[1].ContextMap()
+	c.Assert(fields["type"], check.Equals, statementDDL)
+	c.Assert(fields["fingerprint"], check.Equals, "alter table s1 . t1 add column b int default ?")
+	c.Assert(fields["commitTs"], check.Equals, uint64(6))
+
+	tables := statements.slowTables(slowTablesTopK)
+	c.Assert(tables, check.HasLen, 1)
+	c.Assert(tables[0], check.Matches, "`s1`.`t1`: 3 statements, 2 slow, .*")
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
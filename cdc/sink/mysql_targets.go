@@ -0,0 +1,276 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	tifilter "github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/quotes"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	"go.uber.org/zap"
+)
+
+// mysqlTargetRouter routes the tables to the targets of the MySQL sink. The
+// target 0 is the sink uri of the changefeed, and the target i is the i-th
+// target rule in the sink config. A nil router means there is no target rule.
+type mysqlTargetRouter struct {
+	rules []filter.Filter
+	uris  []*url.URL
+
+	mu sync.Mutex
+	// tables caches the targets of the routed tables, keyed by the table
+	// names without the table IDs
+	tables map[model.TableName]int
+}
+
+// newMySQLTargetRouter creates a mysqlTargetRouter, nil is returned if there
+// is no target rule in the config.
+func newMySQLTargetRouter(cfg *config.ReplicaConfig) (*mysqlTargetRouter, error) {
+	if cfg.Sink == nil || len(cfg.Sink.Targets) == 0 {
+		return nil, nil
+	}
+	r := &mysqlTargetRouter{tables: make(map[model.TableName]int)}
+	for i, rule := range cfg.Sink.Targets {
+		if len(rule.Matcher) == 0 {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack("the matcher of target %d is empty", i+1)
+		}
+		f, err := filter.Parse(rule.Matcher)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if !cfg.CaseSensitive {
+			f = filter.CaseInsensitive(f)
+		}
+		uri, err := url.Parse(rule.SinkURI)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrSinkURIInvalid, err)
+		}
+		if !validSchemes[strings.ToLower(uri.Scheme)] {
+			return nil, cerror.ErrMySQLInvalidConfig.GenWithStack(
+				"the scheme (%s) of target %d is not supported, it must be a MySQL sink uri", uri.Scheme, i+1)
+		}
+		r.rules = append(r.rules, f)
+		r.uris = append(r.uris, uri)
+	}
+	return r, nil
+}
+
+// route returns the target of the table, the tables which don't match any
+// target rule are routed to target 0. ErrSinkTargetConflict is returned if
+// the table matches more than one target rule.
+func (r *mysqlTargetRouter) route(schema, table string) (int, error) {
+	if r == nil {
+		return 0, nil
+	}
+	key := model.TableName{Schema: schema, Table: table}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if target, ok := r.tables[key]; ok {
+		return target, nil
+	}
+	target := 0
+	for i, rule := range r.rules {
+		if !rule.MatchTable(schema, table) {
+			continue
+		}
+		if target != 0 {
+			return 0, cerror.ErrSinkTargetConflict.GenWithStackByArgs(quotes.QuoteSchema(schema, table),
+				fmt.Sprintf("it matches both target %d and target %d", target, i+1))
+		}
+		target = i + 1
+	}
+	r.tables[key] = target
+	return target, nil
+}
+
+// CheckTableTargets checks whether any of the tables matches more than one
+// target rule of the MySQL sink, which is done on creating a changefeed.
+func CheckTableTargets(cfg *config.ReplicaConfig, tables []model.TableName) error {
+	r, err := newMySQLTargetRouter(cfg)
+	if err != nil || r == nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err := r.route(table.Schema, table.Table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mysqlTargetsSink writes the tables to the targets routed by the target
+// rules, each target is written by a MySQL sink with its own connection pool
+// and workers. The rows are flushed by the minimum flushed ts of the targets,
+// and an error of any target fails the whole sink.
+type mysqlTargetsSink struct {
+	router     *mysqlTargetRouter
+	targets    []*mysqlSink
+	statistics *Statistics
+}
+
+// newMySQLTargetsSink creates the MySQL sink of the changefeed, a plain MySQL
+// sink is created if there is no target rule.
+func newMySQLTargetsSink(
+	ctx context.Context,
+	changefeedID model.ChangeFeedID,
+	sinkURI *url.URL,
+	filter *tifilter.Filter,
+	replicaConfig *config.ReplicaConfig,
+	opts map[string]string,
+) (Sink, error) {
+	router, err := newMySQLTargetRouter(replicaConfig)
+	if err != nil {
+		return nil, err
+	}
+	if router == nil {
+		return newMySQLSink(ctx, changefeedID, sinkURI, filter, replicaConfig, opts)
+	}
+	if replicaConfig.Cyclic.IsEnabled() {
+		return nil, cerror.ErrMySQLInvalidConfig.GenWithStack("the cyclic replication is not supported with the targets")
+	}
+	opts[OptChangefeedID] = changefeedID
+	s := &mysqlTargetsSink{
+		router:     router,
+		statistics: NewStatistics(ctx, "mysql", opts),
+	}
+	for i, uri := range append([]*url.URL{sinkURI}, router.uris...) {
+		target, err := createMySQLSink(ctx, changefeedID, uri, filter, replicaConfig, opts, s.statistics)
+		if err != nil {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Warn("close the MySQL sink of the targets failed", zap.Error(closeErr))
+			}
+			return nil, errors.Annotatef(err, "fail to create the MySQL sink of target %d", i)
+		}
+		s.targets = append(s.targets, target)
+	}
+	log.Info("Start mysql sink with targets",
+		zap.String("changefeed", changefeedID), zap.Int("targets", len(router.uris)))
+	return s, nil
+}
+
+// Initialize is no-op for Mysql sink
+func (s *mysqlTargetsSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
+	return nil
+}
+
+func (s *mysqlTargetsSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	groups := make([][]*model.RowChangedEvent, len(s.targets))
+	var last *model.TableName
+	target := 0
+	for _, row := range rows {
+		if last == nil || *last != *row.Table {
+			var err error
+			target, err = s.router.route(row.Table.Schema, row.Table.Table)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			last = row.Table
+		}
+		groups[target] = append(groups[target], row)
+	}
+	for i, rows := range groups {
+		if len(rows) == 0 {
+			continue
+		}
+		if err := s.targets[i].EmitRowChangedEvents(ctx, rows...); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// EmitDDLEvent executes the DDL in the target of the table, the DDLs of the
+// schemas are executed in all the targets, so that the schemas exist before
+// the tables are created in them.
+func (s *mysqlTargetsSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	if ddl.TableInfo.Table == "" {
+		for _, target := range s.targets {
+			// the ignored DDL is ignored by all the targets
+			if err := target.EmitDDLEvent(ctx, ddl); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
+	target, err := s.router.route(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ddl.PreTableInfo != nil && ddl.PreTableInfo.Table != "" {
+		preTarget, err := s.router.route(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if preTarget != target {
+			return cerror.ErrSinkTargetConflict.GenWithStackByArgs(
+				quotes.QuoteSchema(ddl.TableInfo.Schema, ddl.TableInfo.Table),
+				fmt.Sprintf("it's renamed from %s of target %d to target %d",
+					quotes.QuoteSchema(ddl.PreTableInfo.Schema, ddl.PreTableInfo.Table), preTarget, target))
+		}
+	}
+	return errors.Trace(s.targets[target].EmitDDLEvent(ctx, ddl))
+}
+
+func (s *mysqlTargetsSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	checkpointTs := resolvedTs
+	for _, target := range s.targets {
+		flushedTs, err := target.flushedTs(resolvedTs)
+		if err != nil {
+			return model.FlushResult{}, err
+		}
+		if flushedTs < checkpointTs {
+			checkpointTs = flushedTs
+		}
+	}
+	s.statistics.PrintStatus(ctx)
+	s.statistics.ObserveFlushedRows(checkpointTs)
+	// the targets share the statistics
+	return s.statistics.TakeFlushResult(checkpointTs), nil
+}
+
+func (s *mysqlTargetsSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
+	// do nothing
+	return nil
+}
+
+// CheckTableSchema implements the TableSchemaChecker interface
+func (s *mysqlTargetsSink) CheckTableSchema(ctx context.Context, table *model.TableInfo) error {
+	target, err := s.router.route(table.TableName.Schema, table.TableName.Table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return s.targets[target].CheckTableSchema(ctx, table)
+}
+
+func (s *mysqlTargetsSink) Close() error {
+	var firstErr error
+	for _, target := range s.targets {
+		if err := target.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+var _ Sink = &mysqlTargetsSink{}
@@ -0,0 +1,209 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type mysqlTargetsSuite struct{}
+
+var _ = check.Suite(&mysqlTargetsSuite{})
+
+func (s *mysqlTargetsSuite) TestRoute(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	r, err := newMySQLTargetRouter(cfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.IsNil)
+	target, err := r.route("s1", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, 0)
+
+	cfg.CaseSensitive = false
+	cfg.Sink.Targets = []*config.TargetRule{
+		{Matcher: []string{"s1.t2", "s2.*"}, SinkURI: "mysql://127.0.0.1:4001/"},
+		{Matcher: []string{"s3.*", "s2.a*"}, SinkURI: "tidb://127.0.0.1:4002/"},
+	}
+	r, err = newMySQLTargetRouter(cfg)
+	c.Assert(err, check.IsNil)
+	for _, tc := range []struct {
+		schema, table string
+		target        int
+	}{
+		{"s1", "t1", 0},
+		{"S1", "T2", 1},
+		{"s2", "t1", 1},
+		{"s3", "t1", 2},
+	} {
+		target, err := r.route(tc.schema, tc.table)
+		c.Assert(err, check.IsNil)
+		c.Assert(target, check.Equals, tc.target, check.Commentf("%s.%s", tc.schema, tc.table))
+	}
+	_, err = r.route("s2", "a1")
+	c.Assert(cerror.ErrSinkTargetConflict.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*`s2`.`a1`.*target 1 and target 2.*")
+
+	// the tables matching more than one target are rejected on creating
+	c.Assert(CheckTableTargets(cfg, []model.TableName{{Schema: "s1", Table: "t2"}, {Schema: "s3", Table: "t1"}}), check.IsNil)
+	err = CheckTableTargets(cfg, []model.TableName{{Schema: "s1", Table: "t2"}, {Schema: "s2", Table: "a1"}})
+	c.Assert(cerror.ErrSinkTargetConflict.Equal(err), check.IsTrue)
+
+	for _, rule := range []*config.TargetRule{
+		{SinkURI: "mysql://127.0.0.1:4001/"},
+		{Matcher: []string{"s1.t2"}, SinkURI: "kafka://127.0.0.1:9092/topic"},
+	} {
+		cfg.Sink.Targets = []*config.TargetRule{rule}
+		_, err = newMySQLTargetRouter(cfg)
+		c.Assert(cerror.ErrMySQLInvalidConfig.Equal(err), check.IsTrue, check.Commentf("%v", err))
+		err = ValidateConfig("mysql://127.0.0.1:4000/", cfg)
+		c.Assert(cerror.ErrMySQLInvalidConfig.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	}
+	cfg.Sink.Targets = []*config.TargetRule{{Matcher: []string{"s1.["}, SinkURI: "mysql://127.0.0.1:4001/"}}
+	_, err = newMySQLTargetRouter(cfg)
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrFilterRuleInvalid.*")
+}
+
+func (s *mysqlTargetsSuite) TestEmitToTargets(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// the test db is created before the normal db of each target
+	created := make(map[string]int)
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		addr := "127.0.0.1:4000"
+		if strings.Contains(dsnStr, "127.0.0.1:4001") {
+			addr = "127.0.0.1:4001"
+		}
+		defer func() {
+			created[addr]++
+		}()
+		if created[addr] == 0 {
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		table := "t1"
+		if addr == "127.0.0.1:4001" {
+			table = "t2"
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`" + table + "`(`a`) VALUES (?)").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE DATABASE s2").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		if addr == "127.0.0.1:4001" {
+			mock.ExpectBegin()
+			mock.ExpectExec("USE `s1`;").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec("ALTER TABLE s1.t2 ADD COLUMN b int").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+		}
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=4")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	rc.Sink.Targets = []*config.TargetRule{
+		{Matcher: []string{"s1.t2"}, SinkURI: "mysql://127.0.0.1:4001/?time-zone=UTC&worker-count=4"},
+	}
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	sink, err := newMySQLTargetsSink(ctx, "test-changefeed", sinkURI, f, rc, map[string]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(sink, check.FitsTypeOf, &mysqlTargetsSink{})
+
+	newRow := func(table string, tableID int64, commitTs uint64) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			StartTs:  commitTs - 1,
+			CommitTs: commitTs,
+			Table:    &model.TableName{Schema: "s1", Table: table, TableID: tableID},
+			Columns: []*model.Column{
+				{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+			},
+		}
+	}
+	err = sink.EmitRowChangedEvents(ctx, newRow("t1", 1, 2), newRow("t2", 2, 4))
+	c.Assert(err, check.IsNil)
+
+	// the checkpoint is the minimum flushed ts of the targets
+	err = retry.Run(time.Millisecond*20, 10, func() error {
+		ts, err := FlushCheckpointTs(ctx, sink, uint64(4))
+		c.Assert(err, check.IsNil)
+		if ts < uint64(4) {
+			return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, 4)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+
+	// the DDLs of the schemas are executed in all targets
+	err = sink.EmitDDLEvent(ctx, &model.DDLEvent{
+		StartTs:   5,
+		CommitTs:  6,
+		TableInfo: &model.SimpleTableInfo{Schema: "s2"},
+		Type:      timodel.ActionCreateSchema,
+		Query:     "CREATE DATABASE s2",
+	})
+	c.Assert(err, check.IsNil)
+	err = sink.EmitDDLEvent(ctx, &model.DDLEvent{
+		StartTs:   7,
+		CommitTs:  8,
+		TableInfo: &model.SimpleTableInfo{Schema: "s1", Table: "t2"},
+		Type:      timodel.ActionAddColumn,
+		Query:     "ALTER TABLE s1.t2 ADD COLUMN b int",
+	})
+	c.Assert(err, check.IsNil)
+	// the table can't be renamed across the targets
+	err = sink.EmitDDLEvent(ctx, &model.DDLEvent{
+		StartTs:      9,
+		CommitTs:     10,
+		PreTableInfo: &model.SimpleTableInfo{Schema: "s1", Table: "t1"},
+		TableInfo:    &model.SimpleTableInfo{Schema: "s1", Table: "t2"},
+		Type:         timodel.ActionRenameTable,
+		Query:        "RENAME TABLE s1.t1 TO s1.t2",
+	})
+	c.Assert(cerror.ErrSinkTargetConflict.Equal(err), check.IsTrue, check.Commentf("%v", err))
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
@@ -43,7 +43,11 @@ import (
 	"github.com/pingcap/ticdc/pkg/retry"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	"github.com/pingcap/tidb/infoschema"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 type MySQLSinkSuite struct{}
@@ -283,6 +287,9 @@ func (s MySQLSinkSuite) TestMysqlSinkWorker(c *check.C) {
 		expectedOutputRows       [][]*model.RowChangedEvent
 		exportedOutputReplicaIDs []uint64
 		maxTxnRow                int
+		maxTxnBytes              int64
+		// noCoalesce means each txn is executed alone
+		noCoalesce bool
 	}{
 		{
 			txns:      []*model.SingleTableTxn{},
@@ -390,6 +397,51 @@ func (s MySQLSinkSuite) TestMysqlSinkWorker(c *check.C) {
 			},
 			exportedOutputReplicaIDs: []uint64{1, 1, 1},
 			maxTxnRow:                2,
+		}, {
+			txns: []*model.SingleTableTxn{
+				{
+					CommitTs:  1,
+					Rows:      []*model.RowChangedEvent{{CommitTs: 1}},
+					ReplicaID: 1,
+				},
+				{
+					CommitTs:  2,
+					Rows:      []*model.RowChangedEvent{{CommitTs: 2}, {CommitTs: 2}},
+					ReplicaID: 1,
+				},
+			},
+			expectedOutputRows: [][]*model.RowChangedEvent{
+				{{CommitTs: 1}},
+				{{CommitTs: 2}, {CommitTs: 2}},
+			},
+			exportedOutputReplicaIDs: []uint64{1, 1},
+			maxTxnRow:                4,
+			noCoalesce:               true,
+		}, {
+			txns: []*model.SingleTableTxn{
+				{
+					CommitTs:  1,
+					Rows:      []*model.RowChangedEvent{{CommitTs: 1, ApproximateSize: 10}},
+					ReplicaID: 1,
+				},
+				{
+					CommitTs:  2,
+					Rows:      []*model.RowChangedEvent{{CommitTs: 2, ApproximateSize: 10}},
+					ReplicaID: 1,
+				},
+				{
+					CommitTs:  3,
+					Rows:      []*model.RowChangedEvent{{CommitTs: 3, ApproximateSize: 10}},
+					ReplicaID: 1,
+				},
+			},
+			expectedOutputRows: [][]*model.RowChangedEvent{
+				{{CommitTs: 1, ApproximateSize: 10}, {CommitTs: 2, ApproximateSize: 10}},
+				{{CommitTs: 3, ApproximateSize: 10}},
+			},
+			exportedOutputReplicaIDs: []uint64{1, 1},
+			maxTxnRow:                4,
+			maxTxnBytes:              25,
 		},
 	}
 	ctx := context.Background()
@@ -401,7 +453,8 @@ func (s MySQLSinkSuite) TestMysqlSinkWorker(c *check.C) {
 		var outputReplicaIDs []uint64
 		receiver, err := notifier.NewReceiver(-1)
 		c.Assert(err, check.IsNil)
-		w := newMySQLSinkWorker(tc.maxTxnRow, 1,
+		limit := txnBatchLimit{coalesce: !tc.noCoalesce, maxRows: tc.maxTxnRow, maxBytes: tc.maxTxnBytes}
+		w := newMySQLSinkWorker(limit, 1,
 			bucketSizeCounter.WithLabelValues("capture", "changefeed", "1"),
 			receiver,
 			func(ctx context.Context, events []*model.RowChangedEvent, replicaID uint64, bucket int) error {
@@ -472,6 +525,116 @@ func (s MySQLSinkSuite) TestPrepareDML(c *check.C) {
 	}
 }
 
+func (s MySQLSinkSuite) TestPrepareDMLWithoutHandleKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the table has neither primary key nor not null unique key, the mounter
+	// attaches the _tidb_rowid as the last column
+	preCols := []*model.Column{
+		{Name: "a", Type: mysql.TypeLong, Flag: model.BinaryFlag | model.NullableFlag, Value: 1},
+		{Name: "b", Type: mysql.TypeVarchar, Flag: model.NullableFlag, Value: nil},
+		{Name: "_tidb_rowid", Type: mysql.TypeLonglong, Flag: model.TiDBRowIDFlag, Value: int64(10)},
+	}
+	cols := []*model.Column{
+		{Name: "a", Type: mysql.TypeLong, Flag: model.BinaryFlag | model.NullableFlag, Value: 2},
+		{Name: "b", Type: mysql.TypeVarchar, Flag: model.NullableFlag, Value: "test"},
+		{Name: "_tidb_rowid", Type: mysql.TypeLonglong, Flag: model.TiDBRowIDFlag, Value: int64(10)},
+	}
+	table := &model.TableName{Schema: "common_1", Table: "no_handle"}
+	rows := []*model.RowChangedEvent{
+		{StartTs: 1, CommitTs: 2, Table: table, Columns: cols},
+		{StartTs: 1, CommitTs: 2, Table: table, PreColumns: preCols, Columns: cols},
+		{StartTs: 1, CommitTs: 2, Table: table, PreColumns: cols},
+	}
+	testCases := []struct {
+		enableTiDBRowID    bool
+		expected           *preparedDMLs
+		fullColumnMatchCnt float64
+	}{{
+		enableTiDBRowID: true,
+		expected: &preparedDMLs{
+			sqls: []string{
+				"INSERT INTO `common_1`.`no_handle`(`a`,`b`,`_tidb_rowid`) VALUES (?,?,?)",
+				"UPDATE `common_1`.`no_handle` SET `a`=?,`b`=? WHERE `_tidb_rowid`=? LIMIT 1;",
+				"DELETE FROM `common_1`.`no_handle` WHERE `_tidb_rowid` = ? LIMIT 1;",
+			},
+			values: [][]interface{}{
+				{2, "test", int64(10)}, {2, "test", int64(10)}, {int64(10)},
+			},
+			rowCount: 3,
+		},
+		fullColumnMatchCnt: 0,
+	}, {
+		enableTiDBRowID: false,
+		expected: &preparedDMLs{
+			sqls: []string{
+				"INSERT INTO `common_1`.`no_handle`(`a`,`b`) VALUES (?,?)",
+				"UPDATE `common_1`.`no_handle` SET `a`=?,`b`=? WHERE `a`=? AND `b` IS NULL LIMIT 1;",
+				"DELETE FROM `common_1`.`no_handle` WHERE `a` = ? AND `b` = ? LIMIT 1;",
+			},
+			values: [][]interface{}{
+				{2, "test"}, {2, "test", 1}, {2, "test"},
+			},
+			rowCount: 3,
+		},
+		fullColumnMatchCnt: 2,
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i, tc := range testCases {
+		ms := newMySQLSink4Test(ctx, c)
+		ms.forceReplicate = true
+		ms.params.enableOldValue = true
+		ms.params.batchReplaceEnabled = true
+		ms.params.safeMode = false
+		ms.params.enableTiDBRowID = tc.enableTiDBRowID
+		ms.metricFullColumnMatchCounter = prometheus.NewCounter(prometheus.CounterOpts{})
+		dmls := ms.prepareDMLs(rows, 0, 0)
+		c.Assert(dmls, check.DeepEquals, tc.expected, check.Commentf("%d", i))
+		c.Assert(testutil.ToFloat64(ms.metricFullColumnMatchCounter), check.Equals, tc.fullColumnMatchCnt)
+		// the hidden column of the rows is not removed
+		c.Assert(rows[1].PreColumns, check.HasLen, 3)
+	}
+}
+
+func (s MySQLSinkSuite) TestPrepareDMLInSafeModeWindow(c *check.C) {
+	defer testleak.AfterTest(c)()
+	preCols := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+		{Name: "v", Type: mysql.TypeLong, Value: 1},
+	}
+	cols := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+		{Name: "v", Type: mysql.TypeLong, Value: 2},
+	}
+	table := &model.TableName{Schema: "common_1", Table: "pk"}
+	rows := []*model.RowChangedEvent{
+		{StartTs: 5, CommitTs: 10, Table: table, Columns: preCols},
+		{StartTs: 5, CommitTs: 10, Table: table, PreColumns: preCols, Columns: cols},
+		{StartTs: 15, CommitTs: 20, Table: table, PreColumns: cols, Columns: preCols},
+		{StartTs: 15, CommitTs: 20, Table: table, Columns: cols},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ms := newMySQLSink4Test(ctx, c)
+	ms.params.enableOldValue = true
+	ms.params.batchReplaceEnabled = true
+	ms.params.safeMode = false
+	ms.params.safeModeTs = 10
+	dmls := ms.prepareDMLs(rows, 0, 0)
+	// the rows replayed before the safe mode ts are written in safe mode
+	c.Assert(dmls, check.DeepEquals, &preparedDMLs{
+		sqls: []string{
+			"REPLACE INTO `common_1`.`pk`(`id`,`v`) VALUES (?,?)",
+			"DELETE FROM `common_1`.`pk` WHERE `id` = ? LIMIT 1;",
+			"REPLACE INTO `common_1`.`pk`(`id`,`v`) VALUES (?,?)",
+			"UPDATE `common_1`.`pk` SET `id`=?,`v`=? WHERE `id`=? LIMIT 1;",
+			"INSERT INTO `common_1`.`pk`(`id`,`v`) VALUES (?,?)",
+		},
+		values:   [][]interface{}{{1, 1}, {1}, {1, 2}, {1, 1, 1}, {1, 2}},
+		rowCount: 5,
+	})
+}
+
 func (s MySQLSinkSuite) TestPrepareUpdate(c *check.C) {
 	defer testleak.AfterTest(c)()
 	testCases := []struct {
@@ -642,6 +805,34 @@ func (s MySQLSinkSuite) TestWhereSlice(c *check.C) {
 			expectedColNames: []string{"a", "b", "c"},
 			expectedArgs:     []interface{}{1, "test", 100},
 		},
+		{
+			cols: []*model.Column{
+				nil,
+				{Name: "b", Type: mysql.TypeVarString, Flag: model.NullableFlag, Value: nil},
+			},
+			forceReplicate:   true,
+			expectedColNames: []string{"b"},
+			expectedArgs:     []interface{}{nil},
+		},
+		{
+			cols: []*model.Column{
+				{Name: "a", Type: mysql.TypeLong, Flag: model.MultipleKeyFlag, Value: 1},
+				{Name: "_tidb_rowid", Type: mysql.TypeLonglong, Flag: model.TiDBRowIDFlag, Value: int64(10)},
+			},
+			forceReplicate:   true,
+			expectedColNames: []string{"_tidb_rowid"},
+			expectedArgs:     []interface{}{int64(10)},
+		},
+		{
+			cols: []*model.Column{
+				{Name: "a", Type: mysql.TypeLong, Flag: model.UniqueKeyFlag | model.RecoveredFromKeyFlag, Value: 1},
+				nil,
+				{Name: "c", Type: mysql.TypeLong, Flag: model.NullableFlag, Value: nil},
+			},
+			forceReplicate:   true,
+			expectedColNames: []string{"a"},
+			expectedArgs:     []interface{}{1},
+		},
 	}
 	for _, tc := range testCases {
 		colNames, args := whereSlice(tc.cols, tc.forceReplicate)
@@ -825,6 +1016,12 @@ func (s MySQLSinkSuite) TestSinkParamsClone(c *check.C) {
 		writeTimeout:        defaultWriteTimeout,
 		dialTimeout:         defaultDialTimeout,
 		safeMode:            defaultSafeMode,
+		txnAtomicity:        defaultTxnAtomicity,
+		maxTxnBytes:         defaultMaxTxnBytes,
+
+		slowStatementThreshold: defaultSlowStatementThreshold,
+		conflictThreshold:      defaultConflictThreshold,
+		conflictCooldown:       defaultConflictCooldown,
 	})
 	c.Assert(param2, check.DeepEquals, &sinkParams{
 		changefeedID:        "123",
@@ -837,6 +1034,12 @@ func (s MySQLSinkSuite) TestSinkParamsClone(c *check.C) {
 		writeTimeout:        defaultWriteTimeout,
 		dialTimeout:         defaultDialTimeout,
 		safeMode:            defaultSafeMode,
+		txnAtomicity:        defaultTxnAtomicity,
+		maxTxnBytes:         defaultMaxTxnBytes,
+
+		slowStatementThreshold: defaultSlowStatementThreshold,
+		conflictThreshold:      defaultConflictThreshold,
+		conflictCooldown:       defaultConflictCooldown,
 	})
 }
 
@@ -902,9 +1105,39 @@ func (s MySQLSinkSuite) TestConfigureSinkURI(c *check.C) {
 		}
 	}
 
+	testTiDBRowIDParam := func(supported bool) {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, check.IsNil)
+		defer db.Close()
+		columns := []string{"Variable_name", "Value"}
+		mock.ExpectQuery("show session variables like 'allow_auto_random_explicit_insert';").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow("allow_auto_random_explicit_insert", "0"),
+		)
+		mock.ExpectQuery("show session variables like 'tidb_txn_mode';").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow("tidb_txn_mode", "pessimistic"),
+		)
+		writeRowIDRows := sqlmock.NewRows(columns)
+		if supported {
+			writeRowIDRows.AddRow("tidb_opt_write_row_id", "0")
+		}
+		mock.ExpectQuery("show session variables like 'tidb_opt_write_row_id';").WillReturnRows(writeRowIDRows)
+
+		dsn, err := dmysql.ParseDSN("root:123456@tcp(127.0.0.1:4000)/")
+		c.Assert(err, check.IsNil)
+		params := defaultParams.Clone()
+		params.enableTiDBRowID = true
+		dsnStr, err := configureSinkURI(context.TODO(), dsn, params, db)
+		c.Assert(err, check.IsNil)
+		c.Assert(strings.Contains(dsnStr, "tidb_opt_write_row_id=1"), check.Equals, supported)
+		c.Assert(params.enableTiDBRowID, check.Equals, supported)
+		c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	}
+
 	testDefaultParams()
 	testTimezoneParam()
 	testTimeoutParams()
+	testTiDBRowIDParam(true)
+	testTiDBRowIDParam(false)
 }
 
 func (s MySQLSinkSuite) TestParseSinkURI(c *check.C) {
@@ -919,12 +1152,19 @@ func (s MySQLSinkSuite) TestParseSinkURI(c *check.C) {
 	expected.changefeedID = "cf-id"
 	expected.captureAddr = "127.0.0.1:8300"
 	expected.tidbTxnMode = "pessimistic"
+	expected.enableTiDBRowID = true
+	expected.txnAtomicity = txnAtomicityTxn
+	expected.maxTxnBytes = 1024
+	expected.slowStatementThreshold = 200 * time.Millisecond
+	expected.safeModeTs = 100
 	uriStr := "mysql://127.0.0.1:3306/?worker-count=64&max-txn-row=20" +
 		"&batch-replace-enable=true&batch-replace-size=50&safe-mode=true" +
-		"&tidb-txn-mode=pessimistic"
+		"&tidb-txn-mode=pessimistic&enable-tidb-rowid=true" +
+		"&transaction-atomicity=txn&max-txn-bytes=1024&slow-statement-threshold=200ms"
 	opts := map[string]string{
 		OptChangefeedID: expected.changefeedID,
 		OptCaptureAddr:  expected.captureAddr,
+		OptSafeModeTs:   "100",
 	}
 	uri, err := url.Parse(uriStr)
 	c.Assert(err, check.IsNil)
@@ -967,6 +1207,10 @@ func (s MySQLSinkSuite) TestParseSinkURIBadQueryString(c *check.C) {
 		"mysql://127.0.0.1:3306/?batch-replace-enable=not-bool",
 		"mysql://127.0.0.1:3306/?batch-replace-enable=true&batch-replace-size=not-number",
 		"mysql://127.0.0.1:3306/?safe-mode=not-bool",
+		"mysql://127.0.0.1:3306/?enable-tidb-rowid=not-bool",
+		"mysql://127.0.0.1:3306/?transaction-atomicity=table",
+		"mysql://127.0.0.1:3306/?max-txn-bytes=0",
+		"mysql://127.0.0.1:3306/?slow-statement-threshold=-1s",
 	}
 	ctx := context.TODO()
 	opts := map[string]string{OptChangefeedID: "changefeed-01"}
@@ -1032,7 +1276,7 @@ func (s MySQLSinkSuite) TestAdjustSQLMode(c *check.C) {
 	defer cancel()
 
 	dbIndex := 0
-	mockGetDBConn := func(ctx context.Context, dsnStr string) (*sql.DB, error) {
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
 		defer func() {
 			dbIndex++
 		}()
@@ -1152,7 +1396,7 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDML(c *check.C) {
 	defer testleak.AfterTest(c)()
 
 	dbIndex := 0
-	mockGetDBConn := func(ctx context.Context, dsnStr string) (*sql.DB, error) {
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
 		defer func() {
 			dbIndex++
 		}()
@@ -1246,8 +1490,102 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDML(c *check.C) {
 	err = sink.EmitRowChangedEvents(ctx, rows...)
 	c.Assert(err, check.IsNil)
 
+	var flushedRows uint64
+	err = retry.Run(time.Millisecond*20, 10, func() error {
+		result, err := sink.FlushRowChangedEvents(ctx, uint64(2))
+		c.Assert(err, check.IsNil)
+		flushedRows += result.FlushedRows
+		if result.CheckpointTs < uint64(2) {
+			return errors.Errorf("checkpoint ts %d less than resolved ts %d", result.CheckpointTs, 2)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+
+	err = retry.Run(time.Millisecond*20, 10, func() error {
+		result, err := sink.FlushRowChangedEvents(ctx, uint64(4))
+		c.Assert(err, check.IsNil)
+		flushedRows += result.FlushedRows
+		if result.CheckpointTs < uint64(4) {
+			return errors.Errorf("checkpoint ts %d less than resolved ts %d", result.CheckpointTs, 4)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	// the rows after the resolved ts are not flushed
+	c.Assert(flushedRows, check.Equals, uint64(4))
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s MySQLSinkSuite) TestMySQLSinkCharset(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// "中文" in gbk
+	gbkValue := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	ddlQuery := "ALTER TABLE s1.t1 ADD COLUMN d VARCHAR(10) CHARSET gbk DEFAULT '中文'"
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		// the decoded value is sent as a string, which is converted into gbk
+		// by the downstream, and the binary value is sent as it is.
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`,`b`,`c`) VALUES (?,?,?)").
+			WithArgs(1, "中文", gbkValue).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("USE `s1`;").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(ddlQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=1")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	sink, err := newMySQLSink(ctx, "test-changefeed", sinkURI, f, rc, map[string]string{})
+	c.Assert(err, check.IsNil)
+
+	// the string is converted back to the original bytes in gbk
+	encoded, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("中文"))
+	c.Assert(err, check.IsNil)
+	c.Assert(encoded, check.DeepEquals, gbkValue)
+	err = sink.EmitRowChangedEvents(ctx, &model.RowChangedEvent{
+		StartTs:  1,
+		CommitTs: 2,
+		Table:    &model.TableName{Schema: "s1", Table: "t1", TableID: 1},
+		Columns: []*model.Column{
+			{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+			{Name: "b", Type: mysql.TypeVarchar, Value: []byte("中文"), Charset: "gbk"},
+			{Name: "c", Type: mysql.TypeVarchar, Flag: model.BinaryFlag, Value: gbkValue},
+		},
+	})
+	c.Assert(err, check.IsNil)
 	err = retry.Run(time.Millisecond*20, 10, func() error {
-		ts, err := sink.FlushRowChangedEvents(ctx, uint64(2))
+		ts, err := FlushCheckpointTs(ctx, sink, uint64(2))
 		c.Assert(err, check.IsNil)
 		if ts < uint64(2) {
 			return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, 2)
@@ -1256,15 +1594,171 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDML(c *check.C) {
 	})
 	c.Assert(err, check.IsNil)
 
+	// the DDL containing the gbk literal is executed as it is
+	err = sink.EmitDDLEvent(ctx, &model.DDLEvent{
+		StartTs:   3,
+		CommitTs:  4,
+		TableInfo: &model.SimpleTableInfo{Schema: "s1", Table: "t1"},
+		Type:      timodel.ActionAddColumn,
+		Query:     ddlQuery,
+	})
+	c.Assert(err, check.IsNil)
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s MySQLSinkSuite) TestMySQLSinkCoalesceTxns(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		// the txns resolved by the first flush are merged into one txn
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`,`b`) VALUES (?,?),(?,?)").
+			WithArgs(1, "test", 2, "test").
+			WillReturnResult(sqlmock.NewResult(2, 2))
+		mock.ExpectCommit()
+		// the txn after the resolved ts of the first flush isn't merged
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`,`b`) VALUES (?,?)").
+			WithArgs(3, "test").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changefeed := "test-changefeed"
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=1&transaction-atomicity=none")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	sink, err := newMySQLSink(ctx, changefeed, sinkURI, f, rc, map[string]string{})
+	c.Assert(err, check.IsNil)
+
+	newRow := func(commitTs uint64, a int) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			StartTs:  commitTs - 1,
+			CommitTs: commitTs,
+			Table:    &model.TableName{Schema: "s1", Table: "t1", TableID: 1},
+			Columns: []*model.Column{
+				{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: a},
+				{Name: "b", Type: mysql.TypeVarchar, Flag: 0, Value: "test"},
+			},
+		}
+	}
+	err = sink.EmitRowChangedEvents(ctx, newRow(2, 1), newRow(3, 2), newRow(5, 3))
+	c.Assert(err, check.IsNil)
+
+	for _, resolvedTs := range []uint64{3, 5} {
+		resolvedTs := resolvedTs
+		err = retry.Run(time.Millisecond*20, 10, func() error {
+			ts, err := FlushCheckpointTs(ctx, sink, resolvedTs)
+			c.Assert(err, check.IsNil)
+			if ts < resolvedTs {
+				return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, resolvedTs)
+			}
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+	}
+
+	err = sink.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s MySQLSinkSuite) TestMySQLSinkRowLatency(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	dbIndex := 0
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
+		defer func() {
+			dbIndex++
+		}()
+		if dbIndex == 0 {
+			// test db
+			db, err := mockTestDB()
+			c.Assert(err, check.IsNil)
+			return db, nil
+		}
+		// normal db
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, check.IsNil)
+		mock.ExpectBegin()
+		mock.ExpectExec("REPLACE INTO `s1`.`t1`(`a`,`b`) VALUES (?,?),(?,?)").
+			WithArgs(1, "test", 2, "test").
+			WillReturnResult(sqlmock.NewResult(2, 2))
+		mock.ExpectCommit()
+		mock.ExpectClose()
+		return db, nil
+	}
+	backupGetDBConn := getDBConnImpl
+	getDBConnImpl = mockGetDBConn
+	defer func() {
+		getDBConnImpl = backupGetDBConn
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changefeed := "latency-mysql"
+	sinkURI, err := url.Parse("mysql://127.0.0.1:4000/?time-zone=UTC&worker-count=1")
+	c.Assert(err, check.IsNil)
+	rc := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(rc)
+	c.Assert(err, check.IsNil)
+	opts := map[string]string{OptChangefeedID: changefeed, OptCaptureAddr: "127.0.0.1:8300"}
+	sink, err := newMySQLSink(ctx, changefeed, sinkURI, f, rc, opts)
+	c.Assert(err, check.IsNil)
+	his := rowLatencyHistogram.WithLabelValues("127.0.0.1:8300", changefeed)
+
+	commitTs := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Second)), 0)
+	newRow := func(a int, sampled bool) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			StartTs:  commitTs - 1,
+			CommitTs: commitTs,
+			Table:    &model.TableName{Schema: "s1", Table: "t1", TableID: 1},
+			Columns: []*model.Column{
+				{Name: "a", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: a},
+				{Name: "b", Type: mysql.TypeVarchar, Flag: 0, Value: "test"},
+			},
+			Sampled: sampled,
+		}
+	}
+	err = sink.EmitRowChangedEvents(ctx, newRow(1, true), newRow(2, false))
+	c.Assert(err, check.IsNil)
+	// the sampled row isn't observed until the checkpoint ts reaches it
+	c.Assert(sampleCount(c, his), check.Equals, uint64(0))
 	err = retry.Run(time.Millisecond*20, 10, func() error {
-		ts, err := sink.FlushRowChangedEvents(ctx, uint64(4))
+		ts, err := FlushCheckpointTs(ctx, sink, commitTs)
 		c.Assert(err, check.IsNil)
-		if ts < uint64(4) {
-			return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, 4)
+		if ts < commitTs {
+			return errors.Errorf("checkpoint ts %d less than resolved ts %d", ts, commitTs)
 		}
 		return nil
 	})
 	c.Assert(err, check.IsNil)
+	c.Assert(sampleCount(c, his), check.Equals, uint64(1))
 
 	err = sink.Close()
 	c.Assert(err, check.IsNil)
@@ -1292,7 +1786,7 @@ func (s MySQLSinkSuite) TestExecDMLRollback(c *check.C) {
 		Number: uint16(infoschema.ErrDatabaseNotExists.Code()),
 	}
 	dbIndex := 0
-	mockGetDBConn := func(ctx context.Context, dsnStr string) (*sql.DB, error) {
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
 		defer func() {
 			dbIndex++
 		}()
@@ -1343,7 +1837,7 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDDL(c *check.C) {
 	defer testleak.AfterTest(c)()
 
 	dbIndex := 0
-	mockGetDBConn := func(ctx context.Context, dsnStr string) (*sql.DB, error) {
+	mockGetDBConn := func(ctx context.Context, dsnStr string, sessionVariables []sessionVariable) (*sql.DB, error) {
 		defer func() {
 			dbIndex++
 		}()
@@ -1367,6 +1861,15 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDDL(c *check.C) {
 				Number: uint16(infoschema.ErrColumnExists.Code()),
 			})
 		mock.ExpectRollback()
+		// the DDL not supported by the downstream is not retried
+		mock.ExpectBegin()
+		mock.ExpectExec("USE `test`;").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("ALTER TABLE test.t1 ADD COLUMN b vector").
+			WillReturnError(&dmysql.MySQLError{
+				Number:  mysql.ErrParse,
+				Message: "You have an error in your SQL syntax",
+			})
+		mock.ExpectRollback()
 		mock.ExpectClose()
 		return db, nil
 	}
@@ -1418,7 +1921,64 @@ func (s MySQLSinkSuite) TestNewMySQLSinkExecDDL(c *check.C) {
 	// DDL execute failed, but error can be ignored
 	err = sink.EmitDDLEvent(ctx, ddl1)
 	c.Assert(err, check.IsNil)
+	ddl1.Query = "ALTER TABLE test.t1 ADD COLUMN b vector"
+	err = sink.EmitDDLEvent(ctx, ddl1)
+	c.Assert(cerror.ErrDDLUnsupportedByDownstream.Equal(err), check.IsTrue, check.Commentf("%v", err))
+	c.Assert(err, check.ErrorMatches, ".*ADD COLUMN b vector.*Error 1064.*")
 
 	err = sink.Close()
 	c.Assert(err, check.IsNil)
 }
+
+// BenchmarkMySQLSinkWorkerCommits reports the downstream commits of each
+// upstream txn, the small txns are merged into fewer commits if they can be
+// coalesced.
+func BenchmarkMySQLSinkWorkerCommits(b *testing.B) {
+	for _, tc := range []struct {
+		name  string
+		limit txnBatchLimit
+	}{
+		{name: txnAtomicityTxn, limit: txnBatchLimit{maxRows: defaultMaxTxnRow, maxBytes: defaultMaxTxnBytes}},
+		{name: txnAtomicityNone, limit: txnBatchLimit{coalesce: true, maxRows: defaultMaxTxnRow, maxBytes: defaultMaxTxnBytes}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			notifier := new(notify.Notifier)
+			defer notifier.Close()
+			receiver, err := notifier.NewReceiver(-1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			commits := 0
+			w := newMySQLSinkWorker(tc.limit, 1,
+				bucketSizeCounter.WithLabelValues("capture", "changefeed", "1"),
+				receiver,
+				func(ctx context.Context, events []*model.RowChangedEvent, replicaID uint64, bucket int) error {
+					commits++
+					return nil
+				})
+			ctx, cancel := context.WithCancel(context.Background())
+			errg, ctx := errgroup.WithContext(ctx)
+			errg.Go(func() error {
+				return w.run(ctx)
+			})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ts := uint64(i + 1)
+				w.appendTxn(ctx, &model.SingleTableTxn{
+					CommitTs: ts,
+					Rows:     []*model.RowChangedEvent{{CommitTs: ts, ApproximateSize: 64}},
+				})
+			}
+			// the txns are fetched by the worker before it's notified
+			for len(w.txnCh) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			notifier.Notify()
+			w.waitAllTxnsExecuted()
+			b.StopTimer()
+			cancel()
+			_ = errg.Wait()
+			b.ReportMetric(float64(commits)/float64(b.N), "commits/txn")
+		})
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/pingcap/ticdc/pkg/notify"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -47,8 +48,18 @@ type Config struct {
 
 	// control whether to create topic and verify partition number
 	TopicPreProcess bool
+
+	// EnableIdempotent enables the idempotent producer, so that the messages
+	// resent by the retries of the producer are not duplicated in Kafka.
+	EnableIdempotent bool
+
+	// PartitionCheckInterval is the interval the metadata of the topic is
+	// refreshed at to find the partitions added at runtime, 0 disables it.
+	PartitionCheckInterval time.Duration
 }
 
+const defaultPartitionCheckInterval = time.Minute
+
 // NewKafkaConfig returns a default Kafka configuration
 func NewKafkaConfig() Config {
 	return Config{
@@ -58,6 +69,8 @@ func NewKafkaConfig() Config {
 		Compression:       "none",
 		Credential:        &security.Credential{},
 		TopicPreProcess:   true,
+
+		PartitionCheckInterval: defaultPartitionCheckInterval,
 	}
 }
 
@@ -71,6 +84,16 @@ type kafkaSaramaProducer struct {
 	topic        string
 	partitionNum int32
 
+	// client is shared by the asyncClient and the syncClient, so that the
+	// partitions found by the metadata refreshed by the watchPartitions are
+	// known by them too
+	client                 sarama.Client
+	partitionCheckInterval time.Duration
+	topicPartitionNum      int32
+
+	// offsetLock protects the partitionOffset from being grown by the
+	// SetPartitionNum, the offsets are accessed atomically
+	offsetLock      sync.RWMutex
 	partitionOffset []struct {
 		flushed uint64
 		sent    uint64
@@ -80,6 +103,16 @@ type kafkaSaramaProducer struct {
 
 	failpointCh chan error
 
+	// metricRegistry is the registry of the sarama metrics, the bytes sent to
+	// the brokers are collected from it
+	metricRegistry          interface{ Get(string) interface{} }
+	metricUncompressedBytes prometheus.Counter
+	metricSentBytes         prometheus.Counter
+	lastSentBytes           int64
+	// metricLabels are the labels of the byte counters, the series are
+	// deleted once the producer is closed
+	metricLabels []string
+
 	closeCh chan struct{}
 	closed  int32
 }
@@ -93,7 +126,9 @@ func (k *kafkaSaramaProducer) SendMessage(ctx context.Context, key []byte, value
 		Value:     sarama.ByteEncoder(value),
 		Partition: partition,
 	}
+	k.offsetLock.RLock()
 	msg.Metadata = atomic.AddUint64(&k.partitionOffset[partition].sent, 1)
+	k.offsetLock.RUnlock()
 
 	failpoint.Inject("KafkaSinkAsyncSendError", func() {
 		// simulate sending message to intput channel successfully but flushing
@@ -114,6 +149,7 @@ func (k *kafkaSaramaProducer) SendMessage(ctx context.Context, key []byte, value
 	case <-k.closeCh:
 		return nil
 	default:
+		k.metricUncompressedBytes.Add(float64(len(key) + len(value)))
 		k.asyncClient.Input() <- msg
 	}
 	return nil
@@ -137,20 +173,30 @@ func (k *kafkaSaramaProducer) SyncBroadcastMessage(ctx context.Context, key []by
 	case <-k.closeCh:
 		return nil
 	default:
+		k.metricUncompressedBytes.Add(float64((len(key) + len(value)) * len(msgs)))
 		err := k.syncClient.SendMessages(msgs)
 		return cerror.WrapError(cerror.ErrKafkaSendMessage, err)
 	}
 }
 
+// flushedOffset returns the offset of the messages flushed to the partition
+func (k *kafkaSaramaProducer) flushedOffset(partition int) uint64 {
+	k.offsetLock.RLock()
+	defer k.offsetLock.RUnlock()
+	return atomic.LoadUint64(&k.partitionOffset[partition].flushed)
+}
+
 func (k *kafkaSaramaProducer) Flush(ctx context.Context) error {
-	targetOffsets := make([]uint64, k.partitionNum)
+	k.offsetLock.RLock()
+	targetOffsets := make([]uint64, len(k.partitionOffset))
 	for i := 0; i < len(k.partitionOffset); i++ {
 		targetOffsets[i] = atomic.LoadUint64(&k.partitionOffset[i].sent)
 	}
+	k.offsetLock.RUnlock()
 
 	noEventsToFLush := true
 	for i, target := range targetOffsets {
-		if target > atomic.LoadUint64(&k.partitionOffset[i].flushed) {
+		if target > k.flushedOffset(i) {
 			noEventsToFLush = false
 			break
 		}
@@ -163,7 +209,7 @@ func (k *kafkaSaramaProducer) Flush(ctx context.Context) error {
 	// checkAllPartitionFlushed checks whether data in each partition is flushed
 	checkAllPartitionFlushed := func() bool {
 		for i, target := range targetOffsets {
-			if target > atomic.LoadUint64(&k.partitionOffset[i].flushed) {
+			if target > k.flushedOffset(i) {
 				return false
 			}
 		}
@@ -193,6 +239,33 @@ func (k *kafkaSaramaProducer) GetPartitionNum() int32 {
 	return k.partitionNum
 }
 
+// TopicPartitionNum implements the producer.PartitionWatcher interface
+func (k *kafkaSaramaProducer) TopicPartitionNum() int32 {
+	return atomic.LoadInt32(&k.topicPartitionNum)
+}
+
+// SetPartitionNum implements the producer.PartitionWatcher interface
+func (k *kafkaSaramaProducer) SetPartitionNum(partitionNum int32) {
+	k.clientLock.Lock()
+	defer k.clientLock.Unlock()
+	k.offsetLock.Lock()
+	if int(partitionNum) > len(k.partitionOffset) {
+		partitionOffset := make([]struct {
+			flushed uint64
+			sent    uint64
+		}, partitionNum)
+		for i := range k.partitionOffset {
+			partitionOffset[i].flushed = atomic.LoadUint64(&k.partitionOffset[i].flushed)
+			partitionOffset[i].sent = atomic.LoadUint64(&k.partitionOffset[i].sent)
+		}
+		k.partitionOffset = partitionOffset
+	}
+	k.offsetLock.Unlock()
+	log.Info("the partition number of the producer is changed", zap.String("topic", k.topic),
+		zap.Int32("old", k.partitionNum), zap.Int32("new", partitionNum))
+	k.partitionNum = partitionNum
+}
+
 // stop closes the closeCh to signal other routines to exit
 func (k *kafkaSaramaProducer) stop() {
 	k.clientLock.Lock()
@@ -225,12 +298,76 @@ func (k *kafkaSaramaProducer) Close() error {
 	if err2 != nil {
 		log.Error("close async client with error", zap.Error(err2))
 	}
+	if err := k.client.Close(); err != nil {
+		log.Error("close kafka client with error", zap.Error(err))
+	}
+	uncompressedBytesCounter.DeleteLabelValues(k.metricLabels...)
+	sentBytesCounter.DeleteLabelValues(k.metricLabels...)
 	atomic.StoreInt32(&k.closed, 1)
 	return nil
 }
 
+// collectSentBytes adds the bytes sent to the brokers since the last
+// collection to the metric
+func (k *kafkaSaramaProducer) collectSentBytes() {
+	meter, ok := k.metricRegistry.Get("outgoing-byte-rate").(interface{ Count() int64 })
+	if !ok {
+		return
+	}
+	sent := meter.Count()
+	k.metricSentBytes.Add(float64(sent - k.lastSentBytes))
+	k.lastSentBytes = sent
+}
+
+// refreshPartitionNum refreshes the partition number of the topic from the
+// metadata, the partition number found by the first refresh is the baseline
+// of the changes.
+func (k *kafkaSaramaProducer) refreshPartitionNum() error {
+	if err := k.client.RefreshMetadata(k.topic); err != nil {
+		return errors.Trace(err)
+	}
+	partitions, err := k.client.Partitions(k.topic)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	partitionNum := int32(len(partitions))
+	old := atomic.SwapInt32(&k.topicPartitionNum, partitionNum)
+	if old != 0 && old != partitionNum {
+		log.Warn("the partition number of the kafka topic is changed at runtime, the rows are dispatched "+
+			"by the new partition number from the next resolved ts if the dispatchers allow it",
+			zap.String("topic", k.topic),
+			zap.Int32("old", old),
+			zap.Int32("new", partitionNum))
+	}
+	return nil
+}
+
+// watchPartitions refreshes the partition number of the topic periodically
+// until the producer is closed. It's not done by the run routine, since the
+// refresh may be retried for a long time when the brokers are down.
+func (k *kafkaSaramaProducer) watchPartitions(ctx context.Context) {
+	ticker := time.NewTicker(k.partitionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-k.closeCh:
+			return
+		case <-ticker.C:
+			if err := k.refreshPartitionNum(); err != nil {
+				log.Warn("refresh the partition number of the topic failed",
+					zap.String("topic", k.topic), zap.Error(err))
+			}
+		}
+	}
+}
+
 func (k *kafkaSaramaProducer) run(ctx context.Context) error {
+	ticker := time.NewTicker(metricsCollectInterval)
 	defer func() {
+		ticker.Stop()
+		k.collectSentBytes()
 		k.flushedReceiver.Stop()
 		k.stop()
 	}()
@@ -240,6 +377,8 @@ func (k *kafkaSaramaProducer) run(ctx context.Context) error {
 			return ctx.Err()
 		case <-k.closeCh:
 			return nil
+		case <-ticker.C:
+			k.collectSentBytes()
 		case err := <-k.failpointCh:
 			log.Warn("receive from failpoint chan", zap.Error(err))
 			return err
@@ -248,7 +387,9 @@ func (k *kafkaSaramaProducer) run(ctx context.Context) error {
 				continue
 			}
 			flushedOffset := msg.Metadata.(uint64)
+			k.offsetLock.RLock()
 			atomic.StoreUint64(&k.partitionOffset[msg.Partition].flushed, flushedOffset)
+			k.offsetLock.RUnlock()
 			k.flushedNotifier.Notify()
 		case err := <-k.asyncClient.Errors():
 			// We should not wrap a nil pointer if the pointer is of a subtype of `error`
@@ -312,6 +453,113 @@ func kafkaTopicPreProcess(topic, address string, config Config, cfg *sarama.Conf
 	return partitionNum, nil
 }
 
+// DeleteTopics deletes the topics from the Kafka cluster, the errors of the
+// topics failed to be deleted are returned by the topics. The topics already
+// deleted are not treated as failures.
+func DeleteTopics(ctx context.Context, address string, topics []string, config Config) (map[string]error, error) {
+	cfg, err := newSaramaConfigImpl(ctx, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	admin, err := sarama.NewClusterAdmin(strings.Split(address, ","), cfg)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
+	}
+	defer func() {
+		err := admin.Close()
+		if err != nil {
+			log.Warn("close admin client failed", zap.Error(err))
+		}
+	}()
+	errs := make(map[string]error)
+	for _, topic := range topics {
+		log.Info("delete a topic", zap.String("topic", topic))
+		err := admin.DeleteTopic(topic)
+		if err != nil && errors.Cause(err) != sarama.ErrUnknownTopicOrPartition {
+			errs[topic] = cerror.ErrKafkaDeleteTopic.Wrap(err).GenWithStackByArgs(topic)
+		}
+	}
+	return errs, nil
+}
+
+// the keys of the APIs checked before the producer is created
+const (
+	// apiKeyProduce is the key of the Produce API, zstd compression requires
+	// version 7 of it
+	apiKeyProduce = 0
+	// apiKeyInitProducerID is the key of the InitProducerId API, which is used
+	// by the idempotent producer to get the producer ID.
+	apiKeyInitProducerID = 22
+)
+
+// checkBrokersSupport checks whether all brokers of the Kafka cluster support
+// the version of the API, by the API versions they report. The error of the
+// class is returned if any broker doesn't, requirement describes the API and
+// the Kafka version supporting it.
+func checkBrokersSupport(
+	address string, cfg *sarama.Config, apiKey, apiVersion int16, requirement string,
+	newErr func(reason string) error,
+) error {
+	client, err := sarama.NewClient(strings.Split(address, ","), cfg)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
+	}
+	defer func() {
+		err := client.Close()
+		if err != nil {
+			log.Warn("close kafka client failed", zap.Error(err))
+		}
+	}()
+	for _, broker := range client.Brokers() {
+		err := broker.Open(cfg)
+		if err != nil && err != sarama.ErrAlreadyConnected {
+			return cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
+		}
+		resp, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+		if err != nil {
+			return newErr(fmt.Sprintf("failed to get the API versions of broker %s: %s", broker.Addr(), err))
+		}
+		if resp.Err != sarama.ErrNoError {
+			return newErr(fmt.Sprintf("failed to get the API versions of broker %s: %s", broker.Addr(), resp.Err))
+		}
+		supported := false
+		for _, v := range resp.ApiVersions {
+			if v.ApiKey == apiKey && v.MaxVersion >= apiVersion {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return newErr(fmt.Sprintf("broker %s doesn't support %s", broker.Addr(), requirement))
+		}
+	}
+	return nil
+}
+
+// checkIdempotentSupport checks whether all brokers of the Kafka cluster
+// support the idempotent producer.
+func checkIdempotentSupport(address string, cfg *sarama.Config) error {
+	return checkBrokersSupport(address, cfg, apiKeyInitProducerID, 0,
+		"the InitProducerId API, which requires Kafka 0.11.0 or later",
+		func(reason string) error {
+			return cerror.ErrKafkaIdempotentNotSupport.GenWithStackByArgs(reason)
+		})
+}
+
+// checkCompressionSupport checks whether all brokers of the Kafka cluster
+// support the compression codec, only zstd requires a newer Produce API than
+// the producer uses anyway.
+func checkCompressionSupport(address string, cfg *sarama.Config) error {
+	if cfg.Producer.Compression != sarama.CompressionZSTD {
+		return nil
+	}
+	return checkBrokersSupport(address, cfg, apiKeyProduce, 7,
+		"the version 7 of the Produce API, which requires Kafka 2.1.0 or later",
+		func(reason string) error {
+			return cerror.ErrKafkaCodecNotSupport.GenWithStackByArgs(cfg.Producer.Compression, reason)
+		})
+}
+
 var newSaramaConfigImpl = newSaramaConfig
 
 // NewKafkaSaramaProducer creates a kafka sarama producer
@@ -324,12 +572,31 @@ func NewKafkaSaramaProducer(ctx context.Context, address string, topic string, c
 	if config.PartitionNum < 0 {
 		return nil, cerror.ErrKafkaInvalidPartitionNum.GenWithStackByArgs(config.PartitionNum)
 	}
-	asyncClient, err := sarama.NewAsyncProducer(strings.Split(address, ","), cfg)
+	if config.EnableIdempotent {
+		if err := checkIdempotentSupport(address, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkCompressionSupport(address, cfg); err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(strings.Split(address, ","), cfg)
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
 	}
-	syncClient, err := sarama.NewSyncProducer(strings.Split(address, ","), cfg)
+	asyncClient, err := sarama.NewAsyncProducerFromClient(client)
 	if err != nil {
+		// not need to check error
+		//nolint:errcheck
+		client.Close()
+		return nil, cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
+	}
+	syncClient, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		//nolint:errcheck
+		asyncClient.Close()
+		//nolint:errcheck
+		client.Close()
 		return nil, cerror.WrapError(cerror.ErrKafkaNewSaramaProducer, err)
 	}
 
@@ -351,6 +618,10 @@ func NewKafkaSaramaProducer(ctx context.Context, address string, topic string, c
 		syncClient:   syncClient,
 		topic:        topic,
 		partitionNum: partitionNum,
+
+		client:                 client,
+		partitionCheckInterval: config.PartitionCheckInterval,
+
 		partitionOffset: make([]struct {
 			flushed uint64
 			sent    uint64
@@ -359,6 +630,17 @@ func NewKafkaSaramaProducer(ctx context.Context, address string, topic string, c
 		flushedReceiver: flushedReceiver,
 		closeCh:         make(chan struct{}),
 		failpointCh:     make(chan error, 1),
+
+		metricRegistry: cfg.MetricRegistry,
+	}
+	captureAddr := util.CaptureAddrFromCtx(ctx)
+	changefeedID := util.ChangefeedIDFromCtx(ctx)
+	compression := cfg.Producer.Compression.String()
+	k.metricLabels = []string{captureAddr, changefeedID, compression}
+	k.metricUncompressedBytes = uncompressedBytesCounter.WithLabelValues(k.metricLabels...)
+	k.metricSentBytes = sentBytesCounter.WithLabelValues(k.metricLabels...)
+	if k.partitionCheckInterval > 0 {
+		go k.watchPartitions(ctx)
 	}
 	go func() {
 		if err := k.run(ctx); err != nil && errors.Cause(err) != context.Canceled {
@@ -443,11 +725,31 @@ func newSaramaConfig(ctx context.Context, c Config) (*sarama.Config, error) {
 		log.Warn("Unsupported compression algorithm", zap.String("compression", c.Compression))
 		config.Producer.Compression = sarama.CompressionNone
 	}
+	switch {
+	case config.Producer.Compression == sarama.CompressionLZ4 && !version.IsAtLeast(sarama.V0_10_0_0):
+		return nil, cerror.ErrKafkaCodecNotSupport.GenWithStackByArgs(
+			config.Producer.Compression, fmt.Sprintf("kafka-version %s is less than 0.10.0", c.Version))
+	case config.Producer.Compression == sarama.CompressionZSTD && !version.IsAtLeast(sarama.V2_1_0_0):
+		return nil, cerror.ErrKafkaCodecNotSupport.GenWithStackByArgs(
+			config.Producer.Compression, fmt.Sprintf("kafka-version %s is less than 2.1.0", c.Version))
+	}
 
 	// Time out in five minutes(600 * 500ms).
 	config.Producer.Retry.Max = 600
 	config.Producer.Retry.Backoff = 500 * time.Millisecond
 
+	if c.EnableIdempotent {
+		if !version.IsAtLeast(sarama.V0_11_0_0) {
+			return nil, cerror.ErrKafkaIdempotentNotSupport.GenWithStackByArgs(
+				fmt.Sprintf("kafka-version %s is less than 0.11.0", c.Version))
+		}
+		// The idempotent producer keeps the order of the messages by the
+		// sequence numbers, which requires only one in-flight request to each
+		// broker, and the retries above are deduplicated by Kafka.
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+
 	// Time out in one minute(120 * 500ms).
 	config.Admin.Retry.Max = 120
 	config.Admin.Retry.Backoff = 500 * time.Millisecond
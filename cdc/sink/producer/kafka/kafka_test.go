@@ -26,6 +26,7 @@ import (
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type kafkaSuite struct{}
@@ -73,7 +74,6 @@ func (s *kafkaSuite) TestSaramaProducer(c *check.C) {
 	metadataResponse.AddTopicPartition(topic, 0, leader.BrokerID(), nil, nil, nil, sarama.ErrNoError)
 	metadataResponse.AddTopicPartition(topic, 1, leader.BrokerID(), nil, nil, nil, sarama.ErrNoError)
 	leader.Returns(metadataResponse)
-	leader.Returns(metadataResponse)
 
 	prodSuccess := new(sarama.ProduceResponse)
 	prodSuccess.AddTopicPartition(topic, 0, sarama.ErrNoError)
@@ -140,6 +140,7 @@ func (s *kafkaSuite) TestSaramaProducer(c *check.C) {
 		{100, 100},
 	}
 	c.Assert(producer.partitionOffset, check.DeepEquals, expected)
+	c.Assert(testutil.ToFloat64(producer.metricUncompressedBytes), check.Equals, float64(200*len("test-key-1test-value")))
 	select {
 	case err := <-errCh:
 		c.Fatalf("unexpected err: %s", err)
@@ -154,6 +155,9 @@ func (s *kafkaSuite) TestSaramaProducer(c *check.C) {
 
 	err = producer.Close()
 	c.Assert(err, check.IsNil)
+	// the series of the byte counters are deleted
+	c.Assert(uncompressedBytesCounter.DeleteLabelValues(producer.metricLabels...), check.IsFalse)
+	c.Assert(sentBytesCounter.DeleteLabelValues(producer.metricLabels...), check.IsFalse)
 	// check reentrant close
 	err = producer.Close()
 	c.Assert(err, check.IsNil)
@@ -231,6 +235,35 @@ func (s *kafkaSuite) TestTopicPreProcessCreate(c *check.C) {
 	c.Assert(num, check.Equals, int32(4))
 }
 
+func (s *kafkaSuite) TestDeleteTopics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := sarama.NewMockBroker(c, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+		"DeleteTopicsRequest": sarama.NewMockWrapper(&sarama.DeleteTopicsResponse{
+			Version: 1,
+			TopicErrorCodes: map[string]sarama.KError{
+				"deleted":  sarama.ErrNoError,
+				"missing":  sarama.ErrUnknownTopicOrPartition,
+				"disabled": sarama.ErrTopicDeletionDisabled,
+			},
+		}),
+	})
+	defer broker.Close()
+
+	errs, err := DeleteTopics(ctx, broker.Addr(), []string{"deleted", "missing", "disabled"}, NewKafkaConfig())
+	c.Assert(err, check.IsNil)
+	// the topic already deleted is not a failure
+	c.Assert(errs, check.HasLen, 1)
+	c.Assert(errs["disabled"], check.ErrorMatches, ".*kafka delete topic disabled failed.*")
+	c.Assert(errors.Cause(errs["disabled"]), check.Equals, sarama.ErrTopicDeletionDisabled)
+}
+
 func (s *kafkaSuite) TestNewSaramaConfig(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ctx := context.Background()
@@ -264,6 +297,19 @@ func (s *kafkaSuite) TestNewSaramaConfig(c *check.C) {
 		c.Assert(cfg.Producer.Compression, check.Equals, cc.expected)
 	}
 
+	// the codecs not supported by the kafka version are rejected
+	config.Compression = "zstd"
+	config.Version = "2.0.0"
+	_, err = newSaramaConfigImpl(ctx, config)
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*kafka compression zstd is not supported, kafka-version 2.0.0 is less than 2.1.0.*")
+	config.Compression = "lz4"
+	config.Version = "0.9.0.0"
+	_, err = newSaramaConfigImpl(ctx, config)
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue)
+	config.Compression = "none"
+	config.Version = "2.6.0"
+
 	config.Credential = &security.Credential{
 		CAPath: "/invalid/ca/path",
 	}
@@ -271,6 +317,124 @@ func (s *kafkaSuite) TestNewSaramaConfig(c *check.C) {
 	c.Assert(errors.Cause(err), check.ErrorMatches, ".*no such file or directory")
 }
 
+func (s *kafkaSuite) TestNewSaramaConfigIdempotent(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	config := NewKafkaConfig()
+	config.EnableIdempotent = true
+	cfg, err := newSaramaConfigImpl(ctx, config)
+	c.Assert(err, check.IsNil)
+	c.Assert(cfg.Producer.Idempotent, check.IsTrue)
+	c.Assert(cfg.Net.MaxOpenRequests, check.Equals, 1)
+	c.Assert(cfg.Producer.RequiredAcks, check.Equals, sarama.WaitForAll)
+	c.Assert(cfg.Validate(), check.IsNil)
+
+	config.Version = "0.10.2.0"
+	_, err = newSaramaConfigImpl(ctx, config)
+	c.Assert(cerror.ErrKafkaIdempotentNotSupport.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*kafka-version 0.10.2.0 is less than 0.11.0.*")
+}
+
+func (s *kafkaSuite) TestCheckIdempotentSupport(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(c, 1)
+	defer broker.Close()
+	apiVersions := &sarama.ApiVersionsResponse{ApiVersions: []*sarama.ApiVersionsResponseBlock{
+		{ApiKey: 0, MinVersion: 0, MaxVersion: 7},
+		{ApiKey: apiKeyInitProducerID, MinVersion: 0, MaxVersion: 1},
+	}}
+	handlers := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+		"ApiVersionsRequest": sarama.NewMockWrapper(apiVersions),
+	}
+	broker.SetHandlerByMap(handlers)
+
+	config := NewKafkaConfig()
+	config.Version = "0.11.0.0"
+	config.EnableIdempotent = true
+	cfg, err := newSaramaConfigImpl(ctx, config)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkIdempotentSupport(broker.Addr(), cfg), check.IsNil)
+
+	// the broker doesn't support the InitProducerId API
+	apiVersions.ApiVersions = apiVersions.ApiVersions[:1]
+	err = checkIdempotentSupport(broker.Addr(), cfg)
+	c.Assert(cerror.ErrKafkaIdempotentNotSupport.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*doesn't support the InitProducerId API.*")
+}
+
+func (s *kafkaSuite) TestCheckCompressionSupport(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(c, 1)
+	defer broker.Close()
+	apiVersions := &sarama.ApiVersionsResponse{ApiVersions: []*sarama.ApiVersionsResponseBlock{
+		{ApiKey: apiKeyProduce, MinVersion: 0, MaxVersion: 7},
+	}}
+	handlers := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+		"ApiVersionsRequest": sarama.NewMockWrapper(apiVersions),
+	}
+	broker.SetHandlerByMap(handlers)
+
+	config := NewKafkaConfig()
+	config.Version = "2.1.0"
+	config.Compression = "zstd"
+	cfg, err := newSaramaConfigImpl(ctx, config)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkCompressionSupport(broker.Addr(), cfg), check.IsNil)
+
+	// the broker is older than the configured kafka version
+	apiVersions.ApiVersions[0].MaxVersion = 5
+	err = checkCompressionSupport(broker.Addr(), cfg)
+	c.Assert(cerror.ErrKafkaCodecNotSupport.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*doesn't support the version 7 of the Produce API.*")
+
+	// the other codecs are not checked
+	config.Compression = "gzip"
+	cfg, err = newSaramaConfigImpl(ctx, config)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkCompressionSupport(broker.Addr(), cfg), check.IsNil)
+}
+
+// fakeMeterRegistry returns itself as the meter of the outgoing bytes
+type fakeMeterRegistry struct {
+	count int64
+}
+
+func (r *fakeMeterRegistry) Get(name string) interface{} {
+	if name != "outgoing-byte-rate" {
+		return nil
+	}
+	return r
+}
+
+func (r *fakeMeterRegistry) Count() int64 {
+	return r.count
+}
+
+func (s *kafkaSuite) TestCollectSentBytes(c *check.C) {
+	defer testleak.AfterTest(c)()
+	registry := &fakeMeterRegistry{}
+	k := &kafkaSaramaProducer{
+		metricRegistry:  registry,
+		metricSentBytes: sentBytesCounter.WithLabelValues("test-capture", "test-collect-sent-bytes", "zstd"),
+	}
+	registry.count = 100
+	k.collectSentBytes()
+	c.Assert(testutil.ToFloat64(k.metricSentBytes), check.Equals, float64(100))
+	registry.count = 250
+	k.collectSentBytes()
+	c.Assert(testutil.ToFloat64(k.metricSentBytes), check.Equals, float64(250))
+	k.collectSentBytes()
+	c.Assert(testutil.ToFloat64(k.metricSentBytes), check.Equals, float64(250))
+}
+
 func (s *kafkaSuite) TestCreateProducerFailed(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ctx := context.Background()
@@ -285,3 +449,70 @@ func (s *kafkaSuite) TestCreateProducerFailed(c *check.C) {
 	_, err = NewKafkaSaramaProducer(ctx, "127.0.0.1:1111", "topic", config, errCh)
 	c.Assert(cerror.ErrKafkaInvalidPartitionNum.Equal(err), check.IsTrue)
 }
+
+func (s *kafkaSuite) TestPartitionNumChanged(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// not to count the bytes sent in the metrics of the other tests
+	ctx = util.PutChangefeedIDInCtx(ctx, "partition-num-changed")
+
+	topic := "unit_test_4"
+	broker := sarama.NewMockBroker(c, 1)
+	defer broker.Close()
+	setPartitionNum := func(partitionNum int32) {
+		metaResponse := sarama.NewMockMetadataResponse(c).SetBroker(broker.Addr(), broker.BrokerID())
+		for i := int32(0); i < partitionNum; i++ {
+			metaResponse.SetLeader(topic, i, broker.BrokerID())
+		}
+		broker.SetHandlerByMap(map[string]sarama.MockResponse{
+			"MetadataRequest": metaResponse,
+			"ProduceRequest":  sarama.NewMockProduceResponse(c),
+		})
+	}
+	setPartitionNum(2)
+
+	errCh := make(chan error, 1)
+	config := NewKafkaConfig()
+	config.Version = "0.9.0.0"
+	config.PartitionNum = int32(2)
+	config.TopicPreProcess = false
+	config.PartitionCheckInterval = 50 * time.Millisecond
+	producer, err := NewKafkaSaramaProducer(ctx, broker.Addr(), topic, config, errCh)
+	c.Assert(err, check.IsNil)
+	waitTopicPartitionNum := func(partitionNum int32) {
+		for i := 0; i < 100 && producer.TopicPartitionNum() != partitionNum; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		c.Assert(producer.TopicPartitionNum(), check.Equals, partitionNum)
+	}
+	waitTopicPartitionNum(2)
+
+	// the partitions are added to the topic, and the messages are sent to them
+	// once the partition number of the producer is changed
+	setPartitionNum(4)
+	waitTopicPartitionNum(4)
+	c.Assert(producer.GetPartitionNum(), check.Equals, int32(2))
+	producer.SetPartitionNum(4)
+	c.Assert(producer.GetPartitionNum(), check.Equals, int32(4))
+	for i := int32(0); i < 4; i++ {
+		err = producer.SendMessage(ctx, []byte("test-key"), []byte("test-value"), i)
+		c.Assert(err, check.IsNil)
+	}
+	err = producer.Flush(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(producer.partitionOffset, check.HasLen, 4)
+	for i := 0; i < 4; i++ {
+		c.Assert(producer.flushedOffset(i), check.Equals, uint64(1))
+	}
+	err = producer.SyncBroadcastMessage(ctx, []byte("test-broadcast"), nil)
+	c.Assert(err, check.IsNil)
+	select {
+	case err := <-errCh:
+		c.Fatalf("unexpected err: %s", err)
+	default:
+	}
+
+	err = producer.Close()
+	c.Assert(err, check.IsNil)
+}
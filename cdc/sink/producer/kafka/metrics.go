@@ -0,0 +1,46 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsCollectInterval is the interval of collecting the sarama metrics
+const metricsCollectInterval = 5 * time.Second
+
+var (
+	uncompressedBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "kafka_uncompressed_bytes",
+			Help:      "bytes of the keys and values of the messages sent to kafka before compression",
+		}, []string{"capture", "changefeed", "compression"})
+	sentBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ticdc",
+			Subsystem: "sink",
+			Name:      "kafka_sent_bytes",
+			Help:      "bytes sent to the kafka brokers after compression, including the protocol overhead",
+		}, []string{"capture", "changefeed", "compression"})
+)
+
+// InitMetrics registers all metrics in this file
+func InitMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(uncompressedBytesCounter)
+	registry.MustRegister(sentBytesCounter)
+}
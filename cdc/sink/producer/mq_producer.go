@@ -25,3 +25,16 @@ type Producer interface {
 	GetPartitionNum() int32
 	Close() error
 }
+
+// PartitionWatcher is implemented by the producers which refresh the metadata
+// of the topic periodically, so that the partitions added to the topic at
+// runtime are found.
+type PartitionWatcher interface {
+	// TopicPartitionNum returns the partition number of the topic in the last
+	// refreshed metadata, it's 0 before the first refresh.
+	TopicPartitionNum() int32
+	// SetPartitionNum sets the number of the partitions the messages are sent
+	// and broadcast to. It must be called when all the messages sent are
+	// flushed, and no message is being sent.
+	SetPartitionNum(partitionNum int32)
+}
@@ -29,4 +29,12 @@
 //
 // For example:
 // pulsar://{host}/{topic}?auth=token&auth.token={token}
+//
+// Besides the authentication plugins, the following shortcuts are supported,
+// and at most one authentication method can be specified:
+// 1. `token={token}`, authenticate with the given token.
+// 2. `token-file={path}`, authenticate with the token read from the file.
+// 3. `oauth2-issuer={url}&oauth2-audience={audience}&oauth2-key-file={path}`,
+//    authenticate with the access token fetched from the OAuth2 issuer by the
+//    client credentials flow, the key file contains `client_id` and `client_secret`.
 package pulsar
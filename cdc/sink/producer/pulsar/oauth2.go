@@ -0,0 +1,145 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pulsar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oauth2RequestTimeout = 10 * time.Second
+	// refresh the access token a little earlier than it expires
+	oauth2ExpireMargin = 30 * time.Second
+)
+
+// oauth2KeyFile is the credentials file of the OAuth2 client credentials flow,
+// it shares the format with the key file used by pulsar clients of other languages.
+type oauth2KeyFile struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	IssuerURL    string `json:"issuer_url"`
+}
+
+// oauth2TokenSupplier fetches access tokens from the OAuth2 issuer with the
+// client credentials flow, and caches the token until it's expired.
+type oauth2TokenSupplier struct {
+	issuer   string
+	audience string
+	key      oauth2KeyFile
+	client   *http.Client
+
+	mu       sync.Mutex
+	token    string
+	expireAt time.Time
+}
+
+func newOAuth2TokenSupplier(issuer, audience, keyFile string) (*oauth2TokenSupplier, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("oauth2-key-file must be specified when using oauth2 authentication")
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read oauth2 key file %s failed: %s", keyFile, err)
+	}
+	var key oauth2KeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("parse oauth2 key file %s failed: %s", keyFile, err)
+	}
+	if key.ClientID == "" || key.ClientSecret == "" {
+		return nil, fmt.Errorf("client_id and client_secret are required in oauth2 key file %s", keyFile)
+	}
+	return &oauth2TokenSupplier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		key:      key,
+		client:   &http.Client{Timeout: oauth2RequestTimeout},
+	}, nil
+}
+
+// Token returns a valid access token, it's called by the pulsar client each
+// time it needs to authenticate with brokers.
+func (s *oauth2TokenSupplier) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expireAt) {
+		return s.token, nil
+	}
+	endpoint, err := s.tokenEndpoint()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.key.ClientID},
+		"client_secret": {s.key.ClientSecret},
+	}
+	if s.audience != "" {
+		form.Set("audience", s.audience)
+	}
+	resp, err := s.client.PostForm(endpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("request oauth2 token failed: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read oauth2 token response failed: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request oauth2 token failed, status: %s, body: %s", resp.Status, body)
+	}
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("parse oauth2 token response failed: %s", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("no access token in oauth2 token response")
+	}
+	s.token = tokenResp.AccessToken
+	s.expireAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - oauth2ExpireMargin)
+	return s.token, nil
+}
+
+// tokenEndpoint discovers the token endpoint from the well-known metadata of the issuer.
+func (s *oauth2TokenSupplier) tokenEndpoint() (string, error) {
+	resp, err := s.client.Get(s.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("discover oauth2 token endpoint failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("discover oauth2 token endpoint failed, status: %s", resp.Status)
+	}
+	var metadata struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return "", fmt.Errorf("parse oauth2 issuer metadata failed: %s", err)
+	}
+	if metadata.TokenEndpoint == "" {
+		return "", fmt.Errorf("no token endpoint in oauth2 issuer metadata")
+	}
+	return metadata.TokenEndpoint, nil
+}
@@ -70,24 +70,55 @@ func parseClientOption(u *url.URL) (opt *pulsar.ClientOptions, err error) {
 		TLSValidateHostname:        vs.Bool("tlsValidateHostname"),
 		MaxConnectionsPerBroker:    vs.Int("maxConnectionsPerBroker"),
 	}
-	auth := vs.Str("auth")
-	if auth == "" {
-		if u.User.Username() == "" {
-			// no auth
-			return opt, nil
-		}
-		// use token provider by default
-		opt.Authentication = pulsar.NewAuthenticationToken(u.User.Username())
-		return opt, nil
-	}
-	param := jsonStr(vs.SubPathKV("auth"))
-	opt.Authentication, err = pulsar.NewAuthentication(auth, param)
+	opt.Authentication, err = parseAuthentication(u, vs)
 	if err != nil {
 		return nil, err
 	}
 	return opt, nil
 }
 
+// parseAuthentication parses the authentication provider from the sink uri,
+// at most one of the authentication methods can be specified.
+func parseAuthentication(u *url.URL, vs values) (pulsar.Authentication, error) {
+	auth := vs.Str("auth")
+	token := vs.Str("token")
+	tokenFile := vs.Str("token-file")
+	oauth2Issuer := vs.Str("oauth2-issuer")
+	// the token in user info is kept for compatibility
+	userToken := u.User.Username()
+
+	specified := 0
+	for _, v := range []string{auth, token, userToken, tokenFile, oauth2Issuer} {
+		if v != "" {
+			specified++
+		}
+	}
+	if specified > 1 {
+		return nil, fmt.Errorf("only one of auth, token, token-file and oauth2-issuer can be specified")
+	}
+	if userToken != "" {
+		token = userToken
+	}
+
+	switch {
+	case auth != "":
+		param := jsonStr(vs.SubPathKV("auth"))
+		return pulsar.NewAuthentication(auth, param)
+	case token != "":
+		return pulsar.NewAuthenticationToken(token), nil
+	case tokenFile != "":
+		return pulsar.NewAuthenticationTokenFromFile(tokenFile), nil
+	case oauth2Issuer != "":
+		supplier, err := newOAuth2TokenSupplier(oauth2Issuer, vs.Str("oauth2-audience"), vs.Str("oauth2-key-file"))
+		if err != nil {
+			return nil, err
+		}
+		return pulsar.NewAuthenticationTokenFromSupplier(supplier.Token), nil
+	}
+	// no auth
+	return nil, nil
+}
+
 func parseProducerOptions(u *url.URL) (opt *pulsar.ProducerOptions, err error) {
 	vs := values(u.Query())
 	opt = &pulsar.ProducerOptions{
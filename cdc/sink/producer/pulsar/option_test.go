@@ -0,0 +1,121 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pulsar
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type optionSuite struct{}
+
+var _ = check.Suite(&optionSuite{})
+
+func (s *optionSuite) TestParseNoAuth(c *check.C) {
+	defer testleak.AfterTest(c)()
+	u, err := url.Parse("pulsar://127.0.0.1:6650/persistent://public/default/test?maxPendingMessages=10")
+	c.Assert(err, check.IsNil)
+	opt, err := parseSinkOptions(u)
+	c.Assert(err, check.IsNil)
+	c.Assert(opt.clientOptions.URL, check.Equals, "pulsar://127.0.0.1:6650")
+	c.Assert(opt.clientOptions.Authentication, check.IsNil)
+	c.Assert(opt.producerOptions.MaxPendingMessages, check.Equals, 10)
+
+	u, err = url.Parse("kafka://127.0.0.1:6650/test")
+	c.Assert(err, check.IsNil)
+	_, err = parseSinkOptions(u)
+	c.Assert(err, check.ErrorMatches, "unsupported pulsar scheme.*")
+}
+
+func (s *optionSuite) TestParseTokenAuth(c *check.C) {
+	defer testleak.AfterTest(c)()
+	for _, uri := range []string{
+		"pulsar://127.0.0.1:6650/test?token=abc",
+		"pulsar://abc@127.0.0.1:6650/test",
+		"pulsar://127.0.0.1:6650/test?token-file=/tmp/token",
+		"pulsar://127.0.0.1:6650/test?auth=token&auth.token=abc",
+	} {
+		u, err := url.Parse(uri)
+		c.Assert(err, check.IsNil)
+		opt, err := parseSinkOptions(u)
+		c.Assert(err, check.IsNil, check.Commentf("%s", uri))
+		c.Assert(opt.clientOptions.Authentication, check.NotNil, check.Commentf("%s", uri))
+	}
+
+	for _, uri := range []string{
+		"pulsar://abc@127.0.0.1:6650/test?token=abc",
+		"pulsar://127.0.0.1:6650/test?token=abc&token-file=/tmp/token",
+		"pulsar://127.0.0.1:6650/test?token=abc&oauth2-issuer=http://127.0.0.1",
+		"pulsar://127.0.0.1:6650/test?auth=token&token-file=/tmp/token",
+	} {
+		u, err := url.Parse(uri)
+		c.Assert(err, check.IsNil)
+		_, err = parseSinkOptions(u)
+		c.Assert(err, check.ErrorMatches, "only one of .* can be specified", check.Commentf("%s", uri))
+	}
+}
+
+func (s *optionSuite) TestParseOAuth2(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := c.MkDir()
+	keyFile := filepath.Join(dir, "key.json")
+	err := ioutil.WriteFile(keyFile, []byte(`{"type":"client_credentials","client_id":"id","client_secret":"secret"}`), 0o644)
+	c.Assert(err, check.IsNil)
+
+	u, err := url.Parse("pulsar://127.0.0.1:6650/test?oauth2-issuer=http://127.0.0.1:8080/&oauth2-audience=aud&oauth2-key-file=" + keyFile)
+	c.Assert(err, check.IsNil)
+	opt, err := parseSinkOptions(u)
+	c.Assert(err, check.IsNil)
+	c.Assert(opt.clientOptions.Authentication, check.NotNil)
+
+	supplier, err := newOAuth2TokenSupplier("http://127.0.0.1:8080/", "aud", keyFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(supplier.issuer, check.Equals, "http://127.0.0.1:8080")
+	c.Assert(supplier.key.ClientID, check.Equals, "id")
+	c.Assert(supplier.key.ClientSecret, check.Equals, "secret")
+
+	// key file is required
+	u, err = url.Parse("pulsar://127.0.0.1:6650/test?oauth2-issuer=http://127.0.0.1:8080")
+	c.Assert(err, check.IsNil)
+	_, err = parseSinkOptions(u)
+	c.Assert(err, check.ErrorMatches, "oauth2-key-file must be specified.*")
+
+	// client secret is required
+	err = ioutil.WriteFile(keyFile, []byte(`{"client_id":"id"}`), 0o644)
+	c.Assert(err, check.IsNil)
+	_, err = newOAuth2TokenSupplier("http://127.0.0.1:8080", "", keyFile)
+	c.Assert(err, check.ErrorMatches, "client_id and client_secret are required.*")
+}
+
+func (s *optionSuite) TestParseTopic(c *check.C) {
+	defer testleak.AfterTest(c)()
+	u, err := url.Parse("pulsar://127.0.0.1:6650/test")
+	c.Assert(err, check.IsNil)
+	opt, err := parseSinkOptions(u)
+	c.Assert(err, check.IsNil)
+	c.Assert(opt.producerOptions.Topic, check.Equals, "test")
+
+	u, err = url.Parse("pulsar://127.0.0.1:6650?topic=test2")
+	c.Assert(err, check.IsNil)
+	opt, err = parseSinkOptions(u)
+	c.Assert(err, check.IsNil)
+	c.Assert(opt.producerOptions.Topic, check.Equals, "test2")
+}
@@ -19,6 +19,7 @@ import (
 	"strconv"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 )
@@ -40,12 +41,15 @@ func NewProducer(u *url.URL, errCh chan error) (*Producer, error) {
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrPulsarNewProducer, err)
 	}
-	producer, err := client.CreateProducer(*opt.producerOptions)
+	// The pulsar client connects to brokers lazily, so lookup the topic as a
+	// connectivity probe to detect unreachable brokers and bad credentials early.
+	partitions, err := client.TopicPartitions(opt.producerOptions.Topic)
 	if err != nil {
 		client.Close()
-		return nil, cerror.WrapError(cerror.ErrPulsarNewProducer, err)
+		return nil, errors.Annotate(cerror.WrapError(cerror.ErrPulsarNewProducer, err),
+			"pulsar connectivity probe failed, please check the address and the credentials")
 	}
-	partitions, err := client.TopicPartitions(opt.producerOptions.Topic)
+	producer, err := client.CreateProducer(*opt.producerOptions)
 	if err != nil {
 		client.Close()
 		return nil, cerror.WrapError(cerror.ErrPulsarNewProducer, err)
@@ -123,6 +123,7 @@ func (s *simpleMySQLSink) executeRowChangedEvents(ctx context.Context, rows ...*
 	var args []interface{}
 	if s.enableOldValue {
 		for _, row := range rows {
+			row = row.WithoutTiDBRowID()
 			if len(row.PreColumns) != 0 && len(row.Columns) != 0 {
 				// update
 				if s.enableCheckOldValue {
@@ -152,6 +153,7 @@ func (s *simpleMySQLSink) executeRowChangedEvents(ctx context.Context, rows ...*
 		}
 	} else {
 		for _, row := range rows {
+			row = row.WithoutTiDBRowID()
 			if row.IsDelete() {
 				sql, args = prepareDelete(row.Table.QuoteString(), row.PreColumns, true)
 			} else {
@@ -185,22 +187,25 @@ func (s *simpleMySQLSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent)
 
 // FlushRowChangedEvents flushes each row which of commitTs less than or equal to `resolvedTs` into downstream.
 // TiCDC guarantees that all of Event which of commitTs less than or equal to `resolvedTs` are sent to Sink through `EmitRowChangedEvents`
-func (s *simpleMySQLSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error) {
+func (s *simpleMySQLSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
 	s.rowsBufferLock.Lock()
 	defer s.rowsBufferLock.Unlock()
+	result := model.FlushResult{CheckpointTs: resolvedTs}
 	newBuffer := make([]*model.RowChangedEvent, 0, len(s.rowsBuffer))
 	for _, row := range s.rowsBuffer {
 		if row.CommitTs <= resolvedTs {
 			err := s.executeRowChangedEvents(ctx, row)
 			if err != nil {
-				return 0, err
+				return model.FlushResult{}, err
 			}
+			result.FlushedRows++
+			result.FlushedBytes += uint64(row.ApproximateSize)
 		} else {
 			newBuffer = append(newBuffer, row)
 		}
 	}
 	s.rowsBuffer = newBuffer
-	return resolvedTs, nil
+	return result, nil
 }
 
 // EmitCheckpointTs sends CheckpointTs to Sink
@@ -29,6 +29,25 @@ import (
 const (
 	OptChangefeedID = "_changefeed_id"
 	OptCaptureAddr  = "_capture_addr"
+	// OptLatencyTopNTables is the number of the tables whose latency of the
+	// sampled rows is exported by the sink, see config.LatencyConfig
+	OptLatencyTopNTables = "_latency_top_n_tables"
+	// OptSafeModeTs is the max commit ts of the rows written in safe mode by
+	// the MySQL sink, even if the safe mode is disabled in the sink URI. It's
+	// set when a changefeed is resumed from an earlier checkpoint ts, so the
+	// replayed rows may be written to the downstream again.
+	OptSafeModeTs = "_safe_mode_ts"
+
+	// OptEnableTiDBRowID is the sink URI parameter to output the hidden
+	// _tidb_rowid of the tables without handle key
+	OptEnableTiDBRowID = "enable-tidb-rowid"
+	// OptPartitionChange is the sink URI parameter of how the MQ sink handles
+	// the partitions added to the topic at runtime, if any rows are dispatched
+	// by the key hash. The rows are dispatched by the old partition number if
+	// it's "keep", which is the default, or the changefeed fails if it's
+	// "error". The other rows are dispatched by the new partition number
+	// anyway.
+	OptPartitionChange = "partition-change"
 )
 
 // Sink is an abstraction for anything that a changefeed may emit into.
@@ -45,7 +64,8 @@ type Sink interface {
 
 	// FlushRowChangedEvents flushes each row which of commitTs less than or equal to `resolvedTs` into downstream.
 	// TiCDC guarantees that all of Event which of commitTs less than or equal to `resolvedTs` are sent to Sink through `EmitRowChangedEvents`
-	FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (uint64, error)
+	// The result contains the checkpoint ts and the rows and bytes written to the downstream since the last flush.
+	FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error)
 
 	// EmitCheckpointTs sends CheckpointTs to Sink
 	// TiCDC guarantees that all Events **in the cluster** which of commitTs less than or equal `checkpointTs` are sent to downstream successfully.
@@ -55,6 +75,67 @@ type Sink interface {
 	Close() error
 }
 
+// FlushCheckpointTs flushes the sink like FlushRowChangedEvents, but only
+// returns the checkpoint ts, for the callers not interested in the rows and
+// bytes flushed.
+func FlushCheckpointTs(ctx context.Context, s Sink, resolvedTs uint64) (uint64, error) {
+	result, err := s.FlushRowChangedEvents(ctx, resolvedTs)
+	if err != nil {
+		return 0, err
+	}
+	return result.CheckpointTs, nil
+}
+
+// TableDispatchSink is implemented by the sinks dispatching the rows of each
+// table by the dispatch rules. The rules are evaluated for a table when it's
+// added to the processor, whose name is read from the schema snapshot at the
+// start ts of the table.
+type TableDispatchSink interface {
+	// AddTable evaluates the dispatch rules for the table, and returns the
+	// description of the chosen dispatcher
+	AddTable(table model.TableName) (string, error)
+	// RemoveTable forgets the chosen dispatcher of the table
+	RemoveTable(table model.TableName)
+	// TableDispatchers returns the descriptions of the chosen dispatchers of
+	// the tables, which are keyed by the quoted table names
+	TableDispatchers() map[string]string
+}
+
+// TableConflictSink is implemented by the sinks counting the conflicts of the
+// rows of each table in the downstream
+type TableConflictSink interface {
+	// TableConflicts returns the descriptions of the conflicts of the tables,
+	// which are keyed by the table IDs
+	TableConflicts() map[model.TableID]string
+}
+
+// TableSchemaChecker is implemented by the sinks which can check whether the
+// downstream table is compatible with the upstream table before the table is
+// added to the processor.
+type TableSchemaChecker interface {
+	// CheckTableSchema returns an ErrTableSchemaIncompatible error describing
+	// the incompatibilities, or an ErrDownstreamTableNotExists error if the
+	// table doesn't exist, other errors mean the check can't be done.
+	CheckTableSchema(ctx context.Context, table *model.TableInfo) error
+}
+
+// DDLProgressReporter is implemented by the sinks which can report the
+// progress of a DDL being executed by the downstream.
+type DDLProgressReporter interface {
+	// DDLProgress describes the progress of the DDL being executed by
+	// EmitDDLEvent, it's empty if the downstream doesn't report it
+	DDLProgress(ctx context.Context, ddl *model.DDLEvent) (string, error)
+}
+
+// DDLExecutionProber is implemented by the sinks which can tell whether a DDL
+// dispatched by a previous owner is executed by the downstream, so that a new
+// owner doesn't execute the DDL which is not idempotent twice.
+type DDLExecutionProber interface {
+	// ProbeDDLExecution returns whether the DDL is executed by the downstream,
+	// ErrDDLExecutionUnknown is returned if it can't be told.
+	ProbeDDLExecution(ctx context.Context, ddl *model.DDLEvent) (bool, error)
+}
+
 var sinkIniterMap = make(map[string]sinkInitFunc)
 
 type sinkInitFunc func(context.Context, model.ChangeFeedID, *url.URL, *filter.Filter, *config.ReplicaConfig, map[string]string, chan error) (Sink, error)
@@ -69,12 +150,19 @@ func init() {
 	// register mysql sink
 	sinkIniterMap["mysql"] = func(ctx context.Context, changefeedID model.ChangeFeedID, sinkURI *url.URL,
 		filter *filter.Filter, config *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
-		return newMySQLSink(ctx, changefeedID, sinkURI, filter, config, opts)
+		return newMySQLTargetsSink(ctx, changefeedID, sinkURI, filter, config, opts)
 	}
 	sinkIniterMap["tidb"] = sinkIniterMap["mysql"]
 	sinkIniterMap["mysql+ssl"] = sinkIniterMap["mysql"]
 	sinkIniterMap["tidb+ssl"] = sinkIniterMap["mysql"]
 
+	// register the generic sql sink
+	sinkIniterMap["postgres"] = func(ctx context.Context, changefeedID model.ChangeFeedID, sinkURI *url.URL,
+		filter *filter.Filter, config *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
+		return newSQLSink(ctx, changefeedID, sinkURI, filter, config, opts)
+	}
+	sinkIniterMap["postgresql"] = sinkIniterMap["postgres"]
+
 	// register kafka sink
 	sinkIniterMap["kafka"] = func(ctx context.Context, changefeedID model.ChangeFeedID, sinkURI *url.URL,
 		filter *filter.Filter, config *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
@@ -92,7 +180,7 @@ func init() {
 	// register local sink
 	sinkIniterMap["local"] = func(ctx context.Context, changefeedID model.ChangeFeedID, sinkURI *url.URL,
 		filter *filter.Filter, config *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
-		return cdclog.NewLocalFileSink(ctx, sinkURI, errCh)
+		return cdclog.NewLocalFileSink(ctx, changefeedID, sinkURI, errCh)
 	}
 
 	// register s3 sink
@@ -102,15 +190,41 @@ func init() {
 	}
 }
 
-// NewSink creates a new sink with the sink-uri
+// IsMQSinkURI returns whether the sink-uri is a message queue sink
+func IsMQSinkURI(sinkURIStr string) bool {
+	sinkURI, err := url.Parse(sinkURIStr)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(sinkURI.Scheme) {
+	case "kafka", "kafka+ssl", "pulsar", "pulsar+ssl":
+		return true
+	}
+	return false
+}
+
+// NewSink creates a new sink with the sink-uri, the sink is wrapped by the
+// compact sink if the compaction is enabled, and then by the audit sink if the
+// audit is enabled.
 func NewSink(ctx context.Context, changefeedID model.ChangeFeedID, sinkURIStr string, filter *filter.Filter, config *config.ReplicaConfig, opts map[string]string, errCh chan error) (Sink, error) {
 	// parse sinkURI as a URI
 	sinkURI, err := url.Parse(sinkURIStr)
 	if err != nil {
 		return nil, cerror.WrapError(cerror.ErrSinkURIInvalid, err)
 	}
-	if newSink, ok := sinkIniterMap[strings.ToLower(sinkURI.Scheme)]; ok {
-		return newSink(ctx, changefeedID, sinkURI, filter, config, opts, errCh)
+	newSink, ok := sinkIniterMap[strings.ToLower(sinkURI.Scheme)]
+	if !ok {
+		return nil, cerror.ErrSinkURIInvalid.GenWithStack("the sink scheme (%s) is not supported", sinkURI.Scheme)
+	}
+	s, err := newSink(ctx, changefeedID, sinkURI, filter, config, opts, errCh)
+	if err != nil {
+		return nil, err
+	}
+	if config.Compact != nil && config.Compact.Enable {
+		s = newCompactSink(s, config, opts)
+	}
+	if config.Audit != nil && config.Audit.Enable {
+		s = newAuditSink(s, config, opts)
 	}
-	return nil, cerror.ErrSinkURIInvalid.GenWithStack("the sink scheme (%s) is not supported", sinkURI.Scheme)
+	return s, nil
 }
@@ -0,0 +1,502 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/common"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/notify"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const defaultSQLBatchSize = 20
+
+// sqlSinkParams are the parameters of the generic SQL sink in the sink URI,
+// they are removed from the URI before it's passed to the driver.
+var sqlSinkParams = []string{"worker-count", "max-txn-row", "batch-size"}
+
+// sqlDialect translates the events to the statements of a kind of database,
+// the generic SQL sink uses the dialect to write a downstream which is not
+// compatible with MySQL.
+type sqlDialect interface {
+	// DriverName returns the name of the database/sql driver.
+	DriverName() string
+	// QuoteName quotes an identifier, e.g. the name of a schema or a column.
+	QuoteName(name string) string
+	// Placeholder returns the placeholder of the n-th argument, n starts from 1.
+	Placeholder(n int) string
+	// Upsert returns the statement which inserts rowCount rows, the rows
+	// conflicting with the existing rows on keyColNames replace the existing
+	// ones. The statement inserts the rows only if keyColNames is empty.
+	Upsert(quoteTable string, colNames []string, keyColNames []string, rowCount int) string
+	// Delete returns the statement which deletes one row matching the
+	// condition.
+	Delete(quoteTable string, where string) string
+	// ColumnValue converts the value of the column to the argument accepted
+	// by the driver according to the column type.
+	ColumnValue(col *model.Column) interface{}
+	// TranslateDDL translates the DDL event to the statements of the dialect,
+	// ok is false if the DDL is not supported and should be skipped.
+	TranslateDDL(ddl *model.DDLEvent) (sqls []string, ok bool)
+}
+
+// sqlDialects are the dialects supported by the generic SQL sink, keyed by
+// the scheme of the sink URI.
+var sqlDialects = map[string]func() sqlDialect{
+	"postgres":   newPostgresDialect,
+	"postgresql": newPostgresDialect,
+}
+
+// sqlSink is a sink writing the downstream by the statements of a dialect,
+// it shares the workers and the dispatching of txns with the MySQL sink, so
+// the txns are executed concurrently without breaking the causality.
+type sqlSink struct {
+	db      *sql.DB
+	dialect sqlDialect
+
+	changefeedID   string
+	workerCount    int
+	maxTxnRow      int
+	batchSize      int
+	forceReplicate bool
+
+	filter *filter.Filter
+
+	txnCache   *common.UnresolvedTxnCache
+	workers    []*mysqlSinkWorker
+	resolvedTs uint64
+
+	execWaitNotifier *notify.Notifier
+	resolvedNotifier *notify.Notifier
+	errCh            chan error
+
+	statistics *Statistics
+
+	metricConflictDetectDurationHis prometheus.Observer
+	metricBucketSizeCounters        []prometheus.Counter
+
+	logFormatter *model.EventLogFormatter
+}
+
+var _ Sink = &sqlSink{}
+
+var openSQLDBImpl = openSQLDB
+
+func openSQLDB(ctx context.Context, driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, cerror.WrapError(cerror.ErrSQLSinkConnectionError, err)
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		// close db to recycle resources
+		if closeErr := db.Close(); closeErr != nil {
+			log.Warn("close db failed", zap.Error(closeErr))
+		}
+		return nil, cerror.WrapError(cerror.ErrSQLSinkConnectionError, err)
+	}
+	return db, nil
+}
+
+// newSQLSink creates a generic SQL sink with the dialect of the sink URI scheme
+func newSQLSink(
+	ctx context.Context,
+	changefeedID model.ChangeFeedID,
+	sinkURI *url.URL,
+	filter *filter.Filter,
+	replicaConfig *config.ReplicaConfig,
+	opts map[string]string,
+) (Sink, error) {
+	newDialect, ok := sqlDialects[strings.ToLower(sinkURI.Scheme)]
+	if !ok {
+		return nil, cerror.ErrSQLSinkInvalidConfig.GenWithStack("unsupported sql dialect %s", sinkURI.Scheme)
+	}
+	logFormatter, err := model.NewEventLogFormatter(replicaConfig)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	opts[OptChangefeedID] = changefeedID
+	s := &sqlSink{
+		dialect:        newDialect(),
+		changefeedID:   changefeedID,
+		workerCount:    defaultWorkerCount,
+		maxTxnRow:      defaultMaxTxnRow,
+		batchSize:      defaultSQLBatchSize,
+		forceReplicate: replicaConfig.ForceReplicate,
+		filter:         filter,
+		txnCache:       common.NewUnresolvedTxnCache(),
+		errCh:          make(chan error, 1),
+		logFormatter:   logFormatter,
+	}
+	dsn, err := s.parseSinkURI(sinkURI)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openSQLDBImpl(ctx, s.dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(s.workerCount)
+	db.SetMaxOpenConns(s.workerCount)
+	s.db = db
+	log.Info("Start sql sink", zap.String("dialect", s.dialect.DriverName()), zap.String("changefeed", changefeedID))
+
+	captureAddr := opts[OptCaptureAddr]
+	s.statistics = NewStatistics(ctx, s.dialect.DriverName(), opts)
+	s.metricConflictDetectDurationHis = conflictDetectDurationHis.WithLabelValues(captureAddr, changefeedID)
+	s.metricBucketSizeCounters = make([]prometheus.Counter, s.workerCount)
+	for i := range s.metricBucketSizeCounters {
+		s.metricBucketSizeCounters[i] = bucketSizeCounter.WithLabelValues(captureAddr, changefeedID, strconv.Itoa(i))
+	}
+
+	s.execWaitNotifier = new(notify.Notifier)
+	s.resolvedNotifier = new(notify.Notifier)
+	limit := txnBatchLimit{coalesce: true, maxRows: s.maxTxnRow}
+	s.workers, err = startSinkWorkers(ctx, limit, s.metricBucketSizeCounters,
+		s.execWaitNotifier, s.execDMLs, s.errCh)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.flushRowChangedEvents(ctx)
+	return s, nil
+}
+
+// parseSinkURI parses the parameters of the sink, and returns the DSN of the
+// driver, which is the sink URI without the parameters of the sink.
+func (s *sqlSink) parseSinkURI(sinkURI *url.URL) (string, error) {
+	query := sinkURI.Query()
+	parsePositiveInt := func(name string, value *int) error {
+		str := query.Get(name)
+		if str == "" {
+			return nil
+		}
+		c, err := strconv.Atoi(str)
+		if err != nil || c <= 0 {
+			return cerror.ErrSQLSinkInvalidConfig.GenWithStack("invalid %s %s, it must be a positive integer", name, str)
+		}
+		*value = c
+		return nil
+	}
+	if err := parsePositiveInt("worker-count", &s.workerCount); err != nil {
+		return "", err
+	}
+	if err := parsePositiveInt("max-txn-row", &s.maxTxnRow); err != nil {
+		return "", err
+	}
+	if err := parsePositiveInt("batch-size", &s.batchSize); err != nil {
+		return "", err
+	}
+	for _, name := range sqlSinkParams {
+		query.Del(name)
+	}
+	dsn := *sinkURI
+	dsn.RawQuery = query.Encode()
+	return dsn.String(), nil
+}
+
+func (s *sqlSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	count := s.txnCache.Append(s.filter, rows...)
+	s.statistics.AddRowsCount(count)
+	s.statistics.AddSampledRows(rows)
+	return nil
+}
+
+func (s *sqlSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	atomic.StoreUint64(&s.resolvedTs, resolvedTs)
+	s.resolvedNotifier.Notify()
+
+	// check and throw error
+	select {
+	case err := <-s.errCh:
+		return model.FlushResult{}, err
+	default:
+	}
+
+	// the rows are committed by the workers in txns, the checkpoint ts
+	// advances only after all rows before it are committed.
+	checkpointTs := resolvedTs
+	for _, worker := range s.workers {
+		workerCheckpointTs := atomic.LoadUint64(&worker.checkpointTs)
+		if workerCheckpointTs < checkpointTs {
+			checkpointTs = workerCheckpointTs
+		}
+	}
+	s.statistics.PrintStatus(ctx)
+	s.statistics.ObserveFlushedRows(checkpointTs)
+	return s.statistics.TakeFlushResult(checkpointTs), nil
+}
+
+func (s *sqlSink) flushRowChangedEvents(ctx context.Context) {
+	receiver, err := s.resolvedNotifier.NewReceiver(50 * time.Millisecond)
+	if err != nil {
+		log.Error("flush row changed events routine starts failed", zap.Error(err))
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-receiver.C:
+		}
+		resolvedTs := atomic.LoadUint64(&s.resolvedTs)
+		resolvedTxnsMap := s.txnCache.Resolved(resolvedTs)
+		if len(resolvedTxnsMap) != 0 {
+			dispatchAndExecTxns(ctx, resolvedTxnsMap, s.workers, s.execWaitNotifier, s.metricConflictDetectDurationHis, nil)
+		}
+		for _, worker := range s.workers {
+			atomic.StoreUint64(&worker.checkpointTs, resolvedTs)
+		}
+		s.txnCache.UpdateCheckpoint(resolvedTs)
+	}
+}
+
+func (s *sqlSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
+	// do nothing
+	return nil
+}
+
+func (s *sqlSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
+	if s.filter.ShouldIgnoreDDLEvent(ddl.StartTs, ddl.Type, ddl.TableInfo.Schema, ddl.TableInfo.Table) {
+		log.Info(
+			"DDL event ignored",
+			zap.String("query", ddl.Query),
+			zap.Uint64("startTs", ddl.StartTs),
+			zap.Uint64("commitTs", ddl.CommitTs),
+		)
+		return cerror.ErrDDLEventIgnored.GenWithStackByArgs()
+	}
+	sqls, ok := s.dialect.TranslateDDL(ddl)
+	if !ok {
+		log.Warn("DDL is not supported by the sql dialect, skip it",
+			zap.String("dialect", s.dialect.DriverName()),
+			zap.String("query", ddl.Query),
+			zap.Stringer("type", ddl.Type),
+			zap.Uint64("commitTs", ddl.CommitTs))
+		return cerror.ErrDDLEventIgnored.GenWithStackByArgs()
+	}
+	err := retry.Run(500*time.Millisecond, defaultDDLMaxRetryTime, func() error {
+		err := s.execSQLs(ctx, sqls, nil)
+		if errors.Cause(err) == context.Canceled {
+			return backoff.Permanent(err)
+		}
+		if err != nil {
+			log.Warn("execute DDL with error, retry later", zap.String("query", ddl.Query), zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("Exec DDL succeeded", zap.String("query", ddl.Query), zap.Strings("sqls", sqls))
+	return nil
+}
+
+// Initialize is no-op for sql sink
+func (s *sqlSink) Initialize(ctx context.Context, tableInfo []*model.SimpleTableInfo) error {
+	return nil
+}
+
+func (s *sqlSink) Close() error {
+	s.execWaitNotifier.Close()
+	s.resolvedNotifier.Close()
+	err := s.db.Close()
+	return cerror.WrapError(cerror.ErrSQLSinkConnectionError, err)
+}
+
+// execSQLs executes the statements in a txn
+func (s *sqlSink) execSQLs(ctx context.Context, sqls []string, values [][]interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrSQLSinkTxnError, err)
+	}
+	for i, query := range sqls {
+		var args []interface{}
+		if values != nil {
+			args = values[i]
+		}
+		log.Debug("exec row", zap.String("sql", query), zap.Any("args", args))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Warn("failed to rollback txn", zap.Error(rbErr))
+			}
+			return cerror.WrapError(cerror.ErrSQLSinkTxnError, err)
+		}
+	}
+	return cerror.WrapError(cerror.ErrSQLSinkTxnError, tx.Commit())
+}
+
+func (s *sqlSink) execDMLs(ctx context.Context, rows []*model.RowChangedEvent, replicaID uint64, bucket int) error {
+	dmls := s.prepareDMLs(rows)
+	log.Debug("prepare DMLs", s.logFormatter.Rows("rows", rows), zap.Strings("sqls", dmls.sqls))
+	err := retry.Run(500*time.Millisecond, defaultDMLMaxRetryTime, func() error {
+		err := s.statistics.RecordBatchExecution(func() (int, error) {
+			err := s.execSQLs(ctx, dmls.sqls, dmls.values)
+			if err != nil {
+				return 0, err
+			}
+			return dmls.rowCount, nil
+		})
+		if errors.Cause(err) == context.Canceled {
+			return backoff.Permanent(err)
+		}
+		if err != nil {
+			log.Warn("execute DMLs with error, retry later", zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		log.Error("execute DMLs failed", zap.String("err", err.Error()),
+			zap.Uint64("firstCommitTs", rows[0].CommitTs), zap.Uint64("lastCommitTs", rows[len(rows)-1].CommitTs))
+		return errors.Trace(err)
+	}
+	s.statistics.AddFlushedBytes(dmls.size)
+	log.Debug("Exec Rows succeeded",
+		zap.String("changefeed", s.changefeedID),
+		zap.Int("num of Rows", dmls.rowCount),
+		zap.Int("bucket", bucket))
+	return nil
+}
+
+// prepareDMLs converts the rows to statements. An update is translated to a
+// delete of the old row and an upsert of the new row, so that the update of
+// the key columns is applied correctly. The consecutive upserts of the same
+// columns are batched into one statement unless they conflict with each other.
+func (s *sqlSink) prepareDMLs(rows []*model.RowChangedEvent) *preparedDMLs {
+	dmls := &preparedDMLs{
+		sqls:   make([]string, 0, len(rows)),
+		values: make([][]interface{}, 0, len(rows)),
+	}
+	var (
+		batchTable   string
+		batchCols    []string
+		batchKeyCols []string
+		batchKeys    map[string]struct{}
+		batchArgs    []interface{}
+		batchRows    int
+	)
+	flushBatch := func() {
+		if batchRows == 0 {
+			return
+		}
+		dmls.sqls = append(dmls.sqls, s.dialect.Upsert(batchTable, batchCols, batchKeyCols, batchRows))
+		dmls.values = append(dmls.values, batchArgs)
+		batchTable, batchCols, batchKeyCols, batchKeys, batchArgs, batchRows = "", nil, nil, nil, nil, 0
+	}
+
+	for _, row := range rows {
+		dmls.size += row.ApproximateSize
+		// the hidden _tidb_rowid is meaningless to a non-TiDB downstream
+		row = row.WithoutTiDBRowID()
+		quoteTable := s.dialect.QuoteName(row.Table.Schema) + "." + s.dialect.QuoteName(row.Table.Table)
+		if len(row.PreColumns) != 0 {
+			flushBatch()
+			query, args := s.prepareDelete(quoteTable, row.PreColumns)
+			if query != "" {
+				dmls.sqls = append(dmls.sqls, query)
+				dmls.values = append(dmls.values, args)
+				dmls.rowCount++
+			}
+		}
+		if len(row.Columns) == 0 {
+			continue
+		}
+		var cols, keyCols []string
+		var args []interface{}
+		var key strings.Builder
+		for _, col := range row.Columns {
+			if col == nil || col.Flag.IsGeneratedColumn() {
+				continue
+			}
+			cols = append(cols, col.Name)
+			args = append(args, s.dialect.ColumnValue(col))
+			if col.Flag.IsHandleKey() {
+				keyCols = append(keyCols, col.Name)
+				key.WriteString(model.ColumnValueString(col.Value))
+				key.WriteByte(0)
+			}
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		sameBatch := batchTable == quoteTable && batchRows < s.batchSize &&
+			strings.Join(batchCols, ",") == strings.Join(cols, ",")
+		if sameBatch && len(keyCols) != 0 {
+			// a statement can't insert two rows with the same key
+			_, sameKey := batchKeys[key.String()]
+			sameBatch = !sameKey
+		}
+		if !sameBatch {
+			flushBatch()
+			batchTable, batchCols, batchKeyCols = quoteTable, cols, keyCols
+			batchKeys = make(map[string]struct{})
+		}
+		batchKeys[key.String()] = struct{}{}
+		batchArgs = append(batchArgs, args...)
+		batchRows++
+		dmls.rowCount++
+	}
+	flushBatch()
+	return dmls
+}
+
+func (s *sqlSink) prepareDelete(quoteTable string, cols []*model.Column) (string, []interface{}) {
+	whereCols := make([]*model.Column, 0, len(cols))
+	for _, col := range cols {
+		if col != nil && col.Flag.IsHandleKey() {
+			whereCols = append(whereCols, col)
+		}
+	}
+	if len(whereCols) == 0 && s.forceReplicate {
+		// the rows of the tables without handle key are matched by all columns
+		for _, col := range cols {
+			if col != nil {
+				whereCols = append(whereCols, col)
+			}
+		}
+	}
+	if len(whereCols) == 0 {
+		return "", nil
+	}
+	var builder strings.Builder
+	args := make([]interface{}, 0, len(whereCols))
+	for i, col := range whereCols {
+		if i > 0 {
+			builder.WriteString(" AND ")
+		}
+		if col.Value == nil {
+			builder.WriteString(s.dialect.QuoteName(col.Name) + " IS NULL")
+		} else {
+			args = append(args, s.dialect.ColumnValue(col))
+			builder.WriteString(s.dialect.QuoteName(col.Name) + " = " + s.dialect.Placeholder(len(args)))
+		}
+	}
+	return s.dialect.Delete(quoteTable, builder.String()), args
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	// register the postgres driver
+	_ "github.com/lib/pq"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// postgresDialect writes PostgreSQL, the schemas of TiDB are mapped to the
+// schemas in the database of the sink URI. The tables must be created in the
+// downstream beforehand, since most DDLs of TiDB can't be translated.
+type postgresDialect struct{}
+
+func newPostgresDialect() sqlDialect {
+	return postgresDialect{}
+}
+
+func (postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (postgresDialect) QuoteName(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// Upsert returns `INSERT INTO t (a,b) VALUES ($1,$2),($3,$4) ON CONFLICT (a) DO UPDATE SET b = EXCLUDED.b`
+func (d postgresDialect) Upsert(quoteTable string, colNames []string, keyColNames []string, rowCount int) string {
+	var builder strings.Builder
+	builder.WriteString("INSERT INTO " + quoteTable + " (")
+	for i, name := range colNames {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(d.QuoteName(name))
+	}
+	builder.WriteString(") VALUES ")
+	n := 0
+	for i := 0; i < rowCount; i++ {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("(")
+		for j := range colNames {
+			if j > 0 {
+				builder.WriteString(",")
+			}
+			n++
+			builder.WriteString(d.Placeholder(n))
+		}
+		builder.WriteString(")")
+	}
+	if len(keyColNames) == 0 {
+		return builder.String()
+	}
+
+	keys := make(map[string]struct{}, len(keyColNames))
+	builder.WriteString(" ON CONFLICT (")
+	for i, name := range keyColNames {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(d.QuoteName(name))
+		keys[name] = struct{}{}
+	}
+	builder.WriteString(")")
+	updated := 0
+	for _, name := range colNames {
+		if _, ok := keys[name]; ok {
+			continue
+		}
+		if updated == 0 {
+			builder.WriteString(" DO UPDATE SET ")
+		} else {
+			builder.WriteString(",")
+		}
+		builder.WriteString(d.QuoteName(name) + " = EXCLUDED." + d.QuoteName(name))
+		updated++
+	}
+	if updated == 0 {
+		builder.WriteString(" DO NOTHING")
+	}
+	return builder.String()
+}
+
+// Delete deletes only one row by ctid, since PostgreSQL doesn't support
+// `DELETE ... LIMIT 1` and the rows of the tables without key may duplicate.
+func (postgresDialect) Delete(quoteTable string, where string) string {
+	return "DELETE FROM " + quoteTable + " WHERE ctid = (SELECT ctid FROM " + quoteTable + " WHERE " + where + " LIMIT 1)"
+}
+
+// ColumnValue converts the non-binary strings to string, since []byte is
+// written as bytea by the driver. The unsigned integers which exceed the
+// range of int64 are sent as strings, which are casted to NUMERIC columns.
+func (postgresDialect) ColumnValue(col *model.Column) interface{} {
+	switch v := col.Value.(type) {
+	case []byte:
+		if col.Flag.IsBinary() {
+			return v
+		}
+		return string(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return strconv.FormatUint(v, 10)
+		}
+		return int64(v)
+	case string:
+		switch col.Type {
+		case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeNewDate, mysql.TypeTimestamp:
+			// zero dates are not allowed in PostgreSQL
+			if strings.HasPrefix(v, "0000-00-00") {
+				return nil
+			}
+		}
+	}
+	return col.Value
+}
+
+// TranslateDDL translates the DDLs which don't need to convert the column
+// definitions, the other DDLs should be applied to the downstream manually.
+func (d postgresDialect) TranslateDDL(ddl *model.DDLEvent) ([]string, bool) {
+	schema := d.QuoteName(ddl.TableInfo.Schema)
+	quoteTable := schema + "." + d.QuoteName(ddl.TableInfo.Table)
+	switch ddl.Type {
+	case timodel.ActionCreateSchema:
+		return []string{"CREATE SCHEMA IF NOT EXISTS " + schema}, true
+	case timodel.ActionDropSchema:
+		// the tables are dropped with the database in TiDB
+		return []string{"DROP SCHEMA IF EXISTS " + schema + " CASCADE"}, true
+	case timodel.ActionDropTable:
+		return []string{"DROP TABLE IF EXISTS " + quoteTable}, true
+	case timodel.ActionTruncateTable:
+		return []string{"TRUNCATE TABLE " + quoteTable}, true
+	case timodel.ActionRenameTable:
+		pre := ddl.PreTableInfo
+		if pre == nil || pre.Schema != ddl.TableInfo.Schema {
+			return nil, false
+		}
+		preQuoteTable := d.QuoteName(pre.Schema) + "." + d.QuoteName(pre.Table)
+		return []string{"ALTER TABLE " + preQuoteTable + " RENAME TO " + d.QuoteName(ddl.TableInfo.Table)}, true
+	}
+	return nil, false
+}
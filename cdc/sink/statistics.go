@@ -15,10 +15,14 @@ package sink
 
 import (
 	"context"
+	"sort"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -38,9 +42,16 @@ func NewStatistics(ctx context.Context, name string, opts map[string]string) *St
 	if cid, ok := opts[OptCaptureAddr]; ok {
 		statistics.captureAddr = cid
 	}
+	if n, err := strconv.Atoi(opts[OptLatencyTopNTables]); err == nil && n > 0 {
+		statistics.topNTables = n
+		statistics.tableSamples = make(map[string]int)
+		statistics.tableLatencyHis = make(map[string]prometheus.Observer)
+	}
 	statistics.metricExecTxnHis = execTxnHistogram.WithLabelValues(statistics.captureAddr, statistics.changefeedID)
 	statistics.metricExecBatchHis = execBatchHistogram.WithLabelValues(statistics.captureAddr, statistics.changefeedID)
 	statistics.metricExecErrCnt = executionErrorCounter.WithLabelValues(statistics.captureAddr, statistics.changefeedID)
+	statistics.metricRowLatencyHis = rowLatencyHistogram.WithLabelValues(statistics.captureAddr, statistics.changefeedID)
+	statistics.statements = newStatementStatistics(statistics.captureAddr, statistics.changefeedID)
 
 	// Flush metrics in background for better accuracy and efficiency.
 	ticker := time.NewTicker(flushMetricsInterval)
@@ -51,10 +62,13 @@ func NewStatistics(ctx context.Context, name string, opts map[string]string) *St
 		for {
 			select {
 			case <-ctx.Done():
+				statistics.refreshTopTables(true /* closed */)
+				statistics.statements.close()
 				return
 			case <-ticker.C:
 				metricTotalRows.Set(float64(atomic.LoadUint64(&statistics.totalRows)))
 				metricTotalFlushedRows.Set(float64(atomic.LoadUint64(&statistics.totalFlushedRows)))
+				statistics.refreshTopTables(false /* closed */)
 			}
 		}
 	}()
@@ -69,6 +83,10 @@ type Statistics struct {
 	changefeedID     string
 	totalRows        uint64
 	totalFlushedRows uint64
+	// flushedRows and flushedBytes are the rows and bytes written to the
+	// downstream since the last flush, see TakeFlushResult
+	flushedRows  uint64
+	flushedBytes uint64
 
 	lastPrintStatusTotalRows uint64
 	lastPrintStatusTime      time.Time
@@ -76,6 +94,19 @@ type Statistics struct {
 	metricExecTxnHis   prometheus.Observer
 	metricExecBatchHis prometheus.Observer
 	metricExecErrCnt   prometheus.Counter
+
+	metricRowLatencyHis prometheus.Observer
+	// latencyMu protects the sampled rows waiting to be flushed and the per
+	// table latency of the top N tables with the most sampled rows
+	latencyMu       sync.Mutex
+	sampledRows     []*model.RowChangedEvent
+	topNTables      int
+	tableSamples    map[string]int
+	tableLatencyHis map[string]prometheus.Observer
+
+	// statements records the statements executed in the downstream, it's
+	// used by the MySQL sink only
+	statements *statementStatistics
 }
 
 // AddRowsCount records total number of rows needs to flush
@@ -105,9 +136,25 @@ func (b *Statistics) RecordBatchExecution(executer func() (int, error)) error {
 	b.metricExecTxnHis.Observe(castTime)
 	b.metricExecBatchHis.Observe(float64(batchSize))
 	atomic.AddUint64(&b.totalFlushedRows, uint64(batchSize))
+	atomic.AddUint64(&b.flushedRows, uint64(batchSize))
 	return nil
 }
 
+// AddFlushedBytes records the bytes written to the downstream
+func (b *Statistics) AddFlushedBytes(size int64) {
+	atomic.AddUint64(&b.flushedBytes, uint64(size))
+}
+
+// TakeFlushResult returns the flush result of the checkpoint ts, with the
+// rows and bytes flushed since the last call
+func (b *Statistics) TakeFlushResult(checkpointTs uint64) model.FlushResult {
+	return model.FlushResult{
+		CheckpointTs: checkpointTs,
+		FlushedRows:  atomic.SwapUint64(&b.flushedRows, 0),
+		FlushedBytes: atomic.SwapUint64(&b.flushedBytes, 0),
+	}
+}
+
 // PrintStatus prints the status of the Sink
 func (b *Statistics) PrintStatus(ctx context.Context) {
 	since := time.Since(b.lastPrintStatusTime)
@@ -123,10 +170,105 @@ func (b *Statistics) PrintStatus(ctx context.Context) {
 	}
 	b.lastPrintStatusTime = time.Now()
 	b.lastPrintStatusTotalRows = totalRows
-	log.Info("sink replication status",
+	fields := []zap.Field{
 		zap.String("name", b.name),
 		zap.String("changefeed", b.changefeedID),
 		util.ZapFieldCapture(ctx),
 		zap.Uint64("count", count),
-		zap.Uint64("qps", qps))
+		zap.Uint64("qps", qps),
+	}
+	if tables := b.statements.slowTables(slowTablesTopK); len(tables) > 0 {
+		fields = append(fields, zap.Strings("slow-tables", tables))
+	}
+	log.Info("sink replication status", fields...)
+}
+
+// AddSampledRows holds the sampled rows until they are flushed, see
+// ObserveFlushedRows
+func (b *Statistics) AddSampledRows(rows []*model.RowChangedEvent) {
+	for i, row := range rows {
+		if !row.Sampled {
+			continue
+		}
+		b.latencyMu.Lock()
+		for _, row := range rows[i:] {
+			if row.Sampled {
+				b.sampledRows = append(b.sampledRows, row)
+			}
+		}
+		b.latencyMu.Unlock()
+		return
+	}
+}
+
+// ObserveFlushedRows observes the end-to-end latency from the commit ts to
+// now of the sampled rows flushed by the checkpoint ts
+func (b *Statistics) ObserveFlushedRows(checkpointTs uint64) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	if len(b.sampledRows) == 0 {
+		return
+	}
+	now := time.Now()
+	remained := b.sampledRows[:0]
+	for _, row := range b.sampledRows {
+		if row.CommitTs > checkpointTs {
+			remained = append(remained, row)
+			continue
+		}
+		latency := util.TsLag(now, row.CommitTs)
+		b.metricRowLatencyHis.Observe(latency)
+		if b.topNTables > 0 && row.Table != nil {
+			table := row.Table.QuoteString()
+			b.tableSamples[table]++
+			if his, ok := b.tableLatencyHis[table]; ok {
+				his.Observe(latency)
+			}
+		}
+	}
+	for i := len(remained); i < len(b.sampledRows); i++ {
+		b.sampledRows[i] = nil
+	}
+	b.sampledRows = remained
+}
+
+// refreshTopTables exports the latency of the tables with the most sampled
+// rows since the last refresh, the latency of the other tables are deleted.
+// All the per table latency are deleted once the sink is closed.
+func (b *Statistics) refreshTopTables(closed bool) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	if b.topNTables == 0 || (len(b.tableSamples) == 0 && !closed) {
+		return
+	}
+	tables := make([]string, 0, len(b.tableSamples))
+	if !closed {
+		for table := range b.tableSamples {
+			tables = append(tables, table)
+		}
+		sort.Slice(tables, func(i, j int) bool {
+			if b.tableSamples[tables[i]] != b.tableSamples[tables[j]] {
+				return b.tableSamples[tables[i]] > b.tableSamples[tables[j]]
+			}
+			return tables[i] < tables[j]
+		})
+		if len(tables) > b.topNTables {
+			tables = tables[:b.topNTables]
+		}
+	}
+	top := make(map[string]prometheus.Observer, len(tables))
+	for _, table := range tables {
+		if his, ok := b.tableLatencyHis[table]; ok {
+			top[table] = his
+		} else {
+			top[table] = tableRowLatencyHistogram.WithLabelValues(b.captureAddr, b.changefeedID, table)
+		}
+	}
+	for table := range b.tableLatencyHis {
+		if _, ok := top[table]; !ok {
+			tableRowLatencyHistogram.DeleteLabelValues(b.captureAddr, b.changefeedID, table)
+		}
+	}
+	b.tableLatencyHis = top
+	b.tableSamples = make(map[string]int, len(top))
 }
@@ -0,0 +1,131 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type statisticsSuite struct{}
+
+var _ = check.Suite(&statisticsSuite{})
+
+// sampleCount returns the number of the samples observed by the histogram
+func sampleCount(c *check.C, observer prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	c.Assert(observer.(prometheus.Histogram).Write(m), check.IsNil)
+	return m.GetHistogram().GetSampleCount()
+}
+
+// newSampledRow returns a row committed the lag ago
+func newSampledRow(table string, lag time.Duration, sampled bool) *model.RowChangedEvent {
+	return &model.RowChangedEvent{
+		CommitTs: oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-lag)), 0),
+		Table:    &model.TableName{Schema: "test", Table: table},
+		Sampled:  sampled,
+	}
+}
+
+func (s *statisticsSuite) TestBlackHoleRowLatency(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := map[string]string{OptChangefeedID: "latency-blackhole", OptCaptureAddr: "127.0.0.1:8300"}
+	sink := newBlackHoleSink(ctx, opts)
+	his := rowLatencyHistogram.WithLabelValues("127.0.0.1:8300", "latency-blackhole")
+
+	rows := []*model.RowChangedEvent{
+		newSampledRow("t1", 3*time.Second, true),
+		newSampledRow("t1", 2*time.Second, false),
+		newSampledRow("t1", time.Second, true),
+	}
+	c.Assert(sink.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	// only the sampled rows flushed by the resolved ts are observed
+	_, err := sink.FlushRowChangedEvents(ctx, rows[1].CommitTs)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampleCount(c, his), check.Equals, uint64(1))
+	_, err = sink.FlushRowChangedEvents(ctx, rows[2].CommitTs)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampleCount(c, his), check.Equals, uint64(2))
+	c.Assert(sink.statistics.sampledRows, check.HasLen, 0)
+}
+
+func (s *statisticsSuite) TestBlackHoleFlushResult(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := newBlackHoleSink(ctx, map[string]string{OptChangefeedID: "flush-result-blackhole"})
+
+	rows := []*model.RowChangedEvent{
+		{CommitTs: 1, ApproximateSize: 10},
+		{CommitTs: 2, ApproximateSize: 20},
+	}
+	c.Assert(sink.EmitRowChangedEvents(ctx, rows...), check.IsNil)
+	result, err := sink.FlushRowChangedEvents(ctx, 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, model.FlushResult{CheckpointTs: 2, FlushedRows: 2, FlushedBytes: 30})
+	// the rows and bytes are counted since the last flush
+	result, err = sink.FlushRowChangedEvents(ctx, 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, model.FlushResult{CheckpointTs: 3})
+}
+
+func (s *statisticsSuite) TestTopTablesRowLatency(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := map[string]string{
+		OptChangefeedID:      "latency-top-tables",
+		OptCaptureAddr:       "127.0.0.1:8300",
+		OptLatencyTopNTables: "1",
+	}
+	statistics := NewStatistics(ctx, "test", opts)
+	emit := func(table string, count int) {
+		for i := 0; i < count; i++ {
+			statistics.AddSampledRows([]*model.RowChangedEvent{newSampledRow(table, time.Second, true)})
+		}
+	}
+	tableHis := func(table string) prometheus.Observer {
+		return tableRowLatencyHistogram.WithLabelValues("127.0.0.1:8300", "latency-top-tables", table)
+	}
+
+	emit("t1", 1)
+	emit("t2", 2)
+	statistics.ObserveFlushedRows(oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0))
+	statistics.refreshTopTables(false /* closed */)
+	c.Assert(statistics.tableLatencyHis, check.HasLen, 1)
+	c.Assert(statistics.tableLatencyHis, check.HasKey, "`test`.`t2`")
+
+	// the table with the most sampled rows since the last refresh is exported
+	emit("t1", 3)
+	emit("t2", 1)
+	statistics.ObserveFlushedRows(oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0))
+	c.Assert(sampleCount(c, tableHis("`test`.`t2`")), check.Equals, uint64(1))
+	statistics.refreshTopTables(false /* closed */)
+	c.Assert(statistics.tableLatencyHis, check.HasLen, 1)
+	c.Assert(statistics.tableLatencyHis, check.HasKey, "`test`.`t1`")
+	// the latency of the table is deleted once it's out of the top tables
+	c.Assert(sampleCount(c, tableHis("`test`.`t2`")), check.Equals, uint64(0))
+
+	statistics.refreshTopTables(true /* closed */)
+	c.Assert(statistics.tableLatencyHis, check.HasLen, 0)
+}
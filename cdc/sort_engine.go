@@ -0,0 +1,119 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+)
+
+// sortDirCapacityCheckInterval is the interval of checking the free space of
+// the sort dir of a running processor.
+const sortDirCapacityCheckInterval = time.Minute
+
+// sortDirDiskUsage returns the used and total bytes of the file system of the
+// sort dir, it's a variable for testing.
+var sortDirDiskUsage = util.DiskUsage
+
+// prepareSortDir makes sure the sort dir used by the sort engine exists and
+// is writable, the dir is created if it doesn't exist.
+func prepareSortDir(engine model.SortEngine, sortDir string) error {
+	switch engine {
+	case model.SortInMemory:
+		return nil
+	case model.SortInFile, model.SortUnified:
+	default:
+		return cerror.ErrUnknownSortEngine.GenWithStackByArgs(engine)
+	}
+	err := util.IsDirAndWritable(sortDir)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(errors.Cause(err)) {
+		return errors.Annotate(cerror.WrapError(cerror.ErrProcessorSortDir, err), "sort dir check")
+	}
+	err = os.MkdirAll(sortDir, 0o755)
+	if err != nil {
+		return errors.Annotate(cerror.WrapError(cerror.ErrProcessorSortDir, err), "create dir")
+	}
+	return nil
+}
+
+// checkSortDir checks the sort dir of the changefeed when the processor
+// starts, so that an unavailable sort dir, e.g. after the sort engine is
+// switched by updating a paused changefeed, is reported with the capture
+// before any table is added.
+func (p *processor) checkSortDir() error {
+	err := prepareSortDir(p.changefeed.Engine, p.changefeed.SortDir)
+	if err == nil || cerror.ErrUnknownSortEngine.Equal(err) {
+		return err
+	}
+	return cerror.ErrCaptureSortDir.GenWithStackByArgs(p.changefeed.SortDir, p.captureInfo.AdvertiseAddr, err.Error())
+}
+
+// checkSortDirCapacity checks whether the free space of the sort dir reaches
+// the minimum to start the sorter of a table. The free space is also returned,
+// which is 0 if the check is disabled.
+func (p *processor) checkSortDirCapacity() (free uint64, err error) {
+	cfg := p.changefeed.Config.SortDir
+	if p.changefeed.Engine == model.SortInMemory || cfg == nil || cfg.MinFreeBytes == 0 {
+		return 0, nil
+	}
+	used, total, err := sortDirDiskUsage(p.changefeed.SortDir)
+	if err != nil {
+		return 0, cerror.WrapError(cerror.ErrProcessorSortDir, err)
+	}
+	free = total - used
+	if free < cfg.MinFreeBytes {
+		return free, cerror.ErrCaptureSortDirCapacity.GenWithStackByArgs(
+			free, p.changefeed.SortDir, p.captureInfo.AdvertiseAddr, cfg.MinFreeBytes)
+	}
+	return free, nil
+}
+
+// sortDirCapacityWorker checks the free space of the sort dir periodically,
+// and warns if it's approaching the minimum, i.e. less than twice of it. The
+// running tables are not stopped, but no table can be added any more once the
+// minimum is reached.
+func (p *processor) sortDirCapacityWorker(ctx context.Context) error {
+	ticker := p.wheel.NewTicker(sortDirCapacityCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		free, err := p.checkSortDirCapacity()
+		if err != nil {
+			log.Warn("no table can be added because of the sort dir capacity",
+				zap.String("changefeed", p.changefeedID), zap.Error(err))
+			continue
+		}
+		if minFree := p.changefeed.Config.SortDir.MinFreeBytes; free != 0 && free < 2*minFree {
+			log.Warn("the free space of the sort dir is approaching the minimum",
+				zap.String("changefeed", p.changefeedID),
+				zap.String("sortDir", p.changefeed.SortDir),
+				zap.Uint64("free", free), zap.Uint64("minFree", minFree))
+		}
+	}
+}
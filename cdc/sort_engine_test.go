@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type sortEngineSuite struct{}
+
+var _ = check.Suite(&sortEngineSuite{})
+
+func (s *sortEngineSuite) TestPrepareSortDir(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := c.MkDir()
+
+	// the memory sort engine doesn't use the sort dir
+	c.Assert(prepareSortDir(model.SortInMemory, filepath.Join(dir, "memory")), check.IsNil)
+	// the sort dir is created if it doesn't exist
+	sortDir := filepath.Join(dir, "unified")
+	c.Assert(prepareSortDir(model.SortUnified, sortDir), check.IsNil)
+	c.Assert(util.IsDirAndWritable(sortDir), check.IsNil)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, nil, 0o644), check.IsNil)
+	err := prepareSortDir(model.SortInFile, file)
+	c.Assert(err, check.ErrorMatches, ".*sort dir check.*")
+
+	err = prepareSortDir("disk", sortDir)
+	c.Assert(cerror.ErrUnknownSortEngine.Equal(err), check.IsTrue)
+}
+
+func (s *sortEngineSuite) TestCheckSortDir(c *check.C) {
+	defer testleak.AfterTest(c)()
+	dir := c.MkDir()
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, nil, 0o644), check.IsNil)
+
+	p := newProcessorForTest()
+	p.changefeed.Engine = model.SortUnified
+	p.changefeed.SortDir = dir
+	c.Assert(p.checkSortDir(), check.IsNil)
+
+	// the error tells the capture on which the sort dir is not available
+	p.changefeed.SortDir = file
+	err := p.checkSortDir()
+	c.Assert(cerror.ErrCaptureSortDir.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*sort dir .*/file is not available in capture 127.0.0.1:8300.*")
+}
+
+func (s *sortEngineSuite) TestCheckSortDirCapacity(c *check.C) {
+	defer testleak.AfterTest(c)()
+	var free uint64 = 1 << 30
+	originalDiskUsage := sortDirDiskUsage
+	sortDirDiskUsage = func(dir string) (uint64, uint64, error) {
+		return 10<<30 - free, 10 << 30, nil
+	}
+	defer func() {
+		sortDirDiskUsage = originalDiskUsage
+	}()
+
+	cfg := config.GetDefaultReplicaConfig()
+	cfg.SortDir.MinFreeBytes = 2 << 30
+	p := newProcessorForTest(withReplicaConfig(cfg))
+	p.changefeed.Engine = model.SortUnified
+	p.changefeed.SortDir = "/tmp/sorter"
+	_, err := p.checkSortDirCapacity()
+	c.Assert(cerror.ErrCaptureSortDirCapacity.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*free space 1073741824 bytes of sort dir /tmp/sorter in capture 127.0.0.1:8300 is less than 2147483648 bytes.*")
+
+	// the table is not added, and the error is recorded in the operation
+	status := &model.TaskStatus{
+		Tables:    map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 100}},
+		Operation: map[model.TableID]*model.TableOperation{1: {BoundaryTs: 100}},
+	}
+	_, err = p.handleTables(context.Background(), status)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.tables, check.HasLen, 0)
+	c.Assert(status.Dirty, check.IsTrue)
+	op := status.Operation[1]
+	c.Assert(op.Status, check.Equals, model.OperProcessed)
+	c.Assert(op.Error, check.NotNil)
+	c.Assert(op.Error.Code, check.Equals, string(cerror.ErrCaptureSortDirCapacity.RFCCode()))
+	c.Assert(op.Error.Addr, check.Equals, "127.0.0.1:8300")
+
+	free = 3 << 30
+	got, err := p.checkSortDirCapacity()
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, free)
+
+	// the check is disabled for the memory sort engine
+	free = 0
+	p.changefeed.Engine = model.SortInMemory
+	got, err = p.checkSortDirCapacity()
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, uint64(0))
+}
+
+func (s *sortEngineSuite) TestRescheduleFailedTables(c *check.C) {
+	defer testleak.AfterTest(c)()
+	etcdCli, teardown := setUpStopTestEtcd(c)
+	defer teardown()
+	ctx := context.Background()
+
+	const changefeedID = "test-changefeed"
+	failedStatus := &model.TaskStatus{
+		Tables: map[model.TableID]*model.TableReplicaInfo{1: {StartTs: 100}, 2: {StartTs: 90}},
+		Operation: map[model.TableID]*model.TableOperation{
+			1: {BoundaryTs: 100, Status: model.OperProcessed, Error: &model.RunningError{Message: "capture-1 is full"}},
+			2: {BoundaryTs: 90, Status: model.OperFinished},
+		},
+	}
+	c.Assert(etcdCli.PutTaskStatus(ctx, changefeedID, "capture-1", failedStatus), check.IsNil)
+	cf := &changeFeed{
+		id:           changefeedID,
+		etcdCli:      etcdCli,
+		status:       &model.ChangeFeedStatus{},
+		taskStatus:   model.ProcessorsInfos{"capture-1": failedStatus.Clone()},
+		orphanTables: make(map[model.TableID]model.Ts),
+	}
+	c.Assert(cf.rescheduleFailedTables(ctx), check.IsNil)
+	c.Assert(cf.orphanTables, check.DeepEquals, map[model.TableID]model.Ts{1: 100})
+	c.Assert(cf.taskStatus["capture-1"].Tables, check.HasLen, 1)
+	c.Assert(cf.taskStatus["capture-1"].Operation, check.HasLen, 1)
+	_, status, err := etcdCli.GetTaskStatus(ctx, changefeedID, "capture-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Tables[1], check.IsNil)
+	c.Assert(status.Tables[2], check.NotNil)
+
+	// the table distributed to the failed capture is moved to another one
+	captures := map[model.CaptureID]*model.CaptureInfo{"capture-1": {ID: "capture-1"}, "capture-2": {ID: "capture-2"}}
+	operations := map[model.CaptureID]map[model.TableID]*model.TableOperation{
+		"capture-1": {1: {BoundaryTs: 100}},
+	}
+	cf.avoidFailedCaptures(operations, captures)
+	c.Assert(operations["capture-1"], check.HasLen, 0)
+	c.Assert(operations["capture-2"][1], check.NotNil)
+	c.Assert(cf.status.UnscheduledTables, check.IsNil)
+
+	// the table is kept orphan if no capture can add it
+	cf.addTableFailures[1].reasons["capture-2"] = "capture-2 is full"
+	operations = map[model.CaptureID]map[model.TableID]*model.TableOperation{
+		"capture-2": {1: {BoundaryTs: 100}},
+	}
+	cf.avoidFailedCaptures(operations, captures)
+	c.Assert(operations["capture-1"], check.HasLen, 0)
+	c.Assert(operations["capture-2"], check.HasLen, 0)
+	c.Assert(cf.status.UnscheduledTables[1], check.Matches, ".*no capture has sort capacity for table 1: capture-1 is full; capture-2 is full.*")
+
+	// the failures expire, so the table is retried on all captures
+	cf.addTableFailures[1].lastTime = time.Now().Add(-2 * addTableFailureTTL)
+	operations = map[model.CaptureID]map[model.TableID]*model.TableOperation{
+		"capture-2": {1: {BoundaryTs: 100}},
+	}
+	cf.avoidFailedCaptures(operations, captures)
+	c.Assert(operations["capture-2"][1], check.NotNil)
+	c.Assert(cf.addTableFailures, check.HasLen, 0)
+	c.Assert(cf.status.UnscheduledTables, check.IsNil)
+}
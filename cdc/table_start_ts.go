@@ -0,0 +1,94 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+)
+
+// tableStartTsMatcher matches the tables with the start ts overrides of a
+// changefeed. The tables which don't match any override start from the start
+// ts of the changefeed. A nil matcher means there is no override.
+type tableStartTsMatcher struct {
+	defaultStartTs model.Ts
+	rules          []struct {
+		filter.Filter
+		startTs model.Ts
+	}
+}
+
+// newTableStartTsMatcher creates a tableStartTsMatcher, nil is returned if
+// there is no start ts override in the config.
+func newTableStartTsMatcher(cfg *config.ReplicaConfig, defaultStartTs model.Ts) (*tableStartTsMatcher, error) {
+	if len(cfg.TableStartTs) == 0 {
+		return nil, nil
+	}
+	m := &tableStartTsMatcher{defaultStartTs: defaultStartTs}
+	for _, rule := range cfg.TableStartTs {
+		if rule.StartTs == 0 {
+			return nil, cerror.ErrTableStartTsInvalid.GenWithStackByArgs(rule.Matcher, "start-ts is not specified")
+		}
+		f, err := filter.Parse(rule.Matcher)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if !cfg.CaseSensitive {
+			f = filter.CaseInsensitive(f)
+		}
+		m.rules = append(m.rules, struct {
+			filter.Filter
+			startTs model.Ts
+		}{Filter: f, startTs: rule.StartTs})
+	}
+	return m, nil
+}
+
+// startTs returns the start ts of the table, the first matched rule wins
+func (m *tableStartTsMatcher) startTs(schema, table string) model.Ts {
+	for _, rule := range m.rules {
+		if rule.MatchTable(schema, table) {
+			return rule.startTs
+		}
+	}
+	return m.defaultStartTs
+}
+
+// adjust returns the ts to start replicating the table from, which is ts or
+// the start ts of the table if the table is not started yet at ts.
+func (m *tableStartTsMatcher) adjust(name model.TableName, ts model.Ts) model.Ts {
+	if m == nil {
+		return ts
+	}
+	if startTs := m.startTs(name.Schema, name.Table); startTs > ts {
+		return startTs
+	}
+	return ts
+}
+
+// beforeStartTs returns whether the DDL is committed before the start ts of
+// its table, such DDLs are expected to be replicated already and should be
+// skipped in the downstream.
+func (m *tableStartTsMatcher) beforeStartTs(ddl *model.DDLEvent) bool {
+	if m == nil || ddl.TableInfo == nil {
+		return false
+	}
+	startTs := m.defaultStartTs
+	if ddl.TableInfo.Table != "" {
+		startTs = m.startTs(ddl.TableInfo.Schema, ddl.TableInfo.Table)
+	}
+	return ddl.CommitTs <= startTs
+}
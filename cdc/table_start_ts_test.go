@@ -0,0 +1,74 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type tableStartTsSuite struct{}
+
+var _ = check.Suite(&tableStartTsSuite{})
+
+func (s *tableStartTsSuite) TestTableStartTsMatcher(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	m, err := newTableStartTsMatcher(cfg, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.IsNil)
+	// a nil matcher doesn't change the start ts
+	c.Assert(m.adjust(model.TableName{Schema: "test", Table: "a"}, 50), check.Equals, uint64(50))
+	c.Assert(m.beforeStartTs(&model.DDLEvent{CommitTs: 50, TableInfo: &model.SimpleTableInfo{Schema: "test"}}), check.IsFalse)
+
+	cfg.CaseSensitive = false
+	cfg.TableStartTs = []*config.TableStartTsRule{
+		{Matcher: []string{"test.a"}, StartTs: 200},
+		{Matcher: []string{"test.*"}, StartTs: 300},
+	}
+	m, err = newTableStartTsMatcher(cfg, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.adjust(model.TableName{Schema: "TEST", Table: "A"}, 150), check.Equals, uint64(200))
+	c.Assert(m.adjust(model.TableName{Schema: "test", Table: "a"}, 250), check.Equals, uint64(250))
+	c.Assert(m.adjust(model.TableName{Schema: "test", Table: "b"}, 150), check.Equals, uint64(300))
+	c.Assert(m.adjust(model.TableName{Schema: "other", Table: "a"}, 50), check.Equals, uint64(100))
+	c.Assert(m.adjust(model.TableName{Schema: "other", Table: "a"}, 150), check.Equals, uint64(150))
+
+	c.Assert(m.beforeStartTs(&model.DDLEvent{
+		CommitTs: 200, TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "a"},
+	}), check.IsTrue)
+	c.Assert(m.beforeStartTs(&model.DDLEvent{
+		CommitTs: 201, TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "a"},
+	}), check.IsFalse)
+	c.Assert(m.beforeStartTs(&model.DDLEvent{
+		CommitTs: 250, TableInfo: &model.SimpleTableInfo{Schema: "test", Table: "b"},
+	}), check.IsTrue)
+	// the schema DDLs use the start ts of the changefeed
+	c.Assert(m.beforeStartTs(&model.DDLEvent{
+		CommitTs: 150, TableInfo: &model.SimpleTableInfo{Schema: "test"},
+	}), check.IsFalse)
+	c.Assert(m.beforeStartTs(&model.DDLEvent{
+		CommitTs: 100, TableInfo: &model.SimpleTableInfo{Schema: "test"},
+	}), check.IsTrue)
+
+	cfg.TableStartTs = []*config.TableStartTsRule{{Matcher: []string{"test.a"}}}
+	_, err = newTableStartTsMatcher(cfg, 100)
+	c.Assert(cerror.ErrTableStartTsInvalid.Equal(err), check.IsTrue)
+	cfg.TableStartTs = []*config.TableStartTsRule{{Matcher: []string{"[test.a"}, StartTs: 200}}
+	_, err = newTableStartTsMatcher(cfg, 100)
+	c.Assert(err, check.ErrorMatches, ".*CDC:ErrFilterRuleInvalid.*")
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
 	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"go.etcd.io/etcd/clientv3"
@@ -190,8 +191,8 @@ func (w *TaskWatcher) parseTaskEvent(ctx context.Context, key, val []byte) (*Tas
 		return nil, err
 	}
 
-	taskStatus := &model.TaskStatus{}
-	if err := taskStatus.Unmarshal(val); err != nil {
+	taskStatus, err := kv.UnmarshalTaskStatus(string(key), val)
+	if err != nil {
 		log.Warn("unmarshal task status failed",
 			zap.String("capture-id", w.capture.info.ID),
 			zap.Error(err))
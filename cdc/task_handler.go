@@ -0,0 +1,258 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// taskDebounceWindow is how long the task events of a changefeed are coalesced
+// after the first one, only the final desired state of the events in the
+// window is transited to.
+var taskDebounceWindow = 50 * time.Millisecond
+
+// taskState is the state of the processor of a changefeed in the capture
+type taskState int
+
+// The states of the processor, it's started only in taskStateStopped, and
+// stopped only in taskStateRunning.
+const (
+	taskStateStopped taskState = iota
+	taskStateStarting
+	taskStateRunning
+	taskStateStopping
+)
+
+func (s taskState) String() string {
+	switch s {
+	case taskStateStopped:
+		return "stopped"
+	case taskStateStarting:
+		return "starting"
+	case taskStateRunning:
+		return "running"
+	case taskStateStopping:
+		return "stopping"
+	}
+	return "unknown"
+}
+
+// taskTransitions starts and stops the processors of the changefeeds, it's
+// implemented by the capture. The stop returns after the sink is closed and
+// the task keys are deleted.
+type taskTransitions interface {
+	startTask(ctx context.Context, task *Task) error
+	stopTask(ctx context.Context, changefeedID model.ChangeFeedID) error
+}
+
+// changefeedTask is the transitions of the processor of a changefeed, which
+// are made by one goroutine in order.
+type changefeedTask struct {
+	id     model.ChangeFeedID
+	notify chan struct{}
+
+	// the fields below are protected by the mutex of the taskHandler
+	// pending is the last event not handled yet
+	pending *TaskEvent
+	// receivedAt is when the first event of the pending ones is received
+	receivedAt time.Time
+	// deleted means a delete event is coalesced into the pending event, so
+	// the running processor is stopped even if the final event is a create
+	deleted bool
+	// handling means the events taken are being handled
+	handling bool
+	state    taskState
+
+	// the fields below are only accessed by the goroutine of the changefeed
+	lastStopStart time.Time
+	lastStopDone  time.Time
+}
+
+// taskHandler handles the task events of the capture. The events of a
+// changefeed are coalesced in taskDebounceWindow, and the transitions of each
+// changefeed are serialized on a goroutine, so that the processor is never
+// started before the previous one is cleaned up, which may otherwise leave an
+// orphaned sink when the changefeed is paused and resumed in quick succession.
+type taskHandler struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	transitions taskTransitions
+	window      time.Duration
+
+	mu          sync.Mutex
+	tasks       map[model.ChangeFeedID]*changefeedTask
+	maxHandoff  time.Duration
+	wg          sync.WaitGroup
+	errCh       chan error
+	captureAddr string
+
+	coalescedCounter prometheus.Counter
+	handoffGauge     prometheus.Gauge
+}
+
+func newTaskHandler(ctx context.Context, transitions taskTransitions, captureAddr string) *taskHandler {
+	ctx, cancel := context.WithCancel(ctx)
+	return &taskHandler{
+		ctx:              ctx,
+		cancel:           cancel,
+		transitions:      transitions,
+		window:           taskDebounceWindow,
+		tasks:            make(map[model.ChangeFeedID]*changefeedTask),
+		errCh:            make(chan error, 1),
+		captureAddr:      captureAddr,
+		coalescedCounter: taskCoalescedCounter.WithLabelValues(captureAddr),
+		handoffGauge:     taskHandoffGauge.WithLabelValues(captureAddr),
+	}
+}
+
+// dispatch records the event as the desired state of the changefeed, the
+// transition is made asynchronously, and the errors are sent to errorCh().
+func (h *taskHandler) dispatch(ev *TaskEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := ev.Task.ChangeFeedID
+	t, ok := h.tasks[id]
+	if !ok {
+		t = &changefeedTask{id: id, notify: make(chan struct{}, 1)}
+		h.tasks[id] = t
+		h.wg.Add(1)
+		go h.run(t)
+	}
+	if t.pending != nil {
+		h.coalescedCounter.Inc()
+	} else {
+		t.receivedAt = time.Now()
+	}
+	if ev.Op == TaskOpDelete {
+		t.deleted = true
+	}
+	t.pending = ev
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// errorCh returns the channel of the first error of the transitions
+func (h *taskHandler) errorCh() <-chan error {
+	return h.errCh
+}
+
+// close cancels the transitions in progress and waits for the goroutines
+func (h *taskHandler) close() {
+	h.cancel()
+	h.wg.Wait()
+}
+
+func (h *taskHandler) run(t *changefeedTask) {
+	defer h.wg.Done()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-t.notify:
+		}
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-time.After(h.window):
+		}
+		h.mu.Lock()
+		ev, deleted, receivedAt := t.pending, t.deleted, t.receivedAt
+		t.pending, t.deleted, t.handling = nil, false, ev != nil
+		// the notification of the events taken is dropped
+		select {
+		case <-t.notify:
+		default:
+		}
+		h.mu.Unlock()
+		if ev != nil {
+			if err := h.transit(t, ev, deleted, receivedAt); err != nil {
+				select {
+				case h.errCh <- err:
+				default:
+				}
+				return
+			}
+		}
+		h.mu.Lock()
+		t.handling = false
+		if t.pending == nil && t.state == taskStateStopped {
+			delete(h.tasks, t.id)
+			h.mu.Unlock()
+			return
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *taskHandler) getState(t *changefeedTask) taskState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return t.state
+}
+
+func (h *taskHandler) setState(t *changefeedTask, state taskState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	log.Debug("task state changed", zap.String("changefeed", t.id),
+		zap.Stringer("from", t.state), zap.Stringer("to", state))
+	t.state = state
+}
+
+// transit makes the transitions to the desired state of the event. A running
+// processor is stopped if the event is a delete or a delete is coalesced into
+// it, and then a processor is started if the event is a create.
+func (h *taskHandler) transit(t *changefeedTask, ev *TaskEvent, deleted bool, receivedAt time.Time) error {
+	if h.getState(t) == taskStateRunning && (ev.Op == TaskOpDelete || deleted) {
+		h.setState(t, taskStateStopping)
+		t.lastStopStart = time.Now()
+		if err := h.transitions.stopTask(h.ctx, t.id); err != nil {
+			return errors.Trace(err)
+		}
+		t.lastStopDone = time.Now()
+		h.setState(t, taskStateStopped)
+	}
+	if ev.Op != TaskOpCreate || h.getState(t) != taskStateStopped {
+		return nil
+	}
+	h.setState(t, taskStateStarting)
+	if err := h.transitions.startTask(h.ctx, ev.Task); err != nil {
+		h.setState(t, taskStateStopped)
+		return errors.Trace(err)
+	}
+	h.setState(t, taskStateRunning)
+	// the create is received before the previous processor is stopped, the
+	// handoff is from the stop to the start
+	if !t.lastStopDone.IsZero() && receivedAt.Before(t.lastStopDone) {
+		handoff := time.Since(t.lastStopStart)
+		h.mu.Lock()
+		if handoff > h.maxHandoff {
+			h.maxHandoff = handoff
+			h.handoffGauge.Set(handoff.Seconds())
+		}
+		h.mu.Unlock()
+		log.Info("processor is handed off", zap.String("changefeed", t.id),
+			zap.String("capture", h.captureAddr), zap.Duration("duration", handoff))
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/retry"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type taskHandlerSuite struct{}
+
+var _ = check.Suite(&taskHandlerSuite{})
+
+// mockTaskTransitions opens a sink for each processor started, and closes it
+// some time after the processor is asked to stop, like the processors do.
+type mockTaskTransitions struct {
+	mu sync.Mutex
+	// live is the number of the processors of each changefeed
+	live map[model.ChangeFeedID]int
+	// maxLive is the max number of the live processors of a changefeed
+	maxLive  int
+	sinks    int
+	starts   int
+	stops    int
+	startErr error
+}
+
+func newMockTaskTransitions() *mockTaskTransitions {
+	return &mockTaskTransitions{live: make(map[model.ChangeFeedID]int)}
+}
+
+func (m *mockTaskTransitions) startTask(ctx context.Context, task *Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.startErr != nil {
+		return m.startErr
+	}
+	m.starts++
+	m.sinks++
+	m.live[task.ChangeFeedID]++
+	if m.live[task.ChangeFeedID] > m.maxLive {
+		m.maxLive = m.live[task.ChangeFeedID]
+	}
+	return nil
+}
+
+func (m *mockTaskTransitions) stopTask(ctx context.Context, changefeedID model.ChangeFeedID) error {
+	m.mu.Lock()
+	m.stops++
+	m.mu.Unlock()
+	// the sink is closed and the task keys are deleted
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks--
+	m.live[changefeedID]--
+	return nil
+}
+
+func (m *mockTaskTransitions) snapshot() (live, maxLive, sinks, starts, stops int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range m.live {
+		live += n
+	}
+	return live, m.maxLive, m.sinks, m.starts, m.stops
+}
+
+func newTestTaskHandler(c *check.C, transitions taskTransitions) *taskHandler {
+	h := newTaskHandler(context.Background(), transitions, c.TestName())
+	h.window = 10 * time.Millisecond
+	return h
+}
+
+func testTaskEvent(op TaskEventOp, changefeedID model.ChangeFeedID) *TaskEvent {
+	return &TaskEvent{Op: op, Task: &Task{ChangeFeedID: changefeedID, CheckpointTS: 100}}
+}
+
+// waitTaskSettled waits until no event is pending and the changefeed is in
+// the state, the changefeed is gone once it's stopped.
+func waitTaskSettled(c *check.C, h *taskHandler, changefeedID model.ChangeFeedID, state taskState) {
+	err := retry.Run(10*time.Millisecond, 100, func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		t, ok := h.tasks[changefeedID]
+		if !ok {
+			if state == taskStateStopped {
+				return nil
+			}
+			return errors.Errorf("changefeed %s is not found", changefeedID)
+		}
+		if t.pending != nil || t.handling || t.state != state {
+			return errors.Errorf("changefeed %s is %s, pending %v", changefeedID, t.state, t.pending)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *taskHandlerSuite) TestPauseResumeStress(c *check.C) {
+	defer testleak.AfterTest(c)()
+	transitions := newMockTaskTransitions()
+	h := newTestTaskHandler(c, transitions)
+	defer h.close()
+	const changefeedID = "stress"
+
+	h.dispatch(testTaskEvent(TaskOpCreate, changefeedID))
+	waitTaskSettled(c, h, changefeedID, taskStateRunning)
+	for i := 0; i < 50; i++ {
+		h.dispatch(testTaskEvent(TaskOpDelete, changefeedID))
+		time.Sleep(time.Duration(rand.Intn(3)) * 5 * time.Millisecond)
+		h.dispatch(testTaskEvent(TaskOpCreate, changefeedID))
+		time.Sleep(time.Duration(rand.Intn(3)) * 5 * time.Millisecond)
+	}
+	waitTaskSettled(c, h, changefeedID, taskStateRunning)
+
+	live, maxLive, sinks, starts, stops := transitions.snapshot()
+	c.Assert(live, check.Equals, 1)
+	c.Assert(maxLive, check.Equals, 1)
+	c.Assert(sinks, check.Equals, 1)
+	c.Assert(starts, check.Equals, stops+1)
+	select {
+	case err := <-h.errorCh():
+		c.Fatalf("unexpected error %v", err)
+	default:
+	}
+	// the events in quick succession are coalesced, so there are fewer
+	// transitions than the events
+	c.Assert(starts < 51, check.IsTrue)
+	c.Assert(testutil.ToFloat64(h.coalescedCounter) > 0, check.IsTrue)
+	c.Assert(testutil.ToFloat64(h.handoffGauge) > 0, check.IsTrue)
+
+	h.dispatch(testTaskEvent(TaskOpDelete, changefeedID))
+	waitTaskSettled(c, h, changefeedID, taskStateStopped)
+	live, _, sinks, _, _ = transitions.snapshot()
+	c.Assert(live, check.Equals, 0)
+	c.Assert(sinks, check.Equals, 0)
+}
+
+func (s *taskHandlerSuite) TestCoalesceTaskEvents(c *check.C) {
+	defer testleak.AfterTest(c)()
+	transitions := newMockTaskTransitions()
+	h := newTestTaskHandler(c, transitions)
+	h.window = 100 * time.Millisecond
+	defer h.close()
+
+	// create -> delete -> create of a stopped changefeed is one start
+	h.dispatch(testTaskEvent(TaskOpCreate, "a"))
+	h.dispatch(testTaskEvent(TaskOpDelete, "a"))
+	h.dispatch(testTaskEvent(TaskOpCreate, "a"))
+	// create -> delete of a stopped changefeed makes no transition
+	h.dispatch(testTaskEvent(TaskOpCreate, "b"))
+	h.dispatch(testTaskEvent(TaskOpDelete, "b"))
+	waitTaskSettled(c, h, "a", taskStateRunning)
+	waitTaskSettled(c, h, "b", taskStateStopped)
+	_, _, _, starts, stops := transitions.snapshot()
+	c.Assert(starts, check.Equals, 1)
+	c.Assert(stops, check.Equals, 0)
+	c.Assert(testutil.ToFloat64(h.coalescedCounter), check.Equals, float64(3))
+
+	// a create of the running changefeed makes no transition, but it's
+	// restarted if a delete is coalesced into the create
+	h.dispatch(testTaskEvent(TaskOpCreate, "a"))
+	waitTaskSettled(c, h, "a", taskStateRunning)
+	_, _, _, starts, _ = transitions.snapshot()
+	c.Assert(starts, check.Equals, 1)
+	h.dispatch(testTaskEvent(TaskOpDelete, "a"))
+	h.dispatch(testTaskEvent(TaskOpCreate, "a"))
+	waitTaskSettled(c, h, "a", taskStateRunning)
+	_, _, _, starts, stops = transitions.snapshot()
+	c.Assert(starts, check.Equals, 2)
+	c.Assert(stops, check.Equals, 1)
+}
+
+func (s *taskHandlerSuite) TestTaskTransitionError(c *check.C) {
+	defer testleak.AfterTest(c)()
+	transitions := newMockTaskTransitions()
+	transitions.startErr = errors.New("start processor failed")
+	h := newTestTaskHandler(c, transitions)
+	defer h.close()
+
+	h.dispatch(testTaskEvent(TaskOpCreate, "a"))
+	select {
+	case err := <-h.errorCh():
+		c.Assert(err, check.ErrorMatches, "start processor failed")
+	case <-time.After(5 * time.Second):
+		c.Fatal("the error of the transition is not reported")
+	}
+}
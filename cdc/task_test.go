@@ -56,7 +56,7 @@ func (s *taskSuite) SetUpTest(c *check.C) {
 	}
 	c.Assert(capture, check.NotNil)
 	watcher := NewTaskWatcher(capture, &TaskWatcherConfig{
-		Prefix: kv.TaskStatusKeyPrefix + "/" + capture.info.ID,
+		Prefix: capture.etcdClient.TaskStatusKeyPrefix() + "/" + capture.info.ID,
 	})
 	c.Assert(watcher, check.NotNil)
 
@@ -85,7 +85,7 @@ func (s *taskSuite) TestNewTaskWatcher(c *check.C) {
 	}
 	c.Assert(capture, check.NotNil)
 	c.Assert(NewTaskWatcher(capture, &TaskWatcherConfig{
-		Prefix: kv.TaskStatusKeyPrefix + "/" + capture.info.ID,
+		Prefix: capture.etcdClient.TaskStatusKeyPrefix() + "/" + capture.info.ID,
 	}), check.NotNil)
 	capture.Close(context.Background())
 }
@@ -111,12 +111,12 @@ func (s *taskSuite) setupFeedInfo(c *check.C, changeFeedID string) {
 func (s *taskSuite) teardownFeedInfo(c *check.C, changeFeedID string) {
 	etcd := s.c
 	// Delete change feed info
-	resp, err := etcd.Delete(s.c.Ctx(), kv.GetEtcdKeyChangeFeedInfo(changeFeedID), clientv3.WithPrefix())
+	resp, err := etcd.Delete(s.c.Ctx(), s.w.capture.etcdClient.GetEtcdKeyChangeFeedInfo(changeFeedID), clientv3.WithPrefix())
 	c.Assert(err, check.IsNil)
 	c.Assert(resp, check.NotNil)
 
 	// Delete change feed status(job status)
-	resp, err = etcd.Delete(s.c.Ctx(), kv.GetEtcdKeyJob(changeFeedID), clientv3.WithPrefix())
+	resp, err = etcd.Delete(s.c.Ctx(), s.w.capture.etcdClient.GetEtcdKeyJob(changeFeedID), clientv3.WithPrefix())
 	c.Assert(err, check.IsNil)
 	c.Assert(resp, check.NotNil)
 }
@@ -139,7 +139,7 @@ func (s *taskSuite) TestParseTask(c *check.C) {
 		{"short task key", []byte("test"), nil},
 		{
 			"normal task key",
-			[]byte(kv.GetEtcdKeyTaskStatus(changeFeedID, s.w.capture.info.ID)),
+			[]byte(s.w.capture.etcdClient.GetEtcdKeyTaskStatus(changeFeedID, s.w.capture.info.ID)),
 			&Task{changeFeedID, 1},
 		},
 	}
@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/ticdc/cdc/apply"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/logutil"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyID          string
+	applyUpstreamURI string
+	applySinkURI     string
+	applyConfigFile  string
+	applyTimezone    string
+
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the TiCDC open protocol messages in Kafka to a sink",
+		Long: `Apply the TiCDC open protocol messages in a Kafka topic to a sink. The messages
+of all the partitions are applied after the partitions are resolved, and the
+DDLs are executed after all the rows before them are applied. The consumed
+offsets are committed to the consumer group with the resolved ts, so the apply
+is resumed from the last committed offsets after it's restarted.`,
+		RunE: runEApply,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVar(&applyID, "id", "apply", "ID of the apply, which is used as the changefeed ID of the sink")
+	applyCmd.Flags().StringVar(&applyUpstreamURI, "upstream-uri", "", "upstream uri, e.g. kafka://127.0.0.1:9092/topic?version=2.4.0&consumer-group-id=ticdc-apply")
+	applyCmd.Flags().StringVar(&applySinkURI, "sink-uri", "", "sink uri")
+	applyCmd.Flags().StringVar(&applyConfigFile, "config", "", "path of the changefeed config file")
+	applyCmd.Flags().StringVar(&applyTimezone, "tz", "System", "time zone of the sink")
+	applyCmd.Flags().StringVar(&logFile, "log-file", "", "log file path")
+	applyCmd.Flags().StringVar(&logLevel, "log-level", "info", "log level (etc: debug|info|warn|error)")
+	addSecurityFlags(applyCmd.Flags(), false /* isServer */)
+	_ = applyCmd.MarkFlagRequired("upstream-uri")
+	_ = applyCmd.MarkFlagRequired("sink-uri")
+}
+
+func runEApply(cmd *cobra.Command, args []string) error {
+	cancel := initCmd(cmd, &logutil.Config{File: logFile, Level: logLevel})
+	defer cancel()
+	tz, err := util.GetTimezone(applyTimezone)
+	if err != nil {
+		return errors.Annotate(err, "can not load timezone")
+	}
+	cfg := config.GetDefaultReplicaConfig()
+	if len(applyConfigFile) > 0 {
+		if err := strictDecodeFile(applyConfigFile, "cdc", cfg); err != nil {
+			return err
+		}
+	}
+	if err := config.ValidateDDLUnsupportedAction(cfg.DDLUnsupportedAction); err != nil {
+		return err
+	}
+	if err := config.ValidateDDLTimeout(cfg.DDLTimeoutSeconds); err != nil {
+		return err
+	}
+
+	ctx := util.PutTimezoneInCtx(defaultContext, tz)
+	ctx = util.PutChangefeedIDInCtx(ctx, applyID)
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	err = apply.Run(ctx, applyID, applyUpstreamURI, applySinkURI, cfg, getCredential())
+	if errors.Cause(err) == context.Canceled {
+		return nil
+	}
+	return err
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/pkg/logutil"
+	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/pingcap/ticdc/pkg/version"
 	"github.com/spf13/cobra"
 	pd "github.com/tikv/pd/client"
@@ -43,6 +44,7 @@ import (
 func init() {
 	cliCmd := newCliCommand()
 	cliCmd.PersistentFlags().StringVar(&cliPdAddr, "pd", "http://127.0.0.1:2379", "PD address, use ',' to separate multiple PDs")
+	cliCmd.PersistentFlags().StringVar(&clusterID, "cluster-id", "", "ID of the TiCDC cluster to operate on, must be the same as the cluster-id of the servers")
 	cliCmd.PersistentFlags().BoolVarP(&interact, "interact", "i", false, "Run cdc cli with readline")
 	cliCmd.PersistentFlags().StringVar(&cliLogLevel, "log-level", "warn", "log level (etc: debug|info|warn|error)")
 	addSecurityFlags(cliCmd.PersistentFlags(), false /* isServer */)
@@ -56,6 +58,7 @@ var (
 	sinkURI    string
 	configFile string
 	cliPdAddr  string
+	clusterID  string
 	noConfirm  bool
 	sortEngine string
 	sortDir    string
@@ -72,16 +75,47 @@ var (
 	simplified        bool
 	cliLogLevel       string
 	changefeedListAll bool
+	historyOffset     int
+	historyLimit      int
+	listTableName     string
 
 	changefeedID            string
 	captureID               string
 	interval                uint
+	statisticsWindow        time.Duration
+	statisticsByStore       bool
 	disableGCSafePointCheck bool
 
 	syncPointEnabled  bool
 	syncPointInterval time.Duration
 
-	optForceRemove bool
+	snapshotOnly bool
+	showDefaults bool
+
+	metadataKey string
+
+	optForceRemove  bool
+	optSkipDDLJobID int64
+
+	optCleanupDownstream bool
+	optDeleteTopics      bool
+
+	optOverwriteCheckpointTs    uint64
+	optForceOverwriteCheckpoint bool
+
+	optMemoryQuota     int64
+	optEventsPerSecond int
+
+	optBreakerNote string
+
+	optRebalanceDryRun bool
+
+	optUpdateDryRun bool
+
+	forceTableID    int64
+	forceResolvedTs uint64
+
+	refreshGCSafepoint bool
 
 	defaultContext context.Context
 )
@@ -105,6 +139,9 @@ type cfMeta struct {
 	Status     *model.ChangeFeedStatus `json:"status"`
 	Count      uint64                  `json:"count"`
 	TaskStatus []captureTaskStatus     `json:"task-status"`
+	// SessionVariables are the session variables set on the downstream
+	// connections of the MySQL sink, sensitive values are masked.
+	SessionVariables map[string]string `json:"session-variables,omitempty"`
 }
 
 type captureTaskStatus struct {
@@ -124,12 +161,20 @@ type processorMeta struct {
 	Position *model.TaskPosition `json:"position"`
 }
 
+// annotationOffline annotates the commands which don't connect to the cluster
+const annotationOffline = "offline"
+
 func newCliCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "cli",
 		Short: "Manage replication task and TiCDC cluster",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			initCmd(cmd, &logutil.Config{Level: cliLogLevel})
+			// printing the default changefeed config and the offline commands
+			// don't need the cluster
+			if showDefaults || cmd.Annotations[annotationOffline] == "true" {
+				return nil
+			}
 
 			credential := getCredential()
 			tlsConfig, err := credential.ToTLSConfig()
@@ -176,6 +221,7 @@ func newCliCommand() *cobra.Command {
 				// PD embeds an etcd server.
 				return errors.Annotatef(err, "fail to open PD etcd client, pd-addr=\"%s\"", cliPdAddr)
 			}
+			defaultContext = util.PutClusterIDInCtx(defaultContext, clusterID)
 			cdcEtcdCli = kv.NewCDCEtcdClient(defaultContext, etcdCli)
 			pdCli, err = pd.NewClientWithContext(
 				defaultContext, pdEndpoints, credential.PDSecurityOption(),
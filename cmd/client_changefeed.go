@@ -14,18 +14,25 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/google/uuid"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/cdc"
+	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/cdc/sink/cdclog"
 	"github.com/pingcap/ticdc/pkg/config"
 	"github.com/pingcap/ticdc/pkg/cyclic"
 	"github.com/pingcap/ticdc/pkg/cyclic/mark"
@@ -51,10 +58,15 @@ func newChangefeedCommand() *cobra.Command {
 	command.AddCommand(
 		newListChangefeedCommand(),
 		newQueryChangefeedCommand(),
+		newHistoryChangefeedCommand(),
+		newListTablesChangefeedCommand(),
+		newListOperationsChangefeedCommand(),
 		newCreateChangefeedCommand(),
 		newUpdateChangefeedCommand(),
+		newShowConfigChangefeedCommand(),
 		newStatisticsChangefeedCommand(),
 		newCreateChangefeedCyclicCommand(),
+		newVerifyLogChangefeedCommand(),
 	)
 	// Add pause, resume, remove changefeed
 	for _, cmd := range newAdminChangefeedCommand() {
@@ -86,6 +98,15 @@ func newAdminChangefeedCommand() []*cobra.Command {
 					CfID: changefeedID,
 					Type: model.AdminResume,
 				}
+				if optOverwriteCheckpointTs != 0 {
+					err := verifyOverwriteCheckpointTs(ctx, changefeedID, optOverwriteCheckpointTs, optForceOverwriteCheckpoint)
+					if err != nil {
+						return err
+					}
+					job.Opts = &model.AdminJobOption{
+						OverwriteCheckpointTs: optOverwriteCheckpointTs,
+					}
+				}
 				return applyAdminChangefeed(ctx, job, getCredential())
 			},
 		},
@@ -101,7 +122,79 @@ func newAdminChangefeedCommand() []*cobra.Command {
 						ForceRemove: optForceRemove,
 					},
 				}
-				return applyAdminChangefeed(ctx, job, getCredential())
+				if optDeleteTopics && !optCleanupDownstream {
+					return errors.New("delete-topics requires cleanup-downstream")
+				}
+				// the info is read before it's removed by the force removal
+				var info *model.ChangeFeedInfo
+				if optCleanupDownstream {
+					var err error
+					info, err = cdcEtcdCli.GetChangeFeedInfo(ctx, changefeedID)
+					if err != nil {
+						return err
+					}
+					if err := info.VerifyAndFix(); err != nil {
+						return err
+					}
+				}
+				err := applyAdminChangefeed(ctx, job, getCredential())
+				if err != nil || info == nil {
+					return err
+				}
+				return cleanupChangefeedDownstream(ctx, cmd, changefeedID, info)
+			},
+		},
+		{
+			Use:   "skip-ddl",
+			Short: "Skip executing a queued DDL in the downstream of a replicaiton task (changefeed)",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := defaultContext
+				return applySkipDDLOnce(ctx, changefeedID, optSkipDDLJobID, getCredential())
+			},
+		},
+		{
+			Use:   "set-budget",
+			Short: "Update the budget of a running replication task (changefeed) on each capture",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := defaultContext
+				// the budget not specified is not changed
+				memoryQuota, eventsPerSecond := int64(-1), -1
+				if cmd.Flag("memory-quota").Changed {
+					memoryQuota = optMemoryQuota
+				}
+				if cmd.Flag("events-per-second").Changed {
+					eventsPerSecond = optEventsPerSecond
+				}
+				if memoryQuota < 0 && eventsPerSecond < 0 {
+					return errors.New("neither memory-quota nor events-per-second is specified")
+				}
+				return applyUpdateBudget(ctx, changefeedID, memoryQuota, eventsPerSecond, getCredential())
+			},
+		},
+		{
+			Use:   "reset-breaker",
+			Short: "Reset the circuit breaker of a replication task (changefeed), the paused tables are resumed",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := defaultContext
+				if strings.TrimSpace(optBreakerNote) == "" {
+					return errors.New("the acknowledgment note is required")
+				}
+				return applyResetBreaker(ctx, changefeedID, optBreakerNote, getCredential())
+			},
+		},
+		{
+			Use:   "rebalance",
+			Short: "Rebalance the tables of a replication task (changefeed) across the captures",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := defaultContext
+				if !optRebalanceDryRun {
+					return applyRebalanceTrigger(ctx, changefeedID, getCredential())
+				}
+				plan, err := applyOwnerRebalancePlan(ctx, changefeedID, getCredential())
+				if err != nil {
+					return err
+				}
+				return jsonPrint(cmd, plan)
 			},
 		},
 	}
@@ -111,11 +204,103 @@ func newAdminChangefeedCommand() []*cobra.Command {
 		_ = cmd.MarkPersistentFlagRequired("changefeed-id")
 		if cmd.Use == "remove" {
 			cmd.PersistentFlags().BoolVarP(&optForceRemove, "force", "f", false, "remove all information of the changefeed")
+			cmd.PersistentFlags().BoolVar(&optCleanupDownstream, "cleanup-downstream", false,
+				"Clean up the mark tables and the syncpoint records of the changefeed in the downstream after it's removed")
+			cmd.PersistentFlags().BoolVar(&optDeleteTopics, "delete-topics", false,
+				"Delete the topics created by the changefeed automatically in the downstream, requires cleanup-downstream")
+		}
+		if cmd.Use == "resume" {
+			cmd.PersistentFlags().Uint64Var(&optOverwriteCheckpointTs, "overwrite-checkpoint-ts", 0,
+				"Resume the paused changefeed from this ts instead of its checkpoint ts, e.g. the ts the downstream is restored to")
+			cmd.PersistentFlags().BoolVar(&optForceOverwriteCheckpoint, "force", false,
+				"Allow the overwrite-checkpoint-ts after the checkpoint ts, the changes between them are skipped")
+		}
+		if cmd.Use == "skip-ddl" {
+			cmd.PersistentFlags().Int64Var(&optSkipDDLJobID, "skip-ddl-once", 0, "ID of the queued DDL job to skip")
+			_ = cmd.MarkPersistentFlagRequired("skip-ddl-once")
+		}
+		if cmd.Use == "reset-breaker" {
+			cmd.PersistentFlags().StringVar(&optBreakerNote, "note", "",
+				"Acknowledgment note of the trips, which is recorded in the changefeed history")
+			_ = cmd.MarkPersistentFlagRequired("note")
+		}
+		if cmd.Use == "rebalance" {
+			cmd.PersistentFlags().BoolVar(&optRebalanceDryRun, "dry-run", false,
+				"Print the tables the rebalance would move and the projected skewness, without moving them")
+		}
+		if cmd.Use == "set-budget" {
+			cmd.PersistentFlags().Int64Var(&optMemoryQuota, "memory-quota", 0,
+				"Memory quota in bytes of the changefeed on each capture, 0 means the default quota")
+			cmd.PersistentFlags().IntVar(&optEventsPerSecond, "events-per-second", 0,
+				"Row changed events per second of the changefeed on each capture, 0 means unlimited")
 		}
 	}
 	return cmds
 }
 
+// waitChangefeedRemoved waits for the owner to remove the changefeed, so that
+// the downstream artifacts are not written again after they are cleaned up.
+func waitChangefeedRemoved(ctx context.Context, id model.ChangeFeedID) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		status, _, err := cdcEtcdCli.GetChangeFeedStatus(ctx, id)
+		if cerror.ErrChangeFeedNotExists.Equal(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if status.AdminJobType == model.AdminRemove {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), "the changefeed is not removed in time")
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupChangefeedDownstream cleans up the downstream artifacts of the
+// removed changefeed and reports the result of each of them. The changefeed
+// stays removed if any of them fails to be cleaned up.
+func cleanupChangefeedDownstream(ctx context.Context, cmd *cobra.Command, id model.ChangeFeedID, info *model.ChangeFeedInfo) error {
+	if err := waitChangefeedRemoved(ctx, id); err != nil {
+		return errors.Annotate(err, "the downstream is not cleaned up")
+	}
+	opts := sink.CleanupOptions{DeleteTopics: optDeleteTopics}
+	if info.Config.Cyclic.IsEnabled() {
+		ts, logical, err := pdCli.GetTS(ctx)
+		if err != nil {
+			return err
+		}
+		_, opts.Tables, err = verifyTables(ctx, getCredential(), info.Config, oracle.ComposeTS(ts, logical))
+		if err != nil {
+			return err
+		}
+	}
+	results, err := sink.CleanupDownstream(ctx, id, info, opts)
+	if err != nil {
+		return errors.Annotate(err, "the changefeed is removed, but the downstream is not cleaned up")
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			cmd.Printf("Failed to clean up %s: %s\n", result.Item, result.Err)
+		} else {
+			cmd.Printf("Cleaned up %s\n", result.Item)
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("the changefeed is removed, but %d of %d downstream artifacts are not cleaned up", failed, len(results))
+	}
+	return nil
+}
+
 func newListChangefeedCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "list",
@@ -204,7 +389,9 @@ func newQueryChangefeedCommand() *cobra.Command {
 				taskStatus = append(taskStatus, captureTaskStatus{CaptureID: captureID, TaskStatus: status})
 			}
 			meta := &cfMeta{Info: info, Status: status, Count: count, TaskStatus: taskStatus}
-			if info == nil {
+			if info != nil {
+				meta.SessionVariables = sink.SessionVariables(info.SinkURI)
+			} else {
 				log.Warn("this changefeed has been deleted, the residual meta data will be completely deleted within 24 hours.")
 			}
 			return jsonPrint(cmd, meta)
@@ -216,6 +403,84 @@ func newQueryChangefeedCommand() *cobra.Command {
 	return command
 }
 
+func newHistoryChangefeedCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "history",
+		Short: "Query the lifecycle event history of a replication task (changefeed), from the newest to the oldest",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := defaultContext
+			resp, err := applyOwnerChangefeedHistory(ctx, changefeedID, historyOffset, historyLimit, getCredential())
+			if err == nil {
+				return jsonPrint(cmd, resp)
+			}
+			// if no owner is available, read the history from etcd, which
+			// lacks the events not flushed by the owner.
+			log.Warn("query changefeed history from owner failed", zap.String("error", err.Error()))
+			_, history, err := cdcEtcdCli.GetChangeFeedHistory(ctx, changefeedID)
+			if err != nil {
+				return err
+			}
+			return jsonPrint(cmd, &cdc.ChangefeedHistoryResp{
+				Total:  len(history.Events),
+				Events: history.Page(historyOffset, historyLimit),
+			})
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	command.PersistentFlags().IntVar(&historyOffset, "offset", 0, "Number of the newest events to skip")
+	command.PersistentFlags().IntVar(&historyLimit, "limit", 20, "Maximum number of events to show, 0 means no limit")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	return command
+}
+
+func newListTablesChangefeedCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "list-tables",
+		Short: "List the tables of a replication task (changefeed) with the captures replicating them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := defaultContext
+			if listTableName != "" && len(strings.Split(listTableName, ".")) != 2 {
+				return errors.Errorf("invalid table name %s, it should be in the form of schema.table", listTableName)
+			}
+			kvStore, err := kv.CreateTiStore(cliPdAddr, getCredential())
+			if err != nil {
+				return err
+			}
+			defer kvStore.Close() //nolint:errcheck
+			tables, err := cdc.ListChangefeedTables(ctx, cdcEtcdCli, kvStore, changefeedID, listTableName)
+			if err != nil {
+				return err
+			}
+			return jsonPrint(cmd, tables)
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	command.PersistentFlags().StringVar(&listTableName, "table", "", "Only list the table with the name, in the form of schema.table")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	return command
+}
+
+func newListOperationsChangefeedCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "operations",
+		Short: "List the table operations of a replication task (changefeed) pending on the captures",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operations, err := cdc.ListChangefeedOperations(defaultContext, cdcEtcdCli, changefeedID)
+			if err != nil {
+				return err
+			}
+			return jsonPrint(cmd, operations)
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	return command
+}
+
+// memorySortTableCountThreshold is the number of tables, above which the memory
+// sort engine is warned to be used on creating a changefeed.
+const memorySortTableCountThreshold = 100
+
 func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate bool, credential *security.Credential) (*model.ChangeFeedInfo, error) {
 	if isCreate {
 		if sinkURI == "" {
@@ -237,14 +502,80 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 	}
 
 	cfg := config.GetDefaultReplicaConfig()
+	var configText string
 	if len(configFile) > 0 {
 		if err := strictDecodeFile(configFile, "cdc", cfg); err != nil {
 			return nil, err
 		}
+		var err error
+		configText, err = readConfigText(cmd, configFile)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if disableGCSafePointCheck {
 		cfg.CheckGCSafePoint = false
 	}
+	if isCreate {
+		if err := verifyTableStartTs(ctx, cfg, startTs, targetTs); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifySortEngine(model.SortEngine(sortEngine), sortDir); err != nil {
+		return nil, err
+	}
+	if cfg.Notify != nil {
+		if err := cfg.Notify.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Latency != nil {
+		if err := cfg.Latency.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SchemaCheck != nil {
+		if err := cfg.SchemaCheck.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ValidateDDLUnsupportedAction(cfg.DDLUnsupportedAction); err != nil {
+		return nil, err
+	}
+	if err := config.ValidateDDLTimeout(cfg.DDLTimeoutSeconds); err != nil {
+		return nil, err
+	}
+	if cfg.Mounter != nil {
+		if err := cfg.Mounter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ValidateCompleteness(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateCompact(); err != nil {
+		return nil, err
+	}
+	if cfg.CircuitBreaker != nil {
+		if err := cfg.CircuitBreaker.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Scheduler != nil {
+		if err := cfg.Scheduler.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CheckpointGuard != nil {
+		if err := cfg.CheckpointGuard.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ThrottleSchedule != nil {
+		if err := cfg.ThrottleSchedule.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	if cyclicReplicaID != 0 || len(cyclicFilterReplicaIDs) != 0 {
 		if !(cyclicReplicaID != 0 && len(cyclicFilterReplicaIDs) != 0) {
 			return nil, errors.New("invaild cyclic config, please make sure using " +
@@ -263,6 +594,12 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 		}
 	}
 
+	if isCreate && snapshotOnly {
+		if err := verifySnapshotOnly(cfg, targetTs, syncPointEnabled); err != nil {
+			return nil, err
+		}
+	}
+
 	if !cfg.EnableOldValue {
 		sinkURIParsed, err := url.Parse(sinkURI)
 		if err != nil {
@@ -306,6 +643,8 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 		State:             model.StateNormal,
 		SyncPointEnabled:  syncPointEnabled,
 		SyncPointInterval: syncPointInterval,
+		SnapshotOnly:      isCreate && snapshotOnly,
+		ConfigText:        configText,
 	}
 
 	tz, err := util.GetTimezone(timezone)
@@ -322,6 +661,7 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 		if len(ineligibleTables) != 0 {
 			if cfg.ForceReplicate {
 				cmd.Printf("[WARN] force to replicate some ineligible tables, %#v\n", ineligibleTables)
+				warnRowIdentityAmbiguity(cmd, sinkURI)
 			} else {
 				cmd.Printf("[WARN] some tables are not eligible to replicate, %#v\n", ineligibleTables)
 				if !noConfirm {
@@ -338,6 +678,17 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 				}
 			}
 		}
+		if info.Engine == model.SortInMemory && len(eligibleTables) > memorySortTableCountThreshold {
+			cmd.Printf("[WARN] the memory sort engine is used to replicate %d tables, which may run out of memory, "+
+				"the unified sort engine is recommended\n", len(eligibleTables))
+		}
+		replicatedTables := eligibleTables
+		if cfg.ForceReplicate {
+			replicatedTables = append(replicatedTables, ineligibleTables...)
+		}
+		if err := sink.CheckTableTargets(cfg, replicatedTables); err != nil {
+			return nil, err
+		}
 		if cfg.Cyclic.IsEnabled() && !cyclic.IsTablesPaired(eligibleTables) {
 			return nil, errors.New("normal tables and mark tables are not paired, " +
 				"please run `cdc cli changefeed cyclic create-marktables`")
@@ -361,6 +712,10 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 		info.Opts[key] = value
 	}
 
+	err = sink.ValidateConfig(info.SinkURI, info.Config)
+	if err != nil {
+		return nil, err
+	}
 	err = verifySink(ctx, info.SinkURI, info.Config, info.Opts)
 	if err != nil {
 		return nil, err
@@ -368,6 +723,28 @@ func verifyChangefeedParamers(ctx context.Context, cmd *cobra.Command, isCreate
 	return info, nil
 }
 
+// warnRowIdentityAmbiguity warns that the rows of the tables without handle
+// key can't be told apart if the _tidb_rowid is not used.
+func warnRowIdentityAmbiguity(cmd *cobra.Command, sinkURI string) {
+	sinkURIParsed, err := url.Parse(sinkURI)
+	if err != nil {
+		return
+	}
+	if enable, _ := strconv.ParseBool(sinkURIParsed.Query().Get(sink.OptEnableTiDBRowID)); enable {
+		return
+	}
+	switch strings.ToLower(sinkURIParsed.Scheme) {
+	case "mysql", "mysql+ssl", "tidb", "tidb+ssl":
+		cmd.Printf("[WARN] UPDATE and DELETE of the tables without primary key or not null unique key " +
+			"are applied by matching all columns with LIMIT 1, which is ambiguous if there are duplicate rows. " +
+			"If the downstream is TiDB and the rows have the same _tidb_rowid as the upstream, " +
+			"add `enable-tidb-rowid=true` to the sink URI to match the rows by _tidb_rowid\n")
+	case "kafka", "pulsar", "pulsar+ssl":
+		cmd.Printf("[WARN] the duplicate rows of the tables without primary key or not null unique key " +
+			"can't be told apart by the consumers, add `enable-tidb-rowid=true` to the sink URI to output the _tidb_rowid\n")
+	}
+}
+
 func changefeedConfigVariables(command *cobra.Command) {
 	command.PersistentFlags().Uint64Var(&startTs, "start-ts", 0, "Start ts of changefeed")
 	command.PersistentFlags().Uint64Var(&targetTs, "target-ts", 0, "Target ts of changefeed")
@@ -384,12 +761,26 @@ func changefeedConfigVariables(command *cobra.Command) {
 	command.PersistentFlags().DurationVar(&syncPointInterval, "sync-interval", 10*time.Minute, "(Expremental) Set the interval for syncpoint in replication(default 10min)")
 }
 
+// printDefaultReplicaConfig prints the default config of a changefeed in the
+// format of the config file
+func printDefaultReplicaConfig(cmd *cobra.Command) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(config.GetDefaultReplicaConfig()); err != nil {
+		return errors.Trace(err)
+	}
+	cmd.Print(buf.String())
+	return nil
+}
+
 func newCreateChangefeedCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "create",
 		Short: "Create a new replication task (changefeed)",
 		Long:  ``,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if showDefaults {
+				return printDefaultReplicaConfig(cmd)
+			}
 			ctx := defaultContext
 			id := changefeedID
 			if id == "" {
@@ -412,6 +803,17 @@ func newCreateChangefeedCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			err = cdcEtcdCli.AppendChangeFeedHistory(ctx, id, &model.ChangefeedEvent{
+				Time:    time.Now(),
+				Type:    model.ChangefeedEventCreate,
+				Client:  clientInfo(),
+				Ts:      info.StartTs,
+				Message: "changefeed is created",
+			})
+			if err != nil {
+				// the changefeed is created, failing to record the history is not fatal
+				log.Warn("failed to record changefeed history", zap.String("changefeed", id), zap.Error(err))
+			}
 			cmd.Printf("Create changefeed successfully!\nID: %s\nInfo: %s\n", id, infoStr)
 			return nil
 		},
@@ -420,6 +822,8 @@ func newCreateChangefeedCommand() *cobra.Command {
 	command.PersistentFlags().BoolVar(&noConfirm, "no-confirm", false, "Don't ask user whether to ignore ineligible table")
 	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
 	command.PersistentFlags().BoolVarP(&disableGCSafePointCheck, "disable-gc-check", "", false, "Disable GC safe point check")
+	command.PersistentFlags().BoolVar(&snapshotOnly, "snapshot-only", false, "Only replicate the snapshot of the tables at start-ts, the changefeed finishes once the snapshot is replicated")
+	command.PersistentFlags().BoolVar(&showDefaults, "show-defaults", false, "Print the default config of the changefeed in the format of the config file, and exit")
 
 	return command
 }
@@ -447,29 +851,41 @@ func newUpdateChangefeedCommand() *cobra.Command {
 			info.StartTs = old.StartTs
 			info.ErrorHis = old.ErrorHis
 			info.Error = old.Error
-
-			resp, err := applyOwnerChangefeedQuery(ctx, changefeedID, getCredential())
-			// if no cdc owner exists, allow user to update changefeed config
-			if err != nil && errors.Cause(err) != errOwnerNotFound {
-				return err
+			info.SnapshotOnly = old.SnapshotOnly
+			// The sort engine and the sort dir are kept if they are not
+			// specified, they take effect for all tables on resume.
+			if !cmd.Flags().Changed("sort-engine") {
+				info.Engine = old.Engine
 			}
-			// Note that the correctness of the logic here depends on the return value of `/capture/owner/changefeed/query` interface.
-			// TODO: Using error codes instead of string containing judgments
-			if err == nil && !strings.Contains(resp, `"state": "stopped"`) {
-				return errors.Errorf("can only update changefeed config when it is stopped\nstatus: %s", resp)
+			if !cmd.Flags().Changed("sort-dir") {
+				info.SortDir = old.SortDir
+			}
+
+			// the diff is only output on the dry run, which is allowed while
+			// the changefeed is running
+			if !optUpdateDryRun {
+				resp, err := applyOwnerChangefeedQuery(ctx, changefeedID, getCredential())
+				// if no cdc owner exists, allow user to update changefeed config
+				if err != nil && errors.Cause(err) != errOwnerNotFound {
+					return err
+				}
+				// Note that the correctness of the logic here depends on the return value of `/capture/owner/changefeed/query` interface.
+				// TODO: Using error codes instead of string containing judgments
+				if err == nil && !strings.Contains(resp, `"state": "stopped"`) {
+					return errors.Errorf("can only update changefeed config when it is stopped\nstatus: %s", resp)
+				}
 			}
 
-			changelog, err := diff.Diff(old, info)
+			changed, err := printChangefeedInfoDiff(cmd, old, info)
 			if err != nil {
 				return err
 			}
-			if len(changelog) == 0 {
+			if !changed {
 				cmd.Printf("changefeed config is the same with the old one, do nothing\n")
 				return nil
 			}
-			cmd.Printf("Diff of changefeed config:\n")
-			for _, change := range changelog {
-				cmd.Printf("%+v\n", change)
+			if optUpdateDryRun {
+				return nil
 			}
 
 			if !noConfirm {
@@ -502,17 +918,111 @@ func newUpdateChangefeedCommand() *cobra.Command {
 	changefeedConfigVariables(command)
 	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
 	command.PersistentFlags().BoolVar(&noConfirm, "no-confirm", false, "Don't ask user whether to confirm update changefeed config")
+	command.PersistentFlags().BoolVar(&optUpdateDryRun, "dry-run", false, "Output the diff of the changefeed config without updating it")
 	_ = command.MarkPersistentFlagRequired("changefeed-id")
 
 	return command
 }
 
+// printChangefeedInfoDiff prints the field-level diff of the config, and the
+// diff of the other fields of the changefeed info, it returns whether there is
+// any change.
+func printChangefeedInfoDiff(cmd *cobra.Command, old, info *model.ChangeFeedInfo) (bool, error) {
+	configChanges, err := config.DiffConfig(old.Config, info.Config)
+	if err != nil {
+		return false, err
+	}
+	// the config and the original file of it are diffed by the fields of
+	// the config
+	oldInfo, newInfo := *old, *info
+	oldInfo.Config, oldInfo.ConfigText = nil, ""
+	newInfo.Config, newInfo.ConfigText = nil, ""
+	changelog, err := diff.Diff(&oldInfo, &newInfo)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if len(configChanges) != 0 {
+		cmd.Printf("Diff of changefeed config:\n")
+		for _, change := range configChanges {
+			cmd.Printf("%s\n", change)
+		}
+	}
+	if len(changelog) != 0 {
+		cmd.Printf("Diff of changefeed info:\n")
+		for _, change := range changelog {
+			cmd.Printf("%+v\n", change)
+		}
+	}
+	return len(configChanges) != 0 || len(changelog) != 0, nil
+}
+
+func newShowConfigChangefeedCommand() *cobra.Command {
+	var original, effective bool
+	command := &cobra.Command{
+		Use:   "show-config",
+		Short: "Show the config of a replication task (changefeed)",
+		Long: `Show the config of a replication task (changefeed).
+With --effective, which is the default, the normalized config the changefeed runs with is output in the format
+of the config file. With --original, the config file the changefeed is created or last updated with is output.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if original && effective {
+				return errors.New("--original and --effective can't be specified together")
+			}
+			info, err := cdcEtcdCli.GetChangeFeedInfo(defaultContext, changefeedID)
+			if err != nil {
+				return err
+			}
+			if original {
+				if info.ConfigText == "" {
+					return errors.Errorf("the original config file of changefeed %s is not stored, "+
+						"it's created or updated without --config, or the file is larger than %d bytes",
+						changefeedID, model.MaxConfigTextSize)
+				}
+				cmd.Print(info.ConfigText)
+				return nil
+			}
+			var buf bytes.Buffer
+			if err := toml.NewEncoder(&buf).Encode(info.Config); err != nil {
+				return errors.Trace(err)
+			}
+			cmd.Print(buf.String())
+			return nil
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	command.PersistentFlags().BoolVar(&original, "original", false, "Output the original config file of the changefeed")
+	command.PersistentFlags().BoolVar(&effective, "effective", false, "Output the effective config of the changefeed")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	return command
+}
+
 func newStatisticsChangefeedCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "statistics",
 		Short: "Periodically check and output the status of a replicaiton task (changefeed)",
+		Long: `Periodically check and output the status of a replicaiton task (changefeed).
+With --window, the rows and bytes replicated per table in the window are output once instead.
+With --by-store, the events and bytes pulled from each TiKV store in the window (1m by default) are output once instead.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := defaultContext
+			if statisticsByStore {
+				window := statisticsWindow
+				if window <= 0 {
+					window = time.Minute
+				}
+				metrics, err := getChangefeedMetrics(ctx, changefeedID, window, getCredential())
+				if err != nil {
+					return err
+				}
+				return jsonPrint(cmd, aggregateStoreStatistics(metrics))
+			}
+			if statisticsWindow > 0 {
+				metrics, err := getChangefeedMetrics(ctx, changefeedID, statisticsWindow, getCredential())
+				if err != nil {
+					return err
+				}
+				return jsonPrint(cmd, aggregateTableStatistics(metrics))
+			}
 			tick := time.NewTicker(time.Duration(interval) * time.Second)
 			lastTime := time.Now()
 			var lastCount uint64
@@ -557,10 +1067,154 @@ func newStatisticsChangefeedCommand() *cobra.Command {
 	}
 	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
 	command.PersistentFlags().UintVarP(&interval, "interval", "I", 10, "Interval for outputing the latest statistics")
+	command.PersistentFlags().DurationVar(&statisticsWindow, "window", 0, "Output the rows and bytes replicated per table in the window (at most 1h, e.g. 10m) once")
+	command.PersistentFlags().BoolVar(&statisticsByStore, "by-store", false, "Output the events and bytes pulled from each TiKV store in the window once")
 	_ = command.MarkPersistentFlagRequired("changefeed-id")
 	return command
 }
 
+// tableReplicationStatistics is the rows and bytes of a table replicated in
+// the statistics window, the rates are per second.
+type tableReplicationStatistics struct {
+	Table          string  `json:"table"`
+	RowsPerSecond  float64 `json:"rows-per-second"`
+	BytesPerSecond float64 `json:"bytes-per-second"`
+	Rows           uint64  `json:"rows"`
+	Bytes          uint64  `json:"bytes"`
+}
+
+func (s *tableReplicationStatistics) add(other *tableReplicationStatistics) {
+	s.RowsPerSecond += other.RowsPerSecond
+	s.BytesPerSecond += other.BytesPerSecond
+	s.Rows += other.Rows
+	s.Bytes += other.Bytes
+}
+
+// changefeedReplicationStatistics is the output of the statistics command
+// with a window, the tables are sorted by the rows per second in descending
+// order.
+type changefeedReplicationStatistics struct {
+	Tables []*tableReplicationStatistics `json:"tables"`
+	Total  *tableReplicationStatistics   `json:"total"`
+	// Errors are the errors of reading the processors, keyed by the captures
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// aggregateTableStatistics sums up the statistics of the tables across the
+// captures. The rate of a table on a capture is computed with the window
+// covered by its processor, a table moved between the captures in the window
+// is counted by both of them.
+func aggregateTableStatistics(metrics *cdc.ChangefeedMetricsResp) *changefeedReplicationStatistics {
+	tables := make(map[string]*tableReplicationStatistics)
+	result := &changefeedReplicationStatistics{Total: &tableReplicationStatistics{Table: "total"}}
+	for _, capture := range metrics.Captures {
+		if capture.ProcessorError != "" {
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[capture.AdvertiseAddr] = capture.ProcessorError
+		}
+		p := capture.Processor
+		if p == nil {
+			continue
+		}
+		for _, table := range p.Tables {
+			stats := &tableReplicationStatistics{Table: table.Table, Rows: table.Rows, Bytes: table.Bytes}
+			if p.StatisticsWindow > 0 {
+				stats.RowsPerSecond = float64(table.Rows) / p.StatisticsWindow
+				stats.BytesPerSecond = float64(table.Bytes) / p.StatisticsWindow
+			}
+			if _, ok := tables[table.Table]; !ok {
+				tables[table.Table] = &tableReplicationStatistics{Table: table.Table}
+			}
+			tables[table.Table].add(stats)
+			result.Total.add(stats)
+		}
+	}
+	result.Tables = make([]*tableReplicationStatistics, 0, len(tables))
+	for _, table := range tables {
+		result.Tables = append(result.Tables, table)
+	}
+	sort.Slice(result.Tables, func(i, j int) bool {
+		if result.Tables[i].RowsPerSecond != result.Tables[j].RowsPerSecond {
+			return result.Tables[i].RowsPerSecond > result.Tables[j].RowsPerSecond
+		}
+		return result.Tables[i].Table < result.Tables[j].Table
+	})
+	return result
+}
+
+// storePullStatistics is the events and bytes pulled from a TiKV store in the
+// statistics window, the rates are per second.
+type storePullStatistics struct {
+	StoreID         uint64  `json:"store-id"`
+	EventsPerSecond float64 `json:"events-per-second"`
+	BytesPerSecond  float64 `json:"bytes-per-second"`
+	Events          uint64  `json:"events"`
+	Bytes           uint64  `json:"bytes"`
+	// Captures are the bytes per second pulled by each capture
+	Captures map[string]float64 `json:"captures,omitempty"`
+}
+
+// changefeedStoreStatistics is the output of the statistics command by the
+// stores, the stores are sorted by the bytes per second in descending order.
+type changefeedStoreStatistics struct {
+	Stores []*storePullStatistics `json:"stores"`
+	Total  *storePullStatistics   `json:"total"`
+	// Errors are the errors of reading the processors, keyed by the captures
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// aggregateStoreStatistics sums up the pull load of the stores across the
+// captures, the rate of a store on a capture is computed with the window
+// covered by its processor like aggregateTableStatistics.
+func aggregateStoreStatistics(metrics *cdc.ChangefeedMetricsResp) *changefeedStoreStatistics {
+	stores := make(map[uint64]*storePullStatistics)
+	result := &changefeedStoreStatistics{Total: &storePullStatistics{}}
+	for _, capture := range metrics.Captures {
+		if capture.ProcessorError != "" {
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[capture.AdvertiseAddr] = capture.ProcessorError
+		}
+		p := capture.Processor
+		if p == nil {
+			continue
+		}
+		for _, store := range p.Stores {
+			var eventsPerSecond, bytesPerSecond float64
+			if p.StatisticsWindow > 0 {
+				eventsPerSecond = float64(store.Events) / p.StatisticsWindow
+				bytesPerSecond = float64(store.Bytes) / p.StatisticsWindow
+			}
+			stats, ok := stores[store.StoreID]
+			if !ok {
+				stats = &storePullStatistics{StoreID: store.StoreID, Captures: make(map[string]float64)}
+				stores[store.StoreID] = stats
+			}
+			for _, s := range []*storePullStatistics{stats, result.Total} {
+				s.EventsPerSecond += eventsPerSecond
+				s.BytesPerSecond += bytesPerSecond
+				s.Events += store.Events
+				s.Bytes += store.Bytes
+			}
+			stats.Captures[capture.AdvertiseAddr] += bytesPerSecond
+		}
+	}
+	result.Stores = make([]*storePullStatistics, 0, len(stores))
+	for _, store := range stores {
+		result.Stores = append(result.Stores, store)
+	}
+	sort.Slice(result.Stores, func(i, j int) bool {
+		if result.Stores[i].BytesPerSecond != result.Stores[j].BytesPerSecond {
+			return result.Stores[i].BytesPerSecond > result.Stores[j].BytesPerSecond
+		}
+		return result.Stores[i].StoreID < result.Stores[j].StoreID
+	})
+	return result
+}
+
 func newCreateChangefeedCyclicCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "cyclic",
@@ -623,3 +1277,31 @@ func getUpstreamCredential() *security.Credential {
 		KeyPath:  upstreamSslKeyPath,
 	}
 }
+
+func newVerifyLogChangefeedCommand() *cobra.Command {
+	var logDir string
+	command := &cobra.Command{
+		Use:   "verify-log",
+		Short: "Verify the manifests and the files of the changefeed log written by the local sink",
+		// the log is read offline, the cluster is not needed
+		Annotations: map[string]string{annotationOffline: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := cdclog.VerifyLocalLog(logDir)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err := jsonPrint(cmd, report); err != nil {
+				return errors.Trace(err)
+			}
+			if len(report.Problems) > 0 {
+				return cerror.ErrFileSinkLogCorrupted.GenWithStackByArgs(logDir,
+					fmt.Sprintf("%d problems are found", len(report.Problems)))
+			}
+			cmd.Printf("Verify %d events in %d files of %d tables\n", report.Events, report.Files, report.Tables)
+			return nil
+		},
+	}
+	command.PersistentFlags().StringVar(&logDir, "dir", "", "The directory of the changefeed log, which is the path of the local sink URI")
+	_ = command.MarkPersistentFlagRequired("dir")
+	return command
+}
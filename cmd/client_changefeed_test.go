@@ -14,11 +14,16 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
 	"path/filepath"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	"github.com/spf13/cobra"
 )
@@ -42,11 +47,348 @@ enable-old-value = false
 	c.Assert(err, check.IsNil)
 
 	sinkURI = "blackhole:///?protocol=maxwell"
+	sortEngine = string(model.SortUnified)
+	sortDir = "."
 	info, err := verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(info.Config.EnableOldValue, check.IsTrue)
 
+	// the incompatible config is rejected before connecting to the sink
+	configFile = path
+	defer func() { configFile = "" }()
+	sinkURI = "kafka://127.0.0.1:9092/test?protocol=canal-json"
+	_, err = verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(cerror.ErrSinkIncompatibleConfig.Equal(err), check.IsTrue)
+
 	sinkURI = ""
 	_, err = verifyChangefeedParamers(ctx, cmd, true /* isCreate */, nil)
 	c.Assert(err, check.NotNil)
 }
+
+func (s *clientChangefeedSuite) TestVerifyRequireCompleteness(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := &cobra.Command{}
+
+	path := filepath.Join(c.MkDir(), "config.toml")
+	content := `
+require-completeness = true
+[mounter]
+skip-malformed-row = true
+`
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	configFile = path
+	defer func() { configFile = "" }()
+	sinkURI = "blackhole://"
+	sortEngine = string(model.SortUnified)
+	sortDir = "."
+	_, err := verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(cerror.ErrInvalidMounterConfig.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*skip-malformed-row can't be enabled when require-completeness is set.*")
+
+	// the malformed rows are not skipped by default
+	content = `
+require-completeness = true
+`
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	info, err := verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Config.RequireCompleteness, check.IsTrue)
+}
+
+func (s *clientChangefeedSuite) TestVerifyCompact(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := &cobra.Command{}
+
+	path := filepath.Join(c.MkDir(), "config.toml")
+	content := `
+[compact-per-flush]
+enable = true
+`
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	configFile = path
+	defer func() { configFile = "" }()
+	sortEngine = string(model.SortUnified)
+	sortDir = "."
+	defer func() { sinkURI = "" }()
+	sinkURI = "kafka://127.0.0.1:9092/test"
+	_, err := verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(cerror.ErrSinkIncompatibleConfig.Equal(err), check.IsTrue)
+
+	sinkURI = "blackhole://"
+	info, err := verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Config.Compact.Enable, check.IsTrue)
+
+	// an update can't be told from an insert without the old values
+	content = `
+enable-old-value = false
+[compact-per-flush]
+enable = true
+`
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	_, err = verifyChangefeedParamers(ctx, cmd, false /* isCreate */, nil)
+	c.Assert(cerror.ErrInvalidCompactConfig.Equal(err), check.IsTrue)
+}
+
+func (s *clientChangefeedSuite) TestVerifySortEngine(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(verifySortEngine(model.SortInMemory, ""), check.IsNil)
+	c.Assert(verifySortEngine(model.SortUnified, "/tmp/sorter"), check.IsNil)
+	c.Assert(verifySortEngine(model.SortInFile, "/tmp/sorter"), check.IsNil)
+	c.Assert(verifySortEngine(model.SortUnified, ""), check.ErrorMatches, "sort-dir must be specified.*")
+	err := verifySortEngine("disk", "/tmp/sorter")
+	c.Assert(cerror.ErrUnknownSortEngine.Equal(err), check.IsTrue)
+}
+
+func (s *clientChangefeedSuite) TestVerifySnapshotOnly(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cfg := config.GetDefaultReplicaConfig()
+	c.Assert(verifySnapshotOnly(cfg, 0, false), check.IsNil)
+
+	err := verifySnapshotOnly(cfg, 100, false)
+	c.Assert(cerror.ErrSnapshotOnlyConflict.Equal(err), check.IsTrue)
+	c.Assert(err, check.ErrorMatches, ".*target-ts.*")
+	err = verifySnapshotOnly(cfg, 0, true)
+	c.Assert(err, check.ErrorMatches, ".*sync-point.*")
+
+	cfg.Cyclic = &config.CyclicConfig{Enable: true, ReplicaID: 1, FilterReplicaID: []uint64{2}}
+	err = verifySnapshotOnly(cfg, 0, false)
+	c.Assert(err, check.ErrorMatches, ".*cyclic replication.*")
+
+	cfg = config.GetDefaultReplicaConfig()
+	cfg.TableStartTs = []*config.TableStartTsRule{{Matcher: []string{"test.*"}, StartTs: 1}}
+	err = verifySnapshotOnly(cfg, 0, false)
+	c.Assert(err, check.ErrorMatches, ".*table-start-ts.*")
+}
+
+func (s *clientChangefeedSuite) TestCheckOverwriteCheckpointTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	status := &model.ChangeFeedStatus{CheckpointTs: 100, AdminJobType: model.AdminResume}
+	err := checkOverwriteCheckpointTs(status, 90, false)
+	c.Assert(err, check.ErrorMatches, ".*must be paused.*")
+
+	status.AdminJobType = model.AdminStop
+	c.Assert(checkOverwriteCheckpointTs(status, 90, false), check.IsNil)
+	c.Assert(checkOverwriteCheckpointTs(status, 100, false), check.IsNil)
+	err = checkOverwriteCheckpointTs(status, 110, false)
+	c.Assert(err, check.ErrorMatches, ".*after the checkpoint ts 100.*")
+	c.Assert(checkOverwriteCheckpointTs(status, 110, true), check.IsNil)
+
+	// the paused changefeed is resumed from the paused at ts
+	status.Pause = &model.PauseInfo{PausedAtTs: 120}
+	c.Assert(checkOverwriteCheckpointTs(status, 110, false), check.IsNil)
+	err = checkOverwriteCheckpointTs(status, 130, false)
+	c.Assert(err, check.ErrorMatches, ".*after the checkpoint ts 120.*")
+}
+
+func (s *clientChangefeedSuite) TestAggregateTableStatistics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	metrics := &cdc.ChangefeedMetricsResp{Captures: map[model.CaptureID]*cdc.CaptureMetrics{
+		"capture-1": {AdvertiseAddr: "127.0.0.1:8300", Processor: &cdc.ProcessorMetrics{
+			StatisticsWindow: 100,
+			Tables: []*cdc.TableStatistics{
+				{TableID: 1, Table: "`test`.`t1`", Rows: 100, Bytes: 1000},
+				{TableID: 2, Table: "`test`.`t2`", Rows: 1000, Bytes: 2000},
+			},
+		}},
+		// the table is moved to the capture which started 50s ago
+		"capture-2": {AdvertiseAddr: "127.0.0.1:8301", Processor: &cdc.ProcessorMetrics{
+			StatisticsWindow: 50,
+			Tables: []*cdc.TableStatistics{
+				{TableID: 1, Table: "`test`.`t1`", Rows: 50, Bytes: 500},
+			},
+		}},
+		"capture-3": {AdvertiseAddr: "127.0.0.1:8302", ProcessorError: "capture is unavailable"},
+	}}
+	stats := aggregateTableStatistics(metrics)
+	c.Assert(stats.Tables, check.DeepEquals, []*tableReplicationStatistics{
+		{Table: "`test`.`t2`", RowsPerSecond: 10, BytesPerSecond: 20, Rows: 1000, Bytes: 2000},
+		{Table: "`test`.`t1`", RowsPerSecond: 2, BytesPerSecond: 20, Rows: 150, Bytes: 1500},
+	})
+	c.Assert(stats.Total, check.DeepEquals,
+		&tableReplicationStatistics{Table: "total", RowsPerSecond: 12, BytesPerSecond: 40, Rows: 1150, Bytes: 3500})
+	c.Assert(stats.Errors, check.DeepEquals, map[string]string{"127.0.0.1:8302": "capture is unavailable"})
+}
+
+func (s *clientChangefeedSuite) TestAggregateStoreStatistics(c *check.C) {
+	defer testleak.AfterTest(c)()
+	metrics := &cdc.ChangefeedMetricsResp{Captures: map[model.CaptureID]*cdc.CaptureMetrics{
+		"capture-1": {AdvertiseAddr: "127.0.0.1:8300", Processor: &cdc.ProcessorMetrics{
+			StatisticsWindow: 100,
+			Stores: []*cdc.StoreStatistics{
+				{StoreID: 1, Events: 100, Bytes: 1000},
+				{StoreID: 2, Events: 1000, Bytes: 20000},
+			},
+		}},
+		"capture-2": {AdvertiseAddr: "127.0.0.1:8301", Processor: &cdc.ProcessorMetrics{
+			StatisticsWindow: 50,
+			Stores: []*cdc.StoreStatistics{
+				{StoreID: 1, Events: 50, Bytes: 500},
+			},
+		}},
+		"capture-3": {AdvertiseAddr: "127.0.0.1:8302", ProcessorError: "capture is unavailable"},
+	}}
+	stats := aggregateStoreStatistics(metrics)
+	c.Assert(stats.Stores, check.DeepEquals, []*storePullStatistics{
+		{StoreID: 2, EventsPerSecond: 10, BytesPerSecond: 200, Events: 1000, Bytes: 20000,
+			Captures: map[string]float64{"127.0.0.1:8300": 200}},
+		{StoreID: 1, EventsPerSecond: 2, BytesPerSecond: 20, Events: 150, Bytes: 1500,
+			Captures: map[string]float64{"127.0.0.1:8300": 10, "127.0.0.1:8301": 10}},
+	})
+	c.Assert(stats.Total, check.DeepEquals,
+		&storePullStatistics{EventsPerSecond: 12, BytesPerSecond: 220, Events: 1150, Bytes: 21500})
+	c.Assert(stats.Errors, check.DeepEquals, map[string]string{"127.0.0.1:8302": "capture is unavailable"})
+}
+
+func (s *clientChangefeedSuite) TestPrintDefaultReplicaConfig(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cmd := &cobra.Command{}
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	c.Assert(printDefaultReplicaConfig(cmd), check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*\[mounter\].*`)
+
+	// the printed config is a valid config file of the default config
+	path := filepath.Join(c.MkDir(), "changefeed.toml")
+	c.Assert(ioutil.WriteFile(path, buf.Bytes(), 0o644), check.IsNil)
+	cfg := &config.ReplicaConfig{}
+	c.Assert(strictDecodeFile(path, "cdc", cfg), check.IsNil)
+	c.Assert(cfg, check.DeepEquals, config.GetDefaultReplicaConfig())
+}
+
+func decodeTestReplicaConfig(c *check.C, content string) *config.ReplicaConfig {
+	path := filepath.Join(c.MkDir(), "changefeed.toml")
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	cfg := config.GetDefaultReplicaConfig()
+	c.Assert(strictDecodeFile(path, "cdc", cfg), check.IsNil)
+	return cfg
+}
+
+func (s *clientChangefeedSuite) TestDiffReplicaConfig(c *check.C) {
+	defer testleak.AfterTest(c)()
+	oldCfg := decodeTestReplicaConfig(c, `
+[filter]
+rules = ['*.*']
+
+[sink]
+dispatchers = [
+    {matcher = ['test1.*'], dispatcher = "ts"},
+    {matcher = ['test2.*'], dispatcher = "rowid"},
+]
+
+[budget]
+memory-quota = 1024
+`)
+	newCfg := decodeTestReplicaConfig(c, `
+[filter]
+rules = ['test1.*', 'test2.*', 'test3.*']
+do-dbs = ['test1']
+
+[sink]
+dispatchers = [
+    {matcher = ['test1.*'], dispatcher = "table"},
+    {matcher = ['test2.*'], dispatcher = "rowid", topic = "t2"},
+    {matcher = ['test3.*'], dispatcher = "ts"},
+]
+
+[budget]
+memory-quota = 2048
+`)
+	changes, err := config.DiffConfig(oldCfg, newCfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []*config.ConfigChange{
+		{Path: "filter.rules", Old: []string{"*.*"}, New: []string{"test1.*", "test2.*", "test3.*"}},
+		{Path: "filter.do-dbs", Old: nil, New: []string{"test1"}},
+		{Path: "sink.dispatchers[0].dispatcher", Old: "ts", New: "table"},
+		{Path: "sink.dispatchers[1].topic", Old: "", New: "t2"},
+		{Path: "sink.dispatchers[2]", New: &config.DispatchRule{Matcher: []string{"test3.*"}, Dispatcher: "ts"}},
+		{Path: "budget.memory-quota", Old: int64(1024), New: int64(2048), HotReload: true},
+	})
+	c.Assert(changes[2].String(), check.Equals, `sink.dispatchers[0].dispatcher: "ts" → "table" (requires pause)`)
+	c.Assert(changes[4].String(), check.Equals,
+		`sink.dispatchers[2]: null → {"matcher":["test3.*"],"dispatcher":"ts"} (requires pause)`)
+	c.Assert(changes[5].String(), check.Equals, `budget.memory-quota: 1024 → 2048 (hot-reloadable)`)
+
+	// the removed rules are diffed as a whole
+	changes, err = config.DiffConfig(newCfg, oldCfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 6)
+	c.Assert(changes[4], check.DeepEquals, &config.ConfigChange{
+		Path: "sink.dispatchers[2]", Old: &config.DispatchRule{Matcher: []string{"test3.*"}, Dispatcher: "ts"},
+	})
+
+	// the nil sections are compared as the zero values
+	oldCfg = config.GetDefaultReplicaConfig()
+	oldCfg.Latency = nil
+	changes, err = config.DiffConfig(oldCfg, config.GetDefaultReplicaConfig())
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []*config.ConfigChange{
+		{Path: "latency.sample-rate", Old: float64(0), New: 0.001},
+	})
+
+	changes, err = config.DiffConfig(newCfg, newCfg.Clone())
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 0)
+}
+
+func (s *clientChangefeedSuite) TestPrintChangefeedInfoDiff(c *check.C) {
+	defer testleak.AfterTest(c)()
+	old := &model.ChangeFeedInfo{
+		SinkURI:    "blackhole://",
+		Config:     config.GetDefaultReplicaConfig(),
+		ConfigText: "[filter]\nrules = ['*.*']\n",
+	}
+	info := &model.ChangeFeedInfo{
+		SinkURI:    "blackhole://",
+		Config:     config.GetDefaultReplicaConfig(),
+		ConfigText: "[filter]\nrules = ['test.*']\n",
+	}
+	info.Config.Filter.Rules = []string{"test.*"}
+
+	// the original config files are not diffed by the text
+	cmd := &cobra.Command{}
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	changed, err := printChangefeedInfoDiff(cmd, old, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.IsTrue)
+	c.Assert(buf.String(), check.Equals, "Diff of changefeed config:\n"+
+		`filter.rules: ["*.*"] → ["test.*"] (requires pause)`+"\n")
+
+	buf.Reset()
+	info.SortDir = "/tmp/sorter"
+	changed, err = printChangefeedInfoDiff(cmd, old, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.IsTrue)
+	c.Assert(buf.String(), check.Matches, `(?s)Diff of changefeed config:\n.*Diff of changefeed info:\n.*SortDir.*`)
+
+	buf.Reset()
+	changed, err = printChangefeedInfoDiff(cmd, old, old)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.IsFalse)
+	c.Assert(buf.String(), check.Equals, "")
+}
+
+func (s *clientChangefeedSuite) TestReadConfigText(c *check.C) {
+	defer testleak.AfterTest(c)()
+	cmd := &cobra.Command{}
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	path := filepath.Join(c.MkDir(), "changefeed.toml")
+	content := "# the rules\n[filter]\nrules = ['*.*']\n"
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), check.IsNil)
+	text, err := readConfigText(cmd, path)
+	c.Assert(err, check.IsNil)
+	c.Assert(text, check.Equals, content)
+
+	// the file larger than the cap is not stored
+	c.Assert(ioutil.WriteFile(path, bytes.Repeat([]byte("#"), model.MaxConfigTextSize+1), 0o644), check.IsNil)
+	text, err = readConfigText(cmd, path)
+	c.Assert(err, check.IsNil)
+	c.Assert(text, check.Equals, "")
+	c.Assert(buf.String(), check.Matches, `\[WARN\] the config file .* is larger than 65536 bytes.*\n`)
+}
@@ -19,6 +19,8 @@ import (
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/ticdc/cdc"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/pkg/util"
 	"github.com/spf13/cobra"
 )
 
@@ -29,8 +31,12 @@ func newUnsafeCommand() *cobra.Command {
 	}
 	command.AddCommand(
 		newDeleteServiceGcSafepointCommand(),
+		newShowGCSafepointCommand(),
 		newResetCommand(),
 		newShowMetadataCommand(),
+		newAdvanceTableResolvedTsCommand(),
+		newFinishOperationCommand(),
+		newShowQuarantineCommand(),
 	)
 	command.PersistentFlags().BoolVar(&noConfirm, "no-confirm", false, "Don't ask user whether to confirm executing meta command")
 	return command
@@ -61,7 +67,7 @@ func newResetCommand() *cobra.Command {
 				return errors.Trace(err)
 			}
 
-			_, err = pdCli.UpdateServiceGCSafePoint(ctx, cdc.CDCServiceSafePointID, 0, 0)
+			_, err = pdCli.UpdateServiceGCSafePoint(ctx, util.ServiceSafePointID(cdc.CDCServiceSafePointID, cdcEtcdCli.ClusterID), 0, 0)
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -80,6 +86,9 @@ func newShowMetadataCommand() *cobra.Command {
 		Short: "Show metadata stored in PD",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := defaultContext
+			if metadataKey != "" {
+				return showAndValidateMetadata(cmd, metadataKey)
+			}
 			kvs, err := cdcEtcdCli.GetAllCDCInfo(ctx)
 			if err != nil {
 				return errors.Trace(err)
@@ -91,9 +100,56 @@ func newShowMetadataCommand() *cobra.Command {
 			return nil
 		},
 	}
+	command.PersistentFlags().StringVar(&metadataKey, "key", "", "Show and validate the value of the key only, the key base of the cluster can be omitted")
 	return command
 }
 
+func newShowQuarantineCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "show-quarantine",
+		Short: "Show the malformed rows quarantined in the sort dir of a capture, which is read locally",
+		// the quarantine files are read offline, the cluster is not needed
+		Annotations: map[string]string{annotationOffline: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := entry.ReadQuarantine(entry.QuarantineDir(sortDir), changefeedID)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err := jsonPrint(cmd, entries); err != nil {
+				return errors.Trace(err)
+			}
+			cmd.Printf("Show %d quarantined rows\n", len(entries))
+			return nil
+		},
+	}
+	command.PersistentFlags().StringVar(&sortDir, "sort-dir", ".", "The sort dir of the changefeed on the capture")
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID, the rows of all changefeeds are shown if it's empty")
+	return command
+}
+
+// showAndValidateMetadata shows the value of the key, and checks whether it
+// can be unmarshaled into the type stored in the key.
+func showAndValidateMetadata(cmd *cobra.Command, key string) error {
+	kv, err := cdcEtcdCli.GetCDCInfo(defaultContext, key)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cmd.Printf("Key: %s, Value: %s\n", string(kv.Key), string(kv.Value))
+	kind, unknown, err := cdcEtcdCli.ValidateMetadata(string(kv.Key), kv.Value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch {
+	case kind == "":
+		cmd.Println("The key is not recognized, the value is not validated")
+	case unknown != nil:
+		cmd.Printf("The value is a valid %s, but the unknown fields are ignored: %s\n", kind, unknown)
+	default:
+		cmd.Printf("The value is a valid %s\n", kind)
+	}
+	return nil
+}
+
 func newDeleteServiceGcSafepointCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "delete-service-gc-safepoint",
@@ -103,7 +159,7 @@ func newDeleteServiceGcSafepointCommand() *cobra.Command {
 				return err
 			}
 			ctx := defaultContext
-			_, err := pdCli.UpdateServiceGCSafePoint(ctx, cdc.CDCServiceSafePointID, 0, 0)
+			_, err := pdCli.UpdateServiceGCSafePoint(ctx, util.ServiceSafePointID(cdc.CDCServiceSafePointID, cdcEtcdCli.ClusterID), 0, 0)
 			if err == nil {
 				cmd.Println("CDC service GC safepoint truncated in PD!")
 			}
@@ -113,6 +169,88 @@ func newDeleteServiceGcSafepointCommand() *cobra.Command {
 	return command
 }
 
+func newShowGCSafepointCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "show-gc-safepoint",
+		Short: "Show the CDC service GC safepoint last pushed to PD by the owner",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := applyOwnerGCSafepoint(defaultContext, refreshGCSafepoint, getCredential())
+			if err != nil {
+				return err
+			}
+			return jsonPrint(cmd, resp)
+		},
+	}
+	command.PersistentFlags().BoolVar(&refreshGCSafepoint, "refresh", false, "Push the CDC service GC safepoint to PD immediately before showing it")
+	return command
+}
+
+func newAdvanceTableResolvedTsCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "advance-table-resolved-ts",
+		Short: "Force the resolved ts of a table to advance to unblock the changefeed, the events of the table at or below the ts are dropped, confirm that you know what this command will do and use it at your own risk",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if forceResolvedTs == 0 {
+				return errors.New("the ts to advance to must be specified")
+			}
+			ctx := defaultContext
+			if _, err := cdcEtcdCli.GetChangeFeedInfo(ctx, changefeedID); err != nil {
+				return errors.Trace(err)
+			}
+			if err := confirmMetaDelete(cmd); err != nil {
+				return err
+			}
+			captureID, err := cdcEtcdCli.ForceAdvanceTableResolvedTs(ctx, changefeedID, forceTableID, forceResolvedTs, clientInfo())
+			if err != nil {
+				return errors.Trace(err)
+			}
+			cmd.Printf("The resolved ts of table %d is forced to advance to %d on capture %s!\n", forceTableID, forceResolvedTs, captureID)
+			return nil
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	command.PersistentFlags().Int64Var(&forceTableID, "table-id", 0, "ID of the table")
+	command.PersistentFlags().Uint64Var(&forceResolvedTs, "ts", 0, "The resolved ts to advance to")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	_ = command.MarkPersistentFlagRequired("table-id")
+	_ = command.MarkPersistentFlagRequired("ts")
+	return command
+}
+
+func newFinishOperationCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "finish-operation",
+		Short: "Force the pending operation of a table on a capture to finish to unblock the scheduling of the changefeed, use it only if the processor can't finish the operation, confirm that you know what this command will do and use it at your own risk",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := defaultContext
+			if _, err := cdcEtcdCli.GetChangeFeedInfo(ctx, changefeedID); err != nil {
+				return errors.Trace(err)
+			}
+			if err := confirmMetaDelete(cmd); err != nil {
+				return err
+			}
+			op, startTs, err := cdcEtcdCli.FinishTableOperation(ctx, changefeedID, captureID, forceTableID, clientInfo())
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if op.Delete {
+				cmd.Printf("The delete operation of table %d on capture %s is finished, the table is started on the target capture from %d!\n",
+					forceTableID, captureID, startTs)
+				return nil
+			}
+			cmd.Printf("The add operation of table %d on capture %s is finished!\n", forceTableID, captureID)
+			return nil
+		},
+	}
+	command.PersistentFlags().StringVarP(&changefeedID, "changefeed-id", "c", "", "Replication task (changefeed) ID")
+	command.PersistentFlags().StringVarP(&captureID, "capture-id", "p", "", "ID of the capture which the operation is pending on")
+	command.PersistentFlags().Int64Var(&forceTableID, "table-id", 0, "ID of the table")
+	_ = command.MarkPersistentFlagRequired("changefeed-id")
+	_ = command.MarkPersistentFlagRequired("capture-id")
+	_ = command.MarkPersistentFlagRequired("table-id")
+	return command
+}
+
 func confirmMetaDelete(cmd *cobra.Command) error {
 	if noConfirm {
 		return nil
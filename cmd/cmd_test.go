@@ -37,21 +37,32 @@ func (s *decodeFileSuite) TestCanDecodeTOML(c *check.C) {
 	path := filepath.Join(dir, "config.toml")
 	content := `
 case-sensitive = false
+priority = 10
+ddl-unsupported-action = "pause"
 
 [filter]
 ignore-txn-start-ts = [1, 2]
 ddl-allow-list = [1, 2]
 rules = ['*.*', '!test.*']
+sensitive-columns = ['test.users.password']
 
 [mounter]
 worker-num = 64
+input-chan-size = 256
+schema-wait-timeout = 600
+prepare-warn-threshold = 30
+prepare-timeout = 1200
+decode-timeout = 10
+skip-malformed-row = true
 
 [sink]
 dispatchers = [
 	{matcher = ['test1.*', 'test2.*'], dispatcher = "ts"},
 	{matcher = ['test3.*', 'test4.*'], dispatcher = "rowid"},
+	{matcher = ['test5.*'], dispatcher = "table", topic = "cdc_{schema}"},
 ]
 protocol = "default"
+schema-changes-topic = "schema_changes"
 
 [cyclic-replication]
 enable = true
@@ -63,6 +74,81 @@ sync-ddl = true
 [scheduler]
 type = "manual"
 polling-time = 5
+partition-policies = [
+	{matcher = ['test.orders'], policy = "co-locate"},
+]
+
+[consistency-check]
+enable = true
+interval = 30
+sample-size = 20
+fail-on-mismatch = true
+
+[[table-start-ts]]
+matcher = ['test1.a']
+start-ts = 100
+
+[[table-start-ts]]
+matcher = ['test1.b', 'test2.*']
+start-ts = 200
+
+[event-log]
+max-value-bytes = 1024
+
+[dedup]
+window-size = 4096
+
+[downstream-write-check]
+enable = true
+interval = 30
+sentinel-tables = ['test.sentinel']
+
+[large-txn]
+row-threshold = 500000
+annotate-status = true
+
+[sort-dir]
+min-free-bytes = 1073741824
+
+[notify]
+webhook-url = 'http://127.0.0.1:9090/alert'
+lag-threshold = 600
+
+[latency]
+sample-rate = 0.01
+top-n-tables = 10
+
+[schema-check]
+mode = 'strict'
+
+[checkpoint-guard]
+enable = true
+tolerance = 300
+
+[dormant-table]
+idle-seconds = 60
+
+[schema-gc]
+add-table-window = 600
+margin = 30
+
+[budget]
+memory-quota = 1073741824
+events-per-second = 10000
+
+[audit]
+enable = true
+cache-size = 1000
+
+[compact-per-flush]
+enable = true
+max-keys = 5000
+
+[circuit-breaker]
+consistency-mismatch = "pause-table"
+ordering-violation = "pause-changefeed"
+quarantined-rows = "warn"
+quarantine-threshold = 10
 `
 	err := ioutil.WriteFile(path, []byte(content), 0o644)
 	c.Assert(err, check.IsNil)
@@ -72,20 +158,31 @@ polling-time = 5
 	c.Assert(err, check.IsNil)
 
 	c.Assert(cfg.CaseSensitive, check.IsFalse)
+	c.Assert(cfg.Priority, check.Equals, 10)
 	c.Assert(cfg.Filter, check.DeepEquals, &config.FilterConfig{
 		IgnoreTxnStartTs: []uint64{1, 2},
 		DDLAllowlist:     []model.ActionType{1, 2},
 		Rules:            []string{"*.*", "!test.*"},
+		SensitiveColumns: []string{"test.users.password"},
 	})
 	c.Assert(cfg.Mounter, check.DeepEquals, &config.MounterConfig{
-		WorkerNum: 64,
+		WorkerNum:               64,
+		InputChanSize:           256,
+		SchemaWaitTimeout:       600,
+		SchemaWaitWarnThreshold: 60,
+		PrepareWarnThreshold:    30,
+		PrepareTimeout:          1200,
+		DecodeTimeout:           10,
+		SkipMalformedRow:        true,
 	})
 	c.Assert(cfg.Sink, check.DeepEquals, &config.SinkConfig{
 		DispatchRules: []*config.DispatchRule{
 			{Dispatcher: "ts", Matcher: []string{"test1.*", "test2.*"}},
 			{Dispatcher: "rowid", Matcher: []string{"test3.*", "test4.*"}},
+			{Dispatcher: "table", Matcher: []string{"test5.*"}, Topic: "cdc_{schema}"},
 		},
-		Protocol: "default",
+		Protocol:           "default",
+		SchemaChangesTopic: "schema_changes",
 	})
 	c.Assert(cfg.Cyclic, check.DeepEquals, &config.CyclicConfig{
 		Enable:          true,
@@ -97,6 +194,53 @@ polling-time = 5
 	c.Assert(cfg.Scheduler, check.DeepEquals, &config.SchedulerConfig{
 		Tp:          "manual",
 		PollingTime: 5,
+		PartitionPolicies: []*config.PartitionPolicyRule{
+			{Matcher: []string{"test.orders"}, Policy: "co-locate"},
+		},
+		LocalityWeight: 0.5,
+		LocalityLabel:  "zone",
+	})
+	c.Assert(cfg.ConsistencyCheck, check.DeepEquals, &config.ConsistencyCheckConfig{
+		Enable:         true,
+		Interval:       30,
+		SampleSize:     20,
+		MaxQPS:         10,
+		FailOnMismatch: true,
+	})
+	c.Assert(cfg.TableStartTs, check.DeepEquals, []*config.TableStartTsRule{
+		{Matcher: []string{"test1.a"}, StartTs: 100},
+		{Matcher: []string{"test1.b", "test2.*"}, StartTs: 200},
+	})
+	c.Assert(cfg.EventLog, check.DeepEquals, &config.EventLogConfig{MaxValueBytes: 1024})
+	c.Assert(cfg.Dedup, check.DeepEquals, &config.DedupConfig{WindowSize: 4096})
+	c.Assert(cfg.DownstreamWriteCheck, check.DeepEquals, &config.DownstreamWriteCheckConfig{
+		Enable:         true,
+		Interval:       30,
+		SentinelTables: []string{"test.sentinel"},
+	})
+	c.Assert(cfg.LargeTxn, check.DeepEquals, &config.LargeTxnConfig{
+		RowThreshold:   500000,
+		AnnotateStatus: true,
+	})
+	c.Assert(cfg.SortDir, check.DeepEquals, &config.SortDirConfig{MinFreeBytes: 1073741824})
+	c.Assert(cfg.Notify, check.DeepEquals, &config.NotifyConfig{
+		WebhookURL:   "http://127.0.0.1:9090/alert",
+		LagThreshold: 600,
+	})
+	c.Assert(cfg.Latency, check.DeepEquals, &config.LatencyConfig{SampleRate: 0.01, TopNTables: 10})
+	c.Assert(cfg.SchemaCheck, check.DeepEquals, &config.SchemaCheckConfig{Mode: config.SchemaCheckStrict})
+	c.Assert(cfg.CheckpointGuard, check.DeepEquals, &config.CheckpointGuardConfig{Enable: true, Tolerance: 300})
+	c.Assert(cfg.DDLUnsupportedAction, check.Equals, config.DDLUnsupportedPause)
+	c.Assert(cfg.DormantTable, check.DeepEquals, &config.DormantTableConfig{IdleSeconds: 60})
+	c.Assert(cfg.SchemaGC, check.DeepEquals, &config.SchemaGCConfig{AddTableWindow: 600, Margin: 30})
+	c.Assert(cfg.Budget, check.DeepEquals, &config.BudgetConfig{MemoryQuota: 1 << 30, EventsPerSecond: 10000})
+	c.Assert(cfg.Audit, check.DeepEquals, &config.AuditConfig{Enable: true, CacheSize: 1000})
+	c.Assert(cfg.Compact, check.DeepEquals, &config.CompactConfig{Enable: true, MaxKeys: 5000})
+	c.Assert(cfg.CircuitBreaker, check.DeepEquals, &config.CircuitBreakerConfig{
+		ConsistencyMismatch: config.BreakerActionPauseTable,
+		OrderingViolation:   config.BreakerActionPauseChangefeed,
+		QuarantinedRows:     config.BreakerActionWarn,
+		QuarantineThreshold: 10,
 	})
 }
 
@@ -155,11 +299,12 @@ filter-replica-ids = [2,3]
 # Whether to replicate DDL
 sync-ddl = true
 `
-	err := ioutil.WriteFile("changefeed.toml", []byte(content), 0o644)
+	path := filepath.Join(c.MkDir(), "changefeed.toml")
+	err := ioutil.WriteFile(path, []byte(content), 0o644)
 	c.Assert(err, check.IsNil)
 
 	cfg := config.GetDefaultReplicaConfig()
-	err = strictDecodeFile("changefeed.toml", "cdc", &cfg)
+	err = strictDecodeFile(path, "cdc", &cfg)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(cfg.CaseSensitive, check.IsTrue)
@@ -168,7 +313,12 @@ sync-ddl = true
 		Rules:            []string{"*.*", "!test.*"},
 	})
 	c.Assert(cfg.Mounter, check.DeepEquals, &config.MounterConfig{
-		WorkerNum: 16,
+		WorkerNum:               16,
+		InputChanSize:           1024,
+		SchemaWaitTimeout:       1800,
+		SchemaWaitWarnThreshold: 60,
+		PrepareWarnThreshold:    60,
+		PrepareTimeout:          3600,
 	})
 	c.Assert(cfg.Sink, check.DeepEquals, &config.SinkConfig{
 		DispatchRules: []*config.DispatchRule{
@@ -0,0 +1,166 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/logutil"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const replayChangefeedID = "replay"
+
+var (
+	replayFile       string
+	replaySinkURI    string
+	replayConfigFile string
+	replaySortEngine string
+	replaySortDir    string
+	replayTimezone   string
+
+	replayCmd = &cobra.Command{
+		Hidden: true,
+		Use:    "replay",
+		Short:  "Replay a file of the captured raw kv entries into a sink",
+		Long: `Replay a file of the captured raw kv entries into a sink, which is useful for
+testing the performance of the sinks. The file contains one JSON encoded raw kv
+entry per line, the DDL job entries creating the tables must be put before the
+rows of the tables, and the rows are flushed at the resolved entries.`,
+		RunE: runEReplay,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().StringVar(&replayFile, "file", "", "file of the captured raw kv entries")
+	replayCmd.Flags().StringVar(&replaySinkURI, "sink-uri", "blackhole://", "sink uri")
+	replayCmd.Flags().StringVar(&replayConfigFile, "config", "", "path of the changefeed config file")
+	replayCmd.Flags().StringVar(&replaySortEngine, "sort-engine", string(model.SortInMemory), "sort engine used for data sort")
+	replayCmd.Flags().StringVar(&replaySortDir, "sort-dir", "", "directory used for file sort")
+	replayCmd.Flags().StringVar(&replayTimezone, "tz", "System", "time zone of the rows")
+	replayCmd.Flags().StringVar(&logLevel, "log-level", "info", "log level (etc: debug|info|warn|error)")
+	_ = replayCmd.MarkFlagRequired("file")
+}
+
+func runEReplay(cmd *cobra.Command, args []string) error {
+	cancel := initCmd(cmd, &logutil.Config{Level: logLevel})
+	defer cancel()
+	tz, err := util.GetTimezone(replayTimezone)
+	if err != nil {
+		return errors.Annotate(err, "can not load timezone")
+	}
+	cfg := config.GetDefaultReplicaConfig()
+	if len(replayConfigFile) > 0 {
+		if err := strictDecodeFile(replayConfigFile, "cdc", cfg); err != nil {
+			return err
+		}
+	}
+	if err := verifySortEngine(model.SortEngine(replaySortEngine), replaySortDir); err != nil {
+		return err
+	}
+	file, err := os.Open(replayFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer file.Close()
+
+	ctx := util.PutTimezoneInCtx(defaultContext, tz)
+	ctx = util.PutChangefeedIDInCtx(ctx, replayChangefeedID)
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	f, err := filter.NewFilter(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	errCh := make(chan error, 1)
+	s, err := sink.NewSink(ctx, replayChangefeedID, replaySinkURI, f, cfg, map[string]string{}, errCh)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer s.Close() //nolint:errcheck
+	schemaStorage, err := entry.NewSchemaStorage(nil, 0, f, cfg.ForceReplicate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	info := &model.ChangeFeedInfo{
+		SinkURI: replaySinkURI,
+		Engine:  model.SortEngine(replaySortEngine),
+		SortDir: replaySortDir,
+		Config:  cfg,
+	}
+	pipeline := newReplayPipeline(schemaStorage, info, s)
+
+	input := make(chan *model.RawKVEntry, 1024)
+	var entries int
+	start := time.Now()
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		defer close(input)
+		decoder := json.NewDecoder(file)
+		for {
+			raw := new(model.RawKVEntry)
+			if err := decoder.Decode(raw); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return errors.Annotatef(err, "decode the entry %d", entries+1)
+			}
+			select {
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			case input <- raw:
+			}
+			entries++
+		}
+	})
+	// the errors of the sink are watched until the pipeline is finished
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	errg.Go(func() error {
+		defer stopWatch()
+		return pipeline.Run(ctx, input)
+	})
+	errg.Go(func() error {
+		select {
+		case <-watchCtx.Done():
+			return nil
+		case err := <-errCh:
+			return errors.Trace(err)
+		}
+	})
+	if err := errg.Wait(); err != nil {
+		return err
+	}
+	log.Info("replay finished",
+		zap.Int("entries", entries),
+		zap.Uint64("checkpointTs", pipeline.CheckpointTs()),
+		zap.Duration("duration", time.Since(start)))
+	cmd.Printf("replayed %d entries in %s, checkpoint ts %d\n", entries, time.Since(start), pipeline.CheckpointTs())
+	return nil
+}
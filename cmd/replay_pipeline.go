@@ -0,0 +1,226 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	cdcprocessor "github.com/pingcap/ticdc/cdc/processor"
+	"github.com/pingcap/ticdc/cdc/puller"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/util"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// replayEmitBatch is the max number of the events emitted to the sink at
+	// once
+	replayEmitBatch = 1024
+	// replayCheckpointWaitInterval is the interval of the flushes waiting for
+	// the sink to reach the last resolved ts
+	replayCheckpointWaitInterval = 10 * time.Millisecond
+)
+
+// replayPipeline replicates a stream of raw kv entries to a sink, the entries
+// are sorted, mounted and emitted to the sink by the sorter and the row emitter
+// of the processor, and the sink is flushed at each resolved entry. Unlike the
+// processor, it doesn't pull the entries from TiKV or report the progress to
+// etcd, so it works without a capture, PD and etcd.
+type replayPipeline struct {
+	info          *model.ChangeFeedInfo
+	schemaStorage *entry.SchemaStorage
+	sink          sink.Sink
+
+	checkpointTs uint64
+}
+
+// newReplayPipeline creates a pipeline, the sort engine, the sort dir and the replica
+// config are read from the changefeed info. The DDL job entries in the stream
+// are applied to the schema storage, so it can be empty if the stream contains
+// the DDL jobs creating the tables. The DDLs are not emitted to the sink.
+func newReplayPipeline(schemaStorage *entry.SchemaStorage, info *model.ChangeFeedInfo, s sink.Sink) *replayPipeline {
+	return &replayPipeline{
+		info:          info,
+		schemaStorage: schemaStorage,
+		sink:          s,
+	}
+}
+
+// CheckpointTs returns the checkpoint ts returned by the last flush of the sink.
+func (p *replayPipeline) CheckpointTs() model.Ts {
+	return atomic.LoadUint64(&p.checkpointTs)
+}
+
+// Run replicates the entries of input until input is closed, then it waits
+// for the sink to flush the rows before the last resolved entry and returns.
+// Like the entries of a puller, no entry may be less than a resolved entry
+// before it.
+func (p *replayPipeline) Run(ctx context.Context, input <-chan *model.RawKVEntry) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sorter := cdcprocessor.NewSorter(p.info.Engine, p.info.SortDir, "pipeline", util.CaptureAddrFromCtx(ctx))
+	mounter := entry.NewMounter(p.schemaStorage, p.info.Config.Mounter, p.info.Config.EnableOldValue, nil,
+		entry.QuarantineDir(p.info.SortDir))
+	// the max resolved ts of input is sent once input is closed
+	lastResolvedCh := make(chan model.Ts, 1)
+	var finished int32
+
+	errg, cctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		return sorter.Run(cctx)
+	})
+	errg.Go(func() error {
+		return mounter.Run(cctx)
+	})
+	errg.Go(func() error {
+		return p.pullInput(cctx, input, sorter, lastResolvedCh)
+	})
+	errg.Go(func() error {
+		err := p.emit(cctx, sorter, mounter, lastResolvedCh)
+		if err == nil {
+			// the sorter and the mounter are stopped by canceling the context
+			atomic.StoreInt32(&finished, 1)
+			cancel()
+		}
+		return err
+	})
+	err := errg.Wait()
+	if atomic.LoadInt32(&finished) == 1 && errors.Cause(err) == context.Canceled {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+// pullInput sends the entries of input to the sorter, and sends the max
+// resolved ts to lastResolvedCh once input is closed.
+func (p *replayPipeline) pullInput(
+	ctx context.Context, input <-chan *model.RawKVEntry, sorter puller.EventSorter, lastResolvedCh chan<- model.Ts,
+) error {
+	var resolvedTs model.Ts
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case raw, ok := <-input:
+			if !ok {
+				lastResolvedCh <- resolvedTs
+				return nil
+			}
+			if raw == nil {
+				continue
+			}
+			if raw.OpType == model.OpTypeResolved && raw.CRTs > resolvedTs {
+				resolvedTs = raw.CRTs
+			}
+			sorter.AddEntry(ctx, model.NewPolymorphicEvent(raw))
+		}
+	}
+}
+
+// emit receives the sorted events, the DDL jobs are applied to the schema
+// storage, and the rows are mounted and emitted to the sink, which is flushed
+// at each resolved event. It returns nil once the last resolved ts of input is
+// flushed.
+func (p *replayPipeline) emit(
+	ctx context.Context, sorter puller.EventSorter, mounter entry.Mounter, lastResolvedCh <-chan model.Ts,
+) error {
+	emitter := cdcprocessor.NewRowEmitter(p.sink, mounter, replayEmitBatch, nil)
+	var (
+		resolvedTs     model.Ts
+		lastResolvedTs model.Ts
+		inputClosed    bool
+	)
+	for {
+		if inputClosed && resolvedTs >= lastResolvedTs {
+			return p.waitCheckpoint(ctx, lastResolvedTs)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case lastResolvedTs = <-lastResolvedCh:
+			inputClosed = true
+		case pEvent := <-sorter.Output():
+			if pEvent == nil || pEvent.RawKV == nil {
+				continue
+			}
+			raw := pEvent.RawKV
+			if raw.OpType == model.OpTypeResolved {
+				if raw.CRTs <= resolvedTs {
+					continue
+				}
+				p.schemaStorage.AdvanceResolvedTs(raw.CRTs)
+				if err := emitter.Emit(ctx); err != nil {
+					return errors.Trace(err)
+				}
+				checkpointTs, err := sink.FlushCheckpointTs(ctx, p.sink, raw.CRTs)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				atomic.StoreUint64(&p.checkpointTs, checkpointTs)
+				resolvedTs = raw.CRTs
+				continue
+			}
+			job, err := entry.UnmarshalDDL(raw)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if job != nil {
+				if err := p.schemaStorage.HandleDDLJob(job); err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
+			// the DDL jobs before the event are applied as the events are
+			// sorted, so the event can be mounted without waiting for the
+			// next resolved event
+			p.schemaStorage.AdvanceResolvedTs(raw.CRTs)
+			pEvent.SetUpFinishedChan()
+			if err := mounter.AddEntry(ctx, pEvent); err != nil {
+				return errors.Trace(err)
+			}
+			emitter.Append(pEvent)
+			if emitter.Len() >= replayEmitBatch {
+				if err := emitter.Emit(ctx); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+	}
+}
+
+// waitCheckpoint flushes the sink until the checkpoint ts reaches resolvedTs,
+// as some sinks execute the rows asynchronously.
+func (p *replayPipeline) waitCheckpoint(ctx context.Context, resolvedTs model.Ts) error {
+	for p.CheckpointTs() < resolvedTs {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-time.After(replayCheckpointWaitInterval):
+		}
+		checkpointTs, err := sink.FlushCheckpointTs(ctx, p.sink, resolvedTs)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		atomic.StoreUint64(&p.checkpointTs, checkpointTs)
+	}
+	log.Info("the replay pipeline is finished", zap.Uint64("checkpointTs", p.CheckpointTs()))
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	timodel "github.com/pingcap/parser/model"
+	"github.com/pingcap/ticdc/cdc/entry"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink"
+	"github.com/pingcap/ticdc/pkg/config"
+	"github.com/pingcap/ticdc/pkg/filter"
+	"github.com/pingcap/ticdc/pkg/regionspan"
+	"github.com/pingcap/ticdc/pkg/util"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	timeta "github.com/pingcap/tidb/meta"
+	"github.com/pingcap/tidb/session"
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/testkit"
+)
+
+type replayPipelineSuite struct{}
+
+var _ = check.Suite(&replayPipelineSuite{})
+
+// recordSink records the emitted rows and the flushed resolved ts
+type recordSink struct {
+	sink.Sink
+	mu         sync.Mutex
+	rows       []*model.RowChangedEvent
+	resolvedTs []uint64
+}
+
+func (s *recordSink) EmitRowChangedEvents(ctx context.Context, rows ...*model.RowChangedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *recordSink) FlushRowChangedEvents(ctx context.Context, resolvedTs uint64) (model.FlushResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolvedTs = append(s.resolvedTs, resolvedTs)
+	return model.FlushResult{CheckpointTs: resolvedTs}, nil
+}
+
+// captureTableEvents creates a table with the rows in a mock store, and
+// returns the raw kv entries of the DDL jobs and the rows, which are resolved
+// at the returned ts.
+func captureTableEvents(c *check.C, values ...int) ([]*model.RawKVEntry, uint64) {
+	store, err := mockstore.NewMockStore()
+	c.Assert(err, check.IsNil)
+	defer store.Close() //nolint:errcheck
+	session.SetSchemaLease(0)
+	session.DisableStats4Test()
+	domain, err := session.BootstrapSession(store)
+	c.Assert(err, check.IsNil)
+	defer domain.Close()
+	domain.SetStatsUpdating(true)
+	tk := testkit.NewTestKit(c, store)
+	tk.MustExec("use test;")
+	tk.MustExec("create table t(id int primary key, name varchar(32))")
+	for _, v := range values {
+		tk.MustExec("insert into t values (?, 'test')", v)
+	}
+
+	txn, err := store.Begin()
+	c.Assert(err, check.IsNil)
+	defer txn.Rollback() //nolint:errcheck
+	jobs, err := timeta.NewMeta(txn).GetAllHistoryDDLJobs()
+	c.Assert(err, check.IsNil)
+	var entries []*model.RawKVEntry
+	for i, job := range jobs {
+		// the DDL jobs are pulled from the DDL job list
+		key := append([]byte("m"), codec.EncodeBytes(nil, []byte("DDLJobList"))...)
+		key = codec.EncodeUint(key, uint64(entry.ListData))
+		key = codec.EncodeInt(key, int64(i))
+		value, err := json.Marshal(job)
+		c.Assert(err, check.IsNil)
+		entries = append(entries, &model.RawKVEntry{
+			OpType:  model.OpTypePut,
+			Key:     key,
+			Value:   value,
+			StartTs: job.StartTS,
+			CRTs:    job.BinlogInfo.FinishedTS,
+		})
+	}
+	ver, err := store.CurrentVersion()
+	c.Assert(err, check.IsNil)
+	table, err := domain.InfoSchema().TableByName(timodel.NewCIStr("test"), timodel.NewCIStr("t"))
+	c.Assert(err, check.IsNil)
+	span := regionspan.GetTableSpan(table.Meta().ID, false)
+	iter, err := txn.Iter(span.Start, span.End)
+	c.Assert(err, check.IsNil)
+	defer iter.Close()
+	for iter.Valid() {
+		entries = append(entries, &model.RawKVEntry{
+			OpType:  model.OpTypePut,
+			Key:     iter.Key(),
+			Value:   iter.Value(),
+			StartTs: ver.Ver - 1,
+			CRTs:    ver.Ver,
+		})
+		c.Assert(iter.Next(), check.IsNil)
+	}
+	return entries, ver.Ver
+}
+
+func resolvedEntry(ts uint64) *model.RawKVEntry {
+	return &model.RawKVEntry{OpType: model.OpTypeResolved, CRTs: ts}
+}
+
+func newTestPipeline(c *check.C, s sink.Sink) *replayPipeline {
+	schemaStorage, err := entry.NewSchemaStorage(nil, 0, nil, false)
+	c.Assert(err, check.IsNil)
+	info := &model.ChangeFeedInfo{Engine: model.SortInMemory, Config: config.GetDefaultReplicaConfig()}
+	return newReplayPipeline(schemaStorage, info, s)
+}
+
+// runPipeline sends the entries to the pipeline in memory, and waits for the
+// pipeline to finish.
+func runPipeline(c *check.C, p *replayPipeline, entries []*model.RawKVEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = util.PutTimezoneInCtx(ctx, time.UTC)
+	input := make(chan *model.RawKVEntry, len(entries))
+	for _, raw := range entries {
+		input <- raw
+	}
+	close(input)
+	c.Assert(p.Run(ctx, input), check.IsNil)
+}
+
+func (s *replayPipelineSuite) TestPipelineEmitRows(c *check.C) {
+	defer testleak.AfterTest(c)()
+	entries, ts := captureTableEvents(c, 1, 2, 3)
+	// the rows after the last resolved ts are not emitted
+	unresolved := *entries[len(entries)-1]
+	unresolved.StartTs, unresolved.CRTs = ts+1, ts+2
+	entries = append(entries, resolvedEntry(ts-1), resolvedEntry(ts), &unresolved)
+
+	s1 := &recordSink{}
+	p := newTestPipeline(c, s1)
+	runPipeline(c, p, entries)
+	c.Assert(p.CheckpointTs(), check.Equals, ts)
+	c.Assert(s1.resolvedTs, check.DeepEquals, []uint64{ts - 1, ts})
+	c.Assert(s1.rows, check.HasLen, 3)
+	for i, row := range s1.rows {
+		c.Assert(row.Table.Schema, check.Equals, "test")
+		c.Assert(row.Table.Table, check.Equals, "t")
+		c.Assert(row.CommitTs, check.Equals, ts)
+		c.Assert(row.Columns, check.HasLen, 2)
+		c.Assert(row.Columns[0].Value, check.Equals, int64(i+1))
+	}
+}
+
+func (s *replayPipelineSuite) TestPipelineBlackHoleSink(c *check.C) {
+	defer testleak.AfterTest(c)()
+	entries, ts := captureTableEvents(c, 1, 2)
+	entries = append(entries, resolvedEntry(ts))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.GetDefaultReplicaConfig()
+	f, err := filter.NewFilter(cfg)
+	c.Assert(err, check.IsNil)
+	s1, err := sink.NewSink(ctx, "test-changefeed", "blackhole://", f, cfg, map[string]string{}, make(chan error, 1))
+	c.Assert(err, check.IsNil)
+	defer s1.Close() //nolint:errcheck
+	p := newTestPipeline(c, s1)
+	runPipeline(c, p, entries)
+	c.Assert(p.CheckpointTs(), check.Equals, ts)
+
+	// the pipeline without any resolved entry returns at once
+	p = newTestPipeline(c, s1)
+	runPipeline(c, p, nil)
+	c.Assert(p.CheckpointTs(), check.Equals, uint64(0))
+}
@@ -48,6 +48,26 @@ var (
 
 	ownerFlushInterval     time.Duration
 	processorFlushInterval time.Duration
+	serverClusterID        string
+	serverMode             string
+	serverZone             string
+
+	// variables for resource monitor
+	resourceCheckInterval time.Duration
+	diskSoftLimit         int
+	diskHardLimit         int
+	memorySoftLimit       int
+	memoryHardLimit       int
+
+	// variables for the global webhook
+	notifyWebhookURL   string
+	notifyLagThreshold int
+
+	// variables for the DDL pullers
+	ddlPullerMaxMemEntries    int
+	ddlPullerSpillDir         string
+	ddlPullerShared           bool
+	ddlPullerMaxSharedEntries int
 
 	serverCmd = &cobra.Command{
 		Use:   "server",
@@ -76,6 +96,9 @@ func init() {
 	serverCmd.Flags().StringVar(&logLevel, "log-level", "info", "log level (etc: debug|info|warn|error)")
 	serverCmd.Flags().DurationVar(&ownerFlushInterval, "owner-flush-interval", time.Millisecond*200, "owner flushes changefeed status interval")
 	serverCmd.Flags().DurationVar(&processorFlushInterval, "processor-flush-interval", time.Millisecond*100, "processor flushes task status interval")
+	serverCmd.Flags().StringVar(&serverClusterID, "cluster-id", "", "Set the ID of the TiCDC cluster, TiCDC clusters with different IDs can share one PD")
+	serverCmd.Flags().StringVar(&serverZone, "zone", "", "Set the zone of the server, the value of the TiKV store label of the scheduler locality-label in its zone, the tables are preferred to be replicated by the captures in the zones of their region leaders")
+	serverCmd.Flags().StringVar(&serverMode, "mode", cdc.ServerModeNormal, "Set the mode of the server (normal|observer), an observer serves the queries and the metrics without replicating any table")
 
 	serverCmd.Flags().IntVar(&numWorkerPoolGoroutine, "sorter-num-workerpool-goroutine", 16, "sorter workerpool size")
 	serverCmd.Flags().IntVar(&numConcurrentWorker, "sorter-num-concurrent-worker", 4, "sorter concurrency level")
@@ -85,6 +108,18 @@ func init() {
 	// We use 8GB as a safe default before we support local configuration file.
 	serverCmd.Flags().Uint64Var(&maxMemoryConsumption, "sorter-max-memory-consumption", 8*1024*1024*1024, "maximum memory consumption of in-memory sort")
 
+	serverCmd.Flags().DurationVar(&resourceCheckInterval, "resource-check-interval", 10*time.Second, "interval of checking the disk and memory usage, 0 disables the check")
+	serverCmd.Flags().IntVar(&diskSoftLimit, "disk-soft-limit-percentage", 85, "disk usage of sort dir for pausing the changefeeds with the lowest priority, 0 means no limit")
+	serverCmd.Flags().IntVar(&diskHardLimit, "disk-hard-limit-percentage", 95, "disk usage of sort dir for pausing all changefeeds using it, 0 means no limit")
+	serverCmd.Flags().IntVar(&memorySoftLimit, "memory-soft-limit-percentage", 80, "process memory usage for pausing the changefeeds with the lowest priority, 0 means no limit")
+	serverCmd.Flags().IntVar(&memoryHardLimit, "memory-hard-limit-percentage", 90, "process memory usage for pausing all changefeeds, 0 means no limit")
+	serverCmd.Flags().StringVar(&notifyWebhookURL, "notify-webhook-url", "", "webhook URL notified of the state transitions and the checkpoint lag of the changefeeds")
+	serverCmd.Flags().IntVar(&notifyLagThreshold, "notify-lag-threshold", 0, "checkpoint lag (s) of a changefeed to notify the webhook, 0 disables the lag notifications")
+	serverCmd.Flags().IntVar(&ddlPullerMaxMemEntries, "ddl-puller-max-mem-entries", 4096, "max number of the unresolved DDL entries buffered in memory by each DDL puller, the others are spilled to the disk")
+	serverCmd.Flags().StringVar(&ddlPullerSpillDir, "ddl-puller-spill-dir", "", "dir of the spilled DDL entries, empty means the temporary dir of the system")
+	serverCmd.Flags().BoolVar(&ddlPullerShared, "ddl-puller-shared", false, "share one DDL puller among the processors in the capture")
+	serverCmd.Flags().IntVar(&ddlPullerMaxSharedEntries, "ddl-puller-max-shared-entries", 4096, "max number of the DDL entries retained by the shared DDL puller for the processors starting later")
+
 	addSecurityFlags(serverCmd.Flags(), true /* isServer */)
 }
 
@@ -106,6 +141,16 @@ func runEServer(cmd *cobra.Command, args []string) error {
 		MaxMemoryConsumption:   maxMemoryConsumption,
 		NumWorkerPoolGoroutine: numWorkerPoolGoroutine,
 	})
+	ddlPullerConfig := &config.DDLPullerConfig{
+		MaxMemEntries:    ddlPullerMaxMemEntries,
+		SpillDir:         ddlPullerSpillDir,
+		Shared:           ddlPullerShared,
+		MaxSharedEntries: ddlPullerMaxSharedEntries,
+	}
+	if err := ddlPullerConfig.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	config.SetDDLPullerConfig(ddlPullerConfig)
 
 	version.LogVersionInfo()
 	opts := []cdc.ServerOption{
@@ -117,6 +162,20 @@ func runEServer(cmd *cobra.Command, args []string) error {
 		cdc.Credential(getCredential()),
 		cdc.OwnerFlushInterval(ownerFlushInterval),
 		cdc.ProcessorFlushInterval(processorFlushInterval),
+		cdc.ClusterID(serverClusterID),
+		cdc.Mode(serverMode),
+		cdc.Zone(serverZone),
+		cdc.ResourceMonitor(&config.ResourceMonitorConfig{
+			CheckInterval:   resourceCheckInterval,
+			DiskSoftLimit:   diskSoftLimit,
+			DiskHardLimit:   diskHardLimit,
+			MemorySoftLimit: memorySoftLimit,
+			MemoryHardLimit: memoryHardLimit,
+		}),
+		cdc.Notify(&config.NotifyConfig{
+			WebhookURL:   notifyWebhookURL,
+			LagThreshold: notifyLagThreshold,
+		}),
 	}
 	server, err := cdc.NewServer(opts...)
 	if err != nil {
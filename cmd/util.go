@@ -19,11 +19,15 @@ import (
 	liberrors "errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"os/user"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
@@ -34,11 +38,14 @@ import (
 	"github.com/pingcap/ticdc/cdc/model"
 	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/ticdc/pkg/filter"
 	"github.com/pingcap/ticdc/pkg/httputil"
 	"github.com/pingcap/ticdc/pkg/logutil"
 	"github.com/pingcap/ticdc/pkg/security"
 	"github.com/pingcap/ticdc/pkg/util"
+	tablefilter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"go.etcd.io/etcd/clientv3/concurrency"
@@ -109,7 +116,7 @@ func getAllCaptures(ctx context.Context) ([]*capture, error) {
 	if err != nil {
 		return nil, err
 	}
-	ownerID, err := cdcEtcdCli.GetOwnerID(ctx, kv.CaptureOwnerKey)
+	ownerID, err := cdcEtcdCli.GetOwnerID(ctx, cdcEtcdCli.CaptureOwnerKey())
 	if err != nil && errors.Cause(err) != concurrency.ErrElectionNoLeader {
 		return nil, err
 	}
@@ -153,11 +160,16 @@ func applyAdminChangefeed(ctx context.Context, job model.AdminJob, credential *s
 	if job.Opts != nil && job.Opts.ForceRemove {
 		forceRemoveOpt = "true"
 	}
-	resp, err := cli.PostForm(addr, url.Values(map[string][]string{
+	form := url.Values(map[string][]string{
 		cdc.APIOpVarAdminJob:           {fmt.Sprint(int(job.Type))},
 		cdc.APIOpVarChangefeedID:       {job.CfID},
 		cdc.APIOpForceRemoveChangefeed: {forceRemoveOpt},
-	}))
+		cdc.APIOpVarClient:             {clientInfo()},
+	})
+	if job.Opts != nil && job.Opts.OverwriteCheckpointTs != 0 {
+		form.Set(cdc.APIOpOverwriteCheckpointTs, strconv.FormatUint(job.Opts.OverwriteCheckpointTs, 10))
+	}
+	resp, err := cli.PostForm(addr, form)
 	if err != nil {
 		return err
 	}
@@ -171,6 +183,300 @@ func applyAdminChangefeed(ctx context.Context, job model.AdminJob, credential *s
 	return nil
 }
 
+func applySkipDDLOnce(ctx context.Context, cid model.ChangeFeedID, jobID int64, credential *security.Credential) error {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/skip_ddl", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.PostForm(addr, url.Values(map[string][]string{
+		cdc.APIOpVarChangefeedID: {cid},
+		cdc.APIOpVarDDLJobID:     {fmt.Sprint(jobID)},
+	}))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.BadRequestf("skip ddl failed")
+		}
+		return errors.BadRequestf("%s", string(body))
+	}
+	return nil
+}
+
+func applyUpdateBudget(
+	ctx context.Context, cid model.ChangeFeedID, memoryQuota int64, eventsPerSecond int, credential *security.Credential,
+) error {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/changefeed/budget", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		cdc.APIOpVarChangefeedID: {cid},
+		cdc.APIOpVarClient:       {clientInfo()},
+	}
+	if memoryQuota >= 0 {
+		form.Set(cdc.APIOpVarMemoryQuota, strconv.FormatInt(memoryQuota, 10))
+	}
+	if eventsPerSecond >= 0 {
+		form.Set(cdc.APIOpVarEventsPerSecond, strconv.Itoa(eventsPerSecond))
+	}
+	resp, err := cli.PostForm(addr, form)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.BadRequestf("update budget failed")
+		}
+		return errors.BadRequestf("%s", string(body))
+	}
+	return nil
+}
+
+func applyResetBreaker(ctx context.Context, cid model.ChangeFeedID, note string, credential *security.Credential) error {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/changefeed/reset_breaker", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.PostForm(addr, url.Values{
+		cdc.APIOpVarChangefeedID: {cid},
+		cdc.APIOpVarNote:         {note},
+		cdc.APIOpVarClient:       {clientInfo()},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.BadRequestf("reset circuit breaker failed")
+		}
+		return errors.BadRequestf("%s", string(body))
+	}
+	return nil
+}
+
+func applyRebalanceTrigger(ctx context.Context, cid model.ChangeFeedID, credential *security.Credential) error {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/rebalance_trigger", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.PostForm(addr, url.Values{
+		cdc.APIOpVarChangefeedID: {cid},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.BadRequestf("trigger rebalance failed")
+		}
+		return errors.BadRequestf("%s", string(body))
+	}
+	return nil
+}
+
+// applyOwnerRebalancePlan previews the rebalance plan of the changefeed
+// computed by the owner, no table is moved.
+func applyOwnerRebalancePlan(
+	ctx context.Context, cid model.ChangeFeedID, credential *security.Credential,
+) (*cdc.RebalancePlanResp, error) {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/rebalance_plan", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.PostForm(addr, url.Values{
+		cdc.APIOpVarChangefeedID: {cid},
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.BadRequestf("query rebalance plan")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.BadRequestf("%s", string(body))
+	}
+	plan := &cdc.RebalancePlanResp{}
+	err = json.Unmarshal(body, plan)
+	return plan, errors.Trace(err)
+}
+
+func applyOwnerChangefeedHistory(
+	ctx context.Context, cid model.ChangeFeedID, offset, limit int, credential *security.Credential,
+) (*cdc.ChangefeedHistoryResp, error) {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/capture/owner/changefeed/history", scheme, owner.AdvertiseAddr)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.PostForm(addr, url.Values(map[string][]string{
+		cdc.APIOpVarChangefeedID: {cid},
+		cdc.APIOpVarOffset:       {strconv.Itoa(offset)},
+		cdc.APIOpVarLimit:        {strconv.Itoa(limit)},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.BadRequestf("query changefeed history")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.BadRequestf("%s", string(body))
+	}
+	history := &cdc.ChangefeedHistoryResp{}
+	err = json.Unmarshal(body, history)
+	return history, errors.Trace(err)
+}
+
+// getChangefeedMetrics reads the metrics of the changefeed with the table
+// statistics in the window from the owner, which reads the processors from
+// all captures.
+func getChangefeedMetrics(
+	ctx context.Context, cid model.ChangeFeedID, window time.Duration, credential *security.Credential,
+) (*cdc.ChangefeedMetricsResp, error) {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%s://%s/api/v1/metrics/changefeeds/%s?%s=%s",
+		scheme, owner.AdvertiseAddr, cid, cdc.APIOpVarStatisticsWindow, window)
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Get(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.BadRequestf("query changefeed metrics")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.BadRequestf("%s", string(body))
+	}
+	metrics := &cdc.ChangefeedMetricsResp{}
+	err = json.Unmarshal(body, metrics)
+	return metrics, errors.Trace(err)
+}
+
+// applyOwnerGCSafepoint reads the service GC safepoint last pushed to PD from
+// the owner, the safepoint is pushed immediately before it's read if refresh
+// is set.
+func applyOwnerGCSafepoint(ctx context.Context, refresh bool, credential *security.Credential) (*cdc.GCSafepointResp, error) {
+	owner, err := getOwnerCapture(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if credential.IsTLSEnabled() {
+		scheme = "https"
+	}
+	cli, err := httputil.NewClient(credential)
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	if refresh {
+		resp, err = cli.PostForm(fmt.Sprintf("%s://%s/capture/owner/gc/refresh", scheme, owner.AdvertiseAddr), url.Values{})
+	} else {
+		resp, err = cli.Get(fmt.Sprintf("%s://%s/capture/owner/gc", scheme, owner.AdvertiseAddr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.BadRequestf("query gc safepoint")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.BadRequestf("%s", string(body))
+	}
+	safepoint := &cdc.GCSafepointResp{}
+	err = json.Unmarshal(body, safepoint)
+	return safepoint, errors.Trace(err)
+}
+
+// clientInfo describes the client in the changefeed history, e.g. "root@host-1"
+func clientInfo() string {
+	userName := "unknown"
+	if u, err := user.Current(); err == nil {
+		userName = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return userName + "@" + host
+}
+
 func applyOwnerChangefeedQuery(
 	ctx context.Context, cid model.ChangeFeedID, credential *security.Credential,
 ) (string, error) {
@@ -219,6 +525,37 @@ func verifyStartTs(ctx context.Context, startTs uint64) error {
 	return util.CheckSafetyOfStartTs(ctx, pdCli, startTs)
 }
 
+// verifyOverwriteCheckpointTs verifies the ts a paused changefeed is resumed
+// from, it must not be before the GC safe point.
+func verifyOverwriteCheckpointTs(ctx context.Context, changefeedID string, ts uint64, force bool) error {
+	status, _, err := cdcEtcdCli.GetChangeFeedStatus(ctx, changefeedID)
+	if err != nil {
+		return err
+	}
+	if err := checkOverwriteCheckpointTs(status, ts, force); err != nil {
+		return err
+	}
+	return util.CheckSafetyOfResumeTs(ctx, pdCli, ts)
+}
+
+// checkOverwriteCheckpointTs checks the changefeed is paused, and the ts it's
+// resumed from is not after its checkpoint ts unless force is set, because the
+// changes between them are skipped.
+func checkOverwriteCheckpointTs(status *model.ChangeFeedStatus, ts uint64, force bool) error {
+	if status.AdminJobType != model.AdminStop {
+		return errors.New("the changefeed must be paused before it's resumed from another checkpoint ts")
+	}
+	checkpointTs := status.CheckpointTs
+	if status.Pause != nil {
+		checkpointTs = status.Pause.PausedAtTs
+	}
+	if ts > checkpointTs && !force {
+		return errors.Errorf("overwrite-checkpoint-ts %d is after the checkpoint ts %d of the changefeed, "+
+			"the changes between them are skipped, use --force if it's expected", ts, checkpointTs)
+	}
+	return nil
+}
+
 func verifyTargetTs(ctx context.Context, startTs, targetTs uint64) error {
 	if targetTs > 0 && targetTs <= startTs {
 		return errors.Errorf("target-ts %d must be larger than start-ts: %d", targetTs, startTs)
@@ -226,6 +563,74 @@ func verifyTargetTs(ctx context.Context, startTs, targetTs uint64) error {
 	return nil
 }
 
+// verifySortEngine verifies the sort engine of a changefeed. The sort dir is
+// only checked to be specified here, whether it's available is checked by the
+// captures when the changefeed runs on them.
+func verifySortEngine(engine model.SortEngine, sortDir string) error {
+	switch engine {
+	case model.SortInMemory:
+		return nil
+	case model.SortInFile, model.SortUnified:
+		if sortDir == "" {
+			return errors.Errorf("sort-dir must be specified for the %s sort engine", engine)
+		}
+		return nil
+	default:
+		return cerror.ErrUnknownSortEngine.GenWithStackByArgs(engine)
+	}
+}
+
+// verifyTableStartTs verifies the start ts overrides of tables, each of them
+// must be in the range of [GC safe point, current TSO] and before the target ts.
+func verifyTableStartTs(ctx context.Context, cfg *config.ReplicaConfig, startTs, targetTs uint64) error {
+	if len(cfg.TableStartTs) == 0 {
+		return nil
+	}
+	ts, logical, err := pdCli.GetTS(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	currentTs := oracle.ComposeTS(ts, logical)
+	for _, rule := range cfg.TableStartTs {
+		if _, err := tablefilter.Parse(rule.Matcher); err != nil {
+			return cerror.WrapError(cerror.ErrFilterRuleInvalid, err)
+		}
+		if rule.StartTs == 0 {
+			return cerror.ErrTableStartTsInvalid.GenWithStackByArgs(rule.Matcher, "start-ts is not specified")
+		}
+		if rule.StartTs > currentTs {
+			return cerror.ErrTableStartTsInvalid.GenWithStackByArgs(rule.Matcher,
+				fmt.Sprintf("start-ts %d is larger than current ts %d", rule.StartTs, currentTs))
+		}
+		if targetTs > 0 && rule.StartTs >= targetTs {
+			return cerror.ErrTableStartTsInvalid.GenWithStackByArgs(rule.Matcher,
+				fmt.Sprintf("start-ts %d must be less than target-ts %d", rule.StartTs, targetTs))
+		}
+	}
+	// the changefeed starts from the minimum start ts of tables, protect it
+	// from GC instead of the start ts of the changefeed.
+	if minTs := cfg.MinTableStartTs(); minTs < startTs {
+		return verifyStartTs(ctx, minTs)
+	}
+	return nil
+}
+
+// verifySnapshotOnly checks the options which conflict with the snapshot-only
+// mode, in which the changes after start-ts are not replicated.
+func verifySnapshotOnly(cfg *config.ReplicaConfig, targetTs uint64, syncPointEnabled bool) error {
+	switch {
+	case targetTs > 0:
+		return cerror.ErrSnapshotOnlyConflict.GenWithStackByArgs("target-ts")
+	case syncPointEnabled:
+		return cerror.ErrSnapshotOnlyConflict.GenWithStackByArgs("sync-point")
+	case cfg.Cyclic.IsEnabled():
+		return cerror.ErrSnapshotOnlyConflict.GenWithStackByArgs("cyclic replication")
+	case len(cfg.TableStartTs) > 0:
+		return cerror.ErrSnapshotOnlyConflict.GenWithStackByArgs("table-start-ts")
+	}
+	return nil
+}
+
 func verifyTables(ctx context.Context, credential *security.Credential, cfg *config.ReplicaConfig, startTs uint64) (ineligibleTables, eligibleTables []model.TableName, err error) {
 	kvStore, err := kv.CreateTiStore(cliPdAddr, credential)
 	if err != nil {
@@ -289,6 +694,21 @@ func verifySink(
 	return nil
 }
 
+// readConfigText reads the config file to store with the changefeed info, it's
+// empty if the file is larger than model.MaxConfigTextSize.
+func readConfigText(cmd *cobra.Command, path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(data) > model.MaxConfigTextSize {
+		cmd.Printf("[WARN] the config file %s is larger than %d bytes, it's not stored with the changefeed\n",
+			path, model.MaxConfigTextSize)
+		return "", nil
+	}
+	return string(data), nil
+}
+
 // strictDecodeFile decodes the toml file strictly. If any item in confFile file is not mapped
 // into the Config struct, issue an error and stop the server from starting.
 func strictDecodeFile(path, component string, cfg interface{}) error {
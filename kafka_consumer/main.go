@@ -36,6 +36,7 @@ import (
 	"github.com/pingcap/ticdc/cdc/sink"
 	"github.com/pingcap/ticdc/cdc/sink/codec"
 	"github.com/pingcap/ticdc/pkg/config"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
 	cdcfilter "github.com/pingcap/ticdc/pkg/filter"
 	"github.com/pingcap/ticdc/pkg/logutil"
 	"github.com/pingcap/ticdc/pkg/quotes"
@@ -298,6 +299,11 @@ type Consumer struct {
 	maxDDLReceivedTs uint64
 	ddlListMu        sync.Mutex
 
+	// bootstrapTs records the commit ts of the last applied schema bootstrap
+	// event of each table, as the events are broadcast to all partitions.
+	bootstrapTs   map[model.TableName]uint64
+	bootstrapTsMu sync.Mutex
+
 	sinks []*struct {
 		sink.Sink
 		resolvedTs uint64
@@ -323,6 +329,7 @@ func NewConsumer(ctx context.Context) (*Consumer, error) {
 		return nil, errors.Trace(err)
 	}
 	c := new(Consumer)
+	c.bootstrapTs = make(map[model.TableName]uint64)
 	c.fakeTableIDGenerator = &fakeTableIDGenerator{
 		tableIDs: make(map[string]int64),
 	}
@@ -416,6 +423,12 @@ ClaimMessages:
 				if err != nil {
 					log.Fatal("decode message value failed", zap.ByteString("value", message.Value))
 				}
+				if ddl.IsBootstrap {
+					if err := c.applySchemaBootstrap(ctx, ddl); err != nil {
+						log.Fatal("apply schema bootstrap event failed", zap.Error(err))
+					}
+					break
+				}
 				c.appendDDL(ddl)
 			case model.MqMessageTypeRow:
 				row, err := batchDecoder.NextRowChangedEvent()
@@ -483,6 +496,23 @@ func (c *Consumer) appendDDL(ddl *model.DDLEvent) {
 	c.maxDDLReceivedTs = ddl.CommitTs
 }
 
+// applySchemaBootstrap executes the schema bootstrap event at once, it's safe
+// because the event only contains a `CREATE TABLE IF NOT EXISTS` statement.
+func (c *Consumer) applySchemaBootstrap(ctx context.Context, ddl *model.DDLEvent) error {
+	c.bootstrapTsMu.Lock()
+	defer c.bootstrapTsMu.Unlock()
+	table := model.TableName{Schema: ddl.TableInfo.Schema, Table: ddl.TableInfo.Table}
+	if ddl.CommitTs <= c.bootstrapTs[table] {
+		return nil
+	}
+	err := c.ddlSink.EmitDDLEvent(ctx, ddl)
+	if err != nil && cerror.ErrDDLEventIgnored.NotEqual(err) {
+		return errors.Trace(err)
+	}
+	c.bootstrapTs[table] = ddl.CommitTs
+	return nil
+}
+
 func (c *Consumer) getFrontDDL() *model.DDLEvent {
 	c.ddlListMu.Lock()
 	defer c.ddlListMu.Unlock()
@@ -586,14 +616,14 @@ func (c *Consumer) Run(ctx context.Context) error {
 	}
 }
 
-func syncFlushRowChangedEvents(ctx context.Context, sink sink.Sink, resolvedTs uint64) error {
+func syncFlushRowChangedEvents(ctx context.Context, s sink.Sink, resolvedTs uint64) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		checkpointTs, err := sink.FlushRowChangedEvents(ctx, resolvedTs)
+		checkpointTs, err := sink.FlushCheckpointTs(ctx, s, resolvedTs)
 		if err != nil {
 			return err
 		}
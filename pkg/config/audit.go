@@ -0,0 +1,24 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// AuditConfig represents the config of auditing the order of the rows sent to
+// the sink, which is used to diagnose the reordering bugs between the sorter
+// and the sink. It's disabled by default.
+type AuditConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// CacheSize is the max number of the recent keys whose last commit ts
+	// are tracked, the order of the other keys is not checked.
+	CacheSize int `toml:"cache-size" json:"cache-size"`
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// BudgetConfig represents the resource budget of a changefeed on each capture,
+// which keeps a changefeed from starving the others sharing the capture. It
+// can be adjusted while the changefeed is running.
+type BudgetConfig struct {
+	// MemoryQuota is the max bytes of the events buffered by the pullers of
+	// the changefeed and queued in its mounter, the pullers stop receiving
+	// the rows once it's reached. 0 means the default quota.
+	MemoryQuota int64 `toml:"memory-quota" json:"memory-quota" schema:"min=0"`
+	// EventsPerSecond is the max number of the row changed events sorted and
+	// mounted by the changefeed per second, 0 means unlimited.
+	EventsPerSecond int `toml:"events-per-second" json:"events-per-second" schema:"min=0"`
+	// StoreBytesPerSecond is the max bytes pulled from each TiKV store by the
+	// changefeed per second, which protects a struggling store. The streams to
+	// the store are paused in turn once it's reached. 0 means unlimited.
+	StoreBytesPerSecond int64 `toml:"store-bytes-per-second" json:"store-bytes-per-second" schema:"min=0"`
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// CheckpointGuardConfig represents the config of the guard which stops the
+// changefeed when its global checkpoint moves backwards
+type CheckpointGuardConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// Tolerance is the number of the seconds the global checkpoint can move
+	// backwards by before the guard trips
+	Tolerance int `toml:"tolerance" json:"tolerance" schema:"min=0"`
+}
+
+// Validate checks whether the tolerance is not negative
+func (c *CheckpointGuardConfig) Validate() error {
+	if c.Tolerance < 0 {
+		return cerror.ErrInvalidCheckpointGuardConfig.GenWithStack("tolerance %d must not be negative", c.Tolerance)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// the actions taken when the circuit breaker is tripped
+const (
+	// BreakerActionWarn records the failure and keeps replicating
+	BreakerActionWarn = "warn"
+	// BreakerActionPauseTable stops replicating the table the failure is
+	// detected on, the other tables keep replicating
+	BreakerActionPauseTable = "pause-table"
+	// BreakerActionPauseChangefeed stops the changefeed with an error
+	BreakerActionPauseChangefeed = "pause-changefeed"
+)
+
+// CircuitBreakerConfig represents the actions taken when the processors detect
+// the validation failures of the replicated data, the failures are recorded in
+// the changefeed history and notified to the webhook whatever the action is.
+// The breaker stays tripped until it's reset by the operator.
+type CircuitBreakerConfig struct {
+	// ConsistencyMismatch is the action on the rows mismatched between
+	// upstream and downstream found by the consistency check
+	ConsistencyMismatch string `toml:"consistency-mismatch" json:"consistency-mismatch" schema:"enum=warn|pause-table|pause-changefeed"`
+	// OrderingViolation is the action on the rows out of order found by the
+	// audit sink
+	OrderingViolation string `toml:"ordering-violation" json:"ordering-violation" schema:"enum=warn|pause-table|pause-changefeed"`
+	// QuarantinedRows is the action once the malformed rows of a table
+	// quarantined by the mounter exceed QuarantineThreshold
+	QuarantinedRows     string `toml:"quarantined-rows" json:"quarantined-rows" schema:"enum=warn|pause-table|pause-changefeed"`
+	QuarantineThreshold int    `toml:"quarantine-threshold" json:"quarantine-threshold" schema:"min=1"`
+}
+
+// Validate checks whether the actions are known
+func (c *CircuitBreakerConfig) Validate() error {
+	for _, action := range []string{c.ConsistencyMismatch, c.OrderingViolation, c.QuarantinedRows} {
+		switch action {
+		case BreakerActionWarn, BreakerActionPauseTable, BreakerActionPauseChangefeed:
+		default:
+			return cerror.ErrInvalidBreakerConfig.GenWithStack(
+				"unknown action %s, it must be one of warn, pause-table and pause-changefeed", action)
+		}
+	}
+	if c.QuarantineThreshold <= 0 {
+		return cerror.ErrInvalidBreakerConfig.GenWithStack(
+			"quarantine-threshold(%d) must be positive", c.QuarantineThreshold)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// CompactConfig represents the config of compacting the rows sent to the sink
+// in each flush interval, only the last change of each handle key is written
+// to the downstream. It's for the downstreams only interested in the latest
+// states of the rows, and disabled by default.
+type CompactConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// MaxKeys is the max number of the keys buffered for compaction, only the
+	// first and the last changes of each key are buffered. The buffered keys
+	// are written, and so are the rows until the next flush without
+	// compaction, once it's exceeded.
+	MaxKeys int `toml:"max-keys" json:"max-keys" schema:"min=0"`
+}
+
+// ValidateCompact checks whether the rows can be compacted with the other
+// options. The cyclic replication and the completeness require every row to
+// be replicated, and the old values are required to tell an update from an
+// insert. Whether the sink supports the compaction is checked by the sink.
+func (c *ReplicaConfig) ValidateCompact() error {
+	if c.Compact == nil || !c.Compact.Enable {
+		return nil
+	}
+	if c.Compact.MaxKeys < 0 {
+		return cerror.ErrInvalidCompactConfig.GenWithStack("max-keys(%d) must not be negative", c.Compact.MaxKeys)
+	}
+	if c.RequireCompleteness {
+		return cerror.ErrInvalidCompactConfig.GenWithStack("compact-per-flush can't be enabled when require-completeness is set")
+	}
+	if c.Cyclic.IsEnabled() {
+		return cerror.ErrInvalidCompactConfig.GenWithStack("compact-per-flush can't be enabled with the cyclic replication")
+	}
+	if !c.EnableOldValue {
+		return cerror.ErrInvalidCompactConfig.GenWithStack("compact-per-flush requires enable-old-value")
+	}
+	return nil
+}
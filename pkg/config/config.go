@@ -32,7 +32,12 @@ var defaultReplicaConfig = &ReplicaConfig{
 		Rules: []string{"*.*"},
 	},
 	Mounter: &MounterConfig{
-		WorkerNum: 16,
+		WorkerNum:               16,
+		InputChanSize:           1024,
+		SchemaWaitTimeout:       1800,
+		SchemaWaitWarnThreshold: 60,
+		PrepareWarnThreshold:    60,
+		PrepareTimeout:          3600,
 	},
 	Sink: &SinkConfig{
 		Protocol: "default",
@@ -41,8 +46,73 @@ var defaultReplicaConfig = &ReplicaConfig{
 		Enable: false,
 	},
 	Scheduler: &SchedulerConfig{
-		Tp:          "table-number",
-		PollingTime: -1,
+		Tp:             "table-number",
+		PollingTime:    -1,
+		LocalityWeight: 0.5,
+		LocalityLabel:  "zone",
+	},
+	ConsistencyCheck: &ConsistencyCheckConfig{
+		Enable:     false,
+		Interval:   60,
+		SampleSize: 10,
+		MaxQPS:     10,
+	},
+	EventLog: &EventLogConfig{
+		MaxValueBytes: 256,
+	},
+	Dedup: &DedupConfig{
+		WindowSize: 256,
+	},
+	DownstreamWriteCheck: &DownstreamWriteCheckConfig{
+		Enable:   false,
+		Interval: 60,
+	},
+	LargeTxn: &LargeTxnConfig{
+		RowThreshold:   100000,
+		AnnotateStatus: false,
+	},
+	SortDir: &SortDirConfig{
+		MinFreeBytes: 4 * 1024 * 1024 * 1024, // 4G
+	},
+	Notify: &NotifyConfig{},
+	Latency: &LatencyConfig{
+		SampleRate: 0.001,
+		TopNTables: 0,
+	},
+	SchemaCheck: &SchemaCheckConfig{
+		Mode: SchemaCheckOff,
+	},
+	CheckpointGuard: &CheckpointGuardConfig{
+		Enable:    true,
+		Tolerance: 0,
+	},
+	DDLUnsupportedAction: DDLUnsupportedError,
+	DDLIncludeViews:      true,
+	SchemaGC: &SchemaGCConfig{
+		AddTableWindow: 300,
+		Margin:         60,
+	},
+	Budget: &BudgetConfig{
+		MemoryQuota:         0,
+		EventsPerSecond:     0,
+		StoreBytesPerSecond: 0,
+	},
+	Audit: &AuditConfig{
+		Enable:    false,
+		CacheSize: 100000,
+	},
+	ThrottleSchedule: &ThrottleScheduleConfig{
+		TransitionSeconds: 60,
+	},
+	Compact: &CompactConfig{
+		Enable:  false,
+		MaxKeys: 100000,
+	},
+	CircuitBreaker: &CircuitBreakerConfig{
+		ConsistencyMismatch: BreakerActionWarn,
+		OrderingViolation:   BreakerActionWarn,
+		QuarantinedRows:     BreakerActionWarn,
+		QuarantineThreshold: 100,
 	},
 }
 
@@ -50,15 +120,42 @@ var defaultReplicaConfig = &ReplicaConfig{
 type ReplicaConfig replicaConfig
 
 type replicaConfig struct {
-	CaseSensitive    bool             `toml:"case-sensitive" json:"case-sensitive"`
-	EnableOldValue   bool             `toml:"enable-old-value" json:"enable-old-value"`
-	ForceReplicate   bool             `toml:"force-replicate" json:"force-replicate"`
-	CheckGCSafePoint bool             `toml:"check-gc-safe-point" json:"check-gc-safe-point"`
-	Filter           *FilterConfig    `toml:"filter" json:"filter"`
-	Mounter          *MounterConfig   `toml:"mounter" json:"mounter"`
-	Sink             *SinkConfig      `toml:"sink" json:"sink"`
-	Cyclic           *CyclicConfig    `toml:"cyclic-replication" json:"cyclic-replication"`
-	Scheduler        *SchedulerConfig `toml:"scheduler" json:"scheduler"`
+	CaseSensitive        bool                        `toml:"case-sensitive" json:"case-sensitive"`
+	EnableOldValue       bool                        `toml:"enable-old-value" json:"enable-old-value"`
+	ForceReplicate       bool                        `toml:"force-replicate" json:"force-replicate"`
+	CheckGCSafePoint     bool                        `toml:"check-gc-safe-point" json:"check-gc-safe-point"`
+	MaxDDLPerMinute      int                         `toml:"max-ddl-per-minute" json:"max-ddl-per-minute"`
+	Priority             int                         `toml:"priority" json:"priority"`
+	Filter               *FilterConfig               `toml:"filter" json:"filter"`
+	Mounter              *MounterConfig              `toml:"mounter" json:"mounter"`
+	Sink                 *SinkConfig                 `toml:"sink" json:"sink"`
+	Cyclic               *CyclicConfig               `toml:"cyclic-replication" json:"cyclic-replication"`
+	Scheduler            *SchedulerConfig            `toml:"scheduler" json:"scheduler"`
+	ConsistencyCheck     *ConsistencyCheckConfig     `toml:"consistency-check" json:"consistency-check"`
+	TableStartTs         []*TableStartTsRule         `toml:"table-start-ts" json:"table-start-ts,omitempty"`
+	EventLog             *EventLogConfig             `toml:"event-log" json:"event-log"`
+	Dedup                *DedupConfig                `toml:"dedup" json:"dedup"`
+	DownstreamWriteCheck *DownstreamWriteCheckConfig `toml:"downstream-write-check" json:"downstream-write-check"`
+	LargeTxn             *LargeTxnConfig             `toml:"large-txn" json:"large-txn"`
+	SortDir              *SortDirConfig              `toml:"sort-dir" json:"sort-dir"`
+	Notify               *NotifyConfig               `toml:"notify" json:"notify"`
+	Latency              *LatencyConfig              `toml:"latency" json:"latency"`
+	SchemaCheck          *SchemaCheckConfig          `toml:"schema-check" json:"schema-check"`
+	CheckpointGuard      *CheckpointGuardConfig      `toml:"checkpoint-guard" json:"checkpoint-guard"`
+	DDLUnsupportedAction string                      `toml:"ddl-unsupported-action" json:"ddl-unsupported-action" schema:"enum=error|skip|pause"`
+	DDLTimeoutSeconds    int                         `toml:"ddl-timeout-seconds" json:"ddl-timeout-seconds" schema:"min=0"`
+	DDLIncludeSequences  bool                        `toml:"ddl-include-sequences" json:"ddl-include-sequences"`
+	DDLIncludeViews      bool                        `toml:"ddl-include-views" json:"ddl-include-views"`
+	DormantTable         *DormantTableConfig         `toml:"dormant-table" json:"dormant-table"`
+	SchemaGC             *SchemaGCConfig             `toml:"schema-gc" json:"schema-gc"`
+	Budget               *BudgetConfig               `toml:"budget" json:"budget" schema:"hot"`
+	Audit                *AuditConfig                `toml:"audit" json:"audit"`
+	ThrottleSchedule     *ThrottleScheduleConfig     `toml:"throttle-schedule" json:"throttle-schedule" schema:"hot"`
+	Compact              *CompactConfig              `toml:"compact-per-flush" json:"compact-per-flush"`
+	CircuitBreaker       *CircuitBreakerConfig       `toml:"circuit-breaker" json:"circuit-breaker"`
+	// RequireCompleteness asserts every row is replicated exactly, the options
+	// which may skip rows are refused
+	RequireCompleteness bool `toml:"require-completeness" json:"require-completeness"`
 }
 
 // Marshal returns the json marshal format of a ReplicationConfig
@@ -0,0 +1,28 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// ConsistencyCheckConfig represents the config of checking the replicated rows
+// between upstream and downstream, it only works for MySQL sinks
+type ConsistencyCheckConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// Interval is the interval in seconds between two checks
+	Interval int `toml:"interval" json:"interval"`
+	// SampleSize is the number of recently replicated rows sampled in a check
+	SampleSize int `toml:"sample-size" json:"sample-size"`
+	// MaxQPS is the max number of rows read from upstream and downstream per second
+	MaxQPS int `toml:"max-qps" json:"max-qps"`
+	// FailOnMismatch stops the replication if any mismatched row is found
+	FailOnMismatch bool `toml:"fail-on-mismatch" json:"fail-on-mismatch"`
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// the actions taken when a DDL is not supported by the downstream
+const (
+	// DDLUnsupportedError stops the changefeed with an error
+	DDLUnsupportedError = "error"
+	// DDLUnsupportedSkip logs and skips the DDL, and the replication goes on
+	DDLUnsupportedSkip = "skip"
+	// DDLUnsupportedPause pauses the changefeed at the checkpoint before the
+	// DDL, it can be resumed after the DDL is handled by the operator
+	DDLUnsupportedPause = "pause"
+)
+
+// ValidateDDLUnsupportedAction checks whether the action is known, an empty
+// action is the same as DDLUnsupportedError.
+func ValidateDDLUnsupportedAction(action string) error {
+	switch action {
+	case "", DDLUnsupportedError, DDLUnsupportedSkip, DDLUnsupportedPause:
+		return nil
+	}
+	return cerror.ErrInvalidDDLAction.GenWithStackByArgs(action)
+}
+
+// GetDDLUnsupportedAction returns the action taken when a DDL is not
+// supported by the downstream
+func (c *ReplicaConfig) GetDDLUnsupportedAction() string {
+	if c == nil || c.DDLUnsupportedAction == "" {
+		return DDLUnsupportedError
+	}
+	return c.DDLUnsupportedAction
+}
+
+// ValidateDDLTimeout checks the ddl-timeout-seconds, zero means no timeout.
+func ValidateDDLTimeout(seconds int) error {
+	if seconds < 0 {
+		return cerror.ErrInvalidDDLTimeout.GenWithStackByArgs(seconds)
+	}
+	return nil
+}
+
+// GetDDLTimeout returns the time a DDL can be executed by the downstream for,
+// after which the ddl-unsupported-action is taken, the skip action is taken as
+// the error action, as the DDL may be still running in the downstream. Zero
+// means no timeout.
+func (c *ReplicaConfig) GetDDLTimeout() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return time.Duration(c.DDLTimeoutSeconds) * time.Second
+}
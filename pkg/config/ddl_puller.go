@@ -0,0 +1,89 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// DDLPullerConfig represents the config of the DDL pullers of the processors
+// and the owner in a capture
+type DDLPullerConfig struct {
+	// MaxMemEntries is the max number of the unresolved DDL entries buffered in
+	// memory by the sorter of a DDL puller, the entries exceeding it are
+	// spilled to the files in SpillDir
+	MaxMemEntries int `toml:"max-mem-entries" json:"max-mem-entries"`
+	// SpillDir is the dir of the spilled DDL entries, empty means the
+	// temporary dir of the system
+	SpillDir string `toml:"spill-dir" json:"spill-dir"`
+	// Shared means the processors in a capture share one DDL puller, a
+	// processor starting before the DDL entries retained by the shared DDL
+	// puller still runs its own DDL puller
+	Shared bool `toml:"shared" json:"shared"`
+	// MaxSharedEntries is the max number of the DDL entries retained by the
+	// shared DDL puller for the processors starting later
+	MaxSharedEntries int `toml:"max-shared-entries" json:"max-shared-entries"`
+}
+
+var defaultDDLPullerConfig = &DDLPullerConfig{
+	MaxMemEntries:    4096,
+	MaxSharedEntries: 4096,
+}
+
+var ddlPullerConfig *DDLPullerConfig
+
+// Validate checks whether the limits are positive
+func (c *DDLPullerConfig) Validate() error {
+	if c.MaxMemEntries <= 0 {
+		return cerror.ErrInvalidDDLPullerConfig.GenWithStack("max mem entries %d must be positive", c.MaxMemEntries)
+	}
+	if c.Shared && c.MaxSharedEntries <= 0 {
+		return cerror.ErrInvalidDDLPullerConfig.GenWithStack("max shared entries %d must be positive", c.MaxSharedEntries)
+	}
+	return nil
+}
+
+// GetSpillDir returns the dir of the spilled DDL entries
+func (c *DDLPullerConfig) GetSpillDir() string {
+	if c.SpillDir == "" {
+		return os.TempDir()
+	}
+	return c.SpillDir
+}
+
+// GetDefaultDDLPullerConfig returns the default DDL puller config
+func GetDefaultDDLPullerConfig() *DDLPullerConfig {
+	cfg := *defaultDDLPullerConfig
+	return &cfg
+}
+
+// GetDDLPullerConfig returns the process-local DDL puller config, the default
+// config is returned if it's not set
+func GetDDLPullerConfig() *DDLPullerConfig {
+	mu.Lock()
+	defer mu.Unlock()
+	if ddlPullerConfig == nil {
+		return GetDefaultDDLPullerConfig()
+	}
+	return ddlPullerConfig
+}
+
+// SetDDLPullerConfig sets the process-local DDL puller config
+func SetDDLPullerConfig(config *DDLPullerConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	ddlPullerConfig = config
+}
@@ -0,0 +1,22 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// DedupConfig represents the config of dropping the duplicate events of a
+// table, which may be re-delivered by the puller after region retries
+type DedupConfig struct {
+	// WindowSize is the number of the recent events of each table remembered
+	// to find the duplicates, 0 disables the dedup
+	WindowSize int `toml:"window-size" json:"window-size"`
+}
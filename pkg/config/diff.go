@@ -0,0 +1,168 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ConfigChange is a changed field of the config
+type ConfigChange struct {
+	// Path is the key of the field in the toml config file, the keys of the
+	// sections are separated by dots, and the elements of an array of tables
+	// are indexed, e.g. `sink.dispatchers[1].topic`
+	Path string `json:"path"`
+	// Old and New are the values of the field, nil means the field or the
+	// element of the array doesn't exist
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+	// HotReload means the changefeed needn't be paused to apply the change
+	HotReload bool `json:"hot-reload"`
+}
+
+// String implements fmt.Stringer
+func (c *ConfigChange) String() string {
+	reload := "requires pause"
+	if c.HotReload {
+		reload = "hot-reloadable"
+	}
+	return fmt.Sprintf("%s: %s → %s (%s)", c.Path, formatConfigValue(c.Old), formatConfigValue(c.New), reload)
+}
+
+func formatConfigValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// DiffConfig returns the changed fields from the old config struct to the new
+// one, which are of the same type, in the order of the fields in the config
+// file. The fields are named by the toml keys, and the `hot` option of the
+// schema tag marks the fields hot-reloadable, as the config schema does. The
+// nil sections are compared as the sections with the zero values.
+func DiffConfig(oldCfg, newCfg interface{}) ([]*ConfigChange, error) {
+	ov, nv := reflect.ValueOf(oldCfg), reflect.ValueOf(newCfg)
+	if ov.Type() != nv.Type() {
+		return nil, errors.Errorf("can't diff %T with %T", oldCfg, newCfg)
+	}
+	t, ov := indirect(ov.Type(), ov)
+	_, nv = indirect(nv.Type(), nv)
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%T is not a struct", oldCfg)
+	}
+	changes := make([]*ConfigChange, 0)
+	diffStruct(&changes, "", t, ov, nv, false)
+	return changes, nil
+}
+
+// diffStruct appends the changed fields of the struct type, the invalid
+// values are taken as the zero values.
+func diffStruct(changes *[]*ConfigChange, prefix string, t reflect.Type, ov, nv reflect.Value, hot bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		var ofv, nfv reflect.Value
+		if ov.IsValid() {
+			ofv = ov.Field(i)
+		}
+		if nv.IsValid() {
+			nfv = nv.Field(i)
+		}
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		fieldHot := hot || hasHotOption(field.Tag.Get(schemaTag))
+		// the embedded structs without a key are flattened, as the toml
+		// decoder does
+		if field.Anonymous && name == "" {
+			ft, ofv := indirect(field.Type, ofv)
+			_, nfv := indirect(field.Type, nfv)
+			diffStruct(changes, prefix, ft, ofv, nfv, fieldHot)
+			continue
+		}
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		diffField(changes, prefix+name, field.Type, ofv, nfv, fieldHot)
+	}
+}
+
+func diffField(changes *[]*ConfigChange, path string, t reflect.Type, ov, nv reflect.Value, hot bool) {
+	_, nv = indirect(t, nv)
+	t, ov = indirect(t, ov)
+	switch t.Kind() {
+	case reflect.Struct:
+		diffStruct(changes, path+".", t, ov, nv, hot)
+		return
+	case reflect.Slice, reflect.Array:
+		// the arrays of tables are diffed by the elements, so that a change
+		// of a rule is told apart from the other rules
+		if et, _ := indirect(t.Elem(), reflect.Value{}); et.Kind() == reflect.Struct {
+			olen, nlen := valueLen(ov), valueLen(nv)
+			for i := 0; i < olen || i < nlen; i++ {
+				elemPath := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= olen:
+					*changes = append(*changes, &ConfigChange{Path: elemPath, New: nv.Index(i).Interface(), HotReload: hot})
+				case i >= nlen:
+					*changes = append(*changes, &ConfigChange{Path: elemPath, Old: ov.Index(i).Interface(), HotReload: hot})
+				default:
+					diffField(changes, elemPath, t.Elem(), ov.Index(i), nv.Index(i), hot)
+				}
+			}
+			return
+		}
+		// the empty arrays are the same as the absent ones
+		if valueLen(ov) == 0 && valueLen(nv) == 0 {
+			return
+		}
+	}
+	oi, ni := valueInterface(t, ov), valueInterface(t, nv)
+	if reflect.DeepEqual(oi, ni) {
+		return
+	}
+	*changes = append(*changes, &ConfigChange{Path: path, Old: oi, New: ni, HotReload: hot})
+}
+
+func hasHotOption(tag string) bool {
+	for _, opt := range strings.Split(tag, ",") {
+		if opt == "hot" {
+			return true
+		}
+	}
+	return false
+}
+
+func valueLen(v reflect.Value) int {
+	if !v.IsValid() {
+		return 0
+	}
+	return v.Len()
+}
+
+// valueInterface returns the value, or the zero value of the type if the value
+// is invalid
+func valueInterface(t reflect.Type, v reflect.Value) interface{} {
+	if !v.IsValid() {
+		if t.Kind() == reflect.Slice {
+			return nil
+		}
+		return reflect.Zero(t).Interface()
+	}
+	return v.Interface()
+}
@@ -0,0 +1,23 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// DormantTableConfig represents the config of detaching the sorters of the
+// tables without writes, whose resolved ts are tracked by the pullers directly
+// until the next row changed event arrives. It's disabled by default.
+type DormantTableConfig struct {
+	// IdleSeconds is the period (s) without any row changed events for a
+	// table to be dormant, 0 disables it
+	IdleSeconds int `toml:"idle-seconds" json:"idle-seconds"`
+}
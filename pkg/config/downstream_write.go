@@ -0,0 +1,26 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// DownstreamWriteCheckConfig represents the config of detecting the rows written
+// to the downstream by others than the changefeed, it only works for MySQL sinks
+type DownstreamWriteCheckConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// Interval is the interval in seconds between two checks
+	Interval int `toml:"interval" json:"interval"`
+	// SentinelTables are the tables whose rows are counted in the downstream,
+	// in the format of `schema.table`. The rows are counted with a full scan,
+	// so the sentinel tables are expected to be small.
+	SentinelTables []string `toml:"sentinel-tables" json:"sentinel-tables"`
+}
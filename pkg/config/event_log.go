@@ -0,0 +1,22 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// EventLogConfig represents the config of logging the row changed events of
+// a changefeed, e.g. when an unexpected event is found
+type EventLogConfig struct {
+	// MaxValueBytes is the max bytes of a column value in the logs, the longer
+	// values are truncated
+	MaxValueBytes int `toml:"max-value-bytes" json:"max-value-bytes"`
+}
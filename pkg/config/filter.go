@@ -24,4 +24,7 @@ type FilterConfig struct {
 	*filter.MySQLReplicationRules
 	IgnoreTxnStartTs []uint64           `toml:"ignore-txn-start-ts" json:"ignore-txn-start-ts"`
 	DDLAllowlist     []model.ActionType `toml:"ddl-allow-list" json:"ddl-allow-list"`
+	// SensitiveColumns are the columns whose values are hashed in the logs,
+	// in the form of `schema.table.column`, the table part is a filter rule
+	SensitiveColumns []string `toml:"sensitive-columns" json:"sensitive-columns,omitempty"`
 }
@@ -0,0 +1,25 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// LargeTxnConfig represents the config of detecting the large transactions
+// before they are flushed to the sink, which may stall the changefeed
+type LargeTxnConfig struct {
+	// RowThreshold is the number of the rows of a transaction in a table to
+	// treat it as a large transaction, 0 disables the detection
+	RowThreshold int64 `toml:"row-threshold" json:"row-threshold"`
+	// AnnotateStatus reports the large transactions in progress to the owner,
+	// which shows them in the changefeed status
+	AnnotateStatus bool `toml:"annotate-status" json:"annotate-status"`
+}
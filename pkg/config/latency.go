@@ -0,0 +1,39 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// LatencyConfig represents the config of sampling the rows to measure the
+// end-to-end latency from the commit ts to the moment the sink flushes them
+type LatencyConfig struct {
+	// SampleRate is the fraction of the rows to sample, 0 disables the
+	// sampling and 1 samples all rows
+	SampleRate float64 `toml:"sample-rate" json:"sample-rate" schema:"min=0,max=1"`
+	// TopNTables is the number of the tables with the most sampled rows whose
+	// latency is also exported per table, 0 disables the per table latency
+	TopNTables int `toml:"top-n-tables" json:"top-n-tables" schema:"min=0"`
+}
+
+// Validate checks whether the sample rate is in [0, 1] and the number of the
+// tables is not negative
+func (c *LatencyConfig) Validate() error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return cerror.ErrInvalidLatencyConfig.GenWithStack("sample-rate %v must be in [0, 1]", c.SampleRate)
+	}
+	if c.TopNTables < 0 {
+		return cerror.ErrInvalidLatencyConfig.GenWithStack("top-n-tables %d must not be negative", c.TopNTables)
+	}
+	return nil
+}
@@ -13,7 +13,58 @@
 
 package config
 
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
 // MounterConfig represents mounter config for a changefeed
 type MounterConfig struct {
-	WorkerNum int `toml:"worker-num" json:"worker-num"`
+	WorkerNum int `toml:"worker-num" json:"worker-num" schema:"min=0"`
+	// InputChanSize is the number of the events queued for each worker,
+	// the sorter is blocked once the queue is full
+	InputChanSize int `toml:"input-chan-size" json:"input-chan-size" schema:"min=0"`
+	// SchemaWaitTimeout is the max seconds the mounter waits for the schema
+	// storage to catch up with the commit ts of a row, 0 means waiting forever
+	SchemaWaitTimeout int `toml:"schema-wait-timeout" json:"schema-wait-timeout" schema:"min=0"`
+	// SchemaWaitWarnThreshold is the seconds of waiting after which a warning
+	// is logged
+	SchemaWaitWarnThreshold int `toml:"schema-wait-warn-threshold" json:"schema-wait-warn-threshold" schema:"min=0"`
+	// PrepareWarnThreshold is the seconds of waiting for a row to be mounted
+	// after which a warning with the states of the mounter workers is logged
+	PrepareWarnThreshold int `toml:"prepare-warn-threshold" json:"prepare-warn-threshold" schema:"min=0"`
+	// PrepareTimeout is the max seconds waiting for a row to be mounted before
+	// the changefeed fails, 0 means waiting forever
+	PrepareTimeout int `toml:"prepare-timeout" json:"prepare-timeout" schema:"min=0"`
+	// DecodeTimeout is the max seconds of decoding a row, the time waiting for
+	// the schema storage excluded, 0 disables the timeout
+	DecodeTimeout int `toml:"decode-timeout" json:"decode-timeout" schema:"min=0"`
+	// SkipMalformedRow skips the rows which fail to be decoded or whose
+	// decoding times out instead of failing the changefeed, the raw entries
+	// of the failed rows are quarantined in the sort dir
+	SkipMalformedRow bool `toml:"skip-malformed-row" json:"skip-malformed-row"`
+}
+
+// Validate checks whether the input chan size and the timeouts are valid
+func (c *MounterConfig) Validate() error {
+	if c.InputChanSize < 0 {
+		return cerror.ErrInvalidMounterConfig.GenWithStack("input-chan-size %d must not be negative", c.InputChanSize)
+	}
+	if c.SchemaWaitTimeout < 0 || c.SchemaWaitWarnThreshold < 0 ||
+		c.PrepareWarnThreshold < 0 || c.PrepareTimeout < 0 || c.DecodeTimeout < 0 {
+		return cerror.ErrInvalidMounterConfig.GenWithStack("the timeouts and thresholds must not be negative")
+	}
+	// a row may wait for the schema storage before it's mounted, so it must
+	// not time out before the schema storage does
+	if c.PrepareTimeout > 0 && (c.SchemaWaitTimeout == 0 || c.PrepareTimeout <= c.SchemaWaitTimeout) {
+		return cerror.ErrInvalidMounterConfig.GenWithStack(
+			"prepare-timeout(%d) must be greater than schema-wait-timeout(%d), which must not be 0", c.PrepareTimeout, c.SchemaWaitTimeout)
+	}
+	return nil
+}
+
+// ValidateCompleteness checks whether the malformed rows are not skipped if
+// the completeness of the replication is required
+func (c *ReplicaConfig) ValidateCompleteness() error {
+	if c.RequireCompleteness && c.Mounter != nil && c.Mounter.SkipMalformedRow {
+		return cerror.ErrInvalidMounterConfig.GenWithStack("skip-malformed-row can't be enabled when require-completeness is set")
+	}
+	return nil
 }
@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/url"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// NotifyConfig represents the config of notifying a webhook when a changefeed
+// meets an error, fails, finishes or is resumed, and when its checkpoint lag
+// crosses the threshold. The config of a changefeed overrides the global
+// config of the server if it's set.
+type NotifyConfig struct {
+	// WebhookURL is the http or https URL which the notifications are POSTed
+	// to as JSON, empty means no webhook
+	WebhookURL string `toml:"webhook-url" json:"webhook-url"`
+	// LagThreshold is the checkpoint lag (s) to notify when it's exceeded
+	// and recovered, 0 disables the lag notifications
+	LagThreshold int `toml:"lag-threshold" json:"lag-threshold" schema:"min=0"`
+}
+
+// Validate checks whether the webhook URL is a valid http or https URL and
+// the lag threshold is not negative
+func (c *NotifyConfig) Validate() error {
+	if c.LagThreshold < 0 {
+		return cerror.ErrInvalidNotifyConfig.GenWithStack("negative lag threshold %d", c.LagThreshold)
+	}
+	if c.WebhookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.WebhookURL)
+	if err != nil {
+		return cerror.WrapError(cerror.ErrInvalidNotifyConfig, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cerror.ErrInvalidNotifyConfig.GenWithStack("invalid webhook url %s, it must be an http or https url", c.WebhookURL)
+	}
+	return nil
+}
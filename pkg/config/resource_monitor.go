@@ -0,0 +1,62 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// ResourceMonitorConfig represents the config of monitoring the disk usage of
+// sort dirs and the memory usage of a capture. The limits are percentages,
+// zero disables the limit.
+type ResourceMonitorConfig struct {
+	// CheckInterval is the interval between two samplings, zero disables the monitor
+	CheckInterval time.Duration `toml:"check-interval" json:"check-interval"`
+	// DiskSoftLimit is the used percentage of the file system of a sort dir,
+	// the changefeeds with the lowest priority are paused when it's reached
+	DiskSoftLimit int `toml:"disk-soft-limit" json:"disk-soft-limit"`
+	// DiskHardLimit is the used percentage of the file system of a sort dir,
+	// all changefeeds using the sort dir are paused when it's reached
+	DiskHardLimit int `toml:"disk-hard-limit" json:"disk-hard-limit"`
+	// MemorySoftLimit is the percentage of the process RSS to the memory limit,
+	// the changefeeds with the lowest priority are paused when it's reached
+	MemorySoftLimit int `toml:"memory-soft-limit" json:"memory-soft-limit"`
+	// MemoryHardLimit is the percentage of the process RSS to the memory limit,
+	// all changefeeds are paused when it's reached
+	MemoryHardLimit int `toml:"memory-hard-limit" json:"memory-hard-limit"`
+}
+
+// Validate checks whether the limits are valid percentages and the soft
+// limits don't exceed the hard limits
+func (c *ResourceMonitorConfig) Validate() error {
+	check := func(name string, soft, hard int) error {
+		if soft < 0 || soft > 100 || hard < 0 || hard > 100 {
+			return cerror.ErrInvalidServerOption.GenWithStack("%s limits must be in [0, 100]", name)
+		}
+		if soft != 0 && hard != 0 && soft > hard {
+			return cerror.ErrInvalidServerOption.GenWithStack(
+				"%s soft limit %d%% is larger than the hard limit %d%%", name, soft, hard)
+		}
+		return nil
+	}
+	if c.CheckInterval < 0 {
+		return cerror.ErrInvalidServerOption.GenWithStack("negative resource check interval")
+	}
+	if err := check("disk", c.DiskSoftLimit, c.DiskHardLimit); err != nil {
+		return err
+	}
+	return check("memory", c.MemorySoftLimit, c.MemoryHardLimit)
+}
@@ -13,9 +13,56 @@
 
 package config
 
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// the policies of scheduling the partitions of a partitioned table
+const (
+	// PartitionPolicySpread spreads the partitions across the captures evenly
+	PartitionPolicySpread = "spread"
+	// PartitionPolicyCoLocate places all partitions in the same capture
+	PartitionPolicyCoLocate = "co-locate"
+)
+
 // SchedulerConfig represents scheduler config for a changefeed
 type SchedulerConfig struct {
-	Tp string `toml:"type" json:"type"`
+	Tp string `toml:"type" json:"type" schema:"enum=table-number"`
 	// PollingTime represents the polling cycle of checking the skewness of workload and try to do schedule if needed
 	PollingTime int `toml:"polling-time" json:"polling-time"`
+	// PartitionPolicies are the policies of scheduling the partitions of the
+	// matched tables, the first matched rule wins, the partitions of the
+	// tables which don't match any rule are spread.
+	PartitionPolicies []*PartitionPolicyRule `toml:"partition-policies" json:"partition-policies,omitempty"`
+	// LocalityWeight is how strongly the tables are preferred to be placed in
+	// the captures in the zones of their region leaders, in [0, 1]. A capture
+	// may hold up to LocalityWeight times the average number of tables more
+	// than the average to take its local tables, zero disables the locality.
+	LocalityWeight float64 `toml:"locality-weight" json:"locality-weight" schema:"min=0,max=1"`
+	// LocalityLabel is the key of the TiKV store label whose value is the
+	// zone of the store, it's matched with the zones of the captures.
+	LocalityLabel string `toml:"locality-label" json:"locality-label"`
+}
+
+// PartitionPolicyRule sets the policy of scheduling the partitions of the
+// matched tables
+type PartitionPolicyRule struct {
+	Matcher []string `toml:"matcher" json:"matcher"`
+	Policy  string   `toml:"policy" json:"policy" schema:"enum=spread|co-locate"`
+}
+
+// Validate checks whether the partition policies are known and the locality
+// weight is in range
+func (c *SchedulerConfig) Validate() error {
+	if c.LocalityWeight < 0 || c.LocalityWeight > 1 {
+		return cerror.ErrInvalidSchedulerConfig.GenWithStack(
+			"invalid locality-weight %v, it must be in [0, 1]", c.LocalityWeight)
+	}
+	for _, rule := range c.PartitionPolicies {
+		switch rule.Policy {
+		case PartitionPolicySpread, PartitionPolicyCoLocate:
+		default:
+			return cerror.ErrInvalidSchedulerConfig.GenWithStack(
+				"unknown partition policy %s of %v, it must be one of spread and co-locate", rule.Policy, rule.Matcher)
+		}
+	}
+	return nil
 }
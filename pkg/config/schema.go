@@ -0,0 +1,211 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// the types of the fields in the config schema
+const (
+	SchemaTypeBool   = "bool"
+	SchemaTypeInt    = "int"
+	SchemaTypeUint   = "uint"
+	SchemaTypeFloat  = "float"
+	SchemaTypeString = "string"
+	SchemaTypeArray  = "array"
+	SchemaTypeObject = "object"
+)
+
+// schemaTag is the struct tag of the validation constraints of a config field,
+// in the format of comma separated options:
+//   - `min=N` and `max=N` are the inclusive bounds of a number
+//   - `enum=a|b` are the allowed values of a string, or of the elements of an
+//     array of strings
+//   - `hot` means the field, and all fields in it, can be updated while the
+//     changefeed is running
+const schemaTag = "schema"
+
+// FieldSchema describes a field of the config, which is generated from the
+// struct tags of the config types, so that it never drifts from them.
+type FieldSchema struct {
+	// Name is the key of the field in the toml config file
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Default is the default value of the field, it's omitted for the objects
+	// and for the fields without defaults
+	Default   interface{} `json:"default,omitempty"`
+	Min       *float64    `json:"min,omitempty"`
+	Max       *float64    `json:"max,omitempty"`
+	Enum      []string    `json:"enum,omitempty"`
+	HotReload bool        `json:"hot-reload"`
+	// Fields are the fields of an object
+	Fields []*FieldSchema `json:"fields,omitempty"`
+	// Items is the schema of the elements of an array
+	Items *FieldSchema `json:"items,omitempty"`
+}
+
+// GetReplicaConfigSchema returns the schema of the replica config, with the
+// values of the default replica config as the defaults.
+func GetReplicaConfigSchema() ([]*FieldSchema, error) {
+	return GenerateSchema(GetDefaultReplicaConfig())
+}
+
+// GenerateSchema generates the schema of the fields of the config struct, the
+// values of the fields are taken as the defaults.
+func GenerateSchema(cfg interface{}) ([]*FieldSchema, error) {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, cerror.ErrInvalidConfigSchema.GenWithStack("%T is not a struct", cfg)
+	}
+	return structSchema(v.Type(), v, false)
+}
+
+// structSchema generates the schema of the fields of the struct type, v is
+// the invalid value if there are no defaults.
+func structSchema(t reflect.Type, v reflect.Value, hot bool) ([]*FieldSchema, error) {
+	fields := make([]*FieldSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		// the embedded structs without a key are flattened, as the toml
+		// decoder does
+		if field.Anonymous && name == "" {
+			ft, fv := indirect(field.Type, fv)
+			embedded, err := structSchema(ft, fv, hot)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		schema, err := fieldSchema(name, field.Type, fv, field.Tag.Get(schemaTag), hot)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, schema)
+	}
+	return fields, nil
+}
+
+func fieldSchema(name string, t reflect.Type, v reflect.Value, tag string, hot bool) (*FieldSchema, error) {
+	schema := &FieldSchema{Name: name, HotReload: hot}
+	if err := schema.parseTag(tag); err != nil {
+		return nil, errors.Annotatef(err, "field %s", name)
+	}
+	t, v = indirect(t, v)
+	switch t.Kind() {
+	case reflect.Bool:
+		schema.Type = SchemaTypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema.Type = SchemaTypeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema.Type = SchemaTypeUint
+	case reflect.Float32, reflect.Float64:
+		schema.Type = SchemaTypeFloat
+	case reflect.String:
+		schema.Type = SchemaTypeString
+	case reflect.Slice, reflect.Array:
+		schema.Type = SchemaTypeArray
+		// the enum applies to the elements
+		items, err := fieldSchema("", t.Elem(), reflect.Value{}, "", schema.HotReload)
+		if err != nil {
+			return nil, errors.Annotatef(err, "field %s", name)
+		}
+		items.Enum = schema.Enum
+		schema.Items = items
+		if v.IsValid() && v.Len() > 0 {
+			schema.Default = v.Interface()
+		}
+		return schema, nil
+	case reflect.Struct:
+		schema.Type = SchemaTypeObject
+		fields, err := structSchema(t, v, schema.HotReload)
+		if err != nil {
+			return nil, err
+		}
+		schema.Fields = fields
+		return schema, nil
+	default:
+		return nil, cerror.ErrInvalidConfigSchema.GenWithStack("field %s: unsupported type %s", name, t)
+	}
+	if v.IsValid() {
+		schema.Default = v.Interface()
+	}
+	return schema, nil
+}
+
+func (s *FieldSchema) parseTag(tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		switch kv[0] {
+		case "hot":
+			s.HotReload = true
+			continue
+		case "min", "max", "enum":
+			if len(kv) != 2 || kv[1] == "" {
+				return cerror.ErrInvalidConfigSchema.GenWithStack("option %s has no value", kv[0])
+			}
+		default:
+			return cerror.ErrInvalidConfigSchema.GenWithStack("unknown option %s", opt)
+		}
+		if kv[0] == "enum" {
+			s.Enum = strings.Split(kv[1], "|")
+			continue
+		}
+		bound, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return cerror.ErrInvalidConfigSchema.GenWithStack("invalid %s %s", kv[0], kv[1])
+		}
+		if kv[0] == "min" {
+			s.Min = &bound
+		} else {
+			s.Max = &bound
+		}
+	}
+	return nil
+}
+
+// indirect dereferences the pointer type, and the value if it's not nil
+func indirect(t reflect.Type, v reflect.Value) (reflect.Type, reflect.Value) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Value{}
+			} else {
+				v = v.Elem()
+			}
+		}
+	}
+	return t, v
+}
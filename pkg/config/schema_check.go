@@ -0,0 +1,48 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import cerror "github.com/pingcap/ticdc/pkg/errors"
+
+// the modes of checking the downstream schema of the tables
+const (
+	// SchemaCheckOff disables the check
+	SchemaCheckOff = "off"
+	// SchemaCheckLenient logs a warning and replicates the table anyway if
+	// the downstream schema of the table is incompatible
+	SchemaCheckLenient = "lenient"
+	// SchemaCheckStrict fails the table if the downstream schema of the table
+	// is incompatible
+	SchemaCheckStrict = "strict"
+)
+
+// SchemaCheckConfig represents the config of checking whether the downstream
+// table is compatible with the upstream table before the table is replicated
+type SchemaCheckConfig struct {
+	Mode string `toml:"mode" json:"mode" schema:"enum=off|lenient|strict"`
+}
+
+// Validate checks whether the mode is known
+func (c *SchemaCheckConfig) Validate() error {
+	switch c.Mode {
+	case SchemaCheckOff, SchemaCheckLenient, SchemaCheckStrict:
+		return nil
+	}
+	return cerror.ErrInvalidSchemaCheckConfig.GenWithStack("unknown mode %s, it must be one of off, lenient and strict", c.Mode)
+}
+
+// Enabled returns whether the downstream schema of the tables is checked
+func (c *SchemaCheckConfig) Enabled() bool {
+	return c != nil && (c.Mode == SchemaCheckLenient || c.Mode == SchemaCheckStrict)
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// SchemaGCConfig represents the config of the gc of the schema storage in the
+// processors
+type SchemaGCConfig struct {
+	// AddTableWindow is the period (s) after a table is added, during which
+	// the schema snapshots after its start ts are kept for its puller
+	AddTableWindow int `toml:"add-table-window" json:"add-table-window"`
+	// Margin is the period (s) of the schema snapshots kept before the gc ts
+	Margin int `toml:"margin" json:"margin"`
+}
@@ -16,11 +16,36 @@ package config
 // SinkConfig represents sink config for a changefeed
 type SinkConfig struct {
 	DispatchRules []*DispatchRule `toml:"dispatchers" json:"dispatchers"`
-	Protocol      string          `toml:"protocol" json:"protocol"`
+	Protocol      string          `toml:"protocol" json:"protocol" schema:"enum=default|canal|avro|maxwell|canal-json"`
+	// SchemaBootstrap enables sending the full schema of a table to the MQ
+	// when the table starts to be replicated, or when it's requested by the
+	// HTTP API, so that consumers joining a topic mid-stream can learn the schema.
+	SchemaBootstrap bool `toml:"schema-bootstrap" json:"schema-bootstrap"`
+	// SchemaChangesTopic is the MQ topic which all DDLs are sent to, besides
+	// the topics of the tables the DDLs affect.
+	SchemaChangesTopic string `toml:"schema-changes-topic" json:"schema-changes-topic,omitempty"`
+	// Targets routes the matched tables to other downstream databases than
+	// the one in the sink uri, it's only supported by the MySQL sink. The
+	// tables which don't match any target are written to the sink uri.
+	Targets []*TargetRule `toml:"targets" json:"targets,omitempty"`
 }
 
 // DispatchRule represents partition rule for a table
 type DispatchRule struct {
 	Matcher    []string `toml:"matcher" json:"matcher"`
-	Dispatcher string   `toml:"dispatcher" json:"dispatcher"`
+	Dispatcher string   `toml:"dispatcher" json:"dispatcher" schema:"enum=default|rowid|ts|table|index-value"`
+	// Topic is the MQ topic which the matched tables are sent to,
+	// an empty topic means the default topic in the sink uri. The topic can
+	// be an expression with the `{schema}` and `{table}` placeholders, e.g.
+	// `cdc_{schema}`.
+	Topic string `toml:"topic" json:"topic,omitempty"`
+}
+
+// TargetRule represents a downstream database which the matched tables are
+// written to. A table can't match more than one target.
+type TargetRule struct {
+	Matcher []string `toml:"matcher" json:"matcher"`
+	// SinkURI is the uri of the downstream database, whose parameters are
+	// the same as the MySQL sink uri of the changefeed.
+	SinkURI string `toml:"sink-uri" json:"sink-uri"`
 }
@@ -0,0 +1,22 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// SortDirConfig represents the config of the capacity of the sort dir used by
+// the sort engines sorting on disk
+type SortDirConfig struct {
+	// MinFreeBytes is the free space of the file system of the sort dir to
+	// start the sorter of a table, 0 disables the check
+	MinFreeBytes uint64 `toml:"min-free-bytes" json:"min-free-bytes"`
+}
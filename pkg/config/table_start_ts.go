@@ -0,0 +1,33 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// TableStartTsRule overrides the start ts of the matched tables, it's used
+// when the tables are already replicated to different ts by other tools.
+type TableStartTsRule struct {
+	Matcher []string `toml:"matcher" json:"matcher"`
+	StartTs uint64   `toml:"start-ts" json:"start-ts"`
+}
+
+// MinTableStartTs returns the minimum start ts of the table start ts
+// overrides, 0 is returned if there is no override.
+func (c *ReplicaConfig) MinTableStartTs() uint64 {
+	var minTs uint64
+	for _, rule := range c.TableStartTs {
+		if minTs == 0 || rule.StartTs < minTs {
+			minTs = rule.StartTs
+		}
+	}
+	return minTs
+}
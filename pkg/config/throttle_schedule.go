@@ -0,0 +1,124 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	cerror "github.com/pingcap/ticdc/pkg/errors"
+)
+
+// ThrottleScheduleConfig represents the time windows in which the events per
+// second limit of a changefeed differs from the one of its budget, e.g. the
+// changefeed catches up at full speed at night and is throttled in the
+// business hours. It can be adjusted while the changefeed is running.
+type ThrottleScheduleConfig struct {
+	// TimeZone is the time zone the windows are evaluated in, the empty
+	// value means the local time zone of the capture.
+	TimeZone string `toml:"time-zone" json:"time-zone"`
+	// TransitionSeconds is how long the limit takes to move from the limit
+	// of a window to the one of the next, 0 means the limit is switched at
+	// once.
+	TransitionSeconds int `toml:"transition-seconds" json:"transition-seconds" schema:"min=0"`
+	// Windows are checked in order, the first window containing the time
+	// applies. The events per second of the budget applies out of the
+	// windows.
+	Windows []*ThrottleWindow `toml:"windows" json:"windows,omitempty"`
+}
+
+// ThrottleWindow is a daily time window with its events per second limit.
+type ThrottleWindow struct {
+	// Start and End are in the format of HH:MM, the window wraps to the
+	// next day if End is not after Start, e.g. 22:00 to 06:00.
+	Start string `toml:"start" json:"start"`
+	End   string `toml:"end" json:"end"`
+	// Days are the weekdays the window starts on, such as mon and sat,
+	// the empty value means every day.
+	Days []string `toml:"days" json:"days,omitempty" schema:"enum=sun|mon|tue|wed|thu|fri|sat"`
+	// EventsPerSecond is the max number of the row changed events sorted
+	// and mounted by the changefeed per second in the window, 0 means
+	// unlimited.
+	EventsPerSecond int `toml:"events-per-second" json:"events-per-second" schema:"min=0"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseClock parses the time of the day in the format of HH:MM into the
+// minutes since the midnight, 24:00 is accepted as the end of the day.
+func ParseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) == 2 && len(parts[0]) == 2 && len(parts[1]) == 2 {
+		hour, err1 := strconv.Atoi(parts[0])
+		minute, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && hour >= 0 && minute >= 0 && minute < 60 &&
+			(hour < 24 || hour == 24 && minute == 0) {
+			return hour*60 + minute, nil
+		}
+	}
+	return 0, cerror.ErrInvalidThrottleConfig.GenWithStack("invalid time %s, it must be in the format of HH:MM", clock)
+}
+
+// ParseWeekday parses the abbreviated weekday, such as mon, case insensitively.
+func ParseWeekday(day string) (time.Weekday, error) {
+	weekday, ok := weekdays[strings.ToLower(day)]
+	if !ok {
+		return 0, cerror.ErrInvalidThrottleConfig.GenWithStack("invalid day %s, it must be one of sun, mon, tue, wed, thu, fri and sat", day)
+	}
+	return weekday, nil
+}
+
+// Validate checks whether the time zone is known, and the time and the days
+// of the windows are valid
+func (c *ThrottleScheduleConfig) Validate() error {
+	switch strings.ToLower(c.TimeZone) {
+	case "", "system", "local":
+	default:
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return cerror.ErrInvalidThrottleConfig.GenWithStack("unknown time-zone %s", c.TimeZone)
+		}
+	}
+	if c.TransitionSeconds < 0 {
+		return cerror.ErrInvalidThrottleConfig.GenWithStack("transition-seconds %d must not be negative", c.TransitionSeconds)
+	}
+	for i, w := range c.Windows {
+		if w == nil {
+			return cerror.ErrInvalidThrottleConfig.GenWithStack("window %d is empty", i)
+		}
+		if _, err := ParseClock(w.Start); err != nil {
+			return err
+		}
+		if _, err := ParseClock(w.End); err != nil {
+			return err
+		}
+		for _, day := range w.Days {
+			if _, err := ParseWeekday(day); err != nil {
+				return err
+			}
+		}
+		if w.EventsPerSecond < 0 {
+			return cerror.ErrInvalidThrottleConfig.GenWithStack("events-per-second %d must not be negative", w.EventsPerSecond)
+		}
+	}
+	return nil
+}
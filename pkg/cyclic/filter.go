@@ -63,9 +63,11 @@ func (m MarkMap) shouldFilterTxn(startTs uint64, filterReplicaIDs []uint64, repl
 // FilterAndReduceTxns filters duplicate txns bases on filterReplicaIDs and
 // if the mark table dml is exist in the txn, this functiong will set the replicaID by mark table dml
 // if the mark table dml is not exist, this function will set the replicaID by config
+// It returns the number of the mark table rows removed, and the number of the
+// data rows filtered for the loop prevention.
 func FilterAndReduceTxns(
 	txnsMap map[model.TableID][]*model.SingleTableTxn, filterReplicaIDs []uint64, replicaID uint64,
-) (skippedRowCount int) {
+) (markRowCount, filteredRowCount int) {
 	markMap := make(MarkMap)
 	for _, txns := range txnsMap {
 		if !mark.IsMarkTable(txns[0].Table.Schema, txns[0].Table.Table) {
@@ -94,7 +96,7 @@ func FilterAndReduceTxns(
 			delete(txnsMap, table)
 			for i := range txns {
 				// For simplicity, we do not count mark table rows in statistics.
-				skippedRowCount += len(txns[i].Rows)
+				markRowCount += len(txns[i].Rows)
 			}
 			continue
 		}
@@ -105,7 +107,7 @@ func FilterAndReduceTxns(
 			if needSkip {
 				// Found cyclic mark, skip this event as it originly created from
 				// downstream.
-				skippedRowCount += len(txn.Rows)
+				filteredRowCount += len(txn.Rows)
 				continue
 			}
 			txn.ReplicaID = replicaID
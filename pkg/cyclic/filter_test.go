@@ -215,3 +215,29 @@ func (s *markSuite) TestFilterAndReduceTxns(c *check.C) {
 		c.Assert(tc.input, check.DeepEquals, tc.output, check.Commentf("case %d %s\n", i, spew.Sdump(tc)))
 	}
 }
+
+func (s *markSuite) TestFilterAndReduceTxnsRowCount(c *check.C) {
+	defer testleak.AfterTest(c)()
+	rID := mark.CyclicReplicaIDCol
+	markTable := &model.TableName{Schema: "tidb_cdc", Table: "repl_mark_test_t"}
+	dataTable := &model.TableName{Schema: "test", Table: "t"}
+	txns := map[model.TableID][]*model.SingleTableTxn{
+		1: {
+			{Table: markTable, StartTs: 1, Rows: []*model.RowChangedEvent{{StartTs: 1, Columns: []*model.Column{{Name: rID, Value: uint64(10)}}}}},
+			{Table: markTable, StartTs: 2, Rows: []*model.RowChangedEvent{{StartTs: 2, Columns: []*model.Column{{Name: rID, Value: uint64(20)}}}}},
+		},
+		2: {
+			// the txn is from the replica 10, which is filtered
+			{Table: dataTable, StartTs: 1, Rows: []*model.RowChangedEvent{{StartTs: 1}, {StartTs: 1}, {StartTs: 1}}},
+			{Table: dataTable, StartTs: 2, Rows: []*model.RowChangedEvent{{StartTs: 2}}},
+			{Table: dataTable, StartTs: 3, Rows: []*model.RowChangedEvent{{StartTs: 3}, {StartTs: 3}}},
+		},
+	}
+	markRows, filteredRows := FilterAndReduceTxns(txns, []uint64{10}, 1)
+	c.Assert(markRows, check.Equals, 2)
+	c.Assert(filteredRows, check.Equals, 3)
+	c.Assert(txns, check.HasLen, 1)
+	c.Assert(txns[2], check.HasLen, 2)
+	c.Assert(txns[2][0].ReplicaID, check.Equals, uint64(20))
+	c.Assert(txns[2][1].ReplicaID, check.Equals, uint64(1))
+}
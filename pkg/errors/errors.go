@@ -24,6 +24,7 @@ var (
 	ErrChangeFeedNotExists     = errors.Normalize("changefeed not exists, key: %s", errors.RFCCodeText("CDC:ErrChangeFeedNotExists"))
 	ErrChangeFeedAlreadyExists = errors.Normalize("changefeed already exists, key: %s", errors.RFCCodeText("CDC:ErrChangeFeedAlreadyExists"))
 	ErrTaskStatusNotExists     = errors.Normalize("task status not exists, key: %s", errors.RFCCodeText("CDC:ErrTaskStatusNotExists"))
+	ErrEtcdValueCorrupted      = errors.Normalize("the value of key %s is corrupted: %s, value: %s", errors.RFCCodeText("CDC:ErrEtcdValueCorrupted"))
 	ErrTaskPositionNotExists   = errors.Normalize("task position not exists, key: %s", errors.RFCCodeText("CDC:ErrTaskPositionNotExists"))
 	ErrCaptureNotExist         = errors.Normalize("capture not exists, key: %s", errors.RFCCodeText("CDC:ErrCaptureNotExist"))
 	ErrGetAllStoresFailed      = errors.Normalize("get stores from pd failed", errors.RFCCodeText("CDC:ErrGetAllStoresFailed"))
@@ -42,6 +43,7 @@ var (
 	ErrPrewriteNotMatch       = errors.Normalize("prewrite not match, key: %b, start-ts: %d", errors.RFCCodeText("CDC:ErrPrewriteNotMatch"))
 	ErrGetRegionFailed        = errors.Normalize("get region failed", errors.RFCCodeText("CDC:ErrGetRegionFailed"))
 	ErrScanLockFailed         = errors.Normalize("scan lock failed", errors.RFCCodeText("CDC:ErrScanLockFailed"))
+	ErrPullerSnapshotScan     = errors.Normalize("scan the snapshot failed", errors.RFCCodeText("CDC:ErrPullerSnapshotScan"))
 	ErrResolveLocks           = errors.Normalize("resolve locks failed", errors.RFCCodeText("CDC:ErrResolveLocks"))
 	ErrLocateRegion           = errors.Normalize("locate region by id", errors.RFCCodeText("CDC:ErrLocateRegion"))
 	ErrKVStorageSendReq       = errors.Normalize("send req to kv storage", errors.RFCCodeText("CDC:ErrKVStorageSendReq"))
@@ -55,9 +57,12 @@ var (
 	ErrNewStore               = errors.Normalize("new store failed", errors.RFCCodeText("CDC:ErrNewStore"))
 
 	// rule related errors
-	ErrEncodeFailed      = errors.Normalize("encode failed: %s", errors.RFCCodeText("CDC:ErrEncodeFailed"))
-	ErrDecodeFailed      = errors.Normalize("decode failed: %s", errors.RFCCodeText("CDC:ErrDecodeFailed"))
-	ErrFilterRuleInvalid = errors.Normalize("filter rule is invalid", errors.RFCCodeText("CDC:ErrFilterRuleInvalid"))
+	ErrEncodeFailed           = errors.Normalize("encode failed: %s", errors.RFCCodeText("CDC:ErrEncodeFailed"))
+	ErrDecodeFailed           = errors.Normalize("decode failed: %s", errors.RFCCodeText("CDC:ErrDecodeFailed"))
+	ErrFilterRuleInvalid      = errors.Normalize("filter rule is invalid", errors.RFCCodeText("CDC:ErrFilterRuleInvalid"))
+	ErrTableStartTsInvalid    = errors.Normalize("table start-ts override %v is invalid: %s", errors.RFCCodeText("CDC:ErrTableStartTsInvalid"))
+	ErrSnapshotOnlyConflict   = errors.Normalize("snapshot-only can't be used with %s", errors.RFCCodeText("CDC:ErrSnapshotOnlyConflict"))
+	ErrTopicExpressionInvalid = errors.Normalize("topic expression %s is invalid: %s", errors.RFCCodeText("CDC:ErrTopicExpressionInvalid"))
 
 	// internal errors
 	ErrAdminStopProcessor = errors.Normalize("stop processor by admin command", errors.RFCCodeText("CDC:ErrAdminStopProcessor"))
@@ -75,11 +80,16 @@ var (
 	ErrKafkaNewSaramaProducer    = errors.Normalize("new sarama producer", errors.RFCCodeText("CDC:ErrKafkaNewSaramaProducer"))
 	ErrKafkaInvalidClientID      = errors.Normalize("invalid kafka client ID '%s'", errors.RFCCodeText("CDC:ErrKafkaInvalidClientID"))
 	ErrKafkaInvalidVersion       = errors.Normalize("invalid kafka version", errors.RFCCodeText("CDC:ErrKafkaInvalidVersion"))
+	ErrKafkaIdempotentNotSupport = errors.Normalize("kafka idempotent producer is not supported, %s", errors.RFCCodeText("CDC:ErrKafkaIdempotentNotSupport"))
+	ErrKafkaCodecNotSupport      = errors.Normalize("kafka compression %s is not supported, %s", errors.RFCCodeText("CDC:ErrKafkaCodecNotSupport"))
+	ErrKafkaDeleteTopic          = errors.Normalize("kafka delete topic %s failed", errors.RFCCodeText("CDC:ErrKafkaDeleteTopic"))
+	ErrKafkaPartitionNumChanged  = errors.Normalize("the partition number of kafka topic is changed from %d to %d, %s", errors.RFCCodeText("CDC:ErrKafkaPartitionNumChanged"))
 	ErrPulsarNewProducer         = errors.Normalize("new pulsar producer", errors.RFCCodeText("CDC:ErrPulsarNewProducer"))
 	ErrPulsarSendMessage         = errors.Normalize("pulsar send message failed", errors.RFCCodeText("CDC:ErrPulsarSendMessage"))
 	ErrFileSinkCreateDir         = errors.Normalize("file sink create dir", errors.RFCCodeText("CDC:ErrFileSinkCreateDir"))
 	ErrFileSinkFileOp            = errors.Normalize("file sink file operation", errors.RFCCodeText("CDC:ErrFileSinkFileOp"))
 	ErrFileSinkMetaAlreadyExists = errors.Normalize("file sink meta file already exists", errors.RFCCodeText("CDC:ErrFileSinkMetaAlreadyExists"))
+	ErrFileSinkLogCorrupted      = errors.Normalize("the changefeed log in %s is corrupted: %s", errors.RFCCodeText("CDC:ErrFileSinkLogCorrupted"))
 	ErrS3SinkWriteStorage        = errors.Normalize("write to storage", errors.RFCCodeText("CDC:ErrS3SinkWriteStorage"))
 	ErrS3SinkInitialzie          = errors.Normalize("new s3 sink", errors.RFCCodeText("CDC:ErrS3SinkInitialzie"))
 	ErrS3SinkStorageAPI          = errors.Normalize("s3 sink storage api", errors.RFCCodeText("CDC:ErrS3SinkStorageAPI"))
@@ -91,7 +101,16 @@ var (
 	ErrMySQLQueryError           = errors.Normalize("MySQL query error", errors.RFCCodeText("CDC:ErrMySQLQueryError"))
 	ErrMySQLConnectionError      = errors.Normalize("MySQL connection error", errors.RFCCodeText("CDC:ErrMySQLConnectionError"))
 	ErrMySQLInvalidConfig        = errors.Normalize("MySQL config invaldi", errors.RFCCodeText("CDC:ErrMySQLInvalidConfig"))
+	ErrInvalidSessionVariable    = errors.Normalize("invalid session variable %s: %s", errors.RFCCodeText("CDC:ErrInvalidSessionVariable"))
 	ErrMySQLWorkerPanic          = errors.Normalize("MySQL worker panic", errors.RFCCodeText("CDC:ErrMySQLWorkerPanic"))
+	ErrTableSchemaIncompatible   = errors.Normalize("the downstream schema of table %s is incompatible: %s", errors.RFCCodeText("CDC:ErrTableSchemaIncompatible"))
+	ErrDownstreamTableNotExists  = errors.Normalize("the downstream schema of table %s is incompatible: the table doesn't exist in the downstream", errors.RFCCodeText("CDC:ErrDownstreamTableNotExists"))
+	ErrSQLSinkInvalidConfig      = errors.Normalize("SQL sink config invalid", errors.RFCCodeText("CDC:ErrSQLSinkInvalidConfig"))
+	ErrSQLSinkConnectionError    = errors.Normalize("SQL sink connection error", errors.RFCCodeText("CDC:ErrSQLSinkConnectionError"))
+	ErrSQLSinkTxnError           = errors.Normalize("SQL sink txn error", errors.RFCCodeText("CDC:ErrSQLSinkTxnError"))
+	ErrSinkIncompatibleConfig    = errors.Normalize("the changefeed config is incompatible with the sink %s: %s", errors.RFCCodeText("CDC:ErrSinkIncompatibleConfig"))
+	ErrSinkTargetConflict        = errors.Normalize("the table %s is routed to conflicting targets: %s", errors.RFCCodeText("CDC:ErrSinkTargetConflict"))
+	ErrConsistencyCheckMismatch  = errors.Normalize("%d of %d sampled rows are mismatched between upstream and downstream at ts %d", errors.RFCCodeText("CDC:ErrConsistencyCheckMismatch"))
 	ErrAvroToEnvelopeError       = errors.Normalize("to envelope failed", errors.RFCCodeText("CDC:ErrAvroToEnvelopeError"))
 	ErrAvroUnknownType           = errors.Normalize("unknown type for Avro: %v", errors.RFCCodeText("CDC:ErrAvroUnknownType"))
 	ErrAvroMarshalFailed         = errors.Normalize("json marshal failed", errors.RFCCodeText("CDC:ErrAvroMarshalFailed"))
@@ -106,6 +125,16 @@ var (
 	ErrCanalEncodeFailed         = errors.Normalize("canal encode failed", errors.RFCCodeText("CDC:ErrCanalEncodeFailed"))
 	ErrOldValueNotEnabled        = errors.Normalize("old value is not enabled", errors.RFCCodeText("CDC:ErrOldValueNotEnabled"))
 
+	// the DDLs not supported by the downstream
+	ErrDDLUnsupportedByDownstream = errors.Normalize("DDL %s is not supported by the downstream: %s", errors.RFCCodeText("CDC:ErrDDLUnsupportedByDownstream"))
+	ErrPausedOnUnsupportedDDL     = errors.Normalize("changefeed is paused on the DDL %s not supported by the downstream", errors.RFCCodeText("CDC:ErrPausedOnUnsupportedDDL"))
+	ErrDDLExecutionTimeout        = errors.Normalize("DDL %s is not finished by the downstream in %s", errors.RFCCodeText("CDC:ErrDDLExecutionTimeout"))
+	ErrDDLExecutionUnknown        = errors.Normalize("can't tell whether DDL %s is executed by the downstream, %s", errors.RFCCodeText("CDC:ErrDDLExecutionUnknown"))
+	ErrPausedOnDDLTimeout         = errors.Normalize("changefeed is paused on the DDL %s not finished by the downstream in %s", errors.RFCCodeText("CDC:ErrPausedOnDDLTimeout"))
+
+	// the circuit breaker related errors
+	ErrCircuitBreakerTripped = errors.Normalize("changefeed is paused by the circuit breaker on the %s of table %d: %s", errors.RFCCodeText("CDC:ErrCircuitBreakerTripped"))
+
 	// utilities related errors
 	ErrToTLSConfigFailed         = errors.Normalize("generate tls config failed", errors.RFCCodeText("CDC:ErrToTLSConfigFailed"))
 	ErrCheckClusterVersionFromPD = errors.Normalize("failed to request PD", errors.RFCCodeText("CDC:ErrCheckClusterVersionFromPD"))
@@ -131,14 +160,26 @@ var (
 	ErrInvalidEtcdKey        = errors.Normalize("invalid key: %s", errors.RFCCodeText("CDC:ErrInvalidEtcdKey"))
 
 	// schema storage errors
-	ErrSchemaStorageUnresolved = errors.Normalize("can not found schema snapshot, the specified ts(%d) is more than resolvedTs(%d)", errors.RFCCodeText("CDC:ErrSchemaStorageUnresolved"))
-	ErrSchemaStorageGCed       = errors.Normalize("can not found schema snapshot, the specified ts(%d) is less than gcTS(%d)", errors.RFCCodeText("CDC:ErrSchemaStorageGCed"))
-	ErrSchemaSnapshotNotFound  = errors.Normalize("can not found schema snapshot, ts: %d", errors.RFCCodeText("CDC:ErrSchemaSnapshotNotFound"))
-	ErrSchemaStorageTableMiss  = errors.Normalize("table %d not found", errors.RFCCodeText("CDC:ErrSchemaStorageTableMiss"))
-	ErrSnapshotSchemaNotFound  = errors.Normalize("schema %d not found in schema snapshot", errors.RFCCodeText("CDC:ErrSnapshotSchemaNotFound"))
-	ErrSnapshotTableNotFound   = errors.Normalize("table %d not found in schema snapshot", errors.RFCCodeText("CDC:ErrSnapshotTableNotFound"))
-	ErrSnapshotSchemaExists    = errors.Normalize("schema %s(%d) already exists", errors.RFCCodeText("CDC:ErrSnapshotSchemaExists"))
-	ErrSnapshotTableExists     = errors.Normalize("table %s.%s already exists", errors.RFCCodeText("CDC:ErrSnapshotTableExists"))
+	ErrSchemaStorageUnresolved  = errors.Normalize("can not found schema snapshot, the specified ts(%d) is more than resolvedTs(%d)", errors.RFCCodeText("CDC:ErrSchemaStorageUnresolved"))
+	ErrSchemaStorageWaitTimeout = errors.Normalize("wait for the schema storage to be resolved to ts(%d) timeout after %s, the resolvedTs is %d, the DDL puller may lag behind", errors.RFCCodeText("CDC:ErrSchemaStorageWaitTimeout"))
+	ErrSchemaStorageGCed        = errors.Normalize("can not found schema snapshot, the specified ts(%d) is less than gcTS(%d)", errors.RFCCodeText("CDC:ErrSchemaStorageGCed"))
+	ErrSchemaSnapshotNotFound   = errors.Normalize("can not found schema snapshot, ts: %d", errors.RFCCodeText("CDC:ErrSchemaSnapshotNotFound"))
+	ErrSchemaHistoryNotFound    = errors.Normalize("the schema history of table %d from the start ts(%d) to the first schema snapshot(%d) can not be loaded, the start ts may be earlier than the GC safepoint, please add the table with a later start ts", errors.RFCCodeText("CDC:ErrSchemaHistoryNotFound"))
+	ErrSchemaStorageTableMiss   = errors.Normalize("table %d not found", errors.RFCCodeText("CDC:ErrSchemaStorageTableMiss"))
+	ErrSnapshotSchemaNotFound   = errors.Normalize("schema %d not found in schema snapshot", errors.RFCCodeText("CDC:ErrSnapshotSchemaNotFound"))
+	ErrSnapshotTableNotFound    = errors.Normalize("table %d not found in schema snapshot", errors.RFCCodeText("CDC:ErrSnapshotTableNotFound"))
+	ErrSnapshotSchemaExists     = errors.Normalize("schema %s(%d) already exists", errors.RFCCodeText("CDC:ErrSnapshotSchemaExists"))
+	ErrSnapshotTableExists      = errors.Normalize("table %s.%s already exists", errors.RFCCodeText("CDC:ErrSnapshotTableExists"))
+
+	// mounter related errors
+	ErrMounterPrepareTimeout = errors.Normalize("the row of table %d at commit ts %d is not mounted after %s", errors.RFCCodeText("CDC:ErrMounterPrepareTimeout"))
+	ErrMounterDecodeTimeout  = errors.Normalize("decoding the row of table %d at commit ts %d timeout after %s", errors.RFCCodeText("CDC:ErrMounterDecodeTimeout"))
+	ErrMounterMalformedRow   = errors.Normalize("malformed row of table %d at commit ts %d: %s", errors.RFCCodeText("CDC:ErrMounterMalformedRow"))
+	ErrMounterQuarantine     = errors.Normalize("quarantine the malformed row failed", errors.RFCCodeText("CDC:ErrMounterQuarantine"))
+
+	// checkpoint guard related errors
+	ErrCheckpointRegressed          = errors.Normalize("the global checkpoint ts %d is lower than the checkpoint ts %d observed before by more than %s, update the checkpoint-guard config of the changefeed to resume it after reviewing", errors.RFCCodeText("CDC:ErrCheckpointRegressed"))
+	ErrInvalidCheckpointGuardConfig = errors.Normalize("invalid checkpoint guard config", errors.RFCCodeText("CDC:ErrInvalidCheckpointGuardConfig"))
 
 	// puller related errors
 	ErrBufferReachLimit      = errors.Normalize("puller mem buffer reach size limit", errors.RFCCodeText("CDC:ErrBufferReachLimit"))
@@ -148,25 +189,49 @@ var (
 	ErrFileSorterEncode      = errors.Normalize("encode failed", errors.RFCCodeText("CDC:ErrFileSorterEncode"))
 	ErrFileSorterDecode      = errors.Normalize("decode failed", errors.RFCCodeText("CDC:ErrFileSorterDecode"))
 	ErrFileSorterInvalidData = errors.Normalize("invalid data", errors.RFCCodeText("CDC:ErrFileSorterInvalidData"))
+	ErrDDLPullerLagged       = errors.Normalize("the subscriber of the shared ddl puller lags behind the retained %d ddl entries", errors.RFCCodeText("CDC:ErrDDLPullerLagged"))
 
 	// server related errors
 	ErrCaptureSuicide             = errors.Normalize("capture suicide", errors.RFCCodeText("CDC:ErrCaptureSuicide"))
+	ErrCaptureSessionDone         = errors.Normalize("the etcd session of capture %s is done, lease %x", errors.RFCCodeText("CDC:ErrCaptureSessionDone"))
 	ErrNewCaptureFailed           = errors.Normalize("new capture failed", errors.RFCCodeText("CDC:ErrNewCaptureFailed"))
 	ErrCaptureRegister            = errors.Normalize("capture register to etcd failed", errors.RFCCodeText("CDC:ErrCaptureRegister"))
+	ErrCaptureResourcePressure    = errors.Normalize("changefeed is paused by capture %s because of resource pressure: %s", errors.RFCCodeText("CDC:ErrCaptureResourcePressure"))
+	ErrCaptureSortDir             = errors.Normalize("sort dir %s is not available in capture %s: %s", errors.RFCCodeText("CDC:ErrCaptureSortDir"))
+	ErrCaptureSortDirCapacity     = errors.Normalize("the free space %d bytes of sort dir %s in capture %s is less than %d bytes", errors.RFCCodeText("CDC:ErrCaptureSortDirCapacity"))
+	ErrNoCaptureSortCapacity      = errors.Normalize("no capture has sort capacity for table %d: %s", errors.RFCCodeText("CDC:ErrNoCaptureSortCapacity"))
 	ErrNewProcessorFailed         = errors.Normalize("new processor failed", errors.RFCCodeText("CDC:ErrNewProcessorFailed"))
 	ErrProcessorUnknown           = errors.Normalize("processor running unknown error", errors.RFCCodeText("CDC:ErrProcessorUnknown"))
 	ErrProcessorTableNotFound     = errors.Normalize("table not found in processor cache", errors.RFCCodeText("CDC:ErrProcessorTableNotFound"))
+	ErrTableNotReplicated         = errors.Normalize("table %d is not replicated by any capture of changefeed %s", errors.RFCCodeText("CDC:ErrTableNotReplicated"))
+	ErrTableOperationNotPending   = errors.Normalize("no operation of table %d is pending on capture %s of changefeed %s", errors.RFCCodeText("CDC:ErrTableOperationNotPending"))
+	ErrTableOperationNotProcessed = errors.Normalize("the %s operation of table %d is not processed by capture %s, it can't be finished before it's processed", errors.RFCCodeText("CDC:ErrTableOperationNotProcessed"))
+	ErrProcessorNotFound          = errors.Normalize("processor of changefeed %s not found in the capture", errors.RFCCodeText("CDC:ErrProcessorNotFound"))
+	ErrProcessorSinkCloseTimeout  = errors.Normalize("the sink of the processor is not flushed and closed in %s", errors.RFCCodeText("CDC:ErrProcessorSinkCloseTimeout"))
 	ErrProcessorEtcdWatch         = errors.Normalize("etcd watch returns error", errors.RFCCodeText("CDC:ErrProcessorEtcdWatch"))
 	ErrProcessorSortDir           = errors.Normalize("sort dir error", errors.RFCCodeText("CDC:ErrProcessorSortDir"))
 	ErrUnknownSortEngine          = errors.Normalize("unknown sort engine %s", errors.RFCCodeText("CDC:ErrUnknownSortEngine"))
 	ErrInvalidTaskKey             = errors.Normalize("invalid task key: %s", errors.RFCCodeText("CDC:ErrInvalidTaskKey"))
 	ErrInvalidServerOption        = errors.Normalize("invalid server option", errors.RFCCodeText("CDC:ErrInvalidServerOption"))
+	ErrInvalidNotifyConfig        = errors.Normalize("invalid notify config", errors.RFCCodeText("CDC:ErrInvalidNotifyConfig"))
+	ErrInvalidLatencyConfig       = errors.Normalize("invalid latency config", errors.RFCCodeText("CDC:ErrInvalidLatencyConfig"))
+	ErrInvalidSchemaCheckConfig   = errors.Normalize("invalid schema check config", errors.RFCCodeText("CDC:ErrInvalidSchemaCheckConfig"))
+	ErrInvalidCompactConfig       = errors.Normalize("invalid compact-per-flush config", errors.RFCCodeText("CDC:ErrInvalidCompactConfig"))
+	ErrInvalidBreakerConfig       = errors.Normalize("invalid circuit breaker config", errors.RFCCodeText("CDC:ErrInvalidBreakerConfig"))
+	ErrInvalidDDLPullerConfig     = errors.Normalize("invalid ddl puller config", errors.RFCCodeText("CDC:ErrInvalidDDLPullerConfig"))
+	ErrInvalidDDLAction           = errors.Normalize("invalid ddl-unsupported-action %s, it must be one of error, skip and pause", errors.RFCCodeText("CDC:ErrInvalidDDLAction"))
+	ErrInvalidDDLTimeout          = errors.Normalize("invalid ddl-timeout-seconds %d, it must not be negative", errors.RFCCodeText("CDC:ErrInvalidDDLTimeout"))
+	ErrInvalidMounterConfig       = errors.Normalize("invalid mounter config", errors.RFCCodeText("CDC:ErrInvalidMounterConfig"))
+	ErrInvalidSchedulerConfig     = errors.Normalize("invalid scheduler config", errors.RFCCodeText("CDC:ErrInvalidSchedulerConfig"))
+	ErrInvalidThrottleConfig      = errors.Normalize("invalid throttle schedule config", errors.RFCCodeText("CDC:ErrInvalidThrottleConfig"))
+	ErrInvalidConfigSchema        = errors.Normalize("invalid config schema", errors.RFCCodeText("CDC:ErrInvalidConfigSchema"))
 	ErrServerNewPDClient          = errors.Normalize("server creates pd client failed", errors.RFCCodeText("CDC:ErrServerNewPDClient"))
 	ErrServeHTTP                  = errors.Normalize("serve http error", errors.RFCCodeText("CDC:ErrServeHTTP"))
 	ErrCaptureCampaignOwner       = errors.Normalize("campaign owner failed", errors.RFCCodeText("CDC:ErrCaptureCampaignOwner"))
 	ErrCaptureResignOwner         = errors.Normalize("resign owner failed", errors.RFCCodeText("CDC:ErrCaptureResignOwner"))
 	ErrWaitHandleOperationTimeout = errors.Normalize("waiting processor to handle the operation finished timeout", errors.RFCCodeText("CDC:ErrWaitHandleOperationTimeout"))
 	ErrSupportPostOnly            = errors.Normalize("this api supports POST method only", errors.RFCCodeText("CDC:ErrSupportPostOnly"))
+	ErrSupportGetOnly             = errors.Normalize("this api supports GET method only", errors.RFCCodeText("CDC:ErrSupportGetOnly"))
 	ErrAPIInvalidParam            = errors.Normalize("invalid api parameter", errors.RFCCodeText("CDC:ErrAPIInvalidParam"))
 	ErrInternalServerError        = errors.Normalize("internal server error", errors.RFCCodeText("CDC:ErrInternalServerError"))
 	ErrOwnerSortDir               = errors.Normalize("owner sort dir", errors.RFCCodeText("CDC:ErrOwnerSortDir"))
@@ -175,6 +240,7 @@ var (
 	ErrInvalidAdminJobType        = errors.Normalize("invalid admin job type: %d", errors.RFCCodeText("CDC:ErrInvalidAdminJobType"))
 	ErrOwnerEtcdWatch             = errors.Normalize("etcd watch returns error", errors.RFCCodeText("CDC:ErrOwnerEtcdWatch"))
 	ErrOwnerCampaignKeyDeleted    = errors.Normalize("owner campaign key deleted", errors.RFCCodeText("CDC:ErrOwnerCampaignKeyDeleted"))
+	ErrSchemaBootstrapFailed      = errors.Normalize("build schema bootstrap event failed", errors.RFCCodeText("CDC:ErrSchemaBootstrapFailed"))
 
 	// EtcdWorker related errors. Internal use only.
 	// ErrEtcdTryAgain is used by a PatchFunc to force a transaction abort.
@@ -194,4 +260,8 @@ var (
 
 	// unified sorter errors
 	ErrUnifiedSorterBackendTerminating = errors.Normalize("unified sorter backend is terminating", errors.RFCCodeText("CDC:ErrUnifiedSorterBackendTerminating"))
+
+	// apply errors
+	ErrApplyInvalidUpstream = errors.Normalize("invalid upstream uri of apply: %s", errors.RFCCodeText("CDC:ErrApplyInvalidUpstream"))
+	ErrApplyDecodeMessage   = errors.Normalize("decode the open protocol message failed", errors.RFCCodeText("CDC:ErrApplyDecodeMessage"))
 )
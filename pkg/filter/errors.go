@@ -15,11 +15,13 @@ package filter
 
 import (
 	"github.com/pingcap/parser/terror"
+	cerror "github.com/pingcap/ticdc/pkg/errors"
 	"github.com/pingcap/tidb/store/tikv"
 )
 
 // ChangefeedFastFailError checks the error, returns true if it is meaningless
 // to retry on this error
 func ChangefeedFastFailError(err error) bool {
-	return terror.ErrorEqual(err, tikv.ErrGCTooEarly)
+	return terror.ErrorEqual(err, tikv.ErrGCTooEarly) ||
+		cerror.ErrInvalidSessionVariable.Equal(err) || cerror.ErrSQLSinkInvalidConfig.Equal(err)
 }
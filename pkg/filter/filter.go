@@ -28,6 +28,34 @@ type Filter struct {
 	ignoreTxnStartTs []uint64
 	ddlAllowlist     []model.ActionType
 	isCyclicEnabled  bool
+	includeSequences bool
+	includeViews     bool
+}
+
+// DDLObject is the kind of the schema object which a DDL changes
+type DDLObject string
+
+// the kinds of the schema objects
+const (
+	DDLObjectSchema   DDLObject = "schema"
+	DDLObjectTable    DDLObject = "table"
+	DDLObjectView     DDLObject = "view"
+	DDLObjectSequence DDLObject = "sequence"
+)
+
+// ClassifyDDL returns the kind of the object which the DDL of the type changes,
+// the views and the sequences have no rows, so their DDLs are replicated or
+// skipped by the ddl-include-views and ddl-include-sequences options.
+func ClassifyDDL(ddlType model.ActionType) DDLObject {
+	switch ddlType {
+	case model.ActionCreateSchema, model.ActionDropSchema, model.ActionModifySchemaCharsetAndCollate:
+		return DDLObjectSchema
+	case model.ActionCreateView, model.ActionDropView:
+		return DDLObjectView
+	case model.ActionCreateSequence, model.ActionAlterSequence, model.ActionDropSequence:
+		return DDLObjectSequence
+	}
+	return DDLObjectTable
 }
 
 // NewFilter creates a filter
@@ -54,6 +82,8 @@ func NewFilter(cfg *config.ReplicaConfig) (*Filter, error) {
 		ignoreTxnStartTs: cfg.Filter.IgnoreTxnStartTs,
 		ddlAllowlist:     cfg.Filter.DDLAllowlist,
 		isCyclicEnabled:  cfg.Cyclic.IsEnabled(),
+		includeSequences: cfg.DDLIncludeSequences,
+		includeViews:     cfg.DDLIncludeViews,
 	}, nil
 }
 
@@ -101,15 +131,18 @@ func (f *Filter) ShouldIgnoreDDLEvent(ts uint64, ddlType model.ActionType, schem
 
 // ShouldDiscardDDL returns true if this DDL should be discarded
 func (f *Filter) ShouldDiscardDDL(ddlType model.ActionType) bool {
-	if !f.shouldDiscardByBuiltInDDLAllowlist(ddlType) {
-		return false
-	}
 	for _, allowDDLType := range f.ddlAllowlist {
 		if allowDDLType == ddlType {
 			return false
 		}
 	}
-	return true
+	switch ClassifyDDL(ddlType) {
+	case DDLObjectView:
+		return !f.includeViews
+	case DDLObjectSequence:
+		return !f.includeSequences
+	}
+	return f.shouldDiscardByBuiltInDDLAllowlist(ddlType)
 }
 
 func (f *Filter) shouldDiscardByBuiltInDDLAllowlist(ddlType model.ActionType) bool {
@@ -123,9 +156,6 @@ func (f *Filter) shouldDiscardByBuiltInDDLAllowlist(ddlType model.ActionType) bo
 	ActionRepairTable                   ActionType = 29
 	ActionSetTiFlashReplica             ActionType = 30
 	ActionUpdateTiFlashReplicaStatus    ActionType = 31
-	ActionCreateSequence                ActionType = 34
-	ActionAlterSequence                 ActionType = 35
-	ActionDropSequence                  ActionType = 36
 	ActionModifyTableAutoIdCache        ActionType = 39
 	ActionRebaseAutoRandomBase          ActionType = 40
 	ActionAlterIndexVisibility          ActionType = 41
@@ -136,6 +166,8 @@ func (f *Filter) shouldDiscardByBuiltInDDLAllowlist(ddlType model.ActionType) bo
 	ActionAlterTableAlterPartition      ActionType = 46
 
 	... Any Action which of value is greater than 46 ...
+
+	The DDLs of the views and the sequences are discarded by the options.
 	*/
 	switch ddlType {
 	case model.ActionCreateSchema,
@@ -154,10 +186,8 @@ func (f *Filter) shouldDiscardByBuiltInDDLAllowlist(ddlType model.ActionType) bo
 		model.ActionRenameIndex,
 		model.ActionAddTablePartition,
 		model.ActionDropTablePartition,
-		model.ActionCreateView,
 		model.ActionModifyTableCharsetAndCollate,
 		model.ActionTruncateTablePartition,
-		model.ActionDropView,
 		model.ActionRecoverTable,
 		model.ActionModifySchemaCharsetAndCollate,
 		model.ActionAddPrimaryKey,
@@ -128,16 +128,50 @@ func (s *filterSuite) TestShouldIgnoreTxn(c *check.C) {
 
 func (s *filterSuite) TestShouldDiscardDDL(c *check.C) {
 	defer testleak.AfterTest(c)()
+	// the DDLs of the views are replicated by default
+	filter, err := NewFilter(config.GetDefaultReplicaConfig())
+	c.Assert(err, check.IsNil)
+	c.Assert(filter.ShouldDiscardDDL(model.ActionCreateView), check.IsFalse)
+	c.Assert(filter.ShouldDiscardDDL(model.ActionDropView), check.IsFalse)
+	c.Assert(filter.ShouldDiscardDDL(model.ActionCreateSequence), check.IsTrue)
+
 	config := &config.ReplicaConfig{
 		Filter: &config.FilterConfig{
 			DDLAllowlist: []model.ActionType{model.ActionAddForeignKey},
 		},
 	}
-	filter, err := NewFilter(config)
+	filter, err = NewFilter(config)
 	c.Assert(err, check.IsNil)
 	c.Assert(filter.ShouldDiscardDDL(model.ActionDropSchema), check.IsFalse)
 	c.Assert(filter.ShouldDiscardDDL(model.ActionAddForeignKey), check.IsFalse)
 	c.Assert(filter.ShouldDiscardDDL(model.ActionCreateSequence), check.IsTrue)
+	c.Assert(filter.ShouldDiscardDDL(model.ActionCreateView), check.IsTrue)
+	c.Assert(filter.ShouldDiscardDDL(model.ActionDropView), check.IsTrue)
+
+	// the DDLs of the sequences and the views are replicated by the options
+	config.DDLIncludeSequences = true
+	config.DDLIncludeViews = true
+	filter, err = NewFilter(config)
+	c.Assert(err, check.IsNil)
+	for _, tp := range []model.ActionType{
+		model.ActionCreateSequence, model.ActionAlterSequence, model.ActionDropSequence,
+		model.ActionCreateView, model.ActionDropView,
+	} {
+		c.Assert(filter.ShouldDiscardDDL(tp), check.IsFalse, check.Commentf("%s", tp))
+	}
+	c.Assert(filter.ShouldDiscardDDL(model.ActionLockTable), check.IsTrue)
+}
+
+func (s *filterSuite) TestClassifyDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(ClassifyDDL(model.ActionCreateSchema), check.Equals, DDLObjectSchema)
+	c.Assert(ClassifyDDL(model.ActionCreateTable), check.Equals, DDLObjectTable)
+	c.Assert(ClassifyDDL(model.ActionRenameTable), check.Equals, DDLObjectTable)
+	c.Assert(ClassifyDDL(model.ActionCreateView), check.Equals, DDLObjectView)
+	c.Assert(ClassifyDDL(model.ActionDropView), check.Equals, DDLObjectView)
+	c.Assert(ClassifyDDL(model.ActionCreateSequence), check.Equals, DDLObjectSequence)
+	c.Assert(ClassifyDDL(model.ActionAlterSequence), check.Equals, DDLObjectSequence)
+	c.Assert(ClassifyDDL(model.ActionDropSequence), check.Equals, DDLObjectSequence)
 }
 
 func (s *filterSuite) TestShouldIgnoreDDL(c *check.C) {
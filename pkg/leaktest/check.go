@@ -0,0 +1,51 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaktest
+
+import (
+	"time"
+)
+
+// TestingT is implemented by *testing.T and *check.C
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+const (
+	checkRetry    = 50
+	checkInterval = 50 * time.Millisecond
+)
+
+// Check asserts the default registry is empty, it's called after the
+// processors are stopped in the tests. The goroutines may be still exiting,
+// so they're checked for a while before they are reported as leaked.
+// Usage: defer leaktest.Check(c)
+func Check(t TestingT) {
+	checkRegistry(t, defaultRegistry)
+}
+
+func checkRegistry(t TestingT, r *Registry) {
+	var entries []Entry
+	for i := 0; i < checkRetry; i++ {
+		entries = r.Entries()
+		if len(entries) == 0 {
+			return
+		}
+		time.Sleep(checkInterval)
+	}
+	for _, entry := range entries {
+		t.Errorf("the %s goroutine of changefeed %s table %d started at %s appears to have leaked",
+			entry.Component, entry.ChangefeedID, entry.TableID, entry.Since)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaktest
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Owner is the changefeed, or the table of it if TableID isn't 0, which a
+// goroutine works for.
+type Owner struct {
+	ChangefeedID string `json:"changefeed"`
+	TableID      int64  `json:"table-id,omitempty"`
+}
+
+// Entry is a goroutine registered in the registry
+type Entry struct {
+	Component string `json:"component"`
+	Owner
+	Since time.Time `json:"since"`
+}
+
+// Summary is the summary of the goroutines registered in the registry
+type Summary struct {
+	// Goroutines is the number of all goroutines of the process
+	Goroutines int `json:"goroutines"`
+	// Components are the numbers of the registered goroutines by components
+	Components map[string]int `json:"components"`
+	// Orphans are the goroutines whose owners don't exist anymore, they are
+	// most likely leaked.
+	Orphans []Entry `json:"orphans"`
+}
+
+// Registry tracks the long-running goroutines of the components by their
+// owners. The components register the goroutines when they start and
+// deregister them when they stop, and the owners are added and removed with
+// the changefeeds and the tables, so that the goroutines outliving their
+// owners can be detected.
+type Registry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	entries map[uint64]*Entry
+	// owners are the changefeeds alive and their tables alive
+	owners map[string]map[int64]struct{}
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[uint64]*Entry),
+		owners:  make(map[string]map[int64]struct{}),
+	}
+}
+
+// Register registers a goroutine of the component working for the owner, the
+// returned function deregisters it, which must be called when the goroutine
+// exits.
+func (r *Registry) Register(component string, changefeedID string, tableID int64) (deregister func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	r.entries[id] = &Entry{
+		Component: component,
+		Owner:     Owner{ChangefeedID: changefeedID, TableID: tableID},
+		Since:     time.Now(),
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.entries, id)
+		})
+	}
+}
+
+// AddOwner adds the changefeed, or the table of it if tableID isn't 0, as an
+// alive owner.
+func (r *Registry) AddOwner(changefeedID string, tableID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables, ok := r.owners[changefeedID]
+	if !ok {
+		tables = make(map[int64]struct{})
+		r.owners[changefeedID] = tables
+	}
+	if tableID != 0 {
+		tables[tableID] = struct{}{}
+	}
+}
+
+// RemoveOwner removes the table of the changefeed, or the changefeed and all
+// its tables if tableID is 0.
+func (r *Registry) RemoveOwner(changefeedID string, tableID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tableID == 0 {
+		delete(r.owners, changefeedID)
+		return
+	}
+	if tables, ok := r.owners[changefeedID]; ok {
+		delete(tables, tableID)
+	}
+}
+
+func (r *Registry) isOwnerAlive(owner Owner) bool {
+	tables, ok := r.owners[owner.ChangefeedID]
+	if !ok {
+		return false
+	}
+	if owner.TableID == 0 {
+		return true
+	}
+	_, ok = tables[owner.TableID]
+	return ok
+}
+
+// Entries returns the goroutines registered, in the order they're registered
+func (r *Registry) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sortedEntries(func(*Entry) bool { return true })
+}
+
+func (r *Registry) sortedEntries(filter func(*Entry) bool) []Entry {
+	ids := make([]uint64, 0, len(r.entries))
+	for id, entry := range r.entries {
+		if filter(entry) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	entries := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, *r.entries[id])
+	}
+	return entries
+}
+
+// Summarize counts the goroutines registered by the components, and flags
+// the ones whose owners don't exist anymore.
+func (r *Registry) Summarize() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := Summary{
+		Goroutines: runtime.NumGoroutine(),
+		Components: make(map[string]int),
+	}
+	for _, entry := range r.entries {
+		s.Components[entry.Component]++
+	}
+	s.Orphans = r.sortedEntries(func(entry *Entry) bool {
+		return !r.isOwnerAlive(entry.Owner)
+	})
+	return s
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register registers a goroutine in the default registry, see Registry.Register
+func Register(component string, changefeedID string, tableID int64) (deregister func()) {
+	return defaultRegistry.Register(component, changefeedID, tableID)
+}
+
+// AddOwner adds an alive owner in the default registry
+func AddOwner(changefeedID string, tableID int64) {
+	defaultRegistry.AddOwner(changefeedID, tableID)
+}
+
+// RemoveOwner removes an owner from the default registry
+func RemoveOwner(changefeedID string, tableID int64) {
+	defaultRegistry.RemoveOwner(changefeedID, tableID)
+}
+
+// Summarize summarizes the default registry
+func Summarize() Summary {
+	return defaultRegistry.Summarize()
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaktest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type registrySuite struct{}
+
+var _ = check.Suite(&registrySuite{})
+
+type errorRecorder struct {
+	errs []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (s *registrySuite) TestRegistry(c *check.C) {
+	defer testleak.AfterTest(c)()
+	r := NewRegistry()
+	r.AddOwner("cf-1", 0)
+	r.AddOwner("cf-1", 10)
+	r.AddOwner("cf-1", 11)
+	deregisterMounter := r.Register("mounter", "cf-1", 0)
+	deregisterPuller := r.Register("puller", "cf-1", 10)
+	r.Register("puller", "cf-1", 11)
+	// the goroutine of the unknown changefeed is an orphan
+	r.Register("sorter", "cf-2", 20)
+
+	summary := r.Summarize()
+	c.Assert(summary.Goroutines, check.Greater, 0)
+	c.Assert(summary.Components, check.DeepEquals, map[string]int{"mounter": 1, "puller": 2, "sorter": 1})
+	c.Assert(summary.Orphans, check.HasLen, 1)
+	c.Assert(summary.Orphans[0].Owner, check.Equals, Owner{ChangefeedID: "cf-2", TableID: 20})
+
+	// the goroutines of the removed table are orphans
+	r.RemoveOwner("cf-1", 11)
+	summary = r.Summarize()
+	c.Assert(summary.Orphans, check.HasLen, 2)
+	c.Assert(summary.Orphans[0].Owner, check.Equals, Owner{ChangefeedID: "cf-1", TableID: 11})
+
+	// the removed changefeed removes its tables
+	r.RemoveOwner("cf-1", 0)
+	c.Assert(r.Summarize().Orphans, check.HasLen, 4)
+
+	// deregistering twice is harmless
+	deregisterPuller()
+	deregisterPuller()
+	deregisterMounter()
+	entries := r.Entries()
+	c.Assert(entries, check.HasLen, 2)
+	c.Assert(entries[0].Component, check.Equals, "puller")
+	c.Assert(entries[1].Component, check.Equals, "sorter")
+}
+
+func (s *registrySuite) TestCheck(c *check.C) {
+	defer testleak.AfterTest(c)()
+	r := NewRegistry()
+	deregister := r.Register("sorter", "cf-1", 10)
+	go deregister()
+	// the goroutine exiting is not reported
+	checkRegistry(c, r)
+
+	r.Register("sorter", "cf-1", 10)
+	recorder := new(errorRecorder)
+	checkRegistry(recorder, r)
+	c.Assert(recorder.errs, check.HasLen, 1)
+	c.Assert(recorder.errs[0], check.Matches, "the sorter goroutine of changefeed cf-1 table 10 .* appears to have leaked")
+}
@@ -37,6 +37,7 @@ func (n *Notifier) Notify() {
 	defer n.mu.RUnlock()
 	for _, receiver := range n.receivers {
 		receiver.rec.signalNonBlocking()
+		receiver.rec.Wake()
 	}
 }
 
@@ -47,6 +48,22 @@ type Receiver struct {
 	Stop    func()
 	ticker  *time.Ticker
 	closeCh chan struct{}
+	// activeCh resets the tick interval of an adaptive receiver, it's nil
+	// if the receiver ticks at a fixed interval.
+	activeCh chan struct{}
+}
+
+// Wake resets the tick interval of an adaptive receiver to the minimum one
+// without sending a signal, it's called by the consumer which has pending
+// work to poll, e.g. the flushing rows. It's no-op for the other receivers.
+func (r *Receiver) Wake() {
+	if r.activeCh == nil {
+		return
+	}
+	select {
+	case r.activeCh <- struct{}{}:
+	default:
+	}
 }
 
 // returns true if the receiverCh should be closed
@@ -78,6 +95,42 @@ func (r *Receiver) signalTickLoop() {
 	}()
 }
 
+// signalAdaptiveTickLoop sends a signal once the tick interval elapses, the
+// interval is doubled after each tick up to maxTick, and is reset to minTick
+// once the receiver is woken up, so that an idle receiver ticks rarely.
+func (r *Receiver) signalAdaptiveTickLoop(minTick, maxTick time.Duration) {
+	go func() {
+		defer close(r.c)
+		interval := minTick
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-r.closeCh:
+				return
+			case <-r.activeCh:
+				if interval == minTick {
+					continue
+				}
+				interval = minTick
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(interval)
+				continue
+			case <-timer.C:
+			}
+			if r.signalNonBlocking() {
+				return
+			}
+			if interval *= 2; interval > maxTick {
+				interval = maxTick
+			}
+			timer.Reset(interval)
+		}
+	}()
+}
+
 // NewReceiver creates a receiver
 // returns a channel to receive notifications and a function to close this receiver
 func (n *Notifier) NewReceiver(tickTime time.Duration) (*Receiver, error) {
@@ -113,6 +166,38 @@ func (n *Notifier) NewReceiver(tickTime time.Duration) (*Receiver, error) {
 	return rec, nil
 }
 
+// NewAdaptiveReceiver creates a receiver which ticks at minTick at first, the
+// tick interval is backed off to maxTick if there is no notification, and is
+// reset to minTick once the notifier notifies or the receiver is woken up.
+func (n *Notifier) NewAdaptiveReceiver(minTick, maxTick time.Duration) (*Receiver, error) {
+	if minTick <= 0 || maxTick <= minTick {
+		return n.NewReceiver(minTick)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, errors.ErrOperateOnClosedNotifier.GenWithStackByArgs()
+	}
+	currentIndex := n.maxIndex
+	n.maxIndex++
+	receiverCh := make(chan struct{}, 1)
+	rec := &Receiver{
+		C: receiverCh,
+		c: receiverCh,
+		Stop: func() {
+			n.remove(currentIndex)
+		},
+		closeCh:  make(chan struct{}),
+		activeCh: make(chan struct{}, 1),
+	}
+	rec.signalAdaptiveTickLoop(minTick, maxTick)
+	n.receivers = append(n.receivers, struct {
+		rec   *Receiver
+		index int
+	}{rec: rec, index: currentIndex})
+	return rec, nil
+}
+
 func (n *Notifier) remove(index int) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
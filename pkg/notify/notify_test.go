@@ -15,6 +15,8 @@ package notify
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -116,3 +118,134 @@ func (s *notifySuite) TestNewReceiverWithClosedNotifier(c *check.C) {
 	_, err := notifier.NewReceiver(50 * time.Millisecond)
 	c.Assert(errors.ErrOperateOnClosedNotifier.Equal(err), check.IsTrue)
 }
+
+func (s *notifySuite) TestAdaptiveReceiver(c *check.C) {
+	defer testleak.AfterTest(c)()
+	notifier := new(Notifier)
+	defer notifier.Close()
+	r, err := notifier.NewAdaptiveReceiver(10*time.Millisecond, time.Second)
+	c.Assert(err, check.IsNil)
+
+	// the receiver backs off if there is no notification, it ticks at 10ms,
+	// 20ms, 40ms, ... instead of 10ms.
+	ticks := 0
+	timeout := time.After(time.Second)
+loop:
+	for {
+		select {
+		case <-r.C:
+			ticks++
+		case <-timeout:
+			break loop
+		}
+	}
+	c.Assert(ticks, check.Less, 10)
+
+	// the receiver is backed off to 1s, and the notification is received
+	// within 200ms when the traffic resumes.
+	start := time.Now()
+	notifier.Notify()
+	<-r.C
+	c.Assert(time.Since(start), check.Less, 200*time.Millisecond)
+	// the receiver ticks at 10ms after the notification
+	start = time.Now()
+	<-r.C
+	c.Assert(time.Since(start), check.Less, 200*time.Millisecond)
+
+	// the receiver is woken up without a signal
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case <-r.C:
+	default:
+	}
+	r.Wake()
+	start = time.Now()
+	<-r.C
+	c.Assert(time.Since(start), check.Less, 200*time.Millisecond)
+	r.Stop()
+	_, ok := <-r.C
+	c.Assert(ok, check.IsFalse)
+}
+
+// countIdleWakeups counts the signals received by the receivers of the idle
+// feeds in d, each feed is notified every notifyInterval, e.g. its resolved
+// ts is advanced without any row.
+func countIdleWakeups(
+	feeds int, d, notifyInterval time.Duration, newReceiver func(n *Notifier) (*Receiver, error),
+) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	notifier := new(Notifier)
+	defer notifier.Close()
+	var wg sync.WaitGroup
+	var wakeups int64
+	for i := 0; i < feeds; i++ {
+		r, err := newReceiver(notifier)
+		if err != nil {
+			return 0, err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-r.C:
+					atomic.AddInt64(&wakeups, 1)
+				}
+			}
+		}()
+	}
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return atomic.LoadInt64(&wakeups), nil
+		case <-ticker.C:
+			notifier.Notify()
+		}
+	}
+}
+
+func (s *notifySuite) TestIdleWakeups(c *check.C) {
+	defer testleak.AfterTest(c)()
+	// the intervals are scaled down by 10 from the ones of the processor,
+	// which ticks at 50ms and is notified every 1s if it's idle.
+	fixed, err := countIdleWakeups(30, time.Second, 100*time.Millisecond, func(n *Notifier) (*Receiver, error) {
+		return n.NewReceiver(5 * time.Millisecond)
+	})
+	c.Assert(err, check.IsNil)
+	adaptive, err := countIdleWakeups(30, time.Second, 100*time.Millisecond, func(n *Notifier) (*Receiver, error) {
+		return n.NewAdaptiveReceiver(5*time.Millisecond, 100*time.Millisecond)
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(float64(adaptive), check.Less, float64(fixed)*0.3, check.Commentf("fixed %d, adaptive %d", fixed, adaptive))
+}
+
+func benchmarkIdleReceivers(b *testing.B, newReceiver func(n *Notifier) (*Receiver, error)) {
+	var wakeups int64
+	for i := 0; i < b.N; i++ {
+		n, err := countIdleWakeups(30, 500*time.Millisecond, 100*time.Millisecond, newReceiver)
+		if err != nil {
+			b.Fatal(err)
+		}
+		wakeups += n
+	}
+	b.ReportMetric(float64(wakeups)/float64(b.N)/30/0.5, "wakeups/feed/s")
+}
+
+func BenchmarkIdleFixedReceivers(b *testing.B) {
+	benchmarkIdleReceivers(b, func(n *Notifier) (*Receiver, error) {
+		return n.NewReceiver(5 * time.Millisecond)
+	})
+}
+
+func BenchmarkIdleAdaptiveReceivers(b *testing.B) {
+	benchmarkIdleReceivers(b, func(n *Notifier) (*Receiver, error) {
+		return n.NewAdaptiveReceiver(5*time.Millisecond, 100*time.Millisecond)
+	})
+}
@@ -94,6 +94,15 @@ func GetTableSpan(tableID int64, exceptIndexSpan bool) Span {
 	}
 }
 
+// GetTableIndexSpan returns the span of the index kvs of the specified index
+func GetTableIndexSpan(tableID int64, indexID int64) Span {
+	start := tablecodec.EncodeTableIndexPrefix(tableID, indexID)
+	return Span{
+		Start: start,
+		End:   start.PrefixNext(),
+	}
+}
+
 // GetDDLSpan returns the span to watch for DDL related events
 func GetDDLSpan() Span {
 	return getMetaListKey("DDLJobList")
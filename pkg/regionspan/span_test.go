@@ -18,6 +18,7 @@ import (
 
 	"github.com/pingcap/check"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/tablecodec"
 )
 
@@ -120,6 +121,18 @@ func (s *spanSuite) TestGetTableSpan(c *check.C) {
 	c.Assert(span.End, check.LessEqual, prefix)
 }
 
+func (s *spanSuite) TestGetTableIndexSpan(c *check.C) {
+	defer testleak.AfterTest(c)()
+	span := ToComparableSpan(GetTableIndexSpan(123, 2))
+	key := tablecodec.EncodeIndexSeekKey(123, 2, []byte{1, 2, 3})
+	c.Assert(KeyInSpan(ToComparableKey(key), span), check.IsTrue)
+	key = tablecodec.EncodeIndexSeekKey(123, 3, []byte{1, 2, 3})
+	c.Assert(KeyInSpan(ToComparableKey(key), span), check.IsFalse)
+	key = tablecodec.EncodeRowKeyWithHandle(123, kv.IntHandle(1))
+	c.Assert(KeyInSpan(ToComparableKey(key), span), check.IsFalse)
+	c.Assert(IsSubSpan(span, ToComparableSpan(GetTableSpan(123, false))), check.IsTrue)
+}
+
 func (s *spanSuite) TestSpanHack(c *check.C) {
 	defer testleak.AfterTest(c)()
 	testCases := []struct {
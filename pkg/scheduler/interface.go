@@ -34,6 +34,24 @@ type Scheduler interface {
 	// DistributeTables distributes the new tables to the captures
 	// returns the operations of the new tables
 	DistributeTables(tableIDs map[model.TableID]model.Ts) map[model.CaptureID]map[model.TableID]*model.TableOperation
+	// ResetTableGroups resets the groups of the tables, which are respected by
+	// DistributeTables and CalRebalanceOperates
+	ResetTableGroups(groups map[model.TableID]TableGroup)
+	// ResetLocality resets the zones of the captures and the region leaders
+	// of the tables, which are respected by DistributeTables and
+	// CalRebalanceOperates for the tables not in any group
+	ResetLocality(locality *Locality)
+}
+
+// TableGroup is the group of a table, the partitions of a partitioned table
+// are in the group of the logical table. The tables which are not in any
+// group are scheduled by their workloads only.
+type TableGroup struct {
+	// ID is the ID of the logical table
+	ID model.TableID
+	// CoLocate places all tables in the group in the same capture, otherwise
+	// they are spread across the captures evenly
+	CoLocate bool
 }
 
 // NewScheduler creates a new Scheduler
@@ -0,0 +1,154 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"math"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// Locality describes the zones of the captures and of the region leaders of
+// the tables, the tables are preferred to be placed in the captures in the
+// same zones as their leaders, so that the regions are pulled without the
+// cross-zone traffic.
+type Locality struct {
+	// Weight is how strongly the locality is preferred to the balance, in
+	// [0, 1]. A capture may hold up to Weight times the average number of
+	// tables more than the average to take its local tables, zero disables
+	// the locality.
+	Weight float64
+	// CaptureZones are the zones of the captures, the captures without a
+	// zone are never local
+	CaptureZones map[model.CaptureID]string
+	// TableLeaders are the numbers of the sampled region leaders of each
+	// table in each zone, the tables without the leaders are placed by the
+	// balance only
+	TableLeaders map[model.TableID]map[string]int
+}
+
+// Enabled returns whether the locality makes a difference, which needs the
+// captures in more than one zone.
+func (l *Locality) Enabled() bool {
+	if l == nil || l.Weight <= 0 {
+		return false
+	}
+	var zone string
+	for _, z := range l.CaptureZones {
+		if z == "" {
+			continue
+		}
+		if zone != "" && z != zone {
+			return true
+		}
+		zone = z
+	}
+	return false
+}
+
+// localFraction returns the fraction of the leaders of the table in the zone
+// of the capture
+func (l *Locality) localFraction(tableID model.TableID, captureID model.CaptureID) float64 {
+	zone := l.CaptureZones[captureID]
+	leaders := l.TableLeaders[tableID]
+	if zone == "" || len(leaders) == 0 {
+		return 0
+	}
+	var total int
+	for _, n := range leaders {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(leaders[zone]) / float64(total)
+}
+
+// slack returns the number of tables a capture may hold more than the
+// average to take its local tables, when there are pending tables more to be
+// placed
+func (l *Locality) slack(w workloads, pending int) uint64 {
+	return uint64(math.Ceil(l.Weight * avgWorkload(w, pending)))
+}
+
+// limit returns the most tables a capture may hold to take its local tables,
+// when there are pending tables more to be placed
+func (l *Locality) limit(w workloads, pending int) uint64 {
+	return uint64(math.Ceil(avgWorkload(w, pending))) + l.slack(w, pending)
+}
+
+// avgWorkload returns the average workload of the captures, when there are
+// pending tables more to be placed
+func avgWorkload(w workloads, pending int) float64 {
+	if len(w) == 0 {
+		return 0
+	}
+	total := uint64(pending)
+	for captureID := range w {
+		total += w.CaptureWorkload(captureID)
+	}
+	return float64(total) / float64(len(w))
+}
+
+// selectLocalCapture selects the capture with the most leaders of the table
+// in its zone, among the idlest captures and the ones not exceeding the limit
+// with the table, the ties are broken by the workloads.
+func (t *TableNumberScheduler) selectLocalCapture(tableID model.TableID, limit uint64) model.CaptureID {
+	minWorkload := uint64(math.MaxUint64)
+	for captureID := range t.workloads {
+		if workload := t.workloads.CaptureWorkload(captureID); workload < minWorkload {
+			minWorkload = workload
+		}
+	}
+	var (
+		target         model.CaptureID
+		targetFraction float64
+		targetWorkload uint64
+	)
+	for captureID := range t.workloads {
+		workload := t.workloads.CaptureWorkload(captureID)
+		if workload > minWorkload && workload+1 > limit {
+			continue
+		}
+		fraction := t.locality.localFraction(tableID, captureID)
+		if target == "" || fraction > targetFraction ||
+			(fraction == targetFraction && workload < targetWorkload) ||
+			(fraction == targetFraction && workload == targetWorkload && captureID < target) {
+			target, targetFraction, targetWorkload = captureID, fraction, workload
+		}
+	}
+	return target
+}
+
+// nonLocalTables returns the tables not in any group whose captures have fewer
+// of their leaders in the zones than another capture, they're moved to the
+// local captures by the rebalance if the workloads allow.
+func (t *TableNumberScheduler) nonLocalTables() map[model.TableID]model.CaptureID {
+	tables := make(map[model.TableID]model.CaptureID)
+	for captureID, captureWorkloads := range t.workloads {
+		for tableID := range captureWorkloads {
+			if _, ok := t.groups[tableID]; ok {
+				continue
+			}
+			fraction := t.locality.localFraction(tableID, captureID)
+			for other := range t.workloads {
+				if t.locality.localFraction(tableID, other) > fraction {
+					tables[tableID] = captureID
+					break
+				}
+			}
+		}
+	}
+	return tables
+}
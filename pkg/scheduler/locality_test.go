@@ -0,0 +1,158 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type localitySuite struct{}
+
+var _ = check.Suite(&localitySuite{})
+
+// newLocalityScheduler creates a scheduler of the captures in the zones, the
+// leaders of each table are in the zone of the leaders map, with one leader in
+// each of the other zones
+func newLocalityScheduler(weight float64, captureZones map[model.CaptureID]string, leaders map[model.TableID]string) *TableNumberScheduler {
+	t := newTableNumberScheduler()
+	captureIDs := make(map[model.CaptureID]struct{}, len(captureZones))
+	for captureID := range captureZones {
+		captureIDs[captureID] = struct{}{}
+	}
+	t.AlignCapture(captureIDs)
+	t.ResetLocality(&Locality{
+		Weight:       weight,
+		CaptureZones: captureZones,
+		TableLeaders: syntheticLeaders(captureZones, leaders),
+	})
+	return t
+}
+
+func syntheticLeaders(captureZones map[model.CaptureID]string, leaders map[model.TableID]string) map[model.TableID]map[string]int {
+	tableLeaders := make(map[model.TableID]map[string]int, len(leaders))
+	for tableID, zone := range leaders {
+		zones := map[string]int{zone: 8}
+		for _, z := range captureZones {
+			if z != zone {
+				zones[z] = 1
+			}
+		}
+		tableLeaders[tableID] = zones
+	}
+	return tableLeaders
+}
+
+func tablesToAdd(n int) map[model.TableID]model.Ts {
+	tables := make(map[model.TableID]model.Ts, n)
+	for i := 1; i <= n; i++ {
+		tables[model.TableID(i)] = 0
+	}
+	return tables
+}
+
+// placement returns the capture of each table by the operations
+func placement(operations map[model.CaptureID]map[model.TableID]*model.TableOperation) map[model.TableID]model.CaptureID {
+	tables := make(map[model.TableID]model.CaptureID)
+	for captureID, ops := range operations {
+		for tableID := range ops {
+			tables[tableID] = captureID
+		}
+	}
+	return tables
+}
+
+func (s *localitySuite) TestPreferLocalCaptures(c *check.C) {
+	defer testleak.AfterTest(c)()
+	zones := map[model.CaptureID]string{"capture-a": "a", "capture-b": "b", "capture-c": "c"}
+	leaders := map[model.TableID]string{1: "a", 2: "b", 3: "c", 4: "c", 5: "b", 6: "a", 7: "a", 8: "c", 9: "b"}
+	t := newLocalityScheduler(0.5, zones, leaders)
+	tables := placement(t.DistributeTables(tablesToAdd(9)))
+	c.Assert(tables, check.HasLen, 9)
+	for tableID, captureID := range tables {
+		c.Assert(zones[captureID], check.Equals, leaders[tableID], check.Commentf("table %d", tableID))
+	}
+	c.Assert(t.Skewness(), check.Equals, float64(0))
+
+	// the balance bounds the locality when all the leaders are in one zone
+	for tableID := range leaders {
+		leaders[tableID] = "a"
+	}
+	t = newLocalityScheduler(0.5, zones, leaders)
+	t.DistributeTables(tablesToAdd(9))
+	c.Assert(len(t.workloads["capture-a"]), check.Greater, 3)
+	// at most ceil(0.5 * 3) tables more than the average
+	c.Assert(t.workloads["capture-a"], check.HasLen, 5)
+	c.Assert(t.workloads["capture-b"], check.HasLen, 2)
+	c.Assert(t.workloads["capture-c"], check.HasLen, 2)
+	// the rebalance keeps the local tables within the slack
+	_, moveJobs := t.CalRebalanceOperates(0)
+	c.Assert(moveJobs, check.HasLen, 0)
+
+	// the locality is ignored if it's weighted zero
+	t = newLocalityScheduler(0, zones, leaders)
+	t.DistributeTables(tablesToAdd(9))
+	for captureID := range zones {
+		c.Assert(t.workloads[captureID], check.HasLen, 3)
+	}
+}
+
+func (s *localitySuite) TestSingleZone(c *check.C) {
+	defer testleak.AfterTest(c)()
+	zones := map[model.CaptureID]string{"capture-1": "a", "capture-2": "a", "capture-3": "a"}
+	leaders := map[model.TableID]string{1: "a", 2: "a", 3: "a", 4: "a", 5: "a", 6: "a"}
+	// the captures in one zone, or without zones, are scheduled as if there
+	// were no locality
+	for _, z := range []string{"a", ""} {
+		for captureID := range zones {
+			zones[captureID] = z
+		}
+		t := newLocalityScheduler(1, zones, leaders)
+		c.Assert(t.locality.Enabled(), check.IsFalse)
+		t.DistributeTables(tablesToAdd(6))
+		for captureID := range zones {
+			c.Assert(t.workloads[captureID], check.HasLen, 2)
+		}
+	}
+	c.Assert((*Locality)(nil).Enabled(), check.IsFalse)
+}
+
+func (s *localitySuite) TestRebalanceAfterLeaderMigration(c *check.C) {
+	defer testleak.AfterTest(c)()
+	zones := map[model.CaptureID]string{"capture-a1": "a", "capture-a2": "a", "capture-b1": "b", "capture-b2": "b"}
+	leaders := map[model.TableID]string{1: "a", 2: "a", 3: "a", 4: "a", 5: "b", 6: "b", 7: "b", 8: "b"}
+	t := newLocalityScheduler(0.5, zones, leaders)
+	tables := placement(t.DistributeTables(tablesToAdd(8)))
+	for tableID, captureID := range tables {
+		c.Assert(zones[captureID], check.Equals, leaders[tableID])
+	}
+	skewness, moveJobs := t.CalRebalanceOperates(0)
+	c.Assert(moveJobs, check.HasLen, 0)
+	c.Assert(skewness, check.Equals, float64(0))
+
+	// the leaders of two tables are transferred to the zone b
+	leaders[1], leaders[2] = "b", "b"
+	t.ResetLocality(&Locality{Weight: 0.5, CaptureZones: zones, TableLeaders: syntheticLeaders(zones, leaders)})
+	_, moveJobs = t.CalRebalanceOperates(0)
+	c.Assert(moveJobs, check.HasLen, 2)
+	for tableID, job := range moveJobs {
+		c.Assert(tableID == 1 || tableID == 2, check.IsTrue)
+		c.Assert(job.From, check.Equals, tables[tableID])
+		c.Assert(zones[job.To], check.Equals, "b")
+	}
+	for captureID := range zones {
+		c.Assert(len(t.workloads[captureID]), check.Greater, 0)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
+
+// RebalanceInput is the state of the changefeed the rebalance plan is
+// computed from
+type RebalanceInput struct {
+	// Tp is the type of the scheduler
+	Tp string
+	// Workloads are the workloads of the tables in each capture, the captures
+	// without any table must be present with empty workloads
+	Workloads map[model.CaptureID]model.TaskWorkload
+	Groups    map[model.TableID]TableGroup
+	Locality  *Locality
+}
+
+// TableMove is a table moved from a capture to another capture by the
+// rebalance
+type TableMove struct {
+	TableID model.TableID   `json:"table-id"`
+	From    model.CaptureID `json:"from"`
+	To      model.CaptureID `json:"to"`
+	// Workload is the estimated workload of the table shifted by the move
+	Workload uint64 `json:"workload"`
+}
+
+// RebalancePlan is the result of the rebalance computed from the input, it's
+// applied by moving the tables with MoveTableJobs.
+type RebalancePlan struct {
+	// Moves are the tables to move, sorted by the table IDs
+	Moves []TableMove
+	// SkewnessBefore and SkewnessAfter are the imbalance of the workloads of
+	// the captures before and after the moves
+	SkewnessBefore float64
+	SkewnessAfter  float64
+	// Workloads are the projected workloads of the captures after the moves
+	Workloads map[model.CaptureID]model.TaskWorkload
+}
+
+// CalRebalancePlan computes the rebalance plan of the input, the input is not
+// modified. The same input always results in the same plan.
+func CalRebalancePlan(input RebalanceInput) *RebalancePlan {
+	s := NewScheduler(input.Tp)
+	captureIDs := make(map[model.CaptureID]struct{}, len(input.Workloads))
+	for captureID := range input.Workloads {
+		captureIDs[captureID] = struct{}{}
+	}
+	w := workloads(input.Workloads).Clone()
+	for captureID, captureWorkloads := range w {
+		s.ResetWorkloads(captureID, captureWorkloads)
+	}
+	s.AlignCapture(captureIDs)
+	s.ResetTableGroups(input.Groups)
+	s.ResetLocality(input.Locality)
+
+	plan := &RebalancePlan{
+		Moves:          make([]TableMove, 0),
+		SkewnessBefore: sanitizeSkewness(s.Skewness()),
+	}
+	skewness, moveTableJobs := s.CalRebalanceOperates(0)
+	plan.SkewnessAfter = sanitizeSkewness(skewness)
+	for tableID, job := range moveTableJobs {
+		plan.Moves = append(plan.Moves, TableMove{
+			TableID:  tableID,
+			From:     job.From,
+			To:       job.To,
+			Workload: input.Workloads[job.From][tableID].Workload,
+		})
+	}
+	sort.Slice(plan.Moves, func(i, j int) bool { return plan.Moves[i].TableID < plan.Moves[j].TableID })
+	plan.Workloads = w
+	return plan
+}
+
+// MoveTableJobs returns the jobs moving the tables of the plan
+func (p *RebalancePlan) MoveTableJobs() map[model.TableID]*model.MoveTableJob {
+	jobs := make(map[model.TableID]*model.MoveTableJob, len(p.Moves))
+	for _, move := range p.Moves {
+		jobs[move.TableID] = &model.MoveTableJob{
+			From:    move.From,
+			To:      move.To,
+			TableID: move.TableID,
+		}
+	}
+	return jobs
+}
+
+// sanitizeSkewness returns 0 for the skewness of no workload, which is NaN
+func sanitizeSkewness(skewness float64) float64 {
+	if math.IsNaN(skewness) {
+		return 0
+	}
+	return skewness
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type planSuite struct{}
+
+var _ = check.Suite(&planSuite{})
+
+func newPlanTestInput() RebalanceInput {
+	return RebalanceInput{
+		Tp: "table-number",
+		Workloads: map[model.CaptureID]model.TaskWorkload{
+			"capture1": {
+				1: model.WorkloadInfo{Workload: 1},
+				2: model.WorkloadInfo{Workload: 1},
+				3: model.WorkloadInfo{Workload: 1},
+				4: model.WorkloadInfo{Workload: 1},
+				5: model.WorkloadInfo{Workload: 1},
+				6: model.WorkloadInfo{Workload: 1},
+			},
+			"capture2": {
+				7: model.WorkloadInfo{Workload: 1},
+				8: model.WorkloadInfo{Workload: 1},
+			},
+			"capture3": {},
+			"capture4": {},
+		},
+		Groups: map[model.TableID]TableGroup{
+			5: {ID: 100},
+			6: {ID: 100},
+			8: {ID: 101, CoLocate: true},
+		},
+	}
+}
+
+func (s *planSuite) TestCalRebalancePlan(c *check.C) {
+	defer testleak.AfterTest(c)()
+	input := newPlanTestInput()
+	plan := CalRebalancePlan(input)
+	c.Assert(input, check.DeepEquals, newPlanTestInput())
+	c.Assert(plan.SkewnessAfter < plan.SkewnessBefore, check.IsTrue)
+	c.Assert(len(plan.Moves), check.Greater, 0)
+	for i, move := range plan.Moves {
+		if i > 0 {
+			c.Assert(plan.Moves[i-1].TableID < move.TableID, check.IsTrue)
+		}
+		c.Assert(move.From, check.Not(check.Equals), move.To)
+		c.Assert(move.Workload, check.Equals, uint64(1))
+		c.Assert(move.TableID, check.Not(check.Equals), model.TableID(8))
+	}
+
+	// the projected workloads are the input ones with the tables moved
+	projected := workloads(input.Workloads).Clone()
+	for _, move := range plan.Moves {
+		projected.RemoveTable(move.From, move.TableID)
+		projected.SetTable(move.To, move.TableID, model.WorkloadInfo{Workload: 1})
+	}
+	c.Assert(plan.Workloads, check.DeepEquals, map[model.CaptureID]model.TaskWorkload(projected))
+
+	// the same input always results in the same plan
+	for i := 0; i < 20; i++ {
+		c.Assert(CalRebalancePlan(newPlanTestInput()), check.DeepEquals, plan)
+	}
+}
+
+func (s *planSuite) TestRebalancePlanApplied(c *check.C) {
+	defer testleak.AfterTest(c)()
+	input := newPlanTestInput()
+	plan := CalRebalancePlan(input)
+
+	// the plan is the same as the rebalance of the scheduler with the input
+	scheduler := NewScheduler(input.Tp)
+	for captureID, captureWorkloads := range workloads(input.Workloads).Clone() {
+		scheduler.ResetWorkloads(captureID, captureWorkloads)
+	}
+	scheduler.ResetTableGroups(input.Groups)
+	skewness, moveTableJobs := scheduler.CalRebalanceOperates(0)
+	c.Assert(skewness, check.Equals, plan.SkewnessAfter)
+	c.Assert(moveTableJobs, check.DeepEquals, plan.MoveTableJobs())
+}
+
+func (s *planSuite) TestCalRebalancePlanWithoutWorkload(c *check.C) {
+	defer testleak.AfterTest(c)()
+	plan := CalRebalancePlan(RebalanceInput{
+		Tp:        "table-number",
+		Workloads: map[model.CaptureID]model.TaskWorkload{"capture1": {}, "capture2": {}},
+	})
+	c.Assert(plan.Moves, check.HasLen, 0)
+	c.Assert(plan.SkewnessBefore, check.Equals, float64(0))
+	c.Assert(plan.SkewnessAfter, check.Equals, float64(0))
+}
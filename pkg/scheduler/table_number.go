@@ -13,11 +13,17 @@
 
 package scheduler
 
-import "github.com/pingcap/ticdc/cdc/model"
+import (
+	"sort"
+
+	"github.com/pingcap/ticdc/cdc/model"
+)
 
 // TableNumberScheduler provides a feature that scheduling by the table number
 type TableNumberScheduler struct {
 	workloads workloads
+	groups    map[model.TableID]TableGroup
+	locality  *Locality
 }
 
 // newTableNumberScheduler creates a new table number scheduler
@@ -37,6 +43,16 @@ func (t *TableNumberScheduler) AlignCapture(captureIDs map[model.CaptureID]struc
 	t.workloads.AlignCapture(captureIDs)
 }
 
+// ResetTableGroups implements the Scheduler interface
+func (t *TableNumberScheduler) ResetTableGroups(groups map[model.TableID]TableGroup) {
+	t.groups = groups
+}
+
+// ResetLocality implements the Scheduler interface
+func (t *TableNumberScheduler) ResetLocality(locality *Locality) {
+	t.locality = locality
+}
+
 // Skewness implements the Scheduler interface
 func (t *TableNumberScheduler) Skewness() float64 {
 	return t.workloads.Skewness()
@@ -50,21 +66,38 @@ func (t *TableNumberScheduler) CalRebalanceOperates(targetSkewness float64) (
 		totalTableNumber += uint64(len(captureWorkloads))
 	}
 	limitTableNumber := (float64(totalTableNumber) / float64(len(t.workloads))) + 1
+	localityEnabled := t.locality.Enabled()
+	if localityEnabled {
+		// the local tables are allowed to make the captures busier by the slack
+		limitTableNumber += float64(t.locality.slack(t.workloads, 0))
+	}
 	appendTables := make(map[model.TableID]model.Ts)
 	moveTableJobs = make(map[model.TableID]*model.MoveTableJob)
 
 	for captureID, captureWorkloads := range t.workloads {
 		for float64(len(captureWorkloads)) >= limitTableNumber {
-			for tableID := range captureWorkloads {
-				// find a table in this capture
-				appendTables[tableID] = 0
-				moveTableJobs[tableID] = &model.MoveTableJob{
-					From:    captureID,
-					TableID: tableID,
-				}
-				t.workloads.RemoveTable(captureID, tableID)
+			tableID, ok := t.selectTableToMove(captureID)
+			if !ok {
+				// the remaining tables are co-located with their groups
 				break
 			}
+			appendTables[tableID] = 0
+			moveTableJobs[tableID] = &model.MoveTableJob{
+				From:    captureID,
+				TableID: tableID,
+			}
+			t.workloads.RemoveTable(captureID, tableID)
+		}
+	}
+	if localityEnabled {
+		// the leaders may be moved to other zones since the tables are placed
+		for tableID, captureID := range t.nonLocalTables() {
+			appendTables[tableID] = 0
+			moveTableJobs[tableID] = &model.MoveTableJob{
+				From:    captureID,
+				TableID: tableID,
+			}
+			t.workloads.RemoveTable(captureID, tableID)
 		}
 	}
 	addOperations := t.DistributeTables(appendTables)
@@ -84,8 +117,13 @@ func (t *TableNumberScheduler) CalRebalanceOperates(targetSkewness float64) (
 // DistributeTables implements the Scheduler interface
 func (t *TableNumberScheduler) DistributeTables(tableIDs map[model.TableID]model.Ts) map[model.CaptureID]map[model.TableID]*model.TableOperation {
 	result := make(map[model.CaptureID]map[model.TableID]*model.TableOperation, len(t.workloads))
-	for tableID, boundaryTs := range tableIDs {
-		captureID := t.workloads.SelectIdleCapture()
+	var localityLimit uint64
+	if t.locality.Enabled() {
+		localityLimit = t.locality.limit(t.workloads, len(tableIDs))
+	}
+	for _, tableID := range sortedTableIDs(tableIDs) {
+		boundaryTs := tableIDs[tableID]
+		captureID := t.selectCapture(tableID, localityLimit)
 		operations := result[captureID]
 		if operations == nil {
 			operations = make(map[model.TableID]*model.TableOperation)
@@ -98,3 +136,125 @@ func (t *TableNumberScheduler) DistributeTables(tableIDs map[model.TableID]model
 	}
 	return result
 }
+
+func sortedTableIDs(tableIDs map[model.TableID]model.Ts) []model.TableID {
+	sorted := make([]model.TableID, 0, len(tableIDs))
+	for tableID := range tableIDs {
+		sorted = append(sorted, tableID)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// groupTableNumbers returns the number of the tables in the group of each
+// capture
+func (t *TableNumberScheduler) groupTableNumbers(groupID model.TableID) map[model.CaptureID]int {
+	numbers := make(map[model.CaptureID]int, len(t.workloads))
+	for captureID, captureWorkloads := range t.workloads {
+		for tableID := range captureWorkloads {
+			if group, ok := t.groups[tableID]; ok && group.ID == groupID {
+				numbers[captureID]++
+			}
+		}
+	}
+	return numbers
+}
+
+// selectCapture selects the capture to place the table. The tables co-located
+// with their groups are placed in the capture with the most tables of the
+// group, and the other tables in groups are placed in the capture with the
+// fewest tables of the group, the ties are broken by the workloads. The tables
+// not in any group are placed by the locality within the limit if it's enabled.
+func (t *TableNumberScheduler) selectCapture(tableID model.TableID, localityLimit uint64) model.CaptureID {
+	group, ok := t.groups[tableID]
+	if !ok {
+		if t.locality.Enabled() {
+			return t.selectLocalCapture(tableID, localityLimit)
+		}
+		return t.workloads.SelectIdleCapture()
+	}
+	numbers := t.groupTableNumbers(group.ID)
+	if group.CoLocate {
+		var target model.CaptureID
+		for captureID, number := range numbers {
+			if number > numbers[target] || (number == numbers[target] && captureID < target) {
+				target = captureID
+			}
+		}
+		if target != "" {
+			return target
+		}
+		return t.workloads.SelectIdleCapture()
+	}
+	var (
+		target         model.CaptureID
+		targetWorkload uint64
+	)
+	for captureID := range t.workloads {
+		workload := t.workloads.CaptureWorkload(captureID)
+		if target == "" || numbers[captureID] < numbers[target] ||
+			(numbers[captureID] == numbers[target] && workload < targetWorkload) ||
+			(numbers[captureID] == numbers[target] && workload == targetWorkload && captureID < target) {
+			target = captureID
+			targetWorkload = workload
+		}
+	}
+	return target
+}
+
+// selectTableToMove selects a table of the capture to move away when the
+// capture is overloaded. The tables not in any group are selected first, the
+// least local ones first if the locality is enabled, then the tables of the
+// group with the most tables in the capture. The tables co-located with their
+// groups are never selected.
+func (t *TableNumberScheduler) selectTableToMove(captureID model.CaptureID) (model.TableID, bool) {
+	captureWorkloads := t.workloads[captureID]
+	tableIDs := make(map[model.TableID]model.Ts, len(captureWorkloads))
+	for tableID := range captureWorkloads {
+		tableIDs[tableID] = 0
+	}
+	var (
+		target       model.TableID
+		targetNumber int
+		found        bool
+	)
+	var (
+		ungrouped         model.TableID
+		ungroupedFraction float64
+		foundUngrouped    bool
+	)
+	localityEnabled := t.locality.Enabled()
+	groupNumbers := make(map[model.TableID]int)
+	for _, tableID := range sortedTableIDs(tableIDs) {
+		group, ok := t.groups[tableID]
+		if !ok {
+			if !localityEnabled {
+				return tableID, true
+			}
+			// the table with the fewest local leaders is moved first
+			fraction := t.locality.localFraction(tableID, captureID)
+			if !foundUngrouped || fraction < ungroupedFraction {
+				ungrouped, ungroupedFraction, foundUngrouped = tableID, fraction, true
+			}
+			continue
+		}
+		if foundUngrouped {
+			continue
+		}
+		if group.CoLocate {
+			continue
+		}
+		number, ok := groupNumbers[group.ID]
+		if !ok {
+			number = t.groupTableNumbers(group.ID)[captureID]
+			groupNumbers[group.ID] = number
+		}
+		if !found || number > targetNumber {
+			target, targetNumber, found = tableID, number, true
+		}
+	}
+	if foundUngrouped {
+		return ungrouped, true
+	}
+	return target, found
+}
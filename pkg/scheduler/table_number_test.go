@@ -113,3 +113,109 @@ func (s *tableNumberSuite) TestCalRebalanceOperates(c *check.C) {
 	}
 	c.Assert(fmt.Sprintf("%.2f%%", skewness*100), check.Equals, "0.00%")
 }
+
+// newPartitionedTable returns the partitions of a partitioned table, the IDs of
+// the partitions are after the ID of the logical table
+func newPartitionedTable(tableID model.TableID, partitionNum int, coLocate bool) (
+	map[model.TableID]model.Ts, map[model.TableID]TableGroup) {
+	partitions := make(map[model.TableID]model.Ts, partitionNum)
+	groups := make(map[model.TableID]TableGroup, partitionNum)
+	for i := 1; i <= partitionNum; i++ {
+		partitions[tableID+int64(i)] = 1
+		groups[tableID+int64(i)] = TableGroup{ID: tableID, CoLocate: coLocate}
+	}
+	return partitions, groups
+}
+
+// groupDistribution returns the number of the tables in the group of each capture
+func groupDistribution(scheduler *TableNumberScheduler, groupID model.TableID) map[model.CaptureID]int {
+	distribution := make(map[model.CaptureID]int)
+	for captureID, captureWorkloads := range scheduler.workloads {
+		distribution[captureID] = 0
+		for tableID := range captureWorkloads {
+			if group, ok := scheduler.groups[tableID]; ok && group.ID == groupID {
+				distribution[captureID]++
+			}
+		}
+	}
+	return distribution
+}
+
+func (s *tableNumberSuite) TestDistributePartitions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	scheduler := newTableNumberScheduler()
+	for _, captureID := range []model.CaptureID{"capture1", "capture2", "capture3", "capture4"} {
+		scheduler.ResetWorkloads(captureID, model.TaskWorkload{})
+	}
+	partitions, groups := newPartitionedTable(100, 64, false)
+	scheduler.ResetTableGroups(groups)
+	scheduler.DistributeTables(partitions)
+	c.Assert(groupDistribution(scheduler, 100), check.DeepEquals, map[model.CaptureID]int{
+		"capture1": 16, "capture2": 16, "capture3": 16, "capture4": 16,
+	})
+
+	// the partitions are spread even if the captures are not balanced
+	scheduler = newTableNumberScheduler()
+	scheduler.ResetWorkloads("capture1", model.TaskWorkload{
+		1: model.WorkloadInfo{Workload: 1},
+		2: model.WorkloadInfo{Workload: 1},
+		3: model.WorkloadInfo{Workload: 1},
+		4: model.WorkloadInfo{Workload: 1},
+	})
+	for _, captureID := range []model.CaptureID{"capture2", "capture3", "capture4"} {
+		scheduler.ResetWorkloads(captureID, model.TaskWorkload{})
+	}
+	scheduler.ResetTableGroups(groups)
+	scheduler.DistributeTables(partitions)
+	c.Assert(groupDistribution(scheduler, 100), check.DeepEquals, map[model.CaptureID]int{
+		"capture1": 16, "capture2": 16, "capture3": 16, "capture4": 16,
+	})
+
+	// the partitions co-located are placed in the same capture
+	scheduler = newTableNumberScheduler()
+	for _, captureID := range []model.CaptureID{"capture1", "capture2", "capture3", "capture4"} {
+		scheduler.ResetWorkloads(captureID, model.TaskWorkload{})
+	}
+	partitions, groups = newPartitionedTable(200, 64, true)
+	scheduler.ResetTableGroups(groups)
+	result := scheduler.DistributeTables(partitions)
+	c.Assert(result, check.HasLen, 1)
+	for _, ops := range result {
+		c.Assert(ops, check.HasLen, 64)
+	}
+}
+
+func (s *tableNumberSuite) TestRebalancePartitions(c *check.C) {
+	defer testleak.AfterTest(c)()
+	scheduler := newTableNumberScheduler()
+	spread, groups := newPartitionedTable(100, 64, false)
+	coLocated, coLocatedGroups := newPartitionedTable(200, 8, true)
+	for tableID, group := range coLocatedGroups {
+		groups[tableID] = group
+	}
+	// all partitions are in capture1, e.g. the other captures are just started
+	workloads := make(model.TaskWorkload)
+	for tableID := range spread {
+		workloads[tableID] = model.WorkloadInfo{Workload: 1}
+	}
+	for tableID := range coLocated {
+		workloads[tableID] = model.WorkloadInfo{Workload: 1}
+	}
+	scheduler.ResetWorkloads("capture1", workloads)
+	for _, captureID := range []model.CaptureID{"capture2", "capture3", "capture4"} {
+		scheduler.ResetWorkloads(captureID, model.TaskWorkload{})
+	}
+	scheduler.ResetTableGroups(groups)
+	_, moveJobs := scheduler.CalRebalanceOperates(0)
+	for tableID, job := range moveJobs {
+		c.Assert(job.From, check.Equals, "capture1")
+		c.Assert(job.To, check.Not(check.Equals), "capture1")
+		c.Assert(groups[tableID].CoLocate, check.IsFalse)
+	}
+	c.Assert(groupDistribution(scheduler, 100), check.DeepEquals, map[model.CaptureID]int{
+		"capture1": 16, "capture2": 16, "capture3": 16, "capture4": 16,
+	})
+	c.Assert(groupDistribution(scheduler, 200), check.DeepEquals, map[model.CaptureID]int{
+		"capture1": 8, "capture2": 0, "capture3": 0, "capture4": 0,
+	})
+}
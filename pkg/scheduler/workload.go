@@ -87,15 +87,23 @@ func (w workloads) Skewness() float64 {
 	return math.Sqrt(totalVariance / float64(len(w)))
 }
 
+func (w workloads) CaptureWorkload(captureID model.CaptureID) uint64 {
+	var total uint64
+	for _, workload := range w[captureID] {
+		total += workload.Workload
+	}
+	return total
+}
+
 func (w workloads) SelectIdleCapture() model.CaptureID {
 	minWorkload := uint64(math.MaxUint64)
 	var minCapture model.CaptureID
-	for captureID, captureWorkloads := range w {
-		var totalWorkloadInCapture uint64
-		for _, workload := range captureWorkloads {
-			totalWorkloadInCapture += workload.Workload
-		}
-		if minWorkload > totalWorkloadInCapture {
+	for captureID := range w {
+		totalWorkloadInCapture := w.CaptureWorkload(captureID)
+		// the ties are broken by the capture IDs, so that the same workloads
+		// are always scheduled in the same way
+		if minWorkload > totalWorkloadInCapture ||
+			(minWorkload == totalWorkloadInCapture && captureID < minCapture) {
 			minWorkload = totalWorkloadInCapture
 			minCapture = captureID
 		}
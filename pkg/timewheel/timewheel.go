@@ -0,0 +1,136 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timewheel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Wheel is a hashed timing wheel, which drives the coarse-grained tickers,
+// e.g. the ones of the periodic metrics of the processors, by one goroutine
+// instead of a runtime timer for each of them. The intervals of the tickers
+// are rounded up to the resolution of the wheel.
+type Wheel struct {
+	resolution time.Duration
+
+	mu     sync.Mutex
+	slots  []map[*Ticker]struct{}
+	cursor int
+}
+
+// NewWheel creates a Wheel with the resolution and the number of slots, the
+// tickers whose intervals are longer than a round of the wheel wait for more
+// rounds.
+func NewWheel(resolution time.Duration, slots int) *Wheel {
+	w := &Wheel{
+		resolution: resolution,
+		slots:      make([]map[*Ticker]struct{}, slots),
+	}
+	for i := range w.slots {
+		w.slots[i] = make(map[*Ticker]struct{})
+	}
+	return w
+}
+
+// Run advances the wheel by the resolution until the context is done.
+func (w *Wheel) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.advance(now)
+		}
+	}
+}
+
+// advance moves the cursor to the next slot, and fires the tickers in it.
+func (w *Wheel) advance(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cursor = (w.cursor + 1) % len(w.slots)
+	slot := w.slots[w.cursor]
+	var fired []*Ticker
+	for t := range slot {
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		delete(slot, t)
+		fired = append(fired, t)
+	}
+	for _, t := range fired {
+		// the tick is dropped if the last one is not received, like the
+		// time.Ticker does.
+		select {
+		case t.c <- now:
+		default:
+		}
+		w.schedule(t)
+	}
+}
+
+func (w *Wheel) schedule(t *Ticker) {
+	t.slot = (w.cursor + t.ticks) % len(w.slots)
+	t.rounds = (t.ticks - 1) / len(w.slots)
+	w.slots[t.slot][t] = struct{}{}
+}
+
+// Ticker delivers the ticks of an interval, it's driven by a wheel, or by a
+// time.Ticker if the wheel is nil.
+type Ticker struct {
+	C <-chan time.Time
+	c chan time.Time
+
+	wheel  *Wheel
+	ticks  int
+	slot   int
+	rounds int
+
+	std *time.Ticker
+}
+
+// NewTicker returns a Ticker of the interval, a time.Ticker is used if the
+// wheel is nil.
+func (w *Wheel) NewTicker(interval time.Duration) *Ticker {
+	if w == nil {
+		std := time.NewTicker(interval)
+		return &Ticker{C: std.C, std: std}
+	}
+	ticks := int((interval + w.resolution - 1) / w.resolution)
+	if ticks < 1 {
+		ticks = 1
+	}
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, c: c, wheel: w, ticks: ticks}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.schedule(t)
+	return t
+}
+
+// Stop turns off the ticker, no more ticks are sent after Stop returns.
+func (t *Ticker) Stop() {
+	if t.std != nil {
+		t.std.Stop()
+		return
+	}
+	t.wheel.mu.Lock()
+	defer t.wheel.mu.Unlock()
+	delete(t.wheel.slots[t.slot], t)
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timewheel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type wheelSuite struct{}
+
+var _ = check.Suite(&wheelSuite{})
+
+func ticked(t *Ticker) bool {
+	select {
+	case <-t.C:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *wheelSuite) TestAdvance(c *check.C) {
+	defer testleak.AfterTest(c)()
+	w := NewWheel(time.Second, 4)
+	t1 := w.NewTicker(time.Second)
+	// the interval is rounded up to 3s
+	t3 := w.NewTicker(2500 * time.Millisecond)
+	// the ticker waits for 2 rounds of the wheel
+	t10 := w.NewTicker(10 * time.Second)
+	for i := 1; i <= 20; i++ {
+		w.advance(time.Now())
+		c.Assert(ticked(t1), check.IsTrue)
+		c.Assert(ticked(t3), check.Equals, i%3 == 0, check.Commentf("tick %d", i))
+		c.Assert(ticked(t10), check.Equals, i%10 == 0, check.Commentf("tick %d", i))
+	}
+
+	// the tick is dropped if the last one is not received
+	w.advance(time.Now())
+	w.advance(time.Now())
+	c.Assert(ticked(t1), check.IsTrue)
+	c.Assert(ticked(t1), check.IsFalse)
+
+	ticked(t3)
+	t1.Stop()
+	t3.Stop()
+	w.advance(time.Now())
+	c.Assert(ticked(t1), check.IsFalse)
+	for i := 0; i < 10; i++ {
+		w.advance(time.Now())
+	}
+	c.Assert(ticked(t3), check.IsFalse)
+	c.Assert(ticked(t10), check.IsTrue)
+	t10.Stop()
+	for _, slot := range w.slots {
+		c.Assert(slot, check.HasLen, 0)
+	}
+}
+
+func (s *wheelSuite) TestRun(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewWheel(10*time.Millisecond, 16)
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	t := w.NewTicker(50 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		<-t.C
+	}
+	c.Assert(time.Since(start), check.GreaterEqual, 100*time.Millisecond)
+	t.Stop()
+	cancel()
+	<-done
+
+	// a nil wheel falls back to the time.Ticker
+	var nilWheel *Wheel
+	t = nilWheel.NewTicker(10 * time.Millisecond)
+	<-t.C
+	t.Stop()
+}
@@ -32,6 +32,7 @@ const (
 	ctxKeyIsOwner      = ctxKey("isOwner")
 	ctxKeyTimezone     = ctxKey("timezone")
 	ctxKeyKVStorage    = ctxKey("kvStorage")
+	ctxKeyClusterID    = ctxKey("clusterID")
 )
 
 // CaptureAddrFromCtx returns a capture ID stored in the specified context.
@@ -49,6 +50,21 @@ func PutCaptureAddrInCtx(ctx context.Context, captureAddr string) context.Contex
 	return context.WithValue(ctx, ctxKeyCaptureAddr, captureAddr)
 }
 
+// ClusterIDFromCtx returns the ID of the TiCDC cluster stored in the specified context.
+// It returns an empty string (the default cluster) if there's no cluster ID found.
+func ClusterIDFromCtx(ctx context.Context) string {
+	clusterID, ok := ctx.Value(ctxKeyClusterID).(string)
+	if !ok {
+		return ""
+	}
+	return clusterID
+}
+
+// PutClusterIDInCtx returns a new child context with the specified cluster ID stored.
+func PutClusterIDInCtx(ctx context.Context, clusterID string) context.Context {
+	return context.WithValue(ctx, ctxKeyClusterID, clusterID)
+}
+
 // PutTimezoneInCtx returns a new child context with the given timezone
 func PutTimezoneInCtx(ctx context.Context, timezone *time.Location) context.Context {
 	return context.WithValue(ctx, ctxKeyTimezone, timezone)
@@ -132,3 +148,27 @@ func ZapFieldCapture(ctx context.Context) zap.Field {
 func ZapFieldChangefeed(ctx context.Context) zap.Field {
 	return zap.String("changefeed", ChangefeedIDFromCtx(ctx))
 }
+
+// ZapFieldsFromCtx returns the zap fields containing the changefeed id, the
+// capture address and the table stored in the context, the fields of the table
+// are omitted if no table is stored.
+func ZapFieldsFromCtx(ctx context.Context) []zap.Field {
+	fields := []zap.Field{ZapFieldChangefeed(ctx), ZapFieldCapture(ctx)}
+	if info, ok := ctx.Value(ctxKeyTableID).(tableinfo); ok {
+		fields = append(fields, zap.Int64("table-id", info.id), zap.String("table-name", info.name))
+	}
+	return fields
+}
+
+// AnnotateTableErrFromCtx annotates the error with the table stored in the
+// context, the error is returned as is if no table is stored.
+func AnnotateTableErrFromCtx(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	info, ok := ctx.Value(ctxKeyTableID).(tableinfo)
+	if !ok {
+		return err
+	}
+	return errors.Annotatef(err, "table %d %s", info.id, info.name)
+}
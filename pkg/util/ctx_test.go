@@ -17,9 +17,12 @@ import (
 	"context"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
 	"github.com/pingcap/ticdc/pkg/util/testleak"
 	"github.com/pingcap/tidb/store/mockstore"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type ctxValueSuite struct{}
@@ -41,6 +44,13 @@ func (s *ctxValueSuite) TestCaptureIDNotSet(c *check.C) {
 	c.Assert(CaptureAddrFromCtx(ctx), check.Equals, "")
 }
 
+func (s *ctxValueSuite) TestShouldReturnClusterID(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(ClusterIDFromCtx(context.Background()), check.Equals, "")
+	ctx := PutClusterIDInCtx(context.Background(), "cluster-1")
+	c.Assert(ClusterIDFromCtx(ctx), check.Equals, "cluster-1")
+}
+
 func (s *ctxValueSuite) TestShouldReturnChangefeedID(c *check.C) {
 	defer testleak.AfterTest(c)()
 	ctx := PutChangefeedIDInCtx(context.Background(), "ello")
@@ -137,3 +147,38 @@ func (s *ctxValueSuite) TestZapFieldWithContext(c *check.C) {
 	c.Assert(ZapFieldCapture(ctx), check.DeepEquals, zap.String("capture", capture))
 	c.Assert(ZapFieldChangefeed(ctx), check.DeepEquals, zap.String("changefeed", changefeed))
 }
+
+func (s *ctxValueSuite) TestZapFieldsFromCtx(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := PutCaptureAddrInCtx(context.Background(), "127.0.0.1:8200")
+	ctx = PutChangefeedIDInCtx(ctx, "test-cf")
+	c.Assert(ZapFieldsFromCtx(ctx), check.DeepEquals, []zap.Field{
+		zap.String("changefeed", "test-cf"), zap.String("capture", "127.0.0.1:8200"),
+	})
+	ctx = PutTableInfoInCtx(ctx, 1321, "`test`.`t`")
+	c.Assert(ZapFieldsFromCtx(ctx), check.DeepEquals, []zap.Field{
+		zap.String("changefeed", "test-cf"), zap.String("capture", "127.0.0.1:8200"),
+		zap.Int64("table-id", 1321), zap.String("table-name", "`test`.`t`"),
+	})
+
+	// the fields appear on the log lines
+	logs, restore := ObserveLogs(zapcore.InfoLevel)
+	defer restore()
+	log.Info("test log", append(ZapFieldsFromCtx(ctx), zap.Int("n", 1))...)
+	c.Assert(logs.Len(), check.Equals, 1)
+	c.Assert(logs.All()[0].ContextMap(), check.DeepEquals, map[string]interface{}{
+		"changefeed": "test-cf", "capture": "127.0.0.1:8200",
+		"table-id": int64(1321), "table-name": "`test`.`t`", "n": int64(1),
+	})
+}
+
+func (s *ctxValueSuite) TestAnnotateTableErrFromCtx(c *check.C) {
+	defer testleak.AfterTest(c)()
+	err := errors.New("test error")
+	c.Assert(AnnotateTableErrFromCtx(context.Background(), err), check.Equals, err)
+	ctx := PutTableInfoInCtx(context.Background(), 1321, "`test`.`t`")
+	c.Assert(AnnotateTableErrFromCtx(ctx, nil), check.IsNil)
+	annotated := AnnotateTableErrFromCtx(ctx, err)
+	c.Assert(annotated, check.ErrorMatches, "table 1321 `test`.`t`: test error")
+	c.Assert(errors.Cause(annotated), check.Equals, err)
+}
@@ -28,10 +28,20 @@ const (
 	cdcChangefeedCreatingServiceGCSafePointTTL = 10 * 60 // 10 mins
 )
 
+// ServiceSafePointID returns the service GC safe point ID of the TiCDC cluster,
+// the ID of the default cluster (with an empty cluster ID) is the base ID.
+func ServiceSafePointID(baseID, clusterID string) string {
+	if clusterID == "" {
+		return baseID
+	}
+	return baseID + "-" + clusterID
+}
+
 // CheckSafetyOfStartTs checks if the startTs less than the minimum of Service-GC-Ts
 // and this function will update the service GC to startTs
 func CheckSafetyOfStartTs(ctx context.Context, pdCli pd.Client, startTs uint64) error {
-	minServiceGCTs, err := pdCli.UpdateServiceGCSafePoint(ctx, cdcChangefeedCreatingServiceGCSafePointID,
+	minServiceGCTs, err := pdCli.UpdateServiceGCSafePoint(ctx,
+		ServiceSafePointID(cdcChangefeedCreatingServiceGCSafePointID, ClusterIDFromCtx(ctx)),
 		cdcChangefeedCreatingServiceGCSafePointTTL, startTs)
 	if err != nil {
 		return errors.Trace(err)
@@ -41,3 +51,19 @@ func CheckSafetyOfStartTs(ctx context.Context, pdCli pd.Client, startTs uint64)
 	}
 	return nil
 }
+
+// CheckSafetyOfResumeTs checks if the ts a changefeed is resumed from is less
+// than the GC safe point. Unlike CheckSafetyOfStartTs, the service GC safe
+// points are not checked, since the one of TiCDC may be held by the changefeed
+// itself, whose checkpoint ts is after the ts it's resumed from.
+func CheckSafetyOfResumeTs(ctx context.Context, pdCli pd.Client, resumeTs uint64) error {
+	// the GC safe point is never decreased, so the current one is returned
+	gcSafePoint, err := pdCli.UpdateGCSafePoint(ctx, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resumeTs < gcSafePoint {
+		return errors.Wrap(tikv.ErrGCTooEarly.GenWithStackByArgs(resumeTs, gcSafePoint), "resumeTs less than gcSafePoint")
+	}
+	return nil
+}
@@ -43,9 +43,41 @@ func (s *gcServiceSuite) TestCheckSafetyOfStartTs(c *check.C) {
 	c.Assert(s.pdCli.serviceSafePoint, check.DeepEquals, map[string]uint64{"service1": 60, "service2": 80, "service3": 70, "ticdc-changefeed-creating": 65})
 }
 
+func (s *gcServiceSuite) TestServiceSafePointID(c *check.C) {
+	defer testleak.AfterTest(c)()
+	c.Assert(ServiceSafePointID("ticdc", ""), check.Equals, "ticdc")
+	c.Assert(ServiceSafePointID("ticdc", "cluster-1"), check.Equals, "ticdc-cluster-1")
+
+	ctx := PutClusterIDInCtx(context.Background(), "cluster-1")
+	pdCli := mockPdClientForServiceGCSafePoint{serviceSafePoint: map[string]uint64{"service1": 60}}
+	err := CheckSafetyOfStartTs(ctx, pdCli, 65)
+	c.Assert(err, check.IsNil)
+	c.Assert(pdCli.serviceSafePoint, check.DeepEquals, map[string]uint64{"service1": 60, "ticdc-changefeed-creating-cluster-1": 65})
+}
+
+func (s *gcServiceSuite) TestCheckSafetyOfResumeTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+	pdCli := mockPdClientForServiceGCSafePoint{serviceSafePoint: map[string]uint64{"ticdc": 100}, gcSafePoint: 60}
+	err := CheckSafetyOfResumeTs(ctx, pdCli, 50)
+	c.Assert(err.Error(), check.Equals, "resumeTs less than gcSafePoint: [tikv:9006]GC life time is shorter than transaction duration, transaction starts at 50, GC safe point is 60")
+	// the ts before the service GC safe points is allowed
+	c.Assert(CheckSafetyOfResumeTs(ctx, pdCli, 60), check.IsNil)
+	c.Assert(CheckSafetyOfResumeTs(ctx, pdCli, 80), check.IsNil)
+	c.Assert(pdCli.serviceSafePoint, check.DeepEquals, map[string]uint64{"ticdc": 100})
+}
+
 type mockPdClientForServiceGCSafePoint struct {
 	pd.Client
 	serviceSafePoint map[string]uint64
+	gcSafePoint      uint64
+}
+
+func (m mockPdClientForServiceGCSafePoint) UpdateGCSafePoint(ctx context.Context, safePoint uint64) (uint64, error) {
+	if safePoint > m.gcSafePoint {
+		panic("the GC safe point is not expected to be updated")
+	}
+	return m.gcSafePoint, nil
 }
 
 func (m mockPdClientForServiceGCSafePoint) UpdateServiceGCSafePoint(ctx context.Context, serviceID string, ttl int64, safePoint uint64) (uint64, error) {
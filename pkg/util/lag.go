@@ -0,0 +1,35 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"time"
+
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// TsLag returns the lag (s) of the ts behind now, it's 0 for an unset ts.
+// It is more accurate to get tso from PD, but in most cases we have deployed
+// NTP service, a little bias is acceptable here. The lag of a ts ahead of now,
+// which means the clock of this host is behind the PD leader, is clamped to 0.
+func TsLag(now time.Time, ts uint64) float64 {
+	if ts == 0 {
+		return 0
+	}
+	lag := float64(oracle.GetPhysical(now)-oracle.ExtractPhysical(ts)) / 1e3
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type lagSuite struct{}
+
+var _ = check.Suite(&lagSuite{})
+
+func (s *lagSuite) TestTsLag(c *check.C) {
+	defer testleak.AfterTest(c)()
+	now := time.Now()
+	c.Assert(TsLag(now, 0), check.Equals, float64(0))
+	ts := oracle.ComposeTS(oracle.GetPhysical(now.Add(-1500*time.Millisecond)), 0)
+	c.Assert(TsLag(now, ts), check.Equals, 1.5)
+	// the ts ahead of now is clamped
+	ts = oracle.ComposeTS(oracle.GetPhysical(now.Add(time.Second)), 0)
+	c.Assert(TsLag(now, ts), check.Equals, float64(0))
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mackerelio/go-osstat/memory"
+	"github.com/pingcap/errors"
+)
+
+var cgroupMemoryLimitFiles = []string{
+	// cgroup v2
+	"/sys/fs/cgroup/memory.max",
+	// cgroup v1
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// DiskUsage returns the used and total bytes of the file system containing dir
+func DiskUsage(dir string) (used uint64, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	bsize := uint64(st.Bsize)
+	total = st.Blocks * bsize
+	// the blocks reserved for root are not available for us
+	used = total - st.Bavail*bsize
+	return used, total, nil
+}
+
+// ProcessMemoryUsage returns the RSS of the current process and the memory
+// limit of it, which is the cgroup memory limit if it's set, otherwise the
+// total memory of the system.
+func ProcessMemoryUsage() (rss uint64, limit uint64, err error) {
+	// the second field of statm is the number of resident pages
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, 0, errors.Errorf("unexpected content of statm: %s", data)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	rss = pages * uint64(os.Getpagesize())
+
+	m, err := memory.Get()
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	limit = m.Total
+	for _, file := range cgroupMemoryLimitFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// the limit is "max" or a huge number if it's not set
+		cgroupLimit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && cgroupLimit < limit {
+			limit = cgroupLimit
+		}
+		break
+	}
+	return rss, limit, nil
+}
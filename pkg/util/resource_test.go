@@ -0,0 +1,47 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"runtime"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/ticdc/pkg/util/testleak"
+)
+
+type resourceSuite struct{}
+
+var _ = check.Suite(&resourceSuite{})
+
+func (s *resourceSuite) TestDiskUsage(c *check.C) {
+	defer testleak.AfterTest(c)()
+	used, total, err := DiskUsage(c.MkDir())
+	c.Assert(err, check.IsNil)
+	c.Assert(total, check.Greater, uint64(0))
+	c.Assert(used <= total, check.IsTrue)
+
+	_, _, err = DiskUsage("/not-exist-dir")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *resourceSuite) TestProcessMemoryUsage(c *check.C) {
+	defer testleak.AfterTest(c)()
+	if runtime.GOOS != "linux" {
+		c.Skip("statm is only available on linux")
+	}
+	rss, limit, err := ProcessMemoryUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(rss, check.Greater, uint64(0))
+	c.Assert(rss < limit, check.IsTrue)
+}
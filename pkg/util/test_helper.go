@@ -17,6 +17,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -53,3 +57,15 @@ func HandleErrWithErrGroup(ctx context.Context, errCh <-chan error, errFn func(e
 	})
 	return errg
 }
+
+// ObserveLogs replaces the global logger with one recording the logs at or
+// above the level in memory, the returned function restores the original one.
+func ObserveLogs(level zapcore.Level) (*observer.ObservedLogs, func()) {
+	original, originalLevel := log.L(), log.GetLevel()
+	core, logs := observer.New(level)
+	atomicLevel := zap.NewAtomicLevelAt(level)
+	log.ReplaceGlobals(zap.New(core), &log.ZapProperties{Core: core, Level: atomicLevel})
+	return logs, func() {
+		log.ReplaceGlobals(original, &log.ZapProperties{Core: original.Core(), Level: zap.NewAtomicLevelAt(originalLevel)})
+	}
+}
@@ -13,8 +13,22 @@
 
 package main
 
-import "testing"
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+)
 
 func TestFoo(t *testing.T) {
+	// sort in a temporary directory, so that no sort file is left behind
+	dir, err := ioutil.TempDir("", "many_sorters_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := flag.Set("dir", dir); err != nil {
+		t.Fatal(err)
+	}
 	main()
 }
@@ -0,0 +1,71 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+TABLE_COUNT=5
+# the position flush interval is much longer than the expected latency, so the
+# new tables must be discovered by watching the task status
+FLUSH_INTERVAL=30s
+MAX_LATENCY=15
+
+# wait_table waits until the row of the table is replicated and stores the
+# seconds it takes in latency
+function wait_table() {
+    table=$1
+    start=$(date +%s)
+    while true; do
+        if run_sql "SELECT count(*) AS cnt FROM add_table_latency.$table;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} > /dev/null 2>&1 && \
+            check_contains "cnt: 1" > /dev/null 2>&1; then
+            break
+        fi
+        if [ $(( $(date +%s) - start )) -gt $MAX_LATENCY ]; then
+            echo "table $table is not replicated in ${MAX_LATENCY}s"
+            exit 1
+        fi
+        sleep 0.5
+    done
+    latency=$(( $(date +%s) - start ))
+}
+
+function run() {
+    # only the MySQL sink is verified, the latency doesn't depend on the sink
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    run_sql "CREATE DATABASE add_table_latency;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" \
+        --processor-flush-interval $FLUSH_INTERVAL
+    SINK_URI="mysql://root@127.0.0.1:3306/"
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --changefeed-id="add-table-latency"
+
+    total=0
+    for i in $(seq 1 $TABLE_COUNT); do
+        run_sql "CREATE TABLE add_table_latency.t$i(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        run_sql "INSERT INTO add_table_latency.t$i VALUES (1);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        wait_table t$i
+        echo "add table t$i latency: ${latency}s"
+        total=$(( total + latency ))
+    done
+    avg=$(( total / TABLE_COUNT ))
+    echo "average add table latency: ${avg}s, flush interval: $FLUSH_INTERVAL"
+    if [ $avg -ge 10 ]; then
+        echo "the average add table latency ${avg}s is too high"
+        exit 1
+    fi
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,114 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+ROW_COUNT=500
+
+function write_rows() {
+    for i in $(seq 1 $ROW_COUNT); do
+        mysql -uroot -h${UP_TIDB_HOST} -P${UP_TIDB_PORT} -e "INSERT INTO changefeed_clean_pause.t VALUES ($i);"
+    done
+}
+
+function wait_paused() {
+    changefeed_id=$1
+    i=0
+    while [ $i -lt 30 ]; do
+        if run_cdc_cli changefeed query --changefeed-id=$changefeed_id 2>&1 | grep -q '"clean": true'; then
+            return 0
+        fi
+        ((i++))
+        sleep 1
+    done
+    echo "changefeed $changefeed_id is not paused cleanly"
+    run_cdc_cli changefeed query --changefeed-id=$changefeed_id
+    exit 1
+}
+
+function wait_resumed() {
+    changefeed_id=$1
+    i=0
+    while [ $i -lt 30 ]; do
+        if ! run_cdc_cli changefeed query --changefeed-id=$changefeed_id 2>&1 | grep -q '"pause"'; then
+            return 0
+        fi
+        ((i++))
+        sleep 1
+    done
+    echo "changefeed $changefeed_id is not resumed"
+    exit 1
+}
+
+function check_downstream() {
+    run_sql "SELECT count(*) AS cnt FROM changefeed_clean_pause.t;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} && \
+    check_contains "cnt: $ROW_COUNT" && \
+    run_sql "SELECT count(*) AS cnt FROM (SELECT id FROM changefeed_clean_pause.t GROUP BY id HAVING count(*) > 1) AS d;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} && \
+    check_contains "cnt: 0"
+}
+
+function run() {
+    # only the MySQL sink writes the rows to a table which can be checked for
+    # duplicates
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    run_sql "CREATE DATABASE changefeed_clean_pause;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE changefeed_clean_pause.t(id int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+    SINK_URI="mysql://root@127.0.0.1:3306/?safe-mode=false"
+    changefeed_id="clean-pause"
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --config=$CUR/conf/changefeed.toml --changefeed-id=$changefeed_id
+    check_table_exists changefeed_clean_pause.t ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    # pause and resume the changefeed repeatedly while the rows are written,
+    # the rows flushed before a clean pause must not be replicated again.
+    write_rows &
+    writer=$!
+    for i in $(seq 1 5); do
+        sleep 2
+        run_cdc_cli changefeed pause --changefeed-id=$changefeed_id
+        wait_paused $changefeed_id
+        run_cdc_cli changefeed resume --changefeed-id=$changefeed_id
+        wait_resumed $changefeed_id
+    done
+    wait $writer
+
+    i=0
+    check_time=30
+    set +e
+    while [ $i -lt $check_time ]
+    do
+        check_downstream
+        ret=$?
+        if [ "$ret" == 0 ]; then
+            echo "check data successfully"
+            break
+        fi
+        ((i++))
+        echo "check data failed $i-th time, retry later"
+        sleep 2
+    done
+    set -e
+
+    if [ $i -ge $check_time ]; then
+        echo "check data failed at last"
+        exit 1
+    fi
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,110 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+# wait_changefeed waits until the output of `changefeed query` contains all the
+# patterns
+function wait_changefeed() {
+    changefeed_id=$1
+    shift
+    i=0
+    while [ $i -lt 30 ]; do
+        run_cdc_cli changefeed query --changefeed-id=$changefeed_id > $WORK_DIR/query.out 2>&1 || true
+        matched=true
+        for pattern in "$@"; do
+            if ! grep -qF "$pattern" $WORK_DIR/query.out; then
+                matched=false
+                break
+            fi
+        done
+        if [ "$matched" == true ]; then
+            return 0
+        fi
+        ((i++))
+        sleep 1
+    done
+    echo "changefeed $changefeed_id doesn't match $*"
+    cat $WORK_DIR/query.out
+    exit 1
+}
+
+function check_row_count() {
+    expected=$1
+    i=0
+    while [ $i -lt 30 ]; do
+        if run_sql "SELECT count(*) AS cnt FROM changefeed_sort_engine.t;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} && \
+            check_contains "cnt: $expected"; then
+            return 0
+        fi
+        ((i++))
+        sleep 2
+    done
+    echo "the downstream is expected to have $expected rows"
+    exit 1
+}
+
+function run() {
+    # only the MySQL sink is verified, the sort engine doesn't depend on the sink
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    run_sql "CREATE DATABASE changefeed_sort_engine;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE changefeed_sort_engine.t(id int primary key, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO changefeed_sort_engine.t VALUES (1, 1), (2, 2);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300"
+    SINK_URI="mysql://root@127.0.0.1:3306/"
+    changefeed_id="sort-engine"
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --sort-engine=memory --changefeed-id=$changefeed_id
+    check_row_count 2
+
+    # switch the paused changefeed to the unified sorter
+    sort_dir=$WORK_DIR/unified_sort
+    run_cdc_cli changefeed pause --changefeed-id=$changefeed_id
+    wait_changefeed $changefeed_id '"admin-job-type": 1'
+    run_cdc_cli changefeed update --sink-uri="$SINK_URI" --sort-engine=unified --sort-dir=$sort_dir \
+        --no-confirm --changefeed-id=$changefeed_id
+    wait_changefeed $changefeed_id '"sort-engine": "unified"' "\"sort-dir\": \"$sort_dir\""
+    run_cdc_cli changefeed resume --changefeed-id=$changefeed_id
+    run_sql "INSERT INTO changefeed_sort_engine.t VALUES (3, 3);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_row_count 3
+    # the sort dir is created by the capture
+    if [ ! -d $sort_dir ]; then
+        echo "sort dir $sort_dir is not created"
+        exit 1
+    fi
+
+    # the sort dir is checked by each capture on resume
+    bad_sort_dir=$WORK_DIR/not_a_dir
+    touch $bad_sort_dir
+    run_cdc_cli changefeed pause --changefeed-id=$changefeed_id
+    wait_changefeed $changefeed_id '"admin-job-type": 1'
+    run_cdc_cli changefeed update --sink-uri="$SINK_URI" --sort-dir=$bad_sort_dir \
+        --no-confirm --changefeed-id=$changefeed_id
+    wait_changefeed $changefeed_id '"sort-engine": "unified"' "\"sort-dir\": \"$bad_sort_dir\""
+    run_cdc_cli changefeed resume --changefeed-id=$changefeed_id
+    wait_changefeed $changefeed_id 'CDC:ErrCaptureSortDir' "is not available in capture 127.0.0.1:8300"
+
+    # an unknown sort engine is rejected
+    if run_cdc_cli changefeed create --sink-uri="$SINK_URI" --sort-engine=disk --changefeed-id=bad-engine; then
+        echo "the changefeed with an unknown sort engine is not rejected"
+        exit 1
+    fi
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,75 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+MAX_RETRIES=10
+
+function check_capture_count() {
+    pd=$1
+    expected=$2
+    count=$(cdc cli capture list --pd=$pd 2>&1|jq '.|length')
+    if [[ ! "$count" -eq "$expected" ]]; then
+        echo "count: $count expected: $expected"
+        exit 1
+    fi
+}
+
+export -f check_capture_count
+
+function run() {
+    # the rename is probed in the MySQL downstream
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    pd_addr="http://$UP_PD_HOST_1:$UP_PD_PORT_1"
+    SINK_URI="mysql://root@127.0.0.1:3306/?max-txn-row=1"
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr
+    cdc cli changefeed create --pd=$pd_addr --sink-uri="$SINK_URI"
+    run_sql "CREATE DATABASE ddl_owner_failover;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE table ddl_owner_failover.t1 (id int primary key auto_increment, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO ddl_owner_failover.t1 VALUES (),(),();" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "ddl_owner_failover.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    # the owner crashes after the rename is executed by the downstream, before
+    # it's recorded as done
+    cdc_pid=$(curl -s http://127.0.0.1:8300/status|jq '.pid')
+    kill $cdc_pid
+    ensure $MAX_RETRIES check_capture_count $pd_addr 0
+    export GO_FAILPOINTS='github.com/pingcap/ticdc/cdc/OwnerPanicAfterDDLExecuted=1*return(true)'
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr --logsuffix "_crash"
+    ensure $MAX_RETRIES check_capture_count $pd_addr 1
+    # a table of the old name is created after the rename
+    run_sql "RENAME TABLE ddl_owner_failover.t1 TO ddl_owner_failover.t2;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE table ddl_owner_failover.t1 (id int primary key auto_increment, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    ensure $MAX_RETRIES check_capture_count $pd_addr 0
+
+    export GO_FAILPOINTS=''
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr --logsuffix "_recover"
+    ensure $MAX_RETRIES check_capture_count $pd_addr 1
+    run_sql "INSERT INTO ddl_owner_failover.t1 VALUES (),();" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO ddl_owner_failover.t2 VALUES (),();" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+
+    check_table_exists "ddl_owner_failover.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_table_exists "ddl_owner_failover.t2" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+    # the rename is found executed by the new owner rather than executed again
+    grep -q "DDL dispatched by the previous owner is executed by the downstream" $WORK_DIR/cdc_recover.log
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,54 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function run() {
+    # the downstream writes are detected by the MySQL sink only
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300"
+
+    SINK_URI="mysql://root@127.0.0.1:3306/"
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --config=$CUR/conf/changefeed.toml --changefeed-id="downstream-write-check"
+
+    run_sql "CREATE DATABASE downstream_write_check;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE downstream_write_check.sentinel(id int primary key, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "downstream_write_check.sentinel" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    for i in $(seq 1 10); do
+        run_sql "INSERT INTO downstream_write_check.sentinel VALUES ($i, $i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    run_sql "UPDATE downstream_write_check.sentinel SET val = val + 1 WHERE id < 5;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "DELETE FROM downstream_write_check.sentinel WHERE id = 10;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE downstream_write_check.finish_mark(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "downstream_write_check.finish_mark" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    # wait for the baseline to be taken, the replicated rows are expected
+    sleep 5
+    if grep -q "found the rows written to the downstream" $WORK_DIR/cdc.log; then
+        echo "the replicated rows are reported as unexpected writes"
+        exit 1
+    fi
+
+    # an application writes to the downstream directly
+    run_sql "INSERT INTO downstream_write_check.sentinel VALUES (100, 100);" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    ensure 10 "grep -q 'found the rows written to the downstream' $WORK_DIR/cdc.log"
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
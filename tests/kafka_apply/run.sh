@@ -0,0 +1,84 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function start_apply() {
+    cd $WORK_DIR
+    cdc.test -test.coverprofile="$OUT_DIR/cov.$TEST_NAME.apply.$1.out" apply \
+        --upstream-uri "$UPSTREAM_URI" \
+        --sink-uri "mysql://root@127.0.0.1:3306/" \
+        --log-file $WORK_DIR/cdc_apply_$1.log >> $WORK_DIR/cdc_apply_stdout_$1.log 2>&1 &
+    APPLY_PID=$!
+    cd -
+}
+
+function stop_apply() {
+    kill $APPLY_PID
+    wait $APPLY_PID || true
+}
+
+function run() {
+    # test kafka sink only in this case
+    if [ "$SINK_TYPE" == "mysql" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+
+    start_tidb_cluster --workdir $WORK_DIR
+
+    cd $WORK_DIR
+
+    start_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+
+    TOPIC_NAME="ticdc-kafka-apply-test-$RANDOM"
+    SINK_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4"
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI"
+    UPSTREAM_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?consumer-group-id=ticdc-kafka-apply-test-$RANDOM"
+    start_apply 1
+
+    run_sql "CREATE DATABASE kafka_apply;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE kafka_apply.t1(id int primary key, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    for i in $(seq 1 100); do
+        run_sql "INSERT INTO kafka_apply.t1 VALUES ($i, $i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    run_sql "UPDATE kafka_apply.t1 SET val = val + 1 WHERE id % 3 = 0;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "DELETE FROM kafka_apply.t1 WHERE id % 5 = 0;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE kafka_apply.check1(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "kafka_apply.check1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} 90
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    # the apply is resumed from the committed offsets after it's restarted
+    stop_apply
+    run_sql "ALTER TABLE kafka_apply.t1 ADD COLUMN c int DEFAULT 10;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    for i in $(seq 101 200); do
+        run_sql "INSERT INTO kafka_apply.t1 VALUES ($i, $i, $i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    run_sql "UPDATE kafka_apply.t1 SET c = c + 1 WHERE id % 7 = 0;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE kafka_apply.t2 LIKE kafka_apply.t1;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO kafka_apply.t2 SELECT * FROM kafka_apply.t1;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    start_apply 2
+    run_sql "CREATE TABLE kafka_apply.check2(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "kafka_apply.check2" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} 90
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+    # the DDL already applied is not executed again
+    if [ "$(grep -c 'apply ddl.*check1' $WORK_DIR/cdc_apply_2.log)" != "0" ]; then
+        echo "the DDL is executed again after the apply is restarted"
+        exit 1
+    fi
+
+    stop_apply
+    cleanup_process $CDC_BINARY
+    stop_tidb_cluster
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,77 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+CODECS="none gzip snappy lz4 zstd"
+
+function run() {
+    # test kafka sink only in this case
+    if [ "$SINK_TYPE" == "mysql" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    pd_addr="http://$UP_PD_HOST_1:$UP_PD_PORT_1"
+    start_ts=$(run_cdc_cli tso query --pd=$pd_addr)
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr
+
+    # each codec replicates a table by its own changefeed and topic, the
+    # messages are consumed by the kafka consumer
+    for codec in $CODECS; do
+        cat - > $WORK_DIR/changefeed_$codec.toml <<EOF_CONF
+[filter]
+rules = ['kafka_compression.t_$codec']
+EOF_CONF
+        TOPIC_NAME="ticdc-kafka-compression-$codec-test-$RANDOM"
+        SINK_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4&kafka-version=2.4.0&compression=$codec"
+        run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI" \
+            --config=$WORK_DIR/changefeed_$codec.toml --changefeed-id="kafka-compression-$codec"
+        run_kafka_consumer $WORK_DIR "kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4&version=2.4.0" "_$codec"
+    done
+
+    # zstd is rejected if the kafka version doesn't support it
+    SINK_URI="kafka://127.0.0.1:9092/ticdc-kafka-compression-rejected?kafka-version=2.0.0&compression=zstd"
+    cdc cli changefeed create --pd=$pd_addr --start-ts=$start_ts --sink-uri="$SINK_URI" > $WORK_DIR/create_rejected.log 2>&1 || true
+    if ! grep -q "ErrKafkaCodecNotSupport" $WORK_DIR/create_rejected.log; then
+        echo "the changefeed with zstd and kafka-version 2.0.0 is not rejected"
+        cat $WORK_DIR/create_rejected.log
+        exit 1
+    fi
+
+    run_sql "CREATE DATABASE kafka_compression;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    for codec in $CODECS; do
+        run_sql "CREATE table kafka_compression.t_$codec(id int primary key auto_increment, val varchar(255));" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        for i in $(seq 1 50); do
+            run_sql "INSERT INTO kafka_compression.t_$codec (val) VALUES (repeat('$codec', 32));" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        done
+    done
+    for codec in $CODECS; do
+        check_table_exists "kafka_compression.t_$codec" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    done
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    # the bytes before and after compression are exported by codec
+    curl -s http://127.0.0.1:8300/metrics > $WORK_DIR/metrics.txt
+    for codec in $CODECS; do
+        for metric in ticdc_sink_kafka_uncompressed_bytes ticdc_sink_kafka_sent_bytes; do
+            if ! grep -q "^$metric{.*changefeed=\"kafka-compression-$codec\".*compression=\"$codec\"" $WORK_DIR/metrics.txt; then
+                echo "$metric of $codec is not exported"
+                exit 1
+            fi
+        done
+    done
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,55 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function run() {
+    # test kafka sink only in this case
+    if [ "$SINK_TYPE" == "mysql" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    pd_addr="http://$UP_PD_HOST_1:$UP_PD_PORT_1"
+    start_ts=$(run_cdc_cli tso query --pd=$pd_addr)
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr
+
+    TOPIC_NAME="ticdc-kafka-idempotent-test-$RANDOM"
+    SINK_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4&enable-idempotent=true"
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI"
+    run_kafka_consumer $WORK_DIR "kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4"
+
+    run_sql "CREATE DATABASE kafka_idempotent;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE table kafka_idempotent.t1(id int primary key auto_increment, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    for i in $(seq 1 100); do
+        run_sql "INSERT INTO kafka_idempotent.t1 (val) VALUES ($i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    check_table_exists "kafka_idempotent.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    # restart the capture while the rows are being written, the idempotent
+    # producer of the new capture starts from the checkpoint
+    for i in $(seq 1 3); do
+        run_sql "UPDATE kafka_idempotent.t1 SET val = val + 1;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        cleanup_process $CDC_BINARY
+        run_sql "INSERT INTO kafka_idempotent.t1 (val) VALUES ($i),($i),($i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr --logsuffix "$i"
+    done
+
+    run_sql "CREATE table kafka_idempotent.t2(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "kafka_idempotent.t2" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,61 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function run() {
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    # the first row decoded by the mounter is malformed
+    export GO_FAILPOINTS='github.com/pingcap/ticdc/cdc/entry/MounterDecodeMalformed=1*return(true)'
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300"
+    export GO_FAILPOINTS=''
+
+    TOPIC_NAME="ticdc-malformed-row-test-$RANDOM"
+    case $SINK_TYPE in
+        kafka) SINK_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4";;
+        *) SINK_URI="mysql://root@127.0.0.1:3306/";;
+    esac
+
+    # the malformed rows can't be skipped if the completeness is required
+    if run_cdc_cli changefeed create --sink-uri="$SINK_URI" --changefeed-id="malformed-row" \
+        --sort-dir="$WORK_DIR/sort" --config="$CUR/conf/complete.toml"; then
+        echo "the changefeed skipping the malformed rows is created with require-completeness"
+        exit 1
+    fi
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --changefeed-id="malformed-row" \
+        --sort-dir="$WORK_DIR/sort" --config="$CUR/conf/changefeed.toml"
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      run_kafka_consumer $WORK_DIR "kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4"
+    fi
+
+    run_sql "CREATE DATABASE malformed_row;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE malformed_row.t1(id int primary key, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "malformed_row.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    for i in $(seq 1 10); do
+        run_sql "INSERT INTO malformed_row.t1 VALUES ($i, $i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    run_sql "CREATE TABLE malformed_row.finish_mark(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "malformed_row.finish_mark" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    # the malformed row is skipped, and the changefeed goes on
+    run_sql "SELECT count(*) AS cnt FROM malformed_row.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT} && \
+    check_contains "cnt: 9"
+    grep -q "skip the malformed row" $WORK_DIR/cdc.log
+    # the malformed row is quarantined in the sort dir
+    run_cdc_cli unsafe show-quarantine --sort-dir="$WORK_DIR/sort" --changefeed-id="malformed-row" > $WORK_DIR/quarantine.log
+    grep -q "Show 1 quarantined rows" $WORK_DIR/quarantine.log
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -186,7 +186,7 @@ func newCluster(ctx context.Context, pd string) (*cluster, error) {
 }
 
 func (c *cluster) refreshInfo(ctx context.Context) error {
-	ownerID, err := c.cdcEtcdCli.GetOwnerID(ctx, kv.CaptureOwnerKey)
+	ownerID, err := c.cdcEtcdCli.GetOwnerID(ctx, c.cdcEtcdCli.CaptureOwnerKey())
 	if err != nil {
 		return errors.Trace(err)
 	}
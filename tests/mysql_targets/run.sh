@@ -0,0 +1,158 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+MYSQL_A_CONTAINER=ticdc-mysql-targets-a
+MYSQL_A_PORT=23306
+MYSQL_B_CONTAINER=ticdc-mysql-targets-b
+MYSQL_B_PORT=23307
+
+function start_mysql() {
+    docker rm -f $1 >/dev/null 2>&1 || true
+    docker run -d --name $1 -p $2:3306 -e MYSQL_ALLOW_EMPTY_PASSWORD=yes mysql:5.7 >/dev/null
+    i=0
+    while ! mysql -uroot -h127.0.0.1 -P$2 -e "SELECT 1" >/dev/null 2>&1; do
+        ((i++))
+        if [ $i -ge 60 ]; then
+            echo "start mysql $1 failed"
+            exit 1
+        fi
+        sleep 2
+    done
+}
+
+function stop_mysql() {
+    docker rm -f $MYSQL_A_CONTAINER $MYSQL_B_CONTAINER >/dev/null 2>&1 || true
+}
+
+# check_count checks the number of the rows of the table in the downstream
+function check_count() {
+    run_sql "SELECT count(*) AS cnt FROM $1" 127.0.0.1 $2 && check_contains "cnt: $3"
+}
+
+# check_no_table checks the table doesn't exist in the downstream
+function check_no_table() {
+    run_sql "SELECT count(*) AS cnt FROM information_schema.tables WHERE table_schema = 'mysql_targets' AND table_name = '$1'" 127.0.0.1 $2 && \
+    check_contains "cnt: 0"
+}
+
+export -f check_count
+export -f check_no_table
+
+function check_checkpoint_advanced() {
+    ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    i=0
+    while true; do
+        checkpoint=$(cdc cli changefeed query --changefeed-id=$1 2>&1 | jq '.status."checkpoint-ts"')
+        if [ "$checkpoint" -gt "$ts" ]; then
+            break
+        fi
+        ((i++))
+        if [ $i -ge 30 ]; then
+            echo "the checkpoint ts $checkpoint doesn't advance to $ts"
+            exit 1
+        fi
+        sleep 2
+    done
+}
+
+function run() {
+    # the targets are only supported by the MySQL sink
+    if [ "$SINK_TYPE" != "mysql" ] || ! command -v docker >/dev/null; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    start_mysql $MYSQL_A_CONTAINER $MYSQL_A_PORT
+    start_mysql $MYSQL_B_CONTAINER $MYSQL_B_PORT
+
+    cd $WORK_DIR
+
+    run_sql "CREATE DATABASE mysql_targets;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE mysql_targets.a1 (id INT PRIMARY KEY, val INT);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE mysql_targets.b1 (id INT PRIMARY KEY, val INT);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    start_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+
+    # the tables b* are written to mysql b, the others are written to mysql a
+    SINK_URI="mysql://root@127.0.0.1:$MYSQL_A_PORT/?worker-count=4"
+    cat - >"$WORK_DIR/changefeed.toml" <<EOF_CONFIG
+[filter]
+rules = ['mysql_targets.*']
+
+[[sink.targets]]
+matcher = ['mysql_targets.b*']
+sink-uri = "mysql://root@127.0.0.1:$MYSQL_B_PORT/?worker-count=4"
+EOF_CONFIG
+
+    # the tables matching more than one target are rejected
+    cat - >"$WORK_DIR/conflict.toml" <<EOF_CONFIG
+[[sink.targets]]
+matcher = ['mysql_targets.*']
+sink-uri = "mysql://root@127.0.0.1:$MYSQL_A_PORT/"
+
+[[sink.targets]]
+matcher = ['mysql_targets.b*']
+sink-uri = "mysql://root@127.0.0.1:$MYSQL_B_PORT/"
+EOF_CONFIG
+    if cdc cli changefeed create --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1 --start-ts=$start_ts --sink-uri="$SINK_URI" \
+        --config="$WORK_DIR/conflict.toml" --changefeed-id="mysql-targets-conflict" >"$WORK_DIR/conflict.log" 2>&1; then
+        echo "the changefeed with conflicting targets is created"
+        exit 1
+    fi
+    grep -q "ErrSinkTargetConflict" "$WORK_DIR/conflict.log"
+
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI" \
+        --config="$WORK_DIR/changefeed.toml" --changefeed-id="mysql-targets"
+
+    run_sql "INSERT INTO mysql_targets.a1 VALUES (1, 1), (2, 2);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO mysql_targets.b1 VALUES (1, 1), (2, 2), (3, 3);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    ensure 20 check_count mysql_targets.a1 $MYSQL_A_PORT 2
+    ensure 20 check_count mysql_targets.b1 $MYSQL_B_PORT 3
+    check_no_table b1 $MYSQL_A_PORT
+    check_no_table a1 $MYSQL_B_PORT
+
+    # the tables created later are routed by the same rules
+    run_sql "CREATE TABLE mysql_targets.b2 (id INT PRIMARY KEY, val INT);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO mysql_targets.b2 VALUES (1, 1);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "UPDATE mysql_targets.a1 SET val = 10 WHERE id = 1;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "DELETE FROM mysql_targets.b1 WHERE id = 3;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    ensure 20 check_count mysql_targets.b2 $MYSQL_B_PORT 1
+    ensure 20 check_count mysql_targets.b1 $MYSQL_B_PORT 2
+    check_count "mysql_targets.a1 WHERE val = 10" $MYSQL_A_PORT 1
+    check_no_table b2 $MYSQL_A_PORT
+
+    # the checkpoint advances only after the rows are written to both targets
+    check_checkpoint_advanced mysql-targets
+
+    # the checkpoint stops advancing while a target is down, even if the other
+    # target is written, and it catches up once the target is back
+    docker pause $MYSQL_B_CONTAINER
+    run_sql "INSERT INTO mysql_targets.a1 VALUES (3, 3);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "INSERT INTO mysql_targets.b1 VALUES (4, 4);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    ensure 20 check_count mysql_targets.a1 $MYSQL_A_PORT 3
+    paused_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    sleep 10
+    checkpoint=$(cdc cli changefeed query --changefeed-id=mysql-targets 2>&1 | jq '.status."checkpoint-ts"')
+    if [ "$checkpoint" -gt "$paused_ts" ]; then
+        echo "the checkpoint ts $checkpoint advances while a target is down"
+        exit 1
+    fi
+    docker unpause $MYSQL_B_CONTAINER
+    ensure 60 check_count mysql_targets.b1 $MYSQL_B_PORT 3
+    check_checkpoint_advanced mysql-targets
+
+    stop_mysql
+    cleanup_process $CDC_BINARY
+}
+
+trap "stop_tidb_cluster; stop_mysql" EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,5 @@
+use `overwrite_checkpoint`;
+
+insert into t values (9, 9);
+update t set v = v + 10 where id = 5;
+create table finish_mark (id int primary key);
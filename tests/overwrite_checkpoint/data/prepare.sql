@@ -0,0 +1,6 @@
+drop database if exists `overwrite_checkpoint`;
+create database `overwrite_checkpoint`;
+use `overwrite_checkpoint`;
+
+create table t (id int primary key, v int, unique key uk(v));
+insert into t values (1, 1), (2, 2), (3, 3), (4, 4), (5, 5);
@@ -0,0 +1,8 @@
+use `overwrite_checkpoint`;
+
+insert into t values (6, 6), (7, 7), (8, 8);
+update t set v = v + 10 where id <= 3;
+delete from t where id = 4;
+create table t1 (id int primary key, v int);
+insert into t1 values (1, 1), (2, 2);
+update t1 set v = 3 where id = 2;
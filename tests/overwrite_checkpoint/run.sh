@@ -0,0 +1,94 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function wait_paused() {
+    changefeed_id=$1
+    i=0
+    while [ $i -lt 30 ]; do
+        if run_cdc_cli changefeed query --changefeed-id=$changefeed_id 2>&1 | grep -q '"clean": true'; then
+            return 0
+        fi
+        ((i++))
+        sleep 1
+    done
+    echo "changefeed $changefeed_id is not paused cleanly"
+    run_cdc_cli changefeed query --changefeed-id=$changefeed_id
+    exit 1
+}
+
+function wait_overwritten() {
+    changefeed_id=$1
+    ts=$2
+    i=0
+    while [ $i -lt 30 ]; do
+        if run_cdc_cli changefeed history --changefeed-id=$changefeed_id 2>&1 | grep -q "overwritten from [0-9]* to $ts"; then
+            return 0
+        fi
+        ((i++))
+        sleep 1
+    done
+    echo "the checkpoint ts of changefeed $changefeed_id is not overwritten"
+    run_cdc_cli changefeed history --changefeed-id=$changefeed_id
+    exit 1
+}
+
+function run() {
+    # the replayed rows are written in safe mode by the MySQL sink only
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    # record tso before we create tables to skip the system table DDLs
+    start_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+    # the rows replicated twice fail to be written without the safe mode
+    SINK_URI="mysql://root@127.0.0.1:3306/?safe-mode=false"
+    changefeed_id="overwrite-checkpoint"
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI" \
+        --config=$CUR/conf/changefeed.toml --changefeed-id=$changefeed_id
+    run_sql_file $CUR/data/prepare.sql ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists overwrite_checkpoint.t ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    # the downstream is supposed to be restored to replay_ts, the changes
+    # after it are replicated again after the changefeed is resumed from it
+    replay_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    run_sql_file $CUR/data/replay.sql ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists overwrite_checkpoint.t1 ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    run_cdc_cli changefeed pause --changefeed-id=$changefeed_id
+    wait_paused $changefeed_id
+
+    # the checkpoint ts can't be moved forward without --force
+    future_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    if run_cdc_cli changefeed resume --changefeed-id=$changefeed_id --overwrite-checkpoint-ts=$future_ts; then
+        echo "the checkpoint ts is moved forward without --force"
+        exit 1
+    fi
+
+    run_cdc_cli changefeed resume --changefeed-id=$changefeed_id --overwrite-checkpoint-ts=$replay_ts
+    wait_overwritten $changefeed_id $replay_ts
+
+    run_sql_file $CUR/data/finish.sql ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists overwrite_checkpoint.finish_mark ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,66 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+function check_changefeed_normal() {
+    changefeed_id=$1
+    info=$(run_cdc_cli changefeed query --changefeed-id=$changefeed_id -s)
+    echo "$info"
+    state=$(echo $info|jq -r '.state')
+    if [[ ! "$state" == "normal" ]]; then
+        echo "changefeed state $state does not equal to normal"
+        exit 1
+    fi
+}
+
+export -f check_changefeed_normal
+
+function run() {
+    # the duplicate rows are detected by the MySQL sink only
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    # the puller re-delivers the last 16 entries of each table after they are
+    # resolved, like the kv client does after region retries
+    export GO_FAILPOINTS='github.com/pingcap/ticdc/cdc/ProcessorPullerRedeliver=return(16)'
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300"
+    export GO_FAILPOINTS=''
+
+    # the rows are inserted instead of replaced if the safe mode is disabled,
+    # so a row reaching the sink twice fails the changefeed
+    SINK_URI="mysql://root@127.0.0.1:3306/?safe-mode=false"
+    run_cdc_cli changefeed create --sink-uri="$SINK_URI" --changefeed-id="processor-dedup"
+
+    run_sql "CREATE DATABASE processor_dedup;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE processor_dedup.t1(id int primary key auto_increment, val int);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "processor_dedup.t1" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    for i in $(seq 1 20); do
+        run_sql "INSERT INTO processor_dedup.t1(val) VALUES ($i),($i),($i);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+        run_sql "UPDATE processor_dedup.t1 SET val = val + 1 WHERE id % 3 = $(( i % 3 ));" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+    run_sql "DELETE FROM processor_dedup.t1 WHERE id % 5 = 0;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "CREATE TABLE processor_dedup.finish_mark(id int primary key);" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists "processor_dedup.finish_mark" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+    check_changefeed_normal "processor-dedup"
+    # the re-delivered entries are dropped before reaching the sink
+    grep -q "drop the duplicate event" $WORK_DIR/cdc.log
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,112 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+# PULSAR_HOME should point to an extracted apache-pulsar binary package
+PULSAR_HOME=${PULSAR_HOME:-}
+
+function start_pulsar() {
+    # generate a secret key and a token of the super user
+    $PULSAR_HOME/bin/pulsar tokens create-secret-key --output $WORK_DIR/secret.key
+    TOKEN=$($PULSAR_HOME/bin/pulsar tokens create --secret-key file://$WORK_DIR/secret.key --subject cdc)
+    echo -n $TOKEN > $WORK_DIR/token
+
+    cat - >"$WORK_DIR/standalone.conf" <<EOF2
+authenticationEnabled=true
+authenticationProviders=org.apache.pulsar.broker.authentication.AuthenticationProviderToken
+authorizationEnabled=true
+superUserRoles=cdc
+tokenSecretKey=file://$WORK_DIR/secret.key
+brokerClientAuthenticationPlugin=org.apache.pulsar.client.impl.auth.AuthenticationToken
+brokerClientAuthenticationParameters=token:$TOKEN
+EOF2
+    cat $PULSAR_HOME/conf/standalone.conf >> $WORK_DIR/standalone.conf
+    PULSAR_STANDALONE_CONF=$WORK_DIR/standalone.conf \
+        $PULSAR_HOME/bin/pulsar standalone --no-functions-worker > $WORK_DIR/pulsar.log 2>&1 &
+    i=0
+    while ! curl -s -H "Authorization: Bearer $TOKEN" http://127.0.0.1:8080/admin/v2/clusters >/dev/null; do
+        ((i++))
+        if [ $i -ge 60 ]; then
+            echo "start pulsar standalone failed"
+            exit 1
+        fi
+        sleep 2
+    done
+}
+
+function stop_pulsar() {
+    pkill -f "pulsar standalone" || true
+}
+
+function run() {
+    # test pulsar sink only in this case
+    if [ "$SINK_TYPE" == "mysql" ] || [ -z "$PULSAR_HOME" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    start_pulsar
+
+    cd $WORK_DIR
+
+    start_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+    run_sql "CREATE table test.pulsar_auth1(id int primary key, val int);"
+    run_sql "CREATE table test.pulsar_auth2(id int primary key, val int);"
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+
+    # creating changefeed with a bad token must fail at the connectivity probe
+    set +e
+    run_cdc_cli changefeed create --start-ts=$start_ts \
+        --sink-uri="pulsar://127.0.0.1:6650/ticdc-pulsar-auth?token=bad-token&connectionTimeout=5s&operationTimeout=5s" \
+        > $WORK_DIR/bad_token.log 2>&1
+    ret=$?
+    set -e
+    if [ "$ret" == 0 ]; then
+        echo "create changefeed with a bad token should fail"
+        exit 1
+    fi
+    if ! grep -q "pulsar connectivity probe failed" $WORK_DIR/bad_token.log; then
+        echo "bad token is not detected by the connectivity probe"
+        cat $WORK_DIR/bad_token.log
+        exit 1
+    fi
+
+    cat - >"$WORK_DIR/changefeed.toml" <<EOF2
+[sink]
+dispatchers = [
+    {matcher = ['test.pulsar_auth2'], dispatcher = "table", topic = "ticdc-pulsar-auth-routed"},
+]
+EOF2
+    run_cdc_cli changefeed create --start-ts=$start_ts --config=$WORK_DIR/changefeed.toml \
+        --sink-uri="pulsar://127.0.0.1:6650/ticdc-pulsar-auth?token-file=$WORK_DIR/token"
+
+    run_sql "INSERT INTO test.pulsar_auth1(id, val) VALUES (1, 1);"
+    run_sql "INSERT INTO test.pulsar_auth2(id, val) VALUES (2, 2);"
+
+    # the rows of the routed table are only sent to the routed topic
+    for topic in ticdc-pulsar-auth ticdc-pulsar-auth-routed; do
+        i=0
+        while ! curl -s -H "Authorization: Bearer $(cat $WORK_DIR/token)" \
+            "http://127.0.0.1:8080/admin/v2/persistent/public/default/$topic/stats" | grep -Eq '"msgInCounter" ?: ?[1-9]'; do
+            ((i++))
+            if [ $i -ge 30 ]; then
+                echo "no message is produced to topic $topic"
+                exit 1
+            fi
+            sleep 2
+        done
+    done
+
+    cleanup_process $CDC_BINARY
+}
+
+trap 'stop_pulsar; stop_tidb_cluster' EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,11 @@
+drop database if exists `recover_table`;
+create database `recover_table`;
+use `recover_table`;
+
+create table t1 (id int primary key, val int);
+create table t2 (id int primary key, val int);
+create table t3 (id int primary key, val int);
+
+insert into t1 values (1, 1), (2, 2);
+insert into t2 values (1, 1), (2, 2);
+insert into t3 values (1, 1), (2, 2);
@@ -0,0 +1,19 @@
+use `recover_table`;
+
+drop table t1;
+insert into t3 values (3, 3);
+recover table t1;
+insert into t1 values (3, 3);
+update t1 set val = 10 where id = 1;
+
+drop table t2;
+insert into t3 values (4, 4);
+flashback table t2 to t4;
+insert into t4 values (3, 3);
+delete from t4 where id = 1;
+
+drop table t1;
+recover table t1;
+insert into t1 values (4, 4);
+
+create table finish_mark (id int primary key);
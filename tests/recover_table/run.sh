@@ -0,0 +1,54 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+
+# the recover table DDL requires the gc safe point, which is not set in a new cluster
+GC_SAFE_POINT_SQL="INSERT IGNORE INTO mysql.tidb VALUES ('tikv_gc_safe_point', '20210101-00:00:00 +0800', '');"
+
+function run() {
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+
+    start_tidb_cluster --workdir $WORK_DIR
+
+    cd $WORK_DIR
+
+    run_sql "$GC_SAFE_POINT_SQL" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "$GC_SAFE_POINT_SQL" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+
+    # record tso before we create tables to skip the system table DDLs
+    start_ts=$(run_cdc_cli tso query --pd=http://$UP_PD_HOST_1:$UP_PD_PORT_1)
+
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY
+
+    TOPIC_NAME="ticdc-recover-table-test-$RANDOM"
+    case $SINK_TYPE in
+        kafka) SINK_URI="kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4";;
+        *) SINK_URI="mysql://root@127.0.0.1:3306/";;
+    esac
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI"
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      run_kafka_consumer $WORK_DIR "kafka://127.0.0.1:9092/$TOPIC_NAME?partition-num=4"
+    fi
+    run_sql_file $CUR/data/prepare.sql ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists recover_table.t3 ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    # drop the tables, write to the other tables, recover them and write to
+    # them again, the writes after the recovery are replicated
+    run_sql_file $CUR/data/recover.sql ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    check_table_exists recover_table.finish_mark ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_table_exists recover_table.t4 ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_sync_diff $WORK_DIR $CUR/conf/diff_config.toml
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
@@ -0,0 +1,68 @@
+#!/bin/bash
+
+set -e
+
+CUR=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
+source $CUR/../_utils/test_prepare
+WORK_DIR=$OUT_DIR/$TEST_NAME
+CDC_BINARY=cdc.test
+SINK_TYPE=$1
+MAX_RETRIES=10
+
+function check_changefeed_is_finished() {
+    changefeed=$1
+    state=$(cdc cli changefeed query -s -c=$changefeed|jq ".state"|tr -d '"')
+    if [[ "$state" != "finished" ]]; then
+        echo "state $state is not finished"
+        exit 1
+    fi
+}
+
+export -f check_changefeed_is_finished
+
+function run() {
+    # the rows are checked in the downstream MySQL
+    if [ "$SINK_TYPE" == "kafka" ]; then
+      return
+    fi
+
+    rm -rf $WORK_DIR && mkdir -p $WORK_DIR
+    start_tidb_cluster --workdir $WORK_DIR
+    cd $WORK_DIR
+
+    # the DDLs before the start ts are not replicated, the schema is created
+    # in the downstream in advance
+    for host_port in "${UP_TIDB_HOST} ${UP_TIDB_PORT}" "${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}"; do
+        run_sql "CREATE DATABASE snapshot_only;" $host_port
+        run_sql "CREATE TABLE snapshot_only.t (id int primary key, val varchar(64));" $host_port
+    done
+    for i in $(seq 1 100); do
+        run_sql "INSERT INTO snapshot_only.t VALUES ($i, 'snapshot-$i');" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    done
+
+    pd_addr="http://$UP_PD_HOST_1:$UP_PD_PORT_1"
+    run_cdc_server --workdir $WORK_DIR --binary $CDC_BINARY --addr "127.0.0.1:8300" --pd $pd_addr
+    start_ts=$(cdc cli tso query --pd=$pd_addr)
+    SINK_URI="mysql://root@127.0.0.1:3306/"
+    run_cdc_cli changefeed create --start-ts=$start_ts --sink-uri="$SINK_URI" --snapshot-only --changefeed-id="snapshot-only"
+
+    # the changes after the start ts are not replicated
+    run_sql "INSERT INTO snapshot_only.t VALUES (1000, 'after-snapshot');" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+    run_sql "DELETE FROM snapshot_only.t WHERE id = 1;" ${UP_TIDB_HOST} ${UP_TIDB_PORT}
+
+    ensure $MAX_RETRIES check_changefeed_is_finished "snapshot-only"
+    grep -q "snapshot puller is finished" $WORK_DIR/cdc.log
+
+    run_sql "SELECT COUNT(*) AS cnt FROM snapshot_only.t;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_contains "cnt: 100"
+    run_sql "SELECT val FROM snapshot_only.t WHERE id = 1;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_contains "val: snapshot-1"
+    run_sql "SELECT COUNT(*) AS cnt FROM snapshot_only.t WHERE id = 1000;" ${DOWN_TIDB_HOST} ${DOWN_TIDB_PORT}
+    check_contains "cnt: 0"
+
+    cleanup_process $CDC_BINARY
+}
+
+trap stop_tidb_cluster EXIT
+run $*
+echo "[$(date)] <<<<<< run test case $TEST_NAME success! >>>>>>"
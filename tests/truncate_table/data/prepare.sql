@@ -0,0 +1,14 @@
+drop database if exists `truncate_table`;
+create database `truncate_table`;
+use `truncate_table`;
+
+create table t1 (id int primary key, val int);
+create table t2 (id int primary key, val int)
+partition by range (id) (
+    partition p0 values less than (100),
+    partition p1 values less than (200),
+    partition p2 values less than maxvalue
+);
+
+insert into t1 values (1, 1), (2, 2);
+insert into t2 values (1, 1), (101, 101), (201, 201);
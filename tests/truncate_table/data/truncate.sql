@@ -0,0 +1,19 @@
+use `truncate_table`;
+
+truncate table t1;
+insert into t1 values (3, 3), (4, 4);
+update t1 set val = 30 where id = 3;
+
+truncate table t2;
+insert into t2 values (2, 2), (102, 102), (202, 202);
+
+alter table t2 truncate partition p1;
+insert into t2 values (103, 103);
+delete from t2 where id = 2;
+
+truncate table t1;
+insert into t1 values (5, 5);
+truncate table t1;
+insert into t1 values (6, 6);
+
+create table finish_mark (id int primary key);